@@ -223,6 +223,20 @@ func getVersionFromGit() string {
 	return version
 }
 
+// getCommitFromGit returns the hash of the currently checked out git commit.
+func getCommitFromGit() string {
+	cmd := exec.Command("git", "rev-parse", "HEAD")
+	out, err := cmd.Output()
+	if err != nil {
+		verbosePrintf("git rev-parse returned error: %v\n", err)
+		return ""
+	}
+
+	commit := strings.TrimSpace(string(out))
+	verbosePrintf("git commit is %s\n", commit)
+	return commit
+}
+
 // Constants represents a set of constants that are set in the final binary to
 // the given value via compiler flags.
 type Constants map[string]string
@@ -420,6 +434,9 @@ func main() {
 	if version != "" {
 		constants["main.version"] = version
 	}
+	if commit := getCommitFromGit(); commit != "" {
+		constants["main.commit"] = commit
+	}
 	ldflags := constants.LDFlags()
 	if !preserveSymbols {
 		// Strip debug symbols.
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/restic/restic/internal/checker"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// Severities of the findings in a check report. Hints describe non-critical
+// issues, which do not cause the check to fail.
+const (
+	checkSeverityError = "error"
+	checkSeverityHint  = "hint"
+)
+
+// checkReport is the JSON document written by `check --out-file`.
+type checkReport struct {
+	RepositoryID string               `json:"repository_id,omitempty"`
+	Version      string               `json:"restic_version"`
+	Options      checkReportOptions   `json:"options"`
+	StartedAt    time.Time            `json:"started_at"`
+	FinishedAt   time.Time            `json:"finished_at"`
+	Success      bool                 `json:"success"`
+	Error        string               `json:"error,omitempty"`
+	Phases       []*checkPhaseResult  `json:"phases"`
+	Findings     []checkFinding       `json:"findings"`
+	ReadData     *checkReadDataResult `json:"read_data,omitempty"`
+	Estimate     *checkCostEstimate   `json:"estimate,omitempty"`
+}
+
+type checkReportOptions struct {
+	ReadData           bool   `json:"read_data"`
+	ReadDataSubset     string `json:"read_data_subset,omitempty"`
+	CheckUnused        bool   `json:"check_unused"`
+	WithCache          bool   `json:"with_cache"`
+	VerifySnapshotKeys bool   `json:"verify_snapshot_keys"`
+}
+
+// checkPhaseResult counts the findings of a phase of the check.
+type checkPhaseResult struct {
+	Name   string `json:"name"`
+	Errors int    `json:"errors"`
+	Hints  int    `json:"hints"`
+}
+
+// checkFinding is a single problem found by check. Kind classifies the
+// problem, ID is the ID of the affected pack, index, tree, snapshot or blob,
+// if known.
+type checkFinding struct {
+	Phase    string `json:"phase"`
+	Severity string `json:"severity"`
+	Kind     string `json:"kind"`
+	ID       string `json:"id,omitempty"`
+	Message  string `json:"message"`
+}
+
+// checkReadDataResult lists the packs whose data was read. For random subsets
+// Seed allows reproducing the selection for an unchanged repository.
+type checkReadDataResult struct {
+	Selection string   `json:"selection"`
+	Seed      *int64   `json:"seed,omitempty"`
+	PackCount int      `json:"pack_count"`
+	Packs     []string `json:"packs"`
+}
+
+func newCheckReport(opts CheckOptions) *checkReport {
+	return &checkReport{
+		Version: version,
+		Options: checkReportOptions{
+			ReadData:           opts.ReadData,
+			ReadDataSubset:     opts.ReadDataSubset,
+			CheckUnused:        opts.CheckUnused,
+			WithCache:          opts.WithCache,
+			VerifySnapshotKeys: opts.VerifySnapshotKeys,
+		},
+		StartedAt: time.Now(),
+		Phases:    []*checkPhaseResult{},
+		Findings:  []checkFinding{},
+	}
+}
+
+// startPhase begins a new phase, subsequent findings are attributed to it.
+func (r *checkReport) startPhase(name string) {
+	r.Phases = append(r.Phases, &checkPhaseResult{Name: name})
+}
+
+func (r *checkReport) add(severity, kind string, id restic.ID, msg string) {
+	f := checkFinding{Severity: severity, Kind: kind, Message: msg}
+	if !id.IsNull() {
+		f.ID = id.String()
+	}
+	if len(r.Phases) > 0 {
+		phase := r.Phases[len(r.Phases)-1]
+		f.Phase = phase.Name
+		if severity == checkSeverityHint {
+			phase.Hints++
+		} else {
+			phase.Errors++
+		}
+	}
+	r.Findings = append(r.Findings, f)
+}
+
+// addError records an error returned by the checker.
+func (r *checkReport) addError(severity string, err error) {
+	var id restic.ID
+	kind := "other"
+
+	switch e := err.(type) {
+	case *checker.ErrDuplicatePacks:
+		kind, id = "duplicate-pack", e.PackID
+	case *checker.ErrOldIndexFormat:
+		kind, id = "old-index-format", e.ID
+	case *checker.ErrMixedPack:
+		kind, id = "mixed-pack", e.PackID
+	case *checker.PackError:
+		kind, id = "pack", e.ID
+		if e.Orphaned {
+			kind = "orphaned-pack"
+		}
+	case *checker.TreeError:
+		for _, treeErr := range e.Errors {
+			r.add(severity, "tree", e.ID, treeErr.Error())
+		}
+		return
+	case *checker.Error:
+		kind, id = "tree", e.TreeID
+	case *checker.SnapshotKeyError:
+		kind, id = "snapshot-key", e.SnapshotID
+	default:
+		if err == checker.ErrLegacyLayout {
+			kind = "legacy-layout"
+		}
+	}
+
+	r.add(severity, kind, id, err.Error())
+}
+
+// setReadData records the packs selected to be read.
+func (r *checkReport) setReadData(selection string, seed *int64, packs map[restic.ID]int64) {
+	ids := make([]string, 0, len(packs))
+	for id := range packs {
+		ids = append(ids, id.String())
+	}
+	sort.Strings(ids)
+
+	r.ReadData = &checkReadDataResult{
+		Selection: selection,
+		Seed:      seed,
+		PackCount: len(ids),
+		Packs:     ids,
+	}
+}
+
+// finish sets the end time and the final result of the check.
+func (r *checkReport) finish(err error) {
+	r.FinishedAt = time.Now()
+	r.Success = err == nil
+	if err != nil {
+		r.Error = err.Error()
+	}
+}
+
+// writeFile writes the report as JSON to filename.
+func (r *checkReport) writeFile(filename string) error {
+	buf, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	buf = append(buf, '\n')
+
+	err = os.WriteFile(filename, buf, 0644)
+	if err != nil {
+		return errors.Fatalf("unable to write check report: %v", err)
+	}
+	return nil
+}
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"os"
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/restic/restic/internal/debug"
 )
@@ -56,9 +58,93 @@ func RunCleanupHandlers(code int) int {
 	return code
 }
 
+// gracefulShutdownTimeout is the maximum duration to wait for commands to
+// finish their current uploads after the first SIGINT.
+var gracefulShutdownTimeout = 5 * time.Minute
+
+var gracefulShutdown struct {
+	sync.Mutex
+	cancel      map[int]context.CancelFunc
+	next        int
+	interrupted bool
+	timer       *time.Timer
+}
+
+// withGracefulShutdown returns a context which is cancelled when SIGINT is
+// received. Until the returned function is called, the first SIGINT only
+// cancels the context instead of terminating restic, so that the command can
+// stop starting new work and leave the repository in a consistent state. A
+// second SIGINT or the expiry of gracefulShutdownTimeout terminate restic as
+// usual.
+func withGracefulShutdown(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	gracefulShutdown.Lock()
+	defer gracefulShutdown.Unlock()
+
+	if len(gracefulShutdown.cancel) == 0 {
+		// reset the state for integration tests
+		gracefulShutdown.cancel = make(map[int]context.CancelFunc)
+		gracefulShutdown.interrupted = false
+	}
+
+	id := gracefulShutdown.next
+	gracefulShutdown.next++
+	gracefulShutdown.cancel[id] = cancel
+
+	return ctx, func() {
+		cancel()
+
+		gracefulShutdown.Lock()
+		defer gracefulShutdown.Unlock()
+
+		delete(gracefulShutdown.cancel, id)
+		if len(gracefulShutdown.cancel) == 0 && gracefulShutdown.timer != nil {
+			gracefulShutdown.timer.Stop()
+			gracefulShutdown.timer = nil
+		}
+	}
+}
+
+// startGracefulShutdown cancels all contexts returned by withGracefulShutdown
+// and returns true, unless there are none or this is not the first SIGINT.
+func startGracefulShutdown() bool {
+	gracefulShutdown.Lock()
+	defer gracefulShutdown.Unlock()
+
+	if gracefulShutdown.interrupted || len(gracefulShutdown.cancel) == 0 {
+		return false
+	}
+
+	gracefulShutdown.interrupted = true
+	for _, cancel := range gracefulShutdown.cancel {
+		cancel()
+	}
+
+	gracefulShutdown.timer = time.AfterFunc(gracefulShutdownTimeout, func() {
+		Warnf("%scurrent uploads did not finish within %v, aborting\n", clearLine(0), gracefulShutdownTimeout)
+		Exit(exitCodeInterrupted)
+	})
+	return true
+}
+
+// wasInterrupted returns true if a graceful shutdown was started by SIGINT.
+func wasInterrupted() bool {
+	gracefulShutdown.Lock()
+	defer gracefulShutdown.Unlock()
+
+	return gracefulShutdown.interrupted
+}
+
 // CleanupHandler handles the SIGINT signals.
 func CleanupHandler(c <-chan os.Signal) {
 	for s := range c {
+		if s == syscall.SIGINT && startGracefulShutdown() {
+			debug.Log("signal %v received, starting graceful shutdown", s)
+			Warnf("%ssignal %v received, finishing current uploads, press Ctrl-C again to abort immediately\n", clearLine(0), s)
+			continue
+		}
+
 		debug.Log("signal %v received, cleaning up", s)
 		Warnf("%ssignal %v received, cleaning up\n", clearLine(0), s)
 
@@ -71,7 +157,7 @@ func CleanupHandler(c <-chan os.Signal) {
 		code := 0
 
 		if s == syscall.SIGINT {
-			code = 130
+			code = exitCodeInterrupted
 		} else {
 			code = 1
 		}
@@ -19,9 +19,13 @@ import (
 	"golang.org/x/sync/errgroup"
 
 	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/local"
+	"github.com/restic/restic/internal/checker"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/pack"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/textfile"
@@ -42,6 +46,9 @@ EXIT STATUS
 
 Exit status is 0 if the command was successful.
 Exit status is 1 if there was a fatal error (no snapshot created).
+Exit status is 1 if --verify-uploads found damaged packs (snapshot created).
+Exit status is 1 if --require-nonempty is set and a target contains no files
+or is stored on a different file system than in the parent snapshot (snapshot created).
 Exit status is 3 if some source data could not be read (incomplete snapshot created).
 `,
 	PreRun: func(cmd *cobra.Command, args []string) {
@@ -65,7 +72,7 @@ Exit status is 3 if some source data could not be read (incomplete snapshot crea
 			wg.Wait()
 		}()
 
-		term := termstatus.New(globalOptions.stdout, globalOptions.stderr, globalOptions.Quiet)
+		term := termstatus.New(globalOptions.stdout, globalOptions.stderr, globalOptions.Quiet || globalOptions.NoProgress)
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
@@ -88,28 +95,41 @@ Exit status is 3 if some source data could not be read (incomplete snapshot crea
 type BackupOptions struct {
 	excludePatternOptions
 
-	Parent            string
-	GroupBy           restic.SnapshotGroupByOptions
-	Force             bool
-	ExcludeOtherFS    bool
-	ExcludeIfPresent  []string
-	ExcludeCaches     bool
-	ExcludeLargerThan string
-	Stdin             bool
-	StdinFilename     string
-	Tags              restic.TagLists
-	Host              string
-	FilesFrom         []string
-	FilesFromVerbatim []string
-	FilesFromRaw      []string
-	TimeStamp         string
-	WithAtime         bool
-	IgnoreInode       bool
-	IgnoreCtime       bool
-	UseFsSnapshot     bool
-	DryRun            bool
-	ReadConcurrency   uint
-	NoScan            bool
+	Parent             string
+	ParentFromHost     string
+	GroupBy            restic.SnapshotGroupByOptions
+	Force              bool
+	ExcludeOtherFS     bool
+	ExcludeIfPresent   []string
+	ExcludeCaches      bool
+	ExcludeLargerThan  string
+	ExcludeNoDump      bool
+	ExcludeFileAttrs   []string
+	ExcludeIgnoreFiles []string
+	Stdin              bool
+	StdinFilename      string
+	Tags               restic.TagLists
+	Host               string
+	FilesFrom          []string
+	FilesFromVerbatim  []string
+	FilesFromRaw       []string
+	TimeStamp          string
+	WithAtime          bool
+	IgnoreInode        bool
+	IgnoreCtime        bool
+	MtimeResolution    time.Duration
+	UseFsSnapshot      bool
+	DryRun             bool
+	ReadConcurrency    uint
+	NoScan             bool
+	SetPaths           []string
+	VerifyUploads      string
+	RequireNonempty    bool
+	NoExcludeRepo      bool
+	FsyncRepo          bool
+
+	// fsTestHook is used by tests to wrap the file system read by the backup
+	fsTestHook func(fs.FS) fs.FS
 }
 
 var backupOptions BackupOptions
@@ -121,7 +141,8 @@ func init() {
 	cmdRoot.AddCommand(cmdBackup)
 
 	f := cmdBackup.Flags()
-	f.StringVar(&backupOptions.Parent, "parent", "", "use this parent `snapshot` (default: latest snapshot in the group determined by --group-by and not newer than the timestamp determined by --time)")
+	f.StringVar(&backupOptions.Parent, "parent", "", "use this parent `snapshot`, or 'none' to not use a parent (default: latest snapshot in the group determined by --group-by and not newer than the timestamp determined by --time)")
+	f.StringVar(&backupOptions.ParentFromHost, "parent-from-host", "", "use the latest snapshot of `hostname` as parent if there is no parent snapshot for this host, e.g. for a new host cloned from a template")
 	backupOptions.GroupBy = restic.SnapshotGroupByOptions{Host: true, Path: true}
 	f.VarP(&backupOptions.GroupBy, "group-by", "g", "`group` snapshots by host, paths and/or tags, separated by comma (disable grouping with '')")
 	f.BoolVarP(&backupOptions.Force, "force", "f", false, `force re-reading the target files/directories (overrides the "parent" flag)`)
@@ -132,8 +153,12 @@ func init() {
 	f.StringArrayVar(&backupOptions.ExcludeIfPresent, "exclude-if-present", nil, "takes `filename[:header]`, exclude contents of directories containing filename (except filename itself) if header of that file is as provided (can be specified multiple times)")
 	f.BoolVar(&backupOptions.ExcludeCaches, "exclude-caches", false, `excludes cache directories that are marked with a CACHEDIR.TAG file. See https://bford.info/cachedir/ for the Cache Directory Tagging Standard`)
 	f.StringVar(&backupOptions.ExcludeLargerThan, "exclude-larger-than", "", "max `size` of the files to be backed up (allowed suffixes: k/K, m/M, g/G, t/T)")
+	f.BoolVar(&backupOptions.ExcludeNoDump, "exclude-nodump", false, "exclude files and directories with the nodump flag set (only supported on BSD and macOS)")
+	f.StringSliceVar(&backupOptions.ExcludeFileAttrs, "exclude-file-attrs", nil, "exclude files and directories with any of the Windows file `attributes` set, e.g. TEMPORARY,OFFLINE,SYSTEM (only supported on Windows, can be specified multiple times)")
+	f.StringArrayVar(&backupOptions.ExcludeIgnoreFiles, "exclude-ignorefiles", nil, "exclude files matching the patterns in ignore files called `filename` in their parent directories, similar to .gitignore (can be specified multiple times)")
 	f.BoolVar(&backupOptions.Stdin, "stdin", false, "read backup from stdin")
-	f.StringVar(&backupOptions.StdinFilename, "stdin-filename", "stdin", "`filename` to use when reading from stdin")
+	f.StringVar(&backupOptions.StdinFilename, "stdin-filename", "stdin", "`filename` to use when reading from stdin, can include directories (e.g. backups/dump.sql)")
+	f.StringArrayVar(&backupOptions.SetPaths, "set-path", nil, "record the target as absolute `path` in the snapshot, paired with the targets in the given order (can be specified multiple times)")
 	f.Var(&backupOptions.Tags, "tag", "add `tags` for the new snapshot in the format `tag[,tag,...]` (can be specified multiple times)")
 	f.UintVar(&backupOptions.ReadConcurrency, "read-concurrency", 0, "read `n` files concurrently (default: $RESTIC_READ_CONCURRENCY or 2)")
 	f.StringVarP(&backupOptions.Host, "host", "H", "", "set the `hostname` for the snapshot manually. To prevent an expensive rescan use the \"parent\" flag")
@@ -150,8 +175,14 @@ func init() {
 	f.BoolVar(&backupOptions.WithAtime, "with-atime", false, "store the atime for all files and directories")
 	f.BoolVar(&backupOptions.IgnoreInode, "ignore-inode", false, "ignore inode number changes when checking for modified files")
 	f.BoolVar(&backupOptions.IgnoreCtime, "ignore-ctime", false, "ignore ctime changes when checking for modified files")
+	f.DurationVar(&backupOptions.MtimeResolution, "mtime-resolution", 0, "round timestamps down to `duration` when checking for modified files, e.g. 2s for FAT (default: detected from the file system)")
 	f.BoolVarP(&backupOptions.DryRun, "dry-run", "n", false, "do not upload or write any data, just show what would be done")
 	f.BoolVar(&backupOptions.NoScan, "no-scan", false, "do not run scanner to estimate size of backup")
+	f.StringVar(&backupOptions.VerifyUploads, "verify-uploads", "", "download and verify the packs uploaded by this backup, use 'sample:x%' to only verify a random `subset`")
+	f.Lookup("verify-uploads").NoOptDefVal = "all"
+	f.BoolVar(&backupOptions.NoExcludeRepo, "no-exclude-repo", false, "do not exclude a local repository located within a target from the backup")
+	f.BoolVar(&backupOptions.FsyncRepo, "fsync-repo", false, "flush the files written to the repository to stable storage before reporting success (only local and sftp backends)")
+	f.BoolVar(&backupOptions.RequireNonempty, "require-nonempty", false, "fail if a target directory contains no files or is on a different file system than in the parent snapshot")
 	if runtime.GOOS == "windows" {
 		f.BoolVar(&backupOptions.UseFsSnapshot, "use-fs-snapshot", false, "use filesystem snapshot where possible (currently only Windows VSS)")
 	}
@@ -175,7 +206,7 @@ func filterExisting(items []string) (result []string, err error) {
 	}
 
 	if len(result) == 0 {
-		return nil, errors.Fatal("all target directories/files do not exist")
+		return nil, invalidArguments(errors.Fatal("all target directories/files do not exist"))
 	}
 
 	return
@@ -276,7 +307,7 @@ func readFilenamesRaw(r io.Reader) (names []string, err error) {
 func (opts BackupOptions) Check(gopts GlobalOptions, args []string) error {
 	if gopts.password == "" {
 		if opts.Stdin {
-			return errors.Fatal("cannot read both password and data from stdin")
+			return invalidArguments(errors.Fatal("cannot read both password and data from stdin"))
 		}
 
 		filesFrom := append(append(opts.FilesFrom, opts.FilesFromVerbatim...), opts.FilesFromRaw...)
@@ -289,36 +320,122 @@ func (opts BackupOptions) Check(gopts GlobalOptions, args []string) error {
 
 	if opts.Stdin {
 		if len(opts.FilesFrom) > 0 {
-			return errors.Fatal("--stdin and --files-from cannot be used together")
+			return invalidArguments(errors.Fatal("--stdin and --files-from cannot be used together"))
 		}
 		if len(opts.FilesFromVerbatim) > 0 {
-			return errors.Fatal("--stdin and --files-from-verbatim cannot be used together")
+			return invalidArguments(errors.Fatal("--stdin and --files-from-verbatim cannot be used together"))
 		}
 		if len(opts.FilesFromRaw) > 0 {
-			return errors.Fatal("--stdin and --files-from-raw cannot be used together")
+			return invalidArguments(errors.Fatal("--stdin and --files-from-raw cannot be used together"))
 		}
 
 		if len(args) > 0 {
-			return errors.Fatal("--stdin was specified and files/dirs were listed as arguments")
+			return invalidArguments(errors.Fatal("--stdin was specified and files/dirs were listed as arguments"))
 		}
+
+		if path.Join("/", opts.StdinFilename) == "/" {
+			return invalidArguments(errors.Fatal("--stdin-filename must not be empty"))
+		}
+	}
+
+	if len(opts.SetPaths) > 0 {
+		if opts.Stdin || len(opts.FilesFrom) > 0 || len(opts.FilesFromVerbatim) > 0 || len(opts.FilesFromRaw) > 0 {
+			return invalidArguments(errors.Fatal("--set-path can only be used with targets passed as arguments"))
+		}
+		if len(opts.SetPaths) != len(args) {
+			return invalidArgumentsf("--set-path must be specified once for each target, got %d paths for %d targets", len(opts.SetPaths), len(args))
+		}
+		for _, p := range opts.SetPaths {
+			if !filepath.IsAbs(p) {
+				return invalidArgumentsf("path %q passed to --set-path is not absolute", p)
+			}
+		}
+	}
+
+	if opts.ParentFromHost != "" {
+		if opts.Parent != "" {
+			return invalidArguments(errors.Fatal("--parent and --parent-from-host cannot be used together"))
+		}
+		if !opts.GroupBy.Host {
+			return invalidArguments(errors.Fatal("--parent-from-host requires that snapshots are grouped by host"))
+		}
+	}
+
+	if opts.VerifyUploads != "" {
+		if opts.DryRun {
+			return invalidArguments(errors.Fatal("--verify-uploads and --dry-run cannot be used together"))
+		}
+		if _, err := parseVerifyUploads(opts.VerifyUploads); err != nil {
+			return invalidArgumentsf("--verify-uploads: %v", err)
+		}
+	}
+
+	if opts.MtimeResolution < 0 {
+		return invalidArguments(errors.Fatal("--mtime-resolution must not be negative"))
 	}
 
 	return nil
 }
 
-// collectRejectByNameFuncs returns a list of all functions which may reject data
-// from being saved in a snapshot based on path only
-func collectRejectByNameFuncs(opts BackupOptions, repo *repository.Repository) (fs []RejectByNameFunc, err error) {
-	// exclude restic cache
-	if repo.Cache != nil {
-		f, err := rejectResticCache(repo)
-		if err != nil {
-			return nil, err
-		}
+// enableRepoSync requests the backend of repo to flush all written files to
+// stable storage. If the backend cannot do this, a warning is printed and nil
+// is returned.
+func enableRepoSync(repo restic.Repository) restic.Syncer {
+	syncer := restic.AsBackend[restic.Syncer](repo.Backend())
+	if syncer == nil {
+		Warnf("warning: the backend does not support --fsync-repo, written files may not be on stable storage yet\n")
+		return nil
+	}
+	if err := syncer.EnableSync(); err != nil {
+		Warnf("warning: --fsync-repo is not supported: %v\n", err)
+		return nil
+	}
+	return syncer
+}
 
-		fs = append(fs, f)
+// parseVerifyUploads returns the percentage of uploaded packs to verify for
+// the --verify-uploads option, which is either "all" or "sample:x%".
+func parseVerifyUploads(s string) (float64, error) {
+	if s == "all" {
+		return 100, nil
+	}
+
+	if !strings.HasPrefix(s, "sample:") {
+		return 0, errors.Errorf("invalid value %q, expected 'all' or 'sample:x%%'", s)
+	}
+	percentage, err := parsePercentage(strings.TrimPrefix(s, "sample:"))
+	if err != nil {
+		return 0, err
+	}
+	if percentage <= 0.0 || percentage > 100.0 {
+		return 0, errors.Errorf("percentage %v%% is not between 0%% and 100%%", percentage)
+	}
+	return percentage, nil
+}
+
+// collectSnapshotPaths returns the path recorded in the snapshot for each
+// target. The paths passed via --set-path are paired with the targets passed
+// as arguments. If --set-path is not used, nil is returned.
+func collectSnapshotPaths(opts BackupOptions, args, targets []string) ([]string, error) {
+	if len(opts.SetPaths) == 0 {
+		return nil, nil
 	}
 
+	// the targets are the arguments without the ones which do not exist
+	if len(targets) != len(args) {
+		return nil, errors.Fatal("all targets must exist when using --set-path")
+	}
+
+	paths := make([]string, 0, len(opts.SetPaths))
+	for _, p := range opts.SetPaths {
+		paths = append(paths, filepath.Clean(p))
+	}
+	return paths, nil
+}
+
+// collectRejectByNameFuncs returns a list of all functions which may reject data
+// from being saved in a snapshot based on path only
+func collectRejectByNameFuncs(opts BackupOptions) (fs []RejectByNameFunc, err error) {
 	fsPatterns, err := opts.excludePatternOptions.CollectPatterns()
 	if err != nil {
 		return nil, err
@@ -342,13 +459,44 @@ func collectRejectByNameFuncs(opts BackupOptions, repo *repository.Repository) (
 }
 
 // collectRejectFuncs returns a list of all functions which may reject data
-// from being saved in a snapshot based on path and file info
-func collectRejectFuncs(opts BackupOptions, targets []string) (fs []RejectFunc, err error) {
+// from being saved in a snapshot based on path and file info. It also returns
+// the directories of restic which are excluded because they are located
+// within a target.
+func collectRejectFuncs(opts BackupOptions, targets []string, repo *repository.Repository) (fs []RejectFunc, excluded []resticDir, err error) {
+	// exclude the restic cache and a local repository
+	if !opts.Stdin {
+		var dirs []resticDir
+		if repo.Cache != nil {
+			d, err := newResticDir(repo.Cache.BaseDir(), "restic cache directory")
+			if err != nil {
+				return nil, nil, err
+			}
+			dirs = append(dirs, d)
+		}
+
+		if be := restic.AsBackend[*local.Local](repo.Backend()); be != nil && !opts.NoExcludeRepo {
+			d, err := newResticDir(be.Path, "restic repository")
+			if err != nil {
+				return nil, nil, err
+			}
+			dirs = append(dirs, d)
+		}
+
+		if len(dirs) > 0 {
+			f, inside, err := rejectResticDirs(dirs, targets)
+			if err != nil {
+				return nil, nil, err
+			}
+			fs = append(fs, f)
+			excluded = inside
+		}
+	}
+
 	// allowed devices
 	if opts.ExcludeOtherFS && !opts.Stdin {
 		f, err := rejectByDevice(targets)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		fs = append(fs, f)
 	}
@@ -356,12 +504,44 @@ func collectRejectFuncs(opts BackupOptions, targets []string) (fs []RejectFunc,
 	if len(opts.ExcludeLargerThan) != 0 && !opts.Stdin {
 		f, err := rejectBySize(opts.ExcludeLargerThan)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		fs = append(fs, f)
 	}
 
-	return fs, nil
+	if opts.ExcludeNoDump && !opts.Stdin {
+		if f := rejectNoDump(); f != nil {
+			fs = append(fs, f)
+		} else {
+			Warnf("--exclude-nodump is not supported on this platform, ignoring it\n")
+		}
+	}
+
+	if len(opts.ExcludeFileAttrs) > 0 && !opts.Stdin {
+		attrs, err := parseFileAttributes(opts.ExcludeFileAttrs)
+		if err != nil {
+			return nil, nil, err
+		}
+		if f := rejectByFileAttributes(attrs); f != nil {
+			fs = append(fs, f)
+		} else {
+			Warnf("--exclude-file-attrs is only supported on Windows, ignoring it\n")
+		}
+	}
+
+	// ignore files can only exclude additional items, their negated patterns
+	// do not include items again which are rejected by other options
+	if !opts.Stdin {
+		for _, filename := range opts.ExcludeIgnoreFiles {
+			f, err := rejectByIgnoreFiles(filename)
+			if err != nil {
+				return nil, nil, err
+			}
+			fs = append(fs, f)
+		}
+	}
+
+	return fs, excluded, nil
 }
 
 // collectTargets returns a list of target files/dirs from several sources.
@@ -420,7 +600,7 @@ func collectTargets(opts BackupOptions, args []string) (targets []string, err er
 	// and have the ability to use both files-from and args at the same time.
 	targets = append(targets, args...)
 	if len(targets) == 0 && !opts.Stdin {
-		return nil, errors.Fatal("nothing to backup, please specify target files/dirs")
+		return nil, invalidArguments(errors.Fatal("nothing to backup, please specify target files/dirs"))
 	}
 
 	targets, err = filterExisting(targets)
@@ -434,26 +614,49 @@ func collectTargets(opts BackupOptions, args []string) (targets []string, err er
 // parent returns the ID of the parent snapshot. If there is none, nil is
 // returned.
 func findParentSnapshot(ctx context.Context, repo restic.Repository, opts BackupOptions, targets []string, timeStampLimit time.Time) (*restic.Snapshot, error) {
-	if opts.Force {
+	if opts.Force || opts.Parent == "none" {
 		return nil, nil
 	}
 
 	snName := opts.Parent
+	f := restic.SnapshotFilter{TimestampLimit: timeStampLimit}
 	if snName == "" {
 		snName = "latest"
+		// another backup may be writing a snapshot concurrently, only use
+		// snapshots which can be loaded completely
+		f.LoadErrorFn = func(id restic.ID, err error) {
+			Warnf("ignoring snapshot %v while searching the parent snapshot: %v\n", id.Str(), err)
+		}
 	}
-	f := restic.SnapshotFilter{TimestampLimit: timeStampLimit}
 	if opts.GroupBy.Host {
 		f.Hosts = []string{opts.Host}
 	}
 	if opts.GroupBy.Path {
+		// the parent must have been created for exactly these targets
 		f.Paths = targets
+		f.ExactPaths = true
 	}
 	if opts.GroupBy.Tag {
 		f.Tags = []restic.TagList{opts.Tags.Flatten()}
 	}
 
-	sn, _, err := f.FindLatest(ctx, repo.Backend(), repo, snName)
+	var be restic.Lister = repo.Backend()
+	if opts.ParentFromHost != "" {
+		// the snapshots may be searched twice, only list them once
+		var err error
+		be, err = backend.MemorizeList(ctx, be, restic.SnapshotFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sn, _, err := f.FindLatest(ctx, be, repo, snName)
+	if opts.ParentFromHost != "" && errors.Is(err, restic.ErrNoSnapshotFound) {
+		// the paths are still matched exactly, only the host differs
+		debug.Log("no parent for host %v, using snapshots of host %v", opts.Host, opts.ParentFromHost)
+		f.Hosts = []string{opts.ParentFromHost}
+		sn, _, err = f.FindLatest(ctx, be, repo, snName)
+	}
 	// Snapshot not found is ok if no explicit parent was set
 	if opts.Parent == "" && errors.Is(err, restic.ErrNoSnapshotFound) {
 		err = nil
@@ -467,16 +670,27 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 		return err
 	}
 
+	if !opts.DryRun {
+		if err := checkReadOnly(gopts, "backup"); err != nil {
+			return err
+		}
+	}
+
 	targets, err := collectTargets(opts, args)
 	if err != nil {
 		return err
 	}
+	snapshotPaths, err := collectSnapshotPaths(opts, args, targets)
+	if err != nil {
+		return err
+	}
 
-	timeStamp := time.Now()
+	backupStart := time.Now()
+	timeStamp := backupStart
 	if opts.TimeStamp != "" {
 		timeStamp, err = time.ParseInLocation(TimeFormat, opts.TimeStamp, time.Local)
 		if err != nil {
-			return errors.Fatalf("error in time option: %v\n", err)
+			return invalidArgumentsf("error in time option: %v\n", err)
 		}
 	}
 
@@ -496,13 +710,19 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 		progressPrinter = backup.NewTextProgress(term, gopts.verbosity)
 	}
 	progressReporter := backup.NewProgress(progressPrinter,
-		calculateProgressInterval(!gopts.Quiet, gopts.JSON))
+		calculateProgressInterval(gopts, !gopts.Quiet, gopts.JSON))
 	defer progressReporter.Done()
+	defer ui.RegisterStatus(progressReporter.Status)()
 
 	if opts.DryRun {
 		repo.SetDryRun()
 	}
 
+	var syncer restic.Syncer
+	if opts.FsyncRepo && !opts.DryRun {
+		syncer = enableRepoSync(repo)
+	}
+
 	if !gopts.JSON {
 		progressPrinter.V("lock repository")
 	}
@@ -516,26 +736,44 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 	}
 
 	// rejectByNameFuncs collect functions that can reject items from the backup based on path only
-	rejectByNameFuncs, err := collectRejectByNameFuncs(opts, repo)
+	rejectByNameFuncs, err := collectRejectByNameFuncs(opts)
 	if err != nil {
 		return err
 	}
 
 	// rejectFuncs collect functions that can reject items from the backup based on path and file info
-	rejectFuncs, err := collectRejectFuncs(opts, targets)
+	rejectFuncs, excludedDirs, err := collectRejectFuncs(opts, targets, repo)
 	if err != nil {
 		return err
 	}
 
+	if !gopts.JSON {
+		for _, d := range excludedDirs {
+			progressPrinter.P("excluding the %v at %v from the backup\n", d.reason, d.paths[0])
+		}
+	}
+
 	var parentSnapshot *restic.Snapshot
 	if !opts.Stdin {
-		parentSnapshot, err = findParentSnapshot(ctx, repo, opts, targets, timeStamp)
+		// the parent snapshot must contain the paths recorded in the snapshot
+		parentPaths := targets
+		if snapshotPaths != nil {
+			parentPaths = snapshotPaths
+		}
+		// ignore snapshots created by concurrent backups which started after this one
+		timeStampLimit := timeStamp
+		if timeStampLimit.After(backupStart) {
+			timeStampLimit = backupStart
+		}
+		parentSnapshot, err = findParentSnapshot(ctx, repo, opts, parentPaths, timeStampLimit)
 		if err != nil {
 			return err
 		}
 
 		if !gopts.JSON {
-			if parentSnapshot != nil {
+			if parentSnapshot != nil && parentSnapshot.Hostname != opts.Host {
+				progressPrinter.P("using parent snapshot %v of host %v\n", parentSnapshot.ID().Str(), parentSnapshot.Hostname)
+			} else if parentSnapshot != nil {
 				progressPrinter.P("using parent snapshot %v\n", parentSnapshot.ID().Str())
 			} else {
 				progressPrinter.P("no parent snapshot found, will read all files\n")
@@ -551,22 +789,38 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 		return err
 	}
 
-	selectByNameFilter := func(item string) bool {
-		for _, reject := range rejectByNameFuncs {
-			if reject(item) {
-				return false
+	// remember the existing packs to find the packs uploaded by this backup
+	var existingPacks restic.IDSet
+	if opts.VerifyUploads != "" {
+		existingPacks = restic.NewIDSet()
+		repo.Index().Each(ctx, func(blob restic.PackedBlob) {
+			existingPacks.Insert(blob.PackID)
+		})
+	}
+
+	// report is called with the reason why an item is excluded
+	selectByNameFilter := func(report func(item, reason string)) archiver.SelectByNameFunc {
+		return func(item string) bool {
+			for _, reject := range rejectByNameFuncs {
+				if rejected, reason := reject(item); rejected {
+					report(item, reason)
+					return false
+				}
 			}
+			return true
 		}
-		return true
 	}
 
-	selectFilter := func(item string, fi os.FileInfo) bool {
-		for _, reject := range rejectFuncs {
-			if reject(item, fi) {
-				return false
+	selectFilter := func(report func(item, reason string)) archiver.SelectFunc {
+		return func(item string, fi os.FileInfo) bool {
+			for _, reject := range rejectFuncs {
+				if rejected, reason := reject(item, fi); rejected {
+					report(item, reason)
+					return false
+				}
 			}
+			return true
 		}
-		return true
 	}
 
 	var targetFS fs.FS = fs.Local{}
@@ -589,6 +843,9 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 		defer localVss.DeleteSnapshots()
 		targetFS = localVss
 	}
+	if opts.fsTestHook != nil {
+		targetFS = opts.fsTestHook(targetFS)
+	}
 	if opts.Stdin {
 		if !gopts.JSON {
 			progressPrinter.V("read data from stdin")
@@ -609,8 +866,10 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 
 	if !opts.NoScan {
 		sc := archiver.NewScanner(targetFS)
-		sc.SelectByName = selectByNameFilter
-		sc.Select = selectFilter
+		// exclusions are only reported by the archiver
+		noReport := func(string, string) {}
+		sc.SelectByName = selectByNameFilter(noReport)
+		sc.Select = selectFilter(noReport)
 		sc.Error = progressPrinter.ScannerError
 		sc.Result = progressReporter.ReportTotal
 
@@ -621,8 +880,23 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 	}
 
 	arch := archiver.New(repo, targetFS, archiver.Options{ReadConcurrency: backupOptions.ReadConcurrency})
-	arch.SelectByName = selectByNameFilter
-	arch.Select = selectFilter
+	arch.SelectByName = selectByNameFilter(progressReporter.Excluded)
+	arch.Select = selectFilter(progressReporter.Excluded)
+	// targets which did not contribute any files, probably because of a missing mount
+	var suspiciousTargets []string
+	arch.CompleteTarget = func(s archiver.TargetSummary) {
+		switch {
+		case s.Empty():
+			Warnf("Warning: target %v contains no files, check that it is mounted and not excluded\n", s.Target)
+			progressReporter.Warning(s.Target, "empty target")
+		case s.DeviceChanged():
+			Warnf("Warning: target %v is on a different file system than in the parent snapshot\n", s.Target)
+			progressReporter.Warning(s.Target, "target file system changed")
+		default:
+			return
+		}
+		suspiciousTargets = append(suspiciousTargets, s.Target)
+	}
 	arch.WithAtime = opts.WithAtime
 	success := true
 	arch.Error = func(item string, err error) error {
@@ -632,6 +906,13 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 	arch.CompleteItem = progressReporter.CompleteItem
 	arch.StartFile = progressReporter.StartFile
 	arch.CompleteBlob = progressReporter.CompleteBlob
+	arch.FileChanged = progressReporter.FileChanged
+	if opts.Force {
+		// without a parent snapshot all files are new to the archiver
+		arch.FileChanged = func(item, _ string) {
+			progressReporter.FileChanged(item, "forced")
+		}
+	}
 
 	if opts.IgnoreInode {
 		// --ignore-inode implies --ignore-ctime: on FUSE, the ctime is not
@@ -641,6 +922,14 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 	if opts.IgnoreCtime {
 		arch.ChangeIgnoreFlags |= archiver.ChangeIgnoreCtime
 	}
+	arch.MtimeResolution = opts.MtimeResolution
+	var futureMtimeWarning sync.Once
+	arch.FutureMtime = func(item string, mtime time.Time) {
+		futureMtimeWarning.Do(func() {
+			Warnf("Warning: %v has a modification time in the future (%v), files with such a modification time are always read\n", item, mtime.Format(TimeFormat))
+		})
+		progressReporter.Warning(item, "mtime in the future")
+	}
 
 	snapshotOpts := archiver.SnapshotOptions{
 		Excludes:       opts.Excludes,
@@ -649,12 +938,19 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 		Hostname:       opts.Host,
 		ParentSnapshot: parentSnapshot,
 		ProgramVersion: "restic " + version,
+		BackupStart:    backupStart,
+		Paths:          snapshotPaths,
 	}
 
 	if !gopts.JSON {
 		progressPrinter.V("start backup on %v", targets)
 	}
-	_, id, err := arch.Snapshot(ctx, targets, snapshotOpts)
+	// on SIGINT, stop reading files but save the data uploaded so far
+	interruptCtx, stopInterrupt := withGracefulShutdown(ctx)
+	snapshotOpts.Interrupt = interruptCtx.Done()
+	sn, id, err := arch.Snapshot(ctx, targets, snapshotOpts)
+	interrupted := interruptCtx.Err() != nil && ctx.Err() == nil
+	stopInterrupt()
 
 	// cleanly shutdown all running goroutines
 	cancel()
@@ -663,15 +959,41 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 	werr := wg.Wait()
 
 	// return original error
+	if err != nil && interrupted {
+		return errors.Fatal("backup interrupted, no snapshot was created, the data saved so far will be reused by the next backup")
+	}
+	if err != nil && errors.Is(err, repository.ErrSizeLimit) {
+		return errors.Fatalf("%v, no snapshot was created", err)
+	}
 	if err != nil {
 		return errors.Fatalf("unable to save snapshot: %v", err)
 	}
 
+	if !opts.DryRun {
+		recordSnapshot(id, sn.Summary)
+	}
+
 	// Report finished execution
+	progressReporter.SetIndexMemoryUsage(repo.Index().MemoryUsage())
+	if transfer, ok := transferStats(repo); ok {
+		progressReporter.SetTransferStats(transfer)
+	}
+	progressReporter.SetDuplicateStats(duplicateStats(repo))
+	if syncer != nil {
+		progressReporter.SetSyncDuration(syncer.SyncDuration())
+	}
 	progressReporter.Finish(id, opts.DryRun)
 	if !gopts.JSON && !opts.DryRun {
 		progressPrinter.P("snapshot %s saved\n", id.Str())
 	}
+	if opts.VerifyUploads != "" {
+		if err := verifyUploadedPacks(ctx, repo, opts, gopts, existingPacks); err != nil {
+			return err
+		}
+	}
+	if opts.RequireNonempty && len(suspiciousTargets) > 0 {
+		return errors.Fatalf("targets are empty or on a different file system than in the parent snapshot: %v", strings.Join(suspiciousTargets, ", "))
+	}
 	if !success {
 		return ErrInvalidSourceData
 	}
@@ -679,3 +1001,65 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 	// Return error if any
 	return werr
 }
+
+// verifyUploadedPacks downloads the packs which were added to the index
+// during the backup, that is all packs not contained in existingPacks, and
+// checks their integrity.
+func verifyUploadedPacks(ctx context.Context, repo restic.Repository, opts BackupOptions, gopts GlobalOptions, existingPacks restic.IDSet) error {
+	percentage, err := parseVerifyUploads(opts.VerifyUploads)
+	if err != nil {
+		return err
+	}
+
+	uploaded := make(map[restic.ID]int64)
+	repo.Index().Each(ctx, func(blob restic.PackedBlob) {
+		if existingPacks.Has(blob.PackID) {
+			return
+		}
+		size, ok := uploaded[blob.PackID]
+		if !ok {
+			size = int64(pack.CalculateHeaderSize(nil))
+		}
+		uploaded[blob.PackID] = size + int64(blob.Length) + int64(pack.CalculateEntrySize(blob.Blob))
+	})
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	packs := uploaded
+	if percentage < 100.0 {
+		packs = selectRandomPacksByPercentage(uploaded, percentage, time.Now().UnixNano())
+	}
+	if !gopts.JSON {
+		Verbosef("verifying %d of %d uploaded packs\n", len(packs), len(uploaded))
+	}
+
+	var packSize uint64
+	for _, size := range packs {
+		packSize += uint64(size)
+	}
+	p := newPhaseProgress(gopts, "verify-uploads", uint64(len(packs)), packSize, "packs")
+	errChan := make(chan error)
+	chkr := checker.New(repo, false)
+	go chkr.ReadPacks(ctx, packs, p, errChan)
+
+	var damaged []string
+	for err := range errChan {
+		Warnf("%v\n", err)
+		var packErr *checker.PackError
+		if errors.As(err, &packErr) {
+			damaged = append(damaged, packErr.ID.Str())
+		} else {
+			damaged = append(damaged, "(unknown)")
+		}
+	}
+	p.Done()
+
+	if len(damaged) > 0 {
+		return errors.Fatalf("%d of %d verified uploaded packs are damaged: %v", len(damaged), len(packs), strings.Join(damaged, ", "))
+	}
+	if !gopts.JSON {
+		Verbosef("uploaded packs verified successfully\n")
+	}
+	return ctx.Err()
+}
@@ -1,17 +1,26 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/options"
 	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
+	"github.com/restic/restic/internal/ui"
 	"github.com/restic/restic/internal/ui/termstatus"
 )
 
@@ -135,6 +144,51 @@ func TestBackupParentSelection(t *testing.T) {
 	rtest.Assert(t, latestSn.Parent != nil && latestSn.Parent.Equal(firstSnapshotID), "third snapshot selected unexpected parent %v instead of %v", latestSn.Parent, firstSnapshotID)
 }
 
+func TestBackupParentIgnoresBrokenSnapshot(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	opts := BackupOptions{}
+
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, opts, env.gopts)
+	firstSnapshotID := testListSnapshots(t, env.gopts, 1)[0]
+
+	// plant a truncated snapshot file, as written by a concurrent backup
+	buf, err := os.ReadFile(filepath.Join(env.repo, "snapshots", firstSnapshotID.String()))
+	rtest.OK(t, err)
+	brokenFile := filepath.Join(env.repo, "snapshots", restic.NewRandomID().String())
+	rtest.OK(t, os.WriteFile(brokenFile, buf[:len(buf)/2], 0600))
+
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, opts, env.gopts)
+	rtest.OK(t, os.Remove(brokenFile))
+
+	latestSn, _ := testRunSnapshots(t, env.gopts)
+	rtest.Assert(t, latestSn != nil, "missing latest snapshot")
+	rtest.Assert(t, latestSn.Parent != nil && latestSn.Parent.Equal(firstSnapshotID), "second snapshot selected unexpected parent %v instead of %v", latestSn.Parent, firstSnapshotID)
+
+	// an explicitly selected parent snapshot must be readable
+	rtest.OK(t, os.WriteFile(brokenFile, buf[:len(buf)/2], 0600))
+	opts.Parent = filepath.Base(brokenFile)
+	err = testRunBackupAssumeFailure(t, filepath.Dir(env.testdata), []string{"testdata"}, opts, env.gopts)
+	rtest.Assert(t, err != nil, "backup with unreadable parent snapshot should fail")
+	rtest.OK(t, os.Remove(brokenFile))
+}
+
+func TestBackupParentNone(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, BackupOptions{}, env.gopts)
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, BackupOptions{Parent: "none"}, env.gopts)
+
+	latestSn, _ := testRunSnapshots(t, env.gopts)
+	rtest.Assert(t, latestSn != nil, "missing latest snapshot")
+	rtest.Assert(t, latestSn.Parent == nil, "snapshot has unexpected parent %v", latestSn.Parent)
+}
+
 func TestDryRunBackup(t *testing.T) {
 	env, cleanup := withTestEnvironment(t)
 	defer cleanup()
@@ -339,6 +393,66 @@ func TestBackupExclude(t *testing.T) {
 		"expected file %q not in first snapshot, but it's included", "passwords.txt")
 }
 
+func TestBackupIgnoreFiles(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	for name, data := range map[string]string{
+		".resticignore":           "*.log\n!keep.log\ncache/\n!secret.txt\n",
+		"a.log":                   "a",
+		"keep.log":                "keep",
+		"secret.txt":              "secret",
+		"cache/data":              "cache",
+		"sub/.resticignore":       "!*.log\nignored.dat\n/anchored\n",
+		"sub/b.log":               "b",
+		"sub/c.dat":               "c",
+		"sub/ignored.dat":         "ignored",
+		"sub/inner/ignored.dat":   "ignored",
+		"sub/inner/anchored":      "anchored",
+		"sub/anchored":            "anchored",
+		"sub/inner/cache/data":    "cache",
+		"other/ignored.dat":       "other",
+		"other/.resticignore.bak": "*",
+	} {
+		fp := filepath.Join(env.testdata, filepath.FromSlash(name))
+		rtest.OK(t, os.MkdirAll(filepath.Dir(fp), 0755))
+		rtest.OK(t, os.WriteFile(fp, []byte(data), 0644))
+	}
+
+	opts := BackupOptions{ExcludeIgnoreFiles: []string{".resticignore"}}
+	// global excludes win, the ignore file cannot include the file again
+	opts.Excludes = []string{"*.txt"}
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, opts, env.gopts)
+	_, snapshotID := lastSnapshot(map[string]struct{}{}, loadSnapshotMap(t, env.gopts))
+	files := testRunLs(t, env.gopts, snapshotID)
+
+	for _, name := range []string{
+		".resticignore",
+		"keep.log",
+		"sub/.resticignore",
+		"sub/b.log",
+		"sub/c.dat",
+		"sub/inner/anchored",
+		"other/ignored.dat",
+		"other/.resticignore.bak",
+	} {
+		rtest.Assert(t, includes(files, "/testdata/"+name), "expected file %q in snapshot, but it's not included", name)
+	}
+	for _, name := range []string{
+		"a.log",
+		"secret.txt",
+		"cache",
+		"sub/ignored.dat",
+		"sub/inner/ignored.dat",
+		"sub/anchored",
+		"sub/inner/cache",
+	} {
+		rtest.Assert(t, !includes(files, "/testdata/"+name), "expected file %q not in snapshot, but it's included", name)
+	}
+}
+
 func TestBackupErrors(t *testing.T) {
 	if runtime.GOOS == "windows" {
 		return
@@ -567,3 +681,731 @@ func linkEqual(source, dest []string) bool {
 
 	return true
 }
+
+func TestBackupJSON(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+
+	var stdout, stderr bytes.Buffer
+	gopts := env.gopts
+	gopts.JSON = true
+	gopts.verbosity = 2
+	gopts.stdout = &stdout
+	gopts.stderr = &stderr
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, gopts)
+	snapshotID := testListSnapshots(t, env.gopts, 1)[0]
+
+	rtest.Assert(t, stderr.Len() == 0, "unexpected output on stderr: %q", stderr.String())
+
+	required := map[string][]string{
+		"status":         {"seconds_elapsed", "percent_done", "total_files", "files_done", "total_bytes", "bytes_done"},
+		"verbose_status": {"action", "item", "duration", "data_size", "data_size_in_repo"},
+		"summary": {"files_new", "files_changed", "files_unmodified", "dirs_new", "dirs_changed", "dirs_unmodified",
+			"data_blobs", "tree_blobs", "data_added", "total_files_processed", "total_bytes_processed", "total_duration", "snapshot_id"},
+	}
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	seen := make(map[string]int)
+	for i, line := range lines {
+		var msg map[string]interface{}
+		rtest.OK(t, json.Unmarshal([]byte(line), &msg))
+
+		msgType, _ := msg["message_type"].(string)
+		fields, ok := required[msgType]
+		rtest.Assert(t, ok, "unexpected message type in %v", line)
+		for _, field := range fields {
+			_, ok := msg[field]
+			rtest.Assert(t, ok, "field %v missing in %v", field, line)
+		}
+		seen[msgType]++
+
+		if msgType == "summary" {
+			rtest.Equals(t, len(lines)-1, i)
+			rtest.Equals(t, snapshotID.String(), msg["snapshot_id"])
+			rtest.Assert(t, msg["files_new"].(float64) > 0, "no new files in %v", line)
+		}
+	}
+
+	rtest.Equals(t, 1, seen["summary"])
+	rtest.Assert(t, seen["verbose_status"] > 0, "no verbose_status messages found")
+}
+
+func TestBackupVerbosity(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	dir := filepath.Join(env.testdata, "dir")
+	rtest.OK(t, os.MkdirAll(filepath.Join(dir, "sub"), 0755))
+	for _, name := range []string{"changed.txt", "unchanged.txt", "skip.tmp"} {
+		rtest.OK(t, os.WriteFile(filepath.Join(dir, name), []byte(name), 0644))
+	}
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	parent := testListSnapshots(t, env.gopts, 1)[0]
+
+	rtest.OK(t, appendRandomData(filepath.Join(dir, "changed.txt"), 100))
+	rtest.OK(t, os.WriteFile(filepath.Join(dir, "sub", "new.txt"), []byte("new"), 0644))
+
+	opts := BackupOptions{Parent: parent.String()}
+	opts.Excludes = []string{"*.tmp"}
+
+	for _, test := range []struct {
+		verbose int
+		want    []string
+		notWant []string
+	}{
+		{
+			verbose: 0,
+			want:    []string{`(?m)^Files: +1 new, +1 changed, +1 unmodified$`},
+			notWant: []string{`(?m)^(new|modified|unchanged|reading|excluded) `},
+		},
+		{
+			verbose: 1,
+			want: []string{
+				`(?m)^modified  .*/dir/, saved in `,
+				`(?m)^modified  .*/dir/sub/, saved in `,
+			},
+			notWant: []string{`(?m)^(new|modified) .*\.txt`, `(?m)^(unchanged|reading|excluded) `},
+		},
+		{
+			verbose: 2,
+			want: []string{
+				`(?m)^modified  .*/dir/changed\.txt, 111 B, saved in `,
+				`(?m)^new       .*/dir/sub/new\.txt, 3 B, saved in `,
+				`(?m)^modified  .*/dir/, saved in `,
+			},
+			notWant: []string{`(?m)^(unchanged|reading|excluded) `},
+		},
+		{
+			verbose: 3,
+			want: []string{
+				`(?m)^modified  .*/dir/changed\.txt, 111 B, saved in `,
+				`(?m)^unchanged .*/dir/unchanged\.txt$`,
+				`(?m)^reading   .*/dir/changed\.txt: size changed$`,
+				`(?m)^reading   .*/dir/sub/new\.txt: not in parent snapshot$`,
+				`(?m)^excluded  .*skip\.tmp: matches exclude pattern "\*\.tmp"$`,
+			},
+			notWant: []string{`(?m)^reading   .*unchanged\.txt`},
+		},
+	} {
+		t.Run(fmt.Sprintf("verbose-%d", test.verbose), func(t *testing.T) {
+			var stdout bytes.Buffer
+			gopts := env.gopts
+			gopts.verbosity = uint(test.verbose) + 1
+			gopts.stdout = &stdout
+			testRunBackup(t, "", []string{env.testdata}, opts, gopts)
+
+			for _, pattern := range test.want {
+				rtest.Assert(t, regexp.MustCompile(pattern).MatchString(stdout.String()),
+					"output does not match %q:\n%s", pattern, stdout.String())
+			}
+			for _, pattern := range test.notWant {
+				rtest.Assert(t, !regexp.MustCompile(pattern).MatchString(stdout.String()),
+					"output unexpectedly matches %q:\n%s", pattern, stdout.String())
+			}
+		})
+	}
+}
+
+func TestBackupNoProgress(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+
+	t.Setenv("NO_COLOR", "1")
+	t.Setenv("RESTIC_PROGRESS_FPS", "60")
+
+	var stdout bytes.Buffer
+	gopts := env.gopts
+	gopts.Quiet = false
+	gopts.NoProgress = true
+	gopts.verbosity = 1
+	gopts.stdout = &stdout
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, gopts)
+
+	output := stdout.String()
+	rtest.Assert(t, regexp.MustCompile(`(?m)^snapshot [0-9a-f]+ saved$`).MatchString(output),
+		"summary missing in output:\n%s", output)
+	rtest.Assert(t, !regexp.MustCompile(`(?m)^\[\d+:\d+\] `).MatchString(output),
+		"output contains progress:\n%s", output)
+	rtest.Assert(t, !strings.ContainsAny(output, "\x1b\r"),
+		"output contains control characters: %q", output)
+}
+
+// failOnceBackend fails the first attempt to save a data file.
+type failOnceBackend struct {
+	restic.Backend
+	failed bool
+}
+
+func (b *failOnceBackend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	if h.Type == restic.PackFile && !b.failed {
+		b.failed = true
+		return errors.New("injected error")
+	}
+	return b.Backend.Save(ctx, h, rd)
+}
+
+// corruptPackBackend damages the first data pack file which is saved.
+type corruptPackBackend struct {
+	restic.Backend
+	corrupted restic.ID
+}
+
+func (b *corruptPackBackend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	if h.Type != restic.PackFile || h.ContainedBlobType != restic.DataBlob || !b.corrupted.IsNull() {
+		return b.Backend.Save(ctx, h, rd)
+	}
+
+	buf, err := io.ReadAll(rd)
+	if err != nil {
+		return err
+	}
+	buf[len(buf)/2] ^= 0xff
+	b.corrupted = restic.TestParseID(h.Name)
+	return b.Backend.Save(ctx, h, restic.NewByteReader(buf, nil))
+}
+
+func TestBackupVerifyUploads(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	opts := BackupOptions{VerifyUploads: "all"}
+	testRunBackup(t, "", []string{env.testdata}, opts, env.gopts)
+
+	rtest.OK(t, appendRandomData(filepath.Join(env.testdata, "new"), 1<<20))
+	be := &corruptPackBackend{}
+	gopts := env.gopts
+	gopts.backendInnerTestHook = func(r restic.Backend) (restic.Backend, error) {
+		be.Backend = r
+		return be, nil
+	}
+	err := testRunBackupAssumeFailure(t, "", []string{env.testdata}, opts, gopts)
+	rtest.Assert(t, !be.corrupted.IsNull(), "no pack was corrupted")
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "damaged") && strings.Contains(err.Error(), be.corrupted.Str()),
+		"damaged pack %v not reported, error %v", be.corrupted.Str(), err)
+
+	// the snapshot is kept nonetheless
+	testListSnapshots(t, env.gopts, 2)
+}
+
+func TestBackupRequireNonempty(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	empty := filepath.Join(env.base, "empty")
+	rtest.OK(t, os.MkdirAll(filepath.Join(empty, "subdir"), 0700))
+	targets := []string{env.testdata, empty}
+
+	// without --require-nonempty, an empty target only causes a warning
+	testRunBackup(t, "", targets, BackupOptions{}, env.gopts)
+	testListSnapshots(t, env.gopts, 1)
+
+	err := testRunBackupAssumeFailure(t, "", targets, BackupOptions{RequireNonempty: true}, env.gopts)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), empty) && !strings.Contains(err.Error(), env.testdata),
+		"empty target not reported, error %v", err)
+	testListSnapshots(t, env.gopts, 2)
+
+	rtest.OK(t, os.WriteFile(filepath.Join(empty, "subdir", "file"), []byte("content"), 0600))
+	testRunBackup(t, "", targets, BackupOptions{RequireNonempty: true}, env.gopts)
+	testListSnapshots(t, env.gopts, 3)
+}
+
+func TestBackupLogFile(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+
+	gopts := env.gopts
+	gopts.LogFile = filepath.Join(env.base, "restic.log")
+	gopts.LogLevel = "info"
+	gopts.LogJSON = true
+	gopts.backendInnerTestHook = func(r restic.Backend) (restic.Backend, error) {
+		return &failOnceBackend{Backend: r}, nil
+	}
+
+	closeLog, err := openLogFile(gopts)
+	rtest.OK(t, err)
+	oldStderr := globalOptions.stderr
+	globalOptions.stderr = io.Discard
+	testRunBackup(t, "", []string{env.testdata, filepath.Join(env.base, "missing")}, BackupOptions{}, gopts)
+	globalOptions.stderr = oldStderr
+	rtest.OK(t, closeLog())
+
+	buf, err := os.ReadFile(gopts.LogFile)
+	rtest.OK(t, err)
+
+	type logEntry struct {
+		Time    string `json:"time"`
+		Level   string `json:"level"`
+		Message string `json:"message"`
+	}
+	var entries []logEntry
+	for _, line := range strings.Split(strings.TrimSpace(string(buf)), "\n") {
+		var entry logEntry
+		rtest.OK(t, json.Unmarshal([]byte(line), &entry))
+		rtest.Assert(t, entry.Time != "", "missing time in %q", line)
+		entries = append(entries, entry)
+	}
+
+	for _, test := range []struct {
+		level   string
+		message string
+	}{
+		{"info", `^lock repository$`},
+		{"warn", `/missing does not exist, skipping$`},
+		{"warn", `^Save\(<data/[0-9a-f]+>\) returned error, retrying after .*: injected error$`},
+		{"info", `^snapshot [0-9a-f]+ saved$`},
+	} {
+		found := false
+		for _, entry := range entries {
+			if entry.Level == test.level && regexp.MustCompile(test.message).MatchString(entry.Message) {
+				found = true
+				break
+			}
+		}
+		rtest.Assert(t, found, "no %v message matching %q in log:\n%s", test.level, test.message, buf)
+	}
+
+	for _, entry := range entries {
+		rtest.Assert(t, entry.Level != "debug", "unexpected debug message %q", entry.Message)
+	}
+}
+
+func TestBackupTraceBackend(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+
+	gopts := env.gopts
+	gopts.TraceBackend = filepath.Join(env.base, "trace.log")
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, gopts)
+
+	buf, err := os.ReadFile(gopts.TraceBackend)
+	rtest.OK(t, err)
+
+	lineRe := regexp.MustCompile(`^time=\S+ op=(\w+) handle=(\w+)\S* bytes=(\d+) duration=\d+\.\d{6} retries=(\d+) outcome=(ok|not-exist|error err=".*")$`)
+	saved := make(map[string]bool)
+	for _, line := range strings.Split(strings.TrimSpace(string(buf)), "\n") {
+		m := lineRe.FindStringSubmatch(line)
+		rtest.Assert(t, m != nil, "malformed trace line %q", line)
+		if m[1] == "save" && m[5] == "ok" {
+			rtest.Assert(t, m[3] != "0", "save without data in %q", line)
+			saved[m[2]] = true
+		}
+	}
+
+	for _, tpe := range []string{"data", "index", "snapshot", "lock"} {
+		rtest.Assert(t, saved[tpe], "no successful save of a %v file in trace:\n%s", tpe, buf)
+	}
+}
+
+func TestBackupSizeLimit(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	// create enough data for several pack files
+	rtest.OK(t, os.MkdirAll(env.testdata, 0700))
+	for i := 0; i < 16; i++ {
+		rtest.OK(t, os.WriteFile(filepath.Join(env.testdata, fmt.Sprintf("file%d", i)), rtest.Random(i, 1<<20), 0600))
+	}
+
+	gopts := env.gopts
+	gopts.PackSize = 4
+	gopts.RepoMaxSize = "9M"
+	// the size limit lists the index files a second time
+	gopts.backendTestHook = nil
+	err := testRunBackupAssumeFailure(t, "", []string{env.testdata}, BackupOptions{}, gopts)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "repository size limit reached"), "unexpected error %v", err)
+
+	// no snapshot was created and the repository is still consistent
+	testListSnapshots(t, env.gopts, 0)
+	output, err := testRunCheckOutput(env.gopts, false)
+	rtest.Assert(t, err == nil, "check failed: %v\n%v", err, output)
+
+	r, err := OpenRepository(context.TODO(), gopts)
+	rtest.OK(t, err)
+	size, limit, err := r.SizeLimit(context.TODO())
+	rtest.OK(t, err)
+	rtest.Equals(t, uint64(9<<20), limit)
+	rtest.Assert(t, size > 0 && size <= limit, "unexpected repository size %v", size)
+
+	// the backup succeeds with a larger limit
+	gopts.Options = []string{"repository.max-size=100M"}
+	gopts.extended, err = options.Parse(gopts.Options)
+	rtest.OK(t, err)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, gopts)
+	testListSnapshots(t, env.gopts, 1)
+	testRunCheck(t, env.gopts)
+
+	stats, err := withCaptureStdout(func() error {
+		gopts.JSON = true
+		return runStats(context.TODO(), StatsOptions{countMode: countModeRestoreSize}, gopts, nil)
+	})
+	rtest.OK(t, err)
+	var out statsContainer
+	rtest.OK(t, json.Unmarshal(stats.Bytes(), &out))
+	rtest.Equals(t, uint64(100<<20), out.RepositorySizeLimit)
+	rtest.Assert(t, out.RepositorySize > 16<<20, "unexpected repository size %v", out.RepositorySize)
+}
+
+func TestBackupTransferStats(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	before := dirStats(env.repo).size
+
+	var stdout bytes.Buffer
+	gopts := env.gopts
+	gopts.JSON = true
+	gopts.stdout = &stdout
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, gopts)
+	growth := dirStats(env.repo).size - before
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	var summary struct {
+		MessageType string            `json:"message_type"`
+		Transfer    *ui.TransferStats `json:"transfer"`
+	}
+	rtest.OK(t, json.Unmarshal([]byte(lines[len(lines)-1]), &summary))
+	rtest.Equals(t, "summary", summary.MessageType)
+	rtest.Assert(t, summary.Transfer != nil, "transfer statistics missing in summary")
+
+	// the uploaded data additionally includes the lock file, which is removed
+	// again after the backup
+	uploaded := summary.Transfer.BytesUploaded
+	rtest.Assert(t, uploaded >= growth && uploaded <= growth+4096,
+		"uploaded %d bytes, but the repository grew by %d bytes", uploaded, growth)
+	rtest.Assert(t, summary.Transfer.Requests > 0, "no requests reported")
+}
+
+func TestBackupSetPath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses unix paths")
+	}
+
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	// simulate two filesystem snapshots mounted at different locations
+	logical := filepath.Join(string(filepath.Separator), "home")
+	for _, name := range []string{"daily-1", "daily-2"} {
+		dir := filepath.Join(env.base, "snapshots", name, "home")
+		rtest.OK(t, os.MkdirAll(dir, 0755))
+		rtest.OK(t, os.WriteFile(filepath.Join(dir, "file"), []byte("content of "+name), 0644))
+	}
+
+	opts := BackupOptions{SetPaths: []string{logical}}
+	testRunBackup(t, "", []string{filepath.Join(env.base, "snapshots", "daily-1", "home")}, opts, env.gopts)
+	first := testListSnapshots(t, env.gopts, 1)[0]
+	testRunBackup(t, "", []string{filepath.Join(env.base, "snapshots", "daily-2", "home")}, opts, env.gopts)
+	testRunCheck(t, env.gopts)
+
+	repo, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+	var second *restic.Snapshot
+	for _, id := range testListSnapshots(t, env.gopts, 2) {
+		sn, err := restic.LoadSnapshot(context.TODO(), repo, id)
+		rtest.OK(t, err)
+		rtest.Equals(t, []string{logical}, sn.Paths)
+		if !id.Equal(first) {
+			second = sn
+		}
+	}
+
+	// the first snapshot must be detected as parent of the second one
+	rtest.Assert(t, second.Parent != nil && second.Parent.Equal(first),
+		"unexpected parent %v, expected %v", second.Parent, first)
+
+	// the data is stored at the logical path
+	files := testRunLs(t, env.gopts, second.ID().String())
+	rtest.Equals(t, []string{"/home", "/home/file", ""}, files)
+
+	restoredir := filepath.Join(env.base, "restore")
+	testRunRestore(t, env.gopts, restoredir, *second.ID())
+	buf, err := os.ReadFile(filepath.Join(restoredir, "home", "file"))
+	rtest.OK(t, err)
+	rtest.Equals(t, "content of daily-2", string(buf))
+}
+
+func TestBackupSetPathInvalid(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	target := filepath.Join(env.testdata, "0")
+
+	for _, opts := range []BackupOptions{
+		{SetPaths: []string{"/a", "/b"}},
+		{SetPaths: []string{"relative"}},
+		{SetPaths: []string{"/a"}, FilesFrom: []string{filepath.Join(env.base, "files")}},
+	} {
+		err := testRunBackupAssumeFailure(t, "", []string{target}, opts, env.gopts)
+		rtest.Assert(t, err != nil, "expected error for %v", opts.SetPaths)
+	}
+	testListSnapshots(t, env.gopts, 0)
+}
+
+func TestBackupExcludeRepository(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	repoConfig := filepath.Join(env.repo, "config")
+	inCache := func(files map[string]bool) bool {
+		for item := range files {
+			if strings.HasPrefix(item, env.cache) {
+				return true
+			}
+		}
+		return false
+	}
+	testdataFile := filepath.Join(env.testdata, "0", "0", "9", "0")
+
+	backupAndLs := func(opts BackupOptions, target string) (string, map[string]bool) {
+		var stdout bytes.Buffer
+		gopts := env.gopts
+		gopts.Quiet = false
+		gopts.NoProgress = true
+		gopts.verbosity = 1
+		gopts.stdout = &stdout
+		testRunBackup(t, "", []string{target}, opts, gopts)
+
+		newest, _ := testRunSnapshots(t, env.gopts)
+		files := make(map[string]bool)
+		for _, item := range testRunLs(t, env.gopts, newest.ID.String()) {
+			files[item] = true
+		}
+		return stdout.String(), files
+	}
+
+	// repository and cache inside the target
+	out, files := backupAndLs(BackupOptions{}, env.base)
+	rtest.Assert(t, strings.Contains(out, "excluding the restic repository at "+env.repo),
+		"missing notice about the excluded repository, output:\n%v", out)
+	rtest.Assert(t, files[testdataFile], "%v missing in snapshot", testdataFile)
+	rtest.Assert(t, !files[repoConfig], "repository was saved in the snapshot")
+	rtest.Assert(t, !inCache(files), "cache was saved in the snapshot")
+
+	// the override only applies to the repository
+	_, files = backupAndLs(BackupOptions{NoExcludeRepo: true}, env.base)
+	rtest.Assert(t, files[repoConfig], "repository missing in snapshot")
+	rtest.Assert(t, !inCache(files), "cache was saved in the snapshot")
+
+	// target inside the repository
+	out, files = backupAndLs(BackupOptions{}, filepath.Join(env.repo, "keys"))
+	rtest.Assert(t, !strings.Contains(out, "excluding"), "unexpected notice, output:\n%v", out)
+	keys, err := os.ReadDir(filepath.Join(env.repo, "keys"))
+	rtest.OK(t, err)
+	for _, key := range keys {
+		item := filepath.Join(env.repo, "keys", key.Name())
+		rtest.Assert(t, files[item], "%v missing in snapshot", item)
+	}
+}
+
+func testRunBackupStdin(t testing.TB, data []byte, opts BackupOptions, gopts GlobalOptions) {
+	f, err := os.CreateTemp(t.TempDir(), "stdin")
+	rtest.OK(t, err)
+	_, err = f.Write(data)
+	rtest.OK(t, err)
+	_, err = f.Seek(0, io.SeekStart)
+	rtest.OK(t, err)
+
+	oldStdin := os.Stdin
+	os.Stdin = f
+	defer func() {
+		os.Stdin = oldStdin
+	}()
+
+	opts.Stdin = true
+	testRunBackup(t, "", nil, opts, gopts)
+}
+
+func TestBackupStdin(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	testRunInit(t, env.gopts)
+
+	data := rtest.Random(23, 5*1024*1024+12345)
+	opts := BackupOptions{StdinFilename: "backups/db/dump.sql", TimeStamp: "2023-01-02 03:04:05"}
+	testRunBackupStdin(t, data, opts, env.gopts)
+
+	buf, err := withCaptureStdout(func() error {
+		gopts := env.gopts
+		gopts.JSON = true
+		return runLs(context.TODO(), LsOptions{}, gopts, []string{"latest"})
+	})
+	rtest.OK(t, err)
+
+	snapshotTime, err := time.ParseInLocation(TimeFormat, opts.TimeStamp, time.Local)
+	rtest.OK(t, err)
+
+	var paths []string
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var node struct {
+			Path       string      `json:"path"`
+			Type       string      `json:"type"`
+			Size       uint64      `json:"size"`
+			Mode       os.FileMode `json:"mode"`
+			ModTime    time.Time   `json:"mtime"`
+			StructType string      `json:"struct_type"`
+		}
+		rtest.OK(t, dec.Decode(&node))
+		if node.StructType != "node" {
+			continue
+		}
+		paths = append(paths, node.Path)
+
+		rtest.Assert(t, node.ModTime.Equal(snapshotTime), "wrong mtime %v for %v", node.ModTime, node.Path)
+		if node.Type == "file" {
+			rtest.Equals(t, uint64(len(data)), node.Size)
+			rtest.Equals(t, os.FileMode(0644), node.Mode)
+		}
+	}
+	rtest.Equals(t, []string{"/backups", "/backups/db", "/backups/db/dump.sql"}, paths)
+
+	newest, _ := testRunSnapshots(t, env.gopts)
+	rtest.Assert(t, newest.Summary != nil, "missing snapshot summary")
+	rtest.Equals(t, uint(1), newest.Summary.TotalFilesProcessed)
+	rtest.Equals(t, uint64(len(data)), newest.Summary.TotalBytesProcessed)
+
+	stats := testRunStatsJSON(t, StatsOptions{countMode: countModeRestoreSize}, env.gopts)
+	rtest.Equals(t, uint64(len(data)), stats.TotalSize)
+
+	restoredir := filepath.Join(env.base, "restore")
+	testRunRestoreLatest(t, env.gopts, restoredir, nil, nil)
+	restored, err := os.ReadFile(filepath.Join(restoredir, "backups", "db", "dump.sql"))
+	rtest.OK(t, err)
+	rtest.Assert(t, bytes.Equal(data, restored), "restored data does not match")
+
+	err = testRunBackupAssumeFailure(t, "", nil, BackupOptions{Stdin: true, StdinFilename: "/"}, env.gopts)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "--stdin-filename must not be empty"),
+		"unexpected error for empty filename: %v", err)
+}
+
+func TestBackupNotification(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	defer resetCommandOutcome(t, "backup")()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	snapshotIDs := testListSnapshots(t, env.gopts, 1)
+
+	repo, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+
+	n := newNotification(exitCodeSuccess, nil)
+	rtest.Equals(t, "backup", n.Command)
+	rtest.Equals(t, repo.Config().ID, n.RepositoryID)
+	rtest.Equals(t, snapshotIDs[0].String(), n.SnapshotID)
+	rtest.Assert(t, n.BytesAdded > 0, "no bytes added")
+}
+
+// readCountingFS counts the bytes read from files.
+type readCountingFS struct {
+	fs.FS
+	bytes *int64
+}
+
+func (f readCountingFS) Open(name string) (fs.File, error) {
+	file, err := f.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return readCountingFile{File: file, bytes: f.bytes}, nil
+}
+
+func (f readCountingFS) OpenFile(name string, flag int, perm os.FileMode) (fs.File, error) {
+	file, err := f.FS.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return readCountingFile{File: file, bytes: f.bytes}, nil
+}
+
+type readCountingFile struct {
+	fs.File
+	bytes *int64
+}
+
+func (f readCountingFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	atomic.AddInt64(f.bytes, int64(n))
+	return n, err
+}
+
+func TestBackupParentFromHost(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+
+	var bytesRead int64
+	opts := BackupOptions{
+		Host: "template",
+		fsTestHook: func(fs fs.FS) fs.FS {
+			return readCountingFS{FS: fs, bytes: &bytesRead}
+		},
+	}
+	testRunBackup(t, "", []string{env.testdata}, opts, env.gopts)
+	rtest.Assert(t, bytesRead > 0, "no file data read by the first backup")
+	_, snapshots := testRunSnapshots(t, env.gopts)
+	rtest.Equals(t, 1, len(snapshots))
+	var templateID restic.ID
+	for id := range snapshots {
+		templateID = id
+	}
+
+	// the new host uses the snapshot of the template as parent
+	bytesRead = 0
+	opts.Host = "clone"
+	opts.ParentFromHost = "template"
+	testRunBackup(t, "", []string{env.testdata}, opts, env.gopts)
+	rtest.Equals(t, int64(0), bytesRead)
+
+	_, snapshots = testRunSnapshots(t, env.gopts)
+	rtest.Equals(t, 2, len(snapshots))
+	var cloneID restic.ID
+	for id, sn := range snapshots {
+		if id != templateID {
+			cloneID = id
+			rtest.Equals(t, "clone", sn.Hostname)
+			rtest.Assert(t, sn.Parent != nil && *sn.Parent == templateID, "unexpected parent %v", sn.Parent)
+		}
+	}
+
+	// afterwards the snapshots of the host itself are used
+	opts.Host = "clone"
+	testRunBackup(t, "", []string{env.testdata}, opts, env.gopts)
+	_, snapshots = testRunSnapshots(t, env.gopts)
+	rtest.Equals(t, 3, len(snapshots))
+	for id, sn := range snapshots {
+		if id != templateID && id != cloneID {
+			rtest.Assert(t, sn.Parent != nil && *sn.Parent == cloneID, "unexpected parent %v", sn.Parent)
+		}
+	}
+
+	// snapshots of other paths are not used as parent
+	bytesRead = 0
+	opts.Host = "other"
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0")}, opts, env.gopts)
+	rtest.Assert(t, bytesRead > 0, "no file data read for different paths")
+
+	err := testRunBackupAssumeFailure(t, "", []string{env.testdata}, BackupOptions{Parent: "latest", ParentFromHost: "template"}, env.gopts)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "cannot be used together"), "unexpected error %v", err)
+}
@@ -110,3 +110,29 @@ func TestReadFilenamesRaw(t *testing.T) {
 	rtest.Assert(t, strings.Contains(err.Error(), "zero byte"),
 		"wrong error message: %v", err.Error())
 }
+
+func TestParseVerifyUploads(t *testing.T) {
+	for _, test := range []struct {
+		input      string
+		percentage float64
+		ok         bool
+	}{
+		{"all", 100, true},
+		{"sample:10%", 10, true},
+		{"sample:0.5%", 0.5, true},
+		{"sample:100%", 100, true},
+		{"sample:0%", 0, false},
+		{"sample:150%", 0, false},
+		{"sample:10", 0, false},
+		{"10%", 0, false},
+		{"some", 0, false},
+	} {
+		percentage, err := parseVerifyUploads(test.input)
+		if test.ok {
+			rtest.OK(t, err)
+			rtest.Equals(t, test.percentage, percentage)
+		} else {
+			rtest.Assert(t, err != nil, "expected error for %q", test.input)
+		}
+	}
+}
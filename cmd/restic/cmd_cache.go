@@ -53,7 +53,7 @@ func init() {
 
 func runCache(opts CacheOptions, gopts GlobalOptions, args []string) error {
 	if len(args) > 0 {
-		return errors.Fatal("the cache command expects no arguments, only options - please see `restic help cache` for usage and flags")
+		return invalidArguments(errors.Fatal("the cache command expects no arguments, only options - please see `restic help cache` for usage and flags"))
 	}
 
 	if gopts.NoCache {
@@ -3,21 +3,37 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"path"
+	"strings"
 
 	"github.com/spf13/cobra"
 
 	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/index"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/walker"
 )
 
 var cmdCat = &cobra.Command{
-	Use:   "cat [flags] [masterkey|config|pack ID|blob ID|snapshot ID|index ID|key ID|lock ID|tree snapshot:subfolder]",
+	Use:   "cat [flags] [masterkey|config|pack ID|blob ID|snapshot ID|index ID|key ID|lock ID|tree snapshot:subfolder|tree ID]",
 	Short: "Print internal objects to stdout",
 	Long: `
 The "cat" command is used to print internal objects to stdout.
 
+Blobs and trees can also be specified by a unique prefix of their ID with at
+least 4 characters.
+
+With --json, "cat index" prints the decoded index instead of the raw index
+file, this also converts index files in the old format.
+
+With --recursive and --json, "cat tree" prints the metadata of all nodes below
+the tree instead of the raw tree, one JSON object per line in depth-first
+order. Each object contains the path of the node and the node as stored in the
+tree, including the IDs of the content blobs of files. Use --depth to limit
+how many levels below the tree are printed.
+
 EXIT STATUS
 ===========
 
@@ -25,17 +41,38 @@ Exit status is 0 if the command was successful, and non-zero if there was any er
 `,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return runCat(cmd.Context(), globalOptions, args)
+		return runCat(cmd.Context(), catOptions, globalOptions, args)
 	},
 }
 
+// CatOptions collects all options for the cat command.
+type CatOptions struct {
+	Recursive bool
+	Depth     int
+}
+
+var catOptions CatOptions
+
 func init() {
 	cmdRoot.AddCommand(cmdCat)
+
+	f := cmdCat.Flags()
+	f.BoolVar(&catOptions.Recursive, "recursive", false, "print the metadata of all nodes below a tree as JSON lines (requires --json)")
+	f.IntVar(&catOptions.Depth, "depth", 0, "with --recursive, only print nodes up to `n` levels below the tree (default: unlimited)")
 }
 
-func runCat(ctx context.Context, gopts GlobalOptions, args []string) error {
+func runCat(ctx context.Context, opts CatOptions, gopts GlobalOptions, args []string) error {
 	if len(args) < 1 || (args[0] != "masterkey" && args[0] != "config" && len(args) != 2) {
-		return errors.Fatal("type or ID not specified")
+		return invalidArguments(errors.Fatal("type or ID not specified"))
+	}
+	if opts.Recursive && (args[0] != "tree" || !gopts.JSON) {
+		return invalidArguments(errors.Fatal("--recursive is only supported for \"cat tree\" with --json"))
+	}
+	if opts.Depth < 0 {
+		return invalidArguments(errors.Fatal("--depth must not be negative"))
+	}
+	if opts.Depth > 0 && !opts.Recursive {
+		return invalidArguments(errors.Fatal("--depth requires --recursive"))
 	}
 
 	repo, err := OpenRepository(ctx, gopts)
@@ -55,7 +92,7 @@ func runCat(ctx context.Context, gopts GlobalOptions, args []string) error {
 	tpe := args[0]
 
 	var id restic.ID
-	if tpe != "masterkey" && tpe != "config" && tpe != "snapshot" && tpe != "tree" {
+	if tpe != "masterkey" && tpe != "config" && tpe != "snapshot" && tpe != "tree" && tpe != "blob" {
 		id, err = restic.ParseID(args[1])
 		if err != nil {
 			return errors.Fatalf("unable to parse ID: %v\n", err)
@@ -64,6 +101,11 @@ func runCat(ctx context.Context, gopts GlobalOptions, args []string) error {
 
 	switch tpe {
 	case "config":
+		if gopts.JSON {
+			// print a single line which is easy to process in scripts
+			return json.NewEncoder(globalOptions.stdout).Encode(repo.Config())
+		}
+
 		buf, err := json.MarshalIndent(repo.Config(), "", "  ")
 		if err != nil {
 			return err
@@ -77,6 +119,15 @@ func runCat(ctx context.Context, gopts GlobalOptions, args []string) error {
 			return err
 		}
 
+		if gopts.JSON {
+			// print the decoded index, which also works for the old format
+			idx, _, err := index.DecodeIndex(buf, id)
+			if err != nil {
+				return err
+			}
+			return idx.Dump(globalOptions.stdout)
+		}
+
 		Println(string(buf))
 		return nil
 	case "snapshot":
@@ -148,40 +199,53 @@ func runCat(ctx context.Context, gopts GlobalOptions, args []string) error {
 			return err
 		}
 
-		for _, t := range []restic.BlobType{restic.DataBlob, restic.TreeBlob} {
-			bh := restic.BlobHandle{ID: id, Type: t}
-			if !repo.Index().Has(bh) {
-				continue
-			}
-
-			buf, err := repo.LoadBlob(ctx, t, id, nil)
-			if err != nil {
-				return err
-			}
+		bh, err := repo.Index().LookupPrefix(ctx, args[1], restic.DataBlob, restic.TreeBlob)
+		if err != nil {
+			return errors.Fatalf("blob not found: %v", err)
+		}
 
-			_, err = globalOptions.stdout.Write(buf)
+		buf, err := repo.LoadBlob(ctx, bh.Type, bh.ID, nil)
+		if err != nil {
 			return err
 		}
 
-		return errors.Fatal("blob not found")
+		_, err = globalOptions.stdout.Write(buf)
+		return err
 
 	case "tree":
 		sn, subfolder, err := restic.FindSnapshot(ctx, repo.Backend(), repo, args[1])
-		if err != nil {
+		if err != nil && strings.Contains(args[1], ":") {
 			return errors.Fatalf("could not find snapshot: %v\n", err)
 		}
 
-		err = repo.LoadIndex(ctx)
-		if err != nil {
-			return err
+		err2 := repo.LoadIndex(ctx)
+		if err2 != nil {
+			return err2
 		}
 
-		sn.Tree, err = restic.FindTreeDirectory(ctx, repo, sn.Tree, subfolder)
+		var treeID restic.ID
+		prefix := "/"
 		if err != nil {
-			return err
+			// the argument may be the ID of a tree instead of a snapshot
+			bh, lookupErr := repo.Index().LookupPrefix(ctx, args[1], restic.TreeBlob)
+			if lookupErr != nil {
+				return errors.Fatalf("could not find snapshot: %v, or tree: %v\n", err, lookupErr)
+			}
+			treeID = bh.ID
+		} else {
+			sn.Tree, err = restic.FindTreeDirectory(ctx, repo, sn.Tree, subfolder)
+			if err != nil {
+				return err
+			}
+			treeID = *sn.Tree
+			prefix = path.Join("/", subfolder)
+		}
+
+		if opts.Recursive {
+			return catTreeRecursive(ctx, repo, treeID, prefix, opts.Depth)
 		}
 
-		buf, err := repo.LoadBlob(ctx, restic.TreeBlob, *sn.Tree, nil)
+		buf, err := repo.LoadBlob(ctx, restic.TreeBlob, treeID, nil)
 		if err != nil {
 			return err
 		}
@@ -189,6 +253,37 @@ func runCat(ctx context.Context, gopts GlobalOptions, args []string) error {
 		return err
 
 	default:
-		return errors.Fatal("invalid type")
+		return invalidArguments(errors.Fatal("invalid type"))
 	}
 }
+
+// catTreeNode is printed by "cat tree --recursive --json" for each node.
+type catTreeNode struct {
+	Path string       `json:"path"`
+	Node *restic.Node `json:"node"`
+}
+
+// catTreeRecursive prints all nodes below the tree treeID as JSON lines in
+// depth-first order. The paths of the nodes start with prefix. If maxDepth is
+// not zero, only nodes up to maxDepth levels below the tree are printed.
+func catTreeRecursive(ctx context.Context, repo restic.Repository, treeID restic.ID, prefix string, maxDepth int) error {
+	enc := json.NewEncoder(globalOptions.stdout)
+	return walker.Walk(ctx, repo, treeID, nil, func(_ restic.ID, nodepath string, node *restic.Node, err error) (bool, error) {
+		if err != nil {
+			return false, err
+		}
+		if node == nil {
+			return false, nil
+		}
+
+		err = enc.Encode(catTreeNode{Path: path.Join(prefix, nodepath), Node: node})
+		if err != nil {
+			return false, err
+		}
+
+		if node.Type == "dir" && maxDepth > 0 && strings.Count(nodepath, "/") >= maxDepth {
+			return false, walker.ErrSkipNode
+		}
+		return false, nil
+	})
+}
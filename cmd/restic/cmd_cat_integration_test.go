@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func testRunCatTreeRecursive(t testing.TB, gopts GlobalOptions, depth int, target string) []catTreeNode {
+	buf, err := withCaptureStdout(func() error {
+		gopts.JSON = true
+		return runCat(context.TODO(), CatOptions{Recursive: true, Depth: depth}, gopts, []string{"tree", target})
+	})
+	rtest.OK(t, err)
+
+	var nodes []catTreeNode
+	sc := bufio.NewScanner(buf)
+	for sc.Scan() {
+		var node catTreeNode
+		rtest.OK(t, json.Unmarshal(sc.Bytes(), &node))
+		nodes = append(nodes, node)
+	}
+	rtest.OK(t, sc.Err())
+	return nodes
+}
+
+func TestCatTreeRecursive(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	files := map[string]string{
+		"a":         "content of a",
+		"dir/b":     "content of b",
+		"dir/sub/c": "content of c",
+		"dir/sub/d": "",
+	}
+	for name, data := range files {
+		filename := filepath.Join(env.testdata, filepath.FromSlash(name))
+		rtest.OK(t, os.MkdirAll(filepath.Dir(filename), 0755))
+		rtest.OK(t, os.WriteFile(filename, []byte(data), 0644))
+	}
+	testRunBackup(t, env.testdata, []string{"."}, BackupOptions{}, env.gopts)
+
+	type entry struct {
+		path    string
+		tpe     string
+		content restic.IDs
+	}
+	summarize := func(nodes []catTreeNode) []entry {
+		var entries []entry
+		for _, node := range nodes {
+			entries = append(entries, entry{node.Path, node.Node.Type, node.Node.Content})
+		}
+		return entries
+	}
+	contentOf := func(name string) restic.IDs {
+		if files[name] == "" {
+			return restic.IDs{}
+		}
+		return restic.IDs{restic.Hash([]byte(files[name]))}
+	}
+
+	// the nodes are printed in depth-first order
+	nodes := testRunCatTreeRecursive(t, env.gopts, 0, "latest")
+	rtest.Equals(t, []entry{
+		{"/a", "file", contentOf("a")},
+		{"/dir", "dir", nil},
+		{"/dir/b", "file", contentOf("dir/b")},
+		{"/dir/sub", "dir", nil},
+		{"/dir/sub/c", "file", contentOf("dir/sub/c")},
+		{"/dir/sub/d", "file", contentOf("dir/sub/d")},
+	}, summarize(nodes))
+	for _, node := range nodes {
+		rtest.Equals(t, filepath.Base(node.Path), node.Node.Name)
+		if node.Node.Type == "file" {
+			rtest.Equals(t, uint64(len(files[node.Path[1:]])), node.Node.Size)
+		} else {
+			rtest.Assert(t, node.Node.Subtree != nil, "dir %v without subtree", node.Path)
+		}
+	}
+
+	nodes = testRunCatTreeRecursive(t, env.gopts, 2, "latest")
+	rtest.Equals(t, []entry{
+		{"/a", "file", contentOf("a")},
+		{"/dir", "dir", nil},
+		{"/dir/b", "file", contentOf("dir/b")},
+		{"/dir/sub", "dir", nil},
+	}, summarize(nodes))
+
+	// the paths of a subfolder include the subfolder
+	nodes = testRunCatTreeRecursive(t, env.gopts, 0, "latest:dir/sub")
+	rtest.Equals(t, []entry{
+		{"/dir/sub/c", "file", contentOf("dir/sub/c")},
+		{"/dir/sub/d", "file", contentOf("dir/sub/d")},
+	}, summarize(nodes))
+
+	err := runCat(context.TODO(), CatOptions{Recursive: true}, env.gopts, []string{"tree", "latest"})
+	rtest.Assert(t, err != nil, "--recursive without --json did not fail")
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"fmt"
 	"math/rand"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -11,10 +14,12 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"github.com/restic/restic/internal/backend/location"
 	"github.com/restic/restic/internal/cache"
 	"github.com/restic/restic/internal/checker"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/ui"
 )
@@ -29,6 +34,12 @@ finds. It can also be used to read all data and therefore simulate a restore.
 By default, the "check" command will always load all data directly from the
 repository and not use a local cache.
 
+Before the pack files are listed, the number of backend operations the check
+will perform is estimated and printed. If the estimate exceeds the threshold
+set by "-o check.confirm-operations", which defaults to 100000 for cloud
+storage services, restic asks for confirmation. Pass --yes to skip the
+question.
+
 EXIT STATUS
 ===========
 
@@ -45,10 +56,13 @@ Exit status is 0 if the command was successful, and non-zero if there was any er
 
 // CheckOptions bundles all options for the 'check' command.
 type CheckOptions struct {
-	ReadData       bool
-	ReadDataSubset string
-	CheckUnused    bool
-	WithCache      bool
+	ReadData           bool
+	ReadDataSubset     string
+	CheckUnused        bool
+	WithCache          bool
+	VerifySnapshotKeys bool
+	OutFile            string
+	Yes                bool
 }
 
 var checkOptions CheckOptions
@@ -67,24 +81,27 @@ func init() {
 		panic(err)
 	}
 	f.BoolVar(&checkOptions.WithCache, "with-cache", false, "use existing cache, only read uncached data from repository")
+	f.BoolVar(&checkOptions.VerifySnapshotKeys, "verify-snapshot-keys", false, "report snapshots created by keys which no longer exist")
+	f.StringVar(&checkOptions.OutFile, "out-file", "", "write a JSON report of the check to `file`")
+	f.BoolVar(&checkOptions.Yes, "yes", false, "do not ask for confirmation if the check is estimated to perform many backend operations")
 }
 
 func checkFlags(opts CheckOptions) error {
 	if opts.ReadData && opts.ReadDataSubset != "" {
-		return errors.Fatal("check flags --read-data and --read-data-subset cannot be used together")
+		return invalidArguments(errors.Fatal("check flags --read-data and --read-data-subset cannot be used together"))
 	}
 	if opts.ReadDataSubset != "" {
 		dataSubset, err := stringToIntSlice(opts.ReadDataSubset)
-		argumentError := errors.Fatal("check flag --read-data-subset has invalid value, please see documentation")
+		argumentError := invalidArguments(errors.Fatal("check flag --read-data-subset has invalid value, please see documentation"))
 		if err == nil {
 			if len(dataSubset) != 2 {
 				return argumentError
 			}
 			if dataSubset[0] == 0 || dataSubset[1] == 0 || dataSubset[0] > dataSubset[1] {
-				return errors.Fatal("check flag --read-data-subset=n/t values must be positive integers, and n <= t, e.g. --read-data-subset=1/2")
+				return invalidArguments(errors.Fatal("check flag --read-data-subset=n/t values must be positive integers, and n <= t, e.g. --read-data-subset=1/2"))
 			}
 			if dataSubset[1] > totalBucketsMax {
-				return errors.Fatalf("check flag --read-data-subset=n/t t must be at most %d", totalBucketsMax)
+				return invalidArgumentsf("check flag --read-data-subset=n/t t must be at most %d", totalBucketsMax)
 			}
 		} else if strings.HasSuffix(opts.ReadDataSubset, "%") {
 			percentage, err := parsePercentage(opts.ReadDataSubset)
@@ -194,8 +211,40 @@ func prepareCheckCache(opts CheckOptions, gopts *GlobalOptions) (cleanup func())
 }
 
 func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args []string) error {
+	report := newCheckReport(opts)
+	err := checkRepository(ctx, opts, gopts, args, report)
+	if opts.OutFile == "" {
+		return err
+	}
+
+	// the report is also written if the check failed
+	report.finish(err)
+	werr := report.writeFile(opts.OutFile)
+	if err != nil {
+		if werr != nil {
+			Warnf("%v\n", werr)
+		}
+		return err
+	}
+	return werr
+}
+
+func checkRepository(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args []string, report *checkReport) error {
 	if len(args) != 0 {
-		return errors.Fatal("the check command expects no arguments, only options - please see `restic help check` for usage and flags")
+		return invalidArguments(errors.Fatal("the check command expects no arguments, only options - please see `restic help check` for usage and flags"))
+	}
+
+	var checkCfg checker.Config
+	if err := gopts.extended.Extract("check").Apply("check", &checkCfg); err != nil {
+		return err
+	}
+	treeMemoryLimit, err := checkCfg.MemoryLimitBytes()
+	if err != nil {
+		return errors.Fatal(err.Error())
+	}
+	confirmThreshold, err := checkConfirmThreshold(checkCfg, gopts)
+	if err != nil {
+		return err
 	}
 
 	cleanup := prepareCheckCache(opts, &gopts)
@@ -208,6 +257,11 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 	if err != nil {
 		return err
 	}
+	report.RepositoryID = repo.Config().ID
+
+	// check must see all snapshots and read the data stored in the repository
+	repo.DisableListCache()
+	repo.DisableDataCache()
 
 	if !gopts.NoLock {
 		Verbosef("create exclusive lock for repository\n")
@@ -220,12 +274,14 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 	}
 
 	chkr := checker.New(repo, opts.CheckUnused)
+	chkr.SetTreeLoadLimits(treeMemoryLimit, checkCfg.Readers)
 	err = chkr.LoadSnapshots(ctx)
 	if err != nil {
 		return err
 	}
 
 	Verbosef("load indexes\n")
+	report.startPhase("load-index")
 	hints, errs := chkr.LoadIndex(ctx)
 
 	errorsFound := false
@@ -235,12 +291,15 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 		switch hint.(type) {
 		case *checker.ErrDuplicatePacks, *checker.ErrOldIndexFormat:
 			Printf("%v\n", hint)
+			report.addError(checkSeverityHint, hint)
 			suggestIndexRebuild = true
 		case *checker.ErrMixedPack:
 			Printf("%v\n", hint)
+			report.addError(checkSeverityHint, hint)
 			mixedFound = true
 		default:
 			Warnf("error: %v\n", hint)
+			report.addError(checkSeverityError, hint)
 			errorsFound = true
 		}
 	}
@@ -255,25 +314,46 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 	if len(errs) > 0 {
 		for _, err := range errs {
 			Warnf("error: %v\n", err)
+			report.addError(checkSeverityError, err)
 		}
 		return errors.Fatal("LoadIndex returned errors")
 	}
 
+	readData, err := selectReadData(opts, chkr)
+	if err != nil {
+		return err
+	}
+
+	estimate, err := estimateCheckCost(ctx, repo, chkr, opts, readData)
+	if err != nil {
+		return err
+	}
+	report.Estimate = &estimate
+	Verbosef("estimated backend operations: %v\n", estimate)
+	err = confirmCheckCost(opts, gopts, confirmThreshold, estimate)
+	if err != nil {
+		return err
+	}
+
 	orphanedPacks := 0
 	errChan := make(chan error)
 
 	Verbosef("check all packs\n")
+	report.startPhase("packs")
 	go chkr.Packs(ctx, errChan)
 
 	for err := range errChan {
 		if checker.IsOrphanedPack(err) {
 			orphanedPacks++
 			Verbosef("%v\n", err)
+			report.addError(checkSeverityHint, err)
 		} else if err == checker.ErrLegacyLayout {
-			Verbosef("repository still uses the S3 legacy layout\nPlease run `restic migrate s3legacy` to correct this.\n")
+			Verbosef("repository still uses the S3 legacy layout\nPlease run `restic migrate s3_layout` to correct this.\n")
+			report.addError(checkSeverityHint, err)
 		} else {
 			errorsFound = true
 			Warnf("%v\n", err)
+			report.addError(checkSeverityError, err)
 		}
 	}
 
@@ -282,19 +362,21 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 	}
 
 	Verbosef("check snapshots, trees and blobs\n")
+	report.startPhase("structure")
 	errChan = make(chan error)
 	var wg sync.WaitGroup
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		bar := newProgressMax(!gopts.Quiet, 0, "snapshots")
+		bar := newPhaseProgress(gopts, "check-structure", 0, 0, "snapshots")
 		defer bar.Done()
 		chkr.Structure(ctx, bar, errChan)
 	}()
 
 	for err := range errChan {
 		errorsFound = true
+		report.addError(checkSeverityError, err)
 		if e, ok := err.(*checker.TreeError); ok {
 			var clean string
 			if stdoutCanUpdateStatus() {
@@ -314,46 +396,261 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 	// deadlocking in the case of errors.
 	wg.Wait()
 
+	if opts.VerifySnapshotKeys {
+		Verbosef("check keys of snapshots\n")
+		report.startPhase("snapshot-keys")
+		unknown, errs := chkr.SnapshotKeys(ctx)
+		for _, err := range errs {
+			errorsFound = true
+			Warnf("error: %v\n", err)
+			report.addError(checkSeverityError, err)
+		}
+		if unknown > 0 {
+			Verbosef("%d snapshots do not record the key which created them\n", unknown)
+		}
+	}
+
 	if opts.CheckUnused {
+		report.startPhase("unused-blobs")
 		for _, id := range chkr.UnusedBlobs(ctx) {
 			Verbosef("unused blob %v\n", id)
+			report.add(checkSeverityError, "unused-blob", id.ID, fmt.Sprintf("unused blob %v", id))
 			errorsFound = true
 		}
 	}
 
-	doReadData := func(packs map[restic.ID]int64) {
-		packCount := uint64(len(packs))
+	if readData != nil {
+		report.startPhase("read-data")
+		report.setReadData(readData.name, readData.seed, readData.packs)
+		Verbosef("%v\n", readData.message)
+
+		var packSize uint64
+		for _, size := range readData.packs {
+			packSize += uint64(size)
+		}
 
-		p := newProgressMax(!gopts.Quiet, packCount, "packs")
+		p := newPhaseProgress(gopts, "read-data", uint64(len(readData.packs)), packSize, "packs")
 		errChan := make(chan error)
 
-		go chkr.ReadPacks(ctx, packs, p, errChan)
+		go chkr.ReadPacks(ctx, readData.packs, p, errChan)
 
 		for err := range errChan {
 			errorsFound = true
 			Warnf("%v\n", err)
+			report.addError(checkSeverityError, err)
 		}
 		p.Done()
 	}
 
+	if errorsFound {
+		return errors.Fatal("repository contains errors")
+	}
+
+	Verbosef("no errors were found\n")
+
+	return nil
+}
+
+// meteredBackends contains the schemes of the backends whose storage services
+// usually bill each request.
+var meteredBackends = map[string]bool{
+	"azure": true,
+	"b2":    true,
+	"gs":    true,
+	"s3":    true,
+	"swift": true,
+}
+
+// defaultConfirmOperations is the default of check.confirm-operations for
+// metered backends.
+const defaultConfirmOperations = 100000
+
+// checkConfirmThreshold returns the number of estimated backend operations
+// above which check asks for confirmation, zero means never.
+func checkConfirmThreshold(cfg checker.Config, gopts GlobalOptions) (uint64, error) {
+	if cfg.ConfirmOperations != "" {
+		n, err := strconv.ParseUint(cfg.ConfirmOperations, 10, 64)
+		if err != nil {
+			return 0, errors.Fatalf("invalid check.confirm-operations %q: must be a non-negative number", cfg.ConfirmOperations)
+		}
+		return n, nil
+	}
+
+	repo, err := ReadRepo(gopts)
+	if err != nil {
+		return 0, err
+	}
+	loc, err := location.Parse(gopts.backends, repo)
+	if err != nil || !meteredBackends[loc.Scheme] {
+		// an invalid location is reported when opening the repository
+		return 0, nil
+	}
+	return defaultConfirmOperations, nil
+}
+
+// checkListPageSize is the number of files returned by a single request when
+// listing files, this is the page size used by most cloud storage services.
+const checkListPageSize = 1000
+
+// checkCostEstimate counts the backend operations performed by check after
+// the index was loaded. Check does not stat files, thus only listings and
+// loads are counted. LoadedBytes is the amount of data loaded.
+type checkCostEstimate struct {
+	Lists       uint64 `json:"lists"`
+	ListedFiles uint64 `json:"listed_files"`
+	Loads       uint64 `json:"loads"`
+	LoadedBytes uint64 `json:"loaded_bytes"`
+}
+
+// operations returns the number of requests sent to the backend. Listings
+// require an additional request for each checkListPageSize files.
+func (e checkCostEstimate) operations() uint64 {
+	return e.Lists + e.ListedFiles/checkListPageSize + e.Loads
+}
+
+func (e checkCostEstimate) String() string {
+	return fmt.Sprintf("%d list (%d files), %d load (%v), %d requests in total",
+		e.Lists, e.ListedFiles, e.Loads, ui.FormatBytes(e.LoadedBytes), e.operations())
+}
+
+// estimateCheckCost estimates the backend operations of the remaining phases
+// of check from the loaded index and the list of snapshots. Files which are
+// already cached are not loaded from the backend. The estimate is an upper
+// bound for loads, as the trees which are not referenced by any snapshot are
+// not loaded. Pack files missing from the index are not known before listing
+// them and are not included.
+func estimateCheckCost(ctx context.Context, repo *repository.Repository, chkr *checker.Checker, opts CheckOptions, readData *checkReadDataSelection) (checkCostEstimate, error) {
+	var est checkCostEstimate
+	cached := func(h restic.Handle) bool {
+		return repo.Cache != nil && repo.Cache.Has(h)
+	}
+	load := func(size int64) {
+		est.Loads++
+		est.LoadedBytes += uint64(size)
+	}
+
+	// packs: list all pack files
+	est.Lists++
+	est.ListedFiles += chkr.CountPacks()
+
+	// structure: load all snapshots, then the trees
+	err := chkr.Snapshots().List(ctx, restic.SnapshotFile, func(fi restic.FileInfo) error {
+		if cached(restic.Handle{Type: restic.SnapshotFile, Name: fi.Name}) {
+			return nil
+		}
+		load(fi.Size)
+		if opts.VerifySnapshotKeys && repo.Cache == nil {
+			// loaded again to verify the keys
+			load(fi.Size)
+		}
+		return nil
+	})
+	if err != nil {
+		return est, err
+	}
+
+	// with a cache each pack containing trees is loaded once, otherwise each
+	// tree is loaded separately
+	packs := chkr.GetPacks()
+	trees := restic.NewBlobSet()
+	treePacks := restic.NewIDSet()
+	repo.Index().Each(ctx, func(pb restic.PackedBlob) {
+		if pb.Type != restic.TreeBlob {
+			return
+		}
+		if repo.Cache != nil {
+			treePacks.Insert(pb.PackID)
+		} else if !trees.Has(pb.BlobHandle) {
+			trees.Insert(pb.BlobHandle)
+			load(int64(pb.Length))
+		}
+	})
+	if ctx.Err() != nil {
+		return est, ctx.Err()
+	}
+	for id := range treePacks {
+		if !cached(restic.Handle{Type: restic.PackFile, Name: id.String(), ContainedBlobType: restic.TreeBlob}) {
+			load(packs[id])
+		}
+	}
+
+	if opts.VerifySnapshotKeys {
+		est.Lists++
+	}
+
+	// read-data: the data cache is disabled, all selected packs are loaded
+	if readData != nil {
+		for _, size := range readData.packs {
+			load(size)
+		}
+	}
+
+	return est, nil
+}
+
+// confirmCheckCost asks the user to confirm the check if the estimated number
+// of backend operations exceeds threshold. Without a terminal the check is
+// aborted instead, unless --yes was specified.
+func confirmCheckCost(opts CheckOptions, gopts GlobalOptions, threshold uint64, estimate checkCostEstimate) error {
+	ops := estimate.operations()
+	if threshold == 0 || ops <= threshold || opts.Yes {
+		return nil
+	}
+
+	msg := fmt.Sprintf("check is estimated to send %d requests to the backend, which exceeds the threshold of %d", ops, threshold)
+	if gopts.JSON || !stdinIsTerminal() {
+		return errors.Fatalf("%s, use --yes to run it anyway", msg)
+	}
+
+	fmt.Fprintf(os.Stderr, "%s (%v)\ncontinue? [y/N] ", msg, estimate)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return errors.Fatal("check aborted")
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return errors.Fatal("check aborted")
+}
+
+// checkReadDataSelection contains the packs selected by --read-data or
+// --read-data-subset.
+type checkReadDataSelection struct {
+	name    string
+	seed    *int64
+	packs   map[restic.ID]int64
+	message string
+}
+
+// selectReadData returns the packs which must be read according to opts, or
+// nil if no data is read.
+func selectReadData(opts CheckOptions, chkr *checker.Checker) (*checkReadDataSelection, error) {
 	switch {
 	case opts.ReadData:
-		Verbosef("read all data\n")
-		doReadData(selectPacksByBucket(chkr.GetPacks(), 1, 1))
+		return &checkReadDataSelection{
+			name:    "all",
+			packs:   selectPacksByBucket(chkr.GetPacks(), 1, 1),
+			message: "read all data",
+		}, nil
 	case opts.ReadDataSubset != "":
-		var packs map[restic.ID]int64
+		sel := &checkReadDataSelection{}
+		// the seed is recorded in the report to allow reproducing a random selection
+		seed := time.Now().UnixNano()
 		dataSubset, err := stringToIntSlice(opts.ReadDataSubset)
 		if err == nil {
 			bucket := dataSubset[0]
 			totalBuckets := dataSubset[1]
-			packs = selectPacksByBucket(chkr.GetPacks(), bucket, totalBuckets)
-			packCount := uint64(len(packs))
-			Verbosef("read group #%d of %d data packs (out of total %d packs in %d groups)\n", bucket, packCount, chkr.CountPacks(), totalBuckets)
+			sel.packs = selectPacksByBucket(chkr.GetPacks(), bucket, totalBuckets)
+			sel.name = "bucket"
+			sel.message = fmt.Sprintf("read group #%d of %d data packs (out of total %d packs in %d groups)", bucket, len(sel.packs), chkr.CountPacks(), totalBuckets)
 		} else if strings.HasSuffix(opts.ReadDataSubset, "%") {
 			percentage, err := parsePercentage(opts.ReadDataSubset)
 			if err == nil {
-				packs = selectRandomPacksByPercentage(chkr.GetPacks(), percentage)
-				Verbosef("read %.1f%% of data packs\n", percentage)
+				sel.packs = selectRandomPacksByPercentage(chkr.GetPacks(), percentage, seed)
+				sel.name = "percentage"
+				sel.seed = &seed
+				sel.message = fmt.Sprintf("read %.1f%% of data packs", percentage)
 			}
 		} else {
 			repoSize := int64(0)
@@ -362,28 +659,23 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 				repoSize += size
 			}
 			if repoSize == 0 {
-				return errors.Fatal("Cannot read from a repository having size 0")
+				return nil, errors.Fatal("Cannot read from a repository having size 0")
 			}
 			subsetSize, _ := ui.ParseBytes(opts.ReadDataSubset)
 			if subsetSize > repoSize {
 				subsetSize = repoSize
 			}
-			packs = selectRandomPacksByFileSize(chkr.GetPacks(), subsetSize, repoSize)
-			Verbosef("read %d bytes of data packs\n", subsetSize)
+			sel.packs = selectRandomPacksByFileSize(chkr.GetPacks(), subsetSize, repoSize, seed)
+			sel.name = "size"
+			sel.seed = &seed
+			sel.message = fmt.Sprintf("read %d bytes of data packs", subsetSize)
 		}
-		if packs == nil {
-			return errors.Fatal("internal error: failed to select packs to check")
+		if sel.packs == nil {
+			return nil, errors.Fatal("internal error: failed to select packs to check")
 		}
-		doReadData(packs)
+		return sel, nil
 	}
-
-	if errorsFound {
-		return errors.Fatal("repository contains errors")
-	}
-
-	Verbosef("no errors were found\n")
-
-	return nil
+	return nil, nil
 }
 
 // selectPacksByBucket selects subsets of packs by ranges of buckets.
@@ -400,20 +692,21 @@ func selectPacksByBucket(allPacks map[restic.ID]int64, bucket, totalBuckets uint
 }
 
 // selectRandomPacksByPercentage selects the given percentage of packs which are randomly choosen.
-func selectRandomPacksByPercentage(allPacks map[restic.ID]int64, percentage float64) map[restic.ID]int64 {
+// For the same packs and seed, the selection is always the same.
+func selectRandomPacksByPercentage(allPacks map[restic.ID]int64, percentage float64, seed int64) map[restic.ID]int64 {
 	packCount := len(allPacks)
 	packsToCheck := int(float64(packCount) * (percentage / 100.0))
 	if packCount > 0 && packsToCheck < 1 {
 		packsToCheck = 1
 	}
-	timeNs := time.Now().UnixNano()
-	r := rand.New(rand.NewSource(timeNs))
+	r := rand.New(rand.NewSource(seed))
 	idx := r.Perm(packCount)
 
-	var keys []restic.ID
+	var keys restic.IDs
 	for k := range allPacks {
 		keys = append(keys, k)
 	}
+	sort.Sort(keys)
 
 	packs := make(map[restic.ID]int64)
 
@@ -424,8 +717,8 @@ func selectRandomPacksByPercentage(allPacks map[restic.ID]int64, percentage floa
 	return packs
 }
 
-func selectRandomPacksByFileSize(allPacks map[restic.ID]int64, subsetSize int64, repoSize int64) map[restic.ID]int64 {
+func selectRandomPacksByFileSize(allPacks map[restic.ID]int64, subsetSize int64, repoSize int64, seed int64) map[restic.ID]int64 {
 	subsetPercentage := (float64(subsetSize) / float64(repoSize)) * 100.0
-	packs := selectRandomPacksByPercentage(allPacks, subsetPercentage)
+	packs := selectRandomPacksByPercentage(allPacks, subsetPercentage, seed)
 	return packs
 }
@@ -2,8 +2,17 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 
+	"github.com/restic/restic/internal/checker"
+	"github.com/restic/restic/internal/options"
+	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
 )
 
@@ -32,3 +41,321 @@ func testRunCheckOutput(gopts GlobalOptions, checkUnused bool) (string, error) {
 	})
 	return buf.String(), err
 }
+
+func TestCheckProgressJSON(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+
+	buf, err := withCaptureStdout(func() error {
+		gopts := env.gopts
+		gopts.JSON = true
+		gopts.Quiet = false
+		return runCheck(context.TODO(), CheckOptions{ReadData: true}, gopts, nil)
+	})
+	rtest.OK(t, err)
+
+	checkPhaseProgress(t, buf.Bytes(), "check-structure", false)
+	checkPhaseProgress(t, buf.Bytes(), "read-data", true)
+}
+
+func TestCheckVerifySnapshotKeys(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	// must list keys more than once
+	env.gopts.backendTestHook = nil
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+
+	testRunKeyAddNewKey(t, "geheim2", env.gopts)
+	gopts2 := env.gopts
+	gopts2.password = "geheim2"
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, gopts2)
+
+	repo, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+	repo2, err := OpenRepository(context.TODO(), gopts2)
+	rtest.OK(t, err)
+	rtest.Assert(t, repo.KeyID() != repo2.KeyID(), "expected different keys")
+
+	// the key ID is included in the JSON output of the snapshots command
+	var removedSnapshot restic.ID
+	_, snapshots := testRunSnapshots(t, env.gopts)
+	rtest.Equals(t, 2, len(snapshots))
+	for id, sn := range snapshots {
+		rtest.Assert(t, sn.KeyID != nil, "snapshot %v has no key ID", id.Str())
+		rtest.Assert(t, *sn.KeyID == repo.KeyID() || *sn.KeyID == repo2.KeyID(), "snapshot %v has unexpected key ID %v", id.Str(), sn.KeyID)
+		if *sn.KeyID == repo2.KeyID() {
+			removedSnapshot = id
+		}
+	}
+
+	verify := func(gopts GlobalOptions) error {
+		_, err := withCaptureStdout(func() error {
+			return runCheck(context.TODO(), CheckOptions{VerifySnapshotKeys: true}, gopts, nil)
+		})
+		return err
+	}
+	rtest.OK(t, verify(env.gopts))
+
+	testRunKeyRemove(t, env.gopts, []string{repo2.KeyID().String()})
+	rtest.Assert(t, verify(env.gopts) != nil, "expected check to report the removed key")
+
+	chkr := checker.New(repo, false)
+	rtest.OK(t, chkr.LoadSnapshots(context.TODO()))
+	unknown, errs := chkr.SnapshotKeys(context.TODO())
+	rtest.Equals(t, 0, unknown)
+	rtest.Equals(t, []error{&checker.SnapshotKeyError{SnapshotID: removedSnapshot, KeyID: repo2.KeyID()}}, errs)
+}
+
+func loadCheckReport(t testing.TB, filename string) checkReport {
+	buf, err := os.ReadFile(filename)
+	rtest.OK(t, err)
+	var report checkReport
+	rtest.OK(t, json.Unmarshal(buf, &report))
+	return report
+}
+
+func TestCheckReport(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	// the second backup stores another data pack
+	rtest.OK(t, os.WriteFile(filepath.Join(env.testdata, "extra"), rtest.Random(23, 1024), 0644))
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+
+	repo, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+	rtest.OK(t, repo.LoadIndex(context.TODO()))
+	allPacks := listPacks(env.gopts, t)
+	dataPacks := restic.NewIDSet()
+	repo.Index().Each(context.TODO(), func(pb restic.PackedBlob) {
+		if pb.Type == restic.DataBlob {
+			dataPacks.Insert(pb.PackID)
+		}
+	})
+	rtest.Assert(t, len(dataPacks) >= 2, "expected at least two data packs, got %v", len(dataPacks))
+
+	filename := filepath.Join(env.base, "report.json")
+	opts := CheckOptions{ReadData: true, OutFile: filename}
+	_, err = withCaptureStdout(func() error {
+		return runCheck(context.TODO(), opts, env.gopts, nil)
+	})
+	rtest.OK(t, err)
+
+	report := loadCheckReport(t, filename)
+	rtest.Assert(t, report.Success && report.Error == "", "unexpected result %v, %q", report.Success, report.Error)
+	rtest.Equals(t, repo.Config().ID, report.RepositoryID)
+	rtest.Equals(t, version, report.Version)
+	rtest.Equals(t, checkReportOptions{ReadData: true}, report.Options)
+	rtest.Assert(t, !report.FinishedAt.Before(report.StartedAt), "invalid times %v - %v", report.StartedAt, report.FinishedAt)
+	rtest.Equals(t, []checkFinding{}, report.Findings)
+	rtest.Equals(t, len(allPacks), report.ReadData.PackCount)
+
+	// damage one data pack and remove another one
+	ids := dataPacks.List()
+	damaged, missing := ids[0], ids[1]
+	fn := filepath.Join(env.repo, "data", damaged.String()[:2], damaged.String())
+	buf, err := os.ReadFile(fn)
+	rtest.OK(t, err)
+	buf[len(buf)/2] ^= 0xff
+	rtest.OK(t, os.Chmod(fn, 0644))
+	rtest.OK(t, os.WriteFile(fn, buf, 0644))
+	removePacks(env.gopts, t, restic.NewIDSet(missing))
+
+	_, err = withCaptureStdout(func() error {
+		return runCheck(context.TODO(), opts, env.gopts, nil)
+	})
+	rtest.Assert(t, err != nil, "expected check of damaged repository to fail")
+
+	report = loadCheckReport(t, filename)
+	rtest.Assert(t, !report.Success && report.Error == err.Error(), "unexpected result %v, %q", report.Success, report.Error)
+
+	phases := make(map[string]checkPhaseResult)
+	for _, phase := range report.Phases {
+		phases[phase.Name] = *phase
+	}
+	rtest.Equals(t, map[string]checkPhaseResult{
+		"load-index": {Name: "load-index"},
+		"packs":      {Name: "packs", Errors: 1},
+		"structure":  {Name: "structure"},
+		"read-data":  {Name: "read-data", Errors: 2},
+	}, phases)
+
+	found := make(map[string]restic.IDSet)
+	for _, f := range report.Findings {
+		rtest.Equals(t, checkSeverityError, f.Severity)
+		rtest.Equals(t, "pack", f.Kind)
+		if found[f.Phase] == nil {
+			found[f.Phase] = restic.NewIDSet()
+		}
+		found[f.Phase].Insert(restic.TestParseID(f.ID))
+	}
+	rtest.Equals(t, map[string]restic.IDSet{
+		"packs":     restic.NewIDSet(missing),
+		"read-data": restic.NewIDSet(damaged, missing),
+	}, found)
+
+	// the read data contains all indexed packs
+	rtest.Equals(t, "all", report.ReadData.Selection)
+	rtest.Assert(t, report.ReadData.Seed == nil, "unexpected seed")
+	read := restic.NewIDSet()
+	for _, id := range report.ReadData.Packs {
+		read.Insert(restic.TestParseID(id))
+	}
+	rtest.Equals(t, allPacks, read)
+}
+
+func TestCheckReportSubsetSeed(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+
+	filename := filepath.Join(env.base, "report.json")
+	opts := CheckOptions{ReadDataSubset: "50%", OutFile: filename}
+	_, err := withCaptureStdout(func() error {
+		return runCheck(context.TODO(), opts, env.gopts, nil)
+	})
+	rtest.OK(t, err)
+
+	report := loadCheckReport(t, filename)
+	rtest.Equals(t, "percentage", report.ReadData.Selection)
+	rtest.Assert(t, report.ReadData.Seed != nil, "missing seed")
+
+	// the seed reproduces the selection
+	repo, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+	chkr := checker.New(repo, false)
+	hints, errs := chkr.LoadIndex(context.TODO())
+	rtest.Equals(t, 0, len(hints)+len(errs))
+	packs := selectRandomPacksByPercentage(chkr.GetPacks(), 50, *report.ReadData.Seed)
+	rtest.Equals(t, len(packs), report.ReadData.PackCount)
+	for _, id := range report.ReadData.Packs {
+		_, ok := packs[restic.TestParseID(id)]
+		rtest.Assert(t, ok, "pack %v was not selected", id)
+	}
+}
+
+// opCountingBackend counts the list and load operations, except for locks.
+type opCountingBackend struct {
+	restic.Backend
+	m     sync.Mutex
+	count checkCostEstimate
+}
+
+func (be *opCountingBackend) List(ctx context.Context, t restic.FileType, fn func(restic.FileInfo) error) error {
+	if t == restic.LockFile {
+		return be.Backend.List(ctx, t, fn)
+	}
+	be.m.Lock()
+	be.count.Lists++
+	be.m.Unlock()
+	return be.Backend.List(ctx, t, func(fi restic.FileInfo) error {
+		be.m.Lock()
+		be.count.ListedFiles++
+		be.m.Unlock()
+		return fn(fi)
+	})
+}
+
+type countingReader struct {
+	io.Reader
+	n uint64
+}
+
+func (rd *countingReader) Read(p []byte) (int, error) {
+	n, err := rd.Reader.Read(p)
+	rd.n += uint64(n)
+	return n, err
+}
+
+func (be *opCountingBackend) Load(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+	if h.Type == restic.LockFile {
+		return be.Backend.Load(ctx, h, length, offset, fn)
+	}
+	return be.Backend.Load(ctx, h, length, offset, func(rd io.Reader) error {
+		crd := &countingReader{Reader: rd}
+		err := fn(crd)
+		be.m.Lock()
+		be.count.Loads++
+		be.count.LoadedBytes += crd.n
+		be.m.Unlock()
+		return err
+	})
+}
+
+func (be *opCountingBackend) reset() checkCostEstimate {
+	be.m.Lock()
+	defer be.m.Unlock()
+	count := be.count
+	be.count = checkCostEstimate{}
+	return count
+}
+
+func TestCheckCostEstimate(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	rtest.OK(t, os.WriteFile(filepath.Join(env.testdata, "extra"), rtest.Random(23, 1024), 0644))
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+
+	counter := &opCountingBackend{}
+	gopts := env.gopts
+	gopts.backendTestHook = func(r restic.Backend) (restic.Backend, error) {
+		counter.Backend = r
+		return counter, nil
+	}
+	gopts.extended = options.Options{"check.confirm-operations": "1"}
+	filename := filepath.Join(env.base, "report.json")
+
+	for _, test := range []struct {
+		name    string
+		opts    CheckOptions
+		noCache bool
+	}{
+		{"structure", CheckOptions{}, false},
+		{"structure-no-cache", CheckOptions{}, true},
+		{"read-data", CheckOptions{ReadData: true}, false},
+		{"read-data-subset-no-cache", CheckOptions{ReadDataSubset: "1/2"}, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			gopts := gopts
+			gopts.NoCache = test.noCache
+
+			// the check is aborted right after the estimate, which yields
+			// the operations required to load the index
+			_, err := withCaptureStdout(func() error {
+				return runCheck(context.TODO(), test.opts, gopts, nil)
+			})
+			rtest.Assert(t, err != nil && strings.Contains(err.Error(), "use --yes"), "expected check to ask for confirmation, got %v", err)
+			before := counter.reset()
+
+			opts := test.opts
+			opts.Yes = true
+			opts.OutFile = filename
+			_, err = withCaptureStdout(func() error {
+				return runCheck(context.TODO(), opts, gopts, nil)
+			})
+			rtest.OK(t, err)
+			total := counter.reset()
+
+			report := loadCheckReport(t, filename)
+			rtest.Assert(t, report.Estimate != nil, "missing estimate")
+			rtest.Equals(t, checkCostEstimate{
+				Lists:       total.Lists - before.Lists,
+				ListedFiles: total.ListedFiles - before.ListedFiles,
+				Loads:       total.Loads - before.Loads,
+				LoadedBytes: total.LoadedBytes - before.LoadedBytes,
+			}, *report.Estimate)
+		})
+	}
+}
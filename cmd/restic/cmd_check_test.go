@@ -4,7 +4,9 @@ import (
 	"math"
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/restic/restic/internal/checker"
 	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
 )
@@ -98,24 +100,24 @@ func TestSelectRandomPacksByPercentage(t *testing.T) {
 		testPacks[restic.NewRandomID()] = 0
 	}
 
-	selectedPacks := selectRandomPacksByPercentage(testPacks, 0.0)
+	selectedPacks := selectRandomPacksByPercentage(testPacks, 0.0, time.Now().UnixNano())
 	rtest.Assert(t, len(selectedPacks) == 1, "Expected 1 selected packs")
 
-	selectedPacks = selectRandomPacksByPercentage(testPacks, 10.0)
+	selectedPacks = selectRandomPacksByPercentage(testPacks, 10.0, time.Now().UnixNano())
 	rtest.Assert(t, len(selectedPacks) == 1, "Expected 1 selected pack")
 	for pack := range selectedPacks {
 		_, ok := testPacks[pack]
 		rtest.Assert(t, ok, "Unexpected selection")
 	}
 
-	selectedPacks = selectRandomPacksByPercentage(testPacks, 50.0)
+	selectedPacks = selectRandomPacksByPercentage(testPacks, 50.0, time.Now().UnixNano())
 	rtest.Assert(t, len(selectedPacks) == 5, "Expected 5 selected packs")
 	for pack := range selectedPacks {
 		_, ok := testPacks[pack]
 		rtest.Assert(t, ok, "Unexpected item in selection")
 	}
 
-	selectedPacks = selectRandomPacksByPercentage(testPacks, 100.0)
+	selectedPacks = selectRandomPacksByPercentage(testPacks, 100.0, time.Now().UnixNano())
 	rtest.Assert(t, len(selectedPacks) == 10, "Expected 10 selected packs")
 	for testPack := range testPacks {
 		_, ok := selectedPacks[testPack]
@@ -123,10 +125,24 @@ func TestSelectRandomPacksByPercentage(t *testing.T) {
 	}
 }
 
+func TestSelectRandomPacksByPercentageSeed(t *testing.T) {
+	var testPacks = make(map[restic.ID]int64)
+	for i := 1; i <= 100; i++ {
+		testPacks[restic.NewRandomID()] = 0
+	}
+
+	// the same seed must result in the same selection
+	selectedPacks := selectRandomPacksByPercentage(testPacks, 10.0, 42)
+	rtest.Equals(t, 10, len(selectedPacks))
+	for i := 0; i < 5; i++ {
+		rtest.Equals(t, selectedPacks, selectRandomPacksByPercentage(testPacks, 10.0, 42))
+	}
+}
+
 func TestSelectNoRandomPacksByPercentage(t *testing.T) {
 	// that the a repository without pack files works
 	var testPacks = make(map[restic.ID]int64)
-	selectedPacks := selectRandomPacksByPercentage(testPacks, 10.0)
+	selectedPacks := selectRandomPacksByPercentage(testPacks, 10.0, time.Now().UnixNano())
 	rtest.Assert(t, len(selectedPacks) == 0, "Expected 0 selected packs")
 }
 
@@ -139,17 +155,17 @@ func TestSelectRandomPacksByFileSize(t *testing.T) {
 		testPacks[id] = 0
 	}
 
-	selectedPacks := selectRandomPacksByFileSize(testPacks, 10, 500)
+	selectedPacks := selectRandomPacksByFileSize(testPacks, 10, 500, time.Now().UnixNano())
 	rtest.Assert(t, len(selectedPacks) == 1, "Expected 1 selected packs")
 
-	selectedPacks = selectRandomPacksByFileSize(testPacks, 10240, 51200)
+	selectedPacks = selectRandomPacksByFileSize(testPacks, 10240, 51200, time.Now().UnixNano())
 	rtest.Assert(t, len(selectedPacks) == 2, "Expected 2 selected packs")
 	for pack := range selectedPacks {
 		_, ok := testPacks[pack]
 		rtest.Assert(t, ok, "Unexpected selection")
 	}
 
-	selectedPacks = selectRandomPacksByFileSize(testPacks, 500, 500)
+	selectedPacks = selectRandomPacksByFileSize(testPacks, 500, 500, time.Now().UnixNano())
 	rtest.Assert(t, len(selectedPacks) == 10, "Expected 10 selected packs")
 	for pack := range selectedPacks {
 		_, ok := testPacks[pack]
@@ -160,6 +176,39 @@ func TestSelectRandomPacksByFileSize(t *testing.T) {
 func TestSelectNoRandomPacksByFileSize(t *testing.T) {
 	// that the a repository without pack files works
 	var testPacks = make(map[restic.ID]int64)
-	selectedPacks := selectRandomPacksByFileSize(testPacks, 10, 500)
+	selectedPacks := selectRandomPacksByFileSize(testPacks, 10, 500, time.Now().UnixNano())
 	rtest.Assert(t, len(selectedPacks) == 0, "Expected 0 selected packs")
 }
+
+func TestCheckConfirmThreshold(t *testing.T) {
+	for _, test := range []struct {
+		repo      string
+		option    string
+		threshold uint64
+		err       bool
+	}{
+		{"/srv/repo", "", 0, false},
+		{"sftp:host:/srv/repo", "", 0, false},
+		{"b2:bucket:repo", "", defaultConfirmOperations, false},
+		{"s3:s3.amazonaws.com/bucket", "", defaultConfirmOperations, false},
+		{"b2:bucket:repo", "0", 0, false},
+		{"/srv/repo", "500", 500, false},
+		{"/srv/repo", "-1", 0, true},
+		{"/srv/repo", "many", 0, true},
+	} {
+		gopts := GlobalOptions{Repo: test.repo, backends: globalOptions.backends}
+		threshold, err := checkConfirmThreshold(checker.Config{ConfirmOperations: test.option}, gopts)
+		if test.err {
+			rtest.Assert(t, err != nil, "expected error for %q", test.option)
+			continue
+		}
+		rtest.OK(t, err)
+		rtest.Equals(t, test.threshold, threshold)
+	}
+}
+
+func TestCheckCostOperations(t *testing.T) {
+	est := checkCostEstimate{Lists: 2, ListedFiles: 2500, Loads: 10}
+	// two additional requests for the listed pages
+	rtest.Equals(t, uint64(14), est.operations())
+}
@@ -3,12 +3,18 @@ package main
 import (
 	"context"
 	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
 
 	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/filter"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/walker"
 	"golang.org/x/sync/errgroup"
 
 	"github.com/spf13/cobra"
@@ -31,6 +37,12 @@ This means that copied files, which existed in both the source and destination
 repository, /may occupy up to twice their space/ in the destination repository.
 This can be mitigated by the "--copy-chunker-params" option when initializing a
 new destination repository using the "init" command.
+
+The "--include" and "--exclude" options restrict the copy to the matching files
+and directories. Only the data referenced by the remaining files is copied. The
+paths of the new snapshot are adjusted to the copied content and the source
+snapshot is recorded as the original snapshot. Snapshots for which no file
+matches are not copied.
 `,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return runCopy(cmd.Context(), copyOptions, globalOptions, args)
@@ -41,6 +53,9 @@ new destination repository using the "init" command.
 type CopyOptions struct {
 	secondaryRepoOptions
 	restic.SnapshotFilter
+	excludePatternOptions
+	Include            []string
+	InsensitiveInclude []string
 }
 
 var copyOptions CopyOptions
@@ -51,9 +66,21 @@ func init() {
 	f := cmdCopy.Flags()
 	initSecondaryRepoOptions(f, &copyOptions.secondaryRepoOptions, "destination", "to copy snapshots from")
 	initMultiSnapshotFilter(f, &copyOptions.SnapshotFilter, true)
+	initExcludePatternOptions(f, &copyOptions.excludePatternOptions)
+	f.StringArrayVarP(&copyOptions.Include, "include", "i", nil, "only copy files and directories matching `pattern` (can be specified multiple times)")
+	f.StringArrayVar(&copyOptions.InsensitiveInclude, "iinclude", nil, "same as `--include` but ignores the casing of filenames")
 }
 
 func runCopy(ctx context.Context, opts CopyOptions, gopts GlobalOptions, args []string) error {
+	nodeFilter, err := newCopyFilter(opts)
+	if err != nil {
+		return err
+	}
+
+	if err := checkReadOnly(gopts, "copy"); err != nil {
+		return err
+	}
+
 	secondaryGopts, isFromRepo, err := fillSecondaryGlobalOpts(opts.secondaryRepoOptions, gopts, "destination")
 	if err != nil {
 		return err
@@ -121,6 +148,21 @@ func runCopy(ctx context.Context, opts CopyOptions, gopts GlobalOptions, args []
 	visitedTrees := restic.NewIDSet()
 
 	for sn := range FindFilteredSnapshots(ctx, srcSnapshotLister, srcRepo, &opts.SnapshotFilter, args) {
+		var trees *filteredTrees
+		if nodeFilter != nil {
+			trees = newFilteredTrees(srcRepo)
+			filtered, err := nodeFilter.filterSnapshot(ctx, trees, sn)
+			if err != nil {
+				return err
+			}
+			if filtered == nil {
+				Verbosef("\nsnapshot %s of %v at %s)\n", sn.ID().Str(), sn.Paths, sn.Time)
+				Verbosef("skipping source snapshot %s, no files match\n", sn.ID().Str())
+				continue
+			}
+			sn = filtered
+		}
+
 		// check whether the destination has a snapshot with the same persistent ID which has similar snapshot fields
 		srcOriginal := *sn.ID()
 		if sn.Original != nil {
@@ -142,7 +184,7 @@ func runCopy(ctx context.Context, opts CopyOptions, gopts GlobalOptions, args []
 		}
 		Verbosef("\nsnapshot %s of %v at %s)\n", sn.ID().Str(), sn.Paths, sn.Time)
 		Verbosef("  copy started, this may take a while...\n")
-		if err := copyTree(ctx, srcRepo, dstRepo, visitedTrees, *sn.Tree, gopts.Quiet); err != nil {
+		if err := copyTree(ctx, gopts, srcRepo, dstRepo, visitedTrees, *sn.Tree, trees); err != nil {
 			return err
 		}
 		debug.Log("tree copied")
@@ -153,12 +195,18 @@ func runCopy(ctx context.Context, opts CopyOptions, gopts GlobalOptions, args []
 		if sn.Original == nil {
 			sn.Original = sn.ID()
 		}
+		// the key IDs of the source repository are meaningless in the
+		// destination repository
+		keyID := dstRepo.KeyID()
+		sn.KeyID = &keyID
 		newID, err := restic.SaveSnapshot(ctx, dstRepo, sn)
 		if err != nil {
 			return err
 		}
 		Verbosef("snapshot %s saved\n", newID.Str())
 	}
+
+	Verbosef("\nduplicates: %s\n", ui.FormatDuplicateStats(duplicateStats(dstRepo)))
 	return nil
 }
 
@@ -181,12 +229,19 @@ func similarSnapshots(sna *restic.Snapshot, snb *restic.Snapshot) bool {
 	return true
 }
 
-func copyTree(ctx context.Context, srcRepo restic.Repository, dstRepo restic.Repository,
-	visitedTrees restic.IDSet, rootTreeID restic.ID, quiet bool) error {
+// copyTree copies the tree rootTreeID and all blobs referenced by it to
+// dstRepo. If trees is not nil, trees missing in srcRepo are taken from it.
+func copyTree(ctx context.Context, gopts GlobalOptions, srcRepo restic.Repository, dstRepo restic.Repository,
+	visitedTrees restic.IDSet, rootTreeID restic.ID, trees *filteredTrees) error {
 
 	wg, wgCtx := errgroup.WithContext(ctx)
 
-	treeStream := restic.StreamTrees(wgCtx, wg, srcRepo, restic.IDs{rootTreeID}, func(treeID restic.ID) bool {
+	var loader restic.Loader = srcRepo
+	if trees != nil {
+		loader = trees
+	}
+
+	treeStream := restic.StreamTrees(wgCtx, wg, loader, restic.IDs{rootTreeID}, func(treeID restic.ID) bool {
 		visited := visitedTrees.Has(treeID)
 		visitedTrees.Insert(treeID)
 		return visited
@@ -194,13 +249,21 @@ func copyTree(ctx context.Context, srcRepo restic.Repository, dstRepo restic.Rep
 
 	copyBlobs := restic.NewBlobSet()
 	packList := restic.NewIDSet()
+	var copySize uint64
+	var newTrees restic.IDs
 
 	enqueue := func(h restic.BlobHandle) {
+		if copyBlobs.Has(h) {
+			return
+		}
 		pb := srcRepo.Index().Lookup(h)
 		copyBlobs.Insert(h)
 		for _, p := range pb {
 			packList.Insert(p.PackID)
 		}
+		if len(pb) > 0 {
+			copySize += uint64(pb[0].DataLength())
+		}
 	}
 
 	wg.Go(func() error {
@@ -212,8 +275,12 @@ func copyTree(ctx context.Context, srcRepo restic.Repository, dstRepo restic.Rep
 			// Do we already have this tree blob?
 			treeHandle := restic.BlobHandle{ID: tree.ID, Type: restic.TreeBlob}
 			if !dstRepo.Index().Has(treeHandle) {
-				// copy raw tree bytes to avoid problems if the serialization changes
-				enqueue(treeHandle)
+				if trees.has(tree.ID) {
+					newTrees = append(newTrees, tree.ID)
+				} else {
+					// copy raw tree bytes to avoid problems if the serialization changes
+					enqueue(treeHandle)
+				}
 			}
 
 			for _, entry := range tree.Nodes {
@@ -234,11 +301,239 @@ func copyTree(ctx context.Context, srcRepo restic.Repository, dstRepo restic.Rep
 		return err
 	}
 
-	bar := newProgressMax(!quiet, uint64(len(packList)), "packs copied")
-	_, err = repository.Repack(ctx, srcRepo, dstRepo, packList, copyBlobs, bar)
+	bar := newPhaseProgress(gopts, "copy", uint64(len(packList)), copySize, "packs copied")
+	_, err = repository.Repack(ctx, srcRepo, dstRepo, packList, copyBlobs, false, bar)
 	bar.Done()
 	if err != nil {
 		return errors.Fatal(err.Error())
 	}
+
+	if len(newTrees) == 0 {
+		return nil
+	}
+
+	// save the trees created by filtering the snapshot
+	wg, wgCtx = errgroup.WithContext(ctx)
+	dstRepo.StartPackUploader(wgCtx, wg)
+	wg.Go(func() error {
+		for _, id := range newTrees {
+			_, _, _, err := dstRepo.SaveBlob(wgCtx, restic.TreeBlob, trees.trees[id], id, false)
+			if err != nil {
+				return err
+			}
+		}
+		return dstRepo.Flush(wgCtx)
+	})
+	err = wg.Wait()
+	if err != nil {
+		return errors.Fatal(err.Error())
+	}
 	return nil
 }
+
+// filteredTrees keeps the trees created while filtering a snapshot in memory,
+// unless they already exist in the source repository. Loading blobs falls
+// back to the source repository.
+type filteredTrees struct {
+	restic.Repository
+	trees map[restic.ID][]byte
+}
+
+func newFilteredTrees(repo restic.Repository) *filteredTrees {
+	return &filteredTrees{
+		Repository: repo,
+		trees:      make(map[restic.ID][]byte),
+	}
+}
+
+func (r *filteredTrees) has(id restic.ID) bool {
+	if r == nil {
+		return false
+	}
+	_, ok := r.trees[id]
+	return ok
+}
+
+func (r *filteredTrees) SaveBlob(_ context.Context, t restic.BlobType, buf []byte, id restic.ID, _ bool) (restic.ID, bool, int, error) {
+	if t != restic.TreeBlob {
+		return restic.ID{}, false, 0, errors.New("can only save trees")
+	}
+
+	if id.IsNull() {
+		id = restic.Hash(buf)
+	}
+	if r.has(id) || r.Repository.Index().Has(restic.BlobHandle{ID: id, Type: t}) {
+		return id, true, 0, nil
+	}
+
+	r.trees[id] = append([]byte(nil), buf...)
+	return id, false, len(buf), nil
+}
+
+func (r *filteredTrees) LoadBlob(ctx context.Context, t restic.BlobType, id restic.ID, buf []byte) ([]byte, error) {
+	if tree, ok := r.trees[id]; ok && t == restic.TreeBlob {
+		return append(buf[:0], tree...), nil
+	}
+	return r.Repository.LoadBlob(ctx, t, id, buf)
+}
+
+// copyFilter selects the files and directories to copy.
+type copyFilter struct {
+	rejects            []RejectByNameFunc
+	include            []filter.Pattern
+	insensitiveInclude []filter.Pattern
+}
+
+// newCopyFilter returns a filter for the include and exclude patterns in
+// opts, or nil if no pattern is set.
+func newCopyFilter(opts CopyOptions) (*copyFilter, error) {
+	if opts.excludePatternOptions.Empty() && len(opts.Include) == 0 && len(opts.InsensitiveInclude) == 0 {
+		return nil, nil
+	}
+
+	if err := filter.ValidatePatterns(opts.Include); err != nil {
+		return nil, invalidArgumentsf("--include: %s", err)
+	}
+	if err := filter.ValidatePatterns(opts.InsensitiveInclude); err != nil {
+		return nil, invalidArgumentsf("--iinclude: %s", err)
+	}
+
+	rejects, err := opts.excludePatternOptions.CollectPatterns()
+	if err != nil {
+		return nil, err
+	}
+
+	return &copyFilter{
+		rejects:            rejects,
+		include:            filter.ParsePatterns(opts.Include),
+		insensitiveInclude: filter.ParseInsensitivePatterns(opts.InsensitiveInclude),
+	}, nil
+}
+
+// matchInclude returns whether nodepath matches the include patterns and
+// whether a child of nodepath may match. Without include patterns, all paths
+// match.
+func (f *copyFilter) matchInclude(nodepath string) (matched bool, childMayMatch bool) {
+	if len(f.include) == 0 && len(f.insensitiveInclude) == 0 {
+		return true, true
+	}
+
+	// the patterns were already validated
+	matched, childMayMatch, _ = filter.ListWithChild(f.include, nodepath)
+	matchedInsensitive, childMayMatchInsensitive, _ := filter.ListWithChild(f.insensitiveInclude, nodepath)
+	return matched || matchedInsensitive, childMayMatch || childMayMatchInsensitive
+}
+
+func (f *copyFilter) selectNode(node *restic.Node, nodepath string) *restic.Node {
+	for _, reject := range f.rejects {
+		if rejected, _ := reject(nodepath); rejected {
+			return nil
+		}
+	}
+
+	matched, childMayMatch := f.matchInclude(nodepath)
+	if matched || (childMayMatch && node.Type == "dir") {
+		return node
+	}
+	return nil
+}
+
+// filterSnapshot returns a copy of sn which only contains the selected files.
+// The new trees are stored in trees. If no file is selected, nil is returned.
+func (f *copyFilter) filterSnapshot(ctx context.Context, trees *filteredTrees, sn *restic.Snapshot) (*restic.Snapshot, error) {
+	if sn.Tree == nil {
+		return nil, errors.Errorf("snapshot %v has nil tree", sn.ID().Str())
+	}
+
+	rewriter := walker.NewTreeRewriter(walker.RewriteOpts{
+		RewriteNode: f.selectNode,
+		// directories which were only kept because a child might match are
+		// removed if nothing in them matched
+		KeepEmptyTree: func(node *restic.Node, nodepath string) bool {
+			matched, _ := f.matchInclude(nodepath)
+			return matched
+		},
+		// the filter depends on the path of a tree
+		DisableNodeCache: true,
+	})
+
+	filteredTree, err := rewriter.RewriteTree(ctx, trees, "/", *sn.Tree)
+	if err != nil {
+		return nil, err
+	}
+	if walker.IsEmptyTree(filteredTree) {
+		return nil, nil
+	}
+
+	paths, err := filteredSnapshotPaths(ctx, trees, filteredTree, sn.Paths, len(f.include)+len(f.insensitiveInclude) > 0)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := *sn
+	filtered.Tree = &filteredTree
+	filtered.Paths = paths
+	// the filtered snapshot is derived from the source snapshot
+	filtered.Original = sn.ID()
+	return &filtered, nil
+}
+
+// filteredSnapshotPaths returns the paths of a filtered snapshot. Paths
+// without remaining content are removed. If descend is set, directories which
+// only contain a single directory are replaced by that directory, such that the
+// paths point to the included content. If none of the paths can be found in the
+// tree, paths is returned unchanged.
+func filteredSnapshotPaths(ctx context.Context, repo restic.BlobLoader, root restic.ID, paths []string, descend bool) ([]string, error) {
+	var result []string
+	for _, p := range paths {
+		newPath, found, err := findFilteredPath(ctx, repo, root, p, descend)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			result = append(result, newPath)
+		}
+	}
+
+	if len(result) == 0 {
+		return paths, nil
+	}
+	return result, nil
+}
+
+func findFilteredPath(ctx context.Context, repo restic.BlobLoader, root restic.ID, p string, descend bool) (string, bool, error) {
+	treeID := root
+	names := strings.Split(strings.Trim(filepath.ToSlash(p), "/"), "/")
+	for i, name := range names {
+		if name == "" {
+			continue
+		}
+
+		tree, err := restic.LoadTree(ctx, repo, treeID)
+		if err != nil {
+			return "", false, err
+		}
+		node := tree.Find(name)
+		if node == nil {
+			return "", false, nil
+		}
+		if node.Type != "dir" || node.Subtree == nil {
+			// only the last element of the path can be a file
+			return p, i == len(names)-1, nil
+		}
+		treeID = *node.Subtree
+	}
+
+	for descend {
+		tree, err := restic.LoadTree(ctx, repo, treeID)
+		if err != nil {
+			return "", false, err
+		}
+		if len(tree.Nodes) != 1 || tree.Nodes[0].Type != "dir" || tree.Nodes[0].Subtree == nil {
+			return p, true, nil
+		}
+		p = path.Join(filepath.ToSlash(p), tree.Nodes[0].Name)
+		treeID = *tree.Nodes[0].Subtree
+	}
+	return p, true, nil
+}
@@ -6,18 +6,21 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
 )
 
 func testRunCopy(t testing.TB, srcGopts GlobalOptions, dstGopts GlobalOptions) {
+	testRunCopyWithOptions(t, srcGopts, dstGopts, CopyOptions{})
+}
+
+func testRunCopyWithOptions(t testing.TB, srcGopts GlobalOptions, dstGopts GlobalOptions, copyOpts CopyOptions) {
 	gopts := srcGopts
 	gopts.Repo = dstGopts.Repo
 	gopts.password = dstGopts.password
-	copyOpts := CopyOptions{
-		secondaryRepoOptions: secondaryRepoOptions{
-			Repo:     srcGopts.Repo,
-			password: srcGopts.password,
-		},
+	copyOpts.secondaryRepoOptions = secondaryRepoOptions{
+		Repo:     srcGopts.Repo,
+		password: srcGopts.password,
 	}
 
 	rtest.OK(t, runCopy(context.TODO(), copyOpts, gopts, nil))
@@ -134,3 +137,140 @@ func TestCopyUnstableJSON(t *testing.T) {
 	testRunCheck(t, env2.gopts)
 	testListSnapshots(t, env2.gopts, 1)
 }
+
+func TestCopyProgressJSON(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	env2, cleanup2 := withTestEnvironment(t)
+	defer cleanup2()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, BackupOptions{}, env.gopts)
+	testRunInit(t, env2.gopts)
+
+	buf, err := withCaptureStdout(func() error {
+		gopts := env.gopts
+		gopts.JSON = true
+		gopts.Quiet = false
+		testRunCopy(t, gopts, env2.gopts)
+		return nil
+	})
+	rtest.OK(t, err)
+
+	checkPhaseProgress(t, buf.Bytes(), "copy", true)
+}
+
+// testSubtreeBlobs returns all blobs referenced by the directory dir of the
+// snapshot.
+func testSubtreeBlobs(t testing.TB, repo restic.Repository, sn *restic.Snapshot, dir string) restic.BlobSet {
+	treeID, err := restic.FindTreeDirectory(context.TODO(), repo, sn.Tree, dir)
+	rtest.OK(t, err)
+	blobs := restic.NewBlobSet()
+	rtest.OK(t, restic.FindUsedBlobs(context.TODO(), repo, restic.IDs{*treeID}, blobs, nil))
+	return blobs
+}
+
+func TestCopyFiltered(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	env2, cleanup2 := withTestEnvironment(t)
+	defer cleanup2()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0")}, BackupOptions{}, env.gopts)
+	snapshotID := testListSnapshots(t, env.gopts, 1)[0]
+	testRunInit(t, env2.gopts)
+
+	// nothing matches, no snapshot must be created
+	testRunCopyWithOptions(t, env.gopts, env2.gopts, CopyOptions{Include: []string{filepath.Join(env.testdata, "nonexistent")}})
+	testListSnapshots(t, env2.gopts, 0)
+
+	included := filepath.Join(env.testdata, "0", "0", "9")
+	copyOpts := CopyOptions{Include: []string{included}}
+	testRunCopyWithOptions(t, env.gopts, env2.gopts, copyOpts)
+	testRunCheck(t, env2.gopts)
+	copiedID := testListSnapshots(t, env2.gopts, 1)[0]
+
+	// copying again must not create a second snapshot
+	testRunCopyWithOptions(t, env.gopts, env2.gopts, copyOpts)
+	testListSnapshots(t, env2.gopts, 1)
+
+	srcRepo, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+	rtest.OK(t, srcRepo.LoadIndex(context.TODO()))
+	dstRepo, err := OpenRepository(context.TODO(), env2.gopts)
+	rtest.OK(t, err)
+	rtest.OK(t, dstRepo.LoadIndex(context.TODO()))
+
+	sn, err := restic.LoadSnapshot(context.TODO(), srcRepo, snapshotID)
+	rtest.OK(t, err)
+	copied, err := restic.LoadSnapshot(context.TODO(), dstRepo, copiedID)
+	rtest.OK(t, err)
+	rtest.Equals(t, []string{included}, copied.Paths)
+	rtest.Assert(t, copied.Original != nil && copied.Original.Equal(snapshotID),
+		"copied snapshot does not reference source snapshot %v as original", snapshotID.Str())
+
+	// the destination must contain all blobs of the included directory, but no
+	// blob which is only used by excluded files
+	srcDir := filepath.ToSlash(filepath.Join(env.testdata, "0"))
+	includedBlobs := testSubtreeBlobs(t, srcRepo, sn, srcDir+"/0/9")
+	excludedBlobs := testSubtreeBlobs(t, srcRepo, sn, srcDir+"/tests")
+	rtest.Assert(t, len(excludedBlobs) > 0, "test data contains no excluded blobs")
+	for h := range includedBlobs {
+		rtest.Assert(t, dstRepo.Index().Has(h), "blob %v of included directory is missing", h)
+	}
+	for h := range excludedBlobs {
+		if includedBlobs.Has(h) {
+			continue
+		}
+		rtest.Assert(t, !dstRepo.Index().Has(h), "blob %v of excluded directory was copied", h)
+	}
+
+	// the restored content must match the included directory
+	restoredir := filepath.Join(env.base, "restore")
+	testRunRestoreIncludes(t, env.gopts, restoredir, snapshotID, []string{included})
+	restoredir2 := filepath.Join(env2.base, "restore")
+	testRunRestore(t, env2.gopts, restoredir2, copiedID)
+	diff := directoriesContentsDiff(restoredir, restoredir2)
+	rtest.Assert(t, diff == "", "copied snapshot differs from included files:\n%v", diff)
+}
+
+func TestCopyExclude(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	env2, cleanup2 := withTestEnvironment(t)
+	defer cleanup2()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0")}, BackupOptions{}, env.gopts)
+	snapshotID := testListSnapshots(t, env.gopts, 1)[0]
+	testRunInit(t, env2.gopts)
+
+	copyOpts := CopyOptions{}
+	copyOpts.Excludes = []string{filepath.Join(env.testdata, "0", "tests")}
+	testRunCopyWithOptions(t, env.gopts, env2.gopts, copyOpts)
+	testRunCheck(t, env2.gopts)
+	copiedID := testListSnapshots(t, env2.gopts, 1)[0]
+
+	srcRepo, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+	rtest.OK(t, srcRepo.LoadIndex(context.TODO()))
+	dstRepo, err := OpenRepository(context.TODO(), env2.gopts)
+	rtest.OK(t, err)
+	rtest.OK(t, dstRepo.LoadIndex(context.TODO()))
+
+	sn, err := restic.LoadSnapshot(context.TODO(), srcRepo, snapshotID)
+	rtest.OK(t, err)
+	copied, err := restic.LoadSnapshot(context.TODO(), dstRepo, copiedID)
+	rtest.OK(t, err)
+	rtest.Equals(t, sn.Paths, copied.Paths)
+
+	srcDir := filepath.ToSlash(filepath.Join(env.testdata, "0"))
+	includedBlobs := testSubtreeBlobs(t, srcRepo, sn, srcDir+"/0")
+	for h := range testSubtreeBlobs(t, srcRepo, sn, srcDir+"/tests") {
+		if includedBlobs.Has(h) {
+			continue
+		}
+		rtest.Assert(t, !dstRepo.Index().Has(h), "blob %v of excluded directory was copied", h)
+	}
+}
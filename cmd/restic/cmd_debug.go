@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"runtime"
 	"sort"
 	"sync"
@@ -20,7 +21,6 @@ import (
 	"github.com/spf13/cobra"
 	"golang.org/x/sync/errgroup"
 
-	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/crypto"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/index"
@@ -55,14 +55,22 @@ Exit status is 0 if the command was successful, and non-zero if there was any er
 var tryRepair bool
 var repairByte bool
 var extractPack bool
+var extractBlobsDir string
 var reuploadBlobs bool
 
 func init() {
 	cmdRoot.AddCommand(cmdDebug)
+	enableFeature("debug")
 	cmdDebug.AddCommand(cmdDebugDump)
 	cmdDebug.AddCommand(cmdDebugExamine)
 	cmdDebugExamine.Flags().BoolVar(&extractPack, "extract-pack", false, "write blobs to the current directory")
-	cmdDebugExamine.Flags().BoolVar(&reuploadBlobs, "reupload-blobs", false, "reupload blobs to the repository")
+	err := cmdDebugExamine.Flags().MarkDeprecated("extract-pack", "use --extract-blobs .")
+	if err != nil {
+		// MarkDeprecated only returns an error when the flag is not found
+		panic(err)
+	}
+	cmdDebugExamine.Flags().StringVar(&extractBlobsDir, "extract-blobs", "", "write the decrypted blobs to files in `dir`")
+	cmdDebugExamine.Flags().BoolVar(&reuploadBlobs, "reupload-blobs", false, "save the recoverable blobs to new pack files and add them to the index")
 	cmdDebugExamine.Flags().BoolVar(&tryRepair, "try-repair", false, "try to repair broken blobs with single bit flips")
 	cmdDebugExamine.Flags().BoolVar(&repairByte, "repair-byte", false, "try to repair broken blobs by trying bytes")
 }
@@ -146,7 +154,7 @@ func dumpIndexes(ctx context.Context, repo restic.Repository, wr io.Writer) erro
 
 func runDebugDump(ctx context.Context, gopts GlobalOptions, args []string) error {
 	if len(args) != 1 {
-		return errors.Fatal("type not specified")
+		return invalidArguments(errors.Fatal("type not specified"))
 	}
 
 	repo, err := OpenRepository(ctx, gopts)
@@ -192,8 +200,34 @@ func runDebugDump(ctx context.Context, gopts GlobalOptions, args []string) error
 }
 
 var cmdDebugExamine = &cobra.Command{
-	Use:               "examine pack-ID...",
-	Short:             "Examine a pack file",
+	Use:   "examine pack-ID...",
+	Short: "Examine a pack file",
+	Long: `
+The "examine" command downloads the given pack files and checks them. It reports
+whether the hash of the file content matches the pack ID, compares the blobs
+listed in the index with the pack header and tries to decrypt and verify each
+blob. A damaged pack header is reported, the blobs listed in the index are
+checked nonetheless.
+
+Blobs which cannot be decrypted can be repaired with "--try-repair", which
+tries to find single bit flips, or "--repair-byte", which tries to find a
+single broken byte. Both are very slow for large blobs.
+
+The blobs can be written to files in a directory with "--extract-blobs". The
+file name contains the blob ID and is prefixed with "correct-" for blobs whose
+hash matches, "repaired-" for repaired blobs, "wrong-hash-" for blobs with a
+mismatching hash and "damaged-" for undecryptable data.
+
+With "--reupload-blobs", all blobs which could be recovered are saved to new
+pack files and added to the index. Afterwards, the damaged pack file can be
+deleted from the repository, "repair index" then removes it from the index
+without losing these blobs.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful, and non-zero if there was any error.
+`,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return runDebugExamine(cmd.Context(), globalOptions, args)
@@ -244,13 +278,13 @@ func tryRepairWithBitflip(ctx context.Context, key *crypto.Key, input []byte, by
 
 			for i := range ch {
 				if bytewise {
-					for j := 0; j < 255; j++ {
+					for j := 1; j < 256; j++ {
 						if testFlip(i, byte(j)) {
 							return nil
 						}
 					}
 				} else {
-					for j := 0; j < 7; j++ {
+					for j := 0; j < 8; j++ {
 						// flip each bit once
 						if testFlip(i, (1 << uint(j))) {
 							return nil
@@ -333,6 +367,7 @@ func loadBlobs(ctx context.Context, repo restic.Repository, packID restic.ID, li
 	}
 
 	wg.Go(func() error {
+		var correct, repaired, wrongHash, damaged int
 		for _, blob := range list {
 			Printf("      loading blob %v at %v (length %v)\n", blob.ID, blob.Offset, blob.Length)
 			buf := make([]byte, blob.Length)
@@ -345,6 +380,7 @@ func loadBlobs(ctx context.Context, repo restic.Repository, packID restic.ID, li
 			})
 			if err != nil {
 				Warnf("error read: %v\n", err)
+				damaged++
 				continue
 			}
 
@@ -363,10 +399,14 @@ func loadBlobs(ctx context.Context, repo restic.Repository, packID restic.ID, li
 					outputPrefix = "repaired "
 					filePrefix = "repaired-"
 				} else {
-					plaintext = decryptUnsigned(ctx, key, buf)
-					err = storePlainBlob(blob.ID, "damaged-", plaintext)
-					if err != nil {
-						return err
+					Printf("         verdict: damaged, blob cannot be decrypted\n")
+					damaged++
+					if extractBlobsDir != "" {
+						plaintext = decryptUnsigned(ctx, key, buf)
+						err = storePlainBlob(blob.ID, "damaged-", plaintext)
+						if err != nil {
+							return err
+						}
 					}
 					continue
 				}
@@ -386,18 +426,28 @@ func loadBlobs(ctx context.Context, repo restic.Repository, packID restic.ID, li
 			var prefix string
 			if !id.Equal(blob.ID) {
 				Printf("         successfully %vdecrypted blob (length %v), hash is %v, ID does not match, wanted %v\n", outputPrefix, len(plaintext), id, blob.ID)
+				Printf("         verdict: damaged, wrong hash\n")
 				prefix = "wrong-hash-"
+				wrongHash++
 			} else {
 				Printf("         successfully %vdecrypted blob (length %v), hash is %v, ID matches\n", outputPrefix, len(plaintext), id)
 				prefix = "correct-"
+				if outputPrefix != "" {
+					Printf("         verdict: repaired\n")
+					repaired++
+				} else {
+					Printf("         verdict: ok\n")
+					correct++
+				}
 			}
-			if extractPack {
+			if extractBlobsDir != "" {
 				err = storePlainBlob(id, filePrefix+prefix, plaintext)
 				if err != nil {
 					return err
 				}
 			}
-			if reuploadBlobs {
+			// blobs with a wrong hash would only be stored under a different ID
+			if reuploadBlobs && id.Equal(blob.ID) {
 				_, _, _, err := repo.SaveBlob(ctx, blob.Type, plaintext, id, true)
 				if err != nil {
 					return err
@@ -406,6 +456,9 @@ func loadBlobs(ctx context.Context, repo restic.Repository, packID restic.ID, li
 			}
 		}
 
+		Printf("      %d blobs: %d ok, %d repaired, %d with wrong hash, %d damaged\n",
+			len(list), correct, repaired, wrongHash, damaged)
+
 		if reuploadBlobs {
 			return repo.Flush(ctx)
 		}
@@ -416,7 +469,7 @@ func loadBlobs(ctx context.Context, repo restic.Repository, packID restic.ID, li
 }
 
 func storePlainBlob(id restic.ID, prefix string, plain []byte) error {
-	filename := fmt.Sprintf("%s%s.bin", prefix, id)
+	filename := filepath.Join(extractBlobsDir, fmt.Sprintf("%s%s.bin", prefix, id))
 	f, err := os.Create(filename)
 	if err != nil {
 		return err
@@ -438,6 +491,20 @@ func storePlainBlob(id restic.ID, prefix string, plain []byte) error {
 }
 
 func runDebugExamine(ctx context.Context, gopts GlobalOptions, args []string) error {
+	if reuploadBlobs {
+		if err := checkReadOnly(gopts, "debug examine --reupload-blobs"); err != nil {
+			return err
+		}
+	}
+	if extractPack && extractBlobsDir == "" {
+		extractBlobsDir = "."
+	}
+	if extractBlobsDir != "" {
+		if err := os.MkdirAll(extractBlobsDir, 0700); err != nil {
+			return err
+		}
+	}
+
 	repo, err := OpenRepository(ctx, gopts)
 	if err != nil {
 		return err
@@ -499,7 +566,12 @@ func examinePack(ctx context.Context, repo restic.Repository, id restic.ID) erro
 	}
 	Printf("  file size is %v\n", fi.Size)
 
-	buf, err := backend.LoadAll(ctx, nil, repo.Backend(), h)
+	// load the raw content, backend.LoadAll rejects files with a wrong hash
+	var buf []byte
+	err = repo.Backend().Load(ctx, h, 0, 0, func(rd io.Reader) error {
+		buf, err = io.ReadAll(rd)
+		return err
+	})
 	if err != nil {
 		return err
 	}
@@ -535,7 +607,11 @@ func examinePack(ctx context.Context, repo restic.Repository, id restic.ID) erro
 	Printf("  inspect the pack itself\n")
 
 	blobs, _, err := repo.ListPack(ctx, id, fi.Size)
-	if err != nil {
+	if errors.Is(err, pack.ErrInvalidHeader) && blobsLoaded {
+		// the blobs listed in the index have already been checked
+		Printf("      pack header is damaged: %v\n", err)
+		return nil
+	} else if err != nil {
 		return fmt.Errorf("pack %v: %v", id.Str(), err)
 	}
 	checkPackSize(blobs, fi.Size)
@@ -0,0 +1,133 @@
+//go:build debug
+// +build debug
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func testRunDebugExamine(t testing.TB, gopts GlobalOptions, id restic.ID) string {
+	buf, err := withCaptureStdout(func() error {
+		return runDebugExamine(context.TODO(), gopts, []string{id.String()})
+	})
+	rtest.OK(t, err)
+	return buf.String()
+}
+
+// setupDebugExamine creates a snapshot of a few small files and returns the
+// ID and path of the pack file which contains their data.
+func setupDebugExamine(t testing.TB, env *testEnvironment) (restic.ID, []restic.Blob, string) {
+	testRunInit(t, env.gopts)
+	for i, data := range []string{"foo", "bar", "baz"} {
+		rtest.OK(t, os.WriteFile(filepath.Join(env.testdata, data), []byte(strings.Repeat(data, 100*(i+1))), 0600))
+	}
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+
+	repo, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+	rtest.OK(t, repo.LoadIndex(context.TODO()))
+
+	var packID restic.ID
+	repo.Index().Each(context.TODO(), func(pb restic.PackedBlob) {
+		if pb.Type == restic.DataBlob {
+			packID = pb.PackID
+		}
+	})
+	var blobs []restic.Blob
+	for pbs := range repo.Index().ListPacks(context.TODO(), restic.NewIDSet(packID)) {
+		blobs = pbs.Blobs
+	}
+	rtest.Equals(t, 3, len(blobs))
+
+	filename := filepath.Join(env.repo, "data", packID.String()[:2], packID.String())
+	return packID, blobs, filename
+}
+
+func corruptFile(t testing.TB, filename string, offset int64) {
+	data, err := os.ReadFile(filename)
+	rtest.OK(t, err)
+	if offset < 0 {
+		offset += int64(len(data))
+	}
+	data[offset] ^= 0x01
+
+	rtest.OK(t, os.Chmod(filename, 0600))
+	rtest.OK(t, os.WriteFile(filename, data, 0600))
+}
+
+func withDebugExamineOptions(t testing.TB) {
+	t.Cleanup(func() {
+		tryRepair = false
+		repairByte = false
+		extractPack = false
+		extractBlobsDir = ""
+		reuploadBlobs = false
+	})
+}
+
+func TestDebugExamineDamagedHeader(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	withDebugExamineOptions(t)
+
+	packID, _, filename := setupDebugExamine(t, env)
+	corruptFile(t, filename, -10)
+
+	out := testRunDebugExamine(t, env.gopts, packID)
+	for _, s := range []string{"wanted hash", "pack header is damaged", "3 blobs: 3 ok"} {
+		rtest.Assert(t, strings.Contains(out, s), "missing %q in output:\n%v", s, out)
+	}
+}
+
+func TestDebugExamineDamagedBlob(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	withDebugExamineOptions(t)
+
+	packID, blobs, filename := setupDebugExamine(t, env)
+	corruptFile(t, filename, int64(blobs[0].Offset)+20)
+
+	extractBlobsDir = filepath.Join(env.base, "extract")
+	out := testRunDebugExamine(t, env.gopts, packID)
+	rtest.Assert(t, strings.Contains(out, "3 blobs: 2 ok, 0 repaired, 0 with wrong hash, 1 damaged"),
+		"unexpected output:\n%v", out)
+
+	for i, blob := range blobs {
+		prefix := "correct-"
+		if i == 0 {
+			prefix = "damaged-"
+		}
+		_, err := os.Stat(filepath.Join(extractBlobsDir, prefix+blob.ID.String()+".bin"))
+		rtest.OK(t, err)
+	}
+}
+
+func TestDebugExamineRepairBlob(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	withDebugExamineOptions(t)
+
+	packID, blobs, filename := setupDebugExamine(t, env)
+	// damage the MAC at the end of the last blob
+	last := blobs[len(blobs)-1]
+	corruptFile(t, filename, int64(last.Offset+last.Length)-1)
+
+	tryRepair = true
+	reuploadBlobs = true
+	out := testRunDebugExamine(t, env.gopts, packID)
+	rtest.Assert(t, strings.Contains(out, "verdict: repaired") && strings.Contains(out, "uploaded data "+last.ID.String()),
+		"unexpected output:\n%v", out)
+
+	// the damaged pack can be removed without losing data
+	rtest.OK(t, os.Remove(filename))
+	testRunRebuildIndex(t, env.gopts)
+	testRunCheck(t, env.gopts)
+}
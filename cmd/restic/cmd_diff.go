@@ -5,13 +5,13 @@ import (
 	"encoding/json"
 	"path"
 	"reflect"
-	"sort"
 
 	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/walker"
 	"github.com/spf13/cobra"
 )
 
@@ -207,46 +207,10 @@ func (c *Comparer) collectDir(ctx context.Context, blobs restic.BlobSet, id rest
 	return nil
 }
 
-func uniqueNodeNames(tree1, tree2 *restic.Tree) (tree1Nodes, tree2Nodes map[string]*restic.Node, uniqueNames []string) {
-	names := make(map[string]struct{})
-	tree1Nodes = make(map[string]*restic.Node)
-	for _, node := range tree1.Nodes {
-		tree1Nodes[node.Name] = node
-		names[node.Name] = struct{}{}
-	}
-
-	tree2Nodes = make(map[string]*restic.Node)
-	for _, node := range tree2.Nodes {
-		tree2Nodes[node.Name] = node
-		names[node.Name] = struct{}{}
-	}
-
-	uniqueNames = make([]string, 0, len(names))
-	for name := range names {
-		uniqueNames = append(uniqueNames, name)
-	}
-
-	sort.Strings(uniqueNames)
-	return tree1Nodes, tree2Nodes, uniqueNames
-}
-
 func (c *Comparer) diffTree(ctx context.Context, stats *DiffStatsContainer, prefix string, id1, id2 restic.ID) error {
 	debug.Log("diffing %v to %v", id1, id2)
-	tree1, err := restic.LoadTree(ctx, c.repo, id1)
-	if err != nil {
-		return err
-	}
-
-	tree2, err := restic.LoadTree(ctx, c.repo, id2)
-	if err != nil {
-		return err
-	}
-
-	tree1Nodes, tree2Nodes, names := uniqueNodeNames(tree1, tree2)
-
-	for _, name := range names {
-		node1, t1 := tree1Nodes[name]
-		node2, t2 := tree2Nodes[name]
+	return walker.DiffTrees(ctx, c.repo, id1, id2, func(name string, node1, node2 *restic.Node) error {
+		t1, t2 := node1 != nil, node2 != nil
 
 		addBlobs(stats.BlobsBefore, node1)
 		addBlobs(stats.BlobsAfter, node2)
@@ -317,14 +281,13 @@ func (c *Comparer) diffTree(ctx context.Context, stats *DiffStatsContainer, pref
 				}
 			}
 		}
-	}
-
-	return nil
+		return nil
+	})
 }
 
 func runDiff(ctx context.Context, opts DiffOptions, gopts GlobalOptions, args []string) error {
 	if len(args) != 2 {
-		return errors.Fatalf("specify two snapshot IDs")
+		return invalidArgumentsf("specify two snapshot IDs")
 	}
 
 	repo, err := OpenRepository(ctx, gopts)
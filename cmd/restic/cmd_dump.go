@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"path/filepath"
@@ -11,6 +12,7 @@ import (
 	"github.com/restic/restic/internal/dump"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui/progress"
 
 	"github.com/spf13/cobra"
 )
@@ -24,8 +26,13 @@ single file is selected, it prints its contents to stdout. Folders are output
 as a tar (default) or zip file containing the contents of the specified folder.
 Pass "/" as file name to dump the whole snapshot as an archive file.
 
+Use "--target" to write the output to a file instead of stdout, which also
+displays the progress. If an archive is written and the target has no file
+extension, ".tar" or ".zip" is appended. An existing file is only overwritten
+with "--force".
+
 The special snapshot "latest" can be used to use the latest snapshot in the
-repository.
+repository, "latest~N" refers to the snapshot N snapshots before it.
 
 EXIT STATUS
 ===========
@@ -42,6 +49,8 @@ Exit status is 0 if the command was successful, and non-zero if there was any er
 type DumpOptions struct {
 	restic.SnapshotFilter
 	Archive string
+	Target  string
+	Force   bool
 }
 
 var dumpOptions DumpOptions
@@ -52,6 +61,8 @@ func init() {
 	flags := cmdDump.Flags()
 	initSingleSnapshotFilter(flags, &dumpOptions.SnapshotFilter)
 	flags.StringVarP(&dumpOptions.Archive, "archive", "a", "tar", "set archive `format` as \"tar\" or \"zip\"")
+	flags.StringVarP(&dumpOptions.Target, "target", "t", "", "write the output to target `path` instead of stdout, the archive extension is appended if missing")
+	flags.BoolVarP(&dumpOptions.Force, "force", "f", false, "overwrite an existing target file")
 }
 
 func splitPath(p string) []string {
@@ -63,14 +74,23 @@ func splitPath(p string) []string {
 	return append(s, f)
 }
 
-func printFromTree(ctx context.Context, tree *restic.Tree, repo restic.Repository, prefix string, pathComponents []string, d *dump.Dumper) error {
+// dumpItem is the part of a snapshot which is dumped. It is either a single
+// file or a tree which is dumped as an archive.
+type dumpItem struct {
+	node     *restic.Node
+	tree     *restic.Tree
+	rootPath string
+}
+
+func (item dumpItem) isArchive() bool {
+	return item.tree != nil
+}
+
+func findDumpItem(ctx context.Context, tree *restic.Tree, repo restic.Repository, prefix string, pathComponents []string) (dumpItem, error) {
 	// If we print / we need to assume that there are multiple nodes at that
 	// level in the tree.
 	if pathComponents[0] == "" {
-		if err := checkStdoutArchive(); err != nil {
-			return err
-		}
-		return d.DumpTree(ctx, tree, "/")
+		return dumpItem{tree: tree, rootPath: "/"}, nil
 	}
 
 	item := filepath.Join(prefix, pathComponents[0])
@@ -81,35 +101,134 @@ func printFromTree(ctx context.Context, tree *restic.Tree, repo restic.Repositor
 		if node.Name == pathComponents[0] {
 			switch {
 			case l == 1 && dump.IsFile(node):
-				return d.WriteNode(ctx, node)
+				return dumpItem{node: node}, nil
 			case l > 1 && dump.IsDir(node):
 				subtree, err := restic.LoadTree(ctx, repo, *node.Subtree)
 				if err != nil {
-					return errors.Wrapf(err, "cannot load subtree for %q", item)
+					return dumpItem{}, errors.Wrapf(err, "cannot load subtree for %q", item)
 				}
-				return printFromTree(ctx, subtree, repo, item, pathComponents[1:], d)
+				return findDumpItem(ctx, subtree, repo, item, pathComponents[1:])
 			case dump.IsDir(node):
-				if err := checkStdoutArchive(); err != nil {
-					return err
-				}
 				subtree, err := restic.LoadTree(ctx, repo, *node.Subtree)
 				if err != nil {
-					return err
+					return dumpItem{}, err
 				}
-				return d.DumpTree(ctx, subtree, item)
+				return dumpItem{tree: subtree, rootPath: item}, nil
 			case l > 1:
-				return fmt.Errorf("%q should be a dir, but is a %q", item, node.Type)
+				return dumpItem{}, fmt.Errorf("%q should be a dir, but is a %q", item, node.Type)
 			case !dump.IsFile(node):
-				return fmt.Errorf("%q should be a file, but is a %q", item, node.Type)
+				return dumpItem{}, fmt.Errorf("%q should be a file, but is a %q", item, node.Type)
+			}
+		}
+	}
+	return dumpItem{}, fmt.Errorf("path %q not found in snapshot", item)
+}
+
+// dumpSize returns the size of all files contained in tree and its subtrees.
+func dumpSize(ctx context.Context, repo restic.BlobLoader, tree *restic.Tree) (uint64, error) {
+	var size uint64
+	for _, node := range tree.Nodes {
+		switch {
+		case dump.IsFile(node):
+			size += node.Size
+		case dump.IsDir(node) && node.Subtree != nil:
+			subtree, err := restic.LoadTree(ctx, repo, *node.Subtree)
+			if err != nil {
+				return 0, err
 			}
+			subtreeSize, err := dumpSize(ctx, repo, subtree)
+			if err != nil {
+				return 0, err
+			}
+			size += subtreeSize
 		}
 	}
-	return fmt.Errorf("path %q not found in snapshot", item)
+	return size, nil
+}
+
+// dumpTargetName returns the name of the file the dump is written to. The
+// extension of the archive format is appended if the target has none.
+func dumpTargetName(target, format string, archive bool) string {
+	if archive && filepath.Ext(target) == "" {
+		return target + "." + format
+	}
+	return target
+}
+
+// openDumpTarget creates the file target. Existing files are only overwritten
+// if force is set.
+func openDumpTarget(target string, force bool) (*os.File, error) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(target, flags, 0600)
+	if errors.Is(err, os.ErrExist) {
+		return nil, errors.Fatalf("target %v already exists, use --force to overwrite it", target)
+	}
+	return f, err
+}
+
+// progressWriter reports the number of bytes written to the progress counter.
+type progressWriter struct {
+	w io.Writer
+	p *progress.Counter
+}
+
+func (w progressWriter) Write(buf []byte) (int, error) {
+	n, err := w.w.Write(buf)
+	w.p.AddBytes(uint64(n))
+	return n, err
+}
+
+// dumpToFile writes item to the file target and displays the progress.
+func dumpToFile(ctx context.Context, opts DumpOptions, gopts GlobalOptions, repo restic.Repository, item dumpItem) error {
+	target := dumpTargetName(opts.Target, opts.Archive, item.isArchive())
+
+	size := uint64(0)
+	if item.isArchive() {
+		var err error
+		size, err = dumpSize(ctx, repo, item.tree)
+		if err != nil {
+			return err
+		}
+	} else {
+		size = item.node.Size
+	}
+
+	f, err := openDumpTarget(target, opts.Force)
+	if err != nil {
+		return err
+	}
+
+	bar := newPhaseProgress(gopts, "dump", 1, size, "files")
+	d := dump.New(opts.Archive, repo, progressWriter{w: f, p: bar})
+	if item.isArchive() {
+		err = d.DumpTree(ctx, item.tree, item.rootPath)
+	} else {
+		err = d.WriteNode(ctx, item.node)
+	}
+	if err == nil {
+		bar.Add(1)
+	}
+	bar.Done()
+
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		// do not leave an incomplete dump behind
+		_ = os.Remove(target)
+		return err
+	}
+
+	Verbosef("dumped to %v\n", target)
+	return nil
 }
 
 func runDump(ctx context.Context, opts DumpOptions, gopts GlobalOptions, args []string) error {
 	if len(args) != 2 {
-		return errors.Fatal("no file and no snapshot ID specified")
+		return invalidArguments(errors.Fatal("no file and no snapshot ID specified"))
 	}
 
 	switch opts.Archive {
@@ -140,9 +259,10 @@ func runDump(ctx context.Context, opts DumpOptions, gopts GlobalOptions, args []
 	}
 
 	sn, subfolder, err := (&restic.SnapshotFilter{
-		Hosts: opts.Hosts,
-		Paths: opts.Paths,
-		Tags:  opts.Tags,
+		Hosts:       opts.Hosts,
+		Paths:       opts.Paths,
+		Tags:        opts.Tags,
+		LoadErrorFn: warnSnapshotLoadError,
 	}).FindLatest(ctx, repo.Backend(), repo, snapshotIDString)
 	if err != nil {
 		return errors.Fatalf("failed to find snapshot: %v", err)
@@ -163,8 +283,28 @@ func runDump(ctx context.Context, opts DumpOptions, gopts GlobalOptions, args []
 		return errors.Fatalf("loading tree for snapshot %q failed: %v", snapshotIDString, err)
 	}
 
+	item, err := findDumpItem(ctx, tree, repo, "/", splittedPath)
+	if err != nil {
+		return errors.Fatalf("cannot dump file: %v", err)
+	}
+
+	if opts.Target != "" && opts.Target != "-" {
+		err = dumpToFile(ctx, opts, gopts, repo, item)
+		if err != nil {
+			return errors.Fatalf("cannot dump file: %v", err)
+		}
+		return nil
+	}
+
 	d := dump.New(opts.Archive, repo, os.Stdout)
-	err = printFromTree(ctx, tree, repo, "/", splittedPath, d)
+	if item.isArchive() {
+		if err := checkStdoutArchive(); err != nil {
+			return errors.Fatalf("cannot dump file: %v", err)
+		}
+		err = d.DumpTree(ctx, item.tree, item.rootPath)
+	} else {
+		err = d.WriteNode(ctx, item.node)
+	}
 	if err != nil {
 		return errors.Fatalf("cannot dump file: %v", err)
 	}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func testRunDump(gopts GlobalOptions, opts DumpOptions, snapshotID, path string) error {
+	if opts.Archive == "" {
+		opts.Archive = "tar"
+	}
+	return runDump(context.TODO(), opts, gopts, []string{snapshotID, path})
+}
+
+func TestDumpTarget(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+	rtest.OK(t, os.MkdirAll(filepath.Join(env.testdata, "dir"), 0700))
+	files := map[string]string{
+		"file":     "content",
+		"dir/file": "other content",
+	}
+	for name, content := range files {
+		rtest.OK(t, os.WriteFile(filepath.Join(env.testdata, filepath.FromSlash(name)), []byte(content), 0600))
+	}
+	testRunBackup(t, env.testdata, []string{"."}, BackupOptions{}, env.gopts)
+
+	// dump a single file
+	target := filepath.Join(env.base, "file")
+	rtest.OK(t, testRunDump(env.gopts, DumpOptions{Target: target}, "latest", "/file"))
+	data, err := os.ReadFile(target)
+	rtest.OK(t, err)
+	rtest.Equals(t, "content", string(data))
+
+	// existing files are only overwritten with --force
+	rtest.OK(t, os.WriteFile(target, []byte("old"), 0600))
+	err = testRunDump(env.gopts, DumpOptions{Target: target}, "latest", "/file")
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "already exists"), "expected error for existing target, got %v", err)
+	data, err = os.ReadFile(target)
+	rtest.OK(t, err)
+	rtest.Equals(t, "old", string(data))
+
+	rtest.OK(t, testRunDump(env.gopts, DumpOptions{Target: target, Force: true}, "latest", "/file"))
+	data, err = os.ReadFile(target)
+	rtest.OK(t, err)
+	rtest.Equals(t, "content", string(data))
+
+	// the archive extension is added to the target
+	target = filepath.Join(env.base, "archive")
+	rtest.OK(t, testRunDump(env.gopts, DumpOptions{Target: target}, "latest", "/"))
+	_, err = os.Stat(target)
+	rtest.Assert(t, os.IsNotExist(err), "target without extension was created")
+
+	f, err := os.Open(target + ".tar")
+	rtest.OK(t, err)
+	defer func() {
+		rtest.OK(t, f.Close())
+	}()
+	found := make(map[string]string)
+	rd := tar.NewReader(f)
+	for {
+		hdr, err := rd.Next()
+		if err == io.EOF {
+			break
+		}
+		rtest.OK(t, err)
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(rd)
+		rtest.OK(t, err)
+		found[strings.TrimPrefix(hdr.Name, "/")] = string(data)
+	}
+	rtest.Equals(t, files, found)
+}
+
+func TestDumpSize(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+
+	var want uint64
+	rtest.OK(t, filepath.Walk(env.testdata, func(_ string, fi os.FileInfo, err error) error {
+		if err == nil && fi.Mode().IsRegular() {
+			want += uint64(fi.Size())
+		}
+		return err
+	}))
+
+	repo, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+	sn, _, err := (&restic.SnapshotFilter{}).FindLatest(context.TODO(), repo.Backend(), repo, "latest")
+	rtest.OK(t, err)
+	rtest.OK(t, repo.LoadIndex(context.TODO()))
+	tree, err := restic.LoadTree(context.TODO(), repo, *sn.Tree)
+	rtest.OK(t, err)
+
+	size, err := dumpSize(context.TODO(), repo, tree)
+	rtest.OK(t, err)
+	rtest.Equals(t, want, size)
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"bytes"
 	"testing"
+	"time"
 
 	rtest "github.com/restic/restic/internal/test"
+	"github.com/restic/restic/internal/ui/progress"
 )
 
 func TestDumpSplitPath(t *testing.T) {
@@ -25,3 +28,38 @@ func TestDumpSplitPath(t *testing.T) {
 		rtest.Equals(t, path.result, parts)
 	}
 }
+
+func TestDumpTargetName(t *testing.T) {
+	for _, test := range []struct {
+		target  string
+		format  string
+		archive bool
+		result  string
+	}{
+		{"out", "tar", true, "out.tar"},
+		{"out", "zip", true, "out.zip"},
+		{"out.tgz", "tar", true, "out.tgz"},
+		{"out", "tar", false, "out"},
+		{"dir.d/out", "zip", true, "dir.d/out.zip"},
+	} {
+		rtest.Equals(t, test.result, dumpTargetName(test.target, test.format, test.archive))
+	}
+}
+
+func TestDumpProgressWriter(t *testing.T) {
+	p := progress.NewCounter(time.Hour, 1, func(uint64, uint64, time.Duration, bool) {})
+	defer p.Done()
+	p.SetMaxBytes(11)
+
+	var buf bytes.Buffer
+	w := progressWriter{w: &buf, p: p}
+	for _, s := range []string{"hello", " ", "world"} {
+		_, err := w.Write([]byte(s))
+		rtest.OK(t, err)
+	}
+
+	rtest.Equals(t, "hello world", buf.String())
+	v, max := p.GetBytes()
+	rtest.Equals(t, uint64(11), v)
+	rtest.Equals(t, uint64(11), max)
+}
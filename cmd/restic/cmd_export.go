@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	"github.com/spf13/cobra"
+)
+
+var cmdExport = &cobra.Command{
+	Use:   "export [flags] snapshotID",
+	Short: "Export a snapshot into a single file",
+	Long: `
+The "export" command writes a snapshot together with all tree and data blobs
+it references into a single file. The file can be transferred to another
+machine, for example without network access, and loaded into a different
+repository using the "import" command.
+
+The file is encrypted using a separate password, which is read from the file
+specified using "--stream-password-file" or is prompted for. The same password
+must be used to import the file.
+
+To reduce the size of the file, "--have" can specify a file which lists the
+blobs which already exist in the destination repository. These blobs are not
+included in the export. The file uses the format of "restic list blobs", that
+is one line per blob consisting of the blob type and ID.
+
+The special snapshot "latest" can be used to export the latest snapshot in the
+repository, "latest~N" refers to the snapshot N snapshots before it.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful, and non-zero if there was any error.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runExport(cmd.Context(), exportOptions, globalOptions, args)
+	},
+}
+
+// ExportOptions collects all options for the export command.
+type ExportOptions struct {
+	restic.SnapshotFilter
+	ToFile             string
+	Have               string
+	StreamPasswordFile string
+}
+
+var exportOptions ExportOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdExport)
+
+	f := cmdExport.Flags()
+	initSingleSnapshotFilter(f, &exportOptions.SnapshotFilter)
+	f.StringVar(&exportOptions.ToFile, "to-file", "", "write the export to `file`")
+	f.StringVar(&exportOptions.Have, "have", "", "do not export the blobs listed in `file`")
+	f.StringVar(&exportOptions.StreamPasswordFile, "stream-password-file", "", "`file` to read the password for the export file from")
+}
+
+// testStreamPassword is used to set the export password during integration testing.
+var testStreamPassword string
+
+// getStreamPassword returns the password used to encrypt an export file.
+func getStreamPassword(gopts GlobalOptions, passwordFile string, confirm bool) (string, error) {
+	if testStreamPassword != "" {
+		return testStreamPassword, nil
+	}
+
+	if passwordFile != "" {
+		return loadPasswordFromFile(passwordFile)
+	}
+
+	// the repository password must not be reused for the export
+	newopts := gopts
+	newopts.password = ""
+
+	if confirm {
+		return ReadPasswordTwice(newopts,
+			"enter password for export file: ",
+			"enter password again: ")
+	}
+	return ReadPassword(newopts, "enter password for export file: ")
+}
+
+// loadBlobList reads a list of blobs in the format used by "restic list blobs".
+func loadBlobList(filename string) (restic.BlobSet, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, errors.Fatalf("unable to read blob list: %v", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	blobs := restic.NewBlobSet()
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, errors.Fatalf("%v:%d: invalid line %q", filename, line, sc.Text())
+		}
+
+		var h restic.BlobHandle
+		switch fields[0] {
+		case "data":
+			h.Type = restic.DataBlob
+		case "tree":
+			h.Type = restic.TreeBlob
+		default:
+			return nil, errors.Fatalf("%v:%d: invalid blob type %q", filename, line, fields[0])
+		}
+
+		h.ID, err = restic.ParseID(fields[1])
+		if err != nil {
+			return nil, errors.Fatalf("%v:%d: invalid blob ID %q", filename, line, fields[1])
+		}
+		blobs.Insert(h)
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, errors.Fatalf("unable to read blob list: %v", err)
+	}
+	return blobs, nil
+}
+
+func runExport(ctx context.Context, opts ExportOptions, gopts GlobalOptions, args []string) error {
+	if len(args) != 1 {
+		return invalidArguments(errors.Fatal("no snapshot ID specified, specify snapshot ID or use special ID 'latest'"))
+	}
+	if opts.ToFile == "" {
+		return invalidArguments(errors.Fatal("no output file specified, use --to-file"))
+	}
+
+	var have restic.BlobSet
+	if opts.Have != "" {
+		var err error
+		have, err = loadBlobList(opts.Have)
+		if err != nil {
+			return err
+		}
+	}
+
+	repo, err := OpenRepository(ctx, gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		var lock *restic.Lock
+		lock, ctx, err = lockRepo(ctx, repo, gopts.RetryLock, gopts.JSON)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	opts.SnapshotFilter.LoadErrorFn = warnSnapshotLoadError
+	sn, subfolder, err := opts.SnapshotFilter.FindLatest(ctx, repo.Backend(), repo, args[0])
+	if err != nil {
+		return errors.Fatalf("failed to find snapshot: %v", err)
+	}
+	if subfolder != "" {
+		return errors.Fatal("exporting a subfolder of a snapshot is not supported")
+	}
+
+	if err = repo.LoadIndex(ctx); err != nil {
+		return err
+	}
+
+	password, err := getStreamPassword(gopts, opts.StreamPasswordFile, true)
+	if err != nil {
+		return err
+	}
+
+	Verbosef("collecting blobs of snapshot %v\n", sn.ID().Str())
+	blobs := restic.NewBlobSet()
+	err = restic.FindUsedBlobs(ctx, repo, restic.IDs{*sn.Tree}, blobs, nil)
+	if err != nil {
+		return err
+	}
+
+	var skipped int
+	var exportBlobs []restic.PackedBlob
+	for h := range blobs {
+		if have.Has(h) {
+			skipped++
+			continue
+		}
+		pbs := repo.Index().Lookup(h)
+		if len(pbs) == 0 {
+			return errors.Fatalf("blob %v is missing from the repository", h)
+		}
+		exportBlobs = append(exportBlobs, pbs[0])
+	}
+
+	// load blobs in the order they are stored in the repository
+	sort.Slice(exportBlobs, func(i, j int) bool {
+		if exportBlobs[i].PackID != exportBlobs[j].PackID {
+			return exportBlobs[i].PackID.String() < exportBlobs[j].PackID.String()
+		}
+		return exportBlobs[i].Offset < exportBlobs[j].Offset
+	})
+
+	manifest := &repository.ExportManifest{
+		ChunkerPolynomial: repo.Config().ChunkerPolynomial,
+		SnapshotID:        *sn.ID(),
+		Snapshot:          sn,
+	}
+	for _, pb := range exportBlobs {
+		manifest.Blobs = append(manifest.Blobs, pb.BlobHandle)
+	}
+
+	Verbosef("exporting %d blobs, %d blobs are already present at the destination\n", len(exportBlobs), skipped)
+	err = writeExport(ctx, repo, opts.ToFile, password, manifest)
+	if err != nil {
+		return err
+	}
+
+	Verbosef("exported snapshot %v to %v\n", sn.ID().Str(), opts.ToFile)
+	return nil
+}
+
+// writeExport creates the file filename and writes the blobs listed in the
+// manifest to it. The file is removed again if an error occurs.
+func writeExport(ctx context.Context, repo restic.Repository, filename, password string, manifest *repository.ExportManifest) (err error) {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Fatalf("unable to create export file: %v", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(filename)
+		}
+	}()
+
+	wr, err := repository.NewExportWriter(f, password, manifest)
+	if err != nil {
+		return err
+	}
+
+	var buf []byte
+	for _, h := range manifest.Blobs {
+		buf, err = repo.LoadBlob(ctx, h.Type, h.ID, buf)
+		if err != nil {
+			return errors.Fatalf("unable to load blob %v: %v", h, err)
+		}
+
+		if err = wr.WriteBlob(h, buf); err != nil {
+			return err
+		}
+	}
+
+	if err = wr.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
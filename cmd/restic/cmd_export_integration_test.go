@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func testRunExport(t testing.TB, gopts GlobalOptions, opts ExportOptions, snapshotID string) {
+	testStreamPassword = "export secret"
+	defer func() {
+		testStreamPassword = ""
+	}()
+
+	rtest.OK(t, runExport(context.TODO(), opts, gopts, []string{snapshotID}))
+}
+
+func testRunImport(gopts GlobalOptions, opts ImportOptions, filename string) error {
+	testStreamPassword = "export secret"
+	defer func() {
+		testStreamPassword = ""
+	}()
+
+	return runImport(context.TODO(), opts, gopts, []string{filename})
+}
+
+func testRunInitCopyChunkerParams(t testing.TB, src, dst GlobalOptions) {
+	initOpts := InitOptions{
+		secondaryRepoOptions: secondaryRepoOptions{
+			Repo:     src.Repo,
+			password: src.password,
+		},
+		CopyChunkerParameters: true,
+	}
+	rtest.OK(t, runInit(context.TODO(), initOpts, dst, nil))
+}
+
+func testWriteBlobList(t testing.TB, gopts GlobalOptions, filename string) {
+	buf, err := withCaptureStdout(func() error {
+		return runList(context.TODO(), cmdList, ListOptions{}, gopts, []string{"blobs"})
+	})
+	rtest.OK(t, err)
+	rtest.OK(t, os.WriteFile(filename, buf.Bytes(), 0600))
+}
+
+func testCompareRestore(t testing.TB, env, env2 *testEnvironment, snapshotID, importedID restic.ID) {
+	restoredir := filepath.Join(env.base, "restore-"+snapshotID.Str())
+	testRunRestore(t, env.gopts, restoredir, snapshotID)
+	restoredir2 := filepath.Join(env2.base, "restore-"+importedID.Str())
+	testRunRestore(t, env2.gopts, restoredir2, importedID)
+
+	diff := directoriesContentsDiff(restoredir, restoredir2)
+	rtest.Assert(t, diff == "", "imported snapshot differs from original:\n%v", diff)
+}
+
+func TestExportImport(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	env2, cleanup2 := withTestEnvironment(t)
+	defer cleanup2()
+
+	testSetupBackupData(t, env)
+	testRunInitCopyChunkerParams(t, env.gopts, env2.gopts)
+
+	opts := BackupOptions{}
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "2")}, opts, env.gopts)
+	first := testListSnapshots(t, env.gopts, 1)[0]
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, opts, env.gopts)
+	var second restic.ID
+	for _, id := range testListSnapshots(t, env.gopts, 2) {
+		if !id.Equal(first) {
+			second = id
+		}
+	}
+
+	// full export
+	full := filepath.Join(env.base, "full.restic")
+	testRunExport(t, env.gopts, ExportOptions{ToFile: full}, first.String())
+	rtest.OK(t, testRunImport(env2.gopts, ImportOptions{}, full))
+	testRunCheck(t, env2.gopts)
+	importedIDs := testListSnapshots(t, env2.gopts, 1)
+	testCompareRestore(t, env, env2, first, importedIDs[0])
+
+	// the export file must not be overwritten
+	err := runExport(context.TODO(), ExportOptions{ToFile: full}, env.gopts, []string{first.String()})
+	rtest.Assert(t, err != nil, "expected export to existing file to fail")
+
+	// incremental export, only containing the blobs missing at the destination
+	have := filepath.Join(env.base, "have")
+	testWriteBlobList(t, env2.gopts, have)
+	incremental := filepath.Join(env.base, "incremental.restic")
+	testRunExport(t, env.gopts, ExportOptions{ToFile: incremental, Have: have}, second.String())
+	complete := filepath.Join(env.base, "complete.restic")
+	testRunExport(t, env.gopts, ExportOptions{ToFile: complete}, second.String())
+
+	fiIncremental, err := os.Stat(incremental)
+	rtest.OK(t, err)
+	fiComplete, err := os.Stat(complete)
+	rtest.OK(t, err)
+	rtest.Assert(t, fiIncremental.Size() < fiComplete.Size(),
+		"incremental export is not smaller than complete export: %v vs. %v", fiIncremental.Size(), fiComplete.Size())
+
+	rtest.OK(t, testRunImport(env2.gopts, ImportOptions{}, incremental))
+	testRunCheck(t, env2.gopts)
+
+	var importedID restic.ID
+	for _, id := range testListSnapshots(t, env2.gopts, 2) {
+		if !id.Equal(importedIDs[0]) {
+			importedID = id
+		}
+	}
+	testCompareRestore(t, env, env2, second, importedID)
+}
+
+func TestImportIncomplete(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	env2, cleanup2 := withTestEnvironment(t)
+	defer cleanup2()
+	env3, cleanup3 := withTestEnvironment(t)
+	defer cleanup3()
+
+	testSetupBackupData(t, env)
+	testRunInitCopyChunkerParams(t, env.gopts, env2.gopts)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "2")}, BackupOptions{}, env.gopts)
+	first := testListSnapshots(t, env.gopts, 1)[0]
+
+	full := filepath.Join(env.base, "full.restic")
+	testRunExport(t, env.gopts, ExportOptions{ToFile: full}, first.String())
+	rtest.OK(t, testRunImport(env2.gopts, ImportOptions{}, full))
+
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, BackupOptions{}, env.gopts)
+	have := filepath.Join(env.base, "have")
+	testWriteBlobList(t, env2.gopts, have)
+	incremental := filepath.Join(env.base, "incremental.restic")
+	testRunExport(t, env.gopts, ExportOptions{ToFile: incremental, Have: have}, "latest")
+
+	// importing into a repository which lacks the blobs from the have list must fail
+	testRunInitCopyChunkerParams(t, env.gopts, env3.gopts)
+	err := testRunImport(env3.gopts, ImportOptions{}, incremental)
+	rtest.Assert(t, err != nil, "expected import of incomplete snapshot to fail")
+	testListSnapshots(t, env3.gopts, 0)
+}
+
+func TestImportRechunk(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	env2, cleanup2 := withTestEnvironment(t)
+	defer cleanup2()
+
+	testSetupBackupData(t, env)
+	testRunInit(t, env2.gopts)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, BackupOptions{}, env.gopts)
+	snapshotID := testListSnapshots(t, env.gopts, 1)[0]
+
+	filename := filepath.Join(env.base, "export.restic")
+	testRunExport(t, env.gopts, ExportOptions{ToFile: filename}, snapshotID.String())
+
+	err := testRunImport(env2.gopts, ImportOptions{}, filename)
+	rtest.Assert(t, err != nil, "expected import with different chunker parameters to fail")
+	testListSnapshots(t, env2.gopts, 0)
+
+	rtest.OK(t, testRunImport(env2.gopts, ImportOptions{Rechunk: true}, filename))
+	testRunCheck(t, env2.gopts)
+	importedID := testListSnapshots(t, env2.gopts, 1)[0]
+	testCompareRestore(t, env, env2, snapshotID, importedID)
+}
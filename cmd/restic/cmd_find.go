@@ -1,8 +1,11 @@
 package main
 
 import (
+	"container/heap"
 	"context"
+	"crypto/sha256"
 	"encoding/json"
+	"math"
 	"sort"
 	"strings"
 	"time"
@@ -13,7 +16,11 @@ import (
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/filter"
+	"github.com/restic/restic/internal/index"
+	"github.com/restic/restic/internal/pack"
 	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/table"
 	"github.com/restic/restic/internal/walker"
 )
 
@@ -23,13 +30,25 @@ var cmdFind = &cobra.Command{
 	Long: `
 The "find" command searches for files or directories in snapshots stored in the
 repo.
-It can also be used to search for restic blobs or trees for troubleshooting.`,
+It can also be used to search for restic blobs or trees for troubleshooting.
+
+With --largest n, the command lists the n largest files in the snapshots,
+optionally restricted to files matching PATTERN. For each file it also shows
+the amount of stored data which is not shared with any other file in these
+snapshots. A file which is unchanged in several snapshots is only counted once.
+
+With --show-lifetime, the command reports for each path matching PATTERN the
+first and the last snapshot containing it, in the order of the snapshot times,
+and whether its content changed in between.`,
 	Example: `restic find config.json
 restic find --json "*.yml" "*.json"
 restic find --json --blob 420f620f b46ebe8a ddd38656
 restic find --show-pack-id --blob 420f620f
 restic find --tree 577c2bc9 f81f2e22 a62827a9
 restic find --pack 025c1d06
+restic find --largest 10
+restic find --largest 10 "*.img"
+restic find --show-lifetime /home/user/work/report.odt
 
 EXIT STATUS
 ===========
@@ -52,7 +71,11 @@ type FindOptions struct {
 	CaseInsensitive    bool
 	ListLong           bool
 	HumanReadable      bool
+	Largest            int
+	ShowLifetime       bool
+	Timezone           Timezone
 	restic.SnapshotFilter
+	nodeFilterOptions
 }
 
 var findOptions FindOptions
@@ -71,14 +94,19 @@ func init() {
 	f.BoolVarP(&findOptions.CaseInsensitive, "ignore-case", "i", false, "ignore case for pattern")
 	f.BoolVarP(&findOptions.ListLong, "long", "l", false, "use a long listing format showing size and mode")
 	f.BoolVar(&findOptions.HumanReadable, "human-readable", false, "print sizes in human readable format")
+	f.IntVar(&findOptions.Largest, "largest", 0, "show the `n` largest files and the size of their data not shared with other files")
+	f.BoolVar(&findOptions.ShowLifetime, "show-lifetime", false, "show the first and last snapshot containing each matching path and whether its content changed")
+	f.Var(&findOptions.Timezone, "timezone", "display times and interpret --oldest and --newest in the time `zone` (Local, UTC or a name like Europe/Berlin)")
 
 	initMultiSnapshotFilter(f, &findOptions.SnapshotFilter, true)
+	initNodeFilterOptions(f, &findOptions.nodeFilterOptions)
 }
 
 type findPattern struct {
 	oldest, newest time.Time
 	pattern        []string
 	ignoreCase     bool
+	nodeFilter     *nodeFilterOptions
 }
 
 var timeFormats = []string{
@@ -95,9 +123,10 @@ var timeFormats = []string{
 	"Mon Jan 2 15:04:05 -0700 MST 2006",
 }
 
-func parseTime(str string) (time.Time, error) {
+// parseTime parses str, times without a time zone are interpreted in loc.
+func parseTime(str string, loc *time.Location) (time.Time, error) {
 	for _, fmt := range timeFormats {
-		if t, err := time.ParseInLocation(fmt, str, time.Local); err == nil {
+		if t, err := time.ParseInLocation(fmt, str, loc); err == nil {
 			return t, nil
 		}
 	}
@@ -109,6 +138,7 @@ type statefulOutput struct {
 	ListLong      bool
 	HumanReadable bool
 	JSON          bool
+	loc           *time.Location
 	inuse         bool
 	newsn         *restic.Snapshot
 	oldsn         *restic.Snapshot
@@ -117,9 +147,13 @@ type statefulOutput struct {
 
 func (s *statefulOutput) PrintPatternJSON(path string, node *restic.Node) {
 	type findNode restic.Node
+	fn := findNode(*node)
+	// the link target is only converted when marshalling a restic.Node
+	fn.LinkTargetRaw = rawBytes(node.LinkTarget)
 	b, err := json.Marshal(struct {
 		// Add these attributes
 		Path        string `json:"path,omitempty"`
+		PathRaw     []byte `json:"path_raw,omitempty"`
 		Permissions string `json:"permissions,omitempty"`
 
 		*findNode
@@ -133,8 +167,9 @@ func (s *statefulOutput) PrintPatternJSON(path string, node *restic.Node) {
 		Subtree            byte `json:"subtree,omitempty"`
 	}{
 		Path:        path,
+		PathRaw:     rawBytes(path),
 		Permissions: node.Mode.String(),
-		findNode:    (*findNode)(node),
+		findNode:    &fn,
 	})
 	if err != nil {
 		Warnf("Marshall failed: %v\n", err)
@@ -165,9 +200,9 @@ func (s *statefulOutput) PrintPatternNormal(path string, node *restic.Node) {
 			Verbosef("\n")
 		}
 		s.oldsn = s.newsn
-		Verbosef("Found matching entries in snapshot %s from %s\n", s.oldsn.ID().Str(), s.oldsn.Time.Local().Format(TimeFormat))
+		Verbosef("Found matching entries in snapshot %s from %s\n", s.oldsn.ID().Str(), formatTime(s.oldsn.Time, s.loc))
 	}
-	Println(formatNode(path, node, s.ListLong, s.HumanReadable))
+	Println(formatNode(path, node, s.ListLong, s.HumanReadable, s.loc))
 }
 
 func (s *statefulOutput) PrintPattern(path string, node *restic.Node) {
@@ -184,6 +219,7 @@ func (s *statefulOutput) PrintObjectJSON(kind, id, nodepath, treeID string, sn *
 		ObjectType string    `json:"object_type"`
 		ID         string    `json:"id"`
 		Path       string    `json:"path"`
+		PathRaw    []byte    `json:"path_raw,omitempty"`
 		ParentTree string    `json:"parent_tree,omitempty"`
 		SnapshotID string    `json:"snapshot"`
 		Time       time.Time `json:"time,omitempty"`
@@ -191,6 +227,7 @@ func (s *statefulOutput) PrintObjectJSON(kind, id, nodepath, treeID string, sn *
 		ObjectType: kind,
 		ID:         id,
 		Path:       nodepath,
+		PathRaw:    rawBytes(nodepath),
 		SnapshotID: sn.ID().String(),
 		ParentTree: treeID,
 		Time:       sn.Time,
@@ -213,12 +250,12 @@ func (s *statefulOutput) PrintObjectJSON(kind, id, nodepath, treeID string, sn *
 func (s *statefulOutput) PrintObjectNormal(kind, id, nodepath, treeID string, sn *restic.Snapshot) {
 	Printf("Found %s %s\n", kind, id)
 	if kind == "blob" {
-		Printf(" ... in file %s\n", nodepath)
+		Printf(" ... in file %s\n", ui.EscapeInvalidUTF8(nodepath))
 		Printf("     (tree %s)\n", treeID)
 	} else {
-		Printf(" ... path %s\n", nodepath)
+		Printf(" ... path %s\n", ui.EscapeInvalidUTF8(nodepath))
 	}
-	Printf(" ... in snapshot %s (%s)\n", sn.ID().Str(), sn.Time.Local().Format(TimeFormat))
+	Printf(" ... in snapshot %s (%s)\n", sn.ID().Str(), formatTime(sn.Time, s.loc))
 }
 
 func (s *statefulOutput) PrintObject(kind, id, nodepath, treeID string, sn *restic.Snapshot) {
@@ -276,15 +313,15 @@ func (f *Finder) findInSnapshot(ctx context.Context, sn *restic.Snapshot) error
 			return false, nil
 		}
 
-		normalizedNodepath := nodepath
+		match, childMatch := filter.Match, filter.ChildMatch
 		if f.pat.ignoreCase {
-			normalizedNodepath = strings.ToLower(nodepath)
+			match, childMatch = filter.MatchInsensitive, filter.ChildMatchInsensitive
 		}
 
 		var foundMatch bool
 
 		for _, pat := range f.pat.pattern {
-			found, err := filter.Match(pat, normalizedNodepath)
+			found, err := match(pat, nodepath)
 			if err != nil {
 				return false, err
 			}
@@ -301,7 +338,7 @@ func (f *Finder) findInSnapshot(ctx context.Context, sn *restic.Snapshot) error
 		if node.Type == "dir" {
 			var childMayMatch bool
 			for _, pat := range f.pat.pattern {
-				mayMatch, err := filter.ChildMatch(pat, normalizedNodepath)
+				mayMatch, err := childMatch(pat, nodepath)
 				if err != nil {
 					return false, err
 				}
@@ -333,12 +370,36 @@ func (f *Finder) findInSnapshot(ctx context.Context, sn *restic.Snapshot) error
 			return ignoreIfNoMatch, errIfNoMatch
 		}
 
+		if f.pat.nodeFilter != nil && !f.pat.nodeFilter.Match(node) {
+			debug.Log("    owner or permissions do not match\n")
+			return ignoreIfNoMatch, errIfNoMatch
+		}
+
 		debug.Log("    found match\n")
 		f.out.PrintPattern(nodepath, node)
 		return false, nil
 	})
 }
 
+// resolveIDPrefixes returns the full IDs of the blobs of type tpe matching
+// the prefixes. Prefixes without a matching blob are skipped with a warning.
+func resolveIDPrefixes(ctx context.Context, repo restic.Repository, prefixes []string, tpe restic.BlobType) (map[string]struct{}, error) {
+	ids := make(map[string]struct{})
+	for _, prefix := range prefixes {
+		bh, err := repo.Index().LookupPrefix(ctx, prefix, tpe)
+		var notFound *index.NoBlobByPrefixError
+		if errors.As(err, &notFound) {
+			Warnf("%v\n", err)
+			continue
+		}
+		if err != nil {
+			return nil, errors.Fatal(err.Error())
+		}
+		ids[bh.ID.String()] = struct{}{}
+	}
+	return ids, nil
+}
+
 func (f *Finder) findIDs(ctx context.Context, sn *restic.Snapshot) error {
 	debug.Log("searching IDs in snapshot %s", sn.ID())
 
@@ -347,17 +408,19 @@ func (f *Finder) findIDs(ctx context.Context, sn *restic.Snapshot) error {
 	}
 
 	f.out.newsn = sn
-	return walker.Walk(ctx, f.repo, *sn.Tree, f.ignoreTrees, func(parentTreeID restic.ID, nodepath string, node *restic.Node, err error) (bool, error) {
+	// the order in which matches are printed is not deterministic as the
+	// trees are loaded in parallel
+	return walker.ParallelWalk(ctx, f.repo, *sn.Tree, func(parentTreeID restic.ID, nodepath string, node *restic.Node, err error) error {
 		if err != nil {
 			debug.Log("Error loading tree %v: %v", parentTreeID, err)
 
 			Printf("Unable to load tree %s\n ... which belongs to snapshot %s\n", parentTreeID, sn.ID())
 
-			return false, walker.ErrSkipNode
+			return walker.ErrSkipNode
 		}
 
 		if node == nil {
-			return false, nil
+			return nil
 		}
 
 		if node.Type == "dir" && f.treeIDs != nil {
@@ -375,7 +438,7 @@ func (f *Finder) findIDs(ctx context.Context, sn *restic.Snapshot) error {
 				// looking for blobs)
 				if f.itemsFound >= len(f.treeIDs) && f.blobIDs == nil {
 					// Return an error to terminate the Walk
-					return true, errors.New("OK")
+					return errors.New("OK")
 				}
 			}
 		}
@@ -396,8 +459,8 @@ func (f *Finder) findIDs(ctx context.Context, sn *restic.Snapshot) error {
 			}
 		}
 
-		return false, nil
-	})
+		return nil
+	}, walker.ParallelWalkOptions{})
 }
 
 var errAllPacksFound = errors.New("all packs found")
@@ -428,7 +491,9 @@ func (f *Finder) packsToBlobs(ctx context.Context, packs []string) error {
 		}
 		debug.Log("Found pack %s", idStr)
 		blobs, _, err := f.repo.ListPack(ctx, id, size)
-		if err != nil {
+		if errors.Is(err, pack.ErrInvalidHeader) {
+			Warnf("skipping damaged pack %v: %v\n", id.Str(), err)
+		} else if err != nil {
 			return err
 		}
 		for _, b := range blobs {
@@ -538,27 +603,30 @@ func (f *Finder) findObjectsPacks() {
 }
 
 func runFind(ctx context.Context, opts FindOptions, gopts GlobalOptions, args []string) error {
-	if len(args) == 0 {
-		return errors.Fatal("wrong number of arguments")
+	if len(args) == 0 && opts.Largest == 0 {
+		return invalidArguments(errors.Fatal("wrong number of arguments"))
+	}
+	if opts.Largest < 0 {
+		return errors.Fatal("--largest must be positive")
+	}
+	if opts.Largest > 0 && (opts.BlobID || opts.TreeID || opts.PackID) {
+		return errors.Fatal("--largest cannot be used when searching for IDs")
+	}
+	if opts.ShowLifetime && (opts.Largest > 0 || opts.BlobID || opts.TreeID || opts.PackID) {
+		return errors.Fatal("--show-lifetime cannot be used with --largest or when searching for IDs")
 	}
 
 	var err error
-	pat := findPattern{pattern: args}
-	if opts.CaseInsensitive {
-		for i := range pat.pattern {
-			pat.pattern[i] = strings.ToLower(pat.pattern[i])
-		}
-		pat.ignoreCase = true
-	}
+	pat := findPattern{pattern: args, ignoreCase: opts.CaseInsensitive}
 
 	if opts.Oldest != "" {
-		if pat.oldest, err = parseTime(opts.Oldest); err != nil {
+		if pat.oldest, err = parseTime(opts.Oldest, opts.Timezone.Location()); err != nil {
 			return err
 		}
 	}
 
 	if opts.Newest != "" {
-		if pat.newest, err = parseTime(opts.Newest); err != nil {
+		if pat.newest, err = parseTime(opts.Newest, opts.Timezone.Location()); err != nil {
 			return err
 		}
 	}
@@ -571,6 +639,16 @@ func runFind(ctx context.Context, opts FindOptions, gopts GlobalOptions, args []
 		return errors.Fatal("cannot have several ID types")
 	}
 
+	if !opts.nodeFilterOptions.Empty() {
+		if opts.BlobID || opts.TreeID || opts.PackID {
+			return errors.Fatal("owner and permission filters cannot be used when searching for IDs")
+		}
+		if err := opts.nodeFilterOptions.Parse(); err != nil {
+			return err
+		}
+		pat.nodeFilter = &opts.nodeFilterOptions
+	}
+
 	repo, err := OpenRepository(ctx, gopts)
 	if err != nil {
 		return err
@@ -597,20 +675,20 @@ func runFind(ctx context.Context, opts FindOptions, gopts GlobalOptions, args []
 	f := &Finder{
 		repo:        repo,
 		pat:         pat,
-		out:         statefulOutput{ListLong: opts.ListLong, HumanReadable: opts.HumanReadable, JSON: gopts.JSON},
+		out:         statefulOutput{ListLong: opts.ListLong, HumanReadable: opts.HumanReadable, JSON: gopts.JSON, loc: opts.Timezone.Location()},
 		ignoreTrees: restic.NewIDSet(),
 	}
 
 	if opts.BlobID {
-		f.blobIDs = make(map[string]struct{})
-		for _, pat := range f.pat.pattern {
-			f.blobIDs[pat] = struct{}{}
+		f.blobIDs, err = resolveIDPrefixes(ctx, repo, f.pat.pattern, restic.DataBlob)
+		if err != nil {
+			return err
 		}
 	}
 	if opts.TreeID {
-		f.treeIDs = make(map[string]struct{})
-		for _, pat := range f.pat.pattern {
-			f.treeIDs[pat] = struct{}{}
+		f.treeIDs, err = resolveIDPrefixes(ctx, repo, f.pat.pattern, restic.TreeBlob)
+		if err != nil {
+			return err
 		}
 	}
 
@@ -630,6 +708,13 @@ func runFind(ctx context.Context, opts FindOptions, gopts GlobalOptions, args []
 		return filteredSnapshots[i].Time.Before(filteredSnapshots[j].Time)
 	})
 
+	if opts.Largest > 0 {
+		return f.findLargest(ctx, filteredSnapshots, opts.Largest)
+	}
+	if opts.ShowLifetime {
+		return f.findLifetime(ctx, filteredSnapshots)
+	}
+
 	for _, sn := range filteredSnapshots {
 		if f.blobIDs != nil || f.treeIDs != nil {
 			if err = f.findIDs(ctx, sn); err != nil && err.Error() != "OK" {
@@ -649,3 +734,386 @@ func runFind(ctx context.Context, opts FindOptions, gopts GlobalOptions, args []
 
 	return nil
 }
+
+// matchFile returns true if the file at nodepath matches the pattern and the
+// time and node filters. An empty pattern matches all files.
+func (pat *findPattern) matchFile(nodepath string, node *restic.Node) (bool, error) {
+	match := filter.Match
+	if pat.ignoreCase {
+		match = filter.MatchInsensitive
+	}
+
+	foundMatch := len(pat.pattern) == 0
+	for _, p := range pat.pattern {
+		found, err := match(p, nodepath)
+		if err != nil {
+			return false, err
+		}
+		if found {
+			foundMatch = true
+			break
+		}
+	}
+	if !foundMatch {
+		return false, nil
+	}
+
+	if !pat.oldest.IsZero() && node.ModTime.Before(pat.oldest) {
+		return false, nil
+	}
+	if !pat.newest.IsZero() && node.ModTime.After(pat.newest) {
+		return false, nil
+	}
+	if pat.nodeFilter != nil && !pat.nodeFilter.Match(node) {
+		return false, nil
+	}
+	return true, nil
+}
+
+// largestFile is a file version reported by find --largest.
+type largestFile struct {
+	Path       string `json:"path"`
+	SnapshotID string `json:"snapshot"`
+	Size       uint64 `json:"size"`
+	UniqueSize uint64 `json:"unique_size"`
+}
+
+// largestFiles is a min-heap of files ordered by size.
+type largestFiles []largestFile
+
+func (l largestFiles) Len() int { return len(l) }
+func (l largestFiles) Less(i, j int) bool {
+	if l[i].Size != l[j].Size {
+		return l[i].Size < l[j].Size
+	}
+	return l[i].Path > l[j].Path
+}
+func (l largestFiles) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+
+func (l *largestFiles) Push(x interface{}) { *l = append(*l, x.(largestFile)) }
+func (l *largestFiles) Pop() interface{} {
+	old := *l
+	x := old[len(old)-1]
+	*l = old[:len(old)-1]
+	return x
+}
+
+// fileVersionID identifies a version of a file by its path and content, such
+// that a file which is unchanged in several snapshots is only counted once.
+func fileVersionID(nodepath string, node *restic.Node) restic.ID {
+	h := sha256.New()
+	_, _ = h.Write([]byte(nodepath))
+	_, _ = h.Write([]byte{0})
+	for _, id := range node.Content {
+		_, _ = h.Write(id[:])
+	}
+	return restic.IDFromHash(h.Sum(nil))
+}
+
+// walkFiles calls fn for all files in the snapshots. Trees which cannot be
+// loaded are skipped, a warning is printed if warn is set.
+func (f *Finder) walkFiles(ctx context.Context, snapshots []*restic.Snapshot, warn bool, fn func(sn *restic.Snapshot, nodepath string, node *restic.Node) error) error {
+	for _, sn := range snapshots {
+		if sn.Tree == nil {
+			return errors.Errorf("snapshot %v has no tree", sn.ID().Str())
+		}
+
+		err := walker.Walk(ctx, f.repo, *sn.Tree, nil, func(parentTreeID restic.ID, nodepath string, node *restic.Node, err error) (bool, error) {
+			if err != nil {
+				debug.Log("Error loading tree %v: %v", parentTreeID, err)
+				if warn {
+					Warnf("Unable to load tree %s\n ... which belongs to snapshot %s\n", parentTreeID, sn.ID())
+				}
+				return false, walker.ErrSkipNode
+			}
+
+			if node == nil || node.Type != "file" {
+				return false, nil
+			}
+			return false, fn(sn, nodepath, node)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findLargest prints the n largest files matching the pattern in the
+// snapshots, together with the size of the data blobs which are not shared
+// with any other file in the snapshots.
+func (f *Finder) findLargest(ctx context.Context, snapshots []*restic.Snapshot, n int) error {
+	// count the file versions referencing each data blob, the count saturates
+	// at the maximum of a uint8 to keep the memory usage low
+	refs := restic.NewCountedBlobSet()
+	versions := restic.NewIDSet()
+	err := f.walkFiles(ctx, snapshots, true, func(_ *restic.Snapshot, nodepath string, node *restic.Node) error {
+		v := fileVersionID(nodepath, node)
+		if versions.Has(v) {
+			return nil
+		}
+		versions.Insert(v)
+
+		for id := range restic.NewIDSet(node.Content...) {
+			h := restic.BlobHandle{ID: id, Type: restic.DataBlob}
+			if refs[h] < math.MaxUint8 {
+				refs[h]++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var largest largestFiles
+	err = f.walkFiles(ctx, snapshots, false, func(sn *restic.Snapshot, nodepath string, node *restic.Node) error {
+		v := fileVersionID(nodepath, node)
+		if !versions.Has(v) {
+			// already scored
+			return nil
+		}
+		versions.Delete(v)
+
+		match, err := f.pat.matchFile(nodepath, node)
+		if err != nil || !match {
+			return err
+		}
+
+		file := largestFile{Path: nodepath, SnapshotID: sn.ID().Str(), Size: node.Size}
+		if len(largest) == n && !(largestFiles{largest[0], file}).Less(0, 1) {
+			return nil
+		}
+
+		for id := range restic.NewIDSet(node.Content...) {
+			h := restic.BlobHandle{ID: id, Type: restic.DataBlob}
+			if refs[h] != 1 {
+				continue
+			}
+			if pbs := f.repo.Index().Lookup(h); len(pbs) > 0 {
+				file.UniqueSize += uint64(pbs[0].Length)
+			}
+		}
+
+		heap.Push(&largest, file)
+		if len(largest) > n {
+			heap.Pop(&largest)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Sort(sort.Reverse(largest))
+
+	if f.out.JSON {
+		if largest == nil {
+			largest = largestFiles{}
+		}
+		return json.NewEncoder(globalOptions.stdout).Encode(largest)
+	}
+
+	tab := table.New()
+	tab.AddColumn("Size", "{{ .Size }}")
+	tab.AddColumn("Unique", "{{ .Unique }}")
+	tab.AddColumn("Snapshot", "{{ .Snapshot }}")
+	tab.AddColumn("Path", "{{ .Path }}")
+	for _, file := range largest {
+		tab.AddRow(struct {
+			Size, Unique, Snapshot, Path string
+		}{ui.FormatBytes(file.Size), ui.FormatBytes(file.UniqueSize), file.SnapshotID, file.Path})
+	}
+	return tab.Write(globalOptions.stdout)
+}
+
+// pathLifetime is the lifetime of a path reported by find --show-lifetime.
+type pathLifetime struct {
+	Path          string    `json:"path"`
+	FirstSnapshot string    `json:"first_snapshot"`
+	FirstTime     time.Time `json:"first_time"`
+	LastSnapshot  string    `json:"last_snapshot"`
+	LastTime      time.Time `json:"last_time"`
+	Snapshots     int       `json:"snapshots"`
+	Changed       bool      `json:"changed"`
+
+	content restic.ID
+}
+
+// nodeContentID identifies the content of node, ignoring its metadata. For
+// files, this is the list of data blobs.
+func nodeContentID(node *restic.Node) restic.ID {
+	if node.Type == "dir" && node.Subtree != nil {
+		return *node.Subtree
+	}
+
+	h := sha256.New()
+	_, _ = h.Write([]byte(node.Type))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(node.LinkTarget))
+	for _, id := range node.Content {
+		_, _ = h.Write(id[:])
+	}
+	return restic.IDFromHash(h.Sum(nil))
+}
+
+// pathsBelow returns the paths in the sorted list paths which start with
+// prefix.
+func pathsBelow(paths []string, prefix string) []string {
+	start := sort.SearchStrings(paths, prefix)
+	end := start
+	for end < len(paths) && strings.HasPrefix(paths[end], prefix) {
+		end++
+	}
+	return paths[start:end]
+}
+
+// findLifetime prints the lifetime of all paths matching the pattern in the
+// snapshots, which must be sorted by time. Directories which have the same
+// tree as in the previous snapshot are not walked again, the matches found
+// within them in the previous snapshot are used instead.
+func (f *Finder) findLifetime(ctx context.Context, snapshots []*restic.Snapshot) error {
+	match, childMatch := filter.Match, filter.ChildMatch
+	if f.pat.ignoreCase {
+		match, childMatch = filter.MatchInsensitive, filter.ChildMatchInsensitive
+	}
+	matchAny := func(fn func(string, string) (bool, error), nodepath string) (bool, error) {
+		for _, pat := range f.pat.pattern {
+			found, err := fn(pat, nodepath)
+			if err != nil || found {
+				return found, err
+			}
+		}
+		return false, nil
+	}
+
+	lifetimes := make(map[string]*pathLifetime)
+	// the sorted matches and the walked directories of the previous snapshot
+	var prevMatches, prevDirPaths []string
+	prevDirs := make(map[string]restic.ID)
+
+	for _, sn := range snapshots {
+		if sn.Tree == nil {
+			return errors.Errorf("snapshot %v has no tree", sn.ID().Str())
+		}
+
+		var matches []string
+		dirs := make(map[string]restic.ID)
+		seen := func(nodepath string, content restic.ID) {
+			lt := lifetimes[nodepath]
+			if lt == nil {
+				lt = &pathLifetime{Path: nodepath, FirstSnapshot: sn.ID().String(), FirstTime: sn.Time, content: content}
+				lifetimes[nodepath] = lt
+			} else if !lt.content.Equal(content) {
+				lt.Changed = true
+				lt.content = content
+			}
+			lt.LastSnapshot = sn.ID().String()
+			lt.LastTime = sn.Time
+			lt.Snapshots++
+			matches = append(matches, nodepath)
+		}
+		// reuse copies the matches and directories below the unchanged
+		// directory with the given prefix from the previous snapshot
+		reuse := func(prefix string) {
+			for _, p := range pathsBelow(prevMatches, prefix) {
+				seen(p, lifetimes[p].content)
+			}
+			for _, p := range pathsBelow(prevDirPaths, prefix) {
+				dirs[p] = prevDirs[p]
+			}
+		}
+
+		if id, ok := prevDirs["/"]; ok && id.Equal(*sn.Tree) {
+			reuse("/")
+		} else {
+			dirs["/"] = *sn.Tree
+			err := walker.Walk(ctx, f.repo, *sn.Tree, nil, func(parentTreeID restic.ID, nodepath string, node *restic.Node, err error) (bool, error) {
+				if err != nil {
+					debug.Log("Error loading tree %v: %v", parentTreeID, err)
+					Warnf("Unable to load tree %s\n ... which belongs to snapshot %s\n", parentTreeID, sn.ID())
+					return false, walker.ErrSkipNode
+				}
+				if node == nil {
+					return false, nil
+				}
+
+				found, err := matchAny(match, nodepath)
+				if err != nil {
+					return false, err
+				}
+				if found && (f.pat.oldest.IsZero() || !node.ModTime.Before(f.pat.oldest)) &&
+					(f.pat.newest.IsZero() || !node.ModTime.After(f.pat.newest)) &&
+					(f.pat.nodeFilter == nil || f.pat.nodeFilter.Match(node)) {
+					seen(nodepath, nodeContentID(node))
+				}
+
+				if node.Type != "dir" || node.Subtree == nil {
+					return false, nil
+				}
+				childMayMatch, err := matchAny(childMatch, nodepath)
+				if err != nil {
+					return false, err
+				}
+				if !childMayMatch {
+					return false, walker.ErrSkipNode
+				}
+
+				dirs[nodepath] = *node.Subtree
+				if id, ok := prevDirs[nodepath]; ok && id.Equal(*node.Subtree) {
+					reuse(nodepath + "/")
+					return false, walker.ErrSkipNode
+				}
+				return false, nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		sort.Strings(matches)
+		prevMatches = matches
+		prevDirs = dirs
+		prevDirPaths = prevDirPaths[:0]
+		for p := range dirs {
+			prevDirPaths = append(prevDirPaths, p)
+		}
+		sort.Strings(prevDirPaths)
+	}
+
+	result := make([]*pathLifetime, 0, len(lifetimes))
+	for _, lt := range lifetimes {
+		result = append(result, lt)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Path < result[j].Path
+	})
+
+	if f.out.JSON {
+		return json.NewEncoder(globalOptions.stdout).Encode(result)
+	}
+
+	tab := table.New()
+	tab.AddColumn("Path", "{{ .Path }}")
+	tab.AddColumn("First", "{{ .First }}")
+	tab.AddColumn("Last", "{{ .Last }}")
+	tab.AddColumn("Snapshots", "{{ .Snapshots }}")
+	tab.AddColumn("Changed", "{{ .Changed }}")
+	for _, lt := range result {
+		changed := "no"
+		if lt.Changed {
+			changed = "yes"
+		}
+		tab.AddRow(struct {
+			Path, First, Last, Changed string
+			Snapshots                  int
+		}{
+			ui.EscapeInvalidUTF8(lt.Path),
+			lt.FirstSnapshot[:8] + " " + formatTime(lt.FirstTime, f.out.loc),
+			lt.LastSnapshot[:8] + " " + formatTime(lt.LastTime, f.out.loc),
+			changed,
+			lt.Snapshots,
+		})
+	}
+	return tab.Write(globalOptions.stdout)
+}
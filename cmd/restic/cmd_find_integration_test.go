@@ -3,10 +3,13 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
 )
 
@@ -41,6 +44,17 @@ func TestFind(t *testing.T) {
 	results = testRunFind(t, false, env.gopts, "testfile*")
 	lines = strings.Split(string(results), "\n")
 	rtest.Assert(t, len(lines) == 4, "expected three files found in repo (%v)", datafile)
+
+	results = testRunFind(t, false, env.gopts, "TESTFILE*")
+	rtest.Assert(t, len(results) == 0, "case sensitive find matched uppercase pattern")
+
+	buf, err := withCaptureStdout(func() error {
+		opts := FindOptions{CaseInsensitive: true}
+		return runFind(context.TODO(), opts, env.gopts, []string{"TESTFILE*"})
+	})
+	rtest.OK(t, err)
+	lines = strings.Split(buf.String(), "\n")
+	rtest.Assert(t, len(lines) == 4, "expected three files found with --ignore-case (%v)", datafile)
 }
 
 type testMatch struct {
@@ -85,3 +99,199 @@ func TestFindJSON(t *testing.T) {
 	rtest.Assert(t, len(matches[0].Matches) == 3, "expected 3 files to match (%v)", datafile)
 	rtest.Assert(t, matches[0].Hits == 3, "expected hits to show 3 matches (%v)", datafile)
 }
+
+func TestFindTreeIDPrefix(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	snapshotID := testListSnapshots(t, env.gopts, 1)[0]
+
+	repo, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+	sn, err := restic.LoadSnapshot(context.TODO(), repo, snapshotID)
+	rtest.OK(t, err)
+	rtest.OK(t, repo.LoadIndex(context.TODO()))
+	root, err := restic.LoadTree(context.TODO(), repo, *sn.Tree)
+	rtest.OK(t, err)
+
+	// find only reports subtrees, so look for the tree of a subdirectory
+	var treeID string
+	for _, node := range root.Nodes {
+		if node.Type == "dir" {
+			treeID = node.Subtree.String()
+			break
+		}
+	}
+	rtest.Assert(t, treeID != "", "no subdirectory found in snapshot")
+
+	buf, err := withCaptureStdout(func() error {
+		return runFind(context.TODO(), FindOptions{TreeID: true}, env.gopts, []string{treeID[:6]})
+	})
+	rtest.OK(t, err)
+	rtest.Assert(t, strings.Contains(buf.String(), treeID), "tree %v not found, output: %q", treeID, buf.String())
+
+	buf, err = withCaptureStdout(func() error {
+		return runCat(context.TODO(), CatOptions{}, env.gopts, []string{"tree", treeID[:6]})
+	})
+	rtest.OK(t, err)
+	rtest.Assert(t, strings.Contains(buf.String(), `"nodes"`), "unexpected tree output %q", buf.String())
+
+	// a prefix which is too short is rejected
+	err = runFind(context.TODO(), FindOptions{TreeID: true}, env.gopts, []string{treeID[:3]})
+	rtest.Assert(t, err != nil, "missing error for too short prefix")
+}
+
+func testRunFindLargest(t testing.TB, gopts GlobalOptions, n int, patterns ...string) []largestFile {
+	buf, err := withCaptureStdout(func() error {
+		gopts.JSON = true
+
+		opts := FindOptions{Largest: n}
+		return runFind(context.TODO(), opts, gopts, patterns)
+	})
+	rtest.OK(t, err)
+
+	var files []largestFile
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &files))
+	return files
+}
+
+func TestFindLargest(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	const mib = 1024 * 1024
+	unique := rtest.Random(23, 3*mib)
+	shared := rtest.Random(42, 2*mib)
+	rtest.OK(t, os.MkdirAll(env.testdata, 0755))
+	for name, data := range map[string][]byte{
+		"unique.img": unique,
+		"dup1.img":   shared,
+		"dup2.img":   shared,
+		"small":      []byte("foobar"),
+	} {
+		rtest.OK(t, os.WriteFile(filepath.Join(env.testdata, name), data, 0644))
+	}
+
+	// the second snapshot contains the same file versions
+	testRunBackup(t, env.testdata, []string{"."}, BackupOptions{}, env.gopts)
+	testRunBackup(t, env.testdata, []string{"."}, BackupOptions{}, env.gopts)
+
+	files := testRunFindLargest(t, env.gopts, 2)
+	rtest.Equals(t, 2, len(files))
+	rtest.Equals(t, "/unique.img", files[0].Path)
+	rtest.Equals(t, uint64(len(unique)), files[0].Size)
+	// random data does not compress, the stored size includes the encryption overhead
+	rtest.Assert(t, files[0].UniqueSize >= files[0].Size && files[0].UniqueSize < files[0].Size+4096,
+		"unexpected unique size %v for file of size %v", files[0].UniqueSize, files[0].Size)
+	rtest.Equals(t, largestFile{Path: "/dup1.img", SnapshotID: files[1].SnapshotID, Size: uint64(len(shared))}, files[1])
+
+	// all blobs of the duplicated files are shared
+	files = testRunFindLargest(t, env.gopts, 10, "dup*")
+	rtest.Equals(t, 2, len(files))
+	for i, name := range []string{"/dup1.img", "/dup2.img"} {
+		rtest.Equals(t, name, files[i].Path)
+		rtest.Equals(t, uint64(0), files[i].UniqueSize)
+	}
+
+	// the unique file becomes shared when a modified version is added
+	rtest.OK(t, os.WriteFile(filepath.Join(env.testdata, "unique.img"), append(unique, shared...), 0644))
+	testRunBackup(t, env.testdata, []string{"."}, BackupOptions{}, env.gopts)
+	files = testRunFindLargest(t, env.gopts, 1)
+	rtest.Equals(t, "/unique.img", files[0].Path)
+	rtest.Equals(t, uint64(len(unique)+len(shared)), files[0].Size)
+	rtest.Assert(t, files[0].UniqueSize < uint64(len(unique)+len(shared)),
+		"unexpected unique size %v for modified file", files[0].UniqueSize)
+
+	buf, err := withCaptureStdout(func() error {
+		return runFind(context.TODO(), FindOptions{Largest: 1}, env.gopts, nil)
+	})
+	rtest.OK(t, err)
+	rtest.Assert(t, strings.Contains(buf.String(), "/unique.img"), "table output is missing the largest file: %q", buf.String())
+}
+
+func testRunFindLifetime(t testing.TB, gopts GlobalOptions, patterns ...string) map[string]pathLifetime {
+	buf, err := withCaptureStdout(func() error {
+		gopts.JSON = true
+		return runFind(context.TODO(), FindOptions{ShowLifetime: true}, gopts, patterns)
+	})
+	rtest.OK(t, err)
+
+	var list []pathLifetime
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &list))
+	lifetimes := make(map[string]pathLifetime)
+	for _, lt := range list {
+		lifetimes[lt.Path] = lt
+	}
+	return lifetimes
+}
+
+func TestFindLifetime(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	write := func(name, content string) {
+		p := filepath.Join(env.testdata, filepath.FromSlash(name))
+		rtest.OK(t, os.MkdirAll(filepath.Dir(p), 0755))
+		rtest.OK(t, os.WriteFile(p, []byte(content), 0644))
+	}
+	var snapshots []string
+	backup := func() {
+		known := restic.NewIDSet(testListSnapshots(t, env.gopts, len(snapshots))...)
+		testRunBackup(t, env.testdata, []string{"."}, BackupOptions{}, env.gopts)
+		for _, id := range testListSnapshots(t, env.gopts, len(snapshots)+1) {
+			if !known.Has(id) {
+				snapshots = append(snapshots, id.String())
+			}
+		}
+	}
+
+	write("file.txt", "first version")
+	write("sub/deep/keep.txt", "unchanged")
+	write("sub/other.dat", "not matched")
+	backup()
+	write("new.txt", "added in the second snapshot")
+	backup()
+	write("file.txt", "second version")
+	backup()
+	rtest.OK(t, os.Remove(filepath.Join(env.testdata, "file.txt")))
+	backup()
+	write("sub/other.dat", "changed, but the matching file in sub/deep is not")
+	backup()
+
+	lifetimes := testRunFindLifetime(t, env.gopts, "*.txt")
+	rtest.Equals(t, 3, len(lifetimes))
+
+	check := func(path string, first, last, count int, changed bool) {
+		t.Helper()
+		lt, ok := lifetimes[path]
+		rtest.Assert(t, ok, "missing lifetime of %v in %v", path, lifetimes)
+		rtest.Equals(t, snapshots[first], lt.FirstSnapshot)
+		rtest.Equals(t, snapshots[last], lt.LastSnapshot)
+		rtest.Equals(t, count, lt.Snapshots)
+		rtest.Equals(t, changed, lt.Changed)
+	}
+	check("/file.txt", 0, 2, 3, true)
+	check("/new.txt", 1, 4, 4, false)
+	check("/sub/deep/keep.txt", 0, 4, 5, false)
+
+	// a pattern matching a directory also matches its content
+	lifetimes = testRunFindLifetime(t, env.gopts, "sub")
+	rtest.Equals(t, 4, len(lifetimes))
+	check("/sub", 0, 4, 5, true)
+	check("/sub/deep", 0, 4, 5, false)
+	check("/sub/deep/keep.txt", 0, 4, 5, false)
+	check("/sub/other.dat", 0, 4, 5, true)
+
+	buf, err := withCaptureStdout(func() error {
+		return runFind(context.TODO(), FindOptions{ShowLifetime: true}, env.gopts, []string{"file.txt"})
+	})
+	rtest.OK(t, err)
+	rtest.Assert(t, strings.Contains(buf.String(), "/file.txt") && strings.Contains(buf.String(), snapshots[2][:8]),
+		"unexpected table output: %q", buf.String())
+}
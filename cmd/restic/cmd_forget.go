@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"io"
 	"strconv"
+	"strings"
 
+	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
 	"github.com/spf13/cobra"
@@ -19,6 +21,14 @@ The "forget" command removes snapshots according to a policy. All snapshots are
 first divided into groups according to "--group-by", and after that the policy
 specified by the "--keep-*" options is applied to each group individually.
 
+Snapshots can also be given in a file using "--snapshot-file", one snapshot ID
+or unambiguous ID prefix per line. Unless "--skip-missing" is specified, nothing
+is removed if any of the listed snapshots cannot be resolved.
+
+Snapshots which were pinned using "restic tag --pin" are always kept, both when
+a policy is applied and when they are given as snapshot IDs. Use "--ignore-pins"
+to treat them like any other snapshot.
+
 Please note that this command really only deletes the snapshot object in the
 repository, which is a reference to data stored there. In order to remove the
 unreferenced data after "forget" was run successfully, see the "prune" command.
@@ -87,6 +97,10 @@ type ForgetOptions struct {
 	WithinMonthly restic.Duration
 	WithinYearly  restic.Duration
 	KeepTags      restic.TagLists
+	IgnorePins    bool
+	Timezone      Timezone
+	SnapshotFile  string
+	SkipMissing   bool
 
 	restic.SnapshotFilter
 	Compact bool
@@ -116,6 +130,10 @@ func init() {
 	f.VarP(&forgetOptions.WithinMonthly, "keep-within-monthly", "", "keep monthly snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
 	f.VarP(&forgetOptions.WithinYearly, "keep-within-yearly", "", "keep yearly snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
 	f.Var(&forgetOptions.KeepTags, "keep-tag", "keep snapshots with this `taglist` (can be specified multiple times)")
+	f.BoolVar(&forgetOptions.IgnorePins, "ignore-pins", false, "also remove pinned snapshots if they are not kept by the policy")
+	f.StringVar(&forgetOptions.SnapshotFile, "snapshot-file", "", "remove the snapshots listed in `file`, one snapshot ID per line (use - for stdin)")
+	f.BoolVar(&forgetOptions.SkipMissing, "skip-missing", false, "remove the snapshots listed in the snapshot file even if some of them cannot be resolved")
+	f.Var(&forgetOptions.Timezone, "timezone", "use the time `zone` (Local, UTC or a name like Europe/Berlin) to determine the hour, day, week, month and year of snapshots, and to display times")
 
 	initMultiSnapshotFilter(f, &forgetOptions.SnapshotFilter, false)
 	f.StringArrayVar(&forgetOptions.Hosts, "hostname", nil, "only consider snapshots with the given `hostname` (can be specified multiple times)")
@@ -138,25 +156,101 @@ func init() {
 func verifyForgetOptions(opts *ForgetOptions) error {
 	if opts.Last < -1 || opts.Hourly < -1 || opts.Daily < -1 || opts.Weekly < -1 ||
 		opts.Monthly < -1 || opts.Yearly < -1 {
-		return errors.Fatal("negative values other than -1 are not allowed for --keep-*")
+		return invalidArguments(errors.Fatal("negative values other than -1 are not allowed for --keep-*"))
 	}
 
 	for _, d := range []restic.Duration{opts.Within, opts.WithinHourly, opts.WithinDaily,
 		opts.WithinMonthly, opts.WithinWeekly, opts.WithinYearly} {
 		if d.Hours < 0 || d.Days < 0 || d.Months < 0 || d.Years < 0 {
-			return errors.Fatal("durations containing negative values are not allowed for --keep-within*")
+			return invalidArguments(errors.Fatal("durations containing negative values are not allowed for --keep-within*"))
 		}
 	}
 
+	if opts.SkipMissing && opts.SnapshotFile == "" {
+		return invalidArguments(errors.Fatal("--skip-missing requires --snapshot-file"))
+	}
+
 	return nil
 }
 
+// readSnapshotFile returns the snapshot IDs listed in filename, one per line.
+// Empty lines and lines starting with '#' are ignored.
+func readSnapshotFile(filename string) ([]string, error) {
+	lines, err := readLines(filename)
+	if err != nil {
+		return nil, errors.Fatalf("unable to read snapshot file: %v", err)
+	}
+
+	var ids []string
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		ids = append(ids, line)
+	}
+	return ids, nil
+}
+
+// findSnapshotFileSnapshots returns the snapshots listed in the snapshot file
+// and the number of IDs which could not be resolved. All IDs are resolved
+// before anything is removed. Unless opts.SkipMissing is set, an error is
+// returned if any ID cannot be resolved.
+func findSnapshotFileSnapshots(ctx context.Context, repo restic.Repository, opts ForgetOptions) (snapshots restic.Snapshots, missing int, err error) {
+	ids, err := readSnapshotFile(opts.SnapshotFile)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	be, err := backend.MemorizeList(ctx, repo.Backend(), restic.SnapshotFile)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	found := restic.NewIDSet()
+	for _, s := range ids {
+		sn, subfolder, err := restic.FindSnapshot(ctx, be, repo, s)
+		if err == nil && subfolder != "" {
+			err = restic.ErrInvalidSnapshotSyntax
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, 0, ctx.Err()
+			}
+			Warnf("unable to resolve snapshot %q: %v\n", s, err)
+			missing++
+			continue
+		}
+
+		if found.Has(*sn.ID()) {
+			continue
+		}
+		found.Insert(*sn.ID())
+		snapshots = append(snapshots, sn)
+	}
+
+	if missing > 0 && !opts.SkipMissing {
+		return nil, missing, errors.Fatalf("%d of %d snapshots listed in %v could not be resolved, no snapshots were removed (use --skip-missing to remove the others)",
+			missing, len(ids), opts.SnapshotFile)
+	}
+	return snapshots, missing, nil
+}
+
 func runForget(ctx context.Context, opts ForgetOptions, gopts GlobalOptions, args []string) error {
 	err := verifyForgetOptions(&opts)
 	if err != nil {
 		return err
 	}
 
+	if !opts.DryRun {
+		if err := checkAppendOnly(gopts, "forget"); err != nil {
+			return err
+		}
+		if err := checkReadOnly(gopts, "forget"); err != nil {
+			return err
+		}
+	}
+
 	err = verifyPruneOptions(&pruneOptions)
 	if err != nil {
 		return err
@@ -167,8 +261,11 @@ func runForget(ctx context.Context, opts ForgetOptions, gopts GlobalOptions, arg
 		return err
 	}
 
+	// the policy must be applied to all snapshots
+	repo.DisableListCache()
+
 	if gopts.NoLock && !opts.DryRun {
-		return errors.Fatal("--no-lock is only applicable in combination with --dry-run for forget command")
+		return invalidArguments(errors.Fatal("--no-lock is only applicable in combination with --dry-run for forget command"))
 	}
 
 	if !opts.DryRun || !gopts.NoLock {
@@ -183,15 +280,41 @@ func runForget(ctx context.Context, opts ForgetOptions, gopts GlobalOptions, arg
 	var snapshots restic.Snapshots
 	removeSnIDs := restic.NewIDSet()
 
-	for sn := range FindFilteredSnapshots(ctx, repo.Backend(), repo, &opts.SnapshotFilter, args) {
-		snapshots = append(snapshots, sn)
+	// the snapshots in the file are resolved first, such that nothing is
+	// removed if one of them is missing
+	var fileSnapshots restic.Snapshots
+	missing := 0
+	if opts.SnapshotFile != "" {
+		fileSnapshots, missing, err = findSnapshotFileSnapshots(ctx, repo, opts)
+		if err != nil {
+			return err
+		}
+	}
+
+	explicit := len(args) > 0 || opts.SnapshotFile != ""
+	if len(args) > 0 || !explicit {
+		for sn := range FindFilteredSnapshots(ctx, repo.Backend(), repo, &opts.SnapshotFilter, args) {
+			snapshots = append(snapshots, sn)
+		}
+	} else if len(opts.Hosts) > 0 || len(opts.Tags) > 0 || len(opts.Paths) > 0 {
+		Warnf("Ignoring \"filters\": explicit snapshot ids are given\n")
 	}
+	snapshots = append(snapshots, fileSnapshots...)
 
 	var jsonGroups []*ForgetGroup
 
-	if len(args) > 0 {
+	pinned := 0
+	if explicit {
 		// When explicit snapshots args are given, remove them immediately.
 		for _, sn := range snapshots {
+			if removeSnIDs.Has(*sn.ID()) {
+				continue
+			}
+			if sn.Pinned && !opts.IgnorePins {
+				Warnf("snapshot %v is pinned, not removing it (use --ignore-pins to override)\n", sn.ID().Str())
+				pinned++
+				continue
+			}
 			removeSnIDs.Insert(*sn.ID())
 		}
 	} else {
@@ -214,6 +337,8 @@ func runForget(ctx context.Context, opts ForgetOptions, gopts GlobalOptions, arg
 			WithinMonthly: opts.WithinMonthly,
 			WithinYearly:  opts.WithinYearly,
 			Tags:          opts.KeepTags,
+			IgnorePins:    opts.IgnorePins,
+			Location:      opts.Timezone.Location(),
 		}
 
 		if policy.Empty() && len(args) == 0 {
@@ -249,14 +374,14 @@ func runForget(ctx context.Context, opts ForgetOptions, gopts GlobalOptions, arg
 
 				if len(keep) != 0 && !gopts.Quiet && !gopts.JSON {
 					Printf("keep %d snapshots:\n", len(keep))
-					PrintSnapshots(globalOptions.stdout, keep, reasons, opts.Compact)
+					PrintSnapshots(globalOptions.stdout, keep, reasons, opts.Compact, false, nil, opts.Timezone.Location())
 					Printf("\n")
 				}
 				addJSONSnapshots(&fg.Keep, keep)
 
 				if len(remove) != 0 && !gopts.Quiet && !gopts.JSON {
 					Printf("remove %d snapshots:\n", len(remove))
-					PrintSnapshots(globalOptions.stdout, remove, nil, opts.Compact)
+					PrintSnapshots(globalOptions.stdout, remove, nil, opts.Compact, false, nil, opts.Timezone.Location())
 					Printf("\n")
 				}
 				addJSONSnapshots(&fg.Remove, remove)
@@ -284,6 +409,22 @@ func runForget(ctx context.Context, opts ForgetOptions, gopts GlobalOptions, arg
 			}
 		}
 	}
+	if !explicit && len(opts.Hosts)+len(opts.Tags)+len(opts.Paths) == 0 {
+		// all snapshots of the repository have been loaded
+		remaining := len(snapshots)
+		if !opts.DryRun {
+			remaining -= len(removeSnIDs)
+		}
+		recordSnapshotCount(remaining)
+	}
+
+	if opts.SnapshotFile != "" && !gopts.JSON {
+		action := "removed"
+		if opts.DryRun {
+			action = "would be removed"
+		}
+		Printf("%d snapshots %v, %d pinned snapshots kept, %d snapshots could not be resolved\n", len(removeSnIDs), action, pinned, missing)
+	}
 
 	if gopts.JSON && len(jsonGroups) > 0 {
 		err = printJSONForget(globalOptions.stdout, jsonGroups)
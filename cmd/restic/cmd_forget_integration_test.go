@@ -2,8 +2,15 @@ package main
 
 import (
 	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 
+	"github.com/restic/restic/internal/backend/appendonly"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
 )
 
@@ -11,3 +18,127 @@ func testRunForget(t testing.TB, gopts GlobalOptions, args ...string) {
 	opts := ForgetOptions{}
 	rtest.OK(t, runForget(context.TODO(), opts, gopts, args))
 }
+
+// removeCountingBackend counts the files which are removed, except for locks.
+type removeCountingBackend struct {
+	restic.Backend
+	m       sync.Mutex
+	removed int
+}
+
+func (be *removeCountingBackend) Remove(ctx context.Context, h restic.Handle) error {
+	if h.Type != restic.LockFile {
+		be.m.Lock()
+		be.removed++
+		be.m.Unlock()
+	}
+	return be.Backend.Remove(ctx, h)
+}
+
+func TestForgetAppendOnly(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+
+	counter := &removeCountingBackend{}
+	gopts := env.gopts
+	gopts.AppendOnly = true
+	gopts.backendInnerTestHook = func(r restic.Backend) (restic.Backend, error) {
+		counter.Backend = r
+		return counter, nil
+	}
+
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, gopts)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, gopts)
+	snapshotIDs := testListSnapshots(t, gopts, 2)
+
+	// destructive commands are refused before opening the repository
+	for _, test := range []struct {
+		name string
+		run  func() error
+	}{
+		{"forget", func() error {
+			return runForget(context.TODO(), ForgetOptions{}, gopts, []string{snapshotIDs[0].String()})
+		}},
+		{"prune", func() error { return runPrune(context.TODO(), PruneOptions{MaxUnused: "5%"}, gopts) }},
+		{"key remove", func() error { return runKey(context.TODO(), gopts, []string{"remove", "abcdef"}) }},
+		{"unlock --remove-all", func() error { return runUnlock(context.TODO(), UnlockOptions{RemoveAll: true}, gopts) }},
+		{"tag", func() error {
+			return runTag(context.TODO(), TagOptions{AddTags: restic.TagLists{{"foo"}}}, gopts, nil)
+		}},
+	} {
+		err := test.run()
+		rtest.Assert(t, err != nil && strings.Contains(err.Error(), "not allowed in append-only mode"),
+			"unexpected error for %v: %v", test.name, err)
+	}
+
+	// removing files directly fails in the backend
+	repo, err := OpenRepository(context.TODO(), gopts)
+	rtest.OK(t, err)
+	err = repo.Backend().Remove(context.TODO(), restic.Handle{Type: restic.SnapshotFile, Name: snapshotIDs[0].String()})
+	rtest.Assert(t, errors.Is(err, appendonly.ErrAppendOnly), "unexpected error for remove: %v", err)
+
+	rtest.Equals(t, 0, counter.removed)
+	testListSnapshots(t, env.gopts, 2)
+	testRunCheck(t, env.gopts)
+}
+
+func TestForgetSnapshotFile(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	for i := 0; i < 3; i++ {
+		testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	}
+	snapshotIDs := testListSnapshots(t, env.gopts, 3)
+
+	filename := filepath.Join(env.base, "snapshots.txt")
+	writeFile := func(lines ...string) {
+		rtest.OK(t, os.WriteFile(filename, []byte(strings.Join(lines, "\n")+"\n"), 0644))
+	}
+	forget := func(opts ForgetOptions) (string, error) {
+		opts.SnapshotFile = filename
+		buf, err := withCaptureStdout(func() error {
+			return runForget(context.TODO(), opts, env.gopts, nil)
+		})
+		return buf.String(), err
+	}
+
+	// a full ID, a prefix, a comment and a missing ID
+	missing := restic.NewRandomID().String()
+	writeFile(
+		"# snapshots to remove",
+		snapshotIDs[0].String(),
+		"",
+		"  "+snapshotIDs[1].String()[:12]+"  ",
+		missing,
+	)
+
+	// nothing is removed if a snapshot cannot be resolved
+	_, err := forget(ForgetOptions{})
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "1 of 3 snapshots listed"), "unexpected error %v", err)
+	testListSnapshots(t, env.gopts, 3)
+
+	// a dry run does not remove anything
+	out, err := forget(ForgetOptions{SkipMissing: true, DryRun: true})
+	rtest.OK(t, err)
+	rtest.Assert(t, strings.Contains(out, "2 snapshots would be removed, 0 pinned snapshots kept, 1 snapshots could not be resolved"), "unexpected output %q", out)
+	testListSnapshots(t, env.gopts, 3)
+
+	out, err = forget(ForgetOptions{SkipMissing: true})
+	rtest.OK(t, err)
+	rtest.Assert(t, strings.Contains(out, "2 snapshots removed, 0 pinned snapshots kept, 1 snapshots could not be resolved"), "unexpected output %q", out)
+	rtest.Equals(t, restic.IDs{snapshotIDs[2]}, testListSnapshots(t, env.gopts, 1))
+
+	// removed snapshots are now missing as well
+	writeFile(snapshotIDs[0].String(), snapshotIDs[2].String())
+	_, err = forget(ForgetOptions{})
+	rtest.Assert(t, err != nil, "expected error for removed snapshot")
+	testListSnapshots(t, env.gopts, 1)
+
+	// skip-missing is only valid with a snapshot file
+	err = runForget(context.TODO(), ForgetOptions{SkipMissing: true}, env.gopts, nil)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "--skip-missing requires --snapshot-file"), "unexpected error %v", err)
+}
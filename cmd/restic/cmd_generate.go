@@ -1,11 +1,16 @@
 package main
 
 import (
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/restic/restic/internal/errors"
 	"github.com/spf13/cobra"
 	"github.com/spf13/cobra/doc"
+	"github.com/spf13/pflag"
 )
 
 var cmdGenerate = &cobra.Command{
@@ -13,7 +18,9 @@ var cmdGenerate = &cobra.Command{
 	Short: "Generate manual pages and auto-completion files (bash, fish, zsh, powershell)",
 	Long: `
 The "generate" command writes automatically generated files (like the man pages
-and the auto-completion files for bash, fish and zsh).
+and the auto-completion files for bash, fish and zsh). It can also write a
+machine-readable description of all commands and their flags in JSON format.
+Pass "-" as the file name to write the output to stdout.
 
 EXIT STATUS
 ===========
@@ -21,7 +28,9 @@ EXIT STATUS
 Exit status is 0 if the command was successful, and non-zero if there was any error.
 `,
 	DisableAutoGenTag: true,
-	RunE:              runGenerate,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runGenerate(genOpts, globalOptions, args)
+	},
 }
 
 type generateOptions struct {
@@ -30,6 +39,7 @@ type generateOptions struct {
 	FishCompletionFile       string
 	ZSHCompletionFile        string
 	PowerShellCompletionFile string
+	JSONSchemaFile           string
 }
 
 var genOpts generateOptions
@@ -42,6 +52,7 @@ func init() {
 	fs.StringVar(&genOpts.FishCompletionFile, "fish-completion", "", "write fish completion `file`")
 	fs.StringVar(&genOpts.ZSHCompletionFile, "zsh-completion", "", "write zsh completion `file`")
 	fs.StringVar(&genOpts.PowerShellCompletionFile, "powershell-completion", "", "write powershell completion `file`")
+	fs.StringVar(&genOpts.JSONSchemaFile, "json-schema", "", "write a description of all commands and flags in JSON format to `file`")
 }
 
 func writeManpages(dir string) error {
@@ -62,77 +73,181 @@ func writeManpages(dir string) error {
 	return doc.GenManTree(cmdRoot, header, dir)
 }
 
-func writeBashCompletion(file string) error {
-	if stdoutIsTerminal() {
+// writeGeneratedFile creates file and calls gen to write the content. If file
+// is "-", the content is written to stdout instead.
+func writeGeneratedFile(gopts GlobalOptions, file string, gen func(w io.Writer) error) error {
+	if file == "-" {
+		return gen(gopts.stdout)
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+
+	err = gen(f)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func writeBashCompletion(gopts GlobalOptions, file string) error {
+	if stdoutIsTerminal() && file != "-" {
 		Verbosef("writing bash completion file to %v\n", file)
 	}
-	return cmdRoot.GenBashCompletionFile(file)
+	return writeGeneratedFile(gopts, file, cmdRoot.GenBashCompletion)
 }
 
-func writeFishCompletion(file string) error {
-	if stdoutIsTerminal() {
+func writeFishCompletion(gopts GlobalOptions, file string) error {
+	if stdoutIsTerminal() && file != "-" {
 		Verbosef("writing fish completion file to %v\n", file)
 	}
-	return cmdRoot.GenFishCompletionFile(file, true)
+	return writeGeneratedFile(gopts, file, func(w io.Writer) error {
+		return cmdRoot.GenFishCompletion(w, true)
+	})
 }
 
-func writeZSHCompletion(file string) error {
-	if stdoutIsTerminal() {
+func writeZSHCompletion(gopts GlobalOptions, file string) error {
+	if stdoutIsTerminal() && file != "-" {
 		Verbosef("writing zsh completion file to %v\n", file)
 	}
-	return cmdRoot.GenZshCompletionFile(file)
+	return writeGeneratedFile(gopts, file, cmdRoot.GenZshCompletion)
 }
 
-func writePowerShellCompletion(file string) error {
-	if stdoutIsTerminal() {
+func writePowerShellCompletion(gopts GlobalOptions, file string) error {
+	if stdoutIsTerminal() && file != "-" {
 		Verbosef("writing powershell completion file to %v\n", file)
 	}
-	return cmdRoot.GenPowerShellCompletionFile(file)
+	return writeGeneratedFile(gopts, file, cmdRoot.GenPowerShellCompletion)
+}
+
+// commandSchema describes a command and its subcommands for --json-schema.
+type commandSchema struct {
+	Name     string          `json:"name"`
+	Path     string          `json:"path"`
+	Usage    string          `json:"usage"`
+	Aliases  []string        `json:"aliases,omitempty"`
+	Short    string          `json:"short"`
+	Long     string          `json:"long,omitempty"`
+	Flags    []flagSchema    `json:"flags"`
+	Commands []commandSchema `json:"commands,omitempty"`
+}
+
+// flagSchema describes a single flag. Global flags are defined on the root
+// command and are accepted by all commands.
+type flagSchema struct {
+	Name      string `json:"name"`
+	Shorthand string `json:"shorthand,omitempty"`
+	Type      string `json:"type"`
+	Default   string `json:"default"`
+	Usage     string `json:"usage"`
+	Global    bool   `json:"global,omitempty"`
+}
+
+func newCommandSchema(cmd *cobra.Command) commandSchema {
+	schema := commandSchema{
+		Name:    cmd.Name(),
+		Path:    cmd.CommandPath(),
+		Usage:   cmd.UseLine(),
+		Aliases: cmd.Aliases,
+		Short:   cmd.Short,
+		Long:    strings.TrimSpace(cmd.Long),
+		Flags:   []flagSchema{},
+	}
+
+	global := !cmd.HasParent()
+	cmd.LocalFlags().VisitAll(func(f *pflag.Flag) {
+		if f.Hidden || f.Deprecated != "" {
+			return
+		}
+		schema.Flags = append(schema.Flags, flagSchema{
+			Name:      f.Name,
+			Shorthand: f.Shorthand,
+			Type:      f.Value.Type(),
+			Default:   f.DefValue,
+			Usage:     f.Usage,
+			Global:    global && cmd.PersistentFlags().Lookup(f.Name) != nil,
+		})
+	})
+
+	for _, sub := range cmd.Commands() {
+		if !sub.IsAvailableCommand() || sub.IsAdditionalHelpTopicCommand() {
+			continue
+		}
+		schema.Commands = append(schema.Commands, newCommandSchema(sub))
+	}
+
+	return schema
 }
 
-func runGenerate(_ *cobra.Command, args []string) error {
+func writeJSONSchema(gopts GlobalOptions, file string) error {
+	if stdoutIsTerminal() && file != "-" {
+		Verbosef("writing JSON schema to %v\n", file)
+	}
+	return writeGeneratedFile(gopts, file, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(newCommandSchema(cmdRoot))
+	})
+}
+
+func runGenerate(opts generateOptions, gopts GlobalOptions, args []string) error {
 	if len(args) > 0 {
-		return errors.Fatal("the generate command expects no arguments, only options - please see `restic help generate` for usage and flags")
+		return invalidArguments(errors.Fatal("the generate command expects no arguments, only options - please see `restic help generate` for usage and flags"))
+	}
+
+	if opts.ManDir == "-" {
+		return invalidArgumentsf("man pages cannot be written to stdout, please specify a directory")
+	}
+
+	if opts.ManDir != "" {
+		err := writeManpages(opts.ManDir)
+		if err != nil {
+			return err
+		}
 	}
 
-	if genOpts.ManDir != "" {
-		err := writeManpages(genOpts.ManDir)
+	if opts.BashCompletionFile != "" {
+		err := writeBashCompletion(gopts, opts.BashCompletionFile)
 		if err != nil {
 			return err
 		}
 	}
 
-	if genOpts.BashCompletionFile != "" {
-		err := writeBashCompletion(genOpts.BashCompletionFile)
+	if opts.FishCompletionFile != "" {
+		err := writeFishCompletion(gopts, opts.FishCompletionFile)
 		if err != nil {
 			return err
 		}
 	}
 
-	if genOpts.FishCompletionFile != "" {
-		err := writeFishCompletion(genOpts.FishCompletionFile)
+	if opts.ZSHCompletionFile != "" {
+		err := writeZSHCompletion(gopts, opts.ZSHCompletionFile)
 		if err != nil {
 			return err
 		}
 	}
 
-	if genOpts.ZSHCompletionFile != "" {
-		err := writeZSHCompletion(genOpts.ZSHCompletionFile)
+	if opts.PowerShellCompletionFile != "" {
+		err := writePowerShellCompletion(gopts, opts.PowerShellCompletionFile)
 		if err != nil {
 			return err
 		}
 	}
 
-	if genOpts.PowerShellCompletionFile != "" {
-		err := writePowerShellCompletion(genOpts.PowerShellCompletionFile)
+	if opts.JSONSchemaFile != "" {
+		err := writeJSONSchema(gopts, opts.JSONSchemaFile)
 		if err != nil {
 			return err
 		}
 	}
 
 	var empty generateOptions
-	if genOpts == empty {
-		return errors.Fatal("nothing to do, please specify at least one output file/dir")
+	if opts == empty {
+		return invalidArguments(errors.Fatal("nothing to do, please specify at least one output file/dir"))
 	}
 
 	return nil
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestGenerateCompletion(t *testing.T) {
+	dir := t.TempDir()
+	opts := generateOptions{
+		BashCompletionFile: filepath.Join(dir, "restic.bash"),
+		FishCompletionFile: filepath.Join(dir, "restic.fish"),
+		ZSHCompletionFile:  filepath.Join(dir, "_restic"),
+	}
+	rtest.OK(t, runGenerate(opts, globalOptions, nil))
+
+	for _, file := range []string{opts.BashCompletionFile, opts.FishCompletionFile, opts.ZSHCompletionFile} {
+		data, err := os.ReadFile(file)
+		rtest.OK(t, err)
+		rtest.Assert(t, bytes.Contains(data, []byte("restic")), "completion file %v does not mention restic", file)
+	}
+
+	// write to stdout
+	buf := &bytes.Buffer{}
+	gopts := globalOptions
+	gopts.stdout = buf
+	rtest.OK(t, runGenerate(generateOptions{BashCompletionFile: "-"}, gopts, nil))
+	rtest.Assert(t, strings.Contains(buf.String(), "__start_restic"), "unexpected bash completion on stdout: %q", buf.String())
+}
+
+func TestGenerateManpages(t *testing.T) {
+	dir := t.TempDir()
+	rtest.OK(t, runGenerate(generateOptions{ManDir: dir}, globalOptions, nil))
+
+	for _, name := range []string{"restic.1", "restic-backup.1", "restic-generate.1"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		rtest.OK(t, err)
+		rtest.Assert(t, len(data) > 0, "man page %v is empty", name)
+	}
+
+	err := runGenerate(generateOptions{ManDir: "-"}, globalOptions, nil)
+	rtest.Assert(t, isInvalidArguments(err), "expected invalid arguments error, got %v", err)
+}
+
+func findCommandSchema(schema commandSchema, name string) *commandSchema {
+	for i := range schema.Commands {
+		if schema.Commands[i].Name == name {
+			return &schema.Commands[i]
+		}
+	}
+	return nil
+}
+
+func findFlagSchema(schema *commandSchema, name string) *flagSchema {
+	for i := range schema.Flags {
+		if schema.Flags[i].Name == name {
+			return &schema.Flags[i]
+		}
+	}
+	return nil
+}
+
+func TestGenerateJSONSchema(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "restic.json")
+	rtest.OK(t, runGenerate(generateOptions{JSONSchemaFile: file}, globalOptions, nil))
+
+	data, err := os.ReadFile(file)
+	rtest.OK(t, err)
+
+	var schema commandSchema
+	rtest.OK(t, json.Unmarshal(data, &schema))
+	rtest.Equals(t, "restic", schema.Name)
+
+	repo := findFlagSchema(&schema, "repo")
+	rtest.Assert(t, repo != nil, "global flag --repo not found")
+	rtest.Equals(t, "r", repo.Shorthand)
+	rtest.Equals(t, "string", repo.Type)
+	rtest.Assert(t, repo.Global, "flag --repo is not marked as global")
+
+	backup := findCommandSchema(schema, "backup")
+	rtest.Assert(t, backup != nil, "command backup not found")
+	rtest.Equals(t, "restic backup", backup.Path)
+	rtest.Assert(t, backup.Short != "" && backup.Long != "", "help text for backup is missing")
+
+	dryRun := findFlagSchema(backup, "dry-run")
+	rtest.Assert(t, dryRun != nil, "flag --dry-run for backup not found")
+	rtest.Equals(t, "bool", dryRun.Type)
+	rtest.Equals(t, "false", dryRun.Default)
+	rtest.Assert(t, !dryRun.Global, "flag --dry-run is marked as global")
+
+	rtest.Assert(t, findCommandSchema(schema, "generate") != nil, "command generate not found")
+	rtest.Assert(t, findCommandSchema(schema, "help") == nil, "help command must not be included")
+
+	// write to stdout
+	buf := &bytes.Buffer{}
+	gopts := globalOptions
+	gopts.stdout = buf
+	rtest.OK(t, runGenerate(generateOptions{JSONSchemaFile: "-"}, gopts, nil))
+	rtest.Equals(t, string(data), buf.String())
+}
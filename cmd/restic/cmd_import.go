@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/restic/chunker"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+)
+
+var cmdImport = &cobra.Command{
+	Use:   "import [flags] FILE",
+	Short: "Import a snapshot from a file created by export",
+	Long: `
+The "import" command loads a snapshot which was written to a file using the
+"export" command into the repository. The blobs contained in the file are
+stored in new pack files, afterwards the snapshot is saved. All blobs referenced
+by the snapshot which are not part of the file must already exist in the
+repository, otherwise the import fails before the snapshot is saved.
+
+Data blobs can only be deduplicated against existing data if both repositories
+use the same chunker parameters. If they differ, the import is refused unless
+"--rechunk" is specified. In that case the content of all files is split into
+chunks using the chunker parameters of this repository, which requires reading
+the file multiple times.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful, and non-zero if there was any error.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runImport(cmd.Context(), importOptions, globalOptions, args)
+	},
+}
+
+// ImportOptions collects all options for the import command.
+type ImportOptions struct {
+	StreamPasswordFile string
+	Rechunk            bool
+}
+
+var importOptions ImportOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdImport)
+
+	f := cmdImport.Flags()
+	f.StringVar(&importOptions.StreamPasswordFile, "stream-password-file", "", "`file` to read the password for the export file from")
+	f.BoolVar(&importOptions.Rechunk, "rechunk", false, "split files into chunks using the chunker parameters of this repository")
+}
+
+func runImport(ctx context.Context, opts ImportOptions, gopts GlobalOptions, args []string) error {
+	if len(args) != 1 {
+		return invalidArguments(errors.Fatal("no file to import specified"))
+	}
+	if err := checkReadOnly(gopts, "import"); err != nil {
+		return err
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return errors.Fatalf("unable to open export file: %v", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	repo, err := OpenRepository(ctx, gopts)
+	if err != nil {
+		return err
+	}
+
+	lock, ctx, err := lockRepo(ctx, repo, gopts.RetryLock, gopts.JSON)
+	defer unlockRepo(lock)
+	if err != nil {
+		return err
+	}
+
+	if err = repo.LoadIndex(ctx); err != nil {
+		return err
+	}
+
+	password, err := getStreamPassword(gopts, opts.StreamPasswordFile, false)
+	if err != nil {
+		return err
+	}
+
+	rd, err := repository.NewExportReader(f, password)
+	if err != nil {
+		return errors.Fatalf("unable to read export file: %v", err)
+	}
+	manifest := rd.Manifest
+
+	rechunk := manifest.ChunkerPolynomial != repo.Config().ChunkerPolynomial
+	if rechunk && !opts.Rechunk {
+		return errors.Fatal("the chunker parameters of the export differ from this repository, use --rechunk to split files into new chunks")
+	}
+
+	Verbosef("importing snapshot %v with %d blobs\n", manifest.SnapshotID.Str(), len(manifest.Blobs))
+
+	treeID := *manifest.Snapshot.Tree
+	wg, wgCtx := errgroup.WithContext(ctx)
+	repo.StartPackUploader(wgCtx, wg)
+	wg.Go(func() error {
+		var err error
+		if rechunk {
+			treeID, err = importRechunked(wgCtx, repo, rd, f)
+		} else {
+			err = importBlobs(wgCtx, repo, rd)
+		}
+		if err != nil {
+			return err
+		}
+		return repo.Flush(wgCtx)
+	})
+	if err = wg.Wait(); err != nil {
+		return errors.Fatalf("import failed: %v", err)
+	}
+
+	// make sure the snapshot is complete before saving it
+	blobs := restic.NewBlobSet()
+	err = restic.FindUsedBlobs(ctx, repo, restic.IDs{treeID}, blobs, nil)
+	if err != nil {
+		return errors.Fatalf("snapshot is incomplete: %v", err)
+	}
+	for h := range blobs {
+		if !repo.Index().Has(h) {
+			return errors.Fatalf("snapshot is incomplete: blob %v is missing", h)
+		}
+	}
+
+	sn := manifest.Snapshot
+	sn.Tree = &treeID
+	// Parent does not have relevance in the new repo.
+	sn.Parent = nil
+	if sn.Original == nil {
+		sn.Original = &manifest.SnapshotID
+	}
+	// the key IDs of the exporting repository are meaningless here
+	keyID := repo.KeyID()
+	sn.KeyID = &keyID
+	id, err := restic.SaveSnapshot(ctx, repo, sn)
+	if err != nil {
+		return errors.Fatalf("unable to save snapshot: %v", err)
+	}
+
+	Verbosef("snapshot %s saved\n", id.Str())
+	return nil
+}
+
+// importBlobs saves all blobs of the export which do not exist yet.
+func importBlobs(ctx context.Context, repo restic.Repository, rd *repository.ExportReader) error {
+	var buf []byte
+	var imported int
+	for {
+		h, _, data, err := rd.Next(buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		buf = data
+
+		_, known, _, err := repo.SaveBlob(ctx, h.Type, data, h.ID, false)
+		if err != nil {
+			return err
+		}
+		if !known {
+			imported++
+		}
+	}
+
+	Verbosef("imported %d new blobs\n", imported)
+	return nil
+}
+
+// importRechunked rewrites the snapshot tree from the export, splitting all
+// files into chunks using the chunker polynomial of repo. It returns the ID
+// of the new tree.
+func importRechunked(ctx context.Context, repo restic.Repository, rd *repository.ExportReader, ra io.ReaderAt) (restic.ID, error) {
+	loader := &exportBlobLoader{
+		Repository: repo,
+		rd:         rd,
+		ra:         ra,
+		offsets:    make(map[restic.BlobHandle]int64),
+	}
+
+	// remember where each blob is stored, this also verifies the whole export
+	var buf []byte
+	for {
+		h, offset, data, err := rd.Next(buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return restic.ID{}, err
+		}
+		buf = data
+		loader.offsets[h] = offset
+	}
+
+	rc := &rechunker{
+		loader:  loader,
+		repo:    repo,
+		pol:     repo.Config().ChunkerPolynomial,
+		chunker: chunker.New(nil, repo.Config().ChunkerPolynomial),
+		trees:   make(map[restic.ID]restic.ID),
+	}
+	return rc.rewriteTree(ctx, *rd.Manifest.Snapshot.Tree)
+}
+
+// exportBlobLoader loads blobs from an export file and falls back to the
+// repository for blobs not contained in the export.
+type exportBlobLoader struct {
+	restic.Repository
+	rd      *repository.ExportReader
+	ra      io.ReaderAt
+	offsets map[restic.BlobHandle]int64
+}
+
+func (l *exportBlobLoader) LoadBlob(ctx context.Context, t restic.BlobType, id restic.ID, buf []byte) ([]byte, error) {
+	if offset, ok := l.offsets[restic.BlobHandle{Type: t, ID: id}]; ok {
+		_, data, err := l.rd.ReadBlobAt(l.ra, offset, buf)
+		return data, err
+	}
+	return l.Repository.LoadBlob(ctx, t, id, buf)
+}
+
+type rechunker struct {
+	loader  *exportBlobLoader
+	repo    restic.Repository
+	pol     chunker.Pol
+	chunker *chunker.Chunker
+	buf     []byte
+
+	// trees maps the IDs of already rewritten trees to their new ID
+	trees map[restic.ID]restic.ID
+}
+
+func (rc *rechunker) rewriteTree(ctx context.Context, id restic.ID) (restic.ID, error) {
+	if newID, ok := rc.trees[id]; ok {
+		return newID, nil
+	}
+
+	tree, err := restic.LoadTree(ctx, rc.loader, id)
+	if err != nil {
+		return restic.ID{}, err
+	}
+
+	for _, node := range tree.Nodes {
+		switch node.Type {
+		case "dir":
+			if node.Subtree == nil {
+				return restic.ID{}, errors.Errorf("dir %q has no subtree", node.Name)
+			}
+			subtree, err := rc.rewriteTree(ctx, *node.Subtree)
+			if err != nil {
+				return restic.ID{}, err
+			}
+			node.Subtree = &subtree
+		case "file":
+			node.Content, err = rc.rechunkFile(ctx, node.Content)
+			if err != nil {
+				return restic.ID{}, errors.Wrapf(err, "file %q", node.Name)
+			}
+		}
+	}
+
+	newID, err := restic.SaveTree(ctx, rc.repo, tree)
+	if err != nil {
+		return restic.ID{}, err
+	}
+	rc.trees[id] = newID
+	return newID, nil
+}
+
+func (rc *rechunker) rechunkFile(ctx context.Context, content restic.IDs) (restic.IDs, error) {
+	rc.chunker.Reset(&blobsReader{ctx: ctx, loader: rc.loader, ids: content}, rc.pol)
+
+	ids := restic.IDs{}
+	for {
+		chunk, err := rc.chunker.Next(rc.buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		rc.buf = chunk.Data
+
+		id, _, _, err := rc.repo.SaveBlob(ctx, restic.DataBlob, chunk.Data, restic.ID{}, false)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// blobsReader returns the concatenated content of a list of data blobs.
+type blobsReader struct {
+	ctx    context.Context
+	loader restic.BlobLoader
+	ids    restic.IDs
+	buf    []byte
+	rest   []byte
+}
+
+func (r *blobsReader) Read(p []byte) (int, error) {
+	for len(r.rest) == 0 {
+		if len(r.ids) == 0 {
+			return 0, io.EOF
+		}
+
+		var err error
+		r.buf, err = r.loader.LoadBlob(r.ctx, restic.DataBlob, r.ids[0], r.buf)
+		if err != nil {
+			return 0, err
+		}
+		r.rest = r.buf
+		r.ids = r.ids[1:]
+	}
+
+	n := copy(p, r.rest)
+	r.rest = r.rest[n:]
+	return n, nil
+}
@@ -3,7 +3,9 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/restic/chunker"
 	"github.com/restic/restic/internal/backend/location"
@@ -36,6 +38,7 @@ type InitOptions struct {
 	secondaryRepoOptions
 	CopyChunkerParameters bool
 	RepositoryVersion     string
+	ForceInit             bool
 }
 
 var initOptions InitOptions
@@ -47,11 +50,16 @@ func init() {
 	initSecondaryRepoOptions(f, &initOptions.secondaryRepoOptions, "secondary", "to copy chunker parameters from")
 	f.BoolVar(&initOptions.CopyChunkerParameters, "copy-chunker-params", false, "copy chunker parameters from the secondary repository (useful with the copy command)")
 	f.StringVar(&initOptions.RepositoryVersion, "repository-version", "stable", "repository format version to use, allowed values are a format version, 'latest' and 'stable'")
+	f.BoolVar(&initOptions.ForceInit, "force-init", false, "initialize the repository even if the location already contains repository files (dangerous)")
 }
 
 func runInit(ctx context.Context, opts InitOptions, gopts GlobalOptions, args []string) error {
 	if len(args) > 0 {
-		return errors.Fatal("the init command expects no arguments, only options - please see `restic help init` for usage and flags")
+		return invalidArguments(errors.Fatal("the init command expects no arguments, only options - please see `restic help init` for usage and flags"))
+	}
+
+	if err := checkReadOnly(gopts, "init"); err != nil {
+		return err
 	}
 
 	var version uint
@@ -62,7 +70,7 @@ func runInit(ctx context.Context, opts InitOptions, gopts GlobalOptions, args []
 	} else {
 		v, err := strconv.ParseUint(opts.RepositoryVersion, 10, 32)
 		if err != nil {
-			return errors.Fatal("invalid repository version")
+			return invalidArguments(errors.Fatal("invalid repository version"))
 		}
 		version = uint(v)
 	}
@@ -92,6 +100,15 @@ func runInit(ctx context.Context, opts InitOptions, gopts GlobalOptions, args []
 		return errors.Fatalf("create repository at %s failed: %v\n", location.StripPassword(gopts.backends, gopts.Repo), err)
 	}
 
+	if opts.ForceInit {
+		Warnf("--force-init specified, not checking whether the location already contains repository files\n")
+	} else {
+		err = checkRepositoryLocationEmpty(ctx, be)
+		if err != nil {
+			return errors.Fatalf("create repository at %s failed: %v\n", location.StripPassword(gopts.backends, gopts.Repo), err)
+		}
+	}
+
 	s, err := repository.New(be, repository.Options{
 		Compression: gopts.Compression,
 		PackSize:    gopts.PackSize * 1024 * 1024,
@@ -104,6 +121,7 @@ func runInit(ctx context.Context, opts InitOptions, gopts GlobalOptions, args []
 	if err != nil {
 		return errors.Fatalf("create key in repository at %s failed: %v\n", location.StripPassword(gopts.backends, gopts.Repo), err)
 	}
+	recordRepository(s.Config().ID)
 
 	if !gopts.JSON {
 		Verbosef("created restic repository %v at %s", s.Config().ID[:10], location.StripPassword(gopts.backends, gopts.Repo))
@@ -146,11 +164,36 @@ func maybeReadChunkerPolynomial(ctx context.Context, opts InitOptions, gopts Glo
 	}
 
 	if opts.Repo != "" || opts.RepositoryFile != "" || opts.LegacyRepo != "" || opts.LegacyRepositoryFile != "" {
-		return nil, errors.Fatal("Secondary repository must only be specified when copying the chunker parameters")
+		return nil, invalidArguments(errors.Fatal("Secondary repository must only be specified when copying the chunker parameters"))
 	}
 	return nil, nil
 }
 
+// errLocationNotEmpty stops listing a file type after the first file.
+var errLocationNotEmpty = errors.New("location not empty")
+
+// checkRepositoryLocationEmpty returns an error if be already contains keys,
+// snapshots, indexes or pack files, for example from another repository.
+// Writing a new config next to them would result in a repository which mixes
+// data encrypted with different keys.
+func checkRepositoryLocationEmpty(ctx context.Context, be restic.Backend) error {
+	var found []string
+	for _, t := range []restic.FileType{restic.KeyFile, restic.SnapshotFile, restic.IndexFile, restic.PackFile} {
+		err := be.List(ctx, t, func(fi restic.FileInfo) error {
+			found = append(found, fmt.Sprintf("%v file %v", t, fi.Name))
+			return errLocationNotEmpty
+		})
+		if err != nil && !errors.Is(err, errLocationNotEmpty) {
+			return errors.Wrapf(err, "listing %v files", t)
+		}
+	}
+
+	if len(found) > 0 {
+		return errors.Errorf("the location already contains files, found %v. Use --force-init to initialize a repository anyway", strings.Join(found, ", "))
+	}
+	return nil
+}
+
 type initSuccess struct {
 	MessageType string `json:"message_type"` // "initialized"
 	ID          string `json:"id"`
@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/restic/restic/internal/repository"
@@ -47,3 +50,50 @@ func TestInitCopyChunkerParams(t *testing.T) {
 		"expected equal chunker polynomials, got %v expected %v", repo.Config().ChunkerPolynomial,
 		otherRepo.Config().ChunkerPolynomial)
 }
+
+func TestInitNonEmptyLocation(t *testing.T) {
+	testInitFails := func(t testing.TB, gopts GlobalOptions, found string) {
+		err := runInit(context.TODO(), InitOptions{}, gopts, nil)
+		rtest.Assert(t, err != nil && strings.Contains(err.Error(), found),
+			"expected init to fail with %q, got %v", found, err)
+	}
+
+	t.Run("existing-repository", func(t *testing.T) {
+		env, cleanup := withTestEnvironment(t)
+		defer cleanup()
+
+		testRunInit(t, env.gopts)
+		testInitFails(t, env.gopts, "config file already exists")
+
+		// without a config, the keys of the existing repository are found
+		rtest.OK(t, os.Remove(filepath.Join(env.repo, "config")))
+		testInitFails(t, env.gopts, "key file ")
+	})
+
+	t.Run("stray-files", func(t *testing.T) {
+		env, cleanup := withTestEnvironment(t)
+		defer cleanup()
+
+		rtest.OK(t, os.MkdirAll(filepath.Join(env.repo, "data", "00"), 0700))
+		rtest.OK(t, os.WriteFile(filepath.Join(env.repo, "data", "00", "unrelated"), []byte("foo"), 0600))
+		testInitFails(t, env.gopts, "data file unrelated")
+
+		// files outside of the repository directories are ignored
+		env2, cleanup2 := withTestEnvironment(t)
+		defer cleanup2()
+		rtest.OK(t, os.MkdirAll(env2.repo, 0700))
+		rtest.OK(t, os.WriteFile(filepath.Join(env2.repo, "README"), []byte("foo"), 0600))
+		testRunInit(t, env2.gopts)
+	})
+
+	t.Run("force", func(t *testing.T) {
+		env, cleanup := withTestEnvironment(t)
+		defer cleanup()
+
+		rtest.OK(t, os.MkdirAll(filepath.Join(env.repo, "snapshots"), 0700))
+		rtest.OK(t, os.WriteFile(filepath.Join(env.repo, "snapshots", "unrelated"), []byte("foo"), 0600))
+		rtest.OK(t, runInit(context.TODO(), InitOptions{ForceInit: true}, env.gopts, nil))
+		_, err := OpenRepository(context.TODO(), env.gopts)
+		rtest.OK(t, err)
+	})
+}
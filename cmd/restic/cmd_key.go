@@ -21,6 +21,8 @@ var cmdKey = &cobra.Command{
 	Long: `
 The "key" command manages keys (passwords) for accessing the repository.
 
+With "--dry-run", "key remove" only prints the key which would be removed.
+
 EXIT STATUS
 ===========
 
@@ -36,6 +38,8 @@ var (
 	newPasswordFile string
 	keyUsername     string
 	keyHostname     string
+	keyForce        bool
+	keyDryRun       bool
 )
 
 func init() {
@@ -45,6 +49,8 @@ func init() {
 	flags.StringVarP(&newPasswordFile, "new-password-file", "", "", "`file` from which to read the new password")
 	flags.StringVarP(&keyUsername, "user", "", "", "the username for new keys")
 	flags.StringVarP(&keyHostname, "host", "", "", "the hostname for new keys")
+	flags.BoolVarP(&keyForce, "force", "", false, "allow removing the key currently used to access the repository")
+	flags.BoolVarP(&keyDryRun, "dry-run", "n", false, "do not remove the key, just print what would be done (only for remove)")
 }
 
 func listKeys(ctx context.Context, s *repository.Repository, gopts GlobalOptions) error {
@@ -88,6 +94,8 @@ func listKeys(ctx context.Context, s *repository.Repository, gopts GlobalOptions
 		return json.NewEncoder(globalOptions.stdout).Encode(keys)
 	}
 
+	Printf("repository %v\n\n", s.Config().ID)
+
 	tab := table.New()
 	tab.AddColumn(" ID", "{{if .Current}}*{{else}} {{end}}{{ .ID }}")
 	tab.AddColumn("User", "{{ .UserName }}")
@@ -144,13 +152,43 @@ func addKey(ctx context.Context, repo *repository.Repository, gopts GlobalOption
 	return nil
 }
 
-func deleteKey(ctx context.Context, repo *repository.Repository, id restic.ID) error {
-	if id == repo.KeyID() {
-		return errors.Fatal("refusing to remove key currently used to access repository")
+func deleteKey(ctx context.Context, repo *repository.Repository, id restic.ID, force, dryRun bool) error {
+	if id == repo.KeyID() && !force {
+		return errors.Fatal("refusing to remove key currently used to access repository, use --force to remove it anyway")
+	}
+
+	// the list of keys may have changed since the repository was opened, thus
+	// check against the current list in the backend
+	found, otherKeys := false, false
+	err := repo.Backend().List(ctx, restic.KeyFile, func(fi restic.FileInfo) error {
+		if fi.Name == id.String() {
+			found = true
+		} else {
+			otherKeys = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errors.Fatalf("key %v does not exist", id.Str())
+	}
+	if !otherKeys {
+		return errors.Fatal("refusing to remove the last key of the repository")
+	}
+
+	if dryRun {
+		k, err := repository.LoadKey(ctx, repo, id)
+		if err != nil {
+			return err
+		}
+		printDryRun("remove key %v of %v@%v, created at %v", id.Str(), k.Username, k.Hostname, k.Created.Local().Format(TimeFormat))
+		return nil
 	}
 
 	h := restic.Handle{Type: restic.KeyFile, Name: id.String()}
-	err := repo.Backend().Remove(ctx, h)
+	err = repo.Backend().Remove(ctx, h)
 	if err != nil {
 		return err
 	}
@@ -202,7 +240,24 @@ func switchToNewKeyAndRemoveIfBroken(ctx context.Context, repo *repository.Repos
 
 func runKey(ctx context.Context, gopts GlobalOptions, args []string) error {
 	if len(args) < 1 || (args[0] == "remove" && len(args) != 2) || (args[0] != "remove" && len(args) != 1) {
-		return errors.Fatal("wrong number of arguments")
+		return invalidArguments(errors.Fatal("wrong number of arguments"))
+	}
+	if keyDryRun && args[0] != "remove" {
+		return invalidArguments(errors.Fatal("--dry-run is only supported by key remove"))
+	}
+
+	// a dry run does not modify the repository
+	if !keyDryRun {
+		if args[0] == "remove" || args[0] == "passwd" {
+			if err := checkAppendOnly(gopts, "key "+args[0]); err != nil {
+				return err
+			}
+		}
+		if args[0] != "list" {
+			if err := checkReadOnly(gopts, "key "+args[0]); err != nil {
+				return err
+			}
+		}
 	}
 
 	repo, err := OpenRepository(ctx, gopts)
@@ -212,15 +267,18 @@ func runKey(ctx context.Context, gopts GlobalOptions, args []string) error {
 
 	switch args[0] {
 	case "list":
-		lock, ctx, err := lockRepo(ctx, repo, gopts.RetryLock, gopts.JSON)
-		defer unlockRepo(lock)
-		if err != nil {
-			return err
+		if !gopts.NoLock {
+			var lock *restic.Lock
+			lock, ctx, err = lockRepo(ctx, repo, gopts.RetryLock, gopts.JSON)
+			defer unlockRepo(lock)
+			if err != nil {
+				return err
+			}
 		}
 
 		return listKeys(ctx, repo, gopts)
 	case "add":
-		lock, ctx, err := lockRepo(ctx, repo, gopts.RetryLock, gopts.JSON)
+		lock, ctx, err := lockRepoExclusive(ctx, repo, gopts.RetryLock, gopts.JSON)
 		defer unlockRepo(lock)
 		if err != nil {
 			return err
@@ -228,10 +286,14 @@ func runKey(ctx context.Context, gopts GlobalOptions, args []string) error {
 
 		return addKey(ctx, repo, gopts)
 	case "remove":
-		lock, ctx, err := lockRepoExclusive(ctx, repo, gopts.RetryLock, gopts.JSON)
-		defer unlockRepo(lock)
-		if err != nil {
-			return err
+		// creating a lock would modify the repository
+		if !keyDryRun {
+			var lock *restic.Lock
+			lock, ctx, err = lockRepoExclusive(ctx, repo, gopts.RetryLock, gopts.JSON)
+			defer unlockRepo(lock)
+			if err != nil {
+				return err
+			}
 		}
 
 		id, err := restic.Find(ctx, repo.Backend(), restic.KeyFile, args[1])
@@ -239,7 +301,7 @@ func runKey(ctx context.Context, gopts GlobalOptions, args []string) error {
 			return err
 		}
 
-		return deleteKey(ctx, repo, id)
+		return deleteKey(ctx, repo, id, keyForce, keyDryRun)
 	case "passwd":
 		lock, ctx, err := lockRepoExclusive(ctx, repo, gopts.RetryLock, gopts.JSON)
 		defer unlockRepo(lock)
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"context"
 	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/restic/restic/internal/repository"
@@ -143,3 +144,79 @@ func TestKeyProblems(t *testing.T) {
 	rtest.OK(t, runKey(context.TODO(), env.gopts, []string{"list"}))
 	testRunCheck(t, env.gopts)
 }
+
+func TestKeyRemoveGuards(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	// must list keys more than once
+	env.gopts.backendTestHook = nil
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+	defer func() {
+		keyForce = false
+	}()
+
+	repo, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+	firstKey := repo.KeyID().String()
+
+	// the last key must never be removed
+	keyForce = true
+	err = runKey(context.TODO(), env.gopts, []string{"remove", firstKey})
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "last key"), "expected last key error, got %v", err)
+	keyForce = false
+
+	testRunKeyAddNewKey(t, "geheim2", env.gopts)
+
+	// the key in use can only be removed with --force
+	err = runKey(context.TODO(), env.gopts, []string{"remove", firstKey})
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "currently used"), "expected in-use error, got %v", err)
+
+	keyForce = true
+	rtest.OK(t, runKey(context.TODO(), env.gopts, []string{"remove", firstKey}))
+	keyForce = false
+
+	env.gopts.password = "geheim2"
+	rtest.Equals(t, 0, len(testRunKeyListOtherIDs(t, env.gopts)))
+	testRunCheck(t, env.gopts)
+}
+
+func TestKeyRemoveDryRun(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	// must list keys more than once
+	env.gopts.backendTestHook = nil
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+	testRunKeyAddNewKey(t, "geheim2", env.gopts)
+	otherIDs := testRunKeyListOtherIDs(t, env.gopts)
+	rtest.Equals(t, 1, len(otherIDs))
+
+	be := &writeCountingBackend{}
+	gopts := env.gopts
+	gopts.backendTestHook = func(r restic.Backend) (restic.Backend, error) {
+		be.Backend = r
+		return be, nil
+	}
+	keyDryRun = true
+	defer func() {
+		keyDryRun = false
+	}()
+
+	buf, err := withCaptureStdout(func() error {
+		return runKey(context.TODO(), gopts, []string{"remove", otherIDs[0]})
+	})
+	rtest.OK(t, err)
+	rtest.Assert(t, strings.Contains(buf.String(), "would remove key "+otherIDs[0]),
+		"missing dry run output:\n%v", buf.String())
+
+	// the checks are run during a dry run
+	repo, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+	err = runKey(context.TODO(), gopts, []string{"remove", repo.KeyID().String()})
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "currently used"), "expected in-use error, got %v", err)
+	keyDryRun = false
+
+	rtest.Equals(t, int32(0), be.writes)
+	rtest.Equals(t, 1, len(testRunKeyListOtherIDs(t, env.gopts)))
+}
@@ -2,20 +2,31 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
 
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/index"
 	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
 
 	"github.com/spf13/cobra"
 )
 
 var cmdList = &cobra.Command{
-	Use:   "list [flags] [blobs|packs|index|snapshots|keys|locks]",
+	Use:   "list [flags] [blobs|packs|index|snapshots|keys|locks|all]",
 	Short: "List objects in the repository",
 	Long: `
 The "list" command allows listing objects in the repository based on type.
 
+With "list index --long", the number of packs and blobs contained in each index
+file is printed, as well as the index files it supersedes.
+
+With "--sizes", the size of each file is printed, followed by the number and
+the total size of the files of each type. Use the type "all" to list the files
+of every type.
+
 EXIT STATUS
 ===========
 
@@ -23,17 +34,29 @@ Exit status is 0 if the command was successful, and non-zero if there was any er
 `,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return runList(cmd.Context(), cmd, globalOptions, args)
+		return runList(cmd.Context(), cmd, listOptions, globalOptions, args)
 	},
 }
 
+// ListOptions collects all options for the list command.
+type ListOptions struct {
+	Long  bool
+	Sizes bool
+}
+
+var listOptions ListOptions
+
 func init() {
 	cmdRoot.AddCommand(cmdList)
+
+	f := cmdList.Flags()
+	f.BoolVarP(&listOptions.Long, "long", "l", false, "print the number of packs and blobs for each index file")
+	f.BoolVar(&listOptions.Sizes, "sizes", false, "print the size of each file and the totals per type")
 }
 
-func runList(ctx context.Context, cmd *cobra.Command, gopts GlobalOptions, args []string) error {
+func runList(ctx context.Context, cmd *cobra.Command, opts ListOptions, gopts GlobalOptions, args []string) error {
 	if len(args) != 1 {
-		return errors.Fatal("type not specified, usage: " + cmd.Use)
+		return invalidArguments(errors.Fatal("type not specified, usage: " + cmd.Use))
 	}
 
 	repo, err := OpenRepository(ctx, gopts)
@@ -41,7 +64,7 @@ func runList(ctx context.Context, cmd *cobra.Command, gopts GlobalOptions, args
 		return err
 	}
 
-	if !gopts.NoLock && args[0] != "locks" {
+	if !gopts.NoLock && args[0] != "locks" && args[0] != "all" {
 		var lock *restic.Lock
 		lock, ctx, err = lockRepo(ctx, repo, gopts.RetryLock, gopts.JSON)
 		defer unlockRepo(lock)
@@ -50,11 +73,24 @@ func runList(ctx context.Context, cmd *cobra.Command, gopts GlobalOptions, args
 		}
 	}
 
+	if opts.Long && args[0] != "index" {
+		return invalidArguments(errors.Fatal("--long is only supported for index files"))
+	}
+	if opts.Long && opts.Sizes {
+		return invalidArguments(errors.Fatal("--long and --sizes cannot be combined"))
+	}
+	if opts.Sizes {
+		return listSizes(ctx, repo, args[0], gopts.JSON)
+	}
+
 	var t restic.FileType
 	switch args[0] {
 	case "packs":
 		t = restic.PackFile
 	case "index":
+		if opts.Long {
+			return listIndexesLong(ctx, repo)
+		}
 		t = restic.IndexFile
 	case "snapshots":
 		t = restic.SnapshotFile
@@ -73,7 +109,7 @@ func runList(ctx context.Context, cmd *cobra.Command, gopts GlobalOptions, args
 			return nil
 		})
 	default:
-		return errors.Fatal("invalid type")
+		return invalidArguments(errors.Fatal("invalid type"))
 	}
 
 	return repo.List(ctx, t, func(id restic.ID, size int64) error {
@@ -81,3 +117,116 @@ func runList(ctx context.Context, cmd *cobra.Command, gopts GlobalOptions, args
 		return nil
 	})
 }
+
+// listIndexesLong prints the number of packs and blobs contained in each
+// index file and the index files it supersedes. The index files are decoded
+// one after another, so that only a few of them are kept in memory.
+func listIndexesLong(ctx context.Context, repo restic.Repository) error {
+	return index.ForAllIndexes(ctx, repo, func(id restic.ID, idx *index.Index, oldFormat bool, err error) error {
+		if err != nil {
+			return errors.Fatalf("unable to load index %v: %v", id.Str(), err)
+		}
+
+		blobs := 0
+		idx.Each(ctx, func(restic.PackedBlob) {
+			blobs++
+		})
+
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "%v %d packs %d blobs", id, len(idx.Packs()), blobs)
+		if oldFormat {
+			sb.WriteString(" (old format)")
+		}
+		if supersedes := idx.Supersedes(); len(supersedes) > 0 {
+			sb.WriteString(" supersedes")
+			for _, superseded := range supersedes {
+				sb.WriteString(" " + superseded.String())
+			}
+		}
+		Printf("%s\n", sb.String())
+		return nil
+	})
+}
+
+// listFileTypes contains the types of files which can be listed with their
+// sizes. "list all" follows this order, which lists snapshots before the index
+// and the packs as required by the repository read ordering.
+var listFileTypes = []struct {
+	name string
+	t    restic.FileType
+}{
+	{"snapshots", restic.SnapshotFile},
+	{"index", restic.IndexFile},
+	{"packs", restic.PackFile},
+	{"keys", restic.KeyFile},
+	{"locks", restic.LockFile},
+}
+
+type listSizesFile struct {
+	Type string    `json:"type"`
+	ID   restic.ID `json:"id"`
+	Size int64     `json:"size"`
+}
+
+type listSizesTotal struct {
+	Type  string `json:"type"`
+	Count int    `json:"count"`
+	Size  int64  `json:"size"`
+}
+
+type listSizesOutput struct {
+	Files  []listSizesFile  `json:"files"`
+	Totals []listSizesTotal `json:"totals"`
+}
+
+// listSizes prints the size of each file of type tpe, or of every type for
+// "all", followed by the number and the total size of the files per type.
+func listSizes(ctx context.Context, repo restic.Repository, tpe string, printJSON bool) error {
+	all := tpe == "all"
+	out := listSizesOutput{Files: []listSizesFile{}}
+
+	for _, ft := range listFileTypes {
+		if !all && ft.name != tpe {
+			continue
+		}
+
+		total := listSizesTotal{Type: ft.name}
+		err := repo.List(ctx, ft.t, func(id restic.ID, size int64) error {
+			total.Count++
+			total.Size += size
+			switch {
+			case printJSON:
+				out.Files = append(out.Files, listSizesFile{Type: ft.name, ID: id, Size: size})
+			case all:
+				Printf("%v %v %d\n", ft.name, id, size)
+			default:
+				Printf("%v %d\n", id, size)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		out.Totals = append(out.Totals, total)
+	}
+
+	if len(out.Totals) == 0 {
+		return invalidArguments(errors.Fatalf("--sizes is not supported for type %q", tpe))
+	}
+
+	if printJSON {
+		return json.NewEncoder(globalOptions.stdout).Encode(out)
+	}
+
+	var count int
+	var size int64
+	for _, total := range out.Totals {
+		Printf("%v: %d files, %v\n", total.Type, total.Count, ui.FormatBytes(uint64(total.Size)))
+		count += total.Count
+		size += total.Size
+	}
+	if all {
+		Printf("total: %d files, %v\n", count, ui.FormatBytes(uint64(size)))
+	}
+	return nil
+}
@@ -3,16 +3,22 @@ package main
 import (
 	"bufio"
 	"context"
+	"encoding/json"
+	"fmt"
 	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
+	"github.com/restic/restic/internal/ui"
 )
 
 func testRunList(t testing.TB, tpe string, opts GlobalOptions) restic.IDs {
 	buf, err := withCaptureStdout(func() error {
-		return runList(context.TODO(), cmdList, opts, []string{tpe})
+		return runList(context.TODO(), cmdList, ListOptions{}, opts, []string{tpe})
 	})
 	rtest.OK(t, err)
 	return parseIDsFromReader(t, buf)
@@ -42,3 +48,148 @@ func testListSnapshots(t testing.TB, opts GlobalOptions, expected int) restic.ID
 	rtest.Assert(t, len(snapshotIDs) == expected, "expected %v snapshot, got %v", expected, snapshotIDs)
 	return snapshotIDs
 }
+
+func TestListIndexLong(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	rtest.OK(t, appendRandomData(filepath.Join(env.testdata, "new"), 1000))
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+
+	indexIDs := testRunList(t, "index", env.gopts)
+	rtest.Equals(t, 2, len(indexIDs))
+
+	buf, err := withCaptureStdout(func() error {
+		return runList(context.TODO(), cmdList, ListOptions{Long: true}, env.gopts, []string{"index"})
+	})
+	rtest.OK(t, err)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	rtest.Equals(t, 2, len(lines))
+
+	listedIndexes := restic.NewIDSet()
+	totalPacks, totalBlobs := 0, 0
+	for _, line := range lines {
+		var idStr string
+		var packs, blobs int
+		_, err := fmt.Sscanf(line, "%s %d packs %d blobs", &idStr, &packs, &blobs)
+		rtest.OK(t, err)
+		listedIndexes.Insert(restic.TestParseID(idStr))
+		rtest.Assert(t, packs > 0 && blobs >= packs, "unexpected counts in %q", line)
+		totalPacks += packs
+		totalBlobs += blobs
+
+		// the decoded index contains the same number of packs and blobs
+		buf, err := withCaptureStdout(func() error {
+			gopts := env.gopts
+			gopts.JSON = true
+			return runCat(context.TODO(), CatOptions{}, gopts, []string{"index", idStr})
+		})
+		rtest.OK(t, err)
+		var idx struct {
+			Packs []struct {
+				Blobs []json.RawMessage `json:"blobs"`
+			} `json:"packs"`
+		}
+		rtest.OK(t, json.Unmarshal(buf.Bytes(), &idx))
+		rtest.Equals(t, packs, len(idx.Packs))
+		decodedBlobs := 0
+		for _, pack := range idx.Packs {
+			decodedBlobs += len(pack.Blobs)
+		}
+		rtest.Equals(t, blobs, decodedBlobs)
+	}
+
+	rtest.Equals(t, restic.NewIDSet(indexIDs...), listedIndexes)
+	rtest.Equals(t, len(testRunList(t, "packs", env.gopts)), totalPacks)
+
+	blobs, err := withCaptureStdout(func() error {
+		return runList(context.TODO(), cmdList, ListOptions{}, env.gopts, []string{"blobs"})
+	})
+	rtest.OK(t, err)
+	rtest.Equals(t, strings.Count(blobs.String(), "\n"), totalBlobs)
+
+	err = runList(context.TODO(), cmdList, ListOptions{Long: true}, env.gopts, []string{"packs"})
+	rtest.Assert(t, err != nil, "expected error for --long with packs")
+}
+
+func TestListSizes(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	// must list keys more than once
+	env.gopts.backendTestHook = nil
+
+	// collect the sizes of the files in the repository directory
+	expected := make(map[string]listSizesTotal)
+	for _, dir := range []struct{ name, tpe string }{
+		{"data", "packs"},
+		{"index", "index"},
+		{"snapshots", "snapshots"},
+		{"keys", "keys"},
+		{"locks", "locks"},
+	} {
+		total := listSizesTotal{Type: dir.tpe}
+		err := filepath.Walk(filepath.Join(env.repo, dir.name), func(_ string, fi os.FileInfo, err error) error {
+			if err != nil || fi.IsDir() {
+				return err
+			}
+			total.Count++
+			total.Size += fi.Size()
+			return nil
+		})
+		rtest.OK(t, err)
+		expected[dir.tpe] = total
+	}
+	rtest.Assert(t, expected["packs"].Count > 0 && expected["snapshots"].Count == 1, "unexpected repository contents %v", expected)
+
+	runListSizes := func(tpe string) listSizesOutput {
+		buf, err := withCaptureStdout(func() error {
+			gopts := env.gopts
+			gopts.JSON = true
+			return runList(context.TODO(), cmdList, ListOptions{Sizes: true}, gopts, []string{tpe})
+		})
+		rtest.OK(t, err)
+		var out listSizesOutput
+		rtest.OK(t, json.Unmarshal(buf.Bytes(), &out))
+		return out
+	}
+
+	out := runListSizes("all")
+	rtest.Equals(t, len(listFileTypes), len(out.Totals))
+	for _, total := range out.Totals {
+		rtest.Equals(t, expected[total.Type], total)
+	}
+	files := 0
+	for _, total := range out.Totals {
+		files += total.Count
+	}
+	rtest.Equals(t, files, len(out.Files))
+
+	out = runListSizes("packs")
+	rtest.Equals(t, []listSizesTotal{expected["packs"]}, out.Totals)
+	var size int64
+	for _, file := range out.Files {
+		rtest.Equals(t, "packs", file.Type)
+		size += file.Size
+	}
+	rtest.Equals(t, expected["packs"].Size, size)
+
+	// the text output ends with the totals
+	buf, err := withCaptureStdout(func() error {
+		return runList(context.TODO(), cmdList, ListOptions{Sizes: true}, env.gopts, []string{"snapshots"})
+	})
+	rtest.OK(t, err)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	rtest.Equals(t, 2, len(lines))
+	rtest.Equals(t, fmt.Sprintf("snapshots: 1 files, %v", ui.FormatBytes(uint64(expected["snapshots"].Size))), lines[1])
+
+	err = runList(context.TODO(), cmdList, ListOptions{Sizes: true}, env.gopts, []string{"blobs"})
+	rtest.Assert(t, err != nil, "expected error for --sizes with blobs")
+	err = runList(context.TODO(), cmdList, ListOptions{}, env.gopts, []string{"all"})
+	rtest.Assert(t, err != nil, "expected error for all without --sizes")
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"os"
+	"path"
 	"strings"
 	"time"
 
@@ -25,7 +26,8 @@ The "ls" command lists files and directories in a snapshot.
 The special snapshot ID "latest" can be used to list files and
 directories of the latest snapshot in the repository. The
 --host flag can be used in conjunction to select the latest
-snapshot originating from a certain host only.
+snapshot originating from a certain host only. Use "latest~N" to
+select the snapshot N snapshots before the latest one.
 
 File listings can optionally be filtered by directories. Any
 positional arguments after the snapshot ID are interpreted as
@@ -35,6 +37,21 @@ will allow traversing into matching directories' subfolders.
 Any directory paths specified must be absolute (starting with
 a path separator); paths use the forward slash '/' as separator.
 
+The listed files can also be filtered by their owner using --uid,
+--gid, --user and --group and by their permissions using --perm.
+The octal mask given to --perm matches files which have any of the
+bits in the mask set, for example "--perm 0002" lists world-writable
+files. A mask with the suffix "/exact", for example "4755/exact",
+only matches files with exactly this mode. Symlinks are matched by
+their own metadata.
+
+The entries of each directory are listed in the order given by --sort,
+which can be one of "name" (default), "size", "mtime" or "extension".
+Entries with the same sort key are listed by name. The order can be
+inverted using --reverse, and --dirs-first lists directories before all
+other entries of a directory. The contents of subdirectories are listed
+directly after the subdirectory itself.
+
 EXIT STATUS
 ===========
 
@@ -52,6 +69,10 @@ type LsOptions struct {
 	restic.SnapshotFilter
 	Recursive     bool
 	HumanReadable bool
+	Sort          string
+	Reverse       bool
+	DirsFirst     bool
+	nodeFilterOptions
 }
 
 var lsOptions LsOptions
@@ -64,6 +85,10 @@ func init() {
 	flags.BoolVarP(&lsOptions.ListLong, "long", "l", false, "use a long listing format showing size and mode")
 	flags.BoolVar(&lsOptions.Recursive, "recursive", false, "include files in subfolders of the listed directories")
 	flags.BoolVar(&lsOptions.HumanReadable, "human-readable", false, "print sizes in human readable format")
+	flags.StringVar(&lsOptions.Sort, "sort", "name", "sort the entries of each directory by `field`: name, size, mtime or extension")
+	flags.BoolVar(&lsOptions.Reverse, "reverse", false, "reverse the sort order")
+	flags.BoolVar(&lsOptions.DirsFirst, "dirs-first", false, "list directories before other entries")
+	initNodeFilterOptions(flags, &lsOptions.nodeFilterOptions)
 }
 
 type lsSnapshot struct {
@@ -77,8 +102,10 @@ type lsSnapshot struct {
 func lsNodeJSON(enc *json.Encoder, path string, node *restic.Node) error {
 	n := &struct {
 		Name        string      `json:"name"`
+		NameRaw     []byte      `json:"name_raw,omitempty"`
 		Type        string      `json:"type"`
 		Path        string      `json:"path"`
+		PathRaw     []byte      `json:"path_raw,omitempty"`
 		UID         uint32      `json:"uid"`
 		GID         uint32      `json:"gid"`
 		Size        *uint64     `json:"size,omitempty"`
@@ -92,8 +119,10 @@ func lsNodeJSON(enc *json.Encoder, path string, node *restic.Node) error {
 		size uint64 // Target for Size pointer.
 	}{
 		Name:        node.Name,
+		NameRaw:     rawBytes(node.Name),
 		Type:        node.Type,
 		Path:        path,
+		PathRaw:     rawBytes(path),
 		UID:         node.UID,
 		GID:         node.GID,
 		size:        node.Size,
@@ -113,9 +142,67 @@ func lsNodeJSON(enc *json.Encoder, path string, node *restic.Node) error {
 	return enc.Encode(n)
 }
 
+// lsNodeOrder returns the function which orders the entries of a directory.
+// Entries which are equal according to this function are listed by name.
+func lsNodeOrder(sortBy string, reverse, dirsFirst bool) (func(a, b *restic.Node) bool, error) {
+	var compare func(a, b *restic.Node) int
+	switch sortBy {
+	case "", "name":
+		compare = func(a, b *restic.Node) int {
+			return strings.Compare(a.Name, b.Name)
+		}
+	case "size":
+		compare = func(a, b *restic.Node) int {
+			switch {
+			case a.Size < b.Size:
+				return -1
+			case a.Size > b.Size:
+				return 1
+			}
+			return 0
+		}
+	case "mtime":
+		compare = func(a, b *restic.Node) int {
+			switch {
+			case a.ModTime.Before(b.ModTime):
+				return -1
+			case a.ModTime.After(b.ModTime):
+				return 1
+			}
+			return 0
+		}
+	case "extension":
+		compare = func(a, b *restic.Node) int {
+			return strings.Compare(path.Ext(a.Name), path.Ext(b.Name))
+		}
+	default:
+		return nil, errors.Fatalf("invalid sort field %q, must be one of name, size, mtime or extension", sortBy)
+	}
+
+	return func(a, b *restic.Node) bool {
+		if dirsFirst && (a.Type == "dir") != (b.Type == "dir") {
+			return a.Type == "dir"
+		}
+		c := compare(a, b)
+		if reverse {
+			c = -c
+		}
+		return c < 0
+	}, nil
+}
+
 func runLs(ctx context.Context, opts LsOptions, gopts GlobalOptions, args []string) error {
 	if len(args) == 0 {
-		return errors.Fatal("no snapshot ID specified, specify snapshot ID or use special ID 'latest'")
+		return invalidArguments(errors.Fatal("no snapshot ID specified, specify snapshot ID or use special ID 'latest'"))
+	}
+
+	if err := opts.nodeFilterOptions.Parse(); err != nil {
+		return err
+	}
+
+	less, err := lsNodeOrder(opts.Sort, opts.Reverse, opts.DirsFirst)
+	if err != nil {
+		return invalidArguments(err)
 	}
 
 	// extract any specific directories to walk
@@ -124,7 +211,7 @@ func runLs(ctx context.Context, opts LsOptions, gopts GlobalOptions, args []stri
 		dirs = args[1:]
 		for _, dir := range dirs {
 			if !strings.HasPrefix(dir, "/") {
-				return errors.Fatal("All path filters must be absolute, starting with a forward slash '/'")
+				return invalidArguments(errors.Fatal("All path filters must be absolute, starting with a forward slash '/'"))
 			}
 		}
 	}
@@ -208,14 +295,15 @@ func runLs(ctx context.Context, opts LsOptions, gopts GlobalOptions, args []stri
 			Verbosef("snapshot %s of %v filtered by %v at %s):\n", sn.ID().Str(), sn.Paths, dirs, sn.Time)
 		}
 		printNode = func(path string, node *restic.Node) {
-			Printf("%s\n", formatNode(path, node, lsOptions.ListLong, lsOptions.HumanReadable))
+			Printf("%s\n", formatNode(path, node, lsOptions.ListLong, lsOptions.HumanReadable, time.Local))
 		}
 	}
 
 	sn, subfolder, err := (&restic.SnapshotFilter{
-		Hosts: opts.Hosts,
-		Paths: opts.Paths,
-		Tags:  opts.Tags,
+		Hosts:       opts.Hosts,
+		Paths:       opts.Paths,
+		Tags:        opts.Tags,
+		LoadErrorFn: warnSnapshotLoadError,
 	}).FindLatest(ctx, snapshotLister, repo, args[0])
 	if err != nil {
 		return err
@@ -228,7 +316,7 @@ func runLs(ctx context.Context, opts LsOptions, gopts GlobalOptions, args []stri
 
 	printSnapshot(sn)
 
-	err = walker.Walk(ctx, repo, *sn.Tree, nil, func(_ restic.ID, nodepath string, node *restic.Node, err error) (bool, error) {
+	err = walker.WalkOrdered(ctx, repo, *sn.Tree, nil, less, func(_ restic.ID, nodepath string, node *restic.Node, err error) (bool, error) {
 		if err != nil {
 			return false, err
 		}
@@ -238,7 +326,9 @@ func runLs(ctx context.Context, opts LsOptions, gopts GlobalOptions, args []stri
 
 		if withinDir(nodepath) {
 			// if we're within a dir, print the node
-			printNode(nodepath, node)
+			if opts.nodeFilterOptions.Match(node) {
+				printNode(nodepath, node)
+			}
 
 			// if recursive listing is requested, signal the walker that it
 			// should continue walking recursively
@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 
@@ -17,3 +20,40 @@ func testRunLs(t testing.TB, gopts GlobalOptions, snapshotID string) []string {
 	rtest.OK(t, err)
 	return strings.Split(buf.String(), "\n")
 }
+
+func TestLsNodeFilter(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permissions are not supported on Windows")
+	}
+
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	testRunInit(t, env.gopts)
+
+	for name, mode := range map[string]os.FileMode{"private": 0600, "public": 0644, "writable": 0666} {
+		fn := filepath.Join(env.testdata, name)
+		rtest.OK(t, os.WriteFile(fn, []byte(name), 0600))
+		rtest.OK(t, os.Chmod(fn, mode))
+	}
+	// the directory itself must not match the filters
+	rtest.OK(t, os.Chmod(env.testdata, 0700))
+	testRunBackup(t, env.testdata, []string{"."}, BackupOptions{}, env.gopts)
+
+	for _, test := range []struct {
+		perm string
+		want []string
+	}{
+		{"0002", []string{"/writable"}},
+		{"0004", []string{"/public", "/writable"}},
+		{"644/exact", []string{"/public"}},
+	} {
+		buf, err := withCaptureStdout(func() error {
+			gopts := env.gopts
+			gopts.Quiet = true
+			opts := LsOptions{nodeFilterOptions: nodeFilterOptions{Perm: test.perm}}
+			return runLs(context.TODO(), opts, gopts, []string{"latest"})
+		})
+		rtest.OK(t, err)
+		rtest.Equals(t, test.want, strings.Fields(buf.String()))
+	}
+}
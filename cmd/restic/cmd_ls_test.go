@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"os"
+	"sort"
 	"testing"
 	"time"
 
@@ -90,3 +91,52 @@ func TestLsNodeJSON(t *testing.T) {
 		rtest.OK(t, err)
 	}
 }
+
+func TestLsNodeOrder(t *testing.T) {
+	mtime := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	nodes := []*restic.Node{
+		{Name: "b.txt", Type: "file", Size: 20, ModTime: mtime.Add(time.Hour)},
+		{Name: "a.go", Type: "file", Size: 10, ModTime: mtime},
+		{Name: "src", Type: "dir", ModTime: mtime.Add(2 * time.Hour)},
+		{Name: "c.txt", Type: "file", Size: 10, ModTime: mtime},
+		{Name: "README", Type: "file", Size: 30, ModTime: mtime.Add(-time.Hour)},
+		{Name: "doc", Type: "dir", ModTime: mtime},
+	}
+
+	for _, test := range []struct {
+		sort      string
+		reverse   bool
+		dirsFirst bool
+		want      []string
+	}{
+		{"name", false, false, []string{"README", "a.go", "b.txt", "c.txt", "doc", "src"}},
+		{"name", true, false, []string{"src", "doc", "c.txt", "b.txt", "a.go", "README"}},
+		{"name", false, true, []string{"doc", "src", "README", "a.go", "b.txt", "c.txt"}},
+		{"size", false, false, []string{"doc", "src", "a.go", "c.txt", "b.txt", "README"}},
+		{"size", true, false, []string{"README", "b.txt", "a.go", "c.txt", "doc", "src"}},
+		{"size", true, true, []string{"doc", "src", "README", "b.txt", "a.go", "c.txt"}},
+		{"mtime", false, false, []string{"README", "a.go", "c.txt", "doc", "b.txt", "src"}},
+		{"mtime", true, false, []string{"src", "b.txt", "a.go", "c.txt", "doc", "README"}},
+		{"extension", false, false, []string{"README", "doc", "src", "a.go", "b.txt", "c.txt"}},
+		{"extension", true, true, []string{"doc", "src", "b.txt", "c.txt", "a.go", "README"}},
+	} {
+		t.Run(test.sort, func(t *testing.T) {
+			less, err := lsNodeOrder(test.sort, test.reverse, test.dirsFirst)
+			rtest.OK(t, err)
+
+			// sort the nodes like the walker does
+			list := append([]*restic.Node(nil), nodes...)
+			sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+			sort.SliceStable(list, func(i, j int) bool { return less(list[i], list[j]) })
+
+			var names []string
+			for _, node := range list {
+				names = append(names, node.Name)
+			}
+			rtest.Equals(t, test.want, names)
+		})
+	}
+
+	_, err := lsNodeOrder("owner", false, false)
+	rtest.Assert(t, err != nil, "invalid sort field was accepted")
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/migrations"
 	"github.com/restic/restic/internal/restic"
 
@@ -17,6 +19,10 @@ The "migrate" command checks which migrations can be applied for a repository
 and prints a list with available migration names. If one or more migration
 names are specified, these migrations are applied.
 
+With --json, the available migrations are listed as JSON including the changes
+they make to the repository. With --dry-run, the specified migrations are only
+checked and the concrete changes they would make are printed.
+
 EXIT STATUS
 ===========
 
@@ -30,7 +36,8 @@ Exit status is 0 if the command was successful, and non-zero if there was any er
 
 // MigrateOptions bundles all options for the 'check' command.
 type MigrateOptions struct {
-	Force bool
+	Force  bool
+	DryRun bool
 }
 
 var migrateOptions MigrateOptions
@@ -39,12 +46,38 @@ func init() {
 	cmdRoot.AddCommand(cmdMigrate)
 	f := cmdMigrate.Flags()
 	f.BoolVarP(&migrateOptions.Force, "force", "f", false, `apply a migration a second time`)
+	f.BoolVarP(&migrateOptions.DryRun, "dry-run", "n", false, "do not modify the repository, just print what would be done")
 }
 
-func checkMigrations(ctx context.Context, repo restic.Repository) error {
-	Printf("available migrations:\n")
-	found := false
+// migrationInfo describes a migration in the JSON output.
+type migrationInfo struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Changes     []string `json:"changes"`
+	Reversible  bool     `json:"reversible"`
+	RepoCheck   bool     `json:"repository_check"`
+}
+
+func newMigrationInfo(m migrations.Migration) migrationInfo {
+	return migrationInfo{
+		Name:        m.Name(),
+		Description: m.Desc(),
+		Changes:     m.Changes(),
+		Reversible:  m.Reversible(),
+		RepoCheck:   m.RepoCheck(),
+	}
+}
+
+// migrationPlan is the JSON output of a dry run for one migration.
+type migrationPlan struct {
+	migrationInfo
+	Applicable bool     `json:"applicable"`
+	Reason     string   `json:"reason,omitempty"`
+	Plan       []string `json:"plan"`
+}
 
+func checkMigrations(ctx context.Context, gopts GlobalOptions, repo restic.Repository) error {
+	available := []migrationInfo{}
 	for _, m := range migrations.All {
 		ok, _, err := m.Check(ctx, repo)
 		if err != nil {
@@ -52,18 +85,92 @@ func checkMigrations(ctx context.Context, repo restic.Repository) error {
 		}
 
 		if ok {
-			Printf("  %v\t%v\n", m.Name(), m.Desc())
-			found = true
+			available = append(available, newMigrationInfo(m))
 		}
 	}
 
-	if !found {
+	if gopts.JSON {
+		return json.NewEncoder(globalOptions.stdout).Encode(available)
+	}
+
+	Printf("available migrations:\n")
+	for _, m := range available {
+		Printf("  %v\t%v\n", m.Name, m.Description)
+	}
+	if len(available) == 0 {
 		Printf("no migrations found\n")
 	}
 
 	return nil
 }
 
+// findMigration returns the migration with the given name.
+func findMigration(name string) (migrations.Migration, error) {
+	for _, m := range migrations.All {
+		if m.Name() == name {
+			return m, nil
+		}
+	}
+	return nil, errors.Fatalf("unknown migration %v", name)
+}
+
+// planMigrations checks the migrations and prints the changes they would make
+// to the repository, without applying them.
+func planMigrations(ctx context.Context, gopts GlobalOptions, repo restic.Repository, args []string) error {
+	plans := []migrationPlan{}
+	for _, name := range args {
+		m, err := findMigration(name)
+		if err != nil {
+			return err
+		}
+
+		ok, reason, err := m.Check(ctx, repo)
+		if err != nil {
+			return err
+		}
+		p := migrationPlan{migrationInfo: newMigrationInfo(m), Applicable: ok, Reason: reason, Plan: []string{}}
+		if !ok && p.Reason == "" {
+			p.Reason = "check failed"
+		}
+
+		if ok {
+			if planner, isPlanner := m.(migrations.Planner); isPlanner {
+				p.Plan, err = planner.Plan(ctx, repo)
+				if err != nil {
+					return err
+				}
+			} else {
+				// fall back to the general description of the changes
+				p.Plan = m.Changes()
+			}
+		}
+		plans = append(plans, p)
+	}
+
+	if gopts.JSON {
+		return json.NewEncoder(globalOptions.stdout).Encode(plans)
+	}
+
+	for _, p := range plans {
+		if !p.Applicable {
+			Printf("migration %v cannot be applied: %v\n", p.Name, p.Reason)
+			continue
+		}
+
+		Printf("migration %v:\n", p.Name)
+		if p.RepoCheck {
+			printDryRun("check the repository integrity")
+		}
+		for _, change := range p.Plan {
+			printDryRun("%v", change)
+		}
+		if !p.Reversible {
+			Printf("the migration cannot be undone\n")
+		}
+	}
+	return nil
+}
+
 func applyMigrations(ctx context.Context, opts MigrateOptions, gopts GlobalOptions, repo restic.Repository, args []string) error {
 	var firsterr error
 	for _, name := range args {
@@ -117,19 +224,33 @@ func applyMigrations(ctx context.Context, opts MigrateOptions, gopts GlobalOptio
 }
 
 func runMigrate(ctx context.Context, opts MigrateOptions, gopts GlobalOptions, args []string) error {
+	if len(args) > 0 && !opts.DryRun {
+		if err := checkReadOnly(gopts, "migrate"); err != nil {
+			return err
+		}
+	}
+
 	repo, err := OpenRepository(ctx, gopts)
 	if err != nil {
 		return err
 	}
 
-	lock, ctx, err := lockRepoExclusive(ctx, repo, gopts.RetryLock, gopts.JSON)
-	defer unlockRepo(lock)
-	if err != nil {
-		return err
+	// listing the available migrations and dry runs work without a lock
+	if (len(args) > 0 && !opts.DryRun) || !gopts.NoLock {
+		var lock *restic.Lock
+		lock, ctx, err = lockRepoExclusive(ctx, repo, gopts.RetryLock, gopts.JSON)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
 	}
 
 	if len(args) == 0 {
-		return checkMigrations(ctx, repo)
+		return checkMigrations(ctx, gopts, repo)
+	}
+
+	if opts.DryRun {
+		return planMigrations(ctx, gopts, repo, args)
 	}
 
 	return applyMigrations(ctx, opts, gopts, repo, args)
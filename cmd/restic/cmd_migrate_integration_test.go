@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func testRunMigrate(t testing.TB, gopts GlobalOptions, args ...string) string {
+	return testRunMigrateOptions(t, MigrateOptions{}, gopts, args...)
+}
+
+func testRunMigrateOptions(t testing.TB, opts MigrateOptions, gopts GlobalOptions, args ...string) string {
+	buf, err := withCaptureStdout(func() error {
+		return runMigrate(context.TODO(), opts, gopts, args)
+	})
+	rtest.OK(t, err)
+	return buf.String()
+}
+
+func checkDefaultLayout(t testing.TB, repo string) {
+	t.Helper()
+	for _, dir := range []string{"key", "snapshot", "lock"} {
+		entries, err := os.ReadDir(filepath.Join(repo, dir))
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		if len(entries) != 0 {
+			t.Errorf("directory %v still contains %d files", dir, len(entries))
+		}
+	}
+
+	for _, dir := range []string{"keys", "snapshots"} {
+		entries, err := os.ReadDir(filepath.Join(repo, dir))
+		rtest.OK(t, err)
+		rtest.Assert(t, len(entries) > 0, "directory %v is empty", dir)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(repo, "data"))
+	rtest.OK(t, err)
+	for _, e := range entries {
+		rtest.Assert(t, e.IsDir() && len(e.Name()) == 2, "unexpected entry %v in data directory", e.Name())
+	}
+}
+
+func testMigrateS3Layout(t *testing.T, prepare func(repo string)) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	datafile := filepath.Join("..", "..", "internal", "backend", "testdata", "repo-layout-s3legacy.tar.gz")
+	rtest.SetupTarTestFixture(t, env.base, datafile)
+	if prepare != nil {
+		prepare(env.repo)
+	}
+
+	out := testRunMigrate(t, env.gopts)
+	rtest.Assert(t, strings.Contains(out, "s3_layout"), "s3_layout migration not available, output:\n%v", out)
+
+	out = testRunMigrate(t, env.gopts, "s3_layout")
+	rtest.Assert(t, strings.Contains(out, "migration s3_layout: success"), "unexpected output:\n%v", out)
+	checkDefaultLayout(t, env.repo)
+
+	out = testRunMigrate(t, env.gopts)
+	rtest.Assert(t, !strings.Contains(out, "s3_layout"), "s3_layout migration still available, output:\n%v", out)
+
+	testRunCheck(t, env.gopts)
+	testListSnapshots(t, env.gopts, 3)
+	testRunRestoreLatest(t, env.gopts, filepath.Join(env.base, "restore"), nil, nil)
+}
+
+func TestMigrateS3Layout(t *testing.T) {
+	testMigrateS3Layout(t, nil)
+}
+
+func TestMigrateS3LayoutResume(t *testing.T) {
+	// simulate a migration which was interrupted after moving a snapshot, a
+	// pack file and the key, the repository is then detected as using the
+	// default layout
+	testMigrateS3Layout(t, func(repo string) {
+		for _, f := range []struct{ from, to string }{
+			{"snapshot/bf126587a52e6ac30b09be7a98b5a305894ea625dd496b6791c4024a52354652", "snapshots"},
+			{"data/aa464e9fd598fe4202492ee317ffa728e82fa83a1de1a61996e5bd2d6651646c", "data/aa"},
+			{"key/584fd5182a9dc4dee93819078aed63db174dfe7c46ce2ea30d77dcda8c470cc4", "keys"},
+		} {
+			dir := filepath.Join(repo, filepath.FromSlash(f.to))
+			rtest.OK(t, os.MkdirAll(dir, 0700))
+			rtest.OK(t, os.Rename(filepath.Join(repo, filepath.FromSlash(f.from)), filepath.Join(dir, filepath.Base(f.from))))
+		}
+	})
+}
+
+// writeRecordingBackend records all requests which modify the backend.
+type writeRecordingBackend struct {
+	restic.Backend
+
+	m      sync.Mutex
+	writes []string
+}
+
+func (be *writeRecordingBackend) record(op string, h restic.Handle) {
+	be.m.Lock()
+	defer be.m.Unlock()
+	be.writes = append(be.writes, op+" "+h.String())
+}
+
+func (be *writeRecordingBackend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	be.record("save", h)
+	return be.Backend.Save(ctx, h, rd)
+}
+
+func (be *writeRecordingBackend) Remove(ctx context.Context, h restic.Handle) error {
+	be.record("remove", h)
+	return be.Backend.Remove(ctx, h)
+}
+
+func (be *writeRecordingBackend) Unwrap() restic.Backend { return be.Backend }
+
+func countRepoFiles(t testing.TB, dir string) int {
+	entries, err := os.ReadDir(dir)
+	rtest.OK(t, err)
+	count := 0
+	for _, e := range entries {
+		if !e.IsDir() {
+			count++
+		}
+	}
+	return count
+}
+
+func TestMigrateJSON(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	datafile := filepath.Join("..", "..", "internal", "backend", "testdata", "repo-layout-s3legacy.tar.gz")
+	rtest.SetupTarTestFixture(t, env.base, datafile)
+
+	gopts := env.gopts
+	gopts.JSON = true
+	var available []migrationInfo
+	rtest.OK(t, json.Unmarshal([]byte(testRunMigrate(t, gopts)), &available))
+	rtest.Equals(t, 2, len(available))
+	for _, m := range available {
+		rtest.Assert(t, m.Description != "", "missing description for %v", m.Name)
+		rtest.Assert(t, len(m.Changes) > 0, "missing changes for %v", m.Name)
+		rtest.Assert(t, !m.Reversible, "%v migration is reversible", m.Name)
+	}
+	rtest.Equals(t, "s3_layout", available[0].Name)
+	rtest.Assert(t, !available[0].RepoCheck, "s3_layout requires a repository check")
+	rtest.Equals(t, "upgrade_repo_v2", available[1].Name)
+	rtest.Assert(t, available[1].RepoCheck, "upgrade_repo_v2 does not require a repository check")
+}
+
+func TestMigrateDryRun(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	datafile := filepath.Join("..", "..", "internal", "backend", "testdata", "repo-layout-s3legacy.tar.gz")
+	rtest.SetupTarTestFixture(t, env.base, datafile)
+
+	var expected []string
+	for _, f := range []struct{ dir, tpe string }{
+		{"snapshot", "snapshot"},
+		{"data", "data"},
+		{"lock", "lock"},
+		{"key", "key"},
+	} {
+		expected = append(expected, fmt.Sprintf("move %d %v files to the default layout", countRepoFiles(t, filepath.Join(env.repo, f.dir)), f.tpe))
+	}
+
+	be := &writeRecordingBackend{}
+	gopts := env.gopts
+	gopts.NoLock = true
+	gopts.backendTestHook = func(r restic.Backend) (restic.Backend, error) {
+		be.Backend = r
+		return be, nil
+	}
+	opts := MigrateOptions{DryRun: true}
+
+	out := testRunMigrateOptions(t, opts, gopts, "s3_layout", "upgrade_repo_v2")
+	for _, line := range expected {
+		rtest.Assert(t, strings.Contains(out, "would "+line+"\n"), "missing %q in output:\n%v", line, out)
+	}
+	rtest.Assert(t, strings.Contains(out, "would check the repository integrity\nwould change the repository version from 1 to 2\n"), "unexpected output:\n%v", out)
+
+	gopts.JSON = true
+	// must list the legacy files more than once
+	gopts.backendTestHook = nil
+	var plans []migrationPlan
+	rtest.OK(t, json.Unmarshal([]byte(testRunMigrateOptions(t, opts, gopts, "s3_layout")), &plans))
+	rtest.Equals(t, 1, len(plans))
+	rtest.Equals(t, "s3_layout", plans[0].Name)
+	rtest.Assert(t, plans[0].Applicable, "s3_layout migration is not applicable")
+	rtest.Equals(t, expected, plans[0].Plan)
+
+	rtest.Equals(t, []string(nil), be.writes)
+	// the repository still uses the legacy layout and version 1
+	out = testRunMigrate(t, env.gopts)
+	rtest.Assert(t, strings.Contains(out, "s3_layout") && strings.Contains(out, "upgrade_repo_v2"), "migrations not available, output:\n%v", out)
+}
@@ -5,8 +5,14 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -61,6 +67,22 @@ The default path templates are:
     "hosts/%h/%T"
     "tags/%t/%T"
 
+With --diffs, the directory "diffs" contains a directory named
+"<older-id>_<newer-id>" for each pair of consecutive snapshots with the same
+host and paths. It only contains the files and directories which differ
+between the two snapshots, in the version of the newer snapshot. Removed
+entries are represented by an empty file with the suffix ".deleted". The
+differences are computed on first access.
+
+Single Snapshot
+===============
+
+With --snapshot, only the given snapshot is mounted and its content is served
+directly at the mountpoint. Use "latest" together with --host, --path and
+--tag to mount the latest matching snapshot, which is determined once when the
+repository is mounted. A directory within the snapshot can be mounted with
+--path-within or by using the "<snapshot>:<subfolder>" syntax.
+
 EXIT STATUS
 ===========
 
@@ -80,12 +102,16 @@ type MountOptions struct {
 	restic.SnapshotFilter
 	TimeTemplate  string
 	PathTemplates []string
+	Diffs         bool
+	Snapshot      string
+	PathWithin    string
 }
 
 var mountOptions MountOptions
 
 func init() {
 	cmdRoot.AddCommand(cmdMount)
+	enableFeature("fuse")
 
 	mountFlags := cmdMount.Flags()
 	mountFlags.BoolVar(&mountOptions.OwnerRoot, "owner-root", false, "use 'root' as the owner of files and dirs")
@@ -98,6 +124,10 @@ func init() {
 	mountFlags.StringVar(&mountOptions.TimeTemplate, "snapshot-template", time.RFC3339, "set `template` to use for snapshot dirs")
 	mountFlags.StringVar(&mountOptions.TimeTemplate, "time-template", time.RFC3339, "set `template` to use for times")
 	_ = mountFlags.MarkDeprecated("snapshot-template", "use --time-template")
+	mountFlags.BoolVar(&mountOptions.Diffs, "diffs", false, "add the directory 'diffs' containing the differences between consecutive snapshots")
+
+	mountFlags.StringVar(&mountOptions.Snapshot, "snapshot", "", "only mount the `snapshot` at the mountpoint, \"latest\" selects the latest snapshot matching the filters")
+	mountFlags.StringVar(&mountOptions.PathWithin, "path-within", "", "only mount the `dir` within the snapshot given with --snapshot")
 }
 
 func runMount(ctx context.Context, opts MountOptions, gopts GlobalOptions, args []string) error {
@@ -113,6 +143,14 @@ func runMount(ctx context.Context, opts MountOptions, gopts GlobalOptions, args
 		return errors.Fatal("wrong number of parameters")
 	}
 
+	if opts.PathWithin != "" && opts.Snapshot == "" {
+		return errors.Fatal("--path-within requires --snapshot")
+	}
+
+	if opts.Diffs && opts.Snapshot != "" {
+		return errors.Fatal("--diffs and --snapshot cannot be used together")
+	}
+
 	debug.Log("start mount")
 	defer debug.Log("finish mount")
 
@@ -135,6 +173,40 @@ func runMount(ctx context.Context, opts MountOptions, gopts GlobalOptions, args
 		return err
 	}
 
+	cfg := fuse.Config{
+		OwnerIsRoot:   opts.OwnerRoot,
+		Filter:        opts.SnapshotFilter,
+		TimeTemplate:  opts.TimeTemplate,
+		PathTemplates: opts.PathTemplates,
+		Diffs:         opts.Diffs,
+	}
+
+	// resolve the snapshot once, the mount is not updated for new snapshots
+	var sn *restic.Snapshot
+	var root *fuse.Root
+	if opts.Snapshot != "" {
+		var subfolder string
+		opts.SnapshotFilter.LoadErrorFn = warnSnapshotLoadError
+		sn, subfolder, err = opts.SnapshotFilter.FindLatest(ctx, repo.Backend(), repo, opts.Snapshot)
+		if err != nil {
+			return errors.Fatalf("failed to find snapshot: %v", err)
+		}
+
+		if opts.PathWithin != "" {
+			if subfolder != "" {
+				return errors.Fatal("--path-within cannot be combined with the <snapshot>:<subfolder> syntax")
+			}
+			subfolder = opts.PathWithin
+		}
+
+		root, err = fuse.NewSnapshotRoot(ctx, repo, cfg, sn, subfolder)
+		if err != nil {
+			return errors.Fatalf("failed to mount snapshot %v: %v", sn.ID().Str(), err)
+		}
+	} else {
+		root = fuse.NewRoot(repo, cfg)
+	}
+
 	mountpoint := args[0]
 
 	if _, err := resticfs.Stat(mountpoint); errors.Is(err, os.ErrNotExist) {
@@ -156,7 +228,12 @@ func runMount(ctx context.Context, opts MountOptions, gopts GlobalOptions, args
 		}
 	}
 
+	// unmounted is set to 1 once the mountpoint was unmounted gracefully
+	var unmounted int32
 	AddCleanupHandler(func(code int) (int, error) {
+		if atomic.LoadInt32(&unmounted) != 0 {
+			return code, nil
+		}
 		debug.Log("running umount cleanup handler for mount at %v", mountpoint)
 		err := umount(mountpoint)
 		if err != nil {
@@ -178,28 +255,143 @@ func runMount(ctx context.Context, opts MountOptions, gopts GlobalOptions, args
 		debug.Log("fuse: %v", msg)
 	}
 
-	cfg := fuse.Config{
-		OwnerIsRoot:   opts.OwnerRoot,
-		Filter:        opts.SnapshotFilter,
-		TimeTemplate:  opts.TimeTemplate,
-		PathTemplates: opts.PathTemplates,
+	if sn != nil {
+		Printf("Now serving snapshot %s at %s\n", sn.ID().Str(), mountpoint)
+	} else {
+		Printf("Now serving the repository at %s\n", mountpoint)
 	}
-	root := fuse.NewRoot(repo, cfg)
 
-	Printf("Now serving the repository at %s\n", mountpoint)
 	Printf("Use another terminal or tool to browse the contents of this folder.\n")
 	Printf("When finished, quit with Ctrl-c here or umount the mountpoint.\n")
 
+	// the first SIGINT or a SIGTERM unmount the mountpoint gracefully, a
+	// second SIGINT terminates restic immediately
+	shutdownCtx, stopShutdown := withGracefulShutdown(ctx)
+	defer stopShutdown()
+	termCh := make(chan os.Signal, 1)
+	signal.Notify(termCh, syscall.SIGTERM)
+	defer signal.Stop(termCh)
+
 	debug.Log("serving mount at %v", mountpoint)
-	err = fs.Serve(c, root)
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- fs.Serve(c, root)
+	}()
+
+	select {
+	case err = <-serveErr:
+		// the mountpoint was unmounted by the user
+	case <-shutdownCtx.Done():
+		err = unmountGracefully(mountpoint, serveErr)
+	case s := <-termCh:
+		debug.Log("signal %v received, unmounting", s)
+		err = unmountGracefully(mountpoint, serveErr)
+	}
 	if err != nil {
 		return err
 	}
+	atomic.StoreInt32(&unmounted, 1)
 
 	<-c.Ready
 	return c.MountError
 }
 
+// umountRetries is the number of attempts to unmount a busy mountpoint.
+const umountRetries = 3
+
+var (
+	// umountRetryDelay is the time to wait before unmounting a busy
+	// mountpoint again.
+	umountRetryDelay = 2 * time.Second
+	// umountServeTimeout is the maximum time to wait for requests which are
+	// in flight after the mountpoint was unmounted.
+	umountServeTimeout = 5 * time.Second
+)
+
+// unmountGracefully unmounts mountpoint and waits until the requests which
+// are still in flight have been served. Unmounting a busy mountpoint is
+// retried a few times.
+func unmountGracefully(mountpoint string, serveErr <-chan error) error {
+	Printf("unmounting %v\n", mountpoint)
+
+	var err error
+	for i := 0; i < umountRetries; i++ {
+		if i > 0 {
+			time.Sleep(umountRetryDelay)
+		}
+
+		err = umount(mountpoint)
+		if err == nil || !isMountpointBusy(err) {
+			break
+		}
+
+		msg := fmt.Sprintf("mountpoint %v is busy", mountpoint)
+		if pids := mountpointUsers(mountpoint); len(pids) > 0 {
+			msg += fmt.Sprintf(", it is used by the processes %v", pids)
+		}
+		Warnf("%v\n", msg)
+	}
+	if err != nil {
+		return errors.Fatalf("unable to unmount %v: %v\nclose all files in the mountpoint and run \"umount %v\" or \"fusermount -u %v\"", mountpoint, err, mountpoint, mountpoint)
+	}
+
+	select {
+	case err = <-serveErr:
+		return err
+	case <-time.After(umountServeTimeout):
+		debug.Log("serving the remaining requests for %v timed out", mountpoint)
+		return nil
+	}
+}
+
+// isMountpointBusy returns true if err indicates that unmounting failed
+// because the mountpoint is still in use. On Linux, fusermount only reports
+// this as part of its output.
+func isMountpointBusy(err error) bool {
+	return errors.Is(err, syscall.EBUSY) || strings.Contains(err.Error(), "busy")
+}
+
+// mountpointUsers returns the IDs of the processes which have a file below
+// mountpoint opened or use it as their working directory. This requires a
+// proc filesystem as on Linux, otherwise nil is returned.
+func mountpointUsers(mountpoint string) []int {
+	mountpoint, err := filepath.Abs(mountpoint)
+	if err != nil {
+		return nil
+	}
+
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+
+	var pids []int
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+
+		proc := filepath.Join("/proc", entry.Name())
+		links := []string{filepath.Join(proc, "cwd"), filepath.Join(proc, "root")}
+		fds, err := os.ReadDir(filepath.Join(proc, "fd"))
+		if err == nil {
+			for _, fd := range fds {
+				links = append(links, filepath.Join(proc, "fd", fd.Name()))
+			}
+		}
+
+		for _, link := range links {
+			target, err := os.Readlink(link)
+			if err == nil && (target == mountpoint || strings.HasPrefix(target, mountpoint+"/")) {
+				pids = append(pids, pid)
+				break
+			}
+		}
+	}
+	return pids
+}
+
 func umount(mountpoint string) error {
 	return systemFuse.Unmount(mountpoint)
 }
@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"syscall"
 	"testing"
 	"time"
 
@@ -228,3 +229,35 @@ func TestMountSameTimestamps(t *testing.T) {
 
 	checkSnapshots(t, env.gopts, repo, env.mountpoint, env.repo, ids, 4)
 }
+
+func TestMountSignal(t *testing.T) {
+	if !rtest.RunFuseTest {
+		t.Skip("Skipping fuse tests")
+	}
+
+	for _, sig := range []syscall.Signal{syscall.SIGTERM, syscall.SIGINT} {
+		t.Run(sig.String(), func(t *testing.T) {
+			env, cleanup := withTestEnvironment(t)
+			defer cleanup()
+
+			testSetupBackupData(t, env)
+			testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go testRunMount(t, env.gopts, env.mountpoint, &wg)
+			waitForMount(t, env.mountpoint)
+			if t.Failed() {
+				// without a running mount, the signal would terminate the test
+				t.FailNow()
+			}
+			rtest.Equals(t, 1, len(testRunList(t, "locks", env.gopts)))
+
+			rtest.OK(t, syscall.Kill(os.Getpid(), sig))
+			wg.Wait()
+
+			rtest.Assert(t, !snapshotsDirExists(t, env.mountpoint), "mountpoint %v was not unmounted", env.mountpoint)
+			rtest.Equals(t, 0, len(testRunList(t, "locks", env.gopts)))
+		})
+	}
+}
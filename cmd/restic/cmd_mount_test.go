@@ -0,0 +1,37 @@
+//go:build darwin || freebsd || linux
+// +build darwin freebsd linux
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestMountpointUsers(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("listing the users of a mountpoint requires a proc filesystem")
+	}
+
+	dir := rtest.TempDir(t)
+	rtest.OK(t, os.Mkdir(filepath.Join(dir, "sub"), 0700))
+	rtest.Equals(t, 0, len(mountpointUsers(dir)))
+
+	cmd := exec.Command("sleep", "60")
+	cmd.Dir = filepath.Join(dir, "sub")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("unable to start sleep: %v", err)
+	}
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+
+	rtest.Equals(t, []int{cmd.Process.Pid}, mountpointUsers(dir))
+	rtest.Equals(t, 0, len(mountpointUsers(dir+"-other")))
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"github.com/restic/restic/internal/options"
@@ -12,29 +13,80 @@ var optionsCmd = &cobra.Command{
 	Use:   "options",
 	Short: "Print list of extended options",
 	Long: `
-The "options" command prints a list of extended options.
+The "options" command prints a list of all extended options which can be set
+with "-o key=value", grouped by namespace. For each option the type, the
+default value and a short description are shown. Unknown options are rejected
+by all commands.
 
 EXIT STATUS
 ===========
 
 Exit status is 0 if the command was successful, and non-zero if there was any error.
 `,
-	Hidden:            true,
 	DisableAutoGenTag: true,
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Printf("All Extended Options:\n")
-		var maxLen int
-		for _, opt := range options.List() {
-			if l := len(opt.Namespace + "." + opt.Name); l > maxLen {
-				maxLen = l
-			}
-		}
-		for _, opt := range options.List() {
-			fmt.Printf("  %*s  %s\n", -maxLen, opt.Namespace+"."+opt.Name, opt.Text)
-		}
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runOptions(globalOptions, args)
 	},
 }
 
 func init() {
 	cmdRoot.AddCommand(optionsCmd)
 }
+
+// optionJSON is the JSON representation of an extended option.
+type optionJSON struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Default   string `json:"default"`
+	Help      string `json:"help"`
+}
+
+func runOptions(gopts GlobalOptions, args []string) error {
+	if len(args) > 0 {
+		return invalidArgumentsf("the options command expects no arguments")
+	}
+
+	list := options.List()
+
+	if gopts.JSON {
+		out := make([]optionJSON, 0, len(list))
+		for _, opt := range list {
+			out = append(out, optionJSON{
+				Namespace: opt.Namespace,
+				Name:      opt.Name,
+				Type:      opt.Type,
+				Default:   opt.Default,
+				Help:      opt.Text,
+			})
+		}
+		return json.NewEncoder(gopts.stdout).Encode(out)
+	}
+
+	var maxName, maxType, maxDefault int
+	for _, opt := range list {
+		if l := len(opt.Namespace + "." + opt.Name); l > maxName {
+			maxName = l
+		}
+		if l := len(opt.Type); l > maxType {
+			maxType = l
+		}
+		if l := len(opt.Default); l > maxDefault {
+			maxDefault = l
+		}
+	}
+
+	fmt.Fprintf(gopts.stdout, "All Extended Options:\n")
+	var ns string
+	for _, opt := range list {
+		// the list is sorted by namespace
+		if opt.Namespace != ns {
+			ns = opt.Namespace
+			fmt.Fprintf(gopts.stdout, "\n%v:\n", ns)
+		}
+		fmt.Fprintf(gopts.stdout, "  %*s  %*s  %*s  %s\n", -maxName, opt.Namespace+"."+opt.Name,
+			-maxType, opt.Type, -maxDefault, opt.Default, opt.Text)
+	}
+
+	return nil
+}
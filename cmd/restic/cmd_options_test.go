@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/options"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestOptionsRegistry(t *testing.T) {
+	namespaces := make(map[string]bool)
+	for _, opt := range options.List() {
+		namespaces[opt.Namespace] = true
+		rtest.Assert(t, opt.Type != "", "option %v.%v has no type", opt.Namespace, opt.Name)
+		rtest.Assert(t, opt.Text != "", "option %v.%v has no help text", opt.Namespace, opt.Name)
+	}
+
+	for _, ns := range []string{"s3", "sftp", "local", "backend", "limit"} {
+		rtest.Assert(t, namespaces[ns], "namespace %v is not registered", ns)
+	}
+
+	opts, err := options.Parse([]string{"s3.connections=10", "local.fsync=false"})
+	rtest.OK(t, err)
+	rtest.OK(t, opts.Check())
+
+	opts, err = options.Parse([]string{"sftp.conections=10"})
+	rtest.OK(t, err)
+	err = opts.Check()
+	rtest.Assert(t, err != nil, "missing error for unknown option")
+	rtest.Assert(t, strings.Contains(err.Error(), "did you mean sftp.connections"), "missing suggestion in error %v", err)
+}
+
+func TestOptionsCommand(t *testing.T) {
+	buf := &bytes.Buffer{}
+	gopts := globalOptions
+	gopts.stdout = buf
+	rtest.OK(t, runOptions(gopts, nil))
+	rtest.Assert(t, strings.Contains(buf.String(), "\nlocal:\n  local.connections"), "missing local options in output:\n%v", buf.String())
+
+	buf.Reset()
+	gopts.JSON = true
+	rtest.OK(t, runOptions(gopts, nil))
+
+	var list []optionJSON
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &list))
+	var found bool
+	for _, opt := range list {
+		if opt.Namespace == "local" && opt.Name == "connections" {
+			found = true
+			rtest.Equals(t, "uint", opt.Type)
+			rtest.Equals(t, "2", opt.Default)
+		}
+	}
+	rtest.Assert(t, found, "option local.connections not found in JSON output")
+}
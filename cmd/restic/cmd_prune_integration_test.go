@@ -3,11 +3,19 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/restic/restic/internal/options"
+	"github.com/restic/restic/internal/prune"
+	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
+	"github.com/restic/restic/internal/ui"
+	"golang.org/x/sync/errgroup"
 )
 
 func testRunPrune(t testing.TB, gopts GlobalOptions, opts PruneOptions) {
@@ -107,6 +115,59 @@ func testPrune(t *testing.T, pruneOpts PruneOptions, checkOpts CheckOptions) {
 
 var pruneDefaultOptions = PruneOptions{MaxUnused: "5%"}
 
+func countBlobCopies(t testing.TB, gopts GlobalOptions) map[restic.BlobHandle]int {
+	repo, err := OpenRepository(context.TODO(), gopts)
+	rtest.OK(t, err)
+	rtest.OK(t, repo.LoadIndex(context.TODO()))
+
+	copies := make(map[restic.BlobHandle]int)
+	repo.Index().Each(context.TODO(), func(blob restic.PackedBlob) {
+		copies[blob.BlobHandle]++
+	})
+	return copies
+}
+
+func TestPruneDuplicates(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, BackupOptions{}, env.gopts)
+
+	// store a second copy of every data blob in new pack files
+	repo, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+	rtest.OK(t, repo.LoadIndex(context.TODO()))
+
+	var wg errgroup.Group
+	repo.StartPackUploader(context.TODO(), &wg)
+	for h, count := range countBlobCopies(t, env.gopts) {
+		rtest.Equals(t, 1, count)
+		if h.Type != restic.DataBlob {
+			continue
+		}
+		buf, err := repo.LoadBlob(context.TODO(), h.Type, h.ID, nil)
+		rtest.OK(t, err)
+		_, _, _, err = repo.SaveBlob(context.TODO(), h.Type, buf, h.ID, true)
+		rtest.OK(t, err)
+	}
+	rtest.OK(t, repo.Flush(context.TODO()))
+
+	for h, count := range countBlobCopies(t, env.gopts) {
+		if h.Type == restic.DataBlob {
+			rtest.Assert(t, count == 2, "expected two copies of blob %v, got %d", h, count)
+		}
+	}
+
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "0%"})
+
+	// exactly one copy of each blob must remain
+	for h, count := range countBlobCopies(t, env.gopts) {
+		rtest.Assert(t, count == 1, "expected one copy of blob %v, got %d", h, count)
+	}
+	rtest.OK(t, runCheck(context.TODO(), CheckOptions{ReadData: true, CheckUnused: true}, env.gopts, nil))
+}
+
 func TestPruneWithDamagedRepository(t *testing.T) {
 	env, cleanup := withTestEnvironment(t)
 	defer cleanup()
@@ -135,7 +196,7 @@ func TestPruneWithDamagedRepository(t *testing.T) {
 		env.gopts.backendTestHook = oldHook
 	}()
 	// prune should fail
-	rtest.Assert(t, runPrune(context.TODO(), pruneDefaultOptions, env.gopts) == errorPacksMissing,
+	rtest.Assert(t, runPrune(context.TODO(), pruneDefaultOptions, env.gopts) == prune.ErrPacksMissing,
 		"prune should have reported index not complete error")
 }
 
@@ -219,3 +280,298 @@ func testEdgeCaseRepo(t *testing.T, tarfile string, optionsCheck CheckOptions, o
 			"prune should have reported an error")
 	}
 }
+
+func countTrash(t testing.TB, env *testEnvironment) int {
+	entries, err := os.ReadDir(filepath.Join(env.repo, "trash"))
+	if os.IsNotExist(err) {
+		return 0
+	}
+	rtest.OK(t, err)
+	return len(entries)
+}
+
+func TestPruneTrash(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	createPrunableRepo(t, env)
+
+	env.gopts.extended = options.Options{"backend.trash": "30d"}
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "0"})
+	trashed := countTrash(t, env)
+	rtest.Assert(t, trashed > 0, "prune did not move any files to the trash")
+	testRunCheck(t, env.gopts)
+
+	// files are kept in the trash until the retention period has passed
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "0", EmptyTrash: true})
+	rtest.Assert(t, countTrash(t, env) >= trashed, "files were removed from the trash too early")
+
+	// emptying the trash requires a retention
+	env.gopts.extended = make(options.Options)
+	err := runPrune(context.TODO(), PruneOptions{MaxUnused: "0", EmptyTrash: true}, env.gopts)
+	rtest.Assert(t, err != nil, "prune --empty-trash without a retention did not fail")
+	rtest.Assert(t, countTrash(t, env) >= trashed, "files were removed from the trash without a retention")
+
+	// with a retention of zero, all files in the trash are removed
+	env.gopts.extended = options.Options{"backend.trash": "0d"}
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "0", EmptyTrash: true})
+	rtest.Equals(t, 0, countTrash(t, env))
+	testRunCheck(t, env.gopts)
+}
+
+func TestTrashUnsupportedBackend(t *testing.T) {
+	for _, scheme := range []string{"rest", "rclone"} {
+		_, err := wrapTrash(nil, scheme, options.Options{"backend.trash": "30d"})
+		rtest.Assert(t, err != nil, "trash was not rejected for %v", scheme)
+	}
+	_, err := wrapTrash(nil, "rest", options.Options{})
+	rtest.OK(t, err)
+}
+
+// snapshotInjectBackend calls inject before the snapshots are listed for the
+// second time.
+type snapshotInjectBackend struct {
+	restic.Backend
+	listed int
+	inject func()
+}
+
+func (be *snapshotInjectBackend) List(ctx context.Context, t restic.FileType, fn func(restic.FileInfo) error) error {
+	if t == restic.SnapshotFile {
+		be.listed++
+		if be.listed == 2 {
+			be.inject()
+		}
+	}
+	return be.Backend.List(ctx, t, fn)
+}
+
+func (be *snapshotInjectBackend) Unwrap() restic.Backend {
+	return be.Backend
+}
+
+func TestPruneRecheckSnapshots(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "2")}, BackupOptions{}, env.gopts)
+	first := testListSnapshots(t, env.gopts, 1)[0]
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "3")}, BackupOptions{}, env.gopts)
+
+	var second restic.ID
+	for _, id := range testListSnapshots(t, env.gopts, 2) {
+		if !id.Equal(first) {
+			second = id
+		}
+	}
+
+	// hide the second snapshot while prune plans which data to remove, as if
+	// it was uploaded by a concurrent backup
+	snapshotFile := filepath.Join(env.repo, "snapshots", second.String())
+	buf, err := os.ReadFile(snapshotFile)
+	rtest.OK(t, err)
+	rtest.OK(t, os.Remove(snapshotFile))
+	hook := func(r restic.Backend) (restic.Backend, error) {
+		return &snapshotInjectBackend{Backend: r, inject: func() {
+			rtest.OK(t, os.WriteFile(snapshotFile, buf, 0600))
+		}}, nil
+	}
+
+	gopts := env.gopts
+	gopts.backendTestHook = hook
+	err = runPrune(context.TODO(), PruneOptions{MaxUnused: "0"}, gopts)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "was added while pruning"),
+		"expected prune to abort, got %v", err)
+	testListSnapshots(t, env.gopts, 2)
+	testRunCheck(t, env.gopts)
+
+	// without the recheck, the data of the second snapshot is removed
+	rtest.OK(t, os.Remove(snapshotFile))
+	gopts.extended = options.Options{"prune.recheck": "false"}
+	rtest.OK(t, runPrune(context.TODO(), PruneOptions{MaxUnused: "0"}, gopts))
+	rtest.OK(t, os.WriteFile(snapshotFile, buf, 0600))
+	rtest.Assert(t, runCheck(context.TODO(), CheckOptions{}, env.gopts, nil) != nil,
+		"expected check to fail after removing data of the second snapshot")
+}
+
+func TestPruneProgressJSON(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	createPrunableRepo(t, env)
+
+	buf, err := withCaptureStdout(func() error {
+		gopts := env.gopts
+		gopts.JSON = true
+		gopts.Quiet = false
+		testRunPrune(t, gopts, PruneOptions{MaxUnused: "0%"})
+		return nil
+	})
+	rtest.OK(t, err)
+
+	checkPhaseProgress(t, buf.Bytes(), "find-used-blobs", false)
+	checkPhaseProgress(t, buf.Bytes(), "repack", true)
+	checkPhaseProgress(t, buf.Bytes(), "rebuild-index", false)
+}
+
+func TestForgetPruneDryRunForecast(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	for _, dir := range []string{"", "2", "3"} {
+		testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", dir)}, BackupOptions{}, env.gopts)
+	}
+
+	// forget --keep-last 1 removes all but the latest snapshot
+	ids := restic.NewIDSet(testListSnapshots(t, env.gopts, 3)...)
+	// forget and prune both list the snapshots
+	gopts := env.gopts
+	gopts.backendTestHook = nil
+	repo, err := OpenRepository(context.TODO(), gopts)
+	rtest.OK(t, err)
+	sn, _, err := (&restic.SnapshotFilter{}).FindLatest(context.TODO(), repo.Backend(), repo, "latest")
+	rtest.OK(t, err)
+	ids.Delete(*sn.ID())
+
+	defer func(opts PruneOptions) { pruneOptions = opts }(pruneOptions)
+	pruneOptions = PruneOptions{MaxUnused: "0%"}
+	rtest.OK(t, verifyPruneOptions(&pruneOptions))
+
+	// plan the prune for the snapshots which forget will remove
+	rtest.OK(t, repo.LoadIndex(context.TODO()))
+	plan, err := prune.NewPlan(context.TODO(), pruneOptions.pruneOptions(), repo, ids, newPrunePrinter(gopts))
+	rtest.OK(t, err)
+	stats := plan.Stats()
+	totalBlobs := stats.Blobs.Used + stats.Blobs.Unused + stats.Blobs.Duplicate
+	remainingBlobs := totalBlobs - (stats.Blobs.Remove + stats.Blobs.Repackrm)
+	rtest.Assert(t, stats.Blobs.Remove+stats.Blobs.Repackrm > 0, "nothing to prune")
+
+	// the dry run prints the same forecast without modifying the repository
+	buf, err := withCaptureStdout(func() error {
+		globalOptions.verbosity = 1
+		return runForget(context.TODO(), ForgetOptions{Last: 1, DryRun: true, Prune: true}, gopts, nil)
+	})
+	rtest.OK(t, err)
+	forecast := fmt.Sprintf("total prune:  %10d blobs / %s", stats.Blobs.Remove+stats.Blobs.Repackrm,
+		ui.FormatBytes(stats.Size.Remove+stats.Size.Repackrm+stats.Size.Unref))
+	rtest.Assert(t, strings.Contains(buf.String(), "Would have made the following changes"), "missing dry run output:\n%v", buf)
+	rtest.Assert(t, strings.Contains(buf.String(), forecast), "missing %q in output:\n%v", forecast, buf)
+	testListSnapshots(t, env.gopts, 3)
+	rtest.Equals(t, totalBlobs, uint(countBlobs(t, env.gopts)))
+
+	// the actual forget and prune matches the forecast
+	rtest.OK(t, runForget(context.TODO(), ForgetOptions{Last: 1, Prune: true}, gopts, nil))
+	testListSnapshots(t, env.gopts, 1)
+	rtest.Equals(t, remainingBlobs, uint(countBlobs(t, env.gopts)))
+
+	removed := plan.RemovedPacks()
+	packs := testRunList(t, "packs", env.gopts)
+	for _, id := range packs {
+		rtest.Assert(t, !removed.Has(id), "pack %v should have been removed", id)
+	}
+	testRunCheck(t, env.gopts)
+}
+
+func countBlobs(t testing.TB, gopts GlobalOptions) int {
+	n := 0
+	for _, c := range countBlobCopies(t, gopts) {
+		n += c
+	}
+	return n
+}
+
+func countUncompressedBlobs(t testing.TB, gopts GlobalOptions) int {
+	repo, err := OpenRepository(context.TODO(), gopts)
+	rtest.OK(t, err)
+	rtest.OK(t, repo.LoadIndex(context.TODO()))
+
+	n := 0
+	repo.Index().Each(context.TODO(), func(blob restic.PackedBlob) {
+		if !blob.IsCompressed() {
+			n++
+		}
+	})
+	return n
+}
+
+// listTreeStats returns the statistics recorded in the index for all tree blobs.
+func listTreeStats(t testing.TB, gopts GlobalOptions) map[restic.ID]restic.TreeStats {
+	repo, err := OpenRepository(context.TODO(), gopts)
+	rtest.OK(t, err)
+	rtest.OK(t, repo.LoadIndex(context.TODO()))
+
+	trees := restic.NewIDSet()
+	repo.Index().Each(context.TODO(), func(blob restic.PackedBlob) {
+		if blob.Type == restic.TreeBlob {
+			trees.Insert(blob.ID)
+		}
+	})
+
+	stats := make(map[restic.ID]restic.TreeStats)
+	for id := range trees {
+		if s, ok := repo.Index().LookupTreeStats(id); ok {
+			stats[id] = s
+		}
+	}
+	return stats
+}
+
+func TestPruneRepackUncompressed(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	repository.TestUseLowSecurityKDFParameters(t)
+	restic.TestDisableCheckPolynomial(t)
+	restic.TestSetLockTimeout(t, 0)
+	rtest.OK(t, runInit(context.TODO(), InitOptions{RepositoryVersion: "1"}, env.gopts, nil))
+
+	rtest.SetupTarTestFixture(t, env.testdata, filepath.Join("testdata", "backup-data.tar.gz"))
+	target := filepath.Join(env.testdata, "0", "0", "9")
+	testRunBackup(t, "", []string{target}, BackupOptions{}, env.gopts)
+	snapshotID := testListSnapshots(t, env.gopts, 1)[0]
+
+	// the repository must be upgraded before its data can be compressed
+	err := runPrune(context.TODO(), PruneOptions{MaxUnused: "5%", RepackUncompressed: true}, env.gopts)
+	rtest.Assert(t, err != nil, "prune --repack-uncompressed on a v1 repository did not fail")
+
+	env.gopts.backendTestHook = nil
+	out := testRunMigrate(t, env.gopts, "upgrade_repo_v2")
+	rtest.Assert(t, strings.Contains(out, "migration upgrade_repo_v2: success"), "unexpected output:\n%v", out)
+	rtest.Assert(t, countUncompressedBlobs(t, env.gopts) > 0, "expected uncompressed blobs after upgrade")
+	treeStats := listTreeStats(t, env.gopts)
+	rtest.Assert(t, len(treeStats) > 0, "backup did not record tree statistics")
+
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "5%", RepackUncompressed: true})
+	rtest.Equals(t, 0, countUncompressedBlobs(t, env.gopts))
+	// the statistics are kept for the repacked tree blobs
+	rtest.Equals(t, treeStats, listTreeStats(t, env.gopts))
+	testRunCheck(t, env.gopts)
+
+	restoredir := filepath.Join(env.base, "restore")
+	testRunRestore(t, env.gopts, restoredir, snapshotID)
+	diff := directoriesContentsDiff(target, filepath.Join(restoredir, target))
+	rtest.Assert(t, diff == "", "restored directory differs:\n%v", diff)
+}
+
+func TestPruneCacheUsedBlobs(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "2")}, BackupOptions{}, env.gopts)
+	first := testListSnapshots(t, env.gopts, 1)[0]
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "3")}, BackupOptions{}, env.gopts)
+
+	gopts := env.gopts
+	gopts.extended = options.Options{"prune.cache-used-blobs": "true"}
+	// fill the cache, then prune using it
+	testRunPrune(t, gopts, PruneOptions{MaxUnused: "0"})
+	testRunCheck(t, env.gopts)
+
+	testRunForget(t, env.gopts, first.String())
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, BackupOptions{}, env.gopts)
+	testRunPrune(t, gopts, PruneOptions{MaxUnused: "0"})
+	testRunCheck(t, env.gopts)
+}
@@ -36,6 +36,10 @@ func init() {
 }
 
 func runRecover(ctx context.Context, gopts GlobalOptions) error {
+	if err := checkReadOnly(gopts, "recover"); err != nil {
+		return err
+	}
+
 	hostname, err := os.Hostname()
 	if err != nil {
 		return err
@@ -73,7 +77,7 @@ func runRecover(ctx context.Context, gopts GlobalOptions) error {
 	})
 
 	Verbosef("load %d trees\n", len(trees))
-	bar := newProgressMax(!gopts.Quiet, uint64(len(trees)), "trees loaded")
+	bar := newProgressMax(gopts, !gopts.Quiet, uint64(len(trees)), "trees loaded")
 	for id := range trees {
 		tree, err := restic.LoadTree(ctx, repo, id)
 		if err != nil {
@@ -92,6 +96,11 @@ func runRecover(ctx context.Context, gopts GlobalOptions) error {
 
 	Verbosef("load snapshots\n")
 	err = restic.ForAllSnapshots(ctx, snapshotLister, repo, nil, func(id restic.ID, sn *restic.Snapshot, err error) error {
+		if err != nil {
+			// the trees of a damaged snapshot are recovered
+			warnSnapshotLoadError(id, err)
+			return nil
+		}
 		trees[*sn.Tree] = true
 		return nil
 	})
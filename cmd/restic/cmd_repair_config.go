@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/restic/chunker"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/spf13/cobra"
+)
+
+var cmdRepairConfig = &cobra.Command{
+	Use:   "config [flags]",
+	Short: "Rewrite a damaged repository config",
+	Long: `
+The "repair config" command writes a new config for a repository whose config
+file is damaged or contains invalid values. The repository version and the
+chunker polynomial are either specified using "--repository-version" and
+"--chunker-polynomial", or they are copied from a secondary repository, for
+example a repository which was initialized using "init --copy-chunker-params".
+
+The repository version must not be lower than the version the repository was
+created with. Using a different chunker polynomial than the original one does
+not damage the repository, but new data will not be deduplicated against the
+existing data.
+
+The config is only written if "--force" is specified.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful, and non-zero if there was any error.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runRepairConfig(cmd.Context(), repairConfigOptions, globalOptions, args)
+	},
+}
+
+// RepairConfigOptions collects all options for the repair config command.
+type RepairConfigOptions struct {
+	secondaryRepoOptions
+	RepositoryVersion string
+	ChunkerPolynomial string
+	Force             bool
+}
+
+var repairConfigOptions RepairConfigOptions
+
+func init() {
+	cmdRepair.AddCommand(cmdRepairConfig)
+
+	f := cmdRepairConfig.Flags()
+	initSecondaryRepoOptions(f, &repairConfigOptions.secondaryRepoOptions, "secondary", "to copy the repository version and chunker parameters from")
+	f.StringVar(&repairConfigOptions.RepositoryVersion, "repository-version", "", "repository format `version` to write to the config")
+	f.StringVar(&repairConfigOptions.ChunkerPolynomial, "chunker-polynomial", "", "chunker `polynomial` to write to the config, as hexadecimal number")
+	f.BoolVar(&repairConfigOptions.Force, "force", false, "overwrite the config of the repository")
+}
+
+func runRepairConfig(ctx context.Context, opts RepairConfigOptions, gopts GlobalOptions, args []string) error {
+	if len(args) > 0 {
+		return invalidArguments(errors.Fatal("the repair config command expects no arguments, only options - please see `restic help repair config` for usage and flags"))
+	}
+
+	if err := checkAppendOnly(gopts, "repair config"); err != nil {
+		return err
+	}
+	if err := checkReadOnly(gopts, "repair config"); err != nil {
+		return err
+	}
+
+	cfg, err := newRepairConfig(ctx, opts, gopts)
+	if err != nil {
+		return err
+	}
+
+	repo, err := openRepository(ctx, gopts, true)
+	if err != nil {
+		return err
+	}
+
+	lock, ctx, err := lockRepoExclusive(ctx, repo, gopts.RetryLock, gopts.JSON)
+	defer unlockRepo(lock)
+	if err != nil {
+		return err
+	}
+
+	if repo.Config().Version != 0 {
+		return errors.Fatal("the repository config is valid, refusing to overwrite it")
+	}
+
+	Printf("new config: repository version %v, chunker polynomial %v\n", cfg.Version, cfg.ChunkerPolynomial)
+	if !opts.Force {
+		return errors.Fatal("the config was not written, use --force to overwrite the config")
+	}
+
+	err = restic.SaveConfig(ctx, repo, cfg)
+	if err != nil {
+		return errors.Fatalf("saving config failed: %v", err)
+	}
+
+	Verbosef("saved new config with ID %v\n", cfg.ID[:10])
+	return nil
+}
+
+// newRepairConfig returns the config to write, based on the options or on
+// the config of the secondary repository.
+func newRepairConfig(ctx context.Context, opts RepairConfigOptions, gopts GlobalOptions) (restic.Config, error) {
+	var cfg restic.Config
+
+	if opts.Repo != "" || opts.RepositoryFile != "" || opts.LegacyRepo != "" || opts.LegacyRepositoryFile != "" {
+		otherGopts, _, err := fillSecondaryGlobalOpts(opts.secondaryRepoOptions, gopts, "secondary")
+		if err != nil {
+			return restic.Config{}, err
+		}
+
+		otherRepo, err := OpenRepository(ctx, otherGopts)
+		if err != nil {
+			return restic.Config{}, err
+		}
+		cfg.Version = otherRepo.Config().Version
+		cfg.ChunkerPolynomial = otherRepo.Config().ChunkerPolynomial
+	}
+
+	if opts.RepositoryVersion != "" {
+		v, err := strconv.ParseUint(opts.RepositoryVersion, 10, 32)
+		if err != nil {
+			return restic.Config{}, invalidArguments(errors.Fatal("invalid repository version"))
+		}
+		cfg.Version = uint(v)
+	}
+
+	if opts.ChunkerPolynomial != "" {
+		p, err := strconv.ParseUint(strings.TrimPrefix(opts.ChunkerPolynomial, "0x"), 16, 64)
+		if err != nil {
+			return restic.Config{}, invalidArguments(errors.Fatal("invalid chunker polynomial"))
+		}
+		cfg.ChunkerPolynomial = chunker.Pol(p)
+	}
+
+	if cfg.Version == 0 || cfg.ChunkerPolynomial == 0 {
+		return restic.Config{}, invalidArguments(errors.Fatal("the repository version and chunker polynomial must be specified, either directly or using a secondary repository"))
+	}
+
+	err := restic.CheckConfig(cfg)
+	if err != nil {
+		return restic.Config{}, errors.Fatal(err.Error())
+	}
+
+	cfg.ID = restic.NewRandomID().String()
+	return cfg, nil
+}
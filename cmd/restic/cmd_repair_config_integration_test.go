@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func testRunRepairConfig(gopts GlobalOptions, opts RepairConfigOptions) error {
+	return withRestoreGlobalOptions(func() error {
+		return runRepairConfig(context.TODO(), opts, gopts, nil)
+	})
+}
+
+// testCorruptConfig flips a bit in the config file of the repository.
+func testCorruptConfig(t testing.TB, env *testEnvironment) {
+	fn := filepath.Join(env.repo, "config")
+	buf, err := os.ReadFile(fn)
+	rtest.OK(t, err)
+	buf[len(buf)/2] ^= 0x01
+	rtest.OK(t, os.Chmod(fn, 0644))
+	rtest.OK(t, os.WriteFile(fn, buf, 0644))
+}
+
+func testLoadConfig(t testing.TB, gopts GlobalOptions) restic.Config {
+	repo, err := OpenRepository(context.TODO(), gopts)
+	rtest.OK(t, err)
+	return repo.Config()
+}
+
+func TestRepairConfig(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	cfg := testLoadConfig(t, env.gopts)
+
+	testCorruptConfig(t, env)
+
+	_, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "repair config"),
+		"expected hint for repair config, got %v", err)
+
+	opts := RepairConfigOptions{
+		RepositoryVersion: "2",
+		ChunkerPolynomial: cfg.ChunkerPolynomial.String(),
+	}
+
+	// the config must only be written with --force
+	err = testRunRepairConfig(env.gopts, opts)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "--force"), "expected error, got %v", err)
+	_, err = OpenRepository(context.TODO(), env.gopts)
+	rtest.Assert(t, err != nil, "expected config to stay damaged")
+
+	opts.Force = true
+	rtest.OK(t, testRunRepairConfig(env.gopts, opts))
+
+	newCfg := testLoadConfig(t, env.gopts)
+	rtest.Equals(t, cfg.Version, newCfg.Version)
+	rtest.Equals(t, cfg.ChunkerPolynomial, newCfg.ChunkerPolynomial)
+	testRunCheck(t, env.gopts)
+
+	// a valid config is never overwritten
+	err = testRunRepairConfig(env.gopts, opts)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "valid"), "expected error, got %v", err)
+}
+
+func TestRepairConfigFromSecondaryRepo(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	env2, cleanup2 := withTestEnvironment(t)
+	defer cleanup2()
+
+	testRunInit(t, env.gopts)
+	cfg := testLoadConfig(t, env.gopts)
+
+	initOpts := InitOptions{
+		secondaryRepoOptions: secondaryRepoOptions{
+			Repo:     env.gopts.Repo,
+			password: env.gopts.password,
+		},
+		CopyChunkerParameters: true,
+	}
+	rtest.OK(t, runInit(context.TODO(), initOpts, env2.gopts, nil))
+
+	testCorruptConfig(t, env)
+
+	opts := RepairConfigOptions{
+		secondaryRepoOptions: secondaryRepoOptions{
+			Repo:     env2.gopts.Repo,
+			password: env2.gopts.password,
+		},
+		Force: true,
+	}
+	rtest.OK(t, testRunRepairConfig(env.gopts, opts))
+
+	newCfg := testLoadConfig(t, env.gopts)
+	rtest.Equals(t, cfg.Version, newCfg.Version)
+	rtest.Equals(t, cfg.ChunkerPolynomial, newCfg.ChunkerPolynomial)
+	testRunCheck(t, env.gopts)
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/restic/restic/internal/index"
 	"github.com/restic/restic/internal/pack"
+	"github.com/restic/restic/internal/prune"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	"github.com/spf13/cobra"
@@ -56,6 +57,13 @@ func init() {
 }
 
 func runRebuildIndex(ctx context.Context, opts RepairIndexOptions, gopts GlobalOptions) error {
+	if err := checkAppendOnly(gopts, "repair index"); err != nil {
+		return err
+	}
+	if err := checkReadOnly(gopts, "repair index"); err != nil {
+		return err
+	}
+
 	repo, err := OpenRepository(ctx, gopts)
 	if err != nil {
 		return err
@@ -77,9 +85,19 @@ func rebuildIndex(ctx context.Context, opts RepairIndexOptions, gopts GlobalOpti
 	removePacks := restic.NewIDSet()
 
 	if opts.ReadAllPacks {
-		// get list of old index files but start with empty index
-		err := repo.List(ctx, restic.IndexFile, func(id restic.ID, size int64) error {
+		// get list of old index files but start with empty index. The
+		// statistics of tree blobs cannot be recovered from the pack files,
+		// keep those recorded in the readable index files.
+		err := index.ForAllIndexes(ctx, repo, func(id restic.ID, idx *index.Index, oldFormat bool, err error) error {
 			obsoleteIndexes = append(obsoleteIndexes, id)
+			if err != nil {
+				return nil
+			}
+			for pbs := range idx.EachByPack(ctx, nil) {
+				for treeID, stats := range pbs.TreeStats {
+					repo.Index().AddTreeStats(treeID, stats)
+				}
+			}
 			return nil
 		})
 		if err != nil {
@@ -142,7 +160,7 @@ func rebuildIndex(ctx context.Context, opts RepairIndexOptions, gopts GlobalOpti
 
 	if len(packSizeFromList) > 0 {
 		Verbosef("reading pack files\n")
-		bar := newProgressMax(!gopts.Quiet, uint64(len(packSizeFromList)), "packs")
+		bar := newProgressMax(gopts, !gopts.Quiet, uint64(len(packSizeFromList)), "packs")
 		invalidFiles, err := repo.CreateIndexFromPacks(ctx, packSizeFromList, bar)
 		bar.Done()
 		if err != nil {
@@ -150,11 +168,11 @@ func rebuildIndex(ctx context.Context, opts RepairIndexOptions, gopts GlobalOpti
 		}
 
 		for _, id := range invalidFiles {
-			Verboseff("skipped incomplete pack file: %v\n", id)
+			Verboseff("skipped incomplete or damaged pack file: %v\n", id)
 		}
 	}
 
-	err = rebuildIndexFiles(ctx, gopts, repo, removePacks, obsoleteIndexes)
+	err = prune.RebuildIndexFiles(ctx, repo, removePacks, obsoleteIndexes, newPrunePrinter(gopts))
 	if err != nil {
 		return err
 	}
@@ -59,6 +59,24 @@ func TestRebuildIndex(t *testing.T) {
 	testRebuildIndex(t, nil)
 }
 
+func TestRebuildIndexTreeStats(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	treeStats := listTreeStats(t, env.gopts)
+	rtest.Assert(t, len(treeStats) > 0, "backup did not record tree statistics")
+
+	for _, readAllPacks := range []bool{false, true} {
+		rtest.OK(t, withRestoreGlobalOptions(func() error {
+			globalOptions.stdout = io.Discard
+			return runRebuildIndex(context.TODO(), RepairIndexOptions{ReadAllPacks: readAllPacks}, env.gopts)
+		}))
+		rtest.Equals(t, treeStats, listTreeStats(t, env.gopts))
+	}
+}
+
 func TestRebuildIndexAlwaysFull(t *testing.T) {
 	indexFull := index.IndexFull
 	defer func() {
@@ -67,6 +67,17 @@ func init() {
 }
 
 func runRepairSnapshots(ctx context.Context, gopts GlobalOptions, opts RepairOptions, args []string) error {
+	if opts.Forget && !opts.DryRun {
+		if err := checkAppendOnly(gopts, "repair snapshots --forget"); err != nil {
+			return err
+		}
+	}
+	if !opts.DryRun {
+		if err := checkReadOnly(gopts, "repair snapshots"); err != nil {
+			return err
+		}
+	}
+
 	repo, err := OpenRepository(ctx, gopts)
 	if err != nil {
 		return err
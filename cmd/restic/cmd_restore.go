@@ -2,8 +2,11 @@ package main
 
 import (
 	"context"
-	"strings"
+	"fmt"
+	"path"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/restic/restic/internal/debug"
@@ -16,6 +19,7 @@ import (
 	"github.com/restic/restic/internal/ui/termstatus"
 
 	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
 )
 
 var cmdRestore = &cobra.Command{
@@ -26,7 +30,12 @@ The "restore" command extracts the data from a snapshot from the repository to
 a directory.
 
 The special snapshot "latest" can be used to restore the latest snapshot in the
-repository.
+repository, "latest~N" refers to the snapshot N snapshots before it.
+
+If the repository is stored in a cold storage class like S3 Glacier, the files
+needed for the restore must be warmed up first. With "--warmup-only", the
+command requests the warm-up of all pack files needed to restore the snapshot
+and reports how many of them can already be read, without restoring anything.
 
 EXIT STATUS
 ===========
@@ -44,7 +53,7 @@ Exit status is 0 if the command was successful, and non-zero if there was any er
 			wg.Wait()
 		}()
 
-		term := termstatus.New(globalOptions.stdout, globalOptions.stderr, globalOptions.Quiet)
+		term := termstatus.New(globalOptions.stdout, globalOptions.stderr, globalOptions.Quiet || globalOptions.NoProgress)
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
@@ -71,10 +80,18 @@ type RestoreOptions struct {
 	InsensitiveInclude []string
 	Target             string
 	restic.SnapshotFilter
-	Sparse bool
-	Verify bool
+	Sparse     bool
+	Verify     bool
+	WarmupOnly bool
+	// RewriteSymlinks selects how symlink targets are rewritten, see
+	// rewriteSymlinksAbsoluteToTarget
+	RewriteSymlinks string
 }
 
+// rewriteSymlinksAbsoluteToTarget rewrites absolute symlink targets which point
+// into the backed up paths such that they point into the restore target.
+const rewriteSymlinksAbsoluteToTarget = "absolute-to-target"
+
 var restoreOptions RestoreOptions
 
 func init() {
@@ -90,6 +107,8 @@ func init() {
 	initSingleSnapshotFilter(flags, &restoreOptions.SnapshotFilter)
 	flags.BoolVar(&restoreOptions.Sparse, "sparse", false, "restore files as sparse")
 	flags.BoolVar(&restoreOptions.Verify, "verify", false, "verify restored files content")
+	flags.BoolVar(&restoreOptions.WarmupOnly, "warmup-only", false, "only request the warm-up of the files needed for the restore from cold storage")
+	flags.StringVar(&restoreOptions.RewriteSymlinks, "rewrite-symlinks", "", "rewrite symlink targets, `mode` 'absolute-to-target' rewrites absolute targets within the backed up paths to point into the target directory")
 }
 
 func runRestore(ctx context.Context, opts RestoreOptions, gopts GlobalOptions,
@@ -101,46 +120,42 @@ func runRestore(ctx context.Context, opts RestoreOptions, gopts GlobalOptions,
 	// Validate provided patterns
 	if len(opts.Exclude) > 0 {
 		if err := filter.ValidatePatterns(opts.Exclude); err != nil {
-			return errors.Fatalf("--exclude: %s", err)
+			return invalidArgumentsf("--exclude: %s", err)
 		}
 	}
 	if len(opts.InsensitiveExclude) > 0 {
 		if err := filter.ValidatePatterns(opts.InsensitiveExclude); err != nil {
-			return errors.Fatalf("--iexclude: %s", err)
+			return invalidArgumentsf("--iexclude: %s", err)
 		}
 	}
 	if len(opts.Include) > 0 {
 		if err := filter.ValidatePatterns(opts.Include); err != nil {
-			return errors.Fatalf("--include: %s", err)
+			return invalidArgumentsf("--include: %s", err)
 		}
 	}
 	if len(opts.InsensitiveInclude) > 0 {
 		if err := filter.ValidatePatterns(opts.InsensitiveInclude); err != nil {
-			return errors.Fatalf("--iinclude: %s", err)
+			return invalidArgumentsf("--iinclude: %s", err)
 		}
 	}
 
-	for i, str := range opts.InsensitiveExclude {
-		opts.InsensitiveExclude[i] = strings.ToLower(str)
-	}
-
-	for i, str := range opts.InsensitiveInclude {
-		opts.InsensitiveInclude[i] = strings.ToLower(str)
-	}
-
 	switch {
 	case len(args) == 0:
-		return errors.Fatal("no snapshot ID specified")
+		return invalidArguments(errors.Fatal("no snapshot ID specified"))
 	case len(args) > 1:
-		return errors.Fatalf("more than one snapshot ID specified: %v", args)
+		return invalidArgumentsf("more than one snapshot ID specified: %v", args)
 	}
 
-	if opts.Target == "" {
-		return errors.Fatal("please specify a directory to restore to (--target)")
+	if opts.Target == "" && !opts.WarmupOnly {
+		return invalidArguments(errors.Fatal("please specify a directory to restore to (--target)"))
 	}
 
 	if hasExcludes && hasIncludes {
-		return errors.Fatal("exclude and include patterns are mutually exclusive")
+		return invalidArguments(errors.Fatal("exclude and include patterns are mutually exclusive"))
+	}
+
+	if opts.RewriteSymlinks != "" && opts.RewriteSymlinks != rewriteSymlinksAbsoluteToTarget {
+		return invalidArgumentsf("invalid mode %q for --rewrite-symlinks, only %q is supported", opts.RewriteSymlinks, rewriteSymlinksAbsoluteToTarget)
 	}
 
 	snapshotIDString := args[0]
@@ -162,9 +177,10 @@ func runRestore(ctx context.Context, opts RestoreOptions, gopts GlobalOptions,
 	}
 
 	sn, subfolder, err := (&restic.SnapshotFilter{
-		Hosts: opts.Hosts,
-		Paths: opts.Paths,
-		Tags:  opts.Tags,
+		Hosts:       opts.Hosts,
+		Paths:       opts.Paths,
+		Tags:        opts.Tags,
+		LoadErrorFn: warnSnapshotLoadError,
 	}).FindLatest(ctx, repo.Backend(), repo, snapshotIDString)
 	if err != nil {
 		return errors.Fatalf("failed to find snapshot: %v", err)
@@ -175,38 +191,64 @@ func runRestore(ctx context.Context, opts RestoreOptions, gopts GlobalOptions,
 		return err
 	}
 
+	if opts.RewriteSymlinks == rewriteSymlinksAbsoluteToTarget {
+		err = checkSnapshotContainsPaths(ctx, repo, sn)
+		if err != nil {
+			return err
+		}
+	}
+
 	sn.Tree, err = restic.FindTreeDirectory(ctx, repo, sn.Tree, subfolder)
 	if err != nil {
 		return err
 	}
 
 	msg := ui.NewMessage(term, gopts.verbosity)
-	var printer restoreui.ProgressPrinter
-	if gopts.JSON {
-		printer = restoreui.NewJSONProgress(term)
-	} else {
-		printer = restoreui.NewTextProgress(term)
-	}
+	var progress *restoreui.Progress
+	if !opts.WarmupOnly {
+		var printer restoreui.ProgressPrinter
+		if gopts.JSON {
+			printer = restoreui.NewJSONProgress(term)
+		} else {
+			printer = restoreui.NewTextProgress(term)
+		}
 
-	progress := restoreui.NewProgress(printer, calculateProgressInterval(!gopts.Quiet, gopts.JSON))
+		progress = restoreui.NewProgress(printer, calculateProgressInterval(gopts, !gopts.Quiet, gopts.JSON))
+		defer ui.RegisterStatus(progress.Status)()
+	}
 	res := restorer.NewRestorer(repo, sn, opts.Sparse, progress)
+	if opts.RewriteSymlinks == rewriteSymlinksAbsoluteToTarget {
+		res.RewriteSymlink = restorer.RewriteAbsoluteToTarget(sn.Paths, subfolder, func(location, linkTarget string) {
+			if !gopts.JSON {
+				msg.P("not rewriting symlink %s, target %s is outside of the snapshot\n",
+					ui.EscapeInvalidUTF8(location), ui.EscapeInvalidUTF8(linkTarget))
+			}
+		})
+	}
 
 	totalErrors := 0
+	coldErrors := 0
 	res.Error = func(location string, err error) error {
-		msg.E("ignoring error for %s: %s\n", location, err)
+		msg.E("ignoring error for %s: %s\n", ui.EscapeInvalidUTF8(location), err)
+		if progress != nil {
+			progress.Error(location, err)
+		}
 		totalErrors++
+		if errors.Is(err, restic.ErrColdStorage) {
+			coldErrors++
+		}
 		return nil
 	}
 
 	excludePatterns := filter.ParsePatterns(opts.Exclude)
-	insensitiveExcludePatterns := filter.ParsePatterns(opts.InsensitiveExclude)
+	insensitiveExcludePatterns := filter.ParseInsensitivePatterns(opts.InsensitiveExclude)
 	selectExcludeFilter := func(item string, dstpath string, node *restic.Node) (selectedForRestore bool, childMayBeSelected bool) {
 		matched, err := filter.List(excludePatterns, item)
 		if err != nil {
 			msg.E("error for exclude pattern: %v", err)
 		}
 
-		matchedInsensitive, err := filter.List(insensitiveExcludePatterns, strings.ToLower(item))
+		matchedInsensitive, err := filter.List(insensitiveExcludePatterns, item)
 		if err != nil {
 			msg.E("error for iexclude pattern: %v", err)
 		}
@@ -222,16 +264,16 @@ func runRestore(ctx context.Context, opts RestoreOptions, gopts GlobalOptions,
 	}
 
 	includePatterns := filter.ParsePatterns(opts.Include)
-	insensitiveIncludePatterns := filter.ParsePatterns(opts.InsensitiveInclude)
+	insensitiveIncludePatterns := filter.ParseInsensitivePatterns(opts.InsensitiveInclude)
 	selectIncludeFilter := func(item string, dstpath string, node *restic.Node) (selectedForRestore bool, childMayBeSelected bool) {
 		matched, childMayMatch, err := filter.ListWithChild(includePatterns, item)
 		if err != nil {
 			msg.E("error for include pattern: %v", err)
 		}
 
-		matchedInsensitive, childMayMatchInsensitive, err := filter.ListWithChild(insensitiveIncludePatterns, strings.ToLower(item))
+		matchedInsensitive, childMayMatchInsensitive, err := filter.ListWithChild(insensitiveIncludePatterns, item)
 		if err != nil {
-			msg.E("error for iexclude pattern: %v", err)
+			msg.E("error for iinclude pattern: %v", err)
 		}
 
 		selectedForRestore = matched || matchedInsensitive
@@ -246,6 +288,10 @@ func runRestore(ctx context.Context, opts RestoreOptions, gopts GlobalOptions,
 		res.SelectFilter = selectIncludeFilter
 	}
 
+	if opts.WarmupOnly {
+		return warmupRestore(ctx, repo, res, msg)
+	}
+
 	if !gopts.JSON {
 		msg.P("restoring %s to %s\n", res.Snapshot(), opts.Target)
 	}
@@ -255,8 +301,16 @@ func runRestore(ctx context.Context, opts RestoreOptions, gopts GlobalOptions,
 		return err
 	}
 
+	if transfer, ok := transferStats(repo); ok {
+		progress.SetTransferStats(transfer)
+	}
 	progress.Finish()
 
+	if coldErrors > 0 {
+		msg.E("%d files could not be read because they are in cold storage, run `restic restore --warmup-only %s` and retry once the files are available\n",
+			coldErrors, snapshotIDString)
+	}
+
 	if totalErrors > 0 {
 		return errors.Fatalf("There were %d errors\n", totalErrors)
 	}
@@ -283,3 +337,82 @@ func runRestore(ctx context.Context, opts RestoreOptions, gopts GlobalOptions,
 
 	return nil
 }
+
+// checkSnapshotContainsPaths verifies that the tree of sn contains the
+// backed up paths at their absolute location. This is not the case for
+// snapshots of relative paths, then the original location of a file cannot be
+// determined.
+func checkSnapshotContainsPaths(ctx context.Context, repo restic.Repository, sn *restic.Snapshot) error {
+	for _, p := range sn.Paths {
+		dir, name := path.Split(path.Clean(filepath.ToSlash(p)))
+		if name == "" {
+			// the root directory
+			continue
+		}
+
+		id, err := restic.FindTreeDirectory(ctx, repo, sn.Tree, dir)
+		if err == nil {
+			var tree *restic.Tree
+			tree, err = restic.LoadTree(ctx, repo, *id)
+			if err == nil && tree.Find(name) != nil {
+				continue
+			}
+		}
+		debug.Log("path %v not found in snapshot: %v", p, err)
+		return errors.Fatalf("--rewrite-symlinks: path %v is not stored at its absolute location in the snapshot, was it backed up using a relative path?", p)
+	}
+	return nil
+}
+
+// warmupRestore requests the warm-up of all pack files needed by res.
+func warmupRestore(ctx context.Context, repo restic.Repository, res *restorer.Restorer, msg *ui.Message) error {
+	warmer := restic.AsBackend[restic.Warmer](repo.Backend())
+	if warmer == nil {
+		return errors.Fatal("the backend does not support warming up files")
+	}
+
+	packs, err := res.PackFiles(ctx)
+	if err != nil {
+		return err
+	}
+
+	var ready uint64
+	wg, wgCtx := errgroup.WithContext(ctx)
+	ch := make(chan restic.ID)
+
+	wg.Go(func() error {
+		defer close(ch)
+		for id := range packs {
+			select {
+			case ch <- id:
+			case <-wgCtx.Done():
+				return wgCtx.Err()
+			}
+		}
+		return nil
+	})
+
+	for i := 0; i < int(repo.Connections()); i++ {
+		wg.Go(func() error {
+			for id := range ch {
+				ok, err := warmer.WarmupFile(wgCtx, restic.Handle{Type: restic.PackFile, Name: id.String()})
+				if err != nil {
+					return fmt.Errorf("warmup of pack %v failed: %w", id.Str(), err)
+				}
+				if ok {
+					atomic.AddUint64(&ready, 1)
+				}
+			}
+			return nil
+		})
+	}
+
+	err = wg.Wait()
+	if err != nil {
+		return err
+	}
+
+	msg.P("%d of %d pack files are ready to be restored, warm-up requested for the remaining %d\n",
+		ready, len(packs), uint64(len(packs))-ready)
+	return nil
+}
@@ -1,15 +1,22 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	mrand "math/rand"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 	"syscall"
 	"testing"
 	"time"
+	"unicode/utf8"
 
 	"github.com/restic/restic/internal/filter"
 	"github.com/restic/restic/internal/restic"
@@ -107,6 +114,63 @@ func TestRestoreFilter(t *testing.T) {
 	}
 }
 
+func TestRestoreInsensitiveFilter(t *testing.T) {
+	testfiles := []string{
+		"Photos/IMG_0001.JPG",
+		"Photos/img_0002.jpg",
+		"Documents/Straße.txt",
+		"Documents/notes.TXT",
+	}
+
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	for _, name := range testfiles {
+		p := filepath.Join(env.testdata, name)
+		rtest.OK(t, os.MkdirAll(filepath.Dir(p), 0755))
+		rtest.OK(t, appendRandomData(p, 100))
+	}
+
+	testRunBackup(t, filepath.Dir(env.testdata), []string{filepath.Base(env.testdata)}, BackupOptions{}, env.gopts)
+	snapshotID := testListSnapshots(t, env.gopts, 1)[0]
+
+	for i, test := range []struct {
+		opts     RestoreOptions
+		restored []string
+	}{
+		// lowercase patterns match mixed case paths
+		{RestoreOptions{InsensitiveInclude: []string{"*.jpg"}}, testfiles[:2]},
+		{RestoreOptions{InsensitiveInclude: []string{"/testdata/photos"}}, testfiles[:2]},
+		{RestoreOptions{InsensitiveExclude: []string{"/testdata/documents"}}, testfiles[:2]},
+		// mixed case patterns match lowercase paths
+		{RestoreOptions{InsensitiveInclude: []string{"IMG_0002.JPG", "*.Txt"}}, testfiles[1:]},
+		{RestoreOptions{InsensitiveInclude: []string{"STRASSE.txt", "STRAẞE.TXT"}}, testfiles[2:3]},
+		{RestoreOptions{InsensitiveExclude: []string{"*.JPG", "Notes.*"}}, testfiles[2:3]},
+		// the case sensitive options still respect the case
+		{RestoreOptions{Include: []string{"*.jpg"}}, testfiles[1:2]},
+	} {
+		test.opts.Target = filepath.Join(env.base, fmt.Sprintf("restore%d", i))
+		rtest.OK(t, testRunRestoreAssumeFailure(snapshotID.String(), test.opts, env.gopts))
+
+		for _, name := range testfiles {
+			err := testFileSize(filepath.Join(test.opts.Target, "testdata", name), 100)
+			shouldExist := false
+			for _, restored := range test.restored {
+				shouldExist = shouldExist || restored == name
+			}
+
+			if shouldExist {
+				rtest.OK(t, err)
+			} else {
+				rtest.Assert(t, os.IsNotExist(err),
+					"expected %v to not exist in restore step %v, but it exists, err %v", name, i, err)
+			}
+		}
+	}
+}
+
 func TestRestore(t *testing.T) {
 	env, cleanup := withTestEnvironment(t)
 	defer cleanup()
@@ -305,3 +369,189 @@ func TestRestoreLocalLayout(t *testing.T) {
 		rtest.RemoveAll(t, target)
 	}
 }
+
+// warmerBackend records the files passed to WarmupFile.
+type warmerBackend struct {
+	restic.Backend
+	m      sync.Mutex
+	warmed restic.IDSet
+}
+
+func (be *warmerBackend) WarmupFile(_ context.Context, h restic.Handle) (bool, error) {
+	be.m.Lock()
+	defer be.m.Unlock()
+
+	id, err := restic.ParseID(h.Name)
+	if err != nil {
+		return false, err
+	}
+	be.warmed.Insert(id)
+	return len(be.warmed)%2 == 0, nil
+}
+
+func TestRestoreWarmupOnly(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	snapshotID := testListSnapshots(t, env.gopts, 1)[0]
+
+	target := filepath.Join(env.base, "restore")
+	opts := RestoreOptions{Target: target, WarmupOnly: true}
+
+	// the local backend does not store files in cold storage
+	err := testRunRestoreAssumeFailure(snapshotID.String(), opts, env.gopts)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "does not support"), "unexpected error %v", err)
+
+	warmer := &warmerBackend{warmed: restic.NewIDSet()}
+	env.gopts.backendTestHook = func(r restic.Backend) (restic.Backend, error) {
+		warmer.Backend = r
+		return warmer, nil
+	}
+	rtest.OK(t, testRunRestoreAssumeFailure(snapshotID.String(), opts, env.gopts))
+
+	packs := restic.NewIDSet(testRunList(t, "packs", env.gopts)...)
+	rtest.Assert(t, len(warmer.warmed) > 0, "no pack files were warmed up")
+	rtest.Assert(t, len(warmer.warmed.Sub(packs)) == 0, "unknown pack files were warmed up: %v", warmer.warmed.Sub(packs))
+
+	// nothing must be restored
+	_, err = os.Stat(target)
+	rtest.Assert(t, errors.Is(err, os.ErrNotExist), "restore target was created: %v", err)
+}
+
+func TestRestoreInvalidUTF8Filename(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("creating files with invalid UTF-8 names requires Linux")
+	}
+
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	testRunInit(t, env.gopts)
+
+	// a latin1 encoded file name
+	name := "caf\xe9.txt"
+	target := "\xe0 la carte"
+	rtest.OK(t, os.MkdirAll(env.testdata, 0700))
+	rtest.OK(t, os.WriteFile(filepath.Join(env.testdata, name), []byte("content"), 0600))
+	rtest.OK(t, os.Symlink(target, filepath.Join(env.testdata, "link")))
+	testRunBackup(t, env.testdata, []string{"."}, BackupOptions{}, env.gopts)
+
+	// human readable output escapes the invalid bytes
+	lines := testRunLs(t, env.gopts, "latest")
+	rtest.Assert(t, strings.Contains(strings.Join(lines, "\n"), "/caf\\xe9.txt"), "unexpected ls output %q", lines)
+
+	// JSON output is valid UTF-8 and contains the raw name
+	buf, err := withCaptureStdout(func() error {
+		gopts := env.gopts
+		gopts.JSON = true
+		return runLs(context.TODO(), LsOptions{}, gopts, []string{"latest"})
+	})
+	rtest.OK(t, err)
+	rtest.Assert(t, utf8.Valid(buf.Bytes()), "ls output is not valid UTF-8")
+	var found bool
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var node struct {
+			Name    string `json:"name"`
+			NameRaw []byte `json:"name_raw"`
+			Path    string `json:"path"`
+			PathRaw []byte `json:"path_raw"`
+		}
+		rtest.OK(t, dec.Decode(&node))
+		if node.NameRaw != nil {
+			found = true
+			rtest.Equals(t, name, string(node.NameRaw))
+			rtest.Equals(t, "/"+name, string(node.PathRaw))
+			rtest.Equals(t, "caf\uFFFD.txt", node.Name)
+		}
+	}
+	rtest.Assert(t, found, "no node with raw name found")
+
+	out := testRunFind(t, true, env.gopts, "link")
+	rtest.Assert(t, utf8.Valid(out), "find output is not valid UTF-8")
+	var results []struct {
+		Matches []struct {
+			LinkTargetRaw []byte `json:"linktarget_raw"`
+		} `json:"matches"`
+	}
+	rtest.OK(t, json.Unmarshal(out, &results))
+	rtest.Assert(t, len(results) == 1 && len(results[0].Matches) == 1, "unexpected find output %s", out)
+	rtest.Equals(t, target, string(results[0].Matches[0].LinkTargetRaw))
+
+	// restore writes back the original bytes
+	restoredir := filepath.Join(env.base, "restore")
+	testRunRestoreLatest(t, env.gopts, restoredir, nil, nil)
+	data, err := os.ReadFile(filepath.Join(restoredir, name))
+	rtest.OK(t, err)
+	rtest.Assert(t, bytes.Equal(data, []byte("content")), "wrong content %q", data)
+	linkTarget, err := os.Readlink(filepath.Join(restoredir, "link"))
+	rtest.OK(t, err)
+	rtest.Equals(t, target, linkTarget)
+}
+
+func TestRestoreRewriteSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks with absolute targets are not supported on Windows")
+	}
+
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	testRunInit(t, env.gopts)
+
+	outside := filepath.Join(env.base, "outside")
+	links := map[string]string{
+		"internal":       filepath.Join(env.testdata, "file"),
+		"internal-dir":   filepath.Join(env.testdata, "dir") + "/",
+		"external":       outside,
+		"relative":       "dir/../file",
+		"trailing-slash": "dir/",
+		"invalid-utf8":   "caf\xe9/",
+	}
+	rtest.OK(t, os.MkdirAll(filepath.Join(env.testdata, "dir"), 0700))
+	rtest.OK(t, os.WriteFile(filepath.Join(env.testdata, "file"), []byte("content"), 0600))
+	for name, target := range links {
+		rtest.OK(t, os.Symlink(target, filepath.Join(env.testdata, name)))
+	}
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+
+	// by default, the link targets are restored unmodified
+	restoredir := filepath.Join(env.base, "restore")
+	testRunRestoreLatest(t, env.gopts, restoredir, nil, nil)
+	for name, target := range links {
+		linkTarget, err := os.Readlink(filepath.Join(restoredir, env.testdata, name))
+		rtest.OK(t, err)
+		rtest.Equals(t, target, linkTarget)
+	}
+
+	restoredir = filepath.Join(env.base, "rewrite")
+	opts := RestoreOptions{Target: restoredir, RewriteSymlinks: "absolute-to-target"}
+	rtest.OK(t, testRunRestoreAssumeFailure("latest", opts, env.gopts))
+	links["internal"] = filepath.Join(restoredir, env.testdata, "file")
+	links["internal-dir"] = filepath.Join(restoredir, env.testdata, "dir") + "/"
+	for name, target := range links {
+		linkTarget, err := os.Readlink(filepath.Join(restoredir, env.testdata, name))
+		rtest.OK(t, err)
+		rtest.Equals(t, target, linkTarget)
+	}
+	data, err := os.ReadFile(filepath.Join(restoredir, env.testdata, "internal"))
+	rtest.OK(t, err)
+	rtest.Equals(t, "content", string(data))
+
+	// the links are relative to the restored subfolder
+	restoredir = filepath.Join(env.base, "subfolder")
+	opts = RestoreOptions{Target: restoredir, RewriteSymlinks: "absolute-to-target"}
+	rtest.OK(t, testRunRestoreAssumeFailure("latest:"+env.testdata, opts, env.gopts))
+	linkTarget, err := os.Readlink(filepath.Join(restoredir, "internal"))
+	rtest.OK(t, err)
+	rtest.Equals(t, filepath.Join(restoredir, "file"), linkTarget)
+
+	// snapshots of relative paths cannot be rewritten
+	testRunBackup(t, env.testdata, []string{"."}, BackupOptions{}, env.gopts)
+	err = testRunRestoreAssumeFailure("latest", opts, env.gopts)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "relative path"), "unexpected error %v", err)
+
+	opts.RewriteSymlinks = "invalid"
+	err = testRunRestoreAssumeFailure("latest", opts, env.gopts)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "invalid mode"), "unexpected error %v", err)
+}
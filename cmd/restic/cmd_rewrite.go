@@ -80,7 +80,7 @@ func rewriteSnapshot(ctx context.Context, repo *repository.Repository, sn *resti
 
 	selectByName := func(nodepath string) bool {
 		for _, reject := range rejectByNameFuncs {
-			if reject(nodepath) {
+			if rejected, _ := reject(nodepath); rejected {
 				return false
 			}
 		}
@@ -154,16 +154,15 @@ func filterAndReplaceSnapshot(ctx context.Context, repo restic.Repository, sn *r
 		return true, nil
 	}
 
-	// Always set the original snapshot id as this essentially a new snapshot.
-	sn.Original = sn.ID()
-	sn.Tree = &filteredTree
+	rewritten := sn.Rewrite()
+	rewritten.Tree = &filteredTree
 
 	if !forget {
-		sn.AddTags([]string{addTag})
+		rewritten.AddTags([]string{addTag})
 	}
 
 	// Save the new snapshot.
-	id, err := restic.SaveSnapshot(ctx, repo, sn)
+	id, err := restic.SaveSnapshot(ctx, repo, rewritten)
 	if err != nil {
 		return false, err
 	}
@@ -185,6 +184,17 @@ func runRewrite(ctx context.Context, opts RewriteOptions, gopts GlobalOptions, a
 		return errors.Fatal("Nothing to do: no excludes provided")
 	}
 
+	if opts.Forget && !opts.DryRun {
+		if err := checkAppendOnly(gopts, "rewrite --forget"); err != nil {
+			return err
+		}
+	}
+	if !opts.DryRun {
+		if err := checkReadOnly(gopts, "rewrite"); err != nil {
+			return err
+		}
+	}
+
 	repo, err := OpenRepository(ctx, gopts)
 	if err != nil {
 		return err
@@ -71,3 +71,29 @@ func TestRewriteReplace(t *testing.T) {
 	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "0"})
 	testRunCheck(t, env.gopts)
 }
+
+func TestRewriteKeepsOriginal(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	snapshotID := createBasicRewriteRepo(t, env)
+
+	repo, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+	sn, err := restic.LoadSnapshot(context.TODO(), repo, snapshotID)
+	rtest.OK(t, err)
+
+	// tag and rewrite the snapshot, both replace the snapshot
+	testRunTag(t, TagOptions{AddTags: restic.TagLists{[]string{"foo"}}}, env.gopts)
+	testRunRewriteExclude(t, env.gopts, []string{"3"}, true)
+	newSnapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(newSnapshotIDs) == 1, "expected one snapshot, got %v", newSnapshotIDs)
+
+	rewritten, err := restic.LoadSnapshot(context.TODO(), repo, newSnapshotIDs[0])
+	rtest.OK(t, err)
+	rtest.Assert(t, rewritten.Original != nil && rewritten.Original.Equal(snapshotID),
+		"expected original %v, got %v", snapshotID.Str(), rewritten.Original.Str())
+	rtest.Assert(t, rewritten.Time.Equal(sn.Time), "time changed from %v to %v", sn.Time, rewritten.Time)
+	rtest.Equals(t, sn.Hostname, rewritten.Hostname)
+	rtest.Equals(t, sn.Paths, rewritten.Paths)
+	rtest.Equals(t, []string{"foo"}, rewritten.Tags)
+}
@@ -6,6 +6,7 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/selfupdate"
@@ -21,6 +22,10 @@ GitHub and replaces the currently running binary. After download, the
 authenticity of the binary is verified using the GPG signature on the release
 files.
 
+A specific release can be installed using "--version". Use "--channel beta" to
+install the latest pre-release instead. Installing a release older than the
+running version requires "--allow-downgrade".
+
 EXIT STATUS
 ===========
 
@@ -34,19 +39,36 @@ Exit status is 0 if the command was successful, and non-zero if there was any er
 
 // SelfUpdateOptions collects all options for the update-restic command.
 type SelfUpdateOptions struct {
-	Output string
+	Output         string
+	Version        string
+	Channel        string
+	AllowDowngrade bool
 }
 
 var selfUpdateOptions SelfUpdateOptions
 
 func init() {
 	cmdRoot.AddCommand(cmdSelfUpdate)
+	enableFeature("self-update")
 
 	flags := cmdSelfUpdate.Flags()
 	flags.StringVar(&selfUpdateOptions.Output, "output", "", "Save the downloaded file as `filename` (default: running binary itself)")
+	flags.StringVar(&selfUpdateOptions.Version, "version", "", "Install the release with the given `version` instead of the latest one, e.g. 0.15.1")
+	flags.StringVar(&selfUpdateOptions.Channel, "channel", selfupdate.ChannelStable, "Install the latest release of `channel` (stable, beta)")
+	flags.BoolVar(&selfUpdateOptions.AllowDowngrade, "allow-downgrade", false, "Allow installing a release older than the running version")
 }
 
 func runSelfUpdate(ctx context.Context, opts SelfUpdateOptions, gopts GlobalOptions, args []string) error {
+	switch opts.Channel {
+	case "", selfupdate.ChannelStable, selfupdate.ChannelBeta:
+	default:
+		return invalidArgumentsf("invalid channel %q, must be one of stable, beta", opts.Channel)
+	}
+	if opts.Version != "" && opts.Channel == selfupdate.ChannelBeta {
+		return invalidArgumentsf("--version and --channel beta cannot be used together")
+	}
+	opts.Version = strings.TrimPrefix(opts.Version, "v")
+
 	if opts.Output == "" {
 		file, err := os.Executable()
 		if err != nil {
@@ -74,7 +96,14 @@ func runSelfUpdate(ctx context.Context, opts SelfUpdateOptions, gopts GlobalOpti
 
 	Verbosef("writing restic to %v\n", opts.Output)
 
-	v, err := selfupdate.DownloadLatestStableRelease(ctx, opts.Output, version, Verbosef)
+	v, err := selfupdate.DownloadRelease(ctx, opts.Output, version, selfupdate.DownloadOptions{
+		Version:        opts.Version,
+		Channel:        opts.Channel,
+		AllowDowngrade: opts.AllowDowngrade,
+	}, Verbosef)
+	if errors.Is(err, selfupdate.ErrDowngrade) {
+		return errors.Fatalf("unable to update restic: %v, use --allow-downgrade to install it anyway", err)
+	}
 	if err != nil {
 		return errors.Fatalf("unable to update restic: %v", err)
 	}
@@ -1,15 +1,21 @@
 package main
 
 import (
+	"bytes"
+	"container/heap"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/progress"
 	"github.com/restic/restic/internal/ui/table"
+	"github.com/restic/restic/internal/walker"
 	"github.com/spf13/cobra"
 )
 
@@ -19,6 +25,12 @@ var cmdSnapshots = &cobra.Command{
 	Long: `
 The "snapshots" command lists all snapshots stored in the repository.
 
+With "--long", the restore size and the unique size of each snapshot are shown.
+The unique size is the amount of data in the repository which is only
+referenced by this snapshot among the listed snapshots. A summary per host is
+printed at the end. This requires reading all listed snapshots and can take a
+long time.
+
 EXIT STATUS
 ===========
 
@@ -33,10 +45,13 @@ Exit status is 0 if the command was successful, and non-zero if there was any er
 // SnapshotOptions bundles all options for the snapshots command.
 type SnapshotOptions struct {
 	restic.SnapshotFilter
-	Compact bool
-	Last    bool // This option should be removed in favour of Latest.
-	Latest  int
-	GroupBy restic.SnapshotGroupByOptions
+	Compact  bool
+	Details  bool
+	Long     bool
+	Last     bool // This option should be removed in favour of Latest.
+	Latest   int
+	GroupBy  restic.SnapshotGroupByOptions
+	Timezone Timezone
 }
 
 var snapshotOptions SnapshotOptions
@@ -47,6 +62,8 @@ func init() {
 	f := cmdSnapshots.Flags()
 	initMultiSnapshotFilter(f, &snapshotOptions.SnapshotFilter, true)
 	f.BoolVarP(&snapshotOptions.Compact, "compact", "c", false, "use compact output format")
+	f.BoolVar(&snapshotOptions.Details, "details", false, "print the statistics stored by the backup which created each snapshot")
+	f.BoolVar(&snapshotOptions.Long, "long", false, "show the restore size and the unique size of each snapshot and summarize them per host (expensive)")
 	f.BoolVar(&snapshotOptions.Last, "last", false, "only show the last snapshot for each host and path")
 	err := f.MarkDeprecated("last", "use --latest 1")
 	if err != nil {
@@ -55,6 +72,7 @@ func init() {
 	}
 	f.IntVar(&snapshotOptions.Latest, "latest", 0, "only show the last `n` snapshots for each host and path")
 	f.VarP(&snapshotOptions.GroupBy, "group-by", "g", "`group` snapshots by host, paths and/or tags, separated by comma")
+	f.Var(&snapshotOptions.Timezone, "timezone", "display times in the time `zone` (Local, UTC or a name like Europe/Berlin)")
 }
 
 func runSnapshots(ctx context.Context, opts SnapshotOptions, gopts GlobalOptions, args []string) error {
@@ -72,36 +90,61 @@ func runSnapshots(ctx context.Context, opts SnapshotOptions, gopts GlobalOptions
 		}
 	}
 
-	var snapshots restic.Snapshots
+	limit := opts.Latest
+	if opts.Last {
+		// This branch should be removed in the same time
+		// that --last.
+		limit = 1
+	}
+
+	collector := newSnapshotCollector(opts.GroupBy, limit)
+	count := 0
 	for sn := range FindFilteredSnapshots(ctx, repo.Backend(), repo, &opts.SnapshotFilter, args) {
-		snapshots = append(snapshots, sn)
+		err = collector.Add(sn)
+		if err != nil {
+			return err
+		}
+		count++
 	}
-	snapshotGroups, grouped, err := restic.GroupSnapshots(snapshots, opts.GroupBy)
-	if err != nil {
-		return err
+	if len(args) == 0 && len(opts.Hosts)+len(opts.Tags)+len(opts.Paths) == 0 {
+		// all snapshots of the repository have been loaded
+		recordSnapshotCount(count)
 	}
+	snapshotGroups := collector.Groups()
+	grouped := opts.GroupBy.Grouped()
 
-	for k, list := range snapshotGroups {
-		if opts.Last {
-			// This branch should be removed in the same time
-			// that --last.
-			list = FilterLastestSnapshots(list, 1)
-		} else if opts.Latest > 0 {
-			list = FilterLastestSnapshots(list, opts.Latest)
+	var sizes *snapshotSizes
+	if opts.Long {
+		if err = repo.LoadIndex(ctx); err != nil {
+			return err
+		}
+
+		var list restic.Snapshots
+		for _, k := range sortedGroupKeys(snapshotGroups) {
+			list = append(list, snapshotGroups[k]...)
+		}
+
+		var bar *progress.Counter
+		if !gopts.JSON {
+			bar = newPhaseProgress(gopts, "snapshot-sizes", uint64(len(list)), 0, "snapshots")
+		}
+		sizes, err = computeSnapshotSizes(ctx, repo, list, bar)
+		bar.Done()
+		if err != nil {
+			return err
 		}
-		sort.Sort(sort.Reverse(list))
-		snapshotGroups[k] = list
 	}
 
 	if gopts.JSON {
-		err := printSnapshotGroupJSON(globalOptions.stdout, snapshotGroups, grouped)
+		err := printSnapshotGroupJSON(globalOptions.stdout, snapshotGroups, grouped, sizes)
 		if err != nil {
 			Warnf("error printing snapshots: %v\n", err)
 		}
 		return nil
 	}
 
-	for k, list := range snapshotGroups {
+	for _, k := range sortedGroupKeys(snapshotGroups) {
+		list := snapshotGroups[k]
 		if grouped {
 			err := PrintSnapshotGroupHeader(globalOptions.stdout, k)
 			if err != nil {
@@ -109,12 +152,205 @@ func runSnapshots(ctx context.Context, opts SnapshotOptions, gopts GlobalOptions
 				return nil
 			}
 		}
-		PrintSnapshots(globalOptions.stdout, list, nil, opts.Compact)
+		PrintSnapshots(globalOptions.stdout, list, nil, opts.Compact, opts.Details, sizes, opts.Timezone.Location())
+	}
+
+	if sizes != nil {
+		printHostSizes(globalOptions.stdout, sizes)
 	}
 
 	return nil
 }
 
+// snapshotSize contains the sizes computed for a snapshot or a host.
+type snapshotSize struct {
+	// RestoreSize is the size of all files when restored.
+	RestoreSize uint64
+	// UniqueSize is the size in the repository of the blobs which are not
+	// referenced by other snapshots, or other hosts respectively.
+	UniqueSize uint64
+}
+
+// hostSize contains the sizes of all snapshots of a host.
+type hostSize struct {
+	snapshotSize
+	Snapshots int
+}
+
+// snapshotSizes contains the sizes of a list of snapshots.
+type snapshotSizes struct {
+	snapshots map[restic.ID]snapshotSize
+	hosts     map[string]*hostSize
+}
+
+// Special values for blobOwners.
+const (
+	// blobOwnerShared marks blobs referenced by snapshots of several hosts.
+	blobOwnerShared = -1
+	// blobOwnerHost is used to mark blobs referenced by several snapshots of
+	// the same host, the value is blobOwnerHost minus the index of the host.
+	blobOwnerHost = -2
+)
+
+// blobOwners maps each blob to the index of the only snapshot referencing it,
+// or to one of the special values blobOwnerShared and blobOwnerHost.
+type blobOwners map[restic.BlobHandle]int32
+
+// add records that the snapshot with index sn of the host with index host
+// references h. hostOf returns the host index of a snapshot index.
+func (o blobOwners) add(h restic.BlobHandle, sn, host int32, hostOf func(int32) int32) {
+	owner, ok := o[h]
+	switch {
+	case !ok:
+		o[h] = sn
+	case owner == blobOwnerShared, owner == sn:
+	case owner >= 0 && hostOf(owner) == host, owner == blobOwnerHost-host:
+		o[h] = blobOwnerHost - host
+	default:
+		o[h] = blobOwnerShared
+	}
+}
+
+// computeSnapshotSizes walks all snapshots in list and computes their restore
+// and unique sizes. Blobs are only attributed to a snapshot or host if no
+// other snapshot in list references them. The index must already be loaded.
+// The progress counter p is incremented for each processed snapshot.
+func computeSnapshotSizes(ctx context.Context, repo restic.Repository, list restic.Snapshots, p *progress.Counter) (*snapshotSizes, error) {
+	sizes := &snapshotSizes{
+		snapshots: make(map[restic.ID]snapshotSize, len(list)),
+		hosts:     make(map[string]*hostSize),
+	}
+
+	hostIndex := make(map[string]int32)
+	var hostNames []string
+	snapshotHosts := make([]int32, len(list))
+	hostOf := func(sn int32) int32 {
+		return snapshotHosts[sn]
+	}
+
+	owners := make(blobOwners)
+	restoreSizes := make([]uint64, len(list))
+	for i, sn := range list {
+		if sn.Tree == nil {
+			return nil, fmt.Errorf("snapshot %s has nil tree", sn.ID().Str())
+		}
+
+		host, ok := hostIndex[sn.Hostname]
+		if !ok {
+			host = int32(len(hostNames))
+			hostIndex[sn.Hostname] = host
+			hostNames = append(hostNames, sn.Hostname)
+			sizes.hosts[sn.Hostname] = &hostSize{}
+		}
+		snapshotHosts[i] = host
+
+		// each occurrence of a subtree is restored and must be counted, but
+		// its blobs are only recorded once
+		blobs := restic.NewBlobSet(restic.BlobHandle{ID: *sn.Tree, Type: restic.TreeBlob})
+		uniqueInodes := make(map[uint64]struct{})
+		err := walker.ParallelWalk(ctx, repo, *sn.Tree, func(_ restic.ID, _ string, node *restic.Node, nodeErr error) error {
+			if nodeErr != nil {
+				return nodeErr
+			}
+			if node == nil {
+				return nil
+			}
+
+			switch node.Type {
+			case "dir":
+				if node.Subtree != nil {
+					blobs.Insert(restic.BlobHandle{ID: *node.Subtree, Type: restic.TreeBlob})
+				}
+			case "file":
+				// hard links do not increase the restore size
+				if _, ok := uniqueInodes[node.Inode]; !ok || node.Inode == 0 {
+					uniqueInodes[node.Inode] = struct{}{}
+					restoreSizes[i] += node.Size
+				}
+				for _, id := range node.Content {
+					blobs.Insert(restic.BlobHandle{ID: id, Type: restic.DataBlob})
+				}
+			}
+			return nil
+		}, walker.ParallelWalkOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("walking snapshot %s: %v", sn.ID().Str(), err)
+		}
+
+		for h := range blobs {
+			owners.add(h, int32(i), host, hostOf)
+		}
+		p.Add(1)
+	}
+
+	uniqueSizes := make([]uint64, len(list))
+	hostUniqueSizes := make([]uint64, len(hostNames))
+	for h, owner := range owners {
+		if owner == blobOwnerShared {
+			continue
+		}
+		pbs := repo.Index().Lookup(h)
+		if len(pbs) == 0 {
+			return nil, fmt.Errorf("blob %v not found", h)
+		}
+		size := uint64(pbs[0].Length)
+
+		if owner >= 0 {
+			uniqueSizes[owner] += size
+			hostUniqueSizes[hostOf(owner)] += size
+		} else {
+			hostUniqueSizes[blobOwnerHost-owner] += size
+		}
+	}
+
+	for i, sn := range list {
+		sizes.snapshots[*sn.ID()] = snapshotSize{
+			RestoreSize: restoreSizes[i],
+			UniqueSize:  uniqueSizes[i],
+		}
+		hs := sizes.hosts[sn.Hostname]
+		hs.Snapshots++
+		hs.RestoreSize += restoreSizes[i]
+	}
+	for i, name := range hostNames {
+		sizes.hosts[name].UniqueSize = hostUniqueSizes[i]
+	}
+
+	return sizes, nil
+}
+
+// printHostSizes prints a table with the sizes of the snapshots of each host.
+func printHostSizes(stdout io.Writer, sizes *snapshotSizes) {
+	hosts := make([]string, 0, len(sizes.hosts))
+	for host := range sizes.hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	tab := table.New()
+	tab.AddColumn("Host      ", "{{ .Host }}")
+	tab.AddColumn("Snapshots", "{{ .Snapshots }}")
+	tab.AddColumn("Restore Size", "{{ .RestoreSize }}")
+	tab.AddColumn("Unique Size", "{{ .UniqueSize }}")
+
+	for _, host := range hosts {
+		hs := sizes.hosts[host]
+		tab.AddRow(struct {
+			Host        string
+			Snapshots   int
+			RestoreSize string
+			UniqueSize  string
+		}{host, hs.Snapshots, ui.FormatBytes(hs.RestoreSize), ui.FormatBytes(hs.UniqueSize)})
+	}
+	tab.AddFooter(fmt.Sprintf("%d hosts", len(hosts)))
+
+	fmt.Fprintf(stdout, "\nrepository usage by host:\n")
+	err := tab.Write(stdout)
+	if err != nil {
+		Warnf("error printing: %v\n", err)
+	}
+}
+
 // filterLastSnapshotsKey is used by FilterLastSnapshots.
 type filterLastSnapshotsKey struct {
 	Hostname    string
@@ -152,8 +388,119 @@ func FilterLastestSnapshots(list restic.Snapshots, limit int) restic.Snapshots {
 	return results
 }
 
-// PrintSnapshots prints a text table of the snapshots in list to stdout.
-func PrintSnapshots(stdout io.Writer, list restic.Snapshots, reasons []restic.KeepReason, compact bool) {
+// snapshotOlder returns true if a was created before b. Snapshots with the
+// same timestamp are ordered by their ID, so that the order is deterministic.
+func snapshotOlder(a, b *restic.Snapshot) bool {
+	if !a.Time.Equal(b.Time) {
+		return a.Time.Before(b.Time)
+	}
+	return bytes.Compare(a.ID()[:], b.ID()[:]) < 0
+}
+
+// snapshotHeap is a min-heap of snapshots, the oldest snapshot is at the top.
+type snapshotHeap restic.Snapshots
+
+func (h snapshotHeap) Len() int            { return len(h) }
+func (h snapshotHeap) Less(i, j int) bool  { return snapshotOlder(h[i], h[j]) }
+func (h snapshotHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *snapshotHeap) Push(x interface{}) { *h = append(*h, x.(*restic.Snapshot)) }
+func (h *snapshotHeap) Pop() interface{} {
+	old := *h
+	sn := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return sn
+}
+
+// snapshotCollector groups snapshots as they are loaded. If limit is
+// positive, only the newest limit snapshots for each host and path are kept
+// in each group, so the memory usage is proportional to the output and not
+// to the number of snapshots in the repository.
+type snapshotCollector struct {
+	groupBy restic.SnapshotGroupByOptions
+	limit   int
+	groups  map[string]map[filterLastSnapshotsKey]*snapshotHeap
+}
+
+func newSnapshotCollector(groupBy restic.SnapshotGroupByOptions, limit int) *snapshotCollector {
+	return &snapshotCollector{
+		groupBy: groupBy,
+		limit:   limit,
+		groups:  make(map[string]map[filterLastSnapshotsKey]*snapshotHeap),
+	}
+}
+
+// Add adds sn to its group, it may be dropped immediately if the group
+// already contains enough newer snapshots.
+func (c *snapshotCollector) Add(sn *restic.Snapshot) error {
+	k, err := c.groupBy.Key(sn)
+	if err != nil {
+		return err
+	}
+
+	group, ok := c.groups[k]
+	if !ok {
+		group = make(map[filterLastSnapshotsKey]*snapshotHeap)
+		c.groups[k] = group
+	}
+
+	// without a limit all snapshots of the group are kept together
+	var key filterLastSnapshotsKey
+	if c.limit > 0 {
+		key = newFilterLastSnapshotsKey(sn)
+	}
+
+	h, ok := group[key]
+	if !ok {
+		h = &snapshotHeap{}
+		group[key] = h
+	}
+
+	if c.limit <= 0 {
+		*h = append(*h, sn)
+		return nil
+	}
+
+	if h.Len() < c.limit {
+		heap.Push(h, sn)
+	} else if snapshotOlder((*h)[0], sn) {
+		(*h)[0] = sn
+		heap.Fix(h, 0)
+	}
+	return nil
+}
+
+// Groups returns the collected snapshots by group, the oldest snapshots of
+// each group are listed first.
+func (c *snapshotCollector) Groups() map[string]restic.Snapshots {
+	groups := make(map[string]restic.Snapshots, len(c.groups))
+	for k, group := range c.groups {
+		var list restic.Snapshots
+		for _, h := range group {
+			list = append(list, *h...)
+		}
+		sort.Slice(list, func(i, j int) bool {
+			return snapshotOlder(list[i], list[j])
+		})
+		groups[k] = list
+	}
+	return groups
+}
+
+// sortedGroupKeys returns the keys of groups in sorted order.
+func sortedGroupKeys(groups map[string]restic.Snapshots) []string {
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// PrintSnapshots prints a text table of the snapshots in list to stdout. If
+// details is set, the statistics from the snapshot summary are printed as
+// well. If sizes is not nil, the restore and unique size of each snapshot is
+// printed.
+func PrintSnapshots(stdout io.Writer, list restic.Snapshots, reasons []restic.KeepReason, compact, details bool, sizes *snapshotSizes, loc *time.Location) {
 	// keep the reasons a snasphot is being kept in a map, so that it doesn't
 	// get lost when the list of snapshots is sorted
 	keepReasons := make(map[restic.ID]restic.KeepReason, len(reasons))
@@ -199,6 +546,17 @@ func PrintSnapshots(stdout io.Writer, list restic.Snapshots, reasons []restic.Ke
 		}
 		tab.AddColumn("Paths", `{{ join .Paths "\n" }}`)
 	}
+	if details {
+		tab.AddColumn("Files", "{{ .Files }}")
+		tab.AddColumn("New/Changed", "{{ .FilesChanged }}")
+		tab.AddColumn("Size", "{{ .Size }}")
+		tab.AddColumn("Added", "{{ .Added }}")
+		tab.AddColumn("Duration", "{{ .Duration }}")
+	}
+	if sizes != nil {
+		tab.AddColumn("Restore Size", "{{ .RestoreSize }}")
+		tab.AddColumn("Unique Size", "{{ .UniqueSize }}")
+	}
 
 	type snapshot struct {
 		ID        string
@@ -207,23 +565,57 @@ func PrintSnapshots(stdout io.Writer, list restic.Snapshots, reasons []restic.Ke
 		Tags      []string
 		Reasons   []string
 		Paths     []string
+
+		Files        string
+		FilesChanged string
+		Size         string
+		Added        string
+		Duration     string
+
+		RestoreSize string
+		UniqueSize  string
 	}
 
 	var multiline bool
 	for _, sn := range list {
 		data := snapshot{
 			ID:        sn.ID().Str(),
-			Timestamp: sn.Time.Local().Format(TimeFormat),
+			Timestamp: formatTime(sn.Time, loc),
 			Hostname:  sn.Hostname,
 			Tags:      sn.Tags,
 			Paths:     sn.Paths,
 		}
 
+		if sn.Pinned {
+			data.ID += " (pinned)"
+		}
+
 		if len(reasons) > 0 {
 			id := sn.ID()
 			data.Reasons = keepReasons[*id].Matches
 		}
 
+		if details && sn.Summary != nil {
+			data.Files = fmt.Sprintf("%d", sn.Summary.TotalFilesProcessed)
+			data.FilesChanged = fmt.Sprintf("%d/%d", sn.Summary.FilesNew, sn.Summary.FilesChanged)
+			data.Size = ui.FormatBytes(sn.Summary.TotalBytesProcessed)
+			data.Added = ui.FormatBytes(sn.Summary.DataAdded)
+			data.Duration = ui.FormatDuration(sn.Summary.BackupEnd.Sub(sn.Summary.BackupStart))
+		} else if details {
+			// snapshots created by older versions of restic have no summary
+			data.Files = "unknown"
+			data.FilesChanged = "unknown"
+			data.Size = "unknown"
+			data.Added = "unknown"
+			data.Duration = "unknown"
+		}
+
+		if sizes != nil {
+			size := sizes.snapshots[*sn.ID()]
+			data.RestoreSize = ui.FormatBytes(size.RestoreSize)
+			data.UniqueSize = ui.FormatBytes(size.UniqueSize)
+		}
+
 		if len(sn.Paths) > 1 && !compact {
 			multiline = true
 		}
@@ -296,6 +688,25 @@ type Snapshot struct {
 
 	ID      *restic.ID `json:"id"`
 	ShortID string     `json:"short_id"`
+
+	RestoreSize *uint64 `json:"restore_size,omitempty"`
+	UniqueSize  *uint64 `json:"unique_size,omitempty"`
+}
+
+// newSnapshotJSON returns the JSON representation of sn, including its sizes
+// if sizes is not nil.
+func newSnapshotJSON(sn *restic.Snapshot, sizes *snapshotSizes) Snapshot {
+	k := Snapshot{
+		Snapshot: sn,
+		ID:       sn.ID(),
+		ShortID:  sn.ID().Str(),
+	}
+	if sizes != nil {
+		size := sizes.snapshots[*sn.ID()]
+		k.RestoreSize = &size.RestoreSize
+		k.UniqueSize = &size.UniqueSize
+	}
+	return k
 }
 
 // SnapshotGroup helps to print SnaphotGroups as JSON with their GroupReasons included.
@@ -305,11 +716,12 @@ type SnapshotGroup struct {
 }
 
 // printSnapshotsJSON writes the JSON representation of list to stdout.
-func printSnapshotGroupJSON(stdout io.Writer, snGroups map[string]restic.Snapshots, grouped bool) error {
+func printSnapshotGroupJSON(stdout io.Writer, snGroups map[string]restic.Snapshots, grouped bool, sizes *snapshotSizes) error {
 	if grouped {
 		snapshotGroups := []SnapshotGroup{}
 
-		for k, list := range snGroups {
+		for _, k := range sortedGroupKeys(snGroups) {
+			list := snGroups[k]
 			var key restic.SnapshotGroupKey
 			var err error
 			var snapshots []Snapshot
@@ -320,12 +732,7 @@ func printSnapshotGroupJSON(stdout io.Writer, snGroups map[string]restic.Snapsho
 			}
 
 			for _, sn := range list {
-				k := Snapshot{
-					Snapshot: sn,
-					ID:       sn.ID(),
-					ShortID:  sn.ID().Str(),
-				}
-				snapshots = append(snapshots, k)
+				snapshots = append(snapshots, newSnapshotJSON(sn, sizes))
 			}
 
 			group := SnapshotGroup{
@@ -341,14 +748,9 @@ func printSnapshotGroupJSON(stdout io.Writer, snGroups map[string]restic.Snapsho
 	// Old behavior
 	snapshots := []Snapshot{}
 
-	for _, list := range snGroups {
-		for _, sn := range list {
-			k := Snapshot{
-				Snapshot: sn,
-				ID:       sn.ID(),
-				ShortID:  sn.ID().Str(),
-			}
-			snapshots = append(snapshots, k)
+	for _, k := range sortedGroupKeys(snGroups) {
+		for _, sn := range snGroups[k] {
+			snapshots = append(snapshots, newSnapshotJSON(sn, sizes))
 		}
 	}
 
@@ -1,9 +1,17 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
@@ -30,3 +38,312 @@ func testRunSnapshots(t testing.TB, gopts GlobalOptions) (newest *Snapshot, snap
 	}
 	return
 }
+
+func testRunBackupSummary(t testing.TB, target []string, gopts GlobalOptions) restic.SnapshotSummary {
+	var stdout bytes.Buffer
+	gopts.JSON = true
+	gopts.stdout = &stdout
+	testRunBackup(t, "", target, BackupOptions{}, gopts)
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	var summary restic.SnapshotSummary
+	rtest.OK(t, json.Unmarshal([]byte(lines[len(lines)-1]), &summary))
+	return summary
+}
+
+func TestSnapshotsSummary(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackupSummary(t, []string{env.testdata}, env.gopts)
+	rtest.OK(t, appendRandomData(filepath.Join(env.testdata, "0", "0", "9", "0"), 1024))
+	want := testRunBackupSummary(t, []string{env.testdata}, env.gopts)
+	rtest.Assert(t, want.FilesChanged == 1, "expected one changed file, got %+v", want)
+
+	newest, _ := testRunSnapshots(t, env.gopts)
+	rtest.Assert(t, newest.Summary != nil, "snapshot has no summary")
+	got := *newest.Summary
+
+	rtest.Assert(t, got.BackupStart.Equal(newest.Time), "backup start %v does not match snapshot time %v", got.BackupStart, newest.Time)
+	rtest.Assert(t, !got.BackupEnd.Before(got.BackupStart), "backup end %v is before start %v", got.BackupEnd, got.BackupStart)
+	rtest.Assert(t, got.DataAddedPacked > 0, "no packed data reported")
+
+	// the backup output contains neither the times nor the packed size
+	got.BackupStart, got.BackupEnd, got.DataAddedPacked = time.Time{}, time.Time{}, 0
+	rtest.Equals(t, want, got)
+}
+
+func TestSnapshotsDetails(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	runDetails := func() string {
+		buf, err := withCaptureStdout(func() error {
+			return runSnapshots(context.TODO(), SnapshotOptions{Details: true}, env.gopts, nil)
+		})
+		rtest.OK(t, err)
+		return buf.String()
+	}
+
+	// the snapshots in the test repository do not contain a summary
+	datafile := filepath.Join("..", "..", "internal", "backend", "testdata", "repo-layout-default.tar.gz")
+	rtest.SetupTarTestFixture(t, env.base, datafile)
+	out := runDetails()
+	rtest.Assert(t, strings.Contains(out, "Duration") && strings.Contains(out, "unknown"),
+		"missing details for old snapshot, output:\n%v", out)
+
+	rtest.RemoveAll(t, env.repo)
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	out = runDetails()
+	rtest.Assert(t, !strings.Contains(out, "unknown"), "unexpected unknown details, output:\n%v", out)
+}
+
+func TestSnapshotFilterPathPrefix(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	for _, dir := range []string{"0/0/9", "0/0/9/2", "0/0/9/27", "0/tests"} {
+		testRunBackup(t, "", []string{filepath.Join(env.testdata, filepath.FromSlash(dir))}, BackupOptions{}, env.gopts)
+	}
+
+	for _, test := range []struct {
+		path  string
+		count int
+	}{
+		{"0", 4},
+		{"0/0", 3},
+		{"0/0/9", 3},
+		{"0/0/9/2", 1},
+		{"0/tests", 1},
+		{"0/test", 0},
+	} {
+		t.Run(test.path, func(t *testing.T) {
+			f := restic.SnapshotFilter{Paths: []string{filepath.Join(env.testdata, filepath.FromSlash(test.path))}}
+
+			buf, err := withCaptureStdout(func() error {
+				gopts := env.gopts
+				gopts.JSON = true
+				return runSnapshots(context.TODO(), SnapshotOptions{SnapshotFilter: f}, gopts, nil)
+			})
+			rtest.OK(t, err)
+			snapshots := []Snapshot{}
+			rtest.OK(t, json.Unmarshal(buf.Bytes(), &snapshots))
+			rtest.Equals(t, test.count, len(snapshots))
+
+			// commands working on a single snapshot resolve "latest" with the same filter
+			_, err = withCaptureStdout(func() error {
+				gopts := env.gopts
+				gopts.Quiet = true
+				return runLs(context.TODO(), LsOptions{SnapshotFilter: f}, gopts, []string{"latest"})
+			})
+			rtest.Assert(t, (err == nil) == (test.count > 0), "unexpected error for ls latest: %v", err)
+		})
+	}
+}
+
+// loadCountingBackend counts the loaded files per file type.
+type loadCountingBackend struct {
+	restic.Backend
+	m      sync.Mutex
+	loaded map[restic.FileType]int
+}
+
+func (be *loadCountingBackend) Load(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+	be.m.Lock()
+	be.loaded[h.Type]++
+	be.m.Unlock()
+	return be.Backend.Load(ctx, h, length, offset, fn)
+}
+
+func (be *loadCountingBackend) reset() int {
+	be.m.Lock()
+	defer be.m.Unlock()
+	n := be.loaded[restic.SnapshotFile]
+	be.loaded = make(map[restic.FileType]int)
+	return n
+}
+
+func countCachedSnapshots(t testing.TB, cacheDir string) int {
+	files, err := filepath.Glob(filepath.Join(cacheDir, "*", "snapshots", "*", "*"))
+	rtest.OK(t, err)
+	return len(files)
+}
+
+func TestSnapshotsCached(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	for i := 0; i < 3; i++ {
+		testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, BackupOptions{}, env.gopts)
+	}
+
+	be := &loadCountingBackend{loaded: make(map[restic.FileType]int)}
+	env.gopts.backendTestHook = func(r restic.Backend) (restic.Backend, error) {
+		be.Backend = r
+		return be, nil
+	}
+	// start with an empty cache
+	env.gopts.CacheDir = filepath.Join(env.base, "snapshot-cache")
+
+	_, snapmap := testRunSnapshots(t, env.gopts)
+	rtest.Equals(t, 3, len(snapmap))
+	rtest.Equals(t, 3, be.reset())
+	rtest.Equals(t, 3, countCachedSnapshots(t, env.gopts.CacheDir))
+
+	// the second listing only loads snapshots from the cache
+	_, snapmap2 := testRunSnapshots(t, env.gopts)
+	rtest.Equals(t, snapmap, snapmap2)
+	rtest.Equals(t, 0, be.reset())
+
+	var removed restic.ID
+	for id := range snapmap {
+		removed = id
+		break
+	}
+	// remove a snapshot like another client which does not share the cache
+	otherOpts := env.gopts
+	otherOpts.NoCache = true
+	testRunForget(t, otherOpts, removed.String())
+	rtest.Equals(t, 3, countCachedSnapshots(t, env.gopts.CacheDir))
+	be.reset()
+
+	// removed snapshots are dropped from the cache
+	_, snapmap3 := testRunSnapshots(t, env.gopts)
+	rtest.Equals(t, 2, len(snapmap3))
+	_, ok := snapmap3[removed]
+	rtest.Assert(t, !ok, "removed snapshot %v is still listed", removed.Str())
+	rtest.Equals(t, 0, be.reset())
+	rtest.Equals(t, 2, countCachedSnapshots(t, env.gopts.CacheDir))
+}
+
+func TestSnapshotsLong(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	shared := rtest.Random(1, 100000)
+	a := rtest.Random(2, 200000)
+	b := rtest.Random(3, 300000)
+	c := rtest.Random(4, 400000)
+	for _, backup := range []struct {
+		dir   string
+		host  string
+		files map[string][]byte
+	}{
+		{"1", "host1", map[string][]byte{"shared": shared, "a": a}},
+		{"2", "host1", map[string][]byte{"shared": shared, "a": a, "b": b}},
+		{"3", "host2", map[string][]byte{"shared": shared, "c": c}},
+	} {
+		dir := filepath.Join(env.testdata, backup.dir)
+		rtest.OK(t, os.MkdirAll(dir, 0700))
+		for name, data := range backup.files {
+			rtest.OK(t, os.WriteFile(filepath.Join(dir, name), data, 0600))
+		}
+		testRunBackup(t, env.testdata, []string{backup.dir}, BackupOptions{Host: backup.host}, env.gopts)
+	}
+
+	repo, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+
+	var list restic.Snapshots
+	for sn := range FindFilteredSnapshots(context.TODO(), repo.Backend(), repo, &restic.SnapshotFilter{}, nil) {
+		list = append(list, sn)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Paths[0] < list[j].Paths[0]
+	})
+	rtest.Equals(t, 3, len(list))
+	rtest.OK(t, repo.LoadIndex(context.TODO()))
+
+	sizes, err := computeSnapshotSizes(context.TODO(), repo, list, nil)
+	rtest.OK(t, err)
+
+	// compute the expected unique sizes from the blobs used by each snapshot
+	used := make([]restic.BlobSet, len(list))
+	for i, sn := range list {
+		used[i] = restic.NewBlobSet()
+		rtest.OK(t, restic.FindUsedBlobs(context.TODO(), repo, restic.IDs{*sn.Tree}, used[i], nil))
+	}
+	blobSize := func(h restic.BlobHandle) uint64 {
+		return uint64(repo.Index().Lookup(h)[0].Length)
+	}
+	uniqueSize := func(own []int, others []int) uint64 {
+		var size uint64
+		seen := restic.NewBlobSet()
+		for _, i := range own {
+			for h := range used[i] {
+				isShared := false
+				for _, j := range others {
+					isShared = isShared || used[j].Has(h)
+				}
+				if !isShared && !seen.Has(h) {
+					seen.Insert(h)
+					size += blobSize(h)
+				}
+			}
+		}
+		return size
+	}
+
+	for i, restoreSize := range []uint64{300000, 600000, 500000} {
+		var others []int
+		for j := range list {
+			if j != i {
+				others = append(others, j)
+			}
+		}
+		size := sizes.snapshots[*list[i].ID()]
+		rtest.Equals(t, restoreSize, size.RestoreSize)
+		rtest.Equals(t, uniqueSize([]int{i}, others), size.UniqueSize)
+	}
+
+	// the data of file a is referenced by two snapshots of host1, so it is
+	// only attributed to the host
+	dataSize := func(data []byte) uint64 {
+		return blobSize(restic.BlobHandle{ID: restic.Hash(data), Type: restic.DataBlob})
+	}
+	rtest.Assert(t, sizes.snapshots[*list[0].ID()].UniqueSize < dataSize(a), "data of a attributed to the first snapshot")
+	rtest.Assert(t, sizes.snapshots[*list[1].ID()].UniqueSize >= dataSize(b), "data of b not attributed to the second snapshot")
+	rtest.Assert(t, sizes.snapshots[*list[2].ID()].UniqueSize >= dataSize(c), "data of c not attributed to the third snapshot")
+
+	rtest.Equals(t, 2, sizes.hosts["host1"].Snapshots)
+	rtest.Equals(t, uint64(900000), sizes.hosts["host1"].RestoreSize)
+	rtest.Equals(t, uniqueSize([]int{0, 1}, []int{2}), sizes.hosts["host1"].UniqueSize)
+	rtest.Assert(t, sizes.hosts["host1"].UniqueSize >= dataSize(a)+dataSize(b), "data of a and b not attributed to host1")
+	rtest.Equals(t, 1, sizes.hosts["host2"].Snapshots)
+	rtest.Equals(t, uint64(500000), sizes.hosts["host2"].RestoreSize)
+	rtest.Equals(t, uniqueSize([]int{2}, []int{0, 1}), sizes.hosts["host2"].UniqueSize)
+
+	// the data of the shared file is not attributed to anyone
+	total := sizes.hosts["host1"].UniqueSize + sizes.hosts["host2"].UniqueSize
+	rtest.Equals(t, uniqueSize([]int{0, 1, 2}, nil)-dataSize(shared), total)
+}
+
+func TestSnapshotsTimezone(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	_, snapmap := testRunSnapshots(t, env.gopts)
+	var sn Snapshot
+	for _, s := range snapmap {
+		sn = s
+	}
+
+	for _, zone := range []string{"UTC", "Asia/Kolkata"} {
+		opts := SnapshotOptions{}
+		rtest.OK(t, opts.Timezone.Set(zone))
+		buf, err := withCaptureStdout(func() error {
+			return runSnapshots(context.TODO(), opts, env.gopts, nil)
+		})
+		rtest.OK(t, err)
+		want := formatTime(sn.Time, opts.Timezone.Location())
+		rtest.Assert(t, strings.Contains(buf.String(), want), "output does not contain time %v: %q", want, buf.String())
+	}
+}
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"fmt"
+	"math/rand"
+	"sort"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
 )
 
@@ -11,9 +16,100 @@ import (
 func TestEmptySnapshotGroupJSON(t *testing.T) {
 	for _, grouped := range []bool{false, true} {
 		var w strings.Builder
-		err := printSnapshotGroupJSON(&w, nil, grouped)
+		err := printSnapshotGroupJSON(&w, nil, grouped, nil)
 		rtest.OK(t, err)
 
 		rtest.Equals(t, "[]", strings.TrimSpace(w.String()))
 	}
 }
+
+func testSnapshotList(t testing.TB, n int) restic.Snapshots {
+	rnd := rand.New(rand.NewSource(23))
+	hosts := []string{"foo", "bar", "baz"}
+	paths := [][]string{{"/home"}, {"/etc"}, {"/srv", "/var"}}
+	tags := [][]string{nil, {"daily"}, {"weekly", "manual"}}
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	var list restic.Snapshots
+	for i := 0; i < n; i++ {
+		sn, err := restic.NewSnapshot(paths[rnd.Intn(len(paths))], tags[rnd.Intn(len(tags))],
+			hosts[rnd.Intn(len(hosts))], start.Add(time.Duration(rnd.Int63n(1000*24))*time.Hour))
+		rtest.OK(t, err)
+		// ensure that all timestamps are distinct
+		sn.Time = sn.Time.Add(time.Duration(i) * time.Second)
+		restic.TestSetSnapshotID(t, sn, restic.NewRandomID())
+		list = append(list, sn)
+	}
+	return list
+}
+
+func TestSnapshotCollector(t *testing.T) {
+	list := testSnapshotList(t, 500)
+
+	for _, groupBy := range []string{"", "host", "paths", "host,paths,tags"} {
+		for _, limit := range []int{0, 1, 3} {
+			t.Run(fmt.Sprintf("%q/%d", groupBy, limit), func(t *testing.T) {
+				var opts restic.SnapshotGroupByOptions
+				if groupBy != "" {
+					rtest.OK(t, opts.Set(groupBy))
+				}
+
+				// the old implementation, which keeps all snapshots in memory
+				want, _, err := restic.GroupSnapshots(append(restic.Snapshots{}, list...), opts)
+				rtest.OK(t, err)
+				for k, l := range want {
+					if limit > 0 {
+						l = FilterLastestSnapshots(l, limit)
+					}
+					sort.Sort(sort.Reverse(l))
+					want[k] = l
+				}
+
+				c := newSnapshotCollector(opts, limit)
+				for _, sn := range list {
+					rtest.OK(t, c.Add(sn))
+				}
+				rtest.Equals(t, want, c.Groups())
+			})
+		}
+	}
+}
+
+func TestSnapshotCollectorSameTime(t *testing.T) {
+	list := testSnapshotList(t, 10)
+	for _, sn := range list {
+		sn.Time = list[0].Time
+		sn.Hostname = "foo"
+		sn.Paths = []string{"/home"}
+	}
+
+	var result []restic.Snapshots
+	for i := 0; i < 2; i++ {
+		c := newSnapshotCollector(restic.SnapshotGroupByOptions{}, 3)
+		for _, sn := range list {
+			rtest.OK(t, c.Add(sn))
+		}
+		result = append(result, c.Groups()["{\"hostname\":\"\",\"paths\":null,\"tags\":null}"])
+
+		// the order in which snapshots are added must not matter
+		sort.Slice(list, func(i, j int) bool { return list[i].ID().String() > list[j].ID().String() })
+	}
+	rtest.Equals(t, 3, len(result[0]))
+	rtest.Equals(t, result[0], result[1])
+}
+
+func BenchmarkSnapshotCollector(b *testing.B) {
+	list := testSnapshotList(b, 30000)
+	var opts restic.SnapshotGroupByOptions
+	rtest.OK(b, opts.Set("host,paths"))
+
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		c := newSnapshotCollector(opts, 1)
+		for _, sn := range list {
+			rtest.OK(b, c.Add(sn))
+		}
+		_ = c.Groups()
+	}
+}
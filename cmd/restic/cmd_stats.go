@@ -4,7 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"math/bits"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/restic/chunker"
@@ -13,6 +17,7 @@ import (
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/progress"
 	"github.com/restic/restic/internal/ui/table"
 	"github.com/restic/restic/internal/walker"
 
@@ -43,6 +48,17 @@ The modes are:
 * raw-data: Counts the size of blobs in the repository, regardless of
   how many files reference them.
 * blobs-per-file: A combination of files-by-contents and raw-data.
+* files-by-type: Counts the number and restore size of files, grouped
+  by file extension.
+* debug: Shows histograms of the sizes of all files and blobs in the
+  repository, followed by histograms of the file sizes, blobs per file and
+  blob sizes of the selected snapshots in power-of-two buckets. Each tree
+  is only visited once, such that the histograms describe the data of
+  the snapshots without duplicate directories.
+
+The --top-dirs flag additionally reports the number and restore size of
+the files in the N largest top-level directories. It can be used with the
+restore-size and files-by-type modes.
 
 Refer to the online manual for more details about each mode.
 
@@ -61,6 +77,8 @@ Exit status is 0 if the command was successful, and non-zero if there was any er
 type StatsOptions struct {
 	// the mode of counting to perform (see consts for available modes)
 	countMode string
+	// number of top-level directories to report
+	topDirs int
 
 	restic.SnapshotFilter
 }
@@ -70,7 +88,8 @@ var statsOptions StatsOptions
 func init() {
 	cmdRoot.AddCommand(cmdStats)
 	f := cmdStats.Flags()
-	f.StringVar(&statsOptions.countMode, "mode", countModeRestoreSize, "counting mode: restore-size (default), files-by-contents, blobs-per-file or raw-data")
+	f.StringVar(&statsOptions.countMode, "mode", countModeRestoreSize, "counting mode: restore-size (default), files-by-contents, blobs-per-file, raw-data, files-by-type or debug")
+	f.IntVar(&statsOptions.topDirs, "top-dirs", 0, "report the `N` largest top-level directories (restore-size and files-by-type modes only)")
 	initMultiSnapshotFilter(f, &statsOptions.SnapshotFilter, true)
 }
 
@@ -104,7 +123,7 @@ func runStats(ctx context.Context, opts StatsOptions, gopts GlobalOptions, args
 	}
 
 	if opts.countMode == countModeDebug {
-		return statsDebug(ctx, repo)
+		return statsDebug(ctx, repo, snapshotLister, opts, gopts, args)
 	}
 
 	if !gopts.JSON {
@@ -116,6 +135,8 @@ func runStats(ctx context.Context, opts StatsOptions, gopts GlobalOptions, args
 		uniqueFiles:    make(map[fileID]struct{}),
 		fileBlobs:      make(map[string]restic.IDSet),
 		blobs:          restic.NewBlobSet(),
+		fileTypes:      make(statsGroups),
+		topDirs:        make(statsGroups),
 		SnapshotsCount: 0,
 	}
 
@@ -131,6 +152,18 @@ func runStats(ctx context.Context, opts StatsOptions, gopts GlobalOptions, args
 	}
 
 	if opts.countMode == countModeRawData {
+		// process all snapshots at once, such that their trees are loaded
+		// concurrently and shared trees are only loaded once
+		var bar *progress.Counter
+		if !gopts.JSON {
+			bar = newPhaseProgress(gopts, "find-used-blobs", uint64(len(stats.snapshotTrees)), 0, "snapshots")
+		}
+		err = restic.FindUsedBlobs(ctx, repo, stats.snapshotTrees, stats.blobs, bar)
+		bar.Done()
+		if err != nil {
+			return fmt.Errorf("error walking snapshots: %v", err)
+		}
+
 		// the blob handles have been collected, but not yet counted
 		for blobHandle := range stats.blobs {
 			pbs := repo.Index().Lookup(blobHandle)
@@ -156,6 +189,18 @@ func runStats(ctx context.Context, opts StatsOptions, gopts GlobalOptions, args
 		}
 	}
 
+	stats.RepositorySize, stats.RepositorySizeLimit, err = repo.SizeLimit(ctx)
+	if err != nil {
+		return err
+	}
+
+	if opts.countMode == countModeFilesByType {
+		stats.FilesByType = stats.fileTypes.sorted(0)
+	}
+	if opts.topDirs > 0 {
+		stats.TopDirs = stats.topDirs.sorted(opts.topDirs)
+	}
+
 	if gopts.JSON {
 		err = json.NewEncoder(globalOptions.stdout).Encode(stats)
 		if err != nil {
@@ -185,6 +230,25 @@ func runStats(ctx context.Context, opts StatsOptions, gopts GlobalOptions, args
 	if stats.CompressionSpaceSaving > 0 {
 		Printf("Compression Space Saving:  %.2f%%\n", stats.CompressionSpaceSaving)
 	}
+	if stats.RepositorySizeLimit > 0 {
+		Printf("   Repository Size Limit:  %s of %s used (%s)\n", ui.FormatBytes(stats.RepositorySize),
+			ui.FormatBytes(stats.RepositorySizeLimit), ui.FormatPercent(stats.RepositorySize, stats.RepositorySizeLimit))
+	}
+
+	if len(stats.FilesByType) > 0 {
+		Printf("\n")
+		err = printStatsGroups("Extension", stats.FilesByType)
+		if err != nil {
+			return err
+		}
+	}
+	if len(stats.TopDirs) > 0 {
+		Printf("\n")
+		err = printStatsGroups("Directory", stats.TopDirs)
+		if err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
@@ -198,12 +262,19 @@ func statsWalkSnapshot(ctx context.Context, snapshot *restic.Snapshot, repo rest
 
 	if opts.countMode == countModeRawData {
 		// count just the sizes of unique blobs; we don't need to walk the tree
-		// ourselves in this case, since a nifty function does it for us
-		return restic.FindUsedBlobs(ctx, repo, restic.IDs{*snapshot.Tree}, stats.blobs, nil)
+		// ourselves in this case, since FindUsedBlobs does it for us once the
+		// trees of all snapshots are known
+		stats.snapshotTrees = append(stats.snapshotTrees, *snapshot.Tree)
+		return nil
 	}
 
 	uniqueInodes := make(map[uint64]struct{})
-	err := walker.Walk(ctx, repo, *snapshot.Tree, restic.NewIDSet(), statsWalkTree(repo, opts, stats, uniqueInodes))
+	// in restore-size and files-by-type mode, each occurrence of a subtree
+	// is restored and must therefore be counted
+	walkOpts := walker.ParallelWalkOptions{
+		UniqueTrees: opts.countMode != countModeRestoreSize && opts.countMode != countModeFilesByType,
+	}
+	err := walker.ParallelWalk(ctx, repo, *snapshot.Tree, statsWalkTree(repo, opts, stats, uniqueInodes), walkOpts)
 	if err != nil {
 		return fmt.Errorf("walking tree %s: %v", *snapshot.Tree, err)
 	}
@@ -211,13 +282,13 @@ func statsWalkSnapshot(ctx context.Context, snapshot *restic.Snapshot, repo rest
 	return nil
 }
 
-func statsWalkTree(repo restic.Repository, opts StatsOptions, stats *statsContainer, uniqueInodes map[uint64]struct{}) walker.WalkFunc {
-	return func(parentTreeID restic.ID, npath string, node *restic.Node, nodeErr error) (bool, error) {
+func statsWalkTree(repo restic.Repository, opts StatsOptions, stats *statsContainer, uniqueInodes map[uint64]struct{}) walker.ParallelWalkFunc {
+	return func(parentTreeID restic.ID, npath string, node *restic.Node, nodeErr error) error {
 		if nodeErr != nil {
-			return true, nodeErr
+			return nodeErr
 		}
 		if node == nil {
-			return true, nil
+			return nil
 		}
 
 		if opts.countMode == countModeUniqueFilesByContents || opts.countMode == countModeBlobsPerFile {
@@ -247,7 +318,7 @@ func statsWalkTree(repo restic.Repository, opts StatsOptions, stats *statsContai
 							// is always a data blob since we're accessing it via a file's Content array
 							blobSize, found := repo.LookupBlobSize(blobID, restic.DataBlob)
 							if !found {
-								return true, fmt.Errorf("blob %s not found for tree %s", blobID, parentTreeID)
+								return fmt.Errorf("blob %s not found for tree %s", blobID, parentTreeID)
 							}
 
 							// count the blob's size, then add this blob by this
@@ -262,23 +333,46 @@ func statsWalkTree(repo restic.Repository, opts StatsOptions, stats *statsContai
 			}
 		}
 
-		if opts.countMode == countModeRestoreSize {
+		if opts.countMode == countModeRestoreSize || opts.countMode == countModeFilesByType {
 			// as this is a file in the snapshot, we can simply count its
 			// size without worrying about uniqueness, since duplicate files
 			// will still be restored
-			stats.TotalFileCount++
 
 			// if inodes are present, only count each inode once
 			// (hard links do not increase restore size)
+			var size uint64
 			if _, ok := uniqueInodes[node.Inode]; !ok || node.Inode == 0 {
 				uniqueInodes[node.Inode] = struct{}{}
-				stats.TotalSize += node.Size
+				size = node.Size
+			}
+
+			if opts.countMode == countModeRestoreSize {
+				stats.TotalFileCount++
+				stats.TotalSize += size
+			} else if node.Type == "file" {
+				stats.TotalFileCount++
+				stats.TotalSize += size
+				stats.fileTypes.add(fileExtension(node.Name), size)
 			}
 
-			return false, nil
+			if opts.topDirs > 0 && node.Type == "file" {
+				stats.topDirs.add(topLevelDir(npath), size)
+			}
+
+			// the index may already know the size of the subtree, which
+			// avoids loading the trees contained in it
+			if opts.countMode == countModeRestoreSize && opts.topDirs == 0 && node.Type == "dir" && node.Subtree != nil {
+				if treeStats, ok := repo.Index().LookupTreeStats(*node.Subtree); ok {
+					stats.TotalFileCount += treeStats.Nodes
+					stats.TotalSize += treeStats.Size
+					return walker.ErrSkipNode
+				}
+			}
+
+			return nil
 		}
 
-		return true, nil
+		return nil
 	}
 }
 
@@ -299,11 +393,19 @@ func verifyStatsInput(opts StatsOptions) error {
 	case countModeUniqueFilesByContents:
 	case countModeBlobsPerFile:
 	case countModeRawData:
+	case countModeFilesByType:
 	case countModeDebug:
 	default:
 		return fmt.Errorf("unknown counting mode: %s (use the -h flag to get a list of supported modes)", opts.countMode)
 	}
 
+	if opts.topDirs < 0 {
+		return fmt.Errorf("--top-dirs must not be negative")
+	}
+	if opts.topDirs > 0 && opts.countMode != countModeRestoreSize && opts.countMode != countModeFilesByType {
+		return fmt.Errorf("--top-dirs is only supported in the restore-size and files-by-type modes")
+	}
+
 	return nil
 }
 
@@ -322,6 +424,12 @@ type statsContainer struct {
 	TotalBlobCount                       uint64  `json:"total_blob_count,omitempty"`
 	// holds count of all considered snapshots
 	SnapshotsCount int `json:"snapshots_count"`
+	// size of all files in the repository and its limit, if a limit is set
+	RepositorySize      uint64 `json:"repository_size,omitempty"`
+	RepositorySizeLimit uint64 `json:"repository_size_limit,omitempty"`
+	// file count and size per file extension and top-level directory
+	FilesByType []statsGroup `json:"files_by_type,omitempty"`
+	TopDirs     []statsGroup `json:"top_dirs,omitempty"`
 
 	// uniqueFiles marks visited files according to their
 	// contents (hashed sequence of content blob IDs)
@@ -334,6 +442,94 @@ type statsContainer struct {
 	// blobs is used to count individual unique blobs,
 	// independent of references to files
 	blobs restic.BlobSet
+
+	// snapshotTrees holds the root trees of the snapshots in raw-data mode
+	snapshotTrees restic.IDs
+
+	// fileTypes and topDirs aggregate the files by extension
+	// and by top-level directory
+	fileTypes statsGroups
+	topDirs   statsGroups
+}
+
+// statsGroup holds the number and total size of the files in a group.
+type statsGroup struct {
+	Name      string `json:"name"`
+	FileCount uint64 `json:"file_count"`
+	TotalSize uint64 `json:"total_size"`
+}
+
+// statsGroups maps group names to their statistics. Its size only depends on
+// the number of groups, not on the number of files.
+type statsGroups map[string]*statsGroup
+
+func (g statsGroups) add(name string, size uint64) {
+	group, ok := g[name]
+	if !ok {
+		group = &statsGroup{Name: name}
+		g[name] = group
+	}
+	group.FileCount++
+	group.TotalSize += size
+}
+
+// sorted returns the groups ordered by decreasing size. If limit is larger
+// than zero, at most limit groups are returned.
+func (g statsGroups) sorted(limit int) []statsGroup {
+	groups := make([]statsGroup, 0, len(g))
+	for _, group := range g {
+		groups = append(groups, *group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].TotalSize != groups[j].TotalSize {
+			return groups[i].TotalSize > groups[j].TotalSize
+		}
+		return groups[i].Name < groups[j].Name
+	})
+	if limit > 0 && len(groups) > limit {
+		groups = groups[:limit]
+	}
+	return groups
+}
+
+func printStatsGroups(title string, groups []statsGroup) error {
+	tab := table.New()
+	tab.AddColumn(title, "{{ .Name }}")
+	tab.AddColumn("Files", "{{ .FileCount }}")
+	tab.AddColumn("Size", "{{ .Size }}")
+	for _, group := range groups {
+		name := group.Name
+		if name == "" {
+			name = "(none)"
+		}
+		tab.AddRow(struct {
+			Name      string
+			FileCount uint64
+			Size      string
+		}{name, group.FileCount, ui.FormatBytes(group.TotalSize)})
+	}
+	return tab.Write(globalOptions.stdout)
+}
+
+// fileExtension returns the lower-cased extension of a file name, without the
+// leading dot. Hidden files like ".bashrc" have no extension.
+func fileExtension(name string) string {
+	ext := path.Ext(name)
+	if ext == name {
+		return ""
+	}
+	return strings.ToLower(strings.TrimPrefix(ext, "."))
+}
+
+// topLevelDir returns the first component of the slash-separated path p, or
+// "/" for files in the root directory.
+func topLevelDir(p string) string {
+	p = strings.TrimPrefix(p, "/")
+	idx := strings.Index(p, "/")
+	if idx < 0 {
+		return "/"
+	}
+	return "/" + p[:idx]
 }
 
 // fileID is a 256-bit hash that distinguishes unique files.
@@ -344,27 +540,240 @@ const (
 	countModeUniqueFilesByContents = "files-by-contents"
 	countModeBlobsPerFile          = "blobs-per-file"
 	countModeRawData               = "raw-data"
+	countModeFilesByType           = "files-by-type"
 	countModeDebug                 = "debug"
 )
 
-func statsDebug(ctx context.Context, repo restic.Repository) error {
-	Warnf("Collecting size statistics\n\n")
-	for _, t := range []restic.FileType{restic.KeyFile, restic.LockFile, restic.IndexFile, restic.PackFile} {
-		hist, err := statsDebugFileType(ctx, repo, t)
+func statsDebug(ctx context.Context, repo restic.Repository, snapshotLister restic.Lister, opts StatsOptions, gopts GlobalOptions, args []string) error {
+	if !gopts.JSON {
+		Warnf("Collecting size statistics\n\n")
+		for _, t := range []restic.FileType{restic.KeyFile, restic.LockFile, restic.IndexFile, restic.PackFile} {
+			hist, err := statsDebugFileType(ctx, repo, t)
+			if err != nil {
+				return err
+			}
+			Warnf("File Type: %v\n%v\n", t, hist)
+		}
+
+		hist := statsDebugBlobs(ctx, repo)
+		for _, t := range []restic.BlobType{restic.DataBlob, restic.TreeBlob} {
+			Warnf("Blob Type: %v\n%v\n\n", t, hist[t])
+		}
+	}
+
+	stats := newChunkingStats()
+	for sn := range FindFilteredSnapshots(ctx, snapshotLister, repo, &opts.SnapshotFilter, args) {
+		err := stats.walkSnapshot(ctx, repo, sn)
+		if err != nil {
+			return fmt.Errorf("error walking snapshot: %v", err)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if gopts.JSON {
+		err := json.NewEncoder(globalOptions.stdout).Encode(stats)
 		if err != nil {
+			return fmt.Errorf("encoding output: %v", err)
+		}
+		return nil
+	}
+
+	Printf("Snapshots processed:  %d\n", stats.SnapshotsCount)
+	Printf("              Files:  %d\n", stats.FileCount)
+	Printf("         Data Blobs:  %d\n", stats.DataBlobCount)
+	Printf("         Tree Blobs:  %d\n", stats.TreeBlobCount)
+	for _, h := range []struct {
+		title, unit string
+		hist        *log2Histogram
+	}{
+		{"File Sizes", "Bytes", stats.FileSizes},
+		{"Blobs per File", "Blobs", stats.BlobsPerFile},
+		{"Data Blob Sizes", "Bytes", stats.DataBlobSizes},
+		{"Tree Blob Sizes", "Bytes", stats.TreeBlobSizes},
+	} {
+		Printf("\n%v:\n", h.title)
+		if err := h.hist.print(globalOptions.stdout, h.unit); err != nil {
 			return err
 		}
-		Warnf("File Type: %v\n%v\n", t, hist)
 	}
+	return nil
+}
+
+// chunkingStats collects histograms about how the files of snapshots are
+// split into blobs. Its memory usage only depends on the number of trees.
+type chunkingStats struct {
+	SnapshotsCount int    `json:"snapshots_count"`
+	FileCount      uint64 `json:"file_count"`
+	DataBlobCount  uint64 `json:"data_blob_count"`
+	TreeBlobCount  uint64 `json:"tree_blob_count"`
+
+	FileSizes     *log2Histogram `json:"file_sizes"`
+	BlobsPerFile  *log2Histogram `json:"blobs_per_file"`
+	DataBlobSizes *log2Histogram `json:"data_blob_sizes"`
+	TreeBlobSizes *log2Histogram `json:"tree_blob_sizes"`
+
+	// trees contains the visited trees of all snapshots
+	trees restic.IDSet
+}
 
-	hist := statsDebugBlobs(ctx, repo)
-	for _, t := range []restic.BlobType{restic.DataBlob, restic.TreeBlob} {
-		Warnf("Blob Type: %v\n%v\n\n", t, hist[t])
+func newChunkingStats() *chunkingStats {
+	return &chunkingStats{
+		FileSizes:     &log2Histogram{},
+		BlobsPerFile:  &log2Histogram{},
+		DataBlobSizes: &log2Histogram{},
+		TreeBlobSizes: &log2Histogram{},
+		trees:         restic.NewIDSet(),
+	}
+}
+
+// walkSnapshot adds the files and blobs of the trees of sn which have not
+// been visited before. Data blobs are counted once for each file referencing
+// them.
+func (s *chunkingStats) walkSnapshot(ctx context.Context, repo restic.Repository, sn *restic.Snapshot) error {
+	if sn.Tree == nil {
+		return fmt.Errorf("snapshot %s has nil tree", sn.ID().Str())
+	}
+	s.SnapshotsCount++
+
+	addTree := func(id restic.ID) error {
+		if s.trees.Has(id) {
+			return walker.ErrSkipNode
+		}
+		s.trees.Insert(id)
+		size, found := repo.LookupBlobSize(id, restic.TreeBlob)
+		if !found {
+			return fmt.Errorf("tree %v not found in index", id.Str())
+		}
+		s.TreeBlobCount++
+		s.TreeBlobSizes.Add(uint64(size))
+		return nil
 	}
 
+	err := walker.ParallelWalk(ctx, repo, *sn.Tree, func(parentTreeID restic.ID, _ string, node *restic.Node, nodeErr error) error {
+		if nodeErr != nil {
+			return nodeErr
+		}
+		if node == nil {
+			return addTree(parentTreeID)
+		}
+
+		switch node.Type {
+		case "dir":
+			if node.Subtree == nil {
+				return nil
+			}
+			return addTree(*node.Subtree)
+		case "file":
+			s.FileCount++
+			s.FileSizes.Add(node.Size)
+			s.BlobsPerFile.Add(uint64(len(node.Content)))
+			for _, id := range node.Content {
+				size, found := repo.LookupBlobSize(id, restic.DataBlob)
+				if !found {
+					return fmt.Errorf("blob %v not found in index", id.Str())
+				}
+				s.DataBlobCount++
+				s.DataBlobSizes.Add(uint64(size))
+			}
+		}
+		return nil
+	}, walker.ParallelWalkOptions{})
+	if err != nil {
+		return fmt.Errorf("walking tree %s: %v", *sn.Tree, err)
+	}
 	return nil
 }
 
+// log2Histogram counts values in power-of-two buckets: bucket 0 contains the
+// value 0, bucket i > 0 contains the values from 2^(i-1) to 2^i-1.
+type log2Histogram struct {
+	count   uint64
+	total   uint64
+	buckets [65]uint64
+}
+
+func (h *log2Histogram) Add(v uint64) {
+	h.count++
+	h.total += v
+	h.buckets[bits.Len64(v)]++
+}
+
+// Average returns the average of all values, or zero if there are none.
+func (h *log2Histogram) Average() float64 {
+	if h.count == 0 {
+		return 0
+	}
+	return float64(h.total) / float64(h.count)
+}
+
+type log2HistogramBucket struct {
+	Lower uint64 `json:"lower"`
+	Upper uint64 `json:"upper"`
+	Count uint64 `json:"count"`
+}
+
+// bucketRange returns the smallest and largest value in bucket i.
+func bucketRange(i int) (lower, upper uint64) {
+	if i == 0 {
+		return 0, 0
+	}
+	lower = 1 << (i - 1)
+	return lower, lower<<1 - 1
+}
+
+// usedBuckets returns the buckets from the first to the last non-empty one.
+func (h *log2Histogram) usedBuckets() []log2HistogramBucket {
+	first, last := -1, -1
+	for i, c := range h.buckets {
+		if c == 0 {
+			continue
+		}
+		if first < 0 {
+			first = i
+		}
+		last = i
+	}
+	if first < 0 {
+		return nil
+	}
+
+	buckets := make([]log2HistogramBucket, 0, last-first+1)
+	for i := first; i <= last; i++ {
+		lower, upper := bucketRange(i)
+		buckets = append(buckets, log2HistogramBucket{lower, upper, h.buckets[i]})
+	}
+	return buckets
+}
+
+func (h *log2Histogram) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Count   uint64                `json:"count"`
+		Total   uint64                `json:"total"`
+		Average float64               `json:"average"`
+		Buckets []log2HistogramBucket `json:"buckets"`
+	}{h.count, h.total, h.Average(), h.usedBuckets()})
+}
+
+func (h *log2Histogram) print(w io.Writer, unit string) error {
+	_, err := fmt.Fprintf(w, "Count: %d, Total: %d, Average: %.1f\n", h.count, h.total, h.Average())
+	if err != nil || h.count == 0 {
+		return err
+	}
+
+	tab := table.New()
+	tab.AddColumn(unit, "{{ .Range }}")
+	tab.AddColumn("Count", "{{ .Count }}")
+	for _, b := range h.usedBuckets() {
+		tab.AddRow(struct {
+			Range string
+			Count uint64
+		}{fmt.Sprintf("%d - %d", b.Lower, b.Upper), b.Count})
+	}
+	return tab.Write(w)
+}
+
 func statsDebugFileType(ctx context.Context, repo restic.Repository, tpe restic.FileType) (*sizeHistogram, error) {
 	hist := newSizeHistogram(2 * repository.MaxPackSize)
 	err := repo.List(ctx, tpe, func(id restic.ID, size int64) error {
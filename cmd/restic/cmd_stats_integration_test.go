@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func testRunStatsJSON(t testing.TB, opts StatsOptions, gopts GlobalOptions) statsContainer {
+	buf, err := withCaptureStdout(func() error {
+		gopts.JSON = true
+		return runStats(context.TODO(), opts, gopts, nil)
+	})
+	rtest.OK(t, err)
+
+	var stats statsContainer
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &stats))
+	return stats
+}
+
+func TestStatsFilesByType(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	testRunInit(t, env.gopts)
+
+	files := map[string]int{
+		"photos/a.jpg":     100,
+		"photos/b.JPG":     50,
+		"photos/notes.txt": 10,
+		"code/main.txt":    10,
+		"code/README":      5,
+		"code/.bashrc":     3,
+		"top.txt":          1,
+	}
+	for name, size := range files {
+		fn := filepath.Join(env.testdata, filepath.FromSlash(name))
+		rtest.OK(t, os.MkdirAll(filepath.Dir(fn), 0755))
+		rtest.OK(t, os.WriteFile(fn, rtest.Random(size, size), 0644))
+	}
+
+	hardlinks := runtime.GOOS != "windows"
+	if hardlinks {
+		// hard links do not increase the restore size
+		rtest.OK(t, os.Link(filepath.Join(env.testdata, "photos", "a.jpg"), filepath.Join(env.testdata, "photos", "c.jpg")))
+	}
+
+	// both snapshots share all files
+	testRunBackup(t, env.testdata, []string{"photos", "code", "top.txt"}, BackupOptions{}, env.gopts)
+	testRunBackup(t, env.testdata, []string{"photos", "code", "top.txt"}, BackupOptions{}, env.gopts)
+
+	jpgCount := uint64(2)
+	if hardlinks {
+		jpgCount = 3
+	}
+
+	stats := testRunStatsJSON(t, StatsOptions{countMode: countModeFilesByType, topDirs: 2}, env.gopts)
+	rtest.Equals(t, 2, stats.SnapshotsCount)
+	rtest.Equals(t, []statsGroup{
+		{Name: "jpg", FileCount: 2 * jpgCount, TotalSize: 2 * 150},
+		{Name: "txt", FileCount: 2 * 3, TotalSize: 2 * 21},
+		{Name: "", FileCount: 2 * 2, TotalSize: 2 * 8},
+	}, stats.FilesByType)
+	rtest.Equals(t, []statsGroup{
+		{Name: "/photos", FileCount: 2 * (jpgCount + 1), TotalSize: 2 * 160},
+		{Name: "/code", FileCount: 2 * 3, TotalSize: 2 * 18},
+	}, stats.TopDirs)
+	rtest.Equals(t, uint64(2*179), stats.TotalSize)
+
+	// the totals match the restore-size mode, which also counts directories
+	restoreStats := testRunStatsJSON(t, StatsOptions{countMode: countModeRestoreSize, topDirs: 3}, env.gopts)
+	rtest.Equals(t, stats.TotalSize, restoreStats.TotalSize)
+	rtest.Equals(t, 0, len(restoreStats.FilesByType))
+	rtest.Equals(t, 3, len(restoreStats.TopDirs))
+	rtest.Equals(t, statsGroup{Name: "/", FileCount: 2, TotalSize: 2}, restoreStats.TopDirs[2])
+
+	// without --top-dirs, subtree statistics from the index are used
+	plainStats := testRunStatsJSON(t, StatsOptions{countMode: countModeRestoreSize}, env.gopts)
+	rtest.Equals(t, restoreStats.TotalSize, plainStats.TotalSize)
+	rtest.Equals(t, restoreStats.TotalFileCount, plainStats.TotalFileCount)
+
+	err := runStats(context.TODO(), StatsOptions{countMode: countModeRawData, topDirs: 2}, env.gopts, nil)
+	rtest.Assert(t, err != nil, "expected error for --top-dirs in raw-data mode")
+}
+
+func TestStatsDebugChunking(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	testRunInit(t, env.gopts)
+
+	// all files are smaller than the minimal chunk size and thus consist of a single blob
+	files := map[string]int{
+		"empty":     0,
+		"one":       1,
+		"small":     100,
+		"dir/page":  4096,
+		"dir/other": 5000,
+		"dir/large": 300000,
+	}
+	for name, size := range files {
+		fn := filepath.Join(env.testdata, filepath.FromSlash(name))
+		rtest.OK(t, os.MkdirAll(filepath.Dir(fn), 0755))
+		rtest.OK(t, os.WriteFile(fn, rtest.Random(size, size), 0644))
+	}
+
+	// the second snapshot shares all trees with the first one
+	testRunBackup(t, env.testdata, []string{"."}, BackupOptions{}, env.gopts)
+	testRunBackup(t, env.testdata, []string{"."}, BackupOptions{}, env.gopts)
+
+	buf, err := withCaptureStdout(func() error {
+		gopts := env.gopts
+		gopts.JSON = true
+		return runStats(context.TODO(), StatsOptions{countMode: countModeDebug}, gopts, nil)
+	})
+	rtest.OK(t, err)
+
+	type histogram struct {
+		Count   uint64
+		Total   uint64
+		Average float64
+		Buckets []log2HistogramBucket
+	}
+	var stats struct {
+		SnapshotsCount int       `json:"snapshots_count"`
+		FileCount      uint64    `json:"file_count"`
+		DataBlobCount  uint64    `json:"data_blob_count"`
+		TreeBlobCount  uint64    `json:"tree_blob_count"`
+		FileSizes      histogram `json:"file_sizes"`
+		BlobsPerFile   histogram `json:"blobs_per_file"`
+		DataBlobSizes  histogram `json:"data_blob_sizes"`
+		TreeBlobSizes  histogram `json:"tree_blob_sizes"`
+	}
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &stats))
+
+	rtest.Equals(t, 2, stats.SnapshotsCount)
+	rtest.Equals(t, uint64(6), stats.FileCount)
+	rtest.Equals(t, uint64(5), stats.DataBlobCount)
+	rtest.Equals(t, histogram{6, 5, 5.0 / 6, []log2HistogramBucket{{0, 0, 1}, {1, 1, 5}}}, stats.BlobsPerFile)
+
+	total := uint64(1 + 100 + 4096 + 5000 + 300000)
+	rtest.Equals(t, total, stats.FileSizes.Total)
+	rtest.Equals(t, total, stats.DataBlobSizes.Total)
+	rtest.Equals(t, uint64(5), stats.DataBlobSizes.Count)
+	rtest.Equals(t, float64(total)/5, stats.DataBlobSizes.Average)
+
+	counts := make(map[uint64]uint64)
+	for _, b := range stats.DataBlobSizes.Buckets {
+		counts[b.Lower] = b.Count
+	}
+	rtest.Equals(t, map[uint64]uint64{
+		1: 1, 2: 0, 4: 0, 8: 0, 16: 0, 32: 0, 64: 1, 128: 0, 256: 0, 512: 0, 1024: 0,
+		2048: 0, 4096: 2, 8192: 0, 16384: 0, 32768: 0, 65536: 0, 131072: 0, 262144: 1,
+	}, counts)
+
+	// each tree is only counted once, thus the tree count does not depend on the number of snapshots
+	rtest.Assert(t, stats.TreeBlobCount >= 2, "expected at least two trees, got %d", stats.TreeBlobCount)
+	rtest.Equals(t, stats.TreeBlobCount, stats.TreeBlobSizes.Count)
+
+	single, err := withCaptureStdout(func() error {
+		gopts := env.gopts
+		gopts.JSON = true
+		return runStats(context.TODO(), StatsOptions{countMode: countModeDebug}, gopts, []string{"latest"})
+	})
+	rtest.OK(t, err)
+	var singleStats struct {
+		SnapshotsCount int    `json:"snapshots_count"`
+		TreeBlobCount  uint64 `json:"tree_blob_count"`
+	}
+	rtest.OK(t, json.Unmarshal(single.Bytes(), &singleStats))
+	rtest.Equals(t, 1, singleStats.SnapshotsCount)
+	rtest.Equals(t, stats.TreeBlobCount, singleStats.TreeBlobCount)
+}
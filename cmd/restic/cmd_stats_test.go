@@ -1,6 +1,7 @@
 package main
 
 import (
+	"math"
 	"testing"
 
 	rtest "github.com/restic/restic/internal/test"
@@ -60,3 +61,42 @@ func TestSizeHistogramString(t *testing.T) {
 		rtest.Equals(t, "Count: 3\nTotal Size: 11 B\nSize          Count\n-------------------\n  0 - 0 Byte  1\n  1 - 9 Byte  1\n10 - 42 Byte  1\n-------------------\n", h.String())
 	})
 }
+
+func TestLog2HistogramBuckets(t *testing.T) {
+	var h log2Histogram
+	for _, v := range []uint64{0, 1, 2, 3, 4, 7, 8, 1<<20 - 1, 1 << 20} {
+		h.Add(v)
+	}
+
+	rtest.Equals(t, uint64(9), h.count)
+	rtest.Equals(t, uint64(2<<20+24), h.total)
+	rtest.Equals(t, float64(2<<20+24)/9, h.Average())
+
+	buckets := h.usedBuckets()
+	rtest.Equals(t, 22, len(buckets))
+	rtest.Equals(t, []log2HistogramBucket{
+		{0, 0, 1},
+		{1, 1, 1},
+		{2, 3, 2},
+		{4, 7, 2},
+		{8, 15, 1},
+	}, buckets[:5])
+	rtest.Equals(t, log2HistogramBucket{1 << 19, 1<<20 - 1, 1}, buckets[20])
+	rtest.Equals(t, log2HistogramBucket{1 << 20, 1<<21 - 1, 1}, buckets[21])
+	for _, b := range buckets[5:20] {
+		rtest.Equals(t, uint64(0), b.Count)
+	}
+
+	lower, upper := bucketRange(64)
+	rtest.Equals(t, uint64(1<<63), lower)
+	rtest.Equals(t, uint64(math.MaxUint64), upper)
+}
+
+func TestLog2HistogramEmpty(t *testing.T) {
+	var h log2Histogram
+	rtest.Equals(t, float64(0), h.Average())
+	rtest.Equals(t, 0, len(h.usedBuckets()))
+
+	h.Add(math.MaxUint64)
+	rtest.Equals(t, []log2HistogramBucket{{1 << 63, math.MaxUint64, 1}}, h.usedBuckets())
+}
@@ -20,8 +20,14 @@ The "tag" command allows you to modify tags on exiting snapshots.
 You can either set/replace the entire set of tags on a snapshot, or
 add tags to/remove tags from the existing set.
 
+Snapshots can also be pinned with "--pin". Pinned snapshots are always kept by
+the "forget" command, regardless of the policy, until they are unpinned again
+using "--unpin".
+
 When no snapshot-ID is given, all snapshots matching the host, tag and path filter criteria are modified.
 
+With "--dry-run" the snapshots are not modified, instead the new tags are printed.
+
 EXIT STATUS
 ===========
 
@@ -39,6 +45,9 @@ type TagOptions struct {
 	SetTags    restic.TagLists
 	AddTags    restic.TagLists
 	RemoveTags restic.TagLists
+	Pin        bool
+	Unpin      bool
+	DryRun     bool
 }
 
 var tagOptions TagOptions
@@ -50,34 +59,46 @@ func init() {
 	tagFlags.Var(&tagOptions.SetTags, "set", "`tags` which will replace the existing tags in the format `tag[,tag,...]` (can be given multiple times)")
 	tagFlags.Var(&tagOptions.AddTags, "add", "`tags` which will be added to the existing tags in the format `tag[,tag,...]` (can be given multiple times)")
 	tagFlags.Var(&tagOptions.RemoveTags, "remove", "`tags` which will be removed from the existing tags in the format `tag[,tag,...]` (can be given multiple times)")
+	tagFlags.BoolVar(&tagOptions.Pin, "pin", false, "pin the snapshots, pinned snapshots are never removed by 'forget'")
+	tagFlags.BoolVar(&tagOptions.Unpin, "unpin", false, "unpin the snapshots")
+	tagFlags.BoolVarP(&tagOptions.DryRun, "dry-run", "n", false, "do not modify any snapshots, just print what would be done")
 	initMultiSnapshotFilter(tagFlags, &tagOptions.SnapshotFilter, true)
 }
 
-func changeTags(ctx context.Context, repo *repository.Repository, sn *restic.Snapshot, setTags, addTags, removeTags []string) (bool, error) {
+func changeTags(ctx context.Context, repo *repository.Repository, sn *restic.Snapshot, setTags, addTags, removeTags []string, pin, unpin, dryRun bool) (bool, error) {
 	var changed bool
 
+	// the tags are changed on a copy which retains the original snapshot id
+	// over all tag changes
+	rewritten := sn.Rewrite()
+
 	if len(setTags) != 0 {
 		// Setting the tag to an empty string really means no tags.
 		if len(setTags) == 1 && setTags[0] == "" {
 			setTags = nil
 		}
-		sn.Tags = setTags
+		rewritten.Tags = setTags
 		changed = true
 	} else {
-		changed = sn.AddTags(addTags)
-		if sn.RemoveTags(removeTags) {
+		changed = rewritten.AddTags(addTags)
+		if rewritten.RemoveTags(removeTags) {
 			changed = true
 		}
 	}
 
-	if changed {
-		// Retain the original snapshot id over all tag changes.
-		if sn.Original == nil {
-			sn.Original = sn.ID()
-		}
+	if (pin && !rewritten.Pinned) || (unpin && rewritten.Pinned) {
+		rewritten.Pinned = pin
+		changed = true
+	}
+
+	if changed && dryRun {
+		printDryRun("replace snapshot %v, new tags %v, pinned %v", sn.ID().Str(), rewritten.Tags, rewritten.Pinned)
+		return true, nil
+	}
 
+	if changed {
 		// Save the new snapshot.
-		id, err := restic.SaveSnapshot(ctx, repo, sn)
+		id, err := restic.SaveSnapshot(ctx, repo, rewritten)
 		if err != nil {
 			return false, err
 		}
@@ -96,11 +117,25 @@ func changeTags(ctx context.Context, repo *repository.Repository, sn *restic.Sna
 }
 
 func runTag(ctx context.Context, opts TagOptions, gopts GlobalOptions, args []string) error {
-	if len(opts.SetTags) == 0 && len(opts.AddTags) == 0 && len(opts.RemoveTags) == 0 {
+	if len(opts.SetTags) == 0 && len(opts.AddTags) == 0 && len(opts.RemoveTags) == 0 && !opts.Pin && !opts.Unpin {
 		return errors.Fatal("nothing to do!")
 	}
+	if opts.Pin && opts.Unpin {
+		return invalidArguments(errors.Fatal("--pin and --unpin cannot be given at the same time"))
+	}
 	if len(opts.SetTags) != 0 && (len(opts.AddTags) != 0 || len(opts.RemoveTags) != 0) {
-		return errors.Fatal("--set and --add/--remove cannot be given at the same time")
+		return invalidArguments(errors.Fatal("--set and --add/--remove cannot be given at the same time"))
+	}
+
+	// changing the tags replaces the snapshots, a dry run does not modify
+	// the repository
+	if !opts.DryRun {
+		if err := checkAppendOnly(gopts, "tag"); err != nil {
+			return err
+		}
+		if err := checkReadOnly(gopts, "tag"); err != nil {
+			return err
+		}
 	}
 
 	repo, err := OpenRepository(ctx, gopts)
@@ -108,7 +143,8 @@ func runTag(ctx context.Context, opts TagOptions, gopts GlobalOptions, args []st
 		return err
 	}
 
-	if !gopts.NoLock {
+	// creating a lock would modify the repository
+	if !gopts.NoLock && !opts.DryRun {
 		Verbosef("create exclusive lock for repository\n")
 		var lock *restic.Lock
 		lock, ctx, err = lockRepoExclusive(ctx, repo, gopts.RetryLock, gopts.JSON)
@@ -120,7 +156,7 @@ func runTag(ctx context.Context, opts TagOptions, gopts GlobalOptions, args []st
 
 	changeCnt := 0
 	for sn := range FindFilteredSnapshots(ctx, repo.Backend(), repo, &opts.SnapshotFilter, args) {
-		changed, err := changeTags(ctx, repo, sn, opts.SetTags.Flatten(), opts.AddTags.Flatten(), opts.RemoveTags.Flatten())
+		changed, err := changeTags(ctx, repo, sn, opts.SetTags.Flatten(), opts.AddTags.Flatten(), opts.RemoveTags.Flatten(), opts.Pin, opts.Unpin, opts.DryRun)
 		if err != nil {
 			Warnf("unable to modify the tags for snapshot ID %q, ignoring: %v\n", sn.ID(), err)
 			continue
@@ -129,7 +165,9 @@ func runTag(ctx context.Context, opts TagOptions, gopts GlobalOptions, args []st
 			changeCnt++
 		}
 	}
-	if changeCnt == 0 {
+	if opts.DryRun {
+		Verbosef("would modify tags on %v snapshots\n", changeCnt)
+	} else if changeCnt == 0 {
 		Verbosef("no snapshots were modified\n")
 	} else {
 		Verbosef("modified tags on %v snapshots\n", changeCnt)
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/restic/restic/internal/restic"
@@ -92,3 +95,101 @@ func TestTag(t *testing.T) {
 	rtest.Assert(t, *newest.Original == originalID,
 		"expected original ID to be set to the first snapshot id")
 }
+
+func TestTagPin(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	testListSnapshots(t, env.gopts, 1)
+	testRunTag(t, TagOptions{Pin: true}, env.gopts)
+	// pinning replaces the snapshot
+	pinnedID := testListSnapshots(t, env.gopts, 1)[0]
+
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	testListSnapshots(t, env.gopts, 3)
+
+	rtest.OK(t, runForget(context.TODO(), ForgetOptions{Last: 1}, env.gopts, nil))
+	snapshotIDs := testListSnapshots(t, env.gopts, 2)
+	rtest.Assert(t, snapshotIDs[0] == pinnedID || snapshotIDs[1] == pinnedID,
+		"pinned snapshot %v was removed, remaining snapshots %v", pinnedID, snapshotIDs)
+
+	// removing the pinned snapshot explicitly is refused as well
+	rtest.OK(t, runForget(context.TODO(), ForgetOptions{}, env.gopts, []string{pinnedID.String()}))
+	testListSnapshots(t, env.gopts, 2)
+
+	buf, err := withCaptureStdout(func() error {
+		return runSnapshots(context.TODO(), SnapshotOptions{}, env.gopts, nil)
+	})
+	rtest.OK(t, err)
+	out := buf.String()
+	rtest.Assert(t, strings.Contains(out, pinnedID.Str()+" (pinned)"), "missing pin marker, output:\n%v", out)
+	rtest.Assert(t, strings.Count(out, "(pinned)") == 1, "unexpected pin markers, output:\n%v", out)
+
+	rtest.OK(t, runForget(context.TODO(), ForgetOptions{Last: 1, IgnorePins: true}, env.gopts, nil))
+	snapshotIDs = testListSnapshots(t, env.gopts, 1)
+	rtest.Assert(t, snapshotIDs[0] != pinnedID, "pinned snapshot was not removed with --ignore-pins")
+}
+
+func TestTagUnknownFields(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	oldID := testListSnapshots(t, env.gopts, 1)[0]
+
+	// simulate a snapshot created by a newer version of restic
+	repo, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+	buf, err := repo.LoadUnpacked(context.TODO(), restic.SnapshotFile, oldID)
+	rtest.OK(t, err)
+	buf = append(buf[:len(buf)-1], []byte(`,"future_field":{"foo":"bar"}}`)...)
+	id, err := repo.SaveUnpacked(context.TODO(), restic.SnapshotFile, buf)
+	rtest.OK(t, err)
+	rtest.OK(t, repo.Backend().Remove(context.TODO(), restic.Handle{Type: restic.SnapshotFile, Name: oldID.String()}))
+
+	unknownFieldsNotice = sync.Once{}
+	stderr := &bytes.Buffer{}
+	rtest.OK(t, withRestoreGlobalOptions(func() error {
+		globalOptions.stderr = stderr
+		return runTag(context.TODO(), TagOptions{AddTags: restic.TagLists{{"foo"}}}, env.gopts, nil)
+	}))
+	rtest.Assert(t, strings.Contains(stderr.String(), id.Str()+" was created by restic "+version) &&
+		strings.Contains(stderr.String(), "(future_field)"), "missing notice, stderr:\n%v", stderr)
+
+	newID := testListSnapshots(t, env.gopts, 1)[0]
+	rtest.Assert(t, newID != id, "snapshot was not modified")
+	sn, err := restic.LoadSnapshot(context.TODO(), repo, newID)
+	rtest.OK(t, err)
+	rtest.Equals(t, restic.TagList{"foo"}, restic.TagList(sn.Tags))
+	rtest.Equals(t, []string{"future_field"}, sn.UnknownFields())
+}
+
+func TestTagDryRun(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	oldID := testListSnapshots(t, env.gopts, 1)[0]
+
+	be := &writeCountingBackend{}
+	gopts := env.gopts
+	gopts.backendTestHook = func(r restic.Backend) (restic.Backend, error) {
+		be.Backend = r
+		return be, nil
+	}
+
+	buf, err := withCaptureStdout(func() error {
+		return runTag(context.TODO(), TagOptions{AddTags: restic.TagLists{{"foo"}}, Pin: true, DryRun: true}, gopts, nil)
+	})
+	rtest.OK(t, err)
+	rtest.Assert(t, strings.Contains(buf.String(), "would replace snapshot "+oldID.Str()+", new tags [foo], pinned true"),
+		"missing dry run output:\n%v", buf.String())
+
+	rtest.Equals(t, int32(0), be.writes)
+	rtest.Equals(t, oldID, testListSnapshots(t, env.gopts, 1)[0])
+}
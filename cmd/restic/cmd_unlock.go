@@ -13,6 +13,8 @@ var unlockCmd = &cobra.Command{
 	Long: `
 The "unlock" command removes stale locks that have been created by other restic processes.
 
+With "--dry-run" the locks which would be removed are only listed.
+
 EXIT STATUS
 ===========
 
@@ -27,6 +29,7 @@ Exit status is 0 if the command was successful, and non-zero if there was any er
 // UnlockOptions collects all options for the unlock command.
 type UnlockOptions struct {
 	RemoveAll bool
+	DryRun    bool
 }
 
 var unlockOptions UnlockOptions
@@ -35,25 +38,56 @@ func init() {
 	cmdRoot.AddCommand(unlockCmd)
 
 	unlockCmd.Flags().BoolVar(&unlockOptions.RemoveAll, "remove-all", false, "remove all locks, even non-stale ones")
+	unlockCmd.Flags().BoolVarP(&unlockOptions.DryRun, "dry-run", "n", false, "do not remove any locks, just print what would be done")
 }
 
 func runUnlock(ctx context.Context, opts UnlockOptions, gopts GlobalOptions) error {
+	// a dry run does not modify the repository
+	if !opts.DryRun {
+		if err := checkReadOnly(gopts, "unlock"); err != nil {
+			return err
+		}
+		if opts.RemoveAll {
+			// removing the locks of other hosts can break their running operations
+			if err := checkAppendOnly(gopts, "unlock --remove-all"); err != nil {
+				return err
+			}
+		}
+	}
+
 	repo, err := OpenRepository(ctx, gopts)
 	if err != nil {
 		return err
 	}
 
+	// unlock must see all locks
+	repo.DisableListCache()
+
 	fn := restic.RemoveStaleLocks
 	if opts.RemoveAll {
 		fn = restic.RemoveAllLocks
 	}
 
-	processed, err := fn(ctx, repo)
+	var report func(restic.ID, *restic.Lock)
+	if opts.DryRun {
+		report = func(id restic.ID, lock *restic.Lock) {
+			if lock == nil {
+				printDryRun("remove lock %v", id.Str())
+				return
+			}
+			printDryRun("remove lock %v held by PID %d on %s by %s, created at %s",
+				id.Str(), lock.PID, lock.Hostname, lock.Username, lock.Time.Format(TimeFormat))
+		}
+	}
+
+	processed, err := fn(ctx, repo, opts.DryRun, report)
 	if err != nil {
 		return err
 	}
 
-	if processed > 0 {
+	if opts.DryRun {
+		Verbosef("would have removed %d locks\n", processed)
+	} else if processed > 0 {
 		Verbosef("successfully removed %d locks\n", processed)
 	}
 	return nil
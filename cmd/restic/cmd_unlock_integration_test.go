@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestUnlockDryRun(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	repo, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+	staleID, err := restic.SaveJSONUnpacked(context.TODO(), repo, restic.LockFile,
+		&restic.Lock{Time: time.Now().Add(-time.Hour), PID: 42, Hostname: "otherhost", Username: "someone"})
+	rtest.OK(t, err)
+	activeID, err := restic.SaveJSONUnpacked(context.TODO(), repo, restic.LockFile,
+		&restic.Lock{Time: time.Now(), PID: 23, Hostname: "otherhost", Username: "someone"})
+	rtest.OK(t, err)
+
+	be := &writeCountingBackend{}
+	gopts := env.gopts
+	gopts.backendTestHook = func(r restic.Backend) (restic.Backend, error) {
+		be.Backend = r
+		return be, nil
+	}
+
+	for _, test := range []struct {
+		opts     UnlockOptions
+		expected []restic.ID
+	}{
+		{UnlockOptions{DryRun: true}, []restic.ID{staleID}},
+		{UnlockOptions{DryRun: true, RemoveAll: true}, []restic.ID{staleID, activeID}},
+	} {
+		buf, err := withCaptureStdout(func() error {
+			return runUnlock(context.TODO(), test.opts, gopts)
+		})
+		rtest.OK(t, err)
+		out := buf.String()
+		rtest.Equals(t, len(test.expected), strings.Count(out, "would remove lock"))
+		for _, id := range test.expected {
+			rtest.Assert(t, strings.Contains(out, "would remove lock "+id.Str()+" held by PID"),
+				"missing lock %v in output:\n%v", id.Str(), out)
+		}
+		rtest.Assert(t, strings.Contains(out, "on otherhost by someone"), "missing lock holder in output:\n%v", out)
+	}
+
+	rtest.Equals(t, int32(0), be.writes)
+	rtest.OK(t, runUnlock(context.TODO(), UnlockOptions{RemoveAll: true}, env.gopts))
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"runtime"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
@@ -14,18 +16,62 @@ var versionCmd = &cobra.Command{
 The "version" command prints detailed information about the build environment
 and the version of this software.
 
+With "--json", the output also lists the optional features, for example FUSE
+support, and whether they are available in this binary.
+
 EXIT STATUS
 ===========
 
 Exit status is 0 if the command was successful, and non-zero if there was any error.
 `,
 	DisableAutoGenTag: true,
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Printf("restic %s compiled with %v on %v/%v\n",
-			version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runVersion(globalOptions, args)
 	},
 }
 
 func init() {
 	cmdRoot.AddCommand(versionCmd)
 }
+
+// versionJSON is the JSON representation of the version information.
+type versionJSON struct {
+	Version   string          `json:"version"`
+	Commit    string          `json:"commit"`
+	GoVersion string          `json:"go_version"`
+	GoOS      string          `json:"go_os"`
+	GoArch    string          `json:"go_arch"`
+	Features  map[string]bool `json:"features"`
+}
+
+func runVersion(gopts GlobalOptions, args []string) error {
+	if len(args) > 0 {
+		return invalidArgumentsf("the version command expects no arguments")
+	}
+
+	if gopts.JSON {
+		return json.NewEncoder(gopts.stdout).Encode(versionJSON{
+			Version:   version,
+			Commit:    commit,
+			GoVersion: runtime.Version(),
+			GoOS:      runtime.GOOS,
+			GoArch:    runtime.GOARCH,
+			Features:  features,
+		})
+	}
+
+	fmt.Fprintf(gopts.stdout, "restic %s compiled with %v on %v/%v\n",
+		version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	if commit != "" {
+		fmt.Fprintf(gopts.stdout, "commit %s\n", commit)
+	}
+
+	var enabled []string
+	for _, name := range featureNames() {
+		if features[name] {
+			enabled = append(enabled, name)
+		}
+	}
+	fmt.Fprintf(gopts.stdout, "features: %s\n", strings.Join(enabled, ", "))
+	return nil
+}
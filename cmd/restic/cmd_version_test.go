@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"runtime"
+	"strings"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestVersionJSON(t *testing.T) {
+	buf := &bytes.Buffer{}
+	gopts := globalOptions
+	gopts.stdout = buf
+	gopts.JSON = true
+	rtest.OK(t, runVersion(gopts, nil))
+
+	var out map[string]interface{}
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &out))
+	for _, key := range []string{"version", "commit", "go_version", "go_os", "go_arch", "features"} {
+		_, ok := out[key]
+		rtest.Assert(t, ok, "key %v is missing in %v", key, buf.String())
+	}
+	rtest.Equals(t, version, out["version"])
+	rtest.Equals(t, runtime.GOOS, out["go_os"])
+
+	f, ok := out["features"].(map[string]interface{})
+	rtest.Assert(t, ok, "features is not an object: %v", out["features"])
+	for _, name := range featureNames() {
+		rtest.Equals(t, features[name], f[name])
+	}
+	rtest.Equals(t, true, f["compression"])
+}
+
+func TestVersionPlain(t *testing.T) {
+	oldCommit := commit
+	commit = "0123456789abcdef"
+	defer func() { commit = oldCommit }()
+
+	buf := &bytes.Buffer{}
+	gopts := globalOptions
+	gopts.stdout = buf
+	rtest.OK(t, runVersion(gopts, nil))
+
+	rtest.Assert(t, strings.HasPrefix(buf.String(), "restic "+version+" compiled with"), "unexpected output %q", buf.String())
+	rtest.Assert(t, strings.Contains(buf.String(), "commit 0123456789abcdef\n"), "commit is missing in %q", buf.String())
+	rtest.Assert(t, strings.Contains(buf.String(), "compression"), "features are missing in %q", buf.String())
+}
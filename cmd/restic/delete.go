@@ -38,7 +38,7 @@ func deleteFiles(ctx context.Context, gopts GlobalOptions, ignoreError bool, rep
 		return nil
 	})
 
-	bar := newProgressMax(!gopts.JSON && !gopts.Quiet, uint64(totalCount), "files deleted")
+	bar := newProgressMax(gopts, !gopts.JSON && !gopts.Quiet, uint64(totalCount), "files deleted")
 	defer bar.Done()
 	// deleting files is IO-bound
 	workerCount := repo.Connections()
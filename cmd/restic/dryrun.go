@@ -0,0 +1,7 @@
+package main
+
+// printDryRun prints an action which was not performed because of --dry-run.
+// All destructive commands use it, such that their dry run output looks alike.
+func printDryRun(format string, args ...interface{}) {
+	Printf("would "+format+"\n", args...)
+}
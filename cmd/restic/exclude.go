@@ -9,12 +9,12 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"unicode/utf8"
 
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/filter"
 	"github.com/restic/restic/internal/fs"
-	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/textfile"
 	"github.com/restic/restic/internal/ui"
 	"github.com/spf13/pflag"
@@ -66,42 +66,38 @@ func (rc *rejectionCache) Store(dir string, rejected bool) {
 
 // RejectByNameFunc is a function that takes a filename of a
 // file that would be included in the backup. The function returns true if it
-// should be excluded (rejected) from the backup.
-type RejectByNameFunc func(path string) bool
+// should be excluded (rejected) from the backup, along with the reason.
+type RejectByNameFunc func(path string) (rejected bool, reason string)
 
 // RejectFunc is a function that takes a filename and os.FileInfo of a
 // file that would be included in the backup. The function returns true if it
-// should be excluded (rejected) from the backup.
-type RejectFunc func(path string, fi os.FileInfo) bool
+// should be excluded (rejected) from the backup, along with the reason.
+type RejectFunc func(path string, fi os.FileInfo) (rejected bool, reason string)
 
 // rejectByPattern returns a RejectByNameFunc which rejects files that match
 // one of the patterns.
 func rejectByPattern(patterns []string) RejectByNameFunc {
-	parsedPatterns := filter.ParsePatterns(patterns)
-	return func(item string) bool {
-		matched, err := filter.List(parsedPatterns, item)
+	return rejectByParsedPatterns(filter.ParsePatterns(patterns))
+}
+
+// Same as `rejectByPattern` but case insensitive.
+func rejectByInsensitivePattern(patterns []string) RejectByNameFunc {
+	return rejectByParsedPatterns(filter.ParseInsensitivePatterns(patterns))
+}
+
+func rejectByParsedPatterns(parsedPatterns []filter.Pattern) RejectByNameFunc {
+	return func(item string) (bool, string) {
+		matched, pattern, err := filter.ListMatch(parsedPatterns, item)
 		if err != nil {
 			Warnf("error for exclude pattern: %v", err)
 		}
 
 		if matched {
-			debug.Log("path %q excluded by an exclude pattern", item)
-			return true
+			debug.Log("path %q excluded by exclude pattern %q", item, pattern)
+			return true, fmt.Sprintf("matches exclude pattern %q", pattern)
 		}
 
-		return false
-	}
-}
-
-// Same as `rejectByPattern` but case insensitive.
-func rejectByInsensitivePattern(patterns []string) RejectByNameFunc {
-	for index, path := range patterns {
-		patterns[index] = strings.ToLower(path)
-	}
-
-	rejFunc := rejectByPattern(patterns)
-	return func(item string) bool {
-		return rejFunc(strings.ToLower(item))
+		return false, ""
 	}
 }
 
@@ -129,8 +125,11 @@ func rejectIfPresent(excludeFileSpec string) (RejectByNameFunc, error) {
 	}
 	debug.Log("using %q as exclusion tagfile", tf)
 	rc := &rejectionCache{}
-	fn := func(filename string) bool {
-		return isExcludedByFile(filename, tf, tc, rc)
+	fn := func(filename string) (bool, string) {
+		if isExcludedByFile(filename, tf, tc, rc) {
+			return true, fmt.Sprintf("directory contains exclusion tagfile %q", tf)
+		}
+		return false, ""
 	}
 	return fn, nil
 }
@@ -279,7 +278,7 @@ func rejectByDevice(samples []string) (RejectFunc, error) {
 	}
 	debug.Log("allowed devices: %v\n", deviceMap)
 
-	return func(item string, fi os.FileInfo) bool {
+	return func(item string, fi os.FileInfo) (bool, string) {
 		id, err := fs.DeviceID(fi)
 		if err != nil {
 			// This should never happen because gatherDevices() would have
@@ -295,12 +294,12 @@ func rejectByDevice(samples []string) (RejectFunc, error) {
 
 		if allowed {
 			// accept item
-			return false
+			return false, ""
 		}
 
 		// reject everything except directories
 		if !fi.IsDir() {
-			return true
+			return true, "on a different file system"
 		}
 
 		// special case: make sure we keep mountpoints (directories which
@@ -312,54 +311,237 @@ func rejectByDevice(samples []string) (RejectFunc, error) {
 		if err != nil {
 			debug.Log("item %v: error running lstat() on parent directory: %v", item, err)
 			// if in doubt, reject
-			return true
+			return true, "on a different file system"
 		}
 
 		parentDeviceID, err := fs.DeviceID(parentFI)
 		if err != nil {
 			debug.Log("item %v: getting device ID of parent directory: %v", item, err)
 			// if in doubt, reject
-			return true
+			return true, "on a different file system"
 		}
 
 		parentAllowed, err := deviceMap.IsAllowed(parentDir, parentDeviceID)
 		if err != nil {
 			debug.Log("item %v: error checking parent directory: %v", item, err)
 			// if in doubt, reject
-			return true
+			return true, "on a different file system"
 		}
 
 		if parentAllowed {
 			// we found a mount point, so accept the directory
-			return false
+			return false, ""
 		}
 
 		// reject everything else
-		return true
+		return true, "on a different file system"
 	}, nil
 }
 
-// rejectResticCache returns a RejectByNameFunc that rejects the restic cache
-// directory (if set).
-func rejectResticCache(repo *repository.Repository) (RejectByNameFunc, error) {
-	if repo.Cache == nil {
-		return func(string) bool {
-			return false
-		}, nil
+// resticDir is a directory used by restic itself, i.e. the repository or the
+// cache, which must not be saved in a backup.
+type resticDir struct {
+	// paths contains the absolute path of the directory, and the path with
+	// all symlinks resolved if it differs.
+	paths  []string
+	reason string
+
+	// deviceID and inode identify the directory if it is reached via a bind
+	// mount, inode is zero if this is not supported by the file system.
+	deviceID, inode uint64
+}
+
+// newResticDir returns the resticDir for dir.
+func newResticDir(dir, reason string) (resticDir, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return resticDir{}, err
 	}
-	cacheBase := repo.Cache.BaseDir()
 
-	if cacheBase == "" {
-		return nil, errors.New("cacheBase is empty string")
+	d := resticDir{paths: []string{dir}, reason: reason}
+	if real, err := filepath.EvalSymlinks(dir); err == nil && real != dir {
+		d.paths = append(d.paths, real)
 	}
 
-	return func(item string) bool {
-		if fs.HasPathPrefix(cacheBase, item) {
-			debug.Log("rejecting restic cache directory %v", item)
+	fi, err := fs.Stat(dir)
+	if err != nil {
+		return resticDir{}, err
+	}
+	ext := fs.ExtendedStat(fi)
+	d.deviceID, d.inode = ext.DeviceID, ext.Inode
+
+	return d, nil
+}
+
+// contains returns true if item is stored within the directory according to
+// its path.
+func (d resticDir) contains(item string) bool {
+	for _, path := range d.paths {
+		if fs.HasPathPrefix(path, item) {
 			return true
 		}
+	}
+	return false
+}
 
-		return false
+// insideTarget returns true if the directory is located within one of the
+// targets, but is not a target itself.
+func (d resticDir) insideTarget(targets []string) bool {
+	for _, target := range targets {
+		for _, path := range d.paths {
+			if fs.HasPathPrefix(target, path) && !fs.HasPathPrefix(path, target) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rejectResticDirs returns a RejectFunc which rejects the given directories
+// used by restic. A directory is matched by its path, also with symlinks
+// resolved, and by its device ID and inode, so that it is also found via a
+// bind mount. Directories which contain one of the targets are not rejected,
+// so that a part of the repository can still be saved on purpose. The
+// directories which are located within a target are returned as well.
+func rejectResticDirs(dirs []resticDir, targets []string) (RejectFunc, []resticDir, error) {
+	var absTargets []string
+	for _, target := range targets {
+		target, err := filepath.Abs(target)
+		if err != nil {
+			return nil, nil, err
+		}
+		absTargets = append(absTargets, target)
+		if real, err := filepath.EvalSymlinks(target); err == nil && real != target {
+			absTargets = append(absTargets, real)
+		}
+	}
+
+	var rejected, inside []resticDir
+	for _, d := range dirs {
+		containsTarget := false
+		for _, target := range absTargets {
+			if d.contains(target) {
+				containsTarget = true
+				break
+			}
+		}
+		if containsTarget {
+			debug.Log("%v contains a target, not rejecting it", d.paths[0])
+			continue
+		}
+
+		rejected = append(rejected, d)
+		if d.insideTarget(absTargets) {
+			inside = append(inside, d)
+		}
+	}
+
+	return func(item string, fi os.FileInfo) (bool, string) {
+		for _, d := range rejected {
+			if d.contains(item) {
+				debug.Log("rejecting %v %v", d.reason, item)
+				return true, d.reason
+			}
+
+			if d.inode != 0 && fi.IsDir() {
+				ext := fs.ExtendedStat(fi)
+				if ext.DeviceID == d.deviceID && ext.Inode == d.inode {
+					debug.Log("rejecting %v %v, found via bind mount", d.reason, item)
+					return true, d.reason
+				}
+			}
+		}
+
+		return false, ""
+	}, inside, nil
+}
+
+// ignoreScopes caches the scope of the ignore files for each directory.
+type ignoreScopes struct {
+	filename string
+
+	m      sync.Mutex
+	scopes map[string]*filter.Scope
+}
+
+// get returns the scope for dir, which contains the patterns of the ignore
+// files in dir and all its parent directories.
+func (s *ignoreScopes) get(dir string) *filter.Scope {
+	s.m.Lock()
+	scope, ok := s.scopes[dir]
+	s.m.Unlock()
+	if ok {
+		return scope
+	}
+
+	var parent *filter.Scope
+	if p := filepath.Dir(dir); p != dir {
+		parent = s.get(p)
+	}
+	scope = s.load(dir, parent)
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	if existing, ok := s.scopes[dir]; ok {
+		// another goroutine has loaded the ignore file concurrently
+		return existing
+	}
+	s.scopes[dir] = scope
+	return scope
+}
+
+// load returns parent with the patterns of the ignore file in dir pushed on
+// top, or parent if there is no ignore file.
+func (s *ignoreScopes) load(dir string, parent *filter.Scope) *filter.Scope {
+	f, err := fs.Open(filepath.Join(dir, s.filename))
+	if os.IsNotExist(err) {
+		return parent
+	}
+	if err != nil {
+		Warnf("could not open ignore file: %v\n", err)
+		return parent
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	scope, err := parent.Push(dir, s.filename, f)
+	if scope == nil {
+		Warnf("could not read ignore file %q: %v\n", filepath.Join(dir, s.filename), err)
+		return parent
+	}
+	if err != nil {
+		Warnf("ignore file %q: %v\n", filepath.Join(dir, s.filename), err)
+	}
+	debug.Log("loaded ignore file in %v", dir)
+	return scope
+}
+
+// rejectByIgnoreFiles returns a RejectFunc which rejects files and
+// directories matching the patterns in the ignore files called filename in
+// their parent directories, similar to .gitignore files. The patterns of an
+// ignore file are relative to the directory containing it and apply to the
+// whole subtree.
+func rejectByIgnoreFiles(filename string) (RejectFunc, error) {
+	if filename == "" || filename != filepath.Base(filename) {
+		return nil, errors.Fatalf("invalid name for ignore file %q", filename)
+	}
+
+	s := &ignoreScopes{
+		filename: filename,
+		scopes:   make(map[string]*filter.Scope),
+	}
+	return func(item string, fi os.FileInfo) (bool, string) {
+		scope := s.get(filepath.Dir(item))
+		ignored, file, pattern, err := scope.Match(item, fi.IsDir())
+		if err != nil {
+			Warnf("error for ignore file pattern: %v\n", err)
+		}
+		if ignored {
+			debug.Log("path %q excluded by pattern %q in %v", item, pattern, file)
+			return true, fmt.Sprintf("matches pattern %q in ignore file %q", pattern, file)
+		}
+		return false, ""
 	}, nil
 }
 
@@ -369,27 +551,109 @@ func rejectBySize(maxSizeStr string) (RejectFunc, error) {
 		return nil, err
 	}
 
-	return func(item string, fi os.FileInfo) bool {
+	return func(item string, fi os.FileInfo) (bool, string) {
 		// directory will be ignored
 		if fi.IsDir() {
-			return false
+			return false, ""
 		}
 
 		filesize := fi.Size()
 		if filesize > maxSize {
 			debug.Log("file %s is oversize: %d", item, filesize)
-			return true
+			return true, fmt.Sprintf("larger than %v", maxSizeStr)
 		}
 
-		return false
+		return false, ""
 	}, nil
 }
 
+// rejectNoDump returns a RejectFunc which rejects files and directories which
+// have the nodump file flag set. It returns nil if the platform has no nodump
+// flag.
+func rejectNoDump() RejectFunc {
+	if !fs.NoDumpSupported {
+		return nil
+	}
+	return func(item string, fi os.FileInfo) (bool, string) {
+		if fs.NoDump(fi) {
+			debug.Log("item %v has the nodump flag set", item)
+			return true, "nodump flag set"
+		}
+		return false, ""
+	}
+}
+
+// fileAttributeNames maps the names accepted by --exclude-file-attrs to the
+// Windows file attributes.
+var fileAttributeNames = map[string]uint32{
+	"READONLY":              fs.FileAttributeReadonly,
+	"HIDDEN":                fs.FileAttributeHidden,
+	"SYSTEM":                fs.FileAttributeSystem,
+	"ARCHIVE":               fs.FileAttributeArchive,
+	"TEMPORARY":             fs.FileAttributeTemporary,
+	"SPARSE_FILE":           fs.FileAttributeSparseFile,
+	"COMPRESSED":            fs.FileAttributeCompressed,
+	"OFFLINE":               fs.FileAttributeOffline,
+	"NOT_CONTENT_INDEXED":   fs.FileAttributeNotContentIndexed,
+	"ENCRYPTED":             fs.FileAttributeEncrypted,
+	"RECALL_ON_OPEN":        fs.FileAttributeRecallOnOpen,
+	"RECALL_ON_DATA_ACCESS": fs.FileAttributeRecallOnDataAccess,
+}
+
+// parseFileAttributes returns the combined Windows file attributes for names,
+// which may be specified with or without the "FILE_ATTRIBUTE_" prefix and are
+// case insensitive.
+func parseFileAttributes(names []string) (uint32, error) {
+	var attrs uint32
+	for _, name := range names {
+		key := strings.ToUpper(strings.TrimSpace(name))
+		key = strings.TrimPrefix(key, "FILE_ATTRIBUTE_")
+		attr, ok := fileAttributeNames[key]
+		if !ok {
+			return 0, errors.Fatalf("unknown file attribute %q", name)
+		}
+		attrs |= attr
+	}
+	return attrs, nil
+}
+
+// rejectByFileAttributes returns a RejectFunc which rejects files and
+// directories which have at least one of the Windows file attributes in attrs.
+// It returns nil on platforms other than Windows.
+func rejectByFileAttributes(attrs uint32) RejectFunc {
+	if !fs.FileAttributesSupported {
+		return nil
+	}
+	return func(item string, fi os.FileInfo) (bool, string) {
+		if match := fs.FileAttributes(fi) & attrs; match != 0 {
+			debug.Log("item %v has file attributes %#x", item, match)
+			return true, fmt.Sprintf("file attributes %#x set", match)
+		}
+		return false, ""
+	}
+}
+
+// patternFileEncodingWarning returns a description of the problem if the
+// decoded contents of a pattern file contain characters which suggest that the
+// file uses an unsupported encoding. Otherwise, the empty string is returned.
+func patternFileEncodingWarning(data []byte) string {
+	switch {
+	case bytes.IndexByte(data, 0) >= 0:
+		return "contains NUL bytes, it is probably encoded as UTF-16 without byte order mark"
+	case !utf8.Valid(data):
+		return "is not valid UTF-8, it is probably encoded using a legacy code page"
+	case bytes.ContainsRune(data, utf8.RuneError):
+		return "contains invalid characters"
+	}
+	return ""
+}
+
 // readExcludePatternsFromFiles reads all exclude files and returns the list of
-// exclude patterns. For each line, leading and trailing white space is removed
-// and comment lines are ignored. For each remaining pattern, environment
-// variables are resolved. For adding a literal dollar sign ($), write $$ to
-// the file.
+// exclude patterns. Files can be encoded as UTF-8 or as UTF-16 with byte order
+// mark, and may use CRLF line endings. For each line, leading and trailing
+// white space is removed and comment lines are ignored. For each remaining
+// pattern, environment variables are resolved. For adding a literal dollar
+// sign ($), write $$ to the file.
 func readExcludePatternsFromFiles(excludeFiles []string) ([]string, error) {
 	getenvOrDollar := func(s string) string {
 		if s == "$" {
@@ -406,6 +670,10 @@ func readExcludePatternsFromFiles(excludeFiles []string) ([]string, error) {
 				return err
 			}
 
+			if msg := patternFileEncodingWarning(data); msg != "" {
+				Warnf("exclude file %v %v, save it as UTF-8 or as UTF-16 with byte order mark\n", filename, msg)
+			}
+
 			scanner := bufio.NewScanner(bytes.NewReader(data))
 			for scanner.Scan() {
 				line := strings.TrimSpace(scanner.Text())
@@ -460,7 +728,7 @@ func (opts excludePatternOptions) CollectPatterns() ([]RejectByNameFunc, error)
 		}
 
 		if err := filter.ValidatePatterns(excludePatterns); err != nil {
-			return nil, errors.Fatalf("--exclude-file: %s", err)
+			return nil, invalidArgumentsf("--exclude-file: %s", err)
 		}
 
 		opts.Excludes = append(opts.Excludes, excludePatterns...)
@@ -473,7 +741,7 @@ func (opts excludePatternOptions) CollectPatterns() ([]RejectByNameFunc, error)
 		}
 
 		if err := filter.ValidatePatterns(excludes); err != nil {
-			return nil, errors.Fatalf("--iexclude-file: %s", err)
+			return nil, invalidArgumentsf("--iexclude-file: %s", err)
 		}
 
 		opts.InsensitiveExcludes = append(opts.InsensitiveExcludes, excludes...)
@@ -481,7 +749,7 @@ func (opts excludePatternOptions) CollectPatterns() ([]RejectByNameFunc, error)
 
 	if len(opts.InsensitiveExcludes) > 0 {
 		if err := filter.ValidatePatterns(opts.InsensitiveExcludes); err != nil {
-			return nil, errors.Fatalf("--iexclude: %s", err)
+			return nil, invalidArgumentsf("--iexclude: %s", err)
 		}
 
 		fs = append(fs, rejectByInsensitivePattern(opts.InsensitiveExcludes))
@@ -489,7 +757,7 @@ func (opts excludePatternOptions) CollectPatterns() ([]RejectByNameFunc, error)
 
 	if len(opts.Excludes) > 0 {
 		if err := filter.ValidatePatterns(opts.Excludes); err != nil {
-			return nil, errors.Fatalf("--exclude: %s", err)
+			return nil, invalidArgumentsf("--exclude: %s", err)
 		}
 
 		fs = append(fs, rejectByPattern(opts.Excludes))
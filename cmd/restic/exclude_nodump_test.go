@@ -0,0 +1,58 @@
+//go:build freebsd || darwin || netbsd
+// +build freebsd darwin netbsd
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/test"
+	"golang.org/x/sys/unix"
+)
+
+// ufNoDump is the UF_NODUMP file flag.
+const ufNoDump = 0x00000001
+
+func TestRejectNoDump(t *testing.T) {
+	tempDir := test.TempDir(t)
+
+	files := []struct {
+		path   string
+		nodump bool
+		incl   bool
+	}{
+		{"file", false, true},
+		{"nodump", true, false},
+		{"dir/file", false, true},
+		{"nodumpdir", true, false},
+	}
+
+	for _, f := range files {
+		p := filepath.Join(tempDir, filepath.FromSlash(f.path))
+		test.OK(t, os.MkdirAll(filepath.Dir(p), 0700))
+		if f.path == "nodumpdir" {
+			test.OK(t, os.Mkdir(p, 0700))
+		} else {
+			test.OK(t, os.WriteFile(p, []byte(f.path), 0600))
+		}
+		if f.nodump {
+			test.OK(t, unix.Chflags(p, ufNoDump))
+		}
+	}
+
+	reject := rejectNoDump()
+	test.Assert(t, reject != nil, "nodump flag should be supported on this platform")
+
+	for _, f := range files {
+		p := filepath.Join(tempDir, filepath.FromSlash(f.path))
+		fi, err := os.Lstat(p)
+		test.OK(t, err)
+
+		excluded, _ := reject(p, fi)
+		if excluded == f.incl {
+			t.Errorf("inclusion status of %s is wrong: want %v, got %v", f.path, f.incl, !excluded)
+		}
+	}
+}
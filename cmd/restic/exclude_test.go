@@ -3,9 +3,13 @@ package main
 import (
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 
+	"github.com/restic/restic/internal/fs"
 	"github.com/restic/restic/internal/test"
+	"golang.org/x/text/encoding/unicode"
 )
 
 func TestRejectByPattern(t *testing.T) {
@@ -26,11 +30,14 @@ func TestRejectByPattern(t *testing.T) {
 	for _, tc := range tests {
 		t.Run("", func(t *testing.T) {
 			reject := rejectByPattern(patterns)
-			res := reject(tc.filename)
+			res, reason := reject(tc.filename)
 			if res != tc.reject {
 				t.Fatalf("wrong result for filename %v: want %v, got %v",
 					tc.filename, tc.reject, res)
 			}
+			if res != (reason != "") {
+				t.Fatalf("wrong reason for filename %v: %q", tc.filename, reason)
+			}
 		})
 	}
 }
@@ -53,11 +60,14 @@ func TestRejectByInsensitivePattern(t *testing.T) {
 	for _, tc := range tests {
 		t.Run("", func(t *testing.T) {
 			reject := rejectByInsensitivePattern(patterns)
-			res := reject(tc.filename)
+			res, reason := reject(tc.filename)
 			if res != tc.reject {
 				t.Fatalf("wrong result for filename %v: want %v, got %v",
 					tc.filename, tc.reject, res)
 			}
+			if res != (reason != "") {
+				t.Fatalf("wrong reason for filename %v: %q", tc.filename, reason)
+			}
 		})
 	}
 }
@@ -164,8 +174,8 @@ func TestMultipleIsExcludedByFile(t *testing.T) {
 		if err != nil {
 			return err
 		}
-		excludedByFoo := fooExclude(p)
-		excludedByBar := barExclude(p)
+		excludedByFoo, _ := fooExclude(p)
+		excludedByBar, _ := barExclude(p)
 		excluded := excludedByFoo || excludedByBar
 		// the log message helps debugging in case the test fails
 		t.Logf("%q: %v || %v = %v", p, excludedByFoo, excludedByBar, excluded)
@@ -249,7 +259,7 @@ func TestIsExcludedByFileSize(t *testing.T) {
 			return err
 		}
 
-		excluded := sizeExclude(p, fi)
+		excluded, _ := sizeExclude(p, fi)
 		// the log message helps debugging in case the test fails
 		t.Logf("%q: dir:%t; size:%d; excluded:%v", p, fi.IsDir(), fi.Size(), excluded)
 		m[p] = !excluded
@@ -310,3 +320,168 @@ func TestDeviceMap(t *testing.T) {
 		})
 	}
 }
+
+func TestRejectResticDirs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("creating symlinks requires additional privileges on Windows")
+	}
+
+	tempdir := test.TempDir(t)
+	repo := filepath.Join(tempdir, "data", "repo")
+	test.OK(t, os.MkdirAll(filepath.Join(repo, "keys"), 0700))
+	test.OK(t, os.MkdirAll(filepath.Join(tempdir, "data", "work"), 0700))
+
+	// the repository is also reachable via a symlink
+	link := filepath.Join(tempdir, "link")
+	test.OK(t, os.Symlink(filepath.Join(tempdir, "data"), link))
+
+	d, err := newResticDir(repo, "restic repository")
+	test.OK(t, err)
+
+	var tests = []struct {
+		targets  []string
+		inside   bool
+		rejected []string
+		accepted []string
+	}{
+		// repository inside the target
+		{
+			targets:  []string{tempdir},
+			inside:   true,
+			rejected: []string{repo, filepath.Join(repo, "keys"), filepath.Join(link, "repo")},
+			accepted: []string{filepath.Join(tempdir, "data"), filepath.Join(tempdir, "data", "work")},
+		},
+		// repository inside the target, which is accessed via a symlink. The
+		// directory itself is found by its inode, so the archiver never
+		// descends into it.
+		{
+			targets:  []string{link},
+			inside:   true,
+			rejected: []string{filepath.Join(link, "repo")},
+			accepted: []string{filepath.Join(link, "work")},
+		},
+		// the target is the repository
+		{
+			targets:  []string{repo},
+			accepted: []string{repo, filepath.Join(repo, "keys")},
+		},
+		// target inside the repository
+		{
+			targets:  []string{filepath.Join(repo, "keys")},
+			accepted: []string{filepath.Join(repo, "keys")},
+		},
+		// unrelated target, the repository is still rejected if it is found
+		{
+			targets:  []string{filepath.Join(tempdir, "data", "work")},
+			rejected: []string{repo},
+			accepted: []string{filepath.Join(tempdir, "data", "work")},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run("", func(t *testing.T) {
+			reject, inside, err := rejectResticDirs([]resticDir{d}, tc.targets)
+			test.OK(t, err)
+			test.Equals(t, tc.inside, len(inside) == 1)
+
+			for _, item := range tc.rejected {
+				fi, err := os.Lstat(item)
+				test.OK(t, err)
+				res, reason := reject(item, fi)
+				test.Assert(t, res, "%v was not rejected", item)
+				test.Equals(t, "restic repository", reason)
+			}
+			for _, item := range tc.accepted {
+				fi, err := os.Lstat(item)
+				test.OK(t, err)
+				res, _ := reject(item, fi)
+				test.Assert(t, !res, "%v was rejected", item)
+			}
+		})
+	}
+}
+
+func TestParseFileAttributes(t *testing.T) {
+	var tests = []struct {
+		names []string
+		attrs uint32
+		err   bool
+	}{
+		{nil, 0, false},
+		{[]string{"TEMPORARY"}, fs.FileAttributeTemporary, false},
+		{[]string{"temporary", "Offline", " SYSTEM "}, fs.FileAttributeTemporary | fs.FileAttributeOffline | fs.FileAttributeSystem, false},
+		{[]string{"FILE_ATTRIBUTE_HIDDEN"}, fs.FileAttributeHidden, false},
+		{[]string{"TEMPORARY", "FOO"}, 0, true},
+		{[]string{""}, 0, true},
+	}
+
+	for _, tt := range tests {
+		attrs, err := parseFileAttributes(tt.names)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%v: expected error, got none", tt.names)
+			}
+			continue
+		}
+		test.OK(t, err)
+		test.Equals(t, tt.attrs, attrs)
+	}
+}
+
+func encodeUTF16(t testing.TB, s string, endianness unicode.Endianness) []byte {
+	data, err := unicode.UTF16(endianness, unicode.UseBOM).NewEncoder().Bytes([]byte(s))
+	test.OK(t, err)
+	return data
+}
+
+func TestReadExcludePatternsFromFiles(t *testing.T) {
+	const content = "# comment\r\n*.go\r\n\r\n  foo  \r\nC:\\Users\\*\\AppData\r\n"
+	expected := []string{"*.go", "foo", `C:\Users\*\AppData`}
+
+	var tests = []struct {
+		name string
+		data []byte
+	}{
+		{"utf8", []byte(strings.ReplaceAll(content, "\r\n", "\n"))},
+		{"utf8-crlf", []byte(content)},
+		{"utf8-bom", append([]byte{0xef, 0xbb, 0xbf}, content...)},
+		{"utf16le-bom", encodeUTF16(t, content, unicode.LittleEndian)},
+		{"utf16be-bom", encodeUTF16(t, content, unicode.BigEndian)},
+	}
+
+	tempDir := test.TempDir(t)
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			filename := filepath.Join(tempDir, tc.name)
+			test.OK(t, os.WriteFile(filename, tc.data, 0600))
+
+			patterns, err := readExcludePatternsFromFiles([]string{filename})
+			test.OK(t, err)
+			test.Equals(t, expected, patterns)
+		})
+	}
+}
+
+func TestPatternFileEncodingWarning(t *testing.T) {
+	utf16WithoutBOM, err := unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM).NewEncoder().Bytes([]byte("*.go\r\n"))
+	test.OK(t, err)
+
+	var tests = []struct {
+		name string
+		data []byte
+		warn bool
+	}{
+		{"utf8", []byte("*.go\nfoo\n"), false},
+		{"utf8-non-ascii", []byte("/home/user/Ärger\n"), false},
+		{"utf16le-without-bom", utf16WithoutBOM, true},
+		{"latin1", []byte("/home/user/\xc4rger\n"), true},
+		{"replacement-character", []byte("/home/user/\uFFFDrger\n"), true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			msg := patternFileEncodingWarning(tc.data)
+			test.Assert(t, (msg != "") == tc.warn, "unexpected warning %q", msg)
+		})
+	}
+}
@@ -0,0 +1,80 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/test"
+	"golang.org/x/sys/windows"
+	"golang.org/x/text/encoding/unicode"
+)
+
+func TestRejectByFileAttributes(t *testing.T) {
+	tempDir := test.TempDir(t)
+
+	files := []struct {
+		path  string
+		attrs uint32
+		incl  bool
+	}{
+		{"file", 0, true},
+		{"hidden", windows.FILE_ATTRIBUTE_HIDDEN, true},
+		{"temporary", windows.FILE_ATTRIBUTE_TEMPORARY, false},
+		{"offline", windows.FILE_ATTRIBUTE_OFFLINE, false},
+		{"system", windows.FILE_ATTRIBUTE_SYSTEM | windows.FILE_ATTRIBUTE_HIDDEN, false},
+	}
+
+	for _, f := range files {
+		p := filepath.Join(tempDir, f.path)
+		test.OK(t, os.WriteFile(p, []byte(f.path), 0600))
+		if f.attrs != 0 {
+			name, err := windows.UTF16PtrFromString(p)
+			test.OK(t, err)
+			test.OK(t, windows.SetFileAttributes(name, f.attrs))
+		}
+	}
+
+	attrs, err := parseFileAttributes([]string{"TEMPORARY", "OFFLINE", "SYSTEM"})
+	test.OK(t, err)
+	reject := rejectByFileAttributes(attrs)
+	test.Assert(t, reject != nil, "file attributes should be supported on Windows")
+
+	for _, f := range files {
+		p := filepath.Join(tempDir, f.path)
+		fi, err := fs.Lstat(p)
+		test.OK(t, err)
+
+		excluded, _ := reject(p, fi)
+		if excluded == f.incl {
+			t.Errorf("inclusion status of %s is wrong: want %v, got %v", f.path, f.incl, !excluded)
+		}
+	}
+}
+
+func TestRejectByPatternFileWindowsPaths(t *testing.T) {
+	filename := filepath.Join(test.TempDir(t), "excludes")
+	test.OK(t, os.WriteFile(filename, encodeUTF16(t, "C:\\Users\\*\\AppData\r\n**\\*.tmp\r\n", unicode.LittleEndian), 0600))
+
+	patterns, err := readExcludePatternsFromFiles([]string{filename})
+	test.OK(t, err)
+	reject := rejectByPattern(patterns)
+
+	for _, tc := range []struct {
+		path   string
+		reject bool
+	}{
+		{`C:\Users\bob\AppData`, true},
+		{`C:\Users\bob\AppData\Local\file`, true},
+		{`C:\Users\bob\Documents\file`, false},
+		{`D:\temp\build.tmp`, true},
+		{`D:\temp\build.txt`, false},
+	} {
+		rejected, _ := reject(tc.path)
+		test.Assert(t, rejected == tc.reject, "path %v: expected reject=%v, got %v", tc.path, tc.reject, rejected)
+	}
+}
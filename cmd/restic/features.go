@@ -0,0 +1,35 @@
+package main
+
+import "sort"
+
+// features lists the optional features of restic and whether they are
+// available in this binary. Features which depend on build tags or the target
+// platform are disabled here and enabled by the files implementing them via
+// enableFeature, so the list printed by "restic version --json" contains the
+// same keys for all builds.
+var features = map[string]bool{
+	"cgo":         false,
+	"compression": true,
+	"debug":       false,
+	"fuse":        false,
+	"self-update": false,
+}
+
+// enableFeature marks the feature name as available. It must only be called
+// from init functions.
+func enableFeature(name string) {
+	if _, ok := features[name]; !ok {
+		panic("unknown feature " + name)
+	}
+	features[name] = true
+}
+
+// featureNames returns the names of all features in sorted order.
+func featureNames() []string {
+	names := make([]string, 0, len(features))
+	for name := range features {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"strings"
+	"sync"
 
 	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/restic"
@@ -17,7 +19,7 @@ func initMultiSnapshotFilter(flags *pflag.FlagSet, filt *restic.SnapshotFilter,
 	}
 	flags.StringArrayVarP(&filt.Hosts, "host", hostShorthand, nil, "only consider snapshots for this `host` (can be specified multiple times)")
 	flags.Var(&filt.Tags, "tag", "only consider snapshots including `tag[,tag,...]` (can be specified multiple times)")
-	flags.StringArrayVar(&filt.Paths, "path", nil, "only consider snapshots including this (absolute) `path` (can be specified multiple times)")
+	flags.StringArrayVar(&filt.Paths, "path", nil, "only consider snapshots including this (absolute) `path` or a path below it (can be specified multiple times)")
 }
 
 // initSingleSnapshotFilter is used for commands that work on a single snapshot
@@ -25,7 +27,7 @@ func initMultiSnapshotFilter(flags *pflag.FlagSet, filt *restic.SnapshotFilter,
 func initSingleSnapshotFilter(flags *pflag.FlagSet, filt *restic.SnapshotFilter) {
 	flags.StringArrayVarP(&filt.Hosts, "host", "H", nil, "only consider snapshots for this `host`, when snapshot ID \"latest\" is given (can be specified multiple times)")
 	flags.Var(&filt.Tags, "tag", "only consider snapshots including `tag[,tag,...]`, when snapshot ID \"latest\" is given (can be specified multiple times)")
-	flags.StringArrayVar(&filt.Paths, "path", nil, "only consider snapshots including this (absolute) `path`, when snapshot ID \"latest\" is given (can be specified multiple times)")
+	flags.StringArrayVar(&filt.Paths, "path", nil, "only consider snapshots including this (absolute) `path` or a path below it, when snapshot ID \"latest\" is given (can be specified multiple times)")
 }
 
 // FindFilteredSnapshots yields Snapshots, either given explicitly by `snapshotIDs` or filtered from the list of all snapshots.
@@ -39,10 +41,18 @@ func FindFilteredSnapshots(ctx context.Context, be restic.Lister, loader restic.
 			return
 		}
 
+		if f.LoadErrorFn == nil {
+			// skip damaged snapshots while searching the latest snapshot
+			fc := *f
+			fc.LoadErrorFn = warnSnapshotLoadError
+			f = &fc
+		}
+
 		err = f.FindAll(ctx, be, loader, snapshotIDs, func(id string, sn *restic.Snapshot, err error) error {
 			if err != nil {
 				Warnf("Ignoring %q: %v\n", id, err)
 			} else {
+				noticeUnknownFields(sn)
 				select {
 				case <-ctx.Done():
 					return ctx.Err()
@@ -57,3 +67,30 @@ func FindFilteredSnapshots(ctx context.Context, be restic.Lister, loader restic.
 	}()
 	return out
 }
+
+// warnSnapshotLoadError is used as SnapshotFilter.LoadErrorFn to skip
+// snapshots which cannot be loaded, for example because an interrupted backup
+// left a partially written snapshot file behind.
+func warnSnapshotLoadError(id restic.ID, err error) {
+	Warnf("Ignoring snapshot %v: %v\n", id.Str(), err)
+}
+
+var unknownFieldsNotice sync.Once
+
+// noticeUnknownFields tells the user once if a snapshot was created by a
+// version of restic which stores data this version does not know about.
+func noticeUnknownFields(sn *restic.Snapshot) {
+	fields := sn.UnknownFields()
+	if len(fields) == 0 {
+		return
+	}
+
+	unknownFieldsNotice.Do(func() {
+		creator := sn.ProgramVersion
+		if creator == "" {
+			creator = "an unknown program"
+		}
+		Warnf("snapshot %v was created by %v and contains fields unknown to restic %v (%v), they are kept unchanged if the snapshot is modified\n",
+			sn.ID().Str(), creator, version, strings.Join(fields, ", "))
+	})
+}
@@ -12,7 +12,7 @@ func TestFlags(t *testing.T) {
 		t.Run(cmd.Name(), func(t *testing.T) {
 			cmd.Flags().SetOutput(io.Discard)
 			err := cmd.ParseFlags([]string{"--help"})
-			if err.Error() == "pflag: help requested" {
+			if err != nil && err.Error() == "pflag: help requested" {
 				err = nil
 			}
 
@@ -3,12 +3,53 @@ package main
 import (
 	"fmt"
 	"os"
+	"time"
+	"unicode/utf8"
 
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/ui"
 )
 
-func formatNode(path string, n *restic.Node, long bool, human bool) string {
+// Timezone is a time zone given on the command line. Allowed values are
+// "Local", "UTC" and the names of the IANA time zone database, like
+// "Europe/Berlin". The zero value is the local time zone.
+type Timezone struct {
+	loc *time.Location
+}
+
+func (tz *Timezone) Set(s string) error {
+	loc, err := time.LoadLocation(s)
+	if err != nil {
+		return fmt.Errorf("invalid time zone %q: %v", s, err)
+	}
+	tz.loc = loc
+	return nil
+}
+
+func (tz *Timezone) String() string {
+	return tz.Location().String()
+}
+
+func (tz *Timezone) Type() string {
+	return "timezone"
+}
+
+// Location returns the time zone, time.Local is used if none was set.
+func (tz *Timezone) Location() *time.Location {
+	if tz.loc == nil {
+		return time.Local
+	}
+	return tz.loc
+}
+
+// formatTime formats t in the time zone loc.
+func formatTime(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format(TimeFormat)
+}
+
+func formatNode(path string, n *restic.Node, long bool, human bool, loc *time.Location) string {
+	// node names are stored as raw bytes, escape them if they are not UTF-8
+	path = ui.EscapeInvalidUTF8(path)
 	if !long {
 		return path
 	}
@@ -30,7 +71,7 @@ func formatNode(path string, n *restic.Node, long bool, human bool) string {
 		mode = os.ModeDir
 	case "symlink":
 		mode = os.ModeSymlink
-		target = fmt.Sprintf(" -> %v", n.LinkTarget)
+		target = fmt.Sprintf(" -> %v", ui.EscapeInvalidUTF8(n.LinkTarget))
 	case "dev":
 		mode = os.ModeDevice
 	case "chardev":
@@ -41,8 +82,26 @@ func formatNode(path string, n *restic.Node, long bool, human bool) string {
 		mode = os.ModeSocket
 	}
 
-	return fmt.Sprintf("%s %5d %5d %s %s %s%s",
-		mode|n.Mode, n.UID, n.GID, size,
-		n.ModTime.Local().Format(TimeFormat), path,
+	return fmt.Sprintf("%s %5d %5d %-8s %-8s %s %s %s%s",
+		mode|n.Mode, n.UID, n.GID, ownerName(n.User), ownerName(n.Group), size,
+		formatTime(n.ModTime, loc), path,
 		target)
 }
+
+// ownerName returns name, or "-" if the name is unknown.
+func ownerName(name string) string {
+	if name == "" {
+		return "-"
+	}
+	return name
+}
+
+// rawBytes returns the bytes of s if it is not valid UTF-8 and nil otherwise.
+// It is used to add the original bytes of a name to the JSON output, as the
+// JSON encoder replaces invalid UTF-8 with the Unicode replacement character.
+func rawBytes(s string) []byte {
+	if utf8.ValidString(s) {
+		return nil
+	}
+	return []byte(s)
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"testing"
 	"time"
+	// the tests must not depend on the time zone database of the system
+	_ "time/tzdata"
 
 	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
@@ -45,17 +47,53 @@ func TestFormatNode(t *testing.T) {
 			Node:   node,
 			long:   true,
 			human:  false,
-			expect: "----------  1000  2000 14680064 2020-01-02 03:04:05 " + testPath,
+			expect: "----------  1000  2000 -        -        14680064 2020-01-02 03:04:05 " + testPath,
 		},
 		{
 			path:   testPath,
 			Node:   node,
 			long:   true,
 			human:  true,
-			expect: "----------  1000  2000 14.000 MiB 2020-01-02 03:04:05 " + testPath,
+			expect: "----------  1000  2000 -        -        14.000 MiB 2020-01-02 03:04:05 " + testPath,
+		},
+		{
+			path: testPath,
+			Node: restic.Node{
+				Name:    "baz",
+				Type:    "file",
+				Size:    14680064,
+				UID:     1000,
+				GID:     2000,
+				User:    "user",
+				Group:   "users",
+				ModTime: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+			},
+			long:   true,
+			human:  false,
+			expect: "----------  1000  2000 user     users    14680064 2020-01-02 03:04:05 " + testPath,
 		},
 	} {
-		r := formatNode(c.path, &c.Node, c.long, c.human)
+		r := formatNode(c.path, &c.Node, c.long, c.human, time.Local)
 		rtest.Equals(t, c.expect, r)
 	}
 }
+
+func TestTimezone(t *testing.T) {
+	var tz Timezone
+	rtest.Equals(t, time.Local, tz.Location())
+
+	ts := time.Date(2024, 10, 27, 1, 15, 0, 0, time.UTC)
+	for _, test := range []struct {
+		zone, formatted string
+	}{
+		{"UTC", "2024-10-27 01:15:00"},
+		{"Europe/Berlin", "2024-10-27 02:15:00"},
+		{"Asia/Kolkata", "2024-10-27 06:45:00"},
+	} {
+		rtest.OK(t, tz.Set(test.zone))
+		rtest.Equals(t, test.zone, tz.String())
+		rtest.Equals(t, test.formatted, formatTime(ts, tz.Location()))
+	}
+
+	rtest.Assert(t, tz.Set("Invalid/Zone") != nil, "expected error for invalid time zone")
+}
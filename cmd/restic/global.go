@@ -10,23 +10,32 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/appendonly"
 	"github.com/restic/restic/internal/backend/azure"
 	"github.com/restic/restic/internal/backend/b2"
+	"github.com/restic/restic/internal/backend/consistency"
 	"github.com/restic/restic/internal/backend/gs"
 	"github.com/restic/restic/internal/backend/limiter"
 	"github.com/restic/restic/internal/backend/local"
 	"github.com/restic/restic/internal/backend/location"
 	"github.com/restic/restic/internal/backend/logger"
 	"github.com/restic/restic/internal/backend/rclone"
+	"github.com/restic/restic/internal/backend/readonly"
 	"github.com/restic/restic/internal/backend/rest"
 	"github.com/restic/restic/internal/backend/retry"
 	"github.com/restic/restic/internal/backend/s3"
 	"github.com/restic/restic/internal/backend/sema"
 	"github.com/restic/restic/internal/backend/sftp"
+	"github.com/restic/restic/internal/backend/stats"
 	"github.com/restic/restic/internal/backend/swift"
+	"github.com/restic/restic/internal/backend/trace"
+	"github.com/restic/restic/internal/backend/trash"
+	"github.com/restic/restic/internal/backend/watchdog"
+	"github.com/restic/restic/internal/backend/webdav"
 	"github.com/restic/restic/internal/cache"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/fs"
@@ -34,6 +43,7 @@ import (
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/textfile"
+	"github.com/restic/restic/internal/ui"
 	"github.com/restic/restic/internal/ui/termstatus"
 
 	"github.com/restic/restic/internal/errors"
@@ -45,6 +55,9 @@ import (
 
 var version = "0.16.0-dev (compiled manually)"
 
+// commit is the git commit restic was built from, it is set by build.go.
+var commit = ""
+
 // TimeFormat is the format used for all timestamps printed by restic.
 const TimeFormat = "2006-01-02 15:04:05"
 
@@ -52,24 +65,44 @@ type backendWrapper func(r restic.Backend) (restic.Backend, error)
 
 // GlobalOptions hold all global options for restic.
 type GlobalOptions struct {
-	Repo            string
-	RepositoryFile  string
-	PasswordFile    string
-	PasswordCommand string
-	KeyHint         string
-	Quiet           bool
-	Verbose         int
-	NoLock          bool
-	RetryLock       time.Duration
-	JSON            bool
-	CacheDir        string
-	NoCache         bool
-	CleanupCache    bool
-	Compression     repository.CompressionMode
-	PackSize        uint
+	Repo             string
+	RepositoryFile   string
+	RepositoriesFile string
+	PasswordFile     string
+	PasswordCommand  string
+	KeyHint          string
+	ExpectRepoID     string
+	Quiet            bool
+	Verbose          int
+	NoLock           bool
+	AppendOnly       bool
+	ReadOnly         bool
+	VerifyBackend    bool
+	RetryLock        time.Duration
+	RetryCount       int
+	RetryMaxDelay    time.Duration
+	JSON             bool
+	CacheDir         string
+	NoCache          bool
+	CleanupCache     bool
+	Compression      repository.CompressionMode
+	PackSize         uint
+	Connections      uint
+	RepoMaxSize      string
+	LogFile          string
+	LogLevel         string
+	LogJSON          bool
+	TraceBackend     string
+	NoProgress       bool
+	ProgressInterval time.Duration
+	NotifyCommand    string
+	NotifyURL        string
+	MetricsFile      string
+	StatusListen     string
 
 	backend.TransportOptions
 	limiter.Limits
+	ProfileOptions
 
 	password string
 	stdout   io.Writer
@@ -83,6 +116,7 @@ type GlobalOptions struct {
 	//  1 is the default: print essential messages
 	//  2 means: print more messages, report minor things, this is used when --verbose is specified
 	//  3 means: print very detailed debug messages, this is used when --verbose=2 is specified
+	//  4 means: also print the reasons for decisions, this is used when --verbose=3 is specified
 	verbosity uint
 
 	Options []string
@@ -109,6 +143,7 @@ func init() {
 	backends.Register(s3.NewFactory())
 	backends.Register(sftp.NewFactory())
 	backends.Register(swift.NewFactory())
+	backends.Register(webdav.NewFactory())
 	globalOptions.backends = backends
 
 	var cancel context.CancelFunc
@@ -123,38 +158,66 @@ func init() {
 	f := cmdRoot.PersistentFlags()
 	f.StringVarP(&globalOptions.Repo, "repo", "r", "", "`repository` to backup to or restore from (default: $RESTIC_REPOSITORY)")
 	f.StringVarP(&globalOptions.RepositoryFile, "repository-file", "", "", "`file` to read the repository location from (default: $RESTIC_REPOSITORY_FILE)")
+	f.StringVar(&globalOptions.RepositoriesFile, "repositories-file", "", "`file` which defines the repositories that can be selected using --repo name:<name> (default: $RESTIC_REPOSITORIES_FILE or restic/repos.toml in the user config directory)")
 	f.StringVarP(&globalOptions.PasswordFile, "password-file", "p", "", "`file` to read the repository password from (default: $RESTIC_PASSWORD_FILE)")
 	f.StringVarP(&globalOptions.KeyHint, "key-hint", "", "", "`key` ID of key to try decrypting first (default: $RESTIC_KEY_HINT)")
+	f.StringVar(&globalOptions.ExpectRepoID, "expect-repo-id", "", "abort unless the repository ID starts with `prefix` (default: $RESTIC_EXPECTED_REPO_ID)")
 	f.StringVarP(&globalOptions.PasswordCommand, "password-command", "", "", "shell `command` to obtain the repository password from (default: $RESTIC_PASSWORD_COMMAND)")
 	f.BoolVarP(&globalOptions.Quiet, "quiet", "q", false, "do not output comprehensive progress report")
+	f.BoolVar(&globalOptions.NoProgress, "no-progress", false, "do not output progress reports, but still print messages and summaries")
+	f.DurationVar(&globalOptions.ProgressInterval, "progress-interval", 0, "update progress reports every `duration` (default: 60 times per second on terminals, every 30s otherwise, or $RESTIC_PROGRESS_FPS)")
 	// use empty paremeter name as `-v, --verbose n` instead of the correct `--verbose=n` is confusing
-	f.CountVarP(&globalOptions.Verbose, "verbose", "v", "be verbose (specify multiple times or a level using --verbose=n``, max level/times is 2)")
+	f.CountVarP(&globalOptions.Verbose, "verbose", "v", "be verbose (specify multiple times or a level using --verbose=n``, max level/times is 3)")
 	f.BoolVar(&globalOptions.NoLock, "no-lock", false, "do not lock the repository, this allows some operations on read-only repositories")
+	f.BoolVar(&globalOptions.AppendOnly, "append-only", false, "refuse to remove or overwrite data in the repository, except for locks (default: $RESTIC_APPEND_ONLY)")
+	f.BoolVar(&globalOptions.ReadOnly, "read-only", false, "refuse to modify the repository in any way, implies --no-lock (default: $RESTIC_READ_ONLY)")
+	f.BoolVar(&globalOptions.VerifyBackend, "verify-backend", false, "check that new and removed files immediately show up in the backend, warn about delays")
 	f.DurationVar(&globalOptions.RetryLock, "retry-lock", 0, "retry to lock the repository if it is already locked, takes a value like 5m or 2h (default: no retries)")
+	f.IntVar(&globalOptions.RetryCount, "retry-count", 10, "retry failed backend operations `n` times, 0 disables retries, -1 retries until the command is interrupted")
+	f.DurationVar(&globalOptions.RetryMaxDelay, "retry-max-delay", time.Minute, "maximum `duration` to wait between retries of failed backend operations")
 	f.BoolVarP(&globalOptions.JSON, "json", "", false, "set output mode to JSON for commands that support it")
 	f.StringVar(&globalOptions.CacheDir, "cache-dir", "", "set the cache `directory`. (default: use system default cache directory)")
 	f.BoolVar(&globalOptions.NoCache, "no-cache", false, "do not use a local cache")
 	f.StringSliceVar(&globalOptions.RootCertFilenames, "cacert", nil, "`file` to load root certificates from (default: use system certificates or $RESTIC_CACERT)")
 	f.StringVar(&globalOptions.TLSClientCertKeyFilename, "tls-client-cert", "", "path to a `file` containing PEM encoded TLS client certificate and private key (default: $RESTIC_TLS_CLIENT_CERT)")
+	f.StringVar(&globalOptions.TLSClientKeyFilename, "tls-client-key", "", "path to a `file` containing the PEM encoded TLS client private key, if it is not contained in the certificate file (default: $RESTIC_TLS_CLIENT_KEY)")
 	f.BoolVar(&globalOptions.InsecureTLS, "insecure-tls", false, "skip TLS certificate verification when connecting to the repository (insecure)")
 	f.BoolVar(&globalOptions.CleanupCache, "cleanup-cache", false, "auto remove old cache directories")
 	f.Var(&globalOptions.Compression, "compression", "compression mode (only available for repository format version 2), one of (auto|off|max) (default: $RESTIC_COMPRESSION)")
 	f.IntVar(&globalOptions.Limits.UploadKb, "limit-upload", 0, "limits uploads to a maximum `rate` in KiB/s. (default: unlimited)")
 	f.IntVar(&globalOptions.Limits.DownloadKb, "limit-download", 0, "limits downloads to a maximum `rate` in KiB/s. (default: unlimited)")
 	f.UintVar(&globalOptions.PackSize, "pack-size", 0, "set target pack `size` in MiB, created pack files may be larger (default: $RESTIC_PACK_SIZE)")
+	f.UintVar(&globalOptions.Connections, "connections", 0, "set the number of concurrent backend connections `n`, overrides the connections option of the backend (default: backend specific)")
+	f.StringVar(&globalOptions.RepoMaxSize, "repo-max-size", "", "refuse to grow the repository beyond `size`, e.g. 500G (default: $RESTIC_REPO_MAX_SIZE)")
 	f.StringSliceVarP(&globalOptions.Options, "option", "o", []string{}, "set extended option (`key=value`, can be specified multiple times)")
+	f.StringVar(&globalOptions.LogFile, "log-file", "", "append log messages to `file` (default: $RESTIC_LOG_FILE)")
+	f.StringVar(&globalOptions.LogLevel, "log-level", "info", "write log messages up to `level` to the log file, one of (error|warn|info|debug)")
+	f.BoolVar(&globalOptions.LogJSON, "log-json", false, "write the log file as JSON lines")
+	f.StringVar(&globalOptions.TraceBackend, "trace-backend", "", "append a line for each backend request to `file` (default: $RESTIC_TRACE_BACKEND)")
+	f.StringVar(&globalOptions.NotifyCommand, "notify-command", "", "shell `command` to run when the command has finished, the outcome is passed via environment variables (default: $RESTIC_NOTIFY_COMMAND)")
+	f.StringVar(&globalOptions.NotifyURL, "notify-url", "", "`URL` to post a JSON document describing the outcome to when the command has finished (default: $RESTIC_NOTIFY_URL)")
+	f.StringVar(&globalOptions.MetricsFile, "metrics-file", "", "write metrics about the command in the Prometheus text format to `file` when the command has finished (default: $RESTIC_METRICS_FILE)")
+	f.StringVar(&globalOptions.StatusListen, "status-listen", "", "serve the progress of the running operation via HTTP on `address`, e.g. 127.0.0.1:0")
 	// Use our "generate" command instead of the cobra provided "completion" command
 	cmdRoot.CompletionOptions.DisableDefaultCmd = true
 
 	globalOptions.Repo = os.Getenv("RESTIC_REPOSITORY")
 	globalOptions.RepositoryFile = os.Getenv("RESTIC_REPOSITORY_FILE")
+	globalOptions.RepositoriesFile = os.Getenv("RESTIC_REPOSITORIES_FILE")
 	globalOptions.PasswordFile = os.Getenv("RESTIC_PASSWORD_FILE")
 	globalOptions.KeyHint = os.Getenv("RESTIC_KEY_HINT")
+	globalOptions.ExpectRepoID = os.Getenv("RESTIC_EXPECTED_REPO_ID")
 	globalOptions.PasswordCommand = os.Getenv("RESTIC_PASSWORD_COMMAND")
+	globalOptions.LogFile = os.Getenv("RESTIC_LOG_FILE")
+	globalOptions.TraceBackend = os.Getenv("RESTIC_TRACE_BACKEND")
+	globalOptions.NotifyCommand = os.Getenv("RESTIC_NOTIFY_COMMAND")
+	globalOptions.NotifyURL = os.Getenv("RESTIC_NOTIFY_URL")
+	globalOptions.MetricsFile = os.Getenv("RESTIC_METRICS_FILE")
 	if os.Getenv("RESTIC_CACERT") != "" {
 		globalOptions.RootCertFilenames = strings.Split(os.Getenv("RESTIC_CACERT"), ",")
 	}
 	globalOptions.TLSClientCertKeyFilename = os.Getenv("RESTIC_TLS_CLIENT_CERT")
+	globalOptions.TLSClientKeyFilename = os.Getenv("RESTIC_TLS_CLIENT_KEY")
 	comp := os.Getenv("RESTIC_COMPRESSION")
 	if comp != "" {
 		// ignore error as there's no good way to handle it
@@ -163,6 +226,10 @@ func init() {
 	// parse target pack size from env, on error the default value will be used
 	targetPackSize, _ := strconv.ParseUint(os.Getenv("RESTIC_PACK_SIZE"), 10, 32)
 	globalOptions.PackSize = uint(targetPackSize)
+	globalOptions.RepoMaxSize = os.Getenv("RESTIC_REPO_MAX_SIZE")
+	// parse append-only mode from env, on error it stays disabled
+	globalOptions.AppendOnly, _ = strconv.ParseBool(os.Getenv("RESTIC_APPEND_ONLY"))
+	globalOptions.ReadOnly, _ = strconv.ParseBool(os.Getenv("RESTIC_READ_ONLY"))
 
 	restoreTerminal()
 }
@@ -226,8 +293,13 @@ func restoreTerminal() {
 // ClearLine creates a platform dependent string to clear the current
 // line, so it can be overwritten.
 //
-// w should be the terminal width, or 0 to let clearLine figure it out.
+// w should be the terminal width, or 0 to let clearLine figure it out. If
+// stdout cannot update lines in place, the returned string is empty.
 func clearLine(w int) string {
+	if !stdoutCanUpdateStatus() {
+		return ""
+	}
+
 	if runtime.GOOS != "windows" {
 		return "\x1b[2K"
 	}
@@ -266,17 +338,21 @@ func Println(args ...interface{}) {
 }
 
 // Verbosef calls Printf to write the message when the verbose flag is set.
+// The message is always written to the log.
 func Verbosef(format string, args ...interface{}) {
 	if globalOptions.verbosity >= 1 {
 		Printf(format, args...)
 	}
+	ui.Log(ui.LogInfo, format, args...)
 }
 
-// Verboseff calls Printf to write the message when the verbosity is >= 2
+// Verboseff calls Printf to write the message when the verbosity is >= 2.
+// The message is always written to the log.
 func Verboseff(format string, args ...interface{}) {
 	if globalOptions.verbosity >= 2 {
 		Printf(format, args...)
 	}
+	ui.Log(ui.LogInfo, format, args...)
 }
 
 // Warnf writes the message to the configured stderr stream.
@@ -286,12 +362,13 @@ func Warnf(format string, args ...interface{}) {
 		fmt.Fprintf(os.Stderr, "unable to write to stderr: %v\n", err)
 	}
 	debug.Log(format, args...)
+	ui.Log(ui.LogWarn, format, args...)
 }
 
 // resolvePassword determines the password to be used for opening the repository.
 func resolvePassword(opts GlobalOptions, envStr string) (string, error) {
 	if opts.PasswordFile != "" && opts.PasswordCommand != "" {
-		return "", errors.Fatalf("Password file and command are mutually exclusive options")
+		return "", invalidArgumentsf("Password file and command are mutually exclusive options")
 	}
 	if opts.PasswordCommand != "" {
 		args, err := backend.SplitShellStrings(opts.PasswordCommand)
@@ -399,13 +476,13 @@ func ReadPasswordTwice(gopts GlobalOptions, prompt1, prompt2 string) (string, er
 
 func ReadRepo(opts GlobalOptions) (string, error) {
 	if opts.Repo == "" && opts.RepositoryFile == "" {
-		return "", errors.Fatal("Please specify repository location (-r or --repository-file)")
+		return "", invalidArguments(errors.Fatal("Please specify repository location (-r or --repository-file)"))
 	}
 
 	repo := opts.Repo
 	if opts.RepositoryFile != "" {
 		if repo != "" {
-			return "", errors.Fatal("Options -r and --repository-file are mutually exclusive, please specify only one")
+			return "", invalidArguments(errors.Fatal("Options -r and --repository-file are mutually exclusive, please specify only one"))
 		}
 
 		s, err := textfile.Read(opts.RepositoryFile)
@@ -426,11 +503,35 @@ const maxKeys = 20
 
 // OpenRepository reads the password and opens the repository.
 func OpenRepository(ctx context.Context, opts GlobalOptions) (*repository.Repository, error) {
+	return openRepository(ctx, opts, false)
+}
+
+// openRepository opens the repository. If allowInvalidConfig is set, the
+// repository is returned without a config and cache if only the config
+// cannot be read.
+func openRepository(ctx context.Context, opts GlobalOptions, allowInvalidConfig bool) (*repository.Repository, error) {
 	repo, err := ReadRepo(opts)
 	if err != nil {
 		return nil, err
 	}
 
+	if opts.ExpectRepoID != "" {
+		if err := checkRepoIDPrefix(opts.ExpectRepoID); err != nil {
+			return nil, invalidArguments(err)
+		}
+	}
+	if opts.VerifyBackend {
+		if err := checkReadOnly(opts, "--verify-backend"); err != nil {
+			return nil, err
+		}
+	}
+
+	_, _, consistencyCfg, err := backendOptions(opts.extended)
+	if err != nil {
+		return nil, err
+	}
+	restic.SetLockConsistencyDelay(consistencyCfg.ConsistencyDelay)
+
 	be, err := open(ctx, repo, opts, opts.extended)
 	if err != nil {
 		return nil, err
@@ -442,7 +543,9 @@ func OpenRepository(ctx context.Context, opts GlobalOptions) (*repository.Reposi
 	success := func(msg string, retries int) {
 		Warnf("%v operation successful after %d retries\n", msg, retries)
 	}
-	be = retry.New(be, 10, report, success)
+	rbe := retry.New(be, opts.RetryCount, report, success)
+	rbe.MaxDelay = opts.RetryMaxDelay
+	be = rbe
 
 	// wrap backend if a test specified a hook
 	if opts.backendTestHook != nil {
@@ -452,9 +555,16 @@ func OpenRepository(ctx context.Context, opts GlobalOptions) (*repository.Reposi
 		}
 	}
 
+	maxSize, indexFlushThreshold, err := repositoryOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
 	s, err := repository.New(be, repository.Options{
-		Compression: opts.Compression,
-		PackSize:    opts.PackSize * 1024 * 1024,
+		Compression:         opts.Compression,
+		PackSize:            opts.PackSize * 1024 * 1024,
+		MaxSize:             maxSize,
+		IndexFlushThreshold: indexFlushThreshold,
 	})
 	if err != nil {
 		return nil, errors.Fatal(err.Error())
@@ -476,18 +586,39 @@ func OpenRepository(ctx context.Context, opts GlobalOptions) (*repository.Reposi
 		}
 
 		err = s.SearchKey(ctx, opts.password, maxKeys, opts.KeyHint)
+		if errors.Is(err, restic.ErrInvalidConfig) {
+			// the password was correct
+			break
+		}
 		if err != nil && passwordTriesLeft > 1 {
 			opts.password = ""
 			fmt.Fprintf(os.Stderr, "%s. Try again\n", err)
 		}
 	}
+	if errors.Is(err, restic.ErrInvalidConfig) {
+		if opts.ExpectRepoID != "" {
+			return nil, errors.Fatalf("%s\nunable to verify the expected repository ID %v", err, opts.ExpectRepoID)
+		}
+		if allowInvalidConfig {
+			return s, nil
+		}
+		return nil, &invalidConfigError{err: err}
+	}
 	if err != nil {
-		if errors.IsFatal(err) {
+		if errors.IsFatal(err) || errors.Is(err, repository.ErrNoKeyFound) {
 			return nil, err
 		}
 		return nil, errors.Fatalf("%s", err)
 	}
 
+	// verify the repository before any lock is created in it
+	if opts.ExpectRepoID != "" {
+		if err := checkRepoID(opts.ExpectRepoID, s.Config().ID, location.StripPassword(opts.backends, repo)); err != nil {
+			return nil, err
+		}
+	}
+	recordRepository(s.Config().ID)
+
 	if stdoutIsTerminal() && !opts.JSON {
 		id := s.Config().ID
 		if len(id) > 8 {
@@ -502,6 +633,21 @@ func OpenRepository(ctx context.Context, opts GlobalOptions) (*repository.Reposi
 		}
 	}
 
+	if opts.VerifyBackend {
+		if err := verifyBackend(ctx, s.Backend(), consistencyCfg.ConsistencyDelay); err != nil {
+			return nil, err
+		}
+	}
+
+	cacheCfg, err := cacheConfig(opts.extended)
+	if err != nil {
+		return nil, err
+	}
+	dataCacheSize, err := cacheCfg.DataCacheSize()
+	if err != nil {
+		return nil, invalidArguments(err)
+	}
+
 	if opts.NoCache {
 		return s, nil
 	}
@@ -511,6 +657,12 @@ func OpenRepository(ctx context.Context, opts GlobalOptions) (*repository.Reposi
 		Warnf("unable to open cache: %v\n", err)
 		return s, nil
 	}
+	c.SetListTTL(cacheCfg.ListTTL)
+	c.SetDataCacheSize(dataCacheSize)
+	c.SetMaxWriteErrors(cacheCfg.MaxWriteErrors)
+	c.SetWarnFunc(func(msg string) {
+		Warnf("%s\n", msg)
+	})
 
 	if c.Created && !opts.JSON && stdoutIsTerminal() {
 		Verbosef("created new cache in %v\n", c.Base)
@@ -551,7 +703,7 @@ func OpenRepository(ctx context.Context, opts GlobalOptions) (*repository.Reposi
 	return s, nil
 }
 
-func parseConfig(loc location.Location, opts options.Options) (interface{}, error) {
+func parseConfig(loc location.Location, opts options.Options, connections uint) (interface{}, error) {
 	cfg := loc.Config
 	if cfg, ok := cfg.(restic.ApplyEnvironmenter); ok {
 		cfg.ApplyEnvironment("")
@@ -559,6 +711,10 @@ func parseConfig(loc location.Location, opts options.Options) (interface{}, erro
 
 	// only apply options for a particular backend here
 	opts = opts.Extract(loc.Scheme)
+	if connections > 0 {
+		// --connections takes precedence over the backend specific option
+		opts["connections"] = strconv.FormatUint(uint64(connections), 10)
+	}
 	if err := opts.Apply(loc.Scheme, cfg); err != nil {
 		return nil, err
 	}
@@ -577,32 +733,53 @@ func open(ctx context.Context, s string, gopts GlobalOptions, opts options.Optio
 
 	var be restic.Backend
 
-	cfg, err := parseConfig(loc, opts)
+	cfg, err := parseConfig(loc, opts, gopts.Connections)
+	if err != nil {
+		return nil, err
+	}
+
+	_, watchdogCfg, _, err := backendOptions(opts)
 	if err != nil {
 		return nil, err
 	}
 
-	rt, err := backend.Transport(globalOptions.TransportOptions)
+	tropts := gopts.TransportOptions
+	tropts.ConnectTimeout = watchdogCfg.ConnectTimeout
+	rt, err := backend.Transport(tropts)
 	if err != nil {
 		return nil, errors.Fatal(err.Error())
 	}
 
-	// wrap the transport so that the throughput via HTTP is limited
-	lim := limiter.NewStaticLimiter(gopts.Limits)
-	rt = lim.Transport(rt)
+	lim, err := newLimiter(gopts, opts)
+	if err != nil {
+		return nil, err
+	}
 
 	factory := gopts.backends.Lookup(loc.Scheme)
 	if factory == nil {
-		return nil, errors.Fatalf("invalid backend: %q", loc.Scheme)
+		return nil, invalidArgumentsf("invalid backend: %q", loc.Scheme)
 	}
 
-	be, err = factory.Open(ctx, cfg, rt, lim)
+	be, err = factory.Open(ctx, cfg, rt)
 	if err != nil {
-		return nil, errors.Fatalf("unable to open repository at %v: %v", location.StripPassword(gopts.backends, s), err)
+		return nil, &backendAccessError{location: location.StripPassword(gopts.backends, s), err: err}
 	}
 
-	// wrap with debug logging and connection limiting
-	be = logger.New(sema.NewBackend(be))
+	traceBe, err := newTraceBackend(be, gopts)
+	if err != nil {
+		_ = be.Close()
+		return nil, err
+	}
+	be = traceBe
+
+	// wrap with request counting, bandwidth limiting, stall detection, debug
+	// logging and connection limiting
+	be = logger.New(sema.NewBackend(watchdog.New(limiter.LimitBackend(newStatsBackend(be, s, gopts), lim), watchdogCfg)))
+
+	be, err = wrapTrash(be, loc.Scheme, opts)
+	if err != nil {
+		return nil, err
+	}
 
 	// wrap backend if a test specified an inner hook
 	if gopts.backendInnerTestHook != nil {
@@ -612,10 +789,23 @@ func open(ctx context.Context, s string, gopts GlobalOptions, opts options.Optio
 		}
 	}
 
-	// check if config is there
+	if gopts.AppendOnly {
+		be = appendonly.New(be)
+	}
+	if gopts.ReadOnly {
+		be = readonly.New(be)
+	}
+
+	// check if config is there. The backend is probed first, the keys and the
+	// config are checked by openRepository, such that each failure results in a
+	// specific error: backendAccessError, noRepositoryError, NoKeyFoundError
+	// and invalidConfigError.
 	fi, err := be.Stat(ctx, restic.Handle{Type: restic.ConfigFile})
+	if err != nil && be.IsNotExist(err) {
+		return nil, &noRepositoryError{location: location.StripPassword(gopts.backends, s), err: err}
+	}
 	if err != nil {
-		return nil, errors.Fatalf("unable to open config file: %v\nIs there a repository at the following location?\n%v", err, location.StripPassword(gopts.backends, s))
+		return nil, &backendAccessError{location: location.StripPassword(gopts.backends, s), err: err}
 	}
 
 	if fi.Size == 0 {
@@ -625,6 +815,92 @@ func open(ctx context.Context, s string, gopts GlobalOptions, opts options.Optio
 	return be, nil
 }
 
+// minRepoIDPrefixLength is the minimum length of the prefix passed to
+// --expect-repo-id, shorter prefixes would match too many repositories.
+const minRepoIDPrefixLength = 8
+
+// checkRepoIDPrefix returns an error if prefix cannot be used to identify a
+// repository.
+func checkRepoIDPrefix(prefix string) error {
+	if len(prefix) < minRepoIDPrefixLength {
+		return errors.Fatalf("expected repository ID %q is too short, at least %d characters are required", prefix, minRepoIDPrefixLength)
+	}
+	if strings.Trim(strings.ToLower(prefix), "0123456789abcdef") != "" || len(prefix) > 2*len(restic.ID{}) {
+		return errors.Fatalf("expected repository ID %q is not a valid repository ID", prefix)
+	}
+	return nil
+}
+
+// checkRepoID returns an error if the ID of the repository at location does
+// not start with prefix.
+func checkRepoID(prefix, id, location string) error {
+	if !strings.HasPrefix(id, strings.ToLower(prefix)) {
+		return errors.Fatalf("repository at %v has ID %v, which does not match the expected repository ID %v\n"+
+			"check $RESTIC_REPOSITORY and --repo or update --expect-repo-id / $RESTIC_EXPECTED_REPO_ID",
+			location, id, prefix)
+	}
+	return nil
+}
+
+// noRepositoryError is returned if there is no repository at a location.
+type noRepositoryError struct {
+	location string
+	err      error
+}
+
+func (e *noRepositoryError) Error() string {
+	return fmt.Sprintf("unable to open config file: %v\nIs there a repository at the following location?\n%v\n"+
+		"if this is the intended location, use `restic init` to create a new repository there", e.err, e.location)
+}
+
+func (e *noRepositoryError) Unwrap() error {
+	return e.err
+}
+
+// isNoRepository returns true if err was caused by a missing repository.
+func isNoRepository(err error) bool {
+	var e *noRepositoryError
+	return errors.As(err, &e)
+}
+
+// backendAccessError is returned if the backend of a repository cannot be
+// accessed, for example because of network problems or missing permissions.
+type backendAccessError struct {
+	location string
+	err      error
+}
+
+func (e *backendAccessError) Error() string {
+	return fmt.Sprintf("unable to access the repository at %v: %v\n"+
+		"check the repository location, the network connection and the permissions", e.location, e.err)
+}
+
+func (e *backendAccessError) Unwrap() error {
+	return e.err
+}
+
+// invalidConfigError is returned if the password is correct, but the
+// repository config is damaged.
+type invalidConfigError struct {
+	err error
+}
+
+func (e *invalidConfigError) Error() string {
+	return fmt.Sprintf("%v\nthe config can be rewritten using `restic repair config`", e.err)
+}
+
+func (e *invalidConfigError) Unwrap() error {
+	return e.err
+}
+
+// isRepositoryOpenError returns true if err is one of the errors which
+// describe why a repository could not be opened.
+func isRepositoryOpenError(err error) bool {
+	var be *backendAccessError
+	var ce *invalidConfigError
+	return isNoRepository(err) || errors.As(err, &be) || errors.As(err, &ce) || errors.Is(err, repository.ErrNoKeyFound)
+}
+
 // Create the backend specified by URI.
 func create(ctx context.Context, s string, gopts GlobalOptions, opts options.Options) (restic.Backend, error) {
 	debug.Log("parsing location %v", location.StripPassword(gopts.backends, s))
@@ -633,25 +909,255 @@ func create(ctx context.Context, s string, gopts GlobalOptions, opts options.Opt
 		return nil, err
 	}
 
-	cfg, err := parseConfig(loc, opts)
+	cfg, err := parseConfig(loc, opts, gopts.Connections)
 	if err != nil {
 		return nil, err
 	}
 
-	rt, err := backend.Transport(globalOptions.TransportOptions)
+	_, watchdogCfg, _, err := backendOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	tropts := gopts.TransportOptions
+	tropts.ConnectTimeout = watchdogCfg.ConnectTimeout
+	rt, err := backend.Transport(tropts)
 	if err != nil {
 		return nil, errors.Fatal(err.Error())
 	}
 
+	lim, err := newLimiter(gopts, opts)
+	if err != nil {
+		return nil, err
+	}
+
 	factory := gopts.backends.Lookup(loc.Scheme)
 	if factory == nil {
-		return nil, errors.Fatalf("invalid backend: %q", loc.Scheme)
+		return nil, invalidArgumentsf("invalid backend: %q", loc.Scheme)
+	}
+
+	be, err := factory.Create(ctx, cfg, rt)
+	if err != nil {
+		return nil, err
+	}
+
+	traceBe, err := newTraceBackend(be, gopts)
+	if err != nil {
+		_ = be.Close()
+		return nil, err
+	}
+	be = traceBe
+
+	return logger.New(sema.NewBackend(watchdog.New(limiter.LimitBackend(newStatsBackend(be, s, gopts), lim), watchdogCfg))), nil
+}
+
+// checkAppendOnly returns an error if restic runs in append-only mode, the
+// description names the operation which is not allowed.
+func checkAppendOnly(gopts GlobalOptions, description string) error {
+	if gopts.AppendOnly {
+		return errors.Fatalf("%v is not allowed in append-only mode", description)
+	}
+	return nil
+}
+
+// checkReadOnly returns an error if restic runs in read-only mode, the
+// description names the operation which is not allowed.
+func checkReadOnly(gopts GlobalOptions, description string) error {
+	if gopts.ReadOnly {
+		return errors.Fatalf("%v is not allowed with --read-only", description)
+	}
+	return nil
+}
+
+// backendOptions returns the configuration of the trash, the watchdog and the
+// consistency checks set via the extended options in the "backend" namespace.
+func backendOptions(opts options.Options) (trash.Config, watchdog.Config, consistency.Config, error) {
+	var trashCfg trash.Config
+	watchdogCfg := watchdog.NewConfig()
+	var consistencyCfg consistency.Config
+	err := opts.Extract("backend").ApplyAll("backend", &trashCfg, &watchdogCfg, &consistencyCfg)
+	return trashCfg, watchdogCfg, consistencyCfg, err
+}
+
+// verifyBackend checks that changes of files immediately show up in the
+// backend and prints a warning for each detected anomaly.
+func verifyBackend(ctx context.Context, be restic.Backend, consistencyDelay time.Duration) error {
+	res, err := consistency.Probe(ctx, be, consistencyDelay)
+	if err != nil {
+		return errors.Fatalf("verifying backend failed: %v", err)
+	}
+
+	for _, anomaly := range res.Anomalies {
+		Warnf("Warning: backend is not consistent: %v\n", anomaly)
+	}
+	if res.ListDelay > consistencyDelay {
+		Warnf("Locks may be considered removed while their file is missing from listings, use -o backend.consistency-delay to wait for them\n")
+	}
+	return nil
+}
+
+// trashRetention returns the retention period set via the extended option
+// backend.trash. If the trash is disabled, enabled is false.
+func trashRetention(opts options.Options) (retention restic.Duration, enabled bool, err error) {
+	cfg, _, _, err := backendOptions(opts)
+	if err != nil {
+		return restic.Duration{}, false, err
+	}
+
+	if cfg.Trash == "" {
+		return restic.Duration{}, false, nil
+	}
+
+	retention, err = restic.ParseDuration(cfg.Trash)
+	if err != nil {
+		return restic.Duration{}, false, invalidArgumentsf("invalid duration %q for backend.trash: %v", cfg.Trash, err)
 	}
+	return retention, true, nil
+}
 
-	be, err := factory.Create(ctx, cfg, rt, nil)
+// wrapTrash wraps be with the trash if it is enabled via the extended option
+// backend.trash. The REST protocol, which is also used for rclone, only
+// supports the file types of the repository format, such that the trash is
+// rejected for these backends before any files are modified.
+func wrapTrash(be restic.Backend, scheme string, opts options.Options) (restic.Backend, error) {
+	_, enabled, err := trashRetention(opts)
+	if err != nil || !enabled {
+		return be, err
+	}
+	if scheme == "rest" || scheme == "rclone" {
+		return nil, invalidArgumentsf("the %v backend does not support -o backend.trash", scheme)
+	}
+	return trash.New(be), nil
+}
+
+// repositoryOptions returns the size limit of the repository set via
+// --repo-max-size or the extended option repository.max-size, and the index
+// flush threshold set via repository.index-flush-threshold. Zero means
+// unlimited for both.
+func repositoryOptions(gopts GlobalOptions) (maxSize, indexFlushThreshold uint64, err error) {
+	sizeCfg := repository.SizeLimitConfig{MaxSize: gopts.RepoMaxSize}
+	var indexCfg repository.IndexConfig
+	if err := gopts.extended.Extract("repository").ApplyAll("repository", &sizeCfg, &indexCfg); err != nil {
+		return 0, 0, err
+	}
+
+	maxSize, err = sizeCfg.ParseMaxSize()
+	if err != nil {
+		return 0, 0, invalidArguments(err)
+	}
+	indexFlushThreshold, err = indexCfg.ParseIndexFlushThreshold()
 	if err != nil {
+		return 0, 0, invalidArguments(err)
+	}
+	return maxSize, indexFlushThreshold, nil
+}
+
+// cacheConfig returns the configuration of the cache set via the extended
+// options in the "cache" namespace.
+func cacheConfig(opts options.Options) (cache.Config, error) {
+	var cfg cache.Config
+	err := opts.Extract("cache").Apply("cache", &cfg)
+	return cfg, err
+}
+
+// newLimiter returns a limiter for the bandwidth limits set via --limit-upload
+// and --limit-download and the extended options in the "limit" namespace.
+func newLimiter(gopts GlobalOptions, opts options.Options) (limiter.Limiter, error) {
+	limits := gopts.Limits
+	if err := opts.Extract("limit").Apply("limit", &limits); err != nil {
 		return nil, err
 	}
 
-	return logger.New(sema.NewBackend(be)), nil
+	return limiter.NewStaticLimiter(limits), nil
+}
+
+// openedBackends contains the request statistics of all backends opened
+// while running the current command.
+var openedBackends struct {
+	sync.Mutex
+	list []openedBackend
+}
+
+type openedBackend struct {
+	location string
+	be       *stats.Backend
+	trace    *trace.Backend
+}
+
+// newTraceBackend wraps be to trace all requests if --trace-backend is set.
+// Without a trace file, the requests are traced to the debug log if it is
+// enabled.
+func newTraceBackend(be restic.Backend, gopts GlobalOptions) (restic.Backend, error) {
+	if gopts.TraceBackend == "" {
+		if !debug.Enabled() {
+			return be, nil
+		}
+		return trace.New(be, nil), nil
+	}
+
+	f, err := fs.OpenFile(gopts.TraceBackend, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, errors.Fatalf("unable to open backend trace file: %v", err)
+	}
+	return trace.New(be, f), nil
+}
+
+// newStatsBackend wraps be to count the requests sent to the backend.
+func newStatsBackend(be restic.Backend, s string, gopts GlobalOptions) *stats.Backend {
+	statsBe := stats.New(be)
+
+	openedBackends.Lock()
+	defer openedBackends.Unlock()
+	openedBackends.list = append(openedBackends.list, openedBackend{
+		location: location.StripPassword(gopts.backends, s),
+		be:       statsBe,
+		trace:    restic.AsBackend[*trace.Backend](be),
+	})
+	return statsBe
+}
+
+// logBackendStats writes the request statistics of all opened backends to
+// the debug log and the log file at debug level.
+func logBackendStats() {
+	openedBackends.Lock()
+	defer openedBackends.Unlock()
+
+	for _, b := range openedBackends.list {
+		st := b.be.Stats()
+		debug.Log("backend requests for %v: %v", b.location, st)
+		ui.Log(ui.LogDebug, "backend requests for %v: %v", b.location, st)
+
+		if b.trace != nil {
+			latency := trace.FormatSummary(b.trace.Summary())
+			debug.Log("backend latency for %v: %v", b.location, latency)
+			ui.Log(ui.LogDebug, "backend latency for %v: %v", b.location, latency)
+		}
+	}
+}
+
+// transferStats returns the number of requests sent to the backend of repo
+// and the amount of data transferred. It returns false if no statistics are
+// available.
+func transferStats(repo restic.Repository) (ui.TransferStats, bool) {
+	be := restic.AsBackend[*stats.Backend](repo.Backend())
+	if be == nil {
+		return ui.TransferStats{}, false
+	}
+
+	st := be.Stats()
+	return ui.TransferStats{
+		Requests:        st.Requests(),
+		BytesUploaded:   st.BytesUploaded(),
+		BytesDownloaded: st.BytesDownloaded(),
+	}, true
+}
+
+// duplicateStats returns the number of blobs saved to repo which were
+// already contained in the repository.
+func duplicateStats(repo *repository.Repository) ui.DuplicateStats {
+	st := repo.DuplicateStats()
+	return ui.DuplicateStats{
+		Suppressed: st.Suppressed,
+		Stored:     st.Stored,
+	}
 }
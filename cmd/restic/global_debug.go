@@ -9,28 +9,17 @@ import (
 	_ "net/http/pprof"
 	"os"
 
-	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/repository"
-
-	"github.com/pkg/profile"
 )
 
 var (
-	listenProfile    string
-	memProfilePath   string
-	cpuProfilePath   string
-	traceProfilePath string
-	blockProfilePath string
-	insecure         bool
+	listenProfile string
+	insecure      bool
 )
 
 func init() {
 	f := cmdRoot.PersistentFlags()
 	f.StringVar(&listenProfile, "listen-profile", "", "listen on this `address:port` for memory profiling")
-	f.StringVar(&memProfilePath, "mem-profile", "", "write memory profile to `dir`")
-	f.StringVar(&cpuProfilePath, "cpu-profile", "", "write cpu profile to `dir`")
-	f.StringVar(&traceProfilePath, "trace-profile", "", "write trace to `dir`")
-	f.StringVar(&blockProfilePath, "block-profile", "", "write block profile to `dir`")
 	f.BoolVar(&insecure, "insecure-kdf", false, "use insecure KDF settings")
 }
 
@@ -51,45 +40,6 @@ func runDebug() error {
 		}()
 	}
 
-	profilesEnabled := 0
-	if memProfilePath != "" {
-		profilesEnabled++
-	}
-	if cpuProfilePath != "" {
-		profilesEnabled++
-	}
-	if traceProfilePath != "" {
-		profilesEnabled++
-	}
-	if blockProfilePath != "" {
-		profilesEnabled++
-	}
-
-	if profilesEnabled > 1 {
-		return errors.Fatal("only one profile (memory, CPU, trace, or block) may be activated at the same time")
-	}
-
-	var prof interface {
-		Stop()
-	}
-
-	if memProfilePath != "" {
-		prof = profile.Start(profile.Quiet, profile.NoShutdownHook, profile.MemProfile, profile.ProfilePath(memProfilePath))
-	} else if cpuProfilePath != "" {
-		prof = profile.Start(profile.Quiet, profile.NoShutdownHook, profile.CPUProfile, profile.ProfilePath(cpuProfilePath))
-	} else if traceProfilePath != "" {
-		prof = profile.Start(profile.Quiet, profile.NoShutdownHook, profile.TraceProfile, profile.ProfilePath(traceProfilePath))
-	} else if blockProfilePath != "" {
-		prof = profile.Start(profile.Quiet, profile.NoShutdownHook, profile.BlockProfile, profile.ProfilePath(blockProfilePath))
-	}
-
-	if prof != nil {
-		AddCleanupHandler(func(code int) (int, error) {
-			prof.Stop()
-			return code, nil
-		})
-	}
-
 	if insecure {
 		repository.TestUseLowSecurityKDFParameters(fakeTestingTB{})
 	}
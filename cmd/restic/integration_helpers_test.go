@@ -204,6 +204,9 @@ func withTestEnvironment(t testing.TB) (env *testEnvironment, cleanup func()) {
 		stderr:   os.Stderr,
 		extended: make(options.Options),
 
+		// use the default number of retries
+		RetryCount: 10,
+
 		// replace this hook with "nil" if listing a filetype more than once is necessary
 		backendTestHook: func(r restic.Backend) (restic.Backend, error) { return newOrderedListOnceBackend(r), nil },
 		// start with default set of backends
@@ -365,7 +368,7 @@ func withTermStatus(gopts GlobalOptions, callback func(ctx context.Context, term
 	ctx, cancel := context.WithCancel(context.TODO())
 	var wg sync.WaitGroup
 
-	term := termstatus.New(gopts.stdout, gopts.stderr, gopts.Quiet)
+	term := termstatus.New(gopts.stdout, gopts.stderr, gopts.Quiet || gopts.NoProgress)
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -1,16 +1,23 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
 
+	"github.com/restic/restic/internal/backend/readonly"
 	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
+	"github.com/restic/restic/internal/ui/termstatus"
 )
 
 func TestCheckRestoreNoLock(t *testing.T) {
@@ -63,7 +70,9 @@ func newOrderedListOnceBackend(be restic.Backend) *listOnceBackend {
 }
 
 func (be *listOnceBackend) List(ctx context.Context, t restic.FileType, fn func(restic.FileInfo) error) error {
-	if t != restic.LockFile && be.listedFileType[t] {
+	// prune lists the snapshots again before deleting data
+	recheck := t == restic.SnapshotFile && !be.strictOrder && be.listedFileType[restic.IndexFile]
+	if t != restic.LockFile && be.listedFileType[t] && !recheck {
 		return errors.Errorf("tried listing type %v the second time", t)
 	}
 	if be.strictOrder && t == restic.SnapshotFile && be.listedFileType[restic.IndexFile] {
@@ -73,6 +82,10 @@ func (be *listOnceBackend) List(ctx context.Context, t restic.FileType, fn func(
 	return be.Backend.List(ctx, t, fn)
 }
 
+func (be *listOnceBackend) Unwrap() restic.Backend {
+	return be.Backend
+}
+
 func TestListOnce(t *testing.T) {
 	env, cleanup := withTestEnvironment(t)
 	defer cleanup()
@@ -91,6 +104,37 @@ func TestListOnce(t *testing.T) {
 	rtest.OK(t, runRebuildIndex(context.TODO(), RepairIndexOptions{ReadAllPacks: true}, env.gopts))
 }
 
+// statCountBackend counts the number of calls to Stat
+type statCountBackend struct {
+	restic.Backend
+	stats int32
+}
+
+func (be *statCountBackend) Stat(ctx context.Context, h restic.Handle) (restic.FileInfo, error) {
+	atomic.AddInt32(&be.stats, 1)
+	return be.Backend.Stat(ctx, h)
+}
+
+func TestNoStatCalls(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	createPrunableRepo(t, env)
+
+	// the file sizes returned by List must be sufficient for all of these commands
+	be := &statCountBackend{}
+	env.gopts.backendTestHook = func(r restic.Backend) (restic.Backend, error) {
+		be.Backend = r
+		return be, nil
+	}
+
+	rtest.OK(t, runPrune(context.TODO(), PruneOptions{MaxUnused: "0"}, env.gopts))
+	rtest.OK(t, runRebuildIndex(context.TODO(), RepairIndexOptions{}, env.gopts))
+	rtest.OK(t, runCheck(context.TODO(), CheckOptions{CheckUnused: true}, env.gopts, nil))
+
+	rtest.Equals(t, int32(0), atomic.LoadInt32(&be.stats))
+}
+
 type writeToOnly struct {
 	rd io.Reader
 }
@@ -169,3 +213,279 @@ func TestFindListOnce(t *testing.T) {
 	// the snapshots can only be listed once, if both lists match then the there has been only a single List() call
 	rtest.Equals(t, thirdSnapshot, snapshotIDs)
 }
+
+func TestExpectRepoID(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	// key list must list keys more than once
+	env.gopts.backendTestHook = nil
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	buf, err := withCaptureStdout(func() error {
+		gopts := env.gopts
+		gopts.JSON = true
+		return runCat(context.TODO(), CatOptions{}, gopts, []string{"config"})
+	})
+	rtest.OK(t, err)
+	var cfg restic.Config
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &cfg))
+	rtest.Equals(t, 64, len(cfg.ID))
+
+	// the ID is also printed by key list
+	buf, err = withCaptureStdout(func() error {
+		return runKey(context.TODO(), env.gopts, []string{"list"})
+	})
+	rtest.OK(t, err)
+	rtest.Assert(t, strings.Contains(buf.String(), cfg.ID), "repository ID missing in key list output %q", buf.String())
+
+	for _, prefix := range []string{cfg.ID[:8], strings.ToUpper(cfg.ID[:12]), cfg.ID} {
+		gopts := env.gopts
+		gopts.ExpectRepoID = prefix
+		testRunCheck(t, gopts)
+	}
+
+	// flip the last character of the prefix
+	mismatch := []byte(cfg.ID[:8])
+	if mismatch[7] == '0' {
+		mismatch[7] = '1'
+	} else {
+		mismatch[7] = '0'
+	}
+
+	for _, prefix := range []string{string(mismatch), cfg.ID[:7], "xyz12345", cfg.ID + "0"} {
+		gopts := env.gopts
+		gopts.ExpectRepoID = prefix
+		err := runCheck(context.TODO(), CheckOptions{}, gopts, nil)
+		rtest.Assert(t, err != nil, "expected error for prefix %q", prefix)
+
+		// no lock must be created in a repository with an unexpected ID
+		locks, err := os.ReadDir(filepath.Join(env.repo, "locks"))
+		rtest.OK(t, err)
+		rtest.Equals(t, 0, len(locks))
+	}
+}
+
+// unreachableBackend fails all Stat calls with a network error.
+type unreachableBackend struct {
+	restic.Backend
+}
+
+func (be *unreachableBackend) Stat(_ context.Context, _ restic.Handle) (restic.FileInfo, error) {
+	return restic.FileInfo{}, errors.New("dial tcp: connection refused")
+}
+
+func (be *unreachableBackend) IsNotExist(_ error) bool {
+	return false
+}
+
+func TestOpenRepositoryErrors(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	// the backend cannot be reached
+	gopts := env.gopts
+	gopts.backendInnerTestHook = func(r restic.Backend) (restic.Backend, error) {
+		return &unreachableBackend{r}, nil
+	}
+	_, err := OpenRepository(context.TODO(), gopts)
+	var accessErr *backendAccessError
+	rtest.Assert(t, errors.As(err, &accessErr), "expected backendAccessError, got %v", err)
+	rtest.Assert(t, strings.Contains(err.Error(), "connection refused"), "error is missing the cause: %v", err)
+	rtest.Equals(t, exitCodeFatal, exitCode(err))
+
+	// there is no repository at the location
+	gopts = env.gopts
+	gopts.Repo = filepath.Join(env.base, "missing")
+	_, err = OpenRepository(context.TODO(), gopts)
+	rtest.Assert(t, isNoRepository(err), "expected noRepositoryError, got %v", err)
+	rtest.Assert(t, strings.Contains(err.Error(), "restic init"), "error is missing the init hint: %v", err)
+	rtest.Equals(t, exitCodeRepositoryNotFound, exitCode(err))
+
+	// no key matches the password
+	gopts = env.gopts
+	gopts.password = "wrong"
+	_, err = OpenRepository(context.TODO(), gopts)
+	var keyErr *repository.NoKeyFoundError
+	rtest.Assert(t, errors.As(err, &keyErr), "expected NoKeyFoundError, got %v", err)
+	rtest.Equals(t, 1, keyErr.Tried)
+	rtest.Assert(t, strings.Contains(err.Error(), "tried 1 key"), "error is missing the number of keys: %v", err)
+	rtest.Equals(t, exitCodeWrongPassword, exitCode(err))
+
+	// the config is damaged
+	configFile := filepath.Join(env.repo, "config")
+	rtest.OK(t, os.Chmod(configFile, 0600))
+	rtest.OK(t, os.WriteFile(configFile, rtest.Random(23, 100), 0600))
+	_, err = OpenRepository(context.TODO(), env.gopts)
+	var configErr *invalidConfigError
+	rtest.Assert(t, errors.As(err, &configErr), "expected invalidConfigError, got %v", err)
+	rtest.Assert(t, errors.Is(err, restic.ErrInvalidConfig), "expected ErrInvalidConfig, got %v", err)
+	rtest.Assert(t, strings.Contains(err.Error(), "restic repair config"), "error is missing the repair hint: %v", err)
+	rtest.Equals(t, exitCodeFatal, exitCode(err))
+
+	for _, err := range []error{accessErr, keyErr, configErr, &noRepositoryError{}} {
+		rtest.Assert(t, isRepositoryOpenError(err), "%T is not a repository open error", err)
+	}
+}
+
+func TestDamagedSnapshotFile(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	// snapshots are listed several times
+	env.gopts.backendTestHook = nil
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	snapshotID := testListSnapshots(t, env.gopts, 1)[0]
+
+	// plant a truncated snapshot file, as left behind by an interrupted upload
+	buf, err := os.ReadFile(filepath.Join(env.repo, "snapshots", snapshotID.String()))
+	rtest.OK(t, err)
+	rtest.OK(t, os.WriteFile(filepath.Join(env.repo, "snapshots", restic.NewRandomID().String()), buf[:len(buf)/2], 0600))
+
+	_, snapmap := testRunSnapshots(t, env.gopts)
+	rtest.Equals(t, 1, len(snapmap))
+	_, ok := snapmap[snapshotID]
+	rtest.Assert(t, ok, "snapshot %v missing", snapshotID)
+
+	lines := testRunLs(t, env.gopts, "latest")
+	rtest.Assert(t, len(lines) > 1, "ls latest returned no files")
+}
+
+// makeReadOnly removes the write permission for all directories below dir and
+// returns a function which restores it. If the directories are still writable
+// afterwards, which is the case when running as root, writing is prevented by
+// replacing the subdirectories for cached files with regular files.
+func makeReadOnly(t testing.TB, dir string) func() {
+	chmodDirs := func(mode os.FileMode) {
+		rtest.OK(t, filepath.Walk(dir, func(name string, fi os.FileInfo, err error) error {
+			if err != nil || !fi.IsDir() {
+				return err
+			}
+			return os.Chmod(name, mode)
+		}))
+	}
+
+	chmodDirs(0500)
+	f, err := os.CreateTemp(dir, "test-")
+	if err != nil {
+		return func() { chmodDirs(0700) }
+	}
+	rtest.OK(t, f.Close())
+	rtest.OK(t, os.Remove(f.Name()))
+	chmodDirs(0700)
+
+	t.Logf("unable to make %v read-only, replacing the cache directories instead", dir)
+	for _, subdir := range []string{"data", "index", "snapshots"} {
+		dirs, err := filepath.Glob(filepath.Join(dir, "*", subdir))
+		rtest.OK(t, err)
+		for _, d := range dirs {
+			rtest.OK(t, os.RemoveAll(d))
+			rtest.OK(t, os.Mkdir(d, 0700))
+			for i := 0; i < 256; i++ {
+				rtest.OK(t, os.WriteFile(filepath.Join(d, fmt.Sprintf("%02x", i)), nil, 0600))
+			}
+		}
+	}
+	return func() {}
+}
+
+func TestReadOnlyCache(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	opts := BackupOptions{}
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, opts, env.gopts)
+
+	defer makeReadOnly(t, env.cache)()
+
+	var stderr bytes.Buffer
+	globalOptions.stderr = &stderr
+	env.gopts.stderr = &stderr
+	defer func() {
+		globalOptions.stderr = os.Stderr
+	}()
+
+	// all commands must work without writing to the cache
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "2")}, opts, env.gopts)
+	testListSnapshots(t, env.gopts, 2)
+	testRunRestoreLatest(t, env.gopts, filepath.Join(env.base, "restore"), nil, nil)
+	testRunCheck(t, env.gopts)
+
+	rtest.Assert(t, strings.Contains(stderr.String(), "unable to write to the cache"),
+		"missing warning in output %q", stderr.String())
+}
+
+// writeCountingBackend counts all operations which modify the repository.
+type writeCountingBackend struct {
+	restic.Backend
+	writes int32
+}
+
+func (be *writeCountingBackend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	atomic.AddInt32(&be.writes, 1)
+	return be.Backend.Save(ctx, h, rd)
+}
+
+func (be *writeCountingBackend) Remove(ctx context.Context, h restic.Handle) error {
+	atomic.AddInt32(&be.writes, 1)
+	return be.Backend.Remove(ctx, h)
+}
+
+func TestReadOnly(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+	rtest.OK(t, os.WriteFile(filepath.Join(env.testdata, "file"), []byte("content"), 0600))
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+
+	be := &writeCountingBackend{}
+	gopts := env.gopts
+	gopts.ReadOnly = true
+	gopts.NoLock = true
+	gopts.backendTestHook = func(r restic.Backend) (restic.Backend, error) {
+		be.Backend = r
+		return be, nil
+	}
+
+	// commands which only read from the repository work
+	snapshotIDs := testListSnapshots(t, gopts, 1)
+	testRunSnapshots(t, gopts)
+	rtest.Assert(t, len(testRunLs(t, gopts, snapshotIDs[0].String())) > 0, "ls returned no files")
+	// dump writes directly to stdout
+	dumpFile := filepath.Join(env.base, "dump")
+	f, err := os.Create(dumpFile)
+	rtest.OK(t, err)
+	oldStdout := os.Stdout
+	os.Stdout = f
+	err = runDump(context.TODO(), DumpOptions{Archive: "tar"}, gopts, []string{"latest", filepath.Join(env.testdata, "file")})
+	os.Stdout = oldStdout
+	rtest.OK(t, err)
+	rtest.OK(t, f.Close())
+	data, err := os.ReadFile(dumpFile)
+	rtest.OK(t, err)
+	rtest.Equals(t, "content", string(data))
+	testRunCheck(t, gopts)
+
+	// commands which modify the repository refuse to start
+	err = withTermStatus(gopts, func(ctx context.Context, term *termstatus.Terminal) error {
+		return runBackup(ctx, BackupOptions{}, gopts, term, []string{env.testdata})
+	})
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "--read-only"), "unexpected error for backup: %v", err)
+	err = runForget(context.TODO(), ForgetOptions{Last: 1}, gopts, nil)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "--read-only"), "unexpected error for forget: %v", err)
+	err = runTag(context.TODO(), TagOptions{AddTags: restic.TagLists{{"foo"}}}, gopts, nil)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "--read-only"), "unexpected error for tag: %v", err)
+	rtest.Equals(t, int32(0), atomic.LoadInt32(&be.writes))
+
+	// the backend rejects all writes
+	repo, err := OpenRepository(context.TODO(), gopts)
+	rtest.OK(t, err)
+	_, err = restic.SaveJSONUnpacked(context.TODO(), repo, restic.SnapshotFile, restic.Snapshot{})
+	rtest.Assert(t, errors.Is(err, readonly.ErrReadOnly), "unexpected error for saving a snapshot: %v", err)
+	testListSnapshots(t, env.gopts, 1)
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/options"
 	"github.com/restic/restic/internal/restic"
 )
 
@@ -127,6 +128,38 @@ var refreshInterval = 5 * time.Minute
 // the difference allows to compensate for a small time drift between clients.
 var refreshabilityTimeout = restic.StaleLockTimeout - refreshInterval*3/2
 
+// maxRefreshInterval is the longest refresh interval which still leaves time
+// to retry a failed refresh before the lock is considered stale.
+var maxRefreshInterval = restic.StaleLockTimeout * 2 / 5
+
+// LockConfig contains the extended options for locking the repository.
+type LockConfig struct {
+	RefreshInterval time.Duration `option:"refresh-interval" help:"refresh the lock of the repository after this duration, at most 12m (default: 5m)"`
+}
+
+// NewLockConfig returns a new LockConfig with the default values filled in.
+func NewLockConfig() LockConfig {
+	return LockConfig{
+		RefreshInterval: refreshInterval,
+	}
+}
+
+// setLockRefreshInterval configures the lock refresh using the extended
+// options in the "lock" namespace.
+func setLockRefreshInterval(opts options.Options) error {
+	cfg := NewLockConfig()
+	if err := opts.Extract("lock").Apply("lock", &cfg); err != nil {
+		return invalidArguments(err)
+	}
+	if cfg.RefreshInterval <= 0 || cfg.RefreshInterval > maxRefreshInterval {
+		return invalidArgumentsf("lock.refresh-interval must be positive and at most %v, got %v", maxRefreshInterval, cfg.RefreshInterval)
+	}
+
+	refreshInterval = cfg.RefreshInterval
+	refreshabilityTimeout = restic.StaleLockTimeout - refreshInterval*3/2
+	return nil
+}
+
 type refreshLockRequest struct {
 	result chan bool
 }
@@ -178,6 +211,12 @@ func refreshLocks(ctx context.Context, backend restic.Backend, lockInfo *lockCon
 				// the lock is too old, wait until the expiry monitor cancels the context
 				continue
 			}
+			if time.Since(lastRefresh) < refreshInterval/2 {
+				// the lock was just created or refreshed, writing it again
+				// would only cause pointless requests
+				debug.Log("lock is still fresh, skipping refresh")
+				continue
+			}
 
 			debug.Log("refreshing locks")
 			err := lock.Refresh(context.TODO())
@@ -313,4 +352,6 @@ func unlockAll(code int) (int, error) {
 
 func init() {
 	globalLocks.locks = make(map[*restic.Lock]*lockContext)
+
+	options.Register("lock", NewLockConfig())
 }
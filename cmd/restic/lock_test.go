@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"runtime"
@@ -9,9 +10,11 @@ import (
 	"testing"
 	"time"
 
+	"github.com/restic/restic/internal/backend/consistency"
 	"github.com/restic/restic/internal/backend/location"
 	"github.com/restic/restic/internal/backend/mem"
 	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/options"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/test"
@@ -255,6 +258,116 @@ func TestLockSuccessfulStaleRefresh(t *testing.T) {
 	unlockRepo(lock)
 }
 
+type lockSaveCountingBackend struct {
+	restic.Backend
+	m     sync.Mutex
+	saves int
+}
+
+func (b *lockSaveCountingBackend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	if h.Type == restic.LockFile {
+		b.m.Lock()
+		b.saves++
+		b.m.Unlock()
+	}
+	return b.Backend.Save(ctx, h, rd)
+}
+
+func (b *lockSaveCountingBackend) lockSaves() int {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.saves
+}
+
+func TestLockSkipFreshRefresh(t *testing.T) {
+	var cb *lockSaveCountingBackend
+	repo, cleanup, _ := openLockTestRepo(t, func(r restic.Backend) (restic.Backend, error) {
+		cb = &lockSaveCountingBackend{Backend: r}
+		return cb, nil
+	})
+	defer cleanup()
+
+	// reduce locking intervals to be suitable for testing
+	ri, rt := refreshInterval, refreshabilityTimeout
+	refreshInterval = 200 * time.Millisecond
+	refreshabilityTimeout = 2 * time.Second
+	defer func() {
+		refreshInterval, refreshabilityTimeout = ri, rt
+	}()
+
+	lock, err := restic.NewLock(context.TODO(), repo)
+	test.OK(t, err)
+	// pretend that the lock was refreshed shortly before the first tick
+	lock.Time = time.Now().Add(refreshInterval * 3 / 4)
+	saves := cb.lockSaves()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	lockInfo := &lockContext{lock: lock, cancel: cancel}
+	lockInfo.refreshWG.Add(1)
+	refreshed := make(chan struct{}, 1)
+	go refreshLocks(ctx, repo.Backend(), lockInfo, refreshed, nil)
+
+	// the first tick must not refresh the still fresh lock
+	time.Sleep(refreshInterval * 3 / 2)
+	test.Equals(t, saves, cb.lockSaves())
+
+	// the lock is refreshed once it has become old enough
+	select {
+	case <-refreshed:
+	case <-time.After(2 * refreshInterval):
+		t.Error("lock was not refreshed")
+	}
+	test.Equals(t, saves+1, cb.lockSaves())
+
+	cancel()
+	lockInfo.refreshWG.Wait()
+}
+
+func TestLockRefreshIntervalOption(t *testing.T) {
+	ri, rt := refreshInterval, refreshabilityTimeout
+	defer func() {
+		refreshInterval, refreshabilityTimeout = ri, rt
+	}()
+
+	for _, test := range []struct {
+		value    string
+		interval time.Duration
+		timeout  time.Duration
+	}{
+		{"", 5 * time.Minute, 22*time.Minute + 30*time.Second},
+		{"2m", 2 * time.Minute, 27 * time.Minute},
+		{"12m", 12 * time.Minute, 12 * time.Minute},
+		{"30s", 30 * time.Second, 29*time.Minute + 15*time.Second},
+	} {
+		t.Run(test.value, func(t *testing.T) {
+			refreshInterval, refreshabilityTimeout = ri, rt
+			opts := options.Options{}
+			if test.value != "" {
+				opts["lock.refresh-interval"] = test.value
+			}
+			err := setLockRefreshInterval(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if refreshInterval != test.interval || refreshabilityTimeout != test.timeout {
+				t.Fatalf("wrong intervals, want %v/%v, got %v/%v",
+					test.interval, test.timeout, refreshInterval, refreshabilityTimeout)
+			}
+		})
+	}
+
+	for _, value := range []string{"0s", "-1m", "13m", "1h", "foo"} {
+		refreshInterval, refreshabilityTimeout = ri, rt
+		err := setLockRefreshInterval(options.Options{"lock.refresh-interval": value})
+		if err == nil {
+			t.Errorf("invalid interval %q was accepted", value)
+		}
+		if refreshInterval != ri || refreshabilityTimeout != rt {
+			t.Errorf("invalid interval %q changed the refresh interval", value)
+		}
+	}
+}
+
 func TestLockWaitTimeout(t *testing.T) {
 	repo, cleanup, env := openLockTestRepo(t, nil)
 	defer cleanup()
@@ -326,3 +439,46 @@ func TestLockWaitSuccess(t *testing.T) {
 
 	test.OK(t, lock.Unlock())
 }
+
+func TestVerifyBackend(t *testing.T) {
+	_, cleanup, env := openLockTestRepo(t, func(r restic.Backend) (restic.Backend, error) {
+		return consistency.TestLaggingBackend(r, 300*time.Millisecond, 0), nil
+	})
+	defer cleanup()
+
+	oldStderr := globalOptions.stderr
+	defer func() {
+		globalOptions.stderr = oldStderr
+	}()
+
+	for _, tc := range []struct {
+		extended []string
+		hint     bool
+	}{
+		{nil, true},
+		{[]string{"backend.consistency-delay=5s"}, false},
+	} {
+		var err error
+		env.gopts.extended, err = options.Parse(tc.extended)
+		test.OK(t, err)
+		buf := bytes.NewBuffer(nil)
+		globalOptions.stderr = buf
+
+		gopts := env.gopts
+		gopts.VerifyBackend = true
+		_, err = OpenRepository(context.TODO(), gopts)
+		test.OK(t, err)
+
+		output := buf.String()
+		test.Assert(t, strings.Contains(output, "Warning: backend is not consistent: a new file showed up in listings only after"),
+			"missing warning in output %q", output)
+		test.Equals(t, tc.hint, strings.Contains(output, "-o backend.consistency-delay"))
+	}
+	restic.SetLockConsistencyDelay(0)
+
+	gopts := env.gopts
+	gopts.VerifyBackend = true
+	gopts.ReadOnly = true
+	_, err := OpenRepository(context.TODO(), gopts)
+	test.Assert(t, err != nil && strings.Contains(err.Error(), "--verify-backend is not allowed with --read-only"), "unexpected error %v", err)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/ui"
+)
+
+// openLogFile opens the log file configured in gopts and installs a logger
+// which writes to it. The returned function removes the logger and closes
+// the file. If no log file is configured, only the log level is validated.
+func openLogFile(gopts GlobalOptions) (func() error, error) {
+	level, err := ui.ParseLogLevel(gopts.LogLevel)
+	if err != nil {
+		return nil, invalidArguments(errors.Fatal(err.Error()))
+	}
+
+	if gopts.LogFile == "" {
+		return func() error { return nil }, nil
+	}
+
+	f, err := fs.OpenFile(gopts.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, errors.Fatalf("unable to open log file: %v", err)
+	}
+
+	ui.SetLogger(ui.NewLogger(f, level, gopts.LogJSON))
+	return func() error {
+		ui.SetLogger(nil)
+		return f.Close()
+	}, nil
+}
@@ -3,15 +3,22 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"runtime"
 	godebug "runtime/debug"
+	"strings"
 
+	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/options"
+	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/signals"
 
 	"github.com/spf13/cobra"
 
@@ -33,13 +40,17 @@ The full documentation can be found at https://restic.readthedocs.io/ .
 	DisableAutoGenTag: true,
 
 	PersistentPreRunE: func(c *cobra.Command, args []string) error {
+		recordCommandStart(strings.TrimPrefix(c.CommandPath(), c.Root().Name()+" "))
+
 		// set verbosity, default is one
 		globalOptions.verbosity = 1
 		if globalOptions.Quiet && globalOptions.Verbose > 0 {
-			return errors.Fatal("--quiet and --verbose cannot be specified at the same time")
+			return invalidArguments(errors.Fatal("--quiet and --verbose cannot be specified at the same time"))
 		}
 
 		switch {
+		case globalOptions.Verbose >= 3:
+			globalOptions.verbosity = 4
 		case globalOptions.Verbose >= 2:
 			globalOptions.verbosity = 3
 		case globalOptions.Verbose > 0:
@@ -53,10 +64,64 @@ The full documentation can be found at https://restic.readthedocs.io/ .
 		if err != nil {
 			return err
 		}
+		err = opts.Check()
+		if err != nil {
+			return invalidArguments(err)
+		}
 		globalOptions.extended = opts
+		if err := setLockRefreshInterval(opts); err != nil {
+			return err
+		}
+
+		if globalOptions.ReadOnly {
+			// creating a lock would modify the repository
+			globalOptions.NoLock = true
+		}
+
+		closeLog, err := openLogFile(globalOptions)
+		if err != nil {
+			return err
+		}
+		AddCleanupHandler(func(code int) (int, error) {
+			return code, closeLog()
+		})
+		ui.Log(ui.LogInfo, "%v %v started", c.CommandPath(), version)
+
+		stopProfiling, err := startProfiling(globalOptions.ProfileOptions, c.Name())
+		if err != nil {
+			return err
+		}
+		AddCleanupHandler(func(code int) (int, error) {
+			return code, stopProfiling()
+		})
+
+		statusSrv, err := startStatusServer(globalOptions.StatusListen)
+		if err != nil {
+			return err
+		}
+		if statusSrv != nil {
+			// the port may have been chosen by the system, tell the user which one
+			fmt.Fprintf(globalOptions.stderr, "serving status on http://%v/status\n", statusSrv.Addr())
+			ui.Log(ui.LogInfo, "serving status on http://%v/status", statusSrv.Addr())
+			AddCleanupHandler(func(code int) (int, error) {
+				return code, statusSrv.Stop()
+			})
+		}
+
 		if !needsPassword(c.Name()) {
 			return nil
 		}
+
+		if err := applyRepositoryName(&globalOptions, "RESTIC_PASSWORD"); err != nil {
+			return err
+		}
+
+		// load the TLS certificates now so that unusable files are reported
+		// before asking for the password or connecting to the repository
+		if _, err := backend.Transport(globalOptions.TransportOptions); err != nil {
+			return errors.Fatal(err.Error())
+		}
+
 		pwd, err := resolvePassword(globalOptions, "RESTIC_PASSWORD")
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Resolving password failed: %v\n", err)
@@ -70,6 +135,13 @@ The full documentation can be found at https://restic.readthedocs.io/ .
 	},
 }
 
+func init() {
+	// report errors while parsing flags as invalid arguments for all commands
+	cmdRoot.SetFlagErrorFunc(func(_ *cobra.Command, err error) error {
+		return invalidArguments(err)
+	})
+}
+
 // Distinguish commands that need the password from those that work without,
 // so we don't run $RESTIC_PASSWORD_COMMAND for no reason (it might prompt the
 // user for authentication).
@@ -92,6 +164,31 @@ func tweakGoGC() {
 	}
 }
 
+// reportStatusOnSignal prints a status line for the currently running
+// operation to w whenever SIGUSR1 (or SIGINFO on BSD) is received, until ctx
+// is cancelled. SIGINFO also toggles whether the transfer rate is shown.
+func reportStatusOnSignal(ctx context.Context, w io.Writer) {
+	ch := signals.GetProgressChannel()
+	showRate := false
+	for {
+		select {
+		case sig := <-ch:
+			debug.Log("signal %v received, reporting status", sig)
+			if signals.TogglesRate(sig) {
+				showRate = !showRate
+			}
+
+			status := "no progress information available"
+			if s, ok := ui.CurrentStatus(); ok {
+				status = s.Format(showRate)
+			}
+			_, _ = fmt.Fprintf(w, "status: %s\n", status)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
 func main() {
 	tweakGoGC()
 	// install custom global logger into a buffer, if an error occurs
@@ -101,14 +198,20 @@ func main() {
 	debug.Log("main %#v", os.Args)
 	debug.Log("restic %s compiled with %v on %v/%v",
 		version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	go reportStatusOnSignal(internalGlobalCtx, os.Stderr)
+
 	err := cmdRoot.ExecuteContext(internalGlobalCtx)
+	if err != nil && strings.HasPrefix(err.Error(), "unknown command ") {
+		// cobra does not use a distinct error type for unknown commands
+		err = invalidArguments(err)
+	}
 
 	switch {
 	case restic.IsAlreadyLocked(err):
 		fmt.Fprintf(os.Stderr, "%v\nthe `unlock` command can be used to remove stale locks\n", err)
 	case err == ErrInvalidSourceData:
 		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
-	case errors.IsFatal(err):
+	case errors.IsFatal(err), isInvalidArguments(err), isRepositoryOpenError(err):
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 	case err != nil:
 		fmt.Fprintf(os.Stderr, "%+v\n", err)
@@ -122,14 +225,87 @@ func main() {
 		}
 	}
 
-	var exitCode int
-	switch err {
-	case nil:
-		exitCode = 0
-	case ErrInvalidSourceData:
-		exitCode = 3
+	logBackendStats()
+
+	code := exitCode(err)
+	if code != exitCodeSuccess && wasInterrupted() {
+		code = exitCodeInterrupted
+	}
+	switch {
+	case err == nil:
+		ui.Log(ui.LogInfo, "finished successfully")
+	case code == exitCodeInvalidSourceData:
+		ui.Log(ui.LogWarn, "%v", err)
 	default:
-		exitCode = 1
+		ui.Log(ui.LogError, "%v", err)
 	}
-	Exit(exitCode)
+	// failed notifications and metrics do not change the exit code
+	writeMetrics(globalOptions, code)
+	notify(globalOptions, code, err)
+	Exit(code)
+}
+
+// Exit codes of restic. They are documented in doc/075_scripting.rst and
+// must not be changed.
+const (
+	exitCodeSuccess            = 0
+	exitCodeFatal              = 1
+	exitCodeInvalidArguments   = 2
+	exitCodeInvalidSourceData  = 3
+	exitCodeRepositoryNotFound = 10
+	exitCodeLocked             = 11
+	exitCodeWrongPassword      = 12
+	exitCodeInterrupted        = 130
+)
+
+// exitCode returns the exit code for the error returned by a command.
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return exitCodeSuccess
+	case err == ErrInvalidSourceData:
+		return exitCodeInvalidSourceData
+	case isInvalidArguments(err):
+		return exitCodeInvalidArguments
+	case isNoRepository(err):
+		return exitCodeRepositoryNotFound
+	case restic.IsAlreadyLocked(err):
+		return exitCodeLocked
+	case errors.Is(err, repository.ErrNoKeyFound):
+		return exitCodeWrongPassword
+	default:
+		return exitCodeFatal
+	}
+}
+
+// invalidArgumentsError is returned if a command is called with invalid
+// arguments or options.
+type invalidArgumentsError struct {
+	err error
+}
+
+func (e *invalidArgumentsError) Error() string {
+	return e.err.Error()
+}
+
+func (e *invalidArgumentsError) Unwrap() error {
+	return e.err
+}
+
+// invalidArguments marks err as caused by invalid arguments or options.
+func invalidArguments(err error) error {
+	return &invalidArgumentsError{err: err}
+}
+
+// invalidArgumentsf returns a fatal error with the given message which is
+// caused by invalid arguments or options.
+func invalidArgumentsf(format string, args ...interface{}) error {
+	return invalidArguments(errors.Fatalf(format, args...))
+}
+
+// isInvalidArguments returns true if err was caused by invalid arguments or
+// options.
+func isInvalidArguments(err error) bool {
+	var e *invalidArgumentsError
+	return errors.As(err, &e)
 }
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestExitCode(t *testing.T) {
+	for _, test := range []struct {
+		err  error
+		code int
+	}{
+		{nil, exitCodeSuccess},
+		{errors.New("foo"), exitCodeFatal},
+		{errors.Fatal("foo"), exitCodeFatal},
+		{ErrInvalidSourceData, exitCodeInvalidSourceData},
+		{invalidArguments(errors.Fatal("foo")), exitCodeInvalidArguments},
+		{invalidArgumentsf("foo %v", 1), exitCodeInvalidArguments},
+		{errors.Wrap(invalidArgumentsf("foo"), "bar"), exitCodeInvalidArguments},
+	} {
+		rtest.Equals(t, test.code, exitCode(test.err))
+	}
+}
+
+func TestExitCodeCommands(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	// repository does not exist
+	gopts := env.gopts
+	gopts.Repo = filepath.Join(env.base, "missing")
+	err := runSnapshots(context.TODO(), SnapshotOptions{}, gopts, nil)
+	rtest.Assert(t, err != nil, "expected error for missing repository")
+	rtest.Equals(t, exitCodeRepositoryNotFound, exitCode(err))
+
+	testRunInit(t, env.gopts)
+
+	// invalid arguments
+	err = runRestore(context.TODO(), RestoreOptions{}, env.gopts, nil, nil)
+	rtest.Assert(t, err != nil, "expected error for missing snapshot ID")
+	rtest.Equals(t, exitCodeInvalidArguments, exitCode(err))
+
+	// wrong password
+	gopts = env.gopts
+	gopts.password = "wrong"
+	err = runSnapshots(context.TODO(), SnapshotOptions{}, gopts, nil)
+	rtest.Assert(t, err != nil, "expected error for wrong password")
+	rtest.Equals(t, exitCodeWrongPassword, exitCode(err))
+
+	// repository is locked exclusively
+	repo, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+	lock, err := restic.NewExclusiveLock(context.TODO(), repo)
+	rtest.OK(t, err)
+	defer func() {
+		rtest.OK(t, lock.Unlock())
+	}()
+
+	err = runSnapshots(context.TODO(), SnapshotOptions{}, env.gopts, nil)
+	rtest.Assert(t, err != nil, "expected error for locked repository")
+	rtest.Equals(t, exitCodeLocked, exitCode(err))
+}
@@ -0,0 +1,152 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+	"github.com/restic/restic/internal/ui/signals"
+)
+
+type syncBuffer struct {
+	m   sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.buf.String()
+}
+
+// signalBackend sends SIGUSR1 to the process when the first pack file is
+// saved and waits until the status was reported.
+type signalBackend struct {
+	restic.Backend
+	once     sync.Once
+	reported func() bool
+}
+
+func (be *signalBackend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	if h.Type == restic.PackFile {
+		be.once.Do(func() {
+			_ = syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+			for start := time.Now(); time.Since(start) < 10*time.Second && !be.reported(); {
+				time.Sleep(10 * time.Millisecond)
+			}
+		})
+	}
+	return be.Backend.Save(ctx, h, rd)
+}
+
+func TestBackupStatusOnSignal(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+
+	var output syncBuffer
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// make sure the signal handler is installed before the signal is sent
+	signals.GetProgressChannel()
+	go reportStatusOnSignal(ctx, &output)
+
+	reported := func() bool {
+		return strings.Contains(output.String(), "\n")
+	}
+	env.gopts.backendTestHook = func(r restic.Backend) (restic.Backend, error) {
+		return &signalBackend{Backend: r, reported: reported}, nil
+	}
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+
+	line := output.String()
+	rtest.Assert(t, strings.HasPrefix(line, "status: backup, "), "unexpected status %q", line)
+	rtest.Assert(t, strings.Contains(line, " files, ") && strings.Contains(line, "elapsed "),
+		"status %q misses files or elapsed time", line)
+}
+
+// interruptBackend sends SIGINT to the process when the first pack file is
+// saved and waits until the graceful shutdown was started.
+type interruptBackend struct {
+	restic.Backend
+	once sync.Once
+}
+
+func (be *interruptBackend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	if h.Type == restic.PackFile {
+		be.once.Do(func() {
+			_ = syscall.Kill(os.Getpid(), syscall.SIGINT)
+			for start := time.Now(); time.Since(start) < 10*time.Second && !wasInterrupted(); {
+				time.Sleep(10 * time.Millisecond)
+			}
+		})
+	}
+	return be.Backend.Save(ctx, h, rd)
+}
+
+func TestBackupInterrupt(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	// create enough data for several pack files
+	rtest.OK(t, os.MkdirAll(env.testdata, 0700))
+	for i := 0; i < 16; i++ {
+		rtest.OK(t, os.WriteFile(filepath.Join(env.testdata, fmt.Sprintf("file%d", i)), rtest.Random(i, 1<<20), 0600))
+	}
+
+	var stderr syncBuffer
+	oldStderr := globalOptions.stderr
+	globalOptions.stderr = &stderr
+	defer func() {
+		globalOptions.stderr = oldStderr
+	}()
+
+	gopts := env.gopts
+	gopts.PackSize = 4
+	gopts.backendTestHook = func(r restic.Backend) (restic.Backend, error) {
+		return &interruptBackend{Backend: r}, nil
+	}
+	err := testRunBackupAssumeFailure(t, "", []string{env.testdata}, BackupOptions{}, gopts)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "backup interrupted"), "unexpected error %v", err)
+	rtest.Assert(t, wasInterrupted(), "graceful shutdown was not started")
+	rtest.Assert(t, strings.Contains(stderr.String(), "press Ctrl-C again to abort immediately"),
+		"missing message about the graceful shutdown in %q", stderr.String())
+
+	// no snapshot was created, but the repository is consistent and the data
+	// saved so far is contained in the index
+	testListSnapshots(t, env.gopts, 0)
+	output, err := testRunCheckOutput(env.gopts, false)
+	rtest.Assert(t, err == nil, "check failed: %v\n%v", err, output)
+	packs := listPacks(env.gopts, t)
+	rtest.Assert(t, len(packs) > 0, "no pack was saved")
+
+	r, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+	rtest.OK(t, r.LoadIndex(context.TODO()))
+	indexed := restic.NewIDSet()
+	r.Index().Each(context.TODO(), func(pb restic.PackedBlob) {
+		indexed.Insert(pb.PackID)
+	})
+	rtest.Equals(t, packs, indexed)
+}
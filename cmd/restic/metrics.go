@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/ui"
+)
+
+// newMetrics returns the metrics for the command which finished with exit
+// status code. The values are taken from the recorded command outcome.
+func newMetrics(code int) *ui.Metrics {
+	commandOutcome.Lock()
+	defer commandOutcome.Unlock()
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		debug.Log("unable to determine hostname: %v", err)
+	}
+	m := ui.NewMetrics(map[string]string{
+		"command":  commandOutcome.command,
+		"repo_id":  commandOutcome.repositoryID,
+		"hostname": hostname,
+	})
+
+	success := 0.0
+	if code == exitCodeSuccess {
+		success = 1
+	}
+	m.Set("restic_command_success", "Whether the command finished successfully.", success)
+	m.Set("restic_command_exit_status", "Exit status of the command.", float64(code))
+	var duration time.Duration
+	if !commandOutcome.start.IsZero() {
+		duration = time.Since(commandOutcome.start)
+	}
+	m.Set("restic_command_duration_seconds", "Runtime of the command in seconds.", duration.Seconds())
+
+	if s := commandOutcome.summary; s != nil {
+		m.Set("restic_backup_files_new", "Number of new files in the snapshot.", float64(s.FilesNew))
+		m.Set("restic_backup_files_changed", "Number of changed files in the snapshot.", float64(s.FilesChanged))
+		m.Set("restic_backup_files_unmodified", "Number of unmodified files in the snapshot.", float64(s.FilesUnmodified))
+		m.Set("restic_backup_dirs_new", "Number of new directories in the snapshot.", float64(s.DirsNew))
+		m.Set("restic_backup_dirs_changed", "Number of changed directories in the snapshot.", float64(s.DirsChanged))
+		m.Set("restic_backup_dirs_unmodified", "Number of unmodified directories in the snapshot.", float64(s.DirsUnmodified))
+		m.Set("restic_backup_files_processed", "Number of files processed by the backup.", float64(s.TotalFilesProcessed))
+		m.Set("restic_backup_bytes_processed", "Size of the files processed by the backup in bytes.", float64(s.TotalBytesProcessed))
+		m.Set("restic_backup_bytes_added", "Amount of data added to the repository in bytes, before compression.", float64(s.DataAdded))
+		m.Set("restic_backup_bytes_added_packed", "Amount of data added to the repository in bytes, after compression.", float64(s.DataAddedPacked))
+	}
+	if commandOutcome.snapshotsKnown {
+		m.Set("restic_repo_snapshots_total", "Number of snapshots in the repository.", float64(commandOutcome.snapshots))
+	}
+	return m
+}
+
+// writeMetrics writes the metrics of the finished command to the
+// --metrics-file. Errors are printed, but otherwise ignored.
+func writeMetrics(opts GlobalOptions, code int) {
+	if opts.MetricsFile == "" {
+		return
+	}
+
+	if err := newMetrics(code).WriteFile(opts.MetricsFile); err != nil {
+		Warnf("Warning: writing metrics file failed: %v\n", err)
+	}
+}
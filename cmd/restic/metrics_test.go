@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// parseMetricsFile returns the values and labels of the metrics in filename.
+// All metrics must have the same labels.
+func parseMetricsFile(t testing.TB, filename string) (values map[string]float64, labels string) {
+	t.Helper()
+	f, err := os.Open(filename)
+	rtest.OK(t, err)
+	defer func() {
+		rtest.OK(t, f.Close())
+	}()
+
+	values = make(map[string]float64)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		sample, value, ok := strings.Cut(line, " ")
+		rtest.Assert(t, ok, "invalid line %q", line)
+		name, l, ok := strings.Cut(sample, "{")
+		rtest.Assert(t, ok, "labels missing in line %q", line)
+		if labels == "" {
+			labels = "{" + l
+		}
+		rtest.Equals(t, labels, "{"+l)
+		v, err := strconv.ParseFloat(value, 64)
+		rtest.OK(t, err)
+		values[name] = v
+	}
+	rtest.OK(t, sc.Err())
+	return values, labels
+}
+
+func TestMetricsFile(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	hostname, err := os.Hostname()
+	rtest.OK(t, err)
+	metricsFile := filepath.Join(env.base, "restic.prom")
+
+	testSetupBackupData(t, env)
+	defer resetCommandOutcome(t, "backup")()
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	writeMetrics(GlobalOptions{MetricsFile: metricsFile}, exitCodeSuccess)
+
+	summary := commandOutcome.summary
+	rtest.Assert(t, summary != nil, "backup summary was not recorded")
+	values, labels := parseMetricsFile(t, metricsFile)
+	rtest.Equals(t, `{command="backup",hostname="`+hostname+`",repo_id="`+commandOutcome.repositoryID+`"}`, labels)
+	rtest.Assert(t, commandOutcome.repositoryID != "", "repository ID was not recorded")
+	rtest.Equals(t, 1.0, values["restic_command_success"])
+	rtest.Equals(t, 0.0, values["restic_command_exit_status"])
+	rtest.Assert(t, values["restic_command_duration_seconds"] > 0, "invalid duration %v", values["restic_command_duration_seconds"])
+	rtest.Equals(t, float64(summary.FilesNew), values["restic_backup_files_new"])
+	rtest.Equals(t, float64(summary.DataAdded), values["restic_backup_bytes_added"])
+	rtest.Assert(t, values["restic_backup_files_new"] > 0, "no new files reported")
+	_, ok := values["restic_repo_snapshots_total"]
+	rtest.Assert(t, !ok, "backup must not report the number of snapshots")
+
+	// listing all snapshots reports their number
+	recordCommandStart("snapshots")
+	testRunSnapshots(t, env.gopts)
+	writeMetrics(GlobalOptions{MetricsFile: metricsFile}, exitCodeSuccess)
+	values, _ = parseMetricsFile(t, metricsFile)
+	rtest.Equals(t, 1.0, values["restic_repo_snapshots_total"])
+	_, ok = values["restic_backup_files_new"]
+	rtest.Assert(t, !ok, "snapshots must not report backup metrics")
+
+	// a failing command replaces the previous file
+	recordCommandStart("restore")
+	err = testRunRestoreAssumeFailure(restic.NewRandomID().String(), RestoreOptions{Target: env.base}, env.gopts)
+	rtest.Assert(t, err != nil, "restore of missing snapshot succeeded")
+	writeMetrics(GlobalOptions{MetricsFile: metricsFile}, exitCode(err))
+	values, labels = parseMetricsFile(t, metricsFile)
+	rtest.Assert(t, strings.HasPrefix(labels, `{command="restore",`), "unexpected labels %v", labels)
+	rtest.Equals(t, 0.0, values["restic_command_success"])
+	rtest.Equals(t, float64(exitCode(err)), values["restic_command_exit_status"])
+	_, ok = values["restic_backup_bytes_added"]
+	rtest.Assert(t, !ok, "failed restore must not report backup metrics")
+}
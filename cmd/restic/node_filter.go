@@ -0,0 +1,120 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/spf13/pflag"
+)
+
+// nodeFilterOptions collects the options to filter nodes by owner and
+// permissions. A node matches if it matches all specified kinds of filters.
+// For each kind, it must match one of the specified values.
+type nodeFilterOptions struct {
+	UIDs   []uint
+	GIDs   []uint
+	Users  []string
+	Groups []string
+	Perm   string
+
+	perm      uint32
+	permExact bool
+}
+
+func initNodeFilterOptions(f *pflag.FlagSet, opts *nodeFilterOptions) {
+	f.UintSliceVar(&opts.UIDs, "uid", nil, "only include nodes owned by `uid` (can be specified multiple times)")
+	f.UintSliceVar(&opts.GIDs, "gid", nil, "only include nodes owned by group `gid` (can be specified multiple times)")
+	f.StringArrayVar(&opts.Users, "user", nil, "only include nodes owned by `user` (can be specified multiple times)")
+	f.StringArrayVar(&opts.Groups, "group", nil, "only include nodes owned by `group` (can be specified multiple times)")
+	f.StringVar(&opts.Perm, "perm", "", "only include nodes with any of the bits of the octal `mask` set, or with exactly this mode when suffixed with /exact")
+}
+
+// Parse checks the options, it must be called before Match.
+func (opts *nodeFilterOptions) Parse() error {
+	if opts.Perm == "" {
+		return nil
+	}
+
+	mask := opts.Perm
+	if strings.HasSuffix(mask, "/exact") {
+		mask = strings.TrimSuffix(mask, "/exact")
+		opts.permExact = true
+	}
+
+	perm, err := strconv.ParseUint(mask, 8, 32)
+	if err != nil || perm > 07777 {
+		return errors.Fatalf("invalid permission mask %q", opts.Perm)
+	}
+	opts.perm = uint32(perm)
+	return nil
+}
+
+// Empty returns true if no filter is set.
+func (opts *nodeFilterOptions) Empty() bool {
+	return len(opts.UIDs) == 0 && len(opts.GIDs) == 0 && len(opts.Users) == 0 &&
+		len(opts.Groups) == 0 && opts.Perm == ""
+}
+
+// Match returns true if node matches the filters. Symlinks are matched by
+// their own metadata and not by the metadata of their target.
+func (opts *nodeFilterOptions) Match(node *restic.Node) bool {
+	if len(opts.UIDs) > 0 && !matchID(opts.UIDs, node.UID) {
+		return false
+	}
+	if len(opts.GIDs) > 0 && !matchID(opts.GIDs, node.GID) {
+		return false
+	}
+	if len(opts.Users) > 0 && !matchName(opts.Users, node.User) {
+		return false
+	}
+	if len(opts.Groups) > 0 && !matchName(opts.Groups, node.Group) {
+		return false
+	}
+
+	if opts.Perm != "" {
+		mode := unixPermissions(node.Mode)
+		if opts.permExact {
+			return mode == opts.perm
+		}
+		return mode&opts.perm != 0
+	}
+
+	return true
+}
+
+func matchID(ids []uint, id uint32) bool {
+	for _, want := range ids {
+		if uint32(want) == id {
+			return true
+		}
+	}
+	return false
+}
+
+func matchName(names []string, name string) bool {
+	for _, want := range names {
+		if want == name {
+			return true
+		}
+	}
+	return false
+}
+
+// unixPermissions returns the permission bits of mode including the setuid,
+// setgid and sticky bits, as used by chmod.
+func unixPermissions(mode os.FileMode) uint32 {
+	perm := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		perm |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		perm |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		perm |= 01000
+	}
+	return perm
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestNodeFilter(t *testing.T) {
+	nodes := map[string]*restic.Node{
+		"root-setuid": {Type: "file", Mode: 0755 | os.ModeSetuid, UID: 0, GID: 0, User: "root", Group: "root"},
+		"user-file":   {Type: "file", Mode: 0644, UID: 1000, GID: 100, User: "user", Group: "users"},
+		"world-write": {Type: "file", Mode: 0666, UID: 1000, GID: 100, User: "user", Group: "users"},
+		"sticky-tmp":  {Type: "dir", Mode: os.ModeDir | 0777 | os.ModeSticky, UID: 0, GID: 0, User: "root", Group: "root"},
+		"setgid-dir":  {Type: "dir", Mode: os.ModeDir | 0750 | os.ModeSetgid, UID: 1000, GID: 100, User: "user", Group: "users"},
+		// symlinks are matched by their own mode and owner
+		"symlink": {Type: "symlink", Mode: os.ModeSymlink | 0777, UID: 1000, GID: 100, User: "user", Group: "users"},
+	}
+
+	for _, test := range []struct {
+		opts nodeFilterOptions
+		want []string
+	}{
+		{
+			opts: nodeFilterOptions{},
+			want: []string{"root-setuid", "setgid-dir", "sticky-tmp", "symlink", "user-file", "world-write"},
+		},
+		{
+			opts: nodeFilterOptions{UIDs: []uint{0}},
+			want: []string{"root-setuid", "sticky-tmp"},
+		},
+		{
+			opts: nodeFilterOptions{GIDs: []uint{0, 100}},
+			want: []string{"root-setuid", "setgid-dir", "sticky-tmp", "symlink", "user-file", "world-write"},
+		},
+		{
+			opts: nodeFilterOptions{Users: []string{"user"}, Groups: []string{"root"}},
+			want: nil,
+		},
+		{
+			opts: nodeFilterOptions{Groups: []string{"users"}, Perm: "0002"},
+			want: []string{"symlink", "world-write"},
+		},
+		{
+			opts: nodeFilterOptions{Perm: "4000"},
+			want: []string{"root-setuid"},
+		},
+		{
+			opts: nodeFilterOptions{Perm: "6000"},
+			want: []string{"root-setuid", "setgid-dir"},
+		},
+		{
+			opts: nodeFilterOptions{Perm: "1000"},
+			want: []string{"sticky-tmp"},
+		},
+		{
+			opts: nodeFilterOptions{Perm: "1777/exact"},
+			want: []string{"sticky-tmp"},
+		},
+		{
+			opts: nodeFilterOptions{Perm: "777/exact"},
+			want: []string{"symlink"},
+		},
+		{
+			opts: nodeFilterOptions{Perm: "4755/exact", UIDs: []uint{0}},
+			want: []string{"root-setuid"},
+		},
+	} {
+		t.Run("", func(t *testing.T) {
+			opts := test.opts
+			rtest.OK(t, opts.Parse())
+
+			var got []string
+			for _, name := range []string{"root-setuid", "setgid-dir", "sticky-tmp", "symlink", "user-file", "world-write"} {
+				if opts.Match(nodes[name]) {
+					got = append(got, name)
+				}
+			}
+			rtest.Equals(t, test.want, got)
+		})
+	}
+}
+
+func TestNodeFilterParse(t *testing.T) {
+	for _, perm := range []string{"abc", "0999", "17777", "0644/foo", "/exact"} {
+		opts := nodeFilterOptions{Perm: perm}
+		rtest.Assert(t, opts.Parse() != nil, "expected error for mask %q", perm)
+	}
+
+	opts := nodeFilterOptions{}
+	rtest.Assert(t, opts.Empty(), "expected empty filter")
+	opts = nodeFilterOptions{Perm: "0"}
+	rtest.Assert(t, !opts.Empty(), "expected non-empty filter")
+}
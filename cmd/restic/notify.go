@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
+)
+
+// notifyTimeout is the maximum duration the notification command or request
+// may take.
+const notifyTimeout = 30 * time.Second
+
+// notification describes the outcome of a command. It is sent to the
+// --notify-url as JSON and passed to the --notify-command via environment
+// variables.
+type notification struct {
+	Command      string  `json:"command"`
+	RepositoryID string  `json:"repository_id,omitempty"`
+	SnapshotID   string  `json:"snapshot_id,omitempty"`
+	ExitStatus   int     `json:"exit_status"`
+	Error        string  `json:"error,omitempty"`
+	BytesAdded   uint64  `json:"bytes_added"`
+	Duration     float64 `json:"duration"`
+}
+
+// env returns the environment variables describing the notification.
+func (n notification) env() []string {
+	return []string{
+		"RESTIC_EVENT_COMMAND=" + n.Command,
+		"RESTIC_EVENT_REPOSITORY_ID=" + n.RepositoryID,
+		"RESTIC_EVENT_SNAPSHOT_ID=" + n.SnapshotID,
+		"RESTIC_EVENT_EXIT_STATUS=" + strconv.Itoa(n.ExitStatus),
+		"RESTIC_EVENT_ERROR=" + n.Error,
+		"RESTIC_EVENT_BYTES_ADDED=" + strconv.FormatUint(n.BytesAdded, 10),
+		"RESTIC_EVENT_DURATION=" + strconv.FormatFloat(n.Duration, 'f', 3, 64),
+	}
+}
+
+// commandOutcome collects the information about the running command which is
+// included in the notification and the metrics file.
+var commandOutcome struct {
+	sync.Mutex
+	command      string
+	start        time.Time
+	repositoryID string
+	snapshotID   string
+	summary      *restic.SnapshotSummary
+	// snapshots is the number of snapshots in the repository, it is only
+	// valid if snapshotsKnown is set
+	snapshots      int
+	snapshotsKnown bool
+}
+
+// recordCommandStart records the name of the command which is run and clears
+// the outcome of previous commands.
+func recordCommandStart(command string) {
+	commandOutcome.Lock()
+	defer commandOutcome.Unlock()
+	commandOutcome.command = command
+	commandOutcome.start = time.Now()
+	commandOutcome.repositoryID = ""
+	commandOutcome.snapshotID = ""
+	commandOutcome.summary = nil
+	commandOutcome.snapshots = 0
+	commandOutcome.snapshotsKnown = false
+}
+
+// recordRepository records the ID of the repository the command operates on.
+// Only the first repository opened by a command is recorded.
+func recordRepository(id string) {
+	commandOutcome.Lock()
+	defer commandOutcome.Unlock()
+	if commandOutcome.repositoryID == "" {
+		commandOutcome.repositoryID = id
+	}
+}
+
+// recordSnapshot records the snapshot created by the command and the summary
+// of the backup.
+func recordSnapshot(id restic.ID, summary *restic.SnapshotSummary) {
+	commandOutcome.Lock()
+	defer commandOutcome.Unlock()
+	commandOutcome.snapshotID = id.String()
+	commandOutcome.summary = summary
+}
+
+// recordSnapshotCount records the number of snapshots in the repository. It is
+// only called by commands which know it without additional requests.
+func recordSnapshotCount(n int) {
+	commandOutcome.Lock()
+	defer commandOutcome.Unlock()
+	commandOutcome.snapshots = n
+	commandOutcome.snapshotsKnown = true
+}
+
+// newNotification returns the notification for the command which finished
+// with exit status code and error err.
+func newNotification(code int, err error) notification {
+	commandOutcome.Lock()
+	defer commandOutcome.Unlock()
+
+	n := notification{
+		Command:      commandOutcome.command,
+		RepositoryID: commandOutcome.repositoryID,
+		SnapshotID:   commandOutcome.snapshotID,
+		ExitStatus:   code,
+	}
+	if commandOutcome.summary != nil {
+		n.BytesAdded = commandOutcome.summary.DataAdded
+	}
+	if err != nil {
+		n.Error = err.Error()
+	}
+	if !commandOutcome.start.IsZero() {
+		n.Duration = time.Since(commandOutcome.start).Seconds()
+	}
+	return n
+}
+
+// notify runs the notification command and sends the notification to the URL
+// configured in opts. Errors are printed and logged, but otherwise ignored.
+func notify(opts GlobalOptions, code int, err error) {
+	if opts.NotifyCommand == "" && opts.NotifyURL == "" {
+		return
+	}
+
+	n := newNotification(code, err)
+	debug.Log("notification %+v", n)
+
+	// the command may have been interrupted, thus do not use the global context
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+
+	if opts.NotifyCommand != "" {
+		if err := runNotifyCommand(ctx, opts, n); err != nil {
+			Warnf("Warning: notification command failed: %v\n", err)
+		}
+	}
+	if opts.NotifyURL != "" {
+		if err := sendNotification(ctx, opts, n); err != nil {
+			Warnf("Warning: sending notification failed: %v\n", err)
+		}
+	}
+}
+
+// runNotifyCommand runs the --notify-command with the notification passed
+// via environment variables.
+func runNotifyCommand(ctx context.Context, opts GlobalOptions, n notification) error {
+	args, err := backend.SplitShellStrings(opts.NotifyCommand)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return errors.New("empty command")
+	}
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(os.Environ(), n.env()...)
+	cmd.Stdout = opts.stderr
+	cmd.Stderr = opts.stderr
+	return cmd.Run()
+}
+
+// sendNotification posts the notification as JSON to the --notify-url. The
+// request is not retried.
+func sendNotification(ctx context.Context, opts GlobalOptions, n notification) error {
+	buf, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	tr, err := backend.Transport(opts.TransportOptions)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, opts.NotifyURL, bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := (&http.Client{Transport: tr}).Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("unexpected response: %v", resp.Status)
+	}
+
+	ui.Log(ui.LogDebug, "notification sent to %v", opts.NotifyURL)
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// resetCommandOutcome records a new command and returns a function which
+// clears the outcome again.
+func resetCommandOutcome(t testing.TB, command string) func() {
+	t.Helper()
+	recordCommandStart(command)
+	return func() {
+		recordCommandStart("")
+	}
+}
+
+func TestNotifyURL(t *testing.T) {
+	defer resetCommandOutcome(t, "backup")()
+	snID := restic.NewRandomID()
+	recordRepository("repo-id")
+	recordRepository("other-repo-id")
+	recordSnapshot(snID, &restic.SnapshotSummary{DataAdded: 1234})
+
+	var received []notification
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rtest.Equals(t, http.MethodPost, r.Method)
+		rtest.Equals(t, "application/json", r.Header.Get("Content-Type"))
+		var n notification
+		rtest.OK(t, json.NewDecoder(r.Body).Decode(&n))
+		received = append(received, n)
+	}))
+	defer srv.Close()
+
+	notify(GlobalOptions{NotifyURL: srv.URL}, exitCodeInvalidSourceData, ErrInvalidSourceData)
+
+	rtest.Equals(t, 1, len(received))
+	n := received[0]
+	rtest.Equals(t, "backup", n.Command)
+	rtest.Equals(t, "repo-id", n.RepositoryID)
+	rtest.Equals(t, snID.String(), n.SnapshotID)
+	rtest.Equals(t, exitCodeInvalidSourceData, n.ExitStatus)
+	rtest.Equals(t, ErrInvalidSourceData.Error(), n.Error)
+	rtest.Equals(t, uint64(1234), n.BytesAdded)
+	rtest.Assert(t, n.Duration >= 0, "invalid duration %v", n.Duration)
+}
+
+func TestNotifyCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test requires a posix shell")
+	}
+	defer resetCommandOutcome(t, "forget")()
+	recordRepository("repo-id")
+
+	out := filepath.Join(rtest.TempDir(t), "env")
+	stderr := &bytes.Buffer{}
+	notify(GlobalOptions{
+		NotifyCommand: `sh -c 'env > "` + out + `"'`,
+		stderr:        stderr,
+	}, exitCodeLocked, nil)
+	rtest.Equals(t, "", stderr.String())
+
+	buf, err := os.ReadFile(out)
+	rtest.OK(t, err)
+	env := strings.Split(string(buf), "\n")
+	for _, v := range []string{
+		"RESTIC_EVENT_COMMAND=forget",
+		"RESTIC_EVENT_REPOSITORY_ID=repo-id",
+		"RESTIC_EVENT_SNAPSHOT_ID=",
+		"RESTIC_EVENT_EXIT_STATUS=11",
+		"RESTIC_EVENT_ERROR=",
+		"RESTIC_EVENT_BYTES_ADDED=0",
+	} {
+		found := false
+		for _, line := range env {
+			found = found || line == v
+		}
+		rtest.Assert(t, found, "variable %q missing in environment:\n%s", v, buf)
+	}
+}
+
+func TestNotifyFailure(t *testing.T) {
+	defer resetCommandOutcome(t, "backup")()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	stderr := &bytes.Buffer{}
+	rtest.OK(t, withRestoreGlobalOptions(func() error {
+		globalOptions.stderr = stderr
+		notify(GlobalOptions{
+			NotifyCommand: filepath.Join(rtest.TempDir(t), "missing-command"),
+			NotifyURL:     srv.URL,
+			stderr:        stderr,
+		}, exitCodeSuccess, nil)
+		return nil
+	}))
+
+	rtest.Assert(t, strings.Contains(stderr.String(), "Warning: notification command failed"),
+		"missing warning for command, stderr:\n%v", stderr)
+	rtest.Assert(t, strings.Contains(stderr.String(), "Warning: sending notification failed: unexpected response: 500"),
+		"missing warning for URL, stderr:\n%v", stderr)
+}
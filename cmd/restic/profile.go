@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// ProfileOptions collects the directories profiles are written to.
+type ProfileOptions struct {
+	CPUProfile   string
+	MemProfile   string
+	TraceProfile string
+	BlockProfile string
+	Profile      string
+}
+
+func init() {
+	f := cmdRoot.PersistentFlags()
+	f.StringVar(&globalOptions.CPUProfile, "cpu-profile", "", "write cpu profile to `dir`")
+	f.StringVar(&globalOptions.MemProfile, "mem-profile", "", "write memory profile to `dir`")
+	f.StringVar(&globalOptions.TraceProfile, "trace-profile", "", "write trace to `dir`")
+	f.StringVar(&globalOptions.BlockProfile, "block-profile", "", "write block profile to `dir`")
+	f.StringVar(&globalOptions.Profile, "profile", "", "write cpu, memory, trace and block profiles to `dir`")
+	for _, name := range []string{"cpu-profile", "mem-profile", "trace-profile", "block-profile", "profile"} {
+		_ = f.MarkHidden(name)
+	}
+}
+
+// profileFilename returns the name of the file for a profile of kind for the
+// command cmd.
+func profileFilename(dir, cmd, kind string, now time.Time) string {
+	return filepath.Join(dir, fmt.Sprintf("restic-%s-%s-%s", cmd, now.Format("20060102-150405"), kind))
+}
+
+// startProfiling starts collecting the profiles selected in opts for the
+// command cmd. The returned function stops collecting and writes the
+// profiles, it must be called exactly once.
+func startProfiling(opts ProfileOptions, cmd string) (stop func() error, err error) {
+	dir := func(d string) string {
+		if d == "" {
+			return opts.Profile
+		}
+		return d
+	}
+
+	now := time.Now()
+	var stops []func() error
+	stop = func() error {
+		var firstErr error
+		for _, f := range stops {
+			if err := f(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		stops = nil
+		return firstErr
+	}
+
+	create := func(dir, kind string) (*os.File, error) {
+		f, err := os.Create(profileFilename(dir, cmd, kind, now))
+		if err != nil {
+			return nil, errors.Fatalf("unable to create profile: %v", err)
+		}
+		return f, nil
+	}
+
+	if d := dir(opts.CPUProfile); d != "" {
+		f, err := create(d, "cpu.pprof")
+		if err != nil {
+			return nil, err
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			_ = f.Close()
+			return nil, errors.Fatalf("unable to start cpu profile: %v", err)
+		}
+		stops = append(stops, func() error {
+			pprof.StopCPUProfile()
+			return f.Close()
+		})
+	}
+
+	if d := dir(opts.TraceProfile); d != "" {
+		f, err := create(d, "trace.out")
+		if err != nil {
+			_ = stop()
+			return nil, err
+		}
+		if err := trace.Start(f); err != nil {
+			_ = f.Close()
+			_ = stop()
+			return nil, errors.Fatalf("unable to start trace: %v", err)
+		}
+		stops = append(stops, func() error {
+			trace.Stop()
+			return f.Close()
+		})
+	}
+
+	if d := dir(opts.BlockProfile); d != "" {
+		f, err := create(d, "block.pprof")
+		if err != nil {
+			_ = stop()
+			return nil, err
+		}
+		runtime.SetBlockProfileRate(1)
+		stops = append(stops, func() error {
+			err := pprof.Lookup("block").WriteTo(f, 0)
+			runtime.SetBlockProfileRate(0)
+			if err != nil {
+				_ = f.Close()
+				return err
+			}
+			return f.Close()
+		})
+	}
+
+	if d := dir(opts.MemProfile); d != "" {
+		f, err := create(d, "mem.pprof")
+		if err != nil {
+			_ = stop()
+			return nil, err
+		}
+		stops = append(stops, func() error {
+			// update the statistics with all allocations up to now
+			runtime.GC()
+			err := pprof.WriteHeapProfile(f)
+			if err != nil {
+				_ = f.Close()
+				return err
+			}
+			return f.Close()
+		})
+	}
+
+	return stop, nil
+}
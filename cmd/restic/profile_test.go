@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/errors"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// checkProtobuf verifies that buf is a well-formed protocol buffer message
+// which contains field 1, the sample types of a pprof profile.
+func checkProtobuf(buf []byte) error {
+	var sampleType bool
+	for len(buf) > 0 {
+		key, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return errors.New("invalid field key")
+		}
+		buf = buf[n:]
+
+		var size uint64
+		switch key & 7 {
+		case 0:
+			_, n = binary.Uvarint(buf)
+			if n <= 0 {
+				return errors.New("invalid varint")
+			}
+			size = uint64(n)
+		case 1:
+			size = 8
+		case 2:
+			l, n := binary.Uvarint(buf)
+			if n <= 0 {
+				return errors.New("invalid length")
+			}
+			buf = buf[n:]
+			size = l
+		case 5:
+			size = 4
+		default:
+			return errors.Errorf("invalid wire type %d", key&7)
+		}
+
+		if uint64(len(buf)) < size {
+			return errors.New("truncated field")
+		}
+		buf = buf[size:]
+
+		if key>>3 == 1 {
+			sampleType = true
+		}
+	}
+
+	if !sampleType {
+		return errors.New("sample type is missing")
+	}
+	return nil
+}
+
+func TestProfile(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	dir := filepath.Join(env.base, "profile")
+	rtest.OK(t, os.Mkdir(dir, 0700))
+
+	stop, err := startProfiling(ProfileOptions{Profile: dir}, "init")
+	rtest.OK(t, err)
+	testRunInit(t, env.gopts)
+	rtest.OK(t, stop())
+
+	entries, err := os.ReadDir(dir)
+	rtest.OK(t, err)
+	rtest.Equals(t, 4, len(entries))
+
+	for _, entry := range entries {
+		name := entry.Name()
+		rtest.Assert(t, strings.HasPrefix(name, "restic-init-"), "unexpected file name %v", name)
+
+		buf, err := os.ReadFile(filepath.Join(dir, name))
+		rtest.OK(t, err)
+		rtest.Assert(t, len(buf) > 0, "profile %v is empty", name)
+
+		if strings.HasSuffix(name, "-trace.out") {
+			rtest.Assert(t, bytes.HasPrefix(buf, []byte("go 1.")), "trace %v has an invalid header", name)
+			continue
+		}
+
+		rtest.Assert(t, strings.HasSuffix(name, ".pprof"), "unexpected file name %v", name)
+		rd, err := gzip.NewReader(bytes.NewReader(buf))
+		rtest.OK(t, err)
+		data, err := io.ReadAll(rd)
+		rtest.OK(t, err)
+		rtest.OK(t, checkProtobuf(data))
+	}
+}
+
+func TestProfileInvalidDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "missing")
+	_, err := startProfiling(ProfileOptions{CPUProfile: dir}, "init")
+	rtest.Assert(t, err != nil, "missing error for invalid profile directory")
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"strconv"
@@ -12,32 +13,53 @@ import (
 	"github.com/restic/restic/internal/ui/termstatus"
 )
 
-// calculateProgressInterval returns the interval configured via RESTIC_PROGRESS_FPS
-// or if unset returns an interval for 60fps on interactive terminals and 0 (=disabled)
-// for non-interactive terminals or when run using the --quiet flag
-func calculateProgressInterval(show bool, json bool) time.Duration {
-	interval := time.Second / 60
+// minProgressInterval limits the progress updates to 60fps.
+const minProgressInterval = time.Second / 60
+
+// nonInteractiveProgressInterval is the interval between the status lines if
+// stdout is not a terminal which can update the status in place.
+const nonInteractiveProgressInterval = 30 * time.Second
+
+// calculateProgressInterval returns the interval configured via
+// --progress-interval or RESTIC_PROGRESS_FPS. If neither is set, it returns
+// an interval for 60fps on interactive terminals and for a status line every
+// 30 seconds on non-interactive terminals, or 0 (=disabled) when run using
+// the --quiet flag. With --no-progress the interval is always 0.
+func calculateProgressInterval(gopts GlobalOptions, show bool, json bool) time.Duration {
+	if gopts.NoProgress {
+		return 0
+	}
+
+	interval := minProgressInterval
 	fps, err := strconv.ParseFloat(os.Getenv("RESTIC_PROGRESS_FPS"), 64)
-	if err == nil && fps > 0 {
+	switch {
+	case gopts.ProgressInterval > 0:
+		interval = gopts.ProgressInterval
+		if interval < minProgressInterval {
+			interval = minProgressInterval
+		}
+	case err == nil && fps > 0:
 		if fps > 60 {
 			fps = 60
 		}
 		interval = time.Duration(float64(time.Second) / fps)
-	} else if !json && !stdoutCanUpdateStatus() || !show {
+	case !show:
 		interval = 0
+	case !json && !stdoutCanUpdateStatus():
+		interval = nonInteractiveProgressInterval
 	}
 	return interval
 }
 
 // newProgressMax returns a progress.Counter that prints to stdout.
-func newProgressMax(show bool, max uint64, description string) *progress.Counter {
-	if !show {
+func newProgressMax(gopts GlobalOptions, show bool, max uint64, description string) *progress.Counter {
+	if !show || gopts.NoProgress {
 		return nil
 	}
-	interval := calculateProgressInterval(show, false)
+	interval := calculateProgressInterval(gopts, show, false)
 	canUpdateStatus := stdoutCanUpdateStatus()
 
-	return progress.NewCounter(interval, max, func(v uint64, max uint64, d time.Duration, final bool) {
+	c := progress.NewCounter(interval, max, func(v uint64, max uint64, d time.Duration, final bool) {
 		var status string
 		if max == 0 {
 			status = fmt.Sprintf("[%s]          %d %s",
@@ -52,6 +74,95 @@ func newProgressMax(show bool, max uint64, description string) *progress.Counter
 			fmt.Print("\n")
 		}
 	})
+	c.Register("", description)
+	return c
+}
+
+// newPhaseProgress returns a progress.Counter for one phase of a long running
+// operation like prune, check or copy. The counter tracks the number of
+// processed items and, if maxBytes is not zero, the number of processed bytes.
+// With --json, the status is printed as JSON lines for the given phase. If
+// stdout is not a terminal, a status line is printed periodically.
+func newPhaseProgress(gopts GlobalOptions, phase string, maxItems, maxBytes uint64, description string) *progress.Counter {
+	if gopts.Quiet || gopts.NoProgress {
+		return nil
+	}
+
+	interval := calculateProgressInterval(gopts, true, gopts.JSON)
+	var c *progress.Counter
+	if gopts.JSON {
+		c = progress.NewPhaseCounter(interval, maxItems, maxBytes, func(s progress.PhaseStatus, final bool) {
+			printPhaseStatusJSON(phase, s)
+		})
+	} else {
+		canUpdateStatus := stdoutCanUpdateStatus()
+		c = progress.NewPhaseCounter(interval, maxItems, maxBytes, func(s progress.PhaseStatus, final bool) {
+			printProgress(formatPhaseStatus(s, description, final), canUpdateStatus)
+			if final && canUpdateStatus {
+				fmt.Print("\n")
+			}
+		})
+	}
+	c.Register(phase, description)
+	return c
+}
+
+// formatPhaseStatus returns a status line for a phase progress.
+func formatPhaseStatus(s progress.PhaseStatus, description string, final bool) string {
+	if s.MaxItems == 0 && s.MaxBytes == 0 {
+		return fmt.Sprintf("[%s]          %d %s", ui.FormatDuration(s.Runtime), s.Items, description)
+	}
+
+	var percent string
+	if s.MaxBytes > 0 {
+		percent = ui.FormatPercent(s.Bytes, s.MaxBytes)
+	} else {
+		percent = ui.FormatPercent(s.Items, s.MaxItems)
+	}
+
+	status := fmt.Sprintf("[%s] %s  %d / %d %s", ui.FormatDuration(s.Runtime), percent, s.Items, s.MaxItems, description)
+	if s.MaxBytes > 0 {
+		status += fmt.Sprintf(", %s / %s", ui.FormatBytes(s.Bytes), ui.FormatBytes(s.MaxBytes))
+	}
+	if eta, ok := s.ETA(); ok && !final && eta > 0 {
+		status += fmt.Sprintf("  ETA %s", ui.FormatDuration(eta))
+	}
+	return status
+}
+
+type phaseStatusJSON struct {
+	MessageType      string  `json:"message_type"` // "status"
+	Phase            string  `json:"phase"`
+	SecondsElapsed   uint64  `json:"seconds_elapsed"`
+	SecondsRemaining uint64  `json:"seconds_remaining,omitempty"`
+	PercentDone      float64 `json:"percent_done"`
+	TotalItems       uint64  `json:"total_items"`
+	ItemsDone        uint64  `json:"items_done"`
+	TotalBytes       uint64  `json:"total_bytes,omitempty"`
+	BytesDone        uint64  `json:"bytes_done,omitempty"`
+}
+
+func printPhaseStatusJSON(phase string, s progress.PhaseStatus) {
+	status := phaseStatusJSON{
+		MessageType:    "status",
+		Phase:          phase,
+		SecondsElapsed: uint64(s.Runtime / time.Second),
+		TotalItems:     s.MaxItems,
+		ItemsDone:      s.Items,
+		TotalBytes:     s.MaxBytes,
+		BytesDone:      s.Bytes,
+	}
+	if f, ok := s.Fraction(); ok {
+		status.PercentDone = f
+	}
+	if eta, ok := s.ETA(); ok {
+		status.SecondsRemaining = uint64(eta / time.Second)
+	}
+
+	err := json.NewEncoder(globalOptions.stdout).Encode(status)
+	if err != nil {
+		Warnf("JSON encode failed: %v\n", err)
+	}
 }
 
 func printProgress(status string, canUpdateStatus bool) {
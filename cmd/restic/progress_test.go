@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	rtest "github.com/restic/restic/internal/test"
+	"github.com/restic/restic/internal/ui/progress"
+)
+
+func TestFormatPhaseStatus(t *testing.T) {
+	for _, test := range []struct {
+		s     progress.PhaseStatus
+		final bool
+		want  string
+	}{
+		{
+			s:    progress.PhaseStatus{Items: 5, Runtime: 3 * time.Second},
+			want: "[0:03]          5 snapshots",
+		},
+		{
+			s:    progress.PhaseStatus{Items: 5, MaxItems: 10, Runtime: 3 * time.Second},
+			want: "[0:03] 50.00%  5 / 10 snapshots  ETA 0:03",
+		},
+		{
+			s:    progress.PhaseStatus{Items: 5, MaxItems: 10, Bytes: 1024, MaxBytes: 4096, Runtime: 3 * time.Second},
+			want: "[0:03] 25.00%  5 / 10 snapshots, 1.000 KiB / 4.000 KiB  ETA 0:09",
+		},
+		{
+			s:     progress.PhaseStatus{Items: 10, MaxItems: 10, Bytes: 4096, MaxBytes: 4096, Runtime: 3 * time.Second},
+			final: true,
+			want:  "[0:03] 100.00%  10 / 10 snapshots, 4.000 KiB / 4.000 KiB",
+		},
+	} {
+		rtest.Equals(t, test.want, formatPhaseStatus(test.s, "snapshots", test.final))
+	}
+}
+
+// phaseStatusMessages returns the status messages for phase from the JSON
+// output of a command.
+func TestCalculateProgressInterval(t *testing.T) {
+	// status lines are never updated in place with NO_COLOR
+	t.Setenv("NO_COLOR", "1")
+	t.Setenv("RESTIC_PROGRESS_FPS", "")
+
+	for _, test := range []struct {
+		name  string
+		gopts GlobalOptions
+		fps   string
+		show  bool
+		json  bool
+		want  time.Duration
+	}{
+		{"default", GlobalOptions{}, "", true, false, nonInteractiveProgressInterval},
+		{"json", GlobalOptions{}, "", true, true, minProgressInterval},
+		{"quiet", GlobalOptions{}, "", false, false, 0},
+		{"fps", GlobalOptions{}, "2", true, false, time.Second / 2},
+		{"fps-quiet", GlobalOptions{}, "2", false, false, time.Second / 2},
+		{"fps-max", GlobalOptions{}, "1000", true, false, minProgressInterval},
+		{"interval", GlobalOptions{ProgressInterval: time.Minute}, "2", true, false, time.Minute},
+		{"interval-min", GlobalOptions{ProgressInterval: time.Millisecond}, "", true, false, minProgressInterval},
+		{"no-progress", GlobalOptions{NoProgress: true, ProgressInterval: time.Minute}, "2", true, true, 0},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("RESTIC_PROGRESS_FPS", test.fps)
+			rtest.Equals(t, test.want, calculateProgressInterval(test.gopts, test.show, test.json))
+		})
+	}
+}
+
+func phaseStatusMessages(t testing.TB, output []byte, phase string) []phaseStatusJSON {
+	var msgs []phaseStatusJSON
+	sc := bufio.NewScanner(bytes.NewReader(output))
+	for sc.Scan() {
+		line := sc.Bytes()
+		if !bytes.HasPrefix(line, []byte(`{"message_type":"status"`)) {
+			continue
+		}
+
+		var msg phaseStatusJSON
+		rtest.OK(t, json.Unmarshal(line, &msg))
+		if msg.Phase == phase {
+			msgs = append(msgs, msg)
+		}
+	}
+	rtest.OK(t, sc.Err())
+	return msgs
+}
+
+// checkPhaseProgress checks that the progress for phase was reported with
+// sane values and that the phase was completed.
+func checkPhaseProgress(t testing.TB, output []byte, phase string, withBytes bool) {
+	t.Helper()
+	msgs := phaseStatusMessages(t, output, phase)
+	rtest.Assert(t, len(msgs) > 0, "no progress reported for phase %v", phase)
+
+	for _, msg := range msgs {
+		rtest.Assert(t, msg.ItemsDone <= msg.TotalItems, "phase %v: %d of %d items done", phase, msg.ItemsDone, msg.TotalItems)
+		rtest.Assert(t, msg.BytesDone <= msg.TotalBytes, "phase %v: %d of %d bytes done", phase, msg.BytesDone, msg.TotalBytes)
+		rtest.Assert(t, msg.PercentDone >= 0 && msg.PercentDone <= 1, "phase %v: invalid percentage %v", phase, msg.PercentDone)
+	}
+
+	last := msgs[len(msgs)-1]
+	rtest.Assert(t, last.TotalItems > 0, "phase %v: no items to process", phase)
+	rtest.Equals(t, last.TotalItems, last.ItemsDone)
+	rtest.Equals(t, 1.0, last.PercentDone)
+	if withBytes {
+		rtest.Assert(t, last.TotalBytes > 0, "phase %v: no bytes to process", phase)
+		rtest.Equals(t, last.TotalBytes, last.BytesDone)
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/options"
+	"github.com/restic/restic/internal/textfile"
+)
+
+// repositoryNamePrefix marks a repository location which refers to an entry in
+// the repositories file, e.g. "name:offsite".
+const repositoryNamePrefix = "name:"
+
+// repositoryEntry is a named repository from the repositories file.
+type repositoryEntry struct {
+	Repository      string
+	PasswordFile    string
+	PasswordCommand string
+	KeyHint         string
+	Options         []string
+}
+
+// defaultRepositoriesFile returns the location of the repositories file if
+// neither --repositories-file nor $RESTIC_REPOSITORIES_FILE is set.
+func defaultRepositoriesFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", errors.Wrap(err, "UserConfigDir")
+	}
+	return filepath.Join(dir, "restic", "repos.toml"), nil
+}
+
+// applyRepositoryName replaces a repository location of the form
+// "name:<name>" with the repository configured for name in the repositories
+// file. The password settings, the key hint and the extended options from the
+// file are only used if they are not given as options or via environment
+// variables, so these always take precedence. The password command is not run
+// here, it is only called once the password is actually needed.
+func applyRepositoryName(opts *GlobalOptions, pwdEnv string) error {
+	if !strings.HasPrefix(opts.Repo, repositoryNamePrefix) {
+		return nil
+	}
+	name := strings.TrimPrefix(opts.Repo, repositoryNamePrefix)
+
+	filename := opts.RepositoriesFile
+	if filename == "" {
+		var err error
+		filename, err = defaultRepositoriesFile()
+		if err != nil {
+			return err
+		}
+	}
+
+	entries, err := readRepositoriesFile(filename)
+	if err != nil {
+		return err
+	}
+
+	entry, ok := entries[name]
+	if !ok {
+		names := make([]string, 0, len(entries))
+		for n := range entries {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return errors.Fatalf("repository name %q not found in %v, known names: %v", name, filename, strings.Join(names, ", "))
+	}
+
+	opts.Repo = entry.Repository
+	if opts.PasswordFile == "" && opts.PasswordCommand == "" && opts.password == "" && os.Getenv(pwdEnv) == "" {
+		opts.PasswordFile = entry.PasswordFile
+		opts.PasswordCommand = entry.PasswordCommand
+	}
+	if opts.KeyHint == "" {
+		opts.KeyHint = entry.KeyHint
+	}
+
+	if len(entry.Options) > 0 {
+		extended, err := options.Parse(entry.Options)
+		if err != nil {
+			return errors.Fatalf("%v: repository %q: %v", filename, name, err)
+		}
+		if err := extended.Check(); err != nil {
+			return errors.Fatalf("%v: repository %q: %v", filename, name, err)
+		}
+
+		// options from the command line override the file
+		for k, v := range opts.extended {
+			extended[k] = v
+		}
+		opts.extended = extended
+	}
+
+	return nil
+}
+
+// readRepositoriesFile loads the repositories file.
+func readRepositoriesFile(filename string) (map[string]repositoryEntry, error) {
+	buf, err := textfile.Read(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errors.Fatalf("repositories file %s does not exist", filename)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := parseRepositoriesFile(buf)
+	if err != nil {
+		return nil, errors.Fatalf("%v: %v", filename, err)
+	}
+	return entries, nil
+}
+
+// parseRepositoriesFile parses the subset of TOML used by the repositories
+// file: one table per repository containing string values and arrays of
+// strings, for example
+//
+//	[offsite]
+//	repository = "s3:https://s3.example.com/backup"
+//	password-command = "pass show restic/offsite"
+//	options = ["s3.connections=10"]
+func parseRepositoriesFile(data []byte) (map[string]repositoryEntry, error) {
+	entries := make(map[string]repositoryEntry)
+	var current string
+	lines := strings.Split(string(data), "\n")
+
+	for i := 0; i < len(lines); i++ {
+		lineno := i + 1
+		line := stripComment(lines[i])
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, errors.Errorf("line %d: invalid table header %q", lineno, line)
+			}
+			name, err := parseKey(strings.TrimSpace(line[1 : len(line)-1]))
+			if err != nil {
+				return nil, errors.Errorf("line %d: %v", lineno, err)
+			}
+			if _, ok := entries[name]; ok {
+				return nil, errors.Errorf("line %d: repository %q is defined twice", lineno, name)
+			}
+			entries[name] = repositoryEntry{}
+			current = name
+			continue
+		}
+
+		k, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, errors.Errorf("line %d: expected key = value, got %q", lineno, line)
+		}
+		if current == "" {
+			return nil, errors.Errorf("line %d: key outside of a repository table", lineno)
+		}
+		key, err := parseKey(strings.TrimSpace(k))
+		if err != nil {
+			return nil, errors.Errorf("line %d: %v", lineno, err)
+		}
+
+		// arrays may span several lines
+		value = strings.TrimSpace(value)
+		for strings.HasPrefix(value, "[") && indexUnquoted(value, ']') < 0 && i+1 < len(lines) {
+			i++
+			value += " " + stripComment(lines[i])
+		}
+
+		entry := entries[current]
+		switch key {
+		case "repository":
+			entry.Repository, err = parseString(value)
+		case "password-file":
+			entry.PasswordFile, err = parseString(value)
+		case "password-command":
+			entry.PasswordCommand, err = parseString(value)
+		case "key-hint":
+			entry.KeyHint, err = parseString(value)
+		case "options":
+			entry.Options, err = parseStringArray(value)
+		default:
+			err = errors.Errorf("unknown key %q", key)
+		}
+		if err != nil {
+			return nil, errors.Errorf("line %d: %v", lineno, err)
+		}
+		entries[current] = entry
+	}
+
+	for name, entry := range entries {
+		if entry.Repository == "" {
+			return nil, errors.Errorf("repository %q has no repository location", name)
+		}
+		if entry.PasswordFile != "" && entry.PasswordCommand != "" {
+			return nil, errors.Errorf("repository %q: password-file and password-command are mutually exclusive", name)
+		}
+	}
+
+	return entries, nil
+}
+
+// indexUnquoted returns the index of the first byte c in s which is not part
+// of a string, or -1 if there is none.
+func indexUnquoted(s string, c byte) int {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quote == '"' && s[i] == '\\':
+			// skip the escaped character
+			i++
+		case quote != 0:
+			if s[i] == quote {
+				quote = 0
+			}
+		case s[i] == '"' || s[i] == '\'':
+			quote = s[i]
+		case s[i] == c:
+			return i
+		}
+	}
+	return -1
+}
+
+// stripComment removes a trailing comment and surrounding whitespace.
+func stripComment(line string) string {
+	if i := indexUnquoted(line, '#'); i >= 0 {
+		line = line[:i]
+	}
+	return strings.TrimSpace(line)
+}
+
+func isBareKey(s string) bool {
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// parseKey parses a bare or quoted key.
+func parseKey(s string) (string, error) {
+	if isBareKey(s) {
+		return s, nil
+	}
+	if strings.HasPrefix(s, "\"") || strings.HasPrefix(s, "'") {
+		return parseString(s)
+	}
+	return "", errors.Errorf("invalid key %q", s)
+}
+
+// parseString parses a basic string in double quotes or a literal string in
+// single quotes.
+func parseString(s string) (string, error) {
+	switch {
+	case len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' && !strings.Contains(s[1:len(s)-1], "'"):
+		return s[1 : len(s)-1], nil
+	case len(s) >= 2 && s[0] == '"':
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return "", errors.Errorf("invalid string %v", s)
+		}
+		return v, nil
+	}
+	return "", errors.Errorf("expected a string, got %v", s)
+}
+
+// parseStringArray parses an array of strings.
+func parseStringArray(s string) ([]string, error) {
+	end := indexUnquoted(s, ']')
+	if !strings.HasPrefix(s, "[") || end < 0 || strings.TrimSpace(s[end+1:]) != "" {
+		return nil, errors.Errorf("expected an array of strings, got %v", s)
+	}
+
+	var list []string
+	rest := s[1:end]
+	for strings.TrimSpace(rest) != "" {
+		item := rest
+		rest = ""
+		if i := indexUnquoted(item, ','); i >= 0 {
+			item, rest = item[:i], item[i+1:]
+		}
+
+		v, err := parseString(strings.TrimSpace(item))
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, nil
+}
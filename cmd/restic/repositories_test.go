@@ -0,0 +1,160 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/options"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+var testRepositoriesFile = filepath.Join("testdata", "repos.toml")
+
+func TestParseRepositoriesFile(t *testing.T) {
+	entries, err := readRepositoriesFile(testRepositoriesFile)
+	rtest.OK(t, err)
+
+	rtest.Equals(t, map[string]repositoryEntry{
+		"local": {
+			Repository:   "/srv/restic-repo",
+			PasswordFile: "/etc/restic/local.pw",
+		},
+		"offsite": {
+			Repository:      "s3:https://s3.example.com/bucket/restic",
+			PasswordCommand: `sh -c 'touch "$RESTIC_TEST_MARKER" && echo offsite-secret'`,
+			KeyHint:         "0123abcd",
+			Options:         []string{"s3.connections=10", "cache.list-ttl=5m"},
+		},
+		"with spaces": {
+			Repository: "rest:http://localhost:8000/#not-a-comment",
+			Options:    []string{"rest.connections=2"},
+		},
+	}, entries)
+}
+
+func TestParseRepositoriesFileInvalid(t *testing.T) {
+	for _, data := range []string{
+		"repository = \"/srv/repo\"\n",
+		"[foo\nrepository = \"/srv/repo\"\n",
+		"[foo bar]\nrepository = \"/srv/repo\"\n",
+		"[foo]\nrepository = /srv/repo\n",
+		"[foo]\nrepository = \"/srv/repo\n",
+		"[foo]\nrepository\n",
+		"[foo]\nrepository = \"/srv/repo\"\npassword = \"secret\"\n",
+		"[foo]\npassword-file = \"/srv/pw\"\n",
+		"[foo]\nrepository = \"/srv/repo\"\n[foo]\nrepository = \"/srv/repo2\"\n",
+		"[foo]\nrepository = \"/srv/repo\"\npassword-file = \"pw\"\npassword-command = \"echo pw\"\n",
+		"[foo]\nrepository = \"/srv/repo\"\noptions = \"s3.connections=2\"\n",
+		"[foo]\nrepository = \"/srv/repo\"\noptions = [\"s3.connections=2\" \"x\"]\n",
+		"[foo]\nrepository = \"/srv/repo\"\noptions = [\"s3.connections=2\",\n",
+	} {
+		_, err := parseRepositoriesFile([]byte(data))
+		rtest.Assert(t, err != nil, "missing error for %q", data)
+	}
+}
+
+func TestApplyRepositoryName(t *testing.T) {
+	marker := filepath.Join(rtest.TempDir(t), "password-command-called")
+	t.Setenv("RESTIC_TEST_MARKER", marker)
+	t.Setenv("RESTIC_PASSWORD", "")
+
+	// explicit locations don't need the repositories file
+	opts := GlobalOptions{Repo: "/srv/repo", RepositoriesFile: "/nonexistent"}
+	rtest.OK(t, applyRepositoryName(&opts, "RESTIC_PASSWORD"))
+	rtest.Equals(t, GlobalOptions{Repo: "/srv/repo", RepositoriesFile: "/nonexistent"}, opts)
+
+	opts = GlobalOptions{Repo: "name:local", RepositoriesFile: testRepositoriesFile}
+	rtest.OK(t, applyRepositoryName(&opts, "RESTIC_PASSWORD"))
+	rtest.Equals(t, "/srv/restic-repo", opts.Repo)
+	rtest.Equals(t, "/etc/restic/local.pw", opts.PasswordFile)
+
+	// options from the command line take precedence
+	extended, err := options.Parse([]string{"s3.connections=2"})
+	rtest.OK(t, err)
+	opts = GlobalOptions{Repo: "name:offsite", RepositoriesFile: testRepositoriesFile, extended: extended}
+	rtest.OK(t, applyRepositoryName(&opts, "RESTIC_PASSWORD"))
+	rtest.Equals(t, "s3:https://s3.example.com/bucket/restic", opts.Repo)
+	rtest.Equals(t, "0123abcd", opts.KeyHint)
+	rtest.Equals(t, options.Options{"s3.connections": "2", "cache.list-ttl": "5m"}, opts.extended)
+
+	// the password command only runs once the password is needed
+	_, err = os.Stat(marker)
+	rtest.Assert(t, os.IsNotExist(err), "password command was run too early")
+	if runtime.GOOS != "windows" {
+		password, err := resolvePassword(opts, "RESTIC_PASSWORD")
+		rtest.OK(t, err)
+		rtest.Equals(t, "offsite-secret", password)
+		_, err = os.Stat(marker)
+		rtest.OK(t, err)
+	}
+
+	// an explicit password source is not replaced
+	opts = GlobalOptions{Repo: "name:offsite", RepositoriesFile: testRepositoriesFile, PasswordFile: "/srv/pw"}
+	rtest.OK(t, applyRepositoryName(&opts, "RESTIC_PASSWORD"))
+	rtest.Equals(t, "/srv/pw", opts.PasswordFile)
+	rtest.Equals(t, "", opts.PasswordCommand)
+
+	t.Setenv("RESTIC_PASSWORD", "secret")
+	opts = GlobalOptions{Repo: "name:offsite", RepositoriesFile: testRepositoriesFile}
+	rtest.OK(t, applyRepositoryName(&opts, "RESTIC_PASSWORD"))
+	rtest.Equals(t, "", opts.PasswordCommand)
+
+	opts = GlobalOptions{Repo: "name:with spaces", RepositoriesFile: testRepositoriesFile}
+	rtest.OK(t, applyRepositoryName(&opts, "RESTIC_PASSWORD"))
+	rtest.Equals(t, "rest:http://localhost:8000/#not-a-comment", opts.Repo)
+}
+
+func TestApplyRepositoryNameErrors(t *testing.T) {
+	opts := GlobalOptions{Repo: "name:unknown", RepositoriesFile: testRepositoriesFile}
+	err := applyRepositoryName(&opts, "RESTIC_PASSWORD")
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "known names: local, offsite, with spaces"),
+		"unexpected error %v", err)
+
+	opts = GlobalOptions{Repo: "name:local", RepositoriesFile: filepath.Join(rtest.TempDir(t), "missing.toml")}
+	err = applyRepositoryName(&opts, "RESTIC_PASSWORD")
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "does not exist"), "unexpected error %v", err)
+
+	invalid := filepath.Join(rtest.TempDir(t), "invalid.toml")
+	rtest.OK(t, os.WriteFile(invalid, []byte("[local]\nrepository = \"/srv/repo\"\noptions = [\"invalid\"]\n"), 0600))
+	opts = GlobalOptions{Repo: "name:local", RepositoriesFile: invalid}
+	rtest.Assert(t, applyRepositoryName(&opts, "RESTIC_PASSWORD") != nil, "missing error for invalid option")
+}
+
+func TestSecondaryRepositoryName(t *testing.T) {
+	gopts := GlobalOptions{Repo: "/srv/primary", password: "primary", RepositoriesFile: testRepositoriesFile}
+	dstGopts, _, err := fillSecondaryGlobalOpts(secondaryRepoOptions{Repo: "name:local", password: "secret"}, gopts, "source")
+	rtest.OK(t, err)
+	rtest.Equals(t, "/srv/restic-repo", dstGopts.Repo)
+	rtest.Equals(t, "secret", dstGopts.password)
+}
+
+func TestRepositoryNameIntegration(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+
+	pwfile := filepath.Join(env.base, "password")
+	rtest.OK(t, os.WriteFile(pwfile, []byte(env.gopts.password), 0600))
+	reposFile := filepath.Join(env.base, "repos.toml")
+	rtest.OK(t, os.WriteFile(reposFile, []byte("[test]\nrepository = "+strconv.Quote(env.repo)+
+		"\npassword-file = "+strconv.Quote(pwfile)+"\n"), 0600))
+
+	gopts := env.gopts
+	gopts.Repo = "name:test"
+	gopts.RepositoriesFile = reposFile
+	gopts.password = ""
+	t.Setenv("RESTIC_PASSWORD", "")
+	rtest.OK(t, applyRepositoryName(&gopts, "RESTIC_PASSWORD"))
+	password, err := resolvePassword(gopts, "RESTIC_PASSWORD")
+	rtest.OK(t, err)
+	gopts.password = password
+
+	testRunCheck(t, gopts)
+	testRunPrune(t, gopts, PruneOptions{MaxUnused: "5%"})
+}
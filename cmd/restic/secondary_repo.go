@@ -58,7 +58,7 @@ func initSecondaryRepoOptions(f *pflag.FlagSet, opts *secondaryRepoOptions, repo
 
 func fillSecondaryGlobalOpts(opts secondaryRepoOptions, gopts GlobalOptions, repoPrefix string) (GlobalOptions, bool, error) {
 	if opts.Repo == "" && opts.RepositoryFile == "" && opts.LegacyRepo == "" && opts.LegacyRepositoryFile == "" {
-		return GlobalOptions{}, false, errors.Fatal("Please specify a source repository location (--from-repo or --from-repository-file)")
+		return GlobalOptions{}, false, invalidArguments(errors.Fatal("Please specify a source repository location (--from-repo or --from-repository-file)"))
 	}
 
 	hasFromRepo := opts.Repo != "" || opts.RepositoryFile != "" || opts.PasswordFile != "" ||
@@ -67,16 +67,18 @@ func fillSecondaryGlobalOpts(opts secondaryRepoOptions, gopts GlobalOptions, rep
 		opts.LegacyKeyHint != "" || opts.LegacyPasswordCommand != ""
 
 	if hasFromRepo && hasRepo2 {
-		return GlobalOptions{}, false, errors.Fatal("Option groups repo2 and from-repo are mutually exclusive, please specify only one")
+		return GlobalOptions{}, false, invalidArguments(errors.Fatal("Option groups repo2 and from-repo are mutually exclusive, please specify only one"))
 	}
 
 	var err error
 	dstGopts := gopts
+	// the expected repository ID only applies to the primary repository
+	dstGopts.ExpectRepoID = ""
 	var pwdEnv string
 
 	if hasFromRepo {
 		if opts.Repo != "" && opts.RepositoryFile != "" {
-			return GlobalOptions{}, false, errors.Fatal("Options --from-repo and --from-repository-file are mutually exclusive, please specify only one")
+			return GlobalOptions{}, false, invalidArguments(errors.Fatal("Options --from-repo and --from-repository-file are mutually exclusive, please specify only one"))
 		}
 
 		dstGopts.Repo = opts.Repo
@@ -89,7 +91,7 @@ func fillSecondaryGlobalOpts(opts secondaryRepoOptions, gopts GlobalOptions, rep
 		repoPrefix = "source"
 	} else {
 		if opts.LegacyRepo != "" && opts.LegacyRepositoryFile != "" {
-			return GlobalOptions{}, false, errors.Fatal("Options --repo2 and --repository-file2 are mutually exclusive, please specify only one")
+			return GlobalOptions{}, false, invalidArguments(errors.Fatal("Options --repo2 and --repository-file2 are mutually exclusive, please specify only one"))
 		}
 
 		dstGopts.Repo = opts.LegacyRepo
@@ -101,6 +103,11 @@ func fillSecondaryGlobalOpts(opts secondaryRepoOptions, gopts GlobalOptions, rep
 		pwdEnv = "RESTIC_PASSWORD2"
 	}
 
+	dstGopts.password = opts.password
+	if err := applyRepositoryName(&dstGopts, pwdEnv); err != nil {
+		return GlobalOptions{}, false, err
+	}
+
 	if opts.password != "" {
 		dstGopts.password = opts.password
 	} else {
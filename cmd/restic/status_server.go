@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/ui"
+)
+
+// statusShutdownTimeout is the maximum duration to wait for running requests
+// when the status server is stopped.
+const statusShutdownTimeout = 5 * time.Second
+
+// statusResponse is the JSON document served at /status. It describes the
+// operation which is currently running, the same one which is reported on
+// SIGUSR1.
+type statusResponse struct {
+	Running     bool       `json:"running"`
+	Operation   string     `json:"operation,omitempty"`
+	PercentDone float64    `json:"percent_done"`
+	Items       uint64     `json:"items"`
+	TotalItems  uint64     `json:"total_items"`
+	ItemUnit    string     `json:"item_unit,omitempty"`
+	Bytes       uint64     `json:"bytes"`
+	TotalBytes  uint64     `json:"total_bytes"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	Elapsed     float64    `json:"elapsed"`
+}
+
+func newStatusResponse(s ui.Status, ok bool, now time.Time) statusResponse {
+	if !ok {
+		return statusResponse{}
+	}
+
+	res := statusResponse{
+		Running:    true,
+		Operation:  s.Operation,
+		Items:      s.Items,
+		TotalItems: s.TotalItems,
+		ItemUnit:   s.ItemUnit,
+		Bytes:      s.Bytes,
+		TotalBytes: s.TotalBytes,
+		Elapsed:    s.Elapsed.Seconds(),
+	}
+	switch {
+	case s.TotalBytes > 0:
+		res.PercentDone = float64(s.Bytes) / float64(s.TotalBytes)
+	case s.TotalItems > 0:
+		res.PercentDone = float64(s.Items) / float64(s.TotalItems)
+	}
+	startedAt := now.Add(-s.Elapsed)
+	res.StartedAt = &startedAt
+	return res
+}
+
+// statusServer serves the progress of the running operation via HTTP.
+type statusServer struct {
+	srv  *http.Server
+	addr net.Addr
+	done chan struct{}
+}
+
+// startStatusServer starts an HTTP server listening on addr which serves
+// /status and /healthz. An empty addr disables the server, then nil is
+// returned.
+func startStatusServer(addr string) (*statusServer, error) {
+	if addr == "" {
+		return nil, nil
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, errors.Fatalf("unable to start status server: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		s, ok := ui.CurrentStatus()
+		w.Header().Set("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(newStatusResponse(s, ok, time.Now()))
+		if err != nil {
+			debug.Log("unable to write status: %v", err)
+		}
+	})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("ok\n"))
+	})
+
+	s := &statusServer{
+		srv:  &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second},
+		addr: l.Addr(),
+		done: make(chan struct{}),
+	}
+	go func() {
+		defer close(s.done)
+		err := s.srv.Serve(l)
+		if err != nil && err != http.ErrServerClosed {
+			debug.Log("status server failed: %v", err)
+		}
+	}()
+
+	debug.Log("status server listening on %v", s.addr)
+	return s, nil
+}
+
+// Addr returns the address the server is listening on.
+func (s *statusServer) Addr() net.Addr {
+	return s.addr
+}
+
+// Stop shuts the server down and waits for running requests to complete.
+func (s *statusServer) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), statusShutdownTimeout)
+	defer cancel()
+
+	err := s.srv.Shutdown(ctx)
+	if err != nil {
+		err = s.srv.Close()
+	}
+	<-s.done
+	return err
+}
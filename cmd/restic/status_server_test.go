@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+	"github.com/restic/restic/internal/ui"
+)
+
+func getStatus(t testing.TB, srv *statusServer) statusResponse {
+	res, err := http.Get("http://" + srv.Addr().String() + "/status")
+	rtest.OK(t, err)
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	rtest.Equals(t, http.StatusOK, res.StatusCode)
+	rtest.Equals(t, "application/json", res.Header.Get("Content-Type"))
+
+	var status statusResponse
+	rtest.OK(t, json.NewDecoder(res.Body).Decode(&status))
+	return status
+}
+
+func TestStatusServer(t *testing.T) {
+	srv, err := startStatusServer("127.0.0.1:0")
+	rtest.OK(t, err)
+	defer func() {
+		rtest.OK(t, srv.Stop())
+	}()
+
+	res, err := http.Get("http://" + srv.Addr().String() + "/healthz")
+	rtest.OK(t, err)
+	buf, err := io.ReadAll(res.Body)
+	rtest.OK(t, err)
+	rtest.OK(t, res.Body.Close())
+	rtest.Equals(t, http.StatusOK, res.StatusCode)
+	rtest.Equals(t, "ok\n", string(buf))
+
+	rtest.Equals(t, statusResponse{}, getStatus(t, srv))
+
+	unregister := ui.RegisterStatus(func() ui.Status {
+		return ui.Status{Operation: "prune", Items: 3, TotalItems: 4, ItemUnit: "packs", Elapsed: time.Minute}
+	})
+	status := getStatus(t, srv)
+	unregister()
+
+	rtest.Assert(t, status.StartedAt != nil && time.Since(*status.StartedAt) >= time.Minute, "invalid start time %v", status.StartedAt)
+	status.StartedAt = nil
+	rtest.Equals(t, statusResponse{
+		Running:     true,
+		Operation:   "prune",
+		PercentDone: 0.75,
+		Items:       3,
+		TotalItems:  4,
+		ItemUnit:    "packs",
+		Elapsed:     60,
+	}, status)
+}
+
+func TestStatusServerDisabled(t *testing.T) {
+	srv, err := startStatusServer("")
+	rtest.OK(t, err)
+	rtest.Assert(t, srv == nil, "server started without address")
+}
+
+// blockingPackBackend blocks saving pack files until release is closed.
+type blockingPackBackend struct {
+	restic.Backend
+	release <-chan struct{}
+}
+
+func (be *blockingPackBackend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	if h.Type == restic.PackFile {
+		select {
+		case <-be.release:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return be.Backend.Save(ctx, h, rd)
+}
+
+func TestStatusServerBackup(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+
+	srv, err := startStatusServer("127.0.0.1:0")
+	rtest.OK(t, err)
+	defer func() {
+		rtest.OK(t, srv.Stop())
+	}()
+
+	release := make(chan struct{})
+	var releaseOnce sync.Once
+	defer releaseOnce.Do(func() { close(release) })
+	gopts := env.gopts
+	gopts.backendTestHook = func(r restic.Backend) (restic.Backend, error) {
+		return &blockingPackBackend{Backend: r, release: release}, nil
+	}
+
+	start := time.Now()
+	backupErr := make(chan error, 1)
+	go func() {
+		backupErr <- testRunBackupAssumeFailure(t, env.testdata, []string{"."}, BackupOptions{}, gopts)
+	}()
+
+	// the backup cannot finish before the pack files are released
+	var status statusResponse
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		status = getStatus(t, srv)
+		if status.Running && status.TotalItems > 0 && status.Items == status.TotalItems {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("backup status not reported, last status %+v", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	releaseOnce.Do(func() { close(release) })
+
+	rtest.Equals(t, "backup", status.Operation)
+	rtest.Equals(t, "files", status.ItemUnit)
+	rtest.Assert(t, status.Bytes > 0 && status.Bytes == status.TotalBytes, "invalid bytes %v / %v", status.Bytes, status.TotalBytes)
+	rtest.Equals(t, 1.0, status.PercentDone)
+	rtest.Assert(t, status.StartedAt != nil && !status.StartedAt.Before(start.Add(-time.Second)) && !status.StartedAt.After(time.Now()),
+		"invalid start time %v", status.StartedAt)
+
+	rtest.OK(t, <-backupErr)
+	rtest.Equals(t, statusResponse{}, getStatus(t, srv))
+}
@@ -60,6 +60,13 @@ type Archiver struct {
 	fileSaver *FileSaver
 	treeSaver *TreeSaver
 
+	// hardlinks tracks the content of files with several hard links, it is
+	// nil if the inode cannot be relied on
+	hardlinks *hardlinkIndex
+
+	// ancestors contains the directories on the path currently being saved
+	ancestors ancestorDirs
+
 	// Error is called for all errors that occur during backup.
 	Error ErrorFunc
 
@@ -81,6 +88,15 @@ type Archiver struct {
 	// CompleteBlob is called for all saved blobs for files.
 	CompleteBlob func(bytes uint64)
 
+	// CompleteTarget is called for each target once the snapshot has been
+	// saved, ordered by the path of the target in the snapshot.
+	CompleteTarget func(TargetSummary)
+
+	// FileChanged is called for each regular file which is read because its
+	// content cannot be reused from the parent snapshot. The parameter reason
+	// describes why, e.g. "mtime changed".
+	FileChanged func(item string, reason string)
+
 	// WithAtime configures if the access time for files and directories should
 	// be saved. Enabling it may result in much metadata, so it's off by
 	// default.
@@ -88,6 +104,18 @@ type Archiver struct {
 
 	// Flags controlling change detection. See doc/040_backup.rst for details.
 	ChangeIgnoreFlags uint
+
+	// MtimeResolution is the resolution with which the timestamps of files
+	// are compared to the parent snapshot. If it is zero, the resolution is
+	// detected for each file system, see fs.TimeResolution.
+	MtimeResolution time.Duration
+
+	// FutureMtime is called for each regular file whose modification time
+	// lies too far in the future. Its modification time cannot be trusted,
+	// the file is therefore read even if it looks unchanged.
+	FutureMtime func(item string, mtime time.Time)
+
+	timeResolutions timeResolutions
 }
 
 // Flags for the ChangeIgnoreFlags bitfield.
@@ -153,6 +181,12 @@ func New(repo restic.Repository, fs fs.FS, opts Options) *Archiver {
 		CompleteItem: func(string, *restic.Node, *restic.Node, ItemStats, time.Duration) {},
 		StartFile:    func(string) {},
 		CompleteBlob: func(uint64) {},
+		FileChanged:  func(string, string) {},
+		FutureMtime:  func(string, time.Time) {},
+
+		CompleteTarget: func(TargetSummary) {},
+
+		ancestors: make(ancestorDirs),
 	}
 
 	return arch
@@ -222,6 +256,17 @@ func (arch *Archiver) SaveDir(ctx context.Context, snPath string, dir string, fi
 		return FutureNode{}, err
 	}
 
+	ancestor, loop, leave := arch.ancestors.enter(dir, fi)
+	if loop {
+		err := errors.Errorf("filesystem loop detected at %v, the directory is the same as %v", dir, ancestor)
+		if err := arch.error(dir, err); err != nil {
+			return FutureNode{}, err
+		}
+		// save an empty directory to mark the loop
+		return arch.treeSaver.Save(ctx, snPath, dir, treeNode, nil, complete), nil
+	}
+	defer leave()
+
 	names, err := readdirnames(arch.FS, dir, fs.O_NOFOLLOW)
 	if err != nil {
 		return FutureNode{}, err
@@ -367,7 +412,13 @@ func (arch *Archiver) Save(ctx context.Context, snPath, target string, previous
 
 		// check if the file has not changed before performing a fopen operation (more expensive, specially
 		// in network filesystems)
-		if previous != nil && !fileChanged(fi, previous, arch.ChangeIgnoreFlags) {
+		reason := changeReason(fi, previous, arch.ChangeIgnoreFlags, arch.timeResolution(target, fi))
+		if reason == "" && mtimeInFuture(fi, time.Now()) {
+			debug.Log("%v has mtime %v in the future", target, fi.ModTime())
+			arch.FutureMtime(snPath, fi.ModTime())
+			reason = "mtime in the future"
+		}
+		if reason == "" {
 			if arch.allBlobsPresent(previous) {
 				debug.Log("%v hasn't changed, using old list of blobs", target)
 				arch.CompleteItem(snPath, previous, previous, ItemStats{}, time.Since(start))
@@ -380,6 +431,11 @@ func (arch *Archiver) Save(ctx context.Context, snPath, target string, previous
 				// copy list of blobs
 				node.Content = previous.Content
 
+				// other hard links to this file can use the same blobs
+				if entry, first := arch.hardlinks.add(fi); first {
+					entry.complete(previous)
+				}
+
 				fn = newFutureNodeWithResult(futureNodeResult{
 					snPath: snPath,
 					target: target,
@@ -395,50 +451,29 @@ func (arch *Archiver) Save(ctx context.Context, snPath, target string, previous
 			if err != nil {
 				return FutureNode{}, false, err
 			}
+			reason = "content missing in the repository"
 		}
 
-		// reopen file and do an fstat() on the open file to check it is still
-		// a file (and has not been exchanged for e.g. a symlink)
-		file, err := arch.FS.OpenFile(target, fs.O_RDONLY|fs.O_NOFOLLOW, 0)
-		if err != nil {
-			debug.Log("Openfile() for %v returned error: %v", target, err)
-			err = arch.error(abstarget, err)
-			if err != nil {
-				return FutureNode{}, false, errors.WithStack(err)
-			}
-			return FutureNode{}, true, nil
+		entry, first := arch.hardlinks.add(fi)
+		if entry != nil && !first {
+			debug.Log("%v is a hard link to a file saved before", target)
+			fn = arch.saveHardlink(ctx, snPath, target, abstarget, fi, previous, reason, entry, start)
+			return fn, false, nil
 		}
 
-		fi, err = file.Stat()
-		if err != nil {
-			debug.Log("stat() on opened file %v returned error: %v", target, err)
-			_ = file.Close()
-			err = arch.error(abstarget, err)
-			if err != nil {
-				return FutureNode{}, false, errors.WithStack(err)
+		arch.FileChanged(snPath, reason)
+		fn, excluded, err = arch.saveFile(ctx, snPath, target, abstarget, func(node *restic.Node, stats ItemStats) {
+			if entry != nil {
+				entry.complete(node)
 			}
-			return FutureNode{}, true, nil
-		}
-
-		// make sure it's still a file
-		if !fs.IsRegularFile(fi) {
-			err = errors.Errorf("file %v changed type, refusing to archive", fi.Name())
-			_ = file.Close()
-			err = arch.error(abstarget, err)
-			if err != nil {
-				return FutureNode{}, false, err
-			}
-			return FutureNode{}, true, nil
-		}
-
-		// Save will close the file, we don't need to do that
-		fn = arch.fileSaver.Save(ctx, snPath, target, file, fi, func() {
-			arch.StartFile(snPath)
-		}, func() {
-			arch.CompleteItem(snPath, nil, nil, ItemStats{}, 0)
-		}, func(node *restic.Node, stats ItemStats) {
 			arch.CompleteItem(snPath, previous, node, stats, time.Since(start))
 		})
+		if err != nil || excluded {
+			if entry != nil {
+				entry.complete(nil)
+			}
+			return FutureNode{}, excluded, err
+		}
 
 	case fi.IsDir():
 		debug.Log("  %v dir", target)
@@ -484,20 +519,115 @@ func (arch *Archiver) Save(ctx context.Context, snPath, target string, previous
 	return fn, false, nil
 }
 
-// fileChanged tries to detect whether a file's content has changed compared
+// saveFile opens the regular file target and queues it for saving. complete
+// is called once the file has been saved or saving it failed.
+func (arch *Archiver) saveFile(ctx context.Context, snPath, target, abstarget string, complete CompleteFunc) (fn FutureNode, excluded bool, err error) {
+	// reopen file and do an fstat() on the open file to check it is still
+	// a file (and has not been exchanged for e.g. a symlink)
+	file, err := arch.FS.OpenFile(target, fs.O_RDONLY|fs.O_NOFOLLOW, 0)
+	if err != nil {
+		debug.Log("Openfile() for %v returned error: %v", target, err)
+		err = arch.error(abstarget, err)
+		if err != nil {
+			return FutureNode{}, false, errors.WithStack(err)
+		}
+		return FutureNode{}, true, nil
+	}
+
+	fi, err := file.Stat()
+	if err != nil {
+		debug.Log("stat() on opened file %v returned error: %v", target, err)
+		_ = file.Close()
+		err = arch.error(abstarget, err)
+		if err != nil {
+			return FutureNode{}, false, errors.WithStack(err)
+		}
+		return FutureNode{}, true, nil
+	}
+
+	// make sure it's still a file
+	if !fs.IsRegularFile(fi) {
+		err = errors.Errorf("file %v changed type, refusing to archive", fi.Name())
+		_ = file.Close()
+		err = arch.error(abstarget, err)
+		if err != nil {
+			return FutureNode{}, false, err
+		}
+		return FutureNode{}, true, nil
+	}
+
+	// Save will close the file, we don't need to do that
+	fn = arch.fileSaver.Save(ctx, snPath, target, file, fi, func() {
+		arch.StartFile(snPath)
+	}, func() {
+		arch.CompleteItem(snPath, nil, nil, ItemStats{}, 0)
+	}, complete)
+	return fn, false, nil
+}
+
+// saveHardlink returns a node for the file target whose content is saved via
+// another hard link to the same file. The node uses the blobs saved for the
+// other hard link without reading the file again, but keeps its own
+// metadata. If saving the other hard link failed, the file is read instead.
+func (arch *Archiver) saveHardlink(ctx context.Context, snPath, target, abstarget string, fi os.FileInfo, previous *restic.Node, reason string, entry *hardlinkEntry, start time.Time) FutureNode {
+	fn, ch := newFutureNode()
+
+	go func() {
+		defer close(ch)
+
+		select {
+		case <-entry.done:
+		case <-ctx.Done():
+			return
+		}
+
+		if entry.content == nil {
+			debug.Log("saving the other hard link of %v failed, reading it", target)
+			arch.FileChanged(snPath, reason)
+			fn, excluded, err := arch.saveFile(ctx, snPath, target, abstarget, func(node *restic.Node, stats ItemStats) {
+				arch.CompleteItem(snPath, previous, node, stats, time.Since(start))
+			})
+			switch {
+			case err != nil:
+				ch <- futureNodeResult{snPath: snPath, target: target, err: err}
+			case !excluded:
+				ch <- fn.take(ctx)
+			}
+			return
+		}
+
+		node, err := arch.nodeFromFileInfo(snPath, target, fi)
+		if err != nil {
+			ch <- futureNodeResult{snPath: snPath, target: target, err: err}
+			return
+		}
+		node.Content = entry.content
+		node.Size = entry.size
+
+		arch.CompleteBlob(node.Size)
+		arch.CompleteItem(snPath, previous, node, ItemStats{}, time.Since(start))
+		ch <- futureNodeResult{snPath: snPath, target: target, node: node}
+	}()
+
+	return fn
+}
+
+// changeReason tries to detect whether a file's content has changed compared
 // to the contents of node, which describes the same path in the parent backup.
-// It should only be run for regular files.
-func fileChanged(fi os.FileInfo, node *restic.Node, ignoreFlags uint) bool {
+// It returns a description of the detected change, or an empty string if the
+// file has not changed. It should only be run for regular files. Timestamps
+// are compared after rounding them down to resolution.
+func changeReason(fi os.FileInfo, node *restic.Node, ignoreFlags uint, resolution time.Duration) string {
 	switch {
 	case node == nil:
-		return true
+		return "not in parent snapshot"
 	case node.Type != "file":
 		// We're only called for regular files, so this is a type change.
-		return true
+		return "type changed"
 	case uint64(fi.Size()) != node.Size:
-		return true
-	case !fi.ModTime().Equal(node.ModTime):
-		return true
+		return "size changed"
+	case !timesEqual(fi.ModTime(), node.ModTime, resolution):
+		return "mtime changed"
 	}
 
 	checkCtime := ignoreFlags&ChangeIgnoreCtime == 0
@@ -505,13 +635,13 @@ func fileChanged(fi os.FileInfo, node *restic.Node, ignoreFlags uint) bool {
 
 	extFI := fs.ExtendedStat(fi)
 	switch {
-	case checkCtime && !extFI.ChangeTime.Equal(node.ChangeTime):
-		return true
+	case checkCtime && !timesEqual(extFI.ChangeTime, node.ChangeTime, resolution):
+		return "ctime changed"
 	case checkInode && node.Inode != extFI.Inode:
-		return true
+		return "inode changed"
 	}
 
-	return false
+	return ""
 }
 
 // join returns all elements separated with a forward slash.
@@ -555,6 +685,11 @@ func (arch *Archiver) SaveTree(ctx context.Context, snPath string, atree *Tree,
 		if err != nil {
 			return FutureNode{}, 0, err
 		}
+
+		// the targets below this directory are saved independent of each
+		// other, thus the directory only helps to detect loops within them
+		_, _, leave := arch.ancestors.enter(atree.FileInfoPath, fi)
+		defer leave()
 	} else {
 		// fake root node
 		node = &restic.Node{}
@@ -681,6 +816,21 @@ type SnapshotOptions struct {
 	Time           time.Time
 	ParentSnapshot *restic.Snapshot
 	ProgramVersion string
+
+	// BackupStart is the time at which the backup was started, it is stored
+	// in the summary of the snapshot. If it is zero, the time at which
+	// Snapshot was called is used.
+	BackupStart time.Time
+
+	// Paths contains the path recorded in the snapshot for each target. The
+	// data is read from the targets, but stored as if it was found at the
+	// paths. If Paths is empty, the targets are recorded.
+	Paths []string
+
+	// Interrupt stops reading new data when it is closed. The data which was
+	// already saved is still flushed to the repository, so that it can be
+	// reused by the next backup, but no snapshot is created.
+	Interrupt <-chan struct{}
 }
 
 // loadParentTree loads a tree referenced by snapshot id. If id is null, nil is returned.
@@ -715,7 +865,12 @@ func (arch *Archiver) runWorkers(ctx context.Context, wg *errgroup.Group) {
 	arch.fileSaver.CompleteBlob = arch.CompleteBlob
 	arch.fileSaver.NodeFromFileInfo = arch.nodeFromFileInfo
 
-	arch.treeSaver = NewTreeSaver(ctx, wg, arch.Options.SaveTreeConcurrency, arch.blobSaver.Save, arch.Error)
+	// hard links cannot be detected reliably without stable inodes
+	if arch.ChangeIgnoreFlags&ChangeIgnoreInode == 0 {
+		arch.hardlinks = newHardlinkIndex()
+	}
+
+	arch.treeSaver = NewTreeSaver(ctx, wg, arch.Options.SaveTreeConcurrency, arch.blobSaver.Save, arch.Error, arch.Repo.Index())
 }
 
 func (arch *Archiver) stopWorkers() {
@@ -725,27 +880,72 @@ func (arch *Archiver) stopWorkers() {
 	arch.blobSaver = nil
 	arch.fileSaver = nil
 	arch.treeSaver = nil
+	arch.hardlinks = nil
 }
 
 // Snapshot saves several targets and returns a snapshot.
 func (arch *Archiver) Snapshot(ctx context.Context, targets []string, opts SnapshotOptions) (*restic.Snapshot, restic.ID, error) {
-	cleanTargets, err := resolveRelativeTargets(arch.FS, targets)
-	if err != nil {
-		return nil, restic.ID{}, err
+	backupStart := opts.BackupStart
+	if backupStart.IsZero() {
+		backupStart = time.Now()
 	}
 
-	atree, err := NewTree(arch.FS, cleanTargets)
-	if err != nil {
-		return nil, restic.ID{}, err
+	var atree *Tree
+	var err error
+	snPaths := targets
+	if len(opts.Paths) > 0 {
+		// the targets are stored at the given paths, relative targets such
+		// as "." must not be replaced by their contents
+		atree, err = NewTreeAs(arch.FS, opts.Paths, targets)
+		if err != nil {
+			return nil, restic.ID{}, err
+		}
+		snPaths = opts.Paths
+	} else {
+		var cleanTargets []string
+		cleanTargets, err = resolveRelativeTargets(arch.FS, targets)
+		if err != nil {
+			return nil, restic.ID{}, err
+		}
+
+		atree, err = NewTree(arch.FS, cleanTargets)
+		if err != nil {
+			return nil, restic.ID{}, err
+		}
 	}
 
+	// count the files saved for each target and for the snapshot summary
+	tracker := newTargetTracker(atree)
+	stats := &summaryTracker{}
+	completeItem := arch.CompleteItem
+	arch.CompleteItem = func(item string, previous, current *restic.Node, s ItemStats, d time.Duration) {
+		tracker.completeItem(item, previous, current)
+		stats.completeItem(previous, current, s)
+		completeItem(item, previous, current, s, d)
+	}
+	defer func() {
+		arch.CompleteItem = completeItem
+	}()
+
 	var rootTreeID restic.ID
 
 	wgUp, wgUpCtx := errgroup.WithContext(ctx)
 	arch.Repo.StartPackUploader(wgUpCtx, wgUp)
 
 	wgUp.Go(func() error {
-		wg, wgCtx := errgroup.WithContext(wgUpCtx)
+		workCtx, cancel := context.WithCancel(wgUpCtx)
+		defer cancel()
+		if opts.Interrupt != nil {
+			go func() {
+				select {
+				case <-opts.Interrupt:
+					cancel()
+				case <-workCtx.Done():
+				}
+			}()
+		}
+
+		wg, wgCtx := errgroup.WithContext(workCtx)
 		start := time.Now()
 
 		wg.Go(func() error {
@@ -782,6 +982,13 @@ func (arch *Archiver) Snapshot(ctx context.Context, targets []string, opts Snaps
 
 		if err != nil {
 			debug.Log("error while saving tree: %v", err)
+			if workCtx.Err() != nil && wgUpCtx.Err() == nil {
+				// interrupted, save the data which was uploaded so far
+				debug.Log("flushing repository after interrupt")
+				if ferr := arch.Repo.Flush(wgUpCtx); ferr != nil {
+					return ferr
+				}
+			}
 			return err
 		}
 
@@ -792,22 +999,32 @@ func (arch *Archiver) Snapshot(ctx context.Context, targets []string, opts Snaps
 		return nil, restic.ID{}, err
 	}
 
-	sn, err := restic.NewSnapshot(targets, opts.Tags, opts.Hostname, opts.Time)
+	sn, err := restic.NewSnapshot(snPaths, opts.Tags, opts.Hostname, opts.Time)
 	if err != nil {
 		return nil, restic.ID{}, err
 	}
 
 	sn.ProgramVersion = opts.ProgramVersion
+	keyID := arch.Repo.KeyID()
+	sn.KeyID = &keyID
 	sn.Excludes = opts.Excludes
 	if opts.ParentSnapshot != nil {
 		sn.Parent = opts.ParentSnapshot.ID()
 	}
 	sn.Tree = &rootTreeID
+	summary := stats.summary
+	summary.BackupStart = backupStart
+	summary.BackupEnd = time.Now()
+	sn.Summary = &summary
 
 	id, err := restic.SaveSnapshot(ctx, arch.Repo, sn)
 	if err != nil {
 		return nil, restic.ID{}, err
 	}
 
+	for _, s := range tracker.summaries {
+		arch.CompleteTarget(s)
+	}
+
 	return sn, id, nil
 }
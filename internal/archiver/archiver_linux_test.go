@@ -0,0 +1,41 @@
+package archiver
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/restic/restic/internal/fs"
+	restictest "github.com/restic/restic/internal/test"
+)
+
+func TestArchiverBindMountLoop(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("bind mounts require root privileges")
+	}
+
+	tempdir := restictest.TempDir(t)
+	TestCreateFiles(t, tempdir, TestDir{
+		"dir": TestDir{
+			"file": TestFile{Content: "foo"},
+			"sub": TestDir{
+				"loop": TestDir{},
+			},
+		},
+	})
+
+	loop := filepath.Join(tempdir, "dir", "sub", "loop")
+	err := syscall.Mount(filepath.Join(tempdir, "dir"), loop, "", syscall.MS_BIND, "")
+	if err != nil {
+		t.Skipf("unable to create bind mount: %v", err)
+	}
+	defer func() {
+		restictest.OK(t, syscall.Unmount(loop, 0))
+	}()
+
+	back := restictest.Chdir(t, tempdir)
+	defer back()
+
+	testArchiverLoop(t, fs.Local{})
+}
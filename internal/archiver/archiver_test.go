@@ -3,7 +3,9 @@ package archiver
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -684,7 +686,7 @@ func TestFileChanged(t *testing.T) {
 			fiBefore := lstat(t, filename)
 			node := nodeFromFI(t, filename, fiBefore)
 
-			if fileChanged(fiBefore, node, 0) {
+			if changeReason(fiBefore, node, 0, 0) != "" {
 				t.Fatalf("unchanged file detected as changed")
 			}
 
@@ -694,12 +696,12 @@ func TestFileChanged(t *testing.T) {
 
 			if test.SameFile {
 				// file should be detected as unchanged
-				if fileChanged(fiAfter, node, test.ChangeIgnore) {
+				if changeReason(fiAfter, node, test.ChangeIgnore, 0) != "" {
 					t.Fatalf("unmodified file detected as changed")
 				}
 			} else {
 				// file should be detected as changed
-				if !fileChanged(fiAfter, node, test.ChangeIgnore) && !test.SameFile {
+				if changeReason(fiAfter, node, test.ChangeIgnore, 0) == "" && !test.SameFile {
 					t.Fatalf("modified file detected as unchanged")
 				}
 			}
@@ -716,8 +718,8 @@ func TestFilChangedSpecialCases(t *testing.T) {
 
 	t.Run("nil-node", func(t *testing.T) {
 		fi := lstat(t, filename)
-		if !fileChanged(fi, nil, 0) {
-			t.Fatal("nil node detected as unchanged")
+		if reason := changeReason(fi, nil, 0, 0); reason != "not in parent snapshot" {
+			t.Fatalf("nil node detected as unchanged or wrong reason %q", reason)
 		}
 	})
 
@@ -725,8 +727,8 @@ func TestFilChangedSpecialCases(t *testing.T) {
 		fi := lstat(t, filename)
 		node := nodeFromFI(t, filename, fi)
 		node.Type = "symlink"
-		if !fileChanged(fi, node, 0) {
-			t.Fatal("node with changed type detected as unchanged")
+		if reason := changeReason(fi, node, 0, 0); reason != "type changed" {
+			t.Fatalf("node with changed type detected as unchanged or wrong reason %q", reason)
 		}
 	})
 }
@@ -1708,6 +1710,44 @@ func TestArchiverParent(t *testing.T) {
 	}
 }
 
+func TestArchiverTreeStats(t *testing.T) {
+	src := TestDir{
+		"foo": TestFile{Content: "foo"},
+		"sub": TestDir{
+			"bar":   TestFile{Content: "barbaz"},
+			"empty": TestDir{},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tempdir, repo := prepareTempdirRepoSrc(t, src)
+	back := restictest.Chdir(t, tempdir)
+	defer back()
+
+	arch := New(repo, fs.Track{FS: fs.Local{}}, Options{})
+	sn, _, err := arch.Snapshot(ctx, []string{"."}, SnapshotOptions{Time: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, ok := repo.Index().LookupTreeStats(*sn.Tree)
+	if !ok {
+		t.Fatal("index lacks statistics for the root tree")
+	}
+	restictest.Equals(t, restic.TreeStats{Entries: 2, Nodes: 4, Size: 9}, stats)
+
+	tree, err := restic.LoadTree(ctx, repo, *sn.Tree)
+	restictest.OK(t, err)
+	sub := tree.Find("sub")
+	stats, ok = repo.Index().LookupTreeStats(*sub.Subtree)
+	if !ok {
+		t.Fatal("index lacks statistics for subtree")
+	}
+	restictest.Equals(t, restic.TreeStats{Entries: 2, Nodes: 2, Size: 6}, stats)
+}
+
 func TestArchiverErrorReporting(t *testing.T) {
 	ignoreErrorForBasename := func(basename string) ErrorFunc {
 		return func(item string, err error) error {
@@ -1899,6 +1939,52 @@ func TestArchiverContextCanceled(t *testing.T) {
 	t.Fatalf("expected error not returned by archiver")
 }
 
+func TestArchiverInterrupt(t *testing.T) {
+	tempdir := restictest.TempDir(t)
+	dir := TestDir{}
+	for i := 0; i < 20; i++ {
+		dir[fmt.Sprintf("file%02d", i)] = TestFile{Content: fmt.Sprintf("content %d", i)}
+	}
+	TestCreateFiles(t, tempdir, dir)
+
+	repo := repository.TestRepository(t)
+
+	back := restictest.Chdir(t, tempdir)
+	defer back()
+
+	interrupt := make(chan struct{})
+	var once sync.Once
+
+	arch := New(repo, fs.Track{FS: fs.Local{}}, Options{})
+	arch.CompleteItem = func(item string, previous, current *restic.Node, s ItemStats, d time.Duration) {
+		if current != nil && current.Type == "file" {
+			once.Do(func() {
+				close(interrupt)
+				// give the archiver time to notice the interrupt
+				time.Sleep(100 * time.Millisecond)
+			})
+		}
+	}
+
+	_, _, err := arch.Snapshot(context.TODO(), []string{"."}, SnapshotOptions{Time: time.Now(), Interrupt: interrupt})
+	if err == nil {
+		t.Fatal("expected error not returned by archiver")
+	}
+
+	// the data saved before the interrupt must have been flushed to the
+	// repository and added to the index
+	var found int
+	for _, item := range dir {
+		id := restic.Hash([]byte(item.(TestFile).Content))
+		if repo.Index().Has(restic.BlobHandle{ID: id, Type: restic.DataBlob}) {
+			found++
+		}
+	}
+	if found == 0 {
+		t.Fatal("no data was saved before the interrupt")
+	}
+}
+
 // TrackFS keeps track which files are opened. For some files, an error is injected.
 type TrackFS struct {
 	fs.FS
@@ -2071,6 +2157,80 @@ func snapshot(t testing.TB, repo restic.Repository, fs fs.FS, parent *restic.Sna
 	return snapshot, node
 }
 
+// ShuffleFS returns directory entries in random order.
+type ShuffleFS struct {
+	fs.FS
+	rnd *rand.Rand
+}
+
+func (fs *ShuffleFS) Open(name string) (fs.File, error) {
+	f, err := fs.FS.Open(name)
+	if err != nil {
+		return f, err
+	}
+	return shuffleFile{File: f, rnd: fs.rnd}, nil
+}
+
+func (fs *ShuffleFS) OpenFile(name string, flags int, perm os.FileMode) (fs.File, error) {
+	f, err := fs.FS.OpenFile(name, flags, perm)
+	if err != nil {
+		return f, err
+	}
+	return shuffleFile{File: f, rnd: fs.rnd}, nil
+}
+
+type shuffleFile struct {
+	fs.File
+	rnd *rand.Rand
+}
+
+func (f shuffleFile) Readdirnames(n int) ([]string, error) {
+	names, err := f.File.Readdirnames(n)
+	f.rnd.Shuffle(len(names), func(i, j int) { names[i], names[j] = names[j], names[i] })
+	return names, err
+}
+
+func (f shuffleFile) Readdir(n int) ([]os.FileInfo, error) {
+	fis, err := f.File.Readdir(n)
+	f.rnd.Shuffle(len(fis), func(i, j int) { fis[i], fis[j] = fis[j], fis[i] })
+	return fis, err
+}
+
+// TestArchiverReproducibleTree checks that backing up unchanged data twice
+// results in the same tree, regardless of the order in which the filesystem
+// returns directory entries.
+func TestArchiverReproducibleTree(t *testing.T) {
+	src := TestDir{
+		"work": TestDir{
+			"b":      TestFile{Content: "file b"},
+			"a":      TestFile{Content: "file a"},
+			"Z":      TestFile{Content: "file Z"},
+			"ä":      TestFile{Content: "umlaut"},
+			"a.txt":  TestFile{Content: "text"},
+			"subdir": TestDir{"x": TestFile{Content: "x"}, "y": TestFile{Content: "y"}, "1": TestDir{}},
+			"link":   TestSymlink{Target: "a"},
+			"empty":  TestDir{},
+		},
+	}
+
+	tempdir, repo := prepareTempdirRepoSrc(t, src)
+	back := restictest.Chdir(t, tempdir)
+	defer back()
+
+	var trees restic.IDs
+	for seed := int64(0); seed < 3; seed++ {
+		testFS := &ShuffleFS{FS: fs.Local{}, rnd: rand.New(rand.NewSource(seed))}
+		sn, _ := snapshot(t, repo, testFS, nil, "work")
+		trees = append(trees, *sn.Tree)
+	}
+
+	for _, id := range trees[1:] {
+		if !id.Equal(trees[0]) {
+			t.Errorf("trees differ: %v", trees)
+		}
+	}
+}
+
 // StatFS allows overwriting what is returned by the Lstat function.
 type StatFS struct {
 	fs.FS
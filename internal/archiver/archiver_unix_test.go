@@ -4,8 +4,19 @@
 package archiver
 
 import (
+	"context"
 	"os"
+	"path/filepath"
+	"strings"
 	"syscall"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	restictest "github.com/restic/restic/internal/test"
 )
 
 type wrappedFileInfo struct {
@@ -39,3 +50,178 @@ func wrapFileInfo(fi os.FileInfo) os.FileInfo {
 
 	return res
 }
+
+// failOpenFS fails to open the file failOpen.
+type failOpenFS struct {
+	fs.FS
+	failOpen string
+}
+
+func (m *failOpenFS) OpenFile(name string, flag int, perm os.FileMode) (fs.File, error) {
+	if name == m.failOpen {
+		return nil, errors.New("injected error")
+	}
+	return m.FS.OpenFile(name, flag, perm)
+}
+
+func TestArchiverHardlinks(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		ignoreFlags uint
+		failOpen    string
+		wantOpen    uint
+		wantFiles   []string
+	}{
+		{"reuse", 0, "", 1, []string{"file", "link", "link"}},
+		{"ignore-inode", ChangeIgnoreCtime | ChangeIgnoreInode, "", 3, []string{"file", "link", "link"}},
+		// the other hard links are read if opening the first one fails
+		{"fail-first", 0, filepath.FromSlash("dir/file"), 3, []string{"link", "link"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			tempdir := restictest.TempDir(t)
+			repo := repository.TestRepository(t)
+
+			restictest.OK(t, os.MkdirAll(filepath.Join(tempdir, "dir", "sub"), 0700))
+			f, err := os.Create(filepath.Join(tempdir, "dir", "file"))
+			restictest.OK(t, err)
+			restictest.OK(t, f.Truncate(100*1024*1024))
+			restictest.OK(t, f.Close())
+			restictest.OK(t, os.Link(filepath.Join(tempdir, "dir", "file"), filepath.Join(tempdir, "dir", "link")))
+			restictest.OK(t, os.Link(filepath.Join(tempdir, "dir", "file"), filepath.Join(tempdir, "dir", "sub", "link")))
+
+			back := restictest.Chdir(t, tempdir)
+			defer back()
+
+			testFS := &TrackFS{
+				FS:     &failOpenFS{FS: fs.Track{FS: fs.Local{}}, failOpen: test.failOpen},
+				opened: make(map[string]uint),
+			}
+			arch := New(repo, testFS, Options{})
+			arch.ChangeIgnoreFlags = test.ignoreFlags
+			arch.Error = func(item string, err error) error {
+				t.Logf("ignoring error for %v: %v", item, err)
+				return nil
+			}
+
+			ctx := context.TODO()
+			sn, _, err := arch.Snapshot(ctx, []string{"dir"}, SnapshotOptions{Time: time.Now()})
+			restictest.OK(t, err)
+
+			var opened uint
+			for _, name := range []string{"dir/file", "dir/link", "dir/sub/link"} {
+				opened += testFS.opened[filepath.FromSlash(name)]
+			}
+			restictest.Equals(t, test.wantOpen, opened)
+
+			// each hard link has its own node with the same content
+			var nodes []*restic.Node
+			var load func(id restic.ID)
+			load = func(id restic.ID) {
+				tree, err := restic.LoadTree(ctx, repo, id)
+				restictest.OK(t, err)
+				for _, node := range tree.Nodes {
+					switch node.Type {
+					case "dir":
+						load(*node.Subtree)
+					case "file":
+						nodes = append(nodes, node)
+					}
+				}
+			}
+			load(*sn.Tree)
+
+			var names []string
+			for _, node := range nodes {
+				restictest.Equals(t, uint64(100*1024*1024), node.Size)
+				restictest.Equals(t, nodes[0].Content, node.Content)
+				restictest.Equals(t, uint64(3), node.Links)
+				names = append(names, node.Name)
+			}
+			restictest.Equals(t, test.wantFiles, names)
+		})
+	}
+}
+
+// loopFS makes the directory loop look like a bind mount of the directory
+// target, which must be a parent directory of loop.
+type loopFS struct {
+	fs.FS
+	loop, target string
+}
+
+func (m *loopFS) resolve(name string) string {
+	for name == m.loop || strings.HasPrefix(name, m.loop+string(filepath.Separator)) {
+		name = m.target + name[len(m.loop):]
+	}
+	return name
+}
+
+func (m *loopFS) Open(name string) (fs.File, error) {
+	return m.FS.Open(m.resolve(name))
+}
+
+func (m *loopFS) OpenFile(name string, flag int, perm os.FileMode) (fs.File, error) {
+	return m.FS.OpenFile(m.resolve(name), flag, perm)
+}
+
+func (m *loopFS) Lstat(name string) (os.FileInfo, error) {
+	return m.FS.Lstat(m.resolve(name))
+}
+
+func (m *loopFS) Stat(name string) (os.FileInfo, error) {
+	return m.FS.Stat(m.resolve(name))
+}
+
+// testArchiverLoop saves the directory "dir" in which "dir/sub/loop" refers
+// to "dir" again and checks that the loop is recorded as an empty directory.
+func testArchiverLoop(t *testing.T, testFS fs.FS) {
+	repo := repository.TestRepository(t)
+	arch := New(repo, testFS, Options{})
+	var errs []string
+	arch.Error = func(item string, err error) error {
+		t.Logf("ignoring error for %v: %v", item, err)
+		errs = append(errs, item)
+		return nil
+	}
+
+	ctx := context.TODO()
+	sn, _, err := arch.Snapshot(ctx, []string{"dir"}, SnapshotOptions{Time: time.Now()})
+	restictest.OK(t, err)
+	restictest.Equals(t, []string{filepath.FromSlash("dir/sub/loop")}, errs)
+
+	TestEnsureTree(ctx, t, "/", repo, *sn.Tree, TestDir{
+		"dir": TestDir{
+			"file": TestFile{Content: "foo"},
+			"sub": TestDir{
+				"loop": TestDir{},
+			},
+		},
+	})
+
+	// without an error handler, the backup fails
+	arch = New(repo, testFS, Options{})
+	_, _, err = arch.Snapshot(ctx, []string{"dir"}, SnapshotOptions{Time: time.Now()})
+	restictest.Assert(t, err != nil && strings.Contains(err.Error(), "filesystem loop detected"),
+		"unexpected error %v", err)
+}
+
+func TestArchiverLoop(t *testing.T) {
+	tempdir := restictest.TempDir(t)
+	TestCreateFiles(t, tempdir, TestDir{
+		"dir": TestDir{
+			"file": TestFile{Content: "foo"},
+			"sub": TestDir{
+				"loop": TestDir{},
+			},
+		},
+	})
+
+	back := restictest.Chdir(t, tempdir)
+	defer back()
+
+	testArchiverLoop(t, &loopFS{
+		FS:     fs.Local{},
+		loop:   filepath.FromSlash("dir/sub/loop"),
+		target: "dir",
+	})
+}
@@ -14,7 +14,9 @@ import (
 	"golang.org/x/sync/errgroup"
 )
 
-// SaveBlobFn saves a blob to a repo.
+// SaveBlobFn saves a blob to a repo. It takes ownership of the buffer and
+// must release it once the data is no longer used, which allows the buffer to
+// be reused for the next chunk.
 type SaveBlobFn func(context.Context, restic.BlobType, *Buffer, func(res SaveBlobResponse))
 
 // FileSaver concurrently saves incoming files to the repo.
@@ -186,12 +188,14 @@ func (s *FileSaver) saveFile(ctx context.Context, chnker *chunker.Chunker, snPat
 		node.Size += uint64(chunk.Length)
 
 		if err != nil {
+			buf.Release()
 			_ = f.Close()
 			completeError(err)
 			return
 		}
 		// test if the context has been cancelled, return the error
 		if ctx.Err() != nil {
+			buf.Release()
 			_ = f.Close()
 			completeError(ctx.Err())
 			return
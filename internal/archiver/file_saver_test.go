@@ -1,12 +1,17 @@
 package archiver
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/restic/chunker"
 	"github.com/restic/restic/internal/fs"
@@ -100,3 +105,120 @@ func TestFileSaver(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func BenchmarkFileSaver(b *testing.B) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	files := createTestFiles(b, 100)
+	wg, ctx := errgroup.WithContext(ctx)
+	saveBlob := func(ctx context.Context, tpe restic.BlobType, buf *Buffer, cb func(SaveBlobResponse)) {
+		cb(SaveBlobResponse{id: restic.Hash(buf.Data), length: len(buf.Data), sizeInRepo: len(buf.Data)})
+		buf.Release()
+	}
+	s := NewFileSaver(ctx, wg, saveBlob, chunker.Pol(0x3DA3358B4DC173), 2, 2)
+	s.NodeFromFileInfo = func(snPath, filename string, fi os.FileInfo) (*restic.Node, error) {
+		return restic.NodeFromFileInfo(filename, fi)
+	}
+
+	noop := func() {}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		filename := files[i%len(files)]
+		f, err := fs.Local{}.Open(filename)
+		if err != nil {
+			b.Fatal(err)
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			b.Fatal(err)
+		}
+		fn := s.Save(ctx, filename, filename, f, fi, noop, noop, nil)
+		if fnr := fn.take(ctx); fnr.err != nil {
+			b.Fatal(fnr.err)
+		}
+	}
+	b.StopTimer()
+
+	s.TriggerShutdown()
+	if err := wg.Wait(); err != nil {
+		b.Fatal(err)
+	}
+}
+
+// TestFileSaverBufferReuse saves files concurrently while the blobs are saved
+// asynchronously and checks that no buffer is reused before it was released.
+func TestFileSaverBufferReuse(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pol := chunker.Pol(0x3DA3358B4DC173)
+	rnd := rand.New(rand.NewSource(23))
+	tempdir := test.TempDir(t)
+	var files []string
+	for i := 0; i < 12; i++ {
+		data := make([]byte, rnd.Intn(3*chunker.MinSize))
+		_, _ = rnd.Read(data)
+		filename := filepath.Join(tempdir, fmt.Sprintf("file-%d", i))
+		test.OK(t, os.WriteFile(filename, data, 0600))
+		files = append(files, filename)
+	}
+
+	wg, ctx := errgroup.WithContext(ctx)
+	var saveWg sync.WaitGroup
+	saveBlob := func(ctx context.Context, tpe restic.BlobType, buf *Buffer, cb func(SaveBlobResponse)) {
+		saveWg.Add(1)
+		go func() {
+			defer saveWg.Done()
+			// hash the data later on, a buffer reused too early results in a wrong ID
+			time.Sleep(time.Duration(rand.Intn(1000)) * time.Microsecond)
+			id := restic.Hash(buf.Data)
+			length := len(buf.Data)
+			buf.Release()
+			cb(SaveBlobResponse{id: id, length: length, sizeInRepo: length})
+		}()
+	}
+	s := NewFileSaver(ctx, wg, saveBlob, pol, 4, 2)
+	s.NodeFromFileInfo = func(snPath, filename string, fi os.FileInfo) (*restic.Node, error) {
+		return restic.NodeFromFileInfo(filename, fi)
+	}
+
+	noop := func() {}
+	var results []FutureNode
+	for _, filename := range files {
+		f, err := fs.Local{}.Open(filename)
+		test.OK(t, err)
+		fi, err := f.Stat()
+		test.OK(t, err)
+		results = append(results, s.Save(ctx, filename, filename, f, fi, noop, noop, nil))
+	}
+
+	for i, fn := range results {
+		fnr := fn.take(ctx)
+		test.OK(t, fnr.err)
+
+		// chunk the file again to get the expected content
+		data, err := os.ReadFile(files[i])
+		test.OK(t, err)
+		var want restic.IDs
+		chnker := chunker.New(bytes.NewReader(data), pol)
+		for {
+			chunk, err := chnker.Next(nil)
+			if err == io.EOF {
+				break
+			}
+			test.OK(t, err)
+			want = append(want, restic.Hash(chunk.Data))
+		}
+		if want == nil {
+			want = restic.IDs{}
+		}
+		test.Equals(t, want, fnr.node.Content)
+		test.Equals(t, uint64(len(data)), fnr.node.Size)
+	}
+
+	s.TriggerShutdown()
+	test.OK(t, wg.Wait())
+	saveWg.Wait()
+}
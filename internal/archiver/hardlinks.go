@@ -0,0 +1,110 @@
+package archiver
+
+import (
+	"os"
+	"sync"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// maxHardlinkEntries limits the number of files with several hard links the
+// hardlinkIndex keeps track of at the same time.
+const maxHardlinkEntries = 100000
+
+// hardlinkKey identifies the content of a file via its inode. Size and
+// modification time are included to detect changes of the content while
+// the backup is running.
+type hardlinkKey struct {
+	device, inode uint64
+	size          int64
+	mtime         int64
+}
+
+// hardlinkEntry holds the content of a file once it has been saved.
+type hardlinkEntry struct {
+	done chan struct{}
+	once sync.Once
+
+	// content is nil if saving the file failed
+	content restic.IDs
+	size    uint64
+
+	// remaining is the number of hard links which have not been seen yet
+	remaining uint64
+}
+
+// complete records the content of the file saved for the first hard link and
+// wakes up all goroutines waiting for it. node is nil if saving the file
+// failed.
+func (e *hardlinkEntry) complete(node *restic.Node) {
+	e.once.Do(func() {
+		if node != nil {
+			e.content = node.Content
+			e.size = node.Size
+		}
+		close(e.done)
+	})
+}
+
+// hardlinkIndex remembers files with several hard links which have been
+// saved during this backup run, so that their content is only read once. A
+// nil index is disabled.
+type hardlinkIndex struct {
+	m       sync.Mutex
+	entries map[hardlinkKey]*hardlinkEntry
+}
+
+func newHardlinkIndex() *hardlinkIndex {
+	return &hardlinkIndex{
+		entries: make(map[hardlinkKey]*hardlinkEntry),
+	}
+}
+
+// add looks up the regular file described by fi. It returns nil if the file
+// has only a single hard link or the index is disabled or full. Otherwise,
+// first reports whether the file was seen for the first time. In that case
+// the caller must save the file and call complete on the entry.
+func (idx *hardlinkIndex) add(fi os.FileInfo) (entry *hardlinkEntry, first bool) {
+	// files from virtual filesystems, e.g. stdin, have no hard links
+	if idx == nil || fi.Sys() == nil {
+		return nil, false
+	}
+
+	extFI := fs.ExtendedStat(fi)
+	if extFI.Links <= 1 || extFI.Inode == 0 {
+		return nil, false
+	}
+
+	key := hardlinkKey{
+		device: extFI.DeviceID,
+		inode:  extFI.Inode,
+		size:   fi.Size(),
+		mtime:  fi.ModTime().UnixNano(),
+	}
+
+	idx.m.Lock()
+	defer idx.m.Unlock()
+
+	entry, ok := idx.entries[key]
+	if !ok {
+		if len(idx.entries) >= maxHardlinkEntries {
+			debug.Log("index is full, not tracking %v", fi.Name())
+			return nil, false
+		}
+		entry = &hardlinkEntry{
+			done:      make(chan struct{}),
+			remaining: extFI.Links,
+		}
+		idx.entries[key] = entry
+	}
+
+	entry.remaining--
+	if entry.remaining == 0 {
+		// all hard links have been seen
+		delete(idx.entries, key)
+	}
+
+	return entry, !ok
+}
@@ -0,0 +1,41 @@
+package archiver
+
+import (
+	"os"
+
+	"github.com/restic/restic/internal/fs"
+)
+
+// dirID identifies a directory via its device and inode.
+type dirID struct {
+	device, inode uint64
+}
+
+// ancestorDirs contains the directories on the path which is currently being
+// saved. A directory which is its own ancestor, e.g. due to a bind mount of a
+// parent directory into its subtree, would otherwise be traversed forever.
+// The filesystem is traversed by a single goroutine, thus no locking is
+// required.
+type ancestorDirs map[dirID]string
+
+// enter records the directory dir described by fi as an ancestor of the items
+// saved next. If the directory is already an ancestor, its path is returned
+// and found is true. Otherwise, leave must be called once dir is complete.
+// Directories without a usable inode, for example on Windows, are ignored.
+func (a ancestorDirs) enter(dir string, fi os.FileInfo) (ancestor string, found bool, leave func()) {
+	leave = func() {}
+	if fi.Sys() == nil {
+		return "", false, leave
+	}
+	extFI := fs.ExtendedStat(fi)
+	if extFI.Inode == 0 {
+		return "", false, leave
+	}
+
+	id := dirID{device: extFI.DeviceID, inode: extFI.Inode}
+	if ancestor, ok := a[id]; ok {
+		return ancestor, true, leave
+	}
+	a[id] = dir
+	return "", false, func() { delete(a, id) }
+}
@@ -5,10 +5,13 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
 	restictest "github.com/restic/restic/internal/test"
 )
 
@@ -319,3 +322,86 @@ func TestScannerCancel(t *testing.T) {
 		t.Errorf("wrong final result, want\n  %#v\ngot:\n  %#v", result, lastStats)
 	}
 }
+
+func TestScannerTotalsMatchArchiver(t *testing.T) {
+	src := TestDir{
+		"other":   TestFile{Content: "another file"},
+		"app.log": TestFile{Content: "excluded by name"},
+		"work": TestDir{
+			"foo":     TestFile{Content: "foo"},
+			"foo.txt": TestFile{Content: "foo text file"},
+			"large":   TestFile{Content: "this file is excluded because of its size"},
+			"cache": TestDir{
+				"data": TestFile{Content: "excluded directory"},
+			},
+			"subdir": TestDir{
+				"other":   TestFile{Content: "other in subdir"},
+				"bar.log": TestFile{Content: "excluded by name in subdir"},
+				"empty":   TestDir{},
+			},
+		},
+	}
+
+	selectByName := func(item string) bool {
+		return filepath.Ext(item) != ".log" && filepath.Base(item) != "cache"
+	}
+	selectFn := func(item string, fi os.FileInfo) bool {
+		return fi.IsDir() || fi.Size() < 20
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tempdir, repo := prepareTempdirRepoSrc(t, src)
+	back := restictest.Chdir(t, tempdir)
+	defer back()
+
+	targets := []string{"."}
+
+	sc := NewScanner(fs.Track{FS: fs.Local{}})
+	sc.SelectByName = selectByName
+	sc.Select = selectFn
+	var total ScanStats
+	sc.Result = func(item string, s ScanStats) {
+		if item == "" {
+			total = s
+		}
+	}
+	if err := sc.Scan(ctx, targets); err != nil {
+		t.Fatal(err)
+	}
+
+	var m sync.Mutex
+	var processed ScanStats
+	arch := New(repo, fs.Track{FS: fs.Local{}}, Options{})
+	arch.SelectByName = selectByName
+	arch.Select = selectFn
+	arch.CompleteItem = func(item string, previous, current *restic.Node, s ItemStats, d time.Duration) {
+		if current == nil {
+			return
+		}
+
+		m.Lock()
+		defer m.Unlock()
+		switch current.Type {
+		case "file":
+			processed.Files++
+			processed.Bytes += current.Size
+		case "dir":
+			processed.Dirs++
+		default:
+			processed.Others++
+		}
+	}
+	if _, _, err := arch.Snapshot(ctx, targets, SnapshotOptions{Time: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := ScanStats{Files: 4, Dirs: 3, Bytes: 43}
+	if !cmp.Equal(want, total) {
+		t.Errorf("unexpected scanner totals: %v", cmp.Diff(want, total))
+	}
+	if !cmp.Equal(total, processed) {
+		t.Errorf("scanner totals differ from the items processed by the archiver: %v", cmp.Diff(total, processed))
+	}
+}
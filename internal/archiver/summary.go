@@ -0,0 +1,55 @@
+package archiver
+
+import (
+	"sync"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+// summaryTracker collects the statistics for the summary stored in a
+// snapshot from the items passed to the CompleteItem callback. It counts the
+// items in the same way as the backup progress reporting.
+type summaryTracker struct {
+	m       sync.Mutex
+	summary restic.SnapshotSummary
+}
+
+func (t *summaryTracker) completeItem(previous, current *restic.Node, s ItemStats) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	t.summary.DataBlobs += s.DataBlobs
+	t.summary.TreeBlobs += s.TreeBlobs
+	t.summary.DataAdded += s.DataSize + s.TreeSize
+	t.summary.DataAddedPacked += s.DataSizeInRepo + s.TreeSizeInRepo
+
+	// for the last item "/" and for files which have only been read so far,
+	// current is nil
+	if current == nil {
+		return
+	}
+	t.summary.TotalBytesProcessed += current.Size
+
+	switch current.Type {
+	case "dir":
+		switch {
+		case previous == nil:
+			t.summary.DirsNew++
+		case previous.Equals(*current):
+			t.summary.DirsUnmodified++
+		default:
+			t.summary.DirsChanged++
+		}
+
+	case "file":
+		t.summary.TotalFilesProcessed++
+		switch {
+		case previous == nil:
+			t.summary.FilesNew++
+		case previous.Equals(*current):
+			t.summary.FilesUnmodified++
+		default:
+			t.summary.FilesChanged++
+		}
+	}
+}
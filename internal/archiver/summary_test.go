@@ -0,0 +1,62 @@
+package archiver
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+	restictest "github.com/restic/restic/internal/test"
+)
+
+func TestArchiverSnapshotSummary(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tempdir, repo := prepareTempdirRepoSrc(t, TestDir{
+		"foo": TestFile{Content: "foo"},
+		"subdir": TestDir{
+			"bar": TestFile{Content: "bar in subdir"},
+		},
+	})
+
+	back := restictest.Chdir(t, tempdir)
+	defer back()
+
+	start := time.Now().Add(-time.Minute)
+	arch := New(repo, fs.Track{FS: fs.Local{}}, Options{})
+	first, _, err := arch.Snapshot(ctx, []string{"."}, SnapshotOptions{Time: time.Now(), BackupStart: start})
+	restictest.OK(t, err)
+
+	summary := first.Summary
+	restictest.Assert(t, summary != nil, "snapshot has no summary")
+	restictest.Assert(t, summary.BackupStart.Equal(start), "wrong backup start %v, want %v", summary.BackupStart, start)
+	restictest.Assert(t, summary.BackupEnd.After(start), "backup end %v is not after start", summary.BackupEnd)
+	restictest.Equals(t, uint(2), summary.FilesNew)
+	restictest.Equals(t, uint(2), summary.TotalFilesProcessed)
+	restictest.Equals(t, uint64(16), summary.TotalBytesProcessed)
+	restictest.Assert(t, summary.DataAdded > 0 && summary.DataAddedPacked > 0, "no data added: %+v", summary)
+
+	restictest.OK(t, os.WriteFile("foo", []byte("foo, but changed"), 0644))
+	second, _, err := arch.Snapshot(ctx, []string{"."}, SnapshotOptions{Time: time.Now(), ParentSnapshot: first})
+	restictest.OK(t, err)
+
+	summary = second.Summary
+	restictest.Assert(t, summary != nil, "snapshot has no summary")
+	restictest.Assert(t, !summary.BackupStart.IsZero(), "backup start not set")
+	restictest.Equals(t, restic.SnapshotSummary{
+		BackupStart:         summary.BackupStart,
+		BackupEnd:           summary.BackupEnd,
+		FilesChanged:        1,
+		FilesUnmodified:     1,
+		DirsUnmodified:      1,
+		DataBlobs:           1,
+		TreeBlobs:           1,
+		DataAdded:           summary.DataAdded,
+		DataAddedPacked:     summary.DataAddedPacked,
+		TotalFilesProcessed: 2,
+		TotalBytesProcessed: 29,
+	}, *summary)
+}
@@ -0,0 +1,102 @@
+package archiver
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+// TargetSummary contains statistics about the items saved for one of the
+// targets passed to Snapshot.
+type TargetSummary struct {
+	// Target is the path of the target in the file system.
+	Target string
+	// Path is the path of the target in the snapshot.
+	Path string
+
+	// Node is the node saved for the target, it is nil if the target was
+	// excluded or could not be read. Previous is the node for the same path
+	// in the parent snapshot, if any.
+	Node, Previous *restic.Node
+
+	// Files is the number of regular files saved for the target, Bytes is
+	// their total size.
+	Files uint
+	Bytes uint64
+}
+
+// Empty returns true if the target is a directory which contains no files.
+func (s TargetSummary) Empty() bool {
+	return s.Node != nil && s.Node.Type == "dir" && s.Files == 0
+}
+
+// DeviceChanged returns true if the target is stored on a different device
+// than recorded in the parent snapshot. This usually means that a file
+// system is no longer, or only now, mounted at the target.
+func (s TargetSummary) DeviceChanged() bool {
+	if s.Node == nil || s.Previous == nil || s.Node.Type != s.Previous.Type {
+		return false
+	}
+	// the device ID is not available on all platforms
+	if s.Node.DeviceID == 0 || s.Previous.DeviceID == 0 {
+		return false
+	}
+	return s.Node.DeviceID != s.Previous.DeviceID
+}
+
+// targetTracker collects the TargetSummary for all targets of a snapshot.
+type targetTracker struct {
+	m         sync.Mutex
+	summaries []TargetSummary
+}
+
+// newTargetTracker returns a tracker for the leaf nodes of atree, which are
+// the targets of the snapshot.
+func newTargetTracker(atree *Tree) *targetTracker {
+	t := &targetTracker{}
+	t.addTargets("/", atree)
+	return t
+}
+
+func (t *targetTracker) addTargets(snPath string, atree *Tree) {
+	for _, name := range atree.NodeNames() {
+		subatree := atree.Nodes[name]
+		if subatree.Leaf() {
+			t.summaries = append(t.summaries, TargetSummary{
+				Target: subatree.Path,
+				Path:   join(snPath, name),
+			})
+			continue
+		}
+		t.addTargets(join(snPath, name), &subatree)
+	}
+}
+
+// completeItem records an item passed to the CompleteItem callback of the
+// archiver.
+func (t *targetTracker) completeItem(item string, previous, current *restic.Node) {
+	if current == nil {
+		return
+	}
+
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	for i := range t.summaries {
+		s := &t.summaries[i]
+
+		// directories are reported with a trailing slash
+		if item == s.Path || item == s.Path+"/" {
+			s.Node, s.Previous = current, previous
+		} else if !strings.HasPrefix(item, strings.TrimSuffix(s.Path, "/")+"/") {
+			continue
+		}
+
+		if current.Type == "file" {
+			s.Files++
+			s.Bytes += current.Size
+		}
+		return
+	}
+}
@@ -0,0 +1,96 @@
+package archiver
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+	restictest "github.com/restic/restic/internal/test"
+)
+
+func TestArchiverCompleteTarget(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tempdir, repo := prepareTempdirRepoSrc(t, TestDir{
+		"empty": TestDir{
+			"subdir": TestDir{},
+		},
+		"excluded": TestDir{
+			"file.log": TestFile{Content: "excluded file"},
+		},
+		"work": TestDir{
+			"foo": TestFile{Content: "foo"},
+			"subdir": TestDir{
+				"bar": TestFile{Content: "bar in subdir"},
+			},
+		},
+		"file": TestFile{Content: "single file"},
+	})
+
+	back := restictest.Chdir(t, tempdir)
+	defer back()
+
+	arch := New(repo, fs.Track{FS: fs.Local{}}, Options{})
+	arch.SelectByName = func(item string) bool {
+		return filepath.Ext(item) != ".log"
+	}
+	var summaries []TargetSummary
+	arch.CompleteTarget = func(s TargetSummary) {
+		summaries = append(summaries, s)
+	}
+
+	targets := []string{"work", "empty", "file", "excluded"}
+	_, _, err := arch.Snapshot(ctx, targets, SnapshotOptions{Time: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		Target, Path, Type string
+		Files              uint
+		Bytes              uint64
+		Empty              bool
+	}
+	var results []result
+	for _, s := range summaries {
+		r := result{Target: s.Target, Path: s.Path, Files: s.Files, Bytes: s.Bytes, Empty: s.Empty()}
+		if s.Node != nil {
+			r.Type = s.Node.Type
+		}
+		results = append(results, r)
+	}
+
+	want := []result{
+		{Target: "empty", Path: "/empty", Type: "dir", Empty: true},
+		{Target: "excluded", Path: "/excluded", Type: "dir", Empty: true},
+		{Target: "file", Path: "/file", Type: "file", Files: 1, Bytes: 11},
+		{Target: "work", Path: "/work", Type: "dir", Files: 2, Bytes: 16},
+	}
+	if !cmp.Equal(want, results) {
+		t.Error(cmp.Diff(want, results))
+	}
+}
+
+func TestTargetSummaryDeviceChanged(t *testing.T) {
+	for _, test := range []struct {
+		node, previous *restic.Node
+		changed        bool
+	}{
+		{&restic.Node{Type: "dir", DeviceID: 1}, &restic.Node{Type: "dir", DeviceID: 1}, false},
+		{&restic.Node{Type: "dir", DeviceID: 1}, &restic.Node{Type: "dir", DeviceID: 2}, true},
+		{&restic.Node{Type: "dir", DeviceID: 1}, nil, false},
+		{nil, &restic.Node{Type: "dir", DeviceID: 2}, false},
+		{&restic.Node{Type: "dir", DeviceID: 1}, &restic.Node{Type: "dir"}, false},
+		{&restic.Node{Type: "dir", DeviceID: 1}, &restic.Node{Type: "file", DeviceID: 2}, false},
+	} {
+		s := TargetSummary{Node: test.node, Previous: test.previous}
+		if s.DeviceChanged() != test.changed {
+			t.Errorf("DeviceChanged() for %v and %v: expected %v", test.node, test.previous, test.changed)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package archiver
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/fs"
+)
+
+// futureMtimeThreshold is how far in the future the modification time of a
+// file may lie before it is considered to be broken.
+const futureMtimeThreshold = 24 * time.Hour
+
+// timeResolutions caches the resolution of the timestamps of each file
+// system, identified by its device ID.
+type timeResolutions struct {
+	m       sync.Mutex
+	devices map[uint64]time.Duration
+}
+
+// get returns the resolution of the timestamps of the file system which
+// contains the file at path. Zero is returned if the file system is unknown.
+func (r *timeResolutions) get(path string, fi os.FileInfo) time.Duration {
+	device, err := fs.DeviceID(fi)
+	if err != nil {
+		return 0
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+	res, ok := r.devices[device]
+	if !ok {
+		res = fs.TimeResolution(path)
+		debug.Log("resolution of timestamps on device %v (%v): %v", device, path, res)
+		if r.devices == nil {
+			r.devices = make(map[uint64]time.Duration)
+		}
+		r.devices[device] = res
+	}
+	return res
+}
+
+// timeResolution returns the resolution with which the timestamps of the file
+// at path are compared to the parent snapshot.
+func (arch *Archiver) timeResolution(path string, fi os.FileInfo) time.Duration {
+	if arch.MtimeResolution != 0 {
+		return arch.MtimeResolution
+	}
+	return arch.timeResolutions.get(path, fi)
+}
+
+// timesEqual returns true if a and b are equal after rounding both down to
+// resolution. A resolution of zero compares the exact times.
+func timesEqual(a, b time.Time, resolution time.Duration) bool {
+	if resolution <= 0 {
+		return a.Equal(b)
+	}
+	return a.Truncate(resolution).Equal(b.Truncate(resolution))
+}
+
+// mtimeInFuture returns true if the modification time of fi lies more than
+// futureMtimeThreshold after now.
+func mtimeInFuture(fi os.FileInfo, now time.Time) bool {
+	return fi.ModTime().After(now.Add(futureMtimeThreshold))
+}
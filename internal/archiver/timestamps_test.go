@@ -0,0 +1,158 @@
+package archiver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+	restictest "github.com/restic/restic/internal/test"
+)
+
+// mtimeFileInfo overrides the modification time of a file.
+type mtimeFileInfo struct {
+	os.FileInfo
+	mtime time.Time
+}
+
+func (fi mtimeFileInfo) ModTime() time.Time {
+	return fi.mtime
+}
+
+func TestTimesEqual(t *testing.T) {
+	base := time.Date(2023, 5, 1, 10, 0, 1, 500000000, time.UTC)
+
+	for _, test := range []struct {
+		a, b       time.Time
+		resolution time.Duration
+		equal      bool
+	}{
+		{base, base, 0, true},
+		{base, base.Add(time.Nanosecond), 0, false},
+		{base, base.Truncate(2 * time.Second), 0, false},
+		{base, base.Truncate(2 * time.Second), 2 * time.Second, true},
+		{base, base.Truncate(time.Second), 2 * time.Second, true},
+		{base, base.Add(time.Second), 2 * time.Second, false},
+		{base, base.Add(-2 * time.Second), 2 * time.Second, false},
+		{base, base.Truncate(10 * time.Millisecond), 10 * time.Millisecond, true},
+	} {
+		if timesEqual(test.a, test.b, test.resolution) != test.equal {
+			t.Errorf("timesEqual(%v, %v, %v) != %v", test.a, test.b, test.resolution, test.equal)
+		}
+	}
+}
+
+func TestFileChangedResolution(t *testing.T) {
+	tempdir := restictest.TempDir(t)
+	filename := filepath.Join(tempdir, "file")
+	save(t, filename, []byte("foobar"))
+	mtime := time.Date(2023, 5, 1, 10, 0, 1, 500000000, time.Local)
+	setTimestamp(t, filename, mtime, mtime)
+
+	fi := lstat(t, filename)
+	node := nodeFromFI(t, filename, fi)
+
+	// the file system truncates the modification time to two seconds
+	truncated := mtimeFileInfo{FileInfo: fi, mtime: mtime.Truncate(2 * time.Second)}
+	if reason := changeReason(truncated, node, 0, 0); reason != "mtime changed" {
+		t.Fatalf("truncated mtime not detected without resolution, reason %q", reason)
+	}
+	if reason := changeReason(truncated, node, 0, 2*time.Second); reason != "" {
+		t.Fatalf("truncated mtime detected as change: %q", reason)
+	}
+
+	// larger differences are still detected
+	later := mtimeFileInfo{FileInfo: fi, mtime: mtime.Add(2 * time.Second)}
+	if reason := changeReason(later, node, 0, 2*time.Second); reason != "mtime changed" {
+		t.Fatalf("changed mtime not detected, reason %q", reason)
+	}
+}
+
+// testSnapshotRead creates a snapshot of filename using arch and returns the
+// snapshot and the number of bytes read from the file.
+func testSnapshotRead(t testing.TB, arch *Archiver, testFS *MockFS, filename string, parent *restic.Snapshot) (*restic.Snapshot, int) {
+	before := testFS.bytesRead[filename]
+	sn, _, err := arch.Snapshot(context.TODO(), []string{filename}, SnapshotOptions{Time: time.Now(), ParentSnapshot: parent})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sn, testFS.bytesRead[filename] - before
+}
+
+func TestArchiverMtimeResolution(t *testing.T) {
+	content := "foo bar test file"
+	tempdir, repo := prepareTempdirRepoSrc(t, TestDir{"testfile": TestFile{Content: content}})
+	back := restictest.Chdir(t, tempdir)
+	defer back()
+
+	mtime := time.Date(2023, 5, 1, 10, 0, 1, 500000000, time.Local)
+	setTimestamp(t, "testfile", mtime, mtime)
+
+	testFS := &MockFS{FS: fs.Local{}, bytesRead: make(map[string]int)}
+	parent, n := testSnapshotRead(t, New(repo, testFS, Options{}), testFS, "testfile", nil)
+	restictest.Equals(t, len(content), n)
+
+	// the stat result differs from the stored node below the resolution
+	fi := lstat(t, "testfile")
+	testFS.FS = &StatFS{
+		FS: fs.Local{},
+		OverrideLstat: map[string]os.FileInfo{
+			"testfile": mtimeFileInfo{FileInfo: fi, mtime: mtime.Truncate(2 * time.Second)},
+		},
+	}
+
+	arch := New(repo, testFS, Options{})
+	arch.MtimeResolution = 2 * time.Second
+	var changed []string
+	arch.FileChanged = func(item, reason string) {
+		changed = append(changed, reason)
+	}
+	_, n = testSnapshotRead(t, arch, testFS, "testfile", parent)
+	restictest.Equals(t, 0, n)
+	restictest.Equals(t, []string(nil), changed)
+
+	// with exact timestamps the file is read again
+	arch.MtimeResolution = time.Nanosecond
+	_, n = testSnapshotRead(t, arch, testFS, "testfile", parent)
+	restictest.Equals(t, len(content), n)
+	restictest.Equals(t, []string{"mtime changed"}, changed)
+}
+
+func TestArchiverFutureMtime(t *testing.T) {
+	content := "foo bar test file"
+	tempdir, repo := prepareTempdirRepoSrc(t, TestDir{"testfile": TestFile{Content: content}})
+	back := restictest.Chdir(t, tempdir)
+	defer back()
+
+	testFS := &MockFS{FS: fs.Local{}, bytesRead: make(map[string]int)}
+	arch := New(repo, testFS, Options{})
+	var future []string
+	arch.FutureMtime = func(item string, _ time.Time) {
+		future = append(future, item)
+	}
+	var changed []string
+	arch.FileChanged = func(item, reason string) {
+		changed = append(changed, reason)
+	}
+
+	// the file looks unchanged, but its mtime cannot be trusted
+	mtime := time.Now().Add(2 * futureMtimeThreshold)
+	setTimestamp(t, "testfile", mtime, mtime)
+	parent, n := testSnapshotRead(t, arch, testFS, "testfile", nil)
+	restictest.Equals(t, len(content), n)
+	_, n = testSnapshotRead(t, arch, testFS, "testfile", parent)
+	restictest.Equals(t, len(content), n)
+	restictest.Equals(t, []string{"not in parent snapshot", "mtime in the future"}, changed)
+	restictest.Equals(t, 1, len(future))
+
+	// a slightly wrong clock is tolerated
+	mtime = time.Now().Add(futureMtimeThreshold / 2)
+	setTimestamp(t, "testfile", mtime, mtime)
+	parent, _ = testSnapshotRead(t, arch, testFS, "testfile", parent)
+	_, n = testSnapshotRead(t, arch, testFS, "testfile", parent)
+	restictest.Equals(t, 0, n)
+	restictest.Equals(t, 1, len(future))
+}
@@ -96,7 +96,14 @@ func rootDirectory(fs fs.FS, target string) string {
 
 // Add adds a new file or directory to the tree.
 func (t *Tree) Add(fs fs.FS, path string) error {
-	if path == "" {
+	return t.AddAs(fs, path, path)
+}
+
+// AddAs adds the file or directory target to the tree at the location given
+// by path. If path differs from target, the metadata of the intermediate
+// directories is read from the parent directories of target.
+func (t *Tree) AddAs(fs fs.FS, path, target string) error {
+	if path == "" || target == "" {
 		panic("invalid path (empty string)")
 	}
 
@@ -132,27 +139,42 @@ func (t *Tree) Add(fs fs.FS, path string) error {
 		continue
 	}
 
-	if len(pc) > 1 {
-		subroot := fs.Join(root, origName)
+	// dirs contains the directory the metadata for each element of pc is read from
+	dirs := make([]string, len(pc))
+	if path == target {
+		dirs[0] = fs.Join(root, origName)
 		if virtualPrefix {
 			// use the original root dir if this is a virtual directory (volume name on Windows)
-			subroot = root
+			dirs[0] = root
+		}
+		for i := 1; i < len(pc); i++ {
+			dirs[i] = fs.Join(dirs[i-1], pc[i])
 		}
-		err := tree.add(fs, path, subroot, pc[1:])
+	} else {
+		dir := target
+		for i := len(pc) - 1; i >= 0; i-- {
+			dirs[i] = dir
+			dir = fs.Dir(dir)
+		}
+	}
+
+	if len(pc) > 1 {
+		err := tree.add(fs, target, pc[1:], dirs[1:])
 		if err != nil {
 			return err
 		}
-		tree.FileInfoPath = subroot
+		tree.FileInfoPath = dirs[0]
 	} else {
-		tree.Path = path
+		tree.Path = target
 	}
 
 	t.Nodes[name] = tree
 	return nil
 }
 
-// add adds a new target path into the tree.
-func (t *Tree) add(fs fs.FS, target, root string, pc []string) error {
+// add adds a new target path into the tree. dirs contains the directories
+// the metadata for the elements of pc is read from.
+func (t *Tree) add(fs fs.FS, target string, pc, dirs []string) error {
 	if len(pc) == 0 {
 		return errors.Errorf("invalid path %q", target)
 	}
@@ -184,10 +206,9 @@ func (t *Tree) add(fs fs.FS, target, root string, pc []string) error {
 		tree = other
 	}
 
-	subroot := fs.Join(root, name)
-	tree.FileInfoPath = subroot
+	tree.FileInfoPath = dirs[0]
 
-	err := tree.add(fs, target, subroot, pc[1:])
+	err := tree.add(fs, target, pc[1:], dirs[1:])
 	if err != nil {
 		return err
 	}
@@ -271,19 +292,33 @@ func unrollTree(f fs.FS, t *Tree) error {
 
 // NewTree creates a Tree from the target files/directories.
 func NewTree(fs fs.FS, targets []string) (*Tree, error) {
-	debug.Log("targets: %v", targets)
+	return NewTreeAs(fs, targets, targets)
+}
+
+// NewTreeAs creates a Tree from the target files/directories, which are
+// stored at the corresponding element of paths.
+func NewTreeAs(fs fs.FS, paths, targets []string) (*Tree, error) {
+	debug.Log("targets: %v, paths %v", targets, paths)
+	if len(paths) != len(targets) {
+		return nil, errors.Errorf("got %d paths for %d targets", len(paths), len(targets))
+	}
+
 	tree := &Tree{}
 	seen := make(map[string]struct{})
-	for _, target := range targets {
+	for i, target := range targets {
 		target = fs.Clean(target)
+		path := fs.Clean(paths[i])
 
 		// skip duplicate targets
-		if _, ok := seen[target]; ok {
-			continue
+		if _, ok := seen[path]; ok {
+			if path == target {
+				continue
+			}
+			return nil, errors.Errorf("path %v is used for more than one target", path)
 		}
-		seen[target] = struct{}{}
+		seen[path] = struct{}{}
 
-		err := tree.Add(fs, target)
+		err := tree.AddAs(fs, path, target)
 		if err != nil {
 			return nil, err
 		}
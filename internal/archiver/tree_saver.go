@@ -13,19 +13,22 @@ import (
 type TreeSaver struct {
 	saveBlob func(ctx context.Context, t restic.BlobType, buf *Buffer, cb func(res SaveBlobResponse))
 	errFn    ErrorFunc
+	idx      restic.MasterIndex
 
 	ch chan<- saveTreeJob
 }
 
 // NewTreeSaver returns a new tree saver. A worker pool with treeWorkers is
-// started, it is stopped when ctx is cancelled.
-func NewTreeSaver(ctx context.Context, wg *errgroup.Group, treeWorkers uint, saveBlob func(ctx context.Context, t restic.BlobType, buf *Buffer, cb func(res SaveBlobResponse)), errFn ErrorFunc) *TreeSaver {
+// started, it is stopped when ctx is cancelled. If idx is not nil, the
+// statistics of the saved trees are recorded in the index.
+func NewTreeSaver(ctx context.Context, wg *errgroup.Group, treeWorkers uint, saveBlob func(ctx context.Context, t restic.BlobType, buf *Buffer, cb func(res SaveBlobResponse)), errFn ErrorFunc, idx restic.MasterIndex) *TreeSaver {
 	ch := make(chan saveTreeJob)
 
 	s := &TreeSaver{
 		ch:       ch,
 		saveBlob: saveBlob,
 		errFn:    errFn,
+		idx:      idx,
 	}
 
 	for i := uint(0); i < treeWorkers; i++ {
@@ -81,6 +84,7 @@ func (s *TreeSaver) save(ctx context.Context, job *saveTreeJob) (*restic.Node, I
 
 	builder := restic.NewTreeJSONBuilder()
 	var lastNode *restic.Node
+	var treeNodes []*restic.Node
 
 	for i, fn := range nodes {
 		// fn is a copy, so clear the original value explicitly
@@ -106,7 +110,9 @@ func (s *TreeSaver) save(ctx context.Context, job *saveTreeJob) (*restic.Node, I
 		}
 
 		err := builder.AddNode(fnr.node)
-		if err != nil && errors.Is(err, restic.ErrTreeNotOrdered) && lastNode != nil && fnr.node.Equals(*lastNode) {
+		if err == nil {
+			treeNodes = append(treeNodes, fnr.node)
+		} else if errors.Is(err, restic.ErrTreeNotOrdered) && lastNode != nil && fnr.node.Equals(*lastNode) {
 			debug.Log("insert %v failed: %v", fnr.node.Name, err)
 			// ignore error if an _identical_ node already exists, but nevertheless issue a warning
 			_ = s.errFn(fnr.target, err)
@@ -124,6 +130,12 @@ func (s *TreeSaver) save(ctx context.Context, job *saveTreeJob) (*restic.Node, I
 		return nil, stats, err
 	}
 
+	if s.idx != nil {
+		if treeStats, ok := restic.ComputeTreeStats(treeNodes, s.idx.LookupTreeStats); ok {
+			s.idx.AddTreeStats(restic.Hash(buf), treeStats)
+		}
+	}
+
 	b := &Buffer{Data: buf}
 	ch := make(chan SaveBlobResponse, 1)
 	s.saveBlob(ctx, restic.TreeBlob, b, func(res SaveBlobResponse) {
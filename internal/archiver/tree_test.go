@@ -464,3 +464,78 @@ func TestTree(t *testing.T) {
 		})
 	}
 }
+
+func TestTreeAs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skip test on windows")
+	}
+
+	var tests = []struct {
+		paths     []string
+		targets   []string
+		want      Tree
+		mustError bool
+	}{
+		{
+			paths:   []string{"/home"},
+			targets: []string{"/mnt/snap/home"},
+			want: Tree{Nodes: map[string]Tree{
+				"home": {Path: "/mnt/snap/home", Root: "/"},
+			}},
+		},
+		{
+			// intermediate directories use the metadata of the parent
+			// directories of the target
+			paths:   []string{"/home/user1", "/srv"},
+			targets: []string{"/mnt/snap/home/user1", "/mnt/other"},
+			want: Tree{Nodes: map[string]Tree{
+				"home": {Root: "/", FileInfoPath: "/mnt/snap/home", Nodes: map[string]Tree{
+					"user1": {Path: "/mnt/snap/home/user1"},
+				}},
+				"srv": {Path: "/mnt/other", Root: "/"},
+			}},
+		},
+		{
+			paths:   []string{"/home/user1/work"},
+			targets: []string{"/data"},
+			want: Tree{Nodes: map[string]Tree{
+				"home": {Root: "/", FileInfoPath: "/", Nodes: map[string]Tree{
+					"user1": {FileInfoPath: "/", Nodes: map[string]Tree{
+						"work": {Path: "/data"},
+					}},
+				}},
+			}},
+		},
+		{
+			paths:     []string{"/home", "/home"},
+			targets:   []string{"/mnt/snap1/home", "/mnt/snap2/home"},
+			mustError: true,
+		},
+		{
+			paths:     []string{"/home"},
+			targets:   []string{"/mnt/snap1/home", "/mnt/snap2/home"},
+			mustError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			tree, err := NewTreeAs(fs.Local{}, test.paths, test.targets)
+			if test.mustError {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				t.Logf("found expected error: %v", err)
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !cmp.Equal(&test.want, tree) {
+				t.Error(cmp.Diff(&test.want, tree))
+			}
+		})
+	}
+}
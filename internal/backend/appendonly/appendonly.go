@@ -0,0 +1,66 @@
+// Package appendonly implements a backend wrapper which refuses to remove or
+// overwrite files, except for lock files.
+package appendonly
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// ErrAppendOnly is returned for operations which would remove or overwrite
+// files.
+var ErrAppendOnly = errors.New("not allowed in append-only mode")
+
+// Backend rejects all operations which remove or overwrite files.
+type Backend struct {
+	restic.Backend
+}
+
+// statically ensure that Backend implements restic.Backend.
+var _ restic.Backend = &Backend{}
+
+// New returns a backend which allows only to add new files to be.
+func New(be restic.Backend) *Backend {
+	return &Backend{Backend: be}
+}
+
+// reject returns a permanent error, retrying the operation is pointless.
+func reject(op string, h restic.Handle) error {
+	return backoff.Permanent(fmt.Errorf("%v %v: %w", op, h, ErrAppendOnly))
+}
+
+// Save stores the data in the backend, unless the file already exists.
+func (be *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	if h.Type != restic.LockFile {
+		_, err := be.Backend.Stat(ctx, h)
+		if err == nil {
+			return reject("overwriting", h)
+		}
+		if !be.Backend.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return be.Backend.Save(ctx, h, rd)
+}
+
+// Remove removes lock files, all other files are kept.
+func (be *Backend) Remove(ctx context.Context, h restic.Handle) error {
+	if h.Type != restic.LockFile {
+		return reject("removing", h)
+	}
+	return be.Backend.Remove(ctx, h)
+}
+
+// Delete refuses to remove the repository.
+func (be *Backend) Delete(_ context.Context) error {
+	return backoff.Permanent(fmt.Errorf("deleting the repository: %w", ErrAppendOnly))
+}
+
+func (be *Backend) Unwrap() restic.Backend {
+	return be.Backend
+}
@@ -0,0 +1,44 @@
+package appendonly_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/restic/restic/internal/backend/appendonly"
+	"github.com/restic/restic/internal/backend/mem"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func save(be restic.Backend, h restic.Handle, data []byte) error {
+	return be.Save(context.TODO(), h, restic.NewByteReader(data, be.Hasher()))
+}
+
+func TestAppendOnly(t *testing.T) {
+	mbe := mem.New()
+	be := appendonly.New(mbe)
+
+	data := rtest.Random(23, 100)
+	for _, tpe := range []restic.FileType{restic.PackFile, restic.IndexFile, restic.SnapshotFile, restic.KeyFile, restic.LockFile} {
+		h := restic.Handle{Type: tpe, Name: restic.Hash(data).String()}
+		rtest.OK(t, save(be, h, data))
+
+		if tpe == restic.LockFile {
+			// lock files can be removed
+			rtest.OK(t, be.Remove(context.TODO(), h))
+			continue
+		}
+
+		err := save(be, h, data)
+		rtest.Assert(t, errors.Is(err, appendonly.ErrAppendOnly), "unexpected error for overwriting %v: %v", h, err)
+		err = be.Remove(context.TODO(), h)
+		rtest.Assert(t, errors.Is(err, appendonly.ErrAppendOnly), "unexpected error for removing %v: %v", h, err)
+
+		_, err = mbe.Stat(context.TODO(), h)
+		rtest.OK(t, err)
+	}
+
+	err := be.Delete(context.TODO())
+	rtest.Assert(t, errors.Is(err, appendonly.ErrAppendOnly), "unexpected error for deleting the repository: %v", err)
+}
@@ -191,6 +191,12 @@ func (be *Backend) HasAtomicReplace() bool {
 	return true
 }
 
+// HasAtomicSave returns true, blobs only become visible once the upload or
+// the final block list has been committed.
+func (be *Backend) HasAtomicSave() bool {
+	return true
+}
+
 // Path returns the path in the bucket that is used for this backend.
 func (be *Backend) Path() string {
 	return be.prefix
@@ -20,7 +20,7 @@ type Config struct {
 	Container      string
 	Prefix         string
 
-	Connections uint `option:"connections" help:"set a limit for the number of concurrent connections (default: 5)"`
+	Connections uint `option:"connections" help:"set a limit for the number of concurrent connections"`
 }
 
 // NewConfig returns a new Config with the default values filled in.
@@ -31,7 +31,7 @@ func NewConfig() Config {
 }
 
 func init() {
-	options.Register("azure", Config{})
+	options.Register("azure", NewConfig())
 }
 
 // ParseConfig parses the string s and extracts the azure config. The
@@ -174,6 +174,12 @@ func (be *b2Backend) HasAtomicReplace() bool {
 	return true
 }
 
+// HasAtomicSave returns true, files only become visible once the upload has
+// completed.
+func (be *b2Backend) HasAtomicSave() bool {
+	return true
+}
+
 // IsNotExist returns true if the error is caused by a non-existing file.
 func (be *b2Backend) IsNotExist(err error) bool {
 	// blazer/b2 does not export its error types and values,
@@ -220,7 +226,8 @@ func (be *b2Backend) Save(ctx context.Context, h restic.Handle, rd restic.Rewind
 	name := be.Filename(h)
 	obj := be.bucket.Object(name)
 
-	// b2 always requires sha1 checksums for uploaded file parts
+	// b2 always requires sha1 checksums for uploaded file parts, these are
+	// verified by the server
 	w := obj.NewWriter(ctx)
 	n, err := io.Copy(w, rd)
 
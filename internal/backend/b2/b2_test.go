@@ -1,13 +1,24 @@
 package b2_test
 
 import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"path"
 	"testing"
 	"time"
 
 	"github.com/restic/restic/internal/backend/b2"
 	"github.com/restic/restic/internal/backend/test"
+	"github.com/restic/restic/internal/options"
+	"github.com/restic/restic/internal/restic"
 
 	rtest "github.com/restic/restic/internal/test"
 )
@@ -66,3 +77,109 @@ func BenchmarkBackendb2(t *testing.B) {
 	testVars(t)
 	newB2TestSuite().RunBenchmarks(t)
 }
+
+// fakeB2 implements the parts of the B2 API needed to upload a file. It
+// records the SHA1 hashes sent with the uploads and the number of requests for
+// file information.
+type fakeB2 struct {
+	srv       *httptest.Server
+	uploads   int
+	sha1      []string
+	fileInfos int
+}
+
+func newFakeB2(t testing.TB) *fakeB2 {
+	f := &fakeB2{}
+	f.srv = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(f.srv.Close)
+	return f
+}
+
+func (f *fakeB2) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	var resp interface{}
+
+	switch path.Base(r.URL.Path) {
+	case "b2_authorize_account":
+		resp = map[string]interface{}{
+			"accountId":               "account",
+			"authorizationToken":      "token",
+			"apiUrl":                  f.srv.URL,
+			"downloadUrl":             f.srv.URL,
+			"recommendedPartSize":     100 * 1000 * 1000,
+			"absoluteMinimumPartSize": 5 * 1000 * 1000,
+		}
+	case "b2_list_buckets":
+		resp = map[string]interface{}{
+			"buckets": []map[string]interface{}{
+				{"bucketId": "bucket-id", "bucketName": "bucket", "bucketType": "allPrivate"},
+			},
+		}
+	case "b2_get_upload_url":
+		resp = map[string]interface{}{
+			"uploadUrl":          f.srv.URL + "/upload",
+			"authorizationToken": "token",
+		}
+	case "upload":
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		f.uploads++
+		f.sha1 = append(f.sha1, r.Header.Get("X-Bz-Content-Sha1"))
+
+		sum := sha1.Sum(data)
+		resp = map[string]interface{}{
+			"fileId":        "file-id",
+			"fileName":      r.Header.Get("X-Bz-File-Name"),
+			"bucketId":      "bucket-id",
+			"contentLength": len(data),
+			"contentSha1":   hex.EncodeToString(sum[:]),
+			"action":        "upload",
+		}
+	case "b2_get_file_info":
+		f.fileInfos++
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// RoundTrip sends all requests to the fake server.
+func (f *fakeB2) RoundTrip(req *http.Request) (*http.Response, error) {
+	u, err := url.Parse(f.srv.URL)
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.URL.Scheme = u.Scheme
+	req.URL.Host = u.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestSaveSendsChecksum(t *testing.T) {
+	f := newFakeB2(t)
+
+	cfg, err := b2.ParseConfig("b2:bucket:prefix")
+	rtest.OK(t, err)
+	cfg.AccountID = "account"
+	cfg.Key = options.NewSecretString("key")
+
+	be, err := b2.Open(context.TODO(), *cfg, f)
+	rtest.OK(t, err)
+
+	data := rtest.Random(23, 1000)
+	h := restic.Handle{Type: restic.PackFile, Name: restic.Hash(data).String()}
+	rtest.OK(t, be.Save(context.TODO(), h, restic.NewByteReader(data, be.Hasher())))
+
+	// the server verifies the checksum, no additional request is necessary
+	sum := sha1.Sum(data)
+	rtest.Equals(t, 1, f.uploads)
+	rtest.Equals(t, []string{hex.EncodeToString(sum[:])}, f.sha1)
+	rtest.Equals(t, 0, f.fileInfos)
+}
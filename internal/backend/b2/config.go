@@ -19,7 +19,7 @@ type Config struct {
 	Bucket    string
 	Prefix    string
 
-	Connections uint `option:"connections" help:"set a limit for the number of concurrent connections (default: 5)"`
+	Connections uint `option:"connections" help:"set a limit for the number of concurrent connections"`
 }
 
 // NewConfig returns a new config with default options applied.
@@ -30,7 +30,7 @@ func NewConfig() Config {
 }
 
 func init() {
-	options.Register("b2", Config{})
+	options.Register("b2", NewConfig())
 }
 
 var bucketName = regexp.MustCompile("^[a-zA-Z0-9-]+$")
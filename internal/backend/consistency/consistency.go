@@ -0,0 +1,160 @@
+// Package consistency implements a probe which detects backends whose
+// listings or reads lag behind writes and removals.
+package consistency
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/options"
+	"github.com/restic/restic/internal/restic"
+)
+
+// Config contains the consistency options of the backend.
+type Config struct {
+	ConsistencyDelay time.Duration `option:"consistency-delay" help:"wait up to this duration for a file to show up in listings before concluding that it was removed, e.g. for a lock"`
+}
+
+func init() {
+	options.Register("backend", Config{})
+}
+
+// minProbeTimeout is the minimum duration the probe waits for changes to show
+// up in listings.
+const minProbeTimeout = 10 * time.Second
+
+// pollInterval is the delay between two listings while the probe waits for
+// changes to show up.
+var pollInterval = 100 * time.Millisecond
+
+// Result describes the behavior of the backend observed by Probe.
+type Result struct {
+	// ListDelay is the time until a new file showed up in listings.
+	ListDelay time.Duration
+	// RemoveDelay is the time until a removed file vanished from listings.
+	RemoveDelay time.Duration
+	// Anomalies describes all deviations from a consistent backend.
+	Anomalies []string
+}
+
+func (r *Result) addAnomaly(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	debug.Log("anomaly: %v", msg)
+	r.Anomalies = append(r.Anomalies, msg)
+}
+
+// Probe saves an empty lock file to the backend and checks that it can be
+// accessed immediately using Stat, Load and List. Afterwards the file is
+// removed and it is checked that it vanishes from listings. Changes which do
+// not show up in listings immediately are waited for up to timeout, but at
+// least ten seconds. All clients ignore empty lock files, thus the probe does
+// not interfere with other clients, even if removing it fails.
+func Probe(ctx context.Context, be restic.Backend, timeout time.Duration) (res Result, err error) {
+	if timeout < minProbeTimeout {
+		timeout = minProbeTimeout
+	}
+
+	h := restic.Handle{Type: restic.LockFile, Name: restic.NewRandomID().String()}
+	debug.Log("saving probe %v", h)
+	if err := be.Save(ctx, h, restic.NewByteReader(nil, be.Hasher())); err != nil {
+		return Result{}, errors.Wrap(err, "saving probe")
+	}
+
+	removed := false
+	defer func() {
+		if removed {
+			return
+		}
+		// the probe must be removed even if ctx was canceled
+		if rerr := be.Remove(context.Background(), h); rerr != nil && err == nil {
+			err = errors.Wrap(rerr, "removing probe")
+		}
+	}()
+
+	fi, err := be.Stat(ctx, h)
+	if err != nil {
+		res.addAnomaly("Stat of a new file failed: %v", err)
+	} else if fi.Size != 0 {
+		res.addAnomaly("Stat of a new empty file returned size %d", fi.Size)
+	}
+
+	var size int64
+	err = be.Load(ctx, h, 0, 0, func(rd io.Reader) error {
+		var err error
+		size, err = io.Copy(io.Discard, rd)
+		return err
+	})
+	if err != nil {
+		res.addAnomaly("loading a new file failed: %v", err)
+	} else if size != 0 {
+		res.addAnomaly("loading a new empty file returned %d bytes", size)
+	}
+
+	var inTime bool
+	res.ListDelay, inTime, err = waitForListing(ctx, be, h, true, timeout)
+	if err != nil {
+		return Result{}, err
+	}
+	if !inTime {
+		res.addAnomaly("a new file did not show up in listings within %v", timeout)
+	} else if res.ListDelay > 0 {
+		res.addAnomaly("a new file showed up in listings only after %v", res.ListDelay.Round(time.Millisecond))
+	}
+
+	if err := be.Remove(ctx, h); err != nil {
+		return Result{}, errors.Wrap(err, "removing probe")
+	}
+	removed = true
+
+	res.RemoveDelay, inTime, err = waitForListing(ctx, be, h, false, timeout)
+	if err != nil {
+		return Result{}, err
+	}
+	if !inTime {
+		res.addAnomaly("a removed file was still listed after %v", timeout)
+	} else if res.RemoveDelay > 0 {
+		res.addAnomaly("a removed file vanished from listings only after %v", res.RemoveDelay.Round(time.Millisecond))
+	}
+
+	return res, nil
+}
+
+// waitForListing lists the files of the type of h until the presence of h
+// matches listed, but at most for timeout. It returns the time until the
+// listing matched, which is zero if the first listing already matched.
+func waitForListing(ctx context.Context, be restic.Backend, h restic.Handle, listed bool, timeout time.Duration) (delay time.Duration, inTime bool, err error) {
+	start := time.Now()
+	for i := 0; ; i++ {
+		found := false
+		err := be.List(ctx, h.Type, func(fi restic.FileInfo) error {
+			if fi.Name == h.Name {
+				found = true
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, false, errors.Wrap(err, "listing probe")
+		}
+
+		elapsed := time.Since(start)
+		if found == listed {
+			if i == 0 {
+				return 0, true, nil
+			}
+			return elapsed, true, nil
+		}
+		if elapsed > timeout {
+			return elapsed, false, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0, false, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package consistency
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/backend/mem"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func countFiles(t *testing.T, be restic.Backend) int {
+	t.Helper()
+	count := 0
+	rtest.OK(t, be.List(context.TODO(), restic.LockFile, func(restic.FileInfo) error {
+		count++
+		return nil
+	}))
+	return count
+}
+
+func TestProbeConsistent(t *testing.T) {
+	be := mem.New()
+
+	res, err := Probe(context.TODO(), be, 0)
+	rtest.OK(t, err)
+	rtest.Equals(t, Result{}, res)
+	rtest.Equals(t, 0, countFiles(t, be))
+}
+
+func TestProbeLaggingListing(t *testing.T) {
+	pollInterval = 10 * time.Millisecond
+	defer func() {
+		pollInterval = 100 * time.Millisecond
+	}()
+
+	mbe := mem.New()
+	be := TestLaggingBackend(mbe, 300*time.Millisecond, 200*time.Millisecond)
+
+	res, err := Probe(context.TODO(), be, 0)
+	rtest.OK(t, err)
+	rtest.Assert(t, res.ListDelay >= 300*time.Millisecond, "list delay %v too short", res.ListDelay)
+	rtest.Assert(t, res.RemoveDelay >= 200*time.Millisecond, "remove delay %v too short", res.RemoveDelay)
+	rtest.Equals(t, 2, len(res.Anomalies))
+	rtest.Assert(t, strings.HasPrefix(res.Anomalies[0], "a new file showed up in listings only after"), "unexpected anomaly %q", res.Anomalies[0])
+	rtest.Assert(t, strings.HasPrefix(res.Anomalies[1], "a removed file vanished from listings only after"), "unexpected anomaly %q", res.Anomalies[1])
+	rtest.Equals(t, 0, countFiles(t, mbe))
+}
+
+func TestProbeCleanup(t *testing.T) {
+	pollInterval = 10 * time.Millisecond
+	defer func() {
+		pollInterval = 100 * time.Millisecond
+	}()
+
+	mbe := mem.New()
+	// the probe never shows up in listings
+	be := TestLaggingBackend(mbe, time.Hour, 0)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 100*time.Millisecond)
+	defer cancel()
+	_, err := Probe(ctx, be, 0)
+	rtest.Assert(t, err == context.DeadlineExceeded, "unexpected error %v", err)
+
+	// the probe must be removed although the context was canceled
+	rtest.Equals(t, 0, countFiles(t, mbe))
+}
@@ -0,0 +1,87 @@
+package consistency
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+// TestLaggingBackend wraps a backend such that new files only show up in
+// listings after listDelay and removed files are listed for removeDelay. It
+// simulates backends with eventually consistent listings in tests.
+func TestLaggingBackend(be restic.Backend, listDelay, removeDelay time.Duration) restic.Backend {
+	return &laggingBackend{
+		Backend:     be,
+		listDelay:   listDelay,
+		removeDelay: removeDelay,
+		saved:       make(map[restic.Handle]time.Time),
+		removed:     make(map[restic.Handle]time.Time),
+	}
+}
+
+type laggingBackend struct {
+	restic.Backend
+	listDelay, removeDelay time.Duration
+
+	m       sync.Mutex
+	saved   map[restic.Handle]time.Time
+	removed map[restic.Handle]time.Time
+}
+
+func (be *laggingBackend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	err := be.Backend.Save(ctx, h, rd)
+	if err == nil {
+		be.m.Lock()
+		be.saved[h] = time.Now()
+		delete(be.removed, h)
+		be.m.Unlock()
+	}
+	return err
+}
+
+func (be *laggingBackend) Remove(ctx context.Context, h restic.Handle) error {
+	err := be.Backend.Remove(ctx, h)
+	if err == nil {
+		be.m.Lock()
+		be.removed[h] = time.Now()
+		delete(be.saved, h)
+		be.m.Unlock()
+	}
+	return err
+}
+
+func (be *laggingBackend) List(ctx context.Context, t restic.FileType, fn func(restic.FileInfo) error) error {
+	be.m.Lock()
+	var hidden = make(map[string]struct{})
+	var ghosts []string
+	for h, saved := range be.saved {
+		if h.Type == t && time.Since(saved) < be.listDelay {
+			hidden[h.Name] = struct{}{}
+		}
+	}
+	for h, removed := range be.removed {
+		if h.Type == t && time.Since(removed) < be.removeDelay {
+			ghosts = append(ghosts, h.Name)
+		}
+	}
+	be.m.Unlock()
+
+	err := be.Backend.List(ctx, t, func(fi restic.FileInfo) error {
+		if _, ok := hidden[fi.Name]; ok {
+			return nil
+		}
+		return fn(fi)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, name := range ghosts {
+		if err := fn(restic.FileInfo{Name: name}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
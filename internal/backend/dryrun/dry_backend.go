@@ -68,6 +68,11 @@ func (be *Backend) HasAtomicReplace() bool {
 	return be.b.HasAtomicReplace()
 }
 
+// HasAtomicSave returns true, Save does not write anything.
+func (be *Backend) HasAtomicSave() bool {
+	return true
+}
+
 func (be *Backend) IsNotExist(err error) bool {
 	return be.b.IsNotExist(err)
 }
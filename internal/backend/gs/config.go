@@ -18,8 +18,8 @@ type Config struct {
 	Bucket    string
 	Prefix    string
 
-	Connections uint   `option:"connections" help:"set a limit for the number of concurrent connections (default: 5)"`
-	Region      string `option:"region" help:"region to create the bucket in (default: us)"`
+	Connections uint   `option:"connections" help:"set a limit for the number of concurrent connections"`
+	Region      string `option:"region" help:"region to create the bucket in"`
 }
 
 // NewConfig returns a new Config with the default values filled in.
@@ -31,7 +31,7 @@ func NewConfig() Config {
 }
 
 func init() {
-	options.Register("gs", Config{})
+	options.Register("gs", NewConfig())
 }
 
 // ParseConfig parses the string s and extracts the gcs config. The
@@ -4,7 +4,9 @@ package gs
 import (
 	"context"
 	"crypto/md5"
+	"encoding/binary"
 	"hash"
+	"hash/crc32"
 	"io"
 	"net/http"
 	"os"
@@ -95,6 +97,9 @@ func (be *Backend) bucketExists(ctx context.Context, bucket *storage.BucketHandl
 
 const defaultListMaxItems = 1000
 
+// crc32cTable is used to compute the CRC32C checksum GCS reports for objects.
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
 func open(cfg Config, rt http.RoundTripper) (*Backend, error) {
 	debug.Log("open, config %#v", cfg)
 
@@ -197,6 +202,12 @@ func (be *Backend) HasAtomicReplace() bool {
 	return true
 }
 
+// HasAtomicSave returns true, objects only become visible once the upload
+// has completed.
+func (be *Backend) HasAtomicSave() bool {
+	return true
+}
+
 // Path returns the path in the bucket that is used for this backend.
 func (be *Backend) Path() string {
 	return be.prefix
@@ -234,7 +245,8 @@ func (be *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindRe
 	w := be.bucket.Object(objName).NewWriter(ctx)
 	w.ChunkSize = 0
 	w.MD5 = rd.Hash()
-	wbytes, err := io.Copy(w, rd)
+	hrd := restic.NewHashingRewindReader(rd, crc32.New(crc32cTable))
+	wbytes, err := io.Copy(w, hrd)
 	cerr := w.Close()
 	if err == nil {
 		err = cerr
@@ -248,7 +260,15 @@ func (be *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindRe
 	if wbytes != rd.Length() {
 		return errors.Errorf("wrote %d bytes instead of the expected %d bytes", wbytes, rd.Length())
 	}
-	return nil
+
+	attrs := w.Attrs()
+	if attrs == nil {
+		return nil
+	}
+
+	// compare the checksum of the data we sent with what the server received
+	remote := binary.BigEndian.AppendUint32(nil, attrs.CRC32C)
+	return backend.VerifyUploadChecksum(h, "CRC32C", hrd.Sum(nil), remote)
 }
 
 // Load runs fn with a reader that yields the contents of the file at h at the
@@ -1,13 +1,27 @@
 package gs_test
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
 	"fmt"
+	"hash/crc32"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/restic/restic/internal/backend/gs"
+	"github.com/restic/restic/internal/backend/retry"
 	"github.com/restic/restic/internal/backend/test"
+	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
 )
 
@@ -79,3 +93,86 @@ func BenchmarkBackendGS(t *testing.B) {
 	t.Logf("run tests")
 	newGSTestSuite().RunBenchmarks(t)
 }
+
+// newFakeGCSServer returns a server which accepts multipart uploads and
+// responds with the CRC32C checksum of the received data. If wrongChecksum is
+// set, a bit in the checksum is flipped.
+func newFakeGCSServer(t testing.TB, wrongChecksum bool, uploads *int) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if r.Method != http.MethodPost || err != nil {
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+
+		// the first part contains the metadata, the second one the data
+		mr := multipart.NewReader(r.Body, params["boundary"])
+		var data []byte
+		for i := 0; i < 2; i++ {
+			part, err := mr.NextPart()
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			data, err = io.ReadAll(part)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		*uploads++
+
+		crc := crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli))
+		if wrongChecksum {
+			crc ^= 0x01
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"bucket": "bucket",
+			"name":   "object",
+			"size":   strconv.Itoa(len(data)),
+			"crc32c": base64.StdEncoding.EncodeToString(binary.BigEndian.AppendUint32(nil, crc)),
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestSaveVerifyChecksum(t *testing.T) {
+	retry.TestFastRetries(t)
+
+	for _, test := range []struct {
+		name          string
+		wrongChecksum bool
+		uploads       int
+		fail          bool
+	}{
+		{"valid", false, 1, false},
+		{"mismatch", true, 3, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var uploads int
+			srv := newFakeGCSServer(t, test.wrongChecksum, &uploads)
+			t.Setenv("STORAGE_EMULATOR_HOST", strings.TrimPrefix(srv.URL, "http://"))
+			t.Setenv("GOOGLE_ACCESS_TOKEN", "token")
+
+			cfg, err := gs.ParseConfig("gs:bucket:/prefix")
+			rtest.OK(t, err)
+
+			be, err := gs.Open(context.TODO(), *cfg, http.DefaultTransport)
+			rtest.OK(t, err)
+			be = retry.New(be, 2, nil, nil)
+
+			data := rtest.Random(23, 1000)
+			h := restic.Handle{Type: restic.PackFile, Name: restic.Hash(data).String()}
+			err = be.Save(context.TODO(), h, restic.NewByteReader(data, be.Hasher()))
+			if test.fail {
+				rtest.Assert(t, err != nil, "Save did not fail with mismatching checksum")
+			} else {
+				rtest.OK(t, err)
+			}
+			rtest.Equals(t, test.uploads, uploads)
+		})
+	}
+}
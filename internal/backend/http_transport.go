@@ -23,8 +23,15 @@ type TransportOptions struct {
 	// contains the name of a file containing the TLS client certificate and private key in PEM format
 	TLSClientCertKeyFilename string
 
+	// contains the name of a file containing the TLS client private key in
+	// PEM format, if it is not stored in the same file as the certificate
+	TLSClientKeyFilename string
+
 	// Skip TLS certificate verification
 	InsecureTLS bool
+
+	// abort connection attempts after this duration, the default is 30 seconds
+	ConnectTimeout time.Duration
 }
 
 // readPEMCertKey reads a file and returns the PEM encoded certificate and key
@@ -65,11 +72,16 @@ func readPEMCertKey(filename string) (certs []byte, key []byte, err error) {
 // a custom rootCertFilename is non-empty, it must point to a valid PEM file,
 // otherwise the function will return an error.
 func Transport(opts TransportOptions) (http.RoundTripper, error) {
+	connectTimeout := opts.ConnectTimeout
+	if connectTimeout == 0 {
+		connectTimeout = 30 * time.Second
+	}
+
 	// copied from net/http
 	tr := &http.Transport{
 		Proxy: http.ProxyFromEnvironment,
 		DialContext: (&net.Dialer{
-			Timeout:   30 * time.Second,
+			Timeout:   connectTimeout,
 			KeepAlive: 30 * time.Second,
 			DualStack: true,
 		}).DialContext,
@@ -92,11 +104,25 @@ func Transport(opts TransportOptions) (http.RoundTripper, error) {
 			return nil, err
 		}
 
+		if opts.TLSClientKeyFilename != "" {
+			if key != nil {
+				return nil, errors.Errorf("error loading TLS cert and key: private key found in both %v and %v",
+					opts.TLSClientCertKeyFilename, opts.TLSClientKeyFilename)
+			}
+
+			_, key, err = readPEMCertKey(opts.TLSClientKeyFilename)
+			if err != nil {
+				return nil, err
+			}
+		}
+
 		crt, err := tls.X509KeyPair(certs, key)
 		if err != nil {
 			return nil, errors.Errorf("parse TLS client cert or key: %v", err)
 		}
 		tr.TLSClientConfig.Certificates = []tls.Certificate{crt}
+	} else if opts.TLSClientKeyFilename != "" {
+		return nil, errors.Errorf("TLS client key %v specified without a client certificate", opts.TLSClientKeyFilename)
 	}
 
 	if opts.RootCertFilenames != nil {
@@ -0,0 +1,151 @@
+package backend_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/backend"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// newClientCert returns a self-signed client certificate and the
+// corresponding private key, both PEM encoded.
+func newClientCert(t testing.TB) (cert *x509.Certificate, certPEM, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rtest.OK(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "restic test client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	rtest.OK(t, err)
+	cert, err = x509.ParseCertificate(der)
+	rtest.OK(t, err)
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	rtest.OK(t, err)
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return cert, certPEM, keyPEM
+}
+
+func writeFile(t testing.TB, dir, name string, data []byte) string {
+	filename := filepath.Join(dir, name)
+	rtest.OK(t, os.WriteFile(filename, data, 0600))
+	return filename
+}
+
+func TestTransportClientCert(t *testing.T) {
+	cert, certPEM, keyPEM := newClientCert(t)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(cert)
+	srv.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	dir := rtest.TempDir(t)
+	caFile := writeFile(t, dir, "ca.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+	certKeyFile := writeFile(t, dir, "client.pem", append(append([]byte{}, certPEM...), keyPEM...))
+	certFile := writeFile(t, dir, "client.crt", certPEM)
+	keyFile := writeFile(t, dir, "client.key", keyPEM)
+
+	for _, test := range []struct {
+		name string
+		opts backend.TransportOptions
+		ok   bool
+	}{
+		{
+			name: "no-client-cert",
+			opts: backend.TransportOptions{RootCertFilenames: []string{caFile}},
+		},
+		{
+			name: "cert-and-key",
+			opts: backend.TransportOptions{RootCertFilenames: []string{caFile}, TLSClientCertKeyFilename: certKeyFile},
+			ok:   true,
+		},
+		{
+			name: "separate-key",
+			opts: backend.TransportOptions{RootCertFilenames: []string{caFile}, TLSClientCertKeyFilename: certFile, TLSClientKeyFilename: keyFile},
+			ok:   true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			rt, err := backend.Transport(test.opts)
+			rtest.OK(t, err)
+
+			client := http.Client{Transport: rt}
+			res, err := client.Get(srv.URL)
+			if !test.ok {
+				if err == nil {
+					_ = res.Body.Close()
+					t.Fatal("expected TLS handshake to fail without client certificate")
+				}
+				return
+			}
+
+			rtest.OK(t, err)
+			rtest.OK(t, res.Body.Close())
+			rtest.Equals(t, http.StatusNoContent, res.StatusCode)
+		})
+	}
+}
+
+func TestTransportInvalidFiles(t *testing.T) {
+	_, certPEM, keyPEM := newClientCert(t)
+
+	dir := rtest.TempDir(t)
+	certKeyFile := writeFile(t, dir, "client.pem", append(append([]byte{}, certPEM...), keyPEM...))
+	certFile := writeFile(t, dir, "client.crt", certPEM)
+	keyFile := writeFile(t, dir, "client.key", keyPEM)
+	invalidFile := writeFile(t, dir, "invalid.pem", []byte("not a PEM file"))
+	missingFile := filepath.Join(dir, "missing.pem")
+
+	for _, test := range []struct {
+		name string
+		opts backend.TransportOptions
+	}{
+		{"missing-cacert", backend.TransportOptions{RootCertFilenames: []string{missingFile}}},
+		{"invalid-cacert", backend.TransportOptions{RootCertFilenames: []string{invalidFile}}},
+		{"missing-client-cert", backend.TransportOptions{TLSClientCertKeyFilename: missingFile}},
+		{"invalid-client-cert", backend.TransportOptions{TLSClientCertKeyFilename: invalidFile}},
+		{"cert-without-key", backend.TransportOptions{TLSClientCertKeyFilename: certFile}},
+		{"missing-key", backend.TransportOptions{TLSClientCertKeyFilename: certFile, TLSClientKeyFilename: missingFile}},
+		{"duplicate-key", backend.TransportOptions{TLSClientCertKeyFilename: certKeyFile, TLSClientKeyFilename: keyFile}},
+		{"key-without-cert", backend.TransportOptions{TLSClientKeyFilename: keyFile}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := backend.Transport(test.opts)
+			rtest.Assert(t, err != nil, "expected error for %+v", test.opts)
+		})
+	}
+}
@@ -137,33 +137,60 @@ func DetectLayout(ctx context.Context, repo Filesystem, dir string) (Layout, err
 // the empty string, DetectLayout is used. If that fails, defaultLayout is used.
 func ParseLayout(ctx context.Context, repo Filesystem, layout, defaultLayout, path string) (l Layout, err error) {
 	debug.Log("parse layout string %q for backend at %v", layout, path)
-	switch layout {
+	if repo == nil {
+		repo = &LocalFilesystem{}
+	}
+
+	if layout != "" {
+		return NewLayout(layout, path, repo.Join)
+	}
+
+	l, err = DetectLayout(ctx, repo, path)
+
+	// use the default layout if auto detection failed
+	if errors.Is(err, ErrLayoutDetectionFailed) && defaultLayout != "" {
+		debug.Log("error: %v, use default layout %v", err, defaultLayout)
+		return ParseLayout(ctx, repo, defaultLayout, "", path)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	debug.Log("layout detected: %v", l)
+
+	return l, nil
+}
+
+// NewLayout returns the layout with the given name for the repository at path.
+func NewLayout(name, path string, join func(...string) string) (Layout, error) {
+	switch name {
 	case "default":
-		l = &DefaultLayout{
+		return &DefaultLayout{
 			Path: path,
-			Join: repo.Join,
-		}
+			Join: join,
+		}, nil
 	case "s3legacy":
-		l = &S3LegacyLayout{
+		return &S3LegacyLayout{
 			Path: path,
-			Join: repo.Join,
-		}
-	case "":
-		l, err = DetectLayout(ctx, repo, path)
-
-		// use the default layout if auto detection failed
-		if errors.Is(err, ErrLayoutDetectionFailed) && defaultLayout != "" {
-			debug.Log("error: %v, use default layout %v", err, defaultLayout)
-			return ParseLayout(ctx, repo, defaultLayout, "", path)
-		}
-
-		if err != nil {
-			return nil, err
-		}
-		debug.Log("layout detected: %v", l)
+			Join: join,
+		}, nil
 	default:
-		return nil, errors.Errorf("unknown backend layout string %q, may be one of: default, s3legacy", layout)
+		return nil, errors.Errorf("unknown backend layout string %q, may be one of: default, s3legacy", name)
 	}
+}
 
-	return l, nil
+// Mover is implemented by backends which can move their files from one
+// layout to another.
+type Mover interface {
+	restic.Backend
+	Layout
+
+	// NewLayout returns the layout with the given name for the backend.
+	NewLayout(name string) (Layout, error)
+	// SetLayout changes the layout used by the backend.
+	SetLayout(l Layout)
+	// MoveToLayout moves the file for h from its location in the current
+	// layout to its location in l. It returns nil if the file has already
+	// been moved.
+	MoveToLayout(ctx context.Context, h restic.Handle, l Layout) error
 }
@@ -21,6 +21,7 @@ var defaultLayoutPaths = map[restic.FileType]string{
 	restic.IndexFile:    "index",
 	restic.LockFile:     "locks",
 	restic.KeyFile:      "keys",
+	restic.TrashFile:    "trash",
 }
 
 func (l *DefaultLayout) String() string {
@@ -55,7 +56,11 @@ func (l *DefaultLayout) Filename(h restic.Handle) string {
 
 // Paths returns all directory names needed for a repo.
 func (l *DefaultLayout) Paths() (dirs []string) {
-	for _, p := range defaultLayoutPaths {
+	for t, p := range defaultLayoutPaths {
+		// the trash directory is only created once a file is moved there
+		if t == restic.TrashFile {
+			continue
+		}
 		dirs = append(dirs, l.Join(l.Path, p))
 	}
 
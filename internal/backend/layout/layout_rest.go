@@ -42,7 +42,11 @@ func (l *RESTLayout) Filename(h restic.Handle) string {
 
 // Paths returns all directory names
 func (l *RESTLayout) Paths() (dirs []string) {
-	for _, p := range restLayoutPaths {
+	for t, p := range restLayoutPaths {
+		// the trash directory is only created once a file is moved there
+		if t == restic.TrashFile {
+			continue
+		}
 		dirs = append(dirs, l.URL+l.Join(l.Path, p))
 	}
 	return dirs
@@ -58,6 +58,12 @@ func TestDefaultLayout(t *testing.T) {
 			restic.Handle{Type: restic.KeyFile, Name: "123456"},
 			filepath.Join(tempdir, "keys", "123456"),
 		},
+		{
+			tempdir,
+			filepath.Join,
+			restic.Handle{Type: restic.TrashFile, Name: "123456"},
+			filepath.Join(tempdir, "trash", "123456"),
+		},
 		{
 			"",
 			path.Join,
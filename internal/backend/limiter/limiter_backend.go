@@ -3,27 +3,15 @@ package limiter
 import (
 	"context"
 	"io"
+	"os"
 
 	"github.com/restic/restic/internal/restic"
 )
 
-func WrapBackendConstructor[B restic.Backend, C any](constructor func(ctx context.Context, cfg C) (B, error)) func(ctx context.Context, cfg C, lim Limiter) (restic.Backend, error) {
-	return func(ctx context.Context, cfg C, lim Limiter) (restic.Backend, error) {
-		var be restic.Backend
-		be, err := constructor(ctx, cfg)
-		if err != nil {
-			return nil, err
-		}
-
-		if lim != nil {
-			be = LimitBackend(be, lim)
-		}
-		return be, nil
-	}
-}
-
 // LimitBackend wraps a Backend and applies rate limiting to Load() and Save()
-// calls on the backend.
+// calls on the backend. As the limits are applied to the data passed to and
+// returned from the backend, they cover all backend types regardless of how
+// the data is transferred.
 func LimitBackend(be restic.Backend, l Limiter) restic.Backend {
 	return rateLimitedBackend{
 		Backend: be,
@@ -61,8 +49,39 @@ func (r rateLimitedBackend) Load(ctx context.Context, h restic.Handle, length in
 	})
 }
 
+// CopyRange copies a range of the file at h to dst. As the data does not pass
+// through restic, the download limit is applied to the copied bytes after the
+// copy is complete.
+func (r rateLimitedBackend) CopyRange(ctx context.Context, h restic.Handle, length int, offset int64, dst *os.File) error {
+	start, err := dst.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	err = restic.CopyRange(ctx, r.Backend, h, length, offset, dst)
+	if err != nil {
+		return err
+	}
+	end, err := dst.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.CopyN(r.limiter.DownstreamWriter(io.Discard), zeroReader{}, end-start)
+	return err
+}
+
 func (r rateLimitedBackend) Unwrap() restic.Backend { return r.Backend }
 
+// zeroReader returns an infinite stream of zero bytes.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
 type limitedReader struct {
 	io.Reader
 	writerTo io.WriterTo
@@ -86,3 +105,4 @@ func (l *limitedReader) WriteTo(w io.Writer) (int64, error) {
 }
 
 var _ restic.Backend = (*rateLimitedBackend)(nil)
+var _ restic.RangeCopier = (*rateLimitedBackend)(nil)
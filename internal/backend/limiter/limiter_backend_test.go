@@ -6,7 +6,11 @@ import (
 	"crypto/rand"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/restic/restic/internal/backend/mock"
 	"github.com/restic/restic/internal/restic"
@@ -36,7 +40,7 @@ func TestLimitBackendSave(t *testing.T) {
 		}
 		return nil
 	}
-	limiter := NewStaticLimiter(Limits{42 * 1024, 42 * 1024})
+	limiter := NewStaticLimiter(Limits{UploadKb: 42 * 1024, DownloadKb: 42 * 1024})
 	limbe := LimitBackend(be, limiter)
 
 	rd := restic.NewByteReader(data, nil)
@@ -82,7 +86,7 @@ func TestLimitBackendLoad(t *testing.T) {
 			}
 			return newTracedReadCloser(src), nil
 		}
-		limiter := NewStaticLimiter(Limits{42 * 1024, 42 * 1024})
+		limiter := NewStaticLimiter(Limits{UploadKb: 42 * 1024, DownloadKb: 42 * 1024})
 		limbe := LimitBackend(be, limiter)
 
 		err := limbe.Load(context.TODO(), testHandle, 0, 0, func(rd io.Reader) error {
@@ -107,3 +111,117 @@ func TestLimitBackendLoad(t *testing.T) {
 			test.innerWriteTo, test.outerWriteTo)
 	}
 }
+
+// fakeClock implements ratelimit.Clock, Sleep advances the current time
+// without actually waiting.
+type fakeClock struct {
+	m   sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func (c *fakeClock) elapsed(start time.Time) time.Duration {
+	return c.Now().Sub(start)
+}
+
+func assertDuration(t *testing.T, expected, actual time.Duration) {
+	t.Helper()
+	// the token bucket may deviate up to two percent from the configured rate
+	diff := expected - actual
+	if diff < 0 {
+		diff = -diff
+	}
+	if diff > expected/50 {
+		t.Errorf("transfer took %v, expected %v", actual, expected)
+	}
+}
+
+func TestLimitBackendThroughput(t *testing.T) {
+	testHandle := restic.Handle{Type: restic.PackFile, Name: "test"}
+	data := randomBytes(t, 100*1024)
+
+	be := mock.NewBackend()
+	be.SaveFn = func(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+		_, err := io.Copy(io.Discard, rd)
+		return err
+	}
+	be.OpenReaderFn = func(ctx context.Context, h restic.Handle, length int, offset int64) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+
+	for _, test := range []struct {
+		limits           Limits
+		upload, download time.Duration
+	}{
+		// the bucket initially contains one second worth of data
+		{Limits{UploadKb: 10, DownloadKb: 20}, 9 * time.Second, 4 * time.Second},
+		{Limits{UploadKb: 20, DownloadKb: 10}, 4 * time.Second, 9 * time.Second},
+		{Limits{UploadKb: 10, DownloadKb: 20, BurstKb: 50}, 5 * time.Second, 2500 * time.Millisecond},
+		{Limits{UploadKb: 10}, 9 * time.Second, 0},
+		{Limits{DownloadKb: 10}, 0, 9 * time.Second},
+	} {
+		t.Run(fmt.Sprintf("%+v", test.limits), func(t *testing.T) {
+			clock := &fakeClock{now: time.Unix(1000, 0)}
+			limbe := LimitBackend(be, newStaticLimiterWithClock(test.limits, clock))
+
+			start := clock.Now()
+			err := limbe.Save(context.TODO(), testHandle, restic.NewByteReader(data, nil))
+			rtest.OK(t, err)
+			assertDuration(t, test.upload, clock.elapsed(start))
+
+			start = clock.Now()
+			err = limbe.Load(context.TODO(), testHandle, 0, 0, func(rd io.Reader) error {
+				n, err := io.Copy(io.Discard, rd)
+				rtest.Equals(t, int64(len(data)), n)
+				return err
+			})
+			rtest.OK(t, err)
+			assertDuration(t, test.download, clock.elapsed(start))
+		})
+	}
+}
+
+// rangeCopyBackend implements restic.RangeCopier by writing data to dst.
+type rangeCopyBackend struct {
+	*mock.Backend
+	data []byte
+}
+
+func (be *rangeCopyBackend) CopyRange(ctx context.Context, h restic.Handle, length int, offset int64, dst *os.File) error {
+	_, err := dst.Write(be.data)
+	return err
+}
+
+func TestLimitBackendCopyRange(t *testing.T) {
+	testHandle := restic.Handle{Type: restic.PackFile, Name: "test"}
+	be := &rangeCopyBackend{Backend: mock.NewBackend(), data: randomBytes(t, 100*1024)}
+
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	limbe := LimitBackend(be, newStaticLimiterWithClock(Limits{DownloadKb: 10}, clock))
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "copy"))
+	rtest.OK(t, err)
+	defer func() {
+		_ = f.Close()
+	}()
+
+	// the copied data is charged to the download limit
+	start := clock.Now()
+	rtest.OK(t, restic.CopyRange(context.TODO(), limbe, testHandle, 0, 0, f))
+	assertDuration(t, 9*time.Second, clock.elapsed(start))
+
+	buf, err := os.ReadFile(f.Name())
+	rtest.OK(t, err)
+	rtest.Equals(t, be.data, buf)
+}
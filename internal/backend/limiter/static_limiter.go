@@ -5,6 +5,8 @@ import (
 	"net/http"
 
 	"github.com/juju/ratelimit"
+
+	"github.com/restic/restic/internal/options"
 )
 
 type staticLimiter struct {
@@ -17,22 +19,37 @@ type staticLimiter struct {
 type Limits struct {
 	UploadKb   int
 	DownloadKb int
+
+	// BurstKb is the amount of data which can be transferred at once before
+	// the rate limit applies. Zero means the amount of data transferred
+	// within one second at the configured rate.
+	BurstKb int `option:"burst" help:"amount of data in KiB which can be transferred at once before the rate limit applies (default: one second worth of data)"`
+}
+
+func init() {
+	options.Register("limit", Limits{})
 }
 
 // NewStaticLimiter constructs a Limiter with a fixed (static) upload and
 // download rate cap
 func NewStaticLimiter(l Limits) Limiter {
+	return newStaticLimiterWithClock(l, nil)
+}
+
+// newStaticLimiterWithClock constructs a static limiter which uses clock to
+// measure the passage of time. If clock is nil, the system clock is used.
+func newStaticLimiterWithClock(l Limits, clock ratelimit.Clock) Limiter {
 	var (
 		upstreamBucket   *ratelimit.Bucket
 		downstreamBucket *ratelimit.Bucket
 	)
 
 	if l.UploadKb > 0 {
-		upstreamBucket = ratelimit.NewBucketWithRate(toByteRate(l.UploadKb), int64(toByteRate(l.UploadKb)))
+		upstreamBucket = newBucket(l.UploadKb, l.BurstKb, clock)
 	}
 
 	if l.DownloadKb > 0 {
-		downstreamBucket = ratelimit.NewBucketWithRate(toByteRate(l.DownloadKb), int64(toByteRate(l.DownloadKb)))
+		downstreamBucket = newBucket(l.DownloadKb, l.BurstKb, clock)
 	}
 
 	return staticLimiter{
@@ -109,6 +126,14 @@ func (l staticLimiter) limitWriter(w io.Writer, b *ratelimit.Bucket) io.Writer {
 	return ratelimit.Writer(w, b)
 }
 
+func newBucket(rateKb, burstKb int, clock ratelimit.Clock) *ratelimit.Bucket {
+	capacity := int64(toByteRate(rateKb))
+	if burstKb > 0 {
+		capacity = int64(toByteRate(burstKb))
+	}
+	return ratelimit.NewBucketWithRateAndClock(toByteRate(rateKb), capacity, clock)
+}
+
 func toByteRate(val int) float64 {
 	return float64(val) * 1024.
 }
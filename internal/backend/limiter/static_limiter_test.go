@@ -16,10 +16,10 @@ func TestLimiterWrapping(t *testing.T) {
 	writer := new(bytes.Buffer)
 
 	for _, limits := range []Limits{
-		{0, 0},
-		{42, 0},
-		{0, 42},
-		{42, 42},
+		{UploadKb: 0, DownloadKb: 0},
+		{UploadKb: 42, DownloadKb: 0},
+		{UploadKb: 0, DownloadKb: 42},
+		{UploadKb: 42, DownloadKb: 42},
 	} {
 		limiter := NewStaticLimiter(limits)
 
@@ -48,7 +48,7 @@ func (r *tracedReadCloser) Close() error {
 }
 
 func TestRoundTripperReader(t *testing.T) {
-	limiter := NewStaticLimiter(Limits{42 * 1024, 42 * 1024})
+	limiter := NewStaticLimiter(Limits{UploadKb: 42 * 1024, DownloadKb: 42 * 1024})
 	data := make([]byte, 1234)
 	_, err := io.ReadFull(rand.Reader, data)
 	test.OK(t, err)
@@ -86,7 +86,7 @@ func TestRoundTripperReader(t *testing.T) {
 }
 
 func TestRoundTripperCornerCases(t *testing.T) {
-	limiter := NewStaticLimiter(Limits{42 * 1024, 42 * 1024})
+	limiter := NewStaticLimiter(Limits{UploadKb: 42 * 1024, DownloadKb: 42 * 1024})
 
 	rt := limiter.Transport(roundTripper(func(req *http.Request) (*http.Response, error) {
 		return &http.Response{}, nil
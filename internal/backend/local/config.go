@@ -12,18 +12,24 @@ type Config struct {
 	Path   string
 	Layout string `option:"layout" help:"use this backend directory layout (default: auto-detect)"`
 
-	Connections uint `option:"connections" help:"set a limit for the number of concurrent operations (default: 2)"`
+	Connections uint `option:"connections" help:"set a limit for the number of concurrent operations"`
+	Fsync       bool `option:"fsync" help:"flush files and directories to disk after changing them"`
+
+	FileMode      string `option:"file-mode" help:"create files with these octal permissions, e.g. 0640 (default: derived from the config file)"`
+	DirMode       string `option:"dir-mode" help:"create directories with these octal permissions, e.g. 0750 (default: derived from the config file)"`
+	InsecureModes bool   `option:"insecure-modes" help:"allow file and directory modes which let others modify the repository"`
 }
 
 // NewConfig returns a new config with default options applied.
 func NewConfig() Config {
 	return Config{
 		Connections: 2,
+		Fsync:       true,
 	}
 }
 
 func init() {
-	options.Register("local", Config{})
+	options.Register("local", NewConfig())
 }
 
 // ParseConfig parses a local backend config.
@@ -0,0 +1,36 @@
+package local
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// copyFileRange copies length bytes starting at offset of src to the current
+// position of dst using copy_file_range, which allows the filesystem to share
+// the data between both files (reflink) or to copy it within the kernel. It
+// returns errCopyRangeUnsupported if no data could be copied because the
+// syscall is not supported for the files.
+func copyFileRange(dst, src *os.File, offset, length int64) error {
+	copied := false
+	for length > 0 {
+		n, err := unix.CopyFileRange(int(src.Fd()), &offset, int(dst.Fd()), nil, int(length), 0)
+		if err != nil {
+			if !copied && (errors.Is(err, syscall.EXDEV) || errors.Is(err, syscall.ENOSYS) ||
+				errors.Is(err, syscall.EOPNOTSUPP) || errors.Is(err, syscall.EINVAL) ||
+				errors.Is(err, syscall.EPERM)) {
+				return errCopyRangeUnsupported
+			}
+			return err
+		}
+		if n == 0 {
+			return io.ErrUnexpectedEOF
+		}
+		copied = true
+		length -= int64(n)
+	}
+	return nil
+}
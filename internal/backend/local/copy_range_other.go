@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package local
+
+import "os"
+
+// copyFileRange is only supported on Linux.
+func copyFileRange(_, _ *os.File, _, _ int64) error {
+	return errCopyRangeUnsupported
+}
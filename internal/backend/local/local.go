@@ -2,15 +2,19 @@ package local
 
 import (
 	"context"
+	"fmt"
 	"hash"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/backend/layout"
-	"github.com/restic/restic/internal/backend/limiter"
 	"github.com/restic/restic/internal/backend/location"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
@@ -25,13 +29,38 @@ type Local struct {
 	Config
 	layout.Layout
 	backend.Modes
+
+	// dirSyncUnsupported is set to 1 when the filesystem does not support
+	// syncing directories.
+	dirSyncUnsupported int32
+	dirSyncWarning     sync.Once
+
+	// forceSync is set to 1 by EnableSync, files and directories are then
+	// synced regardless of the fsync option.
+	forceSync       int32
+	fileSyncWarning sync.Once
+
+	syncMutex sync.Mutex
+	syncTime  time.Duration
 }
 
 // ensure statically that *Local implements restic.Backend.
 var _ restic.Backend = &Local{}
 
+// ensure statically that *Local implements restic.RangeCopier.
+var _ restic.RangeCopier = &Local{}
+
+// ensure statically that *Local implements restic.Renamer.
+var _ restic.Renamer = &Local{}
+
+// ensure statically that *Local implements restic.Syncer.
+var _ restic.Syncer = &Local{}
+
+// ensure statically that *Local implements layout.Mover.
+var _ layout.Mover = &Local{}
+
 func NewFactory() location.Factory {
-	return location.NewLimitedBackendFactory("local", ParseConfig, location.NoPassword, limiter.WrapBackendConstructor(Create), limiter.WrapBackendConstructor(Open))
+	return location.NewBackendFactory("local", ParseConfig, location.NoPassword, Create, Open)
 }
 
 const defaultLayout = "default"
@@ -43,7 +72,10 @@ func open(ctx context.Context, cfg Config) (*Local, error) {
 	}
 
 	fi, err := fs.Stat(l.Filename(restic.Handle{Type: restic.ConfigFile}))
-	m := backend.DeriveModesFromFileInfo(fi, err)
+	m, err := backend.ParseModes(backend.DeriveModesFromFileInfo(fi, err), cfg.FileMode, cfg.DirMode, cfg.InsecureModes)
+	if err != nil {
+		return nil, err
+	}
 	debug.Log("using (%03O file, %03O dir) permissions", m.File, m.Dir)
 
 	return &Local{
@@ -76,16 +108,50 @@ func Create(ctx context.Context, cfg Config) (*Local, error) {
 	}
 
 	// create paths for data and refs
-	for _, d := range be.Paths() {
-		err := fs.MkdirAll(d, be.Modes.Dir)
+	dirs := make(map[string]struct{})
+	for _, d := range append([]string{be.Path}, be.Paths()...) {
+		err := be.mkdirAll(d)
 		if err != nil {
-			return nil, errors.WithStack(err)
+			return nil, err
+		}
+		dirs[d] = struct{}{}
+		dirs[filepath.Dir(d)] = struct{}{}
+	}
+
+	// commit the new directories to disk, children before their parents
+	sorted := make([]string, 0, len(dirs))
+	for d := range dirs {
+		sorted = append(sorted, d)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(sorted)))
+
+	for _, d := range sorted {
+		if err := be.syncDir(d); err != nil {
+			return nil, err
 		}
 	}
 
 	return be, nil
 }
 
+// mkdirAll creates dir and all missing parents. An explicitly configured
+// directory mode is applied to dir regardless of the umask, an inherited
+// setgid bit is kept.
+func (b *Local) mkdirAll(dir string) error {
+	if err := fs.MkdirAll(dir, b.Modes.Dir); err != nil {
+		return errors.WithStack(err)
+	}
+	if b.DirMode == "" {
+		return nil
+	}
+
+	fi, err := fs.Stat(dir)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(fs.Chmod(dir, b.Modes.Dir|fi.Mode()&os.ModeSetgid))
+}
+
 func (b *Local) Connections() uint {
 	return b.Config.Connections
 }
@@ -105,6 +171,12 @@ func (b *Local) HasAtomicReplace() bool {
 	return true
 }
 
+// HasAtomicSave returns true, files are written to a temporary name and then
+// renamed.
+func (b *Local) HasAtomicSave() bool {
+	return true
+}
+
 // IsNotExist returns true if the error is caused by a non existing file.
 func (b *Local) IsNotExist(err error) bool {
 	return errors.Is(err, os.ErrNotExist)
@@ -124,18 +196,21 @@ func (b *Local) Save(_ context.Context, h restic.Handle, rd restic.RewindReader)
 
 	// Create new file with a temporary name.
 	tmpname := filepath.Base(finalname) + "-tmp-"
-	f, err := tempFile(dir, tmpname)
+	f, err := tempFile(fs.FixPath(dir), tmpname)
 
 	if b.IsNotExist(err) {
 		debug.Log("error %v: creating dir", err)
 
 		// error is caused by a missing directory, try to create it
-		mkdirErr := fs.MkdirAll(dir, b.Modes.Dir)
+		mkdirErr := b.mkdirAll(dir)
 		if mkdirErr != nil {
 			debug.Log("error creating dir %v: %v", dir, mkdirErr)
 		} else {
-			// try again
-			f, err = tempFile(dir, tmpname)
+			// commit the new directory, then try again
+			if err = b.syncDir(filepath.Dir(dir)); err != nil {
+				return err
+			}
+			f, err = tempFile(fs.FixPath(dir), tmpname)
 		}
 	}
 
@@ -172,26 +247,35 @@ func (b *Local) Save(_ context.Context, h restic.Handle, rd restic.RewindReader)
 	}
 
 	// Ignore error if filesystem does not support fsync.
-	err = f.Sync()
-	syncNotSup := err != nil && (errors.Is(err, syscall.ENOTSUP) || isMacENOTTY(err))
-	if err != nil && !syncNotSup {
-		return errors.WithStack(err)
+	if b.fsync() {
+		start := time.Now()
+		err = syncFile(f)
+		b.addSyncTime(start)
+		if err != nil && !isSyncNotSupported(err) {
+			return errors.WithStack(err)
+		}
+		if err != nil && atomic.LoadInt32(&b.forceSync) != 0 {
+			b.fileSyncWarning.Do(func() {
+				fmt.Fprintf(os.Stderr, "warning: the filesystem at %v does not support syncing files, data may be lost after a crash: %v\n", b.Path, err)
+			})
+		}
 	}
 
 	// Close, then rename. Windows doesn't like the reverse order.
 	if err = f.Close(); err != nil {
 		return errors.WithStack(err)
 	}
-	if err = os.Rename(f.Name(), finalname); err != nil {
+	if err = fs.Rename(f.Name(), finalname); err != nil {
+		// on Windows, an existing read-only file cannot be replaced
+		if _, serr := fs.Lstat(finalname); serr == nil {
+			return errors.Wrap(restic.ErrAlreadyExists, err.Error())
+		}
 		return errors.WithStack(err)
 	}
 
 	// Now sync the directory to commit the Rename.
-	if !syncNotSup {
-		err = fsyncDir(dir)
-		if err != nil {
-			return errors.WithStack(err)
-		}
+	if err = b.syncDir(dir); err != nil {
+		return err
 	}
 
 	// try to mark file as read-only to avoid accidential modifications
@@ -207,6 +291,69 @@ func (b *Local) Save(_ context.Context, h restic.Handle, rd restic.RewindReader)
 
 var tempFile = os.CreateTemp // Overridden by test.
 
+// syncFile and syncDir flush changes to disk, they are overridden by tests.
+var (
+	syncFile = (*os.File).Sync
+	syncDir  = fsyncDir
+)
+
+// isSyncNotSupported returns true if err indicates that the filesystem does
+// not support fsync.
+func isSyncNotSupported(err error) bool {
+	return errors.Is(err, syscall.ENOTSUP) || errors.Is(err, syscall.EINVAL) || isMacENOTTY(err)
+}
+
+// syncDir flushes changes to the directory dir to disk. If the filesystem
+// does not support syncing directories, a warning is printed once and
+// directories are no longer synced.
+func (b *Local) syncDir(dir string) error {
+	if !b.fsync() || atomic.LoadInt32(&b.dirSyncUnsupported) != 0 {
+		return nil
+	}
+
+	start := time.Now()
+	err := syncDir(dir)
+	b.addSyncTime(start)
+	switch {
+	case err == nil, errors.Is(err, os.ErrNotExist):
+		return nil
+	case isSyncNotSupported(err):
+		atomic.StoreInt32(&b.dirSyncUnsupported, 1)
+		b.dirSyncWarning.Do(func() {
+			fmt.Fprintf(os.Stderr, "warning: the filesystem at %v does not support syncing directories, data may be lost after a crash: %v\n", b.Path, err)
+		})
+		return nil
+	default:
+		return errors.WithStack(err)
+	}
+}
+
+// fsync returns true if files and directories should be synced.
+func (b *Local) fsync() bool {
+	return b.Fsync || atomic.LoadInt32(&b.forceSync) != 0
+}
+
+func (b *Local) addSyncTime(start time.Time) {
+	b.syncMutex.Lock()
+	defer b.syncMutex.Unlock()
+	b.syncTime += time.Since(start)
+}
+
+// EnableSync implements restic.Syncer. Files and directories are synced even
+// if the fsync option is disabled, a warning is printed if the filesystem
+// does not support this.
+func (b *Local) EnableSync() error {
+	atomic.StoreInt32(&b.forceSync, 1)
+	return nil
+}
+
+// SyncDuration implements restic.Syncer.
+func (b *Local) SyncDuration() time.Duration {
+	b.syncMutex.Lock()
+	defer b.syncMutex.Unlock()
+	return b.syncTime
+}
+
 // Load runs fn with a reader that yields the contents of the file at h at the
 // given offset.
 func (b *Local) Load(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
@@ -234,6 +381,46 @@ func (b *Local) openReader(_ context.Context, h restic.Handle, length int, offse
 	return f, nil
 }
 
+// errCopyRangeUnsupported is returned by copyFileRange if the files cannot be
+// copied using the optimized path.
+var errCopyRangeUnsupported = errors.New("copying file ranges is not supported")
+
+// copyRange copies a file range using the optimized path if possible, it is
+// overridden by tests.
+var copyRange = copyFileRange
+
+// CopyRange copies length bytes starting at offset from the file at h to the
+// current position of dst. If length is zero, the remainder of the file is
+// copied. If possible, the data is copied without passing it through
+// userspace, otherwise it is read and written as usual.
+func (b *Local) CopyRange(_ context.Context, h restic.Handle, length int, offset int64, dst *os.File) error {
+	f, err := fs.OpenFile(b.Filename(h), os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	size := int64(length)
+	if length == 0 {
+		fi, err := f.Stat()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		size = fi.Size() - offset
+	}
+
+	err = copyRange(dst, f, offset, size)
+	if err == nil || !errors.Is(err, errCopyRangeUnsupported) {
+		return errors.WithStack(err)
+	}
+
+	debug.Log("copying %v using copy_file_range failed, falling back to regular copy", h)
+	_, err = io.Copy(dst, io.NewSectionReader(f, offset, size))
+	return errors.WithStack(err)
+}
+
 // Stat returns information about a blob.
 func (b *Local) Stat(_ context.Context, h restic.Handle) (restic.FileInfo, error) {
 	fi, err := fs.Stat(b.Filename(h))
@@ -254,7 +441,73 @@ func (b *Local) Remove(_ context.Context, h restic.Handle) error {
 		return errors.WithStack(err)
 	}
 
-	return fs.Remove(fn)
+	err = fs.Remove(fn)
+	if err != nil {
+		return err
+	}
+
+	return b.syncDir(filepath.Dir(fn))
+}
+
+// Rename moves the file at from to the handle to. The target directory is
+// created if it does not exist yet.
+func (b *Local) Rename(_ context.Context, from, to restic.Handle) error {
+	return b.rename(b.Filename(from), b.Filename(to))
+}
+
+// NewLayout returns the layout with the given name for the repository
+// directory.
+func (b *Local) NewLayout(name string) (layout.Layout, error) {
+	return layout.NewLayout(name, b.Path, filepath.Join)
+}
+
+// SetLayout changes the layout used by the backend.
+func (b *Local) SetLayout(l layout.Layout) {
+	b.Layout = l
+}
+
+// MoveToLayout moves the file for h to its location in the layout l.
+func (b *Local) MoveToLayout(_ context.Context, h restic.Handle, l layout.Layout) error {
+	oldname := b.Filename(h)
+	newname := l.Filename(h)
+	if oldname == newname {
+		return nil
+	}
+
+	debug.Log("move %v -> %v", oldname, newname)
+	err := b.rename(oldname, newname)
+	if b.IsNotExist(err) {
+		if _, serr := fs.Lstat(newname); serr == nil {
+			debug.Log("%v seems to already have been moved", oldname)
+			return nil
+		}
+	}
+	return err
+}
+
+func (b *Local) rename(oldname, newname string) error {
+	dir := filepath.Dir(newname)
+
+	err := fs.Rename(oldname, newname)
+	if b.IsNotExist(err) {
+		// the error may be caused by a missing target directory
+		debug.Log("error %v: creating dir", err)
+		if err = b.mkdirAll(dir); err != nil {
+			return err
+		}
+		if err = b.syncDir(filepath.Dir(dir)); err != nil {
+			return err
+		}
+		err = fs.Rename(oldname, newname)
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err = b.syncDir(dir); err != nil {
+		return err
+	}
+	return b.syncDir(filepath.Dir(oldname))
 }
 
 // List runs fn for each file in the backend which has the type t. When an
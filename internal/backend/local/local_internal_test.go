@@ -1,10 +1,12 @@
 package local
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"syscall"
 	"testing"
 
@@ -40,3 +42,200 @@ func TestNoSpacePermanent(t *testing.T) {
 	rtest.Assert(t, errors.Is(err, syscall.ENOSPC),
 		"could not recover original ENOSPC error")
 }
+
+// recordSyncs replaces the sync functions with functions which record the
+// names of the synced files and directories. If dirErr is not nil, syncing
+// a directory fails with this error.
+func recordSyncs(t *testing.T, dirErr error) (files, dirs *[]string) {
+	oldSyncFile, oldSyncDir := syncFile, syncDir
+	t.Cleanup(func() {
+		syncFile, syncDir = oldSyncFile, oldSyncDir
+	})
+
+	files, dirs = &[]string{}, &[]string{}
+	syncFile = func(f *os.File) error {
+		*files = append(*files, f.Name())
+		return nil
+	}
+	syncDir = func(dir string) error {
+		*dirs = append(*dirs, dir)
+		return dirErr
+	}
+	return files, dirs
+}
+
+func TestSyncFilesAndDirs(t *testing.T) {
+	files, dirs := recordSyncs(t, nil)
+
+	cfg := NewConfig()
+	cfg.Path = filepath.Join(rtest.TempDir(t), "repo")
+	be, err := Create(context.TODO(), cfg)
+	rtest.OK(t, err)
+
+	// all new directories and the parent of the repository must be synced
+	rtest.Assert(t, len(*dirs) == len(be.Paths())+2, "unexpected number of synced directories: %v", len(*dirs))
+	for _, dir := range []string{filepath.Dir(cfg.Path), cfg.Path, filepath.Join(cfg.Path, "snapshots"), filepath.Join(cfg.Path, "index")} {
+		rtest.Assert(t, contains(*dirs, dir), "directory %v was not synced", dir)
+	}
+
+	for _, tpe := range []restic.FileType{restic.SnapshotFile, restic.IndexFile, restic.PackFile} {
+		*files, *dirs = nil, nil
+
+		data := []byte("foobar")
+		h := restic.Handle{Type: tpe, Name: restic.Hash(data).String()}
+		rtest.OK(t, be.Save(context.TODO(), h, restic.NewByteReader(data, nil)))
+
+		// the file must be synced before the rename, afterwards its directory
+		rtest.Equals(t, 1, len(*files))
+		rtest.Equals(t, filepath.Dir(be.Filename(h)), filepath.Dir((*files)[0]))
+		rtest.Equals(t, []string{filepath.Dir(be.Filename(h))}, *dirs)
+
+		*files, *dirs = nil, nil
+		rtest.OK(t, be.Remove(context.TODO(), h))
+		rtest.Equals(t, 0, len(*files))
+		rtest.Equals(t, []string{filepath.Dir(be.Filename(h))}, *dirs)
+	}
+}
+
+func TestSyncDisabled(t *testing.T) {
+	files, dirs := recordSyncs(t, nil)
+
+	cfg := NewConfig()
+	cfg.Path = rtest.TempDir(t)
+	cfg.Fsync = false
+	be, err := Create(context.TODO(), cfg)
+	rtest.OK(t, err)
+
+	data := []byte("foobar")
+	h := restic.Handle{Type: restic.PackFile, Name: restic.Hash(data).String()}
+	rtest.OK(t, be.Save(context.TODO(), h, restic.NewByteReader(data, nil)))
+	rtest.OK(t, be.Remove(context.TODO(), h))
+
+	rtest.Equals(t, 0, len(*files))
+	rtest.Equals(t, 0, len(*dirs))
+}
+
+func TestEnableSync(t *testing.T) {
+	files, dirs := recordSyncs(t, nil)
+
+	cfg := NewConfig()
+	cfg.Path = rtest.TempDir(t)
+	cfg.Fsync = false
+	be, err := Create(context.TODO(), cfg)
+	rtest.OK(t, err)
+	rtest.OK(t, be.EnableSync())
+
+	for _, tpe := range []restic.FileType{restic.LockFile, restic.SnapshotFile, restic.IndexFile, restic.PackFile, restic.KeyFile} {
+		*files, *dirs = nil, nil
+
+		data := []byte("foobar")
+		h := restic.Handle{Type: tpe, Name: restic.Hash(data).String()}
+		rtest.OK(t, be.Save(context.TODO(), h, restic.NewByteReader(data, nil)))
+
+		// the sync option overrides the fsync setting for all file types
+		rtest.Equals(t, 1, len(*files))
+		rtest.Equals(t, filepath.Dir(be.Filename(h)), filepath.Dir((*files)[0]))
+		rtest.Assert(t, contains(*dirs, filepath.Dir(be.Filename(h))), "directory of %v was not synced", tpe)
+	}
+}
+
+func TestSyncDirUnsupported(t *testing.T) {
+	files, dirs := recordSyncs(t, syscall.EINVAL)
+
+	cfg := NewConfig()
+	cfg.Path = rtest.TempDir(t)
+	be, err := Open(context.TODO(), cfg)
+	rtest.OK(t, err)
+
+	for i := 0; i < 3; i++ {
+		data := []byte(fmt.Sprintf("foobar %d", i))
+		h := restic.Handle{Type: restic.PackFile, Name: restic.Hash(data).String()}
+		rtest.OK(t, be.Save(context.TODO(), h, restic.NewByteReader(data, nil)))
+	}
+
+	// files are still synced, but syncing directories is only tried once
+	rtest.Equals(t, 3, len(*files))
+	rtest.Equals(t, 1, len(*dirs))
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func testCopyRange(t *testing.T) {
+	dir := rtest.TempDir(t)
+	be, err := Open(context.Background(), Config{Path: dir, Connections: 2})
+	rtest.OK(t, err)
+	defer func() {
+		rtest.OK(t, be.Close())
+	}()
+
+	data := rtest.Random(23, 5000)
+	id := restic.Hash(data)
+	h := restic.Handle{Type: restic.PackFile, Name: id.String()}
+	rtest.OK(t, be.Save(context.Background(), h, restic.NewByteReader(data, be.Hasher())))
+
+	for _, test := range []struct {
+		length int
+		offset int64
+	}{
+		{0, 0},
+		{0, 1234},
+		{100, 0},
+		{1000, 4000},
+		{1, 4999},
+	} {
+		f, err := os.CreateTemp(dir, "copy-range-")
+		rtest.OK(t, err)
+
+		rtest.OK(t, be.CopyRange(context.Background(), h, test.length, test.offset, f))
+
+		buf, err := os.ReadFile(f.Name())
+		rtest.OK(t, err)
+		rtest.OK(t, f.Close())
+
+		want := data[test.offset:]
+		if test.length > 0 {
+			want = want[:test.length]
+		}
+		rtest.Assert(t, bytes.Equal(buf, want), "wrong data for length %d offset %d", test.length, test.offset)
+	}
+}
+
+func TestCopyRange(t *testing.T) {
+	oldCopyRange := copyRange
+	defer func() {
+		copyRange = oldCopyRange
+	}()
+
+	var calls int
+	copyRange = func(dst, src *os.File, offset, length int64) error {
+		calls++
+		err := oldCopyRange(dst, src, offset, length)
+		if errors.Is(err, errCopyRangeUnsupported) {
+			t.Skip("copying file ranges is not supported here")
+		}
+		return err
+	}
+
+	testCopyRange(t)
+	rtest.Equals(t, 5, calls)
+}
+
+func TestCopyRangeFallback(t *testing.T) {
+	oldCopyRange := copyRange
+	defer func() {
+		copyRange = oldCopyRange
+	}()
+
+	copyRange = func(_, _ *os.File, _, _ int64) error {
+		return errCopyRangeUnsupported
+	}
+
+	testCopyRange(t)
+}
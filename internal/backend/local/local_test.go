@@ -4,10 +4,12 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
 
 	"github.com/restic/restic/internal/backend/local"
 	"github.com/restic/restic/internal/backend/test"
+	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
 )
 
@@ -108,3 +110,67 @@ func TestOpenNotExistingDirectory(t *testing.T) {
 	removeAll(t, filepath.Join(dir, "data"))
 	empty(t, dir)
 }
+
+func TestCreateModes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not supported on Windows")
+	}
+
+	parent := rtest.TempDir(t)
+	dir := filepath.Join(parent, "repo")
+	// new directories inherit the setgid bit on Linux, which must be kept
+	setgid := runtime.GOOS == "linux"
+	if setgid {
+		rtest.OK(t, os.Chmod(parent, 0700|os.ModeSetgid))
+	}
+
+	cfg := local.NewConfig()
+	cfg.Path = dir
+	cfg.FileMode = "0660"
+	cfg.DirMode = "0770"
+
+	be, err := local.Create(context.TODO(), cfg)
+	rtest.OK(t, err)
+	defer func() {
+		rtest.OK(t, be.Close())
+	}()
+
+	data := []byte("foobar")
+	h := restic.Handle{Type: restic.PackFile, Name: restic.Hash(data).String()}
+	rtest.OK(t, be.Save(context.TODO(), h, restic.NewByteReader(data, be.Hasher())))
+
+	// the write permissions are removed once a file is saved
+	for name, mode := range map[string]os.FileMode{
+		dir:                                    0770,
+		filepath.Join(dir, "data"):             0770,
+		filepath.Join(dir, "data", "ff"):       0770,
+		filepath.Join(dir, "snapshots"):        0770,
+		be.Filename(h):                         0440,
+		filepath.Join(dir, "data", h.Name[:2]): 0770,
+	} {
+		fi, err := os.Stat(name)
+		rtest.OK(t, err)
+		if fi.Mode().Perm() != mode {
+			t.Errorf("%v: wrong mode, want %v, got %v", name, mode, fi.Mode().Perm())
+		}
+		if setgid && fi.IsDir() && fi.Mode()&os.ModeSetgid == 0 {
+			t.Errorf("%v: setgid bit was removed", name)
+		}
+	}
+}
+
+func TestCreateModesInvalid(t *testing.T) {
+	dir := rtest.TempDir(t)
+	cfg := local.NewConfig()
+	cfg.Path = dir
+	cfg.DirMode = "0777"
+
+	_, err := local.Create(context.TODO(), cfg)
+	rtest.Assert(t, err != nil, "world-writable directory mode was accepted")
+	empty(t, dir)
+
+	cfg.InsecureModes = true
+	be, err := local.Create(context.TODO(), cfg)
+	rtest.OK(t, err)
+	rtest.OK(t, be.Close())
+}
@@ -20,12 +20,6 @@ func fsyncDir(dir string) error {
 	}
 
 	err = d.Sync()
-	if err != nil &&
-		(errors.Is(err, syscall.ENOTSUP) || errors.Is(err, syscall.ENOENT) ||
-			errors.Is(err, syscall.EINVAL) || isMacENOTTY(err)) {
-		err = nil
-	}
-
 	cerr := d.Close()
 	if err == nil {
 		err = cerr
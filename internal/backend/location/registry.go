@@ -4,7 +4,6 @@ import (
 	"context"
 	"net/http"
 
-	"github.com/restic/restic/internal/backend/limiter"
 	"github.com/restic/restic/internal/restic"
 )
 
@@ -33,16 +32,16 @@ type Factory interface {
 	Scheme() string
 	ParseConfig(s string) (interface{}, error)
 	StripPassword(s string) string
-	Create(ctx context.Context, cfg interface{}, rt http.RoundTripper, lim limiter.Limiter) (restic.Backend, error)
-	Open(ctx context.Context, cfg interface{}, rt http.RoundTripper, lim limiter.Limiter) (restic.Backend, error)
+	Create(ctx context.Context, cfg interface{}, rt http.RoundTripper) (restic.Backend, error)
+	Open(ctx context.Context, cfg interface{}, rt http.RoundTripper) (restic.Backend, error)
 }
 
 type genericBackendFactory[C any, T restic.Backend] struct {
 	scheme          string
 	parseConfigFn   func(s string) (*C, error)
 	stripPasswordFn func(s string) string
-	createFn        func(ctx context.Context, cfg C, rt http.RoundTripper, lim limiter.Limiter) (T, error)
-	openFn          func(ctx context.Context, cfg C, rt http.RoundTripper, lim limiter.Limiter) (T, error)
+	createFn        func(ctx context.Context, cfg C, rt http.RoundTripper) (T, error)
+	openFn          func(ctx context.Context, cfg C, rt http.RoundTripper) (T, error)
 }
 
 func (f *genericBackendFactory[C, T]) Scheme() string {
@@ -58,11 +57,11 @@ func (f *genericBackendFactory[C, T]) StripPassword(s string) string {
 	}
 	return s
 }
-func (f *genericBackendFactory[C, T]) Create(ctx context.Context, cfg interface{}, rt http.RoundTripper, lim limiter.Limiter) (restic.Backend, error) {
-	return f.createFn(ctx, *cfg.(*C), rt, lim)
+func (f *genericBackendFactory[C, T]) Create(ctx context.Context, cfg interface{}, rt http.RoundTripper) (restic.Backend, error) {
+	return f.createFn(ctx, *cfg.(*C), rt)
 }
-func (f *genericBackendFactory[C, T]) Open(ctx context.Context, cfg interface{}, rt http.RoundTripper, lim limiter.Limiter) (restic.Backend, error) {
-	return f.openFn(ctx, *cfg.(*C), rt, lim)
+func (f *genericBackendFactory[C, T]) Open(ctx context.Context, cfg interface{}, rt http.RoundTripper) (restic.Backend, error) {
+	return f.openFn(ctx, *cfg.(*C), rt)
 }
 
 func NewHTTPBackendFactory[C any, T restic.Backend](
@@ -76,31 +75,29 @@ func NewHTTPBackendFactory[C any, T restic.Backend](
 		scheme:          scheme,
 		parseConfigFn:   parseConfigFn,
 		stripPasswordFn: stripPasswordFn,
-		createFn: func(ctx context.Context, cfg C, rt http.RoundTripper, _ limiter.Limiter) (T, error) {
-			return createFn(ctx, cfg, rt)
-		},
-		openFn: func(ctx context.Context, cfg C, rt http.RoundTripper, _ limiter.Limiter) (T, error) {
-			return openFn(ctx, cfg, rt)
-		},
+		createFn:        createFn,
+		openFn:          openFn,
 	}
 }
 
-func NewLimitedBackendFactory[C any, T restic.Backend](
+// NewBackendFactory returns a factory for backends which do not use the HTTP
+// transport, for example because they access the local filesystem.
+func NewBackendFactory[C any, T restic.Backend](
 	scheme string,
 	parseConfigFn func(s string) (*C, error),
 	stripPasswordFn func(s string) string,
-	createFn func(ctx context.Context, cfg C, lim limiter.Limiter) (T, error),
-	openFn func(ctx context.Context, cfg C, lim limiter.Limiter) (T, error)) Factory {
+	createFn func(ctx context.Context, cfg C) (T, error),
+	openFn func(ctx context.Context, cfg C) (T, error)) Factory {
 
 	return &genericBackendFactory[C, T]{
 		scheme:          scheme,
 		parseConfigFn:   parseConfigFn,
 		stripPasswordFn: stripPasswordFn,
-		createFn: func(ctx context.Context, cfg C, _ http.RoundTripper, lim limiter.Limiter) (T, error) {
-			return createFn(ctx, cfg, lim)
+		createFn: func(ctx context.Context, cfg C, _ http.RoundTripper) (T, error) {
+			return createFn(ctx, cfg)
 		},
-		openFn: func(ctx context.Context, cfg C, _ http.RoundTripper, lim limiter.Limiter) (T, error) {
-			return openFn(ctx, cfg, lim)
+		openFn: func(ctx context.Context, cfg C, _ http.RoundTripper) (T, error) {
+			return openFn(ctx, cfg)
 		},
 	}
 }
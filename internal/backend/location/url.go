@@ -0,0 +1,116 @@
+package location
+
+import (
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// ParseURL parses the URL s of an HTTP based backend. In contrast to
+// url.Parse, the returned errors point at the invalid part of the URL and
+// never contain the password.
+func ParseURL(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err == nil {
+		// url.Parse accepts some invalid hosts, e.g. unbracketed IPv6 addresses
+		if err := CheckHostPort(u.Host); err != nil {
+			return nil, err
+		}
+		return u, nil
+	}
+
+	var inner error = err
+	var uerr *url.Error
+	if errors.As(err, &uerr) {
+		inner = uerr.Err
+	}
+
+	scheme, rest, ok := strings.Cut(s, "://")
+	if !ok {
+		return nil, errors.Errorf("invalid URL: %v", inner)
+	}
+
+	authority, remainder := rest, ""
+	if i := strings.IndexAny(rest, "/?#"); i >= 0 {
+		authority, remainder = rest[:i], rest[i:]
+	}
+
+	userinfo, hostport := "", authority
+	if i := strings.LastIndex(authority, "@"); i >= 0 {
+		userinfo, hostport = authority[:i], authority[i+1:]
+	} else if strings.Contains(remainder, "@") {
+		return nil, errors.New("invalid URL: the user name or password contains one of the characters '/', '?' or '#', which must be URL-encoded (e.g. %2F for '/')")
+	}
+
+	if userinfo != "" {
+		if _, err := url.Parse(scheme + "://" + userinfo + "@host"); err != nil {
+			return nil, errors.New("invalid user name or password in URL: special characters must be URL-encoded (e.g. %25 for '%')")
+		}
+	}
+
+	if err := CheckHostPort(hostport); err != nil {
+		return nil, err
+	}
+
+	if userinfo != "" {
+		// inner may quote parts of the URL, don't risk printing the password
+		return nil, errors.New("invalid URL")
+	}
+	return nil, errors.Errorf("invalid URL: %v", inner)
+}
+
+// CheckHostPort checks that hostport is a valid host name with an optional
+// port. IPv6 addresses must be enclosed in square brackets.
+func CheckHostPort(hostport string) error {
+	if strings.HasPrefix(hostport, "[") {
+		end := strings.Index(hostport, "]")
+		if end < 0 {
+			return errors.Errorf("invalid host %q: missing ']' after IPv6 address", hostport)
+		}
+
+		host, port := hostport[1:end], hostport[end+1:]
+		if err := checkIPv6(host); err != nil {
+			return err
+		}
+		if port == "" {
+			return nil
+		}
+		if !strings.HasPrefix(port, ":") {
+			return errors.Errorf("invalid host %q: unexpected %q after IPv6 address", hostport, port)
+		}
+		return checkPort(port[1:])
+	}
+
+	if strings.Count(hostport, ":") > 1 {
+		return errors.Errorf("invalid host %q: IPv6 addresses must be enclosed in square brackets, e.g. [%v]", hostport, hostport)
+	}
+
+	if _, port, ok := strings.Cut(hostport, ":"); ok {
+		return checkPort(port)
+	}
+	return nil
+}
+
+func checkIPv6(host string) error {
+	// strip the zone, e.g. "%eth0" (which is escaped as %25eth0 in URLs)
+	addr, _, _ := strings.Cut(host, "%")
+	ip := net.ParseIP(addr)
+	if ip == nil || !strings.Contains(addr, ":") {
+		return errors.Errorf("invalid IPv6 address %q", host)
+	}
+	return nil
+}
+
+func checkPort(port string) error {
+	if port == "" {
+		return nil
+	}
+	n, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || n == 0 {
+		return errors.Errorf("invalid port %q", port)
+	}
+	return nil
+}
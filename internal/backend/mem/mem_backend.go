@@ -79,7 +79,7 @@ func (be *MemoryBackend) Save(ctx context.Context, h restic.Handle, rd restic.Re
 	}
 
 	if _, ok := be.data[h]; ok {
-		return errors.New("file already exists")
+		return errors.WithStack(restic.ErrAlreadyExists)
 	}
 
 	buf, err := io.ReadAll(rd)
@@ -231,6 +231,11 @@ func (be *MemoryBackend) HasAtomicReplace() bool {
 	return false
 }
 
+// HasAtomicSave returns true, files are only stored once they are complete.
+func (be *MemoryBackend) HasAtomicSave() bool {
+	return true
+}
+
 // Delete removes all data in the backend.
 func (be *MemoryBackend) Delete(ctx context.Context) error {
 	be.m.Lock()
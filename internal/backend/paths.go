@@ -1,6 +1,11 @@
 package backend
 
-import "os"
+import (
+	"os"
+	"strconv"
+
+	"github.com/restic/restic/internal/errors"
+)
 
 type Modes struct {
 	Dir  os.FileMode
@@ -27,3 +32,37 @@ func DeriveModesFromFileInfo(fi os.FileInfo, err error) Modes {
 
 	return m
 }
+
+// ParseModes returns m with the file and directory modes replaced by the octal
+// numbers fileMode and dirMode, empty strings keep the corresponding mode.
+// Modes must grant full access to the owner, modes which grant write access
+// to others are rejected unless insecure is set.
+func ParseModes(m Modes, fileMode, dirMode string, insecure bool) (Modes, error) {
+	for _, opt := range []struct {
+		name  string
+		value string
+		owner os.FileMode
+		mode  *os.FileMode
+	}{
+		{"file-mode", fileMode, 0600, &m.File},
+		{"dir-mode", dirMode, 0700, &m.Dir},
+	} {
+		if opt.value == "" {
+			continue
+		}
+
+		mode, err := strconv.ParseUint(opt.value, 8, 32)
+		if err != nil || mode&^0777 != 0 {
+			return Modes{}, errors.Fatalf("invalid %v %q: must be an octal number between 0000 and 0777", opt.name, opt.value)
+		}
+		if os.FileMode(mode)&opt.owner != opt.owner {
+			return Modes{}, errors.Fatalf("invalid %v %04o: must grant at least %04o to the owner", opt.name, mode, opt.owner)
+		}
+		if mode&0002 != 0 && !insecure {
+			return Modes{}, errors.Fatalf("%v %04o allows others to modify the repository, set the option insecure-modes to use it anyway", opt.name, mode)
+		}
+		*opt.mode = os.FileMode(mode)
+	}
+
+	return m, nil
+}
@@ -0,0 +1,47 @@
+package backend_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/backend"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestParseModes(t *testing.T) {
+	for _, test := range []struct {
+		file, dir string
+		insecure  bool
+		modes     backend.Modes
+	}{
+		{"", "", false, backend.DefaultModes},
+		{"0640", "0750", false, backend.Modes{File: 0640, Dir: 0750}},
+		{"640", "", false, backend.Modes{File: 0640, Dir: 0700}},
+		{"", "0770", false, backend.Modes{File: 0600, Dir: 0770}},
+		{"0666", "0777", true, backend.Modes{File: 0666, Dir: 0777}},
+	} {
+		m, err := backend.ParseModes(backend.DefaultModes, test.file, test.dir, test.insecure)
+		rtest.OK(t, err)
+		rtest.Equals(t, test.modes, m)
+	}
+}
+
+func TestParseModesInvalid(t *testing.T) {
+	for _, test := range []struct {
+		file, dir string
+		err       string
+	}{
+		{"0648", "", `invalid file-mode "0648"`},
+		{"", "rwx", `invalid dir-mode "rwx"`},
+		{"", "01777", `invalid dir-mode "01777"`},
+		{"0440", "", "invalid file-mode 0440: must grant at least 0600 to the owner"},
+		{"", "0650", "invalid dir-mode 0650: must grant at least 0700 to the owner"},
+		{"0662", "", "file-mode 0662 allows others to modify the repository"},
+		{"", "0777", "dir-mode 0777 allows others to modify the repository"},
+	} {
+		_, err := backend.ParseModes(backend.DefaultModes, test.file, test.dir, false)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("modes %q %q: expected error containing %q, got %v", test.file, test.dir, test.err, err)
+		}
+	}
+}
@@ -12,13 +12,13 @@ import (
 	"net/url"
 	"os"
 	"os/exec"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
 	"github.com/restic/restic/internal/backend"
-	"github.com/restic/restic/internal/backend/limiter"
 	"github.com/restic/restic/internal/backend/location"
 	"github.com/restic/restic/internal/backend/rest"
 	"github.com/restic/restic/internal/debug"
@@ -33,16 +33,51 @@ type Backend struct {
 	cmd        *exec.Cmd
 	waitCh     <-chan struct{}
 	waitResult error
+	exitCh     chan struct{} // closed after rclone has exited and waitResult is set
 	wg         *sync.WaitGroup
 	conn       *StdioConn
+	output     *outputTail
 }
 
 func NewFactory() location.Factory {
-	return location.NewLimitedBackendFactory("rclone", ParseConfig, location.NoPassword, Create, Open)
+	return location.NewBackendFactory("rclone", ParseConfig, location.NoPassword, Create, Open)
 }
 
-// run starts command with args and initializes the StdioConn.
-func run(command string, args ...string) (*StdioConn, *sync.WaitGroup, chan struct{}, func() error, error) {
+// maxOutputLines is the number of lines printed by rclone which are kept for
+// error messages.
+const maxOutputLines = 20
+
+// outputTail keeps the last lines printed by rclone to stderr.
+type outputTail struct {
+	m     sync.Mutex
+	lines []string
+}
+
+func (o *outputTail) add(line string) {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	if len(o.lines) == maxOutputLines {
+		o.lines = o.lines[1:]
+	}
+	o.lines = append(o.lines, line)
+}
+
+// String returns the captured output formatted for appending it to an error
+// message, or an empty string if rclone did not print anything.
+func (o *outputTail) String() string {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	if len(o.lines) == 0 {
+		return ""
+	}
+	return "\nrclone output:\n  " + strings.Join(o.lines, "\n  ")
+}
+
+// run starts command with args and initializes the StdioConn. All lines
+// printed by the command to stderr are also added to output.
+func run(output *outputTail, command string, args ...string) (*StdioConn, *sync.WaitGroup, chan struct{}, func() error, error) {
 	cmd := exec.Command(command, args...)
 
 	p, err := cmd.StderrPipe()
@@ -61,6 +96,7 @@ func run(command string, args ...string) (*StdioConn, *sync.WaitGroup, chan stru
 		sc := bufio.NewScanner(p)
 		for sc.Scan() {
 			fmt.Fprintf(os.Stderr, "rclone: %v\n", sc.Text())
+			output.add(sc.Text())
 		}
 		debug.Log("command has exited, closing waitCh")
 	}()
@@ -108,38 +144,8 @@ func run(command string, args ...string) (*StdioConn, *sync.WaitGroup, chan stru
 	return c, &wg, waitCh, bg, nil
 }
 
-// wrappedConn adds bandwidth limiting capabilities to the StdioConn by
-// wrapping the Read/Write methods.
-type wrappedConn struct {
-	*StdioConn
-	io.Reader
-	io.Writer
-}
-
-func (c *wrappedConn) Read(p []byte) (int, error) {
-	return c.Reader.Read(p)
-}
-
-func (c *wrappedConn) Write(p []byte) (int, error) {
-	return c.Writer.Write(p)
-}
-
-func wrapConn(c *StdioConn, lim limiter.Limiter) *wrappedConn {
-	wc := &wrappedConn{
-		StdioConn: c,
-		Reader:    c,
-		Writer:    c,
-	}
-	if lim != nil {
-		wc.Reader = lim.Downstream(c)
-		wc.Writer = lim.UpstreamWriter(c)
-	}
-
-	return wc
-}
-
 // New initializes a Backend and starts the process.
-func newBackend(ctx context.Context, cfg Config, lim limiter.Limiter) (*Backend, error) {
+func newBackend(ctx context.Context, cfg Config) (*Backend, error) {
 	var (
 		args []string
 		err  error
@@ -169,16 +175,12 @@ func newBackend(ctx context.Context, cfg Config, lim limiter.Limiter) (*Backend,
 	arg0, args := args[0], args[1:]
 
 	debug.Log("running command: %v %v", arg0, args)
-	stdioConn, wg, waitCh, bg, err := run(arg0, args...)
+	output := &outputTail{}
+	stdioConn, wg, waitCh, bg, err := run(output, arg0, args...)
 	if err != nil {
 		return nil, err
 	}
 
-	var conn net.Conn = stdioConn
-	if lim != nil {
-		conn = wrapConn(stdioConn, lim)
-	}
-
 	dialCount := 0
 	tr := &http2.Transport{
 		AllowHTTP: true, // this is not really HTTP, just stdin/stdout
@@ -189,7 +191,7 @@ func newBackend(ctx context.Context, cfg Config, lim limiter.Limiter) (*Backend,
 				return nil, backoff.Permanent(errors.New("rclone stdio connection already closed"))
 			}
 			dialCount++
-			return conn, nil
+			return stdioConn, nil
 		},
 	}
 
@@ -198,8 +200,10 @@ func newBackend(ctx context.Context, cfg Config, lim limiter.Limiter) (*Backend,
 		tr:     tr,
 		cmd:    cmd,
 		waitCh: waitCh,
+		exitCh: make(chan struct{}),
 		conn:   stdioConn,
 		wg:     wg,
+		output: output,
 	}
 
 	ctx, cancel := context.WithCancel(ctx)
@@ -215,6 +219,7 @@ func newBackend(ctx context.Context, cfg Config, lim limiter.Limiter) (*Backend,
 		err := cmd.Wait()
 		debug.Log("Wait returned %v", err)
 		be.waitResult = err
+		close(be.exitCh)
 		// close our side of the pipes to rclone, ignore errors
 		_ = stdioConn.CloseAll()
 	}()
@@ -222,14 +227,20 @@ func newBackend(ctx context.Context, cfg Config, lim limiter.Limiter) (*Backend,
 	// send an HTTP request to the base URL, see if the server is there
 	client := http.Client{
 		Transport: debug.RoundTripper(tr),
-		Timeout:   cfg.Timeout,
+	}
+
+	reqCtx := ctx
+	if cfg.Timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		reqCtx, cancelTimeout = context.WithTimeout(ctx, cfg.Timeout)
+		defer cancelTimeout()
 	}
 
 	// request a random file which does not exist. we just want to test when
 	// rclone is able to accept HTTP requests.
 	url := fmt.Sprintf("http://localhost/file-%d", rand.Uint64())
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -243,12 +254,17 @@ func newBackend(ctx context.Context, cfg Config, lim limiter.Limiter) (*Backend,
 
 		// wait for rclone to exit
 		wg.Wait()
+
+		if errors.Is(reqCtx.Err(), context.DeadlineExceeded) {
+			return nil, errors.Errorf("rclone did not respond within %v, use -o rclone.timeout to wait longer%v", cfg.Timeout, output)
+		}
+
 		// try to return the program exit code if communication with rclone has failed
 		if be.waitResult != nil && (errors.Is(err, context.Canceled) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.EPIPE) || errors.Is(err, os.ErrClosed)) {
 			err = be.waitResult
 		}
 
-		return nil, fmt.Errorf("error talking HTTP to rclone: %w", err)
+		return nil, fmt.Errorf("error talking HTTP to rclone: %w%v", err, output)
 	}
 
 	debug.Log("HTTP status %q returned, moving instance to background", res.Status)
@@ -260,9 +276,45 @@ func newBackend(ctx context.Context, cfg Config, lim limiter.Limiter) (*Backend,
 	return be, nil
 }
 
+// exitError returns an error if the rclone process has exited.
+func (be *Backend) exitError() error {
+	select {
+	case <-be.exitCh:
+	default:
+		return nil
+	}
+
+	if be.waitResult != nil {
+		return backoff.Permanent(fmt.Errorf("rclone exited unexpectedly: %w%v", be.waitResult, be.output))
+	}
+	return backoff.Permanent(fmt.Errorf("rclone exited unexpectedly%v", be.output))
+}
+
+// exitTransport fails all requests once the rclone process has exited,
+// instead of trying to talk to it over the already closed connection.
+type exitTransport struct {
+	rt http.RoundTripper
+	be *Backend
+}
+
+func (t *exitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.be.exitError(); err != nil {
+		return nil, err
+	}
+
+	res, err := t.rt.RoundTrip(req)
+	if err != nil {
+		// report the exit of rclone instead of the resulting connection error
+		if exitErr := t.be.exitError(); exitErr != nil {
+			return nil, exitErr
+		}
+	}
+	return res, err
+}
+
 // Open starts an rclone process with the given config.
-func Open(ctx context.Context, cfg Config, lim limiter.Limiter) (*Backend, error) {
-	be, err := newBackend(ctx, cfg, lim)
+func Open(ctx context.Context, cfg Config) (*Backend, error) {
+	be, err := newBackend(ctx, cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -277,7 +329,7 @@ func Open(ctx context.Context, cfg Config, lim limiter.Limiter) (*Backend, error
 		URL:         url,
 	}
 
-	restBackend, err := rest.Open(ctx, restConfig, debug.RoundTripper(be.tr))
+	restBackend, err := rest.Open(ctx, restConfig, debug.RoundTripper(&exitTransport{rt: be.tr, be: be}))
 	if err != nil {
 		_ = be.Close()
 		return nil, err
@@ -288,8 +340,8 @@ func Open(ctx context.Context, cfg Config, lim limiter.Limiter) (*Backend, error
 }
 
 // Create initializes a new restic repo with rclone.
-func Create(ctx context.Context, cfg Config, lim limiter.Limiter) (*Backend, error) {
-	be, err := newBackend(ctx, cfg, lim)
+func Create(ctx context.Context, cfg Config) (*Backend, error) {
+	be, err := newBackend(ctx, cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -306,7 +358,7 @@ func Create(ctx context.Context, cfg Config, lim limiter.Limiter) (*Backend, err
 		URL:         url,
 	}
 
-	restBackend, err := rest.Create(ctx, restConfig, debug.RoundTripper(be.tr))
+	restBackend, err := rest.Create(ctx, restConfig, debug.RoundTripper(&exitTransport{rt: be.tr, be: be}))
 	if err != nil {
 		_ = be.Close()
 		return nil, err
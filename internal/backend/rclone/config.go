@@ -10,11 +10,11 @@ import (
 
 // Config contains all configuration necessary to start rclone.
 type Config struct {
-	Program     string `option:"program" help:"path to rclone (default: rclone)"`
-	Args        string `option:"args"    help:"arguments for running rclone (default: serve restic --stdio --b2-hard-delete)"`
+	Program     string `option:"program" help:"path to rclone"`
+	Args        string `option:"args"    help:"arguments for running rclone"`
 	Remote      string
-	Connections uint          `option:"connections" help:"set a limit for the number of concurrent connections (default: 5)"`
-	Timeout     time.Duration `option:"timeout"     help:"set a timeout limit to wait for rclone to establish a connection (default: 1m)"`
+	Connections uint          `option:"connections" help:"set a limit for the number of concurrent connections"`
+	Timeout     time.Duration `option:"timeout"     help:"set a timeout limit to wait for rclone to establish a connection"`
 }
 
 var defaultConfig = Config{
@@ -25,7 +25,7 @@ var defaultConfig = Config{
 }
 
 func init() {
-	options.Register("rclone", Config{})
+	options.Register("rclone", NewConfig())
 }
 
 // NewConfig returns a new Config with the default values filled in.
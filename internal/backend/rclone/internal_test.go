@@ -2,8 +2,14 @@ package rclone
 
 import (
 	"context"
+	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
@@ -15,7 +21,7 @@ func TestRcloneExit(t *testing.T) {
 	dir := rtest.TempDir(t)
 	cfg := NewConfig()
 	cfg.Remote = dir
-	be, err := Open(context.TODO(), cfg, nil)
+	be, err := Open(context.TODO(), cfg)
 	var e *exec.Error
 	if errors.As(err, &e) && e.Err == exec.ErrNotFound {
 		t.Skipf("program %q not found", e.Name)
@@ -45,10 +51,63 @@ func TestRcloneFailedStart(t *testing.T) {
 	cfg := NewConfig()
 	// exits with exit code 1
 	cfg.Program = "false"
-	_, err := Open(context.TODO(), cfg, nil)
+	_, err := Open(context.TODO(), cfg)
 	var e *exec.ExitError
 	if !errors.As(err, &e) {
 		// unexpected error
 		rtest.OK(t, err)
 	}
 }
+
+// writeScript creates a fake rclone program which runs the shell script.
+func writeScript(t *testing.T, script string) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell scripts are not supported on Windows")
+	}
+
+	filename := filepath.Join(rtest.TempDir(t), "rclone")
+	rtest.OK(t, os.WriteFile(filename, []byte("#!/bin/sh\n"+script), 0700))
+	return filename
+}
+
+// restic should not wait forever for rclone to answer.
+func TestRcloneStartTimeout(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Program = writeScript(t, "echo 'waiting for reauthentication' >&2\nexec sleep 60\n")
+	cfg.Args = ""
+	cfg.Timeout = 500 * time.Millisecond
+
+	start := time.Now()
+	_, err := Open(context.TODO(), cfg)
+	rtest.Assert(t, err != nil, "expected an error")
+	rtest.Assert(t, time.Since(start) < 30*time.Second, "Open did not respect the timeout")
+	rtest.Assert(t, strings.Contains(err.Error(), "did not respond within 500ms"), "unexpected error: %v", err)
+	rtest.Assert(t, strings.Contains(err.Error(), "waiting for reauthentication"), "rclone output missing from error: %v", err)
+}
+
+// restic should report the output of rclone if it exits during startup.
+func TestRcloneStartExit(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Program = writeScript(t, "echo 'config file not found' >&2\nexit 3\n")
+	cfg.Args = ""
+
+	_, err := Open(context.TODO(), cfg)
+	var e *exec.ExitError
+	rtest.Assert(t, errors.As(err, &e), "expected exit error, got %v", err)
+	rtest.Equals(t, 3, e.ExitCode())
+	rtest.Assert(t, strings.Contains(err.Error(), "config file not found"), "rclone output missing from error: %v", err)
+}
+
+func TestOutputTail(t *testing.T) {
+	var o outputTail
+	rtest.Equals(t, "", o.String())
+
+	for i := 0; i < maxOutputLines+5; i++ {
+		o.add(fmt.Sprintf("line %d", i))
+	}
+
+	lines := strings.Split(o.String(), "\n  ")
+	rtest.Equals(t, maxOutputLines+1, len(lines))
+	rtest.Equals(t, "line 5", lines[1])
+	rtest.Equals(t, fmt.Sprintf("line %d", maxOutputLines+4), lines[maxOutputLines])
+}
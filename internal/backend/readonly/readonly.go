@@ -0,0 +1,52 @@
+// Package readonly implements a backend wrapper which refuses all operations
+// that modify the repository, including creating and removing lock files.
+package readonly
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// ErrReadOnly is returned for operations which would modify the repository.
+var ErrReadOnly = errors.New("not allowed in read-only mode")
+
+// Backend rejects all operations which modify the repository.
+type Backend struct {
+	restic.Backend
+}
+
+// statically ensure that Backend implements restic.Backend.
+var _ restic.Backend = &Backend{}
+
+// New returns a backend which only allows reading from be.
+func New(be restic.Backend) *Backend {
+	return &Backend{Backend: be}
+}
+
+// reject returns a permanent error, retrying the operation is pointless.
+func reject(op string, h restic.Handle) error {
+	return backoff.Permanent(fmt.Errorf("%v %v: %w", op, h, ErrReadOnly))
+}
+
+// Save refuses to store any file.
+func (be *Backend) Save(_ context.Context, h restic.Handle, _ restic.RewindReader) error {
+	return reject("saving", h)
+}
+
+// Remove refuses to remove any file.
+func (be *Backend) Remove(_ context.Context, h restic.Handle) error {
+	return reject("removing", h)
+}
+
+// Delete refuses to remove the repository.
+func (be *Backend) Delete(_ context.Context) error {
+	return backoff.Permanent(fmt.Errorf("deleting the repository: %w", ErrReadOnly))
+}
+
+func (be *Backend) Unwrap() restic.Backend {
+	return be.Backend
+}
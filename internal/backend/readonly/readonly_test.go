@@ -0,0 +1,43 @@
+package readonly_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/mem"
+	"github.com/restic/restic/internal/backend/readonly"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func save(be restic.Backend, h restic.Handle, data []byte) error {
+	return be.Save(context.TODO(), h, restic.NewByteReader(data, be.Hasher()))
+}
+
+func TestReadOnly(t *testing.T) {
+	mbe := mem.New()
+	be := readonly.New(mbe)
+
+	data := rtest.Random(23, 100)
+	for _, tpe := range []restic.FileType{restic.PackFile, restic.IndexFile, restic.SnapshotFile, restic.KeyFile, restic.LockFile, restic.ConfigFile} {
+		h := restic.Handle{Type: tpe, Name: restic.Hash(data).String()}
+		err := save(be, h, data)
+		rtest.Assert(t, errors.Is(err, readonly.ErrReadOnly), "unexpected error for saving %v: %v", h, err)
+		_, err = mbe.Stat(context.TODO(), h)
+		rtest.Assert(t, mbe.IsNotExist(err), "file %v was saved", h)
+
+		// existing files can be read but not removed
+		rtest.OK(t, save(mbe, h, data))
+		err = be.Remove(context.TODO(), h)
+		rtest.Assert(t, errors.Is(err, readonly.ErrReadOnly), "unexpected error for removing %v: %v", h, err)
+
+		buf, err := backend.LoadAll(context.TODO(), nil, be, h)
+		rtest.OK(t, err)
+		rtest.Equals(t, data, buf)
+	}
+
+	err := be.Delete(context.TODO())
+	rtest.Assert(t, errors.Is(err, readonly.ErrReadOnly), "unexpected error for deleting the repository: %v", err)
+}
@@ -4,6 +4,7 @@ import (
 	"net/url"
 	"strings"
 
+	"github.com/restic/restic/internal/backend/location"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/options"
 )
@@ -11,11 +12,11 @@ import (
 // Config contains all configuration necessary to connect to a REST server.
 type Config struct {
 	URL         *url.URL
-	Connections uint `option:"connections" help:"set a limit for the number of concurrent connections (default: 5)"`
+	Connections uint `option:"connections" help:"set a limit for the number of concurrent connections"`
 }
 
 func init() {
-	options.Register("rest", Config{})
+	options.Register("rest", NewConfig())
 }
 
 // NewConfig returns a new Config with the default values filled in.
@@ -33,7 +34,7 @@ func ParseConfig(s string) (*Config, error) {
 
 	s = prepareURL(s)
 
-	u, err := url.Parse(s)
+	u, err := location.ParseURL(s)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -59,8 +60,10 @@ func StripPassword(s string) string {
 		return scheme + s
 	}
 
-	// a password was set: we replace it with ***
-	return scheme + strings.Replace(u.String(), u.User.String()+"@", u.User.Username()+":***@", 1)
+	// a password was set: we replace it with ***, the user name is kept in
+	// its escaped form so that the result is still a valid URL
+	user, _, _ := strings.Cut(u.User.String(), ":")
+	return scheme + strings.Replace(u.String(), u.User.String()+"@", user+":***@", 1)
 }
 
 func prepareURL(s string) string {
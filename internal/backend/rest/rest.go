@@ -117,6 +117,12 @@ func (b *Backend) HasAtomicReplace() bool {
 	return false
 }
 
+// HasAtomicSave returns true, rest-server writes files to a temporary name
+// and renames them once the upload has completed.
+func (b *Backend) HasAtomicSave() bool {
+	return true
+}
+
 // Save stores data in the backend at the handle.
 func (b *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
 	ctx, cancel := context.WithCancel(ctx)
@@ -147,6 +153,13 @@ func (b *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindRea
 		return errors.WithStack(err)
 	}
 
+	if resp.StatusCode == http.StatusForbidden {
+		// rest-server refuses to overwrite existing files, but 403 is also
+		// returned e.g. for append-only violations or by proxies
+		if _, serr := b.Stat(ctx, h); serr == nil {
+			return errors.Wrapf(restic.ErrAlreadyExists, "server response unexpected: %v (%v)", resp.Status, resp.StatusCode)
+		}
+	}
 	if resp.StatusCode != http.StatusOK {
 		return errors.Errorf("server response unexpected: %v (%v)", resp.Status, resp.StatusCode)
 	}
@@ -2,6 +2,7 @@ package rest_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -148,3 +149,52 @@ func TestListAPI(t *testing.T) {
 		})
 	}
 }
+
+func TestSaveForbidden(t *testing.T) {
+	for _, exists := range []bool{true, false} {
+		t.Run(fmt.Sprintf("exists=%v", exists), func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				switch req.Method {
+				case "POST":
+					res.WriteHeader(http.StatusForbidden)
+				case "HEAD":
+					if !exists {
+						res.WriteHeader(http.StatusNotFound)
+						return
+					}
+					res.Header().Set("Content-Length", "4")
+					res.WriteHeader(http.StatusOK)
+				default:
+					t.Errorf("unhandled request %v %v", req.Method, req.URL.Path)
+				}
+			}))
+			defer srv.Close()
+
+			srvURL, err := url.Parse(srv.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			be, err := rest.Open(context.TODO(), rest.Config{Connections: 5, URL: srvURL}, http.DefaultTransport)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				err = be.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+			}()
+
+			h := restic.Handle{Type: restic.PackFile, Name: restic.NewRandomID().String()}
+			err = be.Save(context.TODO(), h, restic.NewByteReader([]byte("test"), nil))
+			if err == nil {
+				t.Fatal("expected an error, got nil")
+			}
+			// a 403 response only means that the file exists if it can be found
+			if errors.Is(err, restic.ErrAlreadyExists) != exists {
+				t.Fatalf("unexpected error %v", err)
+			}
+		})
+	}
+}
@@ -4,10 +4,12 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"os"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
 	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
 )
 
@@ -15,13 +17,24 @@ import (
 // backoff.
 type Backend struct {
 	restic.Backend
+	// MaxTries is the number of retries after a failed operation. Zero
+	// disables retries, a negative value retries until the context is
+	// cancelled or its deadline is exceeded.
 	MaxTries int
+	// MaxDelay is the maximum delay between two tries. If it is zero, the
+	// default of the backoff package is used.
+	MaxDelay time.Duration
 	Report   func(string, error, time.Duration)
 	Success  func(string, int)
+
+	// timer is used to wait between retries, if it is nil a timer based on
+	// the system clock is used.
+	timer backoff.Timer
 }
 
 // statically ensure that RetryBackend implements restic.Backend.
 var _ restic.Backend = &Backend{}
+var _ restic.RangeCopier = &Backend{}
 
 // New wraps be with a backend that retries operations after a
 // backoff. report is called with a description and the error, if one occurred.
@@ -38,9 +51,9 @@ func New(be restic.Backend, maxTries int, report func(string, error, time.Durati
 
 // retryNotifyErrorWithSuccess is an extension of backoff.RetryNotify with notification of success after an error.
 // success is NOT notified on the first run of operation (only after an error).
-func retryNotifyErrorWithSuccess(operation backoff.Operation, b backoff.BackOff, notify backoff.Notify, success func(retries int)) error {
+func retryNotifyErrorWithSuccess(operation backoff.Operation, b backoff.BackOff, notify backoff.Notify, success func(retries int), t backoff.Timer) error {
 	if success == nil {
-		return backoff.RetryNotify(operation, b, notify)
+		return backoff.RetryNotifyWithTimer(operation, b, notify, t)
 	}
 	retries := 0
 	operationWrapper := func() error {
@@ -52,7 +65,23 @@ func retryNotifyErrorWithSuccess(operation backoff.Operation, b backoff.BackOff,
 		}
 		return err
 	}
-	return backoff.RetryNotify(operationWrapper, b, notify)
+	return backoff.RetryNotifyWithTimer(operationWrapper, b, notify, t)
+}
+
+// maxDelayBackOff limits the delays returned by a backoff to max. This also
+// applies to the randomized delays which can exceed the maximum interval of
+// backoff.ExponentialBackOff.
+type maxDelayBackOff struct {
+	backoff.BackOff
+	max time.Duration
+}
+
+func (b *maxDelayBackOff) NextBackOff() time.Duration {
+	next := b.BackOff.NextBackOff()
+	if next > b.max {
+		return b.max
+	}
+	return next
 }
 
 var fastRetries = false
@@ -69,13 +98,25 @@ func (be *Backend) retry(ctx context.Context, msg string, f func() error) error
 	}
 
 	bo := backoff.NewExponentialBackOff()
+	// the number of retries is only limited by MaxTries and the context
+	bo.MaxElapsedTime = 0
 	if fastRetries {
 		// speed up integration tests
 		bo.InitialInterval = 1 * time.Millisecond
 	}
 
+	var b backoff.BackOff = bo
+	if be.MaxDelay > 0 {
+		bo.MaxInterval = be.MaxDelay
+		b = &maxDelayBackOff{BackOff: b, max: be.MaxDelay}
+	}
+	if be.MaxTries >= 0 {
+		b = backoff.WithMaxRetries(b, uint64(be.MaxTries))
+	}
+
+	// the backoff aborts waiting as soon as the context is cancelled
 	err := retryNotifyErrorWithSuccess(f,
-		backoff.WithContext(backoff.WithMaxRetries(bo, uint64(be.MaxTries)), ctx),
+		backoff.WithContext(b, ctx),
 		func(err error, d time.Duration) {
 			if be.Report != nil {
 				be.Report(msg, err, d)
@@ -86,6 +127,7 @@ func (be *Backend) retry(ctx context.Context, msg string, f func() error) error
 				be.Success(msg, retries)
 			}
 		},
+		be.timer,
 	)
 
 	return err
@@ -96,7 +138,9 @@ func (be *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindRe
 	return be.retry(ctx, fmt.Sprintf("Save(%v)", h), func() error {
 		err := rd.Rewind()
 		if err != nil {
-			return err
+			// the data is lost, retrying cannot succeed
+			debug.Log("Save(%v) cannot rewind reader: %v", h, err)
+			return backoff.Permanent(err)
 		}
 
 		err = be.Backend.Save(ctx, h, rd)
@@ -104,6 +148,12 @@ func (be *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindRe
 			return nil
 		}
 
+		if errors.Is(err, restic.ErrAlreadyExists) {
+			// the existing file must not be removed, it was not written by us
+			debug.Log("Save(%v) failed, file already exists: %v", h, err)
+			return backoff.Permanent(err)
+		}
+
 		if be.Backend.HasAtomicReplace() {
 			debug.Log("Save(%v) failed with error: %v", h, err)
 			// there is no need to remove files from backends which can atomically replace files
@@ -125,13 +175,44 @@ func (be *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindRe
 // given offset. If length is larger than zero, only a portion of the file
 // is returned. rd must be closed after use. If an error is returned, the
 // ReadCloser must be nil.
+//
+// If the backend returns fewer than length bytes, the remainder is requested
+// with an adjusted range instead of loading the whole range again. The
+// consumer reads the assembled data.
 func (be *Backend) Load(ctx context.Context, h restic.Handle, length int, offset int64, consumer func(rd io.Reader) error) (err error) {
 	return be.retry(ctx, fmt.Sprintf("Load(%v, %v, %v)", h, length, offset),
 		func() error {
-			return be.Backend.Load(ctx, h, length, offset, consumer)
+			if length <= 0 {
+				return be.Backend.Load(ctx, h, length, offset, consumer)
+			}
+
+			return be.Backend.Load(ctx, h, length, offset, func(rd io.Reader) error {
+				r := &resumingReader{ctx: ctx, be: be, h: h, length: length, offset: offset, rd: rd}
+				defer r.stop()
+				return consumer(r)
+			})
 		})
 }
 
+// CopyRange copies a range of the file at h to dst. The data copied by a
+// failed try is discarded before the copy is retried.
+func (be *Backend) CopyRange(ctx context.Context, h restic.Handle, length int, offset int64, dst *os.File) error {
+	start, err := dst.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	return be.retry(ctx, fmt.Sprintf("CopyRange(%v, %v, %v)", h, length, offset), func() error {
+		if err := dst.Truncate(start); err != nil {
+			return backoff.Permanent(err)
+		}
+		if _, err := dst.Seek(start, io.SeekStart); err != nil {
+			return backoff.Permanent(err)
+		}
+		return restic.CopyRange(ctx, be.Backend, h, length, offset, dst)
+	})
+}
+
 // Stat returns information about the File identified by h.
 func (be *Backend) Stat(ctx context.Context, h restic.Handle) (fi restic.FileInfo, err error) {
 	err = be.retry(ctx, fmt.Sprintf("Stat(%v)", h),
@@ -3,12 +3,18 @@ package retry
 import (
 	"bytes"
 	"context"
+	"crypto/md5"
+	"fmt"
 	"io"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
+	"github.com/restic/restic/internal/backend/limiter"
 	"github.com/restic/restic/internal/backend/mock"
+	"github.com/restic/restic/internal/backend/watchdog"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/test"
@@ -83,6 +89,30 @@ func TestBackendSaveRetryAtomic(t *testing.T) {
 	}
 }
 
+func TestBackendSaveAlreadyExists(t *testing.T) {
+	calls := 0
+	calledRemove := false
+	be := &mock.Backend{
+		SaveFn: func(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+			calls++
+			return errors.Wrap(restic.ErrAlreadyExists, "injected error")
+		},
+		RemoveFn: func(ctx context.Context, h restic.Handle) error {
+			calledRemove = true
+			return nil
+		},
+		HasAtomicReplaceFn: func() bool { return false },
+	}
+
+	TestFastRetries(t)
+	retryBackend := New(be, 10, nil, nil)
+
+	err := retryBackend.Save(context.TODO(), restic.Handle{}, restic.NewByteReader([]byte("foo"), be.Hasher()))
+	test.Assert(t, errors.Is(err, restic.ErrAlreadyExists), "expected ErrAlreadyExists, got %v", err)
+	test.Equals(t, 1, calls)
+	test.Assert(t, !calledRemove, "the existing file must not be removed")
+}
+
 func TestBackendListRetry(t *testing.T) {
 	const (
 		ID1 = "id1"
@@ -274,6 +304,52 @@ func TestBackendLoadRetry(t *testing.T) {
 	test.Equals(t, 2, attempt)
 }
 
+// rangeCopyBackend implements restic.RangeCopier using CopyRangeFn.
+type rangeCopyBackend struct {
+	*mock.Backend
+	CopyRangeFn func(ctx context.Context, h restic.Handle, length int, offset int64, dst *os.File) error
+}
+
+func (be *rangeCopyBackend) CopyRange(ctx context.Context, h restic.Handle, length int, offset int64, dst *os.File) error {
+	return be.CopyRangeFn(ctx, h, length, offset, dst)
+}
+
+func TestBackendCopyRangeRetry(t *testing.T) {
+	data := test.Random(23, 1024)
+	attempt := 0
+
+	be := &rangeCopyBackend{Backend: mock.NewBackend()}
+	be.CopyRangeFn = func(ctx context.Context, h restic.Handle, length int, offset int64, dst *os.File) error {
+		// copy only a part of the data on the first invocation
+		attempt++
+		if attempt == 1 {
+			_, err := dst.Write(data[:100])
+			test.OK(t, err)
+			return errors.New("copy failed")
+		}
+		_, err := dst.Write(data)
+		return err
+	}
+
+	TestFastRetries(t)
+	retryBackend := New(be, 10, nil, nil)
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "copy"))
+	test.OK(t, err)
+	defer func() {
+		_ = f.Close()
+	}()
+	_, err = f.Write([]byte("prefix"))
+	test.OK(t, err)
+
+	test.OK(t, retryBackend.CopyRange(context.TODO(), restic.Handle{}, 0, 0, f))
+	test.Equals(t, 2, attempt)
+
+	buf, err := os.ReadFile(f.Name())
+	test.OK(t, err)
+	test.Equals(t, append([]byte("prefix"), data...), buf)
+}
+
 func TestBackendStatNotExists(t *testing.T) {
 	// stat should not retry if the error matches IsNotExist
 	notFound := errors.New("not found")
@@ -347,7 +423,7 @@ func TestNotifyWithSuccessIsNotCalled(t *testing.T) {
 		t.Fatal("Success should not have been called")
 	}
 
-	err := retryNotifyErrorWithSuccess(operation, &backoff.ZeroBackOff{}, notify, success)
+	err := retryNotifyErrorWithSuccess(operation, &backoff.ZeroBackOff{}, notify, success, nil)
 	if err != nil {
 		t.Fatal("retry should not have returned an error")
 	}
@@ -373,7 +449,7 @@ func TestNotifyWithSuccessIsCalled(t *testing.T) {
 		successCalled++
 	}
 
-	err := retryNotifyErrorWithSuccess(operation, &backoff.ZeroBackOff{}, notify, success)
+	err := retryNotifyErrorWithSuccess(operation, &backoff.ZeroBackOff{}, notify, success, nil)
 	if err != nil {
 		t.Fatal("retry should not have returned an error")
 	}
@@ -386,3 +462,366 @@ func TestNotifyWithSuccessIsCalled(t *testing.T) {
 		t.Fatalf("Success should have been called only once, but was called %d times instead", successCalled)
 	}
 }
+
+// fakeTimer records the requested delays. It fires immediately if fire is
+// set, otherwise it never fires.
+type fakeTimer struct {
+	c      chan time.Time
+	fire   bool
+	delays []time.Duration
+}
+
+func newFakeTimer(fire bool) *fakeTimer {
+	return &fakeTimer{c: make(chan time.Time, 1), fire: fire}
+}
+
+func (t *fakeTimer) Start(d time.Duration) {
+	t.delays = append(t.delays, d)
+	if t.fire {
+		t.c <- time.Time{}
+	}
+}
+
+func (t *fakeTimer) Stop() {}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+// disableFastRetries restores the regular retry delays for the current test.
+func disableFastRetries(t *testing.T) {
+	old := fastRetries
+	fastRetries = false
+	t.Cleanup(func() {
+		fastRetries = old
+	})
+}
+
+// newFailingBackend returns a backend for which Remove fails failures times
+// before it succeeds, returning err. The number of calls is counted in calls.
+func newFailingBackend(failures int, err error, calls *int) *mock.Backend {
+	be := mock.NewBackend()
+	be.RemoveFn = func(ctx context.Context, h restic.Handle) error {
+		*calls++
+		if *calls <= failures {
+			return err
+		}
+		return nil
+	}
+	return be
+}
+
+func TestBackendRetryDelays(t *testing.T) {
+	disableFastRetries(t)
+
+	var calls int
+	retryBackend := New(newFailingBackend(100, errors.New("failure"), &calls), 10, nil, nil)
+	retryBackend.MaxDelay = 3 * time.Second
+	timer := newFakeTimer(true)
+	retryBackend.timer = timer
+
+	err := retryBackend.Remove(context.TODO(), restic.Handle{Type: restic.PackFile, Name: "foo"})
+	test.Assert(t, err != nil, "missing error")
+	test.Equals(t, 11, calls)
+	test.Equals(t, 10, len(timer.delays))
+
+	// the delays grow exponentially with some randomization until they are capped
+	interval := 500 * time.Millisecond
+	for i, d := range timer.delays {
+		lower := time.Duration(float64(interval) * (1 - backoff.DefaultRandomizationFactor))
+		upper := time.Duration(float64(interval) * (1 + backoff.DefaultRandomizationFactor))
+		if upper > retryBackend.MaxDelay {
+			upper = retryBackend.MaxDelay
+		}
+		test.Assert(t, lower <= d && d <= upper, "delay %d is %v, expected delay between %v and %v", i, d, lower, upper)
+
+		interval = time.Duration(float64(interval) * backoff.DefaultMultiplier)
+		if interval > retryBackend.MaxDelay {
+			interval = retryBackend.MaxDelay
+		}
+	}
+}
+
+func TestBackendRetryCount(t *testing.T) {
+	for _, tc := range []struct {
+		maxTries int
+		failures int
+		calls    int
+		fail     bool
+	}{
+		{0, 1, 1, true},
+		{3, 2, 3, false},
+		{3, 5, 4, true},
+		{-1, 50, 51, false},
+	} {
+		t.Run(fmt.Sprintf("%d", tc.maxTries), func(t *testing.T) {
+			var calls, successRetries int
+			retryBackend := New(newFailingBackend(tc.failures, errors.New("failure"), &calls), tc.maxTries, nil,
+				func(_ string, retries int) {
+					successRetries = retries
+				})
+			retryBackend.timer = newFakeTimer(true)
+
+			err := retryBackend.Remove(context.TODO(), restic.Handle{Type: restic.PackFile, Name: "foo"})
+			if tc.fail {
+				test.Assert(t, err != nil, "missing error")
+			} else {
+				test.OK(t, err)
+				test.Equals(t, tc.failures, successRetries)
+			}
+			test.Equals(t, tc.calls, calls)
+		})
+	}
+}
+
+func TestBackendRetryPermanentError(t *testing.T) {
+	var calls int
+	retryBackend := New(newFailingBackend(100, backoff.Permanent(errors.New("failure")), &calls), -1, nil, nil)
+	retryBackend.timer = newFakeTimer(true)
+
+	err := retryBackend.Remove(context.TODO(), restic.Handle{Type: restic.PackFile, Name: "foo"})
+	test.Assert(t, err != nil, "missing error")
+	test.Equals(t, 1, calls)
+}
+
+func TestBackendRetryCancel(t *testing.T) {
+	disableFastRetries(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var calls int
+	// cancel the context while waiting for the first retry, the timer never fires
+	retryBackend := New(newFailingBackend(100, errors.New("failure"), &calls), -1,
+		func(string, error, time.Duration) {
+			cancel()
+		}, nil)
+	retryBackend.timer = newFakeTimer(false)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- retryBackend.Remove(ctx, restic.Handle{Type: restic.PackFile, Name: "foo"})
+	}()
+
+	select {
+	case err := <-done:
+		assertIsCanceled(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("retry did not abort after the context was cancelled")
+	}
+	test.Equals(t, 1, calls)
+}
+
+type rewindFailReader struct {
+	restic.RewindReader
+}
+
+func (rd rewindFailReader) Rewind() error {
+	return &restic.RewindError{Err: errors.New("injected rewind error")}
+}
+
+func TestBackendSaveRewindFailure(t *testing.T) {
+	calls := 0
+	be := &mock.Backend{
+		SaveFn: func(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+			calls++
+			return errors.New("injected error")
+		},
+	}
+
+	TestFastRetries(t)
+	retryBackend := New(be, 10, nil, nil)
+
+	rd := rewindFailReader{restic.NewByteReader([]byte("foobar"), nil)}
+	err := retryBackend.Save(context.TODO(), restic.Handle{}, rd)
+	test.Assert(t, restic.IsRewindError(err), "expected rewind error, got %v", err)
+	// the reader cannot be rewound before the first attempt, no save must happen
+	test.Equals(t, 0, calls)
+}
+
+// TestBackendSaveRetryPartialRead checks that a Save which is retried after
+// the data was partially consumed uploads the correct data, for all readers
+// and the wrappers applied to them.
+func TestBackendSaveRetryPartialRead(t *testing.T) {
+	data := test.Random(42, 1024*1024+123)
+	wantHash := md5.Sum(data)
+
+	filename := filepath.Join(test.TempDir(t), "data")
+	test.OK(t, os.WriteFile(filename, data, 0600))
+	f, err := os.Open(filename)
+	test.OK(t, err)
+	defer func() {
+		test.OK(t, f.Close())
+	}()
+
+	readers := map[string]func() restic.RewindReader{
+		"bytes": func() restic.RewindReader {
+			return restic.NewByteReader(data, md5.New())
+		},
+		"file": func() restic.RewindReader {
+			rd, err := restic.NewFileReader(f, wantHash[:])
+			test.OK(t, err)
+			return rd
+		},
+	}
+	wrappers := map[string]func(restic.Backend) restic.Backend{
+		"none": func(be restic.Backend) restic.Backend { return be },
+		"limiter": func(be restic.Backend) restic.Backend {
+			return limiter.LimitBackend(be, limiter.NewStaticLimiter(limiter.Limits{UploadKb: 1 << 20}))
+		},
+		"watchdog": func(be restic.Backend) restic.Backend {
+			return watchdog.New(be, watchdog.Config{StuckTimeout: time.Minute})
+		},
+	}
+
+	TestFastRetries(t)
+	for rdName, newReader := range readers {
+		for wrapName, wrap := range wrappers {
+			// backends like s3 wrap the reader to hash the uploaded data
+			for _, backendHashing := range []bool{false, true} {
+				t.Run(fmt.Sprintf("%v-%v-%v", rdName, wrapName, backendHashing), func(t *testing.T) {
+					calls := 0
+					var uploaded []byte
+					be := &mock.Backend{
+						SaveFn: func(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+							calls++
+							var hrd *restic.HashingRewindReader
+							if backendHashing {
+								hrd = restic.NewHashingRewindReader(rd, md5.New())
+								rd = hrd
+							}
+
+							if calls == 1 {
+								_, err := io.CopyN(io.Discard, rd, 4096)
+								test.OK(t, err)
+								return errors.New("injected error")
+							}
+
+							buf, err := io.ReadAll(rd)
+							if err != nil {
+								return err
+							}
+							if int64(len(buf)) != rd.Length() {
+								return errors.Errorf("wrong length, want %d, got %d", rd.Length(), len(buf))
+							}
+							if hrd != nil && !bytes.Equal(hrd.Sum(nil), rd.Hash()) {
+								return errors.New("hash of uploaded data does not match")
+							}
+							uploaded = buf
+							return nil
+						},
+					}
+
+					// a hashing reader around the whole operation must only
+					// cover the data of the last attempt
+					hrd := restic.NewHashingRewindReader(newReader(), md5.New())
+					retryBackend := New(wrap(be), 10, nil, nil)
+					test.OK(t, retryBackend.Save(context.TODO(), restic.Handle{}, hrd))
+
+					test.Equals(t, 2, calls)
+					test.Equals(t, len(data), len(uploaded))
+					test.Assert(t, bytes.Equal(data, uploaded), "wrong data uploaded")
+					test.Equals(t, wantHash[:], hrd.Sum(nil))
+				})
+			}
+		}
+	}
+}
+
+type loadRequest struct {
+	length int
+	offset int64
+}
+
+// newTruncatingBackend returns a backend which serves data and truncates the
+// response of the i-th request to cuts[i] bytes. requests records all
+// requests.
+func newTruncatingBackend(data []byte, cuts []int, requests *[]loadRequest) *mock.Backend {
+	be := mock.NewBackend()
+	be.OpenReaderFn = func(ctx context.Context, h restic.Handle, length int, offset int64) (io.ReadCloser, error) {
+		*requests = append(*requests, loadRequest{length, offset})
+		buf := data[offset:]
+		if length > 0 && length < len(buf) {
+			buf = buf[:length]
+		}
+		if i := len(*requests) - 1; i < len(cuts) && cuts[i] < len(buf) {
+			buf = buf[:cuts[i]]
+		}
+		return io.NopCloser(bytes.NewReader(buf)), nil
+	}
+	return be
+}
+
+func TestBackendLoadShortRead(t *testing.T) {
+	data := test.Random(23, 64*1024)
+	TestFastRetries(t)
+
+	for _, tc := range []struct {
+		name     string
+		length   int
+		offset   int64
+		cuts     []int
+		requests []loadRequest
+	}{
+		{"none", 1000, 100, nil, []loadRequest{{1000, 100}}},
+		{"once", 1000, 100, []int{300}, []loadRequest{{1000, 100}, {700, 400}}},
+		{"twice", 50000, 5, []int{10000, 0, 25000}, []loadRequest{{50000, 5}, {40000, 10005}, {40000, 10005}, {15000, 35005}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var requests []loadRequest
+			be := New(newTruncatingBackend(data, tc.cuts, &requests), 10, nil, nil)
+
+			var buf []byte
+			err := be.Load(context.TODO(), restic.Handle{Type: restic.PackFile, Name: "foo"}, tc.length, tc.offset, func(rd io.Reader) (err error) {
+				buf, err = io.ReadAll(rd)
+				return err
+			})
+			test.OK(t, err)
+			test.Equals(t, data[tc.offset:tc.offset+int64(tc.length)], buf)
+			test.Equals(t, tc.requests, requests)
+		})
+	}
+}
+
+func TestBackendLoadShortReadLimit(t *testing.T) {
+	data := test.Random(23, 1000)
+	TestFastRetries(t)
+
+	var requests []loadRequest
+	// all requests return at most 10 bytes
+	cuts := make([]int, 100)
+	for i := range cuts {
+		cuts[i] = 10
+	}
+	var reported []string
+	be := New(newTruncatingBackend(data, cuts, &requests), 2, func(msg string, err error, d time.Duration) {
+		reported = append(reported, msg)
+	}, nil)
+
+	err := be.Load(context.TODO(), restic.Handle{Type: restic.PackFile, Name: "foo"}, 500, 0, func(rd io.Reader) error {
+		_, err := io.ReadAll(rd)
+		return err
+	})
+	test.Assert(t, errors.Is(err, io.ErrUnexpectedEOF), "unexpected error %v", err)
+	// each of the three tries requests the remainder twice
+	test.Equals(t, 9, len(requests))
+	test.Equals(t, loadRequest{480, 20}, requests[2])
+	test.Equals(t, 8, len(reported))
+}
+
+func TestBackendLoadShortReadConsumerReturns(t *testing.T) {
+	data := test.Random(23, 1000)
+
+	var requests []loadRequest
+	be := New(newTruncatingBackend(data, []int{10}, &requests), 10, nil, nil)
+
+	err := be.Load(context.TODO(), restic.Handle{Type: restic.PackFile, Name: "foo"}, 1000, 0, func(rd io.Reader) error {
+		// stop reading within the remainder
+		buf := make([]byte, 20)
+		_, err := io.ReadFull(rd, buf)
+		test.Equals(t, data[:20], buf)
+		return err
+	})
+	test.OK(t, err)
+	test.Equals(t, []loadRequest{{1000, 0}, {990, 10}}, requests)
+}
@@ -0,0 +1,105 @@
+package retry
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// maxShortReadResumes is the number of times the remainder of a ranged load
+// is requested if MaxTries is negative.
+const maxShortReadResumes = 10
+
+// errResumeAborted is used to stop the load of the remainder once the
+// consumer has returned.
+var errResumeAborted = errors.New("consumer has returned")
+
+// resumingReader reads the data of a ranged load. If the backend ends the
+// response before length bytes were received, the remainder is requested
+// with an adjusted range, such that the consumer sees the complete data.
+type resumingReader struct {
+	ctx    context.Context
+	be     *Backend
+	h      restic.Handle
+	length int
+	offset int64
+
+	rd       io.Reader
+	received int
+	resumes  int
+	// pr and done belong to the load of the remainder, if one is running
+	pr   *io.PipeReader
+	done chan struct{}
+}
+
+func (r *resumingReader) maxResumes() int {
+	if r.be.MaxTries < 0 {
+		return maxShortReadResumes
+	}
+	return r.be.MaxTries
+}
+
+func (r *resumingReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.rd.Read(p)
+		r.received += n
+		if (err != io.EOF && err != io.ErrUnexpectedEOF) || r.received >= r.length {
+			return n, err
+		}
+
+		// short read, the backend has returned less than requested
+		if r.resumes >= r.maxResumes() {
+			return n, errors.Wrapf(io.ErrUnexpectedEOF, "Load(%v, %v, %v): short read, got %d bytes after %d retries",
+				r.h, r.length, r.offset, r.received, r.resumes)
+		}
+		r.resumes++
+		if r.be.Report != nil {
+			r.be.Report(fmt.Sprintf("Load(%v, %v, %v)", r.h, r.length, r.offset),
+				errors.Wrapf(io.ErrUnexpectedEOF, "short read after %d bytes", r.received), 0)
+		}
+		r.resume()
+
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// resume requests the data which has not been received yet.
+func (r *resumingReader) resume() {
+	r.stop()
+
+	remaining := r.length - r.received
+	offset := r.offset + int64(r.received)
+	debug.Log("Load(%v, %v, %v) returned %d bytes, loading remaining %d bytes at offset %d",
+		r.h, r.length, r.offset, r.received, remaining, offset)
+
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := r.be.Backend.Load(r.ctx, r.h, remaining, offset, func(rd io.Reader) error {
+			_, err := io.Copy(pw, rd)
+			return err
+		})
+		// a nil error closes the pipe with io.EOF
+		_ = pw.CloseWithError(err)
+	}()
+
+	r.rd, r.pr, r.done = pr, pr, done
+}
+
+// stop aborts the load of the remainder, if one is running, and waits for it
+// to finish.
+func (r *resumingReader) stop() {
+	if r.pr == nil {
+		return
+	}
+	_ = r.pr.CloseWithError(errResumeAborted)
+	<-r.done
+	r.pr, r.done = nil, nil
+}
@@ -1,11 +1,11 @@
 package s3
 
 import (
-	"net/url"
 	"os"
 	"path"
 	"strings"
 
+	"github.com/restic/restic/internal/backend/location"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/options"
 	"github.com/restic/restic/internal/restic"
@@ -23,11 +23,15 @@ type Config struct {
 	Layout       string `option:"layout" help:"use this backend layout (default: auto-detect)"`
 	StorageClass string `option:"storage-class" help:"set S3 storage class (STANDARD, STANDARD_IA, ONEZONE_IA, INTELLIGENT_TIERING or REDUCED_REDUNDANCY)"`
 
-	Connections   uint   `option:"connections" help:"set a limit for the number of concurrent connections (default: 5)"`
+	Connections   uint   `option:"connections" help:"set a limit for the number of concurrent connections"`
 	MaxRetries    uint   `option:"retries" help:"set the number of retries attempted"`
 	Region        string `option:"region" help:"set region"`
 	BucketLookup  string `option:"bucket-lookup" help:"bucket lookup style: 'auto', 'dns', or 'path'"`
 	ListObjectsV1 bool   `option:"list-objects-v1" help:"use deprecated V1 api for ListObjects calls"`
+	NoVerifyETag  bool   `option:"no-verify-etag" help:"do not compare the ETag returned for an upload with the MD5 of the data (required for SSE-KMS or SSE-C encrypted buckets)"`
+	RequesterPays bool   `option:"requester-pays" help:"send requests with the header which confirms that the requester pays for the requests (required for requester pays buckets)"`
+	WarmupTier    string `option:"warmup-tier" help:"retrieval tier for warming up files in cold storage (Standard, Bulk or Expedited, default: Standard)"`
+	WarmupDays    uint   `option:"warmup-days" help:"number of days warmed up files stay available (default: 7)"`
 }
 
 // NewConfig returns a new Config with the default values filled in.
@@ -39,7 +43,7 @@ func NewConfig() Config {
 }
 
 func init() {
-	options.Register("s3", Config{})
+	options.Register("s3", NewConfig())
 }
 
 // ParseConfig parses the string s and extracts the s3 config. The two
@@ -52,7 +56,7 @@ func ParseConfig(s string) (*Config, error) {
 		// assume that a URL has been specified, parse it and
 		// use the host as the endpoint and the path as the
 		// bucket name and prefix
-		url, err := url.Parse(s[3:])
+		url, err := location.ParseURL(s[3:])
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
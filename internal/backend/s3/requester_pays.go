@@ -0,0 +1,59 @@
+package s3
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/signer"
+)
+
+// requesterPaysTransport adds the header to all requests which confirms that
+// the requester pays for requests to a requester pays bucket. S3 requires all
+// x-amz-* headers to be signed, so requests which were already signed using
+// signature V4 are signed again.
+type requesterPaysTransport struct {
+	rt    http.RoundTripper
+	creds *credentials.Credentials
+}
+
+func (t *requesterPaysTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("X-Amz-Request-Payer", "requester")
+
+	if region, ok := signatureV4Region(req.Header.Get("Authorization")); ok {
+		v, err := t.creds.Get()
+		if err != nil {
+			return nil, err
+		}
+		req = signer.SignV4(*req, v.AccessKeyID, v.SecretAccessKey, v.SessionToken, region)
+	}
+
+	return t.rt.RoundTrip(req)
+}
+
+// signatureV4Region extracts the region from the credential scope of an
+// Authorization header for signature V4, which looks like this:
+//
+//	AWS4-HMAC-SHA256 Credential=<key>/<date>/<region>/s3/aws4_request, SignedHeaders=..., Signature=...
+func signatureV4Region(auth string) (string, bool) {
+	const algorithm = "AWS4-HMAC-SHA256 "
+	if !strings.HasPrefix(auth, algorithm) {
+		return "", false
+	}
+
+	for _, param := range strings.Split(auth[len(algorithm):], ",") {
+		key, scope, _ := strings.Cut(strings.TrimSpace(param), "=")
+		if key != "Credential" {
+			continue
+		}
+
+		parts := strings.Split(scope, "/")
+		if len(parts) != 5 {
+			return "", false
+		}
+		return parts[2], true
+	}
+
+	return "", false
+}
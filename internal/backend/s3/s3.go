@@ -2,6 +2,8 @@ package s3
 
 import (
 	"context"
+	"crypto/md5"
+	"encoding/hex"
 	"fmt"
 	"hash"
 	"io"
@@ -18,6 +20,7 @@ import (
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
 
+	"github.com/cenkalti/backoff/v4"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 )
@@ -32,6 +35,12 @@ type Backend struct {
 // make sure that *Backend implements backend.Backend
 var _ restic.Backend = &Backend{}
 
+// make sure that *Backend implements restic.Warmer
+var _ restic.Warmer = &Backend{}
+
+// make sure that *Backend implements layout.Mover
+var _ layout.Mover = &Backend{}
+
 func NewFactory() location.Factory {
 	return location.NewHTTPBackendFactory("s3", ParseConfig, location.NoPassword, Create, Open)
 }
@@ -87,6 +96,10 @@ func open(ctx context.Context, cfg Config, rt http.RoundTripper) (*Backend, erro
 		debug.Log("using anonymous access for %#v", cfg.Endpoint)
 	}
 
+	if cfg.RequesterPays {
+		rt = &requesterPaysTransport{rt: rt, creds: creds}
+	}
+
 	options := &minio.Options{
 		Creds:     creds,
 		Secure:    !cfg.UseHTTP,
@@ -105,6 +118,18 @@ func open(ctx context.Context, cfg Config, rt http.RoundTripper) (*Backend, erro
 		return nil, fmt.Errorf(`bad bucket-lookup style %q must be "auto", "path" or "dns"`, cfg.BucketLookup)
 	}
 
+	switch minio.TierType(cfg.WarmupTier) {
+	case "":
+		cfg.WarmupTier = string(minio.TierStandard)
+	case minio.TierStandard, minio.TierBulk, minio.TierExpedited:
+	default:
+		return nil, fmt.Errorf(`bad warmup-tier %q must be "Standard", "Bulk" or "Expedited"`, cfg.WarmupTier)
+	}
+
+	if cfg.WarmupDays == 0 {
+		cfg.WarmupDays = 7
+	}
+
 	client, err := minio.New(cfg.Endpoint, options)
 	if err != nil {
 		return nil, errors.Wrap(err, "minio.New")
@@ -151,8 +176,8 @@ func Create(ctx context.Context, cfg Config, rt http.RoundTripper) (restic.Backe
 	}
 
 	if !found {
-		// create new bucket with default ACL in default region
-		err = be.client.MakeBucket(ctx, cfg.Bucket, minio.MakeBucketOptions{})
+		// create new bucket with default ACL in the configured region
+		err = be.client.MakeBucket(ctx, cfg.Bucket, minio.MakeBucketOptions{Region: cfg.Region})
 		if err != nil {
 			return nil, errors.Wrap(err, "client.MakeBucket")
 		}
@@ -169,6 +194,23 @@ func isAccessDenied(err error) bool {
 	return errors.As(err, &e) && e.Code == "AccessDenied"
 }
 
+// explainAccessDenied adds the details reported by the server to an access
+// denied error, along with a hint about the requester pays setting, which is
+// a common cause for such errors.
+func explainAccessDenied(cfg Config, err error) error {
+	var e minio.ErrorResponse
+	if !errors.As(err, &e) || e.Code != "AccessDenied" {
+		return err
+	}
+
+	hint := "if this is a requester pays bucket, use -o s3.requester-pays=true"
+	if cfg.RequesterPays {
+		hint = "the bucket may not allow requests paid by the requester"
+	}
+
+	return fmt.Errorf("%w (code %v, status %d, request ID %q), %v", err, e.Code, e.StatusCode, e.RequestID, hint)
+}
+
 // IsNotExist returns true if the error is caused by a not existing file.
 func (be *Backend) IsNotExist(err error) bool {
 	var e minio.ErrorResponse
@@ -266,6 +308,12 @@ func (be *Backend) HasAtomicReplace() bool {
 	return true
 }
 
+// HasAtomicSave returns true, objects only become visible once the upload
+// has completed.
+func (be *Backend) HasAtomicSave() bool {
+	return true
+}
+
 // Path returns the path in the bucket that is used for this backend.
 func (be *Backend) Path() string {
 	return be.cfg.Prefix
@@ -281,15 +329,33 @@ func (be *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindRe
 	opts.SendContentMd5 = true
 	// only use multipart uploads for very large files
 	opts.PartSize = 200 * 1024 * 1024
+	// the streaming signature for uploads via HTTP cannot be signed again to
+	// include the requester pays header
+	opts.DisableContentSha256 = be.cfg.RequesterPays
 
-	info, err := be.client.PutObject(ctx, be.cfg.Bucket, objName, io.NopCloser(rd), int64(rd.Length()), opts)
+	hrd := restic.NewHashingRewindReader(rd, md5.New())
+	info, err := be.client.PutObject(ctx, be.cfg.Bucket, objName, io.NopCloser(hrd), int64(rd.Length()), opts)
+	if err != nil {
+		return errors.Wrap(explainAccessDenied(be.cfg, err), "client.PutObject")
+	}
 
 	// sanity check
-	if err == nil && info.Size != rd.Length() {
+	if info.Size != rd.Length() {
 		return errors.Errorf("wrote %d bytes instead of the expected %d bytes", info.Size, rd.Length())
 	}
 
-	return errors.Wrap(err, "client.PutObject")
+	// the ETag of single part uploads is the MD5 hash of the data unless
+	// server-side encryption with custom keys is used
+	if !be.cfg.NoVerifyETag && uint64(rd.Length()) < opts.PartSize {
+		etag, err := hex.DecodeString(info.ETag)
+		if err != nil || len(etag) != md5.Size {
+			debug.Log("Save(%v): ETag %q is not an MD5 hash, skipping verification", h, info.ETag)
+			return nil
+		}
+		return backend.VerifyUploadChecksum(h, "MD5", hrd.Sum(nil), etag)
+	}
+
+	return nil
 }
 
 // Load runs fn with a reader that yields the contents of the file at h at the
@@ -319,12 +385,67 @@ func (be *Backend) openReader(ctx context.Context, h restic.Handle, length int,
 	coreClient := minio.Core{Client: be.client}
 	rd, _, _, err := coreClient.GetObject(ctx, be.cfg.Bucket, objName, opts)
 	if err != nil {
-		return nil, err
+		return nil, explainColdStorage(explainAccessDenied(be.cfg, err))
 	}
 
 	return rd, err
 }
 
+// explainColdStorage marks the error returned when reading a file which is
+// stored in a cold storage class. Retrying cannot succeed until the file was
+// warmed up, thus the error is permanent.
+func explainColdStorage(err error) error {
+	var e minio.ErrorResponse
+	if !errors.As(err, &e) || e.Code != "InvalidObjectState" {
+		return err
+	}
+
+	return backoff.Permanent(fmt.Errorf("%w: %v", restic.ErrColdStorage, err))
+}
+
+// isColdStorageClass returns true if objects in the storage class must be
+// restored before they can be read.
+func isColdStorageClass(class string) bool {
+	switch class {
+	case "GLACIER", "DEEP_ARCHIVE":
+		return true
+	}
+	return false
+}
+
+// WarmupFile requests a temporary copy of the file at h if it is stored in a
+// cold storage class. It returns true if the file can already be read.
+func (be *Backend) WarmupFile(ctx context.Context, h restic.Handle) (bool, error) {
+	objName := be.Filename(h)
+
+	info, err := be.client.StatObject(ctx, be.cfg.Bucket, objName, minio.StatObjectOptions{})
+	if err != nil {
+		return false, errors.Wrap(err, "client.StatObject")
+	}
+
+	// StatObject does not fill in info.StorageClass, so use the header
+	if !isColdStorageClass(info.Metadata.Get("X-Amz-Storage-Class")) {
+		return true, nil
+	}
+
+	if info.Restore != nil {
+		// a restore was already requested
+		return !info.Restore.OngoingRestore, nil
+	}
+
+	debug.Log("requesting restore of %v with tier %v", objName, be.cfg.WarmupTier)
+
+	req := minio.RestoreRequest{}
+	req.SetDays(int(be.cfg.WarmupDays))
+	req.SetGlacierJobParameters(minio.GlacierJobParameters{Tier: minio.TierType(be.cfg.WarmupTier)})
+	err = be.client.RestoreObject(ctx, be.cfg.Bucket, objName, "", req)
+	if err != nil {
+		return false, errors.Wrap(err, "client.RestoreObject")
+	}
+
+	return false, nil
+}
+
 // Stat returns information about a blob.
 func (be *Backend) Stat(ctx context.Context, h restic.Handle) (bi restic.FileInfo, err error) {
 	objName := be.Filename(h)
@@ -347,7 +468,7 @@ func (be *Backend) Stat(ctx context.Context, h restic.Handle) (bi restic.FileInf
 
 	fi, err := obj.Stat()
 	if err != nil {
-		return restic.FileInfo{}, errors.Wrap(err, "Stat")
+		return restic.FileInfo{}, errors.Wrap(explainAccessDenied(be.cfg, err), "Stat")
 	}
 
 	return restic.FileInfo{Size: fi.Size, Name: h.Name}, nil
@@ -392,7 +513,7 @@ func (be *Backend) List(ctx context.Context, t restic.FileType, fn func(restic.F
 
 	for obj := range listresp {
 		if obj.Err != nil {
-			return obj.Err
+			return explainAccessDenied(be.cfg, obj.Err)
 		}
 
 		m := strings.TrimPrefix(obj.Key, prefix)
@@ -430,9 +551,20 @@ func (be *Backend) Delete(ctx context.Context) error {
 // Close does nothing
 func (be *Backend) Close() error { return nil }
 
-// Rename moves a file based on the new layout l.
-func (be *Backend) Rename(ctx context.Context, h restic.Handle, l layout.Layout) error {
-	debug.Log("Rename %v to %v", h, l)
+// NewLayout returns the layout with the given name for the bucket and prefix
+// used by this backend.
+func (be *Backend) NewLayout(name string) (layout.Layout, error) {
+	return layout.NewLayout(name, be.cfg.Prefix, be.Join)
+}
+
+// SetLayout changes the layout used by the backend.
+func (be *Backend) SetLayout(l layout.Layout) {
+	be.Layout = l
+}
+
+// MoveToLayout moves a file based on the new layout l.
+func (be *Backend) MoveToLayout(ctx context.Context, h restic.Handle, l layout.Layout) error {
+	debug.Log("MoveToLayout %v to %v", h, l)
 	oldname := be.Filename(h)
 	newname := l.Filename(h)
 
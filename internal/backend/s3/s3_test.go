@@ -1,20 +1,29 @@
 package s3_test
 
 import (
+	"bytes"
 	"context"
+	"crypto/md5"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/backend/location"
+	"github.com/restic/restic/internal/backend/retry"
 	"github.com/restic/restic/internal/backend/s3"
 	"github.com/restic/restic/internal/backend/test"
 	"github.com/restic/restic/internal/options"
@@ -232,3 +241,367 @@ func BenchmarkBackendS3(t *testing.B) {
 	t.Logf("run tests")
 	newS3TestSuite().RunBenchmarks(t)
 }
+
+// newFakeS3Server returns a server which accepts uploads and responds with the
+// MD5 hash of the received data as ETag. If wrongETag is set, a bit in the ETag
+// is flipped.
+func newFakeS3Server(t testing.TB, wrongETag bool, uploads *int) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+			data = decodeAWSChunked(data)
+		}
+		*uploads++
+
+		sum := md5.Sum(data)
+		if wrongETag {
+			sum[0] ^= 0x01
+		}
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// decodeAWSChunked strips the chunk headers from a body sent with
+// aws-chunked encoding.
+func decodeAWSChunked(body []byte) []byte {
+	var data []byte
+	for len(body) > 0 {
+		header, rest, _ := bytes.Cut(body, []byte("\r\n"))
+		sizeHex, _, _ := bytes.Cut(header, []byte(";"))
+		size, err := strconv.ParseInt(string(sizeHex), 16, 64)
+		if err != nil || size == 0 || int64(len(rest)) < size {
+			break
+		}
+		data = append(data, rest[:size]...)
+		body = bytes.TrimPrefix(rest[size:], []byte("\r\n"))
+	}
+	return data
+}
+
+func TestSaveVerifyETag(t *testing.T) {
+	retry.TestFastRetries(t)
+
+	for _, test := range []struct {
+		name         string
+		wrongETag    bool
+		noVerifyETag bool
+		uploads      int
+		fail         bool
+	}{
+		{"valid", false, false, 1, false},
+		{"mismatch", true, false, 3, true},
+		{"mismatch-no-verify", true, true, 1, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var uploads int
+			srv := newFakeS3Server(t, test.wrongETag, &uploads)
+
+			cfg, err := s3.ParseConfig("s3:" + srv.URL + "/bucket/prefix")
+			rtest.OK(t, err)
+			cfg.KeyID = "key"
+			cfg.Secret = options.NewSecretString("secret")
+			cfg.Region = "us-east-1"
+			cfg.Layout = "default"
+			cfg.NoVerifyETag = test.noVerifyETag
+
+			be, err := s3.Open(context.TODO(), *cfg, http.DefaultTransport)
+			rtest.OK(t, err)
+			be = retry.New(be, 2, nil, nil)
+
+			data := rtest.Random(23, 1000)
+			h := restic.Handle{Type: restic.PackFile, Name: restic.Hash(data).String()}
+			err = be.Save(context.TODO(), h, restic.NewByteReader(data, be.Hasher()))
+			if test.fail {
+				rtest.Assert(t, err != nil, "Save did not fail with mismatching ETag")
+			} else {
+				rtest.OK(t, err)
+			}
+			rtest.Equals(t, test.uploads, uploads)
+		})
+	}
+}
+
+// requestInfo contains the details of a request received by the fake server.
+type requestInfo struct {
+	method        string
+	path          string
+	payer         string
+	signedHeaders string
+	region        string
+}
+
+// newRecordingS3Server returns a server which implements the parts of the S3
+// API used by restic for a single object. All requests are recorded. If
+// requirePayer is set, requests without the requester pays header are
+// rejected.
+func newRecordingS3Server(t testing.TB, requirePayer bool) (*httptest.Server, *[]requestInfo) {
+	var (
+		m        sync.Mutex
+		requests []requestInfo
+		data     []byte
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := requestInfo{
+			method: r.Method,
+			path:   r.URL.Path,
+			payer:  r.Header.Get("X-Amz-Request-Payer"),
+		}
+		for _, param := range strings.Split(r.Header.Get("Authorization"), ",") {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			switch key {
+			case "SignedHeaders":
+				info.signedHeaders = value
+			case "AWS4-HMAC-SHA256 Credential":
+				info.region = strings.Split(value, "/")[2]
+			}
+		}
+
+		m.Lock()
+		defer m.Unlock()
+		requests = append(requests, info)
+
+		if requirePayer && info.payer != "requester" {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>AccessDenied</Code><Message>Access Denied</Message><RequestId>4711</RequestId></Error>`)
+			return
+		}
+
+		_, object, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		switch {
+		case r.Method == http.MethodPut:
+			buf, err := io.ReadAll(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			data = buf
+			sum := md5.Sum(data)
+			w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+		case r.Method == http.MethodGet && object == "":
+			w.Header().Set("Content-Type", "application/xml")
+			_, _ = fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><ListBucketResult><Name>bucket</Name><Prefix>%s</Prefix><KeyCount>1</KeyCount><IsTruncated>false</IsTruncated><Contents><Key>%skey</Key><Size>%d</Size></Contents></ListBucketResult>`,
+				r.URL.Query().Get("prefix"), r.URL.Query().Get("prefix"), len(data))
+		case r.Method == http.MethodGet || r.Method == http.MethodHead:
+			sum := md5.Sum(data)
+			w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+			w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			if r.Method == http.MethodGet {
+				_, _ = w.Write(data)
+			}
+		case r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotImplemented)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestRequesterPays(t *testing.T) {
+	srv, requests := newRecordingS3Server(t, true)
+
+	cfg, err := s3.ParseConfig("s3:" + srv.URL + "/bucket/prefix")
+	rtest.OK(t, err)
+	rtest.OK(t, options.Options{
+		"requester-pays": "true",
+		"region":         "eu-west-1",
+		"bucket-lookup":  "path",
+		"layout":         "default",
+	}.Apply("s3", cfg))
+	cfg.KeyID = "key"
+	cfg.Secret = options.NewSecretString("secret")
+
+	be, err := s3.Create(context.TODO(), *cfg, http.DefaultTransport)
+	rtest.OK(t, err)
+
+	data := rtest.Random(23, 1000)
+	h := restic.Handle{Type: restic.PackFile, Name: restic.Hash(data).String()}
+	rtest.OK(t, be.Save(context.TODO(), h, restic.NewByteReader(data, be.Hasher())))
+
+	fi, err := be.Stat(context.TODO(), h)
+	rtest.OK(t, err)
+	rtest.Equals(t, int64(len(data)), fi.Size)
+
+	buf, err := backend.LoadAll(context.TODO(), nil, be, h)
+	rtest.OK(t, err)
+	rtest.Assert(t, bytes.Equal(data, buf), "loaded data does not match")
+
+	rtest.OK(t, be.List(context.TODO(), restic.PackFile, func(restic.FileInfo) error { return nil }))
+	rtest.OK(t, be.Remove(context.TODO(), h))
+
+	rtest.Assert(t, len(*requests) > 0, "no requests received")
+	for _, req := range *requests {
+		rtest.Equals(t, "requester", req.payer)
+		rtest.Assert(t, strings.Contains(req.signedHeaders, "x-amz-request-payer"),
+			"header not signed for %v %v: %q", req.method, req.path, req.signedHeaders)
+		// the configured region must be used, the bucket location is never requested
+		rtest.Equals(t, "eu-west-1", req.region)
+		rtest.Assert(t, strings.HasPrefix(req.path, "/bucket"), "path-style request expected, got %v", req.path)
+	}
+}
+
+func TestRequesterPaysMissing(t *testing.T) {
+	srv, _ := newRecordingS3Server(t, true)
+
+	cfg, err := s3.ParseConfig("s3:" + srv.URL + "/bucket/prefix")
+	rtest.OK(t, err)
+	cfg.KeyID = "key"
+	cfg.Secret = options.NewSecretString("secret")
+	cfg.Region = "eu-west-1"
+	cfg.Layout = "default"
+
+	be, err := s3.Open(context.TODO(), *cfg, http.DefaultTransport)
+	rtest.OK(t, err)
+
+	data := rtest.Random(23, 1000)
+	h := restic.Handle{Type: restic.PackFile, Name: restic.Hash(data).String()}
+	err = be.Save(context.TODO(), h, restic.NewByteReader(data, be.Hasher()))
+	rtest.Assert(t, err != nil, "Save did not fail")
+	rtest.Assert(t, strings.Contains(err.Error(), "Access Denied") && strings.Contains(err.Error(), "s3.requester-pays"),
+		"error does not explain the problem: %v", err)
+}
+
+// newGlacierS3Server returns a server which stores a single object in the
+// GLACIER storage class. A restore request starts warming up the object, which
+// finishes after the ongoing restore was reported once.
+func newGlacierS3Server(t testing.TB) (srv *httptest.Server, gets, restores *int) {
+	var (
+		m       sync.Mutex
+		data    []byte
+		ongoing bool
+		warm    bool
+	)
+	gets, restores = new(int), new(int)
+
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		defer m.Unlock()
+
+		switch {
+		case r.Method == http.MethodPut:
+			buf, err := io.ReadAll(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+				buf = decodeAWSChunked(buf)
+			}
+			data = buf
+			sum := md5.Sum(data)
+			w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+		case r.Method == http.MethodPost && r.URL.Query().Has("restore"):
+			*restores++
+			body, _ := io.ReadAll(r.Body)
+			if !strings.Contains(string(body), "<Tier>Bulk</Tier>") {
+				t.Errorf("restore request does not contain the configured tier: %s", body)
+			}
+			ongoing = true
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodHead:
+			sum := md5.Sum(data)
+			w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+			w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			w.Header().Set("X-Amz-Storage-Class", "GLACIER")
+			if ongoing {
+				w.Header().Set("X-Amz-Restore", `ongoing-request="true"`)
+				ongoing, warm = false, true
+			} else if warm {
+				expiry := time.Now().Add(24 * time.Hour).UTC().Format(http.TimeFormat)
+				w.Header().Set("X-Amz-Restore", `ongoing-request="false", expiry-date="`+expiry+`"`)
+			}
+		case r.Method == http.MethodGet:
+			*gets++
+			if !warm {
+				w.Header().Set("Content-Type", "application/xml")
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>InvalidObjectState</Code><Message>The operation is not valid for the object's storage class</Message><RequestId>4711</RequestId></Error>`)
+				return
+			}
+			sum := md5.Sum(data)
+			w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+			w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			_, _ = w.Write(data)
+		default:
+			w.WriteHeader(http.StatusNotImplemented)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, gets, restores
+}
+
+func TestWarmupFile(t *testing.T) {
+	srv, gets, restores := newGlacierS3Server(t)
+
+	cfg, err := s3.ParseConfig("s3:" + srv.URL + "/bucket/prefix")
+	rtest.OK(t, err)
+	rtest.OK(t, options.Options{
+		"region":        "eu-west-1",
+		"bucket-lookup": "path",
+		"layout":        "default",
+		"warmup-tier":   "Bulk",
+	}.Apply("s3", cfg))
+	cfg.KeyID = "key"
+	cfg.Secret = options.NewSecretString("secret")
+
+	inner, err := s3.Open(context.TODO(), *cfg, http.DefaultTransport)
+	rtest.OK(t, err)
+	be := retry.New(inner, 5, nil, nil)
+
+	data := rtest.Random(23, 1000)
+	h := restic.Handle{Type: restic.PackFile, Name: restic.Hash(data).String()}
+	rtest.OK(t, be.Save(context.TODO(), h, restic.NewByteReader(data, be.Hasher())))
+
+	// reading a cold object fails without retries
+	_, err = backend.LoadAll(context.TODO(), nil, be, h)
+	rtest.Assert(t, errors.Is(err, restic.ErrColdStorage), "unexpected error %v", err)
+	rtest.Equals(t, 1, *gets)
+
+	warmer := restic.AsBackend[restic.Warmer](be)
+	rtest.Assert(t, warmer != nil, "s3 backend does not implement restic.Warmer")
+
+	// the first call requests the restore, the second one sees it in progress
+	for i := 0; i < 2; i++ {
+		ready, err := warmer.WarmupFile(context.TODO(), h)
+		rtest.OK(t, err)
+		rtest.Assert(t, !ready, "file ready before the restore has finished")
+		rtest.Equals(t, 1, *restores)
+	}
+
+	ready, err := warmer.WarmupFile(context.TODO(), h)
+	rtest.OK(t, err)
+	rtest.Assert(t, ready, "file not ready after the restore has finished")
+	rtest.Equals(t, 1, *restores)
+
+	buf, err := backend.LoadAll(context.TODO(), nil, be, h)
+	rtest.OK(t, err)
+	rtest.Assert(t, bytes.Equal(data, buf), "loaded data does not match")
+}
+
+func TestWarmupTierInvalid(t *testing.T) {
+	cfg, err := s3.ParseConfig("s3:https://localhost/bucket/prefix")
+	rtest.OK(t, err)
+	cfg.WarmupTier = "Fast"
+	cfg.Layout = "default"
+
+	_, err = s3.Open(context.TODO(), *cfg, http.DefaultTransport)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "warmup-tier"), "unexpected error %v", err)
+}
@@ -3,6 +3,7 @@ package sema
 import (
 	"context"
 	"io"
+	"os"
 	"sync"
 
 	"github.com/cenkalti/backoff/v4"
@@ -12,6 +13,7 @@ import (
 
 // make sure that connectionLimitedBackend implements restic.Backend
 var _ restic.Backend = &connectionLimitedBackend{}
+var _ restic.RangeCopier = &connectionLimitedBackend{}
 
 // connectionLimitedBackend limits the number of concurrent operations.
 type connectionLimitedBackend struct {
@@ -95,6 +97,27 @@ func (be *connectionLimitedBackend) Load(ctx context.Context, h restic.Handle, l
 	return be.Backend.Load(ctx, h, length, offset, fn)
 }
 
+// CopyRange copies a range of the file at h to dst, see restic.RangeCopier.
+func (be *connectionLimitedBackend) CopyRange(ctx context.Context, h restic.Handle, length int, offset int64, dst *os.File) error {
+	if err := h.Valid(); err != nil {
+		return backoff.Permanent(err)
+	}
+	if offset < 0 {
+		return backoff.Permanent(errors.New("offset is negative"))
+	}
+	if length < 0 {
+		return backoff.Permanent(errors.Errorf("invalid length %d", length))
+	}
+
+	defer be.typeDependentLimit(h.Type)()
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return restic.CopyRange(ctx, be.Backend, h, length, offset, dst)
+}
+
 // Stat returns information about a file in the backend.
 func (be *connectionLimitedBackend) Stat(ctx context.Context, h restic.Handle) (restic.FileInfo, error) {
 	if err := h.Valid(); err != nil {
@@ -5,6 +5,7 @@ import (
 	"path"
 	"strings"
 
+	"github.com/restic/restic/internal/backend/location"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/options"
 )
@@ -16,7 +17,11 @@ type Config struct {
 	Layout  string `option:"layout" help:"use this backend directory layout (default: auto-detect)"`
 	Command string `option:"command" help:"specify command to create sftp connection"`
 
-	Connections uint `option:"connections" help:"set a limit for the number of concurrent connections (default: 5)"`
+	Connections uint `option:"connections" help:"set a limit for the number of concurrent connections"`
+
+	FileMode      string `option:"file-mode" help:"create files with these octal permissions, e.g. 0640 (default: derived from the config file)"`
+	DirMode       string `option:"dir-mode" help:"create directories with these octal permissions, e.g. 0750 (default: derived from the config file)"`
+	InsecureModes bool   `option:"insecure-modes" help:"allow file and directory modes which let others modify the repository"`
 }
 
 // NewConfig returns a new config with default options applied.
@@ -27,22 +32,25 @@ func NewConfig() Config {
 }
 
 func init() {
-	options.Register("sftp", Config{})
+	options.Register("sftp", NewConfig())
 }
 
 // ParseConfig parses the string s and extracts the sftp config. The
 // supported configuration formats are sftp://user@host[:port]/directory
 // and sftp:user@host:directory.  The directory will be path Cleaned and can
 // be an absolute path if it starts with a '/' (e.g.
-// sftp://user@host//absolute and sftp:user@host:/absolute).
+// sftp://user@host//absolute and sftp:user@host:/absolute). IPv6 addresses
+// must be enclosed in square brackets, in the second form they may be
+// followed by a port: sftp:user@[::1]:2222:directory. URL-encoded characters
+// in the user name are decoded in both forms.
 func ParseConfig(s string) (*Config, error) {
 	var user, host, port, dir string
 	switch {
 	case strings.HasPrefix(s, "sftp://"):
 		// parse the "sftp://user@host/path" url format
-		url, err := url.Parse(s)
+		url, err := location.ParseURL(s)
 		if err != nil {
-			return nil, errors.WithStack(err)
+			return nil, errors.Errorf("invalid sftp location: %v", err)
 		}
 		if url.User != nil {
 			user = url.User.Username()
@@ -58,12 +66,46 @@ func ParseConfig(s string) (*Config, error) {
 	case strings.HasPrefix(s, "sftp:"):
 		// parse the sftp:user@host:path format, which means we'll get
 		// "user@host:path" in s
-		s = s[5:]
+		var err error
+		user, host, port, dir, err = splitShortForm(s[5:])
+		if err != nil {
+			return nil, errors.Errorf("invalid sftp location %q: %v", s, err)
+		}
+		user = unescapeUser(user)
+	default:
+		return nil, errors.New(`invalid format, does not start with "sftp:"`)
+	}
+
+	if host == "" {
+		return nil, errors.Errorf("invalid sftp location %q: no host specified", s)
+	}
+
+	p := path.Clean(dir)
+	if strings.HasPrefix(p, "~") {
+		return nil, errors.New("sftp path starts with the tilde (~) character, that fails for most sftp servers.\nUse a relative directory, most servers interpret this as relative to the user's home directory")
+	}
+
+	cfg := NewConfig()
+	cfg.User = user
+	cfg.Host = host
+	cfg.Port = port
+	cfg.Path = p
+
+	return &cfg, nil
+}
+
+// splitShortForm splits s in the format user@host:path into its components.
+// The user name may contain "@". A host enclosed in square brackets is an
+// IPv6 address, which may be followed by a port: user@[::1]:port:path.
+func splitShortForm(s string) (user, host, port, dir string, err error) {
+	if i := strings.Index(s, "@["); i >= 0 && !strings.Contains(s[:i], ":") {
+		user, s = s[:i], s[i+1:]
+	} else if !strings.HasPrefix(s, "[") {
 		// split user@host and path at the colon
 		var colon bool
 		host, dir, colon = strings.Cut(s, ":")
 		if !colon {
-			return nil, errors.New("sftp: invalid format, hostname or path not found")
+			return "", "", "", "", errors.New("hostname or path not found")
 		}
 		// split user and host at the "@"
 		data := strings.SplitN(host, "@", 3)
@@ -74,20 +116,40 @@ func ParseConfig(s string) (*Config, error) {
 			user = data[0]
 			host = data[1]
 		}
-	default:
-		return nil, errors.New(`invalid format, does not start with "sftp:"`)
+		return user, host, "", dir, nil
 	}
 
-	p := path.Clean(dir)
-	if strings.HasPrefix(p, "~") {
-		return nil, errors.New("sftp path starts with the tilde (~) character, that fails for most sftp servers.\nUse a relative directory, most servers interpret this as relative to the user's home directory")
+	end := strings.Index(s, "]")
+	if end < 0 {
+		return "", "", "", "", errors.Errorf("missing ']' after IPv6 address %q", s)
+	}
+	if err := location.CheckHostPort(s[:end+1]); err != nil {
+		return "", "", "", "", err
 	}
+	host, s = s[1:end], s[end+1:]
 
-	cfg := NewConfig()
-	cfg.User = user
-	cfg.Host = host
-	cfg.Port = port
-	cfg.Path = p
+	if !strings.HasPrefix(s, ":") {
+		return "", "", "", "", errors.Errorf("expected ':' and a path after [%v], found %q", host, s)
+	}
+	dir = s[1:]
 
-	return &cfg, nil
+	// a purely numeric component followed by a colon is the port
+	if p, rest, ok := strings.Cut(dir, ":"); ok && p != "" && strings.Trim(p, "0123456789") == "" {
+		if err := location.CheckHostPort("[" + host + "]:" + p); err != nil {
+			return "", "", "", "", err
+		}
+		port, dir = p, rest
+	}
+	return user, host, port, dir, nil
+}
+
+// unescapeUser decodes URL-encoded characters in the user name. User names
+// which are not valid URL-encoded strings are returned unchanged, they were
+// accepted literally by earlier versions.
+func unescapeUser(user string) string {
+	u, err := url.PathUnescape(user)
+	if err != nil {
+		return user
+	}
+	return u
 }
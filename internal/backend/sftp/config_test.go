@@ -1,6 +1,7 @@
 package sftp
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/restic/restic/internal/backend/test"
@@ -48,6 +49,17 @@ var configTests = []test.ConfigTestData[Config]{
 		Cfg: Config{User: "user", Host: "::1", Port: "22", Path: "dir", Connections: 5},
 	},
 
+	// IPv6 address with zone.
+	{
+		S:   "sftp://user@[fe80::1%25eth0]:22/dir",
+		Cfg: Config{User: "user", Host: "fe80::1%eth0", Port: "22", Path: "dir", Connections: 5},
+	},
+	// URL-encoded user name.
+	{
+		S:   "sftp://user%40domain@host/dir",
+		Cfg: Config{User: "user@domain", Host: "host", Path: "dir", Connections: 5},
+	},
+
 	// second form, user specified sftp:user@host:/dir
 	{
 		S:   "sftp:user@host:/dir/subdir",
@@ -73,22 +85,87 @@ var configTests = []test.ConfigTestData[Config]{
 		S:   "sftp:user@host:dir///subdir",
 		Cfg: Config{User: "user", Host: "host", Path: "dir/subdir", Connections: 5},
 	},
+	{
+		S:   "sftp:user@host:/dir/@[x]",
+		Cfg: Config{User: "user", Host: "host", Path: "/dir/@[x]", Connections: 5},
+	},
+	{
+		S:   "sftp:user%40domain@host:dir",
+		Cfg: Config{User: "user@domain", Host: "host", Path: "dir", Connections: 5},
+	},
+	{
+		S:   "sftp:user%zz@host:dir",
+		Cfg: Config{User: "user%zz", Host: "host", Path: "dir", Connections: 5},
+	},
+	{
+		S:   "sftp:host:22:/dir",
+		Cfg: Config{Host: "host", Path: "22:/dir", Connections: 5},
+	},
+
+	// second form with IPv6 address
+	{
+		S:   "sftp:user@[2001:db8::1]:/srv/repo",
+		Cfg: Config{User: "user", Host: "2001:db8::1", Path: "/srv/repo", Connections: 5},
+	},
+	{
+		S:   "sftp:user@[2001:db8::1]:2222:/srv/repo",
+		Cfg: Config{User: "user", Host: "2001:db8::1", Port: "2222", Path: "/srv/repo", Connections: 5},
+	},
+	{
+		S:   "sftp:user@domain@[2001:db8::1]:2222:repo",
+		Cfg: Config{User: "user@domain", Host: "2001:db8::1", Port: "2222", Path: "repo", Connections: 5},
+	},
+	{
+		S:   "sftp:[::1]:repo",
+		Cfg: Config{Host: "::1", Path: "repo", Connections: 5},
+	},
+	{
+		S:   "sftp:[::1]:22:",
+		Cfg: Config{Host: "::1", Port: "22", Path: ".", Connections: 5},
+	},
+	{
+		S:   "sftp:[::1]:repo:22:suffix",
+		Cfg: Config{Host: "::1", Path: "repo:22:suffix", Connections: 5},
+	},
 }
 
 func TestParseConfig(t *testing.T) {
 	test.ParseConfigTester(t, ParseConfig, configTests)
 }
 
-var configTestsInvalid = []string{
-	"sftp://host:dir",
+var configTestsInvalid = []struct {
+	s   string
+	err string
+}{
+	{"sftp://host:dir", `invalid port "dir"`},
+	{"sftp://host", "no directory specified"},
+	{"sftp://user@::1/dir", "IPv6 addresses must be enclosed in square brackets"},
+	{"sftp://user@[::1/dir", "missing ']' after IPv6 address"},
+	{"sftp://user@[::1]x/dir", `unexpected "x" after IPv6 address`},
+	{"sftp://user@[::1]:99999/dir", `invalid port "99999"`},
+	{"sftp://user@[host]/dir", `invalid IPv6 address "host"`},
+	{"sftp:host", "hostname or path not found"},
+	{"sftp::dir", "no host specified"},
+	{"sftp:user@:dir", "no host specified"},
+	{"sftp:user@[2001:db8::1", "missing ']' after IPv6 address"},
+	{"sftp:user@[2001:db8::1]", "expected ':' and a path after [2001:db8::1]"},
+	{"sftp:user@[2001:db8::1]/srv", "expected ':' and a path after [2001:db8::1]"},
+	{"sftp:user@[2001:db8::1]:70000:/srv", `invalid port "70000"`},
+	{"sftp:user@[192.0.2.1]:/srv", `invalid IPv6 address "192.0.2.1"`},
+	{"sftp:host:~/dir", "tilde"},
+	{"sftp:[::1]:~/dir", "tilde"},
+	{"local:/dir", `does not start with "sftp:"`},
 }
 
 func TestParseConfigInvalid(t *testing.T) {
 	for i, test := range configTestsInvalid {
-		_, err := ParseConfig(test)
+		_, err := ParseConfig(test.s)
 		if err == nil {
-			t.Errorf("test %d: invalid config %s did not return an error", i, test)
+			t.Errorf("test %d: invalid config %s did not return an error", i, test.s)
 			continue
 		}
+		if !strings.Contains(err.Error(), test.err) {
+			t.Errorf("test %d: error for %s does not contain %q: %v", i, test.s, test.err, err)
+		}
 	}
 }
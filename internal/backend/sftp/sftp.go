@@ -11,11 +11,12 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/backend/layout"
-	"github.com/restic/restic/internal/backend/limiter"
 	"github.com/restic/restic/internal/backend/location"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
@@ -36,6 +37,12 @@ type SFTP struct {
 
 	posixRename bool
 
+	// syncEnabled is set to 1 by EnableSync, written files are then synced
+	// on the server before they are renamed.
+	syncEnabled int32
+	syncMutex   sync.Mutex
+	syncTime    time.Duration
+
 	layout.Layout
 	Config
 	backend.Modes
@@ -43,8 +50,14 @@ type SFTP struct {
 
 var _ restic.Backend = &SFTP{}
 
+// ensure statically that *SFTP implements restic.Renamer.
+var _ restic.Renamer = &SFTP{}
+
+// ensure statically that *SFTP implements restic.Syncer.
+var _ restic.Syncer = &SFTP{}
+
 func NewFactory() location.Factory {
-	return location.NewLimitedBackendFactory("sftp", ParseConfig, location.NoPassword, limiter.WrapBackendConstructor(Create), limiter.WrapBackendConstructor(Open))
+	return location.NewBackendFactory("sftp", ParseConfig, location.NoPassword, Create, Open)
 }
 
 const defaultLayout = "default"
@@ -153,7 +166,10 @@ func open(ctx context.Context, sftp *SFTP, cfg Config) (*SFTP, error) {
 	debug.Log("layout: %v\n", sftp.Layout)
 
 	fi, err := sftp.c.Stat(sftp.Layout.Filename(restic.Handle{Type: restic.ConfigFile}))
-	m := backend.DeriveModesFromFileInfo(fi, err)
+	m, err := backend.ParseModes(backend.DeriveModesFromFileInfo(fi, err), cfg.FileMode, cfg.DirMode, cfg.InsecureModes)
+	if err != nil {
+		return nil, err
+	}
 	debug.Log("using (%03O file, %03O dir) permissions", m.File, m.Dir)
 
 	sftp.Config = cfg
@@ -177,14 +193,42 @@ func (r *SFTP) mkdirAllDataSubdirs(ctx context.Context, nconn uint) error {
 			// round trip, not counting duplicate parent creations causes by
 			// concurrency. MkdirAll first does Stat, then recursive MkdirAll
 			// on the parent, so calls typically take three round trips.
-			if err := r.c.Mkdir(d); err == nil {
-				return nil
+			if err := r.c.Mkdir(d); err != nil {
+				if err := r.c.MkdirAll(d); err != nil {
+					return err
+				}
 			}
-			return r.c.MkdirAll(d)
+			return r.chmodDir(d)
 		})
 	}
 
-	return g.Wait()
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	return r.chmodDir(r.p)
+}
+
+// mkdirAll creates dir and all missing parents.
+func (r *SFTP) mkdirAll(dir string) error {
+	if err := r.c.MkdirAll(dir); err != nil {
+		return err
+	}
+	return r.chmodDir(dir)
+}
+
+// chmodDir applies an explicitly configured directory mode to dir, an
+// inherited setgid bit is kept. Otherwise the permissions of new directories
+// are determined by the server.
+func (r *SFTP) chmodDir(dir string) error {
+	if r.DirMode == "" {
+		return nil
+	}
+
+	fi, err := r.c.Stat(dir)
+	if err != nil {
+		return err
+	}
+	return r.c.Chmod(dir, r.Modes.Dir|fi.Mode()&os.ModeSetgid)
 }
 
 // Join combines path components with slashes (according to the sftp spec).
@@ -237,6 +281,11 @@ func buildSSHCommand(cfg Config) (cmd string, args []string, err error) {
 // Create creates an sftp backend as described by the config by running "ssh"
 // with the appropriate arguments (or cfg.Command, if set).
 func Create(ctx context.Context, cfg Config) (*SFTP, error) {
+	modes, err := backend.ParseModes(backend.DefaultModes, cfg.FileMode, cfg.DirMode, cfg.InsecureModes)
+	if err != nil {
+		return nil, err
+	}
+
 	sftp, err := startClient(cfg)
 	if err != nil {
 		debug.Log("unable to start program: %v", err)
@@ -248,7 +297,9 @@ func Create(ctx context.Context, cfg Config) (*SFTP, error) {
 		return nil, err
 	}
 
-	sftp.Modes = backend.DefaultModes
+	sftp.Config = cfg
+	sftp.p = cfg.Path
+	sftp.Modes = modes
 
 	// test if config file already exists
 	_, err = sftp.c.Lstat(sftp.Layout.Filename(restic.Handle{Type: restic.ConfigFile}))
@@ -284,6 +335,12 @@ func (r *SFTP) HasAtomicReplace() bool {
 	return r.posixRename
 }
 
+// HasAtomicSave returns true, files are written to a temporary name and then
+// renamed.
+func (r *SFTP) HasAtomicSave() bool {
+	return true
+}
+
 // Join joins the given paths and cleans them afterwards. This always uses
 // forward slashes, which is required by sftp.
 func Join(parts ...string) string {
@@ -316,7 +373,7 @@ func (r *SFTP) Save(_ context.Context, h restic.Handle, rd restic.RewindReader)
 
 	if r.IsNotExist(err) {
 		// error is caused by a missing directory, try to create it
-		mkdirErr := r.c.MkdirAll(r.Dirname(h))
+		mkdirErr := r.mkdirAll(r.Dirname(h))
 		if mkdirErr != nil {
 			debug.Log("error creating dir %v: %v", r.Dirname(h), mkdirErr)
 		} else {
@@ -361,6 +418,16 @@ func (r *SFTP) Save(_ context.Context, h restic.Handle, rd restic.RewindReader)
 		return errors.Errorf("wrote %d bytes instead of the expected %d bytes", wbytes, rd.Length())
 	}
 
+	if atomic.LoadInt32(&r.syncEnabled) != 0 {
+		start := time.Now()
+		err = f.Sync()
+		r.addSyncTime(start)
+		if err != nil {
+			_ = f.Close()
+			return errors.Wrap(err, "Sync")
+		}
+	}
+
 	err = f.Close()
 	if err != nil {
 		return errors.Wrap(err, "Close")
@@ -372,9 +439,38 @@ func (r *SFTP) Save(_ context.Context, h restic.Handle, rd restic.RewindReader)
 	} else {
 		err = r.c.Rename(tmpFilename, filename)
 	}
+	if err != nil {
+		// a plain rename fails if the file already exists
+		if _, serr := r.c.Lstat(filename); serr == nil {
+			return errors.Wrap(restic.ErrAlreadyExists, err.Error())
+		}
+	}
 	return errors.Wrap(err, "Rename")
 }
 
+// EnableSync implements restic.Syncer. It requires the fsync@openssh.com
+// extension, which only allows syncing files but not directories.
+func (r *SFTP) EnableSync() error {
+	if _, ok := r.c.HasExtension("fsync@openssh.com"); !ok {
+		return errors.New("the sftp server does not support syncing files")
+	}
+	atomic.StoreInt32(&r.syncEnabled, 1)
+	return nil
+}
+
+// SyncDuration implements restic.Syncer.
+func (r *SFTP) SyncDuration() time.Duration {
+	r.syncMutex.Lock()
+	defer r.syncMutex.Unlock()
+	return r.syncTime
+}
+
+func (r *SFTP) addSyncTime(start time.Time) {
+	r.syncMutex.Lock()
+	defer r.syncMutex.Unlock()
+	r.syncTime += time.Since(start)
+}
+
 // checkNoSpace checks if err was likely caused by lack of available space
 // on the remote, and if so, makes it permanent.
 func (r *SFTP) checkNoSpace(dir string, size int64, origErr error) error {
@@ -452,6 +548,34 @@ func (r *SFTP) Remove(_ context.Context, h restic.Handle) error {
 	return r.c.Remove(r.Filename(h))
 }
 
+// Rename moves the file at from to the handle to. The target directory is
+// created if it does not exist yet.
+func (r *SFTP) Rename(_ context.Context, from, to restic.Handle) error {
+	if err := r.clientError(); err != nil {
+		return err
+	}
+
+	oldname := r.Filename(from)
+	newname := r.Filename(to)
+
+	rename := r.c.Rename
+	// Prefer POSIX atomic rename if available.
+	if r.posixRename {
+		rename = r.c.PosixRename
+	}
+
+	err := rename(oldname, newname)
+	if r.IsNotExist(err) {
+		// the error may be caused by a missing target directory
+		if mkdirErr := r.mkdirAll(r.Dirname(to)); mkdirErr != nil {
+			debug.Log("error creating dir %v: %v", r.Dirname(to), mkdirErr)
+		} else {
+			err = rename(oldname, newname)
+		}
+	}
+	return errors.Wrap(err, "Rename")
+}
+
 // List runs fn for each file in the backend which has the type t. When an
 // error occurs (or fn returns an error), List stops and returns it.
 func (r *SFTP) List(ctx context.Context, t restic.FileType, fn func(restic.FileInfo) error) error {
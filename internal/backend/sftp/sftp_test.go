@@ -1,15 +1,18 @@
 package sftp_test
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 
 	"github.com/restic/restic/internal/backend/sftp"
 	"github.com/restic/restic/internal/backend/test"
 	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
 )
 
@@ -67,3 +70,47 @@ func BenchmarkBackendSFTP(t *testing.B) {
 
 	newTestSuite(t).RunBenchmarks(t)
 }
+
+func TestCreateModes(t *testing.T) {
+	if sftpServer == "" {
+		t.Skip("sftp server binary not found")
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not supported on Windows")
+	}
+
+	dir := filepath.Join(rtest.TempDir(t), "repo")
+	cfg := sftp.NewConfig()
+	cfg.Path = dir
+	cfg.Command = fmt.Sprintf("%q -e", sftpServer)
+	cfg.FileMode = "0660"
+	cfg.DirMode = "0770"
+
+	be, err := sftp.Create(context.TODO(), cfg)
+	rtest.OK(t, err)
+	defer func() {
+		rtest.OK(t, be.Close())
+	}()
+
+	data := []byte("foobar")
+	h := restic.Handle{Type: restic.PackFile, Name: restic.Hash(data).String()}
+	rtest.OK(t, be.Save(context.TODO(), h, restic.NewByteReader(data, be.Hasher())))
+
+	for name, mode := range map[string]os.FileMode{
+		dir:                              0770,
+		filepath.Join(dir, "data"):       0770,
+		filepath.Join(dir, "data", "ff"): 0770,
+		filepath.Join(dir, "snapshots"):  0770,
+		be.Filename(h):                   0660,
+	} {
+		fi, err := os.Stat(name)
+		rtest.OK(t, err)
+		if fi.Mode().Perm() != mode {
+			t.Errorf("%v: wrong mode, want %v, got %v", name, mode, fi.Mode().Perm())
+		}
+	}
+
+	cfg.DirMode = "0777"
+	_, err = sftp.Create(context.TODO(), cfg)
+	rtest.Assert(t, err != nil, "world-writable directory mode was accepted")
+}
@@ -0,0 +1,165 @@
+// Package stats implements a backend wrapper which counts the requests sent
+// to a backend and the amount of data transferred.
+package stats
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+// OpStats contains the statistics for one type of backend operation.
+type OpStats struct {
+	Requests uint64
+	// Bytes is the amount of data sent to the backend for save operations
+	// and the amount of data received for load operations.
+	Bytes uint64
+}
+
+// Stats contains the statistics for all backend operations.
+type Stats struct {
+	Save   OpStats
+	Load   OpStats
+	Stat   OpStats
+	List   OpStats
+	Remove OpStats
+}
+
+// Requests returns the total number of requests.
+func (s Stats) Requests() uint64 {
+	return s.Save.Requests + s.Load.Requests + s.Stat.Requests + s.List.Requests + s.Remove.Requests
+}
+
+// BytesUploaded returns the amount of data sent to the backend.
+func (s Stats) BytesUploaded() uint64 {
+	return s.Save.Bytes
+}
+
+// BytesDownloaded returns the amount of data received from the backend.
+func (s Stats) BytesDownloaded() uint64 {
+	return s.Load.Bytes
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("save: %d requests, %d bytes; load: %d requests, %d bytes; stat: %d requests; list: %d requests; remove: %d requests",
+		s.Save.Requests, s.Save.Bytes, s.Load.Requests, s.Load.Bytes, s.Stat.Requests, s.List.Requests, s.Remove.Requests)
+}
+
+// Backend counts the requests passed to the wrapped backend. Retried
+// requests are counted separately if the backend is wrapped by the retry
+// backend.
+type Backend struct {
+	restic.Backend
+
+	m     sync.Mutex
+	stats Stats
+}
+
+// statically ensure that Backend implements restic.Backend.
+var _ restic.Backend = &Backend{}
+var _ restic.RangeCopier = &Backend{}
+
+// New returns a backend which collects statistics for be.
+func New(be restic.Backend) *Backend {
+	return &Backend{Backend: be}
+}
+
+// Stats returns the statistics collected so far.
+func (be *Backend) Stats() Stats {
+	be.m.Lock()
+	defer be.m.Unlock()
+	return be.stats
+}
+
+func (be *Backend) add(op *OpStats, requests, bytes uint64) {
+	be.m.Lock()
+	defer be.m.Unlock()
+	op.Requests += requests
+	op.Bytes += bytes
+}
+
+// Save counts the bytes the wrapped backend reads from rd.
+func (be *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	be.add(&be.stats.Save, 1, 0)
+	return be.Backend.Save(ctx, h, &countingRewindReader{RewindReader: rd, count: func(n int) {
+		be.add(&be.stats.Save, 0, uint64(n))
+	}})
+}
+
+// Load counts the bytes the consumer reads from the backend, which may be
+// less than the requested length.
+func (be *Backend) Load(ctx context.Context, h restic.Handle, length int, offset int64, consumer func(rd io.Reader) error) error {
+	be.add(&be.stats.Load, 1, 0)
+	return be.Backend.Load(ctx, h, length, offset, func(rd io.Reader) error {
+		return consumer(&countingReader{rd: rd, count: func(n int) {
+			be.add(&be.stats.Load, 0, uint64(n))
+		}})
+	})
+}
+
+// CopyRange counts the bytes copied to dst as a load.
+func (be *Backend) CopyRange(ctx context.Context, h restic.Handle, length int, offset int64, dst *os.File) error {
+	be.add(&be.stats.Load, 1, 0)
+	n, err := trackCopied(dst, func() error {
+		return restic.CopyRange(ctx, be.Backend, h, length, offset, dst)
+	})
+	be.add(&be.stats.Load, 0, uint64(n))
+	return err
+}
+
+// trackCopied returns the number of bytes fn has written to dst.
+func trackCopied(dst *os.File, fn func() error) (int64, error) {
+	start, err := dst.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	err = fn()
+	end, serr := dst.Seek(0, io.SeekCurrent)
+	if serr != nil {
+		return 0, err
+	}
+	return end - start, err
+}
+
+func (be *Backend) Stat(ctx context.Context, h restic.Handle) (restic.FileInfo, error) {
+	be.add(&be.stats.Stat, 1, 0)
+	return be.Backend.Stat(ctx, h)
+}
+
+func (be *Backend) List(ctx context.Context, t restic.FileType, fn func(restic.FileInfo) error) error {
+	be.add(&be.stats.List, 1, 0)
+	return be.Backend.List(ctx, t, fn)
+}
+
+func (be *Backend) Remove(ctx context.Context, h restic.Handle) error {
+	be.add(&be.stats.Remove, 1, 0)
+	return be.Backend.Remove(ctx, h)
+}
+
+func (be *Backend) Unwrap() restic.Backend { return be.Backend }
+
+type countingRewindReader struct {
+	restic.RewindReader
+	count func(n int)
+}
+
+func (rd *countingRewindReader) Read(p []byte) (int, error) {
+	n, err := rd.RewindReader.Read(p)
+	rd.count(n)
+	return n, err
+}
+
+type countingReader struct {
+	rd    io.Reader
+	count func(n int)
+}
+
+func (rd *countingReader) Read(p []byte) (int, error) {
+	n, err := rd.rd.Read(p)
+	rd.count(n)
+	return n, err
+}
@@ -0,0 +1,46 @@
+package stats_test
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/restic/restic/internal/backend/mem"
+	"github.com/restic/restic/internal/backend/stats"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestStatsBackend(t *testing.T) {
+	be := stats.New(mem.New())
+	ctx := context.TODO()
+
+	data := rtest.Random(23, 1000)
+	h := restic.Handle{Type: restic.PackFile, Name: restic.Hash(data).String()}
+	rtest.OK(t, be.Save(ctx, h, restic.NewByteReader(data, be.Hasher())))
+
+	_, err := be.Stat(ctx, h)
+	rtest.OK(t, err)
+	rtest.OK(t, be.List(ctx, restic.PackFile, func(restic.FileInfo) error { return nil }))
+
+	// only the bytes actually read by the consumer are counted
+	rtest.OK(t, be.Load(ctx, h, 0, 0, func(rd io.Reader) error {
+		_, err := io.ReadFull(rd, make([]byte, 100))
+		return err
+	}))
+	rtest.OK(t, be.Load(ctx, h, 200, 500, func(rd io.Reader) error {
+		_, err := io.Copy(io.Discard, rd)
+		return err
+	}))
+	rtest.OK(t, be.Remove(ctx, h))
+
+	s := be.Stats()
+	rtest.Equals(t, stats.OpStats{Requests: 1, Bytes: 1000}, s.Save)
+	rtest.Equals(t, stats.OpStats{Requests: 2, Bytes: 300}, s.Load)
+	rtest.Equals(t, stats.OpStats{Requests: 1}, s.Stat)
+	rtest.Equals(t, stats.OpStats{Requests: 1}, s.List)
+	rtest.Equals(t, stats.OpStats{Requests: 1}, s.Remove)
+	rtest.Equals(t, uint64(6), s.Requests())
+	rtest.Equals(t, uint64(1000), s.BytesUploaded())
+	rtest.Equals(t, uint64(300), s.BytesDownloaded())
+}
@@ -36,11 +36,12 @@ type Config struct {
 	Prefix                 string
 	DefaultContainerPolicy string
 
-	Connections uint `option:"connections" help:"set a limit for the number of concurrent connections (default: 5)"`
+	Connections uint   `option:"connections" help:"set a limit for the number of concurrent connections"`
+	SegmentSize uint64 `option:"segment-size" help:"upload files larger than this many bytes as static large objects in segments of this size (default: 0, disabled)"`
 }
 
 func init() {
-	options.Register("swift", Config{})
+	options.Register("swift", NewConfig())
 }
 
 // NewConfig returns a new config with the default values filled in.
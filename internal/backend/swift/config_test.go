@@ -54,3 +54,22 @@ func TestParseConfigInvalid(t *testing.T) {
 		}
 	}
 }
+
+func TestApplyEnvironmentApplicationCredential(t *testing.T) {
+	t.Setenv("RESTIC_TEST_OS_AUTH_URL", "https://auth.example.com/v3")
+	t.Setenv("RESTIC_TEST_OS_APPLICATION_CREDENTIAL_ID", "credential-id")
+	t.Setenv("RESTIC_TEST_OS_APPLICATION_CREDENTIAL_SECRET", "credential-secret")
+
+	cfg := NewConfig()
+	cfg.ApplyEnvironment("RESTIC_TEST_")
+
+	if cfg.AuthURL != "https://auth.example.com/v3" {
+		t.Errorf("wrong auth URL %q", cfg.AuthURL)
+	}
+	if cfg.ApplicationCredentialID != "credential-id" {
+		t.Errorf("wrong application credential ID %q", cfg.ApplicationCredentialID)
+	}
+	if cfg.ApplicationCredentialSecret.Unwrap() != "credential-secret" {
+		t.Errorf("wrong application credential secret %q", cfg.ApplicationCredentialSecret.Unwrap())
+	}
+}
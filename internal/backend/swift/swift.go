@@ -1,13 +1,16 @@
 package swift
 
 import (
+	"bytes"
 	"context"
 	"crypto/md5"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"hash"
 	"io"
 	"net/http"
+	"net/url"
 	"path"
 	"strconv"
 	"strings"
@@ -29,12 +32,16 @@ type beSwift struct {
 	connections uint
 	container   string // Container name
 	prefix      string // Prefix of object names in the container
+	segmentSize uint64 // Size above which files are saved as static large objects
 	layout.Layout
 }
 
 // ensure statically that *beSwift implements restic.Backend.
 var _ restic.Backend = &beSwift{}
 
+// ensure statically that *beSwift implements restic.Warmer.
+var _ restic.Warmer = &beSwift{}
+
 func NewFactory() location.Factory {
 	return location.NewHTTPBackendFactory("swift", ParseConfig, location.NoPassword, Open, Open)
 }
@@ -71,6 +78,7 @@ func Open(ctx context.Context, cfg Config, rt http.RoundTripper) (restic.Backend
 		connections: cfg.Connections,
 		container:   cfg.Container,
 		prefix:      cfg.Prefix,
+		segmentSize: cfg.SegmentSize,
 		Layout: &layout.DefaultLayout{
 			Path: cfg.Prefix,
 			Join: path.Join,
@@ -132,6 +140,12 @@ func (be *beSwift) HasAtomicReplace() bool {
 	return true
 }
 
+// HasAtomicSave returns true, objects and large object manifests only become
+// visible once the upload has completed.
+func (be *beSwift) HasAtomicSave() bool {
+	return true
+}
+
 // Load runs fn with a reader that yields the contents of the file at h at the
 // given offset.
 func (be *beSwift) Load(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
@@ -159,11 +173,35 @@ func (be *beSwift) openReader(ctx context.Context, h restic.Handle, length int,
 	return obj, nil
 }
 
+// WarmupFile reads the first byte of the file at h. Containers using a cold
+// storage policy like OVH Public Cloud Archive reject reads of sealed objects
+// with status 429 and start unsealing them. It returns true if the file can
+// already be read.
+func (be *beSwift) WarmupFile(ctx context.Context, h restic.Handle) (bool, error) {
+	objName := be.Filename(h)
+
+	obj, _, err := be.conn.ObjectOpen(ctx, be.container, objName, false, swift.Headers{"Range": "bytes=0-0"})
+	var e *swift.Error
+	if errors.As(err, &e) && e.StatusCode == http.StatusTooManyRequests {
+		debug.Log("%v is being unsealed", objName)
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "conn.ObjectOpen")
+	}
+
+	return true, obj.Close()
+}
+
 // Save stores data in the backend at the handle.
 func (be *beSwift) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
 	objName := be.Filename(h)
 	encoding := "binary/octet-stream"
 
+	if be.segmentSize > 0 && uint64(rd.Length()) > be.segmentSize {
+		return be.saveLargeObject(ctx, objName, encoding, rd)
+	}
+
 	hdr := swift.Headers{"Content-Length": strconv.FormatInt(rd.Length(), 10)}
 	_, err := be.conn.ObjectPut(ctx,
 		be.container, objName, rd, true, hex.EncodeToString(rd.Hash()),
@@ -173,6 +211,89 @@ func (be *beSwift) Save(ctx context.Context, h restic.Handle, rd restic.RewindRe
 	return errors.Wrap(err, "client.PutObject")
 }
 
+// sloSegment describes a single segment in a static large object manifest.
+type sloSegment struct {
+	Path string `json:"path"`
+	Etag string `json:"etag"`
+	Size int64  `json:"size_bytes"`
+}
+
+// segmentContainer returns the name of the container segments of static
+// large objects are stored in.
+func (be *beSwift) segmentContainer() string {
+	return be.container + "_segments"
+}
+
+// saveLargeObject uploads rd in segments of be.segmentSize bytes to the
+// segment container and afterwards writes a static large object manifest
+// referencing all segments to objName.
+func (be *beSwift) saveLargeObject(ctx context.Context, objName string, encoding string, rd restic.RewindReader) error {
+	segContainer := be.segmentContainer()
+	if err := be.conn.ContainerCreate(ctx, segContainer, nil); err != nil {
+		return errors.Wrap(err, "conn.ContainerCreate")
+	}
+
+	var segments []sloSegment
+	// segments are only referenced once the manifest has been written,
+	// remove them if the upload fails
+	removeSegments := func() {
+		for _, seg := range segments {
+			segName := strings.TrimPrefix(seg.Path, segContainer+"/")
+			if err := be.conn.ObjectDelete(ctx, segContainer, segName); err != nil {
+				debug.Log("removing segment %v failed: %v", seg.Path, err)
+			}
+		}
+	}
+
+	for remaining := rd.Length(); remaining > 0; {
+		size := int64(be.segmentSize)
+		if remaining < size {
+			size = remaining
+		}
+
+		segName := fmt.Sprintf("%s/%08d", objName, len(segments)+1)
+		hdr := swift.Headers{"Content-Length": strconv.FormatInt(size, 10)}
+		// let the library compute and verify the MD5 hash of each segment
+		respHdr, err := be.conn.ObjectPut(ctx, segContainer, segName,
+			io.LimitReader(rd, size), true, "", encoding, hdr)
+		if err != nil {
+			removeSegments()
+			return errors.Wrap(err, "client.PutObject")
+		}
+
+		segments = append(segments, sloSegment{
+			Path: segContainer + "/" + segName,
+			Etag: respHdr["Etag"],
+			Size: size,
+		})
+		remaining -= size
+	}
+
+	manifest, err := json.Marshal(segments)
+	if err != nil {
+		removeSegments()
+		return err
+	}
+
+	_, _, err = be.conn.Call(ctx, be.conn.StorageUrl, swift.RequestOpts{
+		Container:  be.container,
+		ObjectName: objName,
+		Operation:  "PUT",
+		Parameters: url.Values{"multipart-manifest": []string{"put"}},
+		Headers: swift.Headers{
+			"Content-Length": strconv.Itoa(len(manifest)),
+			"Content-Type":   encoding,
+		},
+		Body:       bytes.NewReader(manifest),
+		NoResponse: true,
+	})
+	if err != nil {
+		removeSegments()
+		return errors.Wrap(err, "put manifest")
+	}
+	return nil
+}
+
 // Stat returns information about a blob.
 func (be *beSwift) Stat(ctx context.Context, h restic.Handle) (bi restic.FileInfo, err error) {
 	objName := be.Filename(h)
@@ -189,7 +310,18 @@ func (be *beSwift) Stat(ctx context.Context, h restic.Handle) (bi restic.FileInf
 func (be *beSwift) Remove(ctx context.Context, h restic.Handle) error {
 	objName := be.Filename(h)
 
-	err := be.conn.ObjectDelete(ctx, be.container, objName)
+	// the file may have been saved as a static large object with a different
+	// segment size setting, check the manifest header to also remove its segments
+	_, hdr, err := be.conn.Object(ctx, be.container, objName)
+	if err != nil {
+		return errors.Wrap(err, "conn.Object")
+	}
+	if hdr.IsLargeObjectSLO() {
+		err = be.conn.LargeObjectDelete(ctx, be.container, objName)
+		return errors.Wrap(err, "conn.LargeObjectDelete")
+	}
+
+	err = be.conn.ObjectDelete(ctx, be.container, objName)
 	return errors.Wrap(err, "conn.ObjectDelete")
 }
 
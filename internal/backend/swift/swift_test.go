@@ -1,11 +1,17 @@
 package swift_test
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"testing"
 	"time"
 
+	ncw "github.com/ncw/swift/v2"
+	"github.com/ncw/swift/v2/swifttest"
+	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/backend/swift"
 	"github.com/restic/restic/internal/backend/test"
 	"github.com/restic/restic/internal/restic"
@@ -75,3 +81,76 @@ func BenchmarkBackendSwift(t *testing.B) {
 	t.Logf("run tests")
 	newSwiftTestSuite(t).RunBenchmarks(t)
 }
+
+func TestBackendSwiftLargeObject(t *testing.T) {
+	srv, err := swifttest.NewSwiftServer("localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	cfg, err := swift.ParseConfig("swift:restic-test:/prefix")
+	rtest.OK(t, err)
+	cfg.AuthURL = srv.AuthURL
+	cfg.UserName = swifttest.TEST_ACCOUNT
+	cfg.APIKey = swifttest.TEST_ACCOUNT
+	cfg.SegmentSize = 1000
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	be, err := swift.Open(ctx, *cfg, http.DefaultTransport)
+	rtest.OK(t, err)
+	defer func() {
+		rtest.OK(t, be.Close())
+	}()
+
+	for _, length := range []int{1010, 1020, 3500} {
+		data := rtest.Random(length, length)
+		id := restic.Hash(data)
+		h := restic.Handle{Type: restic.PackFile, Name: id.String()}
+
+		rtest.OK(t, be.Save(ctx, h, restic.NewByteReader(data, be.Hasher())))
+
+		buf, err := backend.LoadAll(ctx, nil, be, h)
+		rtest.OK(t, err)
+		rtest.Equals(t, data, buf)
+
+		// partial reads must work across segment boundaries
+		var part []byte
+		err = be.Load(ctx, h, 20, 990, func(rd io.Reader) error {
+			part, err = io.ReadAll(rd)
+			return err
+		})
+		rtest.OK(t, err)
+		rtest.Equals(t, data[990:1010], part)
+
+		rtest.OK(t, be.Remove(ctx, h))
+		_, err = be.Stat(ctx, h)
+		rtest.Assert(t, be.IsNotExist(err), "file %v still exists after removal: %v", h, err)
+	}
+
+	// large objects must be removed including their segments even if
+	// the segment size is no longer configured
+	data := rtest.Random(23, 2500)
+	h := restic.Handle{Type: restic.PackFile, Name: restic.Hash(data).String()}
+	rtest.OK(t, be.Save(ctx, h, restic.NewByteReader(data, be.Hasher())))
+
+	cfg.SegmentSize = 0
+	be2, err := swift.Open(ctx, *cfg, http.DefaultTransport)
+	rtest.OK(t, err)
+	defer func() {
+		rtest.OK(t, be2.Close())
+	}()
+	rtest.OK(t, be2.Remove(ctx, h))
+
+	conn := &ncw.Connection{
+		UserName: swifttest.TEST_ACCOUNT,
+		ApiKey:   swifttest.TEST_ACCOUNT,
+		AuthUrl:  srv.AuthURL,
+	}
+	rtest.OK(t, conn.Authenticate(ctx))
+	segments, err := conn.ObjectNamesAll(ctx, "restic-test_segments", nil)
+	rtest.OK(t, err)
+	rtest.Equals(t, 0, len(segments))
+}
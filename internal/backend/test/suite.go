@@ -162,7 +162,7 @@ func (s *Suite[C]) createOrError() (restic.Backend, error) {
 		return nil, fmt.Errorf("cannot create transport for tests: %v", err)
 	}
 
-	be, err := s.Factory.Create(context.TODO(), s.Config, tr, nil)
+	be, err := s.Factory.Create(context.TODO(), s.Config, tr)
 	if err != nil {
 		return nil, err
 	}
@@ -193,7 +193,7 @@ func (s *Suite[C]) open(t testing.TB) restic.Backend {
 		t.Fatalf("cannot create transport for tests: %v", err)
 	}
 
-	be, err := s.Factory.Open(context.TODO(), s.Config, tr, nil)
+	be, err := s.Factory.Open(context.TODO(), s.Config, tr)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -331,6 +331,56 @@ func (s *Suite[C]) TestList(t *testing.T) {
 	}
 }
 
+// TestListSize tests that the sizes returned by List match those returned by Stat.
+func (s *Suite[C]) TestListSize(t *testing.T) {
+	seedRand(t)
+
+	b := s.open(t)
+	defer s.close(t, b)
+
+	var handles []restic.Handle
+	for i := 0; i < 5; i++ {
+		data := test.Random(rand.Int(), rand.Intn(1000)+1)
+		h := restic.Handle{Type: restic.PackFile, Name: restic.Hash(data).String()}
+		err := b.Save(context.TODO(), h, restic.NewByteReader(data, b.Hasher()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		handles = append(handles, h)
+	}
+
+	listed := make(map[string]int64)
+	err := b.List(context.TODO(), restic.PackFile, func(fi restic.FileInfo) error {
+		listed[fi.Name] = fi.Size
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("List returned error %v", err)
+	}
+
+	for _, h := range handles {
+		fi, err := b.Stat(context.TODO(), h)
+		if err != nil {
+			t.Fatalf("Stat returned error %v", err)
+		}
+
+		size, ok := listed[h.Name]
+		if !ok {
+			t.Errorf("file %v not returned by List()", h)
+			continue
+		}
+
+		if size != fi.Size {
+			t.Errorf("wrong size for %v returned by List: Stat returned %v, List returned %v", h, fi.Size, size)
+		}
+	}
+
+	err = s.delayedRemove(t, b, handles...)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
 // TestListCancel tests that the context is respected and the error is returned by List.
 func (s *Suite[C]) TestListCancel(t *testing.T) {
 	seedRand(t)
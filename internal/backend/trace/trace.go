@@ -0,0 +1,238 @@
+// Package trace implements a backend wrapper which records the timing and the
+// outcome of every request sent to a backend.
+//
+// Each request is written as one line of space separated key=value pairs:
+//
+//	time=2023-05-01T10:00:00.123456Z op=load handle=data/4d2b... bytes=4194304 duration=0.251312 retries=0 outcome=ok
+//
+// The duration is given in seconds. retries is the number of failed attempts
+// of the same request directly before this one. outcome is one of "ok",
+// "not-exist" and "error", the latter is followed by the quoted error message.
+package trace
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/restic"
+)
+
+// Backend traces the requests passed to the wrapped backend. To observe
+// retries individually, it must be wrapped by the retry backend.
+type Backend struct {
+	restic.Backend
+
+	m         sync.Mutex
+	w         io.Writer
+	now       func() time.Time
+	durations map[string][]time.Duration
+	failed    map[string]int
+}
+
+// statically ensure that Backend implements restic.Backend.
+var _ restic.Backend = &Backend{}
+
+// New returns a backend which writes a trace line for each request sent to be
+// to w. If w is nil, the lines are written to the debug log. If w implements
+// io.Closer, it is closed together with the backend.
+func New(be restic.Backend, w io.Writer) *Backend {
+	return &Backend{
+		Backend:   be,
+		w:         w,
+		now:       time.Now,
+		durations: make(map[string][]time.Duration),
+		failed:    make(map[string]int),
+	}
+}
+
+// request is a request which is currently traced.
+type request struct {
+	op      string
+	handle  string
+	start   time.Time
+	retries int
+}
+
+func (be *Backend) start(op, handle string) *request {
+	be.m.Lock()
+	defer be.m.Unlock()
+
+	return &request{
+		op:      op,
+		handle:  handle,
+		start:   be.now(),
+		retries: be.failed[op+" "+handle],
+	}
+}
+
+func (be *Backend) finish(req *request, bytes uint64, err error) {
+	be.m.Lock()
+	defer be.m.Unlock()
+
+	d := be.now().Sub(req.start)
+	be.add(req.op, d)
+
+	outcome := "ok"
+	key := req.op + " " + req.handle
+	switch {
+	case err == nil:
+		delete(be.failed, key)
+	case be.Backend.IsNotExist(err):
+		outcome = "not-exist"
+		delete(be.failed, key)
+	default:
+		outcome = "error err=" + strconv.Quote(err.Error())
+		be.failed[key]++
+	}
+
+	line := fmt.Sprintf("time=%s op=%s handle=%s bytes=%d duration=%.6f retries=%d outcome=%s",
+		req.start.UTC().Format(time.RFC3339Nano), req.op, req.handle, bytes, d.Seconds(), req.retries, outcome)
+	if be.w == nil {
+		debug.Log("%s", line)
+		return
+	}
+	_, werr := io.WriteString(be.w, line+"\n")
+	if werr != nil {
+		debug.Log("unable to write trace: %v", werr)
+	}
+}
+
+func (be *Backend) add(op string, d time.Duration) {
+	be.durations[op] = append(be.durations[op], d)
+}
+
+func handleString(h restic.Handle) string {
+	if h.Name == "" {
+		return h.Type.String()
+	}
+	return h.Type.String() + "/" + h.Name
+}
+
+// Save traces the request, bytes is the size of the data to save.
+func (be *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	req := be.start("save", handleString(h))
+	err := be.Backend.Save(ctx, h, rd)
+	be.finish(req, uint64(rd.Length()), err)
+	return err
+}
+
+// Load traces the request, bytes is the amount of data read by the consumer.
+func (be *Backend) Load(ctx context.Context, h restic.Handle, length int, offset int64, consumer func(rd io.Reader) error) error {
+	req := be.start("load", handleString(h))
+	var bytes uint64
+	err := be.Backend.Load(ctx, h, length, offset, func(rd io.Reader) error {
+		return consumer(&countingReader{rd: rd, count: &bytes})
+	})
+	be.finish(req, bytes, err)
+	return err
+}
+
+func (be *Backend) Stat(ctx context.Context, h restic.Handle) (restic.FileInfo, error) {
+	req := be.start("stat", handleString(h))
+	fi, err := be.Backend.Stat(ctx, h)
+	be.finish(req, 0, err)
+	return fi, err
+}
+
+func (be *Backend) List(ctx context.Context, t restic.FileType, fn func(restic.FileInfo) error) error {
+	req := be.start("list", t.String())
+	err := be.Backend.List(ctx, t, fn)
+	be.finish(req, 0, err)
+	return err
+}
+
+func (be *Backend) Remove(ctx context.Context, h restic.Handle) error {
+	req := be.start("remove", handleString(h))
+	err := be.Backend.Remove(ctx, h)
+	be.finish(req, 0, err)
+	return err
+}
+
+// Close closes the wrapped backend and the trace writer, if it implements
+// io.Closer.
+func (be *Backend) Close() error {
+	err := be.Backend.Close()
+	if c, ok := be.w.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (be *Backend) Unwrap() restic.Backend { return be.Backend }
+
+// OpSummary contains the latency statistics of one type of operation.
+type OpSummary struct {
+	Op       string
+	Requests int
+	P50      time.Duration
+	P95      time.Duration
+}
+
+func (s OpSummary) String() string {
+	return fmt.Sprintf("%s: %d requests, p50 %v, p95 %v", s.Op, s.Requests, s.P50, s.P95)
+}
+
+// Summary returns the latency statistics of the requests traced so far,
+// sorted by the name of the operation.
+func (be *Backend) Summary() []OpSummary {
+	be.m.Lock()
+	defer be.m.Unlock()
+
+	summary := make([]OpSummary, 0, len(be.durations))
+	for op, durations := range be.durations {
+		sorted := append([]time.Duration(nil), durations...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		summary = append(summary, OpSummary{
+			Op:       op,
+			Requests: len(sorted),
+			P50:      percentile(sorted, 50),
+			P95:      percentile(sorted, 95),
+		})
+	}
+
+	sort.Slice(summary, func(i, j int) bool { return summary[i].Op < summary[j].Op })
+	return summary
+}
+
+// percentile returns the p-th percentile of the sorted durations using the
+// nearest-rank method.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// FormatSummary returns the summary as a single line.
+func FormatSummary(summary []OpSummary) string {
+	parts := make([]string, 0, len(summary))
+	for _, s := range summary {
+		parts = append(parts, s.String())
+	}
+	return strings.Join(parts, "; ")
+}
+
+type countingReader struct {
+	rd    io.Reader
+	count *uint64
+}
+
+func (rd *countingReader) Read(p []byte) (int, error) {
+	n, err := rd.rd.Read(p)
+	*rd.count += uint64(n)
+	return n, err
+}
@@ -0,0 +1,141 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/backend/mem"
+	"github.com/restic/restic/internal/backend/mock"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestPercentile(t *testing.T) {
+	var durations []time.Duration
+	for i := 1; i <= 20; i++ {
+		durations = append(durations, time.Duration(i)*time.Millisecond)
+	}
+
+	for _, test := range []struct {
+		durations []time.Duration
+		p         float64
+		expected  time.Duration
+	}{
+		{nil, 50, 0},
+		{durations[:1], 50, 1 * time.Millisecond},
+		{durations[:1], 95, 1 * time.Millisecond},
+		{durations[:2], 50, 1 * time.Millisecond},
+		{durations[:2], 95, 2 * time.Millisecond},
+		{durations[:3], 50, 2 * time.Millisecond},
+		{durations, 0, 1 * time.Millisecond},
+		{durations, 50, 10 * time.Millisecond},
+		{durations, 95, 19 * time.Millisecond},
+		{durations, 100, 20 * time.Millisecond},
+	} {
+		rtest.Equals(t, test.expected, percentile(test.durations, test.p))
+	}
+}
+
+func TestSummary(t *testing.T) {
+	be := New(mem.New(), nil)
+	// add the durations in reverse order, the summary must sort them
+	for i := 100; i >= 1; i-- {
+		be.add("load", time.Duration(i)*time.Millisecond)
+	}
+	be.add("save", 30*time.Millisecond)
+	be.add("save", 10*time.Millisecond)
+	be.add("save", 20*time.Millisecond)
+
+	summary := be.Summary()
+	rtest.Equals(t, []OpSummary{
+		{Op: "load", Requests: 100, P50: 50 * time.Millisecond, P95: 95 * time.Millisecond},
+		{Op: "save", Requests: 3, P50: 20 * time.Millisecond, P95: 30 * time.Millisecond},
+	}, summary)
+	rtest.Equals(t, "load: 100 requests, p50 50ms, p95 95ms; save: 3 requests, p50 20ms, p95 30ms", FormatSummary(summary))
+}
+
+// newTestBackend returns a trace backend whose clock advances by step on
+// every request.
+func newTestBackend(be restic.Backend, w io.Writer, step time.Duration) *Backend {
+	tbe := New(be, w)
+	now := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	tbe.now = func() time.Time {
+		now = now.Add(step)
+		return now
+	}
+	return tbe
+}
+
+func TestTrace(t *testing.T) {
+	buf := &bytes.Buffer{}
+	be := newTestBackend(mem.New(), buf, 250*time.Millisecond)
+	ctx := context.TODO()
+
+	data := []byte("foobar")
+	h := restic.Handle{Type: restic.PackFile, Name: "abcd"}
+	rtest.OK(t, be.Save(ctx, h, restic.NewByteReader(data, be.Hasher())))
+	rtest.OK(t, be.Load(ctx, h, 3, 1, func(rd io.Reader) error {
+		_, err := io.ReadAll(rd)
+		return err
+	}))
+	_, err := be.Stat(ctx, restic.Handle{Type: restic.PackFile, Name: "missing"})
+	rtest.Assert(t, be.IsNotExist(err), "unexpected error %v", err)
+	rtest.OK(t, be.List(ctx, restic.PackFile, func(restic.FileInfo) error { return nil }))
+	rtest.OK(t, be.Remove(ctx, h))
+
+	rtest.Equals(t, []string{
+		"time=2023-05-01T10:00:00.25Z op=save handle=data/abcd bytes=6 duration=0.250000 retries=0 outcome=ok",
+		"time=2023-05-01T10:00:00.75Z op=load handle=data/abcd bytes=3 duration=0.250000 retries=0 outcome=ok",
+		"time=2023-05-01T10:00:01.25Z op=stat handle=data/missing bytes=0 duration=0.250000 retries=0 outcome=not-exist",
+		"time=2023-05-01T10:00:01.75Z op=list handle=data bytes=0 duration=0.250000 retries=0 outcome=ok",
+		"time=2023-05-01T10:00:02.25Z op=remove handle=data/abcd bytes=0 duration=0.250000 retries=0 outcome=ok",
+	}, strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n"))
+
+	summary := be.Summary()
+	rtest.Equals(t, 5, len(summary))
+	for _, s := range summary {
+		rtest.Equals(t, 1, s.Requests)
+		rtest.Equals(t, 250*time.Millisecond, s.P95)
+	}
+}
+
+func TestTraceRetries(t *testing.T) {
+	failures := 2
+	mbe := mock.NewBackend()
+	mbe.SaveFn = func(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+		if failures > 0 {
+			failures--
+			return errors.New("connection reset")
+		}
+		return nil
+	}
+
+	buf := &bytes.Buffer{}
+	be := newTestBackend(mbe, buf, time.Second)
+	h := restic.Handle{Type: restic.IndexFile, Name: "abcd"}
+	for i := 0; i < 3; i++ {
+		_ = be.Save(context.TODO(), h, restic.NewByteReader([]byte("foo"), nil))
+	}
+	// the retry count starts over after a successful request
+	failures = 1
+	for i := 0; i < 2; i++ {
+		_ = be.Save(context.TODO(), h, restic.NewByteReader([]byte("foo"), nil))
+	}
+
+	var outcomes []string
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		outcomes = append(outcomes, line[strings.Index(line, "retries="):])
+	}
+	rtest.Equals(t, []string{
+		`retries=0 outcome=error err="connection reset"`,
+		`retries=1 outcome=error err="connection reset"`,
+		`retries=2 outcome=ok`,
+		`retries=0 outcome=error err="connection reset"`,
+		`retries=1 outcome=ok`,
+	}, outcomes)
+}
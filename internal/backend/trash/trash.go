@@ -0,0 +1,122 @@
+// Package trash implements a backend wrapper which moves removed files to the
+// trash instead of deleting them right away.
+package trash
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/options"
+	"github.com/restic/restic/internal/restic"
+)
+
+// Config contains the options for the trash.
+type Config struct {
+	Trash string `option:"trash" help:"keep removed files in the trash for the given duration, e.g. 30d (default: remove files immediately)"`
+}
+
+func init() {
+	options.Register("backend", Config{})
+}
+
+// timeFormat is used for the time a file was moved to the trash, which is
+// the first part of the name of the file in the trash. The time includes
+// nanoseconds so that a file can be removed several times.
+const timeFormat = "20060102T150405.000000000Z"
+
+// Backend moves removed files to the trash. Lock files are removed
+// immediately.
+type Backend struct {
+	restic.Backend
+	now func() time.Time
+}
+
+// ensure statically that *Backend implements restic.Backend.
+var _ restic.Backend = &Backend{}
+
+// New returns a backend which moves removed files to the trash.
+func New(be restic.Backend) *Backend {
+	return &Backend{
+		Backend: be,
+		now:     time.Now,
+	}
+}
+
+// trashName returns the name for the file h in the trash if it is moved
+// there at time t.
+func trashName(h restic.Handle, t time.Time) string {
+	return t.UTC().Format(timeFormat) + "-" + h.Type.String() + "-" + h.Name
+}
+
+// removedAt returns the time the file with the given name was moved to the
+// trash.
+func removedAt(name string) (time.Time, error) {
+	ts, _, _ := strings.Cut(name, "-")
+	return time.Parse(timeFormat, ts)
+}
+
+// Remove moves the file to the trash. If the underlying backend can rename
+// files, the file is moved directly, otherwise it is copied to the trash and
+// removed afterwards. Copying a file downloads it completely into memory and
+// uploads it again, which on object stores multiplies the traffic, the number
+// of requests and thus the cost of removing files.
+func (be *Backend) Remove(ctx context.Context, h restic.Handle) error {
+	if h.Type == restic.LockFile || h.Type == restic.TrashFile {
+		return be.Backend.Remove(ctx, h)
+	}
+
+	th := restic.Handle{Type: restic.TrashFile, Name: trashName(h, be.now())}
+	debug.Log("moving %v to the trash as %v", h, th)
+
+	if renamer := restic.AsBackend[restic.Renamer](be.Backend); renamer != nil {
+		return renamer.Rename(ctx, h, th)
+	}
+
+	// the whole file is loaded, as some backends need the hash of the data
+	// before the upload starts
+	buf, err := backend.LoadAll(ctx, nil, be.Backend, h)
+	if err != nil {
+		return err
+	}
+
+	err = be.Backend.Save(ctx, th, restic.NewByteReader(buf, be.Backend.Hasher()))
+	if err != nil {
+		return err
+	}
+
+	return be.Backend.Remove(ctx, h)
+}
+
+func (be *Backend) Unwrap() restic.Backend {
+	return be.Backend
+}
+
+// Expiry returns the time before which files must have been moved to the
+// trash so that they can be removed permanently at time now, if they are
+// kept for the duration retention.
+func Expiry(now time.Time, retention restic.Duration) time.Time {
+	r := retention
+	return now.AddDate(-r.Years, -r.Months, -r.Days).Add(time.Hour * time.Duration(-r.Hours))
+}
+
+// Expired returns the handles for all files which were moved to the trash
+// before the given time. Removing them via be deletes them permanently.
+func Expired(ctx context.Context, be restic.Backend, before time.Time) ([]restic.Handle, error) {
+	var expired []restic.Handle
+	err := be.List(ctx, restic.TrashFile, func(fi restic.FileInfo) error {
+		t, err := removedAt(fi.Name)
+		if err != nil {
+			debug.Log("ignoring file %v in the trash: %v", fi.Name, err)
+			return nil
+		}
+
+		if t.Before(before) {
+			expired = append(expired, restic.Handle{Type: restic.TrashFile, Name: fi.Name})
+		}
+		return nil
+	})
+	return expired, err
+}
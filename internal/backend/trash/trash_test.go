@@ -0,0 +1,159 @@
+package trash
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/local"
+	"github.com/restic/restic/internal/backend/location"
+	"github.com/restic/restic/internal/backend/mem"
+	"github.com/restic/restic/internal/backend/test"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// trashFactory wraps all backends created by the factory with the trash.
+type trashFactory struct {
+	location.Factory
+}
+
+func (f trashFactory) Create(ctx context.Context, cfg interface{}, rt http.RoundTripper) (restic.Backend, error) {
+	be, err := f.Factory.Create(ctx, cfg, rt)
+	if err != nil {
+		return nil, err
+	}
+	return New(be), nil
+}
+
+func (f trashFactory) Open(ctx context.Context, cfg interface{}, rt http.RoundTripper) (restic.Backend, error) {
+	be, err := f.Factory.Open(ctx, cfg, rt)
+	if err != nil {
+		return nil, err
+	}
+	return New(be), nil
+}
+
+func TestSuiteBackendMem(t *testing.T) {
+	suite := &test.Suite[struct{}]{
+		NewConfig: func() (*struct{}, error) {
+			return &struct{}{}, nil
+		},
+		Factory: trashFactory{mem.NewFactory()},
+	}
+	suite.RunTests(t)
+}
+
+func TestSuiteBackendLocal(t *testing.T) {
+	suite := &test.Suite[local.Config]{
+		NewConfig: func() (*local.Config, error) {
+			return &local.Config{Path: rtest.TempDir(t), Connections: 2}, nil
+		},
+		Factory: trashFactory{local.NewFactory()},
+	}
+	suite.RunTests(t)
+}
+
+func save(t testing.TB, be restic.Backend, h restic.Handle, data []byte) {
+	rtest.OK(t, be.Save(context.TODO(), h, restic.NewByteReader(data, be.Hasher())))
+}
+
+func listTrash(t testing.TB, be restic.Backend) []string {
+	var names []string
+	rtest.OK(t, be.List(context.TODO(), restic.TrashFile, func(fi restic.FileInfo) error {
+		names = append(names, fi.Name)
+		return nil
+	}))
+	return names
+}
+
+func testTrashContents(t *testing.T, inner restic.Backend) {
+	now := time.Date(2023, 4, 5, 6, 7, 8, 0, time.UTC)
+	be := New(inner)
+	be.now = func() time.Time { return now }
+
+	data := rtest.Random(23, 1234)
+	id := restic.Hash(data)
+	h := restic.Handle{Type: restic.PackFile, Name: id.String()}
+	save(t, be, h, data)
+
+	lock := restic.Handle{Type: restic.LockFile, Name: restic.NewRandomID().String()}
+	save(t, be, lock, []byte("lock"))
+
+	rtest.OK(t, be.Remove(context.TODO(), h))
+	rtest.OK(t, be.Remove(context.TODO(), lock))
+
+	_, err := be.Stat(context.TODO(), h)
+	rtest.Assert(t, be.IsNotExist(err), "removed file still exists: %v", err)
+
+	// only the pack file must be in the trash
+	names := listTrash(t, be)
+	want := "20230405T060708.000000000Z-data-" + id.String()
+	rtest.Equals(t, []string{want}, names)
+
+	buf, err := backend.LoadAll(context.TODO(), nil, be, restic.Handle{Type: restic.TrashFile, Name: want})
+	rtest.OK(t, err)
+	rtest.Assert(t, bytes.Equal(data, buf), "wrong data in trash")
+
+	// removing a file from the trash deletes it permanently
+	rtest.OK(t, be.Remove(context.TODO(), restic.Handle{Type: restic.TrashFile, Name: want}))
+	rtest.Equals(t, 0, len(listTrash(t, be)))
+}
+
+func TestTrashContentsCopy(t *testing.T) {
+	testTrashContents(t, mem.New())
+}
+
+func TestTrashContentsRename(t *testing.T) {
+	cfg := local.Config{Path: rtest.TempDir(t), Connections: 2}
+	be, err := local.Create(context.TODO(), cfg)
+	rtest.OK(t, err)
+	defer func() {
+		rtest.OK(t, be.Close())
+	}()
+
+	// the trash directory must be created on demand
+	_, err = os.Stat(filepath.Join(cfg.Path, "trash"))
+	rtest.Assert(t, os.IsNotExist(err), "trash directory should not exist yet: %v", err)
+
+	testTrashContents(t, be)
+}
+
+func TestExpired(t *testing.T) {
+	inner := mem.New()
+	be := New(inner)
+
+	now := time.Date(2023, 4, 5, 6, 7, 8, 0, time.UTC)
+	for _, days := range []int{0, 10, 29, 31, 100} {
+		data := rtest.Random(days, 100)
+		h := restic.Handle{Type: restic.PackFile, Name: restic.Hash(data).String()}
+		save(t, be, h, data)
+
+		be.now = func() time.Time { return now.AddDate(0, 0, -days) }
+		rtest.OK(t, be.Remove(context.TODO(), h))
+	}
+
+	// files which are not in the expected format are never removed
+	save(t, inner, restic.Handle{Type: restic.TrashFile, Name: "foo"}, []byte("foo"))
+
+	expiry := Expiry(now, restic.Duration{Days: 30})
+	rtest.Equals(t, now.AddDate(0, 0, -30), expiry)
+
+	expired, err := Expired(context.TODO(), be, expiry)
+	rtest.OK(t, err)
+	rtest.Equals(t, 2, len(expired))
+	for _, h := range expired {
+		rtest.OK(t, be.Remove(context.TODO(), h))
+	}
+	rtest.Equals(t, 4, len(listTrash(t, be)))
+
+	// with a zero retention all remaining files are expired
+	expired, err = Expired(context.TODO(), be, Expiry(now.Add(time.Second), restic.Duration{}))
+	rtest.OK(t, err)
+	rtest.Equals(t, 3, len(expired))
+}
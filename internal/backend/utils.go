@@ -75,6 +75,18 @@ func DefaultLoad(ctx context.Context, h restic.Handle, length int, offset int64,
 	return rd.Close()
 }
 
+// VerifyUploadChecksum compares the checksum computed while uploading the file
+// for handle h with the checksum reported by the backend. A mismatch means that
+// the data was corrupted on the way to the backend. The returned error makes
+// the retry backend upload the file again.
+func VerifyUploadChecksum(h restic.Handle, algorithm string, local, remote []byte) error {
+	if !bytes.Equal(local, remote) {
+		return errors.Errorf("Save(%v): %v checksum mismatch, uploaded data has %x, backend reported %x",
+			h, algorithm, local, remote)
+	}
+	return nil
+}
+
 // DefaultDelete removes all restic keys in the bucket. It will not remove the bucket itself.
 func DefaultDelete(ctx context.Context, be restic.Backend) error {
 	alltypes := []restic.FileType{
@@ -82,7 +94,8 @@ func DefaultDelete(ctx context.Context, be restic.Backend) error {
 		restic.KeyFile,
 		restic.LockFile,
 		restic.SnapshotFile,
-		restic.IndexFile}
+		restic.IndexFile,
+		restic.TrashFile}
 
 	for _, t := range alltypes {
 		err := be.List(ctx, t, func(fi restic.FileInfo) error {
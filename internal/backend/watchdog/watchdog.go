@@ -0,0 +1,257 @@
+// Package watchdog implements a backend wrapper which aborts operations that
+// hang, for example because a server accepted a connection but stopped
+// responding.
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/options"
+	"github.com/restic/restic/internal/restic"
+)
+
+// Config contains the timeouts for backend operations. A zero request or
+// stuck timeout disables the corresponding check, a zero connect timeout
+// uses the default of the HTTP transport.
+type Config struct {
+	ConnectTimeout time.Duration `option:"connect-timeout" help:"abort connection attempts to the backend after this duration"`
+	RequestTimeout time.Duration `option:"request-timeout" help:"abort Stat and Remove requests, and listings which return no new file, after this duration"`
+	StuckTimeout   time.Duration `option:"stuck-timeout" help:"abort uploads and downloads if no data was transferred for this duration"`
+}
+
+// NewConfig returns a new Config with the default values filled in.
+func NewConfig() Config {
+	return Config{
+		ConnectTimeout: 30 * time.Second,
+		RequestTimeout: 2 * time.Minute,
+		StuckTimeout:   5 * time.Minute,
+	}
+}
+
+func init() {
+	options.Register("backend", NewConfig())
+}
+
+// StalledError is returned if an operation was aborted because it made no
+// progress. The operation can be retried.
+type StalledError struct {
+	Op      string
+	Timeout time.Duration
+}
+
+func (e *StalledError) Error() string {
+	return fmt.Sprintf("%v stalled: no progress for %v", e.Op, e.Timeout)
+}
+
+// timer cancels a context once it has not been reset for the timeout. It can
+// be paused while the caller of a backend operation is running, so that only
+// the time spent waiting for the backend is taken into account.
+type timer struct {
+	timeout time.Duration
+	cancel  context.CancelFunc
+
+	m      sync.Mutex
+	t      *time.Timer
+	fired  bool
+	paused bool
+}
+
+func newTimer(ctx context.Context, timeout time.Duration) (context.Context, *timer) {
+	ctx, cancel := context.WithCancel(ctx)
+	t := &timer{
+		timeout: timeout,
+		cancel:  cancel,
+	}
+	t.t = time.AfterFunc(timeout, t.fire)
+	return ctx, t
+}
+
+func (t *timer) fire() {
+	t.m.Lock()
+	defer t.m.Unlock()
+	if t.paused {
+		return
+	}
+	t.fired = true
+	t.cancel()
+}
+
+// progress restarts the timeout.
+func (t *timer) progress() {
+	t.m.Lock()
+	defer t.m.Unlock()
+	t.t.Reset(t.timeout)
+}
+
+// pause stops the timer until resume is called.
+func (t *timer) pause() {
+	t.m.Lock()
+	defer t.m.Unlock()
+	t.paused = true
+	t.t.Stop()
+}
+
+// resume restarts the timer after a call to pause.
+func (t *timer) resume() {
+	t.m.Lock()
+	defer t.m.Unlock()
+	t.paused = false
+	t.t.Reset(t.timeout)
+}
+
+// stop releases the timer and returns whether it has fired.
+func (t *timer) stop() bool {
+	t.m.Lock()
+	defer t.m.Unlock()
+	t.t.Stop()
+	t.cancel()
+	return t.fired
+}
+
+// progressReader restarts the timer whenever data was read.
+type progressReader struct {
+	restic.RewindReader
+	t *timer
+}
+
+func (rd *progressReader) Read(p []byte) (int, error) {
+	n, err := rd.RewindReader.Read(p)
+	if n > 0 {
+		rd.t.progress()
+	}
+	return n, err
+}
+
+// pausingReader runs the timer only while a read is in progress.
+type pausingReader struct {
+	io.Reader
+	t *timer
+}
+
+func (rd *pausingReader) Read(p []byte) (int, error) {
+	rd.t.resume()
+	n, err := rd.Reader.Read(p)
+	rd.t.pause()
+	return n, err
+}
+
+// Backend aborts operations which make no progress.
+type Backend struct {
+	restic.Backend
+	cfg Config
+}
+
+// statically ensure that Backend implements restic.Backend.
+var _ restic.Backend = &Backend{}
+var _ restic.RangeCopier = &Backend{}
+
+// New returns a backend which aborts operations of be if they exceed the
+// timeouts in cfg.
+func New(be restic.Backend, cfg Config) *Backend {
+	return &Backend{
+		Backend: be,
+		cfg:     cfg,
+	}
+}
+
+// check returns a StalledError if the operation failed after the timer has
+// fired, otherwise err.
+func check(t *timer, op string, timeout time.Duration, err error) error {
+	if t.stop() && err != nil {
+		debug.Log("%v stalled, original error: %v", op, err)
+		return &StalledError{Op: op, Timeout: timeout}
+	}
+	return err
+}
+
+// Save stores the data in the backend, it is aborted if no data was read
+// from rd for the stuck timeout.
+func (be *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	if be.cfg.StuckTimeout == 0 {
+		return be.Backend.Save(ctx, h, rd)
+	}
+
+	ctx, t := newTimer(ctx, be.cfg.StuckTimeout)
+	err := be.Backend.Save(ctx, h, &progressReader{RewindReader: rd, t: t})
+	return check(t, fmt.Sprintf("Save(%v)", h), be.cfg.StuckTimeout, err)
+}
+
+// Load runs fn with a reader that yields the contents of the file at h. It
+// is aborted if reading from the backend blocks for the stuck timeout. The
+// time spent in fn outside of reads is not taken into account.
+func (be *Backend) Load(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+	if be.cfg.StuckTimeout == 0 {
+		return be.Backend.Load(ctx, h, length, offset, fn)
+	}
+
+	ctx, t := newTimer(ctx, be.cfg.StuckTimeout)
+	err := be.Backend.Load(ctx, h, length, offset, func(rd io.Reader) error {
+		t.pause()
+		defer t.resume()
+		return fn(&pausingReader{Reader: rd, t: t})
+	})
+	return check(t, fmt.Sprintf("Load(%v, %v, %v)", h, length, offset), be.cfg.StuckTimeout, err)
+}
+
+// CopyRange copies a range of the file at h to dst. As the copy does not
+// report progress, it is aborted if it does not complete within the stuck
+// timeout.
+func (be *Backend) CopyRange(ctx context.Context, h restic.Handle, length int, offset int64, dst *os.File) error {
+	if be.cfg.StuckTimeout == 0 {
+		return restic.CopyRange(ctx, be.Backend, h, length, offset, dst)
+	}
+
+	ctx, t := newTimer(ctx, be.cfg.StuckTimeout)
+	err := restic.CopyRange(ctx, be.Backend, h, length, offset, dst)
+	return check(t, fmt.Sprintf("CopyRange(%v, %v, %v)", h, length, offset), be.cfg.StuckTimeout, err)
+}
+
+// Stat returns information about the file at h, it is aborted after the
+// request timeout.
+func (be *Backend) Stat(ctx context.Context, h restic.Handle) (restic.FileInfo, error) {
+	if be.cfg.RequestTimeout == 0 {
+		return be.Backend.Stat(ctx, h)
+	}
+
+	ctx, t := newTimer(ctx, be.cfg.RequestTimeout)
+	fi, err := be.Backend.Stat(ctx, h)
+	return fi, check(t, fmt.Sprintf("Stat(%v)", h), be.cfg.RequestTimeout, err)
+}
+
+// Remove removes the file at h, it is aborted after the request timeout.
+func (be *Backend) Remove(ctx context.Context, h restic.Handle) error {
+	if be.cfg.RequestTimeout == 0 {
+		return be.Backend.Remove(ctx, h)
+	}
+
+	ctx, t := newTimer(ctx, be.cfg.RequestTimeout)
+	err := be.Backend.Remove(ctx, h)
+	return check(t, fmt.Sprintf("Remove(%v)", h), be.cfg.RequestTimeout, err)
+}
+
+// List runs fn for each file of type t. Listing is aborted if no new file
+// was returned by the backend for the request timeout. The time spent in fn
+// is not taken into account.
+func (be *Backend) List(ctx context.Context, tpe restic.FileType, fn func(restic.FileInfo) error) error {
+	if be.cfg.RequestTimeout == 0 {
+		return be.Backend.List(ctx, tpe, fn)
+	}
+
+	ctx, t := newTimer(ctx, be.cfg.RequestTimeout)
+	err := be.Backend.List(ctx, tpe, func(fi restic.FileInfo) error {
+		t.pause()
+		defer t.resume()
+		return fn(fi)
+	})
+	return check(t, fmt.Sprintf("List(%v)", tpe), be.cfg.RequestTimeout, err)
+}
+
+func (be *Backend) Unwrap() restic.Backend {
+	return be.Backend
+}
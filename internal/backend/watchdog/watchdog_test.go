@@ -0,0 +1,170 @@
+package watchdog_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/mem"
+	"github.com/restic/restic/internal/backend/rest"
+	"github.com/restic/restic/internal/backend/retry"
+	"github.com/restic/restic/internal/backend/watchdog"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// stallingServer serves data, but the first request of each method stalls
+// until the client gives up.
+type stallingServer struct {
+	data []byte
+
+	m        sync.Mutex
+	requests map[string]int
+}
+
+func (s *stallingServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.m.Lock()
+	s.requests[r.Method]++
+	first := s.requests[r.Method] == 1
+	s.m.Unlock()
+
+	_, _ = io.Copy(io.Discard, r.Body)
+
+	if first {
+		if r.Method == http.MethodGet {
+			// send a part of the data, then stall
+			w.Header().Set("Content-Length", "100")
+			_, _ = w.Write(s.data[:10])
+			w.(http.Flusher).Flush()
+		}
+		<-r.Context().Done()
+		return
+	}
+
+	switch r.Method {
+	case http.MethodHead:
+		w.Header().Set("Content-Length", "100")
+	case http.MethodGet:
+		_, _ = w.Write(s.data)
+	}
+}
+
+func (s *stallingServer) count(method string) int {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.requests[method]
+}
+
+func newStallingBackend(t *testing.T) (restic.Backend, *stallingServer) {
+	srv := &stallingServer{
+		data:     rtest.Random(23, 100),
+		requests: make(map[string]int),
+	}
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+
+	u, err := url.Parse(ts.URL)
+	rtest.OK(t, err)
+	cfg := rest.NewConfig()
+	cfg.URL = u
+	rt, err := backend.Transport(backend.TransportOptions{})
+	rtest.OK(t, err)
+	be, err := rest.Open(context.TODO(), cfg, rt)
+	rtest.OK(t, err)
+
+	wcfg := watchdog.Config{
+		RequestTimeout: 100 * time.Millisecond,
+		StuckTimeout:   100 * time.Millisecond,
+	}
+	var reported []error
+	rbe := retry.New(watchdog.New(be, wcfg), 3, func(msg string, err error, d time.Duration) {
+		reported = append(reported, err)
+	}, nil)
+	t.Cleanup(func() {
+		for _, err := range reported {
+			var stalled *watchdog.StalledError
+			rtest.Assert(t, errors.As(err, &stalled), "unexpected error %v", err)
+		}
+	})
+	return rbe, srv
+}
+
+func TestStalledLoad(t *testing.T) {
+	be, srv := newStallingBackend(t)
+
+	h := restic.Handle{Type: restic.PackFile, Name: restic.NewRandomID().String()}
+	var buf []byte
+	err := be.Load(context.TODO(), h, 0, 0, func(rd io.Reader) error {
+		var err error
+		buf, err = io.ReadAll(rd)
+		return err
+	})
+	rtest.OK(t, err)
+	rtest.Equals(t, srv.data, buf)
+	rtest.Equals(t, 2, srv.count(http.MethodGet))
+}
+
+func TestStalledSave(t *testing.T) {
+	be, srv := newStallingBackend(t)
+
+	h := restic.Handle{Type: restic.PackFile, Name: restic.NewRandomID().String()}
+	err := be.Save(context.TODO(), h, restic.NewByteReader(srv.data, nil))
+	rtest.OK(t, err)
+	rtest.Equals(t, 2, srv.count(http.MethodPost))
+}
+
+func TestStalledStat(t *testing.T) {
+	be, srv := newStallingBackend(t)
+
+	h := restic.Handle{Type: restic.PackFile, Name: restic.NewRandomID().String()}
+	fi, err := be.Stat(context.TODO(), h)
+	rtest.OK(t, err)
+	rtest.Equals(t, int64(100), fi.Size)
+	rtest.Equals(t, 2, srv.count(http.MethodHead))
+}
+
+func TestSlowConsumer(t *testing.T) {
+	data := rtest.Random(42, 1000)
+	h := restic.Handle{Type: restic.PackFile, Name: restic.Hash(data).String()}
+	mbe := mem.New()
+	rtest.OK(t, mbe.Save(context.TODO(), h, restic.NewByteReader(data, mbe.Hasher())))
+
+	be := watchdog.New(mbe, watchdog.Config{
+		RequestTimeout: 50 * time.Millisecond,
+		StuckTimeout:   50 * time.Millisecond,
+	})
+
+	// the time spent by the caller is not taken into account
+	err := be.Load(context.TODO(), h, 0, 0, func(rd io.Reader) error {
+		buf := make([]byte, 100)
+		var out bytes.Buffer
+		for {
+			time.Sleep(20 * time.Millisecond)
+			n, err := rd.Read(buf)
+			out.Write(buf[:n])
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+		rtest.Equals(t, data, out.Bytes())
+		return nil
+	})
+	rtest.OK(t, err)
+
+	err = be.List(context.TODO(), restic.PackFile, func(fi restic.FileInfo) error {
+		time.Sleep(100 * time.Millisecond)
+		return nil
+	})
+	rtest.OK(t, err)
+}
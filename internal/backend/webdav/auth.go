@@ -0,0 +1,254 @@
+package webdav
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/restic/restic/internal/debug"
+)
+
+// authTransport adds HTTP basic or digest authentication to requests. Basic
+// authentication is used until the server responds with a digest challenge,
+// afterwards all requests are authenticated using digest authentication.
+type authTransport struct {
+	rt       http.RoundTripper
+	username string
+	password string
+
+	m      sync.Mutex
+	digest *digestChallenge
+	nc     uint32
+}
+
+func newAuthTransport(rt http.RoundTripper, username, password string) *authTransport {
+	return &authTransport{
+		rt:       rt,
+		username: username,
+		password: password,
+	}
+}
+
+// authorize returns a copy of req with authentication headers set.
+func (t *authTransport) authorize(req *http.Request) (*http.Request, error) {
+	req = req.Clone(req.Context())
+
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	if t.digest == nil {
+		req.SetBasicAuth(t.username, t.password)
+		return req, nil
+	}
+
+	t.nc++
+	cnonce, err := newCnonce()
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", t.digest.authorization(t.username, t.password, req.Method, req.URL.RequestURI(), t.nc, cnonce))
+	return req, nil
+}
+
+// RoundTrip executes a single HTTP transaction, retrying it once if the
+// server responds with a new digest challenge and the request body can be
+// sent again.
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.username == "" {
+		return t.rt.RoundTrip(req)
+	}
+
+	authReq, err := t.authorize(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.rt.RoundTrip(authReq)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	challenge, ok := findDigestChallenge(resp.Header.Values("WWW-Authenticate"))
+	if !ok || (req.Body != nil && req.GetBody == nil) {
+		return resp, nil
+	}
+
+	debug.Log("received digest challenge for realm %q, retrying request", challenge.realm)
+	t.m.Lock()
+	t.digest = challenge
+	t.nc = 0
+	t.m.Unlock()
+
+	_ = resp.Body.Close()
+
+	retry, err := t.authorize(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Body != nil {
+		retry.Body, err = req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return t.rt.RoundTrip(retry)
+}
+
+// digestChallenge contains the parameters of a digest authentication
+// challenge as described in RFC 7616.
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+}
+
+// findDigestChallenge returns the first digest challenge found in the list
+// of WWW-Authenticate header values.
+func findDigestChallenge(headers []string) (*digestChallenge, bool) {
+	for _, hdr := range headers {
+		scheme, params, _ := strings.Cut(strings.TrimSpace(hdr), " ")
+		if !strings.EqualFold(scheme, "digest") {
+			continue
+		}
+
+		c := &digestChallenge{}
+		for key, value := range parseAuthParams(params) {
+			switch key {
+			case "realm":
+				c.realm = value
+			case "nonce":
+				c.nonce = value
+			case "opaque":
+				c.opaque = value
+			case "algorithm":
+				c.algorithm = value
+			case "qop":
+				for _, qop := range strings.Split(value, ",") {
+					if strings.TrimSpace(qop) == "auth" {
+						c.qop = "auth"
+					}
+				}
+			}
+		}
+
+		if c.nonce == "" {
+			continue
+		}
+
+		return c, true
+	}
+
+	return nil, false
+}
+
+// parseAuthParams parses a comma separated list of key=value pairs, values
+// may be quoted strings.
+func parseAuthParams(s string) map[string]string {
+	params := make(map[string]string)
+
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return params
+		}
+
+		key, rest, found := strings.Cut(s, "=")
+		if !found {
+			return params
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		rest = strings.TrimLeft(rest, " \t")
+
+		var value strings.Builder
+		if strings.HasPrefix(rest, `"`) {
+			rest = rest[1:]
+			for len(rest) > 0 && rest[0] != '"' {
+				if rest[0] == '\\' && len(rest) > 1 {
+					rest = rest[1:]
+				}
+				value.WriteByte(rest[0])
+				rest = rest[1:]
+			}
+			rest = strings.TrimPrefix(rest, `"`)
+		} else {
+			v, r, _ := strings.Cut(rest, ",")
+			value.WriteString(strings.TrimSpace(v))
+			rest = r
+		}
+
+		params[key] = value.String()
+		s = rest
+	}
+}
+
+func (c *digestChallenge) newHash() hash.Hash {
+	switch strings.TrimSuffix(strings.ToUpper(c.algorithm), "-SESS") {
+	case "SHA-256":
+		return sha256.New()
+	default:
+		return md5.New()
+	}
+}
+
+func (c *digestChallenge) hash(s string) string {
+	h := c.newHash()
+	_, _ = h.Write([]byte(s))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// authorization returns the value for the Authorization header for a request
+// with the given method and uri.
+func (c *digestChallenge) authorization(username, password, method, uri string, nc uint32, cnonce string) string {
+	ha1 := c.hash(username + ":" + c.realm + ":" + password)
+	if strings.HasSuffix(strings.ToUpper(c.algorithm), "-SESS") {
+		ha1 = c.hash(ha1 + ":" + c.nonce + ":" + cnonce)
+	}
+	ha2 := c.hash(method + ":" + uri)
+
+	ncValue := fmt.Sprintf("%08x", nc)
+
+	var response string
+	if c.qop == "auth" {
+		response = c.hash(strings.Join([]string{ha1, c.nonce, ncValue, cnonce, c.qop, ha2}, ":"))
+	} else {
+		response = c.hash(ha1 + ":" + c.nonce + ":" + ha2)
+	}
+
+	parts := []string{
+		fmt.Sprintf("username=%q", username),
+		fmt.Sprintf("realm=%q", c.realm),
+		fmt.Sprintf("nonce=%q", c.nonce),
+		fmt.Sprintf("uri=%q", uri),
+		fmt.Sprintf("response=%q", response),
+	}
+	if c.algorithm != "" {
+		parts = append(parts, "algorithm="+c.algorithm)
+	}
+	if c.opaque != "" {
+		parts = append(parts, fmt.Sprintf("opaque=%q", c.opaque))
+	}
+	if c.qop == "auth" {
+		parts = append(parts, "qop=auth", "nc="+ncValue, fmt.Sprintf("cnonce=%q", cnonce))
+	}
+
+	return "Digest " + strings.Join(parts, ", ")
+}
+
+func newCnonce() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,82 @@
+package webdav
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestFindDigestChallenge(t *testing.T) {
+	c, ok := findDigestChallenge([]string{
+		`Basic realm="basic"`,
+		`Digest realm="testrealm@host.com", qop="auth,auth-int", nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093", opaque="5ccc069c403ebaf9f0171e9517f40e41"`,
+	})
+	rtest.Assert(t, ok, "digest challenge not found")
+	rtest.Equals(t, &digestChallenge{
+		realm:  "testrealm@host.com",
+		nonce:  "dcd98b7102dd2f0e8b11d0f600bfb0c093",
+		opaque: "5ccc069c403ebaf9f0171e9517f40e41",
+		qop:    "auth",
+	}, c)
+
+	_, ok = findDigestChallenge([]string{`Basic realm="basic"`})
+	rtest.Assert(t, !ok, "unexpected digest challenge found")
+}
+
+func TestDigestAuthorization(t *testing.T) {
+	// example from RFC 2617, section 3.5
+	c := &digestChallenge{
+		realm:  "testrealm@host.com",
+		nonce:  "dcd98b7102dd2f0e8b11d0f600bfb0c093",
+		opaque: "5ccc069c403ebaf9f0171e9517f40e41",
+		qop:    "auth",
+	}
+
+	auth := c.authorization("Mufasa", "Circle Of Life", "GET", "/dir/index.html", 1, "0a4f113b")
+	rtest.Assert(t, strings.Contains(auth, `response="6629fae49393a05397450978507c4ef1"`),
+		"wrong digest response in %q", auth)
+	rtest.Assert(t, strings.Contains(auth, "nc=00000001"), "wrong nonce count in %q", auth)
+}
+
+func TestAuthTransportDigest(t *testing.T) {
+	const nonce = "6e6f6e6365"
+	var requests int
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		c := &digestChallenge{realm: "restic", nonce: nonce, qop: "auth"}
+		hdr := r.Header.Get("Authorization")
+		params := parseAuthParams(strings.TrimPrefix(hdr, "Digest "))
+		if !strings.HasPrefix(hdr, "Digest ") {
+			w.Header().Set("WWW-Authenticate", `Digest realm="restic", nonce="`+nonce+`", qop="auth"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		want := parseAuthParams(strings.TrimPrefix(c.authorization("user", "secret", r.Method, r.URL.RequestURI(), 1, params["cnonce"]), "Digest "))
+		if params["response"] != want["response"] {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(body)
+	}))
+	defer srv.Close()
+
+	client := http.Client{Transport: newAuthTransport(http.DefaultTransport, "user", "secret")}
+	resp, err := client.Post(srv.URL+"/foo", "text/plain", strings.NewReader("body"))
+	rtest.OK(t, err)
+	body, err := io.ReadAll(resp.Body)
+	rtest.OK(t, err)
+	rtest.OK(t, resp.Body.Close())
+
+	rtest.Equals(t, http.StatusOK, resp.StatusCode)
+	rtest.Equals(t, "body", string(body))
+	rtest.Equals(t, 2, requests)
+}
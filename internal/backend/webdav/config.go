@@ -0,0 +1,102 @@
+package webdav
+
+import (
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/restic/restic/internal/backend/location"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/options"
+	"github.com/restic/restic/internal/restic"
+)
+
+// Config contains all configuration necessary to connect to a WebDAV server.
+type Config struct {
+	// URL is the location of the repository on the server, without the
+	// password. The user name (if any) is kept in the URL.
+	URL      *url.URL
+	Password options.SecretString
+
+	Connections uint `option:"connections" help:"set a limit for the number of concurrent connections"`
+}
+
+func init() {
+	options.Register("webdav", NewConfig())
+}
+
+// NewConfig returns a new Config with the default values filled in.
+func NewConfig() Config {
+	return Config{
+		Connections: 5,
+	}
+}
+
+// ParseConfig parses the string s and extracts the WebDAV server URL. The
+// format is webdav:http[s]://[user[:password]@]host[:port]/path.
+func ParseConfig(s string) (*Config, error) {
+	if !strings.HasPrefix(s, "webdav:") {
+		return nil, errors.New("invalid WebDAV backend specification")
+	}
+	s = s[len("webdav:"):]
+
+	u, err := location.ParseURL(s)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.Errorf("invalid URL scheme %q, expected http or https", u.Scheme)
+	}
+
+	if u.Host == "" {
+		return nil, errors.New("no host specified")
+	}
+
+	cfg := NewConfig()
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			cfg.Password = options.NewSecretString(password)
+		}
+		u.User = url.User(u.User.Username())
+	}
+
+	u.Path = "/" + strings.Trim(u.Path, "/")
+	u.RawPath = ""
+	cfg.URL = u
+
+	return &cfg, nil
+}
+
+var _ restic.ApplyEnvironmenter = &Config{}
+
+// ApplyEnvironment saves values from the environment to the config.
+func (cfg *Config) ApplyEnvironment(prefix string) {
+	if cfg.Password.String() == "" {
+		cfg.Password = options.NewSecretString(os.Getenv(prefix + "RESTIC_WEBDAV_PASSWORD"))
+	}
+}
+
+// StripPassword removes the password from the URL
+// If the repository location cannot be parsed as a valid URL, it will be returned as is
+// (it's because this function is used for logging errors)
+func StripPassword(s string) string {
+	const scheme = "webdav:"
+	if !strings.HasPrefix(s, scheme) {
+		return s
+	}
+
+	u, err := url.Parse(s[len(scheme):])
+	if err != nil {
+		return s
+	}
+
+	if _, set := u.User.Password(); !set {
+		return s
+	}
+
+	// a password was set: we replace it with ***, the user name is kept in
+	// its escaped form so that the result is still a valid URL
+	user, _, _ := strings.Cut(u.User.String(), ":")
+	return scheme + strings.Replace(u.String(), u.User.String()+"@", user+":***@", 1)
+}
@@ -0,0 +1,515 @@
+package webdav
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/layout"
+	"github.com/restic/restic/internal/backend/location"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// make sure the webdav backend implements restic.Backend
+var _ restic.Backend = &Backend{}
+
+// Backend stores data on a WebDAV server.
+type Backend struct {
+	url         *url.URL
+	connections uint
+	client      http.Client
+	layout.Layout
+}
+
+func NewFactory() location.Factory {
+	return location.NewHTTPBackendFactory("webdav", ParseConfig, StripPassword, Create, Open)
+}
+
+// Open opens the WebDAV backend with the given config.
+func Open(_ context.Context, cfg Config, rt http.RoundTripper) (*Backend, error) {
+	debug.Log("open, config %#v", cfg)
+
+	var username string
+	if cfg.URL.User != nil {
+		username = cfg.URL.User.Username()
+	}
+
+	be := &Backend{
+		url:         cfg.URL,
+		connections: cfg.Connections,
+		client: http.Client{
+			Transport: newAuthTransport(rt, username, cfg.Password.Unwrap()),
+		},
+		Layout: &layout.DefaultLayout{
+			Path: cfg.URL.Path,
+			Join: path.Join,
+		},
+	}
+
+	return be, nil
+}
+
+// Create creates all the necessary collections for a new repository on the
+// server configured in config.
+func Create(ctx context.Context, cfg Config, rt http.RoundTripper) (*Backend, error) {
+	be, err := Open(ctx, cfg, rt)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = be.Stat(ctx, restic.Handle{Type: restic.ConfigFile})
+	if err == nil {
+		return nil, errors.New("config file already exists")
+	}
+	if !be.IsNotExist(err) {
+		return nil, err
+	}
+
+	dirs := append([]string{cfg.URL.Path}, be.Paths()...)
+	for _, d := range dirs {
+		err = be.mkcol(ctx, d)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return be, nil
+}
+
+func (b *Backend) Connections() uint {
+	return b.connections
+}
+
+// Location returns this backend's location (the server's URL).
+func (b *Backend) Location() string {
+	return b.url.String()
+}
+
+// Hasher may return a hash function for calculating a content hash for the backend
+func (b *Backend) Hasher() hash.Hash {
+	return nil
+}
+
+// HasAtomicReplace returns whether Save() can atomically replace files
+func (b *Backend) HasAtomicReplace() bool {
+	// WebDAV does not guarantee that a PUT replaces a file atomically
+	return false
+}
+
+// fileURL returns the URL for the file or directory at p on the server.
+// Directories must be passed with a trailing slash.
+func (b *Backend) fileURL(p string) string {
+	u := *b.url
+	u.User = nil
+	u.Path = p
+	u.RawPath = ""
+	return u.String()
+}
+
+// dirURL returns the URL for the directory at p on the server.
+func (b *Backend) dirURL(p string) string {
+	if !strings.HasSuffix(p, "/") {
+		p += "/"
+	}
+	return b.fileURL(p)
+}
+
+// do executes the request and returns the response. The response body is
+// drained and closed unless keepBody is set.
+func (b *Backend) do(req *http.Request, keepBody bool) (*http.Response, error) {
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "client.Do")
+	}
+
+	if !keepBody {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		if err := resp.Body.Close(); err != nil {
+			return nil, errors.Wrap(err, "Close")
+		}
+	}
+
+	return resp, nil
+}
+
+// mkcol creates the collection dir, it is not an error if it already exists.
+func (b *Backend) mkcol(ctx context.Context, dir string) error {
+	req, err := http.NewRequestWithContext(ctx, "MKCOL", b.dirURL(dir), nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	resp, err := b.do(req, false)
+	if err != nil {
+		return err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusCreated, http.StatusOK:
+		return nil
+	case http.StatusMethodNotAllowed:
+		// the collection already exists
+		return nil
+	}
+
+	return errors.Errorf("MKCOL %v failed, server response: %v (%v)", dir, resp.Status, resp.StatusCode)
+}
+
+// Save stores data in the backend at the handle.
+func (b *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	resp, err := b.put(ctx, h, rd)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode == http.StatusConflict {
+		// the parent collection is missing, create it and try again
+		debug.Log("parent collection for %v is missing, creating it", h)
+		if err := b.mkcol(ctx, b.Dirname(h)); err != nil {
+			return err
+		}
+
+		if err := rd.Rewind(); err != nil {
+			return err
+		}
+
+		resp, err = b.put(ctx, h, rd)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+		return nil
+	}
+
+	return errors.Errorf("server response unexpected: %v (%v)", resp.Status, resp.StatusCode)
+}
+
+func (b *Backend) put(ctx context.Context, h restic.Handle, rd restic.RewindReader) (*http.Response, error) {
+	// make sure that client.Do() cannot close the reader by wrapping it
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, b.fileURL(b.Filename(h)), io.NopCloser(rd))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	// explicitly set the content length, this prevents chunked encoding and
+	// let's the server know what's coming.
+	req.ContentLength = rd.Length()
+
+	// allow the transport to send the request body again, e.g. for digest
+	// authentication
+	req.GetBody = func() (io.ReadCloser, error) {
+		if err := rd.Rewind(); err != nil {
+			return nil, err
+		}
+		return io.NopCloser(rd), nil
+	}
+
+	return b.do(req, false)
+}
+
+// notExistError is returned whenever the requested file does not exist on the
+// server.
+type notExistError struct {
+	restic.Handle
+}
+
+func (e *notExistError) Error() string {
+	return fmt.Sprintf("%v does not exist", e.Handle)
+}
+
+// IsNotExist returns true if the error was caused by a non-existing file.
+func (b *Backend) IsNotExist(err error) bool {
+	var e *notExistError
+	return errors.As(err, &e)
+}
+
+// Load runs fn with a reader that yields the contents of the file at h at the
+// given offset.
+func (b *Backend) Load(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+	return backend.DefaultLoad(ctx, h, length, offset, b.openReader, fn)
+}
+
+func (b *Backend) openReader(ctx context.Context, h restic.Handle, length int, offset int64) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.fileURL(b.Filename(h)), nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if length > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+int64(length)-1))
+	} else if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := b.do(req, true)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		return resp.Body, nil
+
+	case http.StatusOK:
+		if req.Header.Get("Range") == "" {
+			return resp.Body, nil
+		}
+
+		// the server ignored the range request and returns the whole file,
+		// skip the data before offset and only return length bytes
+		debug.Log("server does not support range requests, reading %v from the start", h)
+		if offset > 0 {
+			_, err = io.CopyN(io.Discard, resp.Body, offset)
+			if err != nil {
+				_ = resp.Body.Close()
+				return nil, errors.Wrap(err, "skip to offset")
+			}
+		}
+
+		if length > 0 {
+			return backend.LimitReadCloser(resp.Body, int64(length)), nil
+		}
+		return resp.Body, nil
+
+	case http.StatusNotFound:
+		_ = resp.Body.Close()
+		return nil, &notExistError{h}
+	}
+
+	_ = resp.Body.Close()
+	return nil, errors.Errorf("unexpected HTTP response (%v): %v", resp.StatusCode, resp.Status)
+}
+
+// propfindBody requests only the properties needed for Stat and List.
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:"><D:prop><D:resourcetype/><D:getcontentlength/></D:prop></D:propfind>`
+
+// multistatus is the response to a PROPFIND request.
+type multistatus struct {
+	Responses []propfindResponse `xml:"DAV: response"`
+}
+
+type propfindResponse struct {
+	Href     string `xml:"DAV: href"`
+	Propstat []struct {
+		Status string `xml:"DAV: status"`
+		Prop   struct {
+			ResourceType struct {
+				Collection *struct{} `xml:"DAV: collection"`
+			} `xml:"DAV: resourcetype"`
+			ContentLength string `xml:"DAV: getcontentlength"`
+		} `xml:"DAV: prop"`
+	} `xml:"DAV: propstat"`
+}
+
+// davEntry describes a single file or collection returned by PROPFIND.
+type davEntry struct {
+	path  string
+	size  int64
+	isDir bool
+}
+
+// propfind returns the entries for the resource at u. With depth 1, the
+// direct children of a collection are returned as well. The boolean return
+// value is false if the resource does not exist.
+func (b *Backend) propfind(ctx context.Context, u string, depth int) ([]davEntry, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "PROPFIND", u, strings.NewReader(propfindBody))
+	if err != nil {
+		return nil, false, errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	req.Header.Set("Depth", strconv.Itoa(depth))
+
+	resp, err := b.do(req, true)
+	if err != nil {
+		return nil, false, err
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, false, nil
+	}
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, false, errors.Errorf("PROPFIND failed, server response: %v (%v)", resp.Status, resp.StatusCode)
+	}
+
+	var ms multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, false, errors.Wrap(err, "Decode")
+	}
+
+	entries := make([]davEntry, 0, len(ms.Responses))
+	for _, r := range ms.Responses {
+		href, err := url.Parse(r.Href)
+		if err != nil {
+			return nil, false, errors.Wrap(err, "parse href")
+		}
+
+		entry := davEntry{path: path.Clean(href.Path)}
+		for _, ps := range r.Propstat {
+			if !strings.Contains(ps.Status, " 200 ") {
+				continue
+			}
+
+			if ps.Prop.ResourceType.Collection != nil {
+				entry.isDir = true
+			}
+
+			if ps.Prop.ContentLength != "" {
+				entry.size, err = strconv.ParseInt(ps.Prop.ContentLength, 10, 64)
+				if err != nil {
+					return nil, false, errors.Wrap(err, "parse content length")
+				}
+			}
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, true, nil
+}
+
+// Stat returns information about a blob.
+func (b *Backend) Stat(ctx context.Context, h restic.Handle) (restic.FileInfo, error) {
+	entries, found, err := b.propfind(ctx, b.fileURL(b.Filename(h)), 0)
+	if err != nil {
+		return restic.FileInfo{}, err
+	}
+
+	if !found {
+		return restic.FileInfo{}, &notExistError{h}
+	}
+
+	if len(entries) != 1 || entries[0].isDir {
+		return restic.FileInfo{}, errors.Errorf("%v is not a regular file", h)
+	}
+
+	return restic.FileInfo{Size: entries[0].size, Name: h.Name}, nil
+}
+
+// Remove removes the blob with the given name and type.
+func (b *Backend) Remove(ctx context.Context, h restic.Handle) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, b.fileURL(b.Filename(h)), nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	resp, err := b.do(req, false)
+	if err != nil {
+		return err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusAccepted:
+		return nil
+	case http.StatusNotFound:
+		return &notExistError{h}
+	}
+
+	return errors.Errorf("blob not removed, server response: %v (%v)", resp.Status, resp.StatusCode)
+}
+
+// List runs fn for each file in the backend which has the type t. When an
+// error occurs (or fn returns an error), List stops and returns it.
+func (b *Backend) List(ctx context.Context, t restic.FileType, fn func(restic.FileInfo) error) error {
+	basedir, subdirs := b.Basedir(t)
+
+	if !subdirs {
+		return b.listDir(ctx, basedir, fn)
+	}
+
+	entries, found, err := b.propfind(ctx, b.dirURL(basedir), 1)
+	if err != nil {
+		return err
+	}
+	if !found {
+		// ignore missing directories
+		return nil
+	}
+
+	for _, entry := range entries {
+		if !entry.isDir || entry.path == path.Clean(basedir) {
+			continue
+		}
+
+		err := b.listDir(ctx, entry.path, fn)
+		if err != nil {
+			return err
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+
+	return ctx.Err()
+}
+
+// listDir runs fn for each file in the directory dir.
+func (b *Backend) listDir(ctx context.Context, dir string, fn func(restic.FileInfo) error) error {
+	entries, found, err := b.propfind(ctx, b.dirURL(dir), 1)
+	if err != nil {
+		return err
+	}
+	if !found {
+		// ignore missing directories
+		return nil
+	}
+
+	for _, entry := range entries {
+		if entry.isDir {
+			continue
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		err := fn(restic.FileInfo{
+			Name: path.Base(entry.path),
+			Size: entry.size,
+		})
+		if err != nil {
+			return err
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+
+	return ctx.Err()
+}
+
+// Close closes all open files.
+func (b *Backend) Close() error {
+	// this does not need to do anything, all open files are closed within the
+	// same function.
+	return nil
+}
+
+// Delete removes all data in the backend.
+func (b *Backend) Delete(ctx context.Context) error {
+	return backend.DefaultDelete(ctx, b)
+}
@@ -0,0 +1,54 @@
+package webdav_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/restic/restic/internal/backend/test"
+	"github.com/restic/restic/internal/backend/webdav"
+	rtest "github.com/restic/restic/internal/test"
+	xwebdav "golang.org/x/net/webdav"
+)
+
+func newTestSuite(t testing.TB, handler http.Handler) *test.Suite[webdav.Config] {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	return &test.Suite[webdav.Config]{
+		// NewConfig returns a config for a new temporary backend that will be used in tests.
+		NewConfig: func() (*webdav.Config, error) {
+			return webdav.ParseConfig("webdav:" + srv.URL + "/restic-test")
+		},
+
+		Factory: webdav.NewFactory(),
+	}
+}
+
+func newWebDAVHandler(t testing.TB) http.Handler {
+	return &xwebdav.Handler{
+		FileSystem: xwebdav.Dir(rtest.TempDir(t)),
+		LockSystem: xwebdav.NewMemLS(),
+	}
+}
+
+// stripRange removes range headers from requests to simulate a server which
+// does not support partial downloads.
+func stripRange(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Del("Range")
+		h.ServeHTTP(w, r)
+	})
+}
+
+func TestBackendWebDAV(t *testing.T) {
+	newTestSuite(t, newWebDAVHandler(t)).RunTests(t)
+}
+
+func TestBackendWebDAVNoRange(t *testing.T) {
+	newTestSuite(t, stripRange(newWebDAVHandler(t))).RunTests(t)
+}
+
+func BenchmarkBackendWebDAV(t *testing.B) {
+	newTestSuite(t, newWebDAVHandler(t)).RunBenchmarks(t)
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"io"
 	"sync"
+	"time"
 
+	"github.com/cenkalti/backoff/v4"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/restic"
 )
@@ -19,6 +21,13 @@ type Backend struct {
 	// is finished.
 	inProgressMutex sync.Mutex
 	inProgress      map[restic.Handle]chan struct{}
+
+	// refresh contains the state of listings which are refreshed in the
+	// background.
+	refreshMutex sync.Mutex
+	refreshing   map[restic.FileType]bool
+	closed       bool
+	refreshWg    sync.WaitGroup
 }
 
 // ensure Backend implements restic.Backend
@@ -29,12 +38,15 @@ func newBackend(be restic.Backend, c *Cache) *Backend {
 		Backend:    be,
 		Cache:      c,
 		inProgress: make(map[restic.Handle]chan struct{}),
+		refreshing: make(map[restic.FileType]bool),
 	}
 }
 
 // Remove deletes a file from the backend and the cache if it has been cached.
 func (b *Backend) Remove(ctx context.Context, h restic.Handle) error {
 	debug.Log("cache Remove(%v)", h)
+	defer b.Cache.invalidateList(h.Type)
+
 	err := b.Backend.Remove(ctx, h)
 	if err != nil {
 		return err
@@ -43,19 +55,22 @@ func (b *Backend) Remove(ctx context.Context, h restic.Handle) error {
 	return b.Cache.remove(h)
 }
 
-func autoCacheTypes(h restic.Handle) bool {
+func (b *Backend) autoCacheTypes(h restic.Handle) bool {
 	switch h.Type {
 	case restic.IndexFile, restic.SnapshotFile:
 		return true
 	case restic.PackFile:
-		return h.ContainedBlobType == restic.TreeBlob
+		return h.ContainedBlobType == restic.TreeBlob || b.Cache.canBeCachedHandle(h)
 	}
 	return false
 }
 
 // Save stores a new file in the backend and the cache.
 func (b *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
-	if !autoCacheTypes(h) {
+	defer b.Cache.invalidateList(h.Type)
+
+	// data packs are only cached when they are read
+	if !b.autoCacheTypes(h) || isDataPack(h) || !b.Cache.writable() {
 		return b.Backend.Save(ctx, h, rd)
 	}
 
@@ -81,14 +96,30 @@ func (b *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindRea
 
 	err = b.Cache.Save(h, rd)
 	if err != nil {
-		debug.Log("unable to save %v to cache: %v", h, err)
+		// the file is stored in the backend, so this is not fatal
 		_ = b.Cache.remove(h)
-		return err
+		b.Cache.writeFailed(h, err)
 	}
 
 	return nil
 }
 
+// readErrorReader remembers the last error returned by the underlying
+// reader. This allows telling apart errors while reading from the backend
+// from errors while writing to the cache.
+type readErrorReader struct {
+	io.Reader
+	err error
+}
+
+func (rd *readErrorReader) Read(p []byte) (int, error) {
+	n, err := rd.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		rd.err = err
+	}
+	return n, err
+}
+
 func (b *Backend) cacheFile(ctx context.Context, h restic.Handle) error {
 	finish := make(chan struct{})
 
@@ -119,14 +150,34 @@ func (b *Backend) cacheFile(ctx context.Context, h restic.Handle) error {
 	// test again, maybe the file was cached in the meantime
 	if !b.Cache.Has(h) {
 		// nope, it's still not in the cache, pull it from the repo and save it
+		var cacheErr error
 		err := b.Backend.Load(ctx, h, 0, 0, func(rd io.Reader) error {
-			return b.Cache.Save(h, rd)
+			erd := &readErrorReader{Reader: rd}
+			err := b.Cache.Save(h, erd)
+			if err != nil && erd.err == nil {
+				// retrying the download won't help if the cache cannot be written
+				cacheErr = err
+				return backoff.Permanent(err)
+			}
+			return err
 		})
+		if cacheErr != nil {
+			// the caller falls back to loading the file from the backend
+			_ = b.Cache.remove(h)
+			b.Cache.writeFailed(h, cacheErr)
+			return nil
+		}
 		if err != nil {
 			// try to remove from the cache, ignore errors
 			_ = b.Cache.remove(h)
+			return err
+		}
+
+		if isDataPack(h) {
+			if err := b.Cache.evictData(); err != nil {
+				debug.Log("unable to clean up the data cache: %v", err)
+			}
 		}
-		return err
 	}
 
 	return nil
@@ -167,12 +218,16 @@ func (b *Backend) Load(ctx context.Context, h restic.Handle, length int, offset
 		}
 
 		// drop from cache and retry once
-		_ = b.Cache.remove(h)
+		if rmErr := b.Cache.remove(h); rmErr != nil {
+			// the broken file would be served again, bypass the cache
+			b.Cache.writeFailed(h, rmErr)
+			return b.Backend.Load(ctx, h, length, offset, consumer)
+		}
 	}
 	debug.Log("error loading %v from cache: %v", h, err)
 
 	// if we don't automatically cache this file type, fall back to the backend
-	if !autoCacheTypes(h) {
+	if !b.autoCacheTypes(h) || !b.Cache.writable() {
 		debug.Log("Load(%v, %v, %v): delegating to backend", h, length, offset)
 		return b.Backend.Load(ctx, h, length, offset, consumer)
 	}
@@ -210,6 +265,112 @@ func (b *Backend) Stat(ctx context.Context, h restic.Handle) (restic.FileInfo, e
 	return fi, err
 }
 
+// List runs fn for each file of type t. If enabled, the listing is served from
+// the cache as long as it is younger than the configured TTL. Listings older
+// than half of the TTL are refreshed in the background.
+func (b *Backend) List(ctx context.Context, t restic.FileType, fn func(restic.FileInfo) error) error {
+	ttl, ok := b.Cache.cachesList(t)
+	if !ok {
+		return b.listBackend(ctx, t, fn)
+	}
+
+	m, err := b.Cache.loadManifest(t)
+	if err != nil {
+		debug.Log("unable to load manifest for %v: %v", t, err)
+	}
+
+	age := time.Since(m.created())
+	if m == nil || age < 0 || age > ttl {
+		debug.Log("listing %v from the backend", t)
+		return b.Cache.listAndStore(ctx, b.listBackend, t, fn)
+	}
+
+	debug.Log("serving listing of %v from the cache, age %v", t, age)
+	if age > ttl/2 {
+		b.refreshList(t)
+	}
+
+	for _, e := range m.Files {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		err := fn(restic.FileInfo{Name: e.Name, Size: e.Size})
+		if err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// listBackend lists the files of type t in the backend. Snapshot files are
+// only removed by other clients, thus a complete listing of snapshot files
+// is used to remove those from the cache which no longer exist.
+func (b *Backend) listBackend(ctx context.Context, t restic.FileType, fn func(restic.FileInfo) error) error {
+	if t != restic.SnapshotFile {
+		return b.Backend.List(ctx, t, fn)
+	}
+
+	listed := restic.NewIDSet()
+	err := b.Backend.List(ctx, t, func(fi restic.FileInfo) error {
+		if id, err := restic.ParseID(fi.Name); err == nil {
+			listed.Insert(id)
+		}
+		return fn(fi)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := b.Cache.Clear(t, listed); err != nil {
+		debug.Log("unable to clear cached %v files: %v", t, err)
+	}
+	return nil
+}
+
+// refreshList updates the listing of file type t in the background.
+func (b *Backend) refreshList(t restic.FileType) {
+	b.refreshMutex.Lock()
+	defer b.refreshMutex.Unlock()
+	if b.refreshing[t] || b.closed {
+		return
+	}
+	b.refreshing[t] = true
+
+	b.refreshWg.Add(1)
+	go func() {
+		defer b.refreshWg.Done()
+		err := b.Cache.listAndStore(context.Background(), b.listBackend, t, func(restic.FileInfo) error { return nil })
+		if err != nil {
+			debug.Log("refreshing listing of %v failed: %v", t, err)
+		}
+
+		b.refreshMutex.Lock()
+		b.refreshing[t] = false
+		b.refreshMutex.Unlock()
+	}()
+}
+
+// Delete removes all data in the backend and the cached listings.
+func (b *Backend) Delete(ctx context.Context) error {
+	err := b.Backend.Delete(ctx)
+	for t := range listCacheTypes {
+		b.Cache.invalidateList(t)
+	}
+	return err
+}
+
+// Close waits for listings which are refreshed in the background and closes
+// the backend.
+func (b *Backend) Close() error {
+	b.refreshMutex.Lock()
+	b.closed = true
+	b.refreshMutex.Unlock()
+
+	b.refreshWg.Wait()
+	return b.Backend.Close()
+}
+
 // IsNotExist returns true if the error is caused by a non-existing file.
 func (b *Backend) IsNotExist(err error) bool {
 	return b.Backend.IsNotExist(err)
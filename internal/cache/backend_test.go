@@ -200,3 +200,39 @@ func TestBackendRemoveBroken(t *testing.T) {
 		t.Fatalf("wrong data cache")
 	}
 }
+
+func TestListClearsRemovedSnapshots(t *testing.T) {
+	be := mem.New()
+	c := TestNewCache(t)
+	wbe := c.Wrap(be)
+
+	var handles []restic.Handle
+	for i := 0; i < 3; i++ {
+		h, data := randomData(100)
+		h.Type = restic.SnapshotFile
+		save(t, wbe, h, data)
+		loadAndCompare(t, wbe, h, data)
+		test.Assert(t, c.Has(h), "snapshot %v was not cached", h)
+		handles = append(handles, h)
+	}
+
+	// another client removes a snapshot, the cache only notices on the next listing
+	remove(t, be, handles[0])
+	test.Assert(t, c.Has(handles[0]), "removed snapshot is no longer cached")
+
+	// an aborted listing must not clear the cache
+	errStop := errors.New("stop")
+	err := wbe.List(context.TODO(), restic.SnapshotFile, func(restic.FileInfo) error {
+		return errStop
+	})
+	test.Assert(t, err == errStop, "unexpected error %v", err)
+	test.Assert(t, c.Has(handles[0]), "aborted listing cleared the cache")
+
+	test.OK(t, wbe.List(context.TODO(), restic.SnapshotFile, func(restic.FileInfo) error {
+		return nil
+	}))
+	test.Assert(t, !c.Has(handles[0]), "removed snapshot is still cached")
+	for _, h := range handles[1:] {
+		test.Assert(t, c.Has(h), "snapshot %v was removed from the cache", h)
+	}
+}
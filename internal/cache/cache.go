@@ -6,19 +6,43 @@ import (
 	"path/filepath"
 	"regexp"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/options"
 	"github.com/restic/restic/internal/restic"
 )
 
+// Config contains the options for the cache.
+type Config struct {
+	ListTTL  time.Duration `option:"list-ttl" help:"serve listings of the snapshots from the cache if they are younger than this duration (default: disabled)"`
+	Data     bool          `option:"data" help:"also cache data packs, for example for mount, dump and restore"`
+	DataSize string        `option:"data-size" help:"maximum size of the cached data packs (default: 1GiB)"`
+
+	MaxWriteErrors uint `option:"max-write-errors" help:"stop writing to the cache after this number of failed writes (default: unlimited)"`
+}
+
+func init() {
+	options.Register("cache", Config{})
+}
+
 // Cache manages a local cache.
 type Cache struct {
 	path    string
 	Base    string
 	Created bool
+
+	// m protects the fields below
+	m              sync.Mutex
+	listTTL        time.Duration
+	dataSize       uint64
+	listGeneration map[restic.FileType]uint64
+	warn           func(msg string)
+	writeErrors    uint
+	maxWriteErrors uint
 }
 
 const dirMode = 0700
@@ -134,11 +158,16 @@ func New(id string, basedir string) (c *Cache, err error) {
 			return nil, errors.WithStack(err)
 		}
 	}
+	if err = fs.MkdirAll(filepath.Join(cachedir, dataCacheDir), dirMode); err != nil {
+		return nil, errors.WithStack(err)
+	}
 
 	c = &Cache{
 		path:    cachedir,
 		Base:    basedir,
 		Created: created,
+
+		listGeneration: make(map[restic.FileType]uint64),
 	}
 
 	return c, nil
@@ -0,0 +1,128 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
+)
+
+// dataCacheDir is the directory within the cache for pack files containing
+// data blobs. They are kept separate from the tree packs, which are cleaned
+// up based on the index.
+const dataCacheDir = "datacache"
+
+// defaultDataCacheSize is the default size budget of the data cache.
+const defaultDataCacheSize = 1 << 30
+
+// DataCacheSize returns the size budget for cached data packs, or zero if
+// the data cache is disabled.
+func (cfg Config) DataCacheSize() (uint64, error) {
+	if !cfg.Data {
+		return 0, nil
+	}
+	if cfg.DataSize == "" {
+		return defaultDataCacheSize, nil
+	}
+
+	size, err := ui.ParseBytes(cfg.DataSize)
+	if err != nil {
+		return 0, errors.Errorf("invalid cache.data-size %q: %v", cfg.DataSize, err)
+	}
+	if size <= 0 {
+		return 0, errors.Errorf("invalid cache.data-size %q: must be positive", cfg.DataSize)
+	}
+	return uint64(size), nil
+}
+
+// isDataPack returns true if h is a pack file which was requested to load
+// data blobs.
+func isDataPack(h restic.Handle) bool {
+	return h.Type == restic.PackFile && h.ContainedBlobType == restic.DataBlob
+}
+
+// SetDataCacheSize enables caching data packs up to a total size of size
+// bytes. Least recently used packs are removed once the cache is full. A
+// size of zero disables the data cache.
+func (c *Cache) SetDataCacheSize(size uint64) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.dataSize = size
+}
+
+// DisableDataCache stops loading data packs from the cache. This is used by
+// operations which must read the data stored in the repository.
+func (c *Cache) DisableDataCache() {
+	c.SetDataCacheSize(0)
+}
+
+func (c *Cache) dataCacheSize() uint64 {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.dataSize
+}
+
+// touch marks the cached file for h as recently used.
+func (c *Cache) touch(h restic.Handle) {
+	now := time.Now()
+	if err := os.Chtimes(c.filename(h), now, now); err != nil {
+		debug.Log("unable to update timestamp of %v: %v", h, err)
+	}
+}
+
+// evictData removes the least recently used data packs until the total size
+// of the data cache is within the budget.
+func (c *Cache) evictData() error {
+	budget := c.dataCacheSize()
+
+	type entry struct {
+		name    string
+		size    int64
+		modTime time.Time
+	}
+
+	var entries []entry
+	var total uint64
+	err := filepath.Walk(filepath.Join(c.path, dataCacheDir), func(name string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return errors.Wrap(err, "Walk")
+		}
+		if !isFile(fi) {
+			return nil
+		}
+		if _, err := restic.ParseID(filepath.Base(name)); err != nil {
+			return nil
+		}
+
+		entries = append(entries, entry{name: name, size: fi.Size(), modTime: fi.ModTime()})
+		total += uint64(fi.Size())
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].modTime.Before(entries[j].modTime)
+	})
+
+	for _, e := range entries {
+		if total <= budget {
+			break
+		}
+
+		debug.Log("removing %v from the data cache", e.name)
+		err := fs.Remove(e.name)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return errors.WithStack(err)
+		}
+		total -= uint64(e.size)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/backend/mem"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/test"
+)
+
+// loadCountingBackend counts the calls to Load.
+type loadCountingBackend struct {
+	restic.Backend
+	loads int32
+}
+
+func (be *loadCountingBackend) Load(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+	atomic.AddInt32(&be.loads, 1)
+	return be.Backend.Load(ctx, h, length, offset, fn)
+}
+
+func (be *loadCountingBackend) count() int {
+	return int(atomic.LoadInt32(&be.loads))
+}
+
+func saveDataPack(t testing.TB, be restic.Backend, size int) (restic.Handle, []byte) {
+	h, data := randomData(size)
+	h.Type = restic.PackFile
+	save(t, be, h, data)
+	h.ContainedBlobType = restic.DataBlob
+	return h, data
+}
+
+func loadPart(t testing.TB, be restic.Backend, h restic.Handle, data []byte, offset int) {
+	var buf []byte
+	err := be.Load(context.TODO(), h, 100, int64(offset), func(rd io.Reader) (err error) {
+		buf, err = io.ReadAll(rd)
+		return err
+	})
+	test.OK(t, err)
+	test.Equals(t, data[offset:offset+100], buf)
+}
+
+func TestBackendDataCache(t *testing.T) {
+	be := &loadCountingBackend{Backend: mem.New()}
+	c := TestNewCache(t)
+	c.SetDataCacheSize(1 << 20)
+	wbe := c.Wrap(be)
+
+	h, data := saveDataPack(t, be.Backend, 5000)
+
+	loadPart(t, wbe, h, data, 100)
+	test.Equals(t, 1, be.count())
+	test.Assert(t, c.Has(h), "data pack was not cached")
+
+	// the second read is served from the cache
+	loadPart(t, wbe, h, data, 1000)
+	test.Equals(t, 1, be.count())
+
+	// without the data cache, data packs are loaded from the backend
+	c.DisableDataCache()
+	loadPart(t, wbe, h, data, 1000)
+	test.Equals(t, 2, be.count())
+}
+
+func TestBackendDataCacheDisabled(t *testing.T) {
+	be := &loadCountingBackend{Backend: mem.New()}
+	c := TestNewCache(t)
+	wbe := c.Wrap(be)
+
+	h, data := saveDataPack(t, be.Backend, 5000)
+	loadPart(t, wbe, h, data, 100)
+	loadPart(t, wbe, h, data, 100)
+	test.Equals(t, 2, be.count())
+	test.Assert(t, !c.Has(h), "data pack was cached")
+
+	// data packs are not cached when they are saved
+	c.SetDataCacheSize(1 << 20)
+	h, _ = saveDataPack(t, wbe, 5000)
+	test.Assert(t, !c.Has(h), "data pack was cached on save")
+}
+
+func TestBackendDataCacheEviction(t *testing.T) {
+	be := &loadCountingBackend{Backend: mem.New()}
+	c := TestNewCache(t)
+	c.SetDataCacheSize(25000)
+	wbe := c.Wrap(be)
+
+	var handles []restic.Handle
+	for i := 0; i < 3; i++ {
+		h, data := saveDataPack(t, be.Backend, 10000)
+		loadPart(t, wbe, h, data, 0)
+		handles = append(handles, h)
+
+		// make sure the access times differ
+		ts := time.Now().Add(time.Duration(i-10) * time.Minute)
+		test.OK(t, os.Chtimes(c.filename(h), ts, ts))
+	}
+
+	// the least recently used pack was removed
+	test.Assert(t, !c.Has(handles[0]), "oldest pack was not evicted")
+	test.Assert(t, c.Has(handles[1]), "pack 1 was evicted")
+	test.Assert(t, c.Has(handles[2]), "pack 2 was evicted")
+
+	// reading a pack marks it as recently used
+	test.OK(t, wbe.Load(context.TODO(), handles[1], 10, 0, func(rd io.Reader) error {
+		_, err := io.Copy(io.Discard, rd)
+		return err
+	}))
+	h, data := saveDataPack(t, be.Backend, 10000)
+	loadPart(t, wbe, h, data, 0)
+
+	test.Assert(t, c.Has(handles[1]), "recently used pack was evicted")
+	test.Assert(t, !c.Has(handles[2]), "pack 2 was not evicted")
+	test.Assert(t, c.Has(h), "new pack was evicted")
+}
+
+func TestDataCacheSize(t *testing.T) {
+	for _, cfg := range []struct {
+		cfg  Config
+		size uint64
+		ok   bool
+	}{
+		{Config{}, 0, true},
+		{Config{DataSize: "5G"}, 0, true},
+		{Config{Data: true}, 1 << 30, true},
+		{Config{Data: true, DataSize: "100M"}, 100 << 20, true},
+		{Config{Data: true, DataSize: "foo"}, 0, false},
+		{Config{Data: true, DataSize: "0"}, 0, false},
+	} {
+		size, err := cfg.cfg.DataCacheSize()
+		test.Equals(t, cfg.ok, err == nil)
+		test.Equals(t, cfg.size, size)
+	}
+}
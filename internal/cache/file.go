@@ -19,6 +19,9 @@ func (c *Cache) filename(h restic.Handle) string {
 		panic("Name is empty or too short")
 	}
 	subdir := h.Name[:2]
+	if isDataPack(h) {
+		return filepath.Join(c.path, dataCacheDir, subdir, h.Name)
+	}
 	return filepath.Join(c.path, cacheLayoutPaths[h.Type], subdir, h.Name)
 }
 
@@ -31,12 +34,24 @@ func (c *Cache) canBeCached(t restic.FileType) bool {
 	return ok
 }
 
+// canBeCachedHandle returns true if the file h can be cached. Data packs are
+// only cached if the data cache is enabled.
+func (c *Cache) canBeCachedHandle(h restic.Handle) bool {
+	if c == nil {
+		return false
+	}
+	if isDataPack(h) {
+		return c.dataCacheSize() > 0
+	}
+	return c.canBeCached(h.Type)
+}
+
 // Load returns a reader that yields the contents of the file with the
 // given handle. rd must be closed after use. If an error is returned, the
 // ReadCloser is nil.
 func (c *Cache) load(h restic.Handle, length int, offset int64) (io.ReadCloser, error) {
 	debug.Log("Load(%v, %v, %v) from cache", h, length, offset)
-	if !c.canBeCached(h.Type) {
+	if !c.canBeCachedHandle(h) {
 		return nil, errors.New("cannot be cached")
 	}
 
@@ -64,6 +79,10 @@ func (c *Cache) load(h restic.Handle, length int, offset int64) (io.ReadCloser,
 		return nil, errors.Errorf("cached file %v is too small, removing", h)
 	}
 
+	if isDataPack(h) {
+		c.touch(h)
+	}
+
 	if offset > 0 {
 		if _, err = f.Seek(offset, io.SeekStart); err != nil {
 			_ = f.Close()
@@ -83,7 +102,7 @@ func (c *Cache) Save(h restic.Handle, rd io.Reader) error {
 	if rd == nil {
 		return errors.New("Save() called with nil reader")
 	}
-	if !c.canBeCached(h.Type) {
+	if !c.canBeCachedHandle(h) {
 		return errors.New("cannot be cached")
 	}
 
@@ -208,7 +227,7 @@ func (c *Cache) list(t restic.FileType) (restic.IDSet, error) {
 
 // Has returns true if the file is cached.
 func (c *Cache) Has(h restic.Handle) bool {
-	if !c.canBeCached(h.Type) {
+	if !c.canBeCachedHandle(h) {
 		return false
 	}
 
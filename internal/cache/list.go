@@ -0,0 +1,185 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// listCacheTypes contains the file types for which listings are kept in the
+// cache. Index files are deliberately not included: a stale list of index
+// files could make backup reuse blobs from packs which were already removed
+// by a prune run on a different host.
+var listCacheTypes = map[restic.FileType]bool{
+	restic.SnapshotFile: true,
+}
+
+// listManifest contains the result of listing all files of one type.
+type listManifest struct {
+	Time  time.Time           `json:"time"`
+	Files []listManifestEntry `json:"files"`
+}
+
+type listManifestEntry struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// created returns the time the listing was created, or the zero time for a
+// nil manifest.
+func (m *listManifest) created() time.Time {
+	if m == nil {
+		return time.Time{}
+	}
+	return m.Time
+}
+
+func (c *Cache) manifestFilename(t restic.FileType) string {
+	return filepath.Join(c.path, "lists", cacheLayoutPaths[t]+".json")
+}
+
+// loadManifest returns the manifest for file type t, or nil if there is none.
+func (c *Cache) loadManifest(t restic.FileType) (*listManifest, error) {
+	buf, err := os.ReadFile(c.manifestFilename(t))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var m listManifest
+	err = json.Unmarshal(buf, &m)
+	if err != nil {
+		// ignore broken manifests, they are replaced by the next listing
+		debug.Log("ignoring invalid manifest for %v: %v", t, err)
+		return nil, nil
+	}
+	return &m, nil
+}
+
+// saveManifest stores the manifest for file type t.
+func (c *Cache) saveManifest(t restic.FileType, m *listManifest) error {
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	finalname := c.manifestFilename(t)
+	dir := filepath.Dir(finalname)
+	err = fs.Mkdir(dir, dirMode)
+	if err != nil && !errors.Is(err, os.ErrExist) {
+		return errors.WithStack(err)
+	}
+
+	f, err := os.CreateTemp(dir, "tmp-")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	_, err = f.Write(buf)
+	if err != nil {
+		_ = f.Close()
+		_ = fs.Remove(f.Name())
+		return errors.WithStack(err)
+	}
+
+	if err = f.Close(); err != nil {
+		_ = fs.Remove(f.Name())
+		return errors.WithStack(err)
+	}
+
+	err = fs.Rename(f.Name(), finalname)
+	if err != nil {
+		_ = fs.Remove(f.Name())
+	}
+	return errors.WithStack(err)
+}
+
+// removeManifest removes the manifest for file type t.
+func (c *Cache) removeManifest(t restic.FileType) error {
+	err := fs.Remove(c.manifestFilename(t))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return errors.WithStack(err)
+}
+
+// SetListTTL enables serving listings from the cache while they are younger
+// than ttl. A zero ttl disables cached listings.
+func (c *Cache) SetListTTL(ttl time.Duration) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.listTTL = ttl
+}
+
+// DisableListCache makes all further listings query the backend. This is
+// used by commands which must see the current state of the repository.
+func (c *Cache) DisableListCache() {
+	c.SetListTTL(0)
+}
+
+// cachesList returns whether listings of file type t may be served from the
+// cache, and the maximum age of the listing.
+func (c *Cache) cachesList(t restic.FileType) (time.Duration, bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.listTTL, c.listTTL > 0 && listCacheTypes[t]
+}
+
+// InvalidateList removes the cached listing of file type t, so that the next
+// listing is served by the backend.
+func (c *Cache) InvalidateList(t restic.FileType) {
+	c.invalidateList(t)
+}
+
+// invalidateList removes the listing of file type t. Listings which are
+// currently running are not stored afterwards.
+func (c *Cache) invalidateList(t restic.FileType) {
+	if !listCacheTypes[t] {
+		return
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.listGeneration[t]++
+	if err := c.removeManifest(t); err != nil {
+		debug.Log("unable to remove manifest for %v: %v", t, err)
+	}
+}
+
+// listAndStore lists all files of type t using list and stores the result as
+// manifest, unless the listing was invalidated in the meantime. The function
+// fn is called for each file.
+func (c *Cache) listAndStore(ctx context.Context, list func(context.Context, restic.FileType, func(restic.FileInfo) error) error, t restic.FileType, fn func(restic.FileInfo) error) error {
+	c.m.Lock()
+	generation := c.listGeneration[t]
+	c.m.Unlock()
+
+	m := &listManifest{Time: time.Now()}
+	err := list(ctx, t, func(fi restic.FileInfo) error {
+		m.Files = append(m.Files, listManifestEntry{Name: fi.Name, Size: fi.Size})
+		return fn(fi)
+	})
+	if err != nil {
+		return err
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.listGeneration[t] != generation {
+		debug.Log("listing of %v was invalidated, not storing the manifest", t)
+		return nil
+	}
+	if err := c.saveManifest(t, m); err != nil {
+		debug.Log("unable to save manifest for %v: %v", t, err)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package cache
+
+import (
+	"context"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/backend/mem"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/test"
+)
+
+// listCountingBackend counts the calls to List.
+type listCountingBackend struct {
+	restic.Backend
+	lists int32
+}
+
+func (be *listCountingBackend) List(ctx context.Context, t restic.FileType, fn func(restic.FileInfo) error) error {
+	atomic.AddInt32(&be.lists, 1)
+	return be.Backend.List(ctx, t, fn)
+}
+
+func (be *listCountingBackend) count() int {
+	return int(atomic.LoadInt32(&be.lists))
+}
+
+func listNames(t testing.TB, be restic.Backend, tpe restic.FileType) []string {
+	var names []string
+	err := be.List(context.TODO(), tpe, func(fi restic.FileInfo) error {
+		names = append(names, fi.Name)
+		return nil
+	})
+	test.OK(t, err)
+	sort.Strings(names)
+	return names
+}
+
+func saveSnapshotFile(t testing.TB, be restic.Backend) string {
+	h, data := randomData(100)
+	h.Type = restic.SnapshotFile
+	save(t, be, h, data)
+	return h.Name
+}
+
+func TestBackendListCache(t *testing.T) {
+	be := &listCountingBackend{Backend: mem.New()}
+	c := TestNewCache(t)
+	c.SetListTTL(time.Hour)
+	wbe := c.Wrap(be)
+	defer func() {
+		test.OK(t, wbe.Close())
+	}()
+
+	names := []string{saveSnapshotFile(t, wbe), saveSnapshotFile(t, wbe)}
+	sort.Strings(names)
+
+	// the first listing queries the backend
+	test.Equals(t, names, listNames(t, wbe, restic.SnapshotFile))
+	test.Equals(t, 1, be.count())
+
+	// the second one is served from the cache
+	test.Equals(t, names, listNames(t, wbe, restic.SnapshotFile))
+	test.Equals(t, 1, be.count())
+
+	// saving a snapshot invalidates the listing
+	names = append(names, saveSnapshotFile(t, wbe))
+	sort.Strings(names)
+	test.Equals(t, names, listNames(t, wbe, restic.SnapshotFile))
+	test.Equals(t, 2, be.count())
+
+	// as does removing a snapshot
+	remove(t, wbe, restic.Handle{Type: restic.SnapshotFile, Name: names[0]})
+	names = names[1:]
+	test.Equals(t, names, listNames(t, wbe, restic.SnapshotFile))
+	test.Equals(t, 3, be.count())
+	test.Equals(t, names, listNames(t, wbe, restic.SnapshotFile))
+	test.Equals(t, 3, be.count())
+
+	// index listings are never cached
+	listNames(t, wbe, restic.IndexFile)
+	listNames(t, wbe, restic.IndexFile)
+	test.Equals(t, 5, be.count())
+}
+
+func TestBackendListCacheExpired(t *testing.T) {
+	be := &listCountingBackend{Backend: mem.New()}
+	c := TestNewCache(t)
+	c.SetListTTL(time.Hour)
+	wbe := c.Wrap(be)
+
+	name := saveSnapshotFile(t, wbe)
+	test.Equals(t, []string{name}, listNames(t, wbe, restic.SnapshotFile))
+	test.Equals(t, 1, be.count())
+
+	// a snapshot saved by someone else is not visible until the listing expires
+	other := saveSnapshotFile(t, be.Backend)
+	test.Equals(t, []string{name}, listNames(t, wbe, restic.SnapshotFile))
+
+	m, err := c.loadManifest(restic.SnapshotFile)
+	test.OK(t, err)
+	m.Time = m.Time.Add(-2 * time.Hour)
+	test.OK(t, c.saveManifest(restic.SnapshotFile, m))
+
+	names := []string{name, other}
+	sort.Strings(names)
+	test.Equals(t, names, listNames(t, wbe, restic.SnapshotFile))
+	test.Equals(t, 2, be.count())
+
+	// listings older than half of the TTL are refreshed in the background
+	m, err = c.loadManifest(restic.SnapshotFile)
+	test.OK(t, err)
+	m.Time = m.Time.Add(-45 * time.Minute)
+	test.OK(t, c.saveManifest(restic.SnapshotFile, m))
+
+	test.Equals(t, names, listNames(t, wbe, restic.SnapshotFile))
+	test.OK(t, wbe.Close())
+	test.Equals(t, 3, be.count())
+
+	m, err = c.loadManifest(restic.SnapshotFile)
+	test.OK(t, err)
+	test.Assert(t, time.Since(m.Time) < 30*time.Minute, "listing was not refreshed, created at %v", m.Time)
+}
+
+func TestBackendListCacheDisabled(t *testing.T) {
+	be := &listCountingBackend{Backend: mem.New()}
+	c := TestNewCache(t)
+	c.SetListTTL(time.Hour)
+	wbe := c.Wrap(be)
+	defer func() {
+		test.OK(t, wbe.Close())
+	}()
+
+	name := saveSnapshotFile(t, wbe)
+	listNames(t, wbe, restic.SnapshotFile)
+	test.Equals(t, 1, be.count())
+
+	c.DisableListCache()
+	other := saveSnapshotFile(t, be.Backend)
+	names := []string{name, other}
+	sort.Strings(names)
+	test.Equals(t, names, listNames(t, wbe, restic.SnapshotFile))
+	test.Equals(t, names, listNames(t, wbe, restic.SnapshotFile))
+	test.Equals(t, 3, be.count())
+}
@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/pkg/errors"
+	"github.com/restic/restic/internal/fs"
+)
+
+// sidecarDir contains files which are derived from the repository by
+// commands, for example to speed up later runs. They are not read by the
+// cached backend.
+const sidecarDir = "sidecar"
+
+func (c *Cache) sidecarFilename(name string) string {
+	return filepath.Join(c.path, sidecarDir, name)
+}
+
+// LoadSidecar returns the content of the sidecar file name, or nil if it does
+// not exist.
+func (c *Cache) LoadSidecar(name string) ([]byte, error) {
+	buf, err := os.ReadFile(c.sidecarFilename(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return buf, errors.WithStack(err)
+}
+
+// SaveSidecar replaces the sidecar file name with data.
+func (c *Cache) SaveSidecar(name string, data []byte) error {
+	finalname := c.sidecarFilename(name)
+	dir := filepath.Dir(finalname)
+	err := fs.Mkdir(dir, dirMode)
+	if err != nil && !errors.Is(err, os.ErrExist) {
+		return errors.WithStack(err)
+	}
+
+	// write to a temporary file first, concurrent runs must not see a
+	// partially written file
+	f, err := os.CreateTemp(dir, "tmp-")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = fs.Remove(f.Name())
+		return errors.WithStack(err)
+	}
+
+	err = fs.Rename(f.Name(), finalname)
+	if err != nil {
+		_ = fs.Remove(f.Name())
+	}
+	if runtime.GOOS == "windows" && errors.Is(err, os.ErrPermission) {
+		// another process has the file open, see Save
+		err = nil
+	}
+	return errors.WithStack(err)
+}
+
+// RemoveSidecar removes the sidecar file name, if it exists.
+func (c *Cache) RemoveSidecar(name string) error {
+	err := fs.Remove(c.sidecarFilename(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return errors.WithStack(err)
+}
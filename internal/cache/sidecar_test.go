@@ -0,0 +1,32 @@
+package cache
+
+import (
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestSidecar(t *testing.T) {
+	c := TestNewCache(t)
+
+	buf, err := c.LoadSidecar("test")
+	rtest.OK(t, err)
+	rtest.Assert(t, buf == nil, "unexpected data for missing sidecar file: %q", buf)
+
+	rtest.OK(t, c.SaveSidecar("test", []byte("foo")))
+	rtest.OK(t, c.SaveSidecar("test", []byte("bar")))
+	buf, err = c.LoadSidecar("test")
+	rtest.OK(t, err)
+	rtest.Equals(t, "bar", string(buf))
+
+	// sidecar files are not part of the cached repository files
+	for _, tpe := range cacheLayoutPaths {
+		rtest.Assert(t, tpe != sidecarDir, "sidecar directory %v is used by the cache layout", sidecarDir)
+	}
+
+	rtest.OK(t, c.RemoveSidecar("test"))
+	rtest.OK(t, c.RemoveSidecar("test"))
+	buf, err = c.LoadSidecar("test")
+	rtest.OK(t, err)
+	rtest.Assert(t, buf == nil, "sidecar file was not removed")
+}
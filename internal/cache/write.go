@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"fmt"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/restic"
+)
+
+// SetWarnFunc sets the function which is called to report problems with the
+// cache, for example a full or read-only cache directory. The cache is an
+// optimization only, such problems never cause an operation to fail.
+func (c *Cache) SetWarnFunc(fn func(msg string)) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.warn = fn
+}
+
+// SetMaxWriteErrors stops writing new files to the cache after n failed
+// writes. Files which are already cached are still used. Zero means that
+// writing is never stopped.
+func (c *Cache) SetMaxWriteErrors(n uint) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.maxWriteErrors = n
+}
+
+// writable returns false once writing to the cache was stopped.
+func (c *Cache) writable() bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.maxWriteErrors == 0 || c.writeErrors < c.maxWriteErrors
+}
+
+// writeFailed records that storing the file h in the cache failed. Only the
+// first failure is reported, the file is then loaded from the backend.
+func (c *Cache) writeFailed(h restic.Handle, err error) {
+	debug.Log("unable to write %v to the cache: %v", h, err)
+
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.writeErrors++
+
+	if c.warn == nil {
+		return
+	}
+	if c.writeErrors == 1 {
+		c.warn(fmt.Sprintf("unable to write to the cache, loading files from the repository instead: %v", err))
+	}
+	if c.writeErrors == c.maxWriteErrors {
+		c.warn(fmt.Sprintf("stopped writing to the cache after %d failed writes", c.writeErrors))
+	}
+}
@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/mem"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// breakCacheDir replaces the cache directory for index files with a regular
+// file, so that all writes fail. Unlike a read-only directory, this also
+// works when the tests are run as root.
+func breakCacheDir(t testing.TB, c *Cache) {
+	dir := filepath.Join(c.path, cacheLayoutPaths[restic.IndexFile])
+	rtest.OK(t, os.RemoveAll(dir))
+	rtest.OK(t, os.WriteFile(dir, []byte("foo"), 0600))
+}
+
+func collectWarnings(c *Cache) *[]string {
+	var warnings []string
+	c.SetWarnFunc(func(msg string) {
+		warnings = append(warnings, msg)
+	})
+	return &warnings
+}
+
+func TestBackendWriteError(t *testing.T) {
+	be := mem.New()
+	c := TestNewCache(t)
+	warnings := collectWarnings(c)
+	breakCacheDir(t, c)
+	wbe := c.Wrap(be)
+
+	h, data := randomData(5234142)
+	// saving works even though the file cannot be cached
+	save(t, wbe, h, data)
+	rtest.Assert(t, !c.Has(h), "file was cached")
+	loadAndCompare(t, be, h, data)
+
+	// loading falls back to the backend
+	h2, data2 := randomData(1234)
+	save(t, be, h2, data2)
+	loadAndCompare(t, wbe, h2, data2)
+	loadAndCompare(t, wbe, h, data)
+
+	rtest.Equals(t, 1, len(*warnings))
+	rtest.Equals(t, uint(3), c.writeErrors)
+}
+
+func TestBackendMaxWriteErrors(t *testing.T) {
+	be := mem.New()
+	c := TestNewCache(t)
+	c.SetMaxWriteErrors(2)
+	warnings := collectWarnings(c)
+	breakCacheDir(t, c)
+	wbe := c.Wrap(be)
+
+	for i := 0; i < 4; i++ {
+		h, data := randomData(1234)
+		save(t, be, h, data)
+		loadAndCompare(t, wbe, h, data)
+		save(t, wbe, restic.Handle{Type: restic.IndexFile, Name: restic.NewRandomID().String()}, data)
+	}
+
+	// writing to the cache was stopped after the second failure
+	rtest.Assert(t, !c.writable(), "cache is still written")
+	rtest.Equals(t, uint(2), c.writeErrors)
+	rtest.Equals(t, 2, len(*warnings))
+}
+
+func TestBackendReadOnlyCache(t *testing.T) {
+	be := mem.New()
+	c := TestNewCache(t)
+	warnings := collectWarnings(c)
+	wbe := c.Wrap(be)
+
+	h, data := randomData(5234142)
+	save(t, be, h, data)
+
+	// prime cache with broken copy
+	broken := append([]byte{}, data...)
+	broken[0] ^= 0xff
+	rtest.OK(t, c.Save(h, bytes.NewReader(broken)))
+
+	h2, data2 := randomData(1234)
+	save(t, be, h2, data2)
+
+	dir := filepath.Join(c.path, cacheLayoutPaths[restic.IndexFile])
+	rtest.OK(t, filepath.Walk(dir, func(name string, fi os.FileInfo, err error) error {
+		if err != nil || !fi.IsDir() {
+			return err
+		}
+		return os.Chmod(name, 0500)
+	}))
+	defer func() {
+		rtest.OK(t, filepath.Walk(dir, func(name string, fi os.FileInfo, err error) error {
+			if err != nil || !fi.IsDir() {
+				return err
+			}
+			return os.Chmod(name, 0700)
+		}))
+	}()
+
+	f, err := os.CreateTemp(dir, "test-")
+	if err == nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		t.Skip("cache directory is still writable, probably running as root")
+	}
+
+	// the broken file cannot be removed, the correct data is loaded from the backend
+	buf, err := backend.LoadAll(context.TODO(), nil, wbe, h)
+	rtest.OK(t, err)
+	rtest.Assert(t, bytes.Equal(buf, data), "wrong data returned")
+
+	loadAndCompare(t, wbe, h2, data2)
+	rtest.Equals(t, 1, len(*warnings))
+}
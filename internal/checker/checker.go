@@ -12,8 +12,7 @@ import (
 
 	"github.com/minio/sha256-simd"
 	"github.com/restic/restic/internal/backend"
-	"github.com/restic/restic/internal/backend/s3"
-	"github.com/restic/restic/internal/cache"
+	"github.com/restic/restic/internal/backend/layout"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/hashing"
@@ -41,6 +40,10 @@ type Checker struct {
 	masterIndex *index.MasterIndex
 	snapshots   restic.Lister
 
+	// limits for loading trees concurrently, zero means unlimited
+	treeMemoryLimit uint64
+	treeReaders     uint
+
 	repo restic.Repository
 }
 
@@ -199,6 +202,10 @@ func (e *PackError) Error() string {
 	return "pack " + e.ID.String() + ": " + e.Err.Error()
 }
 
+func (e *PackError) Unwrap() error {
+	return e.Err
+}
+
 // IsOrphanedPack returns true if the error describes a pack which is not
 // contained in any index.
 func IsOrphanedPack(err error) bool {
@@ -207,17 +214,8 @@ func IsOrphanedPack(err error) bool {
 }
 
 func isS3Legacy(b restic.Backend) bool {
-	// unwrap cache
-	if be, ok := b.(*cache.Backend); ok {
-		b = be.Backend
-	}
-
-	be, ok := b.(*s3.Backend)
-	if !ok {
-		return false
-	}
-
-	return be.Layout.Name() == "s3legacy"
+	be := restic.AsBackend[layout.Mover](b)
+	return be != nil && be.Name() == "s3legacy"
 }
 
 // Packs checks that all packs referenced in the index are still available and
@@ -303,6 +301,52 @@ func (e *TreeError) Error() string {
 	return fmt.Sprintf("tree %v: %v", e.ID, e.Errors)
 }
 
+// SnapshotKeyError is returned for a snapshot which was created by a key that
+// no longer exists in the repository.
+type SnapshotKeyError struct {
+	SnapshotID restic.ID
+	KeyID      restic.ID
+}
+
+func (e *SnapshotKeyError) Error() string {
+	return fmt.Sprintf("snapshot %v was created by key %v, which no longer exists", e.SnapshotID.Str(), e.KeyID.Str())
+}
+
+// SnapshotKeys checks that the keys recorded in the snapshots as their creator
+// still exist in the repository. Snapshots which do not contain a key ID are
+// ignored; their number is returned as unknown.
+func (c *Checker) SnapshotKeys(ctx context.Context) (unknown int, errs []error) {
+	keys := restic.NewIDSet()
+	err := c.repo.List(ctx, restic.KeyFile, func(id restic.ID, _ int64) error {
+		keys.Insert(id)
+		return nil
+	})
+	if err != nil {
+		return 0, []error{err}
+	}
+
+	err = restic.ForAllSnapshots(ctx, c.snapshots, c.repo, nil, func(id restic.ID, sn *restic.Snapshot, err error) error {
+		if err != nil {
+			errs = append(errs, err)
+			return nil
+		}
+		if sn.KeyID == nil {
+			unknown++
+			return nil
+		}
+		if !keys.Has(*sn.KeyID) {
+			debug.Log("snapshot %v was created by missing key %v", id, sn.KeyID)
+			errs = append(errs, &SnapshotKeyError{SnapshotID: id, KeyID: *sn.KeyID})
+		}
+		return nil
+	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return unknown, errs
+}
+
 // checkTreeWorker checks the trees received and sends out errors to errChan.
 func (c *Checker) checkTreeWorker(ctx context.Context, trees <-chan restic.TreeItem, out chan<- error) {
 	for job := range trees {
@@ -362,19 +406,20 @@ func (c *Checker) Structure(ctx context.Context, p *progress.Counter, errChan ch
 		}
 	}
 
-	wg, ctx := errgroup.WithContext(ctx)
-	treeStream := restic.StreamTrees(ctx, wg, c.repo, trees, func(treeID restic.ID) bool {
-		// blobRefs may be accessed in parallel by checkTree
-		c.blobRefs.Lock()
-		h := restic.BlobHandle{ID: treeID, Type: restic.TreeBlob}
-		blobReferenced := c.blobRefs.M.Has(h)
-		// noop if already referenced
-		c.blobRefs.M.Insert(h)
-		c.blobRefs.Unlock()
-		return blobReferenced
-	}, p)
+	// blobRefs doubles as the set of visited trees, each tree is loaded only once
+	var roots []restic.TreeJob[struct{}]
+	for _, id := range trees {
+		if c.markTreeReferenced(id) {
+			p.Add(1)
+			continue
+		}
+		roots = append(roots, restic.TreeJob[struct{}]{ID: id})
+	}
 
+	treeStream := make(chan restic.TreeItem)
 	defer close(errChan)
+
+	wg, ctx := errgroup.WithContext(ctx)
 	// The checkTree worker only processes already decoded trees and is thus CPU-bound
 	workerCount := runtime.GOMAXPROCS(0)
 	for i := 0; i < workerCount; i++ {
@@ -384,14 +429,54 @@ func (c *Checker) Structure(ctx context.Context, p *progress.Counter, errChan ch
 		})
 	}
 
+	loader := newLimitedLoader(c.repo, c.treeMemoryLimit, c.treeReaders)
+	err := restic.ParallelWalkTrees(ctx, loader, 0, roots, func(job restic.TreeJob[struct{}], tree *restic.Tree, err error) ([]restic.TreeJob[struct{}], error) {
+		var subtrees []restic.TreeJob[struct{}]
+		if err == nil {
+			for _, id := range tree.Subtrees() {
+				// null IDs are reported by checkTree
+				if id.IsNull() || c.markTreeReferenced(id) {
+					continue
+				}
+				subtrees = append(subtrees, restic.TreeJob[struct{}]{ID: id})
+			}
+		}
+
+		// errors while loading a tree are reported by checkTree and do not stop the walk
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case treeStream <- restic.TreeItem{ID: job.ID, Error: err, Tree: tree}:
+		}
+		return subtrees, nil
+	}, p)
+	close(treeStream)
+	if err != nil {
+		// the walk only fails if ctx was canceled
+		debug.Log("walking trees failed: %v", err)
+	}
+
 	// the wait group should not return an error because no worker returns an
 	// error, so panic if that has changed somehow.
-	err := wg.Wait()
+	err = wg.Wait()
 	if err != nil {
 		panic(err)
 	}
 }
 
+// markTreeReferenced records that the tree id is referenced and returns
+// whether it was already referenced before.
+func (c *Checker) markTreeReferenced(id restic.ID) bool {
+	// blobRefs may be accessed in parallel by checkTree
+	c.blobRefs.Lock()
+	defer c.blobRefs.Unlock()
+	h := restic.BlobHandle{ID: id, Type: restic.TreeBlob}
+	referenced := c.blobRefs.M.Has(h)
+	// noop if already referenced
+	c.blobRefs.M.Insert(h)
+	return referenced
+}
+
 func (c *Checker) checkTree(id restic.ID, tree *restic.Tree) (errs []error) {
 	debug.Log("checking tree %v", id)
 
@@ -482,6 +567,12 @@ func (c *Checker) UnusedBlobs(ctx context.Context) (blobs restic.BlobHandles) {
 	return blobs
 }
 
+// Snapshots returns the snapshot files found by LoadSnapshots. Listing them
+// does not access the backend.
+func (c *Checker) Snapshots() restic.Lister {
+	return c.snapshots
+}
+
 // CountPacks returns the number of packs in the repository.
 func (c *Checker) CountPacks() uint64 {
 	return uint64(len(c.packs))
@@ -497,7 +588,7 @@ func checkPack(ctx context.Context, r restic.Repository, id restic.ID, blobs []r
 	debug.Log("checking pack %v", id.String())
 
 	if len(blobs) == 0 {
-		return errors.Errorf("pack %v is empty or not indexed", id)
+		return errors.New("empty or not indexed")
 	}
 
 	// sanity check blobs in index
@@ -572,16 +663,16 @@ func checkPack(ctx context.Context, r restic.Repository, id restic.ID, blobs []r
 	if err != nil {
 		// failed to load the pack file, return as further checks cannot succeed anyways
 		debug.Log("  error streaming pack: %v", err)
-		return errors.Errorf("pack %v failed to download: %v", id, err)
+		return errors.Errorf("failed to download: %v", err)
 	}
 	if !hash.Equal(id) {
 		debug.Log("Pack ID does not match, want %v, got %v", id, hash)
-		return errors.Errorf("Pack ID does not match, want %v, got %v", id, hash)
+		return errors.Errorf("ID does not match, got %v", hash)
 	}
 
 	blobs, hdrSize, err := pack.List(r.Key(), bytes.NewReader(hdrBuf), int64(len(hdrBuf)))
 	if err != nil {
-		return err
+		return errors.Wrap(err, "damaged pack header")
 	}
 
 	if uint32(idxHdrSize) != hdrSize {
@@ -606,7 +697,7 @@ func checkPack(ctx context.Context, r restic.Repository, id restic.ID, blobs []r
 	}
 
 	if len(errs) > 0 {
-		return errors.Errorf("pack %v contains %v errors: %v", id, len(errs), errs)
+		return errors.Errorf("contains %v errors: %v", len(errs), errs)
 	}
 
 	return nil
@@ -617,7 +708,9 @@ func (c *Checker) ReadData(ctx context.Context, errChan chan<- error) {
 	c.ReadPacks(ctx, c.packs, nil, errChan)
 }
 
-// ReadPacks loads data from specified packs and checks the integrity.
+// ReadPacks loads data from specified packs and checks the integrity. The
+// progress counter p is incremented for each pack and by its size. Damaged
+// packs are reported as *PackError.
 func (c *Checker) ReadPacks(ctx context.Context, packs map[restic.ID]int64, p *progress.Counter, errChan chan<- error) {
 	defer close(errChan)
 
@@ -651,10 +744,16 @@ func (c *Checker) ReadPacks(ctx context.Context, packs map[restic.ID]int64, p *p
 				}
 
 				err := checkPack(ctx, c.repo, ps.id, ps.blobs, ps.size, bufRd)
+				if ctx.Err() != nil {
+					// the pack was not checked completely, don't report it as damaged
+					return nil
+				}
 				p.Add(1)
+				p.AddBytes(uint64(ps.size))
 				if err == nil {
 					continue
 				}
+				err = &PackError{ID: ps.id, Err: err}
 
 				select {
 				case <-ctx.Done():
@@ -678,6 +777,9 @@ func (c *Checker) ReadPacks(ctx context.Context, packs map[restic.ID]int64, p *p
 		case ch <- checkTask{id: pbs.PackID, size: size, blobs: pbs.Blobs}:
 		case <-ctx.Done():
 		}
+		if ctx.Err() != nil {
+			break
+		}
 	}
 	close(ch)
 
@@ -2,6 +2,7 @@ package checker_test
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"math/rand"
 	"os"
@@ -19,6 +20,7 @@ import (
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/test"
+	"github.com/restic/restic/internal/ui/progress"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -90,6 +92,46 @@ func TestCheckRepo(t *testing.T) {
 	test.OKs(t, checkStruct(chkr))
 }
 
+func TestCheckProgress(t *testing.T) {
+	repodir, cleanup := test.Env(t, checkerTestData)
+	defer cleanup()
+
+	repo := repository.TestOpenLocal(t, repodir)
+
+	chkr := checker.New(repo, false)
+	_, errs := chkr.LoadIndex(context.TODO())
+	test.Equals(t, 0, len(errs))
+	test.OK(t, chkr.LoadSnapshots(context.TODO()))
+
+	var last progress.PhaseStatus
+	report := func(s progress.PhaseStatus, final bool) {
+		last = s
+	}
+
+	p := progress.NewPhaseCounter(0, 0, 0, report)
+	test.OKs(t, collectErrors(context.TODO(), func(ctx context.Context, errChan chan<- error) {
+		chkr.Structure(ctx, p, errChan)
+	}))
+	p.Done()
+	test.Assert(t, last.MaxItems > 0, "no trees to check")
+	test.Equals(t, last.MaxItems, last.Items)
+
+	packs := chkr.GetPacks()
+	var size uint64
+	for _, packSize := range packs {
+		size += uint64(packSize)
+	}
+
+	p = progress.NewPhaseCounter(0, uint64(len(packs)), size, report)
+	test.OKs(t, collectErrors(context.TODO(), func(ctx context.Context, errChan chan<- error) {
+		chkr.ReadPacks(ctx, packs, p, errChan)
+	}))
+	p.Done()
+	test.Equals(t, uint64(len(packs)), last.Items)
+	test.Equals(t, size, last.Bytes)
+	test.Equals(t, size, last.MaxBytes)
+}
+
 func TestMissingPack(t *testing.T) {
 	repodir, cleanup := test.Env(t, checkerTestData)
 	defer cleanup()
@@ -384,7 +426,11 @@ type loadTreesOnceRepository struct {
 	DuplicateTree bool
 }
 
-func (r *loadTreesOnceRepository) LoadTree(ctx context.Context, id restic.ID) (*restic.Tree, error) {
+func (r *loadTreesOnceRepository) LoadBlob(ctx context.Context, t restic.BlobType, id restic.ID, buf []byte) ([]byte, error) {
+	if t != restic.TreeBlob {
+		return r.Repository.LoadBlob(ctx, t, id, buf)
+	}
+
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
@@ -394,7 +440,7 @@ func (r *loadTreesOnceRepository) LoadTree(ctx context.Context, id restic.ID) (*
 		return nil, errors.Errorf("trying to load tree with id %v twice", id)
 	}
 	r.loadedTrees.Insert(id)
-	return restic.LoadTree(ctx, r.Repository, id)
+	return r.Repository.LoadBlob(ctx, t, id, buf)
 }
 
 func TestCheckerNoDuplicateTreeDecodes(t *testing.T) {
@@ -417,6 +463,50 @@ func TestCheckerNoDuplicateTreeDecodes(t *testing.T) {
 	test.OKs(t, checkPacks(chkr))
 	test.OKs(t, checkStruct(chkr))
 	test.Assert(t, !checkRepo.DuplicateTree, "detected duplicate tree loading")
+	test.Assert(t, len(checkRepo.loadedTrees) > 0, "no trees were loaded")
+}
+
+func TestCheckerNoDuplicateTreeDecodesSharedTrees(t *testing.T) {
+	repodir, cleanup := test.Env(t, checkerTestData)
+	defer cleanup()
+
+	repo := repository.TestOpenLocal(t, repodir)
+
+	// add snapshots which share the tree of an existing snapshot
+	sn, err := restic.LoadSnapshot(context.TODO(), repo, restic.TestParseID("51d249d28815200d59e4be7b3f21a157b864dc343353df9d8e498220c2499b02"))
+	test.OK(t, err)
+	addSnapshotsWithTree(t, repo, sn.Tree, 20)
+
+	checkRepo := &loadTreesOnceRepository{
+		Repository:  repo,
+		loadedTrees: restic.NewIDSet(),
+	}
+
+	chkr := checker.New(checkRepo, false)
+	hints, errs := chkr.LoadIndex(context.TODO())
+	if len(errs) > 0 {
+		t.Fatalf("expected no errors, got %v: %v", len(errs), errs)
+	}
+	assertOnlyMixedPackHints(t, hints)
+
+	test.OKs(t, checkStruct(chkr))
+	test.Assert(t, !checkRepo.DuplicateTree, "detected duplicate tree loading")
+}
+
+// addSnapshotsWithTree saves count new snapshots which all reference treeID.
+func addSnapshotsWithTree(t testing.TB, repo restic.Repository, treeID *restic.ID, count int) {
+	for i := 0; i < count; i++ {
+		sn, err := restic.NewSnapshot([]string{"test" + strconv.Itoa(i)}, nil, "", time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		sn.Tree = treeID
+
+		_, err = restic.SaveSnapshot(context.TODO(), repo, sn)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
 }
 
 // delayRepository delays read of a specific handle.
@@ -590,20 +680,7 @@ func benchmarkSnapshotScaling(t *testing.B, newSnapshots int) {
 		t.Fatal(err)
 	}
 
-	treeID := sn2.Tree
-
-	for i := 0; i < newSnapshots; i++ {
-		sn, err := restic.NewSnapshot([]string{"test" + strconv.Itoa(i)}, nil, "", time.Now())
-		if err != nil {
-			t.Fatal(err)
-		}
-		sn.Tree = treeID
-
-		_, err = restic.SaveSnapshot(context.TODO(), repo, sn)
-		if err != nil {
-			t.Fatal(err)
-		}
-	}
+	addSnapshotsWithTree(t, repo, sn2.Tree, newSnapshots)
 
 	t.ResetTimer()
 
@@ -623,3 +700,172 @@ func BenchmarkCheckerSnapshotScaling(b *testing.B) {
 		})
 	}
 }
+
+// concurrencyRepository tracks the size and number of tree blobs which are
+// loaded concurrently.
+type concurrencyRepository struct {
+	restic.Repository
+
+	m                     sync.Mutex
+	loads, maxLoads       int
+	inFlight, maxInFlight uint
+}
+
+func (r *concurrencyRepository) LoadBlob(ctx context.Context, t restic.BlobType, id restic.ID, buf []byte) ([]byte, error) {
+	size, _ := r.LookupBlobSize(id, t)
+	r.m.Lock()
+	r.loads++
+	r.inFlight += size
+	if r.loads > r.maxLoads {
+		r.maxLoads = r.loads
+	}
+	if r.inFlight > r.maxInFlight {
+		r.maxInFlight = r.inFlight
+	}
+	r.m.Unlock()
+
+	// give other loads the chance to run concurrently
+	time.Sleep(time.Millisecond)
+	defer func() {
+		r.m.Lock()
+		r.loads--
+		r.inFlight -= size
+		r.m.Unlock()
+	}()
+	return r.Repository.LoadBlob(ctx, t, id, buf)
+}
+
+// createLargeTrees saves a snapshot whose root contains count directories with
+// large trees and returns the size of the largest tree blob.
+func createLargeTrees(t *testing.T, repo restic.Repository, count int) uint {
+	ctx := context.TODO()
+	wg, wgCtx := errgroup.WithContext(ctx)
+	repo.StartPackUploader(wgCtx, wg)
+
+	root := &restic.Tree{}
+	for i := 0; i < count; i++ {
+		tree := &restic.Tree{}
+		for j := 0; j < 500; j++ {
+			test.OK(t, tree.Insert(&restic.Node{
+				Name:       fmt.Sprintf("link-%04d", j),
+				Type:       "symlink",
+				Mode:       os.ModeSymlink | 0777,
+				LinkTarget: fmt.Sprintf("target-%d-%d", i, j),
+			}))
+		}
+		id, err := restic.SaveTree(ctx, repo, tree)
+		test.OK(t, err)
+		test.OK(t, root.Insert(&restic.Node{Name: fmt.Sprintf("dir-%04d", i), Type: "dir", Mode: 0755, Subtree: &id}))
+	}
+	rootID, err := restic.SaveTree(ctx, repo, root)
+	test.OK(t, err)
+	test.OK(t, repo.Flush(ctx))
+
+	sn, err := restic.NewSnapshot([]string{"/large"}, nil, "foo", time.Now())
+	test.OK(t, err)
+	sn.Tree = &rootID
+	_, err = restic.SaveSnapshot(ctx, repo, sn)
+	test.OK(t, err)
+
+	var largest uint
+	for _, node := range root.Nodes {
+		size, found := repo.LookupBlobSize(*node.Subtree, restic.TreeBlob)
+		test.Assert(t, found, "tree %v not found", node.Subtree)
+		if size > largest {
+			largest = size
+		}
+	}
+	return largest
+}
+
+func TestCheckerTreeLoadLimits(t *testing.T) {
+	repo := repository.TestRepository(t)
+	treeSize := createLargeTrees(t, repo, 20)
+
+	for _, test := range []struct {
+		name        string
+		memory      uint64
+		readers     uint
+		maxInFlight uint
+		maxLoads    int
+	}{
+		{"memory", uint64(3 * treeSize), 0, 3 * treeSize, 3},
+		{"oversized", uint64(treeSize / 10), 0, treeSize, 1},
+		{"readers", 0, 2, 0, 2},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			checkRepo := &concurrencyRepository{Repository: repo}
+			chkr := checker.New(checkRepo, false)
+			chkr.SetTreeLoadLimits(test.memory, test.readers)
+
+			hints, errs := chkr.LoadIndex(context.TODO())
+			if len(errs) > 0 || len(hints) > 0 {
+				t.Fatalf("unexpected errors %v, hints %v", errs, hints)
+			}
+			if errs := checkStruct(chkr); len(errs) > 0 {
+				t.Fatalf("unexpected errors: %v", errs)
+			}
+
+			if test.maxInFlight > 0 && checkRepo.maxInFlight > test.maxInFlight {
+				t.Errorf("loaded %v bytes concurrently, limit %v", checkRepo.maxInFlight, test.maxInFlight)
+			}
+			if checkRepo.maxLoads > test.maxLoads {
+				t.Errorf("loaded %v trees concurrently, limit %v", checkRepo.maxLoads, test.maxLoads)
+			}
+		})
+	}
+}
+
+// blockingPackBackend blocks loading pack files until the context of the
+// request is canceled. blocked is closed once the first request blocks.
+type blockingPackBackend struct {
+	restic.Backend
+	once    sync.Once
+	blocked chan struct{}
+}
+
+func (be *blockingPackBackend) Load(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+	if h.Type != restic.PackFile {
+		return be.Backend.Load(ctx, h, length, offset, fn)
+	}
+	be.once.Do(func() { close(be.blocked) })
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestCheckerReadDataCancel(t *testing.T) {
+	repodir, cleanup := test.Env(t, checkerTestData)
+	defer cleanup()
+
+	repo := repository.TestOpenLocal(t, repodir)
+	be := &blockingPackBackend{Backend: repo.Backend(), blocked: make(chan struct{})}
+	checkRepo, err := repository.New(be, repository.Options{})
+	test.OK(t, err)
+	test.OK(t, checkRepo.SearchKey(context.TODO(), test.TestPassword, 5, ""))
+
+	chkr := checker.New(checkRepo, false)
+	_, errs := chkr.LoadIndex(context.TODO())
+	test.Equals(t, 0, len(errs))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errChan := make(chan error)
+	go chkr.ReadData(ctx, errChan)
+
+	<-be.blocked
+	cancel()
+
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case err, ok := <-errChan:
+			if !ok {
+				return
+			}
+			// packs whose check was canceled are not damaged
+			t.Errorf("unexpected error %v", err)
+		case <-timeout:
+			t.Fatal("ReadData did not return after the context was canceled")
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package checker
+
+import (
+	"context"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/options"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
+	"golang.org/x/sync/semaphore"
+)
+
+// Config contains the options for the checker.
+type Config struct {
+	MemoryLimit string `option:"memory-limit" help:"maximum size of the tree blobs loaded concurrently while checking the structure (default: unlimited)"`
+	Readers     uint   `option:"readers" help:"maximum number of tree blobs read concurrently while checking the structure (default: limited by the backend connections)"`
+
+	ConfirmOperations string `option:"confirm-operations" help:"ask for confirmation if check is estimated to perform more than n backend operations, 0 never asks (default: 100000 for cloud storage services)"`
+}
+
+func init() {
+	options.Register("check", Config{})
+}
+
+// MemoryLimitBytes returns the configured memory limit in bytes, zero means
+// unlimited.
+func (cfg Config) MemoryLimitBytes() (uint64, error) {
+	if cfg.MemoryLimit == "" {
+		return 0, nil
+	}
+
+	size, err := ui.ParseBytes(cfg.MemoryLimit)
+	if err != nil {
+		return 0, errors.Errorf("invalid check.memory-limit %q: %v", cfg.MemoryLimit, err)
+	}
+	if size <= 0 {
+		return 0, errors.Errorf("invalid check.memory-limit %q: must be positive", cfg.MemoryLimit)
+	}
+	return uint64(size), nil
+}
+
+// SetTreeLoadLimits limits the tree blobs loaded concurrently while checking
+// the structure to a total size of memory bytes and to readers blobs. A value
+// of zero leaves the respective limit unset.
+func (c *Checker) SetTreeLoadLimits(memory uint64, readers uint) {
+	c.treeMemoryLimit = memory
+	c.treeReaders = readers
+}
+
+// limitedLoader limits the size and the number of blobs loaded concurrently.
+type limitedLoader struct {
+	restic.Loader
+
+	memory      *semaphore.Weighted
+	memoryLimit int64
+	readers     *semaphore.Weighted
+}
+
+func newLimitedLoader(repo restic.Loader, memory uint64, readers uint) restic.Loader {
+	if memory == 0 && readers == 0 {
+		return repo
+	}
+
+	l := &limitedLoader{Loader: repo}
+	if memory > 0 {
+		l.memoryLimit = int64(memory)
+		l.memory = semaphore.NewWeighted(l.memoryLimit)
+	}
+	if readers > 0 {
+		l.readers = semaphore.NewWeighted(int64(readers))
+	}
+	return l
+}
+
+func (l *limitedLoader) LoadBlob(ctx context.Context, t restic.BlobType, id restic.ID, buf []byte) ([]byte, error) {
+	if l.readers != nil {
+		if err := l.readers.Acquire(ctx, 1); err != nil {
+			return nil, err
+		}
+		defer l.readers.Release(1)
+	}
+
+	if l.memory != nil {
+		size, _ := l.LookupBlobSize(id, t)
+		weight := int64(size)
+		// a blob larger than the whole limit may only be loaded on its own
+		if weight > l.memoryLimit {
+			weight = l.memoryLimit
+		}
+		if err := l.memory.Acquire(ctx, weight); err != nil {
+			return nil, err
+		}
+		defer l.memory.Release(weight)
+	}
+
+	return l.Loader.LoadBlob(ctx, t, id, buf)
+}
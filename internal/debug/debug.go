@@ -161,6 +161,11 @@ func checkFilter(filter map[string]bool, key string) bool {
 	return false
 }
 
+// Enabled returns true if debug logging is enabled.
+func Enabled() bool {
+	return opts.isEnabled
+}
+
 // Log prints a message to the debug log (if debug is enabled).
 func Log(f string, args ...interface{}) {
 	if !opts.isEnabled {
@@ -2,7 +2,10 @@ package filter
 
 import (
 	"path/filepath"
+	"runtime"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/restic/restic/internal/errors"
 )
@@ -11,6 +14,11 @@ import (
 // second argument.
 var ErrBadString = errors.New("filter.Match: string is empty")
 
+// windowsPaths is set if backslashes are path separators in both patterns and
+// paths. This is the case on Windows, where a backslash therefore cannot be
+// used to escape special characters.
+var windowsPaths = runtime.GOOS == "windows"
+
 type patternPart struct {
 	pattern  string // First is "/" for absolute pattern; "" for "**".
 	isSimple bool
@@ -21,16 +29,26 @@ type Pattern struct {
 	original  string
 	parts     []patternPart
 	isNegated bool
+	// alternatives contains the expansions of path components which use "**"
+	// together with other characters, for example "*.go**". If set, the
+	// pattern matches if one of the alternatives matches.
+	alternatives [][]patternPart
+	// ignoreCase is set for patterns which match paths regardless of their
+	// case. The parts of such a pattern are already case folded.
+	ignoreCase bool
 }
 
-func prepareStr(str string) ([]string, error) {
+func prepareStr(str string, ignoreCase bool) ([]string, error) {
 	if str == "" {
 		return nil, ErrBadString
 	}
+	if ignoreCase {
+		str = foldCase(str)
+	}
 	return splitPath(str), nil
 }
 
-func preparePattern(patternStr string) Pattern {
+func preparePattern(patternStr string, ignoreCase bool) Pattern {
 	var negate bool
 
 	originalPattern := patternStr
@@ -39,32 +57,143 @@ func preparePattern(patternStr string) Pattern {
 		negate = true
 		patternStr = patternStr[1:]
 	}
+	if ignoreCase {
+		patternStr = foldCase(patternStr)
+	}
 
-	pathParts := splitPath(filepath.Clean(patternStr))
+	hasSpanningPart := false
+	pathParts := splitPath(filepath.Clean(toSlash(patternStr)))
 	parts := make([]patternPart, len(pathParts))
 	for i, part := range pathParts {
 		isSimple := !strings.ContainsAny(part, "\\[]*?")
+		if !isSimple {
+			part = normalizeWildcards(part)
+		}
 		// Replace "**" with the empty string to get faster comparisons
 		// (length-check only) in hasDoubleWildcard.
 		if part == "**" {
 			part = ""
+		} else if strings.Contains(part, "**") {
+			hasSpanningPart = true
 		}
 		parts[i] = patternPart{part, isSimple}
 	}
 
-	return Pattern{originalPattern, parts, negate}
+	pattern := Pattern{original: originalPattern, parts: parts, isNegated: negate, ignoreCase: ignoreCase}
+	if hasSpanningPart {
+		pattern.alternatives = expandSpanningParts(parts)
+	}
+	return pattern
+}
+
+// normalizeWildcards converts a path component to the syntax understood by
+// filepath.Match: the negated character class "[!...]" is replaced by
+// "[^...]" and runs of more than two "*" are shortened to "**".
+func normalizeWildcards(part string) string {
+	if !strings.Contains(part, "[!") && !strings.Contains(part, "***") {
+		return part
+	}
+
+	var sb strings.Builder
+	inClass := false
+	for i := 0; i < len(part); i++ {
+		c := part[i]
+		switch {
+		case c == '\\' && i+1 < len(part) && !windowsPaths:
+			// keep escaped characters unchanged
+			sb.WriteByte(c)
+			i++
+			c = part[i]
+		case c == '[' && !inClass:
+			inClass = true
+			if i+1 < len(part) && part[i+1] == '!' {
+				sb.WriteString("[^")
+				i++
+				continue
+			}
+		case c == ']' && inClass:
+			inClass = false
+		case c == '*' && !inClass && strings.HasSuffix(sb.String(), "**"):
+			continue
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+// expandSpanningParts returns all variants of parts in which each path
+// component that contains "**" together with other characters is replaced,
+// such that the "**" either matches within a single component or spans
+// several components. For example, "a**b" expands to "a*b" and
+// "a*", "**", "*b".
+func expandSpanningParts(parts []patternPart) [][]patternPart {
+	for i, part := range parts {
+		pos := strings.Index(part.pattern, "**")
+		if part.pattern == "" || pos < 0 {
+			continue
+		}
+
+		prefix, suffix := part.pattern[:pos], part.pattern[pos+2:]
+		single := make([]patternPart, 0, len(parts))
+		single = append(single, parts[:i]...)
+		single = append(single, patternPart{prefix + "*" + suffix, false})
+		single = append(single, parts[i+1:]...)
+
+		spanning := make([]patternPart, 0, len(parts)+2)
+		spanning = append(spanning, parts[:i]...)
+		spanning = append(spanning, patternPart{prefix + "*", false}, patternPart{"", false}, patternPart{"*" + suffix, false})
+		spanning = append(spanning, parts[i+1:]...)
+
+		return append(expandSpanningParts(single), expandSpanningParts(spanning)...)
+	}
+	return [][]patternPart{parts}
+}
+
+// toSlash replaces backslashes in p by slashes if backslashes are path
+// separators, for example in a pattern read from an exclude file written on
+// Windows.
+func toSlash(p string) string {
+	if windowsPaths {
+		return strings.ReplaceAll(p, `\`, "/")
+	}
+	return p
 }
 
 // Split p into path components. Assuming p has been Cleaned, no component
 // will be empty. For absolute paths, the first component is "/".
 func splitPath(p string) []string {
-	parts := strings.Split(filepath.ToSlash(p), "/")
+	parts := strings.Split(toSlash(p), "/")
 	if parts[0] == "" {
 		parts[0] = "/"
 	}
 	return parts
 }
 
+// foldCase returns a case folded copy of str. Two strings which only differ
+// in case, as defined by Unicode simple case folding, are equal after
+// folding.
+func foldCase(str string) string {
+	for i := 0; i < len(str); i++ {
+		if str[i] >= utf8.RuneSelf {
+			return strings.Map(foldRune, str)
+		}
+	}
+	return strings.ToLower(str)
+}
+
+// foldRune maps r to the lowercase form of the smallest rune which is
+// equivalent to r under simple case folding, for example both "K" and the
+// Kelvin sign are mapped to "k".
+func foldRune(r rune) rune {
+	min := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if f < min {
+			min = f
+		}
+	}
+	return unicode.ToLower(min)
+}
+
 // Match returns true if str matches the pattern. When the pattern is
 // malformed, filepath.ErrBadPattern is returned. The empty pattern matches
 // everything, when str is the empty string ErrBadString is returned.
@@ -74,14 +203,25 @@ func splitPath(p string) []string {
 //
 // In addition patterns suitable for filepath.Match, pattern accepts a
 // recursive wildcard '**', which greedily matches an arbitrary number of
-// intermediate directories.
+// intermediate directories. Within a path component, '**' matches across
+// directory separators, and '[!...]' is accepted for '[^...]'.
 func Match(patternStr, str string) (matched bool, err error) {
+	return matchString(patternStr, str, false)
+}
+
+// MatchInsensitive is the same as Match, but ignores the case of str and
+// the pattern.
+func MatchInsensitive(patternStr, str string) (matched bool, err error) {
+	return matchString(patternStr, str, true)
+}
+
+func matchString(patternStr, str string, ignoreCase bool) (matched bool, err error) {
 	if patternStr == "" {
 		return true, nil
 	}
 
-	pattern := preparePattern(patternStr)
-	strs, err := prepareStr(str)
+	pattern := preparePattern(patternStr, ignoreCase)
+	strs, err := prepareStr(str, ignoreCase)
 
 	if err != nil {
 		return false, err
@@ -99,14 +239,25 @@ func Match(patternStr, str string) (matched bool, err error) {
 //
 // In addition patterns suitable for filepath.Match, pattern accepts a
 // recursive wildcard '**', which greedily matches an arbitrary number of
-// intermediate directories.
+// intermediate directories. Within a path component, '**' matches across
+// directory separators, and '[!...]' is accepted for '[^...]'.
 func ChildMatch(patternStr, str string) (matched bool, err error) {
+	return childMatchString(patternStr, str, false)
+}
+
+// ChildMatchInsensitive is the same as ChildMatch, but ignores the case of
+// str and the pattern.
+func ChildMatchInsensitive(patternStr, str string) (matched bool, err error) {
+	return childMatchString(patternStr, str, true)
+}
+
+func childMatchString(patternStr, str string, ignoreCase bool) (matched bool, err error) {
 	if patternStr == "" {
 		return true, nil
 	}
 
-	pattern := preparePattern(patternStr)
-	strs, err := prepareStr(str)
+	pattern := preparePattern(patternStr, ignoreCase)
+	strs, err := prepareStr(str, ignoreCase)
 
 	if err != nil {
 		return false, err
@@ -116,6 +267,16 @@ func ChildMatch(patternStr, str string) (matched bool, err error) {
 }
 
 func childMatch(pattern Pattern, strs []string) (matched bool, err error) {
+	if pattern.alternatives != nil {
+		for _, parts := range pattern.alternatives {
+			matched, err := childMatch(Pattern{original: pattern.original, parts: parts, isNegated: pattern.isNegated}, strs)
+			if err != nil || matched {
+				return matched, err
+			}
+		}
+		return false, nil
+	}
+
 	if pattern.parts[0].pattern != "/" {
 		// relative pattern can always be nested down
 		return true, nil
@@ -134,7 +295,7 @@ func childMatch(pattern Pattern, strs []string) (matched bool, err error) {
 	} else {
 		l = len(strs)
 	}
-	return match(Pattern{pattern.original, pattern.parts[0:l], pattern.isNegated}, strs)
+	return match(Pattern{original: pattern.original, parts: pattern.parts[0:l], isNegated: pattern.isNegated}, strs)
 }
 
 func hasDoubleWildcard(list Pattern) (ok bool, pos int) {
@@ -148,6 +309,16 @@ func hasDoubleWildcard(list Pattern) (ok bool, pos int) {
 }
 
 func match(pattern Pattern, strs []string) (matched bool, err error) {
+	if pattern.alternatives != nil {
+		for _, parts := range pattern.alternatives {
+			matched, err := match(Pattern{original: pattern.original, parts: parts, isNegated: pattern.isNegated}, strs)
+			if err != nil || matched {
+				return matched, err
+			}
+		}
+		return false, nil
+	}
+
 	if ok, pos := hasDoubleWildcard(pattern); ok {
 		// gradually expand '**' into separate wildcards
 		newPat := make([]patternPart, len(strs))
@@ -162,7 +333,7 @@ func match(pattern Pattern, strs []string) (matched bool, err error) {
 			}
 			newPat = append(newPat, pattern.parts[pos+1:]...)
 
-			matched, err := match(Pattern{pattern.original, newPat, pattern.isNegated}, strs)
+			matched, err := match(Pattern{original: pattern.original, parts: newPat, isNegated: pattern.isNegated}, strs)
 			if err != nil {
 				return false, err
 			}
@@ -254,13 +425,24 @@ func ValidatePatterns(patterns []string) error {
 
 // ParsePatterns prepares a list of patterns for use with List.
 func ParsePatterns(pattern []string) []Pattern {
+	return parsePatterns(pattern, false)
+}
+
+// ParseInsensitivePatterns is the same as ParsePatterns, but the returned
+// patterns ignore the case of the paths passed to List. Both the patterns
+// and the paths are compared using Unicode case folding.
+func ParseInsensitivePatterns(pattern []string) []Pattern {
+	return parsePatterns(pattern, true)
+}
+
+func parsePatterns(pattern []string, ignoreCase bool) []Pattern {
 	patpat := make([]Pattern, 0)
 	for _, pat := range pattern {
 		if pat == "" {
 			continue
 		}
 
-		pats := preparePattern(pat)
+		pats := preparePattern(pat, ignoreCase)
 		patpat = append(patpat, pats)
 	}
 	return patpat
@@ -268,44 +450,68 @@ func ParsePatterns(pattern []string) []Pattern {
 
 // List returns true if str matches one of the patterns. Empty patterns are ignored.
 func List(patterns []Pattern, str string) (matched bool, err error) {
-	matched, _, err = list(patterns, false, str)
+	matched, _, _, err = list(patterns, false, str)
 	return matched, err
 }
 
+// ListMatch is like List, but also returns the pattern which caused str to
+// match.
+func ListMatch(patterns []Pattern, str string) (matched bool, pattern string, err error) {
+	matched, _, pattern, err = list(patterns, false, str)
+	return matched, pattern, err
+}
+
 // ListWithChild returns true if str matches one of the patterns. Empty patterns are ignored.
 func ListWithChild(patterns []Pattern, str string) (matched bool, childMayMatch bool, err error) {
-	return list(patterns, true, str)
+	matched, childMayMatch, _, err = list(patterns, true, str)
+	return matched, childMayMatch, err
 }
 
 // list returns true if str matches one of the patterns. Empty patterns are ignored.
 // Patterns prefixed by "!" are negated: any matching file excluded by a previous pattern
-// will become included again.
-func list(patterns []Pattern, checkChildMatches bool, str string) (matched bool, childMayMatch bool, err error) {
+// will become included again. If str matches, the pattern which caused the
+// match is returned.
+func list(patterns []Pattern, checkChildMatches bool, str string) (matched bool, childMayMatch bool, pattern string, err error) {
 	if len(patterns) == 0 {
-		return false, false, nil
+		return false, false, "", nil
 	}
 
-	strs, err := prepareStr(str)
+	strs, err := prepareStr(str, false)
 	if err != nil {
-		return false, false, err
+		return false, false, "", err
 	}
 
 	hasNegatedPattern := false
+	hasInsensitivePattern := false
 	for _, pat := range patterns {
 		hasNegatedPattern = hasNegatedPattern || pat.isNegated
+		hasInsensitivePattern = hasInsensitivePattern || pat.ignoreCase
+	}
+
+	var foldedStrs []string
+	if hasInsensitivePattern {
+		foldedStrs, err = prepareStr(str, true)
+		if err != nil {
+			return false, false, "", err
+		}
 	}
 
 	for _, pat := range patterns {
+		strs := strs
+		if pat.ignoreCase {
+			strs = foldedStrs
+		}
+
 		m, err := match(pat, strs)
 		if err != nil {
-			return false, false, err
+			return false, false, "", err
 		}
 
 		var c bool
 		if checkChildMatches {
 			c, err = childMatch(pat, strs)
 			if err != nil {
-				return false, false, err
+				return false, false, "", err
 			}
 		} else {
 			c = true
@@ -315,6 +521,9 @@ func list(patterns []Pattern, checkChildMatches bool, str string) (matched bool,
 			matched = matched && !m
 			childMayMatch = childMayMatch && !m
 		} else {
+			if m && !matched {
+				pattern = pat.original
+			}
 			matched = matched || m
 			childMayMatch = childMayMatch || c
 
@@ -325,5 +534,8 @@ func list(patterns []Pattern, checkChildMatches bool, str string) (matched bool,
 		}
 	}
 
-	return matched, childMayMatch, nil
+	if !matched {
+		pattern = ""
+	}
+	return matched, childMayMatch, pattern, nil
 }
@@ -0,0 +1,49 @@
+package filter
+
+import "testing"
+
+func TestWindowsPaths(t *testing.T) {
+	defer func(old bool) {
+		windowsPaths = old
+	}(windowsPaths)
+	windowsPaths = true
+
+	var tests = []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{`C:\Users\*\AppData`, `C:\Users\bob\AppData`, true},
+		{`C:\Users\*\AppData`, `C:/Users/bob/AppData`, true},
+		{`C:/Users/*/AppData`, `C:\Users\bob\AppData`, true},
+		{`C:\Users\*\AppData`, `C:\Users\bob\AppData\Local\file`, true},
+		{`C:\Users\*\AppData`, `C:\Users\bob\Documents`, false},
+		{`C:\Users\bob\..\alice`, `C:\Users\alice`, true},
+		{`node_modules`, `D:\src\project\node_modules`, true},
+		{`project\node_modules`, `D:\src\project\node_modules`, true},
+		{`**\*.tmp`, `C:\temp\a\b.tmp`, true},
+		{`**\*.tmp`, `C:\temp\a\b.txt`, false},
+		{`*.[!oa]`, `C:\build\main.c`, true},
+		{`*.[!oa]`, `C:\build\main.o`, false},
+	}
+
+	for _, test := range tests {
+		match, err := Match(test.pattern, test.path)
+		if err != nil {
+			t.Errorf("Match(%q, %q) returned error: %v", test.pattern, test.path, err)
+			continue
+		}
+		if match != test.match {
+			t.Errorf("Match(%q, %q): expected %v, got %v", test.pattern, test.path, test.match, match)
+		}
+
+		match, err = List(ParsePatterns([]string{test.pattern}), test.path)
+		if err != nil {
+			t.Errorf("List(%q, %q) returned error: %v", test.pattern, test.path, err)
+			continue
+		}
+		if match != test.match {
+			t.Errorf("List(%q, %q): expected %v, got %v", test.pattern, test.path, test.match, match)
+		}
+	}
+}
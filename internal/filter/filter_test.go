@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 
@@ -93,6 +94,37 @@ var matchTests = []struct {
 	{"c:/foo/", "c:/foo/bar", true},
 	{"c:/foo/*/test.*", "c:/foo/bar/test.go", true},
 	{"c:/foo/*/bar/test.*", "c:/foo/bar/test.go", false},
+
+	// "**" combined with other characters spans directories
+	{"src/**.go", "/x/src/main.go", true},
+	{"src/**.go", "/x/src/a/b/main.go", true},
+	{"src/**.go", "/x/src/a/b/main.c", false},
+	{"src/**.go", "/x/other/main.go", false},
+	{"/a/b**z", "/a/bz", true},
+	{"/a/b**z", "/a/b/c/z", true},
+	{"/a/b**z", "/a/bc/dz", true},
+	{"/a/b**z", "/a/b/c/y", false},
+	{"/a/b**z", "/x/a/b/z", false},
+	{"/a/b**z/x", "/a/b/c/z/x", true},
+	{"/a/b**z/x", "/a/b/c/z/y", false},
+	{"a**b**c", "/a/x/b/y/c", true},
+	{"a**b**c", "/abc", true},
+	{"a**b**c", "/a/x/c", false},
+	{"***.go", "/x/y/main.go", true},
+	{"/x/***/main.go", "/x/y/z/main.go", true},
+
+	// character classes
+	{"[Cc]ache", "/home/user/cache", true},
+	{"[Cc]ache", "/home/user/Cache", true},
+	{"[Cc]ache", "/home/user/xcache", false},
+	{"[!a]bc", "/x/bbc", true},
+	{"[!a]bc", "/x/abc", false},
+	{"[^a]bc", "/x/bbc", true},
+	{"[^a]bc", "/x/abc", false},
+	{"file[0-9].txt", "/x/file7.txt", true},
+	{"file[0-9].txt", "/x/filea.txt", false},
+	{"**/[!.]*.log", "/x/y/debug.log", true},
+	{"**/[!.]*.log", "/x/y/.debug.log", false},
 }
 
 func testpattern(t *testing.T, pattern, path string, shouldMatch bool) {
@@ -183,6 +215,12 @@ var childMatchTests = []struct {
 	{"/foo/*/baz", "/bar/baz", false},
 	{"/**/*", "/foo", true},
 	{"/**/bar", "/foo/bar", true},
+	{"/foo/b**z", "/foo", true},
+	{"/foo/b**z", "/foo/bar/baz", true},
+	{"/foo/b**z", "/bar", false},
+	{"/foo/b**z/x", "/foo/bar", true},
+	{"/foo/[!a]*/x", "/foo/bar", true},
+	{"/foo/[!a]*/x", "/foo/abc", false},
 }
 
 func testchildpattern(t *testing.T, pattern, path string, shouldMatch bool) {
@@ -306,6 +344,205 @@ func TestList(t *testing.T) {
 	}
 }
 
+// gitignoreTests contains the examples from the gitignore documentation.
+// Paths are relative to the directory containing the exclude file, so
+// patterns containing a slash are prefixed with "/". Unlike gitignore, a
+// pattern with a slash also matches the contents of a matching directory.
+var gitignoreTests = []struct {
+	patterns []string
+	path     string
+	match    bool
+}{
+	// "**/foo" matches file or directory "foo" anywhere
+	{[]string{"**/foo"}, "/foo", true},
+	{[]string{"**/foo"}, "/a/b/foo", true},
+	{[]string{"**/foo"}, "/a/b/foobar", false},
+	// "**/foo/bar" matches "bar" anywhere directly under a directory "foo"
+	{[]string{"**/foo/bar"}, "/a/foo/bar", true},
+	{[]string{"**/foo/bar"}, "/foo/bar", true},
+	{[]string{"**/foo/bar"}, "/a/foo/x/bar", false},
+	// "abc/**" matches everything inside "abc"
+	{[]string{"/abc/**"}, "/abc/x", true},
+	{[]string{"/abc/**"}, "/abc/x/y/z", true},
+	{[]string{"/abc/**"}, "/xabc/x", false},
+	// "a/**/b" matches zero or more directories in between
+	{[]string{"/a/**/b"}, "/a/b", true},
+	{[]string{"/a/**/b"}, "/a/x/b", true},
+	{[]string{"/a/**/b"}, "/a/x/y/b", true},
+	{[]string{"/a/**/b"}, "/a/x/y/c", false},
+	// "**/node_modules" excludes all node_modules directories
+	{[]string{"**/node_modules"}, "/project/node_modules", true},
+	{[]string{"**/node_modules"}, "/project/node_modules/pkg/index.js", true},
+	{[]string{"**/node_modules"}, "/project/src/index.js", false},
+	// "*" does not match a slash
+	{[]string{"/doc/*.txt"}, "/doc/notes.txt", true},
+	{[]string{"/doc/*.txt"}, "/doc/server/arch.txt", false},
+	// negated patterns re-include paths, the last matching pattern wins
+	{[]string{"*.log", "!important.log"}, "/a/debug.log", true},
+	{[]string{"*.log", "!important.log"}, "/a/important.log", false},
+	{[]string{"*.log", "!important.log", "important.log"}, "/a/important.log", true},
+	{[]string{"!important.log", "*.log"}, "/a/important.log", true},
+	{[]string{"/foo/*", "!/foo/bar"}, "/foo/bar", false},
+	{[]string{"/foo/*", "!/foo/bar"}, "/foo/baz", true},
+	{[]string{"/*", "!/foo", "/foo/*", "!/foo/bar"}, "/foo/bar", false},
+	{[]string{"/*", "!/foo", "/foo/*", "!/foo/bar"}, "/foo/baz", true},
+	{[]string{"/*", "!/foo", "/foo/*", "!/foo/bar"}, "/other", true},
+	// a backslash escapes a leading "!"
+	{[]string{"\\!important!.txt"}, "/!important!.txt", true},
+	{[]string{"\\!important!.txt"}, "/important!.txt", false},
+	// character classes
+	{[]string{"[Cc]ache"}, "/home/Cache", true},
+	{[]string{"[Cc]ache"}, "/home/cache", true},
+	{[]string{"*.[oa]"}, "/build/main.o", true},
+	{[]string{"*.[oa]"}, "/build/lib.a", true},
+	{[]string{"*.[oa]"}, "/build/main.c", false},
+	{[]string{"*.[!oa]"}, "/build/main.c", true},
+	{[]string{"*.[!oa]"}, "/build/main.o", false},
+}
+
+func TestGitignoreExamples(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("backslash escapes are not supported on Windows")
+	}
+
+	for _, test := range gitignoreTests {
+		patterns := filter.ParsePatterns(test.patterns)
+		match, err := filter.List(patterns, test.path)
+		if err != nil {
+			t.Errorf("filter.List(%q, %q) returned error: %v", test.patterns, test.path, err)
+			continue
+		}
+
+		if match != test.match {
+			t.Errorf("filter.List(%q, %q): expected %v, got %v",
+				test.patterns, test.path, test.match, match)
+		}
+	}
+}
+
+var insensitiveListTests = []struct {
+	patterns   []string
+	path       string
+	match      bool
+	childMatch bool
+}{
+	{[]string{"*.jpg"}, "/home/user/Photo.JPG", true, true},
+	{[]string{"*.JPG"}, "/home/user/photo.jpg", true, true},
+	{[]string{"/HOME/User/photos"}, "/home/USER/Photos/img.png", true, true},
+	{[]string{"/home/user/photos"}, "/HOME", false, true},
+	{[]string{"/home/user/photos"}, "/home/other", false, false},
+	{[]string{"*.jpg", "!/home/user/private"}, "/home/USER/Private/a.JPG", false, false},
+	{[]string{"/data/**/Cache"}, "/DATA/x/y/cache/file", true, true},
+	{[]string{"[a-c]*.txt"}, "/B.TXT", true, true},
+	{[]string{"[!a-c]*.txt"}, "/B.TXT", false, true},
+	// Unicode case folding
+	{[]string{"/ÄRGER"}, "/ärger", true, true},
+	{[]string{"/straße"}, "/STRAẞE", true, true},
+	{[]string{"/kelvin"}, "/\u212aELVIN", true, true},
+	{[]string{"/σίσυφος"}, "/ΣΊΣΥΦΟΣ", true, true},
+}
+
+func TestListInsensitive(t *testing.T) {
+	for i, test := range insensitiveListTests {
+		patterns := filter.ParseInsensitivePatterns(test.patterns)
+		match, childMatch, err := filter.ListWithChild(patterns, test.path)
+		if err != nil {
+			t.Errorf("test %d failed: expected no error for patterns %q, but error returned: %v",
+				i, test.patterns, err)
+			continue
+		}
+
+		if match != test.match || childMatch != test.childMatch {
+			t.Errorf("test %d: filter.ListWithChild(%q, %q): expected %v, %v, got %v, %v",
+				i, test.patterns, test.path, test.match, test.childMatch, match, childMatch)
+		}
+
+		// the case sensitive patterns must only match if the case is equal
+		match, err = filter.List(filter.ParsePatterns(test.patterns), test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if match && test.match != match {
+			t.Errorf("test %d: filter.List(%q, %q) matched case sensitively", i, test.patterns, test.path)
+		}
+	}
+}
+
+func TestListMixedCaseSensitivity(t *testing.T) {
+	patterns := append(filter.ParsePatterns([]string{"*.txt"}), filter.ParseInsensitivePatterns([]string{"!/Secret"})...)
+
+	for _, test := range []struct {
+		path  string
+		match bool
+	}{
+		{"/notes.txt", true},
+		{"/NOTES.TXT", false},
+		{"/secret/notes.txt", false},
+		{"/SECRET/notes.txt", false},
+	} {
+		match, pattern, err := filter.ListMatch(patterns, test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if match != test.match {
+			t.Errorf("filter.ListMatch(%q): expected %v, got %v (%q)", test.path, test.match, match, pattern)
+		}
+	}
+}
+
+func TestMatchInsensitive(t *testing.T) {
+	for _, test := range []struct {
+		pattern, path     string
+		match, childMatch bool
+	}{
+		{"*.Go", "/foo/BAR/test.gO", true, true},
+		{"/FOO/bar", "/foo", false, true},
+		{"/FOO/bar", "/baz", false, false},
+		{"/foo/**/ÖL", "/Foo/a/b/öl", true, true},
+	} {
+		match, err := filter.MatchInsensitive(test.pattern, test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		childMatch, err := filter.ChildMatchInsensitive(test.pattern, test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if match != test.match || childMatch != test.childMatch {
+			t.Errorf("pattern %q, path %q: expected %v, %v, got %v, %v",
+				test.pattern, test.path, test.match, test.childMatch, match, childMatch)
+		}
+	}
+}
+
+func TestListMatch(t *testing.T) {
+	var tests = []struct {
+		patterns []string
+		path     string
+		pattern  string
+	}{
+		{[]string{"*.go"}, "/foo/bar/test.go", "*.go"},
+		{[]string{"*.c", "*.go"}, "/foo/bar/test.go", "*.go"},
+		{[]string{"bar", "*.go"}, "/foo/bar/test.go", "bar"},
+		{[]string{"*.c"}, "/foo/bar/test.go", ""},
+		{[]string{"*.go", "!test.go"}, "/foo/bar/test.go", ""},
+		{[]string{"*", "!*.go", "/foo/bar"}, "/foo/bar/test.go", "/foo/bar"},
+	}
+
+	for _, test := range tests {
+		patterns := filter.ParsePatterns(test.patterns)
+		match, pattern, err := filter.ListMatch(patterns, test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if match != (test.pattern != "") || pattern != test.pattern {
+			t.Errorf("filter.ListMatch(%q, %q): expected %q, got %v, %q",
+				test.patterns, test.path, test.pattern, match, pattern)
+		}
+	}
+}
+
 func ExampleList() {
 	patterns := filter.ParsePatterns([]string{"*.c", "*.go"})
 	match, _ := filter.List(patterns, "/home/user/file.go")
@@ -0,0 +1,154 @@
+package filter
+
+import (
+	"bufio"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// ignorePattern is a pattern read from an ignore file.
+type ignorePattern struct {
+	Pattern
+	// dirOnly is set for patterns with a trailing slash, which only match
+	// directories.
+	dirOnly bool
+}
+
+// Scope contains the patterns of the ignore files of a directory and all its
+// parent directories. Patterns in an ignore file are relative to the
+// directory containing it and follow the semantics of .gitignore files:
+//
+//   - blank lines and lines starting with "#" are ignored
+//   - a leading "!" negates the pattern, a path is then included again; use
+//     "\#" or "\!" for patterns starting with these characters
+//   - a trailing "/" restricts the pattern to directories
+//   - a pattern containing a "/" at the beginning or in the middle is
+//     anchored at the directory of the ignore file, otherwise it matches at
+//     any depth below it
+//
+// The last matching pattern decides whether a path is ignored, patterns of
+// ignore files in subdirectories take precedence over those in parent
+// directories. As with .gitignore, a path cannot be included again once one
+// of its parent directories is ignored, as the directory is not walked at
+// all. A Scope is never modified, so it can be shared between goroutines.
+type Scope struct {
+	parent   *Scope
+	dir      string
+	name     string
+	patterns []ignorePattern
+}
+
+// Push returns a new scope for dir, which must be located within the
+// directory of s, containing the patterns read from rd. name is used to
+// describe the ignore file in the result of Match. s may be nil.
+func (s *Scope) Push(dir, name string, rd io.Reader) (*Scope, error) {
+	var lines []string
+	sc := bufio.NewScanner(rd)
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	child := &Scope{parent: s, dir: dir, name: name}
+	var invalid []string
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		negate := false
+		switch {
+		case line[0] == '!':
+			negate = true
+			line = line[1:]
+		case strings.HasPrefix(line, `\#`), strings.HasPrefix(line, `\!`):
+			// escaped leading "#" or "!"
+			line = line[1:]
+		}
+
+		dirOnly := strings.HasSuffix(line, "/")
+		line = strings.TrimRight(line, "/")
+		if line == "" {
+			continue
+		}
+
+		var pattern string
+		if strings.Contains(line, "/") {
+			pattern = filepath.Join(dir, filepath.FromSlash(line))
+		} else {
+			pattern = filepath.Join(dir, "**", line)
+		}
+		if err := ValidatePatterns([]string{pattern}); err != nil {
+			invalid = append(invalid, line)
+			continue
+		}
+
+		p := preparePattern(pattern, false)
+		p.isNegated = negate
+		p.original = line
+		if negate {
+			p.original = "!" + line
+		}
+		child.patterns = append(child.patterns, ignorePattern{Pattern: p, dirOnly: dirOnly})
+	}
+
+	if len(invalid) > 0 {
+		return child, &InvalidPatternError{InvalidPatterns: invalid}
+	}
+	return child, nil
+}
+
+// Parent returns the scope of the parent directory, or nil.
+func (s *Scope) Parent() *Scope {
+	if s == nil {
+		return nil
+	}
+	return s.parent
+}
+
+// Dir returns the directory of the scope.
+func (s *Scope) Dir() string {
+	return s.dir
+}
+
+// Match returns true if path is ignored according to the patterns of s and
+// its parents. If path is ignored, the name of the ignore file and the
+// pattern which caused the match are returned as well.
+func (s *Scope) Match(path string, isDir bool) (ignored bool, ignoreFile string, pattern string, err error) {
+	if s == nil {
+		return false, "", "", nil
+	}
+
+	strs, err := prepareStr(path, false)
+	if err != nil {
+		return false, "", "", err
+	}
+
+	// check the innermost scope first, its last matching pattern wins
+	for scope := s; scope != nil; scope = scope.parent {
+		for i := len(scope.patterns) - 1; i >= 0; i-- {
+			p := scope.patterns[i]
+			if p.dirOnly && !isDir {
+				continue
+			}
+
+			m, err := match(p.Pattern, strs)
+			if err != nil {
+				return false, "", "", err
+			}
+			if !m {
+				continue
+			}
+
+			if p.isNegated {
+				return false, "", "", nil
+			}
+			return true, filepath.Join(scope.dir, scope.name), p.original, nil
+		}
+	}
+	return false, "", "", nil
+}
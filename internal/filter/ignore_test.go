@@ -0,0 +1,88 @@
+package filter_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/filter"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func pushScope(t testing.TB, parent *filter.Scope, dir string, lines ...string) *filter.Scope {
+	scope, err := parent.Push(filepath.FromSlash(dir), ".resticignore", strings.NewReader(strings.Join(lines, "\n")))
+	rtest.OK(t, err)
+	return scope
+}
+
+func TestScopeMatch(t *testing.T) {
+	root := pushScope(t, nil, "/data",
+		"# comment",
+		"",
+		"*.log",
+		"!important.log",
+		"build/",
+		"/cache",
+		"docs/*.tmp",
+		`\#hash`,
+	)
+	// the nested ignore file overrides the one of its parent directory
+	sub := pushScope(t, root, "/data/project",
+		"!*.log",
+		"debug.log",
+		"*.bin",
+	)
+	nested := pushScope(t, sub, "/data/project/vendor", "!keep.bin")
+
+	for _, test := range []struct {
+		scope   *filter.Scope
+		path    string
+		isDir   bool
+		ignored bool
+		pattern string
+	}{
+		{root, "/data/app.log", false, true, "*.log"},
+		{root, "/data/x/y/app.log", false, true, "*.log"},
+		{root, "/data/x/important.log", false, false, ""},
+		{root, "/data/build", true, true, "build"},
+		{root, "/data/x/build", true, true, "build"},
+		// only directories match patterns with a trailing slash
+		{root, "/data/build", false, false, ""},
+		{root, "/data/cache", true, true, "/cache"},
+		// anchored patterns only match relative to the ignore file
+		{root, "/data/x/cache", true, false, ""},
+		{root, "/data/docs/a.tmp", false, true, "docs/*.tmp"},
+		{root, "/data/x/docs/a.tmp", false, false, ""},
+		{root, "/data/#hash", false, true, "#hash"},
+		{root, "/other/app.log", false, false, ""},
+
+		{sub, "/data/project/app.log", false, false, ""},
+		{sub, "/data/project/debug.log", false, true, "debug.log"},
+		{sub, "/data/project/a.bin", false, true, "*.bin"},
+		// patterns of the parent directory still apply if not overridden
+		{sub, "/data/project/build", true, true, "build"},
+		{sub, "/data/app.log", false, true, "*.log"},
+
+		{nested, "/data/project/vendor/keep.bin", false, false, ""},
+		{nested, "/data/project/vendor/other.bin", false, true, "*.bin"},
+		{nested.Parent(), "/data/project/vendor/keep.bin", false, true, "*.bin"},
+		{nil, "/data/app.log", false, false, ""},
+	} {
+		ignored, file, pattern, err := test.scope.Match(filepath.FromSlash(test.path), test.isDir)
+		rtest.OK(t, err)
+		rtest.Assert(t, ignored == test.ignored, "%v: expected ignored %v, got %v", test.path, test.ignored, ignored)
+		rtest.Equals(t, test.pattern, pattern)
+		if ignored {
+			rtest.Assert(t, strings.HasSuffix(file, ".resticignore"), "%v: unexpected ignore file %q", test.path, file)
+		}
+	}
+}
+
+func TestScopeInvalidPattern(t *testing.T) {
+	scope, err := (*filter.Scope)(nil).Push(filepath.FromSlash("/data"), ".resticignore", strings.NewReader("*.log\n[invalid\n"))
+	rtest.Assert(t, err != nil, "missing error for invalid pattern")
+	// the valid patterns are still used
+	ignored, _, _, err := scope.Match(filepath.FromSlash("/data/a.log"), false)
+	rtest.OK(t, err)
+	rtest.Assert(t, ignored, "valid pattern was not used")
+}
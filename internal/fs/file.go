@@ -6,6 +6,14 @@ import (
 	"time"
 )
 
+// FixPath returns the path which must be passed to the operating system to
+// access name. On Windows, this is the absolute path with the extended-length
+// prefix \\?\, such that paths longer than 260 characters can be accessed.
+// On all other platforms, name is returned unchanged.
+func FixPath(name string) string {
+	return fixpath(name)
+}
+
 // Mkdir creates a new directory with the specified name and permission bits.
 // If there is an error, it will be of type *PathError.
 func Mkdir(name string, perm os.FileMode) error {
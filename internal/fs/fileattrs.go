@@ -0,0 +1,18 @@
+package fs
+
+// Windows file attributes as returned by FileAttributes. The values are the
+// same as the FILE_ATTRIBUTE_* constants of the Windows API.
+const (
+	FileAttributeReadonly           uint32 = 0x00000001
+	FileAttributeHidden             uint32 = 0x00000002
+	FileAttributeSystem             uint32 = 0x00000004
+	FileAttributeArchive            uint32 = 0x00000020
+	FileAttributeTemporary          uint32 = 0x00000100
+	FileAttributeSparseFile         uint32 = 0x00000200
+	FileAttributeCompressed         uint32 = 0x00000800
+	FileAttributeOffline            uint32 = 0x00001000
+	FileAttributeNotContentIndexed  uint32 = 0x00002000
+	FileAttributeEncrypted          uint32 = 0x00004000
+	FileAttributeRecallOnOpen       uint32 = 0x00040000
+	FileAttributeRecallOnDataAccess uint32 = 0x00400000
+)
@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package fs
+
+import "os"
+
+// FileAttributesSupported is true if FileAttributes can read the file
+// attributes on this platform.
+const FileAttributesSupported = false
+
+// FileAttributes always returns zero, only Windows has file attributes.
+func FileAttributes(os.FileInfo) uint32 {
+	return 0
+}
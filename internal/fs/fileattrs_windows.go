@@ -0,0 +1,23 @@
+//go:build windows
+// +build windows
+
+package fs
+
+import (
+	"os"
+	"syscall"
+)
+
+// FileAttributesSupported is true if FileAttributes can read the file
+// attributes on this platform.
+const FileAttributesSupported = true
+
+// FileAttributes returns the Windows file attributes of the file described by
+// fi.
+func FileAttributes(fi os.FileInfo) uint32 {
+	s, ok := fi.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return 0
+	}
+	return s.FileAttributes
+}
@@ -41,8 +41,7 @@ func (fs *Reader) VolumeName(_ string) string {
 
 // Open opens a file for reading.
 func (fs *Reader) Open(name string) (f File, err error) {
-	switch name {
-	case fs.Name:
+	if name == fs.Name {
 		fs.open.Do(func() {
 			f = newReaderFile(fs.ReadCloser, fs.fi(), fs.AllowEmptyFile)
 		})
@@ -52,9 +51,15 @@ func (fs *Reader) Open(name string) (f File, err error) {
 		}
 
 		return f, nil
-	case "/", ".":
+	}
+
+	if entry, ok := fs.dirEntry(name); ok {
 		f = fakeDir{
-			entries: []os.FileInfo{fs.fi()},
+			entries: []os.FileInfo{entry},
+			fakeFile: fakeFile{
+				FileInfo: fs.dirInfo(name),
+				name:     name,
+			},
 		}
 		return f, nil
 	}
@@ -64,13 +69,49 @@ func (fs *Reader) Open(name string) (f File, err error) {
 
 func (fs *Reader) fi() os.FileInfo {
 	return fakeFileInfo{
-		name:    fs.Name,
+		name:    fs.Base(fs.Name),
 		size:    fs.Size,
 		mode:    fs.Mode,
 		modtime: fs.ModTime,
 	}
 }
 
+// dirInfo returns the FileInfo for the directory name. Directories use the
+// modification time of the file, so that backing up the same file name at the
+// same time always results in the same directory nodes.
+func (fs *Reader) dirInfo(name string) os.FileInfo {
+	return fakeFileInfo{
+		name:    fs.Base(name),
+		size:    0,
+		mode:    os.ModeDir | 0755,
+		modtime: fs.ModTime,
+	}
+}
+
+// dirEntry returns the single entry within the directory name, which is
+// either the file itself or the next directory on the path to it. It returns
+// false if name is not a directory containing the file.
+func (fs *Reader) dirEntry(name string) (os.FileInfo, bool) {
+	isRoot := func(p string) bool {
+		return p == "/" || p == "."
+	}
+
+	child := fs.Name
+	for {
+		dir := fs.Dir(child)
+		if dir == name || (isRoot(dir) && isRoot(name)) {
+			if child == fs.Name {
+				return fs.fi(), true
+			}
+			return fs.dirInfo(child), true
+		}
+		if isRoot(dir) {
+			return nil, false
+		}
+		child = dir
+	}
+}
+
 // OpenFile is the generalized open call; most users will use Open
 // or Create instead.  It opens the named file with specified flag
 // (O_RDONLY etc.) and perm, (0666 etc.) if applicable.  If successful,
@@ -104,32 +145,12 @@ func (fs *Reader) Stat(name string) (os.FileInfo, error) {
 // describes the symbolic link.  Lstat makes no attempt to follow the link.
 // If there is an error, it will be of type *os.PathError.
 func (fs *Reader) Lstat(name string) (os.FileInfo, error) {
-	getDirInfo := func(name string) os.FileInfo {
-		fi := fakeFileInfo{
-			name:    fs.Base(name),
-			size:    0,
-			mode:    os.ModeDir | 0755,
-			modtime: time.Now(),
-		}
-		return fi
-	}
-
-	switch name {
-	case fs.Name:
+	if name == fs.Name {
 		return fs.fi(), nil
-	case "/", ".":
-		return getDirInfo(name), nil
 	}
 
-	dir := fs.Dir(fs.Name)
-	for {
-		if dir == "/" || dir == "." {
-			break
-		}
-		if name == dir {
-			return getDirInfo(name), nil
-		}
-		dir = fs.Dir(dir)
+	if _, ok := fs.dirEntry(name); ok {
+		return fs.dirInfo(name), nil
 	}
 
 	return nil, pathError("lstat", name, os.ErrNotExist)
@@ -363,6 +363,7 @@ func TestFSReaderDir(t *testing.T) {
 				ModTime: now,
 			}
 
+			child := fs.Name
 			dir := path.Dir(fs.Name)
 			for {
 				if dir == "/" || dir == "." {
@@ -374,8 +375,22 @@ func TestFSReaderDir(t *testing.T) {
 					t.Fatal(err)
 				}
 
-				checkFileInfo(t, fi, dir, time.Time{}, os.ModeDir|0755, true)
+				checkFileInfo(t, fi, dir, now, os.ModeDir|0755, true)
 
+				f, err := fs.Open(dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				entries, err := f.Readdirnames(-1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(entries) != 1 || path.Join(dir, entries[0]) != child {
+					t.Errorf("wrong entries for %v, want %v, got %v", dir, path.Base(child), entries)
+				}
+
+				child = dir
 				dir = path.Dir(dir)
 			}
 		})
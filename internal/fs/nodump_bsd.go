@@ -0,0 +1,23 @@
+//go:build freebsd || darwin || netbsd
+// +build freebsd darwin netbsd
+
+package fs
+
+import (
+	"os"
+	"syscall"
+)
+
+// ufNoDump is the UF_NODUMP file flag, which has the same value on all BSDs
+// and macOS.
+const ufNoDump = 0x00000001
+
+// NoDumpSupported is true if NoDump can read the nodump flag on this platform.
+const NoDumpSupported = true
+
+// NoDump returns true if the nodump file flag is set for the file described
+// by fi.
+func NoDump(fi os.FileInfo) bool {
+	s, ok := fi.Sys().(*syscall.Stat_t)
+	return ok && s.Flags&ufNoDump != 0
+}
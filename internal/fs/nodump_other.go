@@ -0,0 +1,14 @@
+//go:build !freebsd && !darwin && !netbsd
+// +build !freebsd,!darwin,!netbsd
+
+package fs
+
+import "os"
+
+// NoDumpSupported is true if NoDump can read the nodump flag on this platform.
+const NoDumpSupported = false
+
+// NoDump always returns false, this platform has no nodump file flag.
+func NoDump(os.FileInfo) bool {
+	return false
+}
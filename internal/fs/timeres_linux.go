@@ -0,0 +1,38 @@
+package fs
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Magic numbers of file systems with coarse timestamps, see statfs(2).
+const (
+	msdosSuperMagic = 0x4d44
+	exfatSuperMagic = 0x2011bab0
+	smbSuperMagic   = 0x517b
+	smb2SuperMagic  = 0xfe534d42
+	cifsSuperMagic  = 0xff534d42
+)
+
+// TimeResolution returns the resolution of the timestamps of files on the
+// file system which contains path. Zero is returned if the timestamps are
+// precise or the file system is unknown.
+func TimeResolution(path string) time.Duration {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return 0
+	}
+
+	switch uint32(st.Type) {
+	case msdosSuperMagic:
+		return 2 * time.Second
+	case exfatSuperMagic:
+		return 10 * time.Millisecond
+	case smbSuperMagic, smb2SuperMagic, cifsSuperMagic:
+		// the server may store the files on FAT, which truncates timestamps
+		// to two seconds
+		return 2 * time.Second
+	}
+	return 0
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package fs
+
+import "time"
+
+// TimeResolution returns the resolution of the timestamps of files on the
+// file system which contains path. Detecting the file system is not supported
+// on this platform, zero is returned.
+func TimeResolution(string) time.Duration {
+	return 0
+}
@@ -0,0 +1,239 @@
+//go:build darwin || freebsd || linux
+// +build darwin freebsd linux
+
+package fuse
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"sync"
+	"syscall"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/walker"
+
+	"github.com/anacrolix/fuse"
+	"github.com/anacrolix/fuse/fs"
+)
+
+// deletedSuffix is appended to the name of the marker files which represent
+// removed entries.
+const deletedSuffix = ".deleted"
+
+// diffEntry is an entry in the directory tree containing the differences
+// between two snapshots.
+type diffEntry struct {
+	// node is the entry in the newer snapshot, it is nil if the entry was
+	// removed.
+	node *restic.Node
+	// children is set for directories contained in both snapshots, it only
+	// holds the entries which differ.
+	children map[string]*diffEntry
+}
+
+// buildDiffTree returns the entries which differ between the trees id1 and
+// id2. Added and modified entries are represented by their version in id2,
+// removed entries by a marker named after the entry with deletedSuffix.
+// Changes of the metadata only are ignored.
+func buildDiffTree(ctx context.Context, repo restic.BlobLoader, id1, id2 restic.ID) (map[string]*diffEntry, error) {
+	entries := make(map[string]*diffEntry)
+	err := walker.DiffTrees(ctx, repo, id1, id2, func(name string, node1, node2 *restic.Node) error {
+		name = cleanupNodeName(name)
+
+		switch {
+		case node2 == nil:
+			entries[name+deletedSuffix] = &diffEntry{}
+		case node1 == nil:
+			entries[name] = &diffEntry{node: node2}
+		case node1.Type == "dir" && node2.Type == "dir":
+			if node1.Subtree.Equal(*node2.Subtree) {
+				return nil
+			}
+			children, err := buildDiffTree(ctx, repo, *node1.Subtree, *node2.Subtree)
+			if err != nil {
+				return err
+			}
+			if len(children) > 0 {
+				entries[name] = &diffEntry{node: node2, children: children}
+			}
+		case nodeChanged(node1, node2):
+			entries[name] = &diffEntry{node: node2}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// nodeChanged returns true if the type or the content of a node differs.
+func nodeChanged(node1, node2 *restic.Node) bool {
+	if node1.Type != node2.Type {
+		return true
+	}
+
+	switch node1.Type {
+	case "file":
+		return !reflect.DeepEqual(node1.Content, node2.Content)
+	case "symlink":
+		return node1.LinkTarget != node2.LinkTarget
+	}
+	return false
+}
+
+// snapshotDiff holds the differences between two consecutive snapshots, they
+// are computed on first access.
+type snapshotDiff struct {
+	older, newer *restic.Snapshot
+
+	m       sync.Mutex
+	entries map[string]*diffEntry
+}
+
+func (s *snapshotDiff) load(ctx context.Context, repo restic.BlobLoader) (map[string]*diffEntry, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.entries != nil {
+		return s.entries, nil
+	}
+
+	debug.Log("diff snapshots %v and %v", s.older.ID(), s.newer.ID())
+	entries, err := buildDiffTree(ctx, repo, *s.older.Tree, *s.newer.Tree)
+	if err != nil {
+		return nil, unwrapCtxCanceled(err)
+	}
+	s.entries = entries
+	return entries, nil
+}
+
+// Statically ensure that *diffDir implement those interface
+var _ = fs.HandleReadDirAller(&diffDir{})
+var _ = fs.NodeStringLookuper(&diffDir{})
+
+// diffDir is a directory which contains the entries of a directory which
+// differ between two snapshots.
+type diffDir struct {
+	root        *Root
+	inode       uint64
+	parentInode uint64
+	diff        *snapshotDiff
+
+	// entry is nil for the top-level directory, whose entries are loaded
+	// from diff
+	entry *diffEntry
+}
+
+func newDiffDir(root *Root, inode, parentInode uint64, diff *snapshotDiff, entry *diffEntry) *diffDir {
+	return &diffDir{
+		root:        root,
+		inode:       inode,
+		parentInode: parentInode,
+		diff:        diff,
+		entry:       entry,
+	}
+}
+
+func (d *diffDir) entries(ctx context.Context) (map[string]*diffEntry, error) {
+	if d.entry != nil {
+		return d.entry.children, nil
+	}
+	return d.diff.load(ctx, d.root.repo)
+}
+
+func (d *diffDir) Attr(_ context.Context, a *fuse.Attr) error {
+	a.Inode = d.inode
+	a.Mode = os.ModeDir | 0555
+	a.Uid = d.root.uid
+	a.Gid = d.root.gid
+	a.Atime = d.diff.newer.Time
+	a.Ctime = d.diff.newer.Time
+	a.Mtime = d.diff.newer.Time
+
+	if d.entry != nil {
+		node := d.entry.node
+		a.Mode = os.ModeDir | node.Mode
+		if !d.root.cfg.OwnerIsRoot {
+			a.Uid = node.UID
+			a.Gid = node.GID
+		}
+		a.Atime = node.AccessTime
+		a.Ctime = node.ChangeTime
+		a.Mtime = node.ModTime
+	}
+	a.Nlink = 2
+
+	return nil
+}
+
+func (d *diffDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	debug.Log("ReadDirAll()")
+	entries, err := d.entries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]fuse.Dirent, 0, len(entries)+2)
+	ret = append(ret, fuse.Dirent{
+		Inode: d.inode,
+		Name:  ".",
+		Type:  fuse.DT_Dir,
+	})
+	ret = append(ret, fuse.Dirent{
+		Inode: d.parentInode,
+		Name:  "..",
+		Type:  fuse.DT_Dir,
+	})
+
+	for name, entry := range entries {
+		dirent := fuse.Dirent{
+			Inode: inodeFromName(d.inode, name),
+			Name:  name,
+			Type:  fuse.DT_File,
+		}
+		if entry.node != nil {
+			dirent.Inode = inodeFromNode(d.inode, entry.node)
+			dirent.Type = direntType(entry.node)
+		}
+		ret = append(ret, dirent)
+	}
+
+	return ret, nil
+}
+
+func (d *diffDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	debug.Log("Lookup(%v)", name)
+	entries, err := d.entries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, ok := entries[name]
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+
+	switch {
+	case entry.node == nil:
+		// the marker for a removed entry is an empty file
+		marker := &restic.Node{
+			Name:       name,
+			Type:       "file",
+			Mode:       0444,
+			AccessTime: d.diff.newer.Time,
+			ModTime:    d.diff.newer.Time,
+			ChangeTime: d.diff.newer.Time,
+			UID:        d.root.uid,
+			GID:        d.root.gid,
+			Links:      1,
+		}
+		return newFile(d.root, inodeFromName(d.inode, name), marker)
+	case entry.children != nil:
+		return newDiffDir(d.root, inodeFromNode(d.inode, entry.node), d.inode, d.diff, entry), nil
+	default:
+		return newNode(d.root, inodeFromNode(d.inode, entry.node), d.inode, entry.node)
+	}
+}
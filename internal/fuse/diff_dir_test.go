@@ -0,0 +1,145 @@
+//go:build darwin || freebsd || linux
+// +build darwin freebsd linux
+
+package fuse
+
+import (
+	"context"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+	"golang.org/x/sync/errgroup"
+)
+
+func saveTestTree(t testing.TB, repo restic.Repository, nodes ...*restic.Node) restic.ID {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wg, wgCtx := errgroup.WithContext(ctx)
+	repo.StartPackUploader(wgCtx, wg)
+
+	id, err := restic.SaveTree(ctx, repo, &restic.Tree{Nodes: nodes})
+	rtest.OK(t, err)
+	rtest.OK(t, repo.Flush(ctx))
+	return id
+}
+
+func testFileNode(name string, content ...restic.ID) *restic.Node {
+	return &restic.Node{Name: name, Type: "file", Mode: 0644, Content: content}
+}
+
+func testDirNode(name string, subtree restic.ID) *restic.Node {
+	return &restic.Node{Name: name, Type: "dir", Mode: os.ModeDir | 0755, Subtree: &subtree}
+}
+
+func diffEntryNames(entries map[string]*diffEntry) []string {
+	var names []string
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestBuildDiffTree(t *testing.T) {
+	repo := repository.TestRepository(t)
+	blob1, blob2 := restic.NewRandomID(), restic.NewRandomID()
+
+	unchanged := saveTestTree(t, repo, testFileNode("f", blob1))
+	sub1 := saveTestTree(t, repo, testFileNode("x", blob1), testFileNode("y", blob1))
+	sub2 := saveTestTree(t, repo, testFileNode("x", blob1), testFileNode("z", blob2))
+	// only the metadata of the file in this directory changes
+	meta1 := saveTestTree(t, repo, testFileNode("m", blob1))
+	metaNode := testFileNode("m", blob1)
+	metaNode.ModTime = time.Now()
+	meta2 := saveTestTree(t, repo, metaNode)
+
+	tree1 := saveTestTree(t, repo,
+		testFileNode("added-later", blob1),
+		testFileNode("modified", blob1),
+		testFileNode("removed", blob1),
+		testDirNode("dir", sub1),
+		testDirNode("meta", meta1),
+		testDirNode("removed-dir", sub1),
+		testDirNode("same", unchanged),
+	)
+	tree2 := saveTestTree(t, repo,
+		testFileNode("added", blob2),
+		testFileNode("modified", blob2),
+		testDirNode("dir", sub2),
+		testDirNode("meta", meta2),
+		testDirNode("same", unchanged),
+		&restic.Node{Name: "added-later", Type: "symlink", Mode: os.ModeSymlink | 0777, LinkTarget: "foo"},
+	)
+
+	entries, err := buildDiffTree(context.TODO(), repo, tree1, tree2)
+	rtest.OK(t, err)
+	rtest.Equals(t, []string{"added", "added-later", "dir", "modified", "removed-dir.deleted", "removed.deleted"}, diffEntryNames(entries))
+
+	rtest.Equals(t, "file", entries["added"].node.Type)
+	rtest.Equals(t, "symlink", entries["added-later"].node.Type)
+	rtest.Equals(t, restic.IDs{blob2}, entries["modified"].node.Content)
+	rtest.Assert(t, entries["removed.deleted"].node == nil, "removed file has a node")
+	rtest.Assert(t, entries["removed-dir.deleted"].node == nil, "removed dir has a node")
+
+	dir := entries["dir"]
+	rtest.Equals(t, sub2, *dir.node.Subtree)
+	rtest.Equals(t, []string{"y.deleted", "z"}, diffEntryNames(dir.children))
+	rtest.Equals(t, restic.IDs{blob2}, dir.children["z"].node.Content)
+
+	// the same trees do not differ
+	entries, err = buildDiffTree(context.TODO(), repo, tree1, tree1)
+	rtest.OK(t, err)
+	rtest.Equals(t, 0, len(entries))
+}
+
+func TestMakeDiffs(t *testing.T) {
+	sds := &SnapshotsDirStructure{
+		pathTemplates: []string{"ids/%i"},
+		timeTemplate:  time.RFC3339,
+		diffs:         true,
+	}
+
+	var snapshots restic.Snapshots
+	for i, host := range []string{"a", "b", "a", "a"} {
+		sn := &restic.Snapshot{Hostname: host, Paths: []string{"/home"}, Time: time.Unix(int64(i)*3600, 0)}
+		restic.TestSetSnapshotID(t, sn, restic.NewRandomID())
+		snapshots = append(snapshots, sn)
+	}
+	pairName := func(i, j int) string {
+		return snapshots[i].ID().Str() + "_" + snapshots[j].ID().Str()
+	}
+	sorted := func(names ...string) []string {
+		sort.Strings(names)
+		return names
+	}
+
+	sds.makeDirs(snapshots)
+	names := diffMetaNames(sds.entries["/diffs"])
+	rtest.Equals(t, sorted(pairName(0, 2), pairName(2, 3)), names)
+	diff := sds.entries["/diffs/"+pairName(0, 2)].diff
+	rtest.Equals(t, snapshots[0], diff.older)
+	rtest.Equals(t, snapshots[2], diff.newer)
+
+	// the differences are kept when the snapshots are updated
+	sn := &restic.Snapshot{Hostname: "b", Paths: []string{"/home"}, Time: time.Unix(5*3600, 0)}
+	restic.TestSetSnapshotID(t, sn, restic.NewRandomID())
+	snapshots = append(snapshots, sn)
+	sds.makeDirs(snapshots)
+	names = diffMetaNames(sds.entries["/diffs"])
+	rtest.Equals(t, sorted(pairName(0, 2), pairName(1, 4), pairName(2, 3)), names)
+	rtest.Assert(t, sds.entries["/diffs/"+pairName(0, 2)].diff == diff, "diff was not reused")
+}
+
+func diffMetaNames(meta *MetaDirData) []string {
+	var names []string
+	for name := range meta.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
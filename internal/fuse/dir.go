@@ -8,6 +8,7 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
+	"strconv"
 	"sync"
 	"syscall"
 
@@ -171,27 +172,29 @@ func (d *dir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
 	})
 
 	for _, node := range d.items {
-		name := cleanupNodeName(node.Name)
-		var typ fuse.DirentType
-		switch node.Type {
-		case "dir":
-			typ = fuse.DT_Dir
-		case "file":
-			typ = fuse.DT_File
-		case "symlink":
-			typ = fuse.DT_Link
-		}
-
 		ret = append(ret, fuse.Dirent{
 			Inode: inodeFromNode(d.inode, node),
-			Type:  typ,
-			Name:  name,
+			Type:  direntType(node),
+			Name:  cleanupNodeName(node.Name),
 		})
 	}
 
 	return ret, nil
 }
 
+// direntType returns the directory entry type for node.
+func direntType(node *restic.Node) fuse.DirentType {
+	switch node.Type {
+	case "dir":
+		return fuse.DT_Dir
+	case "file":
+		return fuse.DT_File
+	case "symlink":
+		return fuse.DT_Link
+	}
+	return fuse.DT_Unknown
+}
+
 func (d *dir) Lookup(ctx context.Context, name string) (fs.Node, error) {
 	debug.Log("Lookup(%v)", name)
 
@@ -205,27 +208,56 @@ func (d *dir) Lookup(ctx context.Context, name string) (fs.Node, error) {
 		debug.Log("  Lookup(%v) -> not found", name)
 		return nil, syscall.ENOENT
 	}
-	inode := inodeFromNode(d.inode, node)
+	return newNode(d.root, inodeFromNode(d.inode, node), d.inode, node)
+}
+
+// newNode returns the fuse node for node, which is contained in the directory
+// with inode parentInode.
+func newNode(root *Root, inode, parentInode uint64, node *restic.Node) (fs.Node, error) {
 	switch node.Type {
 	case "dir":
-		return newDir(d.root, inode, d.inode, node)
+		return newDir(root, inode, parentInode, node)
 	case "file":
-		return newFile(d.root, inode, node)
+		return newFile(root, inode, node)
 	case "symlink":
-		return newLink(d.root, inode, node)
+		return newLink(root, inode, node)
 	case "dev", "chardev", "fifo", "socket":
-		return newOther(d.root, inode, node)
+		return newOther(root, inode, node)
 	default:
-		debug.Log("  node %v has unknown type %v", name, node.Type)
+		debug.Log("  node %v has unknown type %v", node.Name, node.Type)
 		return nil, syscall.ENOENT
 	}
 }
 
+// sizeXattr is the name of the extended attribute which contains the total
+// size of all files below a directory. It is only available if the index
+// contains the statistics of the directory's tree.
+const sizeXattr = "user.restic.size"
+
+// totalSize returns the total size of the directory from the statistics in
+// the index, if available. This does not require loading the subtrees.
+func (d *dir) totalSize() (uint64, bool) {
+	if d.node.Subtree == nil {
+		return 0, false
+	}
+	stats, ok := d.root.repo.Index().LookupTreeStats(*d.node.Subtree)
+	return stats.Size, ok
+}
+
 func (d *dir) Listxattr(_ context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) error {
 	nodeToXattrList(d.node, req, resp)
+	if _, ok := d.totalSize(); ok {
+		resp.Append(sizeXattr)
+	}
 	return nil
 }
 
 func (d *dir) Getxattr(_ context.Context, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) error {
+	if req.Name == sizeXattr {
+		if size, ok := d.totalSize(); ok {
+			resp.Xattr = []byte(strconv.FormatUint(size, 10))
+			return nil
+		}
+	}
 	return nodeGetXattr(d.node, req, resp)
 }
@@ -8,6 +8,7 @@ import (
 	"context"
 	"math/rand"
 	"os"
+	"sort"
 	"strings"
 	"testing"
 	"time"
@@ -177,6 +178,46 @@ func TestFuseDir(t *testing.T) {
 	rtest.Equals(t, node.ModTime, attr.Mtime)
 }
 
+func TestFuseDirSizeXattr(t *testing.T) {
+	repo := repository.TestRepository(t)
+	root := &Root{repo: repo, blobCache: bloblru.New(blobCacheSize)}
+
+	withStats := restic.NewRandomID()
+	repo.Index().AddTreeStats(withStats, restic.TreeStats{Entries: 2, Nodes: 5, Size: 1234})
+
+	for _, test := range []struct {
+		subtree restic.ID
+		size    string
+	}{
+		{withStats, "1234"},
+		// the size is not available without statistics in the index
+		{restic.NewRandomID(), ""},
+	} {
+		subtree := test.subtree
+		node := &restic.Node{Name: "foo", Type: "dir", Mode: 0755, Subtree: &subtree}
+		d, err := newDir(root, inodeFromName(1, "foo"), inodeFromName(0, "parent"), node)
+		rtest.OK(t, err)
+
+		// the directory size is never the recursive size
+		attr := fuse.Attr{}
+		rtest.OK(t, d.Attr(context.TODO(), &attr))
+		rtest.Equals(t, uint64(0), attr.Size)
+
+		listResp := fuse.ListxattrResponse{}
+		rtest.OK(t, d.Listxattr(context.TODO(), &fuse.ListxattrRequest{}, &listResp))
+		getResp := fuse.GetxattrResponse{}
+		err = d.Getxattr(context.TODO(), &fuse.GetxattrRequest{Name: sizeXattr}, &getResp)
+		if test.size == "" {
+			rtest.Equals(t, 0, len(listResp.Xattr))
+			rtest.Equals(t, fuse.ErrNoXattr, err)
+		} else {
+			rtest.Equals(t, sizeXattr+"\x00", string(listResp.Xattr))
+			rtest.OK(t, err)
+			rtest.Equals(t, test.size, string(getResp.Xattr))
+		}
+	}
+}
+
 // Test top-level directories for their UID and GID.
 func TestTopUIDGID(t *testing.T) {
 	repo := repository.TestRepository(t)
@@ -217,6 +258,71 @@ func testTopUIDGID(t *testing.T, cfg Config, repo restic.Repository, uid, gid ui
 	rtest.Equals(t, uint32(0), attr.Gid)
 }
 
+func TestSnapshotRoot(t *testing.T) {
+	repo := repository.TestRepository(t)
+	sn := restic.TestCreateSnapshot(t, repo, time.Unix(1460289341, 207401672), 2)
+	ctx := context.Background()
+
+	// find a subdirectory of the snapshot
+	tree := loadTree(t, repo, *sn.Tree)
+	var subdir *restic.Node
+	for _, node := range tree.Nodes {
+		if node.Type == "dir" {
+			subdir = node
+			break
+		}
+	}
+	rtest.Assert(t, subdir != nil, "snapshot contains no directory")
+
+	for _, test := range []struct {
+		subfolder string
+		treeID    restic.ID
+	}{
+		{"", *sn.Tree},
+		{"/", *sn.Tree},
+		{"/" + subdir.Name, *subdir.Subtree},
+		{subdir.Name + "/", *subdir.Subtree},
+	} {
+		root, err := NewSnapshotRoot(ctx, repo, Config{}, sn, test.subfolder)
+		rtest.OK(t, err)
+
+		node, err := root.Root()
+		rtest.OK(t, err)
+		d, ok := node.(*dir)
+		rtest.Assert(t, ok, "root for subfolder %q is %T, not a directory", test.subfolder, node)
+
+		var attr fuse.Attr
+		rtest.OK(t, d.Attr(ctx, &attr))
+		rtest.Equals(t, uint64(rootInode), attr.Inode)
+		rtest.Equals(t, uint32(os.Getuid()), attr.Uid)
+
+		entries, err := d.ReadDirAll(ctx)
+		rtest.OK(t, err)
+		var names []string
+		for _, entry := range entries[2:] {
+			names = append(names, entry.Name)
+		}
+		var want []string
+		for _, node := range loadTree(t, repo, test.treeID).Nodes {
+			want = append(want, node.Name)
+		}
+		sort.Strings(names)
+		sort.Strings(want)
+		rtest.Equals(t, want, names)
+	}
+
+	for _, subfolder := range []string{"missing", "/" + subdir.Name + "/missing"} {
+		_, err := NewSnapshotRoot(ctx, repo, Config{}, sn, subfolder)
+		rtest.Assert(t, err != nil, "missing error for subfolder %q", subfolder)
+	}
+
+	// the repository root still serves the snapshot directories
+	node, err := NewRoot(repo, Config{}).Root()
+	rtest.OK(t, err)
+	_, ok := node.(*Root)
+	rtest.Assert(t, ok, "root is %T, not *Root", node)
+}
+
 // Test reporting of fuse.Attr.Blocks in multiples of 512.
 func TestBlocks(t *testing.T) {
 	root := &Root{}
@@ -4,6 +4,7 @@
 package fuse
 
 import (
+	"context"
 	"os"
 
 	"github.com/restic/restic/internal/bloblru"
@@ -19,6 +20,9 @@ type Config struct {
 	Filter        restic.SnapshotFilter
 	TimeTemplate  string
 	PathTemplates []string
+	// Diffs adds the diffs directory, which contains the differences between
+	// consecutive snapshots of the same host and paths.
+	Diffs bool
 }
 
 // Root is the root node of the fuse mount of a repository.
@@ -29,6 +33,10 @@ type Root struct {
 
 	*SnapshotsDir
 
+	// snapshotDir is served at the root of the mount instead of the
+	// snapshot directories, if set.
+	snapshotDir *dir
+
 	uid, gid uint32
 }
 
@@ -45,16 +53,7 @@ const blobCacheSize = 64 << 20
 func NewRoot(repo restic.Repository, cfg Config) *Root {
 	debug.Log("NewRoot(), config %v", cfg)
 
-	root := &Root{
-		repo:      repo,
-		cfg:       cfg,
-		blobCache: bloblru.New(blobCacheSize),
-	}
-
-	if !cfg.OwnerIsRoot {
-		root.uid = uint32(os.Getuid())
-		root.gid = uint32(os.Getgid())
-	}
+	root := newRoot(repo, cfg)
 
 	// set defaults, if PathTemplates is not set
 	if len(cfg.PathTemplates) == 0 {
@@ -66,13 +65,58 @@ func NewRoot(repo restic.Repository, cfg Config) *Root {
 		}
 	}
 
-	root.SnapshotsDir = NewSnapshotsDir(root, rootInode, rootInode, NewSnapshotsDirStructure(root, cfg.PathTemplates, cfg.TimeTemplate), "")
+	dirStruct := NewSnapshotsDirStructure(root, cfg.PathTemplates, cfg.TimeTemplate)
+	dirStruct.diffs = cfg.Diffs
+	root.SnapshotsDir = NewSnapshotsDir(root, rootInode, rootInode, dirStruct, "")
 
 	return root
 }
 
-// Root is just there to satisfy fs.Root, it returns itself.
+// NewSnapshotRoot initializes a root node which serves the directory
+// subfolder of the snapshot sn directly at the root of the mount. The
+// subfolder is resolved once when the root is created.
+func NewSnapshotRoot(ctx context.Context, repo restic.Repository, cfg Config, sn *restic.Snapshot, subfolder string) (*Root, error) {
+	debug.Log("NewSnapshotRoot(), snapshot %v, subfolder %q", sn.ID(), subfolder)
+
+	treeID, err := restic.FindTreeDirectory(ctx, repo, sn.Tree, subfolder)
+	if err != nil {
+		return nil, err
+	}
+
+	root := newRoot(repo, cfg)
+	d, err := newDirFromSnapshot(root, rootInode, sn)
+	if err != nil {
+		return nil, err
+	}
+	d.node.Subtree = treeID
+	// the mountpoint belongs to the user, as for the snapshot directories
+	d.node.UID, d.node.GID = root.uid, root.gid
+	root.snapshotDir = d
+
+	return root, nil
+}
+
+func newRoot(repo restic.Repository, cfg Config) *Root {
+	root := &Root{
+		repo:      repo,
+		cfg:       cfg,
+		blobCache: bloblru.New(blobCacheSize),
+	}
+
+	if !cfg.OwnerIsRoot {
+		root.uid = uint32(os.Getuid())
+		root.gid = uint32(os.Getgid())
+	}
+
+	return root
+}
+
+// Root is just there to satisfy fs.Root, it returns itself or the snapshot
+// directory served at the root of the mount.
 func (r *Root) Root() (fs.Node, error) {
 	debug.Log("Root()")
+	if r.snapshotDir != nil {
+		return r.snapshotDir, nil
+	}
 	return r, nil
 }
@@ -108,6 +108,8 @@ func (d *SnapshotsDir) Lookup(ctx context.Context, name string) (fs.Node, error)
 		inode := inodeFromName(d.inode, name)
 		if entry.linkTarget != "" {
 			return newSnapshotLink(d.root, inode, entry.linkTarget, entry.snapshot)
+		} else if entry.diff != nil {
+			return newDiffDir(d.root, inode, d.inode, entry.diff, nil), nil
 		} else if entry.snapshot != nil {
 			return newDirFromSnapshot(d.root, inode, entry.snapshot)
 		} else {
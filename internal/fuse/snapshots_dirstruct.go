@@ -23,6 +23,8 @@ type MetaDirData struct {
 	// set if this is a symlink or a snapshot mount point
 	linkTarget string
 	snapshot   *restic.Snapshot
+	// set if this directory contains the differences between two snapshots
+	diff *snapshotDiff
 	// names is set if this is a pseudo directory
 	names map[string]*MetaDirData
 }
@@ -35,12 +37,16 @@ type SnapshotsDirStructure struct {
 	root          *Root
 	pathTemplates []string
 	timeTemplate  string
+	// diffs enables the diffs directory
+	diffs bool
 
 	mutex sync.Mutex
 	// "" is the root path, subdirectory paths are assembled as parent+"/"+childFn
 	// thus all subdirectories are prefixed with a slash as the root is ""
 	// that way we don't need path processing special cases when using the entries tree
 	entries map[string]*MetaDirData
+	// diffCache keeps the differences between snapshots across updates
+	diffCache map[string]*snapshotDiff
 
 	hash      [sha256.Size]byte // Hash at last check.
 	lastCheck time.Time
@@ -214,6 +220,7 @@ func (d *SnapshotsDirStructure) makeDirs(snapshots restic.Snapshots) {
 	type mountData struct {
 		sn         *restic.Snapshot
 		linkTarget string // if linkTarget!= "", this is a symlink
+		diff       *snapshotDiff
 		childFn    string
 		child      *MetaDirData
 	}
@@ -228,6 +235,8 @@ func (d *SnapshotsDirStructure) makeDirs(snapshots restic.Snapshots) {
 		if data.sn != nil {
 			e.snapshot = data.sn
 			e.linkTarget = data.linkTarget
+		} else if data.diff != nil {
+			e.diff = data.diff
 		} else {
 			// intermediate directory, register as a child directory
 			if e.names == nil {
@@ -281,9 +290,49 @@ func (d *SnapshotsDirStructure) makeDirs(snapshots restic.Snapshots) {
 		}
 	}
 
+	if d.diffs {
+		mount("/diffs", mountData{})
+		d.diffCache = d.makeDiffs(snapshots, func(name string, diff *snapshotDiff) {
+			mount("/diffs/"+name, mountData{diff: diff})
+		})
+	}
+
 	d.entries = entries
 }
 
+// makeDiffs calls fn for each pair of consecutive snapshots with the same
+// hostname and paths. snapshots must be sorted by time. The differences
+// computed for a pair are reused for later updates. The returned map contains
+// all pairs by name.
+func (d *SnapshotsDirStructure) makeDiffs(snapshots restic.Snapshots, fn func(name string, diff *snapshotDiff)) map[string]*snapshotDiff {
+	groupBy := restic.SnapshotGroupByOptions{Host: true, Path: true}
+	diffs := make(map[string]*snapshotDiff)
+	last := make(map[string]*restic.Snapshot)
+
+	for _, sn := range snapshots {
+		key, err := groupBy.Key(sn)
+		if err != nil {
+			debug.Log("unable to group snapshot %v: %v", sn.ID(), err)
+			continue
+		}
+
+		older := last[key]
+		last[key] = sn
+		if older == nil {
+			continue
+		}
+
+		name := older.ID().Str() + "_" + sn.ID().Str()
+		diff := d.diffCache[name]
+		if diff == nil {
+			diff = &snapshotDiff{older: older, newer: sn}
+		}
+		diffs[name] = diff
+		fn(name, diff)
+	}
+	return diffs
+}
+
 const minSnapshotsReloadTime = 60 * time.Second
 
 // update snapshots if repository has changed
@@ -6,6 +6,7 @@ import (
 	"io"
 	"sync"
 	"time"
+	"unsafe"
 
 	"github.com/restic/restic/internal/crypto"
 	"github.com/restic/restic/internal/errors"
@@ -47,6 +48,10 @@ type Index struct {
 	byType [restic.NumBlobTypes]indexMap
 	packs  restic.IDs
 
+	// treeStats contains the statistics of those tree blobs for which they
+	// are known. Index entries written by older versions lack statistics.
+	treeStats map[restic.ID]restic.TreeStats
+
 	final      bool       // set to true for all indexes read from the backend ("finalized")
 	ids        restic.IDs // set to the IDs of the contained finalized indexes
 	supersedes restic.IDs
@@ -94,6 +99,20 @@ const (
 	indexMaxAge             = 10 * time.Minute
 )
 
+// MemoryUsage returns the approximate number of bytes of memory used by the
+// index.
+func (idx *Index) MemoryUsage() uint64 {
+	idx.m.Lock()
+	defer idx.m.Unlock()
+
+	var size uint64
+	for typ := range idx.byType {
+		size += idx.byType[typ].memoryUsage()
+	}
+	size += uint64(len(idx.treeStats)) * uint64(len(restic.ID{})+int(unsafe.Sizeof(restic.TreeStats{})))
+	return size + uint64(cap(idx.packs))*uint64(len(restic.ID{}))
+}
+
 // IndexFull returns true iff the index is "full enough" to be saved as a preliminary index.
 var IndexFull = func(idx *Index, compress bool) bool {
 	idx.m.Lock()
@@ -145,6 +164,35 @@ func (idx *Index) StorePack(id restic.ID, blobs []restic.Blob) {
 	}
 }
 
+// StoreTreeStats records the statistics of the tree blob id. They are only
+// encoded if the index also contains an entry for the blob.
+func (idx *Index) StoreTreeStats(id restic.ID, stats restic.TreeStats) {
+	idx.m.Lock()
+	defer idx.m.Unlock()
+
+	if idx.final {
+		panic("store new item in finalized index")
+	}
+
+	idx.storeTreeStats(id, stats)
+}
+
+func (idx *Index) storeTreeStats(id restic.ID, stats restic.TreeStats) {
+	if idx.treeStats == nil {
+		idx.treeStats = make(map[restic.ID]restic.TreeStats)
+	}
+	idx.treeStats[id] = stats
+}
+
+// LookupTreeStats returns the statistics of the tree blob id, if known.
+func (idx *Index) LookupTreeStats(id restic.ID) (restic.TreeStats, bool) {
+	idx.m.Lock()
+	defer idx.m.Unlock()
+
+	stats, ok := idx.treeStats[id]
+	return stats, ok
+}
+
 func (idx *Index) toPackedBlob(e *indexEntry, t restic.BlobType) restic.PackedBlob {
 	return restic.PackedBlob{
 		Blob: restic.Blob{
@@ -236,6 +284,8 @@ func (idx *Index) Each(ctx context.Context, fn func(restic.PackedBlob)) {
 type EachByPackResult struct {
 	PackID restic.ID
 	Blobs  []restic.Blob
+	// TreeStats contains the known statistics of the tree blobs in Blobs.
+	TreeStats map[restic.ID]restic.TreeStats
 }
 
 // EachByPack returns a channel that yields all blobs known to the index
@@ -275,6 +325,12 @@ func (idx *Index) EachByPack(ctx context.Context, packBlacklist restic.IDSet) <-
 			for typ, pack := range packByType {
 				for _, e := range pack {
 					result.Blobs = append(result.Blobs, idx.toPackedBlob(e, restic.BlobType(typ)).Blob)
+					if stats, ok := idx.treeStats[e.id]; ok && restic.BlobType(typ) == restic.TreeBlob {
+						if result.TreeStats == nil {
+							result.TreeStats = make(map[restic.ID]restic.TreeStats)
+						}
+						result.TreeStats[e.id] = stats
+					}
 				}
 			}
 			// allow GC once entry is no longer necessary
@@ -314,6 +370,31 @@ type blobJSON struct {
 	Offset             uint            `json:"offset"`
 	Length             uint            `json:"length"`
 	UncompressedLength uint            `json:"uncompressed_length,omitempty"`
+	Tree               *treeStatsJSON  `json:"tree,omitempty"`
+}
+
+// treeStatsJSON contains the optional statistics of a tree blob. Older
+// versions ignore this field.
+type treeStatsJSON struct {
+	Entries uint   `json:"entries"`
+	Nodes   uint64 `json:"nodes"`
+	Size    uint64 `json:"size"`
+}
+
+func newTreeStatsJSON(stats restic.TreeStats) *treeStatsJSON {
+	return &treeStatsJSON{
+		Entries: stats.Entries,
+		Nodes:   stats.Nodes,
+		Size:    stats.Size,
+	}
+}
+
+func (ts *treeStatsJSON) treeStats() restic.TreeStats {
+	return restic.TreeStats{
+		Entries: ts.Entries,
+		Nodes:   ts.Nodes,
+		Size:    ts.Size,
+	}
 }
 
 // generatePackList returns a list of packs.
@@ -338,13 +419,17 @@ func (idx *Index) generatePackList() ([]packJSON, error) {
 			p := &list[i]
 
 			// add blob
-			p.Blobs = append(p.Blobs, blobJSON{
+			blob := blobJSON{
 				ID:                 e.id,
 				Type:               restic.BlobType(typ),
 				Offset:             uint(e.offset),
 				Length:             uint(e.length),
 				UncompressedLength: uint(e.uncompressedLength),
-			})
+			}
+			if stats, ok := idx.treeStats[e.id]; ok && blob.Type == restic.TreeBlob {
+				blob.Tree = newTreeStatsJSON(stats)
+			}
+			p.Blobs = append(p.Blobs, blob)
 
 			return true
 		})
@@ -492,6 +577,10 @@ func (idx *Index) merge(idx2 *Index) error {
 		})
 	}
 
+	for id, stats := range idx2.treeStats {
+		idx.storeTreeStats(id, stats)
+	}
+
 	idx.ids = append(idx.ids, idx2.ids...)
 	idx.supersedes = append(idx.supersedes, idx2.supersedes...)
 
@@ -536,6 +625,9 @@ func DecodeIndex(buf []byte, id restic.ID) (idx *Index, oldFormat bool, err erro
 				Length:             blob.Length,
 				UncompressedLength: blob.UncompressedLength,
 			})
+			if blob.Tree != nil && blob.Type == restic.TreeBlob {
+				idx.storeTreeStats(blob.ID, blob.Tree.treeStats())
+			}
 		}
 	}
 	idx.supersedes = idxJSON.Supersedes
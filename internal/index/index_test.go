@@ -447,6 +447,67 @@ func TestIndexUnserializeOld(t *testing.T) {
 	rtest.Equals(t, 0, len(idx.Supersedes()))
 }
 
+var docExampleTreeStats = []byte(`
+{
+	"packs": [
+	  {
+		"id": "73d04e6125cf3c28a299cc2f3cca3b78ceac396e4fcf9575e34536b26782413c",
+		"blobs": [
+		  {
+			"id": "9ccb846e60d90d4eb915848add7aa7ea1e4bbabfc60e573db9f7bfb2789afbae",
+			"type": "tree",
+			"offset": 0,
+			"length": 112,
+			"tree": {
+			  "entries": 3,
+			  "nodes": 42,
+			  "size": 123456
+			}
+		  },
+		  {
+			"id": "d3dc577b4ffd38cc4b32122cabf8655a0223ed22edfd93b353dc0c3f2b0fdf66",
+			"type": "tree",
+			"offset": 112,
+			"length": 123
+		  }
+		]
+	  }
+	]
+  }
+`)
+
+func TestIndexTreeStats(t *testing.T) {
+	withStats := restic.TestParseID("9ccb846e60d90d4eb915848add7aa7ea1e4bbabfc60e573db9f7bfb2789afbae")
+	withoutStats := restic.TestParseID("d3dc577b4ffd38cc4b32122cabf8655a0223ed22edfd93b353dc0c3f2b0fdf66")
+	expected := restic.TreeStats{Entries: 3, Nodes: 42, Size: 123456}
+
+	idx, _, err := index.DecodeIndex(docExampleTreeStats, restic.NewRandomID())
+	rtest.OK(t, err)
+
+	stats, ok := idx.LookupTreeStats(withStats)
+	rtest.Assert(t, ok, "missing tree stats")
+	rtest.Equals(t, expected, stats)
+	_, ok = idx.LookupTreeStats(withoutStats)
+	rtest.Assert(t, !ok, "unexpected tree stats for entry without them")
+
+	// the statistics survive encoding the index again
+	buf := new(bytes.Buffer)
+	rtest.OK(t, idx.Encode(buf))
+	idx2, _, err := index.DecodeIndex(buf.Bytes(), restic.NewRandomID())
+	rtest.OK(t, err)
+	stats, ok = idx2.LookupTreeStats(withStats)
+	rtest.Assert(t, ok, "missing tree stats after encoding")
+	rtest.Equals(t, expected, stats)
+
+	// index files written by older versions do not contain statistics
+	for _, doc := range [][]byte{docExampleV1, docExampleV2, docOldExample} {
+		oldIdx, _, err := index.DecodeIndex(doc, restic.NewRandomID())
+		rtest.OK(t, err)
+		_, ok = oldIdx.LookupTreeStats(withStats)
+		rtest.Assert(t, !ok, "unexpected tree stats in old index")
+	}
+}
+
 func TestIndexPacks(t *testing.T) {
 	idx := index.NewIndex()
 	packs := restic.NewIDSet()
@@ -2,6 +2,7 @@ package index
 
 import (
 	"hash/maphash"
+	"unsafe"
 
 	"github.com/restic/restic/internal/restic"
 )
@@ -134,6 +135,11 @@ func (m *indexMap) init() {
 
 func (m *indexMap) len() uint { return m.numentries }
 
+// memoryUsage returns the approximate number of bytes allocated by the map.
+func (m *indexMap) memoryUsage() uint64 {
+	return uint64(len(m.buckets))*uint64(unsafe.Sizeof(uint(0))) + m.blockList.memoryUsage()
+}
+
 func (m *indexMap) newEntry() (*indexEntry, uint) {
 	return m.blockList.Alloc()
 }
@@ -201,6 +207,15 @@ func (h *hashedArrayTree) Size() uint {
 	return h.size
 }
 
+// memoryUsage returns the number of bytes allocated for the blocks.
+func (h *hashedArrayTree) memoryUsage() uint64 {
+	var entries uint64
+	for _, block := range h.blockList {
+		entries += uint64(cap(block))
+	}
+	return entries*uint64(unsafe.Sizeof(indexEntry{})) + uint64(cap(h.blockList))*uint64(unsafe.Sizeof([]indexEntry{}))
+}
+
 func (h *hashedArrayTree) grow() {
 	idx, subIdx := h.index(h.size)
 	if int(idx) == len(h.blockList) {
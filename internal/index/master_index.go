@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"runtime"
 	"sync"
+	"unsafe"
 
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/restic"
@@ -17,8 +18,19 @@ import (
 type MasterIndex struct {
 	idx          []*Index
 	pendingBlobs restic.BlobSet
-	idxMutex     sync.RWMutex
-	compress     bool
+	// pendingTreeStats contains the statistics of tree blobs which are not
+	// yet stored in a pack file.
+	pendingTreeStats map[restic.ID]restic.TreeStats
+	idxMutex         sync.RWMutex
+	compress         bool
+
+	// flushThreshold is the memory usage of the indexes which have not been
+	// saved yet, at which they are saved regardless of their size and age.
+	flushThreshold uint64
+
+	// superseded contains index files which were not loaded because other
+	// index files supersede them.
+	superseded restic.IDs
 }
 
 // NewMasterIndex creates a new master index.
@@ -28,7 +40,43 @@ func NewMasterIndex() *MasterIndex {
 	// sitation that only two indexes exist which are saved and merged concurrently.
 	idx := []*Index{NewIndex()}
 	idx[0].Finalize()
-	return &MasterIndex{idx: idx, pendingBlobs: restic.NewBlobSet()}
+	return &MasterIndex{
+		idx:              idx,
+		pendingBlobs:     restic.NewBlobSet(),
+		pendingTreeStats: make(map[restic.ID]restic.TreeStats),
+	}
+}
+
+// SetFlushThreshold configures that new indexes are saved once they use more
+// than threshold bytes of memory. This bounds the memory used for indexes
+// which have not been saved yet, at the cost of creating more index files.
+// A threshold of zero disables the limit.
+func (mi *MasterIndex) SetFlushThreshold(threshold uint64) {
+	mi.idxMutex.Lock()
+	defer mi.idxMutex.Unlock()
+	mi.flushThreshold = threshold
+}
+
+// MarkSuperseded records that the index files ids were not loaded because
+// other index files supersede them. Save reports them as obsolete.
+func (mi *MasterIndex) MarkSuperseded(ids ...restic.ID) {
+	mi.idxMutex.Lock()
+	defer mi.idxMutex.Unlock()
+	mi.superseded = append(mi.superseded, ids...)
+}
+
+// MemoryUsage returns the approximate number of bytes of memory used by the
+// index.
+func (mi *MasterIndex) MemoryUsage() uint64 {
+	mi.idxMutex.RLock()
+	defer mi.idxMutex.RUnlock()
+
+	size := uint64(len(mi.pendingBlobs)) * uint64(unsafe.Sizeof(restic.BlobHandle{}))
+	size += uint64(len(mi.pendingTreeStats)) * uint64(len(restic.ID{})+int(unsafe.Sizeof(restic.TreeStats{})))
+	for _, idx := range mi.idx {
+		size += idx.MemoryUsage()
+	}
+	return size
 }
 
 func (mi *MasterIndex) MarkCompressed() {
@@ -61,6 +109,49 @@ func (mi *MasterIndex) LookupSize(bh restic.BlobHandle) (uint, bool) {
 	return 0, false
 }
 
+// LookupTreeStats returns the statistics of the tree blob id. This also
+// includes the statistics of tree blobs which have not been stored yet.
+func (mi *MasterIndex) LookupTreeStats(id restic.ID) (restic.TreeStats, bool) {
+	mi.idxMutex.RLock()
+	defer mi.idxMutex.RUnlock()
+
+	if stats, ok := mi.pendingTreeStats[id]; ok {
+		return stats, true
+	}
+	return mi.lookupStoredTreeStats(id)
+}
+
+// lookupStoredTreeStats returns the statistics of the tree blob id recorded
+// in one of the indexes. The caller must hold idxMutex.
+func (mi *MasterIndex) lookupStoredTreeStats(id restic.ID) (restic.TreeStats, bool) {
+	for _, idx := range mi.idx {
+		if stats, ok := idx.LookupTreeStats(id); ok {
+			return stats, true
+		}
+	}
+
+	return restic.TreeStats{}, false
+}
+
+// AddTreeStats records the statistics of the tree blob id. They are added to
+// the index once the blob is stored in a pack file. If the index already
+// contains the blob, the statistics are discarded.
+func (mi *MasterIndex) AddTreeStats(id restic.ID, stats restic.TreeStats) {
+	mi.idxMutex.Lock()
+	defer mi.idxMutex.Unlock()
+
+	bh := restic.BlobHandle{Type: restic.TreeBlob, ID: id}
+	if !mi.pendingBlobs.Has(bh) {
+		for _, idx := range mi.idx {
+			if idx.Has(bh) {
+				return
+			}
+		}
+	}
+
+	mi.pendingTreeStats[id] = stats
+}
+
 // AddPending adds a given blob to list of pending Blobs
 // Before doing so it checks if this blob is already known.
 // Returns true if adding was successful and false if the blob
@@ -165,16 +256,35 @@ func (mi *MasterIndex) StorePack(id restic.ID, blobs []restic.Blob) {
 		mi.pendingBlobs.Delete(restic.BlobHandle{Type: blob.Type, ID: blob.ID})
 	}
 
+	var target *Index
 	for _, idx := range mi.idx {
 		if !idx.Final() {
-			idx.StorePack(id, blobs)
-			return
+			target = idx
+			break
 		}
 	}
+	if target == nil {
+		target = NewIndex()
+		mi.idx = append(mi.idx, target)
+	}
 
-	newIdx := NewIndex()
-	newIdx.StorePack(id, blobs)
-	mi.idx = append(mi.idx, newIdx)
+	target.StorePack(id, blobs)
+	for _, blob := range blobs {
+		if blob.Type != restic.TreeBlob {
+			continue
+		}
+		stats, ok := mi.pendingTreeStats[blob.ID]
+		if ok {
+			delete(mi.pendingTreeStats, blob.ID)
+		} else {
+			// keep the statistics of blobs which are copied to a new pack
+			// file, for example when repacking or when rebuilding the index
+			stats, ok = mi.lookupStoredTreeStats(blob.ID)
+		}
+		if ok {
+			target.StoreTreeStats(blob.ID, stats)
+		}
+	}
 }
 
 // finalizeNotFinalIndexes finalizes all indexes that
@@ -203,13 +313,26 @@ func (mi *MasterIndex) finalizeFullIndexes() []*Index {
 
 	var list []*Index
 
+	// save all new indexes if they use too much memory
+	flush := false
+	if mi.flushThreshold > 0 {
+		var size uint64
+		for _, idx := range mi.idx {
+			if !idx.Final() {
+				size += idx.MemoryUsage()
+			}
+		}
+		debug.Log("new indexes use %d bytes, flush threshold %d", size, mi.flushThreshold)
+		flush = size >= mi.flushThreshold
+	}
+
 	debug.Log("checking %d indexes", len(mi.idx))
 	for _, idx := range mi.idx {
 		if idx.Final() {
 			continue
 		}
 
-		if IndexFull(idx, mi.compress) {
+		if flush || IndexFull(idx, mi.compress) {
 			debug.Log("index %p is full", idx)
 			idx.Finalize()
 			list = append(list, idx)
@@ -312,6 +435,9 @@ func (mi *MasterIndex) Save(ctx context.Context, repo restic.SaverUnpacked, pack
 
 			for pbs := range idx.EachByPack(ctx, packBlacklist) {
 				newIndex.StorePack(pbs.PackID, pbs.Blobs)
+				for id, stats := range pbs.TreeStats {
+					newIndex.StoreTreeStats(id, stats)
+				}
 				p.Add(1)
 				if IndexFull(newIndex, mi.compress) {
 					select {
@@ -330,6 +456,12 @@ func (mi *MasterIndex) Save(ctx context.Context, repo restic.SaverUnpacked, pack
 		}
 		obsolete.Merge(restic.NewIDSet(extraObsolete...))
 
+		err = newIndex.AddToSupersedes(mi.superseded...)
+		if err != nil {
+			return err
+		}
+		obsolete.Merge(restic.NewIDSet(mi.superseded...))
+
 		select {
 		case ch <- newIndex:
 		case <-ctx.Done():
@@ -398,8 +530,10 @@ func (mi *MasterIndex) SaveIndex(ctx context.Context, r restic.SaverUnpacked) er
 	return mi.saveIndex(ctx, r, mi.finalizeNotFinalIndexes()...)
 }
 
-// SaveFullIndex saves all full indexes in the backend.
+// SaveFullIndex saves all full indexes in the backend. If the new indexes
+// use more memory than the flush threshold, they are saved as well.
 func (mi *MasterIndex) SaveFullIndex(ctx context.Context, r restic.SaverUnpacked) error {
+	debug.Log("index uses about %d bytes of memory", mi.MemoryUsage())
 	return mi.saveIndex(ctx, r, mi.finalizeFullIndexes()...)
 }
 
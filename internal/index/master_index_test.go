@@ -406,3 +406,101 @@ func testIndexSave(t *testing.T, version uint) {
 		}
 	}
 }
+
+func TestMasterIndexFlushThreshold(t *testing.T) {
+	// only the flush threshold should cause indexes to be saved
+	defer func(f func(*index.Index, bool) bool) {
+		index.IndexFull = f
+	}(index.IndexFull)
+	index.IndexFull = func(*index.Index, bool) bool { return false }
+
+	countIndexes := func(repo restic.Repository) int {
+		count := 0
+		rtest.OK(t, repo.List(context.TODO(), restic.IndexFile, func(restic.ID, int64) error {
+			count++
+			return nil
+		}))
+		return count
+	}
+
+	for _, test := range []struct {
+		threshold uint64
+		saved     bool
+	}{
+		{0, false},
+		{1 << 30, false},
+		{8 << 10, true},
+	} {
+		repo := repository.TestRepository(t)
+		mi := index.NewMasterIndex()
+		mi.SetFlushThreshold(test.threshold)
+
+		for i := 0; i < 100; i++ {
+			var blobs []restic.Blob
+			for j := 0; j < 10; j++ {
+				blobs = append(blobs, restic.Blob{
+					BlobHandle: restic.NewRandomBlobHandle(),
+					Length:     100,
+					Offset:     uint(j * 100),
+				})
+			}
+			mi.StorePack(restic.NewRandomID(), blobs)
+			rtest.OK(t, mi.SaveFullIndex(context.TODO(), repo))
+		}
+
+		count := countIndexes(repo)
+		if test.saved {
+			rtest.Assert(t, count >= 2, "threshold %v: expected several indexes, got %v", test.threshold, count)
+		} else {
+			rtest.Equals(t, 0, count)
+		}
+
+		rtest.Assert(t, mi.MemoryUsage() >= 1000*uint64(len(restic.ID{})),
+			"memory usage %v is too low for 1000 blobs", mi.MemoryUsage())
+	}
+}
+
+func TestMasterIndexTreeStats(t *testing.T) {
+	repo := repository.TestRepository(t)
+	mi := index.NewMasterIndex()
+
+	// an index entry written by an older version lacks statistics
+	oldTree := restic.BlobHandle{ID: restic.NewRandomID(), Type: restic.TreeBlob}
+	mi.StorePack(restic.NewRandomID(), []restic.Blob{{BlobHandle: oldTree, Length: 100}})
+	rtest.OK(t, mi.SaveIndex(context.TODO(), repo))
+
+	newTree := restic.BlobHandle{ID: restic.NewRandomID(), Type: restic.TreeBlob}
+	expected := restic.TreeStats{Entries: 2, Nodes: 5, Size: 1234}
+	mi.AddTreeStats(newTree.ID, expected)
+	stats, ok := mi.LookupTreeStats(newTree.ID)
+	rtest.Assert(t, ok, "missing statistics of pending tree")
+	rtest.Equals(t, expected, stats)
+
+	// statistics of blobs which are already known are discarded
+	mi.AddTreeStats(oldTree.ID, expected)
+	_, ok = mi.LookupTreeStats(oldTree.ID)
+	rtest.Assert(t, !ok, "unexpected statistics for known tree")
+
+	mi.StorePack(restic.NewRandomID(), []restic.Blob{{BlobHandle: newTree, Length: 100}})
+	rtest.OK(t, mi.SaveIndex(context.TODO(), repo))
+
+	check := func() {
+		rtest.OK(t, repo.SetIndex(index.NewMasterIndex()))
+		rtest.OK(t, repo.LoadIndex(context.TODO()))
+
+		stats, ok := repo.Index().LookupTreeStats(newTree.ID)
+		rtest.Assert(t, ok, "missing statistics after loading the index")
+		rtest.Equals(t, expected, stats)
+		_, ok = repo.Index().LookupTreeStats(oldTree.ID)
+		rtest.Assert(t, !ok, "unexpected statistics for old index entry")
+	}
+	check()
+
+	// rewriting the index keeps the statistics
+	obsolete, err := repo.Index().Save(context.TODO(), repo, nil, nil, nil)
+	rtest.OK(t, err)
+	for id := range obsolete {
+		rtest.OK(t, repo.Backend().Remove(context.TODO(), restic.Handle{Type: restic.IndexFile, Name: id.String()}))
+	}
+	check()
+}
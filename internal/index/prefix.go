@@ -0,0 +1,139 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// MinPrefixLength is the minimum number of hex characters of a blob ID
+// prefix.
+const MinPrefixLength = 4
+
+// maxPrefixCandidates is the number of candidates reported for an ambiguous
+// prefix.
+const maxPrefixCandidates = 5
+
+// AmbiguousPrefixError is returned by LookupPrefix if several blobs match
+// the prefix.
+type AmbiguousPrefixError struct {
+	Prefix string
+	// Candidates contains some of the matching blobs.
+	Candidates []restic.BlobHandle
+}
+
+func (e *AmbiguousPrefixError) Error() string {
+	var ids []string
+	for _, bh := range e.Candidates {
+		ids = append(ids, bh.ID.String()[:12]+" ("+bh.Type.String()+")")
+	}
+	return fmt.Sprintf("multiple blobs with prefix %q found, e.g. %v", e.Prefix, strings.Join(ids, ", "))
+}
+
+// NoBlobByPrefixError is returned by LookupPrefix if no blob matches the
+// prefix.
+type NoBlobByPrefixError struct {
+	Prefix string
+}
+
+func (e *NoBlobByPrefixError) Error() string {
+	return fmt.Sprintf("no blob with prefix %q found", e.Prefix)
+}
+
+// parsePrefix returns the value of each hex character of prefix.
+func parsePrefix(prefix string) ([]byte, error) {
+	if len(prefix) < MinPrefixLength {
+		return nil, errors.Errorf("blob ID prefix %q is too short, at least %d characters are required", prefix, MinPrefixLength)
+	}
+	if len(prefix) > 2*len(restic.ID{}) {
+		return nil, errors.Errorf("blob ID prefix %q is too long", prefix)
+	}
+
+	nibbles := make([]byte, len(prefix))
+	for i, c := range strings.ToLower(prefix) {
+		switch {
+		case c >= '0' && c <= '9':
+			nibbles[i] = byte(c - '0')
+		case c >= 'a' && c <= 'f':
+			nibbles[i] = byte(c-'a') + 10
+		default:
+			return nil, errors.Errorf("invalid blob ID prefix %q", prefix)
+		}
+	}
+	return nibbles, nil
+}
+
+// hasPrefix returns true if the hex representation of id starts with the
+// characters in nibbles.
+func hasPrefix(id restic.ID, nibbles []byte) bool {
+	for i, n := range nibbles {
+		b := id[i/2]
+		if i%2 == 0 {
+			b >>= 4
+		}
+		if b&0xf != n {
+			return false
+		}
+	}
+	return true
+}
+
+// LookupPrefix returns the blob whose ID starts with the hex prefix. Only
+// blobs of the given types are considered, if no type is given all blobs are
+// considered. If several blobs match, an AmbiguousPrefixError is returned,
+// if none matches a NoBlobByPrefixError.
+func (mi *MasterIndex) LookupPrefix(ctx context.Context, prefix string, types ...restic.BlobType) (restic.BlobHandle, error) {
+	nibbles, err := parsePrefix(prefix)
+	if err != nil {
+		return restic.BlobHandle{}, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var found []restic.BlobHandle
+	mi.Each(ctx, func(pb restic.PackedBlob) {
+		if len(types) > 0 && !containsType(types, pb.Type) {
+			return
+		}
+		if !hasPrefix(pb.ID, nibbles) {
+			return
+		}
+
+		bh := pb.BlobHandle
+		for _, f := range found {
+			if f == bh {
+				// the blob is stored in several packs
+				return
+			}
+		}
+		found = append(found, bh)
+		if len(found) >= maxPrefixCandidates {
+			cancel()
+		}
+	})
+	if ctx.Err() != nil && len(found) < maxPrefixCandidates {
+		return restic.BlobHandle{}, ctx.Err()
+	}
+
+	switch len(found) {
+	case 0:
+		return restic.BlobHandle{}, &NoBlobByPrefixError{Prefix: prefix}
+	case 1:
+		return found[0], nil
+	default:
+		return restic.BlobHandle{}, &AmbiguousPrefixError{Prefix: prefix, Candidates: found}
+	}
+}
+
+func containsType(types []restic.BlobType, t restic.BlobType) bool {
+	for _, tpe := range types {
+		if tpe == t {
+			return true
+		}
+	}
+	return false
+}
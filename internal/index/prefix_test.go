@@ -0,0 +1,66 @@
+package index_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/index"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestMasterIndexLookupPrefix(t *testing.T) {
+	ids := []restic.ID{
+		restic.TestParseID("1234560000000000000000000000000000000000000000000000000000000000"),
+		restic.TestParseID("1234570000000000000000000000000000000000000000000000000000000000"),
+		restic.TestParseID("abcdef0000000000000000000000000000000000000000000000000000000000"),
+	}
+
+	idx := index.NewIndex()
+	packID := restic.NewRandomID()
+	var blobs []restic.Blob
+	for i, id := range ids {
+		tpe := restic.DataBlob
+		if i == 1 {
+			tpe = restic.TreeBlob
+		}
+		blobs = append(blobs, restic.Blob{
+			BlobHandle: restic.BlobHandle{ID: id, Type: tpe},
+			Length:     10,
+			Offset:     uint(10 * i),
+		})
+	}
+	idx.StorePack(packID, blobs)
+	mIdx := index.NewMasterIndex()
+	mIdx.Insert(idx)
+
+	ctx := context.TODO()
+
+	bh, err := mIdx.LookupPrefix(ctx, "ABCD")
+	rtest.OK(t, err)
+	rtest.Equals(t, restic.BlobHandle{ID: ids[2], Type: restic.DataBlob}, bh)
+
+	bh, err = mIdx.LookupPrefix(ctx, "12345", restic.TreeBlob)
+	rtest.OK(t, err)
+	rtest.Equals(t, ids[1], bh.ID)
+
+	bh, err = mIdx.LookupPrefix(ctx, ids[0].String())
+	rtest.OK(t, err)
+	rtest.Equals(t, ids[0], bh.ID)
+
+	_, err = mIdx.LookupPrefix(ctx, "12345")
+	var ambiguous *index.AmbiguousPrefixError
+	rtest.Assert(t, errors.As(err, &ambiguous), "expected AmbiguousPrefixError, got %v", err)
+	rtest.Equals(t, 2, len(ambiguous.Candidates))
+
+	_, err = mIdx.LookupPrefix(ctx, "abcd", restic.TreeBlob)
+	var notFound *index.NoBlobByPrefixError
+	rtest.Assert(t, errors.As(err, &notFound), "expected NoBlobByPrefixError, got %v", err)
+
+	for _, prefix := range []string{"123", "xyz12", ids[0].String() + "0"} {
+		_, err = mIdx.LookupPrefix(ctx, prefix)
+		rtest.Assert(t, err != nil, "expected error for prefix %q", prefix)
+		rtest.Assert(t, !errors.As(err, &notFound), "unexpected NoBlobByPrefixError for prefix %q", prefix)
+	}
+}
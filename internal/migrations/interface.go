@@ -21,4 +21,17 @@ type Migration interface {
 
 	// Descr returns a description what the migration does.
 	Desc() string
+
+	// Changes returns a list of the changes the migration makes to the repository.
+	Changes() []string
+
+	// Reversible returns true if the changes can be undone afterwards.
+	Reversible() bool
+}
+
+// Planner is implemented by migrations which can describe the concrete
+// changes they would make to a repository, without applying them. Each
+// change is phrased as an action, e.g. "move 3 snapshot files".
+type Planner interface {
+	Plan(context.Context, restic.Repository) ([]string, error)
 }
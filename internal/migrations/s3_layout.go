@@ -4,10 +4,8 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"path"
 
 	"github.com/restic/restic/internal/backend/layout"
-	"github.com/restic/restic/internal/backend/s3"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
@@ -17,19 +15,29 @@ func init() {
 	register(&S3Layout{})
 }
 
-// S3Layout migrates a repository on an S3 backend from the "s3legacy" to the
-// "default" layout.
+// S3Layout migrates a repository from the "s3legacy" to the "default" layout.
+// It works for all backends which support moving files between layouts.
 type S3Layout struct{}
 
 // Check tests whether the migration can be applied.
-func (m *S3Layout) Check(_ context.Context, repo restic.Repository) (bool, string, error) {
-	be := restic.AsBackend[*s3.Backend](repo.Backend())
+func (m *S3Layout) Check(ctx context.Context, repo restic.Repository) (bool, string, error) {
+	be := restic.AsBackend[layout.Mover](repo.Backend())
 	if be == nil {
-		debug.Log("backend is not s3")
-		return false, "backend is not s3", nil
+		debug.Log("backend does not support moving files to a different layout")
+		return false, "backend does not support changing the layout", nil
 	}
 
-	if be.Layout.Name() != "s3legacy" {
+	if be.Name() == "s3legacy" {
+		return true, "", nil
+	}
+
+	// an interrupted migration may have left files in the legacy layout
+	// behind, the layout detection then falls back to the default layout
+	found, err := m.hasLegacyFiles(ctx, be)
+	if err != nil {
+		return false, "", err
+	}
+	if !found {
 		debug.Log("layout is not s3legacy")
 		return false, "not using the legacy s3 layout", nil
 	}
@@ -37,6 +45,70 @@ func (m *S3Layout) Check(_ context.Context, repo restic.Repository) (bool, strin
 	return true, "", nil
 }
 
+// legacyFileTypes are the file types which are stored in a different location
+// in the legacy layout. Key files are moved last, so that the layout is only
+// detected as "default" once all other files have been moved.
+var legacyFileTypes = []restic.FileType{
+	restic.SnapshotFile,
+	restic.PackFile,
+	restic.LockFile,
+	restic.KeyFile,
+}
+
+// withLegacyLayout runs fn while be uses the legacy layout.
+func withLegacyLayout(be layout.Mover, fn func() error) error {
+	current, err := be.NewLayout(be.Name())
+	if err != nil {
+		return err
+	}
+	oldLayout, err := be.NewLayout("s3legacy")
+	if err != nil {
+		return err
+	}
+
+	be.SetLayout(oldLayout)
+	defer be.SetLayout(current)
+
+	return fn()
+}
+
+// hasLegacyFiles returns true if any file is stored in its location in the
+// legacy layout.
+func (m *S3Layout) hasLegacyFiles(ctx context.Context, be layout.Mover) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	found := false
+	err := withLegacyLayout(be, func() error {
+		for _, t := range legacyFileTypes {
+			err := be.List(ctx, t, func(fi restic.FileInfo) error {
+				if !isBackendFile(fi.Name) {
+					return nil
+				}
+				found = true
+				cancel()
+				return nil
+			})
+			if found {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return found, err
+}
+
+// isBackendFile returns false for the subdirectories of the "data" directory
+// in the default layout, which are listed together with the pack files in
+// the legacy layout.
+func isBackendFile(name string) bool {
+	_, err := restic.ParseID(name)
+	return err == nil
+}
+
 func (m *S3Layout) RepoCheck() bool {
 	return false
 }
@@ -58,58 +130,86 @@ func retry(max int, fail func(err error), f func() error) error {
 // maxErrors for retrying renames on s3.
 const maxErrors = 20
 
-func (m *S3Layout) moveFiles(ctx context.Context, be *s3.Backend, l layout.Layout, t restic.FileType) error {
+func (m *S3Layout) moveFiles(ctx context.Context, be layout.Mover, l layout.Layout, t restic.FileType) error {
 	printErr := func(err error) {
 		fmt.Fprintf(os.Stderr, "renaming file returned error: %v\n", err)
 	}
 
 	return be.List(ctx, t, func(fi restic.FileInfo) error {
+		if !isBackendFile(fi.Name) {
+			debug.Log("skip %v", fi.Name)
+			return nil
+		}
+
 		h := restic.Handle{Type: t, Name: fi.Name}
 		debug.Log("move %v", h)
 
 		return retry(maxErrors, printErr, func() error {
-			return be.Rename(ctx, h, l)
+			return be.MoveToLayout(ctx, h, l)
 		})
 	})
 }
 
-// Apply runs the migration.
+// Apply runs the migration. Files which have already been moved by an
+// interrupted run are skipped.
 func (m *S3Layout) Apply(ctx context.Context, repo restic.Repository) error {
-	be := restic.AsBackend[*s3.Backend](repo.Backend())
+	be := restic.AsBackend[layout.Mover](repo.Backend())
 	if be == nil {
-		debug.Log("backend is not s3")
-		return errors.New("backend is not s3")
+		debug.Log("backend does not support moving files to a different layout")
+		return errors.New("backend does not support changing the layout")
 	}
 
-	oldLayout := &layout.S3LegacyLayout{
-		Path: be.Path(),
-		Join: path.Join,
+	oldLayout, err := be.NewLayout("s3legacy")
+	if err != nil {
+		return err
 	}
 
-	newLayout := &layout.DefaultLayout{
-		Path: be.Path(),
-		Join: path.Join,
+	newLayout, err := be.NewLayout("default")
+	if err != nil {
+		return err
 	}
 
-	be.Layout = oldLayout
+	be.SetLayout(oldLayout)
 
-	for _, t := range []restic.FileType{
-		restic.SnapshotFile,
-		restic.PackFile,
-		restic.KeyFile,
-		restic.LockFile,
-	} {
+	for _, t := range legacyFileTypes {
 		err := m.moveFiles(ctx, be, newLayout, t)
 		if err != nil {
 			return err
 		}
 	}
 
-	be.Layout = newLayout
+	be.SetLayout(newLayout)
 
 	return nil
 }
 
+// Plan returns the number of files of each type which would be moved.
+func (m *S3Layout) Plan(ctx context.Context, repo restic.Repository) ([]string, error) {
+	be := restic.AsBackend[layout.Mover](repo.Backend())
+	if be == nil {
+		return nil, errors.New("backend does not support changing the layout")
+	}
+
+	var plan []string
+	err := withLegacyLayout(be, func() error {
+		for _, t := range legacyFileTypes {
+			count := 0
+			err := be.List(ctx, t, func(fi restic.FileInfo) error {
+				if isBackendFile(fi.Name) {
+					count++
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			plan = append(plan, fmt.Sprintf("move %d %v files to the default layout", count, t))
+		}
+		return nil
+	})
+	return plan, err
+}
+
 // Name returns the name for this migration.
 func (m *S3Layout) Name() string {
 	return "s3_layout"
@@ -119,3 +219,13 @@ func (m *S3Layout) Name() string {
 func (m *S3Layout) Desc() string {
 	return "move files from 's3legacy' to the 'default' repository layout"
 }
+
+// Changes returns the changes the migration makes to the repository.
+func (m *S3Layout) Changes() []string {
+	return []string{"move all snapshot, data, lock and key files to their location in the default layout"}
+}
+
+// Reversible returns false, restic cannot move files back to the legacy layout.
+func (m *S3Layout) Reversible() bool {
+	return false
+}
@@ -44,6 +44,20 @@ func (*UpgradeRepoV2) Desc() string {
 	return "upgrade a repository to version 2"
 }
 
+func (*UpgradeRepoV2) Changes() []string {
+	return []string{"replace the config file, the repository version is set to 2"}
+}
+
+// Reversible returns false, as compressed data cannot be read by restic
+// versions which only support repository version 1.
+func (*UpgradeRepoV2) Reversible() bool {
+	return false
+}
+
+func (*UpgradeRepoV2) Plan(_ context.Context, repo restic.Repository) ([]string, error) {
+	return []string{fmt.Sprintf("change the repository version from %v to 2", repo.Config().Version)}, nil
+}
+
 func (*UpgradeRepoV2) Check(_ context.Context, repo restic.Repository) (bool, string, error) {
 	isV1 := repo.Config().Version == 1
 	reason := ""
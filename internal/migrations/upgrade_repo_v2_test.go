@@ -105,3 +105,14 @@ func TestUpgradeRepoV2Failure(t *testing.T) {
 	test.OK(t, os.Remove(upgradeErr.BackupFilePath))
 	test.OK(t, os.Remove(filepath.Dir(upgradeErr.BackupFilePath)))
 }
+
+func TestUpgradeRepoV2Plan(t *testing.T) {
+	repo := repository.TestRepositoryWithVersion(t, 1)
+
+	m := &UpgradeRepoV2{}
+	plan, err := m.Plan(context.Background(), repo)
+	test.OK(t, err)
+	test.Equals(t, []string{"change the repository version from 1 to 2"}, plan)
+	// planning must not change the repository
+	test.Equals(t, uint(1), repo.Config().Version)
+}
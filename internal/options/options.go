@@ -1,6 +1,7 @@
 package options
 
 import (
+	"fmt"
 	"reflect"
 	"sort"
 	"strconv"
@@ -16,6 +17,8 @@ type Options map[string]string
 var opts []Help
 
 // Register allows registering options so that they can be listed with List.
+// The values of the fields in cfg are used as the default values of the
+// options.
 func Register(ns string, cfg interface{}) {
 	opts = appendAllOptions(opts, ns, cfg)
 }
@@ -49,23 +52,40 @@ func listOptions(cfg interface{}) (opts []Help) {
 		h := Help{
 			Name: f.Tag.Get("option"),
 			Text: f.Tag.Get("help"),
+			Type: optionType(f.Type),
 		}
 
 		if h.Name == "" {
 			continue
 		}
 
+		if fv := v.Field(i); !fv.IsZero() {
+			h.Default = fmt.Sprint(fv.Interface())
+		}
+
 		opts = append(opts, h)
 	}
 
 	return opts
 }
 
+// optionType returns the name of the type of an option as it is shown to
+// users.
+func optionType(t reflect.Type) string {
+	if t.Name() == "Duration" {
+		return "duration"
+	}
+	return t.Name()
+}
+
 // Help contains information about an option.
 type Help struct {
 	Namespace string
 	Name      string
 	Text      string
+	Type      string
+	// Default is the default value, it is empty for the zero value.
+	Default string
 }
 
 type helpList []Help
@@ -143,6 +163,158 @@ func (o Options) Extract(ns string) Options {
 	return opts
 }
 
+// Check returns an error if o contains a key which is not registered (using
+// Register()). The error suggests the registered options with the most
+// similar names.
+func (o Options) Check() error {
+	return o.check(opts)
+}
+
+func (o Options) check(known []Help) error {
+	names := make(map[string]struct{}, len(known))
+	for _, h := range known {
+		names[h.Namespace+"."+h.Name] = struct{}{}
+	}
+
+	keys := make([]string, 0, len(o))
+	for key := range o {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if _, ok := names[key]; ok {
+			continue
+		}
+
+		suggestions := similarOptions(key, known)
+		if len(suggestions) == 0 {
+			return errors.Fatalf("option %v is not known", key)
+		}
+		return errors.Fatalf("option %v is not known, did you mean %v?", key, strings.Join(suggestions, ", "))
+	}
+
+	return nil
+}
+
+// maxSuggestions is the maximum number of options suggested for an unknown
+// option.
+const maxSuggestions = 3
+
+// similarOptions returns the names of the options in known which are most
+// similar to key. Options with the same name in a different namespace are
+// always included.
+func similarOptions(key string, known []Help) []string {
+	type candidate struct {
+		name     string
+		distance int
+	}
+
+	_, keyName, _ := strings.Cut(key, ".")
+
+	var candidates []candidate
+	for _, h := range known {
+		name := h.Namespace + "." + h.Name
+		d := editDistance(key, name)
+		if d > 3 && h.Name != keyName {
+			continue
+		}
+		candidates = append(candidates, candidate{name, d})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].name < candidates[j].name
+	})
+
+	var names []string
+	for i := 0; i < len(candidates) && i < maxSuggestions; i++ {
+		names = append(names, candidates[i].name)
+	}
+	return names
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// ApplyAll sets the options on several structs which share the namespace ns.
+// Each option is set on the struct which has a field with a matching `option`
+// tag, options which are not known by any of the structs are rejected.
+func (o Options) ApplyAll(ns string, dsts ...interface{}) error {
+	parts := make([]Options, len(dsts))
+	for i := range parts {
+		parts[i] = make(Options)
+	}
+
+	for key, value := range o {
+		found := false
+		for i, dst := range dsts {
+			if hasOption(dst, key) {
+				parts[i][key] = value
+				found = true
+				break
+			}
+		}
+		if !found {
+			if ns != "" {
+				key = ns + "." + key
+			}
+			return errors.Fatalf("option %v is not known", key)
+		}
+	}
+
+	for i, dst := range dsts {
+		if err := parts[i].Apply(ns, dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasOption returns true if the struct dst points to has a field with the
+// `option` tag name.
+func hasOption(dst interface{}, name string) bool {
+	t := reflect.TypeOf(dst).Elem()
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("option") == name {
+			return true
+		}
+	}
+	return false
+}
+
 // Apply sets the options on dst via reflection, using the struct tag `option`.
 // The namespace argument (ns) is only used for error messages.
 func (o Options) Apply(ns string, dst interface{}) error {
@@ -195,6 +367,14 @@ func (o Options) Apply(ns string, dst interface{}) error {
 
 			v.Field(i).SetUint(vi)
 
+		case "uint64":
+			vi, err := strconv.ParseUint(value, 0, 64)
+			if err != nil {
+				return err
+			}
+
+			v.Field(i).SetUint(vi)
+
 		case "bool":
 			vi, err := strconv.ParseBool(value)
 			if err != nil {
@@ -126,6 +126,7 @@ type Target struct {
 	ID      int           `option:"id"`
 	Timeout time.Duration `option:"timeout"`
 	Switch  bool          `option:"switch"`
+	Size    uint64        `option:"size"`
 	Other   string
 }
 
@@ -167,6 +168,14 @@ var setTests = []struct {
 			Switch: true,
 		},
 	},
+	{
+		Options{
+			"size": "6442450944",
+		},
+		Target{
+			Size: 6 * 1024 * 1024 * 1024,
+		},
+	},
 }
 
 func TestOptionsApply(t *testing.T) {
@@ -185,6 +194,29 @@ func TestOptionsApply(t *testing.T) {
 	}
 }
 
+func TestOptionsApplyAll(t *testing.T) {
+	type Other struct {
+		Color string `option:"color"`
+	}
+
+	var dst Target
+	var other Other
+	opts := Options{"name": "foobar", "color": "red"}
+	err := opts.ApplyAll("ns", &dst, &other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dst.Name != "foobar" || other.Color != "red" {
+		t.Fatalf("wrong result, got %#v and %#v", dst, other)
+	}
+
+	opts = Options{"name": "foobar", "shape": "round"}
+	err = opts.ApplyAll("ns", &dst, &other)
+	if err == nil || err.Error() != "Fatal: option ns.shape is not known" {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
 var invalidSetTests = []struct {
 	input     Options
 	namespace string
@@ -218,6 +250,13 @@ var invalidSetTests = []struct {
 		"ns",
 		`strconv.ParseBool: parsing "yes": invalid syntax`,
 	},
+	{
+		Options{
+			"size": "-1",
+		},
+		"ns",
+		`strconv.ParseUint: parsing "-1": invalid syntax`,
+	},
 }
 
 func TestOptionsApplyInvalid(t *testing.T) {
@@ -255,7 +294,7 @@ func TestListOptions(t *testing.T) {
 				Foo string `option:"foo" help:"bar text help"`
 			}{},
 			[]Help{
-				{Name: "foo", Text: "bar text help"},
+				{Name: "foo", Text: "bar text help", Type: "string"},
 			},
 		},
 		{
@@ -264,8 +303,8 @@ func TestListOptions(t *testing.T) {
 				Bar string `option:"bar" help:"bar text help"`
 			}{},
 			[]Help{
-				{Name: "foo", Text: "bar text help"},
-				{Name: "bar", Text: "bar text help"},
+				{Name: "foo", Text: "bar text help", Type: "string"},
+				{Name: "bar", Text: "bar text help", Type: "string"},
 			},
 		},
 		{
@@ -274,14 +313,14 @@ func TestListOptions(t *testing.T) {
 				Foo string `option:"foo" help:"bar text help"`
 			}{},
 			[]Help{
-				{Name: "bar", Text: "bar text help"},
-				{Name: "foo", Text: "bar text help"},
+				{Name: "bar", Text: "bar text help", Type: "string"},
+				{Name: "foo", Text: "bar text help", Type: "string"},
 			},
 		},
 		{
 			&teststruct,
 			[]Help{
-				{Name: "foo", Text: "bar text help"},
+				{Name: "foo", Text: "bar text help", Type: "string"},
 			},
 		},
 	}
@@ -312,9 +351,9 @@ func TestAppendAllOptions(t *testing.T) {
 				}{},
 			},
 			[]Help{
-				{Namespace: "local", Name: "foo", Text: "bar text help"},
-				{Namespace: "sftp", Name: "bar", Text: "bar text help"},
-				{Namespace: "sftp", Name: "foo", Text: "bar text help2"},
+				{Namespace: "local", Name: "foo", Text: "bar text help", Type: "string"},
+				{Namespace: "sftp", Name: "bar", Text: "bar text help", Type: "string"},
+				{Namespace: "sftp", Name: "foo", Text: "bar text help2", Type: "string"},
 			},
 		},
 	}
@@ -332,3 +371,63 @@ func TestAppendAllOptions(t *testing.T) {
 		})
 	}
 }
+
+func TestListOptionsDefault(t *testing.T) {
+	cfg := struct {
+		Name    string        `option:"name" help:"name"`
+		Count   uint          `option:"count" help:"count"`
+		Enabled bool          `option:"enabled" help:"enabled"`
+		Timeout time.Duration `option:"timeout" help:"timeout"`
+	}{
+		Count:   5,
+		Timeout: time.Minute,
+	}
+
+	want := []Help{
+		{Name: "name", Text: "name", Type: "string"},
+		{Name: "count", Text: "count", Type: "uint", Default: "5"},
+		{Name: "enabled", Text: "enabled", Type: "bool"},
+		{Name: "timeout", Text: "timeout", Type: "duration", Default: "1m0s"},
+	}
+
+	opts := listOptions(cfg)
+	if !reflect.DeepEqual(opts, want) {
+		t.Fatalf("wrong opts, want:\n  %v\ngot:\n  %v", want, opts)
+	}
+}
+
+func TestOptionsCheck(t *testing.T) {
+	known := []Help{
+		{Namespace: "local", Name: "connections"},
+		{Namespace: "s3", Name: "connections"},
+		{Namespace: "s3", Name: "region"},
+		{Namespace: "gs", Name: "region"},
+	}
+
+	var tests = []struct {
+		opts Options
+		err  string
+	}{
+		{Options{}, ""},
+		{Options{"s3.region": "foo", "local.connections": "2"}, ""},
+		{Options{"s3.conections": "2"}, "Fatal: option s3.conections is not known, did you mean s3.connections?"},
+		{Options{"sftp.region": "x"}, "Fatal: option sftp.region is not known, did you mean s3.region, gs.region?"},
+		{Options{"foo.bar": "x"}, "Fatal: option foo.bar is not known"},
+	}
+
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			err := test.opts.check(known)
+			if test.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error %v", err)
+				}
+				return
+			}
+
+			if err == nil || err.Error() != test.err {
+				t.Fatalf("wrong error, want %q, got %v", test.err, err)
+			}
+		})
+	}
+}
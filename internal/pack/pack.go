@@ -187,7 +187,9 @@ const (
 	// headerSize is the header's constant overhead (independent of #entries)
 	headerSize = headerLengthSize + crypto.Extension
 
-	// MaxHeaderSize is the max size of header including header-length field
+	// MaxHeaderSize is the max size of header including header-length field.
+	// Packers never write more entries than fit into this size (see
+	// HeaderFull), thus a larger header length can only be caused by damage.
 	MaxHeaderSize = 16*1024*1024 + headerLengthSize
 	// number of header enries to download as part of header-length request
 	eagerEntries = 15
@@ -265,6 +267,10 @@ func readHeader(rd io.ReaderAt, size int64) ([]byte, error) {
 	return b, nil
 }
 
+// ErrInvalidHeader is matched by errors.Is for all errors which are returned
+// because the header of a pack file is damaged or the file is not a pack file.
+var ErrInvalidHeader = errors.New("invalid pack header")
+
 // InvalidFileError is return when a file is found that is not a pack file.
 type InvalidFileError struct {
 	Message string
@@ -274,6 +280,11 @@ func (e InvalidFileError) Error() string {
 	return e.Message
 }
 
+// Is returns true if target is ErrInvalidHeader.
+func (e InvalidFileError) Is(target error) bool {
+	return target == ErrInvalidHeader
+}
+
 // List returns the list of entries found in a pack file and the length of the
 // header (including header size and crypto overhead)
 func List(k *crypto.Key, rd io.ReaderAt, size int64) (entries []restic.Blob, hdrSize uint32, err error) {
@@ -283,7 +294,7 @@ func List(k *crypto.Key, rd io.ReaderAt, size int64) (entries []restic.Blob, hdr
 	}
 
 	if len(buf) < crypto.CiphertextLength(0) {
-		return nil, 0, errors.New("invalid header, too small")
+		return nil, 0, errors.Wrap(InvalidFileError{Message: "header is too small"}, "List")
 	}
 
 	hdrSize = headerLengthSize + uint32(len(buf))
@@ -291,7 +302,7 @@ func List(k *crypto.Key, rd io.ReaderAt, size int64) (entries []restic.Blob, hdr
 	nonce, buf := buf[:k.NonceSize()], buf[k.NonceSize():]
 	buf, err = k.Open(buf[:0], nonce, buf, nil)
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, errors.Wrap(InvalidFileError{Message: fmt.Sprintf("decrypting header failed: %v", err)}, "List")
 	}
 
 	// might over allocate a bit if all blobs have EntrySize but only by a few percent
@@ -301,7 +312,7 @@ func List(k *crypto.Key, rd io.ReaderAt, size int64) (entries []restic.Blob, hdr
 	for len(buf) > 0 {
 		entry, headerSize, err := parseHeaderEntry(buf)
 		if err != nil {
-			return nil, 0, err
+			return nil, 0, errors.Wrap(InvalidFileError{Message: err.Error()}, "List")
 		}
 		entry.Offset = pos
 
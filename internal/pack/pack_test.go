@@ -5,6 +5,7 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/json"
 	"io"
 	"testing"
@@ -12,6 +13,7 @@ import (
 	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/backend/mem"
 	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/pack"
 	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
@@ -144,3 +146,75 @@ func TestShortPack(t *testing.T) {
 	rtest.OK(t, b.Save(context.TODO(), handle, restic.NewByteReader(packData, b.Hasher())))
 	verifyBlobs(t, bufs, k, backend.ReaderAt(context.TODO(), b, handle), packSize)
 }
+
+func TestListTruncatedHeader(t *testing.T) {
+	k := crypto.NewRandomKey()
+	bufs, packData, _ := newPack(t, k, testLens)
+
+	dataSize := 0
+	for _, b := range bufs {
+		dataSize += len(b.data)
+	}
+
+	for size := 0; size < len(packData); size++ {
+		if size > 100 && size < dataSize {
+			// only the end of the file matters for reading the header
+			continue
+		}
+		_, _, err := pack.List(k, bytes.NewReader(packData[:size]), int64(size))
+		rtest.Assert(t, errors.Is(err, pack.ErrInvalidHeader), "pack truncated to %d bytes: unexpected error %v", size, err)
+	}
+}
+
+func TestListBitFlippedHeader(t *testing.T) {
+	k := crypto.NewRandomKey()
+	bufs, packData, packSize := newPack(t, k, testLens)
+
+	dataSize := 0
+	for _, b := range bufs {
+		dataSize += len(b.data)
+	}
+
+	buf := make([]byte, len(packData))
+	for i := dataSize; i < len(packData); i++ {
+		for bit := 0; bit < 8; bit++ {
+			copy(buf, packData)
+			buf[i] ^= 1 << bit
+
+			_, _, err := pack.List(k, bytes.NewReader(buf), int64(packSize))
+			rtest.Assert(t, errors.Is(err, pack.ErrInvalidHeader), "bit %d of byte %d flipped: unexpected error %v", bit, i, err)
+		}
+	}
+}
+
+// largeFile simulates a huge file which only contains a header length field.
+type largeFile struct {
+	size int64
+	hlen uint32
+}
+
+func (f largeFile) ReadAt(p []byte, off int64) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	// write the part of the header length field which overlaps with p
+	var field [4]byte
+	binary.LittleEndian.PutUint32(field[:], f.hlen)
+	for i := range field {
+		pos := f.size - 4 + int64(i) - off
+		if pos >= 0 && pos < int64(len(p)) {
+			p[pos] = field[i]
+		}
+	}
+	return len(p), nil
+}
+
+func TestListOversizedHeader(t *testing.T) {
+	k := crypto.NewRandomKey()
+
+	for _, hlen := range []uint32{pack.MaxHeaderSize, 1 << 30, 1<<32 - 1} {
+		rd := largeFile{size: 1 << 40, hlen: hlen}
+		_, _, err := pack.List(k, rd, rd.size)
+		rtest.Assert(t, errors.Is(err, pack.ErrInvalidHeader), "header length %d: unexpected error %v", hlen, err)
+	}
+}
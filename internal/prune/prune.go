@@ -0,0 +1,835 @@
+// Package prune plans and executes the removal of data from a repository
+// which is no longer referenced by any snapshot.
+package prune
+
+import (
+	"context"
+	"math"
+	"sort"
+
+	"github.com/restic/restic/internal/cache"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/index"
+	"github.com/restic/restic/internal/pack"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui/progress"
+
+	"golang.org/x/sync/errgroup"
+)
+
+var ErrIndexIncomplete = errors.Fatal("index is not complete")
+var ErrPacksMissing = errors.Fatal("packs from index missing in repo")
+var ErrSizeNotMatching = errors.Fatal("pack size does not match calculated size from index")
+
+// Options collects the options for planning and executing a prune.
+type Options struct {
+	DryRun bool
+	// UnsafeRecovery deletes all index files before removing packs, which
+	// allows to recover a repository without free space.
+	UnsafeRecovery bool
+
+	// MaxUnusedBytes calculates the number of unused bytes which are
+	// tolerated after repacking, depending on the number of used bytes.
+	MaxUnusedBytes func(used uint64) (unused uint64)
+	MaxRepackBytes uint64
+
+	RepackCachableOnly bool
+	RepackSmall        bool
+	RepackUncompressed bool
+
+	// RecheckSnapshots lists the snapshots again before deleting data and
+	// aborts if a snapshot was added in the meantime.
+	RecheckSnapshots bool
+	// UsedBlobsCache is set if the blobs used by each snapshot are cached.
+	UsedBlobsCache *cache.Cache
+
+	// WithInterrupt, if set, returns a context derived from ctx which is
+	// canceled to stop the prune early. Deleting unreferenced packs and
+	// repacking are stopped, once the index is rewritten the remaining steps
+	// are completed.
+	WithInterrupt func(ctx context.Context) (context.Context, context.CancelFunc)
+}
+
+// Printer reports the messages and the progress of a prune.
+type Printer interface {
+	// P prints a message which is shown by default.
+	P(msg string, args ...interface{})
+	// V prints a verbose message.
+	V(msg string, args ...interface{})
+	// VV prints a message which is only shown with the highest verbosity.
+	VV(msg string, args ...interface{})
+	// E reports a warning.
+	E(msg string, args ...interface{})
+
+	// NewCounter returns a counter for the progress of a step of the prune
+	// which processes max items. It may return nil.
+	NewCounter(description string, max uint64) *progress.Counter
+	// NewPhaseCounter returns a counter for the phase of the prune with the
+	// given name, which processes maxItems items containing maxBytes bytes.
+	// It may return nil.
+	NewPhaseCounter(phase string, maxItems, maxBytes uint64, description string) *progress.Counter
+}
+
+// Stats contains the statistics of a planned prune.
+type Stats struct {
+	Blobs struct {
+		Used      uint
+		Duplicate uint
+		Unused    uint
+		Remove    uint
+		Repack    uint
+		Repackrm  uint
+	}
+	Size struct {
+		Used           uint64
+		Duplicate      uint64
+		DuplicateFreed uint64
+		Unused         uint64
+		Remove         uint64
+		Repack         uint64
+		Repackrm       uint64
+		Unref          uint64
+		Uncompressed   uint64
+	}
+	Packs struct {
+		Used       uint
+		Unused     uint
+		PartlyUsed uint
+		Unref      uint
+		Keep       uint
+		Repack     uint
+		Remove     uint
+	}
+}
+
+// Plan describes which packs are removed and repacked by a prune.
+type Plan struct {
+	removePacksFirst restic.IDSet          // packs to remove first (unreferenced packs)
+	repackPacks      restic.IDSet          // packs to repack
+	keepBlobs        restic.CountedBlobSet // blobs to keep during repacking
+	removePacks      restic.IDSet          // packs to remove
+	ignorePacks      restic.IDSet          // packs to ignore when rebuilding the index
+	snapshots        restic.IDSet          // snapshots known while planning
+
+	repo  restic.Repository
+	opts  Options
+	stats Stats
+}
+
+type packInfo struct {
+	usedBlobs    uint
+	unusedBlobs  uint
+	usedSize     uint64
+	unusedSize   uint64
+	tpe          restic.BlobType
+	uncompressed bool
+	// duplicateSize is the part of unusedSize which belongs to copies of
+	// blobs that are kept in another pack
+	duplicateSize uint64
+}
+
+type packInfoWithID struct {
+	ID restic.ID
+	packInfo
+	mustCompress bool
+}
+
+// NewPlan selects which files to rewrite and which to delete and which blobs
+// to keep. The blobs referenced by ignoreSnapshots are not kept. The index of
+// repo must be loaded.
+func NewPlan(ctx context.Context, opts Options, repo restic.Repository, ignoreSnapshots restic.IDSet, printer Printer) (*Plan, error) {
+	var stats Stats
+
+	usedBlobs, snapshots, err := getUsedBlobs(ctx, opts, repo, ignoreSnapshots, printer)
+	if err != nil {
+		return nil, err
+	}
+
+	printer.P("searching used packs...\n")
+	keepBlobs, indexPack, err := packInfoFromIndex(ctx, repo.Index(), usedBlobs, &stats, printer)
+	if err != nil {
+		return nil, err
+	}
+
+	printer.P("collecting packs for deletion and repacking\n")
+	plan, err := decidePackAction(ctx, opts, repo, indexPack, &stats, printer)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(plan.repackPacks) != 0 {
+		blobCount := keepBlobs.Len()
+		// when repacking, we do not want to keep blobs which are
+		// already contained in kept packs, so delete them from keepBlobs
+		repo.Index().Each(ctx, func(blob restic.PackedBlob) {
+			if plan.removePacks.Has(blob.PackID) || plan.repackPacks.Has(blob.PackID) {
+				return
+			}
+			keepBlobs.Delete(blob.BlobHandle)
+		})
+
+		if keepBlobs.Len() < blobCount/2 {
+			// replace with copy to shrink map to necessary size if there's a chance to benefit
+			keepBlobs = keepBlobs.Copy()
+		}
+	} else {
+		// keepBlobs is only needed if packs are repacked
+		keepBlobs = nil
+	}
+	plan.keepBlobs = keepBlobs
+	plan.snapshots = snapshots
+	plan.repo = repo
+	plan.opts = opts
+	plan.stats = stats
+
+	return plan, nil
+}
+
+// Stats returns the statistics of the plan.
+func (plan *Plan) Stats() Stats {
+	return plan.stats
+}
+
+// RemovedPacks returns the packs which are removed or repacked by the plan.
+func (plan *Plan) RemovedPacks() restic.IDSet {
+	packs := restic.NewIDSet()
+	packs.Merge(plan.removePacksFirst)
+	packs.Merge(plan.repackPacks)
+	packs.Merge(plan.removePacks)
+	return packs
+}
+
+func packInfoFromIndex(ctx context.Context, idx restic.MasterIndex, usedBlobs restic.CountedBlobSet, stats *Stats, printer Printer) (restic.CountedBlobSet, map[restic.ID]packInfo, error) {
+	// iterate over all blobs in index to find out which blobs are duplicates
+	// The counter in usedBlobs describes how many instances of the blob exist in the repository index
+	// Thus 0 == blob is missing, 1 == blob exists once, >= 2 == duplicates exist
+	// After selecting which copy of each duplicate blob to keep, all counters are set to 1.
+	idx.Each(ctx, func(blob restic.PackedBlob) {
+		bh := blob.BlobHandle
+		count, ok := usedBlobs[bh]
+		if ok {
+			if count < math.MaxUint8 {
+				// don't overflow, but saturate count at 255
+				// this can lead to a non-optimal pack selection, but won't cause
+				// problems otherwise
+				count++
+			}
+
+			usedBlobs[bh] = count
+		}
+	})
+
+	// Check if all used blobs have been found in index
+	missingBlobs := restic.NewBlobSet()
+	for bh, count := range usedBlobs {
+		if count == 0 {
+			// blob does not exist in any pack files
+			missingBlobs.Insert(bh)
+		}
+	}
+
+	if len(missingBlobs) != 0 {
+		printer.E("%v not found in the index\n\n"+
+			"Integrity check failed: Data seems to be missing.\n"+
+			"Will not start prune to prevent (additional) data loss!\n"+
+			"Please report this error (along with the output of the 'prune' run) at\n"+
+			"https://github.com/restic/restic/issues/new/choose\n", missingBlobs)
+		return nil, nil, ErrIndexIncomplete
+	}
+
+	indexPack := make(map[restic.ID]packInfo)
+
+	// save computed pack header size
+	for pid, hdrSize := range pack.Size(ctx, idx, true) {
+		// initialize tpe with NumBlobTypes to indicate it's not set
+		indexPack[pid] = packInfo{tpe: restic.NumBlobTypes, usedSize: uint64(hdrSize)}
+	}
+
+	hasDuplicates := false
+	// iterate over all blobs in index to generate packInfo
+	idx.Each(ctx, func(blob restic.PackedBlob) {
+		ip := indexPack[blob.PackID]
+
+		// Set blob type if not yet set
+		if ip.tpe == restic.NumBlobTypes {
+			ip.tpe = blob.Type
+		}
+
+		// mark mixed packs with "Invalid blob type"
+		if ip.tpe != blob.Type {
+			ip.tpe = restic.InvalidBlob
+		}
+
+		bh := blob.BlobHandle
+		size := uint64(blob.Length)
+		dupCount := usedBlobs[bh]
+		switch {
+		case dupCount >= 2:
+			hasDuplicates = true
+			// mark as unused for now, we will later on select one copy
+			ip.unusedSize += size
+			ip.unusedBlobs++
+
+			ip.duplicateSize += size
+
+			// count as duplicate, will later on change one copy to be counted as used
+			stats.Size.Duplicate += size
+			stats.Blobs.Duplicate++
+		case dupCount == 1: // used blob, not duplicate
+			ip.usedSize += size
+			ip.usedBlobs++
+
+			stats.Size.Used += size
+			stats.Blobs.Used++
+		default: // unused blob
+			ip.unusedSize += size
+			ip.unusedBlobs++
+
+			stats.Size.Unused += size
+			stats.Blobs.Unused++
+		}
+		if !blob.IsCompressed() {
+			ip.uncompressed = true
+		}
+		// update indexPack
+		indexPack[blob.PackID] = ip
+	})
+
+	// if duplicate blobs exist, exactly one copy of each is marked as used, all
+	// other copies remain unused. The kept copy is the one in the pack with the
+	// highest ratio of used data, as this pack is the least likely to be repacked.
+	if hasDuplicates {
+		// iterate again over all blobs in index (this is pretty cheap, all in-mem)
+		keepCopy := make(map[restic.BlobHandle]restic.ID)
+		idx.Each(ctx, func(blob restic.PackedBlob) {
+			bh := blob.BlobHandle
+			if usedBlobs[bh] < 2 {
+				return
+			}
+
+			current, ok := keepCopy[bh]
+			if !ok || hasHigherKeepRatio(indexPack[blob.PackID], indexPack[current]) {
+				keepCopy[bh] = blob.PackID
+			}
+		})
+
+		idx.Each(ctx, func(blob restic.PackedBlob) {
+			bh := blob.BlobHandle
+			packID, ok := keepCopy[bh]
+			if !ok || packID != blob.PackID {
+				return
+			}
+			// only keep a single copy even if a pack contains the blob multiple times
+			delete(keepCopy, bh)
+
+			ip := indexPack[blob.PackID]
+			size := uint64(blob.Length)
+			// transition the selected copy to used
+			ip.usedSize += size
+			ip.usedBlobs++
+			ip.unusedSize -= size
+			ip.unusedBlobs--
+			ip.duplicateSize -= size
+			// same for the global statistics
+			stats.Size.Used += size
+			stats.Blobs.Used++
+			stats.Size.Duplicate -= size
+			stats.Blobs.Duplicate--
+			// let other occurences remain marked as unused
+			usedBlobs[bh] = 1
+			// update indexPack
+			indexPack[blob.PackID] = ip
+		})
+	}
+
+	// Sanity check. If no duplicates exist, all blobs have value 1. After handling
+	// duplicates, this also applies to duplicates.
+	for _, count := range usedBlobs {
+		if count != 1 {
+			panic("internal error during blob selection")
+		}
+	}
+
+	return usedBlobs, indexPack, nil
+}
+
+// hasHigherKeepRatio returns whether a larger fraction of pack a is used
+// compared to pack b.
+func hasHigherKeepRatio(a, b packInfo) bool {
+	// compare usedA / totalA > usedB / totalB without divisions
+	return a.usedSize*(b.usedSize+b.unusedSize) > b.usedSize*(a.usedSize+a.unusedSize)
+}
+
+func decidePackAction(ctx context.Context, opts Options, repo restic.Repository, indexPack map[restic.ID]packInfo, stats *Stats, printer Printer) (*Plan, error) {
+	removePacksFirst := restic.NewIDSet()
+	removePacks := restic.NewIDSet()
+	repackPacks := restic.NewIDSet()
+
+	var repackCandidates []packInfoWithID
+	var repackSmallCandidates []packInfoWithID
+	repoVersion := repo.Config().Version
+	// only repack very small files by default
+	targetPackSize := repo.PackSize() / 25
+	if opts.RepackSmall {
+		// consider files with at least 80% of the target size as large enough
+		targetPackSize = repo.PackSize() / 5 * 4
+	}
+
+	// loop over all packs and decide what to do
+	bar := printer.NewCounter("packs processed", uint64(len(indexPack)))
+	err := repo.List(ctx, restic.PackFile, func(id restic.ID, packSize int64) error {
+		p, ok := indexPack[id]
+		if !ok {
+			// Pack was not referenced in index and is not used  => immediately remove!
+			printer.V("will remove pack %v as it is unused and not indexed\n", id.Str())
+			removePacksFirst.Insert(id)
+			stats.Size.Unref += uint64(packSize)
+			return nil
+		}
+
+		if p.unusedSize+p.usedSize != uint64(packSize) && p.usedBlobs != 0 {
+			// Pack size does not fit and pack is needed => error
+			// If the pack is not needed, this is no error, the pack can
+			// and will be simply removed, see below.
+			printer.E("pack %s: calculated size %d does not match real size %d\nRun 'restic repair index'.\n",
+				id.Str(), p.unusedSize+p.usedSize, packSize)
+			return ErrSizeNotMatching
+		}
+
+		// statistics
+		switch {
+		case p.usedBlobs == 0:
+			stats.Packs.Unused++
+		case p.unusedBlobs == 0:
+			stats.Packs.Used++
+		default:
+			stats.Packs.PartlyUsed++
+		}
+
+		if p.uncompressed {
+			stats.Size.Uncompressed += p.unusedSize + p.usedSize
+		}
+		mustCompress := false
+		if repoVersion >= 2 {
+			// repo v2: always repack tree blobs if uncompressed
+			// compress data blobs if requested
+			mustCompress = (p.tpe == restic.TreeBlob || opts.RepackUncompressed) && p.uncompressed
+		}
+
+		// decide what to do
+		switch {
+		case p.usedBlobs == 0:
+			// All blobs in pack are no longer used => remove pack!
+			removePacks.Insert(id)
+			stats.Blobs.Remove += p.unusedBlobs
+			stats.Size.Remove += p.unusedSize
+			stats.Size.DuplicateFreed += p.duplicateSize
+
+		case opts.RepackCachableOnly && p.tpe == restic.DataBlob:
+			// if this is a data pack and --repack-cacheable-only is set => keep pack!
+			stats.Packs.Keep++
+
+		case p.unusedBlobs == 0 && p.tpe != restic.InvalidBlob && !mustCompress:
+			if packSize >= int64(targetPackSize) {
+				// All blobs in pack are used and not mixed => keep pack!
+				stats.Packs.Keep++
+			} else {
+				repackSmallCandidates = append(repackSmallCandidates, packInfoWithID{ID: id, packInfo: p, mustCompress: mustCompress})
+			}
+
+		default:
+			// all other packs are candidates for repacking
+			repackCandidates = append(repackCandidates, packInfoWithID{ID: id, packInfo: p, mustCompress: mustCompress})
+		}
+
+		delete(indexPack, id)
+		bar.Add(1)
+		return nil
+	})
+	bar.Done()
+	if err != nil {
+		return nil, err
+	}
+
+	// At this point indexPacks contains only missing packs!
+
+	// missing packs that are not needed can be ignored
+	ignorePacks := restic.NewIDSet()
+	for id, p := range indexPack {
+		if p.usedBlobs == 0 {
+			ignorePacks.Insert(id)
+			stats.Blobs.Remove += p.unusedBlobs
+			stats.Size.Remove += p.unusedSize
+			stats.Size.DuplicateFreed += p.duplicateSize
+			delete(indexPack, id)
+		}
+	}
+
+	if len(indexPack) != 0 {
+		printer.E("The index references %d needed pack files which are missing from the repository:\n", len(indexPack))
+		for id := range indexPack {
+			printer.E("  %v\n", id)
+		}
+		return nil, ErrPacksMissing
+	}
+	if len(ignorePacks) != 0 {
+		printer.E("Missing but unneeded pack files are referenced in the index, will be repaired\n")
+		for id := range ignorePacks {
+			printer.E("will forget missing pack file %v\n", id)
+		}
+	}
+
+	if len(repackSmallCandidates) < 10 {
+		// too few small files to be worth the trouble, this also prevents endlessly repacking
+		// if there is just a single pack file below the target size
+		stats.Packs.Keep += uint(len(repackSmallCandidates))
+	} else {
+		repackCandidates = append(repackCandidates, repackSmallCandidates...)
+	}
+
+	// Sort repackCandidates such that packs with highest ratio unused/used space are picked first.
+	// This is equivalent to sorting by unused / total space.
+	// Instead of unused[i] / used[i] > unused[j] / used[j] we use
+	// unused[i] * used[j] > unused[j] * used[i] as uint32*uint32 < uint64
+	// Moreover packs containing trees and too small packs are sorted to the beginning
+	sort.Slice(repackCandidates, func(i, j int) bool {
+		pi := repackCandidates[i].packInfo
+		pj := repackCandidates[j].packInfo
+		switch {
+		case pi.tpe != restic.DataBlob && pj.tpe == restic.DataBlob:
+			return true
+		case pj.tpe != restic.DataBlob && pi.tpe == restic.DataBlob:
+			return false
+		case pi.unusedSize+pi.usedSize < uint64(targetPackSize) && pj.unusedSize+pj.usedSize >= uint64(targetPackSize):
+			return true
+		case pj.unusedSize+pj.usedSize < uint64(targetPackSize) && pi.unusedSize+pi.usedSize >= uint64(targetPackSize):
+			return false
+		}
+		return pi.unusedSize*pj.usedSize > pj.unusedSize*pi.usedSize
+	})
+
+	repack := func(id restic.ID, p packInfo) {
+		repackPacks.Insert(id)
+		stats.Blobs.Repack += p.unusedBlobs + p.usedBlobs
+		stats.Size.Repack += p.unusedSize + p.usedSize
+		stats.Blobs.Repackrm += p.unusedBlobs
+		stats.Size.Repackrm += p.unusedSize
+		stats.Size.DuplicateFreed += p.duplicateSize
+		if p.uncompressed {
+			stats.Size.Uncompressed -= p.unusedSize + p.usedSize
+		}
+	}
+
+	// calculate limit for number of unused bytes in the repo after repacking
+	maxUnusedSizeAfter := opts.MaxUnusedBytes(stats.Size.Used)
+
+	for _, p := range repackCandidates {
+		reachedUnusedSizeAfter := (stats.Size.Unused-stats.Size.Remove-stats.Size.Repackrm < maxUnusedSizeAfter)
+		reachedRepackSize := stats.Size.Repack+p.unusedSize+p.usedSize >= opts.MaxRepackBytes
+		packIsLargeEnough := p.unusedSize+p.usedSize >= uint64(targetPackSize)
+
+		switch {
+		case reachedRepackSize:
+			stats.Packs.Keep++
+
+		case p.tpe != restic.DataBlob, p.mustCompress:
+			// repacking non-data packs / uncompressed-trees is only limited by repackSize
+			repack(p.ID, p.packInfo)
+
+		case reachedUnusedSizeAfter && packIsLargeEnough:
+			// for all other packs stop repacking if tolerated unused size is reached.
+			stats.Packs.Keep++
+
+		default:
+			repack(p.ID, p.packInfo)
+		}
+	}
+
+	stats.Packs.Unref = uint(len(removePacksFirst))
+	stats.Packs.Repack = uint(len(repackPacks))
+	stats.Packs.Remove = uint(len(removePacks))
+
+	if repo.Config().Version < 2 {
+		// compression not supported for repository format version 1
+		stats.Size.Uncompressed = 0
+	}
+
+	return &Plan{removePacksFirst: removePacksFirst,
+		removePacks: removePacks,
+		repackPacks: repackPacks,
+		ignorePacks: ignorePacks,
+	}, nil
+}
+
+// Execute does the actual pruning:
+// - remove unreferenced packs first
+// - repack given pack files while keeping the given blobs
+// - rebuild the index while ignoring all files that will be deleted
+// - delete the files
+// plan.removePacks and plan.ignorePacks are modified in this function.
+func (plan *Plan) Execute(ctx context.Context, printer Printer) (err error) {
+	opts := plan.opts
+	repo := plan.repo
+
+	if opts.DryRun {
+		printer.V("Repeated prune dry-runs can report slightly different amounts of data to keep or repack. This is expected behavior.\n\n")
+		if len(plan.removePacksFirst) > 0 {
+			printer.V("Would have removed the following unreferenced packs:\n%v\n\n", plan.removePacksFirst)
+		}
+		printer.V("Would have repacked and removed the following packs:\n%v\n\n", plan.repackPacks)
+		printer.V("Would have removed the following no longer used packs:\n%v\n\n", plan.removePacks)
+		// Always quit here if DryRun was set!
+		return nil
+	}
+
+	// deleting unreferenced packs and repacking can be stopped safely. Once
+	// the index is rewritten, the remaining steps are completed so that the
+	// repository does not contain duplicate index entries.
+	interruptCtx := ctx
+	if opts.WithInterrupt != nil {
+		var stopInterrupt context.CancelFunc
+		interruptCtx, stopInterrupt = opts.WithInterrupt(ctx)
+		defer stopInterrupt()
+	}
+	errInterrupted := errors.Fatal("prune interrupted before the index was rewritten, run prune again to remove unused data")
+
+	// unreferenced packs can be safely deleted first
+	if len(plan.removePacksFirst) != 0 {
+		if err := recheckSnapshots(ctx, opts, repo, plan.snapshots); err != nil {
+			return err
+		}
+		printer.P("deleting unreferenced packs\n")
+		_ = deleteFiles(interruptCtx, true, repo, plan.removePacksFirst, restic.PackFile, printer)
+	}
+
+	if len(plan.repackPacks) != 0 {
+		printer.P("repacking packs\n")
+		bar := printer.NewPhaseCounter("repack", uint64(len(plan.repackPacks)), repackSize(repo.Index(), plan.keepBlobs), "packs repacked")
+		_, err := repository.Repack(interruptCtx, repo, repo, plan.repackPacks, plan.keepBlobs, true, bar)
+		bar.Done()
+		if err != nil && interruptCtx.Err() != nil && ctx.Err() == nil {
+			return errInterrupted
+		}
+		if err != nil {
+			return errors.Fatal(err.Error())
+		}
+
+		// Also remove repacked packs
+		plan.removePacks.Merge(plan.repackPacks)
+
+		if len(plan.keepBlobs) != 0 {
+			printer.E("%v was not repacked\n\n"+
+				"Integrity check failed.\n"+
+				"Please report this error (along with the output of the 'prune' run) at\n"+
+				"https://github.com/restic/restic/issues/new/choose\n", plan.keepBlobs)
+			return errors.Fatal("internal error: blobs were not repacked")
+		}
+
+		// allow GC of the blob set
+		plan.keepBlobs = nil
+	}
+
+	if interruptCtx.Err() != nil && ctx.Err() == nil {
+		return errInterrupted
+	}
+
+	// the new packs and index files written while repacking are harmless to
+	// keep, everything from here on removes data
+	if opts.UnsafeRecovery || len(plan.ignorePacks) != 0 || len(plan.removePacks) != 0 {
+		if err := recheckSnapshots(ctx, opts, repo, plan.snapshots); err != nil {
+			return err
+		}
+	}
+
+	if len(plan.ignorePacks) == 0 {
+		plan.ignorePacks = plan.removePacks
+	} else {
+		plan.ignorePacks.Merge(plan.removePacks)
+	}
+
+	if opts.UnsafeRecovery {
+		printer.P("deleting index files\n")
+		indexFiles := repo.Index().(*index.MasterIndex).IDs()
+		err = deleteFiles(ctx, false, repo, indexFiles, restic.IndexFile, printer)
+		if err != nil {
+			return errors.Fatalf("%s", err)
+		}
+	} else if len(plan.ignorePacks) != 0 {
+		err = RebuildIndexFiles(ctx, repo, plan.ignorePacks, nil, printer)
+		if err != nil {
+			return errors.Fatalf("%s", err)
+		}
+	}
+
+	if len(plan.removePacks) != 0 {
+		printer.P("removing %d old packs\n", len(plan.removePacks))
+		_ = deleteFiles(ctx, true, repo, plan.removePacks, restic.PackFile, printer)
+	}
+
+	if opts.UnsafeRecovery {
+		_, err = writeIndexFiles(ctx, repo, plan.ignorePacks, nil, printer)
+		if err != nil {
+			return errors.Fatalf("%s", err)
+		}
+	}
+
+	printer.P("done\n")
+	return nil
+}
+
+// recheckSnapshots lists the snapshots again and returns an error if a
+// snapshot which is not contained in known was added since planning the prune,
+// for example by a backup which ignored the lock. Data referenced by such a
+// snapshot might otherwise be deleted.
+func recheckSnapshots(ctx context.Context, opts Options, repo restic.Repository, known restic.IDSet) error {
+	if !opts.RecheckSnapshots {
+		return nil
+	}
+
+	debug.Log("checking for snapshots added since planning")
+	err := repo.List(ctx, restic.SnapshotFile, func(id restic.ID, size int64) error {
+		if !known.Has(id) {
+			return errors.Fatalf("snapshot %v was added while pruning, aborting before deleting any data.\n"+
+				"The repository is intact, run prune again to remove unused data", id.Str())
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.IsFatal(err) {
+			return err
+		}
+		return errors.Fatalf("failed to list snapshots before deleting data: %v", err)
+	}
+	return nil
+}
+
+func writeIndexFiles(ctx context.Context, repo restic.Repository, removePacks restic.IDSet, extraObsolete restic.IDs, printer Printer) (restic.IDSet, error) {
+	printer.P("rebuilding index\n")
+
+	bar := printer.NewPhaseCounter("rebuild-index", 0, 0, "packs processed")
+	obsoleteIndexes, err := repo.Index().Save(ctx, repo, removePacks, extraObsolete, bar)
+	bar.Done()
+	return obsoleteIndexes, err
+}
+
+// RebuildIndexFiles writes new index files for all packs in the index except
+// removePacks and deletes the old index files and extraObsolete.
+func RebuildIndexFiles(ctx context.Context, repo restic.Repository, removePacks restic.IDSet, extraObsolete restic.IDs, printer Printer) error {
+	obsoleteIndexes, err := writeIndexFiles(ctx, repo, removePacks, extraObsolete, printer)
+	if err != nil {
+		return err
+	}
+
+	printer.P("deleting obsolete index files\n")
+	return deleteFiles(ctx, false, repo, obsoleteIndexes, restic.IndexFile, printer)
+}
+
+// repackSize returns the amount of data which is copied when repacking the
+// given blobs.
+func repackSize(idx restic.MasterIndex, keepBlobs restic.CountedBlobSet) uint64 {
+	var size uint64
+	for h := range keepBlobs {
+		if pbs := idx.Lookup(h); len(pbs) > 0 {
+			size += uint64(pbs[0].DataLength())
+		}
+	}
+	return size
+}
+
+// deleteFiles deletes the given fileList of fileType in parallel. If
+// ignoreError is set, it prints a warning if there was an error, otherwise it
+// aborts.
+func deleteFiles(ctx context.Context, ignoreError bool, repo restic.Repository, fileList restic.IDSet, fileType restic.FileType, printer Printer) error {
+	fileChan := make(chan restic.ID)
+	wg, ctx := errgroup.WithContext(ctx)
+	wg.Go(func() error {
+		defer close(fileChan)
+		for id := range fileList {
+			select {
+			case fileChan <- id:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+
+	bar := printer.NewCounter("files deleted", uint64(len(fileList)))
+	defer bar.Done()
+	// deleting files is IO-bound
+	workerCount := repo.Connections()
+	for i := 0; i < int(workerCount); i++ {
+		wg.Go(func() error {
+			for id := range fileChan {
+				h := restic.Handle{Type: fileType, Name: id.String()}
+				err := repo.Backend().Remove(ctx, h)
+				if err != nil {
+					printer.E("unable to remove %v from the repository\n", h)
+					if !ignoreError {
+						return err
+					}
+				}
+				printer.VV("removed %v\n", h)
+				bar.Add(1)
+			}
+			return nil
+		})
+	}
+	return wg.Wait()
+}
+
+// getUsedBlobs returns the blobs referenced by all snapshots except
+// ignoreSnapshots. The IDs of the loaded snapshots and of ignoreSnapshots are
+// returned in snapshots.
+func getUsedBlobs(ctx context.Context, opts Options, repo restic.Repository, ignoreSnapshots restic.IDSet, printer Printer) (usedBlobs restic.CountedBlobSet, snapshots restic.IDSet, err error) {
+	var snapshotTrees restic.IDs
+	trees := make(map[restic.ID]restic.ID)
+	snapshots = restic.NewIDSet()
+	snapshots.Merge(ignoreSnapshots)
+	printer.P("loading all snapshots...\n")
+	err = restic.ForAllSnapshots(ctx, repo.Backend(), repo, ignoreSnapshots,
+		func(id restic.ID, sn *restic.Snapshot, err error) error {
+			if err != nil {
+				debug.Log("failed to load snapshot %v (error %v)", id, err)
+				return err
+			}
+			debug.Log("add snapshot %v (tree %v)", id, *sn.Tree)
+			snapshots.Insert(id)
+			snapshotTrees = append(snapshotTrees, *sn.Tree)
+			trees[id] = *sn.Tree
+			return nil
+		})
+	if err != nil {
+		return nil, nil, errors.Fatalf("failed loading snapshot: %v", err)
+	}
+
+	if opts.UsedBlobsCache != nil {
+		usedBlobs, err = findUsedBlobsCached(ctx, repo, opts.UsedBlobsCache, trees, printer)
+		if err != nil {
+			if repo.Backend().IsNotExist(err) {
+				return nil, nil, errors.Fatal("unable to load a tree from the repository: " + err.Error())
+			}
+			return nil, nil, err
+		}
+		return usedBlobs, snapshots, nil
+	}
+
+	printer.P("finding data that is still in use for %d snapshots\n", len(snapshotTrees))
+
+	usedBlobs = restic.NewCountedBlobSet()
+
+	bar := printer.NewPhaseCounter("find-used-blobs", uint64(len(snapshotTrees)), 0, "snapshots")
+	defer bar.Done()
+
+	err = restic.FindUsedBlobs(ctx, repo, snapshotTrees, usedBlobs, bar)
+	if err != nil {
+		if repo.Backend().IsNotExist(err) {
+			return nil, nil, errors.Fatal("unable to load a tree from the repository: " + err.Error())
+		}
+
+		return nil, nil, err
+	}
+	return usedBlobs, snapshots, nil
+}
@@ -0,0 +1,177 @@
+package prune
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/cache"
+	"github.com/restic/restic/internal/index"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+	"github.com/restic/restic/internal/ui/progress"
+)
+
+// testPrinter logs all messages of a prune.
+type testPrinter struct {
+	t testing.TB
+}
+
+func (p testPrinter) P(msg string, args ...interface{})  { p.t.Logf(msg, args...) }
+func (p testPrinter) V(msg string, args ...interface{})  { p.t.Logf(msg, args...) }
+func (p testPrinter) VV(msg string, args ...interface{}) { p.t.Logf(msg, args...) }
+func (p testPrinter) E(msg string, args ...interface{})  { p.t.Logf(msg, args...) }
+
+func (p testPrinter) NewCounter(description string, max uint64) *progress.Counter {
+	return nil
+}
+
+func (p testPrinter) NewPhaseCounter(phase string, maxItems, maxBytes uint64, description string) *progress.Counter {
+	return nil
+}
+
+func TestPackInfoFromIndexDuplicates(t *testing.T) {
+	blob := func(length uint) restic.Blob {
+		return restic.Blob{
+			BlobHandle: restic.BlobHandle{Type: restic.DataBlob, ID: restic.NewRandomID()},
+			Length:     length,
+		}
+	}
+
+	dup := blob(100)
+	usedA, usedB1, usedB2 := blob(100), blob(100), blob(100)
+	unusedA := blob(5000)
+
+	packA, packB, packC := restic.NewRandomID(), restic.NewRandomID(), restic.NewRandomID()
+	idx := index.NewMasterIndex()
+	// pack A is mostly unused, pack B is completely used and pack C only
+	// contains a copy of the duplicate blob
+	idx.StorePack(packA, []restic.Blob{dup, usedA, unusedA})
+	idx.StorePack(packB, []restic.Blob{usedB1, dup, usedB2})
+	idx.StorePack(packC, []restic.Blob{dup})
+
+	usedBlobs := restic.NewCountedBlobSet(dup.BlobHandle, usedA.BlobHandle, usedB1.BlobHandle, usedB2.BlobHandle)
+	var stats Stats
+	keepBlobs, indexPack, err := packInfoFromIndex(context.TODO(), idx, usedBlobs, &stats, testPrinter{t})
+	rtest.OK(t, err)
+
+	// the copy in pack B is kept, as pack B has the highest ratio of used data
+	rtest.Equals(t, uint(3), indexPack[packB].usedBlobs)
+	rtest.Equals(t, uint(0), indexPack[packB].unusedBlobs)
+	rtest.Equals(t, uint64(0), indexPack[packB].duplicateSize)
+
+	rtest.Equals(t, uint(1), indexPack[packA].usedBlobs)
+	rtest.Equals(t, uint(2), indexPack[packA].unusedBlobs)
+	rtest.Equals(t, uint64(100), indexPack[packA].duplicateSize)
+
+	rtest.Equals(t, uint(0), indexPack[packC].usedBlobs)
+	rtest.Equals(t, uint(1), indexPack[packC].unusedBlobs)
+	rtest.Equals(t, uint64(100), indexPack[packC].duplicateSize)
+
+	rtest.Equals(t, uint(4), stats.Blobs.Used)
+	rtest.Equals(t, uint(2), stats.Blobs.Duplicate)
+	rtest.Equals(t, uint64(200), stats.Size.Duplicate)
+	rtest.Equals(t, uint(1), stats.Blobs.Unused)
+
+	// every used blob must be kept exactly once
+	rtest.Equals(t, 4, keepBlobs.Len())
+	for _, count := range keepBlobs {
+		rtest.Equals(t, uint8(1), count)
+	}
+}
+
+func testCompareUsedBlobs(t *testing.T, repo restic.Repository, c *cache.Cache, ignoreSnapshots restic.IDSet) {
+	printer := testPrinter{t}
+	want, wantSnapshots, err := getUsedBlobs(context.TODO(), Options{}, repo, ignoreSnapshots, printer)
+	rtest.OK(t, err)
+	used, snapshots, err := getUsedBlobs(context.TODO(), Options{UsedBlobsCache: c}, repo, ignoreSnapshots, printer)
+	rtest.OK(t, err)
+
+	rtest.Equals(t, wantSnapshots, snapshots)
+	rtest.Equals(t, want.Len(), used.Len())
+	for _, h := range want.List() {
+		rtest.Assert(t, used.Has(h), "blob %v missing from the cached result", h)
+	}
+
+	// the cache must only contain the snapshots which are still in use
+	cached := restic.NewIDSet()
+	for id := range loadUsedBlobsCache(c, repo.Key(), printer).snapshots {
+		cached.Insert(id)
+	}
+	rtest.Equals(t, wantSnapshots.Sub(ignoreSnapshots), cached)
+}
+
+func TestUsedBlobsCached(t *testing.T) {
+	repo := repository.TestRepository(t)
+	c, err := cache.New(repo.Config().ID, rtest.TempDir(t))
+	rtest.OK(t, err)
+
+	var ids restic.IDs
+	for i := 0; i < 3; i++ {
+		sn := restic.TestCreateSnapshot(t, repo, time.Unix(1460289341+int64(i)*3600, 0), 2)
+		ids = append(ids, *sn.ID())
+	}
+
+	// fill the cache, then read all snapshots from it
+	testCompareUsedBlobs(t, repo, c, restic.NewIDSet())
+	testCompareUsedBlobs(t, repo, c, restic.NewIDSet())
+	// snapshots which are about to be removed are dropped from the cache
+	testCompareUsedBlobs(t, repo, c, restic.NewIDSet(ids[0]))
+
+	// new snapshots are added to the cache
+	restic.TestCreateSnapshot(t, repo, time.Unix(1460289341+10*3600, 0), 2)
+	testCompareUsedBlobs(t, repo, c, restic.NewIDSet())
+}
+
+// treeLoadCounter counts how often each tree is loaded.
+type treeLoadCounter struct {
+	restic.Repository
+	m     sync.Mutex
+	loads map[restic.ID]int
+}
+
+func (l *treeLoadCounter) LoadBlob(ctx context.Context, t restic.BlobType, id restic.ID, buf []byte) ([]byte, error) {
+	if t == restic.TreeBlob {
+		l.m.Lock()
+		l.loads[id]++
+		l.m.Unlock()
+	}
+	return l.Repository.LoadBlob(ctx, t, id, buf)
+}
+
+func TestUsedBlobsCachedLoadTreesOnce(t *testing.T) {
+	repo := repository.TestRepository(t)
+	c, err := cache.New(repo.Config().ID, rtest.TempDir(t))
+	rtest.OK(t, err)
+
+	snapshots := make(map[restic.ID]restic.ID)
+	for i := 0; i < 2; i++ {
+		sn := restic.TestCreateSnapshot(t, repo, time.Unix(1460289341+int64(i)*3600, 0), 2)
+		snapshots[*sn.ID()] = *sn.Tree
+
+		// a second snapshot of the same tree
+		sn.Time = sn.Time.Add(time.Minute)
+		id, err := restic.SaveSnapshot(context.TODO(), repo, sn)
+		rtest.OK(t, err)
+		snapshots[id] = *sn.Tree
+	}
+
+	loader := &treeLoadCounter{Repository: repo, loads: make(map[restic.ID]int)}
+	used, err := findUsedBlobsCached(context.TODO(), loader, c, snapshots, testPrinter{t})
+	rtest.OK(t, err)
+
+	for id, n := range loader.loads {
+		rtest.Assert(t, n == 1, "tree %v was loaded %d times", id, n)
+	}
+	cached := loadUsedBlobsCache(c, repo.Key(), testPrinter{t})
+	for id, tree := range snapshots {
+		want := restic.NewBlobSet()
+		rtest.OK(t, restic.FindUsedBlobs(context.TODO(), repo, restic.IDs{tree}, want, nil))
+		rtest.Equals(t, len(want), len(cached.snapshots[id]))
+		for h := range want {
+			rtest.Assert(t, used.Has(h), "blob %v is missing", h)
+		}
+	}
+}
@@ -0,0 +1,445 @@
+package prune
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"math/bits"
+	"sort"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/restic/restic/internal/cache"
+	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// usedBlobsCacheName is the name of the sidecar file in the cache which
+// contains the blobs used by each snapshot.
+const usedBlobsCacheName = "prune-used-blobs"
+
+// usedBlobsCacheVersion is incremented for incompatible changes of the
+// encoding, older files are then ignored.
+const usedBlobsCacheVersion = 2
+
+// blobBitmap contains a bit for each entry of the blob table of a
+// usedBlobsCache.
+type blobBitmap []uint64
+
+func newBlobBitmap(n int) blobBitmap {
+	return make(blobBitmap, (n+63)/64)
+}
+
+func (b blobBitmap) set(i uint32) {
+	b[i/64] |= 1 << (i % 64)
+}
+
+func (b blobBitmap) each(fn func(i uint32)) {
+	for w, word := range b {
+		for word != 0 {
+			bit := bits.TrailingZeros64(word)
+			fn(uint32(w*64 + bit))
+			word &^= 1 << bit
+		}
+	}
+}
+
+// usedBlobsCache records the blobs used by each snapshot. Snapshots are
+// identified by the ID of their file, a rewritten snapshot is therefore
+// treated as a new one. All blobs are stored once in a table, each snapshot
+// references its blobs by a sorted list of indices into that table.
+type usedBlobsCache struct {
+	blobs     restic.BlobHandles
+	index     map[restic.BlobHandle]uint32
+	snapshots map[restic.ID][]uint32
+}
+
+func newUsedBlobsCache() *usedBlobsCache {
+	return &usedBlobsCache{
+		index:     make(map[restic.BlobHandle]uint32),
+		snapshots: make(map[restic.ID][]uint32),
+	}
+}
+
+// lookup returns the index of h in the blob table, h is added if necessary.
+func (c *usedBlobsCache) lookup(h restic.BlobHandle) uint32 {
+	i, ok := c.index[h]
+	if !ok {
+		i = uint32(len(c.blobs))
+		c.blobs = append(c.blobs, h)
+		c.index[h] = i
+	}
+	return i
+}
+
+// add records the blobs used by the snapshot id.
+func (c *usedBlobsCache) add(id restic.ID, blobs restic.BlobSet) {
+	used := make([]uint32, 0, len(blobs))
+	for h := range blobs {
+		used = append(used, c.lookup(h))
+	}
+	c.set(id, used)
+}
+
+// set records the blobs used by the snapshot id as indices into the blob
+// table, used may contain duplicates and is modified.
+func (c *usedBlobsCache) set(id restic.ID, used []uint32) {
+	sort.Slice(used, func(i, j int) bool {
+		return used[i] < used[j]
+	})
+	unique := used[:0]
+	for i, idx := range used {
+		if i == 0 || idx != used[i-1] {
+			unique = append(unique, idx)
+		}
+	}
+	c.snapshots[id] = unique
+}
+
+// has returns true if the blobs used by snapshot id are known.
+func (c *usedBlobsCache) has(id restic.ID) bool {
+	_, ok := c.snapshots[id]
+	return ok
+}
+
+// retain removes all snapshots not contained in ids.
+func (c *usedBlobsCache) retain(ids restic.IDSet) {
+	for id := range c.snapshots {
+		if !ids.Has(id) {
+			delete(c.snapshots, id)
+		}
+	}
+}
+
+// usedBitmap returns the blobs used by snapshots as a bitmap over the blob
+// table.
+func (c *usedBlobsCache) usedBitmap(snapshots restic.IDSet) blobBitmap {
+	used := newBlobBitmap(len(c.blobs))
+	for id := range snapshots {
+		for _, i := range c.snapshots[id] {
+			used.set(i)
+		}
+	}
+	return used
+}
+
+// insertUsed adds the blobs used by snapshots to blobs.
+func (c *usedBlobsCache) insertUsed(snapshots restic.IDSet, blobs restic.CountedBlobSet) {
+	c.usedBitmap(snapshots).each(func(i uint32) {
+		blobs.Insert(c.blobs[i])
+	})
+}
+
+// compact removes the blobs which are not used by any snapshot from the
+// table.
+func (c *usedBlobsCache) compact() {
+	all := make(restic.IDSet, len(c.snapshots))
+	for id := range c.snapshots {
+		all.Insert(id)
+	}
+
+	// map the used blobs to their index in the compacted table, the order
+	// of the blobs and thus of the indices of each snapshot is preserved
+	remap := make([]uint32, len(c.blobs))
+	var blobs restic.BlobHandles
+	c.usedBitmap(all).each(func(i uint32) {
+		remap[i] = uint32(len(blobs))
+		blobs = append(blobs, c.blobs[i])
+	})
+	if len(blobs) == len(c.blobs) {
+		return
+	}
+
+	index := make(map[restic.BlobHandle]uint32, len(blobs))
+	for i, h := range blobs {
+		index[h] = uint32(i)
+	}
+	for _, used := range c.snapshots {
+		for j, i := range used {
+			used[j] = remap[i]
+		}
+	}
+	c.blobs = blobs
+	c.index = index
+}
+
+// encode returns the binary representation of c. It consists of the version,
+// the blob table as a list of blob types and IDs, followed by the snapshot IDs
+// and the indices of their blobs. The indices of each snapshot are delta
+// encoded. Numbers are encoded as varints.
+func (c *usedBlobsCache) encode() []byte {
+	var buf bytes.Buffer
+	var tmp [binary.MaxVarintLen64]byte
+	putUvarint := func(v uint64) {
+		buf.Write(tmp[:binary.PutUvarint(tmp[:], v)])
+	}
+
+	putUvarint(usedBlobsCacheVersion)
+	putUvarint(uint64(len(c.blobs)))
+	for _, h := range c.blobs {
+		buf.WriteByte(byte(h.Type))
+		buf.Write(h.ID[:])
+	}
+
+	putUvarint(uint64(len(c.snapshots)))
+	for id, used := range c.snapshots {
+		buf.Write(id[:])
+		putUvarint(uint64(len(used)))
+		var last uint32
+		for _, i := range used {
+			putUvarint(uint64(i - last))
+			last = i
+		}
+	}
+	return buf.Bytes()
+}
+
+func decodeUsedBlobsCache(data []byte) (*usedBlobsCache, error) {
+	rd := bytes.NewReader(data)
+
+	version, err := binary.ReadUvarint(rd)
+	if err != nil {
+		return nil, err
+	}
+	if version != usedBlobsCacheVersion {
+		return nil, errors.Errorf("unsupported version %d", version)
+	}
+
+	c := newUsedBlobsCache()
+	count, err := binary.ReadUvarint(rd)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < count; i++ {
+		var h restic.BlobHandle
+		tpe, err := rd.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		h.Type = restic.BlobType(tpe)
+		if h.Type != restic.DataBlob && h.Type != restic.TreeBlob {
+			return nil, errors.Errorf("invalid blob type %d", tpe)
+		}
+		if _, err := io.ReadFull(rd, h.ID[:]); err != nil {
+			return nil, err
+		}
+		c.index[h] = uint32(len(c.blobs))
+		c.blobs = append(c.blobs, h)
+	}
+
+	count, err = binary.ReadUvarint(rd)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < count; i++ {
+		var id restic.ID
+		if _, err := io.ReadFull(rd, id[:]); err != nil {
+			return nil, err
+		}
+		n, err := binary.ReadUvarint(rd)
+		if err != nil {
+			return nil, err
+		}
+		if n > uint64(len(c.blobs)) {
+			return nil, errors.Errorf("invalid number of blobs %d", n)
+		}
+		used := make([]uint32, n)
+		var next uint64
+		for j := range used {
+			delta, err := binary.ReadUvarint(rd)
+			if err != nil {
+				return nil, err
+			}
+			// the indices are strictly increasing
+			if j > 0 && delta == 0 {
+				return nil, errors.New("duplicate blob index")
+			}
+			next += delta
+			if next >= uint64(len(c.blobs)) {
+				return nil, errors.Errorf("invalid blob index %d", next)
+			}
+			used[j] = uint32(next)
+		}
+		c.snapshots[id] = used
+	}
+
+	if rd.Len() != 0 {
+		return nil, errors.Errorf("%d bytes of trailing data", rd.Len())
+	}
+	return c, nil
+}
+
+// loadUsedBlobsCache returns the used blob cache stored in the cache. A missing
+// or unusable file results in an empty cache.
+func loadUsedBlobsCache(cache *cache.Cache, key *crypto.Key, printer Printer) *usedBlobsCache {
+	buf, err := cache.LoadSidecar(usedBlobsCacheName)
+	if err != nil || buf == nil {
+		debug.Log("unable to load used blobs cache: %v", err)
+		return newUsedBlobsCache()
+	}
+
+	// the blob IDs are encrypted like the files of the repository
+	if len(buf) < key.NonceSize()+key.Overhead() {
+		debug.Log("used blobs cache is truncated")
+		return newUsedBlobsCache()
+	}
+	nonce, ciphertext := buf[:key.NonceSize()], buf[key.NonceSize():]
+	plaintext, err := key.Open(ciphertext[:0], nonce, ciphertext, nil)
+	if err == nil {
+		var dec *zstd.Decoder
+		dec, err = zstd.NewReader(nil)
+		if err == nil {
+			plaintext, err = dec.DecodeAll(plaintext, nil)
+			dec.Close()
+		}
+	}
+	var c *usedBlobsCache
+	if err == nil {
+		c, err = decodeUsedBlobsCache(plaintext)
+	}
+	if err != nil {
+		printer.E("ignoring invalid cache of used blobs: %v\n", err)
+		return newUsedBlobsCache()
+	}
+	return c
+}
+
+// saveUsedBlobsCache stores c in the cache.
+func saveUsedBlobsCache(cache *cache.Cache, key *crypto.Key, c *usedBlobsCache) error {
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		return err
+	}
+	data := enc.EncodeAll(c.encode(), nil)
+	_ = enc.Close()
+
+	nonce := crypto.NewRandomNonce()
+	ciphertext := make([]byte, 0, crypto.CiphertextLength(len(data)))
+	ciphertext = append(ciphertext, nonce...)
+	ciphertext = key.Seal(ciphertext, nonce, data, nil)
+
+	return cache.SaveSidecar(usedBlobsCacheName, ciphertext)
+}
+
+// treeBlobs contains the blobs referenced directly by a tree.
+type treeBlobs struct {
+	// blobs are the indices of the data blobs in the blob table
+	blobs    []uint32
+	subtrees restic.IDs
+}
+
+// findUsedBlobsCached returns the blobs used by snapshots, which maps the
+// snapshot IDs to their trees. The blobs used by each snapshot are read from
+// the cache if possible, only the snapshots missing from the cache are
+// traversed. The cache is then updated to contain exactly the given snapshots.
+func findUsedBlobsCached(ctx context.Context, repo restic.Repository, cache *cache.Cache, snapshots map[restic.ID]restic.ID, printer Printer) (restic.CountedBlobSet, error) {
+	c := loadUsedBlobsCache(cache, repo.Key(), printer)
+
+	ids := restic.NewIDSet()
+	var missing restic.IDs
+	for id := range snapshots {
+		ids.Insert(id)
+		if !c.has(id) {
+			missing = append(missing, id)
+		}
+	}
+	c.retain(ids)
+	printer.P("finding data that is still in use for %d snapshots, %d of them are cached\n", len(snapshots), len(snapshots)-len(missing))
+
+	trees, err := loadTreeBlobs(ctx, repo, c, snapshots, missing, printer)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range missing {
+		c.set(id, collectTreeBlobs(c, trees, snapshots[id]))
+	}
+
+	usedBlobs := restic.NewCountedBlobSet()
+	c.insertUsed(ids, usedBlobs)
+
+	c.compact()
+	err = saveUsedBlobsCache(cache, repo.Key(), c)
+	if err != nil {
+		printer.E("unable to save the cache of used blobs: %v\n", err)
+	}
+	return usedBlobs, nil
+}
+
+// loadTreeBlobs loads the trees of the missing snapshots. Each tree is only
+// loaded once, even if it is used by several snapshots.
+func loadTreeBlobs(ctx context.Context, repo restic.Repository, c *usedBlobsCache, snapshots map[restic.ID]restic.ID, missing restic.IDs, printer Printer) (map[restic.ID]treeBlobs, error) {
+	bar := printer.NewPhaseCounter("find-used-blobs", uint64(len(missing)), 0, "snapshots")
+	defer bar.Done()
+
+	trees := make(map[restic.ID]treeBlobs)
+	queued := restic.NewIDSet()
+	var roots []restic.TreeJob[struct{}]
+	for _, id := range missing {
+		tree := snapshots[id]
+		if queued.Has(tree) {
+			bar.Add(1)
+			continue
+		}
+		queued.Insert(tree)
+		roots = append(roots, restic.TreeJob[struct{}]{ID: tree})
+	}
+
+	// visit is never called concurrently, thus trees, queued and c need no
+	// locking
+	err := restic.ParallelWalkTrees(ctx, repo, 0, roots, func(job restic.TreeJob[struct{}], tree *restic.Tree, err error) ([]restic.TreeJob[struct{}], error) {
+		if err != nil {
+			return nil, err
+		}
+
+		var t treeBlobs
+		var subtrees []restic.TreeJob[struct{}]
+		for _, node := range tree.Nodes {
+			switch node.Type {
+			case "file":
+				for _, blob := range node.Content {
+					t.blobs = append(t.blobs, c.lookup(restic.BlobHandle{ID: blob, Type: restic.DataBlob}))
+				}
+			case "dir":
+				if node.Subtree == nil || node.Subtree.IsNull() {
+					// reported by the checker
+					continue
+				}
+				t.subtrees = append(t.subtrees, *node.Subtree)
+				if queued.Has(*node.Subtree) {
+					continue
+				}
+				queued.Insert(*node.Subtree)
+				subtrees = append(subtrees, restic.TreeJob[struct{}]{ID: *node.Subtree})
+			}
+		}
+		trees[job.ID] = t
+		return subtrees, nil
+	}, bar)
+	return trees, err
+}
+
+// collectTreeBlobs returns the indices of the blobs used by the tree root and
+// its subtrees.
+func collectTreeBlobs(c *usedBlobsCache, trees map[restic.ID]treeBlobs, root restic.ID) []uint32 {
+	var used []uint32
+	seen := restic.NewIDSet(root)
+	stack := restic.IDs{root}
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		used = append(used, c.lookup(restic.BlobHandle{ID: id, Type: restic.TreeBlob}))
+		t := trees[id]
+		used = append(used, t.blobs...)
+		for _, subtree := range t.subtrees {
+			if !seen.Has(subtree) {
+				seen.Insert(subtree)
+				stack = append(stack, subtree)
+			}
+		}
+	}
+	return used
+}
@@ -0,0 +1,45 @@
+package prune
+
+import (
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestUsedBlobsCacheEncoding(t *testing.T) {
+	c := newUsedBlobsCache()
+	var handles restic.BlobHandles
+	for i := 0; i < 200; i++ {
+		tpe := restic.DataBlob
+		if i%10 == 0 {
+			tpe = restic.TreeBlob
+		}
+		handles = append(handles, restic.BlobHandle{ID: restic.NewRandomID(), Type: tpe})
+	}
+
+	first, second, third := restic.NewRandomID(), restic.NewRandomID(), restic.NewRandomID()
+	c.add(first, restic.NewBlobSet(handles[:150]...))
+	c.add(second, restic.NewBlobSet(handles[100:]...))
+	c.add(third, restic.NewBlobSet())
+
+	decoded, err := decodeUsedBlobsCache(c.encode())
+	rtest.OK(t, err)
+	rtest.Equals(t, c, decoded)
+
+	// dropping a snapshot removes the blobs only it used from the table
+	c.retain(restic.NewIDSet(second, third))
+	c.compact()
+	rtest.Equals(t, 100, len(c.blobs))
+	used := restic.NewCountedBlobSet()
+	c.insertUsed(restic.NewIDSet(second), used)
+	rtest.Equals(t, 100, used.Len())
+	for _, h := range handles[100:] {
+		rtest.Assert(t, used.Has(h), "blob %v is missing", h)
+	}
+
+	for _, data := range [][]byte{nil, {2}, c.encode()[:50], append(c.encode(), 0)} {
+		_, err := decodeUsedBlobsCache(data)
+		rtest.Assert(t, err != nil, "expected error for invalid data %x", data)
+	}
+}
@@ -0,0 +1,346 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+
+	"github.com/restic/chunker"
+	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// An export stream contains a snapshot together with the blobs it references
+// and can be imported into another repository. It is encrypted using a key
+// derived from a separate password, as the source and destination
+// repositories do not share a master key.
+//
+// The stream starts with exportMagic followed by a sequence of records. Each
+// record consists of a one byte record type, the length of the payload as
+// 32 bit big endian integer and the payload. The first record contains the
+// KDF parameters, the second one the encrypted manifest. Afterwards follow
+// the blob records and a final end record. The payload of a blob record is
+// the blob type (one byte), the blob ID and the encrypted plaintext of the
+// blob.
+
+var exportMagic = []byte("RESTICEX\x01")
+
+const (
+	exportRecordKDF      byte = 'K'
+	exportRecordManifest byte = 'M'
+	exportRecordBlob     byte = 'B'
+	exportRecordEnd      byte = 'E'
+
+	exportRecordHeaderSize = 1 + 4
+	exportBlobHeaderSize   = 1 + len(restic.ID{})
+
+	// maxExportRecordSize limits the size of a single record.
+	maxExportRecordSize = 1 << 30
+)
+
+// ErrInvalidExportStream is returned when the stream cannot be parsed.
+var ErrInvalidExportStream = errors.New("invalid export stream")
+
+// ExportManifest describes the content of an export stream.
+type ExportManifest struct {
+	// ChunkerPolynomial is the polynomial the data blobs were chunked with.
+	ChunkerPolynomial chunker.Pol `json:"chunker_polynomial"`
+	// SnapshotID is the ID of the snapshot in the source repository.
+	SnapshotID restic.ID        `json:"snapshot_id"`
+	Snapshot   *restic.Snapshot `json:"snapshot"`
+	// Blobs lists all blobs contained in the stream. Blobs referenced by
+	// the snapshot which are missing in this list must already exist in the
+	// destination repository.
+	Blobs restic.BlobHandles `json:"blobs"`
+}
+
+type exportKDF struct {
+	KDF  string `json:"kdf"`
+	N    int    `json:"N"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+	Salt []byte `json:"salt"`
+}
+
+// ExportWriter writes an export stream.
+type ExportWriter struct {
+	wr    *bufio.Writer
+	key   *crypto.Key
+	buf   []byte
+	blobs int
+}
+
+// NewExportWriter writes the header and the manifest of an export stream
+// encrypted with password to wr. The blobs listed in the manifest must then be
+// added using WriteBlob.
+func NewExportWriter(wr io.Writer, password string, manifest *ExportManifest) (*ExportWriter, error) {
+	if err := calibrateKDF(); err != nil {
+		return nil, err
+	}
+
+	salt, err := crypto.NewSalt()
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := crypto.KDF(*Params, salt, password)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &ExportWriter{
+		wr:  bufio.NewWriter(wr),
+		key: key,
+	}
+
+	if _, err := w.wr.Write(exportMagic); err != nil {
+		return nil, err
+	}
+
+	kdf, err := json.Marshal(exportKDF{
+		KDF:  "scrypt",
+		N:    Params.N,
+		R:    Params.R,
+		P:    Params.P,
+		Salt: salt,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Marshal")
+	}
+	if err := w.writeRecord(exportRecordKDF, kdf); err != nil {
+		return nil, err
+	}
+
+	buf, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, errors.Wrap(err, "Marshal")
+	}
+	if err := w.writeRecord(exportRecordManifest, w.seal(nil, buf)); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (w *ExportWriter) seal(dst, plaintext []byte) []byte {
+	nonce := crypto.NewRandomNonce()
+	dst = append(dst, nonce...)
+	return w.key.Seal(dst, nonce, plaintext, nil)
+}
+
+func (w *ExportWriter) writeRecord(tpe byte, payload []byte) error {
+	var hdr [exportRecordHeaderSize]byte
+	hdr[0] = tpe
+	binary.BigEndian.PutUint32(hdr[1:], uint32(len(payload)))
+
+	if _, err := w.wr.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err := w.wr.Write(payload)
+	return err
+}
+
+// WriteBlob adds the blob with the given plaintext to the stream.
+func (w *ExportWriter) WriteBlob(h restic.BlobHandle, plaintext []byte) error {
+	buf := w.buf[:0]
+	buf = append(buf, byte(h.Type))
+	buf = append(buf, h.ID[:]...)
+	buf = w.seal(buf, plaintext)
+	w.buf = buf
+
+	w.blobs++
+	return w.writeRecord(exportRecordBlob, buf)
+}
+
+// Close writes the end record and flushes the stream. It does not close the
+// underlying writer.
+func (w *ExportWriter) Close() error {
+	var cnt [4]byte
+	binary.BigEndian.PutUint32(cnt[:], uint32(w.blobs))
+	if err := w.writeRecord(exportRecordEnd, w.seal(nil, cnt[:])); err != nil {
+		return err
+	}
+	return w.wr.Flush()
+}
+
+// ExportReader reads an export stream.
+type ExportReader struct {
+	rd     *bufio.Reader
+	key    *crypto.Key
+	offset int64
+	blobs  int
+	done   bool
+
+	// Manifest is the manifest read from the stream.
+	Manifest ExportManifest
+}
+
+// NewExportReader reads the header and the manifest of the export stream rd
+// and decrypts them using password. The blobs can then be read using Next.
+func NewExportReader(rd io.Reader, password string) (*ExportReader, error) {
+	r := &ExportReader{
+		rd: bufio.NewReader(rd),
+	}
+
+	magic := make([]byte, len(exportMagic))
+	if _, err := io.ReadFull(r.rd, magic); err != nil || !bytes.Equal(magic, exportMagic) {
+		return nil, errors.Wrap(ErrInvalidExportStream, "header")
+	}
+	r.offset = int64(len(magic))
+
+	tpe, buf, err := r.readRecord(nil)
+	if err != nil {
+		return nil, err
+	}
+	if tpe != exportRecordKDF {
+		return nil, errors.Wrap(ErrInvalidExportStream, "missing KDF parameters")
+	}
+
+	var kdf exportKDF
+	if err := json.Unmarshal(buf, &kdf); err != nil || kdf.KDF != "scrypt" {
+		return nil, errors.Wrap(ErrInvalidExportStream, "invalid KDF parameters")
+	}
+	r.key, err = crypto.KDF(crypto.Params{N: kdf.N, R: kdf.R, P: kdf.P}, kdf.Salt, password)
+	if err != nil {
+		return nil, err
+	}
+
+	tpe, buf, err = r.readRecord(nil)
+	if err != nil {
+		return nil, err
+	}
+	if tpe != exportRecordManifest {
+		return nil, errors.Wrap(ErrInvalidExportStream, "missing manifest")
+	}
+	buf, err = r.open(buf)
+	if err != nil {
+		return nil, errors.Wrap(err, "wrong password or damaged manifest")
+	}
+	if err := json.Unmarshal(buf, &r.Manifest); err != nil {
+		return nil, errors.Wrap(err, "Unmarshal")
+	}
+	if r.Manifest.Snapshot == nil || r.Manifest.Snapshot.Tree == nil {
+		return nil, errors.Wrap(ErrInvalidExportStream, "manifest contains no snapshot")
+	}
+
+	return r, nil
+}
+
+func (r *ExportReader) open(buf []byte) ([]byte, error) {
+	if len(buf) < r.key.NonceSize()+r.key.Overhead() {
+		return nil, errors.Wrap(ErrInvalidExportStream, "ciphertext too short")
+	}
+	nonce, ciphertext := buf[:r.key.NonceSize()], buf[r.key.NonceSize():]
+	return r.key.Open(ciphertext[:0], nonce, ciphertext, nil)
+}
+
+func (r *ExportReader) readRecord(buf []byte) (byte, []byte, error) {
+	var hdr [exportRecordHeaderSize]byte
+	if _, err := io.ReadFull(r.rd, hdr[:]); err != nil {
+		return 0, nil, errors.Wrap(ErrInvalidExportStream, "truncated stream")
+	}
+
+	length := binary.BigEndian.Uint32(hdr[1:])
+	if length > maxExportRecordSize {
+		return 0, nil, errors.Wrap(ErrInvalidExportStream, "record too large")
+	}
+
+	if cap(buf) < int(length) {
+		buf = make([]byte, length)
+	}
+	buf = buf[:length]
+	if _, err := io.ReadFull(r.rd, buf); err != nil {
+		return 0, nil, errors.Wrap(ErrInvalidExportStream, "truncated stream")
+	}
+
+	r.offset += int64(len(hdr)) + int64(length)
+	return hdr[0], buf, nil
+}
+
+// Next returns the next blob of the stream together with the offset of its
+// record, which can be passed to ReadBlobAt. The plaintext is verified
+// against the blob ID. The returned data may use buf as storage. After the
+// last blob, Next returns io.EOF.
+func (r *ExportReader) Next(buf []byte) (h restic.BlobHandle, offset int64, data []byte, err error) {
+	if r.done {
+		return restic.BlobHandle{}, 0, nil, io.EOF
+	}
+
+	offset = r.offset
+	tpe, buf, err := r.readRecord(buf)
+	if err != nil {
+		return restic.BlobHandle{}, 0, nil, err
+	}
+
+	switch tpe {
+	case exportRecordBlob:
+		h, data, err = r.decodeBlob(buf)
+		if err != nil {
+			return restic.BlobHandle{}, 0, nil, err
+		}
+		r.blobs++
+		return h, offset, data, nil
+
+	case exportRecordEnd:
+		cnt, err := r.open(buf)
+		if err != nil {
+			return restic.BlobHandle{}, 0, nil, err
+		}
+		if len(cnt) != 4 || int(binary.BigEndian.Uint32(cnt)) != r.blobs || r.blobs != len(r.Manifest.Blobs) {
+			return restic.BlobHandle{}, 0, nil, errors.Wrap(ErrInvalidExportStream, "blob count mismatch")
+		}
+		r.done = true
+		return restic.BlobHandle{}, 0, nil, io.EOF
+	}
+
+	return restic.BlobHandle{}, 0, nil, errors.Wrapf(ErrInvalidExportStream, "unexpected record type %q", tpe)
+}
+
+func (r *ExportReader) decodeBlob(buf []byte) (restic.BlobHandle, []byte, error) {
+	if len(buf) < exportBlobHeaderSize {
+		return restic.BlobHandle{}, nil, errors.Wrap(ErrInvalidExportStream, "blob record too short")
+	}
+
+	var h restic.BlobHandle
+	h.Type = restic.BlobType(buf[0])
+	if h.Type != restic.DataBlob && h.Type != restic.TreeBlob {
+		return restic.BlobHandle{}, nil, errors.Wrapf(ErrInvalidExportStream, "invalid blob type %d", buf[0])
+	}
+	copy(h.ID[:], buf[1:exportBlobHeaderSize])
+
+	plaintext, err := r.open(buf[exportBlobHeaderSize:])
+	if err != nil {
+		return restic.BlobHandle{}, nil, errors.Wrapf(err, "decrypting blob %v", h)
+	}
+	// move the plaintext to the start of buf, so that buf can be reused
+	data := buf[:copy(buf, plaintext)]
+	if !restic.Hash(data).Equal(h.ID) {
+		return restic.BlobHandle{}, nil, errors.Errorf("blob %v: hash does not match", h)
+	}
+	return h, data, nil
+}
+
+// ReadBlobAt reads the blob record starting at offset from ra, which must
+// contain the same stream as the one the reader was created for.
+func (r *ExportReader) ReadBlobAt(ra io.ReaderAt, offset int64, buf []byte) (restic.BlobHandle, []byte, error) {
+	var hdr [exportRecordHeaderSize]byte
+	if _, err := ra.ReadAt(hdr[:], offset); err != nil {
+		return restic.BlobHandle{}, nil, errors.Wrap(ErrInvalidExportStream, "truncated stream")
+	}
+	length := binary.BigEndian.Uint32(hdr[1:])
+	if hdr[0] != exportRecordBlob || length > maxExportRecordSize {
+		return restic.BlobHandle{}, nil, errors.Wrap(ErrInvalidExportStream, "no blob record at offset")
+	}
+
+	if cap(buf) < int(length) {
+		buf = make([]byte, length)
+	}
+	buf = buf[:length]
+	if _, err := ra.ReadAt(buf, offset+int64(len(hdr))); err != nil {
+		return restic.BlobHandle{}, nil, errors.Wrap(ErrInvalidExportStream, "truncated stream")
+	}
+	return r.decodeBlob(buf)
+}
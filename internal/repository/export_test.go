@@ -0,0 +1,128 @@
+package repository_test
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+type exportBlob struct {
+	h      restic.BlobHandle
+	data   []byte
+	offset int64
+}
+
+func writeTestExport(t *testing.T, password string) ([]byte, *repository.ExportManifest, []exportBlob) {
+	repository.TestUseLowSecurityKDFParameters(t)
+
+	var blobs []exportBlob
+	for i := 0; i < 20; i++ {
+		data := make([]byte, rand.Intn(1<<16))
+		_, _ = rand.Read(data)
+		tpe := restic.DataBlob
+		if i%5 == 0 {
+			tpe = restic.TreeBlob
+		}
+		blobs = append(blobs, exportBlob{h: restic.BlobHandle{Type: tpe, ID: restic.Hash(data)}, data: data})
+	}
+
+	tree := restic.NewRandomID()
+	sn, err := restic.NewSnapshot([]string{"/foo"}, nil, "host", time.Unix(1000, 0))
+	rtest.OK(t, err)
+	sn.Tree = &tree
+
+	manifest := &repository.ExportManifest{
+		ChunkerPolynomial: repository.TestChunkerPol,
+		SnapshotID:        restic.NewRandomID(),
+		Snapshot:          sn,
+	}
+	for _, blob := range blobs {
+		manifest.Blobs = append(manifest.Blobs, blob.h)
+	}
+
+	var buf bytes.Buffer
+	wr, err := repository.NewExportWriter(&buf, password, manifest)
+	rtest.OK(t, err)
+	for _, blob := range blobs {
+		rtest.OK(t, wr.WriteBlob(blob.h, blob.data))
+	}
+	rtest.OK(t, wr.Close())
+
+	return buf.Bytes(), manifest, blobs
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	stream, manifest, blobs := writeTestExport(t, "secret")
+
+	rd, err := repository.NewExportReader(bytes.NewReader(stream), "secret")
+	rtest.OK(t, err)
+	rtest.Equals(t, manifest.ChunkerPolynomial, rd.Manifest.ChunkerPolynomial)
+	rtest.Equals(t, manifest.SnapshotID, rd.Manifest.SnapshotID)
+	rtest.Equals(t, *manifest.Snapshot.Tree, *rd.Manifest.Snapshot.Tree)
+	rtest.Equals(t, manifest.Blobs, rd.Manifest.Blobs)
+
+	for i := range blobs {
+		h, offset, data, err := rd.Next(nil)
+		rtest.OK(t, err)
+		rtest.Equals(t, blobs[i].h, h)
+		rtest.Equals(t, blobs[i].data, data)
+		blobs[i].offset = offset
+	}
+	_, _, _, err = rd.Next(nil)
+	rtest.Assert(t, err == io.EOF, "expected io.EOF, got %v", err)
+
+	// read blobs in reverse order using the offsets
+	ra := bytes.NewReader(stream)
+	for i := len(blobs) - 1; i >= 0; i-- {
+		h, data, err := rd.ReadBlobAt(ra, blobs[i].offset, nil)
+		rtest.OK(t, err)
+		rtest.Equals(t, blobs[i].h, h)
+		rtest.Equals(t, blobs[i].data, data)
+	}
+}
+
+func TestExportWrongPassword(t *testing.T) {
+	stream, _, _ := writeTestExport(t, "secret")
+
+	_, err := repository.NewExportReader(bytes.NewReader(stream), "wrong")
+	rtest.Assert(t, err != nil, "expected error for wrong password")
+}
+
+func TestExportTruncated(t *testing.T) {
+	stream, _, _ := writeTestExport(t, "secret")
+
+	// drop the end record and part of the last blob
+	rd, err := repository.NewExportReader(bytes.NewReader(stream[:len(stream)-100]), "secret")
+	rtest.OK(t, err)
+	for {
+		_, _, _, err = rd.Next(nil)
+		if err != nil {
+			break
+		}
+	}
+	rtest.Assert(t, errors.Is(err, repository.ErrInvalidExportStream), "expected invalid stream error, got %v", err)
+}
+
+func TestExportModified(t *testing.T) {
+	stream, _, _ := writeTestExport(t, "secret")
+
+	// flip a bit in the last blob
+	stream[len(stream)-200] ^= 0x01
+
+	rd, err := repository.NewExportReader(bytes.NewReader(stream), "secret")
+	rtest.OK(t, err)
+	for {
+		_, _, _, err = rd.Next(nil)
+		if err != nil {
+			break
+		}
+	}
+	rtest.Assert(t, err != io.EOF, "modified blob was not detected")
+}
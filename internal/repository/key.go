@@ -24,6 +24,28 @@ var (
 	ErrMaxKeysReached = errors.New("maximum number of keys reached")
 )
 
+// NoKeyFoundError is returned by SearchKey if none of the keys in the
+// repository can be opened with the password. It matches ErrNoKeyFound.
+type NoKeyFoundError struct {
+	// Tried is the number of keys which were tried.
+	Tried int
+}
+
+func (e *NoKeyFoundError) Error() string {
+	if e.Tried == 0 {
+		return fmt.Sprintf("%v: the repository contains no keys", ErrNoKeyFound)
+	}
+	keys := "keys"
+	if e.Tried == 1 {
+		keys = "key"
+	}
+	return fmt.Sprintf("%v: tried %d %s, none matches the password", ErrNoKeyFound, e.Tried, keys)
+}
+
+func (e *NoKeyFoundError) Unwrap() error {
+	return ErrNoKeyFound
+}
+
 // Key represents an encrypted master key for a repository.
 type Key struct {
 	Created  time.Time `json:"created"`
@@ -109,7 +131,8 @@ func OpenKey(ctx context.Context, s *Repository, id restic.ID, password string)
 }
 
 // SearchKey tries to decrypt at most maxKeys keys in the backend with the
-// given password. If none could be found, ErrNoKeyFound is returned. When
+// given password. If none could be found, a *NoKeyFoundError, which matches
+// ErrNoKeyFound, is returned. When
 // maxKeys is reached, ErrMaxKeysReached is returned. When setting maxKeys to
 // zero, all keys in the repo are checked.
 func SearchKey(ctx context.Context, s *Repository, password string, maxKeys int, keyHint string) (k *Key, err error) {
@@ -170,7 +193,7 @@ func SearchKey(ctx context.Context, s *Repository, password string, maxKeys int,
 	}
 
 	if k == nil {
-		return nil, ErrNoKeyFound
+		return nil, &NoKeyFoundError{Tried: checked}
 	}
 
 	return k, nil
@@ -193,17 +216,28 @@ func LoadKey(ctx context.Context, s *Repository, id restic.ID) (k *Key, err erro
 	return k, nil
 }
 
+// calibrateKDF sets Params to the calibrated KDF parameters, unless they are
+// already set.
+func calibrateKDF() error {
+	if Params != nil {
+		return nil
+	}
+
+	p, err := crypto.Calibrate(KDFTimeout, KDFMemory)
+	if err != nil {
+		return errors.Wrap(err, "Calibrate")
+	}
+
+	Params = &p
+	debug.Log("calibrated KDF parameters are %v", p)
+	return nil
+}
+
 // AddKey adds a new key to an already existing repository.
 func AddKey(ctx context.Context, s *Repository, password, username, hostname string, template *crypto.Key) (*Key, error) {
 	// make sure we have valid KDF parameters
-	if Params == nil {
-		p, err := crypto.Calibrate(KDFTimeout, KDFMemory)
-		if err != nil {
-			return nil, errors.Wrap(err, "Calibrate")
-		}
-
-		Params = &p
-		debug.Log("calibrated KDF parameters are %v", p)
+	if err := calibrateKDF(); err != nil {
+		return nil, err
 	}
 
 	// fill meta data about key
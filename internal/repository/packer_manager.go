@@ -36,8 +36,14 @@ type packerManager struct {
 	pm       sync.Mutex
 	packer   *Packer
 	packSize uint
+	// discarded is set once the uploader has stopped
+	discarded bool
 }
 
+// errUploaderStopped is returned when saving a blob after the pack uploader
+// has stopped due to an error.
+var errUploaderStopped = errors.New("pack uploader has stopped")
+
 // newPackerManager returns an new packer manager which writes temporary files
 // to a temporary directory
 func newPackerManager(key *crypto.Key, tpe restic.BlobType, packSize uint, queueFn func(ctx context.Context, t restic.BlobType, p *Packer) error) *packerManager {
@@ -56,10 +62,10 @@ func (r *packerManager) Flush(ctx context.Context) error {
 	if r.packer != nil {
 		debug.Log("manually flushing pending pack")
 		err := r.queueFn(ctx, r.tpe, r.packer)
+		r.packer = nil
 		if err != nil {
 			return err
 		}
-		r.packer = nil
 	}
 	return nil
 }
@@ -68,6 +74,10 @@ func (r *packerManager) SaveBlob(ctx context.Context, t restic.BlobType, id rest
 	r.pm.Lock()
 	defer r.pm.Unlock()
 
+	if r.discarded {
+		return 0, errUploaderStopped
+	}
+
 	var err error
 	packer := r.packer
 	if r.packer == nil {
@@ -104,6 +114,23 @@ func (r *packerManager) SaveBlob(ctx context.Context, t restic.BlobType, id rest
 	return size + packer.HeaderOverhead(), nil
 }
 
+// discard removes the temporary file of the pending packer, whose blobs will
+// never be uploaded as the uploader has stopped. Blobs saved afterwards are
+// rejected.
+func (r *packerManager) discard() {
+	r.pm.Lock()
+	defer r.pm.Unlock()
+
+	r.discarded = true
+	if r.packer != nil {
+		debug.Log("discarding pending pack")
+		if err := r.packer.removeTempFile(); err != nil {
+			debug.Log("unable to remove temporary file: %v", err)
+		}
+		r.packer = nil
+	}
+}
+
 // findPacker returns a packer for a new blob of size bytes. Either a new one is
 // created or one is returned that already has some blobs.
 func (r *packerManager) newPacker() (packer *Packer, err error) {
@@ -124,10 +151,35 @@ func (r *packerManager) newPacker() (packer *Packer, err error) {
 	return packer, nil
 }
 
+// removeTempFile closes and removes the temporary file of the packer.
+func (p *Packer) removeTempFile() error {
+	cerr := p.tmpfile.Close()
+
+	// on windows the tempfile is automatically deleted on close
+	if runtime.GOOS != "windows" {
+		err := fs.RemoveIfExists(p.tmpfile.Name())
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return errors.Wrap(cerr, "close tempfile")
+}
+
 // savePacker stores p in the backend.
-func (r *Repository) savePacker(ctx context.Context, t restic.BlobType, p *Packer) error {
+func (r *Repository) savePacker(ctx context.Context, t restic.BlobType, p *Packer) (err error) {
 	debug.Log("save packer for %v with %d blobs (%d bytes)\n", t, p.Packer.Count(), p.Packer.Size())
-	err := p.Packer.Finalize()
+	// The backend may rewind the temporary file to retry the upload, thus it
+	// must only be removed once Save has either succeeded or failed
+	// permanently.
+	defer func() {
+		rerr := p.removeTempFile()
+		if err == nil {
+			err = rerr
+		}
+	}()
+
+	err = p.Packer.Finalize()
 	if err != nil {
 		return err
 	}
@@ -167,26 +219,23 @@ func (r *Repository) savePacker(ctx context.Context, t restic.BlobType, p *Packe
 	}
 
 	err = r.be.Save(ctx, h, rrd)
+	if err != nil {
+		err = r.checkAlreadyExists(ctx, h, id, err)
+	}
 	if err != nil {
 		debug.Log("Save(%v) error: %v", h, err)
+		if errors.Is(err, ErrSizeLimit) && !r.noAutoIndexUpdate {
+			// save the index for the packs uploaded so far, so that they
+			// can be used by the next backup
+			if ierr := r.idx.SaveIndex(ctx, r); ierr != nil {
+				debug.Log("saving index failed: %v", ierr)
+			}
+		}
 		return err
 	}
 
 	debug.Log("saved as %v", h)
 
-	err = p.tmpfile.Close()
-	if err != nil {
-		return errors.Wrap(err, "close tempfile")
-	}
-
-	// on windows the tempfile is automatically deleted on close
-	if runtime.GOOS != "windows" {
-		err = fs.RemoveIfExists(p.tmpfile.Name())
-		if err != nil {
-			return errors.WithStack(err)
-		}
-	}
-
 	// update blobs in the index
 	debug.Log("  updating blobs %v to pack %v", p.Packer.Blobs(), id)
 	r.idx.StorePack(id, p.Packer.Blobs())
@@ -4,12 +4,15 @@ import (
 	"context"
 	"io"
 	"math/rand"
+	"os"
 	"sync"
 	"testing"
 
 	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/test"
+	"golang.org/x/sync/errgroup"
 )
 
 func randomID(rd io.Reader) restic.ID {
@@ -110,3 +113,65 @@ func BenchmarkPackerManager(t *testing.B) {
 		fillPacks(t, rnd, pm, blobBuf)
 	}
 }
+
+type failingSaveBackend struct {
+	restic.Backend
+}
+
+func (be failingSaveBackend) Save(_ context.Context, _ restic.Handle, rd restic.RewindReader) error {
+	// consume part of the data like an interrupted upload
+	_, _ = io.CopyN(io.Discard, rd, 10)
+	return errors.New("injected error")
+}
+
+func TestSavePackerClosesTempFile(t *testing.T) {
+	for _, fail := range []bool{false, true} {
+		repo := TestRepository(t).(*Repository)
+		if fail {
+			repo.be = failingSaveBackend{repo.be}
+		}
+
+		var packer *Packer
+		pm := newPackerManager(repo.key, restic.DataBlob, DefaultPackSize, func(ctx context.Context, tpe restic.BlobType, p *Packer) error {
+			packer = p
+			return repo.savePacker(ctx, tpe, p)
+		})
+
+		buf := test.Random(23, 1000)
+		_, err := pm.SaveBlob(context.TODO(), restic.DataBlob, restic.Hash(buf), buf, 0)
+		test.OK(t, err)
+		err = pm.Flush(context.TODO())
+		test.Equals(t, fail, err != nil)
+
+		// the temporary file must be closed regardless of whether the upload succeeded
+		err = packer.tmpfile.Close()
+		test.Assert(t, errors.Is(err, os.ErrClosed), "temporary file was not closed, fail=%v", fail)
+	}
+}
+
+type failingSavePacker struct{}
+
+func (failingSavePacker) savePacker(_ context.Context, _ restic.BlobType, p *Packer) error {
+	_ = p.removeTempFile()
+	return errors.New("injected error")
+}
+
+func TestQueuePackerAfterUploaderFailure(t *testing.T) {
+	wg, wgCtx := errgroup.WithContext(context.Background())
+	pu := newPackerUploader(wgCtx, wg, failingSavePacker{}, 1)
+	pm := newPackerManager(crypto.NewRandomKey(), restic.DataBlob, DefaultPackSize, pu.QueuePacker)
+
+	p, err := pm.newPacker()
+	test.OK(t, err)
+	test.OK(t, pu.QueuePacker(context.TODO(), restic.DataBlob, p))
+
+	// the uploader has stopped, queueing another packer must not block
+	p, err = pm.newPacker()
+	test.OK(t, err)
+	err = pu.QueuePacker(context.TODO(), restic.DataBlob, p)
+	test.Assert(t, err != nil && err.Error() == "injected error", "unexpected error %v", err)
+	_, err = os.Stat(p.tmpfile.Name())
+	test.Assert(t, errors.Is(err, os.ErrNotExist), "temporary file was not removed: %v", err)
+
+	test.Assert(t, wg.Wait() != nil, "missing error")
+}
@@ -2,7 +2,9 @@ package repository
 
 import (
 	"context"
+	"sync"
 
+	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/restic"
 	"golang.org/x/sync/errgroup"
 )
@@ -19,11 +21,17 @@ type uploadTask struct {
 
 type packerUploader struct {
 	uploadQueue chan uploadTask
+	// done is closed once the uploaders have stopped
+	done <-chan struct{}
+
+	m   sync.Mutex
+	err error
 }
 
 func newPackerUploader(ctx context.Context, wg *errgroup.Group, repo SavePacker, connections uint) *packerUploader {
 	pu := &packerUploader{
 		uploadQueue: make(chan uploadTask),
+		done:        ctx.Done(),
 	}
 
 	for i := 0; i < int(connections); i++ {
@@ -36,6 +44,7 @@ func newPackerUploader(ctx context.Context, wg *errgroup.Group, repo SavePacker,
 					}
 					err := repo.savePacker(ctx, t.tpe, t.packer)
 					if err != nil {
+						pu.setErr(err)
 						return err
 					}
 				case <-ctx.Done():
@@ -48,14 +57,36 @@ func newPackerUploader(ctx context.Context, wg *errgroup.Group, repo SavePacker,
 	return pu
 }
 
+func (pu *packerUploader) setErr(err error) {
+	pu.m.Lock()
+	defer pu.m.Unlock()
+	if pu.err == nil {
+		pu.err = err
+	}
+}
+
 func (pu *packerUploader) QueuePacker(ctx context.Context, t restic.BlobType, p *Packer) (err error) {
 	select {
 	case <-ctx.Done():
-		return ctx.Err()
+		err = ctx.Err()
+	case <-pu.done:
+		// the uploaders have stopped, return the error which stopped them
+		pu.m.Lock()
+		err = pu.err
+		pu.m.Unlock()
+		if err == nil {
+			err = context.Canceled
+		}
 	case pu.uploadQueue <- uploadTask{tpe: t, packer: p}:
+		return nil
 	}
 
-	return nil
+	// the packer was not passed to an uploader, which would otherwise
+	// remove its temporary file
+	if rerr := p.removeTempFile(); rerr != nil {
+		debug.Log("unable to remove temporary file: %v", rerr)
+	}
+	return err
 }
 
 func (pu *packerUploader) TriggerShutdown() {
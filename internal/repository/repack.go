@@ -2,10 +2,12 @@ package repository
 
 import (
 	"context"
+	"io"
 	"sync"
 
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/ui/progress"
 
@@ -24,8 +26,16 @@ type repackBlobSet interface {
 // be removed.
 //
 // The map keepBlobs is modified by Repack, it is used to keep track of which
-// blobs have been processed.
-func Repack(ctx context.Context, repo restic.Repository, dstRepo restic.Repository, packs restic.IDSet, keepBlobs repackBlobSet, p *progress.Counter) (obsoletePacks restic.IDSet, err error) {
+// blobs have been processed. Each blob is removed from keepBlobs once it has
+// been saved, thus a blob which is contained in several of the packs is only
+// saved once. The progress counter p is incremented for each
+// processed pack and its bytes for the plaintext size of each saved blob.
+//
+// When repacking within a repository, storeDuplicate must be set as the blobs
+// are already contained in the index and have to be saved again into the new
+// packs. When copying to another repository, blobs which already exist there
+// are skipped unless storeDuplicate is set.
+func Repack(ctx context.Context, repo restic.Repository, dstRepo restic.Repository, packs restic.IDSet, keepBlobs repackBlobSet, storeDuplicate bool, p *progress.Counter) (obsoletePacks restic.IDSet, err error) {
 	debug.Log("repacking %d packs while keeping %d blobs", len(packs), keepBlobs.Len())
 
 	if repo == dstRepo && dstRepo.Connections() < 2 {
@@ -37,7 +47,7 @@ func Repack(ctx context.Context, repo restic.Repository, dstRepo restic.Reposito
 	dstRepo.StartPackUploader(wgCtx, wg)
 	wg.Go(func() error {
 		var err error
-		obsoletePacks, err = repack(wgCtx, repo, dstRepo, packs, keepBlobs, p)
+		obsoletePacks, err = repack(wgCtx, repo, dstRepo, packs, keepBlobs, storeDuplicate, p)
 		return err
 	})
 
@@ -47,7 +57,7 @@ func Repack(ctx context.Context, repo restic.Repository, dstRepo restic.Reposito
 	return obsoletePacks, nil
 }
 
-func repack(ctx context.Context, repo restic.Repository, dstRepo restic.Repository, packs restic.IDSet, keepBlobs repackBlobSet, p *progress.Counter) (obsoletePacks restic.IDSet, err error) {
+func repack(ctx context.Context, repo restic.Repository, dstRepo restic.Repository, packs restic.IDSet, keepBlobs repackBlobSet, storeDuplicate bool, p *progress.Counter) (obsoletePacks restic.IDSet, err error) {
 	wg, wgCtx := errgroup.WithContext(ctx)
 
 	var keepMutex sync.Mutex
@@ -75,9 +85,15 @@ func repack(ctx context.Context, repo restic.Repository, dstRepo restic.Reposito
 		return nil
 	})
 
+	beLoad := repo.Backend().Load
+	if copier := restic.AsRangeCopier(repo.Backend()); copier != nil {
+		debug.Log("backend supports copying file ranges, loading packs via temporary files")
+		beLoad = loadViaCopy(copier)
+	}
+
 	worker := func() error {
 		for t := range downloadQueue {
-			err := StreamPack(wgCtx, repo.Backend().Load, repo.Key(), t.PackID, t.Blobs, func(blob restic.BlobHandle, buf []byte, err error) error {
+			err := StreamPack(wgCtx, beLoad, repo.Key(), t.PackID, t.Blobs, func(blob restic.BlobHandle, buf []byte, err error) error {
 				if err != nil {
 					var ierr error
 					// check whether we can get a valid copy somewhere else
@@ -89,7 +105,8 @@ func repack(ctx context.Context, repo restic.Repository, dstRepo restic.Reposito
 				}
 
 				keepMutex.Lock()
-				// recheck whether some other worker was faster
+				// recheck whether some other worker was faster or another
+				// copy of the blob was already saved
 				shouldKeep := keepBlobs.Has(blob)
 				if shouldKeep {
 					keepBlobs.Delete(blob)
@@ -100,11 +117,11 @@ func repack(ctx context.Context, repo restic.Repository, dstRepo restic.Reposito
 					return nil
 				}
 
-				// We do want to save already saved blobs!
-				_, _, _, err = dstRepo.SaveBlob(wgCtx, blob.Type, buf, blob.ID, true)
+				_, _, _, err = dstRepo.SaveBlob(wgCtx, blob.Type, buf, blob.ID, storeDuplicate)
 				if err != nil {
 					return err
 				}
+				p.AddBytes(uint64(len(buf)))
 
 				debug.Log("  saved blob %v", blob.ID)
 				return nil
@@ -138,3 +155,32 @@ func repack(ctx context.Context, repo restic.Repository, dstRepo restic.Reposito
 
 	return packs, nil
 }
+
+// loadViaCopy returns a function which loads a file range by copying it into
+// a temporary file using be.CopyRange. If the temporary directory is on the
+// same filesystem as the repository, the data is not passed through
+// userspace during the copy. The blobs are verified while reading them from
+// the temporary file as usual.
+func loadViaCopy(be restic.RangeCopier) BackendLoadFn {
+	return func(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+		f, err := fs.TempFile("", "restic-temp-pack-")
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer func() {
+			_ = f.Close()
+			_ = fs.RemoveIfExists(f.Name())
+		}()
+
+		err = be.CopyRange(ctx, h, length, offset, f)
+		if err != nil {
+			return err
+		}
+
+		if _, err = f.Seek(0, io.SeekStart); err != nil {
+			return errors.WithStack(err)
+		}
+
+		return fn(f)
+	}
+}
@@ -2,14 +2,24 @@ package repository_test
 
 import (
 	"context"
+	"io"
 	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/restic/restic/internal/backend/retry"
+	"github.com/restic/restic/internal/backend/sema"
+	"github.com/restic/restic/internal/backend/stats"
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/index"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
+	"github.com/restic/restic/internal/ui/progress"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -151,7 +161,7 @@ func findPacksForBlobs(t *testing.T, repo restic.Repository, blobs restic.BlobSe
 }
 
 func repack(t *testing.T, repo restic.Repository, packs restic.IDSet, blobs restic.BlobSet) {
-	repackedBlobs, err := repository.Repack(context.TODO(), repo, repo, packs, blobs, nil)
+	repackedBlobs, err := repository.Repack(context.TODO(), repo, repo, packs, blobs, true, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -318,7 +328,7 @@ func testRepackCopy(t *testing.T, version uint) {
 	_, keepBlobs := selectBlobs(t, repo, 0.2)
 	copyPacks := findPacksForBlobs(t, repo, keepBlobs)
 
-	_, err := repository.Repack(context.TODO(), repoWrapped, dstRepoWrapped, copyPacks, keepBlobs, nil)
+	_, err := repository.Repack(context.TODO(), repoWrapped, dstRepoWrapped, copyPacks, keepBlobs, false, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -359,7 +369,7 @@ func testRepackWrongBlob(t *testing.T, version uint) {
 	_, keepBlobs := selectBlobs(t, repo, 0)
 	rewritePacks := findPacksForBlobs(t, repo, keepBlobs)
 
-	_, err := repository.Repack(context.TODO(), repo, repo, rewritePacks, keepBlobs, nil)
+	_, err := repository.Repack(context.TODO(), repo, repo, rewritePacks, keepBlobs, true, nil)
 	if err == nil {
 		t.Fatal("expected repack to fail but got no error")
 	}
@@ -406,10 +416,199 @@ func testRepackBlobFallback(t *testing.T, version uint) {
 	rtest.OK(t, repo.Flush(context.Background()))
 
 	// repack must fallback to valid copy
-	_, err = repository.Repack(context.TODO(), repo, repo, rewritePacks, keepBlobs, nil)
+	_, err = repository.Repack(context.TODO(), repo, repo, rewritePacks, keepBlobs, true, nil)
 	rtest.OK(t, err)
 
 	keepBlobs = restic.NewBlobSet(restic.BlobHandle{Type: restic.DataBlob, ID: id})
 	packs := findPacksForBlobs(t, repo, keepBlobs)
 	rtest.Assert(t, len(packs) == 3, "unexpected number of copies: %v", len(packs))
 }
+
+// rangeCopyBackend implements restic.RangeCopier on top of another backend
+// and counts the number of copied files.
+type rangeCopyBackend struct {
+	restic.Backend
+	copies int32
+}
+
+func (be *rangeCopyBackend) CopyRange(ctx context.Context, h restic.Handle, length int, offset int64, dst *os.File) error {
+	atomic.AddInt32(&be.copies, 1)
+	return be.Backend.Load(ctx, h, length, offset, func(rd io.Reader) error {
+		_, err := io.Copy(dst, rd)
+		return err
+	})
+}
+
+func TestRepackRangeCopier(t *testing.T) {
+	repository.TestAllVersions(t, testRepackRangeCopier)
+}
+
+func testRepackRangeCopier(t *testing.T, version uint) {
+	be := &rangeCopyBackend{Backend: repository.TestBackend(t)}
+	// the copies must pass through the backend wrappers
+	statsBe := stats.New(be)
+	repo := repository.TestRepositoryWithBackend(t, retry.New(sema.NewBackend(statsBe), 3, nil, nil), version)
+
+	seed := time.Now().UnixNano()
+	rand.Seed(seed)
+	t.Logf("rand seed is %v", seed)
+
+	createRandomBlobs(t, repo, 100, 0.7)
+	flush(t, repo)
+
+	removeBlobs, keepBlobs := selectBlobs(t, repo, 0.2)
+	removePacks := findPacksForBlobs(t, repo, removeBlobs)
+
+	repack(t, repo, removePacks, keepBlobs)
+	rebuildIndex(t, repo)
+	reloadIndex(t, repo)
+
+	rtest.Assert(t, atomic.LoadInt32(&be.copies) > 0, "repack did not use CopyRange")
+	rtest.Assert(t, statsBe.Stats().Load.Requests >= uint64(atomic.LoadInt32(&be.copies)), "copies were not passed through the stats backend")
+
+	for h := range keepBlobs {
+		_, err := repo.LoadBlob(context.TODO(), h.Type, h.ID, nil)
+		rtest.OK(t, err)
+	}
+}
+
+func TestRepackProgress(t *testing.T) {
+	repository.TestAllVersions(t, testRepackProgress)
+}
+
+func testRepackProgress(t *testing.T, version uint) {
+	repo := repository.TestRepositoryWithVersion(t, version)
+	dstRepo := repository.TestRepositoryWithVersion(t, version)
+
+	createRandomBlobs(t, repo, 100, 0.7)
+	flush(t, repo)
+
+	_, keepBlobs := selectBlobs(t, repo, 0.2)
+	copyPacks := findPacksForBlobs(t, repo, keepBlobs)
+
+	var size uint64
+	for h := range keepBlobs {
+		size += uint64(repo.Index().Lookup(h)[0].DataLength())
+	}
+
+	var last progress.PhaseStatus
+	p := progress.NewPhaseCounter(0, uint64(len(copyPacks)), size, func(s progress.PhaseStatus, final bool) {
+		last = s
+	})
+	_, err := repository.Repack(context.TODO(), repo, dstRepo, copyPacks, keepBlobs, false, p)
+	p.Done()
+	rtest.OK(t, err)
+
+	rtest.Equals(t, uint64(len(copyPacks)), last.Items)
+	rtest.Equals(t, uint64(len(copyPacks)), last.MaxItems)
+	rtest.Equals(t, size, last.Bytes)
+	rtest.Equals(t, size, last.MaxBytes)
+}
+
+func TestRepackDuplicates(t *testing.T) {
+	repository.TestAllVersions(t, testRepackDuplicates)
+}
+
+func testRepackDuplicates(t *testing.T, version uint) {
+	repo := repository.TestRepositoryWithVersion(t, version)
+
+	buf := rtest.Random(42, 100*1024)
+	id := restic.Hash(buf)
+	keepBlobs := restic.NewBlobSet(restic.BlobHandle{Type: restic.DataBlob, ID: id})
+
+	// store the same blob in two separate packs
+	for i := 0; i < 2; i++ {
+		var wg errgroup.Group
+		repo.StartPackUploader(context.TODO(), &wg)
+		_, _, _, err := repo.SaveBlob(context.TODO(), restic.DataBlob, buf, id, true)
+		rtest.OK(t, err)
+		rtest.OK(t, repo.Flush(context.Background()))
+	}
+
+	packs := findPacksForBlobs(t, repo, keepBlobs)
+	rtest.Equals(t, 2, len(packs))
+
+	// repacking both packs must save only a single copy of the blob
+	repack(t, repo, packs, keepBlobs)
+	rtest.Equals(t, 0, keepBlobs.Len())
+	rebuildIndex(t, repo)
+	reloadIndex(t, repo)
+
+	rtest.Equals(t, 1, len(listPacks(t, repo)))
+	rtest.Equals(t, 1, len(repo.Index().Lookup(restic.BlobHandle{Type: restic.DataBlob, ID: id})))
+}
+
+// blockingLoadBackend passes the first load request after arming it to the
+// wrapped backend and blocks all further requests until their context is
+// canceled.
+type blockingLoadBackend struct {
+	restic.Backend
+	armed     int32
+	loads     int32
+	firstDone chan struct{}
+}
+
+func (be *blockingLoadBackend) Load(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+	if atomic.LoadInt32(&be.armed) == 0 {
+		return be.Backend.Load(ctx, h, length, offset, fn)
+	}
+	if atomic.AddInt32(&be.loads, 1) > 1 {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	defer close(be.firstDone)
+	return be.Backend.Load(ctx, h, length, offset, fn)
+}
+
+// openTempPackFiles returns the number of temporary pack files which are
+// currently opened by the process.
+func openTempPackFiles(t *testing.T) int {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skipf("unable to list open files: %v", err)
+	}
+	count := 0
+	for _, entry := range entries {
+		target, err := os.Readlink(filepath.Join("/proc/self/fd", entry.Name()))
+		if err == nil && strings.Contains(target, "restic-temp-pack-") {
+			count++
+		}
+	}
+	return count
+}
+
+func TestRepackCancel(t *testing.T) {
+	be := &blockingLoadBackend{Backend: repository.TestBackend(t), firstDone: make(chan struct{})}
+	repo := repository.TestRepositoryWithBackend(t, be, 0)
+
+	createRandomBlobs(t, repo, 100, 0.7)
+	flush(t, repo)
+	openFiles := openTempPackFiles(t)
+
+	// keep all blobs, but rewrite every pack
+	_, keepBlobs := selectBlobs(t, repo, 0)
+	rewritePacks := findPacksForBlobs(t, repo, keepBlobs)
+	rtest.Assert(t, len(rewritePacks) > 1, "expected several packs, got %v", len(rewritePacks))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	atomic.StoreInt32(&be.armed, 1)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := repository.Repack(ctx, repo, repo, rewritePacks, keepBlobs, true, nil)
+		done <- err
+	}()
+
+	// cancel once the blobs of the first pack are held in a pending pack
+	<-be.firstDone
+	cancel()
+
+	select {
+	case err := <-done:
+		rtest.Assert(t, errors.Is(err, context.Canceled), "unexpected error %v", err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("repack did not return after the context was canceled")
+	}
+	rtest.Equals(t, openFiles, openTempPackFiles(t))
+}
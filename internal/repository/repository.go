@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"io"
 	"os"
@@ -21,8 +22,10 @@ import (
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/index"
+	"github.com/restic/restic/internal/options"
 	"github.com/restic/restic/internal/pack"
 	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
 	"github.com/restic/restic/internal/ui/progress"
 
 	"golang.org/x/sync/errgroup"
@@ -43,10 +46,20 @@ type Repository struct {
 	idx   *index.MasterIndex
 	Cache *cache.Cache
 
+	// refreshMutex serializes refreshing the index after pack files were
+	// found to be missing, refreshGeneration counts the refreshes.
+	refreshMutex      sync.Mutex
+	refreshGeneration uint64
+
 	opts Options
+	// sizeLimit enforces opts.MaxSize, it is nil if the size is unlimited
+	sizeLimit *sizeLimitBackend
 
 	noAutoIndexUpdate bool
 
+	dupMutex sync.Mutex
+	dupStats DuplicateStats
+
 	packerWg *errgroup.Group
 	uploader *packerUploader
 	treePM   *packerManager
@@ -61,6 +74,44 @@ type Repository struct {
 type Options struct {
 	Compression CompressionMode
 	PackSize    uint
+	// MaxSize is the size limit of the repository in bytes, zero means unlimited.
+	MaxSize uint64
+	// IndexFlushThreshold is the memory usage in bytes at which new index
+	// entries are saved, zero means no limit.
+	IndexFlushThreshold uint64
+}
+
+// DuplicateStats counts the blobs passed to SaveBlob which were already
+// contained in the repository.
+type DuplicateStats struct {
+	// Suppressed is the number of known blobs which were not saved again.
+	Suppressed uint64
+	// Stored is the number of known blobs which were saved again as
+	// requested by the caller.
+	Stored uint64
+}
+
+// IndexConfig contains the options for the in-memory index.
+type IndexConfig struct {
+	IndexFlushThreshold string `option:"index-flush-threshold" help:"save new index entries once they use this much memory, e.g. 512M (default: unlimited)"`
+}
+
+func init() {
+	options.Register("repository", IndexConfig{})
+}
+
+// ParseIndexFlushThreshold returns the flush threshold in bytes, zero means
+// unlimited.
+func (cfg IndexConfig) ParseIndexFlushThreshold() (uint64, error) {
+	if cfg.IndexFlushThreshold == "" {
+		return 0, nil
+	}
+
+	size, err := ui.ParseBytes(cfg.IndexFlushThreshold)
+	if err != nil {
+		return 0, errors.Fatalf("invalid index flush threshold %q: %v", cfg.IndexFlushThreshold, err)
+	}
+	return uint64(size), nil
 }
 
 // CompressionMode configures if data should be compressed.
@@ -128,16 +179,45 @@ func New(be restic.Backend, opts Options) (*Repository, error) {
 		opts: opts,
 		idx:  index.NewMasterIndex(),
 	}
+	repo.idx.SetFlushThreshold(opts.IndexFlushThreshold)
+
+	if opts.MaxSize > 0 {
+		repo.sizeLimit = newSizeLimitBackend(be, opts.MaxSize)
+		repo.be = repo.sizeLimit
+	}
 
 	return repo, nil
 }
 
+// DisableSizeLimit removes the size limit of the repository. This is used
+// by operations which temporarily need additional space to reduce the size of
+// the repository.
+func (r *Repository) DisableSizeLimit() {
+	if r.sizeLimit != nil {
+		r.sizeLimit.disable()
+	}
+}
+
+// SizeLimit returns the current size of the repository and its size limit.
+// If the repository has no size limit, both values are zero.
+func (r *Repository) SizeLimit(ctx context.Context) (size, limit uint64, err error) {
+	if r.sizeLimit == nil {
+		return 0, 0, nil
+	}
+	return r.sizeLimit.Usage(ctx)
+}
+
 // DisableAutoIndexUpdate deactives the automatic finalization and upload of new
 // indexes once these are full
 func (r *Repository) DisableAutoIndexUpdate() {
 	r.noAutoIndexUpdate = true
 }
 
+// EnableAutoIndexUpdate reverts DisableAutoIndexUpdate.
+func (r *Repository) EnableAutoIndexUpdate() {
+	r.noAutoIndexUpdate = false
+}
+
 // setConfig assigns the given config and updates the repository parameters accordingly
 func (r *Repository) setConfig(cfg restic.Config) {
 	r.cfg = cfg
@@ -166,6 +246,22 @@ func (r *Repository) UseCache(c *cache.Cache) {
 	r.be = c.Wrap(r.be)
 }
 
+// DisableListCache makes all listings query the backend instead of using
+// listings stored in the cache. This is used by operations which must see
+// the current state of the repository.
+func (r *Repository) DisableListCache() {
+	if r.Cache != nil {
+		r.Cache.DisableListCache()
+	}
+}
+
+// DisableDataCache makes all further loads of data packs query the backend.
+func (r *Repository) DisableDataCache() {
+	if r.Cache != nil {
+		r.Cache.DisableDataCache()
+	}
+}
+
 // SetDryRun sets the repo backend into dry-run mode.
 func (r *Repository) SetDryRun() {
 	r.be = dryrun.New(r.be)
@@ -222,7 +318,7 @@ func (r *Repository) LoadUnpacked(ctx context.Context, t restic.FileType, id res
 	nonce, ciphertext := buf[:r.key.NonceSize()], buf[r.key.NonceSize():]
 	plaintext, err := r.key.Open(ciphertext[:0], nonce, ciphertext, nil)
 	if err != nil {
-		return nil, err
+		return nil, r.keyError(err)
 	}
 	if t != restic.ConfigFile {
 		return r.decompressUnpacked(plaintext)
@@ -265,6 +361,10 @@ func sortCachedPacksFirst(cache haver, blobs []restic.PackedBlob) {
 func (r *Repository) LoadBlob(ctx context.Context, t restic.BlobType, id restic.ID, buf []byte) ([]byte, error) {
 	debug.Log("load %v with id %v (buf len %v, cap %d)", t, id, len(buf), cap(buf))
 
+	r.refreshMutex.Lock()
+	generation := r.refreshGeneration
+	r.refreshMutex.Unlock()
+
 	// lookup packs
 	blobs := r.idx.Lookup(restic.BlobHandle{ID: id, Type: t})
 	if len(blobs) == 0 {
@@ -272,9 +372,39 @@ func (r *Repository) LoadBlob(ctx context.Context, t restic.BlobType, id restic.
 		return nil, errors.Errorf("id %v not found in repository", id)
 	}
 
+	plaintext, missing, err := r.loadBlobFrom(ctx, t, id, blobs, buf)
+	if err == nil || len(missing) == 0 {
+		return plaintext, err
+	}
+
+	// another client may have removed the pack files, e.g. by running prune,
+	// look for other locations of the blob in the current index files
+	debug.Log("packs %v of blob %v are missing, refreshing the index", missing, id)
+	if rerr := r.refreshIndex(ctx, generation); rerr != nil {
+		debug.Log("refreshing the index failed: %v", rerr)
+		return nil, err
+	}
+
+	var others []restic.PackedBlob
+	for _, blob := range r.idx.Lookup(restic.BlobHandle{ID: id, Type: t}) {
+		if !missing.Has(blob.PackID) {
+			others = append(others, blob)
+		}
+	}
+	if len(others) == 0 {
+		return nil, err
+	}
+	plaintext, _, err = r.loadBlobFrom(ctx, t, id, others, buf)
+	return plaintext, err
+}
+
+// loadBlobFrom loads the blob from one of the given locations. It returns the
+// IDs of pack files which do not exist in the backend.
+func (r *Repository) loadBlobFrom(ctx context.Context, t restic.BlobType, id restic.ID, blobs []restic.PackedBlob, buf []byte) ([]byte, restic.IDSet, error) {
 	// try cached pack files first
 	sortCachedPacksFirst(r.Cache, blobs)
 
+	var missing restic.IDSet
 	var lastError error
 	for _, blob := range blobs {
 		debug.Log("blob %v/%v found: %v", t, id, blob)
@@ -296,6 +426,12 @@ func (r *Repository) LoadBlob(ctx context.Context, t restic.BlobType, id restic.
 		n, err := backend.ReadAt(ctx, r.be, h, int64(blob.Offset), buf)
 		if err != nil {
 			debug.Log("error loading blob %v: %v", blob, err)
+			if r.be.IsNotExist(err) {
+				if missing == nil {
+					missing = restic.NewIDSet()
+				}
+				missing.Insert(blob.PackID)
+			}
 			lastError = err
 			continue
 		}
@@ -311,7 +447,7 @@ func (r *Repository) LoadBlob(ctx context.Context, t restic.BlobType, id restic.
 		nonce, ciphertext := buf[:r.key.NonceSize()], buf[r.key.NonceSize():]
 		plaintext, err := r.key.Open(ciphertext[:0], nonce, ciphertext, nil)
 		if err != nil {
-			lastError = errors.Errorf("decrypting blob %v failed: %v", id, err)
+			lastError = errors.Errorf("decrypting blob %v failed: %v", id, r.keyError(err))
 			continue
 		}
 
@@ -330,19 +466,19 @@ func (r *Repository) LoadBlob(ctx context.Context, t restic.BlobType, id restic.
 		}
 
 		if len(plaintext) > cap(buf) {
-			return plaintext, nil
+			return plaintext, nil, nil
 		}
 		// move decrypted data to the start of the buffer
 		buf = buf[:len(plaintext)]
 		copy(buf, plaintext)
-		return buf, nil
+		return buf, nil, nil
 	}
 
 	if lastError != nil {
-		return nil, lastError
+		return nil, missing, lastError
 	}
 
-	return nil, errors.Errorf("loading blob %v from %v packs failed", id.Str(), len(blobs))
+	return nil, missing, errors.Errorf("loading blob %v from %v packs failed", id.Str(), len(blobs))
 }
 
 // LookupBlobSize returns the size of blob id.
@@ -497,21 +633,103 @@ func (r *Repository) SaveUnpacked(ctx context.Context, t restic.FileType, p []by
 	h := restic.Handle{Type: t, Name: id.String()}
 
 	err = r.be.Save(ctx, h, restic.NewByteReader(ciphertext, r.be.Hasher()))
+	if err != nil && t != restic.ConfigFile {
+		err = r.checkAlreadyExists(ctx, h, id, err)
+		if err == nil {
+			return id, nil
+		}
+	}
 	if err != nil {
 		debug.Log("error saving blob %v: %v", h, err)
 		return restic.ID{}, err
 	}
 
+	// a partially written snapshot or index breaks other commands, thus verify
+	// files which were saved by a backend that might leave such a file behind
+	if (t == restic.SnapshotFile || t == restic.IndexFile) && !hasAtomicSave(r.be) {
+		if err := r.verifyUnpacked(ctx, h, id); err != nil {
+			debug.Log("verifying %v failed, removing it: %v", h, err)
+			_ = r.be.Remove(ctx, h)
+			return restic.ID{}, err
+		}
+	}
+
 	debug.Log("blob %v saved", h)
 	return id, nil
 }
 
+// hasAtomicSave returns true if be never leaves partially written files
+// behind.
+func hasAtomicSave(be restic.Backend) bool {
+	saver := restic.AsBackend[restic.AtomicSaver](be)
+	return saver != nil && saver.HasAtomicSave()
+}
+
+// verifyUnpacked checks that the file at h in the backend, bypassing the
+// cache, has the hash id.
+func (r *Repository) verifyUnpacked(ctx context.Context, h restic.Handle, id restic.ID) error {
+	got, err := r.hashFile(ctx, h)
+	if err == nil && !got.Equal(id) {
+		err = errors.Errorf("file is damaged, its hash is %v", got.Str())
+	}
+	if err != nil {
+		return errors.Wrapf(err, "verifying saved %v failed", h)
+	}
+	return nil
+}
+
+// hashFile returns the SHA-256 hash of the file at h in the backend,
+// bypassing the cache.
+func (r *Repository) hashFile(ctx context.Context, h restic.Handle) (restic.ID, error) {
+	be := r.be
+	if cb, ok := be.(*cache.Backend); ok {
+		be = cb.Backend
+	}
+
+	var id restic.ID
+	err := be.Load(ctx, h, 0, 0, func(rd io.Reader) error {
+		hasher := sha256.New()
+		if _, err := io.Copy(hasher, rd); err != nil {
+			return err
+		}
+		id = restic.IDFromHash(hasher.Sum(nil))
+		return nil
+	})
+	return id, err
+}
+
+// checkAlreadyExists is called if saving the file h with the hash id failed
+// with err. Two processes which save the same data race to save a file with
+// the same name. If the backend refused to overwrite the file of the other
+// process, the existing file is accepted if its content is identical.
+// Otherwise err is returned.
+func (r *Repository) checkAlreadyExists(ctx context.Context, h restic.Handle, id restic.ID, err error) error {
+	if !errors.Is(err, restic.ErrAlreadyExists) {
+		return err
+	}
+
+	got, herr := r.hashFile(ctx, h)
+	if herr != nil {
+		debug.Log("loading existing %v failed: %v", h, herr)
+		return err
+	}
+	if !got.Equal(id) {
+		return errors.Errorf("saving %v failed, the existing file has different content (hash %v)", h, got.Str())
+	}
+
+	debug.Log("%v already exists with identical content", h)
+	return nil
+}
+
 // Flush saves all remaining packs and the index
 func (r *Repository) Flush(ctx context.Context) error {
 	if err := r.flushPacks(ctx); err != nil {
 		return err
 	}
 
+	dup := r.DuplicateStats()
+	debug.Log("duplicate blobs: %d suppressed, %d stored", dup.Suppressed, dup.Stored)
+
 	// Save index after flushing only if noAutoIndexUpdate is not set
 	if r.noAutoIndexUpdate {
 		return nil
@@ -530,8 +748,15 @@ func (r *Repository) StartPackUploader(ctx context.Context, wg *errgroup.Group)
 	r.treePM = newPackerManager(r.key, restic.TreeBlob, r.PackSize(), r.uploader.QueuePacker)
 	r.dataPM = newPackerManager(r.key, restic.DataBlob, r.PackSize(), r.uploader.QueuePacker)
 
+	treePM, dataPM := r.treePM, r.dataPM
 	wg.Go(func() error {
-		return innerWg.Wait()
+		err := innerWg.Wait()
+		if err != nil {
+			// the pending packs will never be uploaded
+			treePM.discard()
+			dataPM.discard()
+		}
+		return err
 	})
 }
 
@@ -577,6 +802,7 @@ func (r *Repository) Index() restic.MasterIndex {
 // SetIndex instructs the repository to use the given index.
 func (r *Repository) SetIndex(i restic.MasterIndex) error {
 	r.idx = i.(*index.MasterIndex)
+	r.idx.SetFlushThreshold(r.opts.IndexFlushThreshold)
 	return r.prepareCache()
 }
 
@@ -585,11 +811,14 @@ func (r *Repository) SetIndex(i restic.MasterIndex) error {
 func (r *Repository) LoadIndex(ctx context.Context) error {
 	debug.Log("Loading index")
 
+	var indexes []*index.Index
+	superseded := restic.NewIDSet()
 	err := index.ForAllIndexes(ctx, r, func(id restic.ID, idx *index.Index, oldFormat bool, err error) error {
 		if err != nil {
 			return err
 		}
-		r.idx.Insert(idx)
+		indexes = append(indexes, idx)
+		superseded.Merge(restic.NewIDSet(idx.Supersedes()...))
 		return nil
 	})
 
@@ -597,6 +826,19 @@ func (r *Repository) LoadIndex(ctx context.Context) error {
 		return err
 	}
 
+	for _, idx := range indexes {
+		ids, err := idx.IDs()
+		if err == nil && len(ids) == 1 && superseded.Has(ids[0]) {
+			// the index was replaced but not yet removed, for example by a
+			// prune run of another client. Skipping it also removes it from
+			// the cache below.
+			debug.Log("skipping superseded index %v", ids[0])
+			r.idx.MarkSuperseded(ids[0])
+			continue
+		}
+		r.idx.Insert(idx)
+	}
+
 	err = r.idx.MergeFinalIndexes()
 	if err != nil {
 		return err
@@ -661,7 +903,7 @@ func (r *Repository) CreateIndexFromPacks(ctx context.Context, packsize map[rest
 		for fi := range ch {
 			entries, _, err := r.ListPack(ctx, fi.ID, fi.Size)
 			if err != nil {
-				debug.Log("unable to list pack file %v", fi.ID.Str())
+				debug.Log("unable to list pack file %v: %v", fi.ID.Str(), err)
 				m.Lock()
 				invalid = append(invalid, fi.ID)
 				m.Unlock()
@@ -688,6 +930,58 @@ func (r *Repository) CreateIndexFromPacks(ctx context.Context, packsize map[rest
 	return invalid, nil
 }
 
+// refreshIndex loads the index files which were added to the repository since
+// the index was loaded and removes deleted index files from the cache. The
+// refresh is skipped if it was already performed since generation was read.
+func (r *Repository) refreshIndex(ctx context.Context, generation uint64) error {
+	r.refreshMutex.Lock()
+	defer r.refreshMutex.Unlock()
+
+	if generation != r.refreshGeneration {
+		return nil
+	}
+	r.refreshGeneration++
+
+	if r.Cache != nil {
+		// the cached listings may still contain the removed files
+		r.Cache.InvalidateList(restic.IndexFile)
+		r.Cache.InvalidateList(restic.PackFile)
+	}
+
+	known := r.idx.IDs()
+	present := restic.NewIDSet()
+	err := r.List(ctx, restic.IndexFile, func(id restic.ID, _ int64) error {
+		present.Insert(id)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for id := range present {
+		if known.Has(id) {
+			continue
+		}
+		buf, err := r.LoadUnpacked(ctx, restic.IndexFile, id)
+		if err != nil {
+			return err
+		}
+		idx, _, err := index.DecodeIndex(buf, id)
+		if err != nil {
+			return err
+		}
+		debug.Log("adding index %v", id)
+		r.idx.Insert(idx)
+	}
+
+	if r.Cache != nil {
+		if err := r.Cache.Clear(restic.IndexFile, present); err != nil {
+			debug.Log("error clearing index files in cache: %v", err)
+		}
+	}
+	return nil
+}
+
 // prepareCache initializes the local cache. indexIDs is the list of IDs of
 // index files still present in the repo.
 func (r *Repository) prepareCache() error {
@@ -716,7 +1010,9 @@ func (r *Repository) prepareCache() error {
 }
 
 // SearchKey finds a key with the supplied password, afterwards the config is
-// read and parsed. It tries at most maxKeys key files in the repo.
+// read and parsed. It tries at most maxKeys key files in the repo. If the
+// config is damaged, an error wrapping restic.ErrInvalidConfig is returned,
+// but the key is still used for the repository.
 func (r *Repository) SearchKey(ctx context.Context, password string, maxKeys int, keyHint string) error {
 	key, err := SearchKey(ctx, r, password, maxKeys, keyHint)
 	if err != nil {
@@ -726,8 +1022,11 @@ func (r *Repository) SearchKey(ctx context.Context, password string, maxKeys int
 	r.key = key.master
 	r.keyID = key.ID()
 	cfg, err := restic.LoadConfig(ctx, r)
-	if err == crypto.ErrUnauthenticated {
-		return fmt.Errorf("config or key %v is damaged: %w", key.ID(), err)
+	if errors.Is(err, crypto.ErrUnauthenticated) {
+		// the key was already verified, thus the config must be damaged
+		return fmt.Errorf("%w: %v", restic.ErrInvalidConfig, err)
+	} else if errors.Is(err, restic.ErrInvalidConfig) {
+		return err
 	} else if err != nil {
 		return fmt.Errorf("config cannot be loaded: %w", err)
 	}
@@ -790,6 +1089,16 @@ func (r *Repository) KeyID() restic.ID {
 	return r.keyID
 }
 
+// keyError adds the ID of the current key to decryption errors. A key which
+// was replaced or removed concurrently otherwise results in errors which are
+// hard to diagnose.
+func (r *Repository) keyError(err error) error {
+	if errors.Is(err, crypto.ErrUnauthenticated) {
+		return fmt.Errorf("%w (using key %v)", err, r.keyID.Str())
+	}
+	return err
+}
+
 // List runs fn for all files of type t in the repo.
 func (r *Repository) List(ctx context.Context, t restic.FileType, fn func(restic.ID, int64) error) error {
 	return r.be.List(ctx, t, func(fi restic.FileInfo) error {
@@ -803,11 +1112,25 @@ func (r *Repository) List(ctx context.Context, t restic.FileType, fn func(restic
 }
 
 // ListPack returns the list of blobs saved in the pack id and the length of
-// the the pack header.
+// the the pack header. If the pack header is damaged, the returned error
+// matches pack.ErrInvalidHeader.
 func (r *Repository) ListPack(ctx context.Context, id restic.ID, size int64) ([]restic.Blob, uint32, error) {
 	h := restic.Handle{Type: restic.PackFile, Name: id.String()}
 
-	return pack.List(r.Key(), backend.ReaderAt(ctx, r.Backend(), h), size)
+	blobs, hdrSize, err := pack.List(r.Key(), backend.ReaderAt(ctx, r.Backend(), h), size)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// the blobs must fit into the part of the file before the header
+	for _, blob := range blobs {
+		if int64(blob.Offset)+int64(blob.Length) > size-int64(hdrSize) {
+			err := pack.InvalidFileError{Message: fmt.Sprintf("blob %v at offset %d with length %d exceeds the pack size", blob.ID.Str(), blob.Offset, blob.Length)}
+			return nil, 0, errors.Wrap(err, "ListPack")
+		}
+	}
+
+	return blobs, hdrSize, nil
 }
 
 // Delete calls backend.Delete() if implemented, and returns an error
@@ -852,9 +1175,27 @@ func (r *Repository) SaveBlob(ctx context.Context, t restic.BlobType, buf []byte
 		size, err = r.saveAndEncrypt(ctx, t, buf, newID)
 	}
 
+	if known {
+		r.dupMutex.Lock()
+		if storeDuplicate {
+			r.dupStats.Stored++
+		} else {
+			r.dupStats.Suppressed++
+		}
+		r.dupMutex.Unlock()
+	}
+
 	return newID, known, size, err
 }
 
+// DuplicateStats returns the number of already known blobs passed to
+// SaveBlob so far.
+func (r *Repository) DuplicateStats() DuplicateStats {
+	r.dupMutex.Lock()
+	defer r.dupMutex.Unlock()
+	return r.dupStats
+}
+
 type BackendLoadFn func(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error
 
 // Skip sections with more than 4MB unused blobs
@@ -926,6 +1267,10 @@ func streamPackPart(ctx context.Context, beLoad BackendLoadFn, key *crypto.Key,
 		var buf []byte
 		var decode []byte
 		for _, entry := range blobs {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
 			skipBytes := int(entry.Offset - currentBlobEnd)
 			if skipBytes < 0 {
 				return errors.Errorf("overlapping blobs in pack %v", packID)
@@ -1,12 +1,19 @@
 package repository
 
 import (
+	"context"
 	"math/rand"
 	"sort"
+	"strings"
 	"testing"
 
+	"github.com/restic/restic/internal/backend/mem"
+	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/index"
 	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
+	"golang.org/x/sync/errgroup"
 )
 
 type mapcache map[restic.Handle]bool
@@ -72,3 +79,64 @@ func BenchmarkSortCachedPacksFirst(b *testing.B) {
 		sortCachedPacksFirst(cache, cpy[:])
 	}
 }
+
+func TestIndexFlushThreshold(t *testing.T) {
+	TestUseLowSecurityKDFParameters(t)
+	restic.TestDisableCheckPolynomial(t)
+
+	// only the flush threshold should cause indexes to be saved
+	defer func(f func(*index.Index, bool) bool) {
+		index.IndexFull = f
+	}(index.IndexFull)
+	index.IndexFull = func(*index.Index, bool) bool { return false }
+
+	for _, test := range []struct {
+		threshold uint64
+		indexes   int
+	}{
+		{0, 1},
+		{1, 3},
+	} {
+		repo, err := New(mem.New(), Options{PackSize: MinPackSize, IndexFlushThreshold: test.threshold})
+		rtest.OK(t, err)
+		rtest.OK(t, repo.init(context.TODO(), rtest.TestPassword, restic.TestCreateConfig(t, TestChunkerPol, 2)))
+
+		var wg errgroup.Group
+		repo.StartPackUploader(context.TODO(), &wg)
+		// each blob fills a pack file
+		for i := 0; i < 3; i++ {
+			_, _, _, err := repo.SaveBlob(context.TODO(), restic.DataBlob, rtest.Random(i, MinPackSize+1), restic.ID{}, false)
+			rtest.OK(t, err)
+		}
+		rtest.OK(t, repo.Flush(context.TODO()))
+
+		count := 0
+		rtest.OK(t, repo.List(context.TODO(), restic.IndexFile, func(restic.ID, int64) error {
+			count++
+			return nil
+		}))
+		rtest.Equals(t, test.indexes, count)
+	}
+}
+
+func TestDecryptionErrorContainsKeyID(t *testing.T) {
+	repo := TestRepository(t).(*Repository)
+
+	var wg errgroup.Group
+	repo.StartPackUploader(context.TODO(), &wg)
+	id, _, _, err := repo.SaveBlob(context.TODO(), restic.DataBlob, []byte("foobar"), restic.ID{}, false)
+	rtest.OK(t, err)
+	rtest.OK(t, repo.Flush(context.TODO()))
+
+	// simulate that the data was encrypted using a different master key
+	repo.key = crypto.NewRandomKey()
+	keyID := repo.keyID.Str()
+
+	_, err = repo.LoadUnpacked(context.TODO(), restic.ConfigFile, restic.ID{})
+	rtest.Assert(t, errors.Is(err, crypto.ErrUnauthenticated), "expected ErrUnauthenticated, got %v", err)
+	rtest.Assert(t, strings.Contains(err.Error(), keyID), "error %q does not contain key ID %v", err, keyID)
+
+	_, err = repo.LoadBlob(context.TODO(), restic.DataBlob, id, nil)
+	rtest.Assert(t, err != nil, "expected error loading blob")
+	rtest.Assert(t, strings.Contains(err.Error(), keyID), "error %q does not contain key ID %v", err, keyID)
+}
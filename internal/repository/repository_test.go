@@ -16,9 +16,13 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/klauspost/compress/zstd"
+	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/backend/local"
+	"github.com/restic/restic/internal/cache"
 	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/index"
+	"github.com/restic/restic/internal/pack"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
@@ -169,6 +173,156 @@ func testLoadBlob(t *testing.T, version uint) {
 	}
 }
 
+// loadCountingBackend counts the calls to Load.
+type loadCountingBackend struct {
+	restic.Backend
+	loads int
+}
+
+func (be *loadCountingBackend) Load(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+	be.loads++
+	return be.Backend.Load(ctx, h, length, offset, fn)
+}
+
+// truncatingSaveBackend saves only the first half of snapshot files, like an
+// interrupted upload to a backend without atomic writes.
+type truncatingSaveBackend struct {
+	restic.Backend
+}
+
+func (be *truncatingSaveBackend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	if h.Type != restic.SnapshotFile {
+		return be.Backend.Save(ctx, h, rd)
+	}
+	buf, err := io.ReadAll(rd)
+	if err != nil {
+		return err
+	}
+	buf = buf[:len(buf)/2]
+	return be.Backend.Save(ctx, h, restic.NewByteReader(buf, be.Hasher()))
+}
+
+func TestSaveUnpackedVerify(t *testing.T) {
+	be := &truncatingSaveBackend{Backend: repository.TestBackend(t)}
+	repo := repository.TestRepositoryWithBackend(t, be, 0)
+
+	sn, err := restic.NewSnapshot([]string{"/foo"}, nil, "host", time.Now())
+	rtest.OK(t, err)
+	sn.Tree = &restic.ID{}
+
+	_, err = restic.SaveSnapshot(context.TODO(), repo, sn)
+	rtest.Assert(t, err != nil, "saving a truncated snapshot should fail")
+
+	// the damaged file must not be visible
+	err = be.List(context.TODO(), restic.SnapshotFile, func(fi restic.FileInfo) error {
+		return errors.Errorf("unexpected snapshot file %v", fi.Name)
+	})
+	rtest.OK(t, err)
+
+	// files saved by backends with atomic writes are not verified
+	counter := &loadCountingBackend{Backend: repository.TestBackend(t)}
+	repo = repository.TestRepositoryWithBackend(t, counter, 0)
+	_, err = repo.SaveUnpacked(context.TODO(), restic.SnapshotFile, []byte("foo"))
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, counter.loads)
+
+	counter = &loadCountingBackend{Backend: repository.TestBackend(t)}
+	repo = repository.TestRepositoryWithBackend(t, atomicSaveBackend{counter}, 0)
+	_, err = repo.SaveUnpacked(context.TODO(), restic.SnapshotFile, []byte("foo"))
+	rtest.OK(t, err)
+	rtest.Equals(t, 0, counter.loads)
+}
+
+// racingSaveBackend simulates a concurrent process which saves a file with
+// the same name right before each Save call. The content saved by the other
+// process is the data passed to Save, modified by other.
+type racingSaveBackend struct {
+	restic.Backend
+	other func([]byte) []byte
+}
+
+func (be *racingSaveBackend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	if h.Type == restic.ConfigFile || h.Type == restic.KeyFile {
+		return be.Backend.Save(ctx, h, rd)
+	}
+	buf, err := io.ReadAll(rd)
+	if err != nil {
+		return err
+	}
+	buf = be.other(append([]byte(nil), buf...))
+	if err := be.Backend.Save(ctx, h, restic.NewByteReader(buf, be.Hasher())); err != nil {
+		return err
+	}
+	if err := rd.Rewind(); err != nil {
+		return err
+	}
+	return be.Backend.Save(ctx, h, rd)
+}
+
+func TestSaveAlreadyExists(t *testing.T) {
+	identical := func(buf []byte) []byte { return buf }
+	be := &racingSaveBackend{Backend: repository.TestBackend(t), other: identical}
+	repo := repository.TestRepositoryWithBackend(t, be, 0)
+
+	id, err := repo.SaveUnpacked(context.TODO(), restic.SnapshotFile, []byte("foo"))
+	rtest.OK(t, err)
+	buf, err := repo.LoadUnpacked(context.TODO(), restic.SnapshotFile, id)
+	rtest.OK(t, err)
+	rtest.Equals(t, []byte("foo"), buf)
+
+	var wg errgroup.Group
+	repo.StartPackUploader(context.TODO(), &wg)
+	blobID, _, _, err := repo.SaveBlob(context.TODO(), restic.DataBlob, []byte("bar"), restic.ID{}, false)
+	rtest.OK(t, err)
+	rtest.OK(t, repo.Flush(context.TODO()))
+	rtest.OK(t, wg.Wait())
+	buf, err = repo.LoadBlob(context.TODO(), restic.DataBlob, blobID, nil)
+	rtest.OK(t, err)
+	rtest.Equals(t, []byte("bar"), buf)
+
+	// a file with the same name but different content is an error
+	damaged := func(buf []byte) []byte {
+		buf[0] ^= 0xff
+		return buf
+	}
+	be = &racingSaveBackend{Backend: repository.TestBackend(t), other: damaged}
+	repo = repository.TestRepositoryWithBackend(t, be, 0)
+	_, err = repo.SaveUnpacked(context.TODO(), restic.SnapshotFile, []byte("foo"))
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "different content"),
+		"expected error for different content, got %v", err)
+}
+
+// atomicSaveBackend claims that Save is atomic.
+type atomicSaveBackend struct {
+	restic.Backend
+}
+
+func (atomicSaveBackend) HasAtomicSave() bool { return true }
+
+func TestLoadBlobDataCache(t *testing.T) {
+	be := &loadCountingBackend{Backend: repository.TestBackend(t)}
+	repo := repository.TestRepositoryWithBackend(t, be, 0).(*repository.Repository)
+
+	c := cache.TestNewCache(t)
+	c.SetDataCacheSize(1 << 30)
+	repo.UseCache(c)
+
+	buf := rtest.Random(23, 1000)
+	var wg errgroup.Group
+	repo.StartPackUploader(context.TODO(), &wg)
+	id, _, _, err := repo.SaveBlob(context.TODO(), restic.DataBlob, buf, restic.ID{}, false)
+	rtest.OK(t, err)
+	rtest.OK(t, repo.Flush(context.Background()))
+
+	be.loads = 0
+	for i := 0; i < 2; i++ {
+		data, err := repo.LoadBlob(context.TODO(), restic.DataBlob, id, nil)
+		rtest.OK(t, err)
+		rtest.Equals(t, buf, data)
+	}
+	rtest.Equals(t, 1, be.loads)
+}
+
 func BenchmarkLoadBlob(b *testing.B) {
 	repository.BenchmarkAllVersions(b, benchmarkLoadBlob)
 }
@@ -327,6 +481,23 @@ func TestRepositoryLoadUnpackedRetryBroken(t *testing.T) {
 	rtest.OK(t, repo.LoadIndex(context.TODO()))
 }
 
+func TestSearchKeyWrongPassword(t *testing.T) {
+	repodir, cleanup := rtest.Env(t, repoFixture)
+	defer cleanup()
+
+	be, err := local.Open(context.TODO(), local.Config{Path: repodir, Connections: 2})
+	rtest.OK(t, err)
+	repo, err := repository.New(be, repository.Options{})
+	rtest.OK(t, err)
+
+	err = repo.SearchKey(context.TODO(), "wrong", 10, "")
+	rtest.Assert(t, errors.Is(err, repository.ErrNoKeyFound), "expected ErrNoKeyFound, got %v", err)
+	var keyErr *repository.NoKeyFoundError
+	rtest.Assert(t, errors.As(err, &keyErr), "expected NoKeyFoundError, got %T", err)
+	rtest.Equals(t, 1, keyErr.Tried)
+	rtest.Equals(t, "wrong password or no key found: tried 1 key, none matches the password", err.Error())
+}
+
 func BenchmarkLoadIndex(b *testing.B) {
 	repository.BenchmarkAllVersions(b, benchmarkLoadIndex)
 }
@@ -674,3 +845,185 @@ func TestInvalidCompression(t *testing.T) {
 	_, err = repository.New(nil, repository.Options{Compression: comp})
 	rtest.Assert(t, err != nil, "missing error")
 }
+
+func TestListPackDamaged(t *testing.T) {
+	repo := repository.TestRepository(t)
+
+	var wg errgroup.Group
+	repo.StartPackUploader(context.TODO(), &wg)
+	_, _, _, err := repo.SaveBlob(context.TODO(), restic.DataBlob, rtest.Random(23, 100000), restic.ID{}, false)
+	rtest.OK(t, err)
+	rtest.OK(t, repo.Flush(context.Background()))
+
+	packs := make(map[restic.ID]int64)
+	rtest.OK(t, repo.List(context.TODO(), restic.PackFile, func(id restic.ID, size int64) error {
+		packs[id] = size
+		return nil
+	}))
+	rtest.Equals(t, 1, len(packs))
+
+	var packID restic.ID
+	for id := range packs {
+		packID = id
+	}
+	be := repo.Backend()
+	data, err := backend.LoadAll(context.TODO(), nil, be, restic.Handle{Type: restic.PackFile, Name: packID.String()})
+	rtest.OK(t, err)
+
+	flipped := append([]byte{}, data...)
+	flipped[len(flipped)-10] ^= 0x01
+
+	damaged := restic.NewIDSet()
+	for _, buf := range [][]byte{
+		// the blob no longer fits into the file
+		data[1000:],
+		// the header fails to decrypt
+		flipped,
+		// the header length is out of range
+		append(append([]byte{}, data[:len(data)-4]...), 0xff, 0xff, 0xff, 0x7f),
+	} {
+		id := restic.Hash(buf)
+		rtest.OK(t, be.Save(context.TODO(), restic.Handle{Type: restic.PackFile, Name: id.String()}, restic.NewByteReader(buf, be.Hasher())))
+		packs[id] = int64(len(buf))
+		damaged.Insert(id)
+
+		_, _, err := repo.ListPack(context.TODO(), id, int64(len(buf)))
+		rtest.Assert(t, errors.Is(err, pack.ErrInvalidHeader), "unexpected error for damaged pack: %v", err)
+	}
+
+	// the damaged packs are skipped when creating the index
+	invalid, err := repo.(*repository.Repository).CreateIndexFromPacks(context.TODO(), packs, nil)
+	rtest.OK(t, err)
+	rtest.Equals(t, damaged, restic.NewIDSet(invalid...))
+}
+
+// openTestClient opens the repository in be like a second restic process
+// which uses a cache.
+func openTestClient(t *testing.T, be restic.Backend) *repository.Repository {
+	repo, err := repository.New(be, repository.Options{})
+	rtest.OK(t, err)
+	rtest.OK(t, repo.SearchKey(context.TODO(), rtest.TestPassword, 10, ""))
+	repo.UseCache(cache.TestNewCache(t))
+	rtest.OK(t, repo.LoadIndex(context.TODO()))
+	return repo
+}
+
+// pruneAll simulates a prune run of another client: all pack files are
+// repacked, the index is rewritten and the old files are removed.
+func pruneAll(t *testing.T, repo restic.Repository, keep restic.BlobSet) {
+	packs := repo.Index().(*index.MasterIndex).Packs(restic.NewIDSet())
+	obsoletePacks, err := repository.Repack(context.TODO(), repo, repo, packs, keep, true, nil)
+	rtest.OK(t, err)
+
+	obsoleteIndexes, err := repo.Index().Save(context.TODO(), repo, obsoletePacks, nil, nil)
+	rtest.OK(t, err)
+
+	for id := range obsoleteIndexes {
+		rtest.OK(t, repo.Backend().Remove(context.TODO(), restic.Handle{Type: restic.IndexFile, Name: id.String()}))
+	}
+	for id := range obsoletePacks {
+		rtest.OK(t, repo.Backend().Remove(context.TODO(), restic.Handle{Type: restic.PackFile, Name: id.String()}))
+	}
+	reloadIndex(t, repo)
+}
+
+func TestLoadBlobAfterPruneByOtherClient(t *testing.T) {
+	be := repository.TestBackend(t)
+	repo := repository.TestRepositoryWithBackend(t, be, 0)
+
+	var wg errgroup.Group
+	repo.StartPackUploader(context.TODO(), &wg)
+	buf := rtest.Random(42, 1000)
+	id, _, _, err := repo.SaveBlob(context.TODO(), restic.TreeBlob, buf, restic.ID{}, false)
+	rtest.OK(t, err)
+	rtest.OK(t, repo.Flush(context.TODO()))
+
+	client := openTestClient(t, be)
+
+	// the other client removes the pack file and the index the client knows about
+	pruneAll(t, repo, restic.NewBlobSet(restic.BlobHandle{ID: id, Type: restic.TreeBlob}))
+
+	data, err := client.LoadBlob(context.TODO(), restic.TreeBlob, id, nil)
+	rtest.OK(t, err)
+	rtest.Equals(t, buf, data)
+
+	// the removed index file is dropped from the cache
+	for indexID := range client.Index().(*index.MasterIndex).IDs() {
+		_, err := be.Stat(context.TODO(), restic.Handle{Type: restic.IndexFile, Name: indexID.String()})
+		if err != nil {
+			rtest.Assert(t, !client.Cache.Has(restic.Handle{Type: restic.IndexFile, Name: indexID.String()}),
+				"removed index %v still cached", indexID.Str())
+		}
+	}
+
+}
+
+func TestLoadIndexSkipsSupersededIndex(t *testing.T) {
+	be := repository.TestBackend(t)
+	repo := repository.TestRepositoryWithBackend(t, be, 0)
+
+	var wg errgroup.Group
+	repo.StartPackUploader(context.TODO(), &wg)
+	buf := rtest.Random(23, 1000)
+	id, _, _, err := repo.SaveBlob(context.TODO(), restic.DataBlob, buf, restic.ID{}, false)
+	rtest.OK(t, err)
+	rtest.OK(t, repo.Flush(context.TODO()))
+	oldIndexes := repo.Index().(*index.MasterIndex).IDs()
+
+	client := openTestClient(t, be)
+	for indexID := range oldIndexes {
+		rtest.Assert(t, client.Cache.Has(restic.Handle{Type: restic.IndexFile, Name: indexID.String()}),
+			"index %v not cached", indexID.Str())
+	}
+
+	// another client rewrites the index but was interrupted before removing
+	// the old index files
+	_, err = repo.Index().Save(context.TODO(), repo, restic.NewIDSet(), nil, nil)
+	rtest.OK(t, err)
+
+	client = openTestClient(t, be)
+	for indexID := range oldIndexes {
+		rtest.Assert(t, !client.Index().(*index.MasterIndex).IDs().Has(indexID), "superseded index %v was loaded", indexID.Str())
+		rtest.Assert(t, !client.Cache.Has(restic.Handle{Type: restic.IndexFile, Name: indexID.String()}),
+			"superseded index %v still cached", indexID.Str())
+	}
+	data, err := client.LoadBlob(context.TODO(), restic.DataBlob, id, nil)
+	rtest.OK(t, err)
+	rtest.Equals(t, buf, data)
+
+	// rewriting the index again reports the superseded index files as obsolete
+	obsolete, err := client.Index().Save(context.TODO(), client, restic.NewIDSet(), nil, nil)
+	rtest.OK(t, err)
+	for indexID := range oldIndexes {
+		rtest.Assert(t, obsolete.Has(indexID), "superseded index %v is not obsolete", indexID.Str())
+	}
+}
+
+func TestSaveBlobDuplicateStats(t *testing.T) {
+	repo := repository.TestRepository(t).(*repository.Repository)
+
+	var wg errgroup.Group
+	repo.StartPackUploader(context.TODO(), &wg)
+
+	// save 20 blobs, half of which are duplicates
+	var blobs [][]byte
+	for i := 0; i < 10; i++ {
+		buf := rtest.Random(i, 1000)
+		blobs = append(blobs, buf, buf)
+	}
+	for _, buf := range blobs {
+		_, _, _, err := repo.SaveBlob(context.TODO(), restic.DataBlob, buf, restic.ID{}, false)
+		rtest.OK(t, err)
+	}
+	rtest.Equals(t, repository.DuplicateStats{Suppressed: 10}, repo.DuplicateStats())
+
+	// saving known blobs again on request is counted separately
+	for _, buf := range blobs[:4] {
+		_, known, size, err := repo.SaveBlob(context.TODO(), restic.DataBlob, buf, restic.ID{}, true)
+		rtest.OK(t, err)
+		rtest.Assert(t, known, "blob not reported as known")
+		rtest.Assert(t, size > 0, "duplicate blob was not stored")
+	}
+	rtest.OK(t, repo.Flush(context.TODO()))
+	rtest.Equals(t, repository.DuplicateStats{Suppressed: 10, Stored: 4}, repo.DuplicateStats())
+}
@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/options"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
+)
+
+// ErrSizeLimit is returned when saving a pack file would grow the repository
+// beyond its size limit.
+var ErrSizeLimit = errors.New("repository size limit reached")
+
+// SizeLimitConfig contains the options for the repository size limit.
+type SizeLimitConfig struct {
+	MaxSize string `option:"max-size" help:"refuse to grow the repository beyond this size, e.g. 500G (default: unlimited)"`
+}
+
+func init() {
+	options.Register("repository", SizeLimitConfig{})
+}
+
+// ParseMaxSize returns the size limit in bytes, zero means unlimited.
+func (cfg SizeLimitConfig) ParseMaxSize() (uint64, error) {
+	if cfg.MaxSize == "" {
+		return 0, nil
+	}
+
+	size, err := ui.ParseBytes(cfg.MaxSize)
+	if err != nil {
+		return 0, errors.Fatalf("invalid repository size limit %q: %v", cfg.MaxSize, err)
+	}
+	return uint64(size), nil
+}
+
+// sizeLimitBackend keeps track of the size of all files in the repository
+// and refuses to save pack files once the limit is reached. All other files
+// are still saved, so that the data which was uploaded so far can be indexed.
+type sizeLimitBackend struct {
+	restic.Backend
+	limit uint64
+
+	m        sync.Mutex
+	size     uint64
+	known    bool
+	disabled bool
+}
+
+func newSizeLimitBackend(be restic.Backend, limit uint64) *sizeLimitBackend {
+	return &sizeLimitBackend{
+		Backend: be,
+		limit:   limit,
+	}
+}
+
+// disable stops enforcing and tracking the size limit.
+func (be *sizeLimitBackend) disable() {
+	be.m.Lock()
+	defer be.m.Unlock()
+	be.disabled = true
+	be.known = false
+}
+
+func (be *sizeLimitBackend) isDisabled() bool {
+	be.m.Lock()
+	defer be.m.Unlock()
+	return be.disabled
+}
+
+// loadSize lists all files in the repository to determine its size, unless
+// it is already known. Lock files are not counted. It must be called with
+// the mutex held.
+func (be *sizeLimitBackend) loadSize(ctx context.Context) error {
+	if be.known {
+		return nil
+	}
+
+	var size uint64
+	for _, t := range []restic.FileType{restic.PackFile, restic.IndexFile, restic.SnapshotFile, restic.KeyFile} {
+		err := be.Backend.List(ctx, t, func(fi restic.FileInfo) error {
+			size += uint64(fi.Size)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	debug.Log("repository size is %d bytes, limit %d bytes", size, be.limit)
+	be.size = size
+	be.known = true
+	return nil
+}
+
+// Usage returns the current size of the repository and the limit.
+func (be *sizeLimitBackend) Usage(ctx context.Context) (size, limit uint64, err error) {
+	be.m.Lock()
+	defer be.m.Unlock()
+
+	err = be.loadSize(ctx)
+	return be.size, be.limit, err
+}
+
+// Save stores the file if this does not grow the repository beyond the limit.
+func (be *sizeLimitBackend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	if h.Type == restic.LockFile || be.isDisabled() {
+		return be.Backend.Save(ctx, h, rd)
+	}
+
+	length := uint64(rd.Length())
+
+	be.m.Lock()
+	err := be.loadSize(ctx)
+	if err == nil && h.Type == restic.PackFile && be.size+length > be.limit {
+		err = fmt.Errorf("%w: saving %v more would exceed the limit of %v, %v are used",
+			ErrSizeLimit, ui.FormatBytes(length), ui.FormatBytes(be.limit), ui.FormatBytes(be.size))
+	}
+	if err == nil {
+		// reserve the space while the file is uploaded
+		be.size += length
+	}
+	be.m.Unlock()
+	if err != nil {
+		return err
+	}
+
+	err = be.Backend.Save(ctx, h, rd)
+	if err != nil {
+		be.m.Lock()
+		be.size -= length
+		be.m.Unlock()
+	}
+	return err
+}
+
+// Remove removes the file and subtracts its size from the size of the
+// repository.
+func (be *sizeLimitBackend) Remove(ctx context.Context, h restic.Handle) error {
+	if h.Type == restic.LockFile || be.isDisabled() {
+		return be.Backend.Remove(ctx, h)
+	}
+
+	fi, err := be.Backend.Stat(ctx, h)
+	if err != nil {
+		// the size of the file is unknown, recount on the next upload
+		be.m.Lock()
+		be.known = false
+		be.m.Unlock()
+		return be.Backend.Remove(ctx, h)
+	}
+
+	err = be.Backend.Remove(ctx, h)
+	if err != nil {
+		return err
+	}
+
+	be.m.Lock()
+	if be.known && be.size >= uint64(fi.Size) {
+		be.size -= uint64(fi.Size)
+	} else {
+		be.known = false
+	}
+	be.m.Unlock()
+	return nil
+}
+
+func (be *sizeLimitBackend) Unwrap() restic.Backend {
+	return be.Backend
+}
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/restic/restic/internal/backend/mem"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func saveFile(be restic.Backend, tpe restic.FileType, size int) (restic.Handle, error) {
+	data := rtest.Random(size, size)
+	h := restic.Handle{Type: tpe, Name: restic.Hash(data).String()}
+	return h, be.Save(context.TODO(), h, restic.NewByteReader(data, be.Hasher()))
+}
+
+func TestSizeLimitBackend(t *testing.T) {
+	inner := mem.New()
+	_, err := saveFile(inner, restic.PackFile, 400)
+	rtest.OK(t, err)
+
+	be := newSizeLimitBackend(inner, 1000)
+	size, limit, err := be.Usage(context.TODO())
+	rtest.OK(t, err)
+	rtest.Equals(t, uint64(400), size)
+	rtest.Equals(t, uint64(1000), limit)
+
+	h, err := saveFile(be, restic.PackFile, 500)
+	rtest.OK(t, err)
+
+	// the pack file would exceed the limit
+	_, err = saveFile(be, restic.PackFile, 200)
+	rtest.Assert(t, errors.Is(err, ErrSizeLimit), "unexpected error %v", err)
+
+	// index files and lock files are still saved
+	_, err = saveFile(be, restic.IndexFile, 200)
+	rtest.OK(t, err)
+	_, err = saveFile(be, restic.LockFile, 200)
+	rtest.OK(t, err)
+
+	size, _, err = be.Usage(context.TODO())
+	rtest.OK(t, err)
+	rtest.Equals(t, uint64(1100), size)
+
+	// removing a file frees space
+	rtest.OK(t, be.Remove(context.TODO(), h))
+	size, _, err = be.Usage(context.TODO())
+	rtest.OK(t, err)
+	rtest.Equals(t, uint64(600), size)
+
+	_, err = saveFile(be, restic.PackFile, 300)
+	rtest.OK(t, err)
+	// the limit is not enforced once it is disabled
+	be.disable()
+	_, err = saveFile(be, restic.PackFile, 2000)
+	rtest.OK(t, err)
+}
+
+func TestSizeLimitConfig(t *testing.T) {
+	for _, test := range []struct {
+		maxSize string
+		size    uint64
+		err     bool
+	}{
+		{"", 0, false},
+		{"1000", 1000, false},
+		{"500G", 500 << 30, false},
+		{"5X", 0, true},
+	} {
+		size, err := SizeLimitConfig{MaxSize: test.maxSize}.ParseMaxSize()
+		if test.err {
+			rtest.Assert(t, err != nil, "missing error for %q", test.maxSize)
+			continue
+		}
+		rtest.OK(t, err)
+		rtest.Equals(t, test.size, size)
+	}
+}
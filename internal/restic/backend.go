@@ -4,8 +4,16 @@ import (
 	"context"
 	"hash"
 	"io"
+	"os"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
 )
 
+// ErrAlreadyExists is returned by Backend.Save if the backend refuses to
+// overwrite an existing file with the same name.
+var ErrAlreadyExists = errors.New("file already exists")
+
 // Backend is used to store and access data.
 //
 // Backend operations that return an error will be retried when a Backend is
@@ -52,6 +60,9 @@ type Backend interface {
 	// List runs fn for each file in the backend which has the type t. When an
 	// error occurs (or fn returns an error), List stops and returns it.
 	//
+	// The FileInfo passed to fn must contain both the name and the size of
+	// the file. Callers rely on the size and do not call Stat for each file.
+	//
 	// The function fn is called exactly once for each file during successful
 	// execution and at most once in case of an error.
 	//
@@ -92,6 +103,96 @@ func AsBackend[B Backend](b Backend) B {
 	return be
 }
 
+// RangeCopier is an optional interface for backends which store files in the
+// local filesystem. It allows copying a part of a file without passing the
+// data through userspace.
+type RangeCopier interface {
+	Backend
+	// CopyRange copies length bytes starting at offset from the file at h to
+	// the current position of dst. If length is zero, the remainder of the
+	// file is copied.
+	CopyRange(ctx context.Context, h Handle, length int, offset int64, dst *os.File) error
+}
+
+// AsRangeCopier returns the outermost backend wrapped by b which implements
+// RangeCopier. Backend wrappers pass CopyRange through to the backend they
+// wrap, therefore nil is returned unless the innermost backend supports
+// copying file ranges.
+func AsRangeCopier(b Backend) RangeCopier {
+	copier := AsBackend[RangeCopier](b)
+	if copier == nil {
+		return nil
+	}
+
+	inner := b
+	for {
+		be, ok := inner.(BackendUnwrapper)
+		if !ok || be.Unwrap() == nil {
+			break
+		}
+		inner = be.Unwrap()
+	}
+	if _, ok := inner.(RangeCopier); !ok {
+		return nil
+	}
+	return copier
+}
+
+// CopyRange calls CopyRange of the outermost backend wrapped by b which
+// implements RangeCopier. It is used by backend wrappers to pass CopyRange
+// through.
+func CopyRange(ctx context.Context, b Backend, h Handle, length int, offset int64, dst *os.File) error {
+	copier := AsBackend[RangeCopier](b)
+	if copier == nil {
+		return errors.New("backend does not support copying file ranges")
+	}
+	return copier.CopyRange(ctx, h, length, offset, dst)
+}
+
+// Renamer is an optional interface for backends which can move a file
+// without copying its content.
+type Renamer interface {
+	Backend
+	// Rename moves the file at from to the handle to. The handle to must not
+	// refer to an existing file.
+	Rename(ctx context.Context, from, to Handle) error
+}
+
+// AtomicSaver is an optional interface for backends whose Save only makes a
+// file visible once it has been written completely, for example by writing to
+// a temporary file which is renamed afterwards.
+type AtomicSaver interface {
+	Backend
+	// HasAtomicSave returns true if an interrupted Save never leaves a
+	// partially written file behind.
+	HasAtomicSave() bool
+}
+
+// Syncer is an optional interface for backends which can flush the files
+// written by Save to stable storage before Save returns.
+type Syncer interface {
+	Backend
+	// EnableSync makes Save flush each written file and, if possible, the
+	// directory containing it. It returns an error if the backend cannot
+	// honor the request.
+	EnableSync() error
+	// SyncDuration returns the total time spent flushing data.
+	SyncDuration() time.Duration
+}
+
+// ErrColdStorage is returned by Load if a file is stored in a cold storage
+// class and must be warmed up before it can be read.
+var ErrColdStorage = errors.New("file is in cold storage and must be warmed up before it can be read")
+
+// Warmer is an optional interface for backends which support storage classes
+// that must be warmed up before files can be read, like S3 Glacier.
+type Warmer interface {
+	Backend
+	// WarmupFile requests that the file at h is made available for reading.
+	// It returns true if the file can already be read.
+	WarmupFile(ctx context.Context, h Handle) (ready bool, err error)
+}
+
 type FreezeBackend interface {
 	Backend
 	// Freeze blocks all backend operations except those on lock files
@@ -1,6 +1,8 @@
 package restic_test
 
 import (
+	"context"
+	"os"
 	"testing"
 
 	"github.com/restic/restic/internal/restic"
@@ -36,3 +38,31 @@ func TestAsBackend(t *testing.T) {
 	wrapper.Backend = other
 	test.Assert(t, restic.AsBackend[*testBackend](wrapper) == nil, "a wrapped otherTestBackend is not a testBackend")
 }
+
+type rangeCopierTestBackend struct {
+	restic.Backend
+}
+
+func (t *rangeCopierTestBackend) CopyRange(ctx context.Context, h restic.Handle, length int, offset int64, dst *os.File) error {
+	return nil
+}
+
+type rangeCopierWrapper struct {
+	rangeCopierTestBackend
+	wrapped restic.Backend
+}
+
+func (t *rangeCopierWrapper) Unwrap() restic.Backend {
+	return t.wrapped
+}
+
+func TestAsRangeCopier(t *testing.T) {
+	copier := &rangeCopierTestBackend{}
+	test.Assert(t, restic.AsRangeCopier(copier) == copier, "rangeCopierTestBackend was not returned")
+
+	wrapper := &rangeCopierWrapper{wrapped: &otherTestBackend{Backend: copier}}
+	test.Assert(t, restic.AsRangeCopier(wrapper) == wrapper, "the outermost RangeCopier was not returned")
+
+	wrapper.wrapped = &otherTestBackend{Backend: &testBackend{}}
+	test.Assert(t, restic.AsRangeCopier(wrapper) == nil, "the wrapped backend does not support CopyRange")
+}
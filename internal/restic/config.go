@@ -2,6 +2,8 @@ package restic
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"testing"
 
 	"github.com/restic/restic/internal/errors"
@@ -25,6 +27,10 @@ const MaxRepoVersion = 2
 // is newly created with Init().
 const StableRepoVersion = 2
 
+// ErrInvalidConfig is returned when the config of a repository is damaged or
+// contains invalid values.
+var ErrInvalidConfig = errors.New("invalid repository config")
+
 // JSONUnpackedLoader loads unpacked JSON.
 type JSONUnpackedLoader interface {
 	LoadJSONUnpacked(context.Context, FileType, ID, interface{}) error
@@ -81,22 +87,38 @@ func LoadConfig(ctx context.Context, r LoaderUnpacked) (Config, error) {
 		cfg Config
 	)
 
-	err := LoadJSONUnpacked(ctx, r, ConfigFile, ID{}, &cfg)
+	buf, err := r.LoadUnpacked(ctx, ConfigFile, ID{})
+	if err != nil {
+		return Config{}, err
+	}
+
+	err = json.Unmarshal(buf, &cfg)
+	if err != nil {
+		return Config{}, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+
+	err = CheckConfig(cfg)
 	if err != nil {
 		return Config{}, err
 	}
 
+	return cfg, nil
+}
+
+// CheckConfig returns an error wrapping ErrInvalidConfig if the version or
+// the chunker polynomial of cfg are invalid.
+func CheckConfig(cfg Config) error {
 	if cfg.Version < MinRepoVersion || cfg.Version > MaxRepoVersion {
-		return Config{}, errors.Errorf("unsupported repository version %v", cfg.Version)
+		return fmt.Errorf("%w: unsupported repository version %v", ErrInvalidConfig, cfg.Version)
 	}
 
 	if checkPolynomial {
 		if !cfg.ChunkerPolynomial.Irreducible() {
-			return Config{}, errors.New("invalid chunker polynomial")
+			return fmt.Errorf("%w: invalid chunker polynomial", ErrInvalidConfig)
 		}
 	}
 
-	return cfg, nil
+	return nil
 }
 
 func SaveConfig(ctx context.Context, r SaverUnpacked, cfg Config) error {
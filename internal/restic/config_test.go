@@ -4,6 +4,7 @@ import (
 	"context"
 	"testing"
 
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
 )
@@ -63,3 +64,25 @@ func TestConfig(t *testing.T) {
 	rtest.Assert(t, cfg1 == cfg2,
 		"configs aren't equal: %v != %v", cfg1, cfg2)
 }
+
+func TestLoadConfigInvalid(t *testing.T) {
+	for _, buf := range []string{
+		`{"version":1,"id":"foo","chunker_polynomial":"25b468838dcb75"`,
+		`{"version":0,"id":"foo","chunker_polynomial":"25b468838dcb75"}`,
+		`{"version":17,"id":"foo","chunker_polynomial":"25b468838dcb75"}`,
+	} {
+		load := func(tpe restic.FileType, id restic.ID) ([]byte, error) {
+			return []byte(buf), nil
+		}
+
+		_, err := restic.LoadConfig(context.TODO(), loader{load})
+		rtest.Assert(t, errors.Is(err, restic.ErrInvalidConfig), "expected ErrInvalidConfig for %q, got %v", buf, err)
+	}
+
+	// errors from the backend do not mean the config is invalid
+	load := func(tpe restic.FileType, id restic.ID) ([]byte, error) {
+		return nil, errors.New("connection failed")
+	}
+	_, err := restic.LoadConfig(context.TODO(), loader{load})
+	rtest.Assert(t, err != nil && !errors.Is(err, restic.ErrInvalidConfig), "unexpected error %v", err)
+}
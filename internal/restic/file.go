@@ -17,6 +17,9 @@ const (
 	SnapshotFile
 	IndexFile
 	ConfigFile
+	// TrashFile contains a removed file which is kept for a while, see
+	// package trash.
+	TrashFile
 )
 
 func (t FileType) String() string {
@@ -35,6 +38,8 @@ func (t FileType) String() string {
 		s = "index"
 	case ConfigFile:
 		s = "config"
+	case TrashFile:
+		s = "trash"
 	}
 	return s
 }
@@ -63,6 +68,7 @@ func (h Handle) Valid() error {
 	case SnapshotFile:
 	case IndexFile:
 	case ConfigFile:
+	case TrashFile:
 	default:
 		return errors.Errorf("invalid Type %d", h.Type)
 	}
@@ -2,10 +2,8 @@ package restic
 
 import (
 	"context"
-	"sync"
 
 	"github.com/restic/restic/internal/ui/progress"
-	"golang.org/x/sync/errgroup"
 )
 
 // Loader loads a blob from a repository.
@@ -22,39 +20,51 @@ type findBlobSet interface {
 
 // FindUsedBlobs traverses the tree ID and adds all seen blobs (trees and data
 // blobs) to the set blobs. Already seen tree blobs will not be visited again.
+// As blobs also serves as set of visited trees, each tree shared between the
+// trees in treeIDs is loaded only once. The same holds when blobs is reused
+// for several calls. The trees of all treeIDs are traversed concurrently, thus
+// callers should pass all trees at once instead of calling FindUsedBlobs for
+// each tree. The progress counter p is incremented for each completed tree in
+// treeIDs. If loading a tree fails, all workers are stopped and the error is
+// returned.
 func FindUsedBlobs(ctx context.Context, repo Loader, treeIDs IDs, blobs findBlobSet, p *progress.Counter) error {
-	var lock sync.Mutex
-
-	wg, ctx := errgroup.WithContext(ctx)
-	treeStream := StreamTrees(ctx, wg, repo, treeIDs, func(treeID ID) bool {
-		// locking is necessary the goroutine below concurrently adds data blobs
-		lock.Lock()
-		h := BlobHandle{ID: treeID, Type: TreeBlob}
-		blobReferenced := blobs.Has(h)
-		// noop if already referenced
+	var roots []TreeJob[struct{}]
+	for _, id := range treeIDs {
+		h := BlobHandle{ID: id, Type: TreeBlob}
+		if blobs.Has(h) {
+			p.Add(1)
+			continue
+		}
 		blobs.Insert(h)
-		lock.Unlock()
-		return blobReferenced
-	}, p)
+		roots = append(roots, TreeJob[struct{}]{ID: id})
+	}
 
-	wg.Go(func() error {
-		for tree := range treeStream {
-			if tree.Error != nil {
-				return tree.Error
-			}
+	// visit is never called concurrently, thus blobs needs no locking
+	return ParallelWalkTrees(ctx, repo, 0, roots, func(job TreeJob[struct{}], tree *Tree, err error) ([]TreeJob[struct{}], error) {
+		if err != nil {
+			return nil, err
+		}
 
-			lock.Lock()
-			for _, node := range tree.Nodes {
-				switch node.Type {
-				case "file":
-					for _, blob := range node.Content {
-						blobs.Insert(BlobHandle{ID: blob, Type: DataBlob})
-					}
+		var subtrees []TreeJob[struct{}]
+		for _, node := range tree.Nodes {
+			switch node.Type {
+			case "file":
+				for _, blob := range node.Content {
+					blobs.Insert(BlobHandle{ID: blob, Type: DataBlob})
+				}
+			case "dir":
+				if node.Subtree == nil || node.Subtree.IsNull() {
+					// reported by the checker
+					continue
 				}
+				h := BlobHandle{ID: *node.Subtree, Type: TreeBlob}
+				if blobs.Has(h) {
+					continue
+				}
+				blobs.Insert(h)
+				subtrees = append(subtrees, TreeJob[struct{}]{ID: *node.Subtree})
 			}
-			lock.Unlock()
 		}
-		return nil
-	})
-	return wg.Wait()
+		return subtrees, nil
+	}, p)
 }
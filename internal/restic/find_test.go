@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"sync"
 	"testing"
 	"time"
 
@@ -17,6 +18,7 @@ import (
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/test"
 	"github.com/restic/restic/internal/ui/progress"
+	"golang.org/x/sync/errgroup"
 )
 
 func loadIDSet(t testing.TB, filename string) restic.BlobSet {
@@ -209,3 +211,229 @@ func BenchmarkFindUsedBlobs(b *testing.B) {
 		b.Logf("found %v blobs", len(blobs))
 	}
 }
+
+// treeLoadCounter counts how often each tree is loaded.
+type treeLoadCounter struct {
+	restic.Loader
+	m     sync.Mutex
+	loads map[restic.ID]int
+}
+
+func newTreeLoadCounter(repo restic.Loader) *treeLoadCounter {
+	return &treeLoadCounter{Loader: repo, loads: make(map[restic.ID]int)}
+}
+
+func (c *treeLoadCounter) LoadBlob(ctx context.Context, t restic.BlobType, id restic.ID, buf []byte) ([]byte, error) {
+	if t == restic.TreeBlob {
+		c.m.Lock()
+		c.loads[id]++
+		c.m.Unlock()
+	}
+	return c.Loader.LoadBlob(ctx, t, id, buf)
+}
+
+func (c *treeLoadCounter) total() int {
+	sum := 0
+	for _, n := range c.loads {
+		sum += n
+	}
+	return sum
+}
+
+// createSharedTreeSnapshots returns the IDs of count distinct root trees
+// which all contain the tree of one snapshot twice, as "a" and "b".
+func createSharedTreeSnapshots(t testing.TB, repo restic.Repository, count int) (roots restic.IDs, shared restic.ID) {
+	sn := restic.TestCreateSnapshot(t, repo, findTestTime, findTestDepth)
+	shared = *sn.Tree
+
+	var wg errgroup.Group
+	repo.StartPackUploader(context.TODO(), &wg)
+
+	for i := 0; i < count; i++ {
+		tree := restic.NewTree(3)
+		for _, name := range []string{"a", "b"} {
+			test.OK(t, tree.Insert(&restic.Node{Name: name, Type: "dir", Subtree: &shared}))
+		}
+		test.OK(t, tree.Insert(&restic.Node{Name: fmt.Sprintf("file%d", i), Type: "file"}))
+
+		id, err := restic.SaveTree(context.TODO(), repo, tree)
+		test.OK(t, err)
+		roots = append(roots, id)
+	}
+
+	test.OK(t, repo.Flush(context.TODO()))
+	return roots, shared
+}
+
+func TestFindUsedBlobsLoadsTreesOnce(t *testing.T) {
+	repo := repository.TestRepository(t)
+	roots, shared := createSharedTreeSnapshots(t, repo, 20)
+
+	want := restic.NewBlobSet()
+	test.OK(t, restic.FindUsedBlobs(context.TODO(), repo, restic.IDs{shared}, want, nil))
+	for _, id := range roots {
+		want.Insert(restic.BlobHandle{ID: id, Type: restic.TreeBlob})
+	}
+
+	counter := newTreeLoadCounter(repo)
+	usedBlobs := restic.NewBlobSet()
+	// pass the roots twice to also check duplicate snapshot trees
+	test.OK(t, restic.FindUsedBlobs(context.TODO(), counter, append(roots, roots...), usedBlobs, nil))
+
+	for id, n := range counter.loads {
+		if n != 1 {
+			t.Errorf("tree %v loaded %d times", id.Str(), n)
+		}
+	}
+	if !want.Equals(usedBlobs) {
+		t.Errorf("wrong list of blobs returned:\n  missing blobs: %v\n  extra blobs: %v",
+			want.Sub(usedBlobs), usedBlobs.Sub(want))
+	}
+}
+
+func BenchmarkFindUsedBlobsSharedTrees(b *testing.B) {
+	repo := repository.TestRepository(b)
+	roots, _ := createSharedTreeSnapshots(b, repo, 100)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		counter := newTreeLoadCounter(repo)
+		blobs := restic.NewBlobSet()
+		err := restic.FindUsedBlobs(context.TODO(), counter, roots, blobs, nil)
+		if err != nil {
+			b.Error(err)
+		}
+
+		b.ReportMetric(float64(counter.total()), "tree-loads/op")
+	}
+}
+
+// slowTreeLoader delays loading tree blobs to simulate a remote backend. If
+// failTree is set, loading that tree returns an error.
+type slowTreeLoader struct {
+	restic.Loader
+	latency  time.Duration
+	failTree restic.ID
+}
+
+func (l *slowTreeLoader) LoadBlob(ctx context.Context, t restic.BlobType, id restic.ID, buf []byte) ([]byte, error) {
+	if t == restic.TreeBlob {
+		time.Sleep(l.latency)
+		if id == l.failTree {
+			return nil, errors.New("injected error")
+		}
+	}
+	return l.Loader.LoadBlob(ctx, t, id, buf)
+}
+
+func createManySnapshots(t testing.TB, repo restic.Repository, count int) restic.IDs {
+	var trees restic.IDs
+	for i := 0; i < count; i++ {
+		sn := restic.TestCreateSnapshot(t, repo, findTestTime.Add(time.Duration(i)*time.Second), 1)
+		trees = append(trees, *sn.Tree)
+	}
+	return trees
+}
+
+func TestFindUsedBlobsManySnapshots(t *testing.T) {
+	repo := repository.TestRepository(t)
+	trees := createManySnapshots(t, repo, 20)
+
+	want := restic.NewBlobSet()
+	for _, id := range trees {
+		test.OK(t, restic.FindUsedBlobs(context.TODO(), repo, restic.IDs{id}, want, nil))
+	}
+
+	p := progress.NewCounter(time.Second, uint64(len(trees)), func(value uint64, total uint64, runtime time.Duration, final bool) {})
+	defer p.Done()
+
+	loader := &slowTreeLoader{Loader: repo, latency: time.Millisecond}
+	usedBlobs := restic.NewCountedBlobSet()
+	test.OK(t, restic.FindUsedBlobs(context.TODO(), loader, trees, usedBlobs, p))
+
+	v, _ := p.Get()
+	test.Equals(t, uint64(len(trees)), v)
+	test.Equals(t, len(want), usedBlobs.Len())
+	for h := range want {
+		test.Assert(t, usedBlobs.Has(h), "blob %v is missing", h)
+	}
+}
+
+func TestFindUsedBlobsError(t *testing.T) {
+	repo := repository.TestRepository(t)
+	trees := createManySnapshots(t, repo, 20)
+
+	loader := &slowTreeLoader{Loader: repo, latency: time.Millisecond, failTree: trees[len(trees)/2]}
+	err := restic.FindUsedBlobs(context.TODO(), loader, trees, restic.NewBlobSet(), nil)
+	test.Assert(t, err != nil && err.Error() == "injected error", "expected injected error, got %v", err)
+}
+
+// hugeTreeLoader reports all trees as huge and records the maximum number of
+// trees which were loaded concurrently.
+type hugeTreeLoader struct {
+	slowTreeLoader
+	m       sync.Mutex
+	active  int
+	maxSeen int
+}
+
+func (l *hugeTreeLoader) LookupBlobSize(id restic.ID, t restic.BlobType) (uint, bool) {
+	if t == restic.TreeBlob {
+		return 100 * 1024 * 1024, true
+	}
+	return l.Loader.LookupBlobSize(id, t)
+}
+
+func (l *hugeTreeLoader) LoadBlob(ctx context.Context, t restic.BlobType, id restic.ID, buf []byte) ([]byte, error) {
+	l.m.Lock()
+	l.active++
+	if l.active > l.maxSeen {
+		l.maxSeen = l.active
+	}
+	l.m.Unlock()
+
+	defer func() {
+		l.m.Lock()
+		l.active--
+		l.m.Unlock()
+	}()
+	return l.slowTreeLoader.LoadBlob(ctx, t, id, buf)
+}
+
+func TestFindUsedBlobsHugeTrees(t *testing.T) {
+	repo := repository.TestRepository(t)
+	trees := createManySnapshots(t, repo, 5)
+
+	want := restic.NewBlobSet()
+	test.OK(t, restic.FindUsedBlobs(context.TODO(), repo, trees, want, nil))
+
+	loader := &hugeTreeLoader{slowTreeLoader: slowTreeLoader{Loader: repo, latency: time.Millisecond}}
+	usedBlobs := restic.NewBlobSet()
+	test.OK(t, restic.FindUsedBlobs(context.TODO(), loader, trees, usedBlobs, nil))
+
+	test.Equals(t, want, usedBlobs)
+	test.Equals(t, 1, loader.maxSeen)
+}
+
+func BenchmarkFindUsedBlobsManySnapshots(b *testing.B) {
+	repo := repository.TestRepository(b)
+	trees := createManySnapshots(b, repo, 200)
+	loader := &slowTreeLoader{Loader: repo, latency: time.Millisecond}
+
+	b.Run("sequential", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			blobs := restic.NewCountedBlobSet()
+			for _, id := range trees {
+				test.OK(b, restic.FindUsedBlobs(context.TODO(), loader, restic.IDs{id}, blobs, nil))
+			}
+		}
+	})
+
+	b.Run("concurrent", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			blobs := restic.NewCountedBlobSet()
+			test.OK(b, restic.FindUsedBlobs(context.TODO(), loader, trees, blobs, nil))
+		}
+	})
+}
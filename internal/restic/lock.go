@@ -99,6 +99,21 @@ func NewExclusiveLock(ctx context.Context, repo Repository) (*Lock, error) {
 
 var waitBeforeLockCheck = 200 * time.Millisecond
 
+// lockConsistencyDelay is the duration in nanoseconds a lock file may be
+// missing from listings before it is considered removed.
+var lockConsistencyDelay int64
+
+// lockListPollInterval is the delay between two listings while waiting for
+// a lock file to show up.
+var lockListPollInterval = time.Second
+
+// SetLockConsistencyDelay configures how long a lock file may be missing from
+// listings before it is considered removed. This accounts for backends whose
+// listings lag behind.
+func SetLockConsistencyDelay(d time.Duration) {
+	atomic.StoreInt64(&lockConsistencyDelay, int64(d))
+}
+
 // TestSetLockTimeout can be used to reduce the lock wait timeout for tests.
 func TestSetLockTimeout(t testing.TB, d time.Duration) {
 	t.Logf("setting lock timeout to %v", d)
@@ -322,20 +337,44 @@ func (l *Lock) RefreshStaleLock(ctx context.Context) error {
 	return l.repo.Backend().Remove(context.TODO(), Handle{Type: LockFile, Name: oldLockID.String()})
 }
 
+// checkExistence checks that the lock file is listed by the backend. A
+// missing lock file is searched for until the lock consistency delay has
+// passed.
 func (l *Lock) checkExistence(ctx context.Context) (bool, error) {
 	l.lock.Lock()
-	defer l.lock.Unlock()
+	name := l.lockID.String()
+	l.lock.Unlock()
 
-	exists := false
+	delay := time.Duration(atomic.LoadInt64(&lockConsistencyDelay))
+	start := time.Now()
+	for {
+		exists := false
+		err := l.repo.Backend().List(ctx, LockFile, func(fi FileInfo) error {
+			if fi.Name == name {
+				exists = true
+			}
+			return nil
+		})
+		if err != nil || exists {
+			return exists, err
+		}
 
-	err := l.repo.Backend().List(ctx, LockFile, func(fi FileInfo) error {
-		if fi.Name == l.lockID.String() {
-			exists = true
+		remaining := delay - time.Since(start)
+		if remaining <= 0 {
+			return false, nil
 		}
-		return nil
-	})
+		debug.Log("lock %v not listed, retrying for %v", name, remaining)
 
-	return exists, err
+		wait := lockListPollInterval
+		if remaining < wait {
+			wait = remaining
+		}
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
 }
 
 func (l *Lock) String() string {
@@ -377,7 +416,9 @@ func LoadLock(ctx context.Context, repo Repository, id ID) (*Lock, error) {
 }
 
 // RemoveStaleLocks deletes all locks detected as stale from the repository.
-func RemoveStaleLocks(ctx context.Context, repo Repository) (uint, error) {
+// If dryRun is set, the locks are only reported to report but not removed.
+// report may be nil.
+func RemoveStaleLocks(ctx context.Context, repo Repository, dryRun bool, report func(ID, *Lock)) (uint, error) {
 	var processed uint
 	err := ForAllLocks(ctx, repo, nil, func(id ID, lock *Lock, err error) error {
 		if err != nil {
@@ -387,6 +428,13 @@ func RemoveStaleLocks(ctx context.Context, repo Repository) (uint, error) {
 		}
 
 		if lock.Stale() {
+			if report != nil {
+				report(id, lock)
+			}
+			if dryRun {
+				processed++
+				return nil
+			}
 			err = repo.Backend().Remove(ctx, Handle{Type: LockFile, Name: id.String()})
 			if err == nil {
 				processed++
@@ -399,10 +447,32 @@ func RemoveStaleLocks(ctx context.Context, repo Repository) (uint, error) {
 	return processed, err
 }
 
-// RemoveAllLocks removes all locks forcefully.
-func RemoveAllLocks(ctx context.Context, repo Repository) (uint, error) {
+// RemoveAllLocks removes all locks forcefully. If dryRun is set, the locks are
+// only reported to report but not removed. report may be nil, it is called
+// with a nil lock for lock files which cannot be loaded.
+func RemoveAllLocks(ctx context.Context, repo Repository, dryRun bool, report func(ID, *Lock)) (uint, error) {
 	var processed uint32
+	var m sync.Mutex
 	err := ParallelList(ctx, repo.Backend(), LockFile, repo.Connections(), func(ctx context.Context, id ID, size int64) error {
+		if report != nil {
+			var lock *Lock
+			if size > 0 {
+				var err error
+				lock, err = LoadLock(ctx, repo, id)
+				if err != nil {
+					debug.Log("unable to load lock %v: %v", id, err)
+					lock = nil
+				}
+			}
+			m.Lock()
+			report(id, lock)
+			m.Unlock()
+		}
+		if dryRun {
+			atomic.AddUint32(&processed, 1)
+			return nil
+		}
+
 		err := repo.Backend().Remove(ctx, Handle{Type: LockFile, Name: id.String()})
 		if err == nil {
 			atomic.AddUint32(&processed, 1)
@@ -8,6 +8,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/restic/restic/internal/backend/consistency"
 	"github.com/restic/restic/internal/backend/mem"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
@@ -211,7 +212,7 @@ func TestLockWithStaleLock(t *testing.T) {
 	id3, err := createFakeLock(repo, time.Now().Add(-time.Minute), os.Getpid()+500000)
 	rtest.OK(t, err)
 
-	processed, err := restic.RemoveStaleLocks(context.TODO(), repo)
+	processed, err := restic.RemoveStaleLocks(context.TODO(), repo, false, nil)
 	rtest.OK(t, err)
 
 	rtest.Assert(t, lockExists(repo, t, id1) == false,
@@ -227,6 +228,39 @@ func TestLockWithStaleLock(t *testing.T) {
 	rtest.OK(t, removeLock(repo, id2))
 }
 
+func TestRemoveLocksDryRun(t *testing.T) {
+	repo := repository.TestRepository(t)
+
+	id1, err := createFakeLock(repo, time.Now().Add(-time.Hour), os.Getpid())
+	rtest.OK(t, err)
+
+	id2, err := createFakeLock(repo, time.Now().Add(-time.Minute), os.Getpid())
+	rtest.OK(t, err)
+
+	for _, test := range []struct {
+		fn       func(context.Context, restic.Repository, bool, func(restic.ID, *restic.Lock)) (uint, error)
+		expected restic.IDSet
+	}{
+		{restic.RemoveStaleLocks, restic.NewIDSet(id1)},
+		{restic.RemoveAllLocks, restic.NewIDSet(id1, id2)},
+	} {
+		reported := restic.NewIDSet()
+		processed, err := test.fn(context.TODO(), repo, true, func(id restic.ID, lock *restic.Lock) {
+			rtest.Assert(t, lock != nil, "lock %v was not loaded", id)
+			reported.Insert(id)
+		})
+		rtest.OK(t, err)
+		rtest.Equals(t, test.expected, reported)
+		rtest.Equals(t, uint(len(test.expected)), processed)
+
+		rtest.Assert(t, lockExists(repo, t, id1), "lock was removed during dry run")
+		rtest.Assert(t, lockExists(repo, t, id2), "lock was removed during dry run")
+	}
+
+	rtest.OK(t, removeLock(repo, id1))
+	rtest.OK(t, removeLock(repo, id2))
+}
+
 func TestRemoveAllLocks(t *testing.T) {
 	repo := repository.TestRepository(t)
 
@@ -239,7 +273,7 @@ func TestRemoveAllLocks(t *testing.T) {
 	id3, err := createFakeLock(repo, time.Now().Add(-time.Minute), os.Getpid()+500000)
 	rtest.OK(t, err)
 
-	processed, err := restic.RemoveAllLocks(context.TODO(), repo)
+	processed, err := restic.RemoveAllLocks(context.TODO(), repo, false, nil)
 	rtest.OK(t, err)
 
 	rtest.Assert(t, lockExists(repo, t, id1) == false,
@@ -322,3 +356,22 @@ func TestLockRefreshStaleMissing(t *testing.T) {
 	err = lock.RefreshStaleLock(context.TODO())
 	rtest.Assert(t, err == restic.ErrRemovedLock, "unexpected error, expected %v, got %v", restic.ErrRemovedLock, err)
 }
+
+func TestLockRefreshStaleLaggingListing(t *testing.T) {
+	// new lock files only show up in listings after a delay
+	be := consistency.TestLaggingBackend(mem.New(), 500*time.Millisecond, 0)
+	repo := repository.TestRepositoryWithBackend(t, be, 0)
+	restic.TestSetLockTimeout(t, 5*time.Millisecond)
+
+	lock, err := restic.NewLock(context.TODO(), repo)
+	rtest.OK(t, err)
+
+	// without a consistency delay, the missing lock is considered removed
+	err = lock.RefreshStaleLock(context.TODO())
+	rtest.Assert(t, err == restic.ErrRemovedLock, "unexpected error, expected %v, got %v", restic.ErrRemovedLock, err)
+
+	restic.SetLockConsistencyDelay(5 * time.Second)
+	defer restic.SetLockConsistencyDelay(0)
+	rtest.OK(t, lock.RefreshStaleLock(context.TODO()))
+	rtest.OK(t, lock.Unlock())
+}
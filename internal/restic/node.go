@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"os/user"
+	"sort"
 	"strconv"
 	"sync"
 	"syscall"
@@ -49,6 +50,7 @@ type Node struct {
 	// Must only be set of the linktarget cannot be encoded as valid utf8.
 	LinkTargetRaw      []byte              `json:"linktarget_raw,omitempty"`
 	ExtendedAttributes []ExtendedAttribute `json:"extended_attributes,omitempty"`
+	MacOS              *MacOSAttributes    `json:"macos,omitempty"`
 	Device             uint64              `json:"device,omitempty"` // in case of Type == "dev", stat.st_rdev
 	Content            IDs                 `json:"content"`
 	Subtree            *ID                 `json:"subtree,omitempty"`
@@ -58,6 +60,15 @@ type Node struct {
 	Path string `json:"-"`
 }
 
+// MacOSAttributes contains metadata which only exists on macOS. It is
+// ignored when restoring on other operating systems.
+type MacOSAttributes struct {
+	BirthTime time.Time `json:"btime"`
+	// Flags contains the user-settable file flags (st_flags) which restic
+	// restores, e.g. the hidden and locked flags shown in the Finder.
+	Flags uint32 `json:"flags,omitempty"`
+}
+
 // Nodes is a slice of nodes that can be sorted.
 type Nodes []*Node
 
@@ -223,6 +234,14 @@ func (node Node) restoreMetadata(path string) error {
 		}
 	}
 
+	// must be last, the flags can prevent further modifications of the file
+	if err := node.restoreMacOSAttributes(path); err != nil {
+		debug.Log("error restoring macOS attributes for %v: %v", path, err)
+		if firsterr == nil {
+			firsterr = err
+		}
+	}
+
 	return firsterr
 }
 
@@ -246,7 +265,7 @@ func (node Node) RestoreTimestamps(path string) error {
 		return node.restoreSymlinkTimestamps(path, utimes)
 	}
 
-	if err := syscall.UtimesNano(path, utimes[:]); err != nil {
+	if err := syscall.UtimesNano(fs.FixPath(path), utimes[:]); err != nil {
 		return errors.Wrap(err, "UtimesNano")
 	}
 
@@ -301,7 +320,7 @@ func (node Node) writeNodeContent(ctx context.Context, repo Repository, f *os.Fi
 
 func (node Node) createSymlinkAt(path string) error {
 
-	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+	if err := fs.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
 		return errors.Wrap(err, "Symlink")
 	}
 
@@ -436,6 +455,9 @@ func (node Node) Equals(other Node) bool {
 	if !node.sameExtendedAttributes(other) {
 		return false
 	}
+	if !node.sameMacOSAttributes(other) {
+		return false
+	}
 	if node.Subtree != nil {
 		if other.Subtree == nil {
 			return false
@@ -477,6 +499,13 @@ func (node Node) sameContent(other Node) bool {
 	return true
 }
 
+func (node Node) sameMacOSAttributes(other Node) bool {
+	if node.MacOS == nil || other.MacOS == nil {
+		return node.MacOS == other.MacOS
+	}
+	return node.MacOS.BirthTime.Equal(other.MacOS.BirthTime) && node.MacOS.Flags == other.MacOS.Flags
+}
+
 func (node Node) sameExtendedAttributes(other Node) bool {
 	if len(node.ExtendedAttributes) != len(other.ExtendedAttributes) {
 		return false
@@ -600,6 +629,7 @@ func (node *Node) fillExtra(path string, fi os.FileInfo) error {
 	node.fillTimes(stat)
 
 	node.fillUser(stat)
+	node.fillMacOSAttributes(stat)
 
 	switch node.Type {
 	case "file":
@@ -628,12 +658,24 @@ func (node *Node) fillExtra(path string, fi os.FileInfo) error {
 	return node.fillExtendedAttributes(path)
 }
 
+// resourceForkXattr is the extended attribute through which macOS exposes the
+// resource fork of a file.
+const resourceForkXattr = "com.apple.ResourceFork"
+
+// maxResourceForkSize is the size up to which resource forks are included in
+// the backup. Extended attributes are stored within the tree, which must fit
+// into memory, larger resource forks are skipped.
+const maxResourceForkSize = 4 << 20
+
 func (node *Node) fillExtendedAttributes(path string) error {
 	xattrs, err := Listxattr(path)
 	debug.Log("fillExtendedAttributes(%v) %v %v", path, xattrs, err)
 	if err != nil {
 		return err
 	}
+	// the order returned by the filesystem is not stable, sort the names so
+	// that unchanged files always result in the same tree
+	sort.Strings(xattrs)
 
 	node.ExtendedAttributes = make([]ExtendedAttribute, 0, len(xattrs))
 	for _, attr := range xattrs {
@@ -642,6 +684,10 @@ func (node *Node) fillExtendedAttributes(path string) error {
 			fmt.Fprintf(os.Stderr, "can not obtain extended attribute %v for %v:\n", attr, path)
 			continue
 		}
+		if attr == resourceForkXattr && len(attrVal) > maxResourceForkSize {
+			fmt.Fprintf(os.Stderr, "skipping resource fork of %v: size %d exceeds the limit of %d bytes\n", path, len(attrVal), maxResourceForkSize)
+			continue
+		}
 		attr := ExtendedAttribute{
 			Name:  attr,
 			Value: attrVal,
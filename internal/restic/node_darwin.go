@@ -1,6 +1,13 @@
 package restic
 
-import "syscall"
+import (
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/restic/restic/internal/errors"
+	"golang.org/x/sys/unix"
+)
 
 func (node Node) restoreSymlinkTimestamps(path string, utimes [2]syscall.Timespec) error {
 	return nil
@@ -9,3 +16,39 @@ func (node Node) restoreSymlinkTimestamps(path string, utimes [2]syscall.Timespe
 func (s statT) atim() syscall.Timespec { return s.Atimespec }
 func (s statT) mtim() syscall.Timespec { return s.Mtimespec }
 func (s statT) ctim() syscall.Timespec { return s.Ctimespec }
+
+// macOSFlags are the file flags which are saved and restored. Other flags are
+// either reserved to the superuser or describe the state of the file on disk,
+// e.g. UF_COMPRESSED, and must not be set on a restored file.
+const macOSFlags = unix.UF_NODUMP | unix.UF_IMMUTABLE | unix.UF_APPEND | unix.UF_HIDDEN
+
+func (node *Node) fillMacOSAttributes(stat *statT) {
+	node.MacOS = &MacOSAttributes{
+		BirthTime: time.Unix(stat.Birthtimespec.Unix()).UTC(),
+		Flags:     stat.Flags & macOSFlags,
+	}
+}
+
+func (node Node) restoreMacOSAttributes(path string) error {
+	if node.MacOS == nil {
+		return nil
+	}
+
+	// the creation time is set last, as setting a modification time before
+	// the creation time also moves the latter
+	ts := unix.NsecToTimespec(node.MacOS.BirthTime.UnixNano())
+	attrs := unix.Attrlist{
+		Bitmapcount: unix.ATTR_BIT_MAP_COUNT,
+		Commonattr:  unix.ATTR_CMN_CRTIME,
+	}
+	buf := (*[unsafe.Sizeof(ts)]byte)(unsafe.Pointer(&ts))[:]
+	if err := unix.Setattrlist(path, &attrs, buf, unix.FSOPT_NOFOLLOW); err != nil {
+		return errors.Wrap(err, "Setattrlist")
+	}
+
+	// chflags follows symlinks, there's no lchflags
+	if node.Type == "symlink" || node.MacOS.Flags == 0 {
+		return nil
+	}
+	return errors.Wrap(unix.Chflags(path, int(node.MacOS.Flags&macOSFlags)), "Chflags")
+}
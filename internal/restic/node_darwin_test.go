@@ -0,0 +1,72 @@
+package restic
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	rtest "github.com/restic/restic/internal/test"
+	"golang.org/x/sys/unix"
+)
+
+func TestNodeMacOSAttributesRoundTrip(t *testing.T) {
+	tempdir := t.TempDir()
+
+	birthTime := time.Date(2014, 5, 14, 21, 7, 23, 0, time.UTC)
+	for _, test := range []struct {
+		name  string
+		typ   string
+		flags uint32
+	}{
+		{"file", "file", 0},
+		{"hidden", "file", unix.UF_HIDDEN},
+		{"locked", "file", unix.UF_IMMUTABLE | unix.UF_HIDDEN},
+		{"dir", "dir", unix.UF_HIDDEN},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(tempdir, test.name)
+			if test.typ == "dir" {
+				rtest.OK(t, os.Mkdir(path, 0700))
+			} else {
+				rtest.OK(t, os.WriteFile(path, []byte("content"), 0600))
+			}
+			defer func() {
+				// allow the temp dir to be removed
+				_ = unix.Chflags(path, 0)
+			}()
+
+			node := Node{
+				Name:       test.name,
+				Type:       test.typ,
+				Mode:       0600,
+				ModTime:    time.Date(2015, 5, 14, 21, 7, 23, 0, time.UTC),
+				AccessTime: time.Date(2015, 5, 14, 21, 7, 23, 0, time.UTC),
+				UID:        uint32(os.Getuid()),
+				GID:        uint32(os.Getgid()),
+				MacOS: &MacOSAttributes{
+					BirthTime: birthTime,
+					Flags:     test.flags,
+				},
+			}
+			if test.typ == "dir" {
+				node.Mode = 0700 | os.ModeDir
+			}
+			rtest.OK(t, node.RestoreMetadata(path))
+
+			fi, err := os.Lstat(path)
+			rtest.OK(t, err)
+			n2, err := NodeFromFileInfo(path, fi)
+			rtest.OK(t, err)
+
+			rtest.Assert(t, n2.MacOS != nil, "macOS attributes missing")
+			rtest.Assert(t, birthTime.Equal(n2.MacOS.BirthTime),
+				"birth time doesn't match (%v != %v)", birthTime, n2.MacOS.BirthTime)
+			rtest.Equals(t, test.flags, n2.MacOS.Flags)
+
+			stat := fi.Sys().(*syscall.Stat_t)
+			rtest.Equals(t, test.flags, stat.Flags&macOSFlags)
+		})
+	}
+}
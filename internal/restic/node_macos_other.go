@@ -0,0 +1,12 @@
+//go:build !darwin
+// +build !darwin
+
+package restic
+
+// macOS-specific attributes are neither collected nor restored on other
+// operating systems.
+func (node *Node) fillMacOSAttributes(stat *statT) {}
+
+func (node Node) restoreMacOSAttributes(path string) error {
+	return nil
+}
@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"strings"
 	"testing"
 	"time"
 
@@ -372,3 +373,55 @@ func TestSymlinkSerializationFormat(t *testing.T) {
 		test.Assert(t, n2.LinkTargetRaw == nil, "quoted link target is just a helper field and must be unset after decoding")
 	}
 }
+
+func TestMacOSAttributesSerialization(t *testing.T) {
+	// nodes without macOS attributes must serialize as before
+	ser, err := json.Marshal(restic.Node{Name: "foo"})
+	test.OK(t, err)
+	test.Assert(t, !strings.Contains(string(ser), "macos"), "unexpected macos attributes in %s", ser)
+
+	n := restic.Node{
+		Name: "foo",
+		MacOS: &restic.MacOSAttributes{
+			BirthTime: parseTime("2015-05-14 21:07:23.111"),
+			Flags:     0x8000,
+		},
+	}
+	ser, err = json.Marshal(n)
+	test.OK(t, err)
+	var n2 restic.Node
+	test.OK(t, json.Unmarshal(ser, &n2))
+	test.Assert(t, n.Equals(n2), "nodes differ after round trip: %v != %v", n.MacOS, n2.MacOS)
+
+	n2.MacOS.Flags = 0
+	test.Assert(t, !n.Equals(n2), "nodes with different flags are equal")
+	n2.MacOS = nil
+	test.Assert(t, !n.Equals(n2), "node without macos attributes is equal")
+}
+
+func TestNodeRestoreMacOSAttributesIgnored(t *testing.T) {
+	if runtime.GOOS == "darwin" {
+		t.Skip("macOS attributes are restored on darwin")
+	}
+
+	path := filepath.Join(t.TempDir(), "file")
+	rtest.OK(t, os.WriteFile(path, []byte("content"), 0600))
+
+	node := restic.Node{
+		Name:       "file",
+		Type:       "file",
+		Mode:       0600,
+		ModTime:    parseTime("2015-05-14 21:07:23.111"),
+		AccessTime: parseTime("2015-05-14 21:07:23.111"),
+		UID:        uint32(os.Getuid()),
+		GID:        uint32(os.Getgid()),
+		MacOS: &restic.MacOSAttributes{
+			BirthTime: parseTime("2014-05-14 21:07:23.111"),
+			Flags:     0x2,
+		},
+	}
+	rtest.OK(t, node.RestoreMetadata(path))
+
+	// the file must still be writable, the immutable flag is ignored
+	rtest.OK(t, os.WriteFile(path, []byte("modified"), 0600))
+}
@@ -4,6 +4,7 @@ import (
 	"syscall"
 
 	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
 )
 
 // mknod is not supported on Windows.
@@ -18,7 +19,7 @@ func lchown(path string, uid int, gid int) (err error) {
 
 func (node Node) restoreSymlinkTimestamps(path string, utimes [2]syscall.Timespec) error {
 	// tweaked version of UtimesNano from go/src/syscall/syscall_windows.go
-	pathp, e := syscall.UTF16PtrFromString(path)
+	pathp, e := syscall.UTF16PtrFromString(fs.FixPath(path))
 	if e != nil {
 		return e
 	}
@@ -0,0 +1,226 @@
+package restic
+
+import (
+	"context"
+	"runtime"
+	"sync"
+
+	"github.com/restic/restic/internal/ui/progress"
+)
+
+// TreeLoader loads trees, for example for ParallelWalkTrees.
+type TreeLoader interface {
+	BlobLoader
+	LookupBlobSize(id ID, tpe BlobType) (uint, bool)
+	Connections() uint
+}
+
+// hugeTreeSize is the size above which trees are loaded by a single worker, as
+// decoding a huge tree can require a lot of memory.
+const hugeTreeSize = 50 * 1024 * 1024
+
+// TreeJob is a tree to be loaded by ParallelWalkTrees. Data is passed
+// unchanged to the visit function, for example to keep track of the path of
+// the tree.
+type TreeJob[T any] struct {
+	ID   ID
+	Data T
+}
+
+type treeWalkJob[T any] struct {
+	TreeJob[T]
+	// rootIdx is the index of the root job this tree was reached from
+	rootIdx int
+	huge    bool
+}
+
+type treeWalker[T any] struct {
+	repo  TreeLoader
+	visit func(job TreeJob[T], tree *Tree, err error) ([]TreeJob[T], error)
+	p     *progress.Counter
+
+	// visitMutex serializes calls to visit and protects rootCounter
+	visitMutex  sync.Mutex
+	rootCounter []int
+
+	m         sync.Mutex
+	cond      *sync.Cond
+	queue     []treeWalkJob[T]
+	hugeQueue []treeWalkJob[T]
+	hugeBusy  bool // a huge tree is in progress
+	pending   int  // number of jobs in the queue or in progress
+	err       error
+}
+
+// ParallelWalkTrees loads the trees of roots and the subtrees returned by
+// visit using a bounded pool of workers. For each job, visit is called with
+// the loaded tree, or with the error returned while loading it, and returns
+// the jobs for the subtrees which should be loaded next. visit is never called
+// concurrently. Subtrees are processed in depth-first order to keep the queue
+// short. Trees larger than 50 MiB are loaded one at a time to bound the
+// memory usage. If workers is zero, a default based on the number of backend
+// connections is used.
+//
+// The progress counter p is incremented once all trees reached from a root
+// were visited. If visit returns an error, the remaining workers are stopped
+// and the error is returned.
+func ParallelWalkTrees[T any](ctx context.Context, repo TreeLoader, workers int, roots []TreeJob[T],
+	visit func(job TreeJob[T], tree *Tree, err error) ([]TreeJob[T], error), p *progress.Counter) error {
+
+	w := &treeWalker[T]{
+		repo:        repo,
+		visit:       visit,
+		p:           p,
+		rootCounter: make([]int, len(roots)),
+	}
+	w.cond = sync.NewCond(&w.m)
+
+	// the queue is used as a stack, add the roots backwards to process them in order
+	for i := len(roots) - 1; i >= 0; i-- {
+		w.push(treeWalkJob[T]{TreeJob: roots[i], rootIdx: i, huge: w.isHuge(roots[i].ID)})
+		w.rootCounter[i] = 1
+	}
+	w.pending = len(roots)
+
+	if workers <= 0 {
+		workers = int(repo.Connections()) + runtime.GOMAXPROCS(0)
+	}
+
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.worker(wctx, cancel)
+		}()
+	}
+	wg.Wait()
+
+	if w.err != nil {
+		return w.err
+	}
+	return ctx.Err()
+}
+
+func (w *treeWalker[T]) isHuge(id ID) bool {
+	size, found := w.repo.LookupBlobSize(id, TreeBlob)
+	return found && size > hugeTreeSize
+}
+
+// push adds a job to the queue, w.m must be locked.
+func (w *treeWalker[T]) push(job treeWalkJob[T]) {
+	if job.huge {
+		w.hugeQueue = append(w.hugeQueue, job)
+	} else {
+		w.queue = append(w.queue, job)
+	}
+}
+
+// pop returns the next job which can be processed, w.m must be locked. Only
+// one huge tree is processed at a time.
+func (w *treeWalker[T]) pop() (treeWalkJob[T], bool) {
+	if len(w.hugeQueue) > 0 && !w.hugeBusy {
+		job := w.hugeQueue[len(w.hugeQueue)-1]
+		w.hugeQueue = w.hugeQueue[:len(w.hugeQueue)-1]
+		w.hugeBusy = true
+		return job, true
+	}
+	if len(w.queue) > 0 {
+		job := w.queue[len(w.queue)-1]
+		w.queue = w.queue[:len(w.queue)-1]
+		return job, true
+	}
+	return treeWalkJob[T]{}, false
+}
+
+// done marks a job as finished and records the first error.
+func (w *treeWalker[T]) done(job treeWalkJob[T], err error) {
+	w.m.Lock()
+	defer w.m.Unlock()
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	if job.huge {
+		w.hugeBusy = false
+	}
+	w.pending--
+	w.cond.Broadcast()
+}
+
+// enqueue adds the jobs for the subtrees of a tree reached from root rootIdx.
+func (w *treeWalker[T]) enqueue(jobs []TreeJob[T], rootIdx int) {
+	if len(jobs) == 0 {
+		return
+	}
+
+	huge := make([]bool, len(jobs))
+	for i, job := range jobs {
+		huge[i] = w.isHuge(job.ID)
+	}
+
+	w.m.Lock()
+	defer w.m.Unlock()
+	// add the jobs backwards to process the subtrees in order
+	for i := len(jobs) - 1; i >= 0; i-- {
+		w.push(treeWalkJob[T]{TreeJob: jobs[i], rootIdx: rootIdx, huge: huge[i]})
+	}
+	w.pending += len(jobs)
+	w.cond.Broadcast()
+}
+
+func (w *treeWalker[T]) worker(ctx context.Context, cancel context.CancelFunc) {
+	for {
+		w.m.Lock()
+		var job treeWalkJob[T]
+		ok := false
+		for w.err == nil {
+			job, ok = w.pop()
+			if ok || w.pending == 0 {
+				break
+			}
+			w.cond.Wait()
+		}
+		if w.err != nil {
+			w.m.Unlock()
+			// abort loading trees in the other workers
+			cancel()
+			return
+		}
+		w.m.Unlock()
+		if !ok {
+			return
+		}
+
+		w.done(job, w.process(ctx, job))
+	}
+}
+
+func (w *treeWalker[T]) process(ctx context.Context, job treeWalkJob[T]) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	tree, err := LoadTree(ctx, w.repo, job.ID)
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	w.visitMutex.Lock()
+	defer w.visitMutex.Unlock()
+
+	subtrees, err := w.visit(job.TreeJob, tree, err)
+	if err != nil {
+		return err
+	}
+
+	// the subtrees must be queued before the job is marked as done
+	w.enqueue(subtrees, job.rootIdx)
+	w.rootCounter[job.rootIdx] += len(subtrees) - 1
+	if w.rootCounter[job.rootIdx] == 0 {
+		w.p.Add(1)
+	}
+	return nil
+}
@@ -22,6 +22,8 @@ type Repository interface {
 	Connections() uint
 
 	Key() *crypto.Key
+	// KeyID returns the ID of the key which was used to open the repository
+	KeyID() ID
 
 	Index() MasterIndex
 	LoadIndex(context.Context) error
@@ -85,10 +87,25 @@ type MasterIndex interface {
 	Has(BlobHandle) bool
 	Lookup(BlobHandle) []PackedBlob
 
+	// LookupTreeStats returns the statistics recorded for the tree blob id.
+	// Index entries written by older versions do not contain statistics.
+	LookupTreeStats(id ID) (TreeStats, bool)
+	// AddTreeStats records the statistics of the tree blob id, which is about
+	// to be saved. They are stored in the index entry of the blob.
+	AddTreeStats(id ID, stats TreeStats)
+
 	// Each runs fn on all blobs known to the index. When the context is cancelled,
 	// the index iteration return immediately. This blocks any modification of the index.
 	Each(ctx context.Context, fn func(PackedBlob))
 	ListPacks(ctx context.Context, packs IDSet) <-chan PackBlobs
 
+	// MemoryUsage returns the approximate number of bytes of memory used by
+	// the index.
+	MemoryUsage() uint64
+
+	// LookupPrefix returns the blob of one of the given types whose ID starts
+	// with the hex prefix, it fails if the prefix is not unique.
+	LookupPrefix(ctx context.Context, prefix string, types ...BlobType) (BlobHandle, error)
+
 	Save(ctx context.Context, repo SaverUnpacked, packBlacklist IDSet, extraObsolete IDs, p *progress.Counter) (obsolete IDSet, err error)
 }
@@ -6,6 +6,7 @@ import (
 	"io"
 
 	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/hashing"
 )
 
 // RewindReader allows resetting the Reader to the beginning of the data.
@@ -24,6 +25,27 @@ type RewindReader interface {
 	Hash() []byte
 }
 
+// RewindError is returned by Rewind if the reader cannot be reset to the
+// start of the data. As the data is lost in this case, operations which
+// failed using the reader cannot be retried.
+type RewindError struct {
+	Err error
+}
+
+func (e *RewindError) Error() string {
+	return "cannot rewind reader: " + e.Err.Error()
+}
+
+func (e *RewindError) Unwrap() error {
+	return e.Err
+}
+
+// IsRewindError returns true if err was caused by a failed Rewind.
+func IsRewindError(err error) bool {
+	var rerr *RewindError
+	return errors.As(err, &rerr)
+}
+
 // ByteReader implements a RewindReader for a byte slice.
 type ByteReader struct {
 	*bytes.Reader
@@ -34,7 +56,10 @@ type ByteReader struct {
 // Rewind restarts the reader from the beginning of the data.
 func (b *ByteReader) Rewind() error {
 	_, err := b.Reader.Seek(0, io.SeekStart)
-	return err
+	if err != nil {
+		return &RewindError{Err: err}
+	}
+	return nil
 }
 
 // Length returns the number of bytes read from the reader after Rewind is
@@ -79,10 +104,22 @@ type FileReader struct {
 	hash []byte
 }
 
-// Rewind seeks to the beginning of the file.
+// Rewind seeks to the beginning of the file. It fails if the size of the file
+// has changed, as the data can no longer be read again in that case.
 func (f *FileReader) Rewind() error {
-	_, err := f.ReadSeeker.Seek(0, io.SeekStart)
-	return errors.Wrap(err, "Seek")
+	size, err := f.ReadSeeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return &RewindError{Err: errors.Wrap(err, "Seek")}
+	}
+	if size != f.Len {
+		return &RewindError{Err: errors.Errorf("file size changed from %d to %d bytes", f.Len, size)}
+	}
+
+	_, err = f.ReadSeeker.Seek(0, io.SeekStart)
+	if err != nil {
+		return &RewindError{Err: errors.Wrap(err, "Seek")}
+	}
+	return nil
 }
 
 // Length returns the length of the file.
@@ -115,3 +152,42 @@ func NewFileReader(f io.ReadSeeker, hash []byte) (*FileReader, error) {
 
 	return fr, nil
 }
+
+// statically ensure that *HashingRewindReader implements RewindReader.
+var _ RewindReader = &HashingRewindReader{}
+
+// HashingRewindReader wraps a RewindReader and computes a hash over all data
+// read since the last call to Rewind. Backends use this to compare the data
+// that was actually sent with a checksum returned by the server.
+type HashingRewindReader struct {
+	RewindReader
+	h  hash.Hash
+	rd *hashing.Reader
+}
+
+// NewHashingRewindReader returns a new HashingRewindReader which hashes the
+// data read from rd using h.
+func NewHashingRewindReader(rd RewindReader, h hash.Hash) *HashingRewindReader {
+	return &HashingRewindReader{
+		RewindReader: rd,
+		h:            h,
+		rd:           hashing.NewReader(rd, h),
+	}
+}
+
+func (r *HashingRewindReader) Read(p []byte) (int, error) {
+	return r.rd.Read(p)
+}
+
+// Rewind rewinds the underlying reader and resets the hash. The hash is also
+// reset if rewinding fails, such that it never covers data from a previous
+// attempt.
+func (r *HashingRewindReader) Rewind() error {
+	r.h.Reset()
+	return r.RewindReader.Rewind()
+}
+
+// Sum appends the hash of the data read since the last Rewind to b.
+func (r *HashingRewindReader) Sum(b []byte) []byte {
+	return r.rd.Sum(b)
+}
@@ -68,6 +68,47 @@ func TestFileReader(t *testing.T) {
 	}
 }
 
+func TestFileReaderRewindSizeChanged(t *testing.T) {
+	buf := []byte("foobar")
+
+	filename := filepath.Join(test.TempDir(t), "file-reader-test")
+	test.OK(t, os.WriteFile(filename, buf, 0600))
+	f, err := os.OpenFile(filename, os.O_RDWR, 0)
+	test.OK(t, err)
+	defer func() {
+		test.OK(t, f.Close())
+	}()
+
+	rd, err := NewFileReader(f, nil)
+	test.OK(t, err)
+	_, err = rd.Read(make([]byte, 3))
+	test.OK(t, err)
+
+	test.OK(t, f.Truncate(2))
+	err = rd.Rewind()
+	test.Assert(t, IsRewindError(err), "expected rewind error, got %v", err)
+}
+
+func TestHashingRewindReader(t *testing.T) {
+	buf := []byte("foobar")
+	fn := func() RewindReader {
+		return NewHashingRewindReader(NewByteReader(buf, nil), md5.New())
+	}
+	testRewindReader(t, fn, buf)
+
+	want := md5.Sum(buf)
+	rd := NewHashingRewindReader(NewByteReader(buf, nil), md5.New())
+
+	// a partial read must not influence the hash after rewinding
+	_, err := rd.Read(make([]byte, 3))
+	test.OK(t, err)
+	test.OK(t, rd.Rewind())
+
+	_, err = io.Copy(io.Discard, rd)
+	test.OK(t, err)
+	test.Equals(t, want[:], rd.Sum(nil))
+}
+
 func testRewindReader(t *testing.T, fn func() RewindReader, data []byte) {
 	seed := time.Now().UnixNano()
 	t.Logf("seed is %d", seed)
@@ -2,13 +2,16 @@ package restic
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os/user"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
 )
 
 // Snapshot is the state of a resource at one point in time.
@@ -24,10 +27,37 @@ type Snapshot struct {
 	Excludes []string  `json:"excludes,omitempty"`
 	Tags     []string  `json:"tags,omitempty"`
 	Original *ID       `json:"original,omitempty"`
+	Pinned   bool      `json:"pinned,omitempty"`
 
-	ProgramVersion string `json:"program_version,omitempty"`
+	ProgramVersion string           `json:"program_version,omitempty"`
+	KeyID          *ID              `json:"key_id,omitempty"` // key which created the snapshot, not authenticated
+	Summary        *SnapshotSummary `json:"summary,omitempty"`
 
-	id *ID // plaintext ID, used during restore
+	id      *ID                        // plaintext ID, used during restore
+	unknown map[string]json.RawMessage // fields unknown to this version of restic
+}
+
+// SnapshotSummary contains statistics about the backup run which created a
+// snapshot. It is nil for snapshots created by older versions of restic.
+type SnapshotSummary struct {
+	BackupStart time.Time `json:"backup_start"`
+	BackupEnd   time.Time `json:"backup_end"`
+
+	// the same statistics as in the summary of the backup output
+	FilesNew            uint   `json:"files_new"`
+	FilesChanged        uint   `json:"files_changed"`
+	FilesUnmodified     uint   `json:"files_unmodified"`
+	DirsNew             uint   `json:"dirs_new"`
+	DirsChanged         uint   `json:"dirs_changed"`
+	DirsUnmodified      uint   `json:"dirs_unmodified"`
+	DataBlobs           int    `json:"data_blobs"`
+	TreeBlobs           int    `json:"tree_blobs"`
+	DataAdded           uint64 `json:"data_added"`
+	DataAddedPacked     uint64 `json:"data_added_packed"`
+	TotalFilesProcessed uint   `json:"total_files_processed"`
+	TotalBytesProcessed uint64 `json:"total_bytes_processed"`
+
+	unknown map[string]json.RawMessage // fields unknown to this version of restic
 }
 
 // NewSnapshot returns an initialized snapshot struct for the current user and
@@ -61,7 +91,10 @@ func NewSnapshot(paths []string, tags []string, hostname string, time time.Time)
 // LoadSnapshot loads the snapshot with the id and returns it.
 func LoadSnapshot(ctx context.Context, loader LoaderUnpacked, id ID) (*Snapshot, error) {
 	sn := &Snapshot{id: &id}
-	err := LoadJSONUnpacked(ctx, loader, SnapshotFile, id, sn)
+	buf, err := loader.LoadUnpacked(ctx, SnapshotFile, id)
+	if err == nil {
+		err = decodeSnapshot(buf, sn)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to load snapshot %v: %w", id.Str(), err)
 	}
@@ -71,7 +104,11 @@ func LoadSnapshot(ctx context.Context, loader LoaderUnpacked, id ID) (*Snapshot,
 
 // SaveSnapshot saves the snapshot sn and returns its ID.
 func SaveSnapshot(ctx context.Context, repo SaverUnpacked, sn *Snapshot) (ID, error) {
-	return SaveJSONUnpacked(ctx, repo, SnapshotFile, sn)
+	buf, err := encodeSnapshot(sn)
+	if err != nil {
+		return ID{}, errors.Wrap(err, "json.Marshal")
+	}
+	return repo.SaveUnpacked(ctx, SnapshotFile, buf)
 }
 
 // ForAllSnapshots reads all snapshots in parallel and calls the
@@ -105,6 +142,36 @@ func (sn Snapshot) ID() *ID {
 	return sn.id
 }
 
+// Rewrite returns a copy of sn which is meant to replace sn in the repository,
+// for example after changing its tags or its tree. The copy keeps the time,
+// hostname, paths and parent of sn, such that forget policies treat it like
+// sn. Original is set to the ID of the snapshot sn was derived from, following
+// the Original fields of earlier rewrites.
+func (sn *Snapshot) Rewrite() *Snapshot {
+	rewritten := *sn
+	rewritten.id = nil
+	rewritten.Paths = copyStrings(sn.Paths)
+	rewritten.Excludes = copyStrings(sn.Excludes)
+	rewritten.Tags = copyStrings(sn.Tags)
+
+	switch {
+	case sn.Original != nil:
+		original := *sn.Original
+		rewritten.Original = &original
+	case sn.id != nil:
+		original := *sn.id
+		rewritten.Original = &original
+	}
+	return &rewritten
+}
+
+func copyStrings(l []string) []string {
+	if l == nil {
+		return nil
+	}
+	return append(make([]string, 0, len(l)), l...)
+}
+
 func (sn *Snapshot) fillUserInfo() error {
 	usr, err := user.Current()
 	if err != nil {
@@ -211,6 +278,37 @@ func (sn *Snapshot) HasPaths(paths []string) bool {
 	return true
 }
 
+// HasPathPrefixes returns true if the snapshot has, for each of the
+// prefixes, a path which is equal to or below the prefix.
+func (sn *Snapshot) HasPathPrefixes(prefixes []string) bool {
+	for _, prefix := range prefixes {
+		found := false
+		for _, snPath := range sn.Paths {
+			if hasPathPrefix(snPath, prefix) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hasPathPrefix returns true if p is equal to prefix or a path below it.
+func hasPathPrefix(p, prefix string) bool {
+	if !strings.HasPrefix(p, prefix) {
+		return false
+	}
+	if len(p) == len(prefix) || strings.HasSuffix(prefix, "/") || strings.HasSuffix(prefix, string(filepath.Separator)) {
+		return true
+	}
+	c := p[len(prefix)]
+	return c == '/' || c == filepath.Separator
+}
+
 // HasHostname returns true if either
 // - the snapshot hostname is in the list of the given hostnames, or
 // - the list of given hostnames is empty
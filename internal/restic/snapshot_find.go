@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -19,9 +21,16 @@ type SnapshotFilter struct {
 
 	Hosts []string
 	Tags  TagLists
+	// Paths matches snapshots which, for each of the paths, contain the path
+	// itself or a path below it.
 	Paths []string
+	// If set, Paths must be contained in the snapshots exactly.
+	ExactPaths bool
 	// Match snapshots from before this timestamp. Zero for no limit.
 	TimestampLimit time.Time
+	// If set, FindLatest skips snapshots which cannot be loaded and reports
+	// them to this function instead of returning an error.
+	LoadErrorFn func(id ID, err error)
 }
 
 func (f *SnapshotFilter) empty() bool {
@@ -29,30 +38,51 @@ func (f *SnapshotFilter) empty() bool {
 }
 
 func (f *SnapshotFilter) matches(sn *Snapshot) bool {
-	return sn.HasHostname(f.Hosts) && sn.HasTagList(f.Tags) && sn.HasPaths(f.Paths)
+	if !sn.HasHostname(f.Hosts) || !sn.HasTagList(f.Tags) {
+		return false
+	}
+	if f.ExactPaths {
+		return sn.HasPaths(f.Paths)
+	}
+	return sn.HasPathPrefixes(f.Paths)
 }
 
-// findLatest finds the latest snapshot with optional target/directory,
-// tags, hostname, and timestamp filters.
-func (f *SnapshotFilter) findLatest(ctx context.Context, be Lister, loader LoaderUnpacked) (*Snapshot, error) {
-
-	var err error
+// normalizePaths makes the paths of the filter absolute and cleans them, as
+// the paths of snapshots are stored in this form.
+func (f *SnapshotFilter) normalizePaths() error {
 	absTargets := make([]string, 0, len(f.Paths))
 	for _, target := range f.Paths {
 		if !filepath.IsAbs(target) {
+			var err error
 			target, err = filepath.Abs(target)
 			if err != nil {
-				return nil, errors.Wrap(err, "Abs")
+				return errors.Wrap(err, "Abs")
 			}
 		}
 		absTargets = append(absTargets, filepath.Clean(target))
 	}
 	f.Paths = absTargets
+	return nil
+}
 
-	var latest *Snapshot
+// findLatest finds the latest snapshot with optional target/directory,
+// tags, hostname, and timestamp filters. If offset is larger than zero, the
+// snapshot that many snapshots before the latest one is returned.
+func (f *SnapshotFilter) findLatest(ctx context.Context, be Lister, loader LoaderUnpacked, offset int) (*Snapshot, error) {
+	err := f.normalizePaths()
+	if err != nil {
+		return nil, err
+	}
+
+	// the offset+1 most recent snapshots, sorted newest first
+	var latest Snapshots
 
 	err = ForAllSnapshots(ctx, be, loader, nil, func(id ID, snapshot *Snapshot, err error) error {
 		if err != nil {
+			if f.LoadErrorFn != nil {
+				f.LoadErrorFn(id, err)
+				return nil
+			}
 			return errors.Errorf("Error loading snapshot %v: %v", id.Str(), err)
 		}
 
@@ -60,7 +90,7 @@ func (f *SnapshotFilter) findLatest(ctx context.Context, be Lister, loader Loade
 			return nil
 		}
 
-		if latest != nil && snapshot.Time.Before(latest.Time) {
+		if len(latest) > offset && snapshot.Time.Before(latest[offset].Time) {
 			return nil
 		}
 
@@ -68,7 +98,11 @@ func (f *SnapshotFilter) findLatest(ctx context.Context, be Lister, loader Loade
 			return nil
 		}
 
-		latest = snapshot
+		latest = append(latest, snapshot)
+		sort.Stable(latest)
+		if len(latest) > offset+1 {
+			latest = latest[:offset+1]
+		}
 		return nil
 	})
 
@@ -76,11 +110,81 @@ func (f *SnapshotFilter) findLatest(ctx context.Context, be Lister, loader Loade
 		return nil, err
 	}
 
-	if latest == nil {
+	if len(latest) <= offset {
 		return nil, ErrNoSnapshotFound
 	}
 
-	return latest, nil
+	return latest[offset], nil
+}
+
+// parseLatest parses the snapshot references "latest" and "latest~N". It
+// returns N and whether s refers to one of the latest snapshots.
+func parseLatest(s string) (offset int, ok bool, err error) {
+	if s == "latest" {
+		return 0, true, nil
+	}
+	if !strings.HasPrefix(s, "latest~") {
+		return 0, false, nil
+	}
+
+	offset, err = strconv.Atoi(strings.TrimPrefix(s, "latest~"))
+	if err != nil || offset < 0 {
+		return 0, true, errors.Errorf("invalid snapshot %q, expected latest~N with a non-negative number N", s)
+	}
+	return offset, true, nil
+}
+
+// AmbiguousSnapshotError is returned when a snapshot ID prefix matches more
+// than one snapshot.
+type AmbiguousSnapshotError struct {
+	Prefix     string
+	Candidates Snapshots
+}
+
+func (e *AmbiguousSnapshotError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "snapshot ID prefix %q is ambiguous, it matches %d snapshots:", e.Prefix, len(e.Candidates))
+	for _, sn := range e.Candidates {
+		fmt.Fprintf(&b, "\n  %v from %v", sn.ID(), sn.Time.Format("2006-01-02 15:04:05"))
+	}
+	return b.String()
+}
+
+// findSnapshotByPrefix returns the ID of the snapshot whose ID starts with
+// prefix. If several snapshots match, an AmbiguousSnapshotError is returned.
+func findSnapshotByPrefix(ctx context.Context, be Lister, loader LoaderUnpacked, prefix string) (ID, error) {
+	var matches IDs
+	err := be.List(ctx, SnapshotFile, func(fi FileInfo) error {
+		id, err := ParseID(fi.Name)
+		if err != nil {
+			return nil
+		}
+		if strings.HasPrefix(fi.Name, prefix) {
+			matches = append(matches, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return ID{}, err
+	}
+
+	switch len(matches) {
+	case 0:
+		return ID{}, &NoIDByPrefixError{prefix}
+	case 1:
+		return matches[0], nil
+	}
+
+	candidates := make(Snapshots, 0, len(matches))
+	for _, id := range matches {
+		sn, err := LoadSnapshot(ctx, loader, id)
+		if err != nil {
+			return ID{}, err
+		}
+		candidates = append(candidates, sn)
+	}
+	sort.Stable(candidates)
+	return ID{}, &AmbiguousSnapshotError{Prefix: prefix, Candidates: candidates}
 }
 
 func splitSnapshotID(s string) (id, subfolder string) {
@@ -88,37 +192,48 @@ func splitSnapshotID(s string) (id, subfolder string) {
 	return
 }
 
-// FindSnapshot takes a string and tries to find a snapshot whose ID matches
-// the string as closely as possible.
-func FindSnapshot(ctx context.Context, be Lister, loader LoaderUnpacked, s string) (*Snapshot, string, error) {
-	s, subfolder := splitSnapshotID(s)
-
+// findSnapshot returns the snapshot with the full ID or unambiguous ID prefix s.
+func findSnapshot(ctx context.Context, be Lister, loader LoaderUnpacked, s string) (*Snapshot, error) {
 	// no need to list snapshots if `s` is already a full id
 	id, err := ParseID(s)
 	if err != nil {
 		// find snapshot id with prefix
-		id, err = Find(ctx, be, SnapshotFile, s)
+		id, err = findSnapshotByPrefix(ctx, be, loader, s)
 		if err != nil {
-			return nil, "", err
+			return nil, err
 		}
 	}
-	sn, err := LoadSnapshot(ctx, loader, id)
-	return sn, subfolder, err
+	return LoadSnapshot(ctx, loader, id)
+}
+
+// FindSnapshot takes a string and tries to find a snapshot whose ID matches
+// the string as closely as possible. It accepts the same references as
+// FindLatest without filtering snapshots.
+func FindSnapshot(ctx context.Context, be Lister, loader LoaderUnpacked, s string) (*Snapshot, string, error) {
+	return (&SnapshotFilter{}).FindLatest(ctx, be, loader, s)
 }
 
-// FindLatest returns either the latest of a filtered list of all snapshots
-// or a snapshot specified by `snapshotID`.
+// FindLatest returns the snapshot referenced by `snapshotID`, optionally
+// followed by ":subfolder". This is either a full snapshot ID, an unambiguous
+// ID prefix, "latest" for the latest of a filtered list of all snapshots, or
+// "latest~N" for the snapshot N snapshots before the latest one in that list.
 func (f *SnapshotFilter) FindLatest(ctx context.Context, be Lister, loader LoaderUnpacked, snapshotID string) (*Snapshot, string, error) {
 	id, subfolder := splitSnapshotID(snapshotID)
-	if id == "latest" {
-		sn, err := f.findLatest(ctx, be, loader)
+	offset, isLatest, err := parseLatest(id)
+	if err != nil {
+		return nil, "", err
+	}
+	if isLatest {
+		sn, err := f.findLatest(ctx, be, loader, offset)
 		if err == ErrNoSnapshotFound {
 			err = fmt.Errorf("snapshot filter (Paths:%v Tags:%v Hosts:%v): %w",
 				f.Paths, f.Tags, f.Hosts, err)
 		}
 		return sn, subfolder, err
 	}
-	return FindSnapshot(ctx, be, loader, snapshotID)
+
+	sn, err := findSnapshot(ctx, be, loader, id)
+	return sn, subfolder, err
 }
 
 type SnapshotFindCb func(string, *Snapshot, error) error
@@ -135,29 +250,30 @@ func (f *SnapshotFilter) FindAll(ctx context.Context, be Lister, loader LoaderUn
 		// Process all snapshot IDs given as arguments.
 		for _, s := range snapshotIDs {
 			var sn *Snapshot
-			if s == "latest" {
-				if usedFilter {
-					continue
-				}
-
+			id, subfolder := splitSnapshotID(s)
+			offset, isLatest, perr := parseLatest(id)
+			switch {
+			case perr != nil:
+				err = perr
+			case subfolder != "" || strings.HasSuffix(s, ":"):
+				err = ErrInvalidSnapshotSyntax
+			case isLatest:
 				usedFilter = true
 
-				sn, err = f.findLatest(ctx, be, loader)
+				sn, err = f.findLatest(ctx, be, loader, offset)
 				if err == ErrNoSnapshotFound {
 					err = errors.Errorf("no snapshot matched given filter (Paths:%v Tags:%v Hosts:%v)",
 						f.Paths, f.Tags, f.Hosts)
 				}
-				if sn != nil {
+				if err == nil {
+					if ids.Has(*sn.ID()) {
+						continue
+					}
 					ids.Insert(*sn.ID())
 				}
-			} else if strings.HasPrefix(s, "latest:") {
-				err = ErrInvalidSnapshotSyntax
-			} else {
-				var subfolder string
-				sn, subfolder, err = FindSnapshot(ctx, be, loader, s)
-				if err == nil && subfolder != "" {
-					err = ErrInvalidSnapshotSyntax
-				} else if err == nil {
+			default:
+				sn, err = findSnapshot(ctx, be, loader, id)
+				if err == nil {
 					if ids.Has(*sn.ID()) {
 						continue
 					}
@@ -179,6 +295,10 @@ func (f *SnapshotFilter) FindAll(ctx context.Context, be Lister, loader LoaderUn
 		return nil
 	}
 
+	if err := f.normalizePaths(); err != nil {
+		return err
+	}
+
 	return ForAllSnapshots(ctx, be, loader, nil, func(id ID, sn *Snapshot, err error) error {
 		if err == nil && !f.matches(sn) {
 			return nil
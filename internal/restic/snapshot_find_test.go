@@ -2,7 +2,12 @@ package restic_test
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
@@ -45,6 +50,29 @@ func TestFindLatestSnapshotWithMaxTimestamp(t *testing.T) {
 	}
 }
 
+func TestFindLatestSnapshotLoadError(t *testing.T) {
+	repo := repository.TestRepository(t)
+	desiredSnapshot := restic.TestCreateSnapshot(t, repo, parseTimeUTC("2017-07-07 07:07:07"), 1)
+
+	// a snapshot file which is still being written by a concurrent backup
+	brokenID := restic.NewRandomID()
+	h := restic.Handle{Type: restic.SnapshotFile, Name: brokenID.String()}
+	test.OK(t, repo.Backend().Save(context.TODO(), h, restic.NewByteReader([]byte("truncated"), repo.Backend().Hasher())))
+
+	f := restic.SnapshotFilter{Hosts: []string{"foo"}}
+	_, _, err := f.FindLatest(context.TODO(), repo.Backend(), repo, "latest")
+	test.Assert(t, err != nil, "FindLatest should fail for an unreadable snapshot")
+
+	var ignored restic.IDs
+	f.LoadErrorFn = func(id restic.ID, err error) {
+		ignored = append(ignored, id)
+	}
+	sn, _, err := f.FindLatest(context.TODO(), repo.Backend(), repo, "latest")
+	test.OK(t, err)
+	test.Equals(t, *desiredSnapshot.ID(), *sn.ID())
+	test.Equals(t, restic.IDs{brokenID}, ignored)
+}
+
 func TestFindLatestWithSubpath(t *testing.T) {
 	repo := repository.TestRepository(t)
 	restic.TestCreateSnapshot(t, repo, parseTimeUTC("2015-05-05 05:05:05"), 1)
@@ -89,3 +117,175 @@ func TestFindAllSubpathError(t *testing.T) {
 		}))
 	test.Assert(t, count == 2, "unexpected number of subfolder errors: %v, wanted %v", count, 2)
 }
+
+func TestFindLatestOffset(t *testing.T) {
+	repo := repository.TestRepository(t)
+	sn1 := restic.TestCreateSnapshot(t, repo, parseTimeUTC("2015-05-05 05:05:05"), 1)
+	sn2 := restic.TestCreateSnapshot(t, repo, parseTimeUTC("2017-07-07 07:07:07"), 1)
+	sn3 := restic.TestCreateSnapshot(t, repo, parseTimeUTC("2019-09-09 09:09:09"), 1)
+
+	for _, exp := range []struct {
+		query     string
+		want      *restic.Snapshot
+		subfolder string
+	}{
+		{"latest", sn3, ""},
+		{"latest~0", sn3, ""},
+		{"latest~1", sn2, ""},
+		{"latest~2", sn1, ""},
+		{"latest~2:subfolder", sn1, "subfolder"},
+		{sn2.ID().Str(), sn2, ""},
+		{sn2.ID().String()[:20], sn2, ""},
+		{sn2.ID().String(), sn2, ""},
+	} {
+		t.Run(exp.query, func(t *testing.T) {
+			sn, subfolder, err := (&restic.SnapshotFilter{}).FindLatest(context.TODO(), repo.Backend(), repo, exp.query)
+			test.OK(t, err)
+			test.Equals(t, *exp.want.ID(), *sn.ID())
+			test.Equals(t, exp.subfolder, subfolder)
+
+			// FindSnapshot accepts the same references
+			sn, _, err = restic.FindSnapshot(context.TODO(), repo.Backend(), repo, exp.query)
+			test.OK(t, err)
+			test.Equals(t, *exp.want.ID(), *sn.ID())
+		})
+	}
+
+	// the offset applies to the filtered list
+	sn, _, err := (&restic.SnapshotFilter{TimestampLimit: parseTimeUTC("2018-08-08 08:08:08")}).FindLatest(context.TODO(), repo.Backend(), repo, "latest~1")
+	test.OK(t, err)
+	test.Equals(t, *sn1.ID(), *sn.ID())
+
+	for _, query := range []string{"latest~3", "latest~-1", "latest~x", "latest~"} {
+		_, _, err := (&restic.SnapshotFilter{}).FindLatest(context.TODO(), repo.Backend(), repo, query)
+		test.Assert(t, err != nil, "expected error for %q", query)
+	}
+	_, _, err = (&restic.SnapshotFilter{}).FindLatest(context.TODO(), repo.Backend(), repo, "latest~3")
+	test.Assert(t, errors.Is(err, restic.ErrNoSnapshotFound), "unexpected error %v", err)
+
+	var found restic.IDs
+	test.OK(t, (&restic.SnapshotFilter{}).FindAll(context.TODO(), repo.Backend(), repo,
+		[]string{"latest~1", "latest", "latest~0", sn1.ID().Str()},
+		func(id string, sn *restic.Snapshot, err error) error {
+			test.OK(t, err)
+			found = append(found, *sn.ID())
+			return nil
+		}))
+	test.Equals(t, restic.IDs{*sn2.ID(), *sn3.ID(), *sn1.ID()}, found)
+}
+
+func TestFindSnapshotAmbiguousPrefix(t *testing.T) {
+	repo := repository.TestRepository(t)
+
+	// save snapshots until two IDs share the first four characters
+	prefixes := make(map[string]restic.ID)
+	var prefix string
+	for i := 0; prefix == ""; i++ {
+		if i > 10000 {
+			t.Fatal("no snapshot IDs with a common prefix found")
+		}
+		sn, err := restic.NewSnapshot([]string{"/test"}, nil, "foo", parseTimeUTC("2020-01-01 00:00:00").Add(time.Duration(i)*time.Minute))
+		test.OK(t, err)
+		id, err := restic.SaveSnapshot(context.TODO(), repo, sn)
+		test.OK(t, err)
+
+		p := id.String()[:4]
+		if _, ok := prefixes[p]; ok {
+			prefix = p
+		}
+		prefixes[p] = id
+	}
+
+	_, _, err := restic.FindSnapshot(context.TODO(), repo.Backend(), repo, prefix)
+	var ambiguous *restic.AmbiguousSnapshotError
+	test.Assert(t, errors.As(err, &ambiguous), "unexpected error %v", err)
+	test.Equals(t, 2, len(ambiguous.Candidates))
+	for _, sn := range ambiguous.Candidates {
+		test.Assert(t, strings.HasPrefix(sn.ID().String(), prefix), "candidate %v does not match %v", sn.ID(), prefix)
+		test.Assert(t, strings.Contains(err.Error(), sn.ID().String()+" from "+sn.Time.Format("2006-01-02 15:04:05")),
+			"missing candidate %v in error: %v", sn.ID(), err)
+	}
+	test.Assert(t, ambiguous.Candidates[0].Time.After(ambiguous.Candidates[1].Time), "candidates are not sorted")
+
+	// a longer prefix is unambiguous
+	sn, _, err := restic.FindSnapshot(context.TODO(), repo.Backend(), repo, prefixes[prefix].String()[:16])
+	test.OK(t, err)
+	test.Equals(t, prefixes[prefix], *sn.ID())
+
+	_, _, err = restic.FindSnapshot(context.TODO(), repo.Backend(), repo, "zzzz")
+	var noMatch *restic.NoIDByPrefixError
+	test.Assert(t, errors.As(err, &noMatch), "unexpected error %v", err)
+}
+
+func TestSnapshotFilter(t *testing.T) {
+	repo := repository.TestRepository(t)
+
+	canned := []struct {
+		name  string
+		host  string
+		paths []string
+		tags  []string
+	}{
+		{"a", "foo", []string{"/home/user"}, []string{"work"}},
+		{"b", "foo", []string{"/home/user/docs"}, []string{"work", "daily"}},
+		{"c", "bar", []string{"/home"}, []string{"daily"}},
+		{"d", "bar", []string{"/srv", "/etc"}, nil},
+		{"e", "baz", []string{"/home-other"}, nil},
+	}
+
+	names := make(map[restic.ID]string)
+	for i, c := range canned {
+		sn, err := restic.NewSnapshot(c.paths, c.tags, c.host, parseTimeUTC("2020-01-01 00:00:00").Add(time.Duration(i)*time.Minute))
+		test.OK(t, err)
+		id, err := restic.SaveSnapshot(context.TODO(), repo, sn)
+		test.OK(t, err)
+		names[id] = c.name
+	}
+
+	var tests = []struct {
+		filter restic.SnapshotFilter
+		want   string
+	}{
+		{restic.SnapshotFilter{}, "abcde"},
+		{restic.SnapshotFilter{Hosts: []string{"foo"}}, "ab"},
+		{restic.SnapshotFilter{Hosts: []string{"foo", "bar"}}, "abcd"},
+		{restic.SnapshotFilter{Hosts: []string{"other"}}, ""},
+		{restic.SnapshotFilter{Tags: restic.TagLists{{"work"}}}, "ab"},
+		{restic.SnapshotFilter{Tags: restic.TagLists{{"work", "daily"}}}, "b"},
+		{restic.SnapshotFilter{Tags: restic.TagLists{{"work"}, {"daily"}}}, "abc"},
+		{restic.SnapshotFilter{Paths: []string{"/home"}}, "abc"},
+		{restic.SnapshotFilter{Paths: []string{"/home/"}}, "abc"},
+		{restic.SnapshotFilter{Paths: []string{"/home/user"}}, "ab"},
+		{restic.SnapshotFilter{Paths: []string{"/home/user/../user/docs"}}, "b"},
+		{restic.SnapshotFilter{Paths: []string{"/srv", "/etc"}}, "d"},
+		{restic.SnapshotFilter{Paths: []string{"/srv", "/home"}}, ""},
+		{restic.SnapshotFilter{Paths: []string{"/"}}, "abcde"},
+		{restic.SnapshotFilter{Paths: []string{"/home/user"}, ExactPaths: true}, "a"},
+		{restic.SnapshotFilter{Paths: []string{"/srv"}, ExactPaths: true}, "d"},
+		{restic.SnapshotFilter{Hosts: []string{"foo", "bar"}, Tags: restic.TagLists{{"daily"}}, Paths: []string{"/home"}}, "bc"},
+	}
+
+	for _, tc := range tests {
+		f := tc.filter
+		t.Run(fmt.Sprintf("%v/%v/%v/%v", f.Hosts, f.Tags, f.Paths, f.ExactPaths), func(t *testing.T) {
+			var got []string
+			err := f.FindAll(context.TODO(), repo.Backend(), repo, nil, func(id string, sn *restic.Snapshot, err error) error {
+				test.OK(t, err)
+				got = append(got, names[*sn.ID()])
+				return nil
+			})
+			test.OK(t, err)
+			sort.Strings(got)
+			test.Equals(t, tc.want, strings.Join(got, ""))
+
+			// latest must select the newest of the same snapshots
+			sn, _, err := f.FindLatest(context.TODO(), repo.Backend(), repo, "latest")
+			if tc.want == "" {
+				test.Assert(t, errors.Is(err, restic.ErrNoSnapshotFound), "unexpected error %v", err)
+				return
+			}
+			test.OK(t, err)
+			test.Equals(t, tc.want[len(tc.want)-1:], names[*sn.ID()])
+		})
+	}
+}
@@ -66,6 +66,38 @@ type SnapshotGroupKey struct {
 	Tags     []string `json:"tags"`
 }
 
+// Key returns the key of the group sn belongs to. The tags and paths of sn
+// are sorted in place.
+func (l SnapshotGroupByOptions) Key(sn *Snapshot) (string, error) {
+	var tags []string
+	var hostname string
+	var paths []string
+
+	if l.Tag {
+		tags = sn.Tags
+		sort.Strings(tags)
+	}
+	if l.Host {
+		hostname = sn.Hostname
+	}
+	if l.Path {
+		paths = sn.Paths
+	}
+
+	sort.Strings(sn.Paths)
+
+	k, err := json.Marshal(SnapshotGroupKey{Tags: tags, Hostname: hostname, Paths: paths})
+	if err != nil {
+		return "", err
+	}
+	return string(k), nil
+}
+
+// Grouped returns true if snapshots are grouped by at least one criteria.
+func (l SnapshotGroupByOptions) Grouped() bool {
+	return l.Tag || l.Host || l.Path
+}
+
 // GroupSnapshots takes a list of snapshots and a grouping criteria and creates
 // a grouped list of snapshots.
 func GroupSnapshots(snapshots Snapshots, groupBy SnapshotGroupByOptions) (map[string]Snapshots, bool, error) {
@@ -73,33 +105,12 @@ func GroupSnapshots(snapshots Snapshots, groupBy SnapshotGroupByOptions) (map[st
 	snapshotGroups := make(map[string]Snapshots)
 
 	for _, sn := range snapshots {
-		// Determining grouping-keys
-		var tags []string
-		var hostname string
-		var paths []string
-
-		if groupBy.Tag {
-			tags = sn.Tags
-			sort.Strings(tags)
-		}
-		if groupBy.Host {
-			hostname = sn.Hostname
-		}
-		if groupBy.Path {
-			paths = sn.Paths
-		}
-
-		sort.Strings(sn.Paths)
-		var k []byte
-		var err error
-
-		k, err = json.Marshal(SnapshotGroupKey{Tags: tags, Hostname: hostname, Paths: paths})
-
+		k, err := groupBy.Key(sn)
 		if err != nil {
 			return nil, false, err
 		}
-		snapshotGroups[string(k)] = append(snapshotGroups[string(k)], sn)
+		snapshotGroups[k] = append(snapshotGroups[k], sn)
 	}
 
-	return snapshotGroups, groupBy.Tag || groupBy.Host || groupBy.Path, nil
+	return snapshotGroups, groupBy.Grouped(), nil
 }
@@ -0,0 +1,176 @@
+package restic
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// Snapshots created by newer versions of restic may contain fields which this
+// version does not know. These are kept as raw JSON when a snapshot is loaded
+// and written back when the snapshot is saved again, so that modifying a
+// snapshot (e.g. by tag or rewrite) does not silently drop data.
+
+var (
+	knownSnapshotFields = jsonFieldNames(reflect.TypeOf(Snapshot{}))
+	knownSummaryFields  = jsonFieldNames(reflect.TypeOf(SnapshotSummary{}))
+)
+
+// jsonFieldNames returns the names of the fields in the JSON representation
+// of the struct type t.
+func jsonFieldNames(t reflect.Type) map[string]struct{} {
+	names := make(map[string]struct{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" || !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		names[name] = struct{}{}
+	}
+	return names
+}
+
+// unknownFields returns the fields of the JSON object data whose names are not
+// contained in known. It returns nil if there are no such fields.
+func unknownFields(data []byte, known map[string]struct{}) (map[string]json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	var unknown map[string]json.RawMessage
+	for name, value := range fields {
+		if _, ok := known[name]; ok {
+			continue
+		}
+		if unknown == nil {
+			unknown = make(map[string]json.RawMessage)
+		}
+		unknown[name] = value
+	}
+	return unknown, nil
+}
+
+// appendFields adds fields to the JSON object obj, sorted by name.
+func appendFields(obj []byte, fields map[string]json.RawMessage) ([]byte, error) {
+	obj = bytes.TrimSpace(obj)
+	if len(obj) < 2 || obj[0] != '{' || obj[len(obj)-1] != '}' {
+		return nil, errors.Errorf("invalid JSON object %q", obj)
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf := bytes.NewBuffer(make([]byte, 0, len(obj)))
+	buf.Write(obj[:len(obj)-1])
+	empty := len(bytes.TrimSpace(obj[1:len(obj)-1])) == 0
+	for _, name := range names {
+		if !empty {
+			buf.WriteByte(',')
+		}
+		empty = false
+
+		key, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(fields[name])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// decodeSnapshot unmarshals data into sn and keeps the fields which are unknown
+// to this version of restic.
+func decodeSnapshot(data []byte, sn *Snapshot) error {
+	if err := json.Unmarshal(data, sn); err != nil {
+		return err
+	}
+
+	unknown, err := unknownFields(data, knownSnapshotFields)
+	if err != nil {
+		return err
+	}
+	sn.unknown = unknown
+
+	if sn.Summary != nil {
+		var fields struct {
+			Summary json.RawMessage `json:"summary"`
+		}
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return err
+		}
+		sn.Summary.unknown, err = unknownFields(fields.Summary, knownSummaryFields)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeSnapshot returns the JSON representation of sn including the fields
+// which were unknown when the snapshot was loaded.
+func encodeSnapshot(sn *Snapshot) ([]byte, error) {
+	if len(sn.unknown) == 0 && (sn.Summary == nil || len(sn.Summary.unknown) == 0) {
+		return json.Marshal(sn)
+	}
+
+	// the summary is the last field, encode it separately to add its unknown fields
+	tmp := *sn
+	tmp.Summary = nil
+	buf, err := json.Marshal(&tmp)
+	if err != nil {
+		return nil, err
+	}
+
+	buf, err = appendFields(buf, sn.unknown)
+	if err != nil {
+		return nil, err
+	}
+
+	if sn.Summary != nil {
+		summary, err := json.Marshal(sn.Summary)
+		if err != nil {
+			return nil, err
+		}
+		summary, err = appendFields(summary, sn.Summary.unknown)
+		if err != nil {
+			return nil, err
+		}
+		buf, err = appendFields(buf, map[string]json.RawMessage{"summary": summary})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// UnknownFields returns the sorted names of the fields of the snapshot which
+// are unknown to this version of restic. Fields of the summary are prefixed
+// with "summary.".
+func (sn *Snapshot) UnknownFields() []string {
+	var names []string
+	for name := range sn.unknown {
+		names = append(names, name)
+	}
+	if sn.Summary != nil {
+		for name := range sn.Summary.unknown {
+			names = append(names, "summary."+name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
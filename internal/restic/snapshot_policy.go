@@ -25,6 +25,12 @@ type ExpirePolicy struct {
 	WithinMonthly Duration  // keep monthly snapshots made within this duration
 	WithinYearly  Duration  // keep yearly snapshots made within this duration
 	Tags          []TagList // keep all snapshots that include at least one of the tag lists.
+
+	IgnorePins bool // do not keep pinned snapshots unless they match the policy
+
+	// Location is the time zone which determines the hour, day, week, month
+	// and year of a snapshot. If it is nil, time.Local is used.
+	Location *time.Location
 }
 
 func (e ExpirePolicy) String() (s string) {
@@ -105,13 +111,21 @@ func (e ExpirePolicy) Empty() bool {
 		return false
 	}
 
-	empty := ExpirePolicy{Tags: e.Tags}
+	empty := ExpirePolicy{Tags: e.Tags, IgnorePins: e.IgnorePins, Location: e.Location}
 	return reflect.DeepEqual(e, empty)
 }
 
-// ymdh returns an integer in the form YYYYMMDDHH.
-func ymdh(d time.Time, _ int) int {
-	return d.Year()*1000000 + int(d.Month())*10000 + d.Day()*100 + d.Hour()
+// The buckers below are called with the snapshot time converted to the
+// location of the policy. A day starts at midnight in that location, even if
+// it is shorter or longer than 24 hours due to a daylight saving time change.
+
+// hour returns the number of minutes since the epoch at the start of the hour
+// of d. Unlike the wall clock time, this distinguishes the two hours with the
+// same time when daylight saving time ends, and it respects time zones with
+// offsets which are not a multiple of an hour.
+func hour(d time.Time, _ int) int {
+	start := d.Add(-time.Duration(d.Minute())*time.Minute - time.Duration(d.Second())*time.Second - time.Duration(d.Nanosecond()))
+	return int(start.Unix() / 60)
 }
 
 // ymd returns an integer in the form YYYYMMDD.
@@ -208,7 +222,7 @@ func ApplyPolicy(list Snapshots, p ExpirePolicy) (keep, remove Snapshots, reason
 		reason string
 	}{
 		{p.Last, always, -1, "last snapshot"},
-		{p.Hourly, ymdh, -1, "hourly snapshot"},
+		{p.Hourly, hour, -1, "hourly snapshot"},
 		{p.Daily, ymd, -1, "daily snapshot"},
 		{p.Weekly, yw, -1, "weekly snapshot"},
 		{p.Monthly, ym, -1, "monthly snapshot"},
@@ -222,19 +236,31 @@ func ApplyPolicy(list Snapshots, p ExpirePolicy) (keep, remove Snapshots, reason
 		Last   int
 		reason string
 	}{
-		{p.WithinHourly, ymdh, -1, "hourly within"},
+		{p.WithinHourly, hour, -1, "hourly within"},
 		{p.WithinDaily, ymd, -1, "daily within"},
 		{p.WithinWeekly, yw, -1, "weekly within"},
 		{p.WithinMonthly, ym, -1, "monthly within"},
 		{p.WithinYearly, y, -1, "yearly within"},
 	}
 
-	latest := findLatestTimestamp(list)
+	loc := p.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	// durations given in days, months and years are calendar based
+	latest := findLatestTimestamp(list).In(loc)
 
 	for nr, cur := range list {
+		curTime := cur.Time.In(loc)
 		var keepSnap bool
 		var keepSnapReasons []string
 
+		// Pinned snapshots are always kept and, like tags, are not counted.
+		if cur.Pinned && !p.IgnorePins {
+			keepSnap = true
+			keepSnapReasons = append(keepSnapReasons, "pinned")
+		}
+
 		// Tags are handled specially as they are not counted.
 		for _, l := range p.Tags {
 			if cur.HasTags(l) {
@@ -256,7 +282,7 @@ func ApplyPolicy(list Snapshots, p ExpirePolicy) (keep, remove Snapshots, reason
 		for i, b := range buckets {
 			// -1 means "keep all"
 			if b.Count > 0 || b.Count == -1 {
-				val := b.bucker(cur.Time, nr)
+				val := b.bucker(curTime, nr)
 				// also keep the oldest snapshot if the bucket has some counts left. This maximizes the
 				// the history length kept while some counts are left.
 				if val != b.Last || nr == len(list)-1 {
@@ -277,7 +303,7 @@ func ApplyPolicy(list Snapshots, p ExpirePolicy) (keep, remove Snapshots, reason
 				t := latest.AddDate(-b.Within.Years, -b.Within.Months, -b.Within.Days).Add(time.Hour * time.Duration(-b.Within.Hours))
 
 				if cur.Time.After(t) {
-					val := b.bucker(cur.Time, nr)
+					val := b.bucker(curTime, nr)
 					if val != b.Last || nr == len(list)-1 {
 						debug.Log("keep %v, time %v, ID %v, bucker %v, val %v %v\n", b.reason, cur.Time, cur.id.Str(), i, val, b.Last)
 						keepSnap = true
@@ -7,6 +7,8 @@ import (
 	"path/filepath"
 	"testing"
 	"time"
+	// the time zone tests must not depend on the time zone database of the system
+	_ "time/tzdata"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
@@ -248,7 +250,8 @@ func TestApplyPolicy(t *testing.T) {
 
 	for i, p := range tests {
 		t.Run("", func(t *testing.T) {
-
+			// the golden files were created for the UTC time zone
+			p.Location = time.UTC
 			keep, remove, reasons := restic.ApplyPolicy(testExpireSnapshots, p)
 
 			if len(keep)+len(remove) != len(testExpireSnapshots) {
@@ -285,3 +288,155 @@ func TestApplyPolicy(t *testing.T) {
 		})
 	}
 }
+
+func TestApplyPolicyPinned(t *testing.T) {
+	testExpireSnapshots := restic.Snapshots{
+		{Time: parseTimeUTC("2014-09-01 10:20:30"), Pinned: true},
+		{Time: parseTimeUTC("2014-09-02 10:20:30")},
+		{Time: parseTimeUTC("2014-09-05 10:20:30")},
+		{Time: parseTimeUTC("2014-09-06 10:20:30"), Pinned: true},
+		{Time: parseTimeUTC("2014-09-08 10:20:30")},
+	}
+
+	keep, remove, reasons := restic.ApplyPolicy(testExpireSnapshots, restic.ExpirePolicy{Last: 1})
+	if len(keep) != 3 || len(remove) != 2 {
+		t.Fatalf("wrong number of snapshots kept or removed: keep %d, remove %d", len(keep), len(remove))
+	}
+	for i, want := range []string{"2014-09-08", "2014-09-06", "2014-09-01"} {
+		if got := keep[i].Time.Format("2006-01-02"); got != want {
+			t.Errorf("keep[%d]: want snapshot from %v, got %v", i, want, got)
+		}
+	}
+	if len(reasons) != 3 || len(reasons[1].Matches) != 1 || reasons[1].Matches[0] != "pinned" {
+		t.Errorf("unexpected reasons %v", reasons)
+	}
+	for _, sn := range remove {
+		if sn.Pinned {
+			t.Errorf("pinned snapshot %v was removed", sn.Time)
+		}
+	}
+
+	p := restic.ExpirePolicy{Last: 1, IgnorePins: true}
+	if p.Empty() {
+		t.Fatalf("policy %v should not be empty", p)
+	}
+	keep, remove, _ = restic.ApplyPolicy(testExpireSnapshots, p)
+	if len(keep) != 1 || len(remove) != 4 {
+		t.Fatalf("pins were not ignored: keep %d, remove %d", len(keep), len(remove))
+	}
+
+	if !(restic.ExpirePolicy{IgnorePins: true}).Empty() {
+		t.Errorf("policy with only IgnorePins set should be empty")
+	}
+}
+
+func TestApplyPolicyTimezone(t *testing.T) {
+	var tests = []struct {
+		name      string
+		location  string
+		policy    restic.ExpirePolicy
+		snapshots []string
+		keep      []string
+	}{
+		{
+			// the day of the spring forward change has only 23 hours
+			name:      "spring-forward-daily",
+			location:  "Europe/Berlin",
+			policy:    restic.ExpirePolicy{Daily: -1},
+			snapshots: []string{"2024-03-30T23:30:00+01:00", "2024-03-31T00:30:00+01:00", "2024-03-31T23:30:00+02:00", "2024-04-01T00:30:00+02:00"},
+			keep:      []string{"2024-04-01T00:30:00+02:00", "2024-03-31T23:30:00+02:00", "2024-03-30T23:30:00+01:00"},
+		},
+		{
+			name:      "spring-forward-daily-utc",
+			location:  "UTC",
+			policy:    restic.ExpirePolicy{Daily: -1},
+			snapshots: []string{"2024-03-30T23:30:00+01:00", "2024-03-31T00:30:00+01:00", "2024-03-31T23:30:00+02:00", "2024-04-01T00:30:00+02:00"},
+			keep:      []string{"2024-04-01T00:30:00+02:00", "2024-03-31T00:30:00+01:00", "2024-03-30T23:30:00+01:00"},
+		},
+		{
+			// the day of the fall back change has 25 hours
+			name:      "fall-back-daily",
+			location:  "Europe/Berlin",
+			policy:    restic.ExpirePolicy{Daily: -1},
+			snapshots: []string{"2024-10-26T12:00:00+02:00", "2024-10-27T00:10:00+02:00", "2024-10-27T23:50:00+01:00"},
+			keep:      []string{"2024-10-27T23:50:00+01:00", "2024-10-26T12:00:00+02:00"},
+		},
+		{
+			name:      "fall-back-daily-utc",
+			location:  "UTC",
+			policy:    restic.ExpirePolicy{Daily: -1},
+			snapshots: []string{"2024-10-26T12:00:00+02:00", "2024-10-27T00:10:00+02:00", "2024-10-27T23:50:00+01:00"},
+			keep:      []string{"2024-10-27T23:50:00+01:00", "2024-10-27T00:10:00+02:00", "2024-10-26T12:00:00+02:00"},
+		},
+		{
+			// the hour from 02:00 to 03:00 exists twice
+			name:      "fall-back-hourly",
+			location:  "Europe/Berlin",
+			policy:    restic.ExpirePolicy{Hourly: -1},
+			snapshots: []string{"2024-10-27T00:15:00+02:00", "2024-10-27T01:15:00+02:00", "2024-10-27T02:15:00+02:00", "2024-10-27T02:15:00+01:00"},
+			keep:      []string{"2024-10-27T02:15:00+01:00", "2024-10-27T02:15:00+02:00", "2024-10-27T01:15:00+02:00", "2024-10-27T00:15:00+02:00"},
+		},
+		{
+			name:      "half-hour-offset-daily",
+			location:  "Asia/Kolkata",
+			policy:    restic.ExpirePolicy{Daily: 2},
+			snapshots: []string{"2024-05-01T06:00:00Z", "2024-05-01T18:15:00Z", "2024-05-01T18:45:00Z"},
+			keep:      []string{"2024-05-01T18:45:00Z", "2024-05-01T18:15:00Z"},
+		},
+		{
+			name:      "half-hour-offset-daily-utc",
+			location:  "UTC",
+			policy:    restic.ExpirePolicy{Daily: 2},
+			snapshots: []string{"2024-05-01T06:00:00Z", "2024-05-01T18:15:00Z", "2024-05-01T18:45:00Z"},
+			keep:      []string{"2024-05-01T18:45:00Z", "2024-05-01T06:00:00Z"},
+		},
+		{
+			name:      "half-hour-offset-hourly",
+			location:  "Asia/Kolkata",
+			policy:    restic.ExpirePolicy{Hourly: 2},
+			snapshots: []string{"2024-05-01T17:00:00Z", "2024-05-01T18:20:00Z", "2024-05-01T18:40:00Z"},
+			keep:      []string{"2024-05-01T18:40:00Z", "2024-05-01T18:20:00Z"},
+		},
+		{
+			name:      "half-hour-offset-hourly-utc",
+			location:  "UTC",
+			policy:    restic.ExpirePolicy{Hourly: 2},
+			snapshots: []string{"2024-05-01T17:00:00Z", "2024-05-01T18:20:00Z", "2024-05-01T18:40:00Z"},
+			keep:      []string{"2024-05-01T18:40:00Z", "2024-05-01T17:00:00Z"},
+		},
+	}
+
+	parse := func(t *testing.T, s string) time.Time {
+		ts, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ts
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			loc, err := time.LoadLocation(test.location)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var list restic.Snapshots
+			for _, s := range test.snapshots {
+				list = append(list, &restic.Snapshot{Time: parse(t, s)})
+			}
+
+			p := test.policy
+			p.Location = loc
+			keep, _, _ := restic.ApplyPolicy(list, p)
+
+			var got []string
+			for _, sn := range keep {
+				got = append(got, sn.Time.Format(time.RFC3339))
+			}
+			if !cmp.Equal(test.keep, got) {
+				t.Error(cmp.Diff(test.keep, got))
+			}
+		})
+	}
+}
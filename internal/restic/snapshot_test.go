@@ -2,6 +2,7 @@ package restic_test
 
 import (
 	"context"
+	"encoding/json"
 	"testing"
 	"time"
 
@@ -49,3 +50,113 @@ func testLoadJSONUnpacked(t *testing.T, version uint) {
 	rtest.Equals(t, sn.Hostname, sn2.Hostname)
 	rtest.Equals(t, sn.Username, sn2.Username)
 }
+
+func TestSnapshotUnknownFields(t *testing.T) {
+	repo := repository.TestRepository(t)
+
+	data := `{"time":"2023-05-01T10:00:00Z","tree":"` + restic.NewRandomID().String() + `","paths":["/home"],` +
+		`"hostname":"foo","program_version":"restic 99.0.0","future":{"a":[1,2]},"other":"x",` +
+		`"summary":{"backup_start":"2023-05-01T10:00:00Z","backup_end":"2023-05-01T10:01:00Z","files_new":3,"files_hashed":7}}`
+	id, err := repo.SaveUnpacked(context.TODO(), restic.SnapshotFile, []byte(data))
+	rtest.OK(t, err)
+
+	sn, err := restic.LoadSnapshot(context.TODO(), repo, id)
+	rtest.OK(t, err)
+	rtest.Equals(t, []string{"future", "other", "summary.files_hashed"}, sn.UnknownFields())
+	rtest.Equals(t, "restic 99.0.0", sn.ProgramVersion)
+	rtest.Equals(t, uint(3), sn.Summary.FilesNew)
+
+	// modifying and saving the snapshot keeps the unknown fields
+	sn.AddTags([]string{"foo"})
+	id2, err := restic.SaveSnapshot(context.TODO(), repo, sn)
+	rtest.OK(t, err)
+
+	buf, err := repo.LoadUnpacked(context.TODO(), restic.SnapshotFile, id2)
+	rtest.OK(t, err)
+	var fields map[string]json.RawMessage
+	rtest.OK(t, json.Unmarshal(buf, &fields))
+	rtest.Equals(t, `{"a":[1,2]}`, string(fields["future"]))
+	rtest.Equals(t, `"x"`, string(fields["other"]))
+	rtest.Equals(t, `["foo"]`, string(fields["tags"]))
+
+	var summary map[string]json.RawMessage
+	rtest.OK(t, json.Unmarshal(fields["summary"], &summary))
+	rtest.Equals(t, "7", string(summary["files_hashed"]))
+	rtest.Equals(t, "3", string(summary["files_new"]))
+
+	sn2, err := restic.LoadSnapshot(context.TODO(), repo, id2)
+	rtest.OK(t, err)
+	rtest.Equals(t, sn.UnknownFields(), sn2.UnknownFields())
+
+	// snapshots without unknown fields are encoded as before
+	sn3 := restic.Snapshot{Hostname: "foo", Summary: &restic.SnapshotSummary{FilesNew: 1}}
+	id3, err := restic.SaveSnapshot(context.TODO(), repo, &sn3)
+	rtest.OK(t, err)
+	buf, err = repo.LoadUnpacked(context.TODO(), restic.SnapshotFile, id3)
+	rtest.OK(t, err)
+	expected, err := json.Marshal(&sn3)
+	rtest.OK(t, err)
+	rtest.Equals(t, string(expected), string(buf))
+}
+
+func TestSnapshotRewrite(t *testing.T) {
+	repo := repository.TestRepository(t)
+
+	parent := restic.NewRandomID()
+	tree := restic.NewRandomID()
+	sn := &restic.Snapshot{
+		Time:     time.Now().Add(-36 * time.Hour),
+		Parent:   &parent,
+		Tree:     &tree,
+		Paths:    []string{"/home", "/etc"},
+		Hostname: "foo",
+		Tags:     []string{"a"},
+	}
+	id, err := restic.SaveSnapshot(context.TODO(), repo, sn)
+	rtest.OK(t, err)
+	sn, err = restic.LoadSnapshot(context.TODO(), repo, id)
+	rtest.OK(t, err)
+
+	// rewrite the snapshot twice, the second time starting from the loaded
+	// result of the first rewrite
+	rewritten := sn
+	for i := 0; i < 2; i++ {
+		next := rewritten.Rewrite()
+		next.AddTags([]string{"rewrite"})
+		newTree := restic.NewRandomID()
+		next.Tree = &newTree
+
+		newID, err := restic.SaveSnapshot(context.TODO(), repo, next)
+		rtest.OK(t, err)
+		rewritten, err = restic.LoadSnapshot(context.TODO(), repo, newID)
+		rtest.OK(t, err)
+	}
+
+	rtest.Assert(t, rewritten.Original != nil && rewritten.Original.Equal(id),
+		"expected original %v, got %v", id.Str(), rewritten.Original.Str())
+	rtest.Assert(t, rewritten.Time.Equal(sn.Time), "time changed from %v to %v", sn.Time, rewritten.Time)
+	rtest.Equals(t, sn.Hostname, rewritten.Hostname)
+	rtest.Equals(t, sn.Paths, rewritten.Paths)
+	rtest.Equals(t, parent, *rewritten.Parent)
+	rtest.Equals(t, []string{"a", "rewrite"}, rewritten.Tags)
+	// the rewritten copies must not share the tags of the original
+	rtest.Equals(t, []string{"a"}, sn.Tags)
+
+	// forget policies treat the rewritten snapshot like the original
+	groupBy := restic.SnapshotGroupByOptions{Host: true, Path: true}
+	key, err := groupBy.Key(sn)
+	rtest.OK(t, err)
+	rewrittenKey, err := groupBy.Key(rewritten)
+	rtest.OK(t, err)
+	rtest.Equals(t, key, rewrittenKey)
+
+	newest := &restic.Snapshot{Time: time.Now(), Paths: sn.Paths, Hostname: sn.Hostname}
+	for _, within := range []string{"1d", "2d"} {
+		d, err := restic.ParseDuration(within)
+		rtest.OK(t, err)
+		policy := restic.ExpirePolicy{Within: d}
+		keep, _, _ := restic.ApplyPolicy(restic.Snapshots{newest, sn}, policy)
+		keepRewritten, _, _ := restic.ApplyPolicy(restic.Snapshots{newest, rewritten}, policy)
+		rtest.Equals(t, len(keep), len(keepRewritten))
+	}
+}
@@ -149,6 +149,23 @@ func SaveTree(ctx context.Context, r BlobSaver, t *Tree) (ID, error) {
 
 var ErrTreeNotOrdered = errors.New("nodes are not ordered or duplicate")
 
+// MaxTreeDepth is the maximum nesting depth of trees which is traversed. The
+// root tree has depth zero. Deeper trees are most likely damaged or crafted.
+var MaxTreeDepth = 100000
+
+// ErrTreeTooDeep is returned when traversing trees nested deeper than
+// MaxTreeDepth.
+var ErrTreeTooDeep = errors.New("trees are nested too deeply")
+
+// CheckTreeDepth returns an error wrapping ErrTreeTooDeep if depth exceeds
+// MaxTreeDepth.
+func CheckTreeDepth(depth int) error {
+	if depth > MaxTreeDepth {
+		return errors.Wrapf(ErrTreeTooDeep, "depth %d exceeds the maximum of %d", depth, MaxTreeDepth)
+	}
+	return nil
+}
+
 type TreeJSONBuilder struct {
 	buf      bytes.Buffer
 	lastName string
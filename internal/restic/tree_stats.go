@@ -0,0 +1,43 @@
+package restic
+
+// TreeStats summarizes the contents of a tree blob. It is stored in the index
+// together with the tree blob, such that the size of a directory can be
+// determined without loading all of its subtrees.
+type TreeStats struct {
+	// Entries is the number of nodes directly contained in the tree.
+	Entries uint
+	// Nodes is the number of nodes contained in the tree and all of its
+	// subtrees.
+	Nodes uint64
+	// Size is the sum of the sizes of all nodes contained in the tree and
+	// all of its subtrees.
+	Size uint64
+}
+
+// ComputeTreeStats returns the statistics of a tree consisting of nodes. The
+// statistics of subtrees are queried using lookup. If the statistics of a
+// subtree are not available or if a node is a hard link, whose size must only
+// be counted once across the whole snapshot, ok is false.
+func ComputeTreeStats(nodes []*Node, lookup func(id ID) (TreeStats, bool)) (stats TreeStats, ok bool) {
+	stats.Entries = uint(len(nodes))
+	stats.Nodes = uint64(len(nodes))
+
+	for _, node := range nodes {
+		if node.Links > 1 && node.Type != "dir" {
+			return TreeStats{}, false
+		}
+		stats.Size += node.Size
+
+		if node.Type != "dir" || node.Subtree == nil {
+			continue
+		}
+		sub, found := lookup(*node.Subtree)
+		if !found {
+			return TreeStats{}, false
+		}
+		stats.Nodes += sub.Nodes
+		stats.Size += sub.Size
+	}
+
+	return stats, true
+}
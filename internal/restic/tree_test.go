@@ -244,3 +244,32 @@ func TestFindTreeDirectory(t *testing.T) {
 	_, err := restic.FindTreeDirectory(context.TODO(), repo, nil, "")
 	rtest.Assert(t, err != nil, "missing error on null tree id")
 }
+
+func TestComputeTreeStats(t *testing.T) {
+	subtree := restic.NewRandomID()
+	known := map[restic.ID]restic.TreeStats{
+		subtree: {Entries: 2, Nodes: 3, Size: 100},
+	}
+	lookup := func(id restic.ID) (restic.TreeStats, bool) {
+		stats, ok := known[id]
+		return stats, ok
+	}
+
+	nodes := []*restic.Node{
+		{Name: "file", Type: "file", Size: 42, Links: 1},
+		{Name: "dir", Type: "dir", Subtree: &subtree, Links: 3},
+		{Name: "link", Type: "symlink", Size: 7},
+	}
+	stats, ok := restic.ComputeTreeStats(nodes, lookup)
+	rtest.Assert(t, ok, "statistics not computed")
+	rtest.Equals(t, restic.TreeStats{Entries: 3, Nodes: 6, Size: 149}, stats)
+
+	// the statistics of an unknown subtree are missing
+	unknown := restic.NewRandomID()
+	_, ok = restic.ComputeTreeStats([]*restic.Node{{Name: "dir", Type: "dir", Subtree: &unknown}}, lookup)
+	rtest.Assert(t, !ok, "statistics computed despite unknown subtree")
+
+	// hard links must only be counted once per snapshot
+	_, ok = restic.ComputeTreeStats([]*restic.Node{{Name: "file", Type: "file", Size: 42, Links: 2}}, lookup)
+	rtest.Assert(t, !ok, "statistics computed despite hard link")
+}
@@ -240,10 +240,15 @@ func (r *fileRestorer) downloadPack(ctx context.Context, pack *packInfo) error {
 	}
 
 	sanitizeError := func(file *fileInfo, err error) error {
-		if err != nil {
-			err = r.Error(file.location, err)
+		switch {
+		case err == nil:
+			return nil
+		case ctx.Err() != nil:
+			// the restore was canceled, which is not an error of the file
+			return ctx.Err()
+		default:
+			return r.Error(file.location, err)
 		}
-		return err
 	}
 
 	err := repository.StreamPack(ctx, r.packLoader, r.key, pack.id, blobList, func(h restic.BlobHandle, blobData []byte, err error) error {
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/restic/restic/internal/crypto"
@@ -316,3 +317,67 @@ func testPartialDownloadError(t *testing.T, part int) {
 	rtest.OK(t, err)
 	verifyRestore(t, r, repo)
 }
+
+// corruptBlob replaces the ciphertext of the blob with the given plaintext by
+// a valid ciphertext of the same length whose plaintext has a bit flipped.
+// Decryption of the blob thus succeeds but its hash no longer matches.
+func corruptBlob(t *testing.T, repo *TestRepo, data string) {
+	blob := repo.blobs[restic.Hash([]byte(data))][0]
+	pack := repo.packsIDToData[blob.PackID]
+
+	plaintext := []byte(data)
+	plaintext[0] ^= 0x01
+	nonce := crypto.NewRandomNonce()
+	ciphertext := repo.key.Seal(append([]byte(nil), nonce...), nonce, plaintext, nil)
+	rtest.Equals(t, int(blob.Length), len(ciphertext))
+	copy(pack[blob.Offset:], ciphertext)
+}
+
+func TestFileRestorerVerifyBlobs(t *testing.T) {
+	content := []TestFile{
+		{
+			name: "file1",
+			blobs: []TestBlob{
+				{"data1-1", "pack1"},
+				{"data1-2", "pack1"},
+			},
+		},
+		{
+			name: "file2",
+			blobs: []TestBlob{
+				{"data2-1", "pack1"},
+			},
+		},
+	}
+
+	tempdir := rtest.TempDir(t)
+	repo := newTestRepo(content)
+	corruptBlob(t, repo, "data1-2")
+
+	r := newFileRestorer(tempdir, repo.loader, repo.key, repo.Lookup, 2, false, nil)
+	r.files = repo.files
+	var failed []string
+	r.Error = func(location string, err error) error {
+		failed = append(failed, location)
+		return nil
+	}
+	rtest.OK(t, r.restoreFiles(context.TODO()))
+
+	// the corrupt blob is never written to the file
+	data, err := os.ReadFile(r.targetPath("file1"))
+	rtest.OK(t, err)
+	rtest.Equals(t, []string{"file1"}, failed)
+	rtest.Assert(t, !bytes.Contains(data, []byte("eata1-2")), "corrupt blob was written to the file: %q", data)
+
+	data, err = os.ReadFile(r.targetPath("file2"))
+	rtest.OK(t, err)
+	rtest.Equals(t, "data2-1", string(data))
+
+	// without an error handler the restore fails
+	repo = newTestRepo(content)
+	corruptBlob(t, repo, "data1-2")
+	r = newFileRestorer(rtest.TempDir(t), repo.loader, repo.key, repo.Lookup, 2, false, nil)
+	r.files = repo.files
+	err = r.restoreFiles(context.TODO())
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "wrong data returned"), "unexpected error %v", err)
+}
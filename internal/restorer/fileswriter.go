@@ -53,12 +53,12 @@ func (w *filesWriter) writeToFile(path string, blob []byte, offset int64, create
 
 		var flags int
 		if createSize >= 0 {
-			flags = os.O_CREATE | os.O_TRUNC | os.O_WRONLY
+			flags = os.O_CREATE | os.O_TRUNC | os.O_WRONLY | fs.O_NOFOLLOW
 		} else {
-			flags = os.O_WRONLY
+			flags = os.O_WRONLY | fs.O_NOFOLLOW
 		}
 
-		f, err := os.OpenFile(path, flags, 0600)
+		f, err := os.OpenFile(fs.FixPath(path), flags, 0600)
 		if err != nil {
 			return nil, err
 		}
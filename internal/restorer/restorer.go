@@ -4,8 +4,10 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync/atomic"
 
+	"github.com/restic/restic/internal/bloblru"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/fs"
@@ -20,11 +22,17 @@ type Restorer struct {
 	repo   restic.Repository
 	sn     *restic.Snapshot
 	sparse bool
+	trees  *treeLoader
 
 	progress *restoreui.Progress
 
 	Error        func(location string, err error) error
 	SelectFilter func(item string, dstpath string, node *restic.Node) (selectedForRestore bool, childMayBeSelected bool)
+
+	// RewriteSymlink, if set, returns the target of a symlink which is
+	// restored. dst is the directory the snapshot is restored to. By default,
+	// the target stored in the snapshot is used without any modification.
+	RewriteSymlink func(dst, location, linkTarget string) string
 }
 
 var restorerAbortOnAllErrors = func(location string, err error) error { return err }
@@ -35,6 +43,7 @@ func NewRestorer(repo restic.Repository, sn *restic.Snapshot, sparse bool,
 	r := &Restorer{
 		repo:         repo,
 		sparse:       sparse,
+		trees:        newTreeLoader(repo, bloblru.New(treeCacheSize), int(repo.Connections())),
 		Error:        restorerAbortOnAllErrors,
 		SelectFilter: func(string, string, *restic.Node) (bool, bool) { return true, true },
 		progress:     progress,
@@ -50,114 +59,268 @@ type treeVisitor struct {
 	leaveDir  func(node *restic.Node, target, location string) error
 }
 
+// traverseFrame is a tree which is currently traversed by traverseTree.
+type traverseFrame struct {
+	// target is the path in the file system, location within the snapshot.
+	target, location string
+	treeID           restic.ID
+	nodes            []*restic.Node
+	next             int
+	hasRestored      bool
+
+	// dir is the node referencing the tree, it is nil for the root tree.
+	dir         *restic.Node
+	dirSelected bool
+	// load is set if the nodes of the tree must be traversed.
+	load bool
+
+	// prefetched is the index of the first node which was not yet considered
+	// for prefetching, ahead the number of prefetched subtrees of dir nodes
+	// which were not traversed yet. selections holds the result of
+	// SelectFilter for the dir nodes which were considered for prefetching.
+	prefetched int
+	ahead      int
+	selections map[int]selection
+}
+
+// selection is the result of SelectFilter for a node.
+type selection struct {
+	selectedForRestore, childMayBeSelected bool
+}
+
+// prefetchWindow is the number of subtrees after the current position within
+// a tree which are prefetched. Prefetching is limited to the trees which the
+// traversal reaches soon, such that they are not evicted from the cache before
+// they are used.
+const prefetchWindow = 8
+
 // traverseTree traverses a tree from the repo and calls treeVisitor.
 // target is the path in the file system, location within the snapshot.
+// The trees which are currently traversed are kept on an explicit stack, such
+// that deeply nested trees cannot exhaust the call stack.
 func (res *Restorer) traverseTree(ctx context.Context, target, location string, treeID restic.ID, visitor treeVisitor) (hasRestored bool, err error) {
-	debug.Log("%v %v %v", target, location, treeID)
-	tree, err := restic.LoadTree(ctx, res.repo, treeID)
+	root := &traverseFrame{target: target, location: location, treeID: treeID}
+	err = res.loadTree(ctx, root)
 	if err != nil {
-		debug.Log("error loading tree %v: %v", treeID, err)
-		return hasRestored, res.Error(location, err)
+		return false, err
+	}
+	stack := []*traverseFrame{root}
+
+	// leave removes the topmost tree from the stack and finishes the dir node
+	// referencing it in the parent tree. err is the error which aborted the
+	// traversal of the topmost tree. leave returns the error which aborts the
+	// traversal.
+	leave := func(err error) error {
+		for len(stack) > 1 {
+			child := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			err = res.leaveDir(stack[len(stack)-1], child, visitor, err)
+			if err == nil {
+				return nil
+			}
+		}
+		stack = stack[:0]
+		return err
 	}
 
-	for _, node := range tree.Nodes {
+	for len(stack) > 0 {
+		if ctx.Err() != nil {
+			return root.hasRestored, ctx.Err()
+		}
 
-		// ensure that the node name does not contain anything that refers to a
-		// top-level directory.
-		nodeName := filepath.Base(filepath.Join(string(filepath.Separator), node.Name))
-		if nodeName != node.Name {
-			debug.Log("node %q has invalid name %q", node.Name, nodeName)
-			err := res.Error(location, errors.Errorf("invalid child node name %s", node.Name))
+		frame := stack[len(stack)-1]
+		if frame.next == len(frame.nodes) {
+			err = leave(nil)
 			if err != nil {
-				return hasRestored, err
+				return root.hasRestored, err
 			}
 			continue
 		}
 
-		nodeTarget := filepath.Join(target, nodeName)
-		nodeLocation := filepath.Join(location, nodeName)
-
-		if target == nodeTarget || !fs.HasPathPrefix(target, nodeTarget) {
-			debug.Log("target: %v %v", target, nodeTarget)
-			debug.Log("node %q has invalid target path %q", node.Name, nodeTarget)
-			err := res.Error(nodeLocation, errors.New("node has invalid path"))
+		child, err := res.traverseNode(frame, visitor)
+		if err == nil && child != nil {
+			stack = append(stack, child)
+			if child.load {
+				err = restic.CheckTreeDepth(len(stack) - 1)
+				if err == nil {
+					err = res.loadTree(ctx, child)
+				}
+			}
+		}
+		if err != nil {
+			err = leave(err)
 			if err != nil {
-				return hasRestored, err
+				return root.hasRestored, err
 			}
-			continue
 		}
+	}
+
+	return root.hasRestored, nil
+}
+
+// loadTree loads the nodes of the tree of frame.
+func (res *Restorer) loadTree(ctx context.Context, frame *traverseFrame) error {
+	debug.Log("%v %v %v", frame.target, frame.location, frame.treeID)
+	tree, err := res.trees.load(ctx, frame.treeID)
+	if err != nil {
+		debug.Log("error loading tree %v: %v", frame.treeID, err)
+		return res.Error(frame.location, err)
+	}
+	frame.nodes = tree.Nodes
+	res.prefetchSubtrees(frame)
+	return nil
+}
+
+// nodePath returns the target and location of node in the tree of frame.
+func nodePath(frame *traverseFrame, node *restic.Node) (nodeTarget, nodeLocation string, err error) {
+	// ensure that the node name does not contain anything that refers to a
+	// top-level directory.
+	nodeName := filepath.Base(filepath.Join(string(filepath.Separator), node.Name))
+	if nodeName != node.Name {
+		debug.Log("node %q has invalid name %q", node.Name, nodeName)
+		return "", frame.location, errors.Errorf("invalid child node name %s", node.Name)
+	}
+
+	nodeTarget = filepath.Join(frame.target, nodeName)
+	nodeLocation = filepath.Join(frame.location, nodeName)
+
+	if frame.target == nodeTarget || !fs.HasPathPrefix(frame.target, nodeTarget) {
+		debug.Log("target: %v %v", frame.target, nodeTarget)
+		debug.Log("node %q has invalid target path %q", node.Name, nodeTarget)
+		return "", nodeLocation, errors.New("node has invalid path")
+	}
+	return nodeTarget, nodeLocation, nil
+}
+
+// prefetchSubtrees requests the subtrees of the next prefetchWindow dir nodes
+// in the tree of frame to be loaded in the background. Subtrees which cannot
+// contain any selected node are skipped, as the traversal does not load them.
+func (res *Restorer) prefetchSubtrees(frame *traverseFrame) {
+	if !res.trees.prefetching() {
+		return
+	}
 
-		// sockets cannot be restored
-		if node.Type == "socket" {
+	var ids []restic.ID
+	for ; frame.prefetched < len(frame.nodes) && frame.ahead < prefetchWindow; frame.prefetched++ {
+		node := frame.nodes[frame.prefetched]
+		if node.Type != "dir" || node.Subtree == nil {
+			continue
+		}
+		nodeTarget, nodeLocation, err := nodePath(frame, node)
+		if err != nil {
+			// reported by traverseNode
 			continue
 		}
 
 		selectedForRestore, childMayBeSelected := res.SelectFilter(nodeLocation, nodeTarget, node)
-		debug.Log("SelectFilter returned %v %v for %q", selectedForRestore, childMayBeSelected, nodeLocation)
-
-		if selectedForRestore {
-			hasRestored = true
+		if frame.selections == nil {
+			frame.selections = make(map[int]selection)
 		}
-
-		sanitizeError := func(err error) error {
-			switch err {
-			case nil, context.Canceled, context.DeadlineExceeded:
-				// Context errors are permanent.
-				return err
-			default:
-				return res.Error(nodeLocation, err)
-			}
+		frame.selections[frame.prefetched] = selection{selectedForRestore, childMayBeSelected}
+		if childMayBeSelected {
+			ids = append(ids, *node.Subtree)
+			frame.ahead++
 		}
+	}
+	res.trees.prefetch(ids...)
+}
 
-		if node.Type == "dir" {
-			if node.Subtree == nil {
-				return hasRestored, errors.Errorf("Dir without subtree in tree %v", treeID.Str())
-			}
+// traverseNode visits the next node of the tree of frame. For dir nodes, the
+// frame for the subtree is returned.
+func (res *Restorer) traverseNode(frame *traverseFrame, visitor treeVisitor) (*traverseFrame, error) {
+	idx := frame.next
+	node := frame.nodes[idx]
+	frame.next++
 
-			if selectedForRestore && visitor.enterDir != nil {
-				err = sanitizeError(visitor.enterDir(node, nodeTarget, nodeLocation))
-				if err != nil {
-					return hasRestored, err
-				}
-			}
+	nodeTarget, nodeLocation, err := nodePath(frame, node)
+	if err != nil {
+		return nil, res.Error(nodeLocation, err)
+	}
 
-			// keep track of restored child status
-			// so metadata of the current directory are restored on leaveDir
-			childHasRestored := false
+	// sockets cannot be restored
+	if node.Type == "socket" {
+		return nil, nil
+	}
 
-			if childMayBeSelected {
-				childHasRestored, err = res.traverseTree(ctx, nodeTarget, nodeLocation, *node.Subtree, visitor)
-				err = sanitizeError(err)
-				if err != nil {
-					return hasRestored, err
-				}
-				// inform the parent directory to restore parent metadata on leaveDir if needed
-				if childHasRestored {
-					hasRestored = true
-				}
-			}
+	sel, ok := frame.selections[idx]
+	if ok {
+		delete(frame.selections, idx)
+		if sel.childMayBeSelected {
+			frame.ahead--
+		}
+	} else {
+		sel.selectedForRestore, sel.childMayBeSelected = res.SelectFilter(nodeLocation, nodeTarget, node)
+	}
+	selectedForRestore, childMayBeSelected := sel.selectedForRestore, sel.childMayBeSelected
+	debug.Log("SelectFilter returned %v %v for %q", selectedForRestore, childMayBeSelected, nodeLocation)
 
-			// metadata need to be restore when leaving the directory in both cases
-			// selected for restore or any child of any subtree have been restored
-			if (selectedForRestore || childHasRestored) && visitor.leaveDir != nil {
-				err = sanitizeError(visitor.leaveDir(node, nodeTarget, nodeLocation))
-				if err != nil {
-					return hasRestored, err
-				}
-			}
+	if selectedForRestore {
+		frame.hasRestored = true
+	}
 
-			continue
+	if node.Type == "dir" {
+		if node.Subtree == nil {
+			return nil, errors.Errorf("Dir without subtree in tree %v", frame.treeID.Str())
 		}
 
-		if selectedForRestore {
-			err = sanitizeError(visitor.visitNode(node, nodeTarget, nodeLocation))
+		if selectedForRestore && visitor.enterDir != nil {
+			err := res.sanitizeError(nodeLocation, visitor.enterDir(node, nodeTarget, nodeLocation))
 			if err != nil {
-				return hasRestored, err
+				return nil, err
 			}
 		}
+
+		// move the prefetch window before the subtree is loaded
+		res.prefetchSubtrees(frame)
+
+		// the subtree is only traversed if a child may be selected, but
+		// leaveDir must be called in any case
+		return &traverseFrame{
+			target:      nodeTarget,
+			location:    nodeLocation,
+			treeID:      *node.Subtree,
+			dir:         node,
+			dirSelected: selectedForRestore,
+			load:        childMayBeSelected,
+		}, nil
 	}
 
-	return hasRestored, nil
+	if selectedForRestore {
+		return nil, res.sanitizeError(nodeLocation, visitor.visitNode(node, nodeTarget, nodeLocation))
+	}
+	return nil, nil
+}
+
+// leaveDir finishes the dir node referencing the tree of child in the tree
+// of parent. err is the error which aborted the traversal of child.
+func (res *Restorer) leaveDir(parent, child *traverseFrame, visitor treeVisitor, err error) error {
+	err = res.sanitizeError(child.location, err)
+	if err != nil {
+		return err
+	}
+
+	// inform the parent directory to restore parent metadata on leaveDir if needed
+	if child.hasRestored {
+		parent.hasRestored = true
+	}
+
+	// metadata need to be restore when leaving the directory in both cases
+	// selected for restore or any child of any subtree have been restored
+	if (child.dirSelected || child.hasRestored) && visitor.leaveDir != nil {
+		return res.sanitizeError(child.location, visitor.leaveDir(child.dir, child.target, child.location))
+	}
+	return nil
+}
+
+// sanitizeError passes err for location to res.Error, except for context
+// errors which are permanent.
+func (res *Restorer) sanitizeError(location string, err error) error {
+	switch err {
+	case nil, context.Canceled, context.DeadlineExceeded:
+		return err
+	default:
+		return res.Error(location, err)
+	}
 }
 
 func (res *Restorer) restoreNodeTo(ctx context.Context, node *restic.Node, target, location string) error {
@@ -178,6 +341,15 @@ func (res *Restorer) restoreNodeTo(ctx context.Context, node *restic.Node, targe
 
 func (res *Restorer) restoreNodeMetadataTo(node *restic.Node, target, location string) error {
 	debug.Log("restoreNodeMetadata %v %v %v", node.Name, target, location)
+	// changing the mode or timestamps would follow a symlink which replaced
+	// the node, for example one restored from a crafted snapshot
+	if node.Type != "symlink" {
+		fi, err := fs.Lstat(target)
+		if err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			return errors.Errorf("refusing to restore metadata through symlink %v", target)
+		}
+	}
+
 	err := node.RestoreMetadata(target)
 	if err != nil {
 		debug.Log("node.RestoreMetadata(%s) error %v", target, err)
@@ -203,7 +375,7 @@ func (res *Restorer) restoreHardlinkAt(node *restic.Node, target, path, location
 }
 
 func (res *Restorer) restoreEmptyFileAt(node *restic.Node, target, location string) error {
-	wr, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	wr, err := fs.OpenFile(target, fs.O_CREATE|fs.O_TRUNC|fs.O_WRONLY|fs.O_NOFOLLOW, 0600)
 	if err != nil {
 		return err
 	}
@@ -219,6 +391,60 @@ func (res *Restorer) restoreEmptyFileAt(node *restic.Node, target, location stri
 	return res.restoreNodeMetadataTo(node, target, location)
 }
 
+// createDirAt creates the directory target and all missing parent directories
+// below dst with default permissions. Unlike fs.MkdirAll, existing symlinks
+// are never followed, such that a symlink below dst, for example restored
+// from a crafted snapshot, cannot redirect the restore to a location outside
+// of dst.
+func createDirAt(dst, target string) error {
+	rel, err := filepath.Rel(dst, target)
+	if err != nil {
+		return errors.Wrap(err, "Rel")
+	}
+	if rel == "." {
+		return fs.MkdirAll(dst, 0700)
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return errors.Errorf("path %v is outside of the target directory", target)
+	}
+
+	// the target directory itself may be a symlink
+	err = fs.MkdirAll(dst, 0700)
+	if err != nil {
+		return err
+	}
+
+	dir := dst
+	for _, name := range strings.Split(rel, string(filepath.Separator)) {
+		dir = filepath.Join(dir, name)
+
+		fi, err := fs.Lstat(dir)
+		if os.IsNotExist(err) {
+			err = fs.Mkdir(dir, 0700)
+			if err == nil {
+				continue
+			}
+			if !os.IsExist(err) {
+				return err
+			}
+			// the directory was created concurrently, check it again
+			fi, err = fs.Lstat(dir)
+		}
+		if err != nil {
+			return err
+		}
+
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return errors.Errorf("refusing to follow symlink %v", dir)
+		}
+		if !fi.IsDir() {
+			return errors.Errorf("%v is not a directory", dir)
+		}
+	}
+
+	return nil
+}
+
 // RestoreTo creates the directories and files in the snapshot below dst.
 // Before an item is created, res.Filter is called.
 func (res *Restorer) RestoreTo(ctx context.Context, dst string) error {
@@ -230,6 +456,11 @@ func (res *Restorer) RestoreTo(ctx context.Context, dst string) error {
 		}
 	}
 
+	// load the trees of subdirectories in the background while traversing
+	// the snapshot
+	stopPrefetch := res.trees.start(ctx)
+	defer stopPrefetch()
+
 	idx := NewHardlinkIndex()
 	filerestorer := newFileRestorer(dst, res.repo.Backend().Load, res.repo.Key(), res.repo.Index().Lookup,
 		res.repo.Connections(), res.sparse, res.progress)
@@ -246,14 +477,14 @@ func (res *Restorer) RestoreTo(ctx context.Context, dst string) error {
 			}
 			// create dir with default permissions
 			// #leaveDir restores dir metadata after visiting all children
-			return fs.MkdirAll(target, 0700)
+			return createDirAt(dst, target)
 		},
 
 		visitNode: func(node *restic.Node, target, location string) error {
 			debug.Log("first pass, visitNode: mkdir %q, leaveDir on second pass should restore metadata", location)
 			// create parent dir with default permissions
 			// second pass #leaveDir restores dir metadata after visiting/restoring all children
-			err := fs.MkdirAll(filepath.Dir(target), 0700)
+			err := createDirAt(dst, filepath.Dir(target))
 			if err != nil {
 				return err
 			}
@@ -307,6 +538,11 @@ func (res *Restorer) RestoreTo(ctx context.Context, dst string) error {
 	_, err = res.traverseTree(ctx, dst, string(filepath.Separator), *res.sn.Tree, treeVisitor{
 		visitNode: func(node *restic.Node, target, location string) error {
 			debug.Log("second pass, visitNode: restore node %q", location)
+			if node.Type == "symlink" && res.RewriteSymlink != nil {
+				rewritten := *node
+				rewritten.LinkTarget = res.RewriteSymlink(dst, location, node.LinkTarget)
+				node = &rewritten
+			}
 			if node.Type != "file" {
 				return res.restoreNodeTo(ctx, node, target, location)
 			}
@@ -341,6 +577,30 @@ func (res *Restorer) Snapshot() *restic.Snapshot {
 	return res.sn
 }
 
+// PackFiles returns the IDs of all pack files which contain data of the files
+// selected for restore. Pack files which only contain trees are not included.
+func (res *Restorer) PackFiles(ctx context.Context) (restic.IDSet, error) {
+	packs := restic.NewIDSet()
+	root := string(filepath.Separator)
+	_, err := res.traverseTree(ctx, root, root, *res.sn.Tree, treeVisitor{
+		visitNode: func(node *restic.Node, target, location string) error {
+			if node.Type != "file" {
+				return nil
+			}
+
+			for _, id := range node.Content {
+				pbs := res.repo.Index().Lookup(restic.BlobHandle{ID: id, Type: restic.DataBlob})
+				if len(pbs) == 0 {
+					return errors.Errorf("Unknown blob %s", id.String())
+				}
+				packs.Insert(pbs[0].PackID)
+			}
+			return nil
+		},
+	})
+	return packs, err
+}
+
 // Number of workers in VerifyFiles.
 const nVerifyWorkers = 8
 
@@ -385,10 +645,8 @@ func (res *Restorer) VerifyFiles(ctx context.Context, dst string) (int, error) {
 		g.Go(func() (err error) {
 			var buf []byte
 			for job := range work {
-				buf, err = res.verifyFile(job.path, job.node, buf)
-				if err != nil {
-					err = res.Error(job.path, err)
-				}
+				buf, err = res.verifyFile(ctx, job.path, job.node, buf)
+				err = res.sanitizeError(job.path, err)
 				if err != nil || ctx.Err() != nil {
 					break
 				}
@@ -406,8 +664,8 @@ func (res *Restorer) VerifyFiles(ctx context.Context, dst string) (int, error) {
 // buf and the first return value are scratch space, passed around for reuse.
 // Reusing buffers prevents the verifier goroutines allocating all of RAM and
 // flushing the filesystem cache (at least on Linux).
-func (res *Restorer) verifyFile(target string, node *restic.Node, buf []byte) ([]byte, error) {
-	f, err := os.Open(target)
+func (res *Restorer) verifyFile(ctx context.Context, target string, node *restic.Node, buf []byte) ([]byte, error) {
+	f, err := os.Open(fs.FixPath(target))
 	if err != nil {
 		return buf, err
 	}
@@ -426,6 +684,10 @@ func (res *Restorer) verifyFile(target string, node *restic.Node, buf []byte) ([
 
 	var offset int64
 	for _, blobID := range node.Content {
+		if ctx.Err() != nil {
+			return buf, ctx.Err()
+		}
+
 		length, found := res.repo.LookupBlobSize(blobID, restic.DataBlob)
 		if !found {
 			return buf, errors.Errorf("Unable to fetch blob %s", blobID)
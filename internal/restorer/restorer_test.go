@@ -3,16 +3,19 @@ package restorer
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"math"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/fs"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
@@ -40,6 +43,10 @@ type Dir struct {
 	ModTime time.Time
 }
 
+type Symlink struct {
+	Target string
+}
+
 func saveFile(t testing.TB, repo restic.Repository, node File) restic.ID {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -108,6 +115,18 @@ func saveDir(t testing.TB, repo restic.Repository, nodes map[string]Node, inode
 				Subtree: &id,
 			})
 			rtest.OK(t, err)
+		case Symlink:
+			err := tree.Insert(&restic.Node{
+				Type:       "symlink",
+				Mode:       os.ModeSymlink | 0777,
+				Name:       name,
+				UID:        uint32(os.Getuid()),
+				GID:        uint32(os.Getgid()),
+				LinkTarget: node.Target,
+				Inode:      inode,
+				Links:      1,
+			})
+			rtest.OK(t, err)
 		default:
 			t.Fatalf("unknown node type %T", node)
 		}
@@ -875,3 +894,239 @@ func TestRestorerSparseFiles(t *testing.T) {
 	t.Logf("wrote %d zeros as %d blocks, %.1f%% sparse",
 		len(zeros), blocks, 100*sparsity)
 }
+
+func TestRestorerPackFiles(t *testing.T) {
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"foo": File{Data: "content: foo\n"},
+			"dirtest": Dir{
+				Nodes: map[string]Node{
+					"file": File{Data: "content: file\n"},
+				},
+			},
+		},
+	})
+
+	lookup := func(data string) restic.ID {
+		pbs := repo.Index().Lookup(restic.BlobHandle{ID: restic.Hash([]byte(data)), Type: restic.DataBlob})
+		rtest.Assert(t, len(pbs) == 1, "blob for %q not found", data)
+		return pbs[0].PackID
+	}
+
+	res := NewRestorer(repo, sn, false, nil)
+	packs, err := res.PackFiles(context.TODO())
+	rtest.OK(t, err)
+	rtest.Equals(t, restic.NewIDSet(lookup("content: foo\n"), lookup("content: file\n")), packs)
+
+	res.SelectFilter = func(item, dstpath string, node *restic.Node) (bool, bool) {
+		return item != "/foo", true
+	}
+	packs, err = res.PackFiles(context.TODO())
+	rtest.OK(t, err)
+	rtest.Equals(t, restic.NewIDSet(lookup("content: file\n")), packs)
+}
+
+func TestRestorerDeepTree(t *testing.T) {
+	const depth = 300
+	nodes := map[string]Node{"file": File{Data: "content: file\n"}}
+	for i := 0; i < depth; i++ {
+		nodes = map[string]Node{"d": Dir{Nodes: nodes}}
+	}
+
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, Snapshot{Nodes: nodes})
+
+	old := restic.MaxTreeDepth
+	defer func() {
+		restic.MaxTreeDepth = old
+	}()
+	restic.MaxTreeDepth = depth
+
+	tempdir := rtest.TempDir(t)
+	res := NewRestorer(repo, sn, false, nil)
+	rtest.OK(t, res.RestoreTo(context.TODO(), tempdir))
+
+	filename := filepath.Join(tempdir, strings.Repeat("d"+string(filepath.Separator), depth), "file")
+	data, err := os.ReadFile(filename)
+	rtest.OK(t, err)
+	rtest.Equals(t, "content: file\n", string(data))
+
+	nverified, err := res.VerifyFiles(context.TODO(), tempdir)
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, nverified)
+
+	restic.MaxTreeDepth = depth - 1
+	res = NewRestorer(repo, sn, false, nil)
+	err = res.RestoreTo(context.TODO(), rtest.TempDir(t))
+	rtest.Assert(t, errors.Is(err, restic.ErrTreeTooDeep), "expected ErrTreeTooDeep, got %v", err)
+}
+
+// slowTreeRepository delays loading tree blobs to simulate a high-latency
+// backend.
+type slowTreeRepository struct {
+	restic.Repository
+	latency time.Duration
+}
+
+func (r slowTreeRepository) LoadBlob(ctx context.Context, t restic.BlobType, id restic.ID, buf []byte) ([]byte, error) {
+	if t == restic.TreeBlob {
+		time.Sleep(r.latency)
+	}
+	return r.Repository.LoadBlob(ctx, t, id, buf)
+}
+
+func TestRestorerPrefetchTrees(t *testing.T) {
+	repo := repository.TestRepository(t)
+
+	// a wide tree with many small directories
+	nodes := make(map[string]Node)
+	for i := 0; i < 20; i++ {
+		subdirs := make(map[string]Node)
+		for j := 0; j < 5; j++ {
+			subdirs[fmt.Sprintf("sub%d", j)] = Dir{Nodes: map[string]Node{
+				"file": File{Data: fmt.Sprintf("content %d/%d\n", i, j)},
+			}}
+		}
+		nodes[fmt.Sprintf("dir%d", i)] = Dir{Nodes: subdirs}
+	}
+	sn, _ := saveSnapshot(t, repo, Snapshot{Nodes: nodes})
+
+	slowRepo := slowTreeRepository{Repository: repo, latency: 10 * time.Millisecond}
+
+	restore := func(workers int) (string, time.Duration) {
+		res := NewRestorer(slowRepo, sn, false, nil)
+		res.trees.workers = workers
+
+		target := filepath.Join(rtest.TempDir(t), "target")
+		start := time.Now()
+		rtest.OK(t, res.RestoreTo(context.TODO(), target))
+		return target, time.Since(start)
+	}
+
+	sequentialTarget, sequential := restore(0)
+	prefetchTarget, prefetch := restore(8)
+	t.Logf("restore took %v without prefetching, %v with prefetching", sequential, prefetch)
+	rtest.Assert(t, prefetch < sequential, "prefetching trees did not speed up the restore: %v >= %v", prefetch, sequential)
+
+	for i := 0; i < 20; i++ {
+		for j := 0; j < 5; j++ {
+			name := filepath.Join(fmt.Sprintf("dir%d", i), fmt.Sprintf("sub%d", j), "file")
+			want := fmt.Sprintf("content %d/%d\n", i, j)
+			for _, target := range []string{sequentialTarget, prefetchTarget} {
+				data, err := os.ReadFile(filepath.Join(target, name))
+				rtest.OK(t, err)
+				rtest.Equals(t, want, string(data))
+			}
+		}
+	}
+}
+
+// recordingTreeRepository records which tree blobs were loaded.
+type recordingTreeRepository struct {
+	restic.Repository
+	m     sync.Mutex
+	trees restic.IDSet
+}
+
+func (r *recordingTreeRepository) LoadBlob(ctx context.Context, t restic.BlobType, id restic.ID, buf []byte) ([]byte, error) {
+	if t == restic.TreeBlob {
+		r.m.Lock()
+		r.trees.Insert(id)
+		r.m.Unlock()
+	}
+	return r.Repository.LoadBlob(ctx, t, id, buf)
+}
+
+func TestRestorerPrefetchSelectedTrees(t *testing.T) {
+	repo := repository.TestRepository(t)
+
+	nodes := make(map[string]Node)
+	for i := 0; i < 20; i++ {
+		nodes[fmt.Sprintf("dir%02d", i)] = Dir{Nodes: map[string]Node{
+			"sub": Dir{Nodes: map[string]Node{
+				"file": File{Data: fmt.Sprintf("content %d\n", i)},
+			}},
+		}}
+	}
+	sn, _ := saveSnapshot(t, repo, Snapshot{Nodes: nodes})
+
+	recRepo := &recordingTreeRepository{Repository: repo, trees: restic.NewIDSet()}
+	res := NewRestorer(recRepo, sn, false, nil)
+	res.SelectFilter = func(item, dstpath string, node *restic.Node) (bool, bool) {
+		// only restore dir05
+		item = filepath.ToSlash(item)
+		selected := item == "/dir05" || strings.HasPrefix(item, "/dir05/")
+		return selected, selected
+	}
+	tempdir := rtest.TempDir(t)
+	rtest.OK(t, res.RestoreTo(context.TODO(), tempdir))
+
+	data, err := os.ReadFile(filepath.Join(tempdir, "dir05", "sub", "file"))
+	rtest.OK(t, err)
+	rtest.Equals(t, "content 5\n", string(data))
+
+	// the trees of directories which are not selected are neither traversed
+	// nor prefetched
+	tree, err := restic.LoadTree(context.TODO(), repo, *sn.Tree)
+	rtest.OK(t, err)
+	for _, node := range tree.Nodes {
+		if node.Name != "dir05" {
+			rtest.Assert(t, !recRepo.trees.Has(*node.Subtree), "tree of %v was loaded", node.Name)
+		}
+	}
+}
+
+// blockingDataBackend blocks loading data blobs until the context of the
+// request is canceled. blocked is closed once the first request blocks.
+type blockingDataBackend struct {
+	restic.Backend
+	once    sync.Once
+	blocked chan struct{}
+}
+
+func (be *blockingDataBackend) Load(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+	if h.Type != restic.PackFile || h.ContainedBlobType != restic.DataBlob {
+		return be.Backend.Load(ctx, h, length, offset, fn)
+	}
+	be.once.Do(func() { close(be.blocked) })
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestRestorerCancel(t *testing.T) {
+	be := &blockingDataBackend{Backend: repository.TestBackend(t), blocked: make(chan struct{})}
+	repo := repository.TestRepositoryWithBackend(t, be, 0)
+	nodes := make(map[string]Node)
+	for i := 0; i < 20; i++ {
+		nodes[fmt.Sprintf("file%02d", i)] = File{Data: fmt.Sprintf("content of file %d\n", i)}
+	}
+	sn, _ := saveSnapshot(t, repo, Snapshot{Nodes: nodes})
+
+	res := NewRestorer(repo, sn, false, nil)
+	var errs []error
+	res.Error = func(location string, err error) error {
+		// ignore errors as in the `restore` command
+		errs = append(errs, err)
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- res.RestoreTo(ctx, rtest.TempDir(t))
+	}()
+
+	<-be.blocked
+	cancel()
+
+	select {
+	case err := <-done:
+		rtest.Assert(t, errors.Is(err, context.Canceled), "unexpected error %v", err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("restore did not return after the context was canceled")
+	}
+	// the cancellation is not reported as an error of the restored files
+	rtest.Equals(t, 0, len(errs))
+}
@@ -7,6 +7,7 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"sort"
 	"syscall"
 	"testing"
 	"time"
@@ -14,7 +15,9 @@ import (
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
+	"github.com/restic/restic/internal/ui"
 	restoreui "github.com/restic/restic/internal/ui/restore"
+	"golang.org/x/sync/errgroup"
 )
 
 func TestRestorerRestoreEmptyHardlinkedFileds(t *testing.T) {
@@ -75,7 +78,7 @@ type printerMock struct {
 
 func (p *printerMock) Update(_, _, _, _ uint64, _ time.Duration) {
 }
-func (p *printerMock) Finish(filesFinished, filesTotal, allBytesWritten, allBytesTotal uint64, _ time.Duration) {
+func (p *printerMock) Finish(filesFinished, filesTotal, allBytesWritten, allBytesTotal uint64, _ time.Duration, _ []ui.WarningSummary, _ *ui.TransferStats) {
 	p.filesFinished = filesFinished
 	p.filesTotal = filesTotal
 	p.allBytesWritten = allBytesWritten
@@ -121,3 +124,207 @@ func TestRestorerProgressBar(t *testing.T) {
 	rtest.Assert(t, mock.allBytesWritten == allBytesWritten, "allBytesWritten: expected %v, got %v", allBytesWritten, mock.allBytesWritten)
 	rtest.Assert(t, mock.allBytesTotal == allBytesTotal, "allBytesTotal: expected %v, got %v", allBytesTotal, mock.allBytesTotal)
 }
+
+// restoreCollectErrors restores sn to dst and returns the errors reported
+// for each location.
+func restoreCollectErrors(t *testing.T, repo restic.Repository, sn *restic.Snapshot, dst string) map[string]string {
+	res := NewRestorer(repo, sn, false, nil)
+	errs := make(map[string]string)
+	res.Error = func(location string, err error) error {
+		t.Logf("restore returned error for %q: %v", location, err)
+		errs[filepath.ToSlash(location)] = err.Error()
+		return nil
+	}
+
+	rtest.OK(t, res.RestoreTo(context.TODO(), dst))
+	return errs
+}
+
+func assertEmptyDir(t *testing.T, dir string) {
+	entries, err := os.ReadDir(dir)
+	rtest.OK(t, err)
+	for _, entry := range entries {
+		t.Errorf("unexpected entry %v written to %v", entry.Name(), dir)
+	}
+}
+
+func TestRestorerSymlinkParentDir(t *testing.T) {
+	repo := repository.TestRepository(t)
+	outside := rtest.TempDir(t)
+	tempdir := filepath.Join(rtest.TempDir(t), "target")
+
+	// the first snapshot places a symlink to a directory outside of the target
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"x": Symlink{Target: outside},
+		},
+	})
+	rtest.Equals(t, 0, len(restoreCollectErrors(t, repo, sn, tempdir)))
+
+	// the second snapshot must not write through the existing symlink
+	sn, _ = saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"x": Dir{
+				Nodes: map[string]Node{
+					"file": File{Data: "content"},
+				},
+			},
+			"y": File{Data: "other content"},
+		},
+	})
+	errs := restoreCollectErrors(t, repo, sn, tempdir)
+	rtest.Assert(t, errs["/x"] != "", "missing error for /x, got %v", errs)
+
+	assertEmptyDir(t, outside)
+	data, err := os.ReadFile(filepath.Join(tempdir, "y"))
+	rtest.OK(t, err)
+	rtest.Equals(t, "other content", string(data))
+}
+
+func TestRestorerSymlinkDuplicateName(t *testing.T) {
+	for _, subtree := range []map[string]Node{
+		{"file": File{Data: "content"}},
+		{},
+	} {
+		repo := repository.TestRepository(t)
+		outside := rtest.TempDir(t)
+		tempdir := filepath.Join(rtest.TempDir(t), "target")
+
+		fi, err := os.Stat(outside)
+		rtest.OK(t, err)
+		outsideMode := fi.Mode()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		wg, wgCtx := errgroup.WithContext(ctx)
+		repo.StartPackUploader(wgCtx, wg)
+
+		// a crafted tree which contains a symlink and a directory of the same
+		// name, which cannot be created using tree.Insert
+		subtreeID := saveDir(t, repo, subtree, 2000)
+		tree := &restic.Tree{Nodes: []*restic.Node{
+			{Name: "x", Type: "symlink", Mode: os.ModeSymlink | 0777, LinkTarget: outside},
+			{Name: "x", Type: "dir", Mode: os.ModeDir | 0777, Subtree: &subtreeID},
+		}}
+		treeID, err := restic.SaveTree(ctx, repo, tree)
+		rtest.OK(t, err)
+		rtest.OK(t, repo.Flush(ctx))
+
+		sn, err := restic.NewSnapshot([]string{"test"}, nil, "", time.Now())
+		rtest.OK(t, err)
+		sn.Tree = &treeID
+
+		restoreCollectErrors(t, repo, sn, tempdir)
+		assertEmptyDir(t, outside)
+
+		fi, err = os.Stat(outside)
+		rtest.OK(t, err)
+		rtest.Equals(t, outsideMode, fi.Mode())
+	}
+}
+
+func TestRestorerSymlinkFile(t *testing.T) {
+	repo := repository.TestRepository(t)
+	outside := rtest.TempDir(t)
+	tempdir := rtest.TempDir(t)
+
+	for _, name := range []string{"file", "empty"} {
+		victim := filepath.Join(outside, name)
+		rtest.OK(t, os.WriteFile(victim, []byte("keep"), 0600))
+		rtest.OK(t, os.Symlink(victim, filepath.Join(tempdir, name)))
+	}
+
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"file":  File{Data: "content"},
+			"empty": File{},
+		},
+	})
+	errs := restoreCollectErrors(t, repo, sn, tempdir)
+	rtest.Equals(t, 2, len(errs))
+
+	for _, name := range []string{"file", "empty"} {
+		data, err := os.ReadFile(filepath.Join(outside, name))
+		rtest.OK(t, err)
+		rtest.Equals(t, "keep", string(data))
+	}
+}
+
+// symlinkTargets contains link targets which must be restored byte-exactly.
+var symlinkTargets = map[string]string{
+	"trailing-slash": "dir/",
+	"parent":         "../x/",
+	"double-slash":   "a//b",
+	"dot":            "./",
+	"invalid-utf8":   string([]byte{'x', 0xff, 0xfe, '/'}),
+	"spaces":         " a b ",
+	"backslash":      `a\b`,
+	"absolute":       "/data/dir//file/",
+}
+
+func TestRestorerSymlinkTargets(t *testing.T) {
+	repo := repository.TestRepository(t)
+	tempdir := rtest.TempDir(t)
+
+	nodes := make(map[string]Node)
+	for name, target := range symlinkTargets {
+		nodes[name] = Symlink{Target: target}
+	}
+	sn, _ := saveSnapshot(t, repo, Snapshot{Nodes: nodes})
+	rtest.Equals(t, map[string]string{}, restoreCollectErrors(t, repo, sn, tempdir))
+
+	for name, target := range symlinkTargets {
+		link, err := os.Readlink(filepath.Join(tempdir, name))
+		rtest.OK(t, err)
+		rtest.Equals(t, target, link)
+	}
+}
+
+func TestRestorerRewriteSymlinks(t *testing.T) {
+	repo := repository.TestRepository(t)
+	tempdir := rtest.TempDir(t)
+
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"data": Dir{
+				Nodes: map[string]Node{
+					"file":     File{Data: "content"},
+					"internal": Symlink{Target: "/data/file"},
+					"dir":      Symlink{Target: "/data/sub//"},
+					"root":     Symlink{Target: "/data"},
+					"relative": Symlink{Target: "file"},
+					"external": Symlink{Target: "/etc/passwd"},
+					"prefix":   Symlink{Target: "/database"},
+				},
+			},
+		},
+	})
+	sn.Paths = []string{"/data"}
+
+	var outside []string
+	res := NewRestorer(repo, sn, false, nil)
+	res.RewriteSymlink = RewriteAbsoluteToTarget(sn.Paths, "", func(location, linkTarget string) {
+		outside = append(outside, filepath.ToSlash(location)+" -> "+linkTarget)
+	})
+	rtest.OK(t, res.RestoreTo(context.TODO(), tempdir))
+
+	for name, target := range map[string]string{
+		"internal": filepath.Join(tempdir, "data", "file"),
+		"dir":      filepath.Join(tempdir, "data", "sub") + "/",
+		"root":     filepath.Join(tempdir, "data"),
+		"relative": "file",
+		"external": "/etc/passwd",
+		"prefix":   "/database",
+	} {
+		link, err := os.Readlink(filepath.Join(tempdir, "data", name))
+		rtest.OK(t, err)
+		rtest.Equals(t, target, link)
+	}
+
+	data, err := os.ReadFile(filepath.Join(tempdir, "data", "internal"))
+	rtest.OK(t, err)
+	rtest.Equals(t, "content", string(data))
+
+	sort.Strings(outside)
+	rtest.Equals(t, []string{"/data/external -> /etc/passwd", "/data/prefix -> /database"}, outside)
+}
@@ -0,0 +1,57 @@
+package restorer
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// RewriteAbsoluteToTarget returns a function for Restorer.RewriteSymlink which
+// rewrites absolute symlink targets pointing into paths, the paths which were
+// backed up in the snapshot, such that they point into the directory the
+// snapshot is restored to. subfolder is the directory of the snapshot which is
+// restored, it is empty if the whole snapshot is restored. For absolute
+// targets outside of the restored paths outside is called, if it is not nil,
+// and the target is left unchanged. Relative targets are never changed.
+func RewriteAbsoluteToTarget(paths []string, subfolder string, outside func(location, linkTarget string)) func(dst, location, linkTarget string) string {
+	root := path.Join("/", subfolder)
+
+	return func(dst, location, linkTarget string) string {
+		if !path.IsAbs(linkTarget) {
+			return linkTarget
+		}
+
+		p := path.Clean(linkTarget)
+		if !pathWithin(p, root) || !pathWithinAny(p, paths) {
+			if outside != nil {
+				outside(location, linkTarget)
+			}
+			return linkTarget
+		}
+
+		target := filepath.Join(dst, filepath.FromSlash(strings.TrimPrefix(p, root)))
+		// keep a trailing slash, it requires the target to be a directory
+		if strings.HasSuffix(linkTarget, "/") && !strings.HasSuffix(target, string(filepath.Separator)) {
+			target += string(filepath.Separator)
+		}
+		return target
+	}
+}
+
+// pathWithin returns true if p is dir or located below it. Both paths must be
+// clean.
+func pathWithin(p, dir string) bool {
+	if dir == "/" || p == dir {
+		return true
+	}
+	return strings.HasPrefix(p, dir+"/")
+}
+
+func pathWithinAny(p string, dirs []string) bool {
+	for _, dir := range dirs {
+		if path.IsAbs(dir) && pathWithin(p, path.Clean(dir)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package restorer
+
+import (
+	"path/filepath"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestRewriteAbsoluteToTarget(t *testing.T) {
+	dst := filepath.FromSlash("/mnt/recovery")
+	for _, tc := range []struct {
+		paths     []string
+		subfolder string
+		target    string
+		want      string
+		outside   bool
+	}{
+		{[]string{"/"}, "", "/etc/passwd", "/mnt/recovery/etc/passwd", false},
+		{[]string{"/"}, "", "/", "/mnt/recovery/", false},
+		{[]string{"/home", "/srv"}, "", "/srv/www/", "/mnt/recovery/srv/www/", false},
+		{[]string{"/home", "/srv"}, "", "/srv/../etc", "/srv/../etc", true},
+		{[]string{"/home", "/srv"}, "", "/home2/x", "/home2/x", true},
+		{[]string{"/home", "/srv"}, "", "../srv/www", "../srv/www", false},
+		{[]string{"relative"}, "", "/relative/x", "/relative/x", true},
+		{[]string{"/home"}, "/home/user", "/home/user/file", "/mnt/recovery/file", false},
+		{[]string{"/home"}, "home/user/", "/home/user", "/mnt/recovery", false},
+		{[]string{"/home"}, "/home/user", "/home/other/file", "/home/other/file", true},
+	} {
+		var outside bool
+		rewrite := RewriteAbsoluteToTarget(tc.paths, tc.subfolder, func(location, linkTarget string) {
+			rtest.Equals(t, "/link", location)
+			rtest.Equals(t, tc.target, linkTarget)
+			outside = true
+		})
+
+		got := rewrite(dst, "/link", tc.target)
+		want := tc.want
+		if want != tc.target {
+			want = filepath.FromSlash(want)
+		}
+		rtest.Equals(t, want, got)
+		rtest.Equals(t, tc.outside, outside)
+	}
+}
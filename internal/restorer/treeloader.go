@@ -0,0 +1,196 @@
+package restorer
+
+import (
+	"context"
+	"sync"
+
+	"github.com/restic/restic/internal/bloblru"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/restic"
+)
+
+// treeCacheSize is the memory budget for tree blobs which have been
+// prefetched or are kept for the second pass over the snapshot.
+const treeCacheSize = 32 << 20
+
+// maxPrefetchQueue limits the number of tree blobs waiting to be prefetched.
+// If more trees are requested, the oldest requests are dropped, the trees are
+// then loaded on demand.
+const maxPrefetchQueue = 256
+
+// treeLoader loads tree blobs for the traversal of a snapshot. While
+// prefetching is active, the trees requested via prefetch are fetched in the
+// background, so that the traversal does not have to wait for each tree
+// blob separately.
+type treeLoader struct {
+	repo    restic.BlobLoader
+	cache   *bloblru.Cache
+	workers int
+
+	m       sync.Mutex
+	cond    *sync.Cond
+	loading map[restic.ID]chan struct{}
+	active  bool
+	// queue is used as a stack, the trees requested last are closest to the
+	// current position of the depth-first traversal.
+	queue []restic.ID
+}
+
+func newTreeLoader(repo restic.BlobLoader, cache *bloblru.Cache, workers int) *treeLoader {
+	l := &treeLoader{
+		repo:    repo,
+		cache:   cache,
+		workers: workers,
+		loading: make(map[restic.ID]chan struct{}),
+	}
+	l.cond = sync.NewCond(&l.m)
+	return l
+}
+
+// LoadBlob returns the tree blob from the cache. If it is currently being
+// prefetched, LoadBlob waits for it. Otherwise, the blob is loaded from the
+// repository and added to the cache.
+func (l *treeLoader) LoadBlob(ctx context.Context, t restic.BlobType, id restic.ID, buf []byte) ([]byte, error) {
+	l.m.Lock()
+	ch, ok := l.loading[id]
+	l.m.Unlock()
+
+	if ok {
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	if blob, ok := l.cache.Get(id); ok {
+		return blob, nil
+	}
+
+	blob, err := l.repo.LoadBlob(ctx, t, id, buf)
+	if err != nil {
+		return nil, err
+	}
+	l.cache.Add(id, blob)
+	return blob, nil
+}
+
+// load returns the tree with the given id.
+func (l *treeLoader) load(ctx context.Context, id restic.ID) (*restic.Tree, error) {
+	return restic.LoadTree(ctx, l, id)
+}
+
+// prefetching returns whether trees requested via prefetch are loaded.
+func (l *treeLoader) prefetching() bool {
+	l.m.Lock()
+	defer l.m.Unlock()
+	return l.active
+}
+
+// prefetch requests the trees to be loaded in the background, in order. It
+// does nothing unless prefetching has been started.
+func (l *treeLoader) prefetch(ids ...restic.ID) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	if !l.active || len(ids) == 0 {
+		return
+	}
+
+	// add the trees backwards to load them in order
+	for i := len(ids) - 1; i >= 0; i-- {
+		l.queue = append(l.queue, ids[i])
+	}
+	if len(l.queue) > maxPrefetchQueue {
+		debug.Log("prefetch queue is full, dropping %d trees", len(l.queue)-maxPrefetchQueue)
+		l.queue = append(l.queue[:0], l.queue[len(l.queue)-maxPrefetchQueue:]...)
+	}
+	l.cond.Broadcast()
+}
+
+// next returns the next tree to prefetch. It blocks until a tree is
+// requested and returns false once prefetching was stopped.
+func (l *treeLoader) next() (restic.ID, bool) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	for l.active && len(l.queue) == 0 {
+		l.cond.Wait()
+	}
+	if !l.active {
+		return restic.ID{}, false
+	}
+
+	id := l.queue[len(l.queue)-1]
+	l.queue = l.queue[:len(l.queue)-1]
+	return id, true
+}
+
+// start runs the workers which prefetch trees until the returned function
+// is called.
+func (l *treeLoader) start(ctx context.Context) (stop func()) {
+	if l.workers <= 0 {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	l.m.Lock()
+	l.active = true
+	l.m.Unlock()
+
+	var wg sync.WaitGroup
+	for i := 0; i < l.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				id, ok := l.next()
+				if !ok {
+					return
+				}
+				l.fetch(ctx, id)
+			}
+		}()
+	}
+
+	return func() {
+		l.m.Lock()
+		l.active = false
+		l.queue = nil
+		l.cond.Broadcast()
+		l.m.Unlock()
+
+		cancel()
+		wg.Wait()
+	}
+}
+
+// fetch loads the tree blob id into the cache. Errors are ignored, the
+// traversal reports them when it loads the tree itself.
+func (l *treeLoader) fetch(ctx context.Context, id restic.ID) {
+	l.m.Lock()
+	if _, ok := l.loading[id]; ok {
+		l.m.Unlock()
+		return
+	}
+	if _, ok := l.cache.Get(id); ok {
+		l.m.Unlock()
+		return
+	}
+	ch := make(chan struct{})
+	l.loading[id] = ch
+	l.m.Unlock()
+
+	blob, err := l.repo.LoadBlob(ctx, restic.TreeBlob, id, nil)
+	if err != nil {
+		debug.Log("prefetching tree %v failed: %v", id.Str(), err)
+	} else {
+		l.cache.Add(id, blob)
+	}
+
+	l.m.Lock()
+	delete(l.loading, id)
+	l.m.Unlock()
+	close(ch)
+}
@@ -106,17 +106,60 @@ func extractToFile(buf []byte, filename, target string, printf func(string, ...i
 	return os.Chmod(target, mode)
 }
 
+// Channels which can be selected in DownloadOptions.
+const (
+	ChannelStable = "stable"
+	ChannelBeta   = "beta"
+)
+
+// ErrDowngrade is returned by DownloadRelease if the selected release is older
+// than the current version and DownloadOptions.AllowDowngrade is not set.
+var ErrDowngrade = errors.New("refusing to downgrade")
+
+// DownloadOptions select the release installed by DownloadRelease.
+type DownloadOptions struct {
+	// Version selects a specific release, e.g. "0.15.1". If it is empty, the
+	// latest release of Channel is used.
+	Version string
+	// Channel is either ChannelStable for the latest release or ChannelBeta
+	// for the latest pre-release. The default is ChannelStable.
+	Channel string
+	// AllowDowngrade permits installing a release older than the current
+	// version.
+	AllowDowngrade bool
+}
+
 // DownloadLatestStableRelease downloads the latest stable released version of
 // restic and saves it to target. It returns the version string for the newest
 // version. The function printf is used to print progress information.
 func DownloadLatestStableRelease(ctx context.Context, target, currentVersion string, printf func(string, ...interface{})) (version string, err error) {
+	return DownloadRelease(ctx, target, currentVersion, DownloadOptions{}, printf)
+}
+
+// DownloadRelease downloads the release of restic selected by opts and saves
+// it to target. The file SHA256SUMS is only trusted after its GPG signature
+// was verified, afterwards the hash of the downloaded binary is checked. It
+// returns the version string of the release. The function printf is used to
+// print progress information.
+func DownloadRelease(ctx context.Context, target, currentVersion string, opts DownloadOptions, printf func(string, ...interface{})) (version string, err error) {
 	if printf == nil {
 		printf = func(string, ...interface{}) {}
 	}
 
-	printf("find latest release of restic at GitHub\n")
-
-	rel, err := GitHubLatestRelease(ctx, "restic", "restic")
+	var rel Release
+	switch {
+	case opts.Version != "":
+		printf("find release %v of restic at GitHub\n", opts.Version)
+		rel, err = GitHubReleaseByVersion(ctx, "restic", "restic", opts.Version)
+	case opts.Channel == ChannelBeta:
+		printf("find latest pre-release of restic at GitHub\n")
+		rel, err = GitHubLatestPreRelease(ctx, "restic", "restic")
+	case opts.Channel == "" || opts.Channel == ChannelStable:
+		printf("find latest release of restic at GitHub\n")
+		rel, err = GitHubLatestRelease(ctx, "restic", "restic")
+	default:
+		return "", errors.Errorf("invalid channel %q", opts.Channel)
+	}
 	if err != nil {
 		return "", err
 	}
@@ -126,7 +169,15 @@ func DownloadLatestStableRelease(ctx context.Context, target, currentVersion str
 		return currentVersion, nil
 	}
 
-	printf("latest version is %v\n", rel.Version)
+	if CompareVersions(rel.Version, currentVersion) < 0 && !opts.AllowDowngrade {
+		return "", errors.Wrapf(ErrDowngrade, "version %v is older than the current version %v", rel.Version, currentVersion)
+	}
+
+	if opts.Version != "" {
+		printf("selected version is %v\n", rel.Version)
+	} else {
+		printf("latest version is %v\n", rel.Version)
+	}
 
 	_, sha256sums, err := getGithubDataFile(ctx, rel.Assets, "SHA256SUMS", printf)
 	if err != nil {
@@ -140,7 +191,7 @@ func DownloadLatestStableRelease(ctx context.Context, target, currentVersion str
 
 	ok, err := GPGVerify(sha256sums, sig)
 	if err != nil {
-		return "", err
+		return "", errors.Wrap(err, "GPG signature verification of the file SHA256SUMS failed")
 	}
 
 	if !ok {
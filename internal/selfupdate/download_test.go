@@ -3,11 +3,23 @@ package selfupdate
 import (
 	"archive/zip"
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 
+	"github.com/pkg/errors"
 	rtest "github.com/restic/restic/internal/test"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
 )
 
 func TestExtractToFileZip(t *testing.T) {
@@ -42,3 +54,226 @@ func TestExtractToFileZip(t *testing.T) {
 		rtest.OK(t, os.WriteFile(outfn, []byte{1, 2, 3}, 0))
 	}
 }
+
+// testBinary is the content of the restic binary in the test releases.
+var testBinary = []byte("restic 0.15.1\n")
+
+// testBinaryBz2 is testBinary compressed with bzip2, the standard library
+// has no bzip2 compressor.
+var testBinaryBz2 = []byte{
+	0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0x4e, 0x8b,
+	0x14, 0xb1, 0x00, 0x00, 0x05, 0xd9, 0x80, 0x00, 0x10, 0x40, 0x01, 0x62,
+	0x00, 0x0a, 0x20, 0x1c, 0x00, 0x20, 0x00, 0x31, 0x03, 0x40, 0xd0, 0x20,
+	0x0d, 0x1a, 0x12, 0x00, 0xa0, 0x95, 0x87, 0x8e, 0xf7, 0x8b, 0xb9, 0x22,
+	0x9c, 0x28, 0x48, 0x27, 0x45, 0x8a, 0x58, 0x80,
+}
+
+// testArchive returns the name and content of the release file for the
+// current platform.
+func testArchive(t *testing.T, version string) (string, []byte) {
+	if runtime.GOOS != "windows" {
+		return fmt.Sprintf("restic_%s_%s_%s.bz2", version, runtime.GOOS, runtime.GOARCH), testBinaryBz2
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("restic.exe")
+	rtest.OK(t, err)
+	_, err = w.Write(testBinary)
+	rtest.OK(t, err)
+	rtest.OK(t, zw.Close())
+
+	return fmt.Sprintf("restic_%s_%s_%s.zip", version, runtime.GOOS, runtime.GOARCH), buf.Bytes()
+}
+
+// newTestEntity returns a new GPG key, if trusted is set the key replaces the
+// built-in key for the duration of the test.
+func newTestEntity(t *testing.T, trusted bool) *openpgp.Entity {
+	entity, err := openpgp.NewEntity("test", "", "test@example.com", &packet.Config{RSABits: 1024})
+	rtest.OK(t, err)
+
+	if trusted {
+		var buf bytes.Buffer
+		w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+		rtest.OK(t, err)
+		rtest.OK(t, entity.Serialize(w))
+		rtest.OK(t, w.Close())
+
+		oldKey := key
+		key = buf.Bytes()
+		t.Cleanup(func() { key = oldKey })
+	}
+
+	return entity
+}
+
+// testReleaseServer serves releases and their files via an API compatible
+// with GitHub.
+type testReleaseServer struct {
+	releases []Release
+	files    map[string][]byte
+	srv      *httptest.Server
+}
+
+func newTestReleaseServer(t *testing.T) *testReleaseServer {
+	s := &testReleaseServer{files: make(map[string][]byte)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/restic/restic/releases", func(w http.ResponseWriter, r *http.Request) {
+		s.writeJSON(t, w, s.releases)
+	})
+	mux.HandleFunc("/repos/restic/restic/releases/", func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/repos/restic/restic/releases/")
+		for _, rel := range s.releases {
+			if (name == "latest" && !rel.PreRelease) || name == "tags/"+rel.TagName {
+				s.writeJSON(t, w, rel)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("/download/", func(w http.ResponseWriter, r *http.Request) {
+		data, ok := s.files[strings.TrimPrefix(r.URL.Path, "/download/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(data)
+	})
+
+	s.srv = httptest.NewServer(mux)
+	t.Cleanup(s.srv.Close)
+
+	oldURL := githubAPIURL
+	githubAPIURL = s.srv.URL
+	t.Cleanup(func() { githubAPIURL = oldURL })
+
+	return s
+}
+
+func (s *testReleaseServer) writeJSON(t *testing.T, w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	rtest.OK(t, json.NewEncoder(w).Encode(data))
+}
+
+// addRelease adds a release signed by signer. The function modify can change
+// the files before they are served.
+func (s *testReleaseServer) addRelease(t *testing.T, version string, prerelease bool, signer *openpgp.Entity, modify func(files map[string][]byte)) {
+	filename, archive := testArchive(t, version)
+	hash := sha256.Sum256(archive)
+	sums := []byte(fmt.Sprintf("%x  %s\n", hash, filename))
+
+	var sig bytes.Buffer
+	rtest.OK(t, openpgp.ArmoredDetachSign(&sig, signer, bytes.NewReader(sums), nil))
+
+	files := map[string][]byte{
+		filename:         archive,
+		"SHA256SUMS":     sums,
+		"SHA256SUMS.asc": sig.Bytes(),
+	}
+	if modify != nil {
+		modify(files)
+	}
+
+	rel := Release{
+		TagName:    "v" + version,
+		PreRelease: prerelease,
+	}
+	for name, data := range files {
+		s.files[version+"/"+name] = data
+		rel.Assets = append(rel.Assets, Asset{
+			Name: name,
+			URL:  s.srv.URL + "/download/" + version + "/" + name,
+		})
+	}
+
+	// keep newest release first, like GitHub
+	s.releases = append([]Release{rel}, s.releases...)
+}
+
+func TestDownloadReleasePinned(t *testing.T) {
+	signer := newTestEntity(t, true)
+	srv := newTestReleaseServer(t)
+	srv.addRelease(t, "0.15.1", false, signer, nil)
+	srv.addRelease(t, "0.16.0", false, signer, nil)
+
+	target := filepath.Join(t.TempDir(), "restic")
+
+	// installing an older version requires AllowDowngrade
+	_, err := DownloadRelease(context.TODO(), target, "0.16.0", DownloadOptions{Version: "0.15.1"}, nil)
+	rtest.Assert(t, errors.Is(err, ErrDowngrade), "expected ErrDowngrade, got %v", err)
+	_, err = os.Stat(target)
+	rtest.Assert(t, errors.Is(err, os.ErrNotExist), "target was written: %v", err)
+
+	v, err := DownloadRelease(context.TODO(), target, "0.16.0", DownloadOptions{Version: "0.15.1", AllowDowngrade: true}, nil)
+	rtest.OK(t, err)
+	rtest.Equals(t, "0.15.1", v)
+
+	data, err := os.ReadFile(target)
+	rtest.OK(t, err)
+	rtest.Equals(t, testBinary, data)
+
+	_, err = DownloadRelease(context.TODO(), target, "0.16.0", DownloadOptions{Version: "0.14.0", AllowDowngrade: true}, nil)
+	rtest.Assert(t, err != nil, "missing error for unknown version")
+}
+
+func TestDownloadReleaseChannel(t *testing.T) {
+	signer := newTestEntity(t, true)
+	srv := newTestReleaseServer(t)
+	srv.addRelease(t, "0.15.1", false, signer, nil)
+	srv.addRelease(t, "0.16.0-rc1", true, signer, nil)
+
+	target := filepath.Join(t.TempDir(), "restic")
+
+	v, err := DownloadRelease(context.TODO(), target, "0.15.0", DownloadOptions{Channel: ChannelStable}, nil)
+	rtest.OK(t, err)
+	rtest.Equals(t, "0.15.1", v)
+
+	v, err = DownloadRelease(context.TODO(), target, "0.15.1", DownloadOptions{Channel: ChannelBeta}, nil)
+	rtest.OK(t, err)
+	rtest.Equals(t, "0.16.0-rc1", v)
+
+	// the latest release is already installed
+	v, err = DownloadRelease(context.TODO(), target, "0.16.0-rc1", DownloadOptions{Channel: ChannelBeta}, nil)
+	rtest.OK(t, err)
+	rtest.Equals(t, "0.16.0-rc1", v)
+}
+
+func TestDownloadReleaseBadSignature(t *testing.T) {
+	signer := newTestEntity(t, true)
+	untrusted := newTestEntity(t, false)
+
+	srv := newTestReleaseServer(t)
+	// signed with an unknown key
+	srv.addRelease(t, "0.15.1", false, untrusted, nil)
+	// SHA256SUMS modified after signing
+	srv.addRelease(t, "0.15.2", false, signer, func(files map[string][]byte) {
+		files["SHA256SUMS"] = append(files["SHA256SUMS"], []byte("0000  restic_0.15.2_other.bz2\n")...)
+	})
+
+	for _, version := range []string{"0.15.1", "0.15.2"} {
+		target := filepath.Join(t.TempDir(), "restic")
+		_, err := DownloadRelease(context.TODO(), target, "0.15.0", DownloadOptions{Version: version}, nil)
+		rtest.Assert(t, err != nil && strings.Contains(err.Error(), "GPG signature verification"),
+			"expected signature error for version %v, got %v", version, err)
+
+		_, err = os.Stat(target)
+		rtest.Assert(t, errors.Is(err, os.ErrNotExist), "target was written for version %v: %v", version, err)
+	}
+}
+
+func TestDownloadReleaseHashMismatch(t *testing.T) {
+	signer := newTestEntity(t, true)
+	srv := newTestReleaseServer(t)
+	srv.addRelease(t, "0.15.1", false, signer, func(files map[string][]byte) {
+		filename, archive := testArchive(t, "0.15.1")
+		files[filename] = append(append([]byte{}, archive...), 0)
+	})
+
+	target := filepath.Join(t.TempDir(), "restic")
+	_, err := DownloadRelease(context.TODO(), target, "0.15.0", DownloadOptions{Version: "0.15.1"}, nil)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "hash mismatch"), "expected hash mismatch, got %v", err)
+
+	_, err = os.Stat(target)
+	rtest.Assert(t, errors.Is(err, os.ErrNotExist), "target was written: %v", err)
+}
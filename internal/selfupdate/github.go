@@ -45,16 +45,89 @@ type githubError struct {
 	Message string
 }
 
+// githubAPIURL is the base URL of the GitHub API, it can be replaced in tests.
+var githubAPIURL = "https://api.github.com"
+
 // GitHubLatestRelease uses the GitHub API to get information about the latest
 // release of a repository.
 func GitHubLatestRelease(ctx context.Context, owner, repo string) (Release, error) {
+	var release Release
+	err := getGithubJSON(ctx, fmt.Sprintf("%s/repos/%s/%s/releases/latest", githubAPIURL, owner, repo), &release)
+	if err != nil {
+		return Release{}, err
+	}
+
+	return parseRelease(release)
+}
+
+// GitHubReleaseByVersion uses the GitHub API to get information about the
+// release with the given version, e.g. "0.15.1".
+func GitHubReleaseByVersion(ctx context.Context, owner, repo, version string) (Release, error) {
+	var release Release
+	err := getGithubJSON(ctx, fmt.Sprintf("%s/repos/%s/%s/releases/tags/v%s", githubAPIURL, owner, repo, version), &release)
+	if err != nil {
+		return Release{}, errors.Wrapf(err, "unable to find release %v", version)
+	}
+
+	return parseRelease(release)
+}
+
+// GitHubLatestPreRelease uses the GitHub API to get information about the
+// newest release of a repository which is marked as a pre-release. Draft
+// releases are ignored.
+func GitHubLatestPreRelease(ctx context.Context, owner, repo string) (Release, error) {
+	var releases []Release
+	err := getGithubJSON(ctx, fmt.Sprintf("%s/repos/%s/%s/releases", githubAPIURL, owner, repo), &releases)
+	if err != nil {
+		return Release{}, err
+	}
+
+	var latest Release
+	for _, rel := range releases {
+		if rel.Draft || !rel.PreRelease {
+			continue
+		}
+
+		rel, err := parseRelease(rel)
+		if err != nil {
+			return Release{}, err
+		}
+
+		if latest.Version == "" || CompareVersions(rel.Version, latest.Version) > 0 {
+			latest = rel
+		}
+	}
+
+	if latest.Version == "" {
+		return Release{}, errors.New("no pre-release found")
+	}
+
+	return latest, nil
+}
+
+func parseRelease(release Release) (Release, error) {
+	if release.TagName == "" {
+		return Release{}, errors.New("tag name for latest release is empty")
+	}
+
+	if !strings.HasPrefix(release.TagName, "v") {
+		return Release{}, errors.Errorf("tag name %q is invalid, does not start with 'v'", release.TagName)
+	}
+
+	release.Version = release.TagName[1:]
+
+	return release, nil
+}
+
+// getGithubJSON requests url from the GitHub API and decodes the response
+// into data.
+func getGithubJSON(ctx context.Context, url string, data interface{}) error {
 	ctx, cancel := context.WithTimeout(ctx, githubAPITimeout)
 	defer cancel()
 
-	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/releases/latest", owner, repo)
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return Release{}, err
+		return err
 	}
 
 	// pin API version 3
@@ -62,7 +135,7 @@ func GitHubLatestRelease(ctx context.Context, owner, repo string) (Release, erro
 
 	res, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return Release{}, err
+		return err
 	}
 
 	if res.StatusCode != http.StatusOK {
@@ -72,42 +145,27 @@ func GitHubLatestRelease(ctx context.Context, owner, repo string) (Release, erro
 			var msg githubError
 			jerr := json.NewDecoder(res.Body).Decode(&msg)
 			if jerr == nil {
-				return Release{}, fmt.Errorf("unexpected status %v (%v) returned, message:\n  %v", res.StatusCode, res.Status, msg.Message)
+				_ = res.Body.Close()
+				return fmt.Errorf("unexpected status %v (%v) returned, message:\n  %v", res.StatusCode, res.Status, msg.Message)
 			}
 		}
 
 		_ = res.Body.Close()
-		return Release{}, fmt.Errorf("unexpected status %v (%v) returned", res.StatusCode, res.Status)
+		return fmt.Errorf("unexpected status %v (%v) returned", res.StatusCode, res.Status)
 	}
 
 	buf, err := io.ReadAll(res.Body)
 	if err != nil {
 		_ = res.Body.Close()
-		return Release{}, err
+		return err
 	}
 
 	err = res.Body.Close()
 	if err != nil {
-		return Release{}, err
+		return err
 	}
 
-	var release Release
-	err = json.Unmarshal(buf, &release)
-	if err != nil {
-		return Release{}, err
-	}
-
-	if release.TagName == "" {
-		return Release{}, errors.New("tag name for latest release is empty")
-	}
-
-	if !strings.HasPrefix(release.TagName, "v") {
-		return Release{}, errors.Errorf("tag name %q is invalid, does not start with 'v'", release.TagName)
-	}
-
-	release.Version = release.TagName[1:]
-
-	return release, nil
+	return json.Unmarshal(buf, data)
 }
 
 func getGithubData(ctx context.Context, url string) ([]byte, error) {
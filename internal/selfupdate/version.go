@@ -0,0 +1,62 @@
+package selfupdate
+
+import (
+	"strconv"
+	"strings"
+)
+
+// splitVersion splits a version like "0.15.1-rc1 (compiled manually)" into
+// the numeric components and the pre-release suffix.
+func splitVersion(v string) (numbers []int, pre string) {
+	v, _, _ = strings.Cut(strings.TrimSpace(v), " ")
+	v, pre, _ = strings.Cut(v, "-")
+
+	for _, s := range strings.Split(v, ".") {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			n = 0
+		}
+		numbers = append(numbers, n)
+	}
+
+	return numbers, pre
+}
+
+// CompareVersions compares two restic versions. It returns -1 if a is older
+// than b, 1 if a is newer than b and 0 if both are equal. A pre-release, for
+// example "0.16.0-rc1" or "0.16.0-dev", is older than the corresponding
+// release.
+func CompareVersions(a, b string) int {
+	numA, preA := splitVersion(a)
+	numB, preB := splitVersion(b)
+
+	for i := 0; i < len(numA) || i < len(numB); i++ {
+		var x, y int
+		if i < len(numA) {
+			x = numA[i]
+		}
+		if i < len(numB) {
+			y = numB[i]
+		}
+
+		if x < y {
+			return -1
+		}
+		if x > y {
+			return 1
+		}
+	}
+
+	switch {
+	case preA == preB:
+		return 0
+	case preA == "":
+		return 1
+	case preB == "":
+		return -1
+	case preA < preB:
+		return -1
+	default:
+		return 1
+	}
+}
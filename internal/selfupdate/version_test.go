@@ -0,0 +1,29 @@
+package selfupdate
+
+import (
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestCompareVersions(t *testing.T) {
+	for _, test := range []struct {
+		a, b string
+		res  int
+	}{
+		{"0.15.1", "0.15.1", 0},
+		{"0.15.1", "0.15.2", -1},
+		{"0.16.0", "0.15.2", 1},
+		{"0.10.0", "0.9.4", 1},
+		{"1.0", "0.99.0", 1},
+		{"0.16", "0.16.0", 0},
+		{"0.16.0-rc1", "0.16.0", -1},
+		{"0.16.0-rc2", "0.16.0-rc1", 1},
+		{"0.16.0-rc1", "0.15.2", 1},
+		{"0.16.0-dev (compiled manually)", "0.16.0", -1},
+		{"0.16.0-dev (compiled manually)", "0.15.2", 1},
+	} {
+		rtest.Equals(t, test.res, CompareVersions(test.a, test.b))
+		rtest.Equals(t, -test.res, CompareVersions(test.b, test.a))
+	}
+}
@@ -68,7 +68,7 @@ func (b *JSONProgress) Update(total, processed Counter, errors uint, currentFile
 func (b *JSONProgress) ScannerError(item string, err error) error {
 	b.error(errorUpdate{
 		MessageType: "error",
-		Error:       err,
+		Error:       errorObject{err.Error()},
 		During:      "scan",
 		Item:        item,
 	})
@@ -79,7 +79,7 @@ func (b *JSONProgress) ScannerError(item string, err error) error {
 func (b *JSONProgress) Error(item string, err error) error {
 	b.error(errorUpdate{
 		MessageType: "error",
-		Error:       err,
+		Error:       errorObject{err.Error()},
 		During:      "archival",
 		Item:        item,
 	})
@@ -88,7 +88,7 @@ func (b *JSONProgress) Error(item string, err error) error {
 
 // CompleteItem is the status callback function for the archiver when a
 // file/dir has been saved successfully.
-func (b *JSONProgress) CompleteItem(messageType, item string, s archiver.ItemStats, d time.Duration) {
+func (b *JSONProgress) CompleteItem(messageType, item string, _ uint64, s archiver.ItemStats, d time.Duration) {
 	if b.v < 2 {
 		return
 	}
@@ -149,6 +149,13 @@ func (b *JSONProgress) CompleteItem(messageType, item string, s archiver.ItemSta
 	}
 }
 
+// FileChanged does nothing, the JSON output does not include the reason
+// why a file is read.
+func (b *JSONProgress) FileChanged(_, _ string) {}
+
+// Excluded does nothing, the JSON output does not include excluded items.
+func (b *JSONProgress) Excluded(_, _ string) {}
+
 // ReportTotal sets the total stats up to now
 func (b *JSONProgress) ReportTotal(start time.Time, s archiver.ScanStats) {
 	if b.v >= 2 {
@@ -164,6 +171,11 @@ func (b *JSONProgress) ReportTotal(start time.Time, s archiver.ScanStats) {
 
 // Finish prints the finishing messages.
 func (b *JSONProgress) Finish(snapshotID restic.ID, start time.Time, summary *Summary, dryRun bool) {
+	var syncDuration *float64
+	if summary.SyncDuration != nil {
+		seconds := summary.SyncDuration.Seconds()
+		syncDuration = &seconds
+	}
 	b.print(summaryOutput{
 		MessageType:         "summary",
 		FilesNew:            summary.Files.New,
@@ -180,6 +192,11 @@ func (b *JSONProgress) Finish(snapshotID restic.ID, start time.Time, summary *Su
 		TotalDuration:       time.Since(start).Seconds(),
 		SnapshotID:          snapshotID.String(),
 		DryRun:              dryRun,
+		Warnings:            summary.Warnings,
+		IndexMemoryUsage:    summary.IndexMemoryUsage,
+		Transfer:            summary.Transfer,
+		Duplicates:          summary.Duplicates,
+		SyncDuration:        syncDuration,
 	})
 }
 
@@ -189,22 +206,28 @@ func (b *JSONProgress) Reset() {
 
 type statusUpdate struct {
 	MessageType      string   `json:"message_type"` // "status"
-	SecondsElapsed   uint64   `json:"seconds_elapsed,omitempty"`
+	SecondsElapsed   uint64   `json:"seconds_elapsed"`
 	SecondsRemaining uint64   `json:"seconds_remaining,omitempty"`
 	PercentDone      float64  `json:"percent_done"`
-	TotalFiles       uint64   `json:"total_files,omitempty"`
-	FilesDone        uint64   `json:"files_done,omitempty"`
-	TotalBytes       uint64   `json:"total_bytes,omitempty"`
-	BytesDone        uint64   `json:"bytes_done,omitempty"`
+	TotalFiles       uint64   `json:"total_files"`
+	FilesDone        uint64   `json:"files_done"`
+	TotalBytes       uint64   `json:"total_bytes"`
+	BytesDone        uint64   `json:"bytes_done"`
 	ErrorCount       uint     `json:"error_count,omitempty"`
 	CurrentFiles     []string `json:"current_files,omitempty"`
 }
 
+// errorObject wraps the error message, as an error value itself is encoded as
+// an empty JSON object.
+type errorObject struct {
+	Message string `json:"message"`
+}
+
 type errorUpdate struct {
-	MessageType string `json:"message_type"` // "error"
-	Error       error  `json:"error"`
-	During      string `json:"during"`
-	Item        string `json:"item"`
+	MessageType string      `json:"message_type"` // "error"
+	Error       errorObject `json:"error"`
+	During      string      `json:"during"`
+	Item        string      `json:"item"`
 }
 
 type verboseUpdate struct {
@@ -235,4 +258,14 @@ type summaryOutput struct {
 	TotalDuration       float64 `json:"total_duration"` // in seconds
 	SnapshotID          string  `json:"snapshot_id"`
 	DryRun              bool    `json:"dry_run,omitempty"`
+
+	Warnings []ui.WarningSummary `json:"warnings,omitempty"`
+
+	IndexMemoryUsage uint64 `json:"index_memory_usage,omitempty"`
+
+	Transfer *ui.TransferStats `json:"transfer,omitempty"`
+
+	Duplicates *ui.DuplicateStats `json:"duplicates,omitempty"`
+
+	SyncDuration *float64 `json:"sync_duration,omitempty"` // in seconds
 }
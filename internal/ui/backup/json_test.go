@@ -0,0 +1,88 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+	"github.com/restic/restic/internal/ui/termstatus"
+)
+
+// runJSONProgress calls fn with a JSONProgress and returns the decoded
+// messages printed to stdout and stderr.
+func runJSONProgress(t *testing.T, fn func(p *JSONProgress)) (stdout, stderr []map[string]interface{}) {
+	var outBuf, errBuf bytes.Buffer
+	term := termstatus.New(&outBuf, &errBuf, true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		term.Run(ctx)
+	}()
+
+	fn(NewJSONProgress(term, 2))
+	cancel()
+	wg.Wait()
+
+	decode := func(buf *bytes.Buffer) []map[string]interface{} {
+		var msgs []map[string]interface{}
+		if buf.Len() == 0 {
+			return msgs
+		}
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			var msg map[string]interface{}
+			rtest.OK(t, json.Unmarshal([]byte(line), &msg))
+			msgs = append(msgs, msg)
+		}
+		return msgs
+	}
+	return decode(&outBuf), decode(&errBuf)
+}
+
+func TestJSONProgressStatus(t *testing.T) {
+	stdout, _ := runJSONProgress(t, func(p *JSONProgress) {
+		p.Update(Counter{Files: 3, Bytes: 40}, Counter{}, 0, nil, time.Now(), 0)
+		p.Update(Counter{Files: 3, Bytes: 40}, Counter{Files: 1, Bytes: 10}, 1,
+			map[string]struct{}{"/foo": {}, "/bar": {}}, time.Now().Add(-2*time.Second), 5)
+	})
+
+	rtest.Equals(t, 2, len(stdout))
+
+	// counters must be present even if they are zero
+	for _, field := range []string{"seconds_elapsed", "percent_done", "total_files", "files_done", "total_bytes", "bytes_done"} {
+		_, ok := stdout[0][field]
+		rtest.Assert(t, ok, "field %v missing in %v", field, stdout[0])
+	}
+
+	rtest.Equals(t, "status", stdout[1]["message_type"])
+	rtest.Equals(t, 0.25, stdout[1]["percent_done"])
+	rtest.Equals(t, float64(2), stdout[1]["seconds_elapsed"])
+	rtest.Equals(t, float64(5), stdout[1]["seconds_remaining"])
+	rtest.Equals(t, float64(1), stdout[1]["files_done"])
+	rtest.Equals(t, float64(1), stdout[1]["error_count"])
+	rtest.Equals(t, []interface{}{"/bar", "/foo"}, stdout[1]["current_files"])
+}
+
+func TestJSONProgressError(t *testing.T) {
+	stdout, stderr := runJSONProgress(t, func(p *JSONProgress) {
+		rtest.OK(t, p.ScannerError("/foo", errors.New("scan failed")))
+		rtest.OK(t, p.Error("/bar", errors.New("read failed")))
+		p.Finish(restic.NewRandomID(), time.Now(), &Summary{}, false)
+	})
+
+	// errors are printed to stderr
+	rtest.Equals(t, 1, len(stdout))
+	rtest.Equals(t, []map[string]interface{}{
+		{"message_type": "error", "error": map[string]interface{}{"message": "scan failed"}, "during": "scan", "item": "/foo"},
+		{"message_type": "error", "error": map[string]interface{}{"message": "read failed"}, "during": "archival", "item": "/bar"},
+	}, stderr)
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/restic/restic/internal/archiver"
 	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
 	"github.com/restic/restic/internal/ui/progress"
 )
 
@@ -15,7 +16,9 @@ type ProgressPrinter interface {
 	Update(total, processed Counter, errors uint, currentFiles map[string]struct{}, start time.Time, secs uint64)
 	Error(item string, err error) error
 	ScannerError(item string, err error) error
-	CompleteItem(messageType string, item string, s archiver.ItemStats, d time.Duration)
+	CompleteItem(messageType string, item string, size uint64, s archiver.ItemStats, d time.Duration)
+	FileChanged(item string, reason string)
+	Excluded(item string, reason string)
 	ReportTotal(start time.Time, s archiver.ScanStats)
 	Finish(snapshotID restic.ID, start time.Time, summary *Summary, dryRun bool)
 	Reset()
@@ -36,8 +39,24 @@ type Summary struct {
 	}
 	ProcessedBytes uint64
 	archiver.ItemStats
+	Warnings []ui.WarningSummary
+	// IndexMemoryUsage is the approximate memory used by the index in bytes.
+	IndexMemoryUsage uint64
+	// Transfer contains the backend requests of the backup, it is nil if no
+	// statistics were collected.
+	Transfer *ui.TransferStats
+	// Duplicates contains the number of blobs which were already contained
+	// in the repository, it is nil if no statistics were collected.
+	Duplicates *ui.DuplicateStats
+	// SyncDuration is the time spent flushing the written files to stable
+	// storage, it is nil unless syncing was requested.
+	SyncDuration *time.Duration
 }
 
+// maxWarningExamples is the number of items kept for each category of
+// warnings.
+const maxWarningExamples = 5
+
 // Progress reports progress for the `backup` command.
 type Progress struct {
 	progress.Updater
@@ -52,14 +71,16 @@ type Progress struct {
 	processed, total Counter
 	errors           uint
 
-	summary Summary
-	printer ProgressPrinter
+	summary  Summary
+	warnings *ui.Warnings
+	printer  ProgressPrinter
 }
 
 func NewProgress(printer ProgressPrinter, interval time.Duration) *Progress {
 	p := &Progress{
 		start:        time.Now(),
 		currentFiles: make(map[string]struct{}),
+		warnings:     ui.NewWarnings(maxWarningExamples),
 		printer:      printer,
 		estimator:    *newRateEstimator(time.Now()),
 	}
@@ -91,16 +112,45 @@ func NewProgress(printer ProgressPrinter, interval time.Duration) *Progress {
 	return p
 }
 
-// Error is the error callback function for the archiver, it prints the error and returns nil.
+// Status returns a snapshot of the backup progress. The totals are only set
+// once the scanner has finished.
+func (p *Progress) Status() ui.Status {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s := ui.Status{
+		Operation: "backup",
+		Items:     p.processed.Files,
+		ItemUnit:  "files",
+		Bytes:     p.processed.Bytes,
+		Elapsed:   time.Since(p.start),
+	}
+	if p.scanFinished {
+		s.TotalItems = p.total.Files
+		s.TotalBytes = p.total.Bytes
+	}
+	return s
+}
+
+// Error is the error callback function for the archiver, it prints the error
+// and returns nil. The error is also recorded for the summary of warnings.
 func (p *Progress) Error(item string, err error) error {
 	p.mu.Lock()
 	p.errors++
 	p.scanStarted = true
 	p.mu.Unlock()
 
+	p.warnings.Add(item, err)
+
 	return p.printer.Error(item, err)
 }
 
+// Warning records a warning of the given category for item in the summary
+// of warnings. Unlike Error, it is not counted as an error.
+func (p *Progress) Warning(item string, category string) {
+	p.warnings.AddCategory(category, item)
+}
+
 // StartFile is called when a file is being processed by a worker.
 func (p *Progress) StartFile(filename string) {
 	p.mu.Lock()
@@ -152,19 +202,19 @@ func (p *Progress) CompleteItem(item string, previous, current *restic.Node, s a
 
 		switch {
 		case previous == nil:
-			p.printer.CompleteItem("dir new", item, s, d)
+			p.printer.CompleteItem("dir new", item, current.Size, s, d)
 			p.mu.Lock()
 			p.summary.Dirs.New++
 			p.mu.Unlock()
 
 		case previous.Equals(*current):
-			p.printer.CompleteItem("dir unchanged", item, s, d)
+			p.printer.CompleteItem("dir unchanged", item, current.Size, s, d)
 			p.mu.Lock()
 			p.summary.Dirs.Unchanged++
 			p.mu.Unlock()
 
 		default:
-			p.printer.CompleteItem("dir modified", item, s, d)
+			p.printer.CompleteItem("dir modified", item, current.Size, s, d)
 			p.mu.Lock()
 			p.summary.Dirs.Changed++
 			p.mu.Unlock()
@@ -178,19 +228,19 @@ func (p *Progress) CompleteItem(item string, previous, current *restic.Node, s a
 
 		switch {
 		case previous == nil:
-			p.printer.CompleteItem("file new", item, s, d)
+			p.printer.CompleteItem("file new", item, current.Size, s, d)
 			p.mu.Lock()
 			p.summary.Files.New++
 			p.mu.Unlock()
 
 		case previous.Equals(*current):
-			p.printer.CompleteItem("file unchanged", item, s, d)
+			p.printer.CompleteItem("file unchanged", item, current.Size, s, d)
 			p.mu.Lock()
 			p.summary.Files.Unchanged++
 			p.mu.Unlock()
 
 		default:
-			p.printer.CompleteItem("file modified", item, s, d)
+			p.printer.CompleteItem("file modified", item, current.Size, s, d)
 			p.mu.Lock()
 			p.summary.Files.Changed++
 			p.mu.Unlock()
@@ -198,6 +248,17 @@ func (p *Progress) CompleteItem(item string, previous, current *restic.Node, s a
 	}
 }
 
+// FileChanged is called by the archiver when a file is read because its
+// content cannot be reused from the parent snapshot.
+func (p *Progress) FileChanged(item string, reason string) {
+	p.printer.FileChanged(item, reason)
+}
+
+// Excluded is called when an item is excluded from the backup.
+func (p *Progress) Excluded(item string, reason string) {
+	p.printer.Excluded(item, reason)
+}
+
 // ReportTotal sets the total stats up to now
 func (p *Progress) ReportTotal(item string, s archiver.ScanStats) {
 	p.mu.Lock()
@@ -212,9 +273,39 @@ func (p *Progress) ReportTotal(item string, s archiver.ScanStats) {
 	}
 }
 
+// SetIndexMemoryUsage records the memory used by the index for the summary.
+func (p *Progress) SetIndexMemoryUsage(size uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.summary.IndexMemoryUsage = size
+}
+
+// SetTransferStats records the backend requests for the summary.
+func (p *Progress) SetTransferStats(s ui.TransferStats) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.summary.Transfer = &s
+}
+
+// SetDuplicateStats records the number of already known blobs for the summary.
+func (p *Progress) SetDuplicateStats(s ui.DuplicateStats) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.summary.Duplicates = &s
+}
+
+// SetSyncDuration records the time spent syncing the repository files for
+// the summary.
+func (p *Progress) SetSyncDuration(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.summary.SyncDuration = &d
+}
+
 // Finish prints the finishing messages.
 func (p *Progress) Finish(snapshotID restic.ID, dryrun bool) {
 	// wait for the status update goroutine to shut down
 	p.Updater.Done()
+	p.summary.Warnings = p.warnings.Summary()
 	p.printer.Finish(snapshotID, p.start, &p.summary, dryrun)
 }
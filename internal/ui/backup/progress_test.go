@@ -1,18 +1,22 @@
 package backup
 
 import (
+	"os"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/restic/restic/internal/archiver"
 	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/test"
+	"github.com/restic/restic/internal/ui"
 )
 
 type mockPrinter struct {
 	sync.Mutex
 	dirUnchanged, fileNew bool
 	id                    restic.ID
+	warnings              []ui.WarningSummary
 }
 
 func (p *mockPrinter) Update(_, _ Counter, _ uint, _ map[string]struct{}, _ time.Time, _ uint64) {
@@ -20,7 +24,7 @@ func (p *mockPrinter) Update(_, _ Counter, _ uint, _ map[string]struct{}, _ time
 func (p *mockPrinter) Error(_ string, err error) error        { return err }
 func (p *mockPrinter) ScannerError(_ string, err error) error { return err }
 
-func (p *mockPrinter) CompleteItem(messageType string, _ string, _ archiver.ItemStats, _ time.Duration) {
+func (p *mockPrinter) CompleteItem(messageType string, _ string, _ uint64, _ archiver.ItemStats, _ time.Duration) {
 	p.Lock()
 	defer p.Unlock()
 
@@ -32,6 +36,8 @@ func (p *mockPrinter) CompleteItem(messageType string, _ string, _ archiver.Item
 	}
 }
 
+func (p *mockPrinter) FileChanged(_, _ string)                       {}
+func (p *mockPrinter) Excluded(_, _ string)                          {}
 func (p *mockPrinter) ReportTotal(_ time.Time, _ archiver.ScanStats) {}
 func (p *mockPrinter) Finish(id restic.ID, _ time.Time, summary *Summary, _ bool) {
 	p.Lock()
@@ -39,6 +45,7 @@ func (p *mockPrinter) Finish(id restic.ID, _ time.Time, summary *Summary, _ bool
 
 	_ = *summary // Should not be nil.
 	p.id = id
+	p.warnings = summary.Warnings
 }
 
 func (p *mockPrinter) Reset() {}
@@ -76,3 +83,21 @@ func TestProgress(t *testing.T) {
 		t.Errorf("id not stored (has %v)", prnt.id)
 	}
 }
+
+func TestProgressWarnings(t *testing.T) {
+	prnt := &mockPrinter{}
+	prog := NewProgress(prnt, 0)
+
+	_ = prog.Error("/vanished", &os.PathError{Op: "lstat", Path: "/vanished", Err: os.ErrNotExist})
+	for _, name := range []string{"/a", "/b", "/c", "/d", "/e", "/f"} {
+		_ = prog.Error(name, &os.PathError{Op: "open", Path: name, Err: os.ErrPermission})
+	}
+	prog.Warning("/mnt/data", "empty target")
+	prog.Finish(restic.NewRandomID(), false)
+
+	test.Equals(t, []ui.WarningSummary{
+		{Category: "permission denied", Count: 6, Examples: []string{"/a", "/b", "/c", "/d", "/e"}},
+		{Category: "empty target", Count: 1, Examples: []string{"/mnt/data"}},
+		{Category: "file not found", Count: 1, Examples: []string{"/vanished"}},
+	}, prnt.warnings)
+}
@@ -84,32 +84,44 @@ func (b *TextProgress) Error(_ string, err error) error {
 }
 
 // CompleteItem is the status callback function for the archiver when a
-// file/dir has been saved successfully.
-func (b *TextProgress) CompleteItem(messageType, item string, s archiver.ItemStats, d time.Duration) {
+// file/dir has been saved successfully. New and modified directories are
+// printed with verbosity level 1, new and modified files with level 2 and
+// unchanged items with level 3.
+func (b *TextProgress) CompleteItem(messageType, item string, size uint64, s archiver.ItemStats, d time.Duration) {
 	item = termstatus.Quote(item)
 
 	switch messageType {
 	case "dir new":
-		b.VV("new       %v, saved in %.3fs (%v added, %v stored, %v metadata)",
+		b.V("new       %v, saved in %.3fs (%v added, %v stored, %v metadata)",
 			item, d.Seconds(), ui.FormatBytes(s.DataSize),
 			ui.FormatBytes(s.DataSizeInRepo), ui.FormatBytes(s.TreeSizeInRepo))
 	case "dir unchanged":
-		b.VV("unchanged %v", item)
+		b.VVV("unchanged %v", item)
 	case "dir modified":
-		b.VV("modified  %v, saved in %.3fs (%v added, %v stored, %v metadata)",
+		b.V("modified  %v, saved in %.3fs (%v added, %v stored, %v metadata)",
 			item, d.Seconds(), ui.FormatBytes(s.DataSize),
 			ui.FormatBytes(s.DataSizeInRepo), ui.FormatBytes(s.TreeSizeInRepo))
 	case "file new":
-		b.VV("new       %v, saved in %.3fs (%v added)", item,
+		b.VV("new       %v, %v, saved in %.3fs (%v added)", item, ui.FormatBytes(size),
 			d.Seconds(), ui.FormatBytes(s.DataSize))
 	case "file unchanged":
-		b.VV("unchanged %v", item)
+		b.VVV("unchanged %v", item)
 	case "file modified":
-		b.VV("modified  %v, saved in %.3fs (%v added, %v stored)", item,
+		b.VV("modified  %v, %v, saved in %.3fs (%v added, %v stored)", item, ui.FormatBytes(size),
 			d.Seconds(), ui.FormatBytes(s.DataSize), ui.FormatBytes(s.DataSizeInRepo))
 	}
 }
 
+// FileChanged prints why a file is read with verbosity level 3.
+func (b *TextProgress) FileChanged(item string, reason string) {
+	b.VVV("reading   %v: %v", termstatus.Quote(item), reason)
+}
+
+// Excluded prints why an item is excluded with verbosity level 3.
+func (b *TextProgress) Excluded(item string, reason string) {
+	b.VVV("excluded  %v: %v", termstatus.Quote(item), reason)
+}
+
 // ReportTotal sets the total stats up to now
 func (b *TextProgress) ReportTotal(start time.Time, s archiver.ScanStats) {
 	b.V("scan finished in %.3fs: %v files, %s",
@@ -128,10 +140,19 @@ func (b *TextProgress) Reset() {
 // Finish prints the finishing messages.
 func (b *TextProgress) Finish(_ restic.ID, start time.Time, summary *Summary, dryRun bool) {
 	b.P("\n")
+	if warnings := ui.FormatWarnings(summary.Warnings); len(warnings) > 0 {
+		for _, line := range warnings {
+			b.P("%s\n", line)
+		}
+		b.P("\n")
+	}
 	b.P("Files:       %5d new, %5d changed, %5d unmodified\n", summary.Files.New, summary.Files.Changed, summary.Files.Unchanged)
 	b.P("Dirs:        %5d new, %5d changed, %5d unmodified\n", summary.Dirs.New, summary.Dirs.Changed, summary.Dirs.Unchanged)
 	b.V("Data Blobs:  %5d new\n", summary.ItemStats.DataBlobs)
 	b.V("Tree Blobs:  %5d new\n", summary.ItemStats.TreeBlobs)
+	if summary.Duplicates != nil {
+		b.V("Duplicates:  %s\n", ui.FormatDuplicateStats(*summary.Duplicates))
+	}
 	verb := "Added"
 	if dryRun {
 		verb = "Would add"
@@ -139,6 +160,12 @@ func (b *TextProgress) Finish(_ restic.ID, start time.Time, summary *Summary, dr
 	b.P("%s to the repository: %-5s (%-5s stored)\n", verb,
 		ui.FormatBytes(summary.ItemStats.DataSize+summary.ItemStats.TreeSize),
 		ui.FormatBytes(summary.ItemStats.DataSizeInRepo+summary.ItemStats.TreeSizeInRepo))
+	if summary.Transfer != nil {
+		b.P("Backend:     %s\n", ui.FormatTransferStats(*summary.Transfer))
+	}
+	if summary.SyncDuration != nil {
+		b.P("Sync:        took %s\n", summary.SyncDuration.Round(time.Millisecond))
+	}
 	b.P("\n")
 	b.P("processed %v files, %v in %s",
 		summary.Files.New+summary.Files.Changed+summary.Files.Unchanged,
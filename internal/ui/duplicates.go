@@ -0,0 +1,17 @@
+package ui
+
+import "fmt"
+
+// DuplicateStats contains the number of blobs which were already contained in
+// the repository while running a command.
+type DuplicateStats struct {
+	// Suppressed is the number of known blobs which were not saved again.
+	Suppressed uint64 `json:"suppressed"`
+	// Stored is the number of known blobs which were saved again.
+	Stored uint64 `json:"stored"`
+}
+
+// FormatDuplicateStats returns a short description of s.
+func FormatDuplicateStats(s DuplicateStats) string {
+	return fmt.Sprintf("%d blobs skipped, %d stored again", s.Suppressed, s.Stored)
+}
@@ -8,6 +8,7 @@ import (
 	"math/bits"
 	"strconv"
 	"time"
+	"unicode/utf8"
 )
 
 func FormatBytes(c uint64) string {
@@ -40,6 +41,14 @@ func FormatPercent(numerator uint64, denominator uint64) string {
 	return fmt.Sprintf("%3.2f%%", percent)
 }
 
+// FormatRate formats the average rate of processing c bytes in d.
+func FormatRate(c uint64, d time.Duration) string {
+	if d <= 0 {
+		return "0 B/s"
+	}
+	return FormatBytes(uint64(float64(c)/d.Seconds())) + "/s"
+}
+
 // FormatDuration formats d as FormatSeconds would.
 func FormatDuration(d time.Duration) string {
 	sec := uint64(d / time.Second)
@@ -105,3 +114,23 @@ func ToJSONString(status interface{}) string {
 	}
 	return buf.String()
 }
+
+// EscapeInvalidUTF8 replaces each byte of s which is not part of a valid UTF-8
+// sequence with the escape sequence \xNN. Valid UTF-8 is kept unchanged.
+func EscapeInvalidUTF8(s string) string {
+	if utf8.ValidString(s) {
+		return s
+	}
+
+	var buf bytes.Buffer
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		if r == utf8.RuneError && size == 1 {
+			fmt.Fprintf(&buf, "\\x%02x", s[0])
+		} else {
+			buf.WriteString(s[:size])
+		}
+		s = s[size:]
+	}
+	return buf.String()
+}
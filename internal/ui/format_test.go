@@ -84,3 +84,22 @@ func TestParseBytesInvalid(t *testing.T) {
 		test.Equals(t, int64(0), v)
 	}
 }
+
+func TestEscapeInvalidUTF8(t *testing.T) {
+	for _, c := range []struct {
+		input, want string
+	}{
+		{"", ""},
+		{"foo bar.txt", "foo bar.txt"},
+		{"Straße \u00e9\u4e16", "Straße \u00e9\u4e16"},
+		{"caf\xe9.txt", "caf\\xe9.txt"},
+		{"\xff\xfe", "\\xff\\xfe"},
+		// a truncated multi-byte sequence
+		{"a\xe4\xb8", "a\\xe4\\xb8"},
+		{"\xe9\u00e9", "\\xe9\u00e9"},
+	} {
+		if got := EscapeInvalidUTF8(c.input); got != c.want {
+			t.Errorf("EscapeInvalidUTF8(%q) = %q, want %q", c.input, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// LogLevel is the severity of an event written to the log file.
+type LogLevel int
+
+// The log levels, ordered from the most to the least severe.
+const (
+	LogError LogLevel = iota
+	LogWarn
+	LogInfo
+	LogDebug
+)
+
+var logLevelNames = []string{"error", "warn", "info", "debug"}
+
+func (l LogLevel) String() string {
+	if l < 0 || int(l) >= len(logLevelNames) {
+		return fmt.Sprintf("LogLevel(%d)", int(l))
+	}
+	return logLevelNames[l]
+}
+
+// ParseLogLevel returns the log level with the given name.
+func ParseLogLevel(s string) (LogLevel, error) {
+	for i, name := range logLevelNames {
+		if s == name {
+			return LogLevel(i), nil
+		}
+	}
+	return 0, errors.Errorf("invalid log level %q, must be one of %v", s, strings.Join(logLevelNames, ", "))
+}
+
+// Logger writes events up to a maximum level to w, one line per event. The
+// lines are either plain text or JSON objects.
+type Logger struct {
+	m     sync.Mutex
+	w     io.Writer
+	level LogLevel
+	json  bool
+	now   func() time.Time
+}
+
+// NewLogger returns a logger which writes all events with a level up to
+// level to w.
+func NewLogger(w io.Writer, level LogLevel, json bool) *Logger {
+	return &Logger{
+		w:     w,
+		level: level,
+		json:  json,
+		now:   time.Now,
+	}
+}
+
+type logEntry struct {
+	Time    string `json:"time"`
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
+const logTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// Log writes the message to the log if the level is enabled. Leading and
+// trailing whitespace is removed from the message, empty messages are
+// ignored.
+func (l *Logger) Log(level LogLevel, msg string, args ...interface{}) {
+	if l == nil || level > l.level {
+		return
+	}
+
+	msg = strings.TrimSpace(fmt.Sprintf(msg, args...))
+	if msg == "" {
+		return
+	}
+
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	entry := logEntry{
+		Time:    l.now().Format(logTimeFormat),
+		Level:   level.String(),
+		Message: msg,
+	}
+
+	var line []byte
+	if l.json {
+		buf, err := json.Marshal(entry)
+		if err != nil {
+			return
+		}
+		line = append(buf, '\n')
+	} else {
+		line = []byte(fmt.Sprintf("%s %-5s %s\n", entry.Time, entry.Level, entry.Message))
+	}
+
+	// errors while writing the log must not interrupt restic
+	_, _ = l.w.Write(line)
+}
+
+var globalLogger struct {
+	sync.Mutex
+	l *Logger
+}
+
+// SetLogger installs l as the logger used by the package level log
+// functions. A nil logger disables logging.
+func SetLogger(l *Logger) {
+	globalLogger.Lock()
+	defer globalLogger.Unlock()
+	globalLogger.l = l
+}
+
+// Log writes the message to the logger installed by SetLogger, if any.
+func Log(level LogLevel, msg string, args ...interface{}) {
+	globalLogger.Lock()
+	l := globalLogger.l
+	globalLogger.Unlock()
+
+	l.Log(level, msg, args...)
+}
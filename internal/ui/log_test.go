@@ -0,0 +1,69 @@
+package ui
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/test"
+)
+
+func TestParseLogLevel(t *testing.T) {
+	for _, level := range []LogLevel{LogError, LogWarn, LogInfo, LogDebug} {
+		l, err := ParseLogLevel(level.String())
+		test.OK(t, err)
+		test.Equals(t, level, l)
+	}
+
+	_, err := ParseLogLevel("verbose")
+	test.Assert(t, err != nil, "missing error for invalid log level")
+}
+
+func newTestLogger(level LogLevel, json bool) (*Logger, *bytes.Buffer) {
+	buf := &bytes.Buffer{}
+	l := NewLogger(buf, level, json)
+	l.now = func() time.Time { return time.Date(2023, 4, 5, 6, 7, 8, 9000000, time.UTC) }
+	return l, buf
+}
+
+func TestLoggerLevel(t *testing.T) {
+	l, buf := newTestLogger(LogWarn, false)
+	l.Log(LogError, "error %d\n", 1)
+	l.Log(LogWarn, "warning")
+	l.Log(LogInfo, "info")
+	l.Log(LogDebug, "debug")
+	// empty messages are not logged
+	l.Log(LogError, "\n")
+
+	test.Equals(t, "2023-04-05T06:07:08.009Z error error 1\n"+
+		"2023-04-05T06:07:08.009Z warn  warning\n", buf.String())
+}
+
+func TestLoggerJSON(t *testing.T) {
+	l, buf := newTestLogger(LogDebug, true)
+	l.Log(LogInfo, "snapshot %v saved\n", "abcdef")
+
+	var entry logEntry
+	test.OK(t, json.Unmarshal(buf.Bytes(), &entry))
+	test.Equals(t, logEntry{
+		Time:    "2023-04-05T06:07:08.009Z",
+		Level:   "info",
+		Message: "snapshot abcdef saved",
+	}, entry)
+	test.Assert(t, strings.Count(buf.String(), "\n") == 1, "expected a single line, got %q", buf.String())
+}
+
+func TestGlobalLogger(t *testing.T) {
+	// logging without a logger must not fail
+	Log(LogError, "foo")
+
+	l, buf := newTestLogger(LogInfo, false)
+	SetLogger(l)
+	Log(LogInfo, "foo")
+	SetLogger(nil)
+	Log(LogInfo, "bar")
+
+	test.Equals(t, "2023-04-05T06:07:08.009Z info  foo\n", buf.String())
+}
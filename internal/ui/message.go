@@ -2,7 +2,8 @@ package ui
 
 import "github.com/restic/restic/internal/ui/termstatus"
 
-// Message reports progress with messages of different verbosity.
+// Message reports progress with messages of different verbosity. All
+// messages are also written to the log, independent of the verbosity.
 type Message struct {
 	term *termstatus.Terminal
 	v    uint
@@ -20,6 +21,7 @@ func NewMessage(term *termstatus.Terminal, verbosity uint) *Message {
 // E reports an error
 func (m *Message) E(msg string, args ...interface{}) {
 	m.term.Errorf(msg, args...)
+	Log(LogError, msg, args...)
 }
 
 // P prints a message if verbosity >= 1, this is used for normal messages which
@@ -28,6 +30,7 @@ func (m *Message) P(msg string, args ...interface{}) {
 	if m.v >= 1 {
 		m.term.Printf(msg, args...)
 	}
+	Log(LogInfo, msg, args...)
 }
 
 // V prints a message if verbosity >= 2, this is used for verbose messages.
@@ -35,6 +38,7 @@ func (m *Message) V(msg string, args ...interface{}) {
 	if m.v >= 2 {
 		m.term.Printf(msg, args...)
 	}
+	Log(LogInfo, msg, args...)
 }
 
 // VV prints a message if verbosity >= 3, this is used for debug messages.
@@ -42,4 +46,14 @@ func (m *Message) VV(msg string, args ...interface{}) {
 	if m.v >= 3 {
 		m.term.Printf(msg, args...)
 	}
+	Log(LogDebug, msg, args...)
+}
+
+// VVV prints a message if verbosity >= 4, this is used for very detailed
+// debug messages.
+func (m *Message) VVV(msg string, args ...interface{}) {
+	if m.v >= 4 {
+		m.term.Printf(msg, args...)
+	}
+	Log(LogDebug, msg, args...)
 }
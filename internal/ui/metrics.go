@@ -0,0 +1,109 @@
+package ui
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+)
+
+// metric is a single gauge of Metrics.
+type metric struct {
+	name  string
+	help  string
+	value float64
+}
+
+// Metrics collects gauges which are written in the Prometheus text exposition
+// format, for example to be picked up by the textfile collector of the node
+// exporter. All metrics share the same labels.
+type Metrics struct {
+	labels  map[string]string
+	metrics []metric
+}
+
+// NewMetrics returns an empty set of metrics with the given labels.
+func NewMetrics(labels map[string]string) *Metrics {
+	return &Metrics{labels: labels}
+}
+
+// Set adds the gauge name with the description help and value. Metrics are
+// written in the order they were added.
+func (m *Metrics) Set(name, help string, value float64) {
+	m.metrics = append(m.metrics, metric{name: name, help: help, value: value})
+}
+
+// escapeLabelValue escapes backslashes, double quotes and line breaks, as
+// required by the exposition format.
+var escapeLabelValue = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace
+
+// escapeHelp escapes backslashes and line breaks in the HELP line.
+var escapeHelp = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace
+
+// labelString returns the labels in the form {a="1",b="2"}, sorted by name.
+func (m *Metrics) labelString() string {
+	if len(m.labels) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(m.labels))
+	for name := range m.labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	sb.WriteString("{")
+	for i, name := range names {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString(name + `="` + escapeLabelValue(m.labels[name]) + `"`)
+	}
+	sb.WriteString("}")
+	return sb.String()
+}
+
+// Write writes the metrics to w.
+func (m *Metrics) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	labels := m.labelString()
+	for _, g := range m.metrics {
+		_, _ = bw.WriteString("# HELP " + g.name + " " + escapeHelp(g.help) + "\n")
+		_, _ = bw.WriteString("# TYPE " + g.name + " gauge\n")
+		_, _ = bw.WriteString(g.name + labels + " " + strconv.FormatFloat(g.value, 'g', -1, 64) + "\n")
+	}
+	return bw.Flush()
+}
+
+// WriteFile replaces filename with the metrics. The file is written to a
+// temporary file in the same directory first and then renamed, such that
+// readers never see a partially written file.
+func (m *Metrics) WriteFile(filename string) error {
+	f, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp-")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = m.Write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		// CreateTemp uses mode 0600, the file is usually read by another user
+		err = fs.Chmod(f.Name(), 0644)
+	}
+	if err == nil {
+		err = fs.Rename(f.Name(), filename)
+	}
+	if err != nil {
+		_ = fs.Remove(f.Name())
+		return errors.WithStack(err)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package ui
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/test"
+)
+
+func TestMetricsWrite(t *testing.T) {
+	m := NewMetrics(map[string]string{
+		"hostname": "host",
+		"command":  "backup",
+		"repo_id":  "a\"b\\c\nd",
+	})
+	m.Set("restic_command_success", "whether the command succeeded", 1)
+	m.Set("restic_command_duration_seconds", "runtime of the command\nin seconds", 1.5)
+
+	var buf bytes.Buffer
+	test.OK(t, m.Write(&buf))
+	labels := `{command="backup",hostname="host",repo_id="a\"b\\c\nd"}`
+	test.Equals(t, "# HELP restic_command_success whether the command succeeded\n"+
+		"# TYPE restic_command_success gauge\n"+
+		"restic_command_success"+labels+" 1\n"+
+		"# HELP restic_command_duration_seconds runtime of the command\\nin seconds\n"+
+		"# TYPE restic_command_duration_seconds gauge\n"+
+		"restic_command_duration_seconds"+labels+" 1.5\n", buf.String())
+}
+
+func TestMetricsWriteFile(t *testing.T) {
+	dir := test.TempDir(t)
+	filename := filepath.Join(dir, "restic.prom")
+	test.OK(t, os.WriteFile(filename, []byte("old content"), 0600))
+
+	m := NewMetrics(nil)
+	m.Set("restic_backup_files_new", "new files", 42)
+	test.OK(t, m.WriteFile(filename))
+
+	buf, err := os.ReadFile(filename)
+	test.OK(t, err)
+	test.Equals(t, "# HELP restic_backup_files_new new files\n"+
+		"# TYPE restic_backup_files_new gauge\n"+
+		"restic_backup_files_new 42\n", string(buf))
+
+	// the temporary file is removed
+	entries, err := os.ReadDir(dir)
+	test.OK(t, err)
+	test.Equals(t, 1, len(entries))
+
+	// a missing directory is reported
+	test.Assert(t, m.WriteFile(filepath.Join(dir, "missing", "restic.prom")) != nil,
+		"expected error for missing directory")
+}
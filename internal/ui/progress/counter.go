@@ -3,6 +3,8 @@ package progress
 import (
 	"sync"
 	"time"
+
+	"github.com/restic/restic/internal/ui"
 )
 
 // A Func is a callback for a Counter.
@@ -13,14 +15,16 @@ type Func func(value uint64, total uint64, runtime time.Duration, final bool)
 
 // A Counter tracks a running count and controls a goroutine that passes its
 // value periodically to a Func.
-//
-// The Func is also called when SIGUSR1 (or SIGINFO, on BSD) is received.
 type Counter struct {
 	Updater
 
 	valueMutex sync.Mutex
 	value      uint64
 	max        uint64
+	bytes      uint64
+	maxBytes   uint64
+
+	unregister func()
 }
 
 // NewCounter starts a new Counter.
@@ -46,6 +50,18 @@ func (c *Counter) Add(v uint64) {
 	c.valueMutex.Unlock()
 }
 
+// AddBytes adds v to the number of processed bytes. This method is
+// concurrency-safe.
+func (c *Counter) AddBytes(v uint64) {
+	if c == nil {
+		return
+	}
+
+	c.valueMutex.Lock()
+	c.bytes += v
+	c.valueMutex.Unlock()
+}
+
 // SetMax sets the maximum expected counter value. This method is concurrency-safe.
 func (c *Counter) SetMax(max uint64) {
 	if c == nil {
@@ -56,6 +72,17 @@ func (c *Counter) SetMax(max uint64) {
 	c.valueMutex.Unlock()
 }
 
+// SetMaxBytes sets the expected number of bytes to process. This method is
+// concurrency-safe.
+func (c *Counter) SetMaxBytes(max uint64) {
+	if c == nil {
+		return
+	}
+	c.valueMutex.Lock()
+	c.maxBytes = max
+	c.valueMutex.Unlock()
+}
+
 // Get returns the current value and the maximum of c.
 // This method is concurrency-safe.
 func (c *Counter) Get() (v, max uint64) {
@@ -66,8 +93,40 @@ func (c *Counter) Get() (v, max uint64) {
 	return v, max
 }
 
+// GetBytes returns the number of processed bytes and the expected total.
+// This method is concurrency-safe.
+func (c *Counter) GetBytes() (v, max uint64) {
+	c.valueMutex.Lock()
+	v, max = c.bytes, c.maxBytes
+	c.valueMutex.Unlock()
+
+	return v, max
+}
+
+// Register installs c as the source of status snapshots for operation until
+// Done is called, see ui.RegisterStatus. The unit describes the counted items.
+func (c *Counter) Register(operation, unit string) {
+	if c == nil {
+		return
+	}
+
+	c.unregister = ui.RegisterStatus(func() ui.Status {
+		s := ui.Status{
+			Operation: operation,
+			ItemUnit:  unit,
+			Elapsed:   time.Since(c.start),
+		}
+		s.Items, s.TotalItems = c.Get()
+		s.Bytes, s.TotalBytes = c.GetBytes()
+		return s
+	})
+}
+
 func (c *Counter) Done() {
 	if c != nil {
 		c.Updater.Done()
+		if c.unregister != nil {
+			c.unregister()
+		}
 	}
 }
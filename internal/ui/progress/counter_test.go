@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/restic/restic/internal/test"
+	"github.com/restic/restic/internal/ui"
 	"github.com/restic/restic/internal/ui/progress"
 )
 
@@ -66,3 +67,23 @@ func TestCounterNil(_ *testing.T) {
 	c.SetMax(42)
 	c.Done()
 }
+
+func TestCounterRegister(t *testing.T) {
+	c := progress.NewPhaseCounter(0, 10, 1000, func(progress.PhaseStatus, bool) {})
+	c.Register("repack", "packs")
+	c.Add(3)
+	c.AddBytes(300)
+
+	s, ok := ui.CurrentStatus()
+	test.Assert(t, ok, "counter is not registered")
+	test.Equals(t, "repack", s.Operation)
+	test.Equals(t, "packs", s.ItemUnit)
+	test.Equals(t, uint64(3), s.Items)
+	test.Equals(t, uint64(10), s.TotalItems)
+	test.Equals(t, uint64(300), s.Bytes)
+	test.Equals(t, uint64(1000), s.TotalBytes)
+
+	c.Done()
+	_, ok = ui.CurrentStatus()
+	test.Assert(t, !ok, "counter is still registered after Done")
+}
@@ -0,0 +1,67 @@
+package progress
+
+import "time"
+
+// PhaseStatus describes the progress of one phase of an operation, for
+// example the repacking step of prune. The byte counters are only set if the
+// phase tracks the amount of processed data.
+type PhaseStatus struct {
+	Items    uint64
+	MaxItems uint64
+	Bytes    uint64
+	MaxBytes uint64
+	Runtime  time.Duration
+}
+
+// A PhaseFunc is a callback for a Counter created by NewPhaseCounter.
+//
+// The final argument is true if Counter.Done has been called,
+// which means that the current call will be the last.
+type PhaseFunc func(s PhaseStatus, final bool)
+
+// NewPhaseCounter starts a new Counter which reports both the number of
+// processed items and the number of processed bytes.
+func NewPhaseCounter(interval time.Duration, maxItems, maxBytes uint64, report PhaseFunc) *Counter {
+	c := &Counter{
+		max:      maxItems,
+		maxBytes: maxBytes,
+	}
+	c.Updater = *NewUpdater(interval, func(runtime time.Duration, final bool) {
+		s := PhaseStatus{Runtime: runtime}
+		s.Items, s.MaxItems = c.Get()
+		s.Bytes, s.MaxBytes = c.GetBytes()
+		report(s, final)
+	})
+	return c
+}
+
+// Fraction returns the fraction of the phase which is complete. The byte
+// counters are preferred as they better reflect the remaining work. If no
+// total is known, ok is false.
+func (s PhaseStatus) Fraction() (f float64, ok bool) {
+	switch {
+	case s.MaxBytes > 0:
+		f = float64(s.Bytes) / float64(s.MaxBytes)
+	case s.MaxItems > 0:
+		f = float64(s.Items) / float64(s.MaxItems)
+	default:
+		return 0, false
+	}
+
+	if f > 1 {
+		f = 1
+	}
+	return f, true
+}
+
+// ETA returns the estimated remaining time for the phase, extrapolated from
+// the progress made so far. If no estimate is possible yet, ok is false.
+func (s PhaseStatus) ETA() (eta time.Duration, ok bool) {
+	f, ok := s.Fraction()
+	if !ok || f <= 0 || s.Runtime <= 0 {
+		return 0, false
+	}
+
+	total := time.Duration(float64(s.Runtime) / f)
+	return total - s.Runtime, true
+}
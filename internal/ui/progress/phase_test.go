@@ -0,0 +1,55 @@
+package progress_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/test"
+	"github.com/restic/restic/internal/ui/progress"
+)
+
+func TestPhaseCounter(t *testing.T) {
+	var (
+		last      progress.PhaseStatus
+		finalSeen bool
+	)
+
+	c := progress.NewPhaseCounter(time.Millisecond, 10, 1000, func(s progress.PhaseStatus, final bool) {
+		test.Assert(t, s.Items <= s.MaxItems, "items %d exceed total %d", s.Items, s.MaxItems)
+		test.Assert(t, s.Bytes <= s.MaxBytes, "bytes %d exceed total %d", s.Bytes, s.MaxBytes)
+		last = s
+		finalSeen = final
+	})
+
+	for i := 0; i < 10; i++ {
+		time.Sleep(time.Millisecond)
+		c.Add(1)
+		c.AddBytes(100)
+	}
+	c.Done()
+
+	test.Assert(t, finalSeen, "final call did not happen")
+	test.Equals(t, uint64(10), last.Items)
+	test.Equals(t, uint64(10), last.MaxItems)
+	test.Equals(t, uint64(1000), last.Bytes)
+	test.Equals(t, uint64(1000), last.MaxBytes)
+}
+
+func TestPhaseStatusETA(t *testing.T) {
+	for _, c := range []struct {
+		s   progress.PhaseStatus
+		eta time.Duration
+		ok  bool
+	}{
+		{progress.PhaseStatus{Runtime: time.Minute}, 0, false},
+		{progress.PhaseStatus{MaxItems: 10, Runtime: time.Minute}, 0, false},
+		{progress.PhaseStatus{Items: 5, MaxItems: 10, Runtime: time.Minute}, time.Minute, true},
+		// bytes take precedence over items
+		{progress.PhaseStatus{Items: 5, MaxItems: 10, Bytes: 25, MaxBytes: 100, Runtime: time.Minute}, 3 * time.Minute, true},
+		{progress.PhaseStatus{Items: 10, MaxItems: 10, Runtime: time.Minute}, 0, true},
+	} {
+		eta, ok := c.s.ETA()
+		test.Equals(t, c.ok, ok)
+		test.Equals(t, c.eta, eta)
+	}
+}
@@ -2,9 +2,6 @@ package progress
 
 import (
 	"time"
-
-	"github.com/restic/restic/internal/debug"
-	"github.com/restic/restic/internal/ui/signals"
 )
 
 // An UpdateFunc is a callback for a (progress) Updater.
@@ -14,8 +11,6 @@ import (
 type UpdateFunc func(runtime time.Duration, final bool)
 
 // An Updater controls a goroutine that periodically calls an UpdateFunc.
-//
-// The UpdateFunc is also called when SIGUSR1 (or SIGINFO, on BSD) is received.
 type Updater struct {
 	report  UpdateFunc
 	start   time.Time
@@ -66,15 +61,11 @@ func (c *Updater) run() {
 	if c.tick != nil {
 		tick = c.tick.C
 	}
-	signalsCh := signals.GetProgressChannel()
 	for {
 		var now time.Time
 
 		select {
 		case now = <-tick:
-		case sig := <-signalsCh:
-			debug.Log("Signal received: %v\n", sig)
-			now = time.Now()
 		case <-c.stop:
 			return
 		}
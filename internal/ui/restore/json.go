@@ -37,7 +37,7 @@ func (t *jsonPrinter) Update(filesFinished, filesTotal, allBytesWritten, allByte
 	t.print(status)
 }
 
-func (t *jsonPrinter) Finish(filesFinished, filesTotal, allBytesWritten, allBytesTotal uint64, duration time.Duration) {
+func (t *jsonPrinter) Finish(filesFinished, filesTotal, allBytesWritten, allBytesTotal uint64, duration time.Duration, warnings []ui.WarningSummary, transfer *ui.TransferStats) {
 	status := summaryOutput{
 		MessageType:    "summary",
 		SecondsElapsed: uint64(duration / time.Second),
@@ -45,6 +45,8 @@ func (t *jsonPrinter) Finish(filesFinished, filesTotal, allBytesWritten, allByte
 		FilesRestored:  filesFinished,
 		TotalBytes:     allBytesTotal,
 		BytesRestored:  allBytesWritten,
+		Warnings:       warnings,
+		Transfer:       transfer,
 	}
 	t.print(status)
 }
@@ -60,10 +62,12 @@ type statusUpdate struct {
 }
 
 type summaryOutput struct {
-	MessageType    string `json:"message_type"` // "summary"
-	SecondsElapsed uint64 `json:"seconds_elapsed,omitempty"`
-	TotalFiles     uint64 `json:"total_files,omitempty"`
-	FilesRestored  uint64 `json:"files_restored,omitempty"`
-	TotalBytes     uint64 `json:"total_bytes,omitempty"`
-	BytesRestored  uint64 `json:"bytes_restored,omitempty"`
+	MessageType    string              `json:"message_type"` // "summary"
+	SecondsElapsed uint64              `json:"seconds_elapsed,omitempty"`
+	TotalFiles     uint64              `json:"total_files,omitempty"`
+	FilesRestored  uint64              `json:"files_restored,omitempty"`
+	TotalBytes     uint64              `json:"total_bytes,omitempty"`
+	BytesRestored  uint64              `json:"bytes_restored,omitempty"`
+	Warnings       []ui.WarningSummary `json:"warnings,omitempty"`
+	Transfer       *ui.TransferStats   `json:"transfer,omitempty"`
 }
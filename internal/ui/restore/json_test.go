@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/restic/restic/internal/test"
+	"github.com/restic/restic/internal/ui"
 )
 
 func TestJSONPrintUpdate(t *testing.T) {
@@ -17,13 +18,29 @@ func TestJSONPrintUpdate(t *testing.T) {
 func TestJSONPrintSummaryOnSuccess(t *testing.T) {
 	term := &mockTerm{}
 	printer := NewJSONProgress(term)
-	printer.Finish(11, 11, 47, 47, 5*time.Second)
+	printer.Finish(11, 11, 47, 47, 5*time.Second, nil, nil)
 	test.Equals(t, []string{"{\"message_type\":\"summary\",\"seconds_elapsed\":5,\"total_files\":11,\"files_restored\":11,\"total_bytes\":47,\"bytes_restored\":47}\n"}, term.output)
 }
 
 func TestJSONPrintSummaryOnErrors(t *testing.T) {
 	term := &mockTerm{}
 	printer := NewJSONProgress(term)
-	printer.Finish(3, 11, 29, 47, 5*time.Second)
+	printer.Finish(3, 11, 29, 47, 5*time.Second, nil, nil)
 	test.Equals(t, []string{"{\"message_type\":\"summary\",\"seconds_elapsed\":5,\"total_files\":11,\"files_restored\":3,\"total_bytes\":47,\"bytes_restored\":29}\n"}, term.output)
 }
+
+func TestJSONPrintSummaryWithWarnings(t *testing.T) {
+	term := &mockTerm{}
+	printer := NewJSONProgress(term)
+	printer.Finish(3, 11, 29, 47, 5*time.Second, []ui.WarningSummary{
+		{Category: "chmod failed", Count: 3, Examples: []string{"/a", "/b"}},
+	}, nil)
+	test.Equals(t, []string{"{\"message_type\":\"summary\",\"seconds_elapsed\":5,\"total_files\":11,\"files_restored\":3,\"total_bytes\":47,\"bytes_restored\":29,\"warnings\":[{\"category\":\"chmod failed\",\"count\":3,\"examples\":[\"/a\",\"/b\"]}]}\n"}, term.output)
+}
+
+func TestJSONPrintSummaryWithTransferStats(t *testing.T) {
+	term := &mockTerm{}
+	printer := NewJSONProgress(term)
+	printer.Finish(11, 11, 47, 47, 5*time.Second, nil, &ui.TransferStats{Requests: 4, BytesDownloaded: 1234})
+	test.Equals(t, []string{"{\"message_type\":\"summary\",\"seconds_elapsed\":5,\"total_files\":11,\"files_restored\":11,\"total_bytes\":47,\"bytes_restored\":47,\"transfer\":{\"requests\":4,\"bytes_uploaded\":0,\"bytes_downloaded\":1234}}\n"}, term.output)
+}
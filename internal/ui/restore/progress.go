@@ -4,6 +4,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/restic/restic/internal/ui"
 	"github.com/restic/restic/internal/ui/progress"
 )
 
@@ -17,10 +18,16 @@ type Progress struct {
 	allBytesWritten uint64
 	allBytesTotal   uint64
 	started         time.Time
+	warnings        *ui.Warnings
+	transfer        *ui.TransferStats
 
 	printer ProgressPrinter
 }
 
+// maxWarningExamples is the number of items kept for each category of
+// warnings.
+const maxWarningExamples = 5
+
 type progressInfoEntry struct {
 	bytesWritten uint64
 	bytesTotal   uint64
@@ -33,13 +40,14 @@ type term interface {
 
 type ProgressPrinter interface {
 	Update(filesFinished, filesTotal, allBytesWritten, allBytesTotal uint64, duration time.Duration)
-	Finish(filesFinished, filesTotal, allBytesWritten, allBytesTotal uint64, duration time.Duration)
+	Finish(filesFinished, filesTotal, allBytesWritten, allBytesTotal uint64, duration time.Duration, warnings []ui.WarningSummary, transfer *ui.TransferStats)
 }
 
 func NewProgress(printer ProgressPrinter, interval time.Duration) *Progress {
 	p := &Progress{
 		progressInfoMap: make(map[string]progressInfoEntry),
 		started:         time.Now(),
+		warnings:        ui.NewWarnings(maxWarningExamples),
 		printer:         printer,
 	}
 	p.updater = *progress.NewUpdater(interval, p.update)
@@ -53,7 +61,7 @@ func (p *Progress) update(runtime time.Duration, final bool) {
 	if !final {
 		p.printer.Update(p.filesFinished, p.filesTotal, p.allBytesWritten, p.allBytesTotal, runtime)
 	} else {
-		p.printer.Finish(p.filesFinished, p.filesTotal, p.allBytesWritten, p.allBytesTotal, runtime)
+		p.printer.Finish(p.filesFinished, p.filesTotal, p.allBytesWritten, p.allBytesTotal, runtime, p.warnings.Summary(), p.transfer)
 	}
 }
 
@@ -85,6 +93,35 @@ func (p *Progress) AddProgress(name string, bytesWrittenPortion uint64, bytesTot
 	}
 }
 
+// Error records the error for item for the summary of warnings.
+func (p *Progress) Error(item string, err error) {
+	p.warnings.Add(item, err)
+}
+
+// Status returns a snapshot of the restore progress.
+func (p *Progress) Status() ui.Status {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	return ui.Status{
+		Operation:  "restore",
+		Items:      p.filesFinished,
+		TotalItems: p.filesTotal,
+		ItemUnit:   "files",
+		Bytes:      p.allBytesWritten,
+		TotalBytes: p.allBytesTotal,
+		Elapsed:    time.Since(p.started),
+	}
+}
+
+// SetTransferStats records the backend requests for the summary, it must be
+// called before Finish.
+func (p *Progress) SetTransferStats(s ui.TransferStats) {
+	p.m.Lock()
+	defer p.m.Unlock()
+	p.transfer = &s
+}
+
 func (p *Progress) Finish() {
 	p.updater.Done()
 }
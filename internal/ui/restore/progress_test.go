@@ -1,10 +1,13 @@
 package restore
 
 import (
+	"os"
 	"testing"
 	"time"
 
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/test"
+	"github.com/restic/restic/internal/ui"
 )
 
 type printerTraceEntry struct {
@@ -25,7 +28,7 @@ const mockFinishDuration = 42 * time.Second
 func (p *mockPrinter) Update(filesFinished, filesTotal, allBytesWritten, allBytesTotal uint64, duration time.Duration) {
 	p.trace = append(p.trace, printerTraceEntry{filesFinished, filesTotal, allBytesWritten, allBytesTotal, duration, false})
 }
-func (p *mockPrinter) Finish(filesFinished, filesTotal, allBytesWritten, allBytesTotal uint64, _ time.Duration) {
+func (p *mockPrinter) Finish(filesFinished, filesTotal, allBytesWritten, allBytesTotal uint64, _ time.Duration, _ []ui.WarningSummary, _ *ui.TransferStats) {
 	p.trace = append(p.trace, printerTraceEntry{filesFinished, filesTotal, allBytesWritten, allBytesTotal, mockFinishDuration, true})
 }
 
@@ -135,3 +138,24 @@ func TestSummaryOnErrors(t *testing.T) {
 		printerTraceEntry{1, 2, 50 + fileSize/2, 50 + fileSize, mockFinishDuration, true},
 	}, result)
 }
+
+func TestProgressWarnings(t *testing.T) {
+	printer := &warningsPrinter{}
+	progress := NewProgress(printer, 0)
+	progress.Error("/foo", &os.PathError{Op: "chmod", Path: "/foo", Err: errors.New("read-only file system")})
+	progress.Error("/bar", &os.PathError{Op: "chmod", Path: "/bar", Err: errors.New("read-only file system")})
+	progress.Finish()
+
+	test.Equals(t, []ui.WarningSummary{
+		{Category: "chmod failed", Count: 2, Examples: []string{"/foo", "/bar"}},
+	}, printer.warnings)
+}
+
+type warningsPrinter struct {
+	mockPrinter
+	warnings []ui.WarningSummary
+}
+
+func (p *warningsPrinter) Finish(_, _, _, _ uint64, _ time.Duration, warnings []ui.WarningSummary, _ *ui.TransferStats) {
+	p.warnings = warnings
+}
@@ -28,9 +28,13 @@ func (t *textPrinter) Update(filesFinished, filesTotal, allBytesWritten, allByte
 	t.terminal.SetStatus([]string{progress})
 }
 
-func (t *textPrinter) Finish(filesFinished, filesTotal, allBytesWritten, allBytesTotal uint64, duration time.Duration) {
+func (t *textPrinter) Finish(filesFinished, filesTotal, allBytesWritten, allBytesTotal uint64, duration time.Duration, warnings []ui.WarningSummary, transfer *ui.TransferStats) {
 	t.terminal.SetStatus([]string{})
 
+	for _, line := range ui.FormatWarnings(warnings) {
+		t.terminal.Print(line)
+	}
+
 	timeLeft := ui.FormatDuration(duration)
 	formattedAllBytesTotal := ui.FormatBytes(allBytesTotal)
 
@@ -44,4 +48,7 @@ func (t *textPrinter) Finish(filesFinished, filesTotal, allBytesWritten, allByte
 	}
 
 	t.terminal.Print(summary)
+	if transfer != nil {
+		t.terminal.Print(fmt.Sprintf("Backend: %s", ui.FormatTransferStats(*transfer)))
+	}
 }
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/restic/restic/internal/test"
+	"github.com/restic/restic/internal/ui"
 )
 
 type mockTerm struct {
@@ -29,13 +30,38 @@ func TestPrintUpdate(t *testing.T) {
 func TestPrintSummaryOnSuccess(t *testing.T) {
 	term := &mockTerm{}
 	printer := NewTextProgress(term)
-	printer.Finish(11, 11, 47, 47, 5*time.Second)
+	printer.Finish(11, 11, 47, 47, 5*time.Second, nil, nil)
 	test.Equals(t, []string{"Summary: Restored 11 Files (47 B) in 0:05"}, term.output)
 }
 
 func TestPrintSummaryOnErrors(t *testing.T) {
 	term := &mockTerm{}
 	printer := NewTextProgress(term)
-	printer.Finish(3, 11, 29, 47, 5*time.Second)
+	printer.Finish(3, 11, 29, 47, 5*time.Second, nil, nil)
 	test.Equals(t, []string{"Summary: Restored 3 / 11 Files (29 B / 47 B) in 0:05"}, term.output)
 }
+
+func TestPrintSummaryWithWarnings(t *testing.T) {
+	term := &mockTerm{}
+	printer := NewTextProgress(term)
+	printer.Finish(3, 11, 29, 47, 5*time.Second, []ui.WarningSummary{
+		{Category: "chmod failed", Count: 3, Examples: []string{"/a", "/b"}},
+		{Category: "permission denied", Count: 1, Examples: []string{"/c"}},
+	}, nil)
+	test.Equals(t, []string{
+		"Warnings:",
+		"  3 chmod failed, e.g. /a, /b and 1 more",
+		"  1 permission denied, e.g. /c",
+		"Summary: Restored 3 / 11 Files (29 B / 47 B) in 0:05",
+	}, term.output)
+}
+
+func TestPrintSummaryWithTransferStats(t *testing.T) {
+	term := &mockTerm{}
+	printer := NewTextProgress(term)
+	printer.Finish(11, 11, 47, 47, 5*time.Second, nil, &ui.TransferStats{Requests: 4, BytesDownloaded: 1234})
+	test.Equals(t, []string{
+		"Summary: Restored 11 Files (47 B) in 0:05",
+		"Backend: 4 requests, 0 B uploaded, 1.205 KiB downloaded",
+	}, term.output)
+}
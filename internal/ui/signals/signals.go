@@ -6,7 +6,7 @@ import (
 )
 
 // GetProgressChannel returns a channel with which a single listener
-// receives each incoming signal.
+// receives each incoming signal which requests a status report.
 func GetProgressChannel() <-chan os.Signal {
 	signals.Once.Do(func() {
 		signals.ch = make(chan os.Signal, 1)
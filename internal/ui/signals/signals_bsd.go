@@ -4,6 +4,7 @@
 package signals
 
 import (
+	"os"
 	"os/signal"
 	"syscall"
 )
@@ -11,3 +12,9 @@ import (
 func setupSignals() {
 	signal.Notify(signals.ch, syscall.SIGINFO, syscall.SIGUSR1)
 }
+
+// TogglesRate returns true if sig also toggles whether the status report
+// includes the transfer rate. This is the case for SIGINFO.
+func TogglesRate(sig os.Signal) bool {
+	return sig == syscall.SIGINFO
+}
@@ -4,6 +4,7 @@
 package signals
 
 import (
+	"os"
 	"os/signal"
 	"syscall"
 )
@@ -11,3 +12,9 @@ import (
 func setupSignals() {
 	signal.Notify(signals.ch, syscall.SIGUSR1)
 }
+
+// TogglesRate returns true if sig also toggles whether the status report
+// includes the transfer rate. SIGINFO is not available on this platform.
+func TogglesRate(_ os.Signal) bool {
+	return false
+}
@@ -1,3 +1,11 @@
 package signals
 
+import "os"
+
 func setupSignals() {}
+
+// TogglesRate returns true if sig also toggles whether the status report
+// includes the transfer rate. No signals are handled on Windows.
+func TogglesRate(_ os.Signal) bool {
+	return false
+}
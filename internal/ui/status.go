@@ -0,0 +1,116 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Status is a snapshot of the progress of the currently running operation.
+// The totals are zero if they are not known.
+type Status struct {
+	Operation  string
+	Items      uint64
+	TotalItems uint64
+	// ItemUnit describes the items, for example "files" or "packs".
+	ItemUnit   string
+	Bytes      uint64
+	TotalBytes uint64
+	Elapsed    time.Duration
+}
+
+// A StatusFunc returns a snapshot of the progress of an operation. It must
+// be safe to call it concurrently with the operation.
+type StatusFunc func() Status
+
+var statusRegistry struct {
+	sync.Mutex
+	next    int
+	entries []statusEntry
+}
+
+type statusEntry struct {
+	id int
+	fn StatusFunc
+}
+
+// RegisterStatus installs fn as the source of status snapshots until the
+// returned function is called. If several functions are registered, the most
+// recent one is used.
+func RegisterStatus(fn StatusFunc) (unregister func()) {
+	statusRegistry.Lock()
+	defer statusRegistry.Unlock()
+
+	id := statusRegistry.next
+	statusRegistry.next++
+	statusRegistry.entries = append(statusRegistry.entries, statusEntry{id: id, fn: fn})
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			statusRegistry.Lock()
+			defer statusRegistry.Unlock()
+
+			for i, e := range statusRegistry.entries {
+				if e.id == id {
+					statusRegistry.entries = append(statusRegistry.entries[:i], statusRegistry.entries[i+1:]...)
+					break
+				}
+			}
+		})
+	}
+}
+
+// CurrentStatus returns a snapshot of the progress of the most recently
+// registered operation. If no operation is registered, ok is false.
+func CurrentStatus() (s Status, ok bool) {
+	statusRegistry.Lock()
+	if len(statusRegistry.entries) == 0 {
+		statusRegistry.Unlock()
+		return Status{}, false
+	}
+	fn := statusRegistry.entries[len(statusRegistry.entries)-1].fn
+	statusRegistry.Unlock()
+
+	return fn(), true
+}
+
+// Format returns a single line describing the status. If showRate is set,
+// the average rate of processed bytes is included.
+func (s Status) Format(showRate bool) string {
+	var parts []string
+	if s.Operation != "" {
+		parts = append(parts, s.Operation)
+	}
+
+	switch {
+	case s.TotalBytes > 0:
+		parts = append(parts, FormatPercent(s.Bytes, s.TotalBytes)+" done")
+	case s.TotalItems > 0:
+		parts = append(parts, FormatPercent(s.Items, s.TotalItems)+" done")
+	}
+
+	unit := s.ItemUnit
+	if unit == "" {
+		unit = "items"
+	}
+	if s.TotalItems > 0 {
+		parts = append(parts, fmt.Sprintf("%d / %d %s", s.Items, s.TotalItems, unit))
+	} else {
+		parts = append(parts, fmt.Sprintf("%d %s", s.Items, unit))
+	}
+
+	if s.TotalBytes > 0 {
+		parts = append(parts, FormatBytes(s.Bytes)+" / "+FormatBytes(s.TotalBytes))
+	} else if s.Bytes > 0 {
+		parts = append(parts, FormatBytes(s.Bytes))
+	}
+
+	parts = append(parts, "elapsed "+FormatDuration(s.Elapsed))
+	if showRate {
+		parts = append(parts, FormatRate(s.Bytes, s.Elapsed))
+	}
+
+	return strings.Join(parts, ", ")
+}
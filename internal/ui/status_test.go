@@ -0,0 +1,62 @@
+package ui
+
+import (
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/test"
+)
+
+func TestRegisterStatus(t *testing.T) {
+	_, ok := CurrentStatus()
+	test.Assert(t, !ok, "unexpected status without registered operation")
+
+	unregisterOuter := RegisterStatus(func() Status { return Status{Operation: "outer"} })
+	unregisterInner := RegisterStatus(func() Status { return Status{Operation: "inner"} })
+
+	s, ok := CurrentStatus()
+	test.Assert(t, ok, "missing status")
+	test.Equals(t, "inner", s.Operation)
+
+	unregisterInner()
+	// unregistering twice must not remove other entries
+	unregisterInner()
+	s, ok = CurrentStatus()
+	test.Assert(t, ok, "missing status")
+	test.Equals(t, "outer", s.Operation)
+
+	unregisterOuter()
+	_, ok = CurrentStatus()
+	test.Assert(t, !ok, "unexpected status after unregistering all operations")
+}
+
+func TestStatusFormat(t *testing.T) {
+	for _, c := range []struct {
+		s        Status
+		showRate bool
+		want     string
+	}{
+		{
+			Status{Operation: "backup", Items: 3, TotalItems: 4, ItemUnit: "files", Bytes: 1 << 20, TotalBytes: 4 << 20, Elapsed: 2 * time.Second},
+			false,
+			"backup, 25.00% done, 3 / 4 files, 1.000 MiB / 4.000 MiB, elapsed 0:02",
+		},
+		{
+			Status{Operation: "backup", Items: 3, TotalItems: 4, ItemUnit: "files", Bytes: 1 << 20, TotalBytes: 4 << 20, Elapsed: 2 * time.Second},
+			true,
+			"backup, 25.00% done, 3 / 4 files, 1.000 MiB / 4.000 MiB, elapsed 0:02, 512.000 KiB/s",
+		},
+		{
+			Status{Operation: "check", Items: 5, TotalItems: 10, ItemUnit: "packs", Elapsed: 65 * time.Second},
+			false,
+			"check, 50.00% done, 5 / 10 packs, elapsed 1:05",
+		},
+		{
+			Status{Operation: "prune", Items: 7, Elapsed: time.Second},
+			false,
+			"prune, 7 items, elapsed 0:01",
+		},
+	} {
+		test.Equals(t, c.want, c.s.Format(c.showRate))
+	}
+}
@@ -81,6 +81,14 @@ func New(wr io.Writer, errWriter io.Writer, disableStatus bool) *Terminal {
 	return t
 }
 
+// NoColor returns true if the NO_COLOR environment variable is set to a
+// non-empty value, see https://no-color.org. In this case no escape sequences
+// are written to the terminal, status lines are printed like for a
+// non-interactive terminal.
+func NoColor() bool {
+	return os.Getenv("NO_COLOR") != ""
+}
+
 // CanUpdateStatus return whether the status output is updated in place.
 func (t *Terminal) CanUpdateStatus() bool {
 	return t.canUpdateStatus
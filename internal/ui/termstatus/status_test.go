@@ -5,7 +5,9 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"os"
 	"strconv"
+	"strings"
 	"testing"
 
 	rtest "github.com/restic/restic/internal/test"
@@ -153,3 +155,30 @@ func TestSanitizeLines(t *testing.T) {
 		})
 	}
 }
+
+func TestNoColor(t *testing.T) {
+	t.Setenv("NO_COLOR", "")
+	rtest.Assert(t, !NoColor(), "empty NO_COLOR must be ignored")
+
+	t.Setenv("NO_COLOR", "1")
+	rtest.Assert(t, NoColor(), "NO_COLOR not detected")
+	rtest.Assert(t, !CanUpdateStatus(os.Stdout.Fd()), "status must not be updated in place with NO_COLOR")
+}
+
+func TestSetStatusPlain(t *testing.T) {
+	var buf bytes.Buffer
+	term := New(&buf, io.Discard, false)
+	rtest.Assert(t, !term.CanUpdateStatus(), "status can be updated for a buffer")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go term.Run(ctx)
+
+	term.SetStatus([]string{"first"})
+	term.SetStatus([]string{"foo", "bar"})
+	term.Print("message")
+	cancel()
+	<-term.closed
+
+	rtest.Equals(t, "first\nfoo\nbar\nmessage\n", buf.String())
+	rtest.Assert(t, !strings.ContainsAny(buf.String(), "\x1b\r"), "output contains control characters: %q", buf.String())
+}
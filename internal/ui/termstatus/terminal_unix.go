@@ -22,8 +22,12 @@ func moveCursorUp(_ uintptr) func(io.Writer, uintptr, int) {
 }
 
 // CanUpdateStatus returns true if status lines can be printed, the process
-// output is not redirected to a file or pipe.
+// output is not redirected to a file or pipe, the terminal is not a dumb
+// terminal and NO_COLOR is not set.
 func CanUpdateStatus(fd uintptr) bool {
+	if NoColor() {
+		return false
+	}
 	if !term.IsTerminal(int(fd)) {
 		return false
 	}
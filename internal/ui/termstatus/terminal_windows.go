@@ -99,8 +99,12 @@ func getFileNameByHandle(fd uintptr) (string, error) {
 }
 
 // CanUpdateStatus returns true if status lines can be printed, the process
-// output is not redirected to a file or pipe.
+// output is not redirected to a file or pipe and NO_COLOR is not set.
 func CanUpdateStatus(fd uintptr) bool {
+	if NoColor() {
+		return false
+	}
+
 	// easy case, the terminal is cmd or psh, without redirection
 	if isWindowsTerminal(fd) {
 		return true
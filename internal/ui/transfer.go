@@ -0,0 +1,17 @@
+package ui
+
+import "fmt"
+
+// TransferStats contains the number of requests sent to the backend and the
+// amount of data transferred while running a command.
+type TransferStats struct {
+	Requests        uint64 `json:"requests"`
+	BytesUploaded   uint64 `json:"bytes_uploaded"`
+	BytesDownloaded uint64 `json:"bytes_downloaded"`
+}
+
+// FormatTransferStats returns a short description of s.
+func FormatTransferStats(s TransferStats) string {
+	return fmt.Sprintf("%d requests, %s uploaded, %s downloaded",
+		s.Requests, FormatBytes(s.BytesUploaded), FormatBytes(s.BytesDownloaded))
+}
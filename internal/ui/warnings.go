@@ -0,0 +1,139 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// maxWarningCategories limits the number of categories kept by Warnings,
+// further warnings are counted in the category "other".
+const maxWarningCategories = 20
+
+// WarningSummary contains the number of warnings of one category and some
+// of the affected items.
+type WarningSummary struct {
+	Category string   `json:"category"`
+	Count    uint64   `json:"count"`
+	Examples []string `json:"examples"`
+}
+
+// Warnings collects warnings by category. For each category only the number
+// of warnings and up to a fixed number of example items are kept, so the
+// memory usage is bounded independent of the number of warnings. It is safe
+// to use from concurrent goroutines.
+type Warnings struct {
+	m           sync.Mutex
+	maxExamples int
+	categories  map[string]*WarningSummary
+}
+
+// NewWarnings returns a collection of warnings which keeps up to maxExamples
+// items for each category.
+func NewWarnings(maxExamples int) *Warnings {
+	return &Warnings{
+		maxExamples: maxExamples,
+		categories:  make(map[string]*WarningSummary),
+	}
+}
+
+// WarningCategory returns a short description of the kind of the error, for
+// example "permission denied" or "chmod failed".
+func WarningCategory(err error) string {
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return "file not found"
+	case errors.Is(err, os.ErrPermission):
+		return "permission denied"
+	}
+
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Op + " failed"
+	}
+	var linkErr *os.LinkError
+	if errors.As(err, &linkErr) {
+		return linkErr.Op + " failed"
+	}
+	var syscallErr *os.SyscallError
+	if errors.As(err, &syscallErr) {
+		return syscallErr.Syscall + " failed"
+	}
+
+	return "other"
+}
+
+// Add records a warning for item.
+func (w *Warnings) Add(item string, err error) {
+	w.AddCategory(WarningCategory(err), item)
+}
+
+// AddCategory records a warning of the given category for item.
+func (w *Warnings) AddCategory(category string, item string) {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	s, ok := w.categories[category]
+	if !ok && len(w.categories) >= maxWarningCategories {
+		category = "other"
+		s, ok = w.categories[category]
+	}
+	if !ok {
+		s = &WarningSummary{Category: category}
+		w.categories[category] = s
+	}
+
+	s.Count++
+	if len(s.Examples) < w.maxExamples {
+		s.Examples = append(s.Examples, item)
+	}
+}
+
+// Summary returns the warnings for all categories, the most frequent first.
+func (w *Warnings) Summary() []WarningSummary {
+	if w == nil {
+		return nil
+	}
+
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	var summary []WarningSummary
+	for _, s := range w.categories {
+		summary = append(summary, WarningSummary{
+			Category: s.Category,
+			Count:    s.Count,
+			Examples: append([]string{}, s.Examples...),
+		})
+	}
+
+	sort.Slice(summary, func(i, j int) bool {
+		if summary[i].Count != summary[j].Count {
+			return summary[i].Count > summary[j].Count
+		}
+		return summary[i].Category < summary[j].Category
+	})
+	return summary
+}
+
+// FormatWarnings returns a compact description of the warnings with one line
+// per category, or an empty slice if there were no warnings.
+func FormatWarnings(summary []WarningSummary) []string {
+	if len(summary) == 0 {
+		return nil
+	}
+
+	lines := []string{"Warnings:"}
+	for _, s := range summary {
+		line := fmt.Sprintf("  %d %s, e.g. %s", s.Count, s.Category, strings.Join(s.Examples, ", "))
+		if more := s.Count - uint64(len(s.Examples)); more > 0 {
+			line += fmt.Sprintf(" and %d more", more)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
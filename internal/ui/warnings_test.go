@@ -0,0 +1,70 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/test"
+)
+
+func TestWarningCategory(t *testing.T) {
+	for _, c := range []struct {
+		err  error
+		want string
+	}{
+		{&os.PathError{Op: "lstat", Path: "/foo", Err: os.ErrNotExist}, "file not found"},
+		{errors.WithStack(&os.PathError{Op: "open", Path: "/foo", Err: os.ErrPermission}), "permission denied"},
+		{errors.Wrap(&os.PathError{Op: "chmod", Path: "/foo", Err: errors.New("read-only file system")}, "RestoreMetadata"), "chmod failed"},
+		{&os.LinkError{Op: "symlink", Old: "a", New: "b", Err: errors.New("foo")}, "symlink failed"},
+		{os.NewSyscallError("fsync", errors.New("foo")), "fsync failed"},
+		{errors.New("something else"), "other"},
+	} {
+		test.Equals(t, c.want, WarningCategory(c.err))
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	w := NewWarnings(2)
+	test.Equals(t, 0, len(w.Summary()))
+	test.Equals(t, 0, len(FormatWarnings(w.Summary())))
+
+	for i := 0; i < 5; i++ {
+		w.Add(fmt.Sprintf("/denied/%d", i), &os.PathError{Op: "open", Path: "x", Err: os.ErrPermission})
+	}
+	w.Add("/vanished", &os.PathError{Op: "lstat", Path: "x", Err: os.ErrNotExist})
+	w.Add("/other", errors.New("foo"))
+
+	summary := w.Summary()
+	test.Equals(t, []WarningSummary{
+		{Category: "permission denied", Count: 5, Examples: []string{"/denied/0", "/denied/1"}},
+		{Category: "file not found", Count: 1, Examples: []string{"/vanished"}},
+		{Category: "other", Count: 1, Examples: []string{"/other"}},
+	}, summary)
+
+	test.Equals(t, []string{
+		"Warnings:",
+		"  5 permission denied, e.g. /denied/0, /denied/1 and 3 more",
+		"  1 file not found, e.g. /vanished",
+		"  1 other, e.g. /other",
+	}, FormatWarnings(summary))
+}
+
+func TestWarningsBounded(t *testing.T) {
+	w := NewWarnings(3)
+	for i := 0; i < 1000; i++ {
+		op := fmt.Sprintf("op%d", i%100)
+		w.Add(fmt.Sprintf("/file/%d", i), &os.PathError{Op: op, Path: "x", Err: errors.New("foo")})
+	}
+
+	summary := w.Summary()
+	test.Assert(t, len(summary) <= maxWarningCategories+1, "too many categories: %d", len(summary))
+
+	var count uint64
+	for _, s := range summary {
+		count += s.Count
+		test.Assert(t, len(s.Examples) <= 3, "too many examples for %v: %d", s.Category, len(s.Examples))
+	}
+	test.Equals(t, uint64(1000), count)
+}
@@ -0,0 +1,65 @@
+package walker
+
+import (
+	"context"
+	"sort"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+// DiffFunc is called by DiffTrees for each name contained in at least one of
+// the compared trees. node1 is nil if the name only exists in the second tree,
+// node2 is nil if it only exists in the first tree.
+type DiffFunc func(name string, node1, node2 *restic.Node) error
+
+// DiffTrees loads the trees id1 and id2 and calls fn for the nodes of both
+// trees, ordered by their names. Subtrees are not descended into, fn can call
+// DiffTrees for the subtrees of two dir nodes. If fn returns an error, it is
+// passed up.
+func DiffTrees(ctx context.Context, repo restic.BlobLoader, id1, id2 restic.ID, fn DiffFunc) error {
+	tree1, err := restic.LoadTree(ctx, repo, id1)
+	if err != nil {
+		return err
+	}
+
+	tree2, err := restic.LoadTree(ctx, repo, id2)
+	if err != nil {
+		return err
+	}
+
+	tree1Nodes, tree2Nodes, names := uniqueNodeNames(tree1, tree2)
+	for _, name := range names {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		err := fn(name, tree1Nodes[name], tree2Nodes[name])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func uniqueNodeNames(tree1, tree2 *restic.Tree) (tree1Nodes, tree2Nodes map[string]*restic.Node, uniqueNames []string) {
+	names := make(map[string]struct{})
+	tree1Nodes = make(map[string]*restic.Node)
+	for _, node := range tree1.Nodes {
+		tree1Nodes[node.Name] = node
+		names[node.Name] = struct{}{}
+	}
+
+	tree2Nodes = make(map[string]*restic.Node)
+	for _, node := range tree2.Nodes {
+		tree2Nodes[node.Name] = node
+		names[node.Name] = struct{}{}
+	}
+
+	uniqueNames = make([]string, 0, len(names))
+	for name := range names {
+		uniqueNames = append(uniqueNames, name)
+	}
+
+	sort.Strings(uniqueNames)
+	return tree1Nodes, tree2Nodes, uniqueNames
+}
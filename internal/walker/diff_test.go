@@ -0,0 +1,40 @@
+package walker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestDiffTrees(t *testing.T) {
+	repo, root1 := BuildTreeMap(TestTree{
+		"a":   TestFile{Size: 1},
+		"b":   TestFile{Size: 2},
+		"dir": TestTree{"x": TestFile{}},
+	})
+	m2, root2 := BuildTreeMap(TestTree{
+		"b":   TestFile{Size: 3},
+		"c":   TestFile{},
+		"dir": TestTree{"y": TestFile{}},
+	})
+	for id, buf := range m2 {
+		repo[id] = buf
+	}
+
+	var got []string
+	err := DiffTrees(context.TODO(), repo, root1, root2, func(name string, node1, node2 *restic.Node) error {
+		switch {
+		case node1 == nil:
+			got = append(got, "+"+name)
+		case node2 == nil:
+			got = append(got, "-"+name)
+		default:
+			got = append(got, "="+name)
+		}
+		return nil
+	})
+	rtest.OK(t, err)
+	rtest.Equals(t, []string{"-a", "=b", "+c", "=dir"}, got)
+}
@@ -0,0 +1,136 @@
+package walker
+
+import (
+	"context"
+	"path"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+// ParallelWalkFunc is the type of the function called for each node visited
+// by ParallelWalk. Path is the slash-separated path from the root node. The
+// function is never called concurrently.
+//
+// For dir nodes, the function is called before the subtree is loaded. If it
+// returns ErrSkipNode, the subtree is not walked. If loading the subtree
+// fails, the function is called again for the dir node with nodeErr set. For
+// all other nodes, returning ErrSkipNode skips the remaining nodes of the
+// tree. Any other error aborts the walk.
+type ParallelWalkFunc func(parentTreeID restic.ID, path string, node *restic.Node, nodeErr error) error
+
+// ParallelWalkOptions configures ParallelWalk.
+type ParallelWalkOptions struct {
+	// Workers is the number of trees loaded concurrently. If it is zero, a
+	// default based on the number of backend connections is used.
+	Workers int
+	// UniqueTrees walks each subtree only once, even if it is referenced at
+	// several paths.
+	UniqueTrees bool
+}
+
+// parallelWalkJob holds the position of a subtree passed to
+// restic.ParallelWalkTrees.
+type parallelWalkJob struct {
+	parentTreeID restic.ID
+	path         string
+	// node is nil for the root tree
+	node *restic.Node
+	// depth is the nesting depth of the subtree of node
+	depth int
+}
+
+type parallelWalker struct {
+	fn      ParallelWalkFunc
+	visited restic.IDSet
+}
+
+// ParallelWalk calls fn for each node in root. In contrast to Walk, subtrees
+// are loaded concurrently, so nodes are not visited in a fixed order. The
+// nodes within one tree are visited sorted by name. Each tree is visited
+// exactly once for each path it is referenced at, or only once overall if
+// opts.UniqueTrees is set. The root tree is passed to fn as a nil node with
+// path "/".
+func ParallelWalk(ctx context.Context, repo restic.TreeLoader, root restic.ID, fn ParallelWalkFunc, opts ParallelWalkOptions) error {
+	w := &parallelWalker{fn: fn}
+	if opts.UniqueTrees {
+		w.visited = restic.NewIDSet(root)
+	}
+
+	roots := []restic.TreeJob[parallelWalkJob]{{ID: root, Data: parallelWalkJob{parentTreeID: root, path: "/"}}}
+	return restic.ParallelWalkTrees(ctx, repo, opts.Workers, roots, w.visit, nil)
+}
+
+// visit calls fn for the nodes of the loaded tree and returns the subtrees
+// to walk next. It is never called concurrently.
+func (w *parallelWalker) visit(job restic.TreeJob[parallelWalkJob], tree *restic.Tree, err error) ([]restic.TreeJob[parallelWalkJob], error) {
+	if job.Data.node == nil {
+		// the root tree
+		err = w.fn(job.Data.parentTreeID, job.Data.path, nil, err)
+		if err != nil || tree == nil {
+			if err == ErrSkipNode {
+				err = nil
+			}
+			return nil, err
+		}
+	} else if err != nil {
+		err = w.fn(job.Data.parentTreeID, job.Data.path, job.Data.node, err)
+		if err == ErrSkipNode {
+			err = nil
+		}
+		return nil, err
+	}
+
+	return w.walkTree(job.ID, job.Data.path, job.Data.depth, tree)
+}
+
+// walkTree calls fn for all nodes in tree and returns the subtrees to walk.
+// depth is the nesting depth of tree.
+func (w *parallelWalker) walkTree(treeID restic.ID, prefix string, depth int, tree *restic.Tree) ([]restic.TreeJob[parallelWalkJob], error) {
+	sort.Slice(tree.Nodes, func(i, j int) bool {
+		return tree.Nodes[i].Name < tree.Nodes[j].Name
+	})
+
+	var subtrees []restic.TreeJob[parallelWalkJob]
+	for _, node := range tree.Nodes {
+		p := path.Join(prefix, node.Name)
+
+		if node.Type == "" {
+			return nil, errors.Errorf("node type is empty for node %q", node.Name)
+		}
+		if node.Type == "dir" && node.Subtree == nil {
+			return nil, errors.Errorf("subtree for node %v in tree %v is nil", node.Name, p)
+		}
+
+		err := w.fn(treeID, p, node, nil)
+		if err == ErrSkipNode {
+			if node.Type == "dir" {
+				continue
+			}
+			// skip the remaining entries in this tree
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if node.Type == "dir" {
+			if err := restic.CheckTreeDepth(depth + 1); err != nil {
+				return nil, errors.Wrapf(err, "subtree %v", node.Subtree.Str())
+			}
+			if w.visited != nil {
+				if w.visited.Has(*node.Subtree) {
+					continue
+				}
+				w.visited.Insert(*node.Subtree)
+			}
+			subtrees = append(subtrees, restic.TreeJob[parallelWalkJob]{
+				ID:   *node.Subtree,
+				Data: parallelWalkJob{parentTreeID: treeID, path: p, node: node, depth: depth + 1},
+			})
+		}
+	}
+	return subtrees, nil
+}
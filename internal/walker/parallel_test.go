@@ -0,0 +1,305 @@
+package walker
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// collectParallel walks the tree using ParallelWalk and returns the sorted list
+// of visited paths.
+func collectParallel(t testing.TB, repo restic.TreeLoader, root restic.ID, opts ParallelWalkOptions, skip map[string]struct{}) []string {
+	var paths []string
+	err := ParallelWalk(context.TODO(), repo, root, func(_ restic.ID, path string, node *restic.Node, err error) error {
+		if err != nil {
+			return err
+		}
+		paths = append(paths, path)
+		if _, ok := skip[path]; ok {
+			return ErrSkipNode
+		}
+		return nil
+	}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// collectSequential walks the tree using Walk and returns the sorted list of
+// visited paths.
+func collectSequential(t testing.TB, repo restic.TreeLoader, root restic.ID) []string {
+	var paths []string
+	err := Walk(context.TODO(), repo, root, restic.NewIDSet(), func(_ restic.ID, path string, node *restic.Node, err error) (bool, error) {
+		if err != nil {
+			return false, err
+		}
+		paths = append(paths, path)
+		return false, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+var parallelTestTree = TestTree{
+	"foo": TestFile{},
+	"a": TestTree{
+		"file":  TestFile{Size: 1},
+		"file2": TestFile{Size: 2},
+		"sub": TestTree{
+			"x": TestFile{},
+		},
+	},
+	// b and c have the same content as a and therefore the same subtree ID
+	"b": TestTree{
+		"file":  TestFile{Size: 1},
+		"file2": TestFile{Size: 2},
+		"sub": TestTree{
+			"x": TestFile{},
+		},
+	},
+	"c": TestTree{
+		"file":  TestFile{Size: 1},
+		"file2": TestFile{Size: 2},
+		"sub": TestTree{
+			"x": TestFile{},
+		},
+	},
+	"empty": TestTree{},
+}
+
+func TestParallelWalk(t *testing.T) {
+	repo, root := BuildTreeMap(parallelTestTree)
+
+	want := collectSequential(t, repo, root)
+	for _, workers := range []int{0, 1, 2, 20} {
+		t.Run(fmt.Sprintf("workers-%d", workers), func(t *testing.T) {
+			for i := 0; i < 10; i++ {
+				got := collectParallel(t, repo, root, ParallelWalkOptions{Workers: workers}, nil)
+				if !cmp.Equal(want, got) {
+					t.Fatal(cmp.Diff(want, got))
+				}
+			}
+		})
+	}
+}
+
+func TestParallelWalkUniqueTrees(t *testing.T) {
+	repo, root := BuildTreeMap(parallelTestTree)
+
+	got := collectParallel(t, repo, root, ParallelWalkOptions{UniqueTrees: true}, nil)
+
+	// dir nodes are always reported, but the duplicated subtree is only
+	// walked once
+	var contents []string
+	dirs := 0
+	for _, p := range got {
+		switch p {
+		case "/a", "/b", "/c":
+			dirs++
+		case "/a/file", "/b/file", "/c/file":
+			contents = append(contents, p)
+		}
+	}
+	if dirs != 3 {
+		t.Errorf("expected three dir nodes, got %d: %v", dirs, got)
+	}
+	if len(contents) != 1 {
+		t.Errorf("expected duplicate subtree to be walked once, got %v", contents)
+	}
+	// total: /, /a, /b, /c, /empty, /foo and one copy of file, file2, sub, sub/x
+	if len(got) != 10 {
+		t.Errorf("unexpected number of paths %d: %v", len(got), got)
+	}
+}
+
+func TestParallelWalkSkip(t *testing.T) {
+	repo, root := BuildTreeMap(parallelTestTree)
+
+	got := collectParallel(t, repo, root, ParallelWalkOptions{}, map[string]struct{}{
+		"/a":       {},
+		"/b/file":  {},
+		"/c/sub/x": {},
+	})
+	want := []string{
+		"/",
+		"/a",
+		"/b",
+		"/b/file",
+		"/c",
+		"/c/file",
+		"/c/file2",
+		"/c/sub",
+		"/c/sub/x",
+		"/empty",
+		"/foo",
+	}
+	if !cmp.Equal(want, got) {
+		t.Fatal(cmp.Diff(want, got))
+	}
+}
+
+func TestParallelWalkLoadError(t *testing.T) {
+	repo, root := BuildTreeMap(parallelTestTree)
+
+	// remove the shared subtree sub
+	var subID restic.ID
+	err := Walk(context.TODO(), repo, root, nil, func(_ restic.ID, path string, node *restic.Node, err error) (bool, error) {
+		if path == "/a/sub" {
+			subID = *node.Subtree
+		}
+		return false, err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	delete(repo, subID)
+
+	var errPaths []string
+	err = ParallelWalk(context.TODO(), repo, root, func(_ restic.ID, path string, node *restic.Node, err error) error {
+		if err != nil {
+			errPaths = append(errPaths, path)
+		}
+		return nil
+	}, ParallelWalkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(errPaths)
+
+	want := []string{"/a/sub", "/b/sub", "/c/sub"}
+	if !cmp.Equal(want, errPaths) {
+		t.Fatal(cmp.Diff(want, errPaths))
+	}
+
+	// returning the error aborts the walk
+	err = ParallelWalk(context.TODO(), repo, root, func(_ restic.ID, path string, node *restic.Node, err error) error {
+		return err
+	}, ParallelWalkOptions{})
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
+
+func TestParallelWalkError(t *testing.T) {
+	repo, root := BuildTreeMap(parallelTestTree)
+
+	testErr := errors.New("test error")
+	err := ParallelWalk(context.TODO(), repo, root, func(_ restic.ID, path string, node *restic.Node, err error) error {
+		if path == "/b/sub/x" {
+			return testErr
+		}
+		return nil
+	}, ParallelWalkOptions{})
+	if err != testErr {
+		t.Fatalf("expected %v, got %v", testErr, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	err = ParallelWalk(ctx, repo, root, func(_ restic.ID, path string, node *restic.Node, err error) error {
+		return err
+	}, ParallelWalkOptions{})
+	if err == nil {
+		t.Fatal("expected error for canceled context, got nil")
+	}
+}
+
+// buildDeepTree returns a tree with the given depth where each directory
+// contains width subdirectories and files. Names include the path to make
+// all subtrees unique.
+func buildDeepTree(prefix string, depth, width int) TestTree {
+	tree := TestTree{}
+	for i := 0; i < width; i++ {
+		tree[fmt.Sprintf("%s-file%d", prefix, i)] = TestFile{Size: uint64(i)}
+	}
+	if depth == 0 {
+		return tree
+	}
+	for i := 0; i < width; i++ {
+		name := fmt.Sprintf("%s-%d", prefix, i)
+		tree[name] = buildDeepTree(name, depth-1, width)
+	}
+	return tree
+}
+
+// slowTreeMap simulates the latency of loading trees from a repository.
+type slowTreeMap struct {
+	TreeMap
+}
+
+func (t slowTreeMap) LoadBlob(ctx context.Context, tpe restic.BlobType, id restic.ID, buf []byte) ([]byte, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(100 * time.Microsecond):
+	}
+	return t.TreeMap.LoadBlob(ctx, tpe, id, buf)
+}
+
+func TestParallelWalkDeep(t *testing.T) {
+	repo, root := BuildTreeMap(buildDeepTree("d", 4, 3))
+
+	want := collectSequential(t, repo, root)
+	got := collectParallel(t, repo, root, ParallelWalkOptions{Workers: 8}, nil)
+	if !cmp.Equal(want, got) {
+		t.Fatal(cmp.Diff(want, got))
+	}
+}
+
+func TestParallelWalkDeepChain(t *testing.T) {
+	const depth = 5000
+	repo, root := buildChain(depth)
+
+	defer setMaxTreeDepth(depth)()
+	got := collectParallel(t, repo, root, ParallelWalkOptions{}, nil)
+	if len(got) != depth+2 {
+		t.Fatalf("wrong number of nodes visited, want %d, got %d", depth+2, len(got))
+	}
+
+	restic.MaxTreeDepth = depth - 1
+	err := ParallelWalk(context.TODO(), repo, root, func(restic.ID, string, *restic.Node, error) error {
+		return nil
+	}, ParallelWalkOptions{})
+	if !errors.Is(err, restic.ErrTreeTooDeep) {
+		t.Fatalf("expected ErrTreeTooDeep, got %v", err)
+	}
+}
+
+func BenchmarkWalk(b *testing.B) {
+	m, root := BuildTreeMap(buildDeepTree("d", 5, 3))
+	repo := slowTreeMap{m}
+	fn := func(_ restic.ID, _ string, _ *restic.Node, err error) error {
+		return err
+	}
+
+	b.Run("sequential", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			err := Walk(context.TODO(), repo, root, nil, func(parentTreeID restic.ID, path string, node *restic.Node, err error) (bool, error) {
+				return false, fn(parentTreeID, path, node, err)
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("parallel", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			err := ParallelWalk(context.TODO(), repo, root, fn, ParallelWalkOptions{Workers: 8})
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
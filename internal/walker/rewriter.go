@@ -11,12 +11,15 @@ import (
 
 type NodeRewriteFunc func(node *restic.Node, path string) *restic.Node
 type FailedTreeRewriteFunc func(nodeID restic.ID, path string, err error) (restic.ID, error)
+type KeepEmptyTreeFunc func(node *restic.Node, path string) bool
 
 type RewriteOpts struct {
 	// return nil to remove the node
 	RewriteNode NodeRewriteFunc
 	// decide what to do with a tree that could not be loaded. Return nil to remove the node. By default the load error is returned which causes the operation to fail.
 	RewriteFailedTree FailedTreeRewriteFunc
+	// decide whether to keep a directory which is empty after rewriting its subtree. Return false to remove the node. By default all directories are kept.
+	KeepEmptyTree KeepEmptyTreeFunc
 
 	AllowUnstableSerialization bool
 	DisableNodeCache           bool
@@ -24,6 +27,20 @@ type RewriteOpts struct {
 
 type idMap map[restic.ID]restic.ID
 
+// emptyTreeID is the ID of a tree without nodes.
+var emptyTreeID = func() restic.ID {
+	buf, err := restic.NewTreeJSONBuilder().Finalize()
+	if err != nil {
+		panic(err)
+	}
+	return restic.Hash(buf)
+}()
+
+// IsEmptyTree returns true if id is the ID of a tree without nodes.
+func IsEmptyTree(id restic.ID) bool {
+	return id == emptyTreeID
+}
+
 type TreeRewriter struct {
 	opts RewriteOpts
 
@@ -57,66 +74,140 @@ type BlobLoadSaver interface {
 	restic.BlobLoader
 }
 
-func (t *TreeRewriter) RewriteTree(ctx context.Context, repo BlobLoadSaver, nodepath string, nodeID restic.ID) (newNodeID restic.ID, err error) {
-	// check if tree was already changed
-	newID, ok := t.replaces[nodeID]
-	if ok {
-		return newID, nil
-	}
+// rewriteFrame is a tree which is currently rewritten by RewriteTree.
+type rewriteFrame struct {
+	nodeID   restic.ID
+	nodepath string
+	nodes    []*restic.Node
+	next     int
+	builder  *restic.TreeJSONBuilder
+	// node is the dir node in the parent tree which references this tree
+	node *restic.Node
+}
 
-	// a nil nodeID will lead to a load error
-	curTree, err := restic.LoadTree(ctx, repo, nodeID)
-	if err != nil {
-		return t.opts.RewriteFailedTree(nodeID, nodepath, err)
+// RewriteTree rewrites the tree nodeID and all of its subtrees and returns
+// the ID of the new tree. The trees which are currently rewritten are kept on
+// an explicit stack, such that deeply nested trees cannot exhaust the call
+// stack.
+func (t *TreeRewriter) RewriteTree(ctx context.Context, repo BlobLoadSaver, nodepath string, nodeID restic.ID) (newNodeID restic.ID, err error) {
+	newID, frame, err := t.enterTree(ctx, repo, nodepath, nodeID)
+	if err != nil || frame == nil {
+		return newID, err
 	}
+	stack := []*rewriteFrame{frame}
+
+	for {
+		frame := stack[len(stack)-1]
+		if frame.next == len(frame.nodes) {
+			newID, err := t.leaveTree(ctx, repo, frame)
+			stack = stack[:len(stack)-1]
+			if err != nil || len(stack) == 0 {
+				return newID, err
+			}
 
-	if !t.opts.AllowUnstableSerialization {
-		// check that we can properly encode this tree without losing information
-		// The alternative of using json/Decoder.DisallowUnknownFields() doesn't work as we use
-		// a custom UnmarshalJSON to decode trees, see also https://github.com/golang/go/issues/41144
-		testID, err := restic.SaveTree(ctx, repo, curTree)
-		if err != nil {
-			return restic.ID{}, err
-		}
-		if nodeID != testID {
-			return restic.ID{}, fmt.Errorf("cannot encode tree at %q without losing information", nodepath)
+			err = t.addSubtree(stack[len(stack)-1], frame.node, frame.nodepath, newID)
+			if err != nil {
+				return restic.ID{}, err
+			}
+			continue
 		}
-	}
 
-	debug.Log("filterTree: %s, nodeId: %s\n", nodepath, nodeID.Str())
+		node := frame.nodes[frame.next]
+		frame.next++
 
-	tb := restic.NewTreeJSONBuilder()
-	for _, node := range curTree.Nodes {
-		path := path.Join(nodepath, node.Name)
+		path := path.Join(frame.nodepath, node.Name)
 		node = t.opts.RewriteNode(node, path)
 		if node == nil {
 			continue
 		}
 
 		if node.Type != "dir" {
-			err = tb.AddNode(node)
+			err = frame.builder.AddNode(node)
 			if err != nil {
 				return restic.ID{}, err
 			}
 			continue
 		}
+
+		if err := restic.CheckTreeDepth(len(stack)); err != nil {
+			return restic.ID{}, fmt.Errorf("cannot rewrite subtrees of tree %v: %w", frame.nodeID.Str(), err)
+		}
+
 		// treat nil as null id
 		var subtree restic.ID
 		if node.Subtree != nil {
 			subtree = *node.Subtree
 		}
-		newID, err := t.RewriteTree(ctx, repo, path, subtree)
+		newID, sub, err := t.enterTree(ctx, repo, path, subtree)
 		if err != nil {
 			return restic.ID{}, err
 		}
-		node.Subtree = &newID
-		err = tb.AddNode(node)
+		if sub == nil {
+			err = t.addSubtree(frame, node, path, newID)
+			if err != nil {
+				return restic.ID{}, err
+			}
+			continue
+		}
+
+		sub.node = node
+		stack = append(stack, sub)
+	}
+}
+
+// enterTree loads the tree nodeID for rewriting. If the tree was already
+// rewritten or could not be loaded, the ID of its replacement is returned
+// instead.
+func (t *TreeRewriter) enterTree(ctx context.Context, repo BlobLoadSaver, nodepath string, nodeID restic.ID) (restic.ID, *rewriteFrame, error) {
+	// check if tree was already changed
+	newID, ok := t.replaces[nodeID]
+	if ok {
+		return newID, nil, nil
+	}
+
+	// a nil nodeID will lead to a load error
+	curTree, err := restic.LoadTree(ctx, repo, nodeID)
+	if err != nil {
+		newID, err = t.opts.RewriteFailedTree(nodeID, nodepath, err)
+		return newID, nil, err
+	}
+
+	if !t.opts.AllowUnstableSerialization {
+		// check that we can properly encode this tree without losing information
+		// The alternative of using json/Decoder.DisallowUnknownFields() doesn't work as we use
+		// a custom UnmarshalJSON to decode trees, see also https://github.com/golang/go/issues/41144
+		testID, err := restic.SaveTree(ctx, repo, curTree)
 		if err != nil {
-			return restic.ID{}, err
+			return restic.ID{}, nil, err
 		}
+		if nodeID != testID {
+			return restic.ID{}, nil, fmt.Errorf("cannot encode tree at %q without losing information", nodepath)
+		}
+	}
+
+	debug.Log("filterTree: %s, nodeId: %s\n", nodepath, nodeID.Str())
+
+	return restic.ID{}, &rewriteFrame{
+		nodeID:   nodeID,
+		nodepath: nodepath,
+		nodes:    curTree.Nodes,
+		builder:  restic.NewTreeJSONBuilder(),
+	}, nil
+}
+
+// addSubtree adds the dir node referencing the rewritten subtree newID to
+// frame, unless the subtree is empty and should not be kept.
+func (t *TreeRewriter) addSubtree(frame *rewriteFrame, node *restic.Node, path string, newID restic.ID) error {
+	if t.opts.KeepEmptyTree != nil && newID == emptyTreeID && !t.opts.KeepEmptyTree(node, path) {
+		return nil
 	}
+	node.Subtree = &newID
+	return frame.builder.AddNode(node)
+}
 
-	tree, err := tb.Finalize()
+// leaveTree saves the rewritten tree of frame.
+func (t *TreeRewriter) leaveTree(ctx context.Context, repo BlobLoadSaver, frame *rewriteFrame) (restic.ID, error) {
+	tree, err := frame.builder.Finalize()
 	if err != nil {
 		return restic.ID{}, err
 	}
@@ -124,10 +215,10 @@ func (t *TreeRewriter) RewriteTree(ctx context.Context, repo BlobLoadSaver, node
 	// Save new tree
 	newTreeID, _, _, err := repo.SaveBlob(ctx, restic.TreeBlob, tree, restic.ID{}, false)
 	if t.replaces != nil {
-		t.replaces[nodeID] = newTreeID
+		t.replaces[frame.nodeID] = newTreeID
 	}
-	if !newTreeID.Equal(nodeID) {
-		debug.Log("filterTree: save new tree for %s as %v\n", nodepath, newTreeID)
+	if !newTreeID.Equal(frame.nodeID) {
+		debug.Log("filterTree: save new tree for %s as %v\n", frame.nodepath, newTreeID)
 	}
 	return newTreeID, err
 }
@@ -123,6 +123,29 @@ func checkIncreaseNodeSize(increase uint64) checkRewriteFunc {
 	}
 }
 
+// checkRewriteEmptyTrees excludes nodes if path is in skipFor and removes
+// directories which are empty afterwards unless they are in keep.
+func checkRewriteEmptyTrees(skipFor map[string]struct{}, keep map[string]struct{}) checkRewriteFunc {
+	return func(t testing.TB) (rewriter *TreeRewriter, final func(testing.TB)) {
+		rewriter = NewTreeRewriter(RewriteOpts{
+			RewriteNode: func(node *restic.Node, path string) *restic.Node {
+				if _, skip := skipFor[path]; skip {
+					return nil
+				}
+				return node
+			},
+			KeepEmptyTree: func(node *restic.Node, path string) bool {
+				_, ok := keep[path]
+				return ok
+			},
+		})
+
+		final = func(t testing.TB) {}
+
+		return rewriter, final
+	}
+}
+
 func TestRewriter(t *testing.T) {
 	var tests = []struct {
 		tree    TestTree
@@ -186,6 +209,35 @@ func TestRewriter(t *testing.T) {
 				false,
 			),
 		},
+		{ // remove empty dirs
+			tree: TestTree{
+				"foo": TestFile{},
+				"subdir": TestTree{
+					"subfile": TestFile{},
+					"subsubdir": TestTree{
+						"subsubfile": TestFile{},
+					},
+				},
+				"keepdir": TestTree{
+					"subfile": TestFile{},
+				},
+				"emptydir": TestTree{},
+			},
+			newTree: TestTree{
+				"foo":     TestFile{},
+				"keepdir": TestTree{},
+			},
+			check: checkRewriteEmptyTrees(
+				map[string]struct{}{
+					"/subdir/subfile":              {},
+					"/subdir/subsubdir/subsubfile": {},
+					"/keepdir/subfile":             {},
+				},
+				map[string]struct{}{
+					"/keepdir": {},
+				},
+			),
+		},
 		{ // modify node
 			tree: TestTree{
 				"foo": TestFile{Size: 21},
@@ -364,3 +416,31 @@ func TestRewriterTreeLoadError(t *testing.T) {
 	test.OK(t, err)
 	test.Equals(t, replacementID, newRoot)
 }
+
+func TestRewriterDeepChain(t *testing.T) {
+	const depth = 5000
+	tm, root := buildChain(depth)
+	defer setMaxTreeDepth(depth)()
+
+	// remove the file at the bottom of the chain and all directories which
+	// are empty afterwards
+	rewriter := NewTreeRewriter(RewriteOpts{
+		RewriteNode: func(node *restic.Node, path string) *restic.Node {
+			if node.Type == "file" {
+				return nil
+			}
+			return node
+		},
+		KeepEmptyTree: func(node *restic.Node, path string) bool {
+			return false
+		},
+	})
+	newRoot, err := rewriter.RewriteTree(context.TODO(), WritableTreeMap{tm}, "/", root)
+	test.OK(t, err)
+	test.Assert(t, IsEmptyTree(newRoot), "rewritten chain is not empty")
+
+	restic.MaxTreeDepth = depth - 1
+	rewriter = NewTreeRewriter(RewriteOpts{})
+	_, err = rewriter.RewriteTree(context.TODO(), WritableTreeMap{tm}, "/", root)
+	test.Assert(t, errors.Is(err, restic.ErrTreeTooDeep), "expected ErrTreeTooDeep, got %v", err)
+}
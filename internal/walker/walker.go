@@ -34,6 +34,14 @@ type WalkFunc func(parentTreeID restic.ID, path string, node *restic.Node, nodeE
 // error, it is passed up the call stack. The trees in ignoreTrees are not
 // walked. If walkFn ignores trees, these are added to the set.
 func Walk(ctx context.Context, repo restic.BlobLoader, root restic.ID, ignoreTrees restic.IDSet, walkFn WalkFunc) error {
+	return WalkOrdered(ctx, repo, root, ignoreTrees, nil, walkFn)
+}
+
+// WalkOrdered works like Walk, but visits the nodes of each tree in the order
+// defined by less. Nodes for which less reports neither a < b nor b < a are
+// visited in the order of their names. If less is nil, the nodes are visited
+// in the order of their names.
+func WalkOrdered(ctx context.Context, repo restic.BlobLoader, root restic.ID, ignoreTrees restic.IDSet, less func(a, b *restic.Node) bool, walkFn WalkFunc) error {
 	tree, err := restic.LoadTree(ctx, repo, root)
 	_, err = walkFn(root, "/", nil, err)
 
@@ -48,59 +56,114 @@ func Walk(ctx context.Context, repo restic.BlobLoader, root restic.ID, ignoreTre
 		ignoreTrees = restic.NewIDSet()
 	}
 
-	_, err = walk(ctx, repo, "/", root, tree, ignoreTrees, walkFn)
-	return err
+	return walk(ctx, repo, root, tree, ignoreTrees, less, walkFn)
 }
 
-// walk recursively traverses the tree, ignoring subtrees when the ID of the
-// subtree is in ignoreTrees. If err is nil and ignore is true, the subtree ID
-// will be added to ignoreTrees by walk.
-func walk(ctx context.Context, repo restic.BlobLoader, prefix string, parentTreeID restic.ID, tree *restic.Tree, ignoreTrees restic.IDSet, walkFn WalkFunc) (ignore bool, err error) {
-	var allNodesIgnored = true
+// walkFrame is a tree which is currently traversed by walk.
+type walkFrame struct {
+	prefix string
+	treeID restic.ID
+	nodes  []*restic.Node
+	next   int
+	// allNodesIgnored is true if walkFn ignored all nodes visited so far.
+	allNodesIgnored bool
+}
 
-	if len(tree.Nodes) == 0 {
-		allNodesIgnored = false
+func newWalkFrame(prefix string, treeID restic.ID, tree *restic.Tree, less func(a, b *restic.Node) bool) *walkFrame {
+	var nodes []*restic.Node
+	if tree != nil {
+		nodes = tree.Nodes
 	}
 
-	sort.Slice(tree.Nodes, func(i, j int) bool {
-		return tree.Nodes[i].Name < tree.Nodes[j].Name
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Name < nodes[j].Name
 	})
+	if less != nil {
+		sort.SliceStable(nodes, func(i, j int) bool {
+			return less(nodes[i], nodes[j])
+		})
+	}
+
+	return &walkFrame{
+		prefix:          prefix,
+		treeID:          treeID,
+		nodes:           nodes,
+		allNodesIgnored: len(nodes) > 0,
+	}
+}
 
-	for _, node := range tree.Nodes {
-		p := path.Join(prefix, node.Name)
+// walk traverses the tree, ignoring subtrees when the ID of the subtree is in
+// ignoreTrees. If walkFn ignores all nodes of a subtree, its ID is added to
+// ignoreTrees. The trees which are currently traversed are kept on an
+// explicit stack, such that deeply nested trees cannot exhaust the call
+// stack.
+func walk(ctx context.Context, repo restic.BlobLoader, rootID restic.ID, root *restic.Tree, ignoreTrees restic.IDSet, less func(a, b *restic.Node) bool, walkFn WalkFunc) error {
+	stack := []*walkFrame{newWalkFrame("/", rootID, root, less)}
+
+	// leave removes the topmost tree from the stack and informs its parent
+	// whether all nodes were ignored
+	leave := func(ignore bool) {
+		frame := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if len(stack) == 0 {
+			return
+		}
+
+		if ignore {
+			ignoreTrees.Insert(frame.treeID)
+		} else {
+			stack[len(stack)-1].allNodesIgnored = false
+		}
+	}
+
+	for len(stack) > 0 {
+		frame := stack[len(stack)-1]
+		if frame.next == len(frame.nodes) {
+			leave(frame.allNodesIgnored)
+			continue
+		}
+
+		node := frame.nodes[frame.next]
+		frame.next++
+		p := path.Join(frame.prefix, node.Name)
 
 		if node.Type == "" {
-			return false, errors.Errorf("node type is empty for node %q", node.Name)
+			return errors.Errorf("node type is empty for node %q", node.Name)
 		}
 
 		if node.Type != "dir" {
-			ignore, err := walkFn(parentTreeID, p, node, nil)
+			ignore, err := walkFn(frame.treeID, p, node, nil)
 			if err != nil {
 				if err == ErrSkipNode {
 					// skip the remaining entries in this tree
-					return allNodesIgnored, nil
+					leave(frame.allNodesIgnored)
+					continue
 				}
 
-				return false, err
+				return err
 			}
 
 			if !ignore {
-				allNodesIgnored = false
+				frame.allNodesIgnored = false
 			}
 
 			continue
 		}
 
 		if node.Subtree == nil {
-			return false, errors.Errorf("subtree for node %v in tree %v is nil", node.Name, p)
+			return errors.Errorf("subtree for node %v in tree %v is nil", node.Name, p)
 		}
 
 		if ignoreTrees.Has(*node.Subtree) {
 			continue
 		}
 
+		if err := restic.CheckTreeDepth(len(stack)); err != nil {
+			return errors.Wrapf(err, "subtree %v", node.Subtree.Str())
+		}
+
 		subtree, err := restic.LoadTree(ctx, repo, *node.Subtree)
-		ignore, err := walkFn(parentTreeID, p, node, err)
+		ignore, err := walkFn(frame.treeID, p, node, err)
 		if err != nil {
 			if err == ErrSkipNode {
 				if ignore {
@@ -108,7 +171,7 @@ func walk(ctx context.Context, repo restic.BlobLoader, prefix string, parentTree
 				}
 				continue
 			}
-			return false, err
+			return err
 		}
 
 		if ignore {
@@ -116,22 +179,11 @@ func walk(ctx context.Context, repo restic.BlobLoader, prefix string, parentTree
 		}
 
 		if !ignore {
-			allNodesIgnored = false
-		}
-
-		ignore, err = walk(ctx, repo, p, *node.Subtree, subtree, ignoreTrees, walkFn)
-		if err != nil {
-			return false, err
+			frame.allNodesIgnored = false
 		}
 
-		if ignore {
-			ignoreTrees.Insert(*node.Subtree)
-		}
-
-		if !ignore {
-			allNodesIgnored = false
-		}
+		stack = append(stack, newWalkFrame(p, *node.Subtree, subtree, less))
 	}
 
-	return allNodesIgnored, nil
+	return nil
 }
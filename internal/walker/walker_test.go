@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"strings"
 	"testing"
 
 	"github.com/pkg/errors"
@@ -87,6 +88,14 @@ func (t TreeMap) LoadBlob(_ context.Context, tpe restic.BlobType, id restic.ID,
 	return tree, nil
 }
 
+func (t TreeMap) LookupBlobSize(id restic.ID, tpe restic.BlobType) (uint, bool) {
+	if tpe != restic.TreeBlob {
+		return 0, false
+	}
+	tree, ok := t[id]
+	return uint(len(tree)), ok
+}
+
 func (t TreeMap) Connections() uint {
 	return 2
 }
@@ -563,3 +572,101 @@ func TestWalker(t *testing.T) {
 		})
 	}
 }
+
+func TestWalkOrdered(t *testing.T) {
+	repo, root := BuildTreeMap(TestTree{
+		"a": TestFile{Size: 1},
+		"b": TestFile{Size: 3},
+		"c": TestFile{Size: 1},
+		"d": TestTree{
+			"x": TestFile{Size: 1},
+			"y": TestFile{Size: 2},
+		},
+		"e": TestFile{Size: 2},
+	})
+
+	// largest first, ties are visited by name
+	less := func(a, b *restic.Node) bool {
+		return a.Size > b.Size
+	}
+	fn, last := checkItemOrder([]string{
+		"/",
+		"/b",
+		"/e",
+		"/a",
+		"/c",
+		"/d",
+		"/d/y",
+		"/d/x",
+	})(t)
+	err := WalkOrdered(context.TODO(), repo, root, restic.NewIDSet(), less, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last(t)
+}
+
+// buildChain returns a chain of depth nested directories named "d", the
+// innermost directory contains the file "file". The trees are built bottom-up,
+// such that the depth is not limited by the call stack.
+func buildChain(depth int) (m TreeMap, root restic.ID) {
+	m = TreeMap{}
+	node := &restic.Node{Name: "file", Type: "file"}
+	for i := 0; ; i++ {
+		tb := restic.NewTreeJSONBuilder()
+		if err := tb.AddNode(node); err != nil {
+			panic(err)
+		}
+		buf, err := tb.Finalize()
+		if err != nil {
+			panic(err)
+		}
+		id := restic.Hash(buf)
+		m[id] = buf
+
+		if i == depth {
+			return m, id
+		}
+		node = &restic.Node{Name: "d", Type: "dir", Subtree: &id}
+	}
+}
+
+// setMaxTreeDepth changes restic.MaxTreeDepth and returns a function which
+// restores the previous value.
+func setMaxTreeDepth(depth int) func() {
+	old := restic.MaxTreeDepth
+	restic.MaxTreeDepth = depth
+	return func() {
+		restic.MaxTreeDepth = old
+	}
+}
+
+func TestWalkDeepChain(t *testing.T) {
+	const depth = 5000
+	repo, root := buildChain(depth)
+
+	var paths []string
+	walkFn := func(_ restic.ID, path string, _ *restic.Node, err error) (bool, error) {
+		paths = append(paths, path)
+		return false, err
+	}
+
+	defer setMaxTreeDepth(depth)()
+	err := Walk(context.TODO(), repo, root, nil, walkFn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != depth+2 {
+		t.Fatalf("wrong number of nodes visited, want %d, got %d", depth+2, len(paths))
+	}
+	want := strings.Repeat("/d", depth) + "/file"
+	if paths[len(paths)-1] != want {
+		t.Fatalf("wrong last path, want %d characters, got %q", len(want), paths[len(paths)-1])
+	}
+
+	restic.MaxTreeDepth = depth - 1
+	err = Walk(context.TODO(), repo, root, nil, walkFn)
+	if !errors.Is(err, restic.ErrTreeTooDeep) {
+		t.Fatalf("expected ErrTreeTooDeep, got %v", err)
+	}
+}
@@ -0,0 +1,172 @@
+package restic
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/filter"
+	"github.com/restic/restic/internal/fs"
+	irestic "github.com/restic/restic/internal/restic"
+)
+
+// BackupOptions configure a backup.
+type BackupOptions struct {
+	// Hostname recorded in the snapshot. If empty, the hostname of the
+	// system is used.
+	Hostname string
+	// Tags added to the snapshot.
+	Tags []string
+	// Excludes contains patterns for files which are not backed up, in the
+	// same syntax as the --exclude option of restic.
+	Excludes []string
+	// Time of the snapshot. If zero, the current time is used.
+	Time time.Time
+	// Parent is the ID of the snapshot used to detect unchanged files. If
+	// empty, the latest snapshot of the same host and paths is used.
+	Parent string
+
+	// Progress is called for each processed file and directory. It may be
+	// called concurrently from several goroutines.
+	Progress func(BackupProgress)
+	// Error is called for files which cannot be read. If it returns nil, the
+	// file is skipped and the backup continues. If Error is nil, the backup
+	// is aborted on the first error.
+	Error func(item string, err error) error
+}
+
+// BackupProgress contains the statistics of a running backup.
+type BackupProgress struct {
+	// Item is the file or directory which was processed last.
+	Item string
+	// Files and Dirs are the number of processed files and directories.
+	Files, Dirs uint64
+	// Bytes is the amount of file data saved so far, including data which
+	// was already contained in the repository.
+	Bytes uint64
+}
+
+// Backup saves the targets in a new snapshot and returns the snapshot.
+func (r *Repository) Backup(ctx context.Context, targets []string, opts BackupOptions) (Snapshot, error) {
+	if len(targets) == 0 {
+		return Snapshot{}, errors.New("no backup targets given")
+	}
+	if err := filter.ValidatePatterns(opts.Excludes); err != nil {
+		return Snapshot{}, err
+	}
+
+	unlock, err := r.lock(ctx, false)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	defer unlock()
+
+	if opts.Time.IsZero() {
+		opts.Time = time.Now()
+	}
+	if opts.Hostname == "" {
+		opts.Hostname, err = os.Hostname()
+		if err != nil {
+			return Snapshot{}, errors.Wrap(err, "unable to determine hostname")
+		}
+	}
+
+	parent, err := r.findParent(ctx, targets, opts)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	if err := r.loadIndex(ctx); err != nil {
+		return Snapshot{}, err
+	}
+
+	arch := archiver.New(r.repo, fs.Local{}, archiver.Options{})
+	if len(opts.Excludes) > 0 {
+		patterns := filter.ParsePatterns(opts.Excludes)
+		arch.SelectByName = func(item string) bool {
+			matched, err := filter.List(patterns, item)
+			if err != nil {
+				debug.Log("error for exclude pattern: %v", err)
+			}
+			return !matched
+		}
+	}
+	if opts.Error != nil {
+		arch.Error = opts.Error
+	}
+
+	var m sync.Mutex
+	var progress BackupProgress
+	arch.CompleteBlob = func(bytes uint64) {
+		m.Lock()
+		progress.Bytes += bytes
+		m.Unlock()
+	}
+	arch.CompleteItem = func(item string, previous, current *irestic.Node, s archiver.ItemStats, d time.Duration) {
+		if current == nil {
+			return
+		}
+
+		m.Lock()
+		switch current.Type {
+		case "dir":
+			progress.Dirs++
+		case "file":
+			progress.Files++
+		}
+		progress.Item = item
+		p := progress
+		m.Unlock()
+
+		if opts.Progress != nil {
+			opts.Progress(p)
+		}
+	}
+
+	sn, id, err := arch.Snapshot(ctx, targets, archiver.SnapshotOptions{
+		Tags:           opts.Tags,
+		Hostname:       opts.Hostname,
+		Excludes:       opts.Excludes,
+		Time:           opts.Time,
+		ParentSnapshot: parent,
+		ProgramVersion: "restic library",
+	})
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	return newSnapshot(id, sn), nil
+}
+
+// findParent returns the parent snapshot for a backup of targets.
+func (r *Repository) findParent(ctx context.Context, targets []string, opts BackupOptions) (*irestic.Snapshot, error) {
+	if opts.Parent != "" {
+		return r.findSnapshot(ctx, opts.Parent)
+	}
+
+	// snapshots record the absolute paths of the targets
+	paths := make([]string, 0, len(targets))
+	for _, target := range targets {
+		path, err := filepath.Abs(target)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		paths = append(paths, path)
+	}
+
+	f := irestic.SnapshotFilter{
+		Hosts:          []string{opts.Hostname},
+		Paths:          paths,
+		TimestampLimit: opts.Time,
+	}
+	sn, _, err := f.FindLatest(ctx, r.repo.Backend(), r.repo, "latest")
+	if errors.Is(err, irestic.ErrNoSnapshotFound) {
+		return nil, nil
+	}
+	return sn, err
+}
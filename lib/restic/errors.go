@@ -0,0 +1,30 @@
+package restic
+
+import "github.com/restic/restic/internal/errors"
+
+var (
+	// ErrWrongPassword is returned by Open if none of the keys in the
+	// repository can be decrypted with the password.
+	ErrWrongPassword = errors.New("wrong password or no key found")
+
+	// ErrNoRepository is returned by Open if there is no repository at the
+	// location.
+	ErrNoRepository = errors.New("repository does not exist")
+
+	// ErrNoSnapshot is returned if no snapshot matches the given ID.
+	ErrNoSnapshot = errors.New("no matching snapshot found")
+)
+
+// LockError is returned if the repository cannot be locked because another
+// process holds a conflicting lock.
+type LockError struct {
+	err error
+}
+
+func (e *LockError) Error() string {
+	return e.err.Error()
+}
+
+func (e *LockError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,115 @@
+package restic_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/restic/restic/lib/restic"
+)
+
+func Example() {
+	ctx := context.Background()
+
+	tempdir, err := os.MkdirTemp("", "restic-example-")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	data := filepath.Join(tempdir, "data")
+	if err := os.MkdirAll(data, 0700); err != nil {
+		panic(err)
+	}
+	if err := os.WriteFile(filepath.Join(data, "file.txt"), []byte("hello world"), 0600); err != nil {
+		panic(err)
+	}
+
+	opts := restic.Options{
+		Location: filepath.Join(tempdir, "repo"),
+		Password: func() (string, error) { return "secret", nil },
+	}
+
+	repo, err := restic.Init(ctx, opts)
+	if err != nil {
+		panic(err)
+	}
+	defer repo.Close()
+
+	sn, err := repo.Backup(ctx, []string{data}, restic.BackupOptions{Hostname: "example", Tags: []string{"docs"}})
+	if err != nil {
+		panic(err)
+	}
+
+	snapshots, err := repo.Snapshots(ctx, restic.SnapshotFilter{Tags: []string{"docs"}})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("%d snapshot from host %v, same ID: %v\n", len(snapshots), snapshots[0].Hostname, snapshots[0].ID == sn.ID)
+
+	target := filepath.Join(tempdir, "restore")
+	if err := repo.Restore(ctx, sn.ID, target, restic.RestoreOptions{}); err != nil {
+		panic(err)
+	}
+
+	buf, err := os.ReadFile(filepath.Join(target, data, "file.txt"))
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("restored: %s\n", buf)
+
+	// Output:
+	// 1 snapshot from host example, same ID: true
+	// restored: hello world
+}
+
+func ExampleRepository_Forget() {
+	ctx := context.Background()
+
+	tempdir, err := os.MkdirTemp("", "restic-example-")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	repo, err := restic.Init(ctx, restic.Options{
+		Location: filepath.Join(tempdir, "repo"),
+		Password: func() (string, error) { return "secret", nil },
+	})
+	if err != nil {
+		panic(err)
+	}
+	defer repo.Close()
+
+	file := filepath.Join(tempdir, "file.txt")
+	for i := 0; i < 3; i++ {
+		if err := os.WriteFile(file, []byte(fmt.Sprintf("version %d", i)), 0600); err != nil {
+			panic(err)
+		}
+		if _, err := repo.Backup(ctx, []string{file}, restic.BackupOptions{}); err != nil {
+			panic(err)
+		}
+	}
+
+	removed, err := repo.Forget(ctx, restic.ForgetPolicy{Last: 1}, restic.SnapshotFilter{})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("removed %d snapshots\n", len(removed))
+
+	// remove the data which is no longer referenced
+	if err := repo.Prune(ctx); err != nil {
+		panic(err)
+	}
+
+	snapshots, err := repo.Snapshots(ctx, restic.SnapshotFilter{})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("%d snapshot left\n", len(snapshots))
+
+	// Output:
+	// removed 2 snapshots
+	// 1 snapshot left
+}
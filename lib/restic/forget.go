@@ -0,0 +1,140 @@
+package restic
+
+import (
+	"context"
+	"math"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/prune"
+	irestic "github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui/progress"
+)
+
+// Duration is a period of time counted in calendar units.
+type Duration struct {
+	Years, Months, Days, Hours int
+}
+
+// ForgetPolicy describes which snapshots are kept by Forget, the fields
+// correspond to the --keep-* options of restic. A value of -1 keeps all
+// snapshots of the respective interval.
+type ForgetPolicy struct {
+	Last, Hourly, Daily, Weekly, Monthly, Yearly int
+	// Within keeps all snapshots made within this duration before the
+	// latest snapshot.
+	Within Duration
+	// Tags keeps all snapshots which have all of the tags.
+	Tags []string
+}
+
+func (p ForgetPolicy) expirePolicy() irestic.ExpirePolicy {
+	policy := irestic.ExpirePolicy{
+		Last:    p.Last,
+		Hourly:  p.Hourly,
+		Daily:   p.Daily,
+		Weekly:  p.Weekly,
+		Monthly: p.Monthly,
+		Yearly:  p.Yearly,
+		Within: irestic.Duration{
+			Years:  p.Within.Years,
+			Months: p.Within.Months,
+			Days:   p.Within.Days,
+			Hours:  p.Within.Hours,
+		},
+	}
+	if len(p.Tags) > 0 {
+		policy.Tags = []irestic.TagList{irestic.TagList(p.Tags)}
+	}
+	return policy
+}
+
+// Forget removes the snapshots matching the filter which are not kept by the
+// policy. Like the forget command of restic, the policy is applied separately
+// to the snapshots of each combination of host and paths. The removed
+// snapshots are returned. Forget does not remove data from the repository,
+// use Prune afterwards.
+func (r *Repository) Forget(ctx context.Context, policy ForgetPolicy, filter SnapshotFilter) ([]Snapshot, error) {
+	expirePolicy := policy.expirePolicy()
+	if expirePolicy.Empty() {
+		return nil, errors.New("no policy was specified")
+	}
+
+	unlock, err := r.lock(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	list, err := r.findSnapshots(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	groups, _, err := irestic.GroupSnapshots(list, irestic.SnapshotGroupByOptions{Host: true, Path: true})
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []Snapshot
+	for _, group := range groups {
+		_, remove, _ := irestic.ApplyPolicy(group, expirePolicy)
+		for _, sn := range remove {
+			h := irestic.Handle{Type: irestic.SnapshotFile, Name: sn.ID().String()}
+			if err := r.repo.Backend().Remove(ctx, h); err != nil {
+				return removed, err
+			}
+			removed = append(removed, newSnapshot(*sn.ID(), sn))
+		}
+	}
+	return removed, nil
+}
+
+// Prune removes all data from the repository which is not referenced by any
+// snapshot. Like the prune command of restic with its default options, pack
+// files which are partly used are repacked until at most 5% of the used data
+// remains unused.
+func (r *Repository) Prune(ctx context.Context) error {
+	unlock, err := r.lock(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// the index is rewritten after the repacking is complete
+	r.repo.DisableAutoIndexUpdate()
+	defer r.repo.EnableAutoIndexUpdate()
+
+	if err := r.loadIndex(ctx); err != nil {
+		return err
+	}
+
+	opts := prune.Options{
+		MaxUnusedBytes: func(used uint64) uint64 {
+			return uint64(5.0 / (100 - 5.0) * float64(used))
+		},
+		MaxRepackBytes:   math.MaxUint64,
+		RecheckSnapshots: true,
+	}
+	plan, err := prune.NewPlan(ctx, opts, r.repo, irestic.NewIDSet(), pruneLogger{})
+	if err != nil {
+		return err
+	}
+	return plan.Execute(ctx, pruneLogger{})
+}
+
+// pruneLogger writes the messages of a prune to the debug log.
+type pruneLogger struct{}
+
+func (pruneLogger) P(msg string, args ...interface{})  { debug.Log(msg, args...) }
+func (pruneLogger) V(msg string, args ...interface{})  { debug.Log(msg, args...) }
+func (pruneLogger) VV(msg string, args ...interface{}) { debug.Log(msg, args...) }
+func (pruneLogger) E(msg string, args ...interface{})  { debug.Log(msg, args...) }
+
+func (pruneLogger) NewCounter(description string, max uint64) *progress.Counter {
+	return nil
+}
+
+func (pruneLogger) NewPhaseCounter(phase string, maxItems, maxBytes uint64, description string) *progress.Counter {
+	return nil
+}
@@ -0,0 +1,57 @@
+package restic
+
+import (
+	"context"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	irestic "github.com/restic/restic/internal/restic"
+)
+
+// lockRefreshInterval is the interval in which locks are refreshed while an
+// operation is running.
+var lockRefreshInterval = 5 * time.Minute
+
+// lock locks the repository until the returned function is called. Conflicts
+// with other locks are returned as LockError.
+func (r *Repository) lock(ctx context.Context, exclusive bool) (unlock func(), err error) {
+	var lock *irestic.Lock
+	if exclusive {
+		lock, err = irestic.NewExclusiveLock(ctx, r.repo)
+	} else {
+		lock, err = irestic.NewLock(ctx, r.repo)
+	}
+	if irestic.IsAlreadyLocked(err) {
+		return nil, &LockError{err: err}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	refreshCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(lockRefreshInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-refreshCtx.Done():
+				return
+			case <-ticker.C:
+				if err := lock.Refresh(refreshCtx); err != nil {
+					debug.Log("unable to refresh lock: %v", err)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+		if err := lock.Unlock(); err != nil {
+			debug.Log("unable to remove lock: %v", err)
+		}
+	}, nil
+}
@@ -0,0 +1,224 @@
+// Package restic provides a small, stable API to embed restic in other Go
+// programs. It wraps the internal packages used by the restic command and
+// only exposes the types defined in this package.
+//
+// All operations lock the repository like the corresponding restic commands.
+package restic
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/azure"
+	"github.com/restic/restic/internal/backend/b2"
+	"github.com/restic/restic/internal/backend/gs"
+	"github.com/restic/restic/internal/backend/local"
+	"github.com/restic/restic/internal/backend/location"
+	"github.com/restic/restic/internal/backend/rclone"
+	"github.com/restic/restic/internal/backend/rest"
+	"github.com/restic/restic/internal/backend/retry"
+	"github.com/restic/restic/internal/backend/s3"
+	"github.com/restic/restic/internal/backend/sema"
+	"github.com/restic/restic/internal/backend/sftp"
+	"github.com/restic/restic/internal/backend/swift"
+	"github.com/restic/restic/internal/backend/webdav"
+	"github.com/restic/restic/internal/cache"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/index"
+	"github.com/restic/restic/internal/repository"
+	irestic "github.com/restic/restic/internal/restic"
+)
+
+var backends = location.NewRegistry()
+
+func init() {
+	backends.Register(azure.NewFactory())
+	backends.Register(b2.NewFactory())
+	backends.Register(gs.NewFactory())
+	backends.Register(local.NewFactory())
+	backends.Register(rclone.NewFactory())
+	backends.Register(rest.NewFactory())
+	backends.Register(s3.NewFactory())
+	backends.Register(sftp.NewFactory())
+	backends.Register(swift.NewFactory())
+	backends.Register(webdav.NewFactory())
+}
+
+// Options configure how a repository is accessed.
+type Options struct {
+	// Location of the repository in the same syntax as the --repo option of
+	// restic, for example "/srv/restic-repo" or "sftp:user@host:/srv/repo".
+	// Credentials for the backend are read from the same environment
+	// variables as used by restic.
+	Location string
+
+	// Password is called to get the password of the repository.
+	Password func() (string, error)
+
+	// CacheDir is the directory used for the local cache. If it is empty, no
+	// cache is used.
+	CacheDir string
+}
+
+// Repository is an open restic repository. Its methods must not be called
+// concurrently, use several Repository values instead.
+type Repository struct {
+	repo *repository.Repository
+}
+
+// Open opens the existing repository at opts.Location.
+func Open(ctx context.Context, opts Options) (*Repository, error) {
+	be, err := openBackend(ctx, opts.Location, false)
+	if err != nil {
+		return nil, err
+	}
+
+	repo, err := newRepository(be)
+	if err != nil {
+		return nil, err
+	}
+
+	password, err := readPassword(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = repo.SearchKey(ctx, password, 0, "")
+	if errors.Is(err, repository.ErrNoKeyFound) {
+		return nil, ErrWrongPassword
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.CacheDir != "" {
+		c, err := cache.New(repo.Config().ID, opts.CacheDir)
+		if err != nil {
+			return nil, err
+		}
+		repo.UseCache(c)
+	}
+
+	return &Repository{repo: repo}, nil
+}
+
+// Init creates a new repository at opts.Location and returns it.
+func Init(ctx context.Context, opts Options) (*Repository, error) {
+	be, err := openBackend(ctx, opts.Location, true)
+	if err != nil {
+		return nil, err
+	}
+
+	repo, err := newRepository(be)
+	if err != nil {
+		return nil, err
+	}
+
+	password, err := readPassword(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = repo.Init(ctx, irestic.StableRepoVersion, password, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Repository{repo: repo}, nil
+}
+
+// ID returns the ID of the repository.
+func (r *Repository) ID() string {
+	return r.repo.Config().ID
+}
+
+// Close closes the repository.
+func (r *Repository) Close() error {
+	return r.repo.Close()
+}
+
+// loadIndex replaces the in-memory index with the index files currently
+// stored in the repository, as they may have been modified since the last
+// operation.
+func (r *Repository) loadIndex(ctx context.Context) error {
+	if err := r.repo.SetIndex(index.NewMasterIndex()); err != nil {
+		return err
+	}
+	return r.repo.LoadIndex(ctx)
+}
+
+func readPassword(opts Options) (string, error) {
+	if opts.Password == nil {
+		return "", errors.New("no password callback given")
+	}
+
+	password, err := opts.Password()
+	if err != nil {
+		return "", err
+	}
+	if password == "" {
+		return "", errors.New("empty password")
+	}
+	return password, nil
+}
+
+func newRepository(be irestic.Backend) (*repository.Repository, error) {
+	return repository.New(be, repository.Options{})
+}
+
+// openBackend opens or creates the backend for the location s.
+func openBackend(ctx context.Context, s string, create bool) (irestic.Backend, error) {
+	debug.Log("parsing location %v", location.StripPassword(backends, s))
+	loc, err := location.Parse(backends, s)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing repository location failed")
+	}
+
+	cfg := loc.Config
+	if cfg, ok := cfg.(irestic.ApplyEnvironmenter); ok {
+		cfg.ApplyEnvironment("")
+	}
+
+	rt, err := backend.Transport(backend.TransportOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	factory := backends.Lookup(loc.Scheme)
+	if factory == nil {
+		return nil, errors.Errorf("invalid backend: %q", loc.Scheme)
+	}
+
+	var open func(ctx context.Context, cfg interface{}, rt http.RoundTripper) (irestic.Backend, error)
+	if create {
+		open = factory.Create
+	} else {
+		open = factory.Open
+	}
+
+	be, err := open(ctx, cfg, rt)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to open repository at %v", location.StripPassword(backends, s))
+	}
+	be = sema.NewBackend(retry.New(be, 10, func(msg string, err error, d time.Duration) {
+		debug.Log("%v returned error, retrying after %v: %v", msg, d, err)
+	}, nil))
+
+	if create {
+		return be, nil
+	}
+
+	// check if config is there
+	_, err = be.Stat(ctx, irestic.Handle{Type: irestic.ConfigFile})
+	if err != nil && be.IsNotExist(err) {
+		return nil, ErrNoRepository
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to open config file")
+	}
+
+	return be, nil
+}
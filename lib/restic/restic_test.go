@@ -0,0 +1,122 @@
+package restic
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	irestic "github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func testOptions(t *testing.T) Options {
+	repository.TestUseLowSecurityKDFParameters(t)
+	return Options{
+		Location: filepath.Join(t.TempDir(), "repo"),
+		Password: func() (string, error) { return "secret", nil },
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	opts := testOptions(t)
+
+	_, err := Open(context.TODO(), opts)
+	rtest.Assert(t, errors.Is(err, ErrNoRepository), "unexpected error %v", err)
+
+	repo, err := Init(context.TODO(), opts)
+	rtest.OK(t, err)
+	rtest.OK(t, repo.Close())
+
+	repo, err = Open(context.TODO(), opts)
+	rtest.OK(t, err)
+	rtest.OK(t, repo.Close())
+
+	opts.Password = func() (string, error) { return "wrong", nil }
+	_, err = Open(context.TODO(), opts)
+	rtest.Assert(t, errors.Is(err, ErrWrongPassword), "unexpected error %v", err)
+}
+
+func TestLockConflict(t *testing.T) {
+	repo, err := Init(context.TODO(), testOptions(t))
+	rtest.OK(t, err)
+	defer func() { rtest.OK(t, repo.Close()) }()
+
+	lock, err := irestic.NewExclusiveLock(context.TODO(), repo.repo)
+	rtest.OK(t, err)
+
+	_, err = repo.Snapshots(context.TODO(), SnapshotFilter{})
+	var lockErr *LockError
+	rtest.Assert(t, errors.As(err, &lockErr), "expected LockError, got %v", err)
+
+	rtest.OK(t, lock.Unlock())
+	_, err = repo.Snapshots(context.TODO(), SnapshotFilter{})
+	rtest.OK(t, err)
+}
+
+func TestRestoreMissingSnapshot(t *testing.T) {
+	repo, err := Init(context.TODO(), testOptions(t))
+	rtest.OK(t, err)
+	defer func() { rtest.OK(t, repo.Close()) }()
+
+	err = repo.Restore(context.TODO(), "latest", t.TempDir(), RestoreOptions{})
+	rtest.Assert(t, errors.Is(err, ErrNoSnapshot), "unexpected error %v", err)
+	err = repo.Restore(context.TODO(), "abcdef12", t.TempDir(), RestoreOptions{})
+	rtest.Assert(t, errors.Is(err, ErrNoSnapshot), "unexpected error %v", err)
+}
+
+func TestBackupParentAndPrune(t *testing.T) {
+	repo, err := Init(context.TODO(), testOptions(t))
+	rtest.OK(t, err)
+	defer func() { rtest.OK(t, repo.Close()) }()
+
+	data := t.TempDir()
+	rtest.OK(t, os.WriteFile(filepath.Join(data, "file"), rtest.Random(1, 100000), 0600))
+	rtest.OK(t, os.WriteFile(filepath.Join(data, "excluded"), []byte("excluded"), 0600))
+
+	var progress BackupProgress
+	opts := BackupOptions{
+		Excludes: []string{"excluded"},
+		Progress: func(p BackupProgress) { progress = p },
+	}
+	first, err := repo.Backup(context.TODO(), []string{data}, opts)
+	rtest.OK(t, err)
+	rtest.Equals(t, uint64(1), progress.Files)
+
+	rtest.OK(t, os.WriteFile(filepath.Join(data, "file"), rtest.Random(2, 100000), 0600))
+	second, err := repo.Backup(context.TODO(), []string{data}, opts)
+	rtest.OK(t, err)
+	rtest.Equals(t, first.ID, second.Parent)
+
+	removed, err := repo.Forget(context.TODO(), ForgetPolicy{Last: 1}, SnapshotFilter{})
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, len(removed))
+	rtest.Equals(t, first.ID, removed[0].ID)
+	rtest.OK(t, repo.Prune(context.TODO()))
+
+	var restored RestoreProgress
+	target := t.TempDir()
+	rtest.OK(t, repo.Restore(context.TODO(), "latest", target, RestoreOptions{
+		Progress: func(p RestoreProgress) { restored = p },
+	}))
+	rtest.Assert(t, restored.FilesFinished > 0 && restored.FilesFinished == restored.FilesTotal,
+		"unexpected restore progress %+v", restored)
+
+	buf, err := os.ReadFile(filepath.Join(target, data, "file"))
+	rtest.OK(t, err)
+	rtest.Equals(t, rtest.Random(2, 100000), buf)
+	_, err = os.Stat(filepath.Join(target, data, "excluded"))
+	rtest.Assert(t, errors.Is(err, os.ErrNotExist), "excluded file was restored")
+
+	// the data of the first snapshot must have been removed
+	rtest.OK(t, repo.loadIndex(context.TODO()))
+	count := 0
+	repo.repo.Index().Each(context.TODO(), func(blob irestic.PackedBlob) {
+		if blob.Type == irestic.DataBlob {
+			count++
+		}
+	})
+	rtest.Equals(t, 1, count)
+}
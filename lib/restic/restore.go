@@ -0,0 +1,93 @@
+package restic
+
+import (
+	"context"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restorer"
+	"github.com/restic/restic/internal/ui"
+	restoreui "github.com/restic/restic/internal/ui/restore"
+)
+
+// RestoreOptions configure a restore.
+type RestoreOptions struct {
+	// Sparse restores files as sparse files where possible.
+	Sparse bool
+
+	// Progress is called periodically while the restore is running and
+	// once after it has finished.
+	Progress func(RestoreProgress)
+	// ProgressInterval is the minimal interval between two calls to
+	// Progress. If it is zero, Progress is only called once at the end.
+	ProgressInterval time.Duration
+	// Error is called for files which cannot be restored. If it returns nil,
+	// the file is skipped and the restore continues. If Error is nil, the
+	// restore is aborted on the first error.
+	Error func(item string, err error) error
+}
+
+// RestoreProgress contains the statistics of a running restore.
+type RestoreProgress struct {
+	FilesFinished, FilesTotal uint64
+	BytesWritten, BytesTotal  uint64
+	Elapsed                   time.Duration
+}
+
+// restoreProgressPrinter passes the restore progress to a callback.
+type restoreProgressPrinter struct {
+	fn func(RestoreProgress)
+}
+
+func (p restoreProgressPrinter) Update(filesFinished, filesTotal, allBytesWritten, allBytesTotal uint64, duration time.Duration) {
+	p.fn(RestoreProgress{
+		FilesFinished: filesFinished,
+		FilesTotal:    filesTotal,
+		BytesWritten:  allBytesWritten,
+		BytesTotal:    allBytesTotal,
+		Elapsed:       duration,
+	})
+}
+
+func (p restoreProgressPrinter) Finish(filesFinished, filesTotal, allBytesWritten, allBytesTotal uint64, duration time.Duration, _ []ui.WarningSummary, _ *ui.TransferStats) {
+	p.Update(filesFinished, filesTotal, allBytesWritten, allBytesTotal, duration)
+}
+
+// Restore restores the snapshot with the given ID to the directory target.
+// The ID may be abbreviated, "latest" selects the latest snapshot.
+func (r *Repository) Restore(ctx context.Context, snapshotID string, target string, opts RestoreOptions) error {
+	if target == "" {
+		return errors.New("no restore target given")
+	}
+
+	unlock, err := r.lock(ctx, false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	sn, err := r.findSnapshot(ctx, snapshotID)
+	if err != nil {
+		return err
+	}
+
+	if err := r.loadIndex(ctx); err != nil {
+		return err
+	}
+
+	var progress *restoreui.Progress
+	if opts.Progress != nil {
+		progress = restoreui.NewProgress(restoreProgressPrinter{fn: opts.Progress}, opts.ProgressInterval)
+	}
+
+	res := restorer.NewRestorer(r.repo, sn, opts.Sparse, progress)
+	if opts.Error != nil {
+		res.Error = opts.Error
+	}
+
+	err = res.RestoreTo(ctx, target)
+	if progress != nil {
+		progress.Finish()
+	}
+	return err
+}
@@ -0,0 +1,114 @@
+package restic
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	irestic "github.com/restic/restic/internal/restic"
+)
+
+// Snapshot describes a snapshot stored in the repository.
+type Snapshot struct {
+	ID       string
+	Time     time.Time
+	Parent   string
+	Paths    []string
+	Hostname string
+	Username string
+	Tags     []string
+}
+
+func newSnapshot(id irestic.ID, sn *irestic.Snapshot) Snapshot {
+	s := Snapshot{
+		ID:       id.String(),
+		Time:     sn.Time,
+		Paths:    sn.Paths,
+		Hostname: sn.Hostname,
+		Username: sn.Username,
+		Tags:     sn.Tags,
+	}
+	if sn.Parent != nil {
+		s.Parent = sn.Parent.String()
+	}
+	return s
+}
+
+// SnapshotFilter selects snapshots. Empty fields match all snapshots.
+type SnapshotFilter struct {
+	// Hosts matches snapshots created on one of the hosts.
+	Hosts []string
+	// Tags matches snapshots which have all of the tags.
+	Tags []string
+	// Paths matches snapshots which contain all of the paths.
+	Paths []string
+}
+
+func (f SnapshotFilter) filter() *irestic.SnapshotFilter {
+	filter := &irestic.SnapshotFilter{
+		Hosts:      f.Hosts,
+		Paths:      f.Paths,
+		ExactPaths: true,
+	}
+	if len(f.Tags) > 0 {
+		filter.Tags = irestic.TagLists{irestic.TagList(f.Tags)}
+	}
+	return filter
+}
+
+// Snapshots returns all snapshots which match the filter, oldest first.
+func (r *Repository) Snapshots(ctx context.Context, filter SnapshotFilter) ([]Snapshot, error) {
+	unlock, err := r.lock(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	list, err := r.findSnapshots(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]Snapshot, 0, len(list))
+	for _, sn := range list {
+		snapshots = append(snapshots, newSnapshot(*sn.ID(), sn))
+	}
+	return snapshots, nil
+}
+
+func (r *Repository) findSnapshots(ctx context.Context, filter SnapshotFilter) (irestic.Snapshots, error) {
+	var list irestic.Snapshots
+	err := filter.filter().FindAll(ctx, r.repo.Backend(), r.repo, nil, func(_ string, sn *irestic.Snapshot, err error) error {
+		if err != nil {
+			return err
+		}
+		list = append(list, sn)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Time.Before(list[j].Time)
+	})
+	return list, nil
+}
+
+// findSnapshot returns the snapshot with the given ID or ID prefix. The ID
+// "latest" selects the latest snapshot.
+func (r *Repository) findSnapshot(ctx context.Context, id string) (*irestic.Snapshot, error) {
+	sn, subfolder, err := (&irestic.SnapshotFilter{}).FindLatest(ctx, r.repo.Backend(), r.repo, id)
+	if err != nil {
+		var noID *irestic.NoIDByPrefixError
+		if errors.Is(err, irestic.ErrNoSnapshotFound) || errors.As(err, &noID) || r.repo.Backend().IsNotExist(err) {
+			return nil, ErrNoSnapshot
+		}
+		return nil, err
+	}
+	if subfolder != "" {
+		return nil, irestic.ErrInvalidSnapshotSyntax
+	}
+	return sn, nil
+}